@@ -0,0 +1,145 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/pkg/ocibundle/tools"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engine/singularity/config"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// actionBundle is an OCI bundle directory, holding a config.json file and a
+// root filesystem, used as the image of the action commands. The bundle
+// process defaults apply like the ones of an image: its environment
+// overrides the host environment but not SINGULARITYENV_ variables, its
+// working directory and arguments only apply when not set by the command.
+type actionBundle struct {
+	path   string
+	rootfs string
+	spec   specs.Spec
+}
+
+// loadActionBundle returns the OCI bundle found at path, or nil if path
+// isn't an OCI bundle directory.
+func loadActionBundle(path string) (*actionBundle, error) {
+	config := tools.Config(path).Path()
+	if !fs.IsDir(path) || !fs.IsFile(config) {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(config)
+	if err != nil {
+		return nil, fmt.Errorf("while reading %s: %s", config, err)
+	}
+	b := &actionBundle{path: path}
+	// a sandbox image may hold a config.json file unrelated to OCI
+	if err := json.Unmarshal(data, &b.spec); err != nil || b.spec.Version == "" {
+		sylog.Debugf("%s is not an OCI bundle configuration", config)
+		return nil, nil
+	}
+
+	b.rootfs = "rootfs"
+	if b.spec.Root != nil && b.spec.Root.Path != "" {
+		b.rootfs = b.spec.Root.Path
+	}
+	if !filepath.IsAbs(b.rootfs) {
+		b.rootfs = filepath.Join(path, b.rootfs)
+	}
+	if !fs.IsDir(b.rootfs) {
+		return nil, fmt.Errorf("OCI bundle root filesystem %s is not a directory", b.rootfs)
+	}
+	return b, nil
+}
+
+// readOnly returns true if the bundle root filesystem is read-only.
+func (b *actionBundle) readOnly() bool {
+	return b.spec.Root != nil && b.spec.Root.Readonly
+}
+
+// processArgs returns the container process arguments for the action
+// arguments args: the run action executes the bundle process arguments
+// followed by the action arguments, other actions are left unchanged.
+func (b *actionBundle) processArgs(args []string) []string {
+	if len(args) == 0 || args[0] != "/.singularity.d/actions/run" || b.spec.Process == nil {
+		return args
+	}
+	bundleArgs := b.spec.Process.Args
+	// bundles created by "singularity oci mount" run the image runscript
+	if len(bundleArgs) == 0 || bundleArgs[0] == tools.RunScript {
+		return args
+	}
+	a := append([]string{"/.singularity.d/actions/exec"}, bundleArgs...)
+	return append(a, args[1:]...)
+}
+
+// processEnv returns the bundle process environment, except HOME which is
+// set by Singularity.
+func (b *actionBundle) processEnv() map[string]string {
+	env := make(map[string]string)
+	if b.spec.Process == nil {
+		return env
+	}
+	for _, e := range b.spec.Process.Env {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[0] == "HOME" {
+			continue
+		}
+		env[kv[0]] = kv[1]
+	}
+	return env
+}
+
+// processCwd returns the bundle process working directory, or an empty
+// string if it is the default one, the root directory.
+func (b *actionBundle) processCwd() string {
+	if b.spec.Process == nil || filepath.Clean("/"+b.spec.Process.Cwd) == "/" {
+		return ""
+	}
+	return b.spec.Process.Cwd
+}
+
+// bindPaths returns the bind mounts of the bundle, relative sources are
+// relative to the bundle directory. Other mounts, like proc or tmpfs, are
+// set up by Singularity.
+func (b *actionBundle) bindPaths() []singularityConfig.BindPath {
+	var binds []singularityConfig.BindPath
+	for _, m := range b.spec.Mounts {
+		bind := m.Type == "bind"
+		readOnly := false
+		for _, o := range m.Options {
+			switch o {
+			case "bind", "rbind":
+				bind = true
+			case "ro":
+				readOnly = true
+			}
+		}
+		if !bind || m.Destination == "" {
+			continue
+		}
+
+		bp := singularityConfig.BindPath{
+			Source:      m.Source,
+			Destination: m.Destination,
+		}
+		if !filepath.IsAbs(bp.Source) {
+			bp.Source = filepath.Join(b.path, bp.Source)
+		}
+		if readOnly {
+			bp.Options = map[string]*singularityConfig.BindOption{"ro": {}}
+		}
+		binds = append(binds, bp)
+	}
+	return binds
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engine/singularity/config"
+)
+
+// writeBundle writes an OCI bundle in a new directory of dir with the
+// configuration spec, or the raw configuration data if spec is nil.
+func writeBundle(t *testing.T, dir, name string, spec *specs.Spec, data string) string {
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Join(path, "rootfs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if spec != nil {
+		b, err := json.Marshal(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = string(b)
+	}
+	if err := ioutil.WriteFile(filepath.Join(path, "config.json"), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadActionBundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "action-bundle-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name       string
+		spec       *specs.Spec
+		data       string
+		wantBundle bool
+		wantRootfs string
+		wantErr    bool
+	}{
+		{
+			name:       "DefaultRoot",
+			spec:       &specs.Spec{Version: specs.Version},
+			wantBundle: true,
+			wantRootfs: "rootfs",
+		},
+		{
+			name:       "RelativeRoot",
+			spec:       &specs.Spec{Version: specs.Version, Root: &specs.Root{Path: "rootfs/"}},
+			wantBundle: true,
+			wantRootfs: "rootfs",
+		},
+		{
+			name:    "MissingRoot",
+			spec:    &specs.Spec{Version: specs.Version, Root: &specs.Root{Path: "missing"}},
+			wantErr: true,
+		},
+		{
+			name: "NotOCI",
+			data: `{"key": "value"}`,
+		},
+		{
+			name: "NotJSON",
+			data: "key = value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeBundle(t, dir, tt.name, tt.spec, tt.data)
+
+			b, err := loadActionBundle(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("unexpected success")
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !tt.wantBundle {
+				if b != nil {
+					t.Fatalf("unexpected bundle")
+				}
+				return
+			}
+			if b == nil {
+				t.Fatalf("bundle not found")
+			}
+			if want := filepath.Join(path, tt.wantRootfs); b.rootfs != want {
+				t.Errorf("got root filesystem %s, want %s", b.rootfs, want)
+			}
+		})
+	}
+
+	// a directory without configuration isn't a bundle
+	if b, err := loadActionBundle(dir); b != nil || err != nil {
+		t.Errorf("unexpected bundle %v or error %v for %s", b, err, dir)
+	}
+}
+
+func TestActionBundleProcess(t *testing.T) {
+	b := &actionBundle{
+		path: "/bundle",
+		spec: specs.Spec{
+			Process: &specs.Process{
+				Args: []string{"/bin/server", "--port", "80"},
+				Env:  []string{"PATH=/opt/bin:/bin", "HOME=/root", "EMPTY=", "INVALID"},
+				Cwd:  "/srv",
+			},
+			Mounts: []specs.Mount{
+				{Destination: "/proc", Type: "proc", Source: "proc"},
+				{Destination: "/data", Type: "bind", Source: "/host/data", Options: []string{"rbind", "ro"}},
+				{Destination: "/config", Source: "config", Options: []string{"bind"}},
+			},
+		},
+	}
+
+	args := b.processArgs([]string{"/.singularity.d/actions/run", "--debug"})
+	wantArgs := []string{"/.singularity.d/actions/exec", "/bin/server", "--port", "80", "--debug"}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("got run arguments %v, want %v", args, wantArgs)
+	}
+	execArgs := []string{"/.singularity.d/actions/exec", "true"}
+	if args := b.processArgs(execArgs); !reflect.DeepEqual(args, execArgs) {
+		t.Errorf("got exec arguments %v, want %v", args, execArgs)
+	}
+
+	wantEnv := map[string]string{"PATH": "/opt/bin:/bin", "EMPTY": ""}
+	if env := b.processEnv(); !reflect.DeepEqual(env, wantEnv) {
+		t.Errorf("got environment %v, want %v", env, wantEnv)
+	}
+
+	if cwd := b.processCwd(); cwd != "/srv" {
+		t.Errorf("got working directory %q, want /srv", cwd)
+	}
+
+	wantBinds := []singularityConfig.BindPath{
+		{
+			Source:      "/host/data",
+			Destination: "/data",
+			Options:     map[string]*singularityConfig.BindOption{"ro": {}},
+		},
+		{Source: "/bundle/config", Destination: "/config"},
+	}
+	if binds := b.bindPaths(); !reflect.DeepEqual(binds, wantBinds) {
+		t.Errorf("got binds %v, want %v", binds, wantBinds)
+	}
+
+	// bundles created by "singularity oci mount" run the image runscript
+	// from the root directory
+	b.spec.Process = &specs.Process{Args: []string{"/.singularity.d/actions/run"}, Cwd: "/"}
+	runArgs := []string{"/.singularity.d/actions/run", "arg"}
+	if args := b.processArgs(runArgs); !reflect.DeepEqual(args, runArgs) {
+		t.Errorf("got run arguments %v, want %v", args, runArgs)
+	}
+	if cwd := b.processCwd(); cwd != "" {
+		t.Errorf("got working directory %q, want none", cwd)
+	}
+}
@@ -14,13 +14,20 @@ import (
 // actionflags.go contains flag variables for action-like commands to draw from
 var (
 	AppName            string
+	AppOrder           []string
+	AppExit            string
+	ScifDataPath       string
+	ScifDataQuota      int
 	BindPaths          []string
+	Devices            []string
 	HomePath           string
 	OverlayPath        []string
 	ScratchPath        []string
 	WorkdirPath        string
 	PwdPath            string
+	PidFile            string
 	ShellPath          string
+	HistoryFile        string
 	Hostname           string
 	Network            string
 	NetworkArgs        []string
@@ -34,6 +41,13 @@ var (
 	FuseMount          []string
 	SingularityEnv     []string
 	SingularityEnvFile string
+	ShmSize            string
+	TmpMount           string
+	VarTmpMount        string
+	Timeout            string
+	MaxOutput          int
+	Rlimits            []string
+	Profiles           []string
 
 	IsBoot          bool
 	IsFakeroot      bool
@@ -42,17 +56,27 @@ var (
 	IsContainAll    bool
 	IsWritable      bool
 	IsWritableTmpfs bool
+	BindCgroups     bool
 	Nvidia          bool
 	Rocm            bool
 	NoHome          bool
 	NoInit          bool
+	NoPivot         bool
+	ReadOnly        bool
+	DryRun          bool
 	NoNvidia        bool
 	NoRocm          bool
 	NoUmask         bool
+	SanitizePath    bool
 	VM              bool
 	VMErr           bool
 	NoNet           bool
 	IsSyOS          bool
+	NoRC            bool
+	Pty             bool
+	NoPty           bool
+	RootfsROCheck   bool
+	NoFork          bool
 	disableCache    bool
 
 	NetNamespace  bool
@@ -61,13 +85,39 @@ var (
 	PidNamespace  bool
 	IpcNamespace  bool
 
-	AllowSUID bool
-	KeepPrivs bool
-	NoPrivs   bool
-	AddCaps   string
-	DropCaps  string
+	AllowSUID        bool
+	OverrideSUID     bool
+	KeepPrivs        bool
+	KeepPrivsPrelude string
+	NoPrivs          bool
+	AddCaps          string
+	DropCaps         string
 )
 
+// --pid-file
+var actionPidFileFlag = cmdline.Flag{
+	ID:           "actionPidFileFlag",
+	Value:        &PidFile,
+	DefaultValue: "",
+	Name:         "pid-file",
+	Usage:        "write the host PID of the container process to the file with the given name once it's running, the file is removed when the container exits",
+	EnvKeys:      []string{"PID_FILE"},
+	Tag:          "<path>",
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// --scif-data-quota
+var actionScifDataQuotaFlag = cmdline.Flag{
+	ID:           "actionScifDataQuotaFlag",
+	Value:        &ScifDataQuota,
+	DefaultValue: 0,
+	Name:         "scif-data-quota",
+	Usage:        "limit the size of the temporary data directory of the application set with --app, stored in a disk image in the temporary directory, writing beyond fails with ENOSPC (No space left on device)",
+	EnvKeys:      []string{"SCIF_DATA_QUOTA"},
+	Tag:          "<MiB>",
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
 // --app
 var actionAppFlag = cmdline.Flag{
 	ID:           "actionAppFlag",
@@ -79,6 +129,42 @@ var actionAppFlag = cmdline.Flag{
 	ExcludedOS:   []string{cmdline.Darwin},
 }
 
+// --scif-data
+var actionScifDataFlag = cmdline.Flag{
+	ID:           "actionScifDataFlag",
+	Value:        &ScifDataPath,
+	DefaultValue: "",
+	Name:         "scif-data",
+	Usage:        "host directory bound to the data directory of the application set with --app (/scif/data/<app>) to persist its outputs",
+	EnvKeys:      []string{"SCIF_DATA"},
+	Tag:          "<path>",
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// --app-order
+var actionAppOrderFlag = cmdline.Flag{
+	ID:           "actionAppOrderFlag",
+	Value:        &AppOrder,
+	DefaultValue: []string{},
+	Name:         "app-order",
+	Usage:        "run a comma separated list of applications one after the other in the given order",
+	EnvKeys:      []string{"APP_ORDER"},
+	Tag:          "<app,...>",
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// --app-exit
+var actionAppExitFlag = cmdline.Flag{
+	ID:           "actionAppExitFlag",
+	Value:        &AppExit,
+	DefaultValue: "last",
+	Name:         "app-exit",
+	Usage:        "select which non-zero application exit code is returned with --app-order: 'last' or 'first'",
+	EnvKeys:      []string{"APP_EXIT"},
+	Tag:          "<last|first>",
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
 // -B|--bind
 var actionBindFlag = cmdline.Flag{
 	ID:           "actionBindFlag",
@@ -86,12 +172,25 @@ var actionBindFlag = cmdline.Flag{
 	DefaultValue: []string{},
 	Name:         "bind",
 	ShortHand:    "B",
-	Usage:        "a user-bind path specification.  spec has the format src[:dest[:opts]], where src and dest are outside and inside paths.  If dest is not given, it is set equal to src.  Mount options ('opts') may be specified as 'ro' (read-only) or 'rw' (read/write, which is the default). Multiple bind paths can be given by a comma separated list.",
+	Usage:        "a user-bind path specification.  spec has the format src[:dest[:opts]], where src and dest are outside and inside paths.  If dest is not given, it is set equal to src.  Mount options ('opts') may be specified as 'ro' (read-only) or 'rw' (read/write, which is the default), 'optional' skips the bind with a warning if src doesn't exist, 'idmap' translates the ownership of src through the container user namespace ID mappings (Linux 5.12+). 'chown=uid:gid' binds a copy of src owned by the numeric uid and gid, made in the session directory when idmapped mounts aren't available: src is copied rather than bound, so changes in the container are not written back to the host, non-root users can only give their own IDs or IDs mapped in the container user namespace. 'nosuid', 'nodev' and 'noexec' set the corresponding mount flags, 'suid' and 'dev' clear them for root without user namespace. A src with wildcards (e.g. '/scratch/job-*:/scratch/') binds each matching path, under its name in dest if dest ends with a '/'. Multiple bind paths can be given by a comma separated list.",
 	EnvKeys:      []string{"BIND", "BINDPATH"},
 	Tag:          "<spec>",
 	EnvHandler:   cmdline.EnvAppendValue,
 }
 
+// --device
+var actionDeviceFlag = cmdline.Flag{
+	ID:           "actionDeviceFlag",
+	Value:        &Devices,
+	DefaultValue: []string{},
+	Name:         "device",
+	Usage:        "pass a host block or character device into the container (root only).  spec has the format src[:dest][:ro|rw], dest must be in /dev and is set equal to src if not given.  Devices are writable by default, writes to a 'ro' device are denied by the devices cgroup.",
+	EnvKeys:      []string{"DEVICE"},
+	Tag:          "<spec>",
+	EnvHandler:   cmdline.EnvAppendValue,
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
 // -H|--home
 var actionHomeFlag = cmdline.Flag{
 	ID:           "actionHomeFlag",
@@ -166,15 +265,95 @@ var actionShellFlag = cmdline.Flag{
 	ExcludedOS:   []string{cmdline.Darwin},
 }
 
-// --pwd
+// --norc
+var actionNoRCFlag = cmdline.Flag{
+	ID:           "actionNoRCFlag",
+	Value:        &NoRC,
+	DefaultValue: false,
+	Name:         "norc",
+	Usage:        "start the interactive shell without reading its startup files (bashrc, zshrc, $ENV)",
+	EnvKeys:      []string{"NORC"},
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// --pty
+var actionPtyFlag = cmdline.Flag{
+	ID:           "actionPtyFlag",
+	Value:        &Pty,
+	DefaultValue: false,
+	Name:         "pty",
+	Usage:        "run the command in a pseudo terminal even if the standard streams are not all terminals",
+	EnvKeys:      []string{"PTY"},
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// --no-pty
+var actionNoPtyFlag = cmdline.Flag{
+	ID:           "actionNoPtyFlag",
+	Value:        &NoPty,
+	DefaultValue: false,
+	Name:         "no-pty",
+	Usage:        "never run the command in a pseudo terminal, it uses the standard streams directly",
+	EnvKeys:      []string{"NO_PTY"},
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// --rootfs-ro-check
+var actionRootfsROCheckFlag = cmdline.Flag{
+	ID:           "actionRootfsROCheckFlag",
+	Value:        &RootfsROCheck,
+	DefaultValue: false,
+	Name:         "rootfs-ro-check",
+	Usage:        "fail the run if the image was modified by it, or was mounted writable",
+	EnvKeys:      []string{"ROOTFS_RO_CHECK"},
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// --no-fork
+var actionNoForkFlag = cmdline.Flag{
+	ID:           "actionNoForkFlag",
+	Value:        &NoFork,
+	DefaultValue: false,
+	Name:         "no-fork",
+	Usage:        "ensure the container command is a direct child of the singularity process, so its resource usage is accounted to it. The process tree is already direct by default when no option requires a supervising process, with --no-fork exec doesn't allocate a pseudo terminal and --pty, --timeout, --max-output, --rootfs-ro-check or a PID namespace without --no-init are refused",
+	EnvKeys:      []string{"NO_FORK"},
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// --history-file
+var actionHistoryFileFlag = cmdline.Flag{
+	ID:           "actionHistoryFileFlag",
+	Value:        &HistoryFile,
+	DefaultValue: "",
+	Name:         "history-file",
+	Usage:        "path of the interactive shell history file in the container, 'none' to not record history, 'host' to keep the host history file (default: a file per image in ~/.singularity/shell_history)",
+	EnvKeys:      []string{"HISTORY_FILE"},
+	Tag:          "<path>",
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// --cwd
+var actionCwdFlag = cmdline.Flag{
+	ID:           "actionCwdFlag",
+	Value:        &PwdPath,
+	DefaultValue: "",
+	Name:         "cwd",
+	Usage:        "initial working directory for payload process inside the container, a relative path is resolved against the default container working directory",
+	EnvKeys:      []string{"CWD"},
+	Tag:          "<path>",
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// --pwd is kept as an hidden alias of --cwd
 var actionPwdFlag = cmdline.Flag{
 	ID:           "actionPwdFlag",
 	Value:        &PwdPath,
 	DefaultValue: "",
 	Name:         "pwd",
-	Usage:        "initial working directory for payload process inside the container",
+	Usage:        "initial working directory for payload process inside the container (alias of --cwd)",
 	EnvKeys:      []string{"PWD", "TARGET_PWD"},
 	Tag:          "<path>",
+	Hidden:       true,
 	ExcludedOS:   []string{cmdline.Darwin},
 }
 
@@ -220,7 +399,7 @@ var actionDNSFlag = cmdline.Flag{
 	Value:        &DNS,
 	DefaultValue: "",
 	Name:         "dns",
-	Usage:        "list of DNS server separated by commas to add in resolv.conf",
+	Usage:        "list of DNS server separated by commas to add in resolv.conf, IPv6 link-local addresses take a %<interface> suffix, ignored when /etc/resolv.conf is bound with --bind",
 	EnvKeys:      []string{"DNS"},
 	ExcludedOS:   []string{cmdline.Darwin},
 }
@@ -231,7 +410,7 @@ var actionSecurityFlag = cmdline.Flag{
 	Value:        &Security,
 	DefaultValue: []string{},
 	Name:         "security",
-	Usage:        "enable security features (SELinux, Apparmor, Seccomp)",
+	Usage:        "enable security features (SELinux, Apparmor, Seccomp), restrict filesystem access with a Landlock ruleset (landlock:ro=<path>,rw=<path>) or run as another UID/GID (uid:<id>, gid:<id>) or ignore setuid bits and file capabilities (nofilecaps)",
 	EnvKeys:      []string{"SECURITY"},
 	ExcludedOS:   []string{cmdline.Darwin},
 }
@@ -427,6 +606,17 @@ var actionWritableTmpfsFlag = cmdline.Flag{
 	ExcludedOS:   []string{cmdline.Darwin},
 }
 
+// --bind-cgroups
+var actionBindCgroupsFlag = cmdline.Flag{
+	ID:           "actionBindCgroupsFlag",
+	Value:        &BindCgroups,
+	DefaultValue: false,
+	Name:         "bind-cgroups",
+	Usage:        "bind the host cgroup v2 hierarchy read-write at /sys/fs/cgroup to run container engines in the container (root only, gives control over all host cgroups)",
+	EnvKeys:      []string{"BIND_CGROUPS"},
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
 // --no-home
 var actionNoHomeFlag = cmdline.Flag{
 	ID:           "actionNoHomeFlag",
@@ -449,6 +639,38 @@ var actionNoInitFlag = cmdline.Flag{
 	ExcludedOS:   []string{cmdline.Darwin},
 }
 
+// --no-pivot
+var actionNoPivotFlag = cmdline.Flag{
+	ID:           "actionNoPivotFlag",
+	Value:        &NoPivot,
+	DefaultValue: false,
+	Name:         "no-pivot",
+	Usage:        "use chroot instead of pivot_root to enter the container root filesystem, for environments disallowing pivot_root (less secure: the host filesystem stays reachable by privileged processes)",
+	EnvKeys:      []string{"NO_PIVOT"},
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// --read-only
+var actionReadOnlyFlag = cmdline.Flag{
+	ID:           "actionReadOnlyFlag",
+	Value:        &ReadOnly,
+	DefaultValue: false,
+	Name:         "read-only",
+	Usage:        "force a read-only container root filesystem, overlay images are only used as read-only lower layers",
+	EnvKeys:      []string{"READ_ONLY"},
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// --dry-run
+var actionDryRunFlag = cmdline.Flag{
+	ID:           "actionDryRunFlag",
+	Value:        &DryRun,
+	DefaultValue: false,
+	Name:         "dry-run",
+	Usage:        "only check the options for incompatibilities and exit, without running the container",
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
 // hidden flag to disable nvidia bindings when 'always use nv = yes'
 var actionNoNvidiaFlag = cmdline.Flag{
 	ID:           "actionNoNvidiaFlag",
@@ -572,6 +794,17 @@ var actionKeepPrivsFlag = cmdline.Flag{
 	ExcludedOS:   []string{cmdline.Darwin},
 }
 
+// --keep-privs-prelude
+var actionKeepPrivsPreludeFlag = cmdline.Flag{
+	ID:           "actionKeepPrivsPreludeFlag",
+	Value:        &KeepPrivsPrelude,
+	DefaultValue: "",
+	Name:         "keep-privs-prelude",
+	Usage:        "run a shell command in container with the root user privileges kept, then drop them for the container command (root only)",
+	EnvKeys:      []string{"KEEP_PRIVS_PRELUDE"},
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
 // --no-privs
 var actionNoPrivsFlag = cmdline.Flag{
 	ID:           "actionNoPrivsFlag",
@@ -616,6 +849,17 @@ var actionAllowSetuidFlag = cmdline.Flag{
 	ExcludedOS:   []string{cmdline.Darwin},
 }
 
+// --override-setuid-policy
+var actionOverrideSetuidPolicyFlag = cmdline.Flag{
+	ID:           "actionOverrideSetuidPolicyFlag",
+	Value:        &OverrideSUID,
+	DefaultValue: false,
+	Name:         "override-setuid-policy",
+	Usage:        "honor --allow-setuid when setuid binaries are denied by the configuration (root only)",
+	EnvKeys:      []string{"OVERRIDE_SETUID_POLICY"},
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
 // --env
 var actionEnvFlag = cmdline.Flag{
 	ID:           "actionEnvFlag",
@@ -648,6 +892,201 @@ var actionNoUmaskFlag = cmdline.Flag{
 	ExcludedOS:   []string{cmdline.Darwin},
 }
 
+// --sanitize-path
+var actionSanitizePathFlag = cmdline.Flag{
+	ID:           "actionSanitizePathFlag",
+	Value:        &SanitizePath,
+	DefaultValue: false,
+	Name:         "sanitize-path",
+	Usage:        "reset PATH to the default container PATH (/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin) once the container environment is set, the default is set by 'sanitize path' in singularity.conf",
+	EnvKeys:      []string{"SANITIZE_PATH"},
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// --shm-size
+var actionShmSizeFlag = cmdline.Flag{
+	ID:           "actionShmSizeFlag",
+	Value:        &ShmSize,
+	DefaultValue: "",
+	Name:         "shm-size",
+	Usage:        "size of the container /dev/shm temporary filesystem (e.g. 256M), by default the host /dev/shm is shared unless --contain is used",
+	EnvKeys:      []string{"SHM_SIZE"},
+	Tag:          "<size>",
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// --tmp
+var actionTmpFlag = cmdline.Flag{
+	ID:           "actionTmpFlag",
+	Value:        &TmpMount,
+	DefaultValue: "",
+	Name:         "tmp",
+	Usage:        "host directory to mount on the container /tmp, or 'tmpfs' for a private temporary filesystem, by default the host /tmp is shared unless --contain is used",
+	EnvKeys:      []string{"TMP_MOUNT"},
+	Tag:          "<dir|tmpfs>",
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// --var-tmp
+var actionVarTmpFlag = cmdline.Flag{
+	ID:           "actionVarTmpFlag",
+	Value:        &VarTmpMount,
+	DefaultValue: "",
+	Name:         "var-tmp",
+	Usage:        "host directory to mount on the container /var/tmp, or 'tmpfs' for a private temporary filesystem, by default the host /var/tmp is shared unless --contain is used",
+	EnvKeys:      []string{"VAR_TMP_MOUNT"},
+	Tag:          "<dir|tmpfs>",
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// --timeout
+var actionTimeoutFlag = cmdline.Flag{
+	ID:           "actionTimeoutFlag",
+	Value:        &Timeout,
+	DefaultValue: "",
+	Name:         "timeout",
+	Usage:        "terminate the container process and its process group with SIGTERM once it has run for the given duration (e.g. 30m), then with SIGKILL after 10 seconds, the exit code is 124 like timeout(1)",
+	EnvKeys:      []string{"TIMEOUT"},
+	Tag:          "<duration>",
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// --max-output
+var actionMaxOutputFlag = cmdline.Flag{
+	ID:           "actionMaxOutputFlag",
+	Value:        &MaxOutput,
+	DefaultValue: 0,
+	Name:         "max-output",
+	Usage:        "truncate the container standard output and error after the given number of bytes each, when they are not a terminal",
+	EnvKeys:      []string{"MAX_OUTPUT"},
+	Tag:          "<bytes>",
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// --rlimit
+var actionRlimitFlag = cmdline.Flag{
+	ID:           "actionRlimitFlag",
+	Value:        &Rlimits,
+	DefaultValue: []string{},
+	Name:         "rlimit",
+	Usage:        "set a resource limit of the container process, spec has the format name=soft[:hard] where name is one of core, memlock, nofile, nproc or stack, and soft and hard are a number (with a K, M or G suffix for core, memlock and stack) or 'unlimited', hard is equal to soft if not given. Limits above the maximum set by the administrator are clamped. Multiple limits can be given by a comma separated list.",
+	EnvKeys:      []string{"RLIMIT"},
+	Tag:          "<spec>",
+	EnvHandler:   cmdline.EnvAppendValue,
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// --profile
+var actionProfileFlag = cmdline.Flag{
+	ID:           "actionProfileFlag",
+	Value:        &Profiles,
+	DefaultValue: []string{},
+	Name:         "profile",
+	Usage:        "apply a bind profile defined by the administrator, binding host files and setting environment variables and library paths in the container. Profile binds are mounted before the user binds and profile variables are overridden by the ones set by the user. Multiple profiles can be given by a comma separated list.",
+	EnvKeys:      []string{"PROFILE"},
+	Tag:          "<name>",
+	EnvHandler:   cmdline.EnvAppendValue,
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// actionFlags holds the flags shared by the action commands and instance
+// start, both flag sets are generated from this list so a new action flag
+// is automatically available for instance start, unless the flag is listed
+// in instanceUnsupportedFlags.
+var actionFlags = []*cmdline.Flag{
+	&actionAddCapsFlag,
+	&actionAllowSetuidFlag,
+	&actionOverrideSetuidPolicyFlag,
+	&actionAppFlag,
+	&actionApplyCgroupsFlag,
+	&actionBindCgroupsFlag,
+	&actionBindFlag,
+	&actionCleanEnvFlag,
+	&actionContainAllFlag,
+	&actionContainFlag,
+	&actionContainLibsFlag,
+	&actionCwdFlag,
+	&actionDeviceFlag,
+	&actionDisableCacheFlag,
+	&actionDNSFlag,
+	&actionDropCapsFlag,
+	&actionDryRunFlag,
+	&actionFakerootFlag,
+	&actionFuseMountFlag,
+	&actionHomeFlag,
+	&actionHostnameFlag,
+	&actionIpcNamespaceFlag,
+	&actionKeepPrivsFlag,
+	&actionKeepPrivsPreludeFlag,
+	&actionNetNamespaceFlag,
+	&actionNetworkArgsFlag,
+	&actionNetworkFlag,
+	&actionNoHomeFlag,
+	&actionNoInitFlag,
+	&actionNoPivotFlag,
+	&actionNONETFlag,
+	&actionNoNvidiaFlag,
+	&actionNoRocmFlag,
+	&actionNoPrivsFlag,
+	&actionNvidiaFlag,
+	&actionRocmFlag,
+	&actionOverlayFlag,
+	&commonPromptForPassphraseFlag,
+	&commonPEMFlag,
+	&actionPidNamespaceFlag,
+	&actionPwdFlag,
+	&actionReadOnlyFlag,
+	&actionScifDataFlag,
+	&actionScifDataQuotaFlag,
+	&actionScratchFlag,
+	&actionSecurityFlag,
+	&actionShmSizeFlag,
+	&actionTmpDirFlag,
+	&actionTmpFlag,
+	&actionUserNamespaceFlag,
+	&actionUtsNamespaceFlag,
+	&actionVarTmpFlag,
+	&actionVMCPUFlag,
+	&actionVMErrFlag,
+	&actionVMFlag,
+	&actionVMIPFlag,
+	&actionVMRAMFlag,
+	&actionWorkdirFlag,
+	&actionWritableFlag,
+	&actionWritableTmpfsFlag,
+	&commonNoHTTPSFlag,
+	&commonRegistryInsecureFlag,
+	&dockerLoginFlag,
+	&dockerPasswordFlag,
+	&dockerUsernameFlag,
+	&actionEnvFlag,
+	&actionEnvFileFlag,
+	&actionNoUmaskFlag,
+	&actionSanitizePathFlag,
+	&actionTimeoutFlag,
+	&actionMaxOutputFlag,
+	&actionRlimitFlag,
+	&actionProfileFlag,
+}
+
+// instanceUnsupportedFlags maps the name of action flags which can't be
+// honored by instance start to the reason reported to the user. Those flags
+// are still registered for instance start but are hidden and rejected at
+// runtime rather than being reported as unknown flags.
+var instanceUnsupportedFlags = map[string]string{
+	"app":             "an instance always executes the container startscript",
+	"scif-data":       "an instance doesn't run an application set with --app",
+	"scif-data-quota": "an instance doesn't run an application set with --app",
+	"nonet":           "instances can't be started in a virtual machine",
+	"vm":              "instances can't be started in a virtual machine",
+	"vm-cpu":          "instances can't be started in a virtual machine",
+	"vm-err":          "instances can't be started in a virtual machine",
+	"vm-ip":           "instances can't be started in a virtual machine",
+	"vm-ram":          "instances can't be started in a virtual machine",
+	"timeout":         "an instance runs until it's stopped, use 'instance stop --timeout' to bound the time it's given to exit",
+	"max-output":      "the output of an instance is written to its log files",
+}
+
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterCmd(ExecCmd)
@@ -668,61 +1107,29 @@ func init() {
 
 		initPlatformDefaults()
 
-		cmdManager.RegisterFlagForCmd(&actionAddCapsFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionAllowSetuidFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionAppFlag, actionsCmd...)
-		cmdManager.RegisterFlagForCmd(&actionApplyCgroupsFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionBindFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionCleanEnvFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionContainAllFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionContainFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionContainLibsFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionDisableCacheFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionDNSFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionDropCapsFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionFakerootFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionFuseMountFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionHomeFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionHostnameFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionIpcNamespaceFlag, actionsCmd...)
-		cmdManager.RegisterFlagForCmd(&actionKeepPrivsFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionNetNamespaceFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionNetworkArgsFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionNetworkFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionNoHomeFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionNoInitFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionNONETFlag, actionsCmd...)
-		cmdManager.RegisterFlagForCmd(&actionNoNvidiaFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionNoRocmFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionNoPrivsFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionNvidiaFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionRocmFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionOverlayFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&commonPromptForPassphraseFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&commonPEMFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionPidNamespaceFlag, actionsCmd...)
-		cmdManager.RegisterFlagForCmd(&actionPwdFlag, actionsCmd...)
-		cmdManager.RegisterFlagForCmd(&actionScratchFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionSecurityFlag, actionsInstanceCmd...)
+		for _, flag := range actionFlags {
+			cmdManager.RegisterFlagForCmd(flag, actionsInstanceCmd...)
+		}
+
+		if instanceStartCmd != nil {
+			for name := range instanceUnsupportedFlags {
+				instanceStartCmd.Flags().MarkHidden(name)
+			}
+		}
+
+		cmdManager.RegisterFlagForCmd(&actionPidFileFlag, ExecCmd, RunCmd)
+		if instanceStartCmd != nil {
+			cmdManager.RegisterFlagForCmd(&actionPidFileFlag, instanceStartCmd)
+		}
+		cmdManager.RegisterFlagForCmd(&actionAppOrderFlag, RunCmd)
+		cmdManager.RegisterFlagForCmd(&actionAppExitFlag, RunCmd)
 		cmdManager.RegisterFlagForCmd(&actionShellFlag, ShellCmd)
 		cmdManager.RegisterFlagForCmd(&actionSyOSFlag, ShellCmd)
-		cmdManager.RegisterFlagForCmd(&actionTmpDirFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionUserNamespaceFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionUtsNamespaceFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionVMCPUFlag, actionsCmd...)
-		cmdManager.RegisterFlagForCmd(&actionVMErrFlag, actionsCmd...)
-		cmdManager.RegisterFlagForCmd(&actionVMFlag, actionsCmd...)
-		cmdManager.RegisterFlagForCmd(&actionVMIPFlag, actionsCmd...)
-		cmdManager.RegisterFlagForCmd(&actionVMRAMFlag, actionsCmd...)
-		cmdManager.RegisterFlagForCmd(&actionWorkdirFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionWritableFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionWritableTmpfsFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&commonNoHTTPSFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&dockerLoginFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&dockerPasswordFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&dockerUsernameFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionEnvFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionEnvFileFlag, actionsInstanceCmd...)
-		cmdManager.RegisterFlagForCmd(&actionNoUmaskFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionNoRCFlag, ShellCmd)
+		cmdManager.RegisterFlagForCmd(&actionHistoryFileFlag, ShellCmd)
+		cmdManager.RegisterFlagForCmd(&actionPtyFlag, ExecCmd, ShellCmd)
+		cmdManager.RegisterFlagForCmd(&actionNoPtyFlag, ExecCmd, ShellCmd)
+		cmdManager.RegisterFlagForCmd(&actionRootfsROCheckFlag, ExecCmd, RunCmd)
+		cmdManager.RegisterFlagForCmd(&actionNoForkFlag, ExecCmd, RunCmd)
 	})
 }
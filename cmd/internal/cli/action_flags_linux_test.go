@@ -0,0 +1,87 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var initOnce sync.Once
+
+// initCommands initializes the command tree once for all tests
+// of this package requiring registered commands and flags.
+func initCommands() {
+	initOnce.Do(func() {
+		Init(false)
+	})
+}
+
+// commandSpecificFlags lists flags which are intentionally registered
+// for some commands only and are not part of the shared action flags.
+// Flags shared by instance start and some action commands, like
+// --pid-file for exec and run, are checked and not listed.
+var commandSpecificFlags = map[string]bool{
+	// run only
+	"app-order": true,
+	"app-exit":  true,
+	// exec and shell only
+	"pty":    true,
+	"no-pty": true,
+	// exec and run only
+	"rootfs-ro-check": true,
+	"no-fork":         true,
+	// shell only
+	"shell":        true,
+	"syos":         true,
+	"norc":         true,
+	"history-file": true,
+	// instance start only
+	"boot":         true,
+	"systemd":      true,
+	"options-file": true,
+	"scope":        true,
+	"restart":      true,
+	"restart-sec":  true,
+}
+
+func TestInstanceStartFlagParity(t *testing.T) {
+	initCommands()
+
+	for _, cmd := range []*cobra.Command{ExecCmd, RunCmd, ShellCmd, TestCmd} {
+		cmd.Flags().VisitAll(func(f *pflag.Flag) {
+			if commandSpecificFlags[f.Name] {
+				return
+			}
+			instFlag := instanceStartCmd.Flags().Lookup(f.Name)
+			if instFlag == nil {
+				t.Errorf("flag --%s of %s is missing for instance start", f.Name, cmd.Name())
+				return
+			}
+			if _, ok := instanceUnsupportedFlags[f.Name]; ok && !instFlag.Hidden {
+				t.Errorf("unsupported flag --%s should be hidden for instance start", f.Name)
+			}
+		})
+	}
+
+	instanceStartCmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if commandSpecificFlags[f.Name] {
+			return
+		}
+		if ExecCmd.Flags().Lookup(f.Name) == nil {
+			t.Errorf("flag --%s of instance start is missing for action commands", f.Name)
+		}
+	})
+
+	for name := range instanceUnsupportedFlags {
+		if instanceStartCmd.Flags().Lookup(name) == nil {
+			t.Errorf("unsupported flag --%s is not registered for instance start", name)
+		}
+	}
+}
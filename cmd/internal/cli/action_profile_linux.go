@@ -0,0 +1,98 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/util/bindprofile"
+	"github.com/sylabs/singularity/pkg/util/singularityconf"
+)
+
+// currentGroups returns the primary and supplementary groups of the user.
+func currentGroups() ([]uint32, error) {
+	groups, err := os.Getgroups()
+	if err != nil {
+		return nil, fmt.Errorf("could not get supplementary groups: %s", err)
+	}
+	gids := []uint32{uint32(os.Getgid())}
+	for _, g := range groups {
+		gids = append(gids, uint32(g))
+	}
+	return gids, nil
+}
+
+// actionProfiles returns the bind profiles applied to the container: the
+// profiles of the user groups followed by the ones selected with --profile.
+func actionProfiles(conf *singularityconf.File) ([]*bindprofile.Profile, error) {
+	var entries []string
+	if conf != nil {
+		entries = conf.BindProfile
+	}
+	profiles, err := bindprofile.Load(configurationFile, entries, bindprofile.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("while loading bind profiles: %s", err)
+	}
+	gids, err := currentGroups()
+	if err != nil {
+		return nil, err
+	}
+	return bindprofile.Select(profiles, Profiles, gids)
+}
+
+// profileNames returns the names of the profiles, in order.
+func profileNames(profiles []*bindprofile.Profile) []string {
+	names := make([]string, 0, len(profiles))
+	for _, p := range profiles {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// profileEnv returns the environment variables of the profiles, a later
+// profile overrides the variables set by a former one.
+func profileEnv(profiles []*bindprofile.Profile) []string {
+	var env []string
+	for _, p := range profiles {
+		env = append(env, p.Env...)
+	}
+	return env
+}
+
+// profileLdPath returns the library search path added by the profiles.
+func profileLdPath(profiles []*bindprofile.Profile) string {
+	var paths []string
+	for _, p := range profiles {
+		paths = append(paths, p.LdPaths...)
+	}
+	return strings.Join(paths, ":")
+}
+
+// profileReport describes the bind profiles applied to the container, each
+// line is labeled by the profile name.
+func profileReport(profiles []*bindprofile.Profile, gids []uint32) []string {
+	var report []string
+	for _, p := range profiles {
+		label := fmt.Sprintf("Profile %s", p.Name)
+		if group, ok := p.Group(gids); ok {
+			report = append(report, fmt.Sprintf("%s: defined in %s, applied to the members of group %s", label, p.Source, group))
+		} else {
+			report = append(report, fmt.Sprintf("%s: defined in %s, selected with --profile", label, p.Source))
+		}
+		for _, b := range p.Binds {
+			report = append(report, fmt.Sprintf("%s: bind %s", label, b))
+		}
+		for _, e := range p.Env {
+			report = append(report, fmt.Sprintf("%s: environment variable %s", label, e))
+		}
+		for _, l := range p.LdPaths {
+			report = append(report, fmt.Sprintf("%s: library path %s", label, l))
+		}
+	}
+	return report
+}
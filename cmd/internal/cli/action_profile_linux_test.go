@@ -0,0 +1,53 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/util/bindprofile"
+)
+
+func TestProfileReport(t *testing.T) {
+	ucx, err := bindprofile.Parse("ucx", "/etc/singularity/profiles.d/ucx.conf", strings.NewReader(`
+bind = /opt/ucx:/opt/ucx:ro
+env = UCX_TLS=rc
+ld path = /opt/ucx/lib
+group = root
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	agent, err := bindprofile.Parse("agent", "singularity.conf", strings.NewReader("ld path = /opt/agent/lib"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	profiles := []*bindprofile.Profile{ucx, agent}
+
+	want := []string{
+		"Profile ucx: defined in /etc/singularity/profiles.d/ucx.conf, applied to the members of group root",
+		"Profile ucx: bind /opt/ucx:/opt/ucx:ro",
+		"Profile ucx: environment variable UCX_TLS=rc",
+		"Profile ucx: library path /opt/ucx/lib",
+		"Profile agent: defined in singularity.conf, selected with --profile",
+		"Profile agent: library path /opt/agent/lib",
+	}
+	if got := profileReport(profiles, []uint32{1000, 0}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got report:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if got := bindprofile.Binds(profiles); !reflect.DeepEqual(got, []string{"/opt/ucx:/opt/ucx:ro"}) {
+		t.Errorf("got binds %v", got)
+	}
+	if got := profileNames(profiles); !reflect.DeepEqual(got, []string{"ucx", "agent"}) {
+		t.Errorf("got names %v", got)
+	}
+	if got := profileLdPath(profiles); got != "/opt/ucx/lib:/opt/agent/lib" {
+		t.Errorf("got library path %q", got)
+	}
+}
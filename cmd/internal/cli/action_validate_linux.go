@@ -0,0 +1,479 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/util/env"
+	"github.com/sylabs/singularity/internal/pkg/util/shell/interpreter"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engine/singularity/config"
+	"github.com/sylabs/singularity/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/util/rlimit"
+	"github.com/sylabs/singularity/pkg/util/singularityconf"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// actionOptions holds the action options and the host properties checked
+// by validateActionOptions.
+type actionOptions struct {
+	uid int
+	// userNamespaces is set when the kernel supports user namespaces
+	userNamespaces bool
+
+	writable      bool
+	writableTmpfs bool
+	readOnly      bool
+	overlay       []string
+	contain       bool
+	binds         []string
+	devices       []string
+	// home is the home directory isolated by --contain, if any
+	home          string
+	fakeroot      bool
+	userNamespace bool
+	keepPrivs     bool
+	noPrivs       bool
+	// keepPrivsPrelude is the command run with the root user privileges
+	// kept before the container command, if any
+	keepPrivsPrelude string
+	boot             bool
+	// rlimits are the resource limits requested with --rlimit
+	rlimits []string
+	// noFork keeps the container command a direct child of the
+	// singularity process
+	noFork        bool
+	pidNamespace  bool
+	noInit        bool
+	pty           bool
+	timeout       bool
+	maxOutput     bool
+	rootfsROCheck bool
+	// autoPty is set when exec or shell allocate a pseudo terminal
+	// without --pty as the standard streams are terminals
+	autoPty bool
+}
+
+// actionRule checks the action options for a known incompatibility or a
+// missing prerequisite, it returns a description of each problem found.
+type actionRule func(o *actionOptions) []string
+
+// actionRules lists the rules checked by validateActionOptions.
+var actionRules = []actionRule{
+	checkWritableOverlay,
+	checkReadOnly,
+	checkContainBinds,
+	checkUserNamespaces,
+	checkReadOnlyDevices,
+	checkKeepPrivs,
+	checkKeepPrivsPrelude,
+	checkNoFork,
+}
+
+// actionOptionsError lists all the problems found in the action options.
+type actionOptionsError []string
+
+func (e actionOptionsError) Error() string {
+	return fmt.Sprintf("invalid combination of options:\n  - %s", strings.Join(e, "\n  - "))
+}
+
+// validateActionOptions checks the action options against all rules and
+// returns an error listing every problem found.
+func validateActionOptions(o *actionOptions) error {
+	var problems actionOptionsError
+	for _, rule := range actionRules {
+		problems = append(problems, rule(o)...)
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// checkActionOptions validates the options of the action command cmd, and
+// exits once validated with --dry-run.
+func checkActionOptions(cmd *cobra.Command, args []string) {
+	o := currentActionOptions(cmd)
+	if err := validateActionOptions(o); err != nil {
+		sylog.Fatalf("%s", err)
+	}
+	if DryRun {
+		for _, layer := range overlayStack(o) {
+			sylog.Infof("%s", layer)
+		}
+		policy := env.LoaderEnvPass
+		if conf := singularityconf.GetCurrentConfig(); conf != nil {
+			policy = conf.ContainerLoaderEnv
+		}
+		for _, v := range loaderEnvReport(dryRunEnv(args), IsCleanEnv, policy) {
+			sylog.Infof("%s", v)
+		}
+		report, err := rlimitReport(o, singularityconf.GetCurrentConfig())
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		for _, v := range report {
+			sylog.Infof("%s", v)
+		}
+		profiles, err := actionProfiles(singularityconf.GetCurrentConfig())
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		gids, err := currentGroups()
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		for _, v := range profileReport(profiles, gids) {
+			sylog.Infof("%s", v)
+		}
+		sylog.Infof("%s", processTreeReport(o))
+		sylog.Infof("No incompatible options found")
+		os.Exit(0)
+	}
+}
+
+// overlayStack describes the layers stacked over the container image, from
+// the lowest to the uppermost one, as requested by the action options.
+func overlayStack(o *actionOptions) []string {
+	var stack []string
+	for _, ov := range o.overlay {
+		mode := "writable"
+		if strings.HasSuffix(ov, ":ro") {
+			ov = strings.TrimSuffix(ov, ":ro")
+			mode = "read-only"
+		} else if o.readOnly {
+			mode = "read-only (demoted by --read-only)"
+		}
+		stack = append(stack, fmt.Sprintf("Overlay %s: %s", ov, mode))
+	}
+	if o.writableTmpfs {
+		stack = append(stack, "Overlay tmpfs: writable")
+	}
+	if o.readOnly {
+		stack = append(stack, "Root filesystem: read-only")
+	}
+	return stack
+}
+
+// dryRunEnv returns the host environment with the --env and --env-file
+// variables prefixed with SINGULARITYENV_, as they are processed when the
+// container environment is set.
+func dryRunEnv(args []string) []string {
+	vars := SingularityEnv
+	if SingularityEnvFile != "" {
+		content, err := ioutil.ReadFile(SingularityEnvFile)
+		if err != nil {
+			sylog.Fatalf("Could not read %q environment file: %s", SingularityEnvFile, err)
+		}
+		fileVars, err := interpreter.EvaluateEnv(content, args, os.Environ())
+		if err != nil {
+			sylog.Fatalf("While processing %s: %s", SingularityEnvFile, err)
+		}
+		vars = append(fileVars, vars...)
+	}
+
+	hostEnv := os.Environ()
+	for _, v := range vars {
+		if strings.Contains(v, "=") {
+			hostEnv = append(hostEnv, env.SingularityEnvPrefix+v)
+		}
+	}
+	return hostEnv
+}
+
+// loaderEnvReport describes the dynamic loader variables forwarded from
+// hostEnv to the container, why they are sanitized, and whether they reach
+// the container process according to the container loader env policy.
+func loaderEnvReport(hostEnv []string, cleanEnv bool, policy string) []string {
+	var report []string
+	for _, key := range env.ForwardedLoaderKeys(hostEnv, cleanEnv) {
+		action := "passed to the container process"
+		if policy == env.LoaderEnvStrip {
+			action = "stripped from the container process environment (container loader env = strip)"
+		}
+		report = append(report, fmt.Sprintf("Environment variable %s: %s, never passed to privileged helpers as it %s", key, action, env.LoaderKeys[key]))
+	}
+	return report
+}
+
+// rlimitReport describes the resource limits applied to the container
+// process, from the defaults and maximums of the configuration conf and
+// the limits requested with --rlimit.
+func rlimitReport(o *actionOptions, conf *singularityconf.File) ([]string, error) {
+	var defaults, ceilings []rlimit.Limit
+	suid := buildcfg.SINGULARITY_SUID_INSTALL == 1
+	if conf != nil {
+		var err error
+		if defaults, err = rlimit.ParseLimits(conf.DefaultRlimit); err != nil {
+			return nil, fmt.Errorf("bad 'default rlimit' in singularity.conf: %s", err)
+		}
+		if ceilings, err = rlimit.ParseLimits(conf.MaxRlimit); err != nil {
+			return nil, fmt.Errorf("bad 'max rlimit' in singularity.conf: %s", err)
+		}
+		suid = suid && conf.AllowSetuid
+	}
+
+	// like the runtime, hard limits are only raised by the setuid
+	// workflow or root without user namespace
+	raise := (o.uid == 0 || suid) && !o.userNamespace && !o.fakeroot
+	limits, err := rlimit.Resolve(defaults, ceilings, o.rlimits, o.uid == 0, raise)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --rlimit value: %s", err)
+	}
+
+	var report []string
+	for _, l := range limits {
+		report = append(report, fmt.Sprintf("Resource limit %s: soft %s, hard %s", l.Name(), rlimit.FormatValue(l.Soft), rlimit.FormatValue(l.Hard)))
+	}
+	return report, nil
+}
+
+// currentActionOptions returns the action options set from the command
+// line of cmd.
+func currentActionOptions(cmd *cobra.Command) *actionOptions {
+	// the home directory is only isolated by --contain when it's
+	// not requested with --home
+	home := ""
+	if f := cmd.Flag("home"); f != nil && !f.Changed && !NoHome {
+		home = HomePath
+		if i := strings.Index(home, ":"); i >= 0 {
+			home = home[i+1:]
+		}
+	}
+
+	return &actionOptions{
+		uid:              os.Getuid(),
+		userNamespaces:   hasUserNamespaces(),
+		writable:         IsWritable,
+		writableTmpfs:    IsWritableTmpfs,
+		readOnly:         ReadOnly,
+		overlay:          OverlayPath,
+		contain:          IsContained || IsContainAll || IsBoot,
+		binds:            BindPaths,
+		devices:          Devices,
+		home:             home,
+		fakeroot:         IsFakeroot,
+		userNamespace:    UserNamespace,
+		keepPrivs:        KeepPrivs,
+		noPrivs:          NoPrivs,
+		keepPrivsPrelude: KeepPrivsPrelude,
+		boot:             IsBoot,
+		rlimits:          Rlimits,
+		noFork:           NoFork,
+		pidNamespace:     PidNamespace || IsContainAll,
+		noInit:           NoInit,
+		pty:              Pty,
+		timeout:          Timeout != "",
+		maxOutput:        MaxOutput > 0,
+		rootfsROCheck:    RootfsROCheck,
+		autoPty:          (cmd.Name() == "exec" || cmd.Name() == "shell") && !Pty && !NoPty && !NoFork && isInteractive(),
+	}
+}
+
+// isInteractive returns if the standard streams are all terminals.
+func isInteractive() bool {
+	return terminal.IsTerminal(0) && terminal.IsTerminal(1) && terminal.IsTerminal(2)
+}
+
+// hasUserNamespaces returns if the kernel supports user namespaces and if
+// they are enabled.
+func hasUserNamespaces() bool {
+	if _, err := os.Stat("/proc/self/ns/user"); err != nil {
+		return false
+	}
+	b, err := ioutil.ReadFile("/proc/sys/user/max_user_namespaces")
+	if err != nil {
+		// no limit exposed by older kernels
+		return true
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	return err != nil || n > 0
+}
+
+func checkWritableOverlay(o *actionOptions) []string {
+	if o.writable && len(o.overlay) > 0 {
+		return []string{"--writable and --overlay are mutually exclusive, an overlay already makes the container writable"}
+	}
+	return nil
+}
+
+func checkReadOnly(o *actionOptions) []string {
+	if !o.readOnly {
+		return nil
+	}
+
+	var problems []string
+	if o.writable {
+		problems = append(problems, "--read-only and --writable are mutually exclusive")
+	}
+	if o.writableTmpfs {
+		problems = append(problems, "--read-only and --writable-tmpfs are mutually exclusive, the root filesystem can't be writable")
+	}
+	return problems
+}
+
+// checkContainBinds reports bind mounts on a parent of the directories
+// isolated by --contain, the contained directory would then be hidden by
+// the bound host directory. A bind mount on the contained directory
+// itself is a deliberate replacement (e.g. a scratch /tmp) and is allowed.
+func checkContainBinds(o *actionOptions) []string {
+	if !o.contain || len(o.binds) == 0 {
+		return nil
+	}
+
+	binds, err := singularityConfig.ParseBindPath(strings.Join(o.binds, ","))
+	if err != nil {
+		// reported when the bind paths are processed
+		return nil
+	}
+
+	contained := []string{"/tmp", "/var/tmp"}
+	if o.home != "" && o.home != "/" {
+		contained = append(contained, filepath.Clean(o.home))
+	}
+
+	var problems []string
+	for _, b := range binds {
+		dst := filepath.Clean(b.Destination)
+		for _, c := range contained {
+			if strings.HasPrefix(c, dst+"/") {
+				problems = append(problems, fmt.Sprintf("--bind destination %s hides the %s directory isolated by --contain", b.Destination, c))
+			}
+		}
+	}
+	return problems
+}
+
+func checkUserNamespaces(o *actionOptions) []string {
+	if o.userNamespaces {
+		return nil
+	}
+
+	var problems []string
+	if o.fakeroot {
+		problems = append(problems, "--fakeroot requires user namespaces, which are not supported or disabled on this host")
+	}
+	if o.userNamespace {
+		problems = append(problems, "--userns requires user namespaces, which are not supported or disabled on this host")
+	}
+	return problems
+}
+
+// checkReadOnlyDevices reports read-only devices requested with a user
+// namespace, the devices cgroup enforcing them can't be applied from
+// a user namespace.
+func checkReadOnlyDevices(o *actionOptions) []string {
+	if !o.fakeroot && !o.userNamespace {
+		return nil
+	}
+
+	var problems []string
+	for _, spec := range o.devices {
+		d, err := singularityConfig.ParseDevice(spec)
+		if err != nil {
+			// reported when the devices are processed
+			continue
+		}
+		if d.ReadOnly {
+			problems = append(problems, fmt.Sprintf("read-only --device %s requires cgroups, which can't be applied with --fakeroot or --userns", d.Source))
+		}
+	}
+	return problems
+}
+
+func checkKeepPrivs(o *actionOptions) []string {
+	if !o.keepPrivs {
+		return nil
+	}
+
+	var problems []string
+	if o.uid != 0 {
+		problems = append(problems, "--keep-privs requires root privileges")
+	}
+	if o.noPrivs {
+		problems = append(problems, "--keep-privs and --no-privs are mutually exclusive")
+	}
+	return problems
+}
+
+func checkKeepPrivsPrelude(o *actionOptions) []string {
+	if o.keepPrivsPrelude == "" {
+		return nil
+	}
+
+	var problems []string
+	if o.uid != 0 {
+		problems = append(problems, "--keep-privs-prelude requires root privileges")
+	}
+	if o.keepPrivs {
+		problems = append(problems, "--keep-privs-prelude and --keep-privs are mutually exclusive")
+	}
+	if o.noPrivs {
+		problems = append(problems, "--keep-privs-prelude and --no-privs are mutually exclusive")
+	}
+	if o.boot {
+		problems = append(problems, "--keep-privs-prelude can't be used with --boot, there is no container command")
+	}
+	return problems
+}
+
+// processTreeReport describes how the container command is started
+// relative to the singularity process.
+func processTreeReport(o *actionOptions) string {
+	var supervisors []string
+	if o.pty || o.autoPty {
+		supervisors = append(supervisors, "pseudo terminal")
+	}
+	if o.timeout {
+		supervisors = append(supervisors, "--timeout")
+	}
+	if o.maxOutput {
+		supervisors = append(supervisors, "--max-output")
+	}
+	if o.rootfsROCheck {
+		supervisors = append(supervisors, "--rootfs-ro-check")
+	}
+	if o.pidNamespace && !o.noInit {
+		supervisors = append(supervisors, "PID namespace init")
+	}
+	if len(supervisors) == 0 {
+		return "Process tree: the container command is a direct child of the singularity process"
+	}
+	return fmt.Sprintf("Process tree: the container command is started by a supervising process (%s)", strings.Join(supervisors, ", "))
+}
+
+// checkNoFork reports the options requiring a process between the
+// singularity process and the container command.
+func checkNoFork(o *actionOptions) []string {
+	if !o.noFork {
+		return nil
+	}
+
+	var problems []string
+	if o.pty {
+		problems = append(problems, "--no-fork and --pty are mutually exclusive, the pseudo terminal is attached by a supervising process")
+	}
+	if o.timeout {
+		problems = append(problems, "--no-fork and --timeout are mutually exclusive, the time limit is enforced by a supervising process")
+	}
+	if o.maxOutput {
+		problems = append(problems, "--no-fork and --max-output are mutually exclusive, the output is limited by a supervising process")
+	}
+	if o.rootfsROCheck {
+		problems = append(problems, "--no-fork and --rootfs-ro-check are mutually exclusive, the image is checked once the container exits")
+	}
+	if o.pidNamespace && !o.noInit {
+		problems = append(problems, "--no-fork requires --no-init with a PID namespace, the container command is otherwise started by an init process")
+	}
+	return problems
+}
@@ -0,0 +1,344 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// validOptions returns options without any incompatibility.
+func validOptions() actionOptions {
+	return actionOptions{
+		uid:            1000,
+		userNamespaces: true,
+		home:           "/home/user",
+	}
+}
+
+func TestActionRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   actionRule
+		modify func(o *actionOptions)
+		want   []string
+	}{
+		{
+			name:   "Writable",
+			rule:   checkWritableOverlay,
+			modify: func(o *actionOptions) { o.writable = true },
+		},
+		{
+			name:   "WritableOverlay",
+			rule:   checkWritableOverlay,
+			modify: func(o *actionOptions) { o.writable = true; o.overlay = []string{"overlay.img"} },
+			want:   []string{"--writable and --overlay are mutually exclusive"},
+		},
+		{
+			name:   "ReadOnlyOverlay",
+			rule:   checkReadOnly,
+			modify: func(o *actionOptions) { o.readOnly = true; o.overlay = []string{"overlay.img"} },
+		},
+		{
+			name: "ReadOnlyWritable",
+			rule: checkReadOnly,
+			modify: func(o *actionOptions) {
+				o.readOnly = true
+				o.writable = true
+				o.writableTmpfs = true
+			},
+			want: []string{"--read-only and --writable are mutually exclusive", "--read-only and --writable-tmpfs are mutually exclusive"},
+		},
+		{
+			name:   "BindNoContain",
+			rule:   checkContainBinds,
+			modify: func(o *actionOptions) { o.binds = []string{"/data:/tmp"} },
+		},
+		{
+			name:   "ContainBind",
+			rule:   checkContainBinds,
+			modify: func(o *actionOptions) { o.contain = true; o.binds = []string{"/data:/opt/data", "/scratch"} },
+		},
+		{
+			name:   "ContainBindTmp",
+			rule:   checkContainBinds,
+			modify: func(o *actionOptions) { o.contain = true; o.binds = []string{"/scratch:/tmp/"} },
+		},
+		{
+			name:   "ContainBindTmpSubdir",
+			rule:   checkContainBinds,
+			modify: func(o *actionOptions) { o.contain = true; o.binds = []string{"/data:/tmp/data"} },
+		},
+		{
+			name:   "ContainBindVar",
+			rule:   checkContainBinds,
+			modify: func(o *actionOptions) { o.contain = true; o.binds = []string{"/data:/var"} },
+			want:   []string{"--bind destination /var hides the /var/tmp directory"},
+		},
+		{
+			name:   "ContainBindHome",
+			rule:   checkContainBinds,
+			modify: func(o *actionOptions) { o.contain = true; o.binds = []string{"/data:/home"} },
+			want:   []string{"--bind destination /home hides the /home/user directory"},
+		},
+		{
+			name: "ContainBindCustomHome",
+			rule: checkContainBinds,
+			modify: func(o *actionOptions) {
+				o.contain = true
+				o.home = ""
+				o.binds = []string{"/data:/home"}
+			},
+		},
+		{
+			name:   "Fakeroot",
+			rule:   checkUserNamespaces,
+			modify: func(o *actionOptions) { o.fakeroot = true; o.userNamespace = true },
+		},
+		{
+			name: "FakerootUsernsUnsupported",
+			rule: checkUserNamespaces,
+			modify: func(o *actionOptions) {
+				o.userNamespaces = false
+				o.fakeroot = true
+				o.userNamespace = true
+			},
+			want: []string{"--fakeroot requires user namespaces", "--userns requires user namespaces"},
+		},
+		{
+			name:   "ReadOnlyDevice",
+			rule:   checkReadOnlyDevices,
+			modify: func(o *actionOptions) { o.devices = []string{"/dev/loop0:ro"} },
+		},
+		{
+			name: "UsernsDevices",
+			rule: checkReadOnlyDevices,
+			modify: func(o *actionOptions) {
+				o.userNamespace = true
+				o.devices = []string{"/dev/loop0:/dev/data:ro", "/dev/loop1:rw", "/dev/loop2"}
+			},
+			want: []string{"read-only --device /dev/loop0 requires cgroups"},
+		},
+		{
+			name:   "KeepPrivsRoot",
+			rule:   checkKeepPrivs,
+			modify: func(o *actionOptions) { o.uid = 0; o.keepPrivs = true },
+		},
+		{
+			name:   "KeepPrivsUser",
+			rule:   checkKeepPrivs,
+			modify: func(o *actionOptions) { o.keepPrivs = true },
+			want:   []string{"--keep-privs requires root privileges"},
+		},
+		{
+			name:   "KeepPrivsNoPrivs",
+			rule:   checkKeepPrivs,
+			modify: func(o *actionOptions) { o.uid = 0; o.keepPrivs = true; o.noPrivs = true },
+			want:   []string{"--keep-privs and --no-privs are mutually exclusive"},
+		},
+		{
+			name:   "KeepPrivsPreludeRoot",
+			rule:   checkKeepPrivsPrelude,
+			modify: func(o *actionOptions) { o.uid = 0; o.keepPrivsPrelude = "true" },
+		},
+		{
+			name:   "KeepPrivsPreludeUser",
+			rule:   checkKeepPrivsPrelude,
+			modify: func(o *actionOptions) { o.keepPrivsPrelude = "true" },
+			want:   []string{"--keep-privs-prelude requires root privileges"},
+		},
+		{
+			name: "KeepPrivsPreludeConflicts",
+			rule: checkKeepPrivsPrelude,
+			modify: func(o *actionOptions) {
+				o.uid = 0
+				o.keepPrivsPrelude = "true"
+				o.keepPrivs = true
+				o.noPrivs = true
+				o.boot = true
+			},
+			want: []string{
+				"--keep-privs-prelude and --keep-privs are mutually exclusive",
+				"--keep-privs-prelude and --no-privs are mutually exclusive",
+				"--keep-privs-prelude can't be used with --boot",
+			},
+		},
+		{
+			name:   "NoForkSupervised",
+			rule:   checkNoFork,
+			modify: func(o *actionOptions) { o.pty = true; o.timeout = true; o.pidNamespace = true },
+		},
+		{
+			name:   "NoForkPidNamespace",
+			rule:   checkNoFork,
+			modify: func(o *actionOptions) { o.noFork = true; o.pidNamespace = true; o.noInit = true },
+		},
+		{
+			name: "NoForkConflicts",
+			rule: checkNoFork,
+			modify: func(o *actionOptions) {
+				o.noFork = true
+				o.pty = true
+				o.timeout = true
+				o.maxOutput = true
+				o.rootfsROCheck = true
+				o.pidNamespace = true
+			},
+			want: []string{
+				"--no-fork and --pty are mutually exclusive",
+				"--no-fork and --timeout are mutually exclusive",
+				"--no-fork and --max-output are mutually exclusive",
+				"--no-fork and --rootfs-ro-check are mutually exclusive",
+				"--no-fork requires --no-init with a PID namespace",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := validOptions()
+			tt.modify(&o)
+
+			got := tt.rule(&o)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got problems %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if !strings.HasPrefix(got[i], tt.want[i]) {
+					t.Errorf("got problem %q, want %q", got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateActionOptions(t *testing.T) {
+	o := validOptions()
+	if err := validateActionOptions(&o); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	o.writable = true
+	o.overlay = []string{"overlay.img"}
+	o.keepPrivs = true
+
+	err := validateActionOptions(&o)
+	problems, ok := err.(actionOptionsError)
+	if !ok {
+		t.Fatalf("got error %v, want an actionOptionsError", err)
+	}
+	want := actionOptionsError{
+		checkWritableOverlay(&o)[0],
+		checkKeepPrivs(&o)[0],
+	}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("got problems %q, want %q", problems, want)
+	}
+	for _, p := range want {
+		if !strings.Contains(err.Error(), p) {
+			t.Errorf("error %q doesn't report %q", err, p)
+		}
+	}
+}
+
+func TestOverlayStack(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(o *actionOptions)
+		want   []string
+	}{
+		{
+			name:   "NoOverlay",
+			modify: func(o *actionOptions) {},
+		},
+		{
+			name:   "Overlays",
+			modify: func(o *actionOptions) { o.overlay = []string{"lower.img:ro", "upper.img"} },
+			want:   []string{"Overlay lower.img: read-only", "Overlay upper.img: writable"},
+		},
+		{
+			name:   "WritableTmpfs",
+			modify: func(o *actionOptions) { o.overlay = []string{"lower.img:ro"}; o.writableTmpfs = true },
+			want:   []string{"Overlay lower.img: read-only", "Overlay tmpfs: writable"},
+		},
+		{
+			name:   "ReadOnly",
+			modify: func(o *actionOptions) { o.overlay = []string{"lower.img:ro", "upper.img"}; o.readOnly = true },
+			want: []string{
+				"Overlay lower.img: read-only",
+				"Overlay upper.img: read-only (demoted by --read-only)",
+				"Root filesystem: read-only",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := validOptions()
+			tt.modify(&o)
+
+			if got := overlayStack(&o); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got overlay stack %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoaderEnvReport(t *testing.T) {
+	hostEnv := []string{"LD_PRELOAD=/tmp/evil.so", "SINGULARITYENV_TZDIR=/tmp", "TERM=xterm"}
+
+	tests := []struct {
+		name     string
+		cleanEnv bool
+		policy   string
+		want     []string
+	}{
+		{name: "Pass", policy: "pass", want: []string{"LD_PRELOAD", "TZDIR"}},
+		{name: "Strip", policy: "strip", want: []string{"LD_PRELOAD", "TZDIR"}},
+		{name: "CleanEnv", cleanEnv: true, policy: "pass", want: []string{"TZDIR"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := loaderEnvReport(hostEnv, tt.cleanEnv, tt.policy)
+			if len(report) != len(tt.want) {
+				t.Fatalf("got report %q, want %d variables", report, len(tt.want))
+			}
+			for i, key := range tt.want {
+				if !strings.HasPrefix(report[i], "Environment variable "+key+": ") {
+					t.Errorf("got %q, want a report of %s", report[i], key)
+				}
+				if !strings.Contains(report[i], "never passed to privileged helpers") {
+					t.Errorf("%q doesn't report privileged helpers", report[i])
+				}
+				if strings.Contains(report[i], "stripped") != (tt.policy == "strip") {
+					t.Errorf("%q doesn't report the %s policy", report[i], tt.policy)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessTreeReport(t *testing.T) {
+	o := validOptions()
+	if got, want := processTreeReport(&o), "Process tree: the container command is a direct child of the singularity process"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	o.pidNamespace = true
+	o.noInit = true
+	if got := processTreeReport(&o); !strings.Contains(got, "direct child") {
+		t.Errorf("got %q with --no-init, want a direct child", got)
+	}
+
+	o.noInit = false
+	o.autoPty = true
+	o.timeout = true
+	if got, want := processTreeReport(&o), "Process tree: the container command is started by a supervising process (pseudo terminal, --timeout, PID namespace init)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -10,20 +10,26 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
 	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/client/bucket"
 	"github.com/sylabs/singularity/internal/pkg/client/library"
 	"github.com/sylabs/singularity/internal/pkg/client/net"
 	"github.com/sylabs/singularity/internal/pkg/client/oci"
 	"github.com/sylabs/singularity/internal/pkg/client/oras"
 	"github.com/sylabs/singularity/internal/pkg/client/shub"
 	"github.com/sylabs/singularity/internal/pkg/remote/endpoint"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
 	"github.com/sylabs/singularity/internal/pkg/util/uri"
 	"github.com/sylabs/singularity/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/util/singularityconf"
 )
 
 const (
@@ -44,6 +50,8 @@ func getCacheHandle(cfg cache.Config) *cache.Handle {
 
 // actionPreRun will run replaceURIWithImage and will also do the proper path unsetting
 func actionPreRun(cmd *cobra.Command, args []string) {
+	checkActionOptions(cmd, args)
+
 	// backup user PATH
 	userPath := strings.Join([]string{os.Getenv("PATH"), defaultPath}, ":")
 
@@ -57,7 +65,12 @@ func actionPreRun(cmd *cobra.Command, args []string) {
 
 	ctx := context.TODO()
 
+	// images run from a URI are pulled in the cache
+	t, _ := uri.Split(args[0])
 	replaceURIWithImage(ctx, imgCache, cmd, args)
+	if t != "instance" {
+		recordImageUsage(imgCache, args[0], t == "")
+	}
 
 	// set PATH after pulling images to be able to find potential
 	// docker credential helpers outside of standard paths
@@ -69,7 +82,8 @@ func handleOCI(ctx context.Context, imgCache *cache.Handle, cmd *cobra.Command,
 	if err != nil {
 		sylog.Fatalf("While creating Docker credentials: %v", err)
 	}
-	return oci.Pull(ctx, imgCache, pullFrom, tmpDir, ociAuth, noHTTPS, false)
+	pullFrom, ociAuth = mirrorRegistryRef(pullFrom, ociAuth)
+	return oci.Pull(ctx, imgCache, pullFrom, tmpDir, ociAuth, noHTTPSFor(pullFrom), false)
 }
 
 func handleOras(ctx context.Context, imgCache *cache.Handle, cmd *cobra.Command, pullFrom string) (string, error) {
@@ -77,6 +91,7 @@ func handleOras(ctx context.Context, imgCache *cache.Handle, cmd *cobra.Command,
 	if err != nil {
 		return "", fmt.Errorf("while creating docker credentials: %v", err)
 	}
+	pullFrom, ociAuth = mirrorRegistryRef(pullFrom, ociAuth)
 	return oras.Pull(ctx, imgCache, pullFrom, tmpDir, ociAuth)
 }
 
@@ -85,6 +100,7 @@ func handleLibrary(ctx context.Context, imgCache *cache.Handle, pullFrom string)
 	if err != nil {
 		return "", err
 	}
+	pullFrom, c = mirrorLibraryRef(pullFrom, c)
 	return library.Pull(ctx, imgCache, pullFrom, runtime.GOARCH, tmpDir, c)
 }
 
@@ -96,6 +112,10 @@ func handleNet(ctx context.Context, imgCache *cache.Handle, pullFrom string) (st
 	return net.Pull(ctx, imgCache, pullFrom, tmpDir)
 }
 
+func handleBucket(ctx context.Context, imgCache *cache.Handle, pullFrom string) (string, error) {
+	return bucket.Pull(ctx, imgCache, pullFrom, tmpDir, bucketConfigs())
+}
+
 func replaceURIWithImage(ctx context.Context, imgCache *cache.Handle, cmd *cobra.Command, args []string) {
 	// If args[0] is not transport:ref (ex. instance://...) formatted return, not a URI
 	t, _ := uri.Split(args[0])
@@ -119,6 +139,8 @@ func replaceURIWithImage(ctx context.Context, imgCache *cache.Handle, cmd *cobra
 		image, err = handleNet(ctx, imgCache, args[0])
 	case uri.HTTPS:
 		image, err = handleNet(ctx, imgCache, args[0])
+	case uri.S3, uri.GS:
+		image, err = handleBucket(ctx, imgCache, args[0])
 	default:
 		sylog.Fatalf("Unsupported transport type: %s", t)
 	}
@@ -130,6 +152,30 @@ func replaceURIWithImage(ctx context.Context, imgCache *cache.Handle, cmd *cobra
 	args[0] = image
 }
 
+// recordImageUsage records a run of the image file in the usage database
+// when enabled by the image usage stats directive: cache entries are
+// recorded unless it's set to no, local images only if it's set to all.
+// Failures never prevent the image from running.
+func recordImageUsage(imgCache *cache.Handle, image string, local bool) {
+	conf := singularityconf.GetCurrentConfig()
+	if conf == nil || conf.ImageUsageStats == "no" {
+		return
+	}
+
+	path, err := filepath.Abs(image)
+	if err != nil || !fs.IsFile(path) {
+		return
+	}
+	if imgCache.EntryType(path) == "" && (!local || conf.ImageUsageStats != "all") {
+		return
+	}
+
+	db := cache.NewUsageDB(cache.UsageDBPath(buildcfg.USAGEDIR, os.Getuid()))
+	if err := db.Record(path, time.Now()); err != nil {
+		sylog.Debugf("Could not record usage of %s: %s", path, err)
+	}
+}
+
 // setVM will set the --vm option if needed by other options
 func setVM(cmd *cobra.Command) {
 	// check if --vm-ram or --vm-cpu changed from default value
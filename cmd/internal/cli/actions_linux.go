@@ -6,6 +6,9 @@
 package cli
 
 import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -22,6 +25,7 @@ import (
 	"github.com/sylabs/singularity/internal/pkg/plugin"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engine/config/oci"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engine/config/oci/generate"
+	"github.com/sylabs/singularity/internal/pkg/runtime/launcher"
 	"github.com/sylabs/singularity/internal/pkg/security"
 	"github.com/sylabs/singularity/internal/pkg/util/env"
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
@@ -34,15 +38,13 @@ import (
 	singularitycallback "github.com/sylabs/singularity/pkg/plugin/callback/runtime/engine/singularity"
 	"github.com/sylabs/singularity/pkg/runtime/engine/config"
 	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engine/singularity/config"
+	"github.com/sylabs/singularity/pkg/syfs"
 	"github.com/sylabs/singularity/pkg/sylog"
-	"github.com/sylabs/singularity/pkg/util/capabilities"
 	"github.com/sylabs/singularity/pkg/util/crypt"
 	"github.com/sylabs/singularity/pkg/util/fs/proc"
 	"github.com/sylabs/singularity/pkg/util/gpu"
 	"github.com/sylabs/singularity/pkg/util/namespaces"
-	"github.com/sylabs/singularity/pkg/util/rlimit"
 	"github.com/sylabs/singularity/pkg/util/singularityconf"
-	"golang.org/x/sys/unix"
 )
 
 // convertImage extracts the image found at filename to directory dir within a temporary directory
@@ -138,6 +140,190 @@ func hidepidProc() bool {
 	return false
 }
 
+// skipMissingBinds returns binds without the optional bind paths whose
+// source doesn't exist, a warning is reported for each of them.
+func skipMissingBinds(binds []singularityConfig.BindPath) []singularityConfig.BindPath {
+	kept := make([]singularityConfig.BindPath, 0, len(binds))
+	for _, b := range binds {
+		if b.Optional() {
+			if _, err := os.Stat(b.Source); os.IsNotExist(err) {
+				sylog.Warningf("Skipping optional bind mount %s: source doesn't exist", b.Source)
+				continue
+			}
+		}
+		kept = append(kept, b)
+	}
+	return kept
+}
+
+// shellHistoryFile returns the path in the container of the history file
+// of a shell started in image, or an empty string to keep the history file
+// of the host. Unless set with --history-file and if isolate is true, each
+// image gets its own history file in ~/.singularity/shell_history, named
+// after the hash of the image path, when the user home directory is the
+// home directory mounted in the container at homeDest.
+func shellHistoryFile(image, homeSource, homeDest string, isolate bool) string {
+	switch HistoryFile {
+	case "":
+	case "host":
+		return ""
+	case "none":
+		return "/dev/null"
+	default:
+		return HistoryFile
+	}
+
+	if !isolate || homeSource != CurrentUser.HomeDir {
+		return ""
+	}
+
+	dir := syfs.ShellHistoryDir()
+	rel, err := filepath.Rel(homeSource, dir)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		sylog.Debugf("Shell history directory %s is not in home directory %s", dir, homeSource)
+		return ""
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		sylog.Verbosef("Keeping host shell history, could not create %s: %s", dir, err)
+		return ""
+	}
+	return filepath.Join(homeDest, rel, fmt.Sprintf("%x", sha256.Sum256([]byte(image))))
+}
+
+// tmpMountSpec checks the mount specification of the container temporary
+// directory set with flag, and returns it with an absolute host directory.
+func tmpMountSpec(flag, spec string) (string, error) {
+	if spec == singularityConfig.TmpfsMount {
+		return spec, nil
+	}
+	path, err := filepath.Abs(spec)
+	if err != nil {
+		return "", fmt.Errorf("while resolving %s path %s: %s", flag, spec, err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("while checking %s path: %s", flag, err)
+	}
+	if !fi.IsDir() {
+		return "", fmt.Errorf("%s path %s is not a directory, must be a host directory or %s", flag, path, singularityConfig.TmpfsMount)
+	}
+	return path, nil
+}
+
+// hostDevices parses the device specifications and checks that each source
+// resolves to a block or character device on the host.
+func hostDevices(specs []string) ([]singularityConfig.Device, error) {
+	devices := make([]singularityConfig.Device, 0, len(specs))
+	for _, spec := range specs {
+		d, err := singularityConfig.ParseDevice(spec)
+		if err != nil {
+			return nil, err
+		}
+		d.Source, err = filepath.EvalSymlinks(d.Source)
+		if err != nil {
+			return nil, fmt.Errorf("while resolving device %s: %s", spec, err)
+		}
+		fi, err := os.Stat(d.Source)
+		if err != nil {
+			return nil, err
+		}
+		if fi.Mode()&os.ModeDevice == 0 {
+			return nil, fmt.Errorf("%s is not a block or character device", d.Source)
+		}
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
+
+// readOnlyOverlays returns the overlay images in paths, all demoted to
+// read-only.
+func readOnlyOverlays(paths []string) []string {
+	overlays := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if !strings.HasSuffix(p, ":ro") {
+			p += ":ro"
+		}
+		overlays = append(overlays, p)
+	}
+	return overlays
+}
+
+// imageLabels returns the labels of the SIF or sandbox image img, other
+// image formats don't expose their labels without being mounted.
+func imageLabels(img *imgutil.Image) (map[string]string, error) {
+	switch img.Type {
+	case imgutil.SIF:
+		md, err := getInspectMetadataFromSIF(img)
+		if err != nil {
+			return nil, err
+		}
+		return md.Attributes.Labels, nil
+	case imgutil.SANDBOX:
+		b, err := ioutil.ReadFile(filepath.Join(img.Path, ".singularity.d", "labels.json"))
+		if err != nil {
+			return nil, err
+		}
+		labels := make(map[string]string)
+		if err := json.Unmarshal(b, &labels); err != nil {
+			return nil, fmt.Errorf("while decoding labels: %s", err)
+		}
+		return labels, nil
+	}
+	return nil, nil
+}
+
+// checkCudaDriver warns when the CUDA version declared by the labels of
+// img requires a newer NVIDIA driver than the one installed on the host.
+func checkCudaDriver(img *imgutil.Image, userPath string) {
+	labels, err := imageLabels(img)
+	if err != nil {
+		sylog.Debugf("Could not read image labels: %s", err)
+		return
+	}
+	cuda := labels[gpu.CudaVersionLabel]
+	if cuda == "" {
+		return
+	}
+	// don't probe the host driver for CUDA versions without known requirements
+	if _, ok := gpu.CudaDriverVersion(cuda); !ok {
+		sylog.Debugf("No known NVIDIA driver requirement for CUDA %s", cuda)
+		return
+	}
+
+	driver, err := gpu.NvidiaDriverVersion(userPath)
+	if err != nil {
+		sylog.Verbosef("Not checking CUDA %s requirements: %s", cuda, err)
+		return
+	}
+	sylog.Debugf("Container CUDA version %s, host NVIDIA driver version %s", cuda, driver)
+
+	if err := gpu.CheckCudaDriver(cuda, driver); err != nil {
+		sylog.Warningf("NVIDIA driver mismatch: %s, CUDA applications will likely fail", err)
+	}
+}
+
+// checkSetuidBinaries is called for --allow-setuid. When setuid binaries
+// are denied by the configuration and not overridden, it refuses images
+// holding setuid files or whose setuid files are unknown, it warns about
+// the setuid files of the image otherwise.
+func checkSetuidBinaries(img *imgutil.Image, deny, override bool) {
+	files, err := imageSpecialFiles(img)
+	if deny && !override {
+		if err != nil {
+			sylog.Fatalf("Setuid binaries are denied by the configuration and the setuid files of %s are unknown: %s, use --override-setuid-policy to allow setuid binaries", img.Path, err)
+		} else if files.SetuidCount > 0 {
+			sylog.Fatalf("Setuid binaries are denied by the configuration and %s holds %d setuid files, use --override-setuid-policy to allow setuid binaries", img.Path, files.SetuidCount)
+		}
+		sylog.Verbosef("Setuid binaries are denied by the configuration, the container is mounted nosuid")
+		return
+	}
+	if err != nil {
+		sylog.Debugf("Could not get the setuid files of %s: %s", img.Path, err)
+	} else if files.SetuidCount > 0 {
+		sylog.Warningf("%s holds %d setuid files which run with elevated privileges with --allow-setuid", img.Path, files.SetuidCount)
+	}
+}
+
 // TODO: Let's stick this in another file so that that CLI is just CLI
 func execStarter(cobraCmd *cobra.Command, image string, args []string, name string) {
 	var err error
@@ -151,6 +337,11 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 	gid := uint32(os.Getgid())
 	insideUserNs, _ := namespaces.IsInsideUserNamespace(os.Getpid())
 
+	// bundle is set when the image is an OCI bundle directory
+	var bundle *actionBundle
+	// containerImage is the image path, also for instances
+	var containerImage string
+
 	// Are we running from a privileged account?
 	isPrivileged := uid == 0
 	checkPrivileges := func(cond bool, desc string, fn func()) {
@@ -172,6 +363,14 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 		sylog.Fatalf("Unable to get singularity configuration")
 	}
 
+	profiles, err := actionProfiles(engineConfig.File)
+	if err != nil {
+		sylog.Fatalf("%s", err)
+	}
+	for _, p := range profiles {
+		sylog.Verbosef("Applying bind profile %s defined in %s", p.Name, p.Source)
+	}
+
 	ociConfig := &oci.Config{}
 	generator := generate.New(&ociConfig.Spec)
 
@@ -191,19 +390,30 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 	uidParam := security.GetParam(Security, "uid")
 	gidParam := security.GetParam(Security, "gid")
 
-	// handle target UID/GID for root user
-	checkPrivileges(uidParam != "", "uid security feature", func() {
+	// handle target UID/GID for root user, users are allowed to
+	// run the container process with IDs from their subordinate ID
+	// ranges within a user namespace
+	remapIDs := !isPrivileged && (uidParam != "" || gidParam != "")
+	if remapIDs && IsFakeroot {
+		sylog.Fatalf("uid/gid security features are not supported with --fakeroot")
+	}
+
+	if uidParam != "" {
 		u, err := strconv.ParseUint(uidParam, 10, 32)
 		if err != nil {
 			sylog.Fatalf("failed to parse provided UID")
 		}
 		targetUID = int(u)
-		uid = uint32(targetUID)
+		if isPrivileged {
+			uid = uint32(targetUID)
+		} else if targetUID == 0 {
+			sylog.Fatalf("uid security feature requires root privileges to run as UID 0, use --fakeroot instead")
+		}
 
 		engineConfig.SetTargetUID(targetUID)
-	})
+	}
 
-	checkPrivileges(gidParam != "", "gid security feature", func() {
+	if gidParam != "" {
 		gids := strings.Split(gidParam, ":")
 		for _, id := range gids {
 			g, err := strconv.ParseUint(id, 10, 32)
@@ -212,27 +422,35 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 			}
 			targetGID = append(targetGID, int(g))
 		}
-		if len(gids) > 0 {
+		if isPrivileged && len(gids) > 0 {
 			gid = uint32(targetGID[0])
 		}
 
 		engineConfig.SetTargetGID(targetGID)
-	})
+	}
 
 	if strings.HasPrefix(image, "instance://") {
 		if name != "" {
 			sylog.Fatalf("Starting an instance from another is not allowed")
 		}
+		if remapIDs {
+			sylog.Fatalf("uid/gid security features are applied at instance start, they can't be used to join an instance")
+		}
 		instanceName := instance.ExtractName(image)
-		file, err := instance.Get(instanceName, instance.SingSubDir)
-		if err != nil {
+		// instanceExecUser is only set by root with instance exec
+		file, err := instance.GetForUser(instanceName, instanceExecUser, instance.SingSubDir)
+		if errors.Is(err, instance.ErrOtherUser) && os.Getuid() == 0 {
+			sylog.Fatalf("%s, use instance exec --user to join it", err)
+		} else if err != nil {
 			sylog.Fatalf("%s", err)
 		}
 		UserNamespace = file.UserNs
 		generator.AddProcessEnv("SINGULARITY_CONTAINER", file.Image)
 		generator.AddProcessEnv("SINGULARITY_NAME", filepath.Base(file.Image))
+		containerImage = file.Image
 		engineConfig.SetImage(image)
 		engineConfig.SetInstanceJoin(true)
+		engineConfig.SetInstanceUser(instanceExecUser)
 	} else {
 		abspath, err := filepath.Abs(image)
 		generator.AddProcessEnv("SINGULARITY_CONTAINER", abspath)
@@ -241,43 +459,16 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 			sylog.Fatalf("Failed to determine image absolute path for %s: %s", image, err)
 		}
 		engineConfig.SetImage(abspath)
-	}
-
-	// privileged installation by default
-	useSuid := true
-
-	// singularity was compiled with '--without-suid' option
-	if buildcfg.SINGULARITY_SUID_INSTALL == 0 {
-		useSuid = false
-
-		if !UserNamespace && uid != 0 {
-			sylog.Verbosef("Unprivileged installation: using user namespace")
-			UserNamespace = true
-		}
-	}
+		containerImage = abspath
 
-	// use non privileged starter binary:
-	// - if running as root
-	// - if already running inside a user namespace
-	// - if user namespace is requested
-	// - if running as user and 'allow setuid = no' is set in singularity.conf
-	if uid == 0 || insideUserNs || UserNamespace || !engineConfig.File.AllowSetuid {
-		useSuid = false
-
-		// fallback to user namespace:
-		// - for non root user with setuid installation and 'allow setuid = no'
-		// - for root user without effective capability CAP_SYS_ADMIN
-		if uid != 0 && buildcfg.SINGULARITY_SUID_INSTALL == 1 && !engineConfig.File.AllowSetuid {
-			sylog.Verbosef("'allow setuid' set to 'no' by configuration, fallback to user namespace")
-			UserNamespace = true
-		} else if uid == 0 && !UserNamespace {
-			caps, err := capabilities.GetProcessEffective()
-			if err != nil {
-				sylog.Fatalf("Could not get process effective capabilities: %s", err)
-			}
-			if caps&uint64(1<<unix.CAP_SYS_ADMIN) == 0 {
-				sylog.Verbosef("Effective capability CAP_SYS_ADMIN is missing, fallback to user namespace")
-				UserNamespace = true
+		bundle, err = loadActionBundle(abspath)
+		if err != nil {
+			sylog.Fatalf("While loading OCI bundle %s: %s", abspath, err)
+		} else if bundle != nil {
+			sylog.Verbosef("Using OCI bundle %s with root filesystem %s", abspath, bundle.rootfs)
+			engineConfig.SetImage(bundle.rootfs)
+			if AppName == "" && len(AppOrder) == 0 {
+				generator.SetProcessArgs(bundle.processArgs(args))
 			}
 		}
 	}
@@ -375,17 +566,46 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 			engineConfig.SetEncryptionKey(plaintextKey)
 		}
 
+		if Nvidia {
+			checkCudaDriver(img, userPath)
+		}
+
+		// setuid binaries are ignored with the nofilecaps security feature
+		if AllowSUID && isPrivileged && !security.HasFeature(Security, "nofilecaps") {
+			checkSetuidBinaries(img, engineConfig.File.DenySetuidBinaries, OverrideSUID)
+		}
+
 		// don't defer this call as in all cases it won't be
 		// called before execing starter, so it would leak the
 		// image file descriptor to the container process
 		img.File.Close()
 	}
 
+	// profile binds are system binds read by the engine from the
+	// profiles defined by the administrator, mounted before the user
+	// binds even if user bind control is disabled
+	engineConfig.SetProfiles(profileNames(profiles))
 	binds, err := singularityConfig.ParseBindPath(strings.Join(BindPaths, ","))
 	if err != nil {
 		sylog.Fatalf("while parsing bind path: %s", err)
 	}
-	engineConfig.SetBindPath(binds)
+	binds, err = singularityConfig.ExpandBindPaths(binds, engineConfig.File.MaxBindGlobMatches)
+	if err != nil {
+		sylog.Fatalf("while expanding bind path: %s", err)
+	}
+	if bundle != nil {
+		// user binds are mounted on top of the bundle mounts
+		binds = append(bundle.bindPaths(), binds...)
+	}
+	engineConfig.SetBindPath(skipMissingBinds(binds))
+
+	checkPrivileges(len(Devices) > 0, "--device", func() {
+		devices, err := hostDevices(Devices)
+		if err != nil {
+			sylog.Fatalf("while processing devices: %s", err)
+		}
+		engineConfig.SetDevices(devices)
+	})
 
 	if len(FuseMount) > 0 {
 		/* If --fusemount is given, imply --pid */
@@ -397,7 +617,12 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 	engineConfig.SetNetwork(Network)
 	engineConfig.SetDNS(DNS)
 	engineConfig.SetNetworkArgs(NetworkArgs)
-	engineConfig.SetOverlayImage(OverlayPath)
+	if ReadOnly {
+		engineConfig.SetReadOnlyRootfs(true)
+		engineConfig.SetOverlayImage(readOnlyOverlays(OverlayPath))
+	} else {
+		engineConfig.SetOverlayImage(OverlayPath)
+	}
 	engineConfig.SetWritableImage(IsWritable)
 	engineConfig.SetNoHome(NoHome)
 	engineConfig.SetNv(Nvidia)
@@ -407,13 +632,27 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 	engineConfig.SetConfigurationFile(configurationFile)
 
 	checkPrivileges(AllowSUID, "--allow-setuid", func() {
+		if security.HasFeature(Security, "nofilecaps") {
+			sylog.Warningf("--allow-setuid has no effect with --security nofilecaps, setuid binaries are ignored")
+		}
 		engineConfig.SetAllowSUID(AllowSUID)
 	})
 
+	checkPrivileges(OverrideSUID, "--override-setuid-policy", func() {
+		if !AllowSUID {
+			sylog.Warningf("--override-setuid-policy has no effect without --allow-setuid")
+		}
+		engineConfig.SetOverrideSUIDPolicy(OverrideSUID)
+	})
+
 	checkPrivileges(KeepPrivs, "--keep-privs", func() {
 		engineConfig.SetKeepPrivs(KeepPrivs)
 	})
 
+	checkPrivileges(KeepPrivsPrelude != "", "--keep-privs-prelude", func() {
+		engineConfig.SetKeepPrivsPrelude(KeepPrivsPrelude)
+	})
+
 	engineConfig.SetNoPrivs(NoPrivs)
 	engineConfig.SetSecurity(Security)
 	engineConfig.SetShell(ShellPath)
@@ -435,6 +674,55 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 		engineConfig.SetWritableTmpfs(IsWritableTmpfs)
 	}
 
+	if bundle != nil {
+		if bundle.readOnly() && IsWritable {
+			sylog.Fatalf("The root filesystem of OCI bundle %s is read-only, --writable is not allowed", bundle.path)
+		} else if !bundle.readOnly() && !IsWritable && !ReadOnly && len(OverlayPath) == 0 {
+			// modifications of the bundle root filesystem are
+			// discarded unless --writable is set
+			sylog.Debugf("Using an ephemeral writable overlay for OCI bundle %s", bundle.path)
+			engineConfig.SetWritableTmpfs(true)
+		}
+	}
+
+	// store the session directory on disk in SINGULARITY_SESSIONDIR,
+	// this is ignored by the engine in the setuid workflow
+	if dir := os.Getenv("SINGULARITY_SESSIONDIR"); dir != "" {
+		sessionDir, err := filepath.Abs(dir)
+		if err != nil {
+			sylog.Fatalf("Failed to determine absolute path for %s: %s", dir, err)
+		}
+		engineConfig.SetSessionDir(sessionDir)
+	}
+
+	if ShmSize != "" {
+		if err := singularityConfig.CheckShmSize(ShmSize); err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		engineConfig.SetShmSize(ShmSize)
+	}
+
+	if TmpMount != "" {
+		spec, err := tmpMountSpec("--tmp", TmpMount)
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		engineConfig.SetTmpMount(spec)
+	}
+	if VarTmpMount != "" {
+		spec, err := tmpMountSpec("--var-tmp", VarTmpMount)
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		engineConfig.SetVarTmpMount(spec)
+	}
+
+	if NoPivot {
+		sylog.Warningf("--no-pivot enters the container with chroot, the host root filesystem remains " +
+			"reachable from the container by processes with the CAP_SYS_CHROOT capability")
+		engineConfig.SetNoPivot(true)
+	}
+
 	homeFlag := cobraCmd.Flag("home")
 	engineConfig.SetCustomHome(homeFlag.Changed)
 
@@ -487,33 +775,13 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 	engineConfig.SetScratchDir(ScratchPath)
 	engineConfig.SetWorkdir(WorkdirPath)
 
-	homeSlice := strings.Split(HomePath, ":")
-
-	if len(homeSlice) > 2 || len(homeSlice) == 0 {
-		sylog.Fatalf("home argument has incorrect number of elements: %v", len(homeSlice))
-	}
-
-	engineConfig.SetHomeSource(homeSlice[0])
-	if len(homeSlice) == 1 {
-		engineConfig.SetHomeDest(homeSlice[0])
-	} else {
-		engineConfig.SetHomeDest(homeSlice[1])
-	}
-
-	if IsFakeroot {
-		UserNamespace = true
-	}
-
 	/* if name submitted, run as instance */
 	if name != "" {
 		PidNamespace = true
 		IpcNamespace = true
 		engineConfig.SetInstance(true)
 		engineConfig.SetBootInstance(IsBoot)
-
-		if useSuid && !UserNamespace && hidepidProc() {
-			sylog.Fatalf("hidepid option set on /proc mount, require 'hidepid=0' to start instance with setuid workflow")
-		}
+		engineConfig.SetStartOptions(instanceStartOptions)
 
 		_, err := instance.Get(name, instance.SingSubDir)
 		if err == nil {
@@ -544,39 +812,73 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 		procname = "Singularity runtime parent"
 	}
 
-	if NetNamespace {
-		if IsFakeroot && Network != "none" {
-			engineConfig.SetNetwork("fakeroot")
-
-			// unprivileged installation could not use fakeroot
-			// network because it requires a setuid installation
-			// so we fallback to none
-			if buildcfg.SINGULARITY_SUID_INSTALL == 0 || !engineConfig.File.AllowSetuid {
-				sylog.Warningf(
-					"fakeroot with unprivileged installation or 'allow setuid = no' " +
-						"could not use 'fakeroot' network, fallback to 'none' network",
-				)
-				engineConfig.SetNetwork("none")
-			}
+	if NetNamespace && IsFakeroot && Network != "none" {
+		engineConfig.SetNetwork("fakeroot")
+
+		// unprivileged installation could not use fakeroot
+		// network because it requires a setuid installation
+		// so we fallback to none
+		if buildcfg.SINGULARITY_SUID_INSTALL == 0 || !engineConfig.File.AllowSetuid {
+			sylog.Warningf(
+				"fakeroot with unprivileged installation or 'allow setuid = no' " +
+					"could not use 'fakeroot' network, fallback to 'none' network",
+			)
+			engineConfig.SetNetwork("none")
 		}
-		generator.AddOrReplaceLinuxNamespace("network", "")
-	}
-	if UtsNamespace {
-		generator.AddOrReplaceLinuxNamespace("uts", "")
 	}
 	if PidNamespace {
-		generator.AddOrReplaceLinuxNamespace("pid", "")
 		engineConfig.SetNoInit(NoInit)
 	}
-	if IpcNamespace {
-		generator.AddOrReplaceLinuxNamespace("ipc", "")
+
+	launcherOpts := launcher.Options{
+		UID: uid,
+		GID: gid,
+		Namespaces: launcher.Namespaces{
+			User: UserNamespace,
+			PID:  PidNamespace,
+			IPC:  IpcNamespace,
+			Net:  NetNamespace,
+			UTS:  UtsNamespace,
+		},
+		Fakeroot: IsFakeroot,
+		RemapIDs: remapIDs,
+		Home:     HomePath,
+		Pwd:      PwdPath,
+		App:      AppName,
+		Rlimits:  Rlimits,
+	}
+	if bundle != nil {
+		launcherOpts.DefaultPwd = bundle.processCwd()
+	}
+	// --sanitize-path overrides the default set in singularity.conf
+	if cobraCmd.Flag(actionSanitizePathFlag.Name).Changed {
+		launcherOpts.SanitizePath = &SanitizePath
+	}
+	wf, err := launcher.Configure(engineConfig, generator, launcherOpts)
+	if err != nil {
+		sylog.Fatalf("%s", err)
+	}
+	useSuid := wf.UseSuid
+	UserNamespace = wf.UserNamespace
+
+	if engineConfig.GetInstance() && useSuid && !UserNamespace && hidepidProc() {
+		sylog.Fatalf("hidepid option set on /proc mount, require 'hidepid=0' to start instance with setuid workflow")
 	}
-	if UserNamespace {
-		generator.AddOrReplaceLinuxNamespace("user", "")
 
-		if !IsFakeroot {
-			generator.AddLinuxUIDMapping(uid, uid, 1)
-			generator.AddLinuxGIDMapping(gid, gid, 1)
+	// the shell settings are passed to the action script for the
+	// shell command only, they don't apply to exec or run
+	if cobraCmd.Name() == "shell" {
+		if NoRC {
+			generator.AddProcessEnv("SINGULARITY_SHELL_NORC", "1")
+		}
+		historyFile := shellHistoryFile(
+			containerImage,
+			engineConfig.GetHomeSource(),
+			engineConfig.GetHomeDest(),
+			!engineConfig.GetNoHome() && engineConfig.File.ShellHistoryIsolation,
+		)
+		if historyFile != "" {
+			generator.AddProcessEnv("SINGULARITY_SHELL_HISTFILE", historyFile)
 		}
 	}
 
@@ -613,35 +915,142 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 		os.Setenv("SINGULARITYENV_"+e[0], e[1])
 	}
 
+	// profile variables don't override the ones set by the user
+	profileVars := make(map[string]string)
+	for _, v := range profileEnv(profiles) {
+		e := strings.SplitN(v, "=", 2)
+		profileVars["SINGULARITYENV_"+e[0]] = e[1]
+	}
+	for key, value := range profileVars {
+		if _, ok := os.LookupEnv(key); !ok {
+			os.Setenv(key, value)
+		}
+	}
+
 	// Copy and cache environment
 	environment := os.Environ()
 
 	// Clean environment
 	singularityEnv := env.SetContainerEnv(generator, environment, IsCleanEnv, engineConfig.GetHomeDest())
+	// the profile library paths are appended by the action scripts to
+	// the LD_LIBRARY_PATH of the container, set by the image or the user
+	if ldPath := profileLdPath(profiles); ldPath != "" {
+		singularityEnv["SING_PROFILE_LD_LIBRARY_PATH"] = ldPath
+	}
 	engineConfig.SetSingularityEnv(singularityEnv)
 
-	if pwd, err := os.Getwd(); err == nil {
-		engineConfig.SetCwd(pwd)
-		if PwdPath != "" {
-			generator.SetProcessCwd(PwdPath)
-		} else {
-			if engineConfig.GetContain() {
-				generator.SetProcessCwd(engineConfig.GetHomeDest())
-			} else {
-				generator.SetProcessCwd(pwd)
+	// the bundle environment is the image environment, it overrides
+	// the host environment but not the SINGULARITYENV_ variables
+	if bundle != nil {
+		for key, value := range bundle.processEnv() {
+			if _, ok := singularityEnv[key]; !ok {
+				generator.AddProcessEnv(key, value)
 			}
 		}
-	} else {
-		sylog.Warningf("can't determine current working directory: %s", err)
 	}
 
-	// starter will force the loading of kernel overlay module
-	loadOverlay := false
-	if !UserNamespace && buildcfg.SINGULARITY_SUID_INSTALL == 1 {
-		loadOverlay = true
+	// with MIG devices listed in CUDA_VISIBLE_DEVICES, only their
+	// device nodes are bound in the container
+	if Nvidia {
+		for _, e := range generator.Config.Process.Env {
+			if strings.HasPrefix(e, "CUDA_VISIBLE_DEVICES=") {
+				engineConfig.SetNvVisibleDevices(strings.TrimPrefix(e, "CUDA_VISIBLE_DEVICES="))
+			}
+		}
 	}
 
-	generator.AddProcessEnv("SINGULARITY_APPNAME", AppName)
+	if BindCgroups {
+		if !isPrivileged {
+			sylog.Fatalf("--bind-cgroups requires root privileges")
+		}
+		engineConfig.SetBindCgroups(true)
+	}
+
+	if PidFile != "" {
+		path, err := filepath.Abs(PidFile)
+		if err != nil {
+			sylog.Fatalf("Failed to determine absolute path of pid file %s: %s", PidFile, err)
+		}
+		engineConfig.SetPidFile(path)
+	}
+
+	if Timeout != "" {
+		timeout, err := time.ParseDuration(Timeout)
+		if err != nil || timeout <= 0 {
+			sylog.Fatalf("Invalid --timeout value %q, must be a positive duration (e.g. 30m)", Timeout)
+		}
+		engineConfig.SetTimeout(timeout)
+	}
+	if MaxOutput < 0 {
+		sylog.Fatalf("Invalid --max-output value %d, must be a positive number of bytes", MaxOutput)
+	}
+	engineConfig.SetMaxOutput(MaxOutput)
+
+	// exec and shell run the command in a pseudo terminal with --pty, or
+	// by default when the standard streams are all terminals and the
+	// command isn't kept a direct child with --no-fork
+	if name := cobraCmd.Name(); name == "exec" || name == "shell" {
+		if Pty && NoPty {
+			sylog.Fatalf("--pty and --no-pty are mutually exclusive")
+		}
+		engineConfig.SetAllocatePty(Pty || (isInteractive() && !NoPty && !NoFork))
+	}
+	// the process tree is already direct without supervising options,
+	// the engine refuses to add a supervising process with --no-fork
+	engineConfig.SetNoFork(NoFork)
+
+	// the image is checked once the container exits, the commands joining
+	// an instance don't own its container, which outlives them
+	if RootfsROCheck && engineConfig.GetInstanceJoin() {
+		sylog.Fatalf("--rootfs-ro-check can't be used to join an instance")
+	}
+
+	if ScifDataPath != "" {
+		if AppName == "" {
+			sylog.Fatalf("--scif-data requires an application set with --app")
+		}
+		path, err := filepath.Abs(ScifDataPath)
+		if err != nil {
+			sylog.Fatalf("Failed to determine absolute path of %s: %s", ScifDataPath, err)
+		}
+		if !fs.IsDir(path) {
+			sylog.Fatalf("--scif-data directory %s doesn't exist", path)
+		}
+		engineConfig.SetScifData(path)
+	}
+	if ScifDataQuota < 0 {
+		sylog.Fatalf("Invalid --scif-data-quota value %d, must be a positive size in MiB", ScifDataQuota)
+	} else if ScifDataQuota > 0 {
+		if AppName == "" {
+			sylog.Fatalf("--scif-data-quota requires an application set with --app")
+		}
+		if ScifDataPath != "" {
+			sylog.Fatalf("--scif-data-quota limits the temporary application data directory, it can't limit the --scif-data host directory")
+		}
+		engineConfig.SetScifDataQuota(ScifDataQuota)
+	}
+
+	if len(AppOrder) > 0 {
+		if AppName != "" {
+			sylog.Fatalf("--app and --app-order are mutually exclusive")
+		}
+		if AppExit != "last" && AppExit != "first" {
+			sylog.Fatalf("--app-exit value must be 'last' or 'first', got %q", AppExit)
+		}
+		for _, app := range AppOrder {
+			if app == "" {
+				sylog.Fatalf("--app-order contains an empty application name")
+			}
+		}
+		generator.AddProcessEnv("SINGULARITY_APPORDER", strings.Join(AppOrder, ","))
+		generator.AddProcessEnv("SINGULARITY_APPEXIT", AppExit)
+	}
+
+	// block devices are mounted like image files, this requires
+	// the setuid workflow
+	if (UserNamespace || insideUserNs) && fs.IsBlockDevice(image) {
+		sylog.Fatalf("Block device %s can't be used in a user namespace, a setuid installation is required", image)
+	}
 
 	// convert image file to sandbox if we are using user
 	// namespace or if we are currently running inside a
@@ -697,17 +1106,6 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 		}
 	}
 
-	// setuid workflow set RLIMIT_STACK to its default value,
-	// get the original value to restore it before executing
-	// container process
-	if useSuid {
-		soft, hard, err := rlimit.Get("RLIMIT_STACK")
-		if err != nil {
-			sylog.Warningf("can't retrieve stack size limit: %s", err)
-		}
-		generator.AddProcessRlimits("RLIMIT_STACK", hard, soft)
-	}
-
 	cfg := &config.Common{
 		EngineName:   singularityConfig.Name,
 		ContainerID:  name,
@@ -740,7 +1138,7 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 			starter.UseSuid(useSuid),
 			starter.WithStdout(stdout),
 			starter.WithStderr(stderr),
-			starter.LoadOverlayModule(loadOverlay),
+			starter.LoadOverlayModule(wf.LoadOverlay),
 		)
 
 		if sylog.GetLevel() != 0 {
@@ -755,7 +1153,7 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 			if end-start > 0 {
 				output := make([]byte, end-start)
 				stderr.ReadAt(output, start)
-				fmt.Println(string(output))
+				fmt.Fprintln(os.Stderr, string(output))
 			}
 		}
 
@@ -766,12 +1164,21 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 			sylog.Verbosef("you will find instance error here: %s", stderr.Name())
 			sylog.Infof("instance started successfully")
 		}
+	} else if RootfsROCheck {
+		runRootfsROCheck(
+			procname,
+			cfg,
+			containerImage,
+			engineConfig.GetWritableImage(),
+			starter.UseSuid(useSuid),
+			starter.LoadOverlayModule(wf.LoadOverlay),
+		)
 	} else {
 		err := starter.Exec(
 			procname,
 			cfg,
 			starter.UseSuid(useSuid),
-			starter.LoadOverlayModule(loadOverlay),
+			starter.LoadOverlayModule(wf.LoadOverlay),
 		)
 		sylog.Fatalf("%s", err)
 	}
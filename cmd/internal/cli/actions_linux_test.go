@@ -0,0 +1,161 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engine/singularity/config"
+)
+
+func TestHostDevices(t *testing.T) {
+	dir, err := ioutil.TempDir("", "host-devices-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "null")
+	if err := os.Symlink("/dev/null", link); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		spec    string
+		want    singularityConfig.Device
+		wantErr string
+	}{
+		{
+			name: "Source",
+			spec: "/dev/null",
+			want: singularityConfig.Device{Source: "/dev/null", Destination: "/dev/null"},
+		},
+		{
+			name: "ReadOnly",
+			spec: "/dev/null:ro",
+			want: singularityConfig.Device{Source: "/dev/null", Destination: "/dev/null", ReadOnly: true},
+		},
+		{
+			name: "Destination",
+			spec: "/dev/null:/dev/data/:rw",
+			want: singularityConfig.Device{Source: "/dev/null", Destination: "/dev/data"},
+		},
+		{
+			name: "Symlink",
+			spec: link + ":/dev/data:ro",
+			want: singularityConfig.Device{Source: "/dev/null", Destination: "/dev/data", ReadOnly: true},
+		},
+		{name: "RegularFile", spec: file + ":/dev/data", wantErr: "is not a block or character device"},
+		{name: "Missing", spec: "/dev/non-existent", wantErr: "while resolving device"},
+		{name: "RelativeSource", spec: "null:/dev/null", wantErr: "must be an absolute path"},
+		{name: "OutsideDev", spec: "/dev/null:/data", wantErr: "must be in /dev"},
+		{name: "BadSyntax", spec: "/dev/null:/dev/data:/dev/other", wantErr: "wrong device syntax"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := hostDevices([]string{tt.spec})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if want := []singularityConfig.Device{tt.want}; !reflect.DeepEqual(got, want) {
+				t.Errorf("got devices %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestShellHistoryFile(t *testing.T) {
+	defer func(f string) { HistoryFile = f }(HistoryFile)
+
+	home := CurrentUser.HomeDir
+	image := "/images/alpine.sif"
+	perImage := filepath.Join("/root", ".singularity", "shell_history", fmt.Sprintf("%x", sha256.Sum256([]byte(image))))
+
+	tests := []struct {
+		name        string
+		historyFile string
+		homeSource  string
+		isolate     bool
+		want        string
+	}{
+		{name: "PerImage", homeSource: home, isolate: true, want: perImage},
+		{name: "NotIsolated", homeSource: home, want: ""},
+		{name: "CustomHome", homeSource: "/tmp/home", isolate: true, want: ""},
+		{name: "Host", historyFile: "host", homeSource: home, isolate: true, want: ""},
+		{name: "None", historyFile: "none", homeSource: home, isolate: true, want: "/dev/null"},
+		{name: "Path", historyFile: "/tmp/history", homeSource: home, want: "/tmp/history"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			HistoryFile = tt.historyFile
+			if got := shellHistoryFile(image, tt.homeSource, "/root", tt.isolate); got != tt.want {
+				t.Errorf("got history file %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTmpMountSpec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmp-mount-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		spec    string
+		want    string
+		wantErr string
+	}{
+		{name: "Tmpfs", spec: "tmpfs", want: "tmpfs"},
+		{name: "Directory", spec: dir, want: dir},
+		{name: "CleanedDirectory", spec: dir + "/./", want: dir},
+		{name: "File", spec: file, wantErr: "is not a directory"},
+		{name: "Missing", spec: filepath.Join(dir, "missing"), wantErr: "no such file or directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tmpMountSpec("--tmp", tt.spec)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -9,9 +9,22 @@ package cli
 
 import (
 	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/pkg/sylog"
 )
 
+// unsupportedExecution is reported by the commands running containers,
+// outside of Linux they can only run in a virtual machine.
+const unsupportedExecution = "not supported on this platform; use a remote endpoint or Linux host"
+
+// checkActionOptions stops the action commands before fetching the image
+// when there is no hypervisor to run the container.
+func checkActionOptions(cmd *cobra.Command, args []string) {
+	if !hypervisorInstalled() {
+		sylog.Fatalf("%s: %s", cmd.Name(), unsupportedExecution)
+	}
+}
+
 // TODO: Let's stick this in another file so that that CLI is just CLI
 func execStarter(cobraCmd *cobra.Command, image string, args []string, name string) {
-	panic("starter is unsupported on this platform")
+	sylog.Fatalf("%s without --vm: %s", cobraCmd.Name(), unsupportedExecution)
 }
@@ -0,0 +1,24 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/sylabs/singularity/internal/pkg/client/bucket"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// bucketConfigs returns the settings of the s3:// and gs:// buckets from
+// the remote configuration.
+func bucketConfigs() []bucket.Config {
+	c, err := syncedRemoteConf()
+	if err != nil {
+		sylog.Warningf("Unable to load remote configuration, bucket settings are ignored: %s", err)
+	}
+	if c == nil {
+		return nil
+	}
+	return c.BucketConfigs()
+}
@@ -7,40 +7,58 @@
 package cli
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"runtime"
 
 	ocitypes "github.com/containers/image/v5/types"
 	"github.com/spf13/cobra"
 	scsbuildclient "github.com/sylabs/scs-build-client/client"
 	scslibclient "github.com/sylabs/scs-library-client/client"
+	"github.com/sylabs/sif/pkg/sif"
 	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/pkg/build"
 	"github.com/sylabs/singularity/internal/pkg/remote/endpoint"
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
 	"github.com/sylabs/singularity/internal/pkg/util/interactive"
 	"github.com/sylabs/singularity/pkg/build/types"
 	"github.com/sylabs/singularity/pkg/build/types/parser"
 	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/image"
 	"github.com/sylabs/singularity/pkg/sylog"
 )
 
 var buildArgs struct {
-	sections   []string
-	arch       string
-	builderURL string
-	libraryURL string
-	detached   bool
-	encrypt    bool
-	fakeroot   bool
-	fixPerms   bool
-	isJSON     bool
-	noCleanUp  bool
-	noTest     bool
-	remote     bool
-	sandbox    bool
-	update     bool
+	sections     []string
+	arch         string
+	blockSize    string
+	buildArgs    []string
+	builderURL   string
+	libraryURL   string
+	detached     bool
+	encrypt      bool
+	fakeroot     bool
+	fixPerms     bool
+	forceUnsafe  bool
+	isJSON       bool
+	noCleanUp    bool
+	noTest       bool
+	osVersion    string
+	remote       bool
+	reproducible bool
+	sandbox      bool
+	secrets      []string
+	secretsDisk  bool
+	shellOptions string
+	skipScan     bool
+	timestamps   bool
+	testUnpriv   bool
+	update       bool
+	updateBase   bool
 }
 
 // -s|--sandbox
@@ -81,10 +99,30 @@ var buildUpdateFlag = cmdline.Flag{
 	DefaultValue: false,
 	Name:         "update",
 	ShortHand:    "u",
-	Usage:        "run definition over existing container (skips header)",
+	Usage:        "run definition over existing container (skips header), or resume an interrupted sandbox build",
 	EnvKeys:      []string{"UPDATE"},
 }
 
+// --force-unsafe
+var buildForceUnsafeFlag = cmdline.Flag{
+	ID:           "buildForceUnsafeFlag",
+	Value:        &buildArgs.forceUnsafe,
+	DefaultValue: false,
+	Name:         "force-unsafe",
+	Usage:        "like --force, but also overwrite a build target which is not a Singularity image",
+	EnvKeys:      []string{"FORCE_UNSAFE"},
+}
+
+// --update-base
+var buildUpdateBaseFlag = cmdline.Flag{
+	ID:           "buildUpdateBaseFlag",
+	Value:        &buildArgs.updateBase,
+	DefaultValue: false,
+	Name:         "update-base",
+	Usage:        "fetch a fresh copy of the base image instead of using the cached one",
+	EnvKeys:      []string{"UPDATE_BASE"},
+}
+
 // -T|--notest
 var buildNoTestFlag = cmdline.Flag{
 	ID:           "buildNoTestFlag",
@@ -96,6 +134,82 @@ var buildNoTestFlag = cmdline.Flag{
 	EnvKeys:      []string{"NOTEST"},
 }
 
+// --build-arg
+var buildArgFlag = cmdline.Flag{
+	ID:           "buildArgFlag",
+	Value:        &buildArgs.buildArgs,
+	DefaultValue: []string{},
+	Name:         "build-arg",
+	Usage:        "set a build argument referenced as {{ .NAME }} or in {{ if .NAME }} guards in the definition file (NAME=VALUE)",
+}
+
+// --secret
+var buildSecretFlag = cmdline.Flag{
+	ID:           "buildSecretFlag",
+	Value:        &buildArgs.secrets,
+	DefaultValue: []string{},
+	Name:         "secret",
+	Usage:        "expose a host file to the %post section at /run/secrets/<id> without recording it in the image (id=<id>,src=<path>)",
+}
+
+// --secrets-on-disk
+var buildSecretsOnDiskFlag = cmdline.Flag{
+	ID:           "buildSecretsOnDiskFlag",
+	Value:        &buildArgs.secretsDisk,
+	DefaultValue: false,
+	Name:         "secrets-on-disk",
+	Usage:        "allow staging the --secret files in the temporary directory when /dev/shm is not available, their content is then written to a disk",
+}
+
+// --shell-options
+var buildShellOptionsFlag = cmdline.Flag{
+	ID:           "buildShellOptionsFlag",
+	Value:        &buildArgs.shellOptions,
+	DefaultValue: "",
+	Name:         "shell-options",
+	Usage:        "shell options of the %pre, %setup, %post and %test sections (errexit, pipefail or none), overriding the ShellOptions header",
+}
+
+// --os-version
+var buildOSVersionFlag = cmdline.Flag{
+	ID:           "buildOSVersionFlag",
+	Value:        &buildArgs.osVersion,
+	DefaultValue: "",
+	Name:         "os-version",
+	Usage:        "OS version bootstrapped by the debootstrap, yum and zypper bootstrap agents, overriding the OSVersion header",
+	EnvKeys:      []string{"OS_VERSION"},
+}
+
+// --skip-scan
+var buildSkipScanFlag = cmdline.Flag{
+	ID:           "buildSkipScanFlag",
+	Value:        &buildArgs.skipScan,
+	DefaultValue: false,
+	Name:         "skip-scan",
+	Usage:        "do not run the post build image scan (must be allowed by the administrator)",
+	EnvKeys:      []string{"SKIP_SCAN"},
+}
+
+// --reproducible
+var buildReproducibleFlag = cmdline.Flag{
+	ID:           "buildReproducibleFlag",
+	Value:        &buildArgs.reproducible,
+	DefaultValue: false,
+	Name:         "reproducible",
+	Usage:        "build a bit-identical SIF image from identical inputs, timestamps are set from SOURCE_DATE_EPOCH or the definition file modification time",
+	EnvKeys:      []string{"REPRODUCIBLE"},
+}
+
+// --blocksize
+var buildBlockSizeFlag = cmdline.Flag{
+	ID:           "buildBlockSizeFlag",
+	Value:        &buildArgs.blockSize,
+	DefaultValue: "",
+	Name:         "blocksize",
+	Usage:        "squashfs block size of the SIF image, a power of two from 4K to 1M (mksquashfs default 128K), smaller blocks speed up random reads at the cost of compression ratio",
+	EnvKeys:      []string{"BLOCKSIZE"},
+}
+
 // -r|--remote
 var buildRemoteFlag = cmdline.Flag{
 	ID:           "buildRemoteFlag",
@@ -200,27 +314,60 @@ var buildFixPermsFlag = cmdline.Flag{
 	EnvKeys:      []string{"FIXPERMS"},
 }
 
+// --timestamps
+var buildTimestampsFlag = cmdline.Flag{
+	ID:           "buildTimestampsFlag",
+	Value:        &buildArgs.timestamps,
+	DefaultValue: false,
+	Name:         "timestamps",
+	Usage:        "prefix each line of the %pre, %setup, %post and %test output with the time elapsed since the build started",
+	EnvKeys:      []string{"BUILD_TIMESTAMPS"},
+}
+
+// --test-unprivileged
+var buildTestUnprivilegedFlag = cmdline.Flag{
+	ID:           "buildTestUnprivilegedFlag",
+	Value:        &buildArgs.testUnpriv,
+	DefaultValue: false,
+	Name:         "test-unprivileged",
+	Usage:        "run the %test section as an unprivileged user (UID/GID 65534) instead of the user running %post",
+	EnvKeys:      []string{"TEST_UNPRIVILEGED"},
+}
+
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterCmd(buildCmd)
 
 		cmdManager.RegisterFlagForCmd(&buildArchFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildArgFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildBlockSizeFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildBuilderFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildDetachedFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildDisableCacheFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildEncryptFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildFakerootFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildFixPermsFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildForceUnsafeFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildJSONFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildLibraryFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildNoCleanupFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildNoTestFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildOSVersionFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildRemoteFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildReproducibleFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildSandboxFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildSecretFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildSecretsOnDiskFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildSectionFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildShellOptionsFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildSkipScanFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildTestUnprivilegedFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildTimestampsFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildUpdateFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildUpdateBaseFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&commonForceFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&commonNoHTTPSFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&commonRegistryInsecureFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&commonTmpDirFlag, buildCmd)
 
 		cmdManager.RegisterFlagForCmd(&dockerUsernameFlag, buildCmd)
@@ -268,28 +415,50 @@ func checkBuildTarget(path string) error {
 	if !buildArgs.sandbox && buildArgs.update {
 		return fmt.Errorf("only sandbox update is supported: --sandbox flag is missing")
 	}
+	if buildArgs.forceUnsafe {
+		forceOverwrite = true
+	}
 	if f, err := os.Stat(abspath); err == nil {
 		if buildArgs.update && !f.IsDir() {
 			return fmt.Errorf("only sandbox update is supported: %s is not a directory", abspath)
 		}
+
+		// a sandbox left by an interrupted build can be resumed
+		var state *build.State
+		if f.IsDir() {
+			if state, err = build.ReadState(abspath); err != nil {
+				sylog.Warningf("Could not read the build state of %s: %s", abspath, err)
+			}
+		}
+		// --force only overwrites Singularity images, to not lose
+		// an unrelated file or directory because of a mistyped path
+		if forceOverwrite && !buildArgs.forceUnsafe && !buildArgs.update {
+			isImage, err := isSingularityTarget(abspath, f, state)
+			if err != nil {
+				return err
+			} else if !isImage {
+				return fmt.Errorf("%s is not a Singularity image, check its content first and use --force-unsafe if you want to overwrite it", abspath)
+			}
+		}
+		if forceOverwrite {
+			target := "file"
+			if state != nil {
+				target = fmt.Sprintf("sandbox of an interrupted build (completed phases: %s)", state)
+			} else if f.IsDir() {
+				target = "directory"
+			}
+			sylog.Warningf("--force: removing the existing %s %s", target, abspath)
+		}
+
 		// check if the sandbox image being overwritten looks like a Singularity
 		// image and inform users to check its content and use --force option if
 		// the sandbox image is not a Singularity image
 		if f.IsDir() && !forceOverwrite {
-			files, err := ioutil.ReadDir(abspath)
+			sandbox, err := isSandbox(abspath)
 			if err != nil {
-				return fmt.Errorf("could not read sandbox directory %s: %s", abspath, err)
-			} else if len(files) > 0 {
-				required := 0
-				for _, f := range files {
-					switch f.Name() {
-					case ".singularity.d", "dev", "proc", "sys":
-						required++
-					}
-				}
-				if required != 4 {
-					return fmt.Errorf("%s is not empty and is not a Singularity sandbox, check its content first and use --force if you want to overwrite it", abspath)
-				}
+				return err
+			} else if !sandbox {
+				return fmt.Errorf("%s is not empty and is not a Singularity sandbox, check its content first and use --force-unsafe if you want to overwrite it", abspath)
 			}
 		}
 		if !buildArgs.update && !forceOverwrite {
@@ -298,6 +467,9 @@ func checkBuildTarget(path string) error {
 
 			if isDefFile, _ := parser.IsValidDefinition(abspath); isDefFile {
 				question = fmt.Sprintf("Build target '%s' is a definition file that will be overwritten. Do you still want to overwrite? [N/y]", f.Name())
+			} else if state != nil {
+				question = fmt.Sprintf("Build target '%s' holds an interrupted build (completed phases: %s), use --update to resume it. "+
+					"Do you want to delete it and rebuild from scratch? [N/y]", f.Name(), state)
 			}
 
 			input, err := interactive.AskYNQuestion("n", question)
@@ -315,9 +487,75 @@ func checkBuildTarget(path string) error {
 	return nil
 }
 
+// isSandbox returns whether the directory path is empty or looks like
+// a Singularity sandbox image.
+func isSandbox(path string) (bool, error) {
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return false, fmt.Errorf("could not read sandbox directory %s: %s", path, err)
+	}
+	if len(files) == 0 {
+		return true, nil
+	}
+	required := 0
+	for _, f := range files {
+		switch f.Name() {
+		case ".singularity.d", "dev", "proc", "sys":
+			required++
+		}
+	}
+	return required == 4, nil
+}
+
+// isSingularityTarget returns whether the existing build target path with
+// the file information f can be overwritten by --force: a Singularity image
+// file, a sandbox, possibly left by an interrupted build with the build
+// state, or a character device like /dev/null.
+func isSingularityTarget(path string, f os.FileInfo, state *build.State) (bool, error) {
+	switch {
+	case f.IsDir():
+		if state != nil {
+			return true, nil
+		}
+		return isSandbox(path)
+	case f.Mode().IsRegular():
+		r, err := os.Open(path)
+		if err != nil {
+			return false, fmt.Errorf("could not open build target %s: %s", path, err)
+		}
+		defer r.Close()
+
+		// image formats are identified by the header
+		b := make([]byte, 2048)
+		n, err := io.ReadFull(r, b)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return false, fmt.Errorf("could not read build target %s: %s", path, err)
+		}
+		b = b[:n]
+
+		// the SIF magic follows the launch script line in the header
+		if len(b) >= sif.HdrLaunchLen+len(sif.HdrMagic) &&
+			bytes.Equal(b[sif.HdrLaunchLen:sif.HdrLaunchLen+len(sif.HdrMagic)], []byte(sif.HdrMagic)) {
+			return true, nil
+		}
+		if _, err := image.GetSquashfsComp(b); err == nil {
+			return true, nil
+		}
+		if _, err := image.CheckExt3Header(b); err == nil {
+			return true, nil
+		}
+		return false, nil
+	case f.Mode()&os.ModeCharDevice != 0:
+		return true, nil
+	}
+	// block devices, named pipes and sockets are never written by a build
+	return false, nil
+}
+
 // definitionFromSpec is specifically for parsing specs for the remote builder
-// it uses a different version the the definition struct and parser
-func definitionFromSpec(spec string) (types.Definition, error) {
+// it uses a different version the the definition struct and parser, the
+// build arguments args are applied to a definition file
+func definitionFromSpec(spec string, args map[string]string) (types.Definition, error) {
 	// Try spec as URI first
 	def, err := types.NewDefinitionFromURI(spec)
 	if err == nil {
@@ -342,7 +580,11 @@ func definitionFromSpec(spec string) (types.Definition, error) {
 
 		defer defFile.Close()
 
-		return parser.ParseDefinitionFile(defFile)
+		r, err := build.RenderDefinition(defFile, filepath.Base(spec), args)
+		if err != nil {
+			return types.Definition{}, err
+		}
+		return parser.ParseDefinitionFile(r)
 	}
 
 	// File exists and does NOT contain a valid definition
@@ -9,20 +9,26 @@ package cli
 import (
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	osExec "os/exec"
+	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/internal/app/singularity"
 	"github.com/sylabs/singularity/internal/pkg/build"
 	"github.com/sylabs/singularity/internal/pkg/build/remotebuilder"
 	"github.com/sylabs/singularity/internal/pkg/buildcfg"
 	"github.com/sylabs/singularity/internal/pkg/cache"
 	fakerootConfig "github.com/sylabs/singularity/internal/pkg/runtime/engine/fakeroot/config"
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/internal/pkg/util/fs/squashfs"
 	"github.com/sylabs/singularity/internal/pkg/util/interactive"
 	"github.com/sylabs/singularity/internal/pkg/util/starter"
 	"github.com/sylabs/singularity/internal/pkg/util/user"
@@ -31,6 +37,8 @@ import (
 	"github.com/sylabs/singularity/pkg/runtime/engine/config"
 	"github.com/sylabs/singularity/pkg/sylog"
 	"github.com/sylabs/singularity/pkg/util/crypt"
+	"github.com/sylabs/singularity/pkg/util/singularityconf"
+	"golang.org/x/crypto/ssh/terminal"
 )
 
 func fakerootExec(cmdArgs []string) {
@@ -96,17 +104,175 @@ func runBuild(cmd *cobra.Command, args []string) {
 	dest := args[0]
 	spec := args[1]
 
+	hook, err := postBuildHook()
+	if err != nil {
+		sylog.Fatalf("%s", err)
+	}
+
+	if buildArgs.reproducible && hook != nil {
+		sylog.Warningf("The post build hook report recorded in the image makes the build not reproducible")
+	}
+
+	if spec == "-" {
+		if _, ok := os.LookupEnv("SOURCE_DATE_EPOCH"); buildArgs.reproducible && !ok {
+			sylog.Fatalf("SOURCE_DATE_EPOCH must be set for reproducible builds reading the definition from standard input")
+		}
+		if dest != "-" && !forceOverwrite {
+			if _, err := os.Stat(dest); err == nil {
+				sylog.Fatalf("Build target %s already exists, use --force to overwrite it when reading the definition from standard input", dest)
+			}
+		}
+
+		defFile, err := definitionFromStdin()
+		if err != nil {
+			sylog.Fatalf("While reading definition from standard input: %s", err)
+		}
+		defer os.Remove(defFile)
+
+		spec = defFile
+	}
+
+	if dest == "-" {
+		if buildArgs.sandbox {
+			sylog.Fatalf("Sandbox builds can't be written to standard output")
+		}
+		if terminal.IsTerminal(int(os.Stdout.Fd())) {
+			sylog.Fatalf("Refusing to write image to a terminal, redirect standard output")
+		}
+
+		stdout, err := redirectStdout()
+		if err != nil {
+			sylog.Fatalf("While redirecting standard output: %s", err)
+		}
+		defer stdout.Close()
+
+		dir, err := ioutil.TempDir(tmpDir, "build-stdout-")
+		if err != nil {
+			sylog.Fatalf("Could not create temporary directory: %s", err)
+		}
+		defer os.RemoveAll(dir)
+
+		image := filepath.Join(dir, "image.sif")
+		buildImage(ctx, cmd, image, spec, hook)
+
+		if err := writeImage(stdout, image); err != nil {
+			sylog.Fatalf("While writing image to standard output: %s", err)
+		}
+		sylog.Infof("Build complete: image written to standard output")
+		return
+	}
+
 	// check if target collides with existing file
 	if err := checkBuildTarget(dest); err != nil {
 		sylog.Fatalf("While checking build target: %s", err)
 	}
 
+	buildImage(ctx, cmd, dest, spec, hook)
+	sylog.Infof("Build complete: %s", dest)
+}
+
+func buildImage(ctx context.Context, cmd *cobra.Command, dest, spec string, hook *singularity.ScanHook) {
 	if buildArgs.remote {
 		runBuildRemote(ctx, cmd, dest, spec)
 	} else {
 		runBuildLocal(ctx, cmd, dest, spec)
 	}
-	sylog.Infof("Build complete: %s", dest)
+
+	if hook != nil {
+		scanImage(ctx, hook, dest)
+	}
+}
+
+// postBuildHook returns the post build hook configured by the
+// administrator, nil if there is none or if the scan is skipped.
+func postBuildHook() (*singularity.ScanHook, error) {
+	conf := singularityconf.GetCurrentConfig()
+
+	hook, err := singularity.NewScanHook(conf)
+	if err == singularity.ErrNoScanHook {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("while configuring post build hook: %s", err)
+	}
+
+	if buildArgs.skipScan {
+		if !conf.AllowSkipScan {
+			return nil, fmt.Errorf("--skip-scan is not allowed by the administrator")
+		}
+		sylog.Warningf("Skipping post build image scan")
+		return nil, nil
+	}
+	if buildArgs.remote && buildArgs.detached {
+		sylog.Warningf("Detached remote builds are not scanned")
+		return nil, nil
+	}
+	return hook, nil
+}
+
+// scanImage runs the post build hook against the built image and records
+// its report in the image. The image is removed if the scan fails, unless
+// an existing sandbox was updated.
+func scanImage(ctx context.Context, hook *singularity.ScanHook, image string) {
+	r, err := hook.Scan(ctx, image)
+	if err != nil {
+		if r != nil {
+			os.Stderr.WriteString(r.Output)
+			if !buildArgs.update {
+				os.RemoveAll(image)
+			}
+		}
+		sylog.Fatalf("While scanning image: %s", err)
+	}
+
+	if err := singularity.RecordScanReport(image, r); err != nil {
+		sylog.Fatalf("While recording scan report: %s", err)
+	}
+	sylog.Verbosef("Image scan report recorded in %s", image)
+}
+
+// definitionFromStdin writes the definition read from the standard input
+// to a temporary file and returns its path.
+func definitionFromStdin() (string, error) {
+	f, err := ioutil.TempFile(tmpDir, "stdin-def-")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, os.Stdin); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// redirectStdout redirects the standard output to the standard error, so
+// nothing else than the image can be written to the original standard
+// output, returned as a file.
+func redirectStdout() (*os.File, error) {
+	fd, err := syscall.Dup(int(os.Stdout.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	syscall.CloseOnExec(fd)
+
+	if err := syscall.Dup3(int(os.Stderr.Fd()), int(os.Stdout.Fd()), 0); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), "stdout"), nil
+}
+
+// writeImage copies the image file to w.
+func writeImage(w io.Writer, image string) error {
+	f, err := os.Open(image)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
 }
 
 func runBuildRemote(ctx context.Context, cmd *cobra.Command, dst, spec string) {
@@ -114,6 +280,30 @@ func runBuildRemote(ctx context.Context, cmd *cobra.Command, dst, spec string) {
 	if buildArgs.encrypt {
 		sylog.Fatalf("Building encrypted container with the remote builder is not currently supported.")
 	}
+	if buildArgs.updateBase {
+		sylog.Warningf("--update-base has no effect with the remote builder, which doesn't share the local image cache")
+	}
+	if buildArgs.reproducible {
+		sylog.Warningf("--reproducible is not supported by the remote builder, the image won't be reproducible")
+	}
+	if buildArgs.blockSize != "" {
+		sylog.Fatalf("--blocksize is not supported by the remote builder")
+	}
+	if buildArgs.osVersion != "" {
+		sylog.Fatalf("--os-version is not supported by the remote builder, set the OSVersion header instead")
+	}
+	if buildArgs.timestamps {
+		sylog.Warningf("--timestamps is not supported by the remote builder, the output won't be timestamped")
+	}
+	if buildArgs.testUnpriv {
+		sylog.Fatalf("--test-unprivileged is not supported by the remote builder")
+	}
+	if len(buildArgs.secrets) > 0 {
+		sylog.Fatalf("--secret is not supported by the remote builder")
+	}
+	if len(registryInsecure) > 0 {
+		sylog.Warningf("--registry-insecure has no effect with the remote builder")
+	}
 
 	bc, lc, err := getBuildAndLibraryClientConfig(buildArgs.builderURL, buildArgs.libraryURL)
 	if err != nil {
@@ -127,7 +317,12 @@ func runBuildRemote(ctx context.Context, cmd *cobra.Command, dst, spec string) {
 		sylog.Fatalf("Unable to submit build job: %v", remoteWarning)
 	}
 
-	def, err := definitionFromSpec(spec)
+	defArgs, err := build.ParseBuildArgs(buildArgs.buildArgs)
+	if err != nil {
+		sylog.Fatalf("While parsing build arguments: %v", err)
+	}
+
+	def, err := definitionFromSpec(spec, defArgs)
 	if err != nil {
 		sylog.Fatalf("Unable to build from %s: %v", spec, err)
 	}
@@ -240,8 +435,13 @@ func runBuildLocal(ctx context.Context, cmd *cobra.Command, dst, spec string) {
 		sylog.Fatalf("While creating Docker credentials: %v", err)
 	}
 
+	defArgs, err := build.ParseBuildArgs(buildArgs.buildArgs)
+	if err != nil {
+		sylog.Fatalf("While parsing build arguments: %v", err)
+	}
+
 	// parse definition to determine build source
-	defs, err := build.MakeAllDefs(spec)
+	defs, err := build.MakeAllDefs(spec, defArgs)
 	if err != nil {
 		sylog.Fatalf("Unable to build from %s: %v", spec, err)
 	}
@@ -267,6 +467,19 @@ func runBuildLocal(ctx context.Context, cmd *cobra.Command, dst, spec string) {
 		authToken = lc.AuthToken
 	}
 
+	secrets, err := build.ParseSecrets(buildArgs.secrets)
+	if err != nil {
+		sylog.Fatalf("While parsing secrets: %v", err)
+	}
+
+	var date time.Time
+	if buildArgs.reproducible {
+		if date, err = sourceDate(spec); err != nil {
+			sylog.Fatalf("While setting reproducible build time: %v", err)
+		}
+		sylog.Verbosef("Reproducible build time set to %s", date.UTC())
+	}
+
 	buildFormat := "sif"
 	sandboxTarget := false
 	if buildArgs.sandbox {
@@ -275,6 +488,17 @@ func runBuildLocal(ctx context.Context, cmd *cobra.Command, dst, spec string) {
 
 	}
 
+	var blockSize uint32
+	if buildArgs.blockSize != "" {
+		if buildArgs.sandbox {
+			sylog.Fatalf("--blocksize only applies to SIF images, not to sandbox builds")
+		}
+		if blockSize, err = squashfs.ParseBlockSize(buildArgs.blockSize); err != nil {
+			sylog.Fatalf("While setting the squashfs block size: %v", err)
+		}
+		sylog.Verbosef("Squashfs block size set to %d bytes", blockSize)
+	}
+
 	b, err := build.New(
 		defs,
 		build.Config{
@@ -282,20 +506,33 @@ func runBuildLocal(ctx context.Context, cmd *cobra.Command, dst, spec string) {
 			Format:    buildFormat,
 			NoCleanUp: buildArgs.noCleanUp,
 			Opts: types.Options{
-				ImgCache:          imgCache,
-				TmpDir:            tmpDir,
-				NoCache:           disableCache,
-				Update:            buildArgs.update,
-				Force:             forceOverwrite,
-				Sections:          buildArgs.sections,
-				NoTest:            buildArgs.noTest,
-				NoHTTPS:           noHTTPS,
-				LibraryURL:        buildArgs.libraryURL,
-				LibraryAuthToken:  authToken,
-				DockerAuthConfig:  authConf,
-				EncryptionKeyInfo: keyInfo,
-				FixPerms:          buildArgs.fixPerms,
-				SandboxTarget:     sandboxTarget,
+				ImgCache:           imgCache,
+				TmpDir:             tmpDir,
+				NoCache:            disableCache,
+				Update:             buildArgs.update,
+				UpdateBase:         buildArgs.updateBase,
+				Reproducible:       buildArgs.reproducible,
+				SourceDate:         date,
+				BlockSize:          blockSize,
+				Force:              forceOverwrite,
+				Sections:           buildArgs.sections,
+				NoTest:             buildArgs.noTest,
+				TestUnprivileged:   buildArgs.testUnpriv,
+				ShellOptions:       buildArgs.shellOptions,
+				OSVersion:          buildArgs.osVersion,
+				Timestamps:         buildArgs.timestamps,
+				NoHTTPS:            noHTTPS,
+				InsecureRegistries: insecureRegistries(),
+				Buckets:            bucketConfigs(),
+				Mirrors:            mirrorRules(),
+				LibraryURL:         buildArgs.libraryURL,
+				LibraryAuthToken:   authToken,
+				DockerAuthConfig:   authConf,
+				EncryptionKeyInfo:  keyInfo,
+				FixPerms:           buildArgs.fixPerms,
+				SandboxTarget:      sandboxTarget,
+				Secrets:            secrets,
+				SecretsOnDisk:      buildArgs.secretsDisk,
 			},
 		})
 	if err != nil {
@@ -307,6 +544,28 @@ func runBuildLocal(ctx context.Context, cmd *cobra.Command, dst, spec string) {
 	}
 }
 
+// sourceDate returns the build time recorded by reproducible builds, read
+// from SOURCE_DATE_EPOCH or from the modification time of the build spec
+// when it's a local file.
+func sourceDate(spec string) (time.Time, error) {
+	if epoch, ok := os.LookupEnv("SOURCE_DATE_EPOCH"); ok {
+		sec, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %s", epoch, err)
+		}
+		return time.Unix(sec, 0), nil
+	}
+
+	if !fs.IsFile(spec) {
+		return time.Time{}, fmt.Errorf("SOURCE_DATE_EPOCH must be set when not building from a local file")
+	}
+	fi, err := os.Stat(spec)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
 func checkSections() error {
 	var all, none bool
 	for _, section := range buildArgs.sections {
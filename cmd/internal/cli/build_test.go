@@ -0,0 +1,87 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/build"
+)
+
+func TestIsSingularityTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "build-target-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	document := filepath.Join(dir, "document.txt")
+	if err := ioutil.WriteFile(document, []byte("not an image"), 0644); err != nil {
+		t.Fatalf("failed to create file: %s", err)
+	}
+	empty := filepath.Join(dir, "empty")
+	sandbox := filepath.Join(dir, "sandbox")
+	other := filepath.Join(dir, "other")
+	for _, d := range []string{empty, sandbox, other} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatalf("failed to create directory: %s", err)
+		}
+	}
+	for _, d := range []string{".singularity.d", "dev", "proc", "sys"} {
+		if err := os.Mkdir(filepath.Join(sandbox, d), 0755); err != nil {
+			t.Fatalf("failed to create directory: %s", err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(other, "secret"), []byte("secret"), 0644); err != nil {
+		t.Fatalf("failed to create file: %s", err)
+	}
+	// a document quoting the SIF magic anywhere but at its header offset
+	quote := filepath.Join(dir, "quote.txt")
+	if err := ioutil.WriteFile(quote, []byte("images start with SIF_MAGIC"), 0644); err != nil {
+		t.Fatalf("failed to create file: %s", err)
+	}
+	fifo := filepath.Join(dir, "fifo")
+	if err := syscall.Mkfifo(fifo, 0644); err != nil {
+		t.Fatalf("failed to create named pipe: %s", err)
+	}
+
+	tests := []struct {
+		name  string
+		path  string
+		state *build.State
+		want  bool
+	}{
+		{name: "SIF", path: "../../../internal/app/singularity/testdata/images/one-group.sif", want: true},
+		{name: "Document", path: document, want: false},
+		{name: "EmptyDirectory", path: empty, want: true},
+		{name: "Sandbox", path: sandbox, want: true},
+		{name: "Directory", path: other, want: false},
+		{name: "InterruptedBuild", path: other, state: &build.State{}, want: true},
+		{name: "Device", path: "/dev/null", want: true},
+		{name: "QuotedMagic", path: quote, want: false},
+		{name: "NamedPipe", path: fifo, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := os.Stat(tt.path)
+			if err != nil {
+				t.Fatalf("failed to stat %s: %s", tt.path, err)
+			}
+			got, err := isSingularityTarget(tt.path, f, tt.state)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v for %s, expected %v", got, tt.path, tt.want)
+			}
+		})
+	}
+}
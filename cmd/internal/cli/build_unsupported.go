@@ -4,12 +4,15 @@
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
 
+// +build !linux
+
 package cli
 
 import (
 	"context"
 
 	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/internal/pkg/build"
 	"github.com/sylabs/singularity/internal/pkg/build/remotebuilder"
 	"github.com/sylabs/singularity/pkg/sylog"
 )
@@ -43,7 +46,12 @@ func runBuild(cmd *cobra.Command, args []string) {
 		sylog.Fatalf("Unable to submit build job: %v", remoteWarning)
 	}
 
-	def, err := definitionFromSpec(spec)
+	defArgs, err := build.ParseBuildArgs(buildArgs.buildArgs)
+	if err != nil {
+		sylog.Fatalf("While parsing build arguments: %v", err)
+	}
+
+	def, err := definitionFromSpec(spec, defArgs)
 	if err != nil {
 		sylog.Fatalf("Unable to build from %s: %v", spec, err)
 	}
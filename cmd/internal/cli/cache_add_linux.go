@@ -0,0 +1,31 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// cacheAddCmd is 'singularity cache add' and will add a local SIF image to your local singularity cache
+var cacheAddCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		imgCache := getCacheHandle(cache.Config{})
+		if err := singularity.AddSingularityCache(imgCache, args[0]); err != nil {
+			sylog.Fatalf("Failed to add image to cache: %v", err)
+		}
+	},
+
+	Use:     docs.CacheAddUse,
+	Short:   docs.CacheAddShort,
+	Long:    docs.CacheAddLong,
+	Example: docs.CacheAddExample,
+}
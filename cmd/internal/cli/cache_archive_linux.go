@@ -0,0 +1,50 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// cacheExportCmd is 'singularity cache export' and will write the cache
+// entries to a tar archive
+var cacheExportCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		imgCache := getCacheHandle(cache.Config{})
+		if err := singularity.ExportSingularityCache(imgCache, args[0]); err != nil {
+			sylog.Fatalf("Failed to export cache: %v", err)
+		}
+	},
+
+	Use:     docs.CacheExportUse,
+	Short:   docs.CacheExportShort,
+	Long:    docs.CacheExportLong,
+	Example: docs.CacheExportExample,
+}
+
+// cacheImportCmd is 'singularity cache import' and will add the entries of
+// a tar archive written by 'singularity cache export' to the cache
+var cacheImportCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		imgCache := getCacheHandle(cache.Config{})
+		if err := singularity.ImportSingularityCache(imgCache, args[0]); err != nil {
+			sylog.Fatalf("Failed to import cache: %v", err)
+		}
+	},
+
+	Use:     docs.CacheImportUse,
+	Short:   docs.CacheImportShort,
+	Long:    docs.CacheImportLong,
+	Example: docs.CacheImportExample,
+}
@@ -18,6 +18,11 @@ func init() {
 		cmdManager.RegisterCmd(CacheCmd)
 		cmdManager.RegisterSubCmd(CacheCmd, cacheCleanCmd)
 		cmdManager.RegisterSubCmd(CacheCmd, CacheListCmd)
+		cmdManager.RegisterSubCmd(CacheCmd, cacheAddCmd)
+		cmdManager.RegisterSubCmd(CacheCmd, cacheStatsCmd)
+		cmdManager.RegisterSubCmd(CacheCmd, cacheVerifyCmd)
+		cmdManager.RegisterSubCmd(CacheCmd, cacheExportCmd)
+		cmdManager.RegisterSubCmd(CacheCmd, cacheImportCmd)
 	})
 }
 
@@ -28,7 +28,7 @@ var cacheListTypesFlag = cmdline.Flag{
 	DefaultValue: []string{"all"},
 	Name:         "type",
 	ShortHand:    "T",
-	Usage:        "a list of cache types to display, possible entries: library, oci, shub, blob(s), all",
+	Usage:        "a list of cache types to display, possible entries: library, oci, shub, blob(s), file, bucket, layers, chunks, inspect, all",
 }
 
 // -s|--summary
@@ -70,7 +70,7 @@ func cacheListCmd() error {
 		sylog.Fatalf("failed to create image cache handle")
 	}
 
-	err := singularity.ListSingularityCache(imgCache, cacheListTypes, cacheListVerbose)
+	err := singularity.ListSingularityCache(imgCache, cacheListTypes, cacheListVerbose, imageUsage(false))
 	if err != nil {
 		sylog.Fatalf("An error occurred while listing cache: %v", err)
 		return err
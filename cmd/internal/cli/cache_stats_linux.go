@@ -0,0 +1,84 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/util/singularityconf"
+)
+
+var cacheStatsAll bool
+
+// -a|--all
+var cacheStatsAllFlag = cmdline.Flag{
+	ID:           "cacheStatsAllFlag",
+	Value:        &cacheStatsAll,
+	DefaultValue: false,
+	Name:         "all",
+	ShortHand:    "a",
+	Usage:        "show the usage statistics of the images run by all users (root only)",
+}
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&cacheStatsAllFlag, cacheStatsCmd)
+	})
+}
+
+// imageUsage returns the usage statistics of the images run by the current
+// user, or by all users if all is set, or nil if they are disabled by the
+// image usage stats directive.
+func imageUsage(all bool) []*cache.Usage {
+	conf := singularityconf.GetCurrentConfig()
+	if conf == nil || conf.ImageUsageStats == "no" {
+		return nil
+	}
+	var usage []*cache.Usage
+	var err error
+	if all {
+		usage, err = cache.AllUsage(buildcfg.USAGEDIR)
+	} else {
+		usage, err = cache.NewUsageDB(cache.UsageDBPath(buildcfg.USAGEDIR, os.Getuid())).Usage()
+	}
+	if err != nil {
+		sylog.Warningf("Unable to read image usage statistics: %s", err)
+		return nil
+	}
+	return usage
+}
+
+// cacheStatsCmd is 'singularity cache stats' and will show the usage
+// statistics of the images run by the current user, or by all users
+var cacheStatsCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		if cacheStatsAll && os.Getuid() != 0 {
+			sylog.Fatalf("Only root can show the image usage statistics of all users")
+		}
+		usage := imageUsage(cacheStatsAll)
+		if usage == nil {
+			sylog.Fatalf("Image usage statistics are disabled by the administrator")
+		}
+		imgCache := getCacheHandle(cache.Config{})
+		if err := singularity.CacheStats(imgCache, usage); err != nil {
+			sylog.Fatalf("An error occurred while showing image usage statistics: %v", err)
+		}
+	},
+
+	Use:     docs.CacheStatsUse,
+	Short:   docs.CacheStatsShort,
+	Long:    docs.CacheStatsLong,
+	Example: docs.CacheStatsExample,
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&cacheVerifyTypesFlag, cacheVerifyCmd)
+	})
+}
+
+var (
+	cacheVerifyTypes []string
+
+	// -T|--type
+	cacheVerifyTypesFlag = cmdline.Flag{
+		ID:           "cacheVerifyTypes",
+		Value:        &cacheVerifyTypes,
+		DefaultValue: []string{"all"},
+		Name:         "type",
+		ShortHand:    "T",
+		Usage:        "a list of cache types to verify (possible values: library, oci-tmp, shub, net, oras, file, bucket, layers, chunks, inspect, all)",
+	}
+
+	// cacheVerifyCmd is 'singularity cache verify' and will check the
+	// cache entries against their manifest
+	cacheVerifyCmd = &cobra.Command{
+		DisableFlagsInUseLine: true,
+		Args:                  cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			imgCache := getCacheHandle(cache.Config{})
+			if err := singularity.VerifySingularityCache(imgCache, cacheVerifyTypes); err != nil {
+				sylog.Fatalf("Cache verification failed: %v", err)
+			}
+		},
+
+		Use:     docs.CacheVerifyUse,
+		Short:   docs.CacheVerifyShort,
+		Long:    docs.CacheVerifyLong,
+		Example: docs.CacheVerifyExample,
+	}
+)
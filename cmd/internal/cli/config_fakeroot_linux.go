@@ -59,13 +59,37 @@ var fakerootConfigDisableFlag = cmdline.Flag{
 	Usage:        "disable a user fakeroot mapping entry preventing him to use the fakeroot feature (the user mapping must be present)",
 }
 
+// -l|--list
+var fakerootConfigList bool
+var fakerootConfigListFlag = cmdline.Flag{
+	ID:           "fakerootConfigListFlag",
+	Value:        &fakerootConfigList,
+	DefaultValue: false,
+	Name:         "list",
+	ShortHand:    "l",
+	Usage:        "list the fakeroot mappings of all users with an entry in /etc/subuid or /etc/subgid, or of the given user, and where they come from",
+}
+
 // configFakerootCmd singularity config fakeroot
 var configFakerootCmd = &cobra.Command{
-	Args:                  cobra.ExactArgs(1),
+	Args:                  cobra.RangeArgs(0, 1),
 	DisableFlagsInUseLine: true,
 	PreRun:                CheckRoot,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		username := args[0]
+		username := ""
+		if len(args) > 0 {
+			username = args[0]
+		}
+
+		if fakerootConfigList {
+			if err := singularity.FakerootList(username); err != nil {
+				sylog.Fatalf("%s", err)
+			}
+			return nil
+		} else if username == "" {
+			return fmt.Errorf("you must specify a user")
+		}
+
 		var op singularity.FakerootConfigOp
 
 		if fakerootConfigAdd {
@@ -99,5 +123,6 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&fakerootConfigRemoveFlag, configFakerootCmd)
 		cmdManager.RegisterFlagForCmd(&fakerootConfigEnableFlag, configFakerootCmd)
 		cmdManager.RegisterFlagForCmd(&fakerootConfigDisableFlag, configFakerootCmd)
+		cmdManager.RegisterFlagForCmd(&fakerootConfigListFlag, configFakerootCmd)
 	})
 }
@@ -0,0 +1,187 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/internal/pkg/util/interactive"
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/util/crypt"
+)
+
+// environment variables setting the passphrases of a rekey
+const (
+	cryptOldPassphraseEnv = "SINGULARITY_OLD_ENCRYPTION_PASSPHRASE"
+	cryptNewPassphraseEnv = "SINGULARITY_NEW_ENCRYPTION_PASSPHRASE"
+)
+
+var (
+	cryptOldPEMPath    string
+	cryptNewPEMPath    string
+	cryptOldPassphrase bool
+	cryptNewPassphrase bool
+	cryptKeepOld       bool
+)
+
+// --old-pem
+var cryptOldPEMPathFlag = cmdline.Flag{
+	ID:           "cryptOldPEMPathFlag",
+	Value:        &cryptOldPEMPath,
+	DefaultValue: "",
+	Name:         "old-pem",
+	Usage:        "PEM private key decrypting the image",
+	EnvKeys:      []string{"OLD_ENCRYPTION_PEM_PATH"},
+}
+
+// --new-pem
+var cryptNewPEMPathFlag = cmdline.Flag{
+	ID:           "cryptNewPEMPathFlag",
+	Value:        &cryptNewPEMPath,
+	DefaultValue: "",
+	Name:         "new-pem",
+	Usage:        "PEM public key the image is encrypted with",
+	EnvKeys:      []string{"NEW_ENCRYPTION_PEM_PATH"},
+}
+
+// --old-passphrase
+var cryptOldPassphraseFlag = cmdline.Flag{
+	ID:           "cryptOldPassphraseFlag",
+	Value:        &cryptOldPassphrase,
+	DefaultValue: false,
+	Name:         "old-passphrase",
+	Usage:        "prompt for the passphrase decrypting the image",
+}
+
+// --new-passphrase
+var cryptNewPassphraseFlag = cmdline.Flag{
+	ID:           "cryptNewPassphraseFlag",
+	Value:        &cryptNewPassphrase,
+	DefaultValue: false,
+	Name:         "new-passphrase",
+	Usage:        "prompt for the passphrase the image is encrypted with",
+}
+
+// --keep-old
+var cryptKeepOldFlag = cmdline.Flag{
+	ID:           "cryptKeepOldFlag",
+	Value:        &cryptKeepOld,
+	DefaultValue: false,
+	Name:         "keep-old",
+	Usage:        "keep the old key, the image is decrypted by both keys",
+}
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterCmd(CryptCmd)
+		cmdManager.RegisterSubCmd(CryptCmd, cryptRekeyCmd)
+
+		cmdManager.RegisterFlagForCmd(&cryptOldPEMPathFlag, cryptRekeyCmd)
+		cmdManager.RegisterFlagForCmd(&cryptNewPEMPathFlag, cryptRekeyCmd)
+		cmdManager.RegisterFlagForCmd(&cryptOldPassphraseFlag, cryptRekeyCmd)
+		cmdManager.RegisterFlagForCmd(&cryptNewPassphraseFlag, cryptRekeyCmd)
+		cmdManager.RegisterFlagForCmd(&cryptKeepOldFlag, cryptRekeyCmd)
+	})
+}
+
+// CryptCmd is 'singularity crypt', it manages the keys of encrypted images
+var CryptCmd = &cobra.Command{
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return errors.New("invalid command")
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:           docs.CryptUse,
+	Short:         docs.CryptShort,
+	Long:          docs.CryptLong,
+	Example:       docs.CryptExample,
+	SilenceErrors: true,
+}
+
+// cryptRekeyCmd is 'singularity crypt rekey <image>'
+var cryptRekeyCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		oldKey, err := cryptKeyInfo(cryptOldPEMPath, cryptOldPassphrase, cryptOldPassphraseEnv, "old", "Enter the old passphrase: ")
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		newKey, err := cryptKeyInfo(cryptNewPEMPath, cryptNewPassphrase, cryptNewPassphraseEnv, "new", "Enter the new passphrase: ")
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+
+		// the private key is checked before the image is copied
+		if oldKey.Format == crypt.PEM {
+			if _, err := crypt.LoadPEMPrivateKey(oldKey.Path); err != nil {
+				sylog.Fatalf("Invalid old private key: %v", err)
+			}
+		}
+		if newKey.Format == crypt.PEM {
+			if _, err := crypt.LoadPEMPublicKey(newKey.Path); err != nil {
+				sylog.Fatalf("Invalid new public key: %v", err)
+			}
+		}
+
+		opts := singularity.CryptRekeyOptions{
+			OldKey:  oldKey,
+			NewKey:  newKey,
+			KeepOld: cryptKeepOld,
+		}
+		if err := singularity.CryptRekey(args[0], opts); err != nil {
+			sylog.Fatalf("Unable to rekey %s: %s", args[0], err)
+		}
+		if cryptKeepOld {
+			sylog.Infof("Image %s is now decrypted by both the old and the new key", args[0])
+		} else {
+			sylog.Infof("Image %s is now decrypted by the new key only", args[0])
+		}
+	},
+
+	Use:     docs.CryptRekeyUse,
+	Short:   docs.CryptRekeyShort,
+	Long:    docs.CryptRekeyLong,
+	Example: docs.CryptRekeyExample,
+}
+
+// cryptKeyInfo returns the old or new key of a rekey, named which, from a
+// PEM file path, an interactive passphrase or the passphrase of the
+// environment variable env, in this order of precedence.
+func cryptKeyInfo(pemPath string, ask bool, env, which, prompt string) (crypt.KeyInfo, error) {
+	passphraseEnv, passphraseEnvOK := os.LookupEnv(env)
+
+	switch {
+	case pemPath != "" && ask:
+		return crypt.KeyInfo{}, fmt.Errorf("--%[1]s-pem and --%[1]s-passphrase are mutually exclusive", which)
+	case pemPath != "":
+		return crypt.KeyInfo{Format: crypt.PEM, Path: pemPath}, nil
+	case ask:
+		var passphrase string
+		var err error
+		if which == "new" {
+			passphrase, err = interactive.GetPassphrase(prompt, 3)
+		} else {
+			passphrase, err = interactive.AskQuestionNoEcho(prompt)
+		}
+		if err != nil {
+			return crypt.KeyInfo{}, err
+		}
+		if passphrase == "" {
+			return crypt.KeyInfo{}, fmt.Errorf("cannot use an empty %s passphrase", which)
+		}
+		return crypt.KeyInfo{Format: crypt.Passphrase, Material: passphrase}, nil
+	case passphraseEnvOK:
+		return crypt.KeyInfo{Format: crypt.Passphrase, Material: passphraseEnv}, nil
+	}
+	return crypt.KeyInfo{}, fmt.Errorf("the %[1]s key must be set with --%[1]s-pem, --%[1]s-passphrase or %[2]s", which, env)
+}
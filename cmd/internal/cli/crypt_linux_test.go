@@ -0,0 +1,50 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+	"testing"
+
+	"github.com/sylabs/singularity/pkg/util/crypt"
+)
+
+func TestCryptKeyInfo(t *testing.T) {
+	const env = "SINGULARITY_TEST_REKEY_PASSPHRASE"
+
+	tests := []struct {
+		name    string
+		pemPath string
+		ask     bool
+		env     string
+		want    crypt.KeyInfo
+		wantErr bool
+	}{
+		{name: "PEM", pemPath: "new.pub", want: crypt.KeyInfo{Format: crypt.PEM, Path: "new.pub"}},
+		{name: "PEMOverEnv", pemPath: "new.pub", env: "secret", want: crypt.KeyInfo{Format: crypt.PEM, Path: "new.pub"}},
+		{name: "Env", env: "secret", want: crypt.KeyInfo{Format: crypt.Passphrase, Material: "secret"}},
+		{name: "PEMAndPassphrase", pemPath: "new.pub", ask: true, wantErr: true},
+		{name: "None", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Unsetenv(env)
+			if tt.env != "" {
+				os.Setenv(env, tt.env)
+				defer os.Unsetenv(env)
+			}
+
+			got, err := cryptKeyInfo(tt.pemPath, tt.ask, env, "new", "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/util/singularityconf"
+)
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterCmd(DoctorCmd)
+
+		cmdManager.RegisterFlagForCmd(&doctorJSONFlag, DoctorCmd)
+		cmdManager.RegisterFlagForCmd(&doctorFeatureFlag, DoctorCmd)
+	})
+}
+
+// -j|--json
+var doctorJSON bool
+var doctorJSONFlag = cmdline.Flag{
+	ID:           "doctorJSONFlag",
+	Value:        &doctorJSON,
+	DefaultValue: false,
+	Name:         "json",
+	ShortHand:    "j",
+	Usage:        "print structured json instead of a table",
+	EnvKeys:      []string{"JSON"},
+}
+
+// --feature
+var doctorFeatures []string
+var doctorFeatureFlag = cmdline.Flag{
+	ID:           "doctorFeatureFlag",
+	Value:        &doctorFeatures,
+	DefaultValue: []string{},
+	Name:         "feature",
+	Usage:        "probe only the given comma separated features, the command fails if one of them is unavailable",
+	EnvKeys:      []string{"DOCTOR_FEATURE"},
+}
+
+// DoctorCmd singularity doctor
+var DoctorCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := singularity.Doctor(os.Stdout, singularityconf.GetCurrentConfig(), doctorFeatures, doctorJSON)
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+	},
+
+	Use:     docs.DoctorUse,
+	Short:   docs.DoctorShort,
+	Long:    docs.DoctorLong,
+	Example: docs.DoctorExample,
+}
@@ -18,11 +18,15 @@ import (
 	"runtime"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/sylabs/sif/pkg/sif"
 	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/pkg/build"
+	"github.com/sylabs/singularity/internal/pkg/cache"
 	"github.com/sylabs/singularity/internal/pkg/util/env"
+	"github.com/sylabs/singularity/pkg/build/types/parser"
 	"github.com/sylabs/singularity/pkg/cmdline"
 	"github.com/sylabs/singularity/pkg/image"
 	"github.com/sylabs/singularity/pkg/inspect"
@@ -33,16 +37,20 @@ var errNoSIFMetadata = errors.New("no SIF metadata found")
 var errNoSIF = errors.New("invalid SIF")
 
 var (
-	allData     bool
-	runscript   bool
-	startscript bool
-	testfile    bool
-	environment bool
-	helpfile    bool
-	listApps    bool
-	labels      bool
-	deffile     bool
-	jsonfmt     bool
+	allData      bool
+	runscript    bool
+	startscript  bool
+	testfile     bool
+	environment  bool
+	helpfile     bool
+	listApps     bool
+	labels       bool
+	deffile      bool
+	jsonfmt      bool
+	specialFiles bool
+	scanReport   bool
+	definition   bool
+	inspectArgs  []string
 )
 
 // -l|--labels
@@ -144,6 +152,42 @@ var inspectHelpfileFlag = cmdline.Flag{
 	Usage:        "inspect the runscript helpfile, if it exists",
 }
 
+// --special-files
+var inspectSpecialFilesFlag = cmdline.Flag{
+	ID:           "inspectSpecialFilesFlag",
+	Value:        &specialFiles,
+	DefaultValue: false,
+	Name:         "special-files",
+	Usage:        "show the setuid, setgid and world-writable files of the image",
+}
+
+// --scan-report
+var inspectScanReportFlag = cmdline.Flag{
+	ID:           "inspectScanReportFlag",
+	Value:        &scanReport,
+	DefaultValue: false,
+	Name:         "scan-report",
+	Usage:        "show the report of the post build image scan, if the image was scanned",
+}
+
+// --definition
+var inspectDefinitionFlag = cmdline.Flag{
+	ID:           "inspectDefinitionFlag",
+	Value:        &definition,
+	DefaultValue: false,
+	Name:         "definition",
+	Usage:        "inspect a definition file, showing all the sections of the image it would build unless some are selected",
+}
+
+// --build-arg
+var inspectBuildArgFlag = cmdline.Flag{
+	ID:           "inspectBuildArgFlag",
+	Value:        &inspectArgs,
+	DefaultValue: []string{},
+	Name:         "build-arg",
+	Usage:        "set a build argument of the inspected definition file (NAME=VALUE)",
+}
+
 // --all
 var inspectAllFlag = cmdline.Flag{
 	ID:           "inspectAllFlag",
@@ -167,7 +211,11 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&inspectStartscriptFlag, InspectCmd)
 		cmdManager.RegisterFlagForCmd(&inspectTestFlag, InspectCmd)
 		cmdManager.RegisterFlagForCmd(&inspectAppsListFlag, InspectCmd)
+		cmdManager.RegisterFlagForCmd(&inspectSpecialFilesFlag, InspectCmd)
+		cmdManager.RegisterFlagForCmd(&inspectScanReportFlag, InspectCmd)
 		cmdManager.RegisterFlagForCmd(&inspectAllFlag, InspectCmd)
+		cmdManager.RegisterFlagForCmd(&inspectDefinitionFlag, InspectCmd)
+		cmdManager.RegisterFlagForCmd(&inspectBuildArgFlag, InspectCmd)
 	})
 }
 
@@ -176,6 +224,9 @@ const (
 	metadataJSON = "inspect-metadata.json"
 )
 
+// inspectExec runs the inspect script in a single file image.
+var inspectExec = singularityExec
+
 type command struct {
 	script      string
 	appName     string
@@ -197,11 +248,7 @@ func newCommand(allData bool, appName string, img *image.Image) *command {
 		metadata, err := getInspectMetadataFromSIF(img)
 		if err == nil {
 			sylog.Debugf("Using %s SIF descriptor", metadataJSON)
-			command.sifMetadata = metadata
-			if listApps || allData {
-				// copy app attributes for related flags as they are not copied by default
-				command.metadata.Attributes.Apps = metadata.Attributes.Apps
-			}
+			command.setSIFMetadata(metadata, allData)
 		} else if err != image.ErrNoSection {
 			sylog.Warningf("Unable to read %s SIF descriptor: %s", metadataJSON, err)
 		} else {
@@ -259,6 +306,21 @@ func newCommand(allData bool, appName string, img *image.Image) *command {
 	return command
 }
 
+// setSIFMetadata sets the metadata of the image, gathered without running
+// the container, which are used instead of running the inspect script.
+func (c *command) setSIFMetadata(metadata *inspect.Metadata, allData bool) {
+	c.sifMetadata = metadata
+	if allData {
+		// copy app attributes for related flags as they are not copied by default
+		c.metadata.Attributes.Apps = metadata.Attributes.Apps
+	} else if listApps {
+		// only list apps, like when they are found by the inspect script
+		for app := range metadata.Attributes.Apps {
+			c.metadata.AddApp(app)
+		}
+	}
+}
+
 func (c *command) setAttribute(section, value, file string) error {
 	sylog.Debugf("Section %s found", section)
 	value = strings.TrimRight(value, "\n")
@@ -291,8 +353,8 @@ func (c *command) setAttribute(section, value, file string) error {
 			c.metadata.Data.Attributes.Helpfile = value
 		}
 	case "labels":
-		labels := make(map[string]string)
-		if err := json.Unmarshal([]byte(value), &labels); err != nil {
+		labels, err := decodeLabels([]byte(value))
+		if err != nil {
 			sylog.Warningf("Unable to parse labels: %s", err)
 		}
 		if app != "" {
@@ -308,6 +370,13 @@ func (c *command) setAttribute(section, value, file string) error {
 		}
 	case "startscript":
 		c.metadata.Data.Attributes.Startscript = value
+	case "specialfiles":
+		files := new(inspect.SpecialFiles)
+		if err := json.Unmarshal([]byte(value), files); err != nil {
+			sylog.Warningf("Unable to parse special files: %s", err)
+		} else {
+			c.metadata.Data.Attributes.SpecialFiles = files
+		}
 	case "environment":
 		if app != "" {
 			c.metadata.Data.Attributes.Apps[app].Environment[file] = value
@@ -320,6 +389,31 @@ func (c *command) setAttribute(section, value, file string) error {
 	return nil
 }
 
+// decodeLabels decodes the content of a labels.json file. Values which
+// aren't strings (e.g. numbers written by other tools) are kept as their
+// compact JSON representation, so labels are always reported as strings.
+func decodeLabels(data []byte) (map[string]string, error) {
+	raw := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	labels := make(map[string]string, len(raw))
+	for k, v := range raw {
+		var s string
+		if err := json.Unmarshal(v, &s); err == nil {
+			labels[k] = s
+			continue
+		}
+		buf := new(bytes.Buffer)
+		if err := json.Compact(buf, v); err != nil {
+			return nil, err
+		}
+		labels[k] = buf.String()
+	}
+	return labels, nil
+}
+
 func (c *command) getMetadata() (*inspect.Metadata, error) {
 	// we got metadata from SIF, no need to run script
 	if c.sifMetadata != nil {
@@ -351,7 +445,7 @@ func (c *command) getMetadata() (*inspect.Metadata, error) {
 		prefix = c.img.Path
 	} else {
 		// single file image, run singularity exec with the compound script
-		out, err := singularityExec(c.img.Path, args)
+		out, err := inspectExec(c.img.Path, args)
 		if err != nil {
 			return nil, fmt.Errorf("could not inspect container: %v", err)
 		}
@@ -526,18 +620,79 @@ func (c *command) addEnvironmentCommand() {
 }
 
 func (c *command) addDefinitionCommand() {
+	if c.sifMetadata != nil {
+		c.metadata.Attributes.Deffile = c.sifMetadata.Attributes.Deffile
+		return
+	}
+
 	deffile, err := inspectDeffilePartition(c.img)
 	if err == errNoSIFMetadata || err == errNoSIF {
 		c.addSingleFileCommand("Singularity", "deffile")
 	} else if err != nil {
 		sylog.Warningf("Unable to inspect deffile: %s", err)
 	} else {
-		if c.sifMetadata == nil {
-			c.metadata.Attributes.Deffile = deffile
-		} else {
-			c.metadata.Attributes.Deffile = c.sifMetadata.Attributes.Deffile
+		c.metadata.Attributes.Deffile = deffile
+	}
+}
+
+func (c *command) addSpecialFilesCommand() {
+	if c.sifMetadata != nil && c.sifMetadata.Attributes.SpecialFiles != nil {
+		c.metadata.Attributes.SpecialFiles = c.sifMetadata.Attributes.SpecialFiles
+		return
+	}
+	if c.img == nil {
+		// definition files don't have special files yet
+		return
+	}
+
+	files, err := imageSpecialFiles(c.img)
+	if err == errNoSpecialFiles && c.sifMetadata == nil {
+		c.addSingleFileCommand(specialFilesJSON, "specialfiles")
+	} else if err != nil {
+		sylog.Warningf("Unable to inspect special files: %s", err)
+	} else {
+		c.metadata.Attributes.SpecialFiles = files
+	}
+}
+
+func (c *command) addScanReportCommand() {
+	if c.img == nil {
+		// definition files are not scanned
+		return
+	}
+
+	var r io.Reader
+
+	switch c.img.Type {
+	case image.SIF:
+		sr, err := image.NewSectionReader(c.img, inspect.ScanReportName, -1)
+		if err == image.ErrNoSection {
+			return
+		} else if err != nil {
+			sylog.Warningf("Unable to inspect scan report: %s", err)
+			return
+		}
+		r = sr
+	case image.SANDBOX:
+		f, err := os.Open(filepath.Join(c.img.Path, ".singularity.d", inspect.ScanReportName))
+		if os.IsNotExist(err) {
+			return
+		} else if err != nil {
+			sylog.Warningf("Unable to inspect scan report: %s", err)
+			return
 		}
+		defer f.Close()
+		r = f
+	default:
+		return
 	}
+
+	report := new(inspect.ScanReport)
+	if err := json.NewDecoder(r).Decode(report); err != nil {
+		sylog.Warningf("Unable to parse scan report: %s", err)
+		return
+	}
+	c.metadata.Attributes.ScanReport = report
 }
 
 func getInspectMetadataFromSIF(img *image.Image) (*inspect.Metadata, error) {
@@ -610,7 +765,148 @@ func printSortedMap(m map[string]string, fn func(key string)) {
 
 // returns true if flags for other forms of information are unset.
 func defaultToLabels() bool {
-	return !(helpfile || deffile || runscript || startscript || testfile || environment || listApps)
+	return !(helpfile || deffile || runscript || startscript || testfile || environment || listApps || specialFiles || scanReport)
+}
+
+// inspectImage returns the metadata of img selected by the inspect flags.
+// The metadata of images which must be run to be inspected are read from
+// imgCache if it's not nil.
+func inspectImage(img *image.Image, imgCache *cache.Handle) (*inspect.Metadata, error) {
+	inspectCmd := newCommand(allData, AppName, img)
+
+	// Use the cached metadata of images without a metadata descriptor,
+	// so they are not run again each time they are inspected.
+	if inspectCmd.sifMetadata == nil && img.Type != image.SANDBOX && imgCache != nil {
+		metadata, err := cachedInspectMetadata(img, imgCache)
+		if err == nil {
+			inspectCmd.setSIFMetadata(metadata, allData)
+		} else {
+			sylog.Debugf("Not using the inspect cache: %s", err)
+		}
+	}
+
+	return inspectCmd.selectMetadata()
+}
+
+// inspectDefinition returns the metadata selected by the inspect flags
+// from the metadata of the image which would be built from a definition.
+func inspectDefinition(metadata *inspect.Metadata) (*inspect.Metadata, error) {
+	inspectCmd := &command{
+		appName:  AppName,
+		metadata: inspect.NewMetadata(),
+	}
+	inspectCmd.setSIFMetadata(metadata, allData)
+
+	return inspectCmd.selectMetadata()
+}
+
+// definitionMetadata parses the definition file path, rendered with the
+// build arguments args, and returns the metadata of the image which would
+// be built from it.
+func definitionMetadata(path string, args map[string]string) (*inspect.Metadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := build.RenderDefinition(f, filepath.Base(path), args)
+	if err != nil {
+		return nil, err
+	}
+	defs, err := parser.All(r)
+	if err != nil {
+		return nil, err
+	}
+	return build.DefinitionMetadata(defs)
+}
+
+// inspectDefinitionFile returns the metadata selected by the inspect flags
+// of the image which would be built from the definition file path.
+func inspectDefinitionFile(path string) (*inspect.Metadata, error) {
+	buildArgs, err := build.ParseBuildArgs(inspectArgs)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := definitionMetadata(path, buildArgs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse definition file %s: %s", path, err)
+	}
+	sylog.Debugf("Inspecting %s as a definition file", path)
+
+	return inspectDefinition(metadata)
+}
+
+// selectMetadata returns the metadata selected by the inspect flags.
+func (c *command) selectMetadata() (*inspect.Metadata, error) {
+	// Try to inspect the label partition, if not, then exec/shell
+	// the container to get the data.
+	if labels || defaultToLabels() || allData {
+		// If '--app' is specified, then we need to shell/exec the
+		// container.
+		sylog.Debugf("Inspection of labels selected.")
+		c.addLabelsCommand()
+	}
+
+	// Inspect the deffile.
+	if deffile || allData {
+		sylog.Debugf("Inspection of deffile selected.")
+		c.addDefinitionCommand()
+	}
+
+	if helpfile || allData {
+		sylog.Debugf("Inspection of helpfile selected.")
+		c.addHelpCommand()
+	}
+
+	if runscript || allData {
+		sylog.Debugf("Inspection of runscript selected.")
+		c.addRunscriptCommand()
+	}
+
+	if startscript || allData {
+		if AppName == "" {
+			sylog.Debugf("Inspection of startscript selected.")
+			c.addStartscriptCommand()
+		}
+	}
+
+	if testfile || allData {
+		sylog.Debugf("Inspection of test selected.")
+		c.addTestCommand()
+	}
+
+	if environment || allData {
+		sylog.Debugf("Inspection of environment selected.")
+		c.addEnvironmentCommand()
+	}
+
+	if (specialFiles || allData) && AppName == "" {
+		sylog.Debugf("Inspection of special files selected.")
+		c.addSpecialFilesCommand()
+	}
+
+	if (scanReport || allData) && AppName == "" {
+		sylog.Debugf("Inspection of scan report selected.")
+		c.addScanReportCommand()
+	}
+
+	if listApps || allData {
+		sylog.Debugf("Listing all apps in container")
+	}
+
+	inspectData, err := c.getMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	for app := range inspectData.Data.Attributes.Apps {
+		if !listApps && !allData && AppName != app {
+			delete(inspectData.Data.Attributes.Apps, app)
+		}
+	}
+
+	return inspectData, nil
 }
 
 // InspectCmd represents the 'inspect' command.
@@ -625,76 +921,48 @@ var InspectCmd = &cobra.Command{
 	Example: docs.InspectExample,
 
 	Run: func(cmd *cobra.Command, args []string) {
-		img, err := image.Init(args[0], false)
-		if err != nil {
-			sylog.Fatalf("Failed to open image %s: %s", args[0], err)
-		}
-
 		if allData {
 			// display all data in JSON format only
 			jsonfmt = true
 			AppName = ""
 		}
 
-		inspectCmd := newCommand(allData, AppName, img)
+		var inspectData *inspect.Metadata
 
-		// Try to inspect the label partition, if not, then exec/shell
-		// the container to get the data.
-		if labels || defaultToLabels() || allData {
-			// If '--app' is specified, then we need to shell/exec the
-			// container.
-			sylog.Debugf("Inspection of labels selected.")
-			inspectCmd.addLabelsCommand()
+		if len(inspectArgs) > 0 && !definition {
+			sylog.Fatalf("--build-arg requires the --definition flag")
 		}
 
-		// Inspect the deffile.
-		if deffile || allData {
-			sylog.Debugf("Inspection of deffile selected.")
-			inspectCmd.addDefinitionCommand()
-		}
-
-		if helpfile || allData {
-			sylog.Debugf("Inspection of helpfile selected.")
-			inspectCmd.addHelpCommand()
-		}
-
-		if runscript || allData {
-			sylog.Debugf("Inspection of runscript selected.")
-			inspectCmd.addRunscriptCommand()
-		}
+		var img *image.Image
+		var err error
 
-		if startscript || allData {
-			if AppName == "" {
-				sylog.Debugf("Inspection of startscript selected.")
-				inspectCmd.addStartscriptCommand()
+		if definition {
+			// show all the sections of the would-be image by default
+			if defaultToLabels() {
+				labels, helpfile, runscript, startscript, testfile, environment, listApps = true, true, true, true, true, true, true
 			}
+		} else {
+			img, err = image.Init(args[0], false)
 		}
 
-		if testfile || allData {
-			sylog.Debugf("Inspection of test selected.")
-			inspectCmd.addTestCommand()
-		}
-
-		if environment || allData {
-			sylog.Debugf("Inspection of environment selected.")
-			inspectCmd.addEnvironmentCommand()
-		}
-
-		if listApps || allData {
-			sylog.Debugf("Listing all apps in container")
+		switch {
+		case definition || err == image.ErrUnknownFormat:
+			// a definition file is inspected without building the image
+			inspectData, err = inspectDefinitionFile(args[0])
+		case err != nil:
+			sylog.Fatalf("Failed to open image %s: %s", args[0], err)
+		default:
+			imgCache, cerr := cache.New(cache.Config{ParentDir: os.Getenv(cache.DirEnv)})
+			if cerr != nil {
+				sylog.Debugf("Not using the inspect cache: %s", cerr)
+				imgCache = nil
+			}
+			inspectData, err = inspectImage(img, imgCache)
 		}
-
-		inspectData, err := inspectCmd.getMetadata()
 		if err != nil {
 			sylog.Fatalf("%s", err)
 		}
 
-		for app := range inspectData.Data.Attributes.Apps {
-			if !listApps && !allData && AppName != app {
-				delete(inspectData.Data.Attributes.Apps, app)
-			}
-		}
-
 		// Output the inspection results (use JSON if requested).
 		if jsonfmt {
 			jsonObj, err := json.MarshalIndent(inspectData, "", "\t")
@@ -739,6 +1007,12 @@ var InspectCmd = &cobra.Command{
 					fmt.Printf("=== %s ===\n%s\n\n", k, appAttr.Environment[k])
 				})
 			}
+			if inspectData.Data.Attributes.SpecialFiles != nil {
+				printSpecialFiles(inspectData.Data.Attributes.SpecialFiles)
+			}
+			if r := inspectData.Data.Attributes.ScanReport; r != nil {
+				fmt.Printf("Hook: %s\nDate: %s\nExit code: %d\n%s", r.Hook, r.Date.Format(time.RFC3339), r.ExitCode, r.Output)
+			}
 			if len(inspectData.Data.Attributes.Labels) > 0 {
 				printSortedMap(inspectData.Data.Attributes.Labels, func(k string) {
 					fmt.Printf("%s: %s\n", k, inspectData.Data.Attributes.Labels[k])
@@ -0,0 +1,101 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/pkg/image"
+	"github.com/sylabs/singularity/pkg/inspect"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// inspectCacheKey returns the key of the cached metadata of img, which
+// changes with the image file and the version of singularity.
+func inspectCacheKey(img *image.Image) (string, error) {
+	path, err := filepath.Abs(img.Path)
+	if err != nil {
+		return "", fmt.Errorf("while determining absolute path for %s: %v", img.Path, err)
+	}
+	fi, err := img.File.Stat()
+	if err != nil {
+		return "", fmt.Errorf("while getting image %s information: %v", img.Path, err)
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%d\x00%d", buildcfg.PACKAGE_VERSION, path, fi.Size(), fi.ModTime().UnixNano())
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// cachedInspectMetadata returns the metadata of img, which doesn't embed
+// them, from imgCache. When they are not cached yet, all the metadata are
+// gathered by running the container, like during a build, and cached so the
+// next inspections of the unchanged image don't run the container.
+func cachedInspectMetadata(img *image.Image, imgCache *cache.Handle) (*inspect.Metadata, error) {
+	if imgCache.IsDisabled() {
+		return nil, fmt.Errorf("cache is disabled")
+	}
+
+	key, err := inspectCacheKey(img)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := imgCache.GetEntry(cache.InspectCacheType, key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to check if inspect metadata of %s exist in cache: %v", img.Path, err)
+	}
+	defer entry.CleanTmp()
+
+	if entry.Exists {
+		data, err := ioutil.ReadFile(entry.Path)
+		if err != nil {
+			return nil, fmt.Errorf("while reading cached inspect metadata: %v", err)
+		}
+		metadata := new(inspect.Metadata)
+		if err := json.Unmarshal(data, metadata); err != nil {
+			return nil, fmt.Errorf("while decoding cached inspect metadata %s: %v", entry.Path, err)
+		}
+		sylog.Debugf("Using cached inspect metadata %s", entry.Path)
+		return metadata, nil
+	}
+
+	entry.Source = img.Path
+	c := newCommand(true, "", img)
+	c.addLabelsCommand()
+	c.addDefinitionCommand()
+	c.addHelpCommand()
+	c.addRunscriptCommand()
+	c.addStartscriptCommand()
+	c.addTestCommand()
+	c.addEnvironmentCommand()
+	c.addSpecialFilesCommand()
+
+	metadata, err := c.getMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("while encoding inspect metadata: %v", err)
+	}
+	if err := ioutil.WriteFile(entry.TmpPath, data, 0600); err != nil {
+		return nil, fmt.Errorf("while writing inspect metadata to cache: %v", err)
+	}
+	if err := entry.Finalize(); err != nil {
+		return nil, err
+	}
+	sylog.Debugf("Cached inspect metadata of %s in %s", img.Path, entry.Path)
+
+	return metadata, nil
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/pkg/image"
+)
+
+// makeInspectRootfs creates the files read by inspect in the container
+// root filesystem dir.
+func makeInspectRootfs(t *testing.T, dir string) {
+	files := map[string]string{
+		".singularity.d/labels.json":                  `{"maintainer": "e2e", "version": 1}`,
+		".singularity.d/Singularity":                  "bootstrap: docker\nfrom: alpine",
+		".singularity.d/runscript":                    "#!/bin/sh\necho run",
+		".singularity.d/runscript.help":               "some help",
+		".singularity.d/startscript":                  "#!/bin/sh\necho start",
+		".singularity.d/test":                         "#!/bin/sh\necho test",
+		".singularity.d/env/10-docker2singularity.sh": "export DOCKER=1",
+		".singularity.d/env/90-environment.sh":        "export FOO=bar",
+		"scif/apps/foo/scif/labels.json":              `{"app": "foo"}`,
+		"scif/apps/foo/scif/runscript":                "#!/bin/sh\necho foo",
+		"scif/apps/foo/scif/runscript.help":           "foo help",
+		"scif/apps/foo/scif/env/90-environment.sh":    "export APP=foo",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// makeSquashfsImage creates an image file recognized as a squashfs image.
+func makeSquashfsImage(t *testing.T, path string) {
+	b := make([]byte, 4096)
+	copy(b, "hsqs")
+	b[20] = 1 // zlib compression
+	b[28] = 4 // major version
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInspectCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inspect-cache-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rootfs := filepath.Join(dir, "rootfs")
+	makeInspectRootfs(t, rootfs)
+
+	imgPath := filepath.Join(dir, "image.sqs")
+	makeSquashfsImage(t, imgPath)
+
+	imgCache, err := cache.New(cache.Config{ParentDir: filepath.Join(dir, "cache")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// run the inspect script on the root filesystem, instead of running
+	// the image, and count the runs
+	runs := 0
+	defer func(fn func(string, []string) (string, error)) {
+		inspectExec = fn
+	}(inspectExec)
+	inspectExec = func(_ string, args []string) (string, error) {
+		runs++
+		script := args[2]
+		script = strings.ReplaceAll(script, "/.singularity.d", rootfs+"/.singularity.d")
+		script = strings.ReplaceAll(script, "/scif/apps", rootfs+"/scif/apps")
+		out, err := exec.Command("/bin/sh", "-c", script).Output()
+		return strings.ReplaceAll(string(out), rootfs, ""), err
+	}
+
+	defer func(l, d, h, r, s, te, e, la, a bool, app string) {
+		labels, deffile, helpfile, runscript, startscript, testfile, environment, listApps, allData = l, d, h, r, s, te, e, la, a
+		AppName = app
+	}(labels, deffile, helpfile, runscript, startscript, testfile, environment, listApps, allData, AppName)
+
+	tests := []struct {
+		name  string
+		flags []*bool
+		app   string
+	}{
+		{name: "Default"},
+		{name: "Labels", flags: []*bool{&labels}},
+		{name: "Deffile", flags: []*bool{&deffile}},
+		{name: "Helpfile", flags: []*bool{&helpfile}},
+		{name: "Runscript", flags: []*bool{&runscript}},
+		{name: "Startscript", flags: []*bool{&startscript}},
+		{name: "Test", flags: []*bool{&testfile}},
+		{name: "Environment", flags: []*bool{&environment}},
+		{name: "ListApps", flags: []*bool{&listApps}},
+		{name: "All", flags: []*bool{&allData}},
+		{name: "AppLabels", flags: []*bool{&labels}, app: "foo"},
+		{name: "AppRunscript", flags: []*bool{&runscript}, app: "foo"},
+		{name: "AppHelpfile", flags: []*bool{&helpfile}, app: "foo"},
+		{name: "AppEnvironment", flags: []*bool{&environment}, app: "foo"},
+		{name: "Several", flags: []*bool{&labels, &runscript, &environment}},
+	}
+
+	inspectJSON := func(t *testing.T, imgCache *cache.Handle) string {
+		img, err := image.Init(imgPath, false)
+		if err != nil {
+			t.Fatalf("failed to open image: %s", err)
+		}
+		defer img.File.Close()
+
+		metadata, err := inspectImage(img, imgCache)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		b, err := json.MarshalIndent(metadata, "", "\t")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels, deffile, helpfile, runscript, startscript, testfile, environment, listApps, allData = false, false, false, false, false, false, false, false, false
+			for _, f := range tt.flags {
+				*f = true
+			}
+			AppName = tt.app
+
+			runs = 0
+			want := inspectJSON(t, nil)
+			if runs != 1 {
+				t.Errorf("image run %d times without cache, want 1", runs)
+			}
+
+			runs = 0
+			got := inspectJSON(t, imgCache)
+			if got != want {
+				t.Errorf("got cached inspect output:\n%s\nwant:\n%s", got, want)
+			}
+			// metadata are cached by the first test
+			if wantRuns := 0; i == 0 {
+				if runs != 1 {
+					t.Errorf("image run %d times on cache miss, want 1", runs)
+				}
+			} else if runs != wantRuns {
+				t.Errorf("image run %d times with cached metadata, want %d", runs, wantRuns)
+			}
+		})
+	}
+
+	// metadata are gathered again when the image changes
+	labels, deffile, helpfile, runscript, startscript, testfile, environment, listApps, allData = false, false, false, false, false, false, false, false, false
+	AppName = ""
+
+	mtime := time.Now().Add(time.Hour)
+	if err := os.Chtimes(imgPath, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	runs = 0
+	inspectJSON(t, imgCache)
+	inspectJSON(t, imgCache)
+	if runs != 1 {
+		t.Errorf("modified image run %d times, want 1", runs)
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeLabels(t *testing.T) {
+	data := `{
+	"multi": "first line\nsecond line",
+	"url": "https://example.com:8443",
+	"number": 42,
+	"bool": true,
+	"object": {
+		"a": [1, 2]
+	}
+}`
+	want := map[string]string{
+		"multi":  "first line\nsecond line",
+		"url":    "https://example.com:8443",
+		"number": "42",
+		"bool":   "true",
+		"object": `{"a":[1,2]}`,
+	}
+
+	labels, err := decodeLabels([]byte(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(labels, want) {
+		t.Errorf("got labels %q, want %q", labels, want)
+	}
+
+	if _, err := decodeLabels([]byte(`["not", "labels"]`)); err == nil {
+		t.Errorf("unexpected success with invalid labels")
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/pkg/util/user"
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&instanceExecUserFlag, instanceExecCmd)
+		cmdManager.RegisterFlagForCmd(&instanceExecTTYFlag, instanceExecCmd)
+		cmdManager.RegisterFlagForCmd(&instanceExecNoTTYFlag, instanceExecCmd)
+	})
+}
+
+// -u|--user
+var instanceExecUser string
+var instanceExecUserFlag = cmdline.Flag{
+	ID:           "instanceExecUserFlag",
+	Value:        &instanceExecUser,
+	DefaultValue: "",
+	Name:         "user",
+	ShortHand:    "u",
+	Usage:        "if running as root, execute the command in an instance belonging to user",
+	Tag:          "<username>",
+}
+
+// -t|--tty
+var instanceExecTTY bool
+var instanceExecTTYFlag = cmdline.Flag{
+	ID:           "instanceExecTTYFlag",
+	Value:        &instanceExecTTY,
+	DefaultValue: false,
+	Name:         "tty",
+	ShortHand:    "t",
+	Usage:        "allocate a pseudo terminal to the command, for interactive commands",
+}
+
+// -T|--no-tty
+var instanceExecNoTTY bool
+var instanceExecNoTTYFlag = cmdline.Flag{
+	ID:           "instanceExecNoTTYFlag",
+	Value:        &instanceExecNoTTY,
+	DefaultValue: false,
+	Name:         "no-tty",
+	ShortHand:    "T",
+	Usage:        "execute the command without terminal, standard input is read from /dev/null",
+}
+
+// checkInstanceExecUser returns an error if the instance of username can't
+// be joined by the current user, only root can join the instances of other
+// users. It returns the user owning the instance for root, an empty string
+// for the current user.
+func checkInstanceExecUser(name, username string) (string, error) {
+	if username == "" || os.Getuid() == 0 {
+		return username, nil
+	}
+	u, err := user.CurrentOriginal()
+	if err != nil {
+		return "", fmt.Errorf("while getting current user: %s", err)
+	}
+	if u.Name != username {
+		return "", fmt.Errorf("instance %s belongs to user %s, only root can execute commands in instances of other users", name, username)
+	}
+	return "", nil
+}
+
+// detachTerminal detaches the process from its controlling terminal, if
+// any, and reads its standard input from /dev/null.
+func detachTerminal() error {
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		return err
+	}
+	defer null.Close()
+
+	if err := unix.Dup2(int(null.Fd()), 0); err != nil {
+		return fmt.Errorf("while redirecting standard input: %s", err)
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		// no controlling terminal
+		return nil
+	}
+	defer tty.Close()
+
+	if err := unix.IoctlSetInt(int(tty.Fd()), unix.TIOCNOTTY, 0); err != nil {
+		return fmt.Errorf("while detaching controlling terminal: %s", err)
+	}
+	return nil
+}
+
+// singularity instance exec
+var instanceExecCmd = &cobra.Command{
+	Args:                  cobra.MinimumNArgs(2),
+	DisableFlagsInUseLine: true,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		// same environment than exec with instance://
+		actionPreRun(ExecCmd, []string{"instance://" + args[0]})
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+		args = args[1:]
+		if args[0] == "--" {
+			args = args[1:]
+		}
+		if len(args) == 0 {
+			sylog.Fatalf("No command to execute in instance %s", name)
+		}
+
+		username, err := checkInstanceExecUser(name, instanceExecUser)
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		instanceExecUser = username
+
+		if instanceExecTTY && instanceExecNoTTY {
+			sylog.Fatalf("--tty and --no-tty are mutually exclusive")
+		} else if instanceExecNoTTY {
+			if err := detachTerminal(); err != nil {
+				sylog.Fatalf("Could not detach from terminal: %s", err)
+			}
+		}
+		// the command runs in a pseudo terminal like with exec --pty
+		Pty = instanceExecTTY
+		NoPty = instanceExecNoTTY
+
+		// join the instance like exec with instance://, the action
+		// flags of exec keep their default values
+		a := append([]string{"/.singularity.d/actions/exec"}, args...)
+		execStarter(ExecCmd, "instance://"+name, a, "")
+	},
+
+	Use:     docs.InstanceExecUse,
+	Short:   docs.InstanceExecShort,
+	Long:    docs.InstanceExecLong,
+	Example: docs.InstanceExecExample,
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+	"github.com/sylabs/singularity/internal/pkg/util/user"
+)
+
+func TestCheckInstanceExecUser(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	u, err := user.CurrentOriginal()
+	if err != nil {
+		t.Fatalf("while getting current user: %s", err)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		wantErr  bool
+	}{
+		{
+			name: "CurrentUserImplicit",
+		},
+		{
+			name:     "CurrentUserExplicit",
+			username: u.Name,
+		},
+		{
+			name:     "OtherUser",
+			username: "root",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			username, err := checkInstanceExecUser("test", tt.username)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("unexpected success")
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			// the instances of the current user are looked up
+			// without username
+			if username != "" {
+				t.Errorf("got username %q, want none", username)
+			}
+		})
+	}
+}
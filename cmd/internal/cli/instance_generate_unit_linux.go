@@ -0,0 +1,162 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/internal/pkg/instance"
+	"github.com/sylabs/singularity/internal/pkg/util/uri"
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&instanceUnitScopeFlag, instanceGenerateUnitCmd, instanceStartCmd)
+		cmdManager.RegisterFlagForCmd(&instanceUnitRestartFlag, instanceGenerateUnitCmd, instanceStartCmd)
+		cmdManager.RegisterFlagForCmd(&instanceUnitRestartSecFlag, instanceGenerateUnitCmd, instanceStartCmd)
+	})
+}
+
+// --scope
+var instanceUnitScope string
+var instanceUnitScopeFlag = cmdline.Flag{
+	ID:           "instanceUnitScopeFlag",
+	Value:        &instanceUnitScope,
+	DefaultValue: "",
+	Name:         "scope",
+	Usage:        "scope of the systemd unit, user or system (default system for root, user otherwise)",
+	Tag:          "<scope>",
+	EnvKeys:      []string{"UNIT_SCOPE"},
+}
+
+// --restart
+var instanceUnitRestart string
+var instanceUnitRestartFlag = cmdline.Flag{
+	ID:           "instanceUnitRestartFlag",
+	Value:        &instanceUnitRestart,
+	DefaultValue: "on-failure",
+	Name:         "restart",
+	Usage:        "systemd restart policy of the instance (no, on-success, on-failure, on-abnormal, on-watchdog, on-abort or always)",
+	Tag:          "<policy>",
+	EnvKeys:      []string{"UNIT_RESTART"},
+}
+
+// --restart-sec
+var instanceUnitRestartSec int
+var instanceUnitRestartSecFlag = cmdline.Flag{
+	ID:           "instanceUnitRestartSecFlag",
+	Value:        &instanceUnitRestartSec,
+	DefaultValue: 5,
+	Name:         "restart-sec",
+	Usage:        "delay in seconds before systemd restarts the instance",
+	Tag:          "<seconds>",
+	EnvKeys:      []string{"UNIT_RESTART_SEC"},
+}
+
+// unitFlags are the flags configuring the systemd unit of an instance,
+// they are not recorded in the instance start options.
+var unitFlags = map[string]bool{
+	"systemd":      true,
+	"scope":        true,
+	"restart":      true,
+	"restart-sec":  true,
+	"options-file": true,
+}
+
+// unrecordedFlags are the instance start flags prompting the user, which
+// can't be used to start the instance again from systemd.
+var unrecordedFlags = map[string]bool{
+	"docker-login": true,
+	"passphrase":   true,
+}
+
+// newStartOptions returns the start options of the instance of image
+// started with the startscript args and the flags set for cmd. A URI is
+// recorded as is, so the image is fetched again if it's removed from the
+// cache.
+func newStartOptions(cmd *cobra.Command, image string, args []string) (*instance.StartOptions, error) {
+	if t, _ := uri.Split(image); t == "" {
+		path, err := filepath.Abs(image)
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine image absolute path for %s: %s", image, err)
+		}
+		image = path
+	}
+	o := &instance.StartOptions{
+		Image: image,
+		Args:  args,
+	}
+
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if unitFlags[f.Name] {
+			return
+		}
+		if unrecordedFlags[f.Name] {
+			sylog.Warningf("--%s is not recorded in the instance start options", f.Name)
+			return
+		}
+		if s, ok := f.Value.(pflag.SliceValue); ok {
+			for _, v := range s.GetSlice() {
+				o.Flags = append(o.Flags, f.Name+"="+v)
+			}
+			return
+		}
+		o.Flags = append(o.Flags, f.Name+"="+f.Value.String())
+	})
+	return o, nil
+}
+
+// writeInstanceUnit prints the systemd unit of the instance name started
+// with the options o.
+func writeInstanceUnit(name string, o *instance.StartOptions) {
+	scope := instanceUnitScope
+	if scope == "" {
+		scope = singularity.DefaultUnitScope()
+	}
+
+	err := singularity.WriteInstanceUnit(os.Stdout, singularity.InstanceUnit{
+		Name:       name,
+		Scope:      scope,
+		Restart:    instanceUnitRestart,
+		RestartSec: instanceUnitRestartSec,
+		Options:    o,
+	})
+	if err != nil {
+		sylog.Fatalf("Could not generate unit for instance %s: %s", name, err)
+	}
+	sylog.Infof("Instance options saved to %s, install the unit as %s", singularity.InstanceOptionsFile(name, scope), singularity.InstanceUnitName(name))
+}
+
+// singularity instance generate-unit
+var instanceGenerateUnitCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+
+		file, err := instance.Get(name, instance.SingSubDir)
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		if file.StartOptions == nil {
+			sylog.Fatalf("Instance %s was started without recording its options, restart it or use instance start --systemd", name)
+		}
+		writeInstanceUnit(name, file.StartOptions)
+	},
+
+	Use:     docs.InstanceGenerateUnitUse,
+	Short:   docs.InstanceGenerateUnitShort,
+	Long:    docs.InstanceGenerateUnitLong,
+	Example: docs.InstanceGenerateUnitExample,
+}
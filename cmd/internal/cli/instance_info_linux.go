@@ -0,0 +1,82 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&instanceInfoUserFlag, instanceInfoCmd)
+		cmdManager.RegisterFlagForCmd(&instanceInfoJSONFlag, instanceInfoCmd)
+		cmdManager.RegisterFlagForCmd(&instanceInfoNsPathsFlag, instanceInfoCmd)
+	})
+}
+
+// -u|--user
+var instanceInfoUser string
+var instanceInfoUserFlag = cmdline.Flag{
+	ID:           "instanceInfoUserFlag",
+	Value:        &instanceInfoUser,
+	DefaultValue: "",
+	Name:         "user",
+	ShortHand:    "u",
+	Usage:        `if running as root, show an instance from "<username>"`,
+	Tag:          "<username>",
+	EnvKeys:      []string{"USER"},
+}
+
+// -j|--json
+var instanceInfoJSON bool
+var instanceInfoJSONFlag = cmdline.Flag{
+	ID:           "instanceInfoJSONFlag",
+	Value:        &instanceInfoJSON,
+	DefaultValue: false,
+	Name:         "json",
+	ShortHand:    "j",
+	Usage:        "print structured json instead of list",
+	EnvKeys:      []string{"JSON"},
+}
+
+// --ns-paths
+var instanceInfoNsPaths bool
+var instanceInfoNsPathsFlag = cmdline.Flag{
+	ID:           "instanceInfoNsPathsFlag",
+	Value:        &instanceInfoNsPaths,
+	DefaultValue: false,
+	Name:         "ns-paths",
+	Usage:        "print only the nsenter options joining the instance namespaces",
+	EnvKeys:      []string{"NS_PATHS"},
+}
+
+// singularity instance info
+var instanceInfoCmd = &cobra.Command{
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		uid := os.Getuid()
+		if instanceInfoUser != "" && uid != 0 {
+			sylog.Fatalf("Only root user can show user's instances")
+		}
+
+		err := singularity.PrintInstanceInfo(os.Stdout, args[0], instanceInfoUser, instanceInfoJSON, instanceInfoNsPaths)
+		if err != nil {
+			sylog.Fatalf("Could not show instance info: %v", err)
+		}
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.InstanceInfoUse,
+	Short:   docs.InstanceInfoShort,
+	Long:    docs.InstanceInfoLong,
+	Example: docs.InstanceInfoExample,
+}
@@ -19,6 +19,9 @@ func init() {
 		cmdManager.RegisterSubCmd(instanceCmd, instanceStartCmd)
 		cmdManager.RegisterSubCmd(instanceCmd, instanceStopCmd)
 		cmdManager.RegisterSubCmd(instanceCmd, instanceListCmd)
+		cmdManager.RegisterSubCmd(instanceCmd, instanceExecCmd)
+		cmdManager.RegisterSubCmd(instanceCmd, instanceInfoCmd)
+		cmdManager.RegisterSubCmd(instanceCmd, instanceGenerateUnitCmd)
 	})
 }
 
@@ -6,39 +6,153 @@
 package cli
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/spf13/cobra"
 	"github.com/sylabs/singularity/docs"
-	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/internal/pkg/instance"
 	"github.com/sylabs/singularity/pkg/cmdline"
 	"github.com/sylabs/singularity/pkg/sylog"
 )
 
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
-		cmdManager.RegisterFlagForCmd(&instanceStartPidFileFlag, instanceStartCmd)
+		cmdManager.RegisterFlagForCmd(&instanceStartSystemdFlag, instanceStartCmd)
+		cmdManager.RegisterFlagForCmd(&instanceStartOptionsFileFlag, instanceStartCmd)
 	})
 }
 
-// --pid-file
-var instanceStartPidFile string
-var instanceStartPidFileFlag = cmdline.Flag{
-	ID:           "instanceStartPidFileFlag",
-	Value:        &instanceStartPidFile,
+// --systemd
+var instanceStartSystemd bool
+var instanceStartSystemdFlag = cmdline.Flag{
+	ID:           "instanceStartSystemdFlag",
+	Value:        &instanceStartSystemd,
+	DefaultValue: false,
+	Name:         "systemd",
+	Usage:        "print a systemd unit starting the instance with the given options instead of starting it",
+	EnvKeys:      []string{"SYSTEMD"},
+}
+
+// --options-file
+var instanceStartOptionsFile string
+var instanceStartOptionsFileFlag = cmdline.Flag{
+	ID:           "instanceStartOptionsFileFlag",
+	Value:        &instanceStartOptionsFile,
 	DefaultValue: "",
-	Name:         "pid-file",
-	Usage:        "write instance PID to the file with the given name",
-	EnvKeys:      []string{"PID_FILE"},
+	Name:         "options-file",
+	Usage:        "start the instance with the image, arguments and flags saved in the options file of a systemd unit",
+	Tag:          "<path>",
+	EnvKeys:      []string{"OPTIONS_FILE"},
+}
+
+// instanceStartArgs are the instance start arguments, read from the
+// options file with --options-file, and instanceStartImage is the image
+// given before a URI is replaced by the image pulled in the cache. The
+// instanceStartOptions are recorded in the instance file.
+var (
+	instanceStartArgs    []string
+	instanceStartImage   string
+	instanceStartOptions *instance.StartOptions
+)
+
+// checkInstanceUnsupportedFlags reports an error for any action flag set
+// on the command line which can't be honored by instance start.
+func checkInstanceUnsupportedFlags(cmd *cobra.Command) {
+	for name, reason := range instanceUnsupportedFlags {
+		if flag := cmd.Flag(name); flag != nil && flag.Changed {
+			sylog.Fatalf("--%s is not supported by instance start: %s", name, reason)
+		}
+	}
+	if !instanceStartSystemd {
+		for _, name := range []string{"scope", "restart", "restart-sec"} {
+			if flag := cmd.Flag(name); flag != nil && flag.Changed {
+				sylog.Fatalf("--%s requires --systemd", name)
+			}
+		}
+	}
+}
+
+// instanceStartArgsValidator checks the instance start arguments, only the
+// instance name is given with --options-file.
+func instanceStartArgsValidator(cmd *cobra.Command, args []string) error {
+	if cmd.Flag("options-file").Changed {
+		if len(args) != 1 {
+			return fmt.Errorf("requires the instance name only with --options-file, received %d arguments", len(args))
+		}
+		return nil
+	}
+	return cobra.MinimumNArgs(2)(cmd, args)
+}
+
+// applyStartOptions sets the instance start flags from the options file,
+// flags set on the command line or from the environment take precedence,
+// and returns the instance start arguments.
+func applyStartOptions(cmd *cobra.Command, path, name string) ([]string, error) {
+	o, err := instance.LoadStartOptions(path)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make(map[string]bool)
+	for _, f := range o.Flags {
+		kv := strings.SplitN(f, "=", 2)
+		flag := cmd.Flags().Lookup(kv[0])
+		if flag == nil || unitFlags[kv[0]] {
+			return nil, fmt.Errorf("options file %s: unknown instance start flag --%s", path, kv[0])
+		}
+		if flag.Changed && !changed[kv[0]] {
+			continue
+		}
+		if err := cmd.Flags().Set(kv[0], kv[1]); err != nil {
+			return nil, fmt.Errorf("options file %s: %s", path, err)
+		}
+		changed[kv[0]] = true
+	}
+
+	args := []string{o.Image, name}
+	return append(args, o.Args...), nil
 }
 
 // singularity instance start
 var instanceStartCmd = &cobra.Command{
-	Args:                  cobra.MinimumNArgs(2),
-	PreRun:                actionPreRun,
+	Args: instanceStartArgsValidator,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if instanceStartOptionsFile != "" {
+			if instanceStartSystemd {
+				sylog.Fatalf("--systemd and --options-file are mutually exclusive")
+			}
+			a, err := applyStartOptions(cmd, instanceStartOptionsFile, args[0])
+			if err != nil {
+				sylog.Fatalf("%s", err)
+			}
+			args = a
+		}
+		instanceStartArgs = args
+		instanceStartImage = args[0]
+		checkInstanceUnsupportedFlags(cmd)
+		actionPreRun(cmd, instanceStartArgs)
+	},
 	DisableFlagsInUseLine: true,
-	Run: func(cmd *cobra.Command, args []string) {
+	Run: func(cmd *cobra.Command, _ []string) {
+		args := instanceStartArgs
 		image := args[0]
 		name := args[1]
 
+		if err := instance.CheckName(name); err != nil {
+			sylog.Fatalf("%s", err)
+		}
+
+		o, err := newStartOptions(cmd, instanceStartImage, args[2:])
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		if instanceStartSystemd {
+			writeInstanceUnit(name, o)
+			return
+		}
+		instanceStartOptions = o
+
 		a := append([]string{"/.singularity.d/actions/start"}, args[2:]...)
 		setVM(cmd)
 		if VM {
@@ -46,13 +160,6 @@ var instanceStartCmd = &cobra.Command{
 			return
 		}
 		execStarter(cmd, image, a, name)
-
-		if instanceStartPidFile != "" {
-			err := singularity.WriteInstancePidFile(name, instanceStartPidFile)
-			if err != nil {
-				sylog.Warningf("Failed to write pid file: %v", err)
-			}
-		}
 	},
 
 	Use:     docs.InstanceStartUse,
@@ -0,0 +1,92 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// newStartOptionsCmd returns a command with flags of each type recorded in
+// the start options.
+func newStartOptionsCmd() *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Flags().StringSlice("bind", nil, "")
+	cmd.Flags().StringArray("env", nil, "")
+	cmd.Flags().Bool("net", false, "")
+	cmd.Flags().String("hostname", "", "")
+	cmd.Flags().Bool("systemd", false, "")
+	return cmd
+}
+
+func TestStartOptionsRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "start-options-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cmd := newStartOptionsCmd()
+	err = cmd.Flags().Parse([]string{
+		"--bind", "/data:/data,/logs", "--env", "A=b,c", "--net", "--hostname", "web", "--systemd",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := newStartOptions(cmd, "docker://nginx", []string{"arg"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	wantFlags := []string{"bind=/data:/data", "bind=/logs", "env=A=b,c", "hostname=web", "net=true"}
+	if o.Image != "docker://nginx" || !reflect.DeepEqual(o.Args, []string{"arg"}) || !reflect.DeepEqual(o.Flags, wantFlags) {
+		t.Fatalf("unexpected start options %+v", o)
+	}
+
+	path := filepath.Join(dir, "web.json")
+	if err := o.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// flags set on the command line take precedence
+	cmd = newStartOptionsCmd()
+	if err := cmd.Flags().Parse([]string{"--hostname", "db"}); err != nil {
+		t.Fatal(err)
+	}
+	args, err := applyStartOptions(cmd, path, "web")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want := []string{"docker://nginx", "web", "arg"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("got args %v, want %v", args, want)
+	}
+	if v, _ := cmd.Flags().GetStringSlice("bind"); !reflect.DeepEqual(v, []string{"/data:/data", "/logs"}) {
+		t.Errorf("unexpected bind values %v", v)
+	}
+	if v, _ := cmd.Flags().GetStringArray("env"); !reflect.DeepEqual(v, []string{"A=b,c"}) {
+		t.Errorf("unexpected env values %v", v)
+	}
+	if v, _ := cmd.Flags().GetBool("net"); !v {
+		t.Errorf("net flag not set")
+	}
+	if v, _ := cmd.Flags().GetString("hostname"); v != "db" {
+		t.Errorf("got hostname %s, want db", v)
+	}
+
+	// the unit flags can't be set from the options file
+	o.Flags = append(o.Flags, "systemd=true")
+	if err := o.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := applyStartOptions(newStartOptionsCmd(), path, "web"); err == nil {
+		t.Errorf("unexpected success with a unit flag")
+	}
+}
@@ -23,6 +23,7 @@ var (
 	keyServerURI        string // -u command line option
 	keySearchLongList   bool   // -l option for long-list
 	keyNewpairBitLength int    // -b option for bit length
+	keyPushAll          bool   // --all option for push
 )
 
 // -u|--url
@@ -56,6 +57,15 @@ var keyNewpairBitLengthFlag = cmdline.Flag{
 	Usage:        "specify key bit length",
 }
 
+// --all
+var keyPushAllFlag = cmdline.Flag{
+	ID:           "keyPushAllFlag",
+	Value:        &keyPushAll,
+	DefaultValue: false,
+	Name:         "all",
+	Usage:        "push the key to all keyservers of the active remote endpoint, except verify only keyservers",
+}
+
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterCmd(KeyCmd)
@@ -74,10 +84,12 @@ func init() {
 		cmdManager.RegisterSubCmd(KeyCmd, KeyImportCmd)
 		cmdManager.RegisterSubCmd(KeyCmd, KeyRemoveCmd)
 		cmdManager.RegisterSubCmd(KeyCmd, KeyExportCmd)
+		cmdManager.RegisterSubCmd(KeyCmd, KeyGeneratePEMCmd)
 
 		cmdManager.RegisterFlagForCmd(&keyServerURIFlag, KeySearchCmd, KeyPushCmd, KeyPullCmd)
 		cmdManager.RegisterFlagForCmd(&keySearchLongListFlag, KeySearchCmd)
-		cmdManager.RegisterFlagForCmd(&keyNewpairBitLengthFlag, KeyNewPairCmd)
+		cmdManager.RegisterFlagForCmd(&keyPushAllFlag, KeyPushCmd)
+		cmdManager.RegisterFlagForCmd(&keyNewpairBitLengthFlag, KeyNewPairCmd, KeyGeneratePEMCmd)
 		cmdManager.RegisterFlagForCmd(&keyImportWithNewPasswordFlag, KeyImportCmd)
 	})
 }
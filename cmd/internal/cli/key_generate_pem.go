@@ -0,0 +1,68 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/util/crypt"
+)
+
+// KeyGeneratePEMCmd is 'singularity key generate-pem <private key> [public key]',
+// it creates an RSA key pair for the encryption of images with --pem-path
+var KeyGeneratePEMCmd = &cobra.Command{
+	Args:                  cobra.RangeArgs(1, 2),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		privPath := args[0]
+		pubPath := pemPublicKeyPath(privPath)
+		if len(args) > 1 {
+			pubPath = args[1]
+		}
+
+		for _, p := range []string{privPath, pubPath} {
+			if _, err := os.Stat(p); err == nil {
+				sylog.Fatalf("Key file %s already exists, it won't be overwritten", p)
+			} else if !os.IsNotExist(err) {
+				sylog.Fatalf("While checking key file %s: %s", p, err)
+			}
+		}
+
+		key, err := crypt.GenerateRSAKey(keyNewpairBitLength)
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		if err := crypt.SavePrivatePEM(privPath, key); err != nil {
+			sylog.Fatalf("Unable to save private key: %s", err)
+		}
+		if err := crypt.SavePublicPEM(pubPath, key); err != nil {
+			os.Remove(privPath)
+			sylog.Fatalf("Unable to save public key: %s", err)
+		}
+
+		sylog.Infof("Private key written to %s, it isn't protected by a passphrase", privPath)
+		sylog.Infof("Public key written to %s", pubPath)
+	},
+
+	Use:     docs.KeyGeneratePEMUse,
+	Short:   docs.KeyGeneratePEMShort,
+	Long:    docs.KeyGeneratePEMLong,
+	Example: docs.KeyGeneratePEMExample,
+}
+
+// pemPublicKeyPath returns the default path of the public key of the
+// private key path, its .pem extension is replaced by .pub.
+func pemPublicKeyPath(path string) string {
+	if filepath.Ext(path) == ".pem" {
+		return strings.TrimSuffix(path, ".pem") + ".pub"
+	}
+	return path + ".pub"
+}
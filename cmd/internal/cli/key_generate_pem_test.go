@@ -0,0 +1,23 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import "testing"
+
+func TestPEMPublicKeyPath(t *testing.T) {
+	tests := map[string]string{
+		"image.pem":          "image.pub",
+		"keys/image.pem":     "keys/image.pub",
+		"image.key":          "image.key.pub",
+		"image":              "image.pub",
+		"keys.pem/image.rsa": "keys.pem/image.rsa.pub",
+	}
+	for path, want := range tests {
+		if got := pemPublicKeyPath(path); got != want {
+			t.Errorf("got %s for %s, want %s", got, path, want)
+		}
+	}
+}
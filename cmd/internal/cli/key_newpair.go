@@ -9,7 +9,6 @@ package cli
 import (
 	"context"
 	"errors"
-	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -101,16 +100,16 @@ func runNewPairCmd(cmd *cobra.Command, args []string) {
 	}
 	opts.KeyLength = keyNewpairBitLength
 
-	fmt.Printf("Generating Entity and OpenPGP Key Pair... ")
+	sylog.Infof("Generating Entity and OpenPGP Key Pair...")
 	key, err := keyring.GenKeyPair(opts.GenKeyPairOptions)
 	if err != nil {
 		sylog.Errorf("creating newpair failed: %v", err)
 		os.Exit(2)
 	}
-	fmt.Printf("done\n")
+	sylog.Infof("Key pair created for %s", key.PrimaryKey.KeyIdString())
 
 	if !opts.PushToKeyStore {
-		fmt.Printf("NOT pushing newly created key to: %s\n", keyServerURI)
+		sylog.Infof("NOT pushing newly created key to: %s", keyServerURI)
 		return
 	}
 
@@ -121,9 +120,9 @@ func runNewPairCmd(cmd *cobra.Command, args []string) {
 	}
 
 	if err := sypgp.PushPubkey(ctx, keyClient, key); err != nil {
-		fmt.Printf("Failed to push newly created key to keystore: %s\n", err)
+		sylog.Errorf("Failed to push newly created key to keystore: %s", err)
 	} else {
-		fmt.Printf("Key successfully pushed to: %s\n", keyServerURI)
+		sylog.Infof("Key successfully pushed to: %s", keyServerURI)
 	}
 }
 
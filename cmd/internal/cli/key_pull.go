@@ -82,7 +82,7 @@ func doKeyPullCmd(ctx context.Context, fingerprint string, c *client.Config) err
 		}
 	}
 
-	fmt.Printf("%v key(s) added to keyring of trust %s\n", count, keyring.PublicPath())
+	sylog.Infof("%v key(s) added to keyring of trust %s", count, keyring.PublicPath())
 
 	return nil
 }
@@ -27,13 +27,33 @@ var KeyPushCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		ctx := context.TODO()
 
-		keyClient, err := getKeyserverClientConfig(keyServerURI, endpoint.KeyserverPushOp)
-		if err != nil {
-			sylog.Fatalf("Keyserver client failed: %s", err)
+		var keyClients []*client.Config
+
+		if keyPushAll {
+			if cmd.Flag(keyServerURIFlag.Name).Changed {
+				sylog.Fatalf("--all can't be used with --%s", keyServerURIFlag.Name)
+			}
+			clients, err := getKeyserverPushClientConfigs()
+			if err != nil {
+				sylog.Fatalf("Keyserver client failed: %s", err)
+			}
+			keyClients = clients
+		} else {
+			keyClient, err := getKeyserverClientConfig(keyServerURI, endpoint.KeyserverPushOp)
+			if err != nil {
+				sylog.Fatalf("Keyserver client failed: %s", err)
+			}
+			keyClients = append(keyClients, keyClient)
 		}
 
-		if err := doKeyPushCmd(ctx, args[0], keyClient); err != nil {
-			sylog.Errorf("push failed: %s", err)
+		failed := false
+		for _, keyClient := range keyClients {
+			if err := doKeyPushCmd(ctx, args[0], keyClient); err != nil {
+				sylog.Errorf("push to %s failed: %s", keyClient.BaseURL, err)
+				failed = true
+			}
+		}
+		if failed {
 			os.Exit(2)
 		}
 	},
@@ -73,7 +93,7 @@ func doKeyPushCmd(ctx context.Context, fingerprint string, c *client.Config) err
 		return err
 	}
 
-	fmt.Printf("public key `%v' pushed to server successfully\n", fingerprint)
+	sylog.Infof("public key `%v' pushed to server %s successfully", fingerprint, c.BaseURL)
 
 	return nil
 }
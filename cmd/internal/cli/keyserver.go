@@ -0,0 +1,146 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/syfs"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+var (
+	keyserverOrder      uint32
+	keyserverInsecure   bool
+	keyserverVerifyOnly bool
+)
+
+// -o|--order
+var keyserverOrderFlag = cmdline.Flag{
+	ID:           "keyserverOrderFlag",
+	Value:        &keyserverOrder,
+	DefaultValue: uint32(0),
+	Name:         "order",
+	ShortHand:    "o",
+	Usage:        "define the keyserver order",
+}
+
+// -i|--insecure
+var keyserverInsecureFlag = cmdline.Flag{
+	ID:           "keyserverInsecureFlag",
+	Value:        &keyserverInsecure,
+	DefaultValue: false,
+	Name:         "insecure",
+	ShortHand:    "i",
+	Usage:        "allow insecure connection to keyserver",
+}
+
+// --verify-only
+var keyserverVerifyOnlyFlag = cmdline.Flag{
+	ID:           "keyserverVerifyOnlyFlag",
+	Value:        &keyserverVerifyOnly,
+	DefaultValue: false,
+	Name:         "verify-only",
+	Usage:        "use the keyserver for key verification and search only, keys are never pushed to it",
+}
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterCmd(KeyserverCmd)
+		cmdManager.RegisterSubCmd(KeyserverCmd, KeyserverAddCmd)
+		cmdManager.RegisterSubCmd(KeyserverCmd, KeyserverRemoveCmd)
+		cmdManager.RegisterSubCmd(KeyserverCmd, KeyserverListCmd)
+
+		cmdManager.RegisterFlagForCmd(&keyserverOrderFlag, KeyserverAddCmd)
+		cmdManager.RegisterFlagForCmd(&keyserverInsecureFlag, KeyserverAddCmd)
+		cmdManager.RegisterFlagForCmd(&keyserverVerifyOnlyFlag, KeyserverAddCmd)
+	})
+}
+
+// activeRemoteName returns the name of the active remote endpoint, an
+// empty name means the default system remote endpoint.
+func activeRemoteName() string {
+	c, err := syncedRemoteConf()
+	if err != nil {
+		sylog.Fatalf("Unable to load remote configuration: %s", err)
+	} else if c == nil {
+		return ""
+	}
+	return c.DefaultRemote
+}
+
+// KeyserverCmd singularity keyserver [...]
+var KeyserverCmd = &cobra.Command{
+	Run: nil,
+
+	Use:     docs.KeyserverUse,
+	Short:   docs.KeyserverShort,
+	Long:    docs.KeyserverLong,
+	Example: docs.KeyserverExample,
+
+	DisableFlagsInUseLine: true,
+}
+
+// KeyserverAddCmd singularity keyserver add [option] <keyserver_url>
+var KeyserverAddCmd = &cobra.Command{
+	Args:   cobra.ExactArgs(1),
+	PreRun: setKeyserver,
+	Run: func(cmd *cobra.Command, args []string) {
+		if cmd.Flag(keyserverOrderFlag.Name).Changed && keyserverOrder == 0 {
+			sylog.Fatalf("order must be > 0")
+		}
+
+		name := activeRemoteName()
+		if err := singularity.RemoteAddKeyserver(name, args[0], keyserverOrder, keyserverInsecure, keyserverVerifyOnly); err != nil {
+			sylog.Fatalf("%s", err)
+		}
+	},
+
+	Use:     docs.KeyserverAddUse,
+	Short:   docs.KeyserverAddShort,
+	Long:    docs.KeyserverAddLong,
+	Example: docs.KeyserverAddExample,
+
+	DisableFlagsInUseLine: true,
+}
+
+// KeyserverRemoveCmd singularity keyserver remove <keyserver_url>
+var KeyserverRemoveCmd = &cobra.Command{
+	Args:   cobra.ExactArgs(1),
+	PreRun: setKeyserver,
+	Run: func(cmd *cobra.Command, args []string) {
+		name := activeRemoteName()
+		if err := singularity.RemoteRemoveKeyserver(name, args[0]); err != nil {
+			sylog.Fatalf("%s", err)
+		}
+	},
+
+	Use:     docs.KeyserverRemoveUse,
+	Short:   docs.KeyserverRemoveShort,
+	Long:    docs.KeyserverRemoveLong,
+	Example: docs.KeyserverRemoveExample,
+
+	DisableFlagsInUseLine: true,
+}
+
+// KeyserverListCmd singularity keyserver list
+var KeyserverListCmd = &cobra.Command{
+	Args: cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := singularity.KeyserverList(syfs.RemoteConf(), activeRemoteName()); err != nil {
+			sylog.Fatalf("%s", err)
+		}
+	},
+
+	Use:     docs.KeyserverListUse,
+	Short:   docs.KeyserverListShort,
+	Long:    docs.KeyserverListLong,
+	Example: docs.KeyserverListExample,
+
+	DisableFlagsInUseLine: true,
+}
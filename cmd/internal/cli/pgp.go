@@ -129,6 +129,16 @@ func isLocal(e *openpgp.Entity) bool {
 	return len(keys) > 0
 }
 
+// datatypeName returns the name of the data object type t, types unknown
+// to this version, used by images created with newer versions, are named
+// with their value.
+func datatypeName(t sif.Datatype) string {
+	if s := t.String(); s != "Unknown" {
+		return s
+	}
+	return fmt.Sprintf("Unknown (%#x)", int32(t))
+}
+
 // outputVerify outputs a textual representation of r to stdout.
 func outputVerify(f *sif.FileImage, r integrity.VerifyResult) bool {
 	e := r.Entity()
@@ -149,6 +159,11 @@ func outputVerify(f *sif.FileImage, r integrity.VerifyResult) bool {
 
 		// Always print fingerprint.
 		fmt.Printf("%-18v Fingerprint: %X\n", prefix, e.PrimaryKey.Fingerprint)
+
+		// Print signature hash algorithm, if recorded.
+		if h := singularity.SignatureHash(f, r.Signature()); h != "" {
+			fmt.Printf("%-18v Hash: %s\n", prefix, h)
+		}
 	}
 
 	// Print table of signed objects.
@@ -178,11 +193,11 @@ func outputVerify(f *sif.FileImage, r integrity.VerifyResult) bool {
 			}
 		}
 
-		fmt.Printf("%-4d|%-8s|%-8s|%s\n", id, group, link, od.Datatype)
+		fmt.Printf("%-4d|%-8s|%-8s|%s\n", id, group, link, datatypeName(od.Datatype))
 	}
 
 	if err := r.Error(); err != nil {
-		fmt.Printf("\nError encountered during signature verification: %v\n", err)
+		sylog.Errorf("Error encountered during signature verification: %v", err)
 	}
 
 	return false
@@ -197,6 +212,7 @@ type keyEntity struct {
 	Partition   string
 	Name        string
 	Fingerprint string
+	Hash        string `json:",omitempty"`
 	KeyLocal    bool
 	KeyCheck    bool
 	DataCheck   bool
@@ -213,6 +229,7 @@ func getJSONCallback(kl *keyList) singularity.VerifyCallback {
 	return func(f *sif.FileImage, r integrity.VerifyResult) bool {
 		name, fp := "unknown", ""
 		var keyLocal, keyCheck bool
+		hash := singularity.SignatureHash(f, r.Signature())
 
 		// Increment signature count.
 		kl.Signatures++
@@ -236,9 +253,10 @@ func getJSONCallback(kl *keyList) singularity.VerifyCallback {
 			}
 
 			ke := keyEntity{
-				Partition:   od.Datatype.String(),
+				Partition:   datatypeName(od.Datatype),
 				Name:        name,
 				Fingerprint: fp,
+				Hash:        hash,
 				KeyLocal:    keyLocal,
 				KeyCheck:    keyCheck,
 				DataCheck:   true,
@@ -255,9 +273,10 @@ func getJSONCallback(kl *keyList) singularity.VerifyCallback {
 			}
 
 			ke := keyEntity{
-				Partition:   od.Datatype.String(),
+				Partition:   datatypeName(od.Datatype),
 				Name:        name,
 				Fingerprint: fp,
+				Hash:        hash,
 				KeyLocal:    keyLocal,
 				KeyCheck:    keyCheck,
 				DataCheck:   false,
@@ -7,6 +7,7 @@
 package cli
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -14,6 +15,8 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/sylabs/singularity/docs"
 	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/client/bucket"
+	"github.com/sylabs/singularity/internal/pkg/client/file"
 	"github.com/sylabs/singularity/internal/pkg/client/library"
 	"github.com/sylabs/singularity/internal/pkg/client/net"
 	"github.com/sylabs/singularity/internal/pkg/client/oci"
@@ -38,6 +41,12 @@ const (
 	HTTPSProtocol = "https"
 	// OrasProtocol holds the oras URI.
 	OrasProtocol = "oras"
+	// FileProtocol holds the local file URI.
+	FileProtocol = "file"
+	// S3Protocol holds the Amazon S3 object storage URI.
+	S3Protocol = "s3"
+	// GSProtocol holds the Google Cloud Storage URI.
+	GSProtocol = "gs"
 )
 
 var (
@@ -52,6 +61,11 @@ var (
 	// pullArch is the architecture for which containers will be pulled from the
 	// SCS library.
 	pullArch string
+	// pullUpdate when true; replaces an existing image file only if the image
+	// changed.
+	pullUpdate bool
+	// pullCheckOnly when true; only reports if an update is available.
+	pullCheckOnly bool
 )
 
 // --arch
@@ -74,14 +88,14 @@ var pullLibraryURIFlag = cmdline.Flag{
 	EnvKeys:      []string{"LIBRARY"},
 }
 
-// --name
+// -o|--name
 var pullNameFlag = cmdline.Flag{
 	ID:           "pullNameFlag",
 	Value:        &pullImageName,
 	DefaultValue: "",
 	Name:         "name",
-	Hidden:       true,
-	Usage:        "specify a custom image name",
+	ShortHand:    "o",
+	Usage:        "set the image file name instead of the name derived from the URI",
 	EnvKeys:      []string{"PULL_NAME"},
 }
 
@@ -95,6 +109,26 @@ var pullDirFlag = cmdline.Flag{
 	EnvKeys:      []string{"PULLDIR", "PULLFOLDER"},
 }
 
+// --update
+var pullUpdateFlag = cmdline.Flag{
+	ID:           "pullUpdateFlag",
+	Value:        &pullUpdate,
+	DefaultValue: false,
+	Name:         "update",
+	Usage:        "replace an existing image file only if the image changed since it was pulled",
+	EnvKeys:      []string{"PULL_UPDATE"},
+}
+
+// --check-only
+var pullCheckOnlyFlag = cmdline.Flag{
+	ID:           "pullCheckOnlyFlag",
+	Value:        &pullCheckOnly,
+	DefaultValue: false,
+	Name:         "check-only",
+	Usage:        "with --update, only report if an update of the image file is available",
+	EnvKeys:      []string{"PULL_CHECK_ONLY"},
+}
+
 // --disable-cache
 var pullDisableCacheFlag = cmdline.Flag{
 	ID:           "pullDisableCacheFlag",
@@ -137,6 +171,7 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&pullLibraryURIFlag, PullCmd)
 		cmdManager.RegisterFlagForCmd(&pullNameFlag, PullCmd)
 		cmdManager.RegisterFlagForCmd(&commonNoHTTPSFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&commonRegistryInsecureFlag, PullCmd)
 		cmdManager.RegisterFlagForCmd(&commonTmpDirFlag, PullCmd)
 		cmdManager.RegisterFlagForCmd(&pullDisableCacheFlag, PullCmd)
 		cmdManager.RegisterFlagForCmd(&pullDirFlag, PullCmd)
@@ -149,6 +184,8 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&pullAllowUnsignedFlag, PullCmd)
 		cmdManager.RegisterFlagForCmd(&pullAllowUnauthenticatedFlag, PullCmd)
 		cmdManager.RegisterFlagForCmd(&pullArchFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullUpdateFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullCheckOnlyFlag, PullCmd)
 	})
 }
 
@@ -164,8 +201,6 @@ var PullCmd = &cobra.Command{
 }
 
 func pullRun(cmd *cobra.Command, args []string) {
-	ctx := cmd.Context()
-
 	imgCache := getCacheHandle(cache.Config{Disable: disableCache})
 	if imgCache == nil {
 		sylog.Fatalf("Failed to create an image cache handle")
@@ -177,15 +212,24 @@ func pullRun(cmd *cobra.Command, args []string) {
 		sylog.Fatalf("Bad URI %s", pullFrom)
 	}
 
+	source := pullFrom
+	if transport == "" {
+		source = LibraryProtocol + "://" + pullFrom
+	}
+
+	if pullImageName != "" && len(args) == 2 {
+		sylog.Fatalf("The image file name can't be set with both --name and an output file argument")
+	}
+
 	pullTo := pullImageName
-	if pullTo == "" {
+	if pullTo == "" && len(args) == 2 {
 		pullTo = args[0]
-		if len(args) == 1 {
-			if transport == "" {
-				pullTo = uri.GetName("library://" + pullFrom)
-			} else {
-				pullTo = uri.GetName(pullFrom) // TODO: If not library/shub & no name specified, simply put to cache
-			}
+	}
+	derivedName := pullTo == ""
+	if derivedName {
+		pullTo = uri.GetName(source)
+		if pullTo == "" {
+			sylog.Fatalf("Unable to derive an image file name from %s, use --name to set it", pullFrom)
 		}
 	}
 
@@ -193,28 +237,60 @@ func pullRun(cmd *cobra.Command, args []string) {
 		pullTo = filepath.Join(pullDir, pullTo)
 	}
 
+	if pullCheckOnly && !pullUpdate {
+		sylog.Fatalf("--check-only requires --update")
+	}
+
 	_, err := os.Stat(pullTo)
 	if !os.IsNotExist(err) {
-		// image already exists
-		if !forceOverwrite {
-			sylog.Fatalf("Image file already exists: %q - will not overwrite", pullTo)
+		// image already exists, it's replaced with --force or --update unless
+		// the file name derived from the URI collides with the one of another
+		// image
+		if previous := pullSource(pullTo); derivedName && previous != "" && !uri.SameImage(previous, source) {
+			sylog.Fatalf("Image file %q pulled from %s has the same name as %s, use --name to set another image file name", pullTo, previous, source)
 		}
 	}
 
+	if pullUpdate {
+		pullUpdateRun(cmd, imgCache, pullTo, pullFrom, source, transport)
+		return
+	}
+
+	if !os.IsNotExist(err) && !forceOverwrite {
+		sylog.Fatalf("Image file already exists: %q - will not overwrite", pullTo)
+	}
+
+	if err := pullImage(cmd, imgCache, pullTo, pullFrom, transport); err != nil {
+		sylog.Fatalf("%s", err)
+	}
+
+	setPullSource(pullTo, source)
+
+	// the image path is the command result and goes to stdout
+	// so it can be captured by scripts
+	fmt.Println(pullTo)
+}
+
+// pullImage pulls the image of the URI pullFrom with the transport to the
+// image file pullTo.
+func pullImage(cmd *cobra.Command, imgCache *cache.Handle, pullTo, pullFrom, transport string) error {
+	ctx := cmd.Context()
+
 	switch transport {
 	case LibraryProtocol, "":
 		lc, err := getLibraryClientConfig(pullLibraryURI)
 		if err != nil {
-			sylog.Fatalf("Unable to get library client configuration: %v", err)
+			return fmt.Errorf("unable to get library client configuration: %v", err)
 		}
 		kc, err := getKeyserverClientConfig(endpoint.SCSDefaultKeyserverURI, endpoint.KeyserverVerifyOp)
 		if err != nil {
-			sylog.Fatalf("Unable to get keyserver client configuration: %v", err)
+			return fmt.Errorf("unable to get keyserver client configuration: %v", err)
 		}
+		pullFrom, lc = mirrorLibraryRef(pullFrom, lc)
 
 		_, err = library.PullToFile(ctx, imgCache, pullTo, pullFrom, pullArch, tmpDir, lc, kc)
 		if err != nil && err != library.ErrLibraryPullUnsigned {
-			sylog.Fatalf("While pulling library image: %v", err)
+			return fmt.Errorf("while pulling library image: %v", err)
 		}
 		if err == library.ErrLibraryPullUnsigned {
 			sylog.Warningf("Skipping container verification")
@@ -222,34 +298,71 @@ func pullRun(cmd *cobra.Command, args []string) {
 	case ShubProtocol:
 		_, err := shub.PullToFile(ctx, imgCache, pullTo, pullFrom, tmpDir, noHTTPS)
 		if err != nil {
-			sylog.Fatalf("While pulling shub image: %v\n", err)
+			return fmt.Errorf("while pulling shub image: %v", err)
 		}
 	case OrasProtocol:
 		ociAuth, err := makeDockerCredentials(cmd)
 		if err != nil {
-			sylog.Fatalf("Unable to make docker oci credentials: %s", err)
+			return fmt.Errorf("unable to make docker oci credentials: %s", err)
 		}
+		pullFrom, ociAuth = mirrorRegistryRef(pullFrom, ociAuth)
 
 		_, err = oras.PullToFile(ctx, imgCache, pullTo, pullFrom, tmpDir, ociAuth)
 		if err != nil {
-			sylog.Fatalf("While pulling image from oci registry: %v", err)
+			return fmt.Errorf("while pulling image from oci registry: %v", err)
 		}
 	case HTTPProtocol, HTTPSProtocol:
 		_, err := net.PullToFile(ctx, imgCache, pullTo, pullFrom, tmpDir)
 		if err != nil {
-			sylog.Fatalf("While pulling from image from http(s): %v\n", err)
+			return fmt.Errorf("while pulling from image from http(s): %v", err)
+		}
+	case FileProtocol:
+		_, err := file.PullToFile(ctx, imgCache, pullTo, pullFrom, tmpDir)
+		if err != nil {
+			return fmt.Errorf("while pulling local image: %v", err)
+		}
+	case S3Protocol, GSProtocol:
+		_, err := bucket.PullToFile(ctx, imgCache, pullTo, pullFrom, tmpDir, bucketConfigs())
+		if err != nil {
+			return fmt.Errorf("while pulling image from object storage: %v", err)
 		}
 	case oci.IsSupported(transport):
 		ociAuth, err := makeDockerCredentials(cmd)
 		if err != nil {
-			sylog.Fatalf("While creating Docker credentials: %v", err)
+			return fmt.Errorf("while creating Docker credentials: %v", err)
 		}
+		pullFrom, ociAuth = mirrorRegistryRef(pullFrom, ociAuth)
 
-		_, err = oci.PullToFile(ctx, imgCache, pullTo, pullFrom, tmpDir, ociAuth, noHTTPS, buildArgs.noCleanUp)
+		_, err = oci.PullToFile(ctx, imgCache, pullTo, pullFrom, tmpDir, ociAuth, noHTTPSFor(pullFrom), buildArgs.noCleanUp)
 		if err != nil {
-			sylog.Fatalf("While making image from oci registry: %v", err)
+			return fmt.Errorf("while making image from oci registry: %v", err)
 		}
 	default:
-		sylog.Fatalf("Unsupported transport type: %s", transport)
+		return fmt.Errorf("unsupported transport type: %s", transport)
+	}
+	return nil
+}
+
+// pullSourceXattr is the extended attribute recording the URI an image file
+// was pulled from, to detect collisions between the file names derived from
+// different URIs.
+const pullSourceXattr = "user.singularity.pull.source"
+
+// pullSource returns the URI the image file path was pulled from, or an
+// empty string if unknown.
+func pullSource(path string) string {
+	b := make([]byte, 4096)
+	n, err := getXattr(path, pullSourceXattr, b)
+	if err != nil {
+		return ""
+	}
+	return string(b[:n])
+}
+
+// setPullSource records the URI source the image file path was pulled from,
+// this is best effort as not all filesystems support extended attributes.
+func setPullSource(path, source string) {
+	if err := setXattr(path, pullSourceXattr, []byte(source)); err != nil {
+		sylog.Debugf("Could not record image source of %s: %s", path, err)
 	}
 }
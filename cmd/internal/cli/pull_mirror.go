@@ -0,0 +1,116 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"net/url"
+	"strings"
+
+	ocitypes "github.com/containers/image/v5/types"
+	scslibclient "github.com/sylabs/scs-library-client/client"
+	"github.com/sylabs/singularity/internal/pkg/client/library"
+	"github.com/sylabs/singularity/internal/pkg/remote"
+	"github.com/sylabs/singularity/internal/pkg/util/uri"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// mirrorConfig returns the remote configuration holding the mirror rules,
+// or nil if there is none.
+func mirrorConfig() *remote.Config {
+	c, err := syncedRemoteConf()
+	if err != nil {
+		sylog.Warningf("Unable to load remote configuration, mirror rules are ignored: %s", err)
+		return nil
+	}
+	return c
+}
+
+// mirrorRules returns the mirror rules of the remote configuration.
+func mirrorRules() remote.Mirrors {
+	if c := mirrorConfig(); c != nil {
+		return c.Mirrors
+	}
+	return nil
+}
+
+// mirrorRegistryRef returns the docker:// or oras:// URI pullFrom and the
+// registry credentials auth rewritten by the mirror rules of the remote
+// configuration.
+func mirrorRegistryRef(pullFrom string, auth *ocitypes.DockerAuthConfig) (string, *ocitypes.DockerAuthConfig) {
+	return rewriteRegistryRef(mirrorConfig(), pullFrom, auth)
+}
+
+// rewriteRegistryRef returns the docker:// or oras:// URI pullFrom rewritten
+// by the mirror rules of c for its transport, along with the registry
+// credentials auth to use for the pull. Rules are matched against the
+// normalized reference, like docker.io/library/alpine:latest for
+// docker://alpine. The credentials given for the original registry are
+// never sent to a mirror on another host, the mirror credentials are
+// looked up in the docker configuration instead.
+func rewriteRegistryRef(c *remote.Config, pullFrom string, auth *ocitypes.DockerAuthConfig) (string, *ocitypes.DockerAuthConfig) {
+	if c == nil {
+		return pullFrom, auth
+	}
+	transport, ref := uri.Split(pullFrom)
+	if transport != remote.MirrorDocker && transport != remote.MirrorOras {
+		return pullFrom, auth
+	}
+	ref = strings.TrimPrefix(ref, "//")
+
+	mirrored, moved := c.Mirrors.RewriteRegistry(transport, ref)
+	if mirrored == ref {
+		return pullFrom, auth
+	}
+	sylog.Verbosef("Pulling %s from mirror %s", pullFrom, mirrored)
+	if moved && auth != nil {
+		sylog.Verbosef("Not sending the registry credentials of %s to mirror %s", pullFrom, mirrored)
+		auth = nil
+	}
+	return transport + "://" + mirrored, auth
+}
+
+// mirrorLibraryRef returns the library:// URI pullFrom and the library
+// client configuration lc rewritten by the library mirror rules of the
+// remote configuration.
+func mirrorLibraryRef(pullFrom string, lc *scslibclient.Config) (string, *scslibclient.Config) {
+	return rewriteLibraryRef(mirrorConfig(), pullFrom, lc)
+}
+
+// rewriteLibraryRef returns the library:// URI pullFrom and the library
+// client configuration lc rewritten by the library mirror rules of c. Rules
+// are matched against the normalized reference prefixed by the library
+// host, like library.sylabs.io/alpine:latest for library://alpine, the
+// host of the rewritten reference is the library used for the pull.
+func rewriteLibraryRef(c *remote.Config, pullFrom string, lc *scslibclient.Config) (string, *scslibclient.Config) {
+	if c == nil || len(c.Mirrors) == 0 || lc == nil {
+		return pullFrom, lc
+	}
+	u, err := url.Parse(lc.BaseURL)
+	if err != nil || u.Host == "" {
+		sylog.Debugf("Not applying mirror rules to %s: bad library URL %q", pullFrom, lc.BaseURL)
+		return pullFrom, lc
+	}
+	ref := u.Host + "/" + strings.TrimPrefix(library.NormalizeLibraryRef(pullFrom), "/")
+
+	mirrored := c.Rewrite(remote.MirrorLibrary, ref)
+	if mirrored == ref {
+		return pullFrom, lc
+	}
+	i := strings.Index(mirrored, "/")
+	if i <= 0 {
+		sylog.Warningf("Ignoring mirror %s of %s: no library host", mirrored, pullFrom)
+		return pullFrom, lc
+	}
+	sylog.Verbosef("Pulling %s from mirror %s", pullFrom, mirrored)
+
+	mc := *lc
+	mc.BaseURL = u.Scheme + "://" + mirrored[:i]
+	// don't send the library token to another host
+	if mirrored[:i] != u.Host {
+		mc.AuthToken = ""
+	}
+	return "library://" + mirrored[i+1:], &mc
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"testing"
+
+	ocitypes "github.com/containers/image/v5/types"
+	scslibclient "github.com/sylabs/scs-library-client/client"
+	"github.com/sylabs/singularity/internal/pkg/remote"
+)
+
+var mirrorTestConfig = &remote.Config{
+	Mirrors: []*remote.Mirror{
+		{Transport: remote.MirrorDocker, Prefix: "docker.io/", Mirror: "registry.example.com:5000/"},
+		{Transport: remote.MirrorDocker, Prefix: "ghcr.io/sylabs/", Mirror: "ghcr.io/sylabs-mirror/"},
+		{Transport: remote.MirrorOras, Prefix: "ghcr.io/", Mirror: "registry.example.com:5000/ghcr/"},
+		{Transport: remote.MirrorLibrary, Regex: `^library\.sylabs\.io/(.*)$`, Mirror: "library.example.com/$1"},
+	},
+}
+
+func TestRewriteRegistryRef(t *testing.T) {
+	auth := &ocitypes.DockerAuthConfig{Username: "user", Password: "secret"}
+
+	tests := []struct {
+		name     string
+		pullFrom string
+		want     string
+		wantAuth bool
+	}{
+		{"Official", "docker://alpine", "docker://registry.example.com:5000/library/alpine:latest", false},
+		{"User", "docker://sylabsio/lolcow:3.6", "docker://registry.example.com:5000/sylabsio/lolcow:3.6", false},
+		{"Explicit", "docker://docker.io/library/busybox:1.31", "docker://registry.example.com:5000/library/busybox:1.31", false},
+		{"SameHost", "docker://ghcr.io/sylabs/alpine:3.12", "docker://ghcr.io/sylabs-mirror/alpine:3.12", true},
+		{"OtherRegistry", "docker://quay.io/biocontainers/samtools", "docker://quay.io/biocontainers/samtools", true},
+		{"Invalid", "docker://UPPER", "docker://UPPER", true},
+		{"Oras", "oras://ghcr.io/sylabs/alpine:3.12", "oras://registry.example.com:5000/ghcr/sylabs/alpine:3.12", false},
+		{"OrasOtherRegistry", "oras://quay.io/sylabs/alpine:3.12", "oras://quay.io/sylabs/alpine:3.12", true},
+		{"OtherTransport", "docker-archive:alpine.tar", "docker-archive:alpine.tar", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotAuth := rewriteRegistryRef(mirrorTestConfig, tt.pullFrom, auth)
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+			if (gotAuth == auth) != tt.wantAuth {
+				t.Errorf("got credentials %v, want original credentials %t", gotAuth, tt.wantAuth)
+			}
+		})
+	}
+
+	if got, _ := rewriteRegistryRef(nil, "docker://alpine", nil); got != "docker://alpine" {
+		t.Errorf("got %s without configuration, want docker://alpine", got)
+	}
+}
+
+func TestRewriteLibraryRef(t *testing.T) {
+	lc := &scslibclient.Config{BaseURL: "https://library.sylabs.io", AuthToken: "token"}
+
+	pullFrom, c := rewriteLibraryRef(mirrorTestConfig, "library://alpine", lc)
+	if pullFrom != "library://alpine:latest" {
+		t.Errorf("got %s, want library://alpine:latest", pullFrom)
+	}
+	if c.BaseURL != "https://library.example.com" {
+		t.Errorf("got library %s, want https://library.example.com", c.BaseURL)
+	}
+	if c.AuthToken != "" {
+		t.Errorf("library token sent to mirror")
+	}
+	if lc.BaseURL != "https://library.sylabs.io" || lc.AuthToken != "token" {
+		t.Errorf("original library configuration modified")
+	}
+
+	other := &scslibclient.Config{BaseURL: "https://library.example.org"}
+	pullFrom, c = rewriteLibraryRef(mirrorTestConfig, "library://alpine", other)
+	if pullFrom != "library://alpine" || c != other {
+		t.Errorf("unexpected rewrite %s from %s", pullFrom, c.BaseURL)
+	}
+}
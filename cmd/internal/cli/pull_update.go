@@ -0,0 +1,215 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	scslibclient "github.com/sylabs/scs-library-client/client"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/client/library"
+	"github.com/sylabs/singularity/internal/pkg/client/oci"
+	"github.com/sylabs/singularity/internal/pkg/client/oras"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/internal/pkg/util/uri"
+	"github.com/sylabs/singularity/pkg/image"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// pullUpdateAvailableStatus is the exit status of pull --update
+// --check-only when an update of the image file is available.
+const pullUpdateAvailableStatus = 100
+
+// ociDigest returns the digest of the manifest of the OCI image the image
+// file path was built from, recorded in its SIF metadata, or an empty string
+// if unknown.
+func ociDigest(path string) (string, error) {
+	img, err := image.Init(path, false)
+	if err != nil {
+		return "", err
+	}
+	defer img.File.Close()
+
+	if img.Type != image.SIF {
+		return "", nil
+	}
+	r, err := image.NewSectionReader(img, image.SIFDescOCIDigestJSON, -1)
+	if err != nil {
+		// images built before the digest was recorded
+		sylog.Debugf("No OCI digest recorded in %s: %s", path, err)
+		return "", nil
+	}
+	var digest string
+	if err := json.NewDecoder(r).Decode(&digest); err != nil {
+		return "", fmt.Errorf("while decoding OCI digest: %s", err)
+	}
+	return strings.TrimPrefix(digest, "sha256:"), nil
+}
+
+// remoteDigest returns the digest of the current image of the URI pullFrom,
+// from the library API or from the manifest of a registry image, without
+// downloading it.
+func remoteDigest(cmd *cobra.Command, pullFrom, transport string) (string, error) {
+	ctx := cmd.Context()
+
+	switch transport {
+	case LibraryProtocol, "":
+		lc, err := getLibraryClientConfig(pullLibraryURI)
+		if err != nil {
+			return "", fmt.Errorf("unable to get library client configuration: %v", err)
+		}
+		pullFrom, lc = mirrorLibraryRef(pullFrom, lc)
+		return library.ImageDigest(ctx, pullFrom, pullArch, lc)
+	case OrasProtocol:
+		ociAuth, err := makeDockerCredentials(cmd)
+		if err != nil {
+			return "", fmt.Errorf("unable to make docker oci credentials: %s", err)
+		}
+		pullFrom, ociAuth = mirrorRegistryRef(pullFrom, ociAuth)
+		return oras.ImageSHA(ctx, pullFrom, ociAuth)
+	case oci.IsSupported(transport):
+		ociAuth, err := makeDockerCredentials(cmd)
+		if err != nil {
+			return "", fmt.Errorf("while creating Docker credentials: %v", err)
+		}
+		pullFrom, ociAuth = mirrorRegistryRef(pullFrom, ociAuth)
+		return oci.ImageDigest(ctx, pullFrom, tmpDir, ociAuth, noHTTPSFor(pullFrom))
+	}
+	return "", fmt.Errorf("unsupported transport type: %s", transport)
+}
+
+// localDigest returns the digest of the image file path pulled from source
+// to compare with the one returned by remoteDigest, or an empty string if
+// unknown. Library and oras images are downloaded as is, their digest is the
+// one of the image file, while the digest of an OCI image is the one
+// recorded in the SIF metadata of the image file built from it.
+func localDigest(path, source, transport string) (string, error) {
+	switch transport {
+	case LibraryProtocol, "":
+		return scslibclient.ImageHash(path)
+	case OrasProtocol:
+		return oras.ImageHash(path)
+	}
+	if previous := pullSource(path); previous != "" && !uri.SameImage(previous, source) {
+		return "", nil
+	}
+	return ociDigest(path)
+}
+
+// pullUpdateRun replaces the image file pullTo by the image of the URI
+// pullFrom only if the image changed since it was pulled. With
+// --check-only, it only reports if an update is available.
+func pullUpdateRun(cmd *cobra.Command, imgCache *cache.Handle, pullTo, pullFrom, source, transport string) {
+	switch transport {
+	case LibraryProtocol, "", OrasProtocol, oci.IsSupported(transport):
+	default:
+		sylog.Fatalf("--update is not supported for %s images, only for library, oras and OCI images", transport)
+	}
+
+	digest, err := remoteDigest(cmd, pullFrom, transport)
+	if err != nil {
+		sylog.Fatalf("Unable to get the digest of %s: %s", source, err)
+	}
+	sylog.Debugf("Current digest of %s: %s", source, digest)
+
+	_, err = os.Stat(pullTo)
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		sylog.Fatalf("While checking image file %s: %s", pullTo, err)
+	}
+
+	if exists {
+		current, err := localDigest(pullTo, source, transport)
+		if err != nil {
+			sylog.Fatalf("Unable to get the digest of image file %s: %s", pullTo, err)
+		}
+		if current == digest {
+			sylog.Infof("Image file %s is already up to date with %s", pullTo, source)
+			if pullCheckOnly {
+				fmt.Println("up-to-date")
+			} else {
+				fmt.Println(pullTo)
+			}
+			return
+		}
+	}
+
+	// the result of --check-only goes to stdout and the exit status, so
+	// scripts can test it
+	if pullCheckOnly {
+		if exists {
+			sylog.Infof("An update of image file %s is available from %s", pullTo, source)
+		} else {
+			sylog.Infof("Image file %s doesn't exist, it would be pulled from %s", pullTo, source)
+		}
+		fmt.Println("update-available")
+		os.Exit(pullUpdateAvailableStatus)
+	}
+
+	if err := replaceImage(cmd, imgCache, pullTo, pullFrom, transport); err != nil {
+		sylog.Fatalf("%s", err)
+	}
+
+	setPullSource(pullTo, source)
+
+	if exists {
+		sylog.Infof("Image file %s updated from %s", pullTo, source)
+	}
+	fmt.Println(pullTo)
+}
+
+// replaceImage pulls the image of the URI pullFrom to a temporary file
+// next to the image file pullTo and atomically replaces pullTo once the
+// pull succeeded, the previous image file is left untouched on failure.
+func replaceImage(cmd *cobra.Command, imgCache *cache.Handle, pullTo, pullFrom, transport string) error {
+	// keep the permissions of the previous image file, a new image file is
+	// created like with a regular pull
+	oldmask := umask(0)
+	umask(oldmask)
+	mode := os.FileMode(0777) &^ os.FileMode(oldmask)
+	if fi, err := os.Stat(pullTo); err == nil {
+		mode = fi.Mode().Perm()
+	}
+
+	dir := filepath.Dir(pullTo)
+	tmp, err := fs.MakeTmpFile(dir, "."+filepath.Base(pullTo)+".update-", 0600)
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := pullImage(cmd, imgCache, tmp.Name(), pullFrom, transport); err != nil {
+		return err
+	}
+
+	f, err := os.Open(tmp.Name())
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("while syncing %s: %s", tmp.Name(), err)
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), pullTo); err != nil {
+		return fmt.Errorf("while replacing image file %s: %s", pullTo, err)
+	}
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
@@ -8,7 +8,6 @@ package cli
 
 import (
 	"context"
-	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -18,6 +17,7 @@ import (
 	"github.com/sylabs/singularity/internal/pkg/remote/endpoint"
 	"github.com/sylabs/singularity/internal/pkg/util/uri"
 	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/syfs"
 	"github.com/sylabs/singularity/pkg/sylog"
 )
 
@@ -30,6 +30,9 @@ var (
 
 	// pushDescription holds a description to be set against a library container
 	pushDescription string
+
+	// pushPartSize holds the size in MiB of the parts of a multipart library upload
+	pushPartSize int
 )
 
 // --library
@@ -63,6 +66,16 @@ var pushDescriptionFlag = cmdline.Flag{
 	Usage:        "description for container image (library:// only)",
 }
 
+// --part-size
+var pushPartSizeFlag = cmdline.Flag{
+	ID:           "pushPartSizeFlag",
+	Value:        &pushPartSize,
+	DefaultValue: int(singularity.DefaultUploadPartSize >> 20),
+	Name:         "part-size",
+	Usage:        "size in MiB of the parts of a resumable multipart upload (library:// only)",
+	EnvKeys:      []string{"PUSH_PART_SIZE"},
+}
+
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterCmd(PushCmd)
@@ -70,6 +83,7 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&pushLibraryURIFlag, PushCmd)
 		cmdManager.RegisterFlagForCmd(&pushAllowUnsignedFlag, PushCmd)
 		cmdManager.RegisterFlagForCmd(&pushDescriptionFlag, PushCmd)
+		cmdManager.RegisterFlagForCmd(&pushPartSizeFlag, PushCmd)
 
 		cmdManager.RegisterFlagForCmd(&dockerUsernameFlag, PushCmd)
 		cmdManager.RegisterFlagForCmd(&dockerPasswordFlag, PushCmd)
@@ -107,17 +121,24 @@ var PushCmd = &cobra.Command{
 				sylog.Fatalf("Unable to get keyserver client configuration: %v", err)
 			}
 
+			partSize := int64(pushPartSize) << 20
+			if partSize < singularity.MinUploadPartSize {
+				sylog.Fatalf("Part size must be at least %d MiB", singularity.MinUploadPartSize>>20)
+			}
+
 			pushSpec := singularity.LibraryPushSpec{
 				SourceFile:    file,
 				DestRef:       dest,
 				Description:   pushDescription,
 				AllowUnsigned: unsignedPush,
+				PartSize:      partSize,
+				StateDir:      syfs.UploadStateDir(),
 			}
 
 			err = singularity.LibraryPush(ctx, pushSpec, lc, kc)
 			if err == singularity.ErrLibraryUnsigned {
-				fmt.Printf("TIP: You can push unsigned images with 'singularity push -U %s'.\n", file)
-				fmt.Printf("TIP: Learn how to sign your own containers by using 'singularity help sign'\n\n")
+				sylog.Infof("TIP: You can push unsigned images with 'singularity push -U %s'.", file)
+				sylog.Infof("TIP: Learn how to sign your own containers by using 'singularity help sign'")
 				sylog.Fatalf("Unable to upload container: unable to verify signature")
 				os.Exit(3)
 			} else if err != nil {
@@ -127,6 +148,9 @@ var PushCmd = &cobra.Command{
 			if cmd.Flag(pushDescriptionFlag.Name).Changed {
 				sylog.Warningf("Description is not supported for push to oras. Ignoring it.")
 			}
+			if cmd.Flag(pushPartSizeFlag.Name).Changed {
+				sylog.Warningf("Part size is not supported for push to oras. Ignoring it.")
+			}
 			ociAuth, err := makeDockerCredentials(cmd)
 			if err != nil {
 				sylog.Fatalf("Unable to make docker oci credentials: %s", err)
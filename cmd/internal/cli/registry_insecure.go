@@ -0,0 +1,46 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/sylabs/singularity/internal/pkg/remote"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// insecureRegistries returns the hosts of the registries pulled from
+// without HTTPS: the ones given with --registry-insecure and the ones
+// marked as insecure in the remote configuration.
+func insecureRegistries() []string {
+	c, err := syncedRemoteConf()
+	if err != nil {
+		sylog.Warningf("Unable to load remote configuration, insecure registries are ignored: %s", err)
+	}
+	return mergeInsecureRegistries(c, registryInsecure)
+}
+
+// mergeInsecureRegistries returns the hosts listed in hosts followed by
+// the insecure registries of c.
+func mergeInsecureRegistries(c *remote.Config, hosts []string) []string {
+	merged := append([]string{}, hosts...)
+	if c != nil {
+		merged = append(merged, c.InsecureRegistries()...)
+	}
+	return merged
+}
+
+// noHTTPSFor returns if HTTPS must not be used to pull the docker:// URI
+// pullFrom, either with --nohttps for all registries or because its
+// registry is an insecure one.
+func noHTTPSFor(pullFrom string) bool {
+	if noHTTPS {
+		return true
+	}
+	if remote.InsecureRegistry(insecureRegistries(), pullFrom) {
+		sylog.Verbosef("Not using HTTPS to pull %s from an insecure registry", pullFrom)
+		return true
+	}
+	return false
+}
@@ -411,7 +411,7 @@ var RemoteAddKeyserverCmd = &cobra.Command{
 			sylog.Fatalf("order must be > 0")
 		}
 
-		if err := singularity.RemoteAddKeyserver(name, uri, remoteKeyserverOrder, remoteKeyserverInsecure); err != nil {
+		if err := singularity.RemoteAddKeyserver(name, uri, remoteKeyserverOrder, remoteKeyserverInsecure, false); err != nil {
 			sylog.Fatalf("%s", err)
 		}
 	},
@@ -0,0 +1,152 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/sylabs/singularity/internal/pkg/util/starter"
+	"github.com/sylabs/singularity/pkg/runtime/engine/config"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// rootfsDigest returns the SHA256 digest of the image path. The digest of
+// an image file or block device covers its whole content, the digest of a
+// sandbox directory covers the path, type, permissions, ownership and
+// content of each file, but not their timestamps.
+func rootfsDigest(path string) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	if !fi.IsDir() {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%x", h.Sum(nil)), nil
+	}
+
+	err = filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(h, "%s\x00%o\x00", rel, fi.Mode())
+		if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+			fmt.Fprintf(h, "%d:%d\x00", st.Uid, st.Gid)
+		}
+
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "%s\x00", target)
+		case fi.Mode().IsRegular():
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			fmt.Fprintf(h, "%d\x00", fi.Size())
+			if _, err := io.Copy(h, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// runRootfsROCheck runs the container with the starter and waits for it,
+// then checks that the image was not modified by comparing its digest
+// before and after the run, and that it was not mounted writable. The
+// process exits with the exit code of the container if the checks pass,
+// the run fails otherwise.
+func runRootfsROCheck(procname string, cfg *config.Common, image string, writable bool, ops ...starter.CommandOp) {
+	before, err := rootfsDigest(image)
+	if err != nil {
+		sylog.Fatalf("Could not compute the digest of %s: %s", image, err)
+	}
+	sylog.Debugf("Digest of %s before the run: %s", image, before)
+
+	// interrupts from the terminal are received by the container too,
+	// singularity must outlive it to check the image, termination
+	// requests kill the container instead
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		for s := range sigs {
+			if s == syscall.SIGTERM || s == syscall.SIGHUP {
+				cancel()
+			}
+		}
+	}()
+
+	ops = append(ops,
+		starter.WithStdin(os.Stdin),
+		starter.WithStdout(os.Stdout),
+		starter.WithStderr(os.Stderr),
+		starter.WithContext(ctx),
+	)
+	exitCode := 0
+	if err := starter.Run(procname, cfg, ops...); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			sylog.Fatalf("%s", err)
+		}
+		status, _ := exitErr.Sys().(syscall.WaitStatus)
+		exitCode = status.ExitStatus()
+		if status.Signaled() {
+			exitCode = 128 + int(status.Signal())
+		}
+	}
+	signal.Stop(sigs)
+
+	after, err := rootfsDigest(image)
+	if err != nil {
+		sylog.Fatalf("Could not compute the digest of %s after the run: %s", image, err)
+	}
+	sylog.Debugf("Digest of %s after the run: %s", image, after)
+
+	if after != before {
+		sylog.Fatalf("Image %s was modified by the run: digest %s changed to %s", image, before, after)
+	}
+	if writable {
+		sylog.Fatalf("Image %s was mounted writable by --writable, the run could have modified it", image)
+	}
+	sylog.Verbosef("Image %s was not modified by the run", image)
+	os.Exit(exitCode)
+}
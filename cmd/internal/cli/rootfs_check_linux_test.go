@@ -0,0 +1,115 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRootfsDigest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rootfs-digest-")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	image := filepath.Join(dir, "image.sif")
+	sandbox := filepath.Join(dir, "sandbox")
+	file := filepath.Join(sandbox, "etc", "file")
+
+	if err := ioutil.WriteFile(image, []byte("image"), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := ioutil.WriteFile(file, []byte("file"), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.Symlink("file", filepath.Join(sandbox, "etc", "link")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		modify  func() error
+		changed bool
+	}{
+		{
+			name:    "FileContent",
+			path:    image,
+			modify:  func() error { return ioutil.WriteFile(image, []byte("imagE"), 0644) },
+			changed: true,
+		},
+		{
+			name: "SandboxTimestamps",
+			path: sandbox,
+			modify: func() error {
+				now := time.Now().Add(time.Hour)
+				return os.Chtimes(file, now, now)
+			},
+			changed: false,
+		},
+		{
+			name:    "SandboxContent",
+			path:    sandbox,
+			modify:  func() error { return ioutil.WriteFile(file, []byte("File"), 0644) },
+			changed: true,
+		},
+		{
+			name:    "SandboxMode",
+			path:    sandbox,
+			modify:  func() error { return os.Chmod(file, 0600) },
+			changed: true,
+		},
+		{
+			name:    "SandboxNewFile",
+			path:    sandbox,
+			modify:  func() error { return ioutil.WriteFile(filepath.Join(sandbox, "new"), nil, 0644) },
+			changed: true,
+		},
+		{
+			name: "SandboxSymlink",
+			path: sandbox,
+			modify: func() error {
+				link := filepath.Join(sandbox, "etc", "link")
+				if err := os.Remove(link); err != nil {
+					return err
+				}
+				return os.Symlink("/etc/passwd", link)
+			},
+			changed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, err := rootfsDigest(tt.path)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if err := tt.modify(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			after, err := rootfsDigest(tt.path)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if changed := after != before; changed != tt.changed {
+				t.Errorf("got digest changed %t, want %t", changed, tt.changed)
+			}
+		})
+	}
+
+	if _, err := rootfsDigest(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("unexpected success with a missing image")
+	}
+}
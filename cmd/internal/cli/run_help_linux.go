@@ -16,6 +16,7 @@ import (
 	"github.com/sylabs/singularity/docs"
 	"github.com/sylabs/singularity/internal/pkg/buildcfg"
 	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/image"
 	"github.com/sylabs/singularity/pkg/sylog"
 )
 
@@ -46,6 +47,27 @@ var RunHelpCmd = &cobra.Command{
 			sylog.Fatalf("container not found: %s", err)
 		}
 
+		// the help of a definition file is shown without building the image
+		if _, err := image.Init(args[0], false); err == image.ErrUnknownFormat {
+			metadata, err := definitionMetadata(args[0], nil)
+			if err != nil {
+				sylog.Fatalf("Failed to parse definition file %s: %s", args[0], err)
+			}
+			help := metadata.Attributes.Helpfile
+			if AppName != "" {
+				help = ""
+				if app := metadata.Attributes.Apps[AppName]; app != nil {
+					help = app.Helpfile
+				}
+			}
+			if help == "" {
+				fmt.Println("No help sections were defined for this image")
+			} else {
+				fmt.Println(help)
+			}
+			return
+		}
+
 		cmdArgs := []string{"inspect", "--helpfile"}
 		if AppName != "" {
 			sylog.Debugf("App specified. Looking for help section of %s", AppName)
@@ -0,0 +1,49 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/util/singularityconf"
+)
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterCmd(ScanCmd)
+	})
+}
+
+// ScanCmd singularity scan <image>
+var ScanCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		hook, err := singularity.NewScanHook(singularityconf.GetCurrentConfig())
+		if err != nil {
+			sylog.Fatalf("While configuring post build hook: %s", err)
+		}
+
+		r, err := hook.Scan(context.TODO(), args[0])
+		if r != nil {
+			fmt.Print(r.Output)
+		}
+		if err != nil {
+			sylog.Fatalf("While scanning image: %s", err)
+		}
+	},
+
+	Use:     docs.ScanUse,
+	Short:   docs.ScanShort,
+	Long:    docs.ScanLong,
+	Example: docs.ScanExample,
+}
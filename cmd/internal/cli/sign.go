@@ -6,8 +6,6 @@
 package cli
 
 import (
-	"fmt"
-
 	"github.com/spf13/cobra"
 	"github.com/sylabs/singularity/docs"
 	"github.com/sylabs/singularity/internal/app/singularity"
@@ -17,8 +15,9 @@ import (
 )
 
 var (
-	privKey int // -k encryption key (index from 'keys list') specification
-	signAll bool
+	privKey  int // -k encryption key (index from 'keys list') specification
+	signAll  bool
+	signHash string
 )
 
 // -g|--group-id
@@ -71,6 +70,15 @@ var signKeyIdxFlag = cmdline.Flag{
 	Usage:        "private key to use (index from 'key list')",
 }
 
+// --hash
+var signHashFlag = cmdline.Flag{
+	ID:           "signHashFlag",
+	Value:        &signHash,
+	DefaultValue: singularity.DefaultSignHash,
+	Name:         "hash",
+	Usage:        "hash algorithm used for the signature (sha256, sha384 or sha512)",
+}
+
 // -a|--all (deprecated)
 var signAllFlag = cmdline.Flag{
 	ID:           "signAllFlag",
@@ -92,6 +100,7 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&signSifDescIDFlag, SignCmd)
 		cmdManager.RegisterFlagForCmd(&signKeyIdxFlag, SignCmd)
 		cmdManager.RegisterFlagForCmd(&signAllFlag, SignCmd)
+		cmdManager.RegisterFlagForCmd(&signHashFlag, SignCmd)
 	})
 }
 
@@ -112,7 +121,8 @@ var SignCmd = &cobra.Command{
 }
 
 func doSignCmd(cmd *cobra.Command, cpath string) {
-	var opts []singularity.SignOpt
+	// Set hash option first, so an unsupported algorithm is reported before selecting a key.
+	opts := []singularity.SignOpt{singularity.OptSignHash(signHash)}
 
 	// Set entity selector option, and ensure the entity is decrypted.
 	var f sypgp.EntitySelector
@@ -135,9 +145,9 @@ func doSignCmd(cmd *cobra.Command, cpath string) {
 	}
 
 	// Sign the image.
-	fmt.Printf("Signing image: %s\n", cpath)
+	sylog.Infof("Signing image: %s", cpath)
 	if err := singularity.Sign(cpath, opts...); err != nil {
 		sylog.Fatalf("Failed to sign container: %s", err)
 	}
-	fmt.Printf("Signature created and applied to %s\n", cpath)
+	sylog.Infof("Signature created and applied to %s", cpath)
 }
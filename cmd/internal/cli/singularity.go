@@ -20,6 +20,7 @@ import (
 	"text/template"
 
 	ocitypes "github.com/containers/image/v5/types"
+	pgpColor "github.com/fatih/color"
 	"github.com/spf13/cobra"
 	scsbuildclient "github.com/sylabs/scs-build-client/client"
 	scskeyclient "github.com/sylabs/scs-key-client/client"
@@ -56,6 +57,7 @@ var (
 	promptForPassphrase bool
 	forceOverwrite      bool
 	noHTTPS             bool
+	registryInsecure    []string
 	tmpDir              string
 )
 
@@ -90,7 +92,7 @@ var singNoColorFlag = cmdline.Flag{
 	Value:        &nocolor,
 	DefaultValue: false,
 	Name:         "nocolor",
-	Usage:        "print without color output (default False)",
+	Usage:        "print without color output, also enabled by setting NO_COLOR (default False)",
 }
 
 // -s|--silent
@@ -110,7 +112,7 @@ var singQuietFlag = cmdline.Flag{
 	DefaultValue: false,
 	Name:         "quiet",
 	ShortHand:    "q",
-	Usage:        "suppress normal output",
+	Usage:        "suppress informational messages, warnings, errors and command results are still printed",
 }
 
 // -v|--verbose
@@ -194,6 +196,17 @@ var commonNoHTTPSFlag = cmdline.Flag{
 	EnvKeys:      []string{"NOHTTPS"},
 }
 
+// --registry-insecure
+var commonRegistryInsecureFlag = cmdline.Flag{
+	ID:           "commonRegistryInsecureFlag",
+	Value:        &registryInsecure,
+	DefaultValue: []string{},
+	Name:         "registry-insecure",
+	Usage:        "do NOT use HTTPS with the docker:// transport for the given registry hosts only, other registries still require HTTPS",
+	EnvKeys:      []string{"REGISTRY_INSECURE"},
+	Tag:          "<host[:port],...>",
+}
+
 // --tmpdir
 var commonTmpDirFlag = cmdline.Flag{
 	ID:           "commonTmpDirFlag",
@@ -243,12 +256,14 @@ func setSylogMessageLevel() {
 		level = 1
 	}
 
+	// NO_COLOR is honored as described by https://no-color.org
 	color := true
-	if nocolor || !terminal.IsTerminal(2) {
+	if nocolor || os.Getenv("NO_COLOR") != "" || !terminal.IsTerminal(2) {
 		color = false
 	}
 
 	sylog.SetLevel(level, color)
+	pgpColor.NoColor = !color
 }
 
 // handleRemoteConf will make sure your 'remote.yaml' config file
@@ -496,26 +511,35 @@ func loadRemoteConf(filepath string) (*remote.Config, error) {
 	return c, nil
 }
 
-// sylabsRemote returns the remote in use or an error
-func sylabsRemote() (*endpoint.Config, error) {
-	var c *remote.Config
-
-	// try to load both remotes, check for errors, sync if both exist,
-	// if neither exist return errNoDefault to return to old auth behavior
+// syncedRemoteConf returns the user remote configuration synced with the
+// system one, or nil if neither exist
+func syncedRemoteConf() (*remote.Config, error) {
+	// try to load both remotes, check for errors, sync if both exist
 	cSys, sysErr := loadRemoteConf(remote.SystemConfigPath)
 	cUsr, usrErr := loadRemoteConf(syfs.RemoteConf())
 	if sysErr != nil && usrErr != nil {
-		return endpoint.DefaultEndpointConfig, nil
+		return nil, nil
 	} else if sysErr != nil {
-		c = cUsr
+		return cUsr, nil
 	} else if usrErr != nil {
-		c = cSys
-	} else {
-		// sync cUsr with system config cSys
-		if err := cUsr.SyncFrom(cSys); err != nil {
-			return nil, err
-		}
-		c = cUsr
+		return cSys, nil
+	}
+	// sync cUsr with system config cSys
+	if err := cUsr.SyncFrom(cSys); err != nil {
+		return nil, err
+	}
+	return cUsr, nil
+}
+
+// sylabsRemote returns the remote in use or an error
+func sylabsRemote() (*endpoint.Config, error) {
+	c, err := syncedRemoteConf()
+	if err != nil {
+		return nil, err
+	} else if c == nil {
+		// if neither exist return the default endpoint to return
+		// to old auth behavior
+		return endpoint.DefaultEndpointConfig, nil
 	}
 
 	ep, err := c.GetDefault()
@@ -609,6 +633,22 @@ func getKeyserverClientConfig(uri string, op endpoint.KeyserverOp) (*scskeyclien
 	return currentRemoteEndpoint.KeyserverClientConfig(uri, op)
 }
 
+// getKeyserverPushClientConfigs returns the client configurations to
+// push keys to all the keyservers of the active remote endpoint accepting
+// keys.
+func getKeyserverPushClientConfigs() ([]*scskeyclient.Config, error) {
+	if currentRemoteEndpoint == nil {
+		var err error
+
+		currentRemoteEndpoint, err = sylabsRemote()
+		if err != nil {
+			return nil, fmt.Errorf("unable to load remote configuration: %v", err)
+		}
+	}
+
+	return currentRemoteEndpoint.KeyserverPushClientConfigs(true)
+}
+
 func getLibraryClientConfig(uri string) (*scslibclient.Config, error) {
 	isDefault := uri == endpoint.SCSDefaultLibraryURI
 
@@ -0,0 +1,88 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/sylabs/singularity/internal/pkg/util/fs/specialfiles"
+	"github.com/sylabs/singularity/pkg/image"
+	"github.com/sylabs/singularity/pkg/image/unpacker"
+	"github.com/sylabs/singularity/pkg/inspect"
+)
+
+const specialFilesJSON = "special-files.json"
+
+// errNoSpecialFiles is returned when the special files of an image can't
+// be found without running the container.
+var errNoSpecialFiles = errors.New("special files are not recorded in the image metadata")
+
+// imageSpecialFiles returns the setuid, setgid and world-writable files
+// of img, recorded in its metadata when it was built. The special files
+// of images built without recording them are read from the listing of
+// their squashfs root filesystem, or found by scanning sandbox images.
+func imageSpecialFiles(img *image.Image) (*inspect.SpecialFiles, error) {
+	switch img.Type {
+	case image.SIF:
+		md, err := getInspectMetadataFromSIF(img)
+		if err == nil && md.Attributes.SpecialFiles != nil {
+			return md.Attributes.SpecialFiles, nil
+		} else if err != nil && err != image.ErrNoSection {
+			return nil, err
+		}
+	case image.SANDBOX:
+		b, err := ioutil.ReadFile(filepath.Join(img.Path, ".singularity.d", specialFilesJSON))
+		if os.IsNotExist(err) {
+			return specialfiles.ScanDir(img.Path)
+		} else if err != nil {
+			return nil, err
+		}
+		files := new(inspect.SpecialFiles)
+		if err := json.Unmarshal(b, files); err != nil {
+			return nil, fmt.Errorf("while decoding %s: %s", specialFilesJSON, err)
+		}
+		return files, nil
+	}
+
+	part, err := img.GetRootFsPartition()
+	if err != nil {
+		return nil, err
+	}
+	if part.Type != image.SQUASHFS {
+		return nil, errNoSpecialFiles
+	}
+	s := unpacker.NewSquashfs()
+	if !s.HasUnsquashfs() {
+		return nil, fmt.Errorf("%s: unsquashfs not found", errNoSpecialFiles)
+	}
+	return specialfiles.ScanSquashfs(s.UnsquashfsPath, img.Path, part.Offset, part.Size)
+}
+
+// printSpecialFiles prints the counts and paths of special files.
+func printSpecialFiles(files *inspect.SpecialFiles) {
+	for _, kind := range []struct {
+		name  string
+		count int
+		paths []string
+	}{
+		{"Setuid files", files.SetuidCount, files.Setuid},
+		{"Setgid files", files.SetgidCount, files.Setgid},
+		{"World-writable files", files.WorldWritableCount, files.WorldWritable},
+	} {
+		fmt.Printf("%s: %d\n", kind.name, kind.count)
+		for _, p := range kind.paths {
+			fmt.Printf("  %s\n", p)
+		}
+		if more := kind.count - len(kind.paths); more > 0 {
+			fmt.Printf("  ... and %d more\n", more)
+		}
+	}
+}
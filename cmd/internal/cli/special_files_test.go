@@ -0,0 +1,72 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/singularity/pkg/image"
+)
+
+func TestImageSpecialFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "special-files-")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	passwd := filepath.Join(dir, "bin", "passwd")
+	if err := os.MkdirAll(filepath.Dir(passwd), 0755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := ioutil.WriteFile(passwd, nil, 0755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.Chmod(passwd, 0755|os.ModeSetuid); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	img, err := image.Init(dir, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer img.File.Close()
+
+	// the sandbox is scanned without recorded special files
+	files, err := imageSpecialFiles(img)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if files.SetuidCount != 1 || len(files.Setuid) != 1 || files.Setuid[0] != "/bin/passwd" {
+		t.Errorf("got setuid files %d %v, want 1 [/bin/passwd]", files.SetuidCount, files.Setuid)
+	}
+
+	// recorded special files are used otherwise
+	recorded := filepath.Join(dir, ".singularity.d", specialFilesJSON)
+	if err := os.MkdirAll(filepath.Dir(recorded), 0755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := ioutil.WriteFile(recorded, []byte(`{"setuidCount": 0, "setgidCount": 2, "setgid": ["/a", "/b"], "worldWritableCount": 0}`), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	files, err = imageSpecialFiles(img)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if files.SetuidCount != 0 || files.SetgidCount != 2 {
+		t.Errorf("got %d setuid and %d setgid files, want 0 and 2", files.SetuidCount, files.SetgidCount)
+	}
+
+	if err := ioutil.WriteFile(recorded, []byte(`{`), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := imageSpecialFiles(img); err == nil {
+		t.Errorf("unexpected success with invalid recorded special files")
+	}
+}
@@ -19,6 +19,17 @@ import (
 	"github.com/sylabs/singularity/pkg/sylog"
 )
 
+// xhyvePath is the path of the hypervisor running containers on macOS, it's
+// only installed with the virtual machine images, client installations
+// can't run containers.
+var xhyvePath = filepath.Join(buildcfg.LIBEXECDIR, "/singularity/vm/xhyve")
+
+// hypervisorInstalled returns if containers can run in a virtual machine.
+func hypervisorInstalled() bool {
+	_, err := os.Stat(xhyvePath)
+	return err == nil
+}
+
 // Lots of love from:
 // https://stackoverflow.com/questions/22892120/how-to-generate-a-random-string-of-a-fixed-length-in-go
 func genString(n int) string {
@@ -38,7 +49,7 @@ func getHypervisorArgs(sifImage, bzImage, initramfs, singAction, cliExtra string
 	hdString := fmt.Sprintf("2:0,ahci-hd,%s", sifImage)
 
 	// Check xhyve permissions
-	fi, err := os.Stat(filepath.Join(buildcfg.LIBEXECDIR, "/singularity/vm/xhyve"))
+	fi, err := os.Stat(xhyvePath)
 	if err != nil {
 		sylog.Fatalf("Filed to Stat() xhyve binary: %v", err)
 	}
@@ -48,7 +59,7 @@ func getHypervisorArgs(sifImage, bzImage, initramfs, singAction, cliExtra string
 	}
 	// Default xhyve Arguments
 	args := []string{
-		filepath.Join(buildcfg.LIBEXECDIR, "/singularity/vm/xhyve"),
+		xhyvePath,
 		"-A",
 		"-m", VMRAM,
 		"-c", VMCPU,
@@ -0,0 +1,21 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// hypervisorInstalled returns if containers can run in a virtual machine,
+// this platform has no supported hypervisor.
+func hypervisorInstalled() bool {
+	return false
+}
+
+func getHypervisorArgs(sifImage, bzImage, initramfs, singAction, cliExtra string) []string {
+	sylog.Fatalf("virtual machines are not supported on this platform")
+	return nil
+}
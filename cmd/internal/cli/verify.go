@@ -8,23 +8,40 @@ package cli
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"regexp"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/sylabs/singularity/docs"
 	"github.com/sylabs/singularity/internal/app/singularity"
 	"github.com/sylabs/singularity/internal/pkg/remote/endpoint"
+	"github.com/sylabs/singularity/internal/pkg/sigstore"
+	"github.com/sylabs/singularity/internal/pkg/tuf"
 	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/syfs"
 	"github.com/sylabs/singularity/pkg/sylog"
 )
 
 var (
-	sifGroupID   uint32 // -g groupid specification
-	sifDescID    uint32 // -i id specification
-	localVerify  bool   // -l flag
-	jsonVerify   bool   // -j flag
-	verifyAll    bool
-	verifyLegacy bool
+	sifGroupID    uint32 // -g groupid specification
+	sifDescID     uint32 // -i id specification
+	localVerify   bool   // -l flag
+	jsonVerify    bool   // -j flag
+	verifyAll     bool
+	verifyLegacy  bool
+	verifySandbox bool
+
+	keyCacheTTL        string
+	refreshKeys        bool
+	strictKeyFreshness bool
+
+	certIdentityRegexp string
+	certOIDCIssuer     string
+	certChainFile      string
+	ctLogKeyFile       string
+	rekorKeyFile       string
 )
 
 // -u|--url
@@ -118,6 +135,94 @@ var verifyLegacyFlag = cmdline.Flag{
 	Usage:        "enable verification of (insecure) legacy signatures",
 }
 
+// --sandbox
+var verifySandboxFlag = cmdline.Flag{
+	ID:           "verifySandboxFlag",
+	Value:        &verifySandbox,
+	DefaultValue: false,
+	Name:         "sandbox",
+	Usage:        "verify a sandbox directory against the signed image it was extracted from",
+}
+
+// --key-cache-ttl
+var verifyKeyCacheTTLFlag = cmdline.Flag{
+	ID:           "verifyKeyCacheTTLFlag",
+	Value:        &keyCacheTTL,
+	DefaultValue: "0",
+	Name:         "key-cache-ttl",
+	Usage:        "cache keys retrieved from the key server for this duration (e.g. 1h), the cache is disabled by default",
+	EnvKeys:      []string{"KEY_CACHE_TTL"},
+}
+
+// --refresh-keys
+var verifyRefreshKeysFlag = cmdline.Flag{
+	ID:           "verifyRefreshKeysFlag",
+	Value:        &refreshKeys,
+	DefaultValue: false,
+	Name:         "refresh-keys",
+	Usage:        "retrieve keys from the key server again, even if they are cached",
+}
+
+// --strict-key-freshness
+var verifyStrictKeyFreshnessFlag = cmdline.Flag{
+	ID:           "verifyStrictKeyFreshnessFlag",
+	Value:        &strictKeyFreshness,
+	DefaultValue: false,
+	Name:         "strict-key-freshness",
+	Usage:        "fail instead of using expired cached keys when the key server is unreachable",
+	EnvKeys:      []string{"STRICT_KEY_FRESHNESS"},
+}
+
+// --certificate-identity-regexp
+var verifyCertIdentityFlag = cmdline.Flag{
+	ID:           "verifyCertIdentityFlag",
+	Value:        &certIdentityRegexp,
+	DefaultValue: "",
+	Name:         "certificate-identity-regexp",
+	Usage:        "verify keyless signatures whose signer identity (email or URI) matches the regular expression (unanchored, use ^ and $ to match the whole identity)",
+	EnvKeys:      []string{"CERTIFICATE_IDENTITY_REGEXP"},
+}
+
+// --certificate-oidc-issuer
+var verifyCertOIDCIssuerFlag = cmdline.Flag{
+	ID:           "verifyCertOIDCIssuerFlag",
+	Value:        &certOIDCIssuer,
+	DefaultValue: "",
+	Name:         "certificate-oidc-issuer",
+	Usage:        "verify keyless signatures whose signer identity was issued by this OIDC provider",
+	EnvKeys:      []string{"CERTIFICATE_OIDC_ISSUER"},
+}
+
+// --certificate-chain
+var verifyCertChainFlag = cmdline.Flag{
+	ID:           "verifyCertChainFlag",
+	Value:        &certChainFile,
+	DefaultValue: "",
+	Name:         "certificate-chain",
+	Usage:        "PEM file with the trusted root and intermediate certificates issuing keyless signing certificates",
+	EnvKeys:      []string{"CERTIFICATE_CHAIN"},
+}
+
+// --ctlog-public-key
+var verifyCTLogKeyFlag = cmdline.Flag{
+	ID:           "verifyCTLogKeyFlag",
+	Value:        &ctLogKeyFile,
+	DefaultValue: "",
+	Name:         "ctlog-public-key",
+	Usage:        "PEM file with the public key(s) of trusted certificate transparency logs",
+	EnvKeys:      []string{"CTLOG_PUBLIC_KEY"},
+}
+
+// --rekor-public-key
+var verifyRekorKeyFlag = cmdline.Flag{
+	ID:           "verifyRekorKeyFlag",
+	Value:        &rekorKeyFile,
+	DefaultValue: "",
+	Name:         "rekor-public-key",
+	Usage:        "PEM file with the public key(s) of trusted transparency logs",
+	EnvKeys:      []string{"REKOR_PUBLIC_KEY"},
+}
+
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterCmd(VerifyCmd)
@@ -131,6 +236,15 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&verifyJSONFlag, VerifyCmd)
 		cmdManager.RegisterFlagForCmd(&verifyAllFlag, VerifyCmd)
 		cmdManager.RegisterFlagForCmd(&verifyLegacyFlag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifySandboxFlag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifyKeyCacheTTLFlag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifyRefreshKeysFlag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifyStrictKeyFreshnessFlag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifyCertIdentityFlag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifyCertOIDCIssuerFlag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifyCertChainFlag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifyCTLogKeyFlag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifyRekorKeyFlag, VerifyCmd)
 	})
 }
 
@@ -151,6 +265,16 @@ var VerifyCmd = &cobra.Command{
 }
 
 func doVerifyCmd(cmd *cobra.Command, cpath string) {
+	// any keyless option selects keyless verification, never fall back to
+	// PGP signatures when keyless verification was requested
+	if certIdentityRegexp != "" || certOIDCIssuer != "" || certChainFile != "" || ctLogKeyFile != "" || rekorKeyFile != "" {
+		if verifySandbox {
+			sylog.Fatalf("--sandbox is not supported with keyless signatures")
+		}
+		doVerifyKeyless(cmd, cpath)
+		return
+	}
+
 	var opts []singularity.VerifyOpt
 
 	// Set keyserver option, if applicable.
@@ -161,8 +285,28 @@ func doVerifyCmd(cmd *cobra.Command, cpath string) {
 		}
 
 		opts = append(opts, singularity.OptVerifyUseKeyServer(c))
+
+		ttl, err := time.ParseDuration(keyCacheTTL)
+		if err != nil {
+			sylog.Fatalf("Invalid --%s value: %s", verifyKeyCacheTTLFlag.Name, err)
+		}
+		opts = append(opts, singularity.OptVerifyKeyCache(ttl))
+
+		if refreshKeys {
+			opts = append(opts, singularity.OptVerifyRefreshKeys())
+		}
+		if strictKeyFreshness {
+			opts = append(opts, singularity.OptVerifyStrictKeyFreshness())
+		}
 	}
 
+	if verifySandbox {
+		doVerifySandbox(cmd, cpath, opts)
+		return
+	}
+
+	opts = append(opts, freshnessOpts()...)
+
 	// Set group option, if applicable.
 	if cmd.Flag(verifySifGroupIDFlag.Name).Changed || cmd.Flag(verifyOldSifGroupIDFlag.Name).Changed {
 		opts = append(opts, singularity.OptVerifyGroup(sifGroupID))
@@ -202,12 +346,124 @@ func doVerifyCmd(cmd *cobra.Command, cpath string) {
 	} else {
 		opts = append(opts, singularity.OptVerifyCallback(outputVerify))
 
-		fmt.Printf("Verifying image: %s\n", cpath)
+		sylog.Infof("Verifying image: %s", cpath)
 
 		if err := singularity.Verify(cmd.Context(), cpath, opts...); err != nil {
 			sylog.Fatalf("Failed to verify container: %s", err)
 		}
 
-		fmt.Printf("Container verified: %s\n", cpath)
+		sylog.Infof("Container verified: %s", cpath)
+	}
+}
+
+// freshnessOpts returns the option checking that the verified image is the
+// latest signed version, when the active remote endpoint configures a
+// freshness metadata source.
+func freshnessOpts() []singularity.VerifyOpt {
+	ep, err := sylabsRemote()
+	if err != nil {
+		sylog.Warningf("Unable to load remote configuration, image freshness is not checked: %s", err)
+		return nil
+	}
+	if ep.Freshness == nil {
+		return nil
 	}
+	c := tuf.NewClient(*ep.Freshness, syfs.TUFStateDir())
+	return []singularity.VerifyOpt{singularity.OptVerifyFreshness(c)}
+}
+
+// doVerifySandbox verifies the sandbox cpath against the signed image it was extracted from.
+func doVerifySandbox(cmd *cobra.Command, cpath string, opts []singularity.VerifyOpt) {
+	if jsonVerify || verifyLegacy || verifyAll || cmd.Flag(verifySifGroupIDFlag.Name).Changed || cmd.Flag(verifySifDescSifIDFlag.Name).Changed {
+		sylog.Fatalf("--json, --legacy-insecure, --all, --group-id and --sif-id are not supported with --sandbox")
+	}
+
+	sylog.Infof("Verifying sandbox: %s", cpath)
+
+	r, err := singularity.VerifySandbox(cmd.Context(), cpath, opts...)
+	if err != nil {
+		sylog.Fatalf("Failed to verify sandbox: %s", err)
+	}
+
+	if len(r.Changes) > 0 {
+		for _, c := range r.Changes {
+			fmt.Printf("%-9s %s\n", c.Kind+":", c.Path)
+		}
+		sylog.Fatalf("Sandbox %s doesn't match signed source %s: %d path(s) changed", cpath, r.Source, len(r.Changes))
+	}
+
+	for _, e := range r.Signers {
+		fmt.Printf("Sandbox matches signed source %X\n", e.PrimaryKey.Fingerprint)
+	}
+	sylog.Infof("Sandbox verified: %s", cpath)
+}
+
+// doVerifyKeyless verifies keyless (sigstore) signatures of the image cpath.
+func doVerifyKeyless(cmd *cobra.Command, cpath string) {
+	if jsonVerify || verifyLegacy || verifyAll || cmd.Flag(verifySifDescSifIDFlag.Name).Changed || cmd.Flag(verifySifDescIDFlag.Name).Changed {
+		sylog.Fatalf("--json, --legacy-insecure, --all and --sif-id are not supported with keyless signatures")
+	}
+
+	for _, f := range []struct {
+		value string
+		flag  string
+	}{
+		{certIdentityRegexp, verifyCertIdentityFlag.Name},
+		{certOIDCIssuer, verifyCertOIDCIssuerFlag.Name},
+	} {
+		if f.value == "" {
+			sylog.Fatalf("--%s is required to verify keyless signatures", f.flag)
+		}
+	}
+	re, err := regexp.Compile(certIdentityRegexp)
+	if err != nil {
+		sylog.Fatalf("Invalid certificate identity regular expression: %s", err)
+	}
+
+	var material [3][]byte
+	for i, f := range []struct {
+		path string
+		flag string
+	}{
+		{certChainFile, verifyCertChainFlag.Name},
+		{ctLogKeyFile, verifyCTLogKeyFlag.Name},
+		{rekorKeyFile, verifyRekorKeyFlag.Name},
+	} {
+		if f.path == "" {
+			sylog.Fatalf("--%s is required to verify keyless signatures", f.flag)
+		}
+		material[i], err = ioutil.ReadFile(f.path)
+		if err != nil {
+			sylog.Fatalf("While reading --%s file: %s", f.flag, err)
+		}
+	}
+
+	tr, err := sigstore.NewTrustRoot(material[0], material[1], material[2])
+	if err != nil {
+		sylog.Fatalf("Failed to load keyless trust root: %s", err)
+	}
+
+	opts := []singularity.VerifyOpt{
+		singularity.OptVerifyKeyless(tr, sigstore.Identity{Subject: re, Issuer: certOIDCIssuer}),
+		singularity.OptVerifyKeylessCallback(outputVerifyKeyless),
+	}
+	if cmd.Flag(verifySifGroupIDFlag.Name).Changed || cmd.Flag(verifyOldSifGroupIDFlag.Name).Changed {
+		opts = append(opts, singularity.OptVerifyGroup(sifGroupID))
+	}
+	opts = append(opts, freshnessOpts()...)
+
+	sylog.Infof("Verifying image with keyless signatures: %s", cpath)
+
+	if err := singularity.Verify(cmd.Context(), cpath, opts...); err != nil {
+		sylog.Fatalf("Failed to verify container: %s", err)
+	}
+
+	sylog.Infof("Container verified: %s", cpath)
+}
+
+// outputVerifyKeyless outputs a verified keyless signature.
+func outputVerifyKeyless(groupID uint32, r *sigstore.Result) {
+	fmt.Printf("Object group %d signed by: %s\n", groupID, r.Subject)
+	fmt.Printf("  OIDC issuer:          %s\n", r.Issuer)
+	fmt.Printf("  Transparency log:     index %d, %s\n", r.LogIndex, r.IntegratedTime.UTC().Format(time.RFC3339))
 }
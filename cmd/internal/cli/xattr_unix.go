@@ -0,0 +1,24 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !windows
+
+package cli
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+func getXattr(path, attr string, dest []byte) (int, error) {
+	return unix.Getxattr(path, attr, dest)
+}
+
+func setXattr(path, attr string, data []byte) error {
+	return unix.Setxattr(path, attr, data, 0)
+}
+
+func umask(mask int) int {
+	return unix.Umask(mask)
+}
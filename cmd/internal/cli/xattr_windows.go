@@ -0,0 +1,27 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"errors"
+)
+
+// errNoXattr is returned as extended attributes are not supported on
+// this platform, callers treat them as best effort.
+var errNoXattr = errors.New("extended attributes are not supported on this platform")
+
+func getXattr(path, attr string, dest []byte) (int, error) {
+	return 0, errNoXattr
+}
+
+func setXattr(path, attr string, data []byte) error {
+	return errNoXattr
+}
+
+// umask is a no-op, there is no process umask on this platform.
+func umask(mask int) int {
+	return 0
+}
@@ -9,6 +9,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -22,6 +23,7 @@ import (
 
 	"github.com/sylabs/singularity/internal/pkg/test"
 	"github.com/sylabs/singularity/internal/pkg/test/tool/require"
+	"github.com/sylabs/singularity/pkg/client/actions"
 )
 
 // build base image for tests
@@ -54,6 +56,58 @@ type opts struct {
 // imageExec can be used to run/exec/shell a Singularity image
 // it return the exitCode and err of the execution
 func imageExec(t *testing.T, action string, opts opts, imagePath string, command []string) (string, string, int, error) {
+	// the client package runs local images without user namespace
+	// conversion, the other executions still go through the CLI
+	useClient := (action == "exec" || action == "run") &&
+		!strings.Contains(imagePath, "://") &&
+		!opts.userns &&
+		len(opts.security) == 0
+	if useClient {
+		return clientExec(t, action, opts, imagePath, command)
+	}
+	return cliExec(t, action, opts, imagePath, command)
+}
+
+// clientExec runs/execs a local Singularity image with the actions
+// client package, the exit code is 1 on any failure like with cliExec.
+func clientExec(t *testing.T, action string, opts opts, imagePath string, command []string) (string, string, int, error) {
+	clientOpts := actions.Options{
+		Binds:     opts.binds,
+		Overlay:   opts.overlay,
+		Contain:   opts.contain,
+		NoHome:    opts.noHome,
+		Home:      opts.home,
+		Workdir:   opts.workdir,
+		Pwd:       opts.pwd,
+		App:       opts.app,
+		KeepPrivs: opts.keepPrivs,
+		DropCaps:  opts.dropCaps,
+	}
+
+	run := actions.Exec
+	if action == "run" {
+		run = actions.Run
+	}
+
+	res, err := run(context.Background(), actions.ImageRef(imagePath), command, clientOpts)
+	if err != nil {
+		stderr := err.Error()
+		if res != nil {
+			stderr = string(res.Stderr) + stderr
+		}
+		return "", stderr, 1, nil
+	}
+
+	exitCode := 0
+	if res.ExitCode != 0 {
+		exitCode = 1
+	}
+	return string(res.Stdout), string(res.Stderr), exitCode, nil
+}
+
+// cliExec runs/execs/shells a Singularity image with the singularity
+// binary.
+func cliExec(t *testing.T, action string, opts opts, imagePath string, command []string) (string, string, int, error) {
 	// action can be run/exec/shell
 	argv := []string{action}
 	for _, bind := range opts.binds {
@@ -273,6 +327,12 @@ func testSTDINPipe(t *testing.T) {
 		// {"sh", "shub", []string{"-c", "echo true | singularity shell shub://singularityhub/busybox"}, 0},
 		// Test apps
 		{"sh", "appsFoo", []string{"-c", fmt.Sprintf("singularity run --app foo %s | grep 'FOO'", appsImage)}, 0},
+		{"sh", "appsOrder", []string{"-c", fmt.Sprintf("singularity run --app-order bar,foo %s 2>/dev/null | tr '\\n' ' ' | grep 'RUNNING BAR RUNNING FOO'", appsImage)}, 0},
+		{"sh", "appsOrderEnv", []string{"-c", fmt.Sprintf("singularity run --app-order foo,bar,foo %s 2>/dev/null | tr '\\n' ' ' | grep -x 'RUNNING FOO WITH foo RUNNING BAR RUNNING FOO WITH foo '", appsImage)}, 0},
+		{"sh", "appsOrderGlobalEnv", []string{"-c", fmt.Sprintf("SINGULARITYENV_HELLOTHISIS=global singularity run --app-order bar,foo %s 2>/dev/null | tr '\\n' ' ' | grep -x 'RUNNING BAR WITH global RUNNING FOO WITH foo '", appsImage)}, 0},
+		{"sh", "appsOrderSummary", []string{"-c", fmt.Sprintf("singularity run --app-order bar,foo %s 2>&1 >/dev/null | grep -A2 'EXIT CODE' | tr -s ' \\n' ' ' | grep 'bar 0 foo 0'", appsImage)}, 0},
+		{"sh", "appsOrderExitLast", []string{"-c", fmt.Sprintf("singularity run --app-order bar,baz,foo %s 3", appsImage)}, 1},
+		{"sh", "appsOrderExitFirst", []string{"-c", fmt.Sprintf("singularity run --app-order bar,baz,foo --app-exit first %s 3", appsImage)}, 3},
 		// Test target pwd
 		{"sh", "pwdPath", []string{"-c", fmt.Sprintf("singularity exec --pwd /etc %s pwd | egrep '^/etc'", imagePath)}, 0},
 	}
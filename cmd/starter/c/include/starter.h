@@ -23,6 +23,7 @@
 #define MAX_PATH_SIZE       PATH_MAX
 #define MAX_GID             32
 #define MAX_STARTER_FDS     1024
+#define MAX_RLIMITS         16
 #define MAX_CMD_SIZE        MAX_PATH_SIZE+MAX_MAP_SIZE+64
 
 #ifndef PR_SET_NO_NEW_PRIVS
@@ -82,6 +83,14 @@ struct capabilities {
     unsigned long long ambient;
 };
 
+/* container process resource limit */
+struct resourceLimit {
+    /* resource number (RLIMIT_NOFILE ...) */
+    int resource;
+    unsigned long long soft;
+    unsigned long long hard;
+};
+
 /* container namespaces */
 struct namespace {
     /* namespace flags (CLONE_NEWPID, CLONE_NEWUSER ...) */
@@ -124,6 +133,10 @@ struct privileges {
 
     /* container process capabilities */
     struct capabilities capabilities;
+
+    /* resource limits set before dropping privileges */
+    struct resourceLimit rlimits[MAX_RLIMITS];
+    int numRlimits;
 };
 
 /* container configuration */
@@ -27,6 +27,7 @@
 #include <sys/mount.h>
 #include <sys/wait.h>
 #include <sys/prctl.h>
+#include <sys/resource.h>
 #include <sys/socket.h>
 #include <sys/stat.h>
 #include <sys/statfs.h>
@@ -237,6 +238,7 @@ static void apply_privileges(struct privileges *privileges, struct capabilities
     struct __user_cap_data_struct data[2];
     int last_cap = get_last_cap();
     int caps_index;
+    int i;
 
     /* adjust capabilities based on the lastest capability supported by the system */
     for ( caps_index = last_cap + 1; caps_index <= CAPSET_MAX; caps_index++ ) {
@@ -289,6 +291,19 @@ static void apply_privileges(struct privileges *privileges, struct capabilities
         fatalf("Failed to set securebits: %s\n", strerror(errno));
     }
 
+    /* apply resource limits while hard limits can still be raised */
+    for ( i = 0; i < privileges->numRlimits; i++ ) {
+        struct rlimit limit;
+
+        limit.rlim_cur = (rlim_t)privileges->rlimits[i].soft;
+        limit.rlim_max = (rlim_t)privileges->rlimits[i].hard;
+
+        debugf("Set resource limit %d to %llu/%llu\n", privileges->rlimits[i].resource, privileges->rlimits[i].soft, privileges->rlimits[i].hard);
+        if ( setrlimit(privileges->rlimits[i].resource, &limit) < 0 ) {
+            fatalf("Failed to set resource limit %d: %s\n", privileges->rlimits[i].resource, strerror(errno));
+        }
+    }
+
     /* apply target GID for root user or if setgroups is allowed within user namespace */
     if ( currentUID == 0 || privileges->allowSetgroups ) {
         if ( privileges->numGID >= 1 ) {
@@ -20,6 +20,7 @@ import (
 	"github.com/sylabs/singularity/internal/app/starter"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engine"
 	starterConfig "github.com/sylabs/singularity/internal/pkg/runtime/engine/config/starter"
+	"github.com/sylabs/singularity/internal/pkg/util/env"
 	_ "github.com/sylabs/singularity/internal/pkg/util/goversion"
 	"github.com/sylabs/singularity/internal/pkg/util/mainthread"
 	"github.com/sylabs/singularity/pkg/sylog"
@@ -37,6 +38,13 @@ func getEngine(jsonConfig []byte) *engine.Engine {
 }
 
 func startup() {
+	// the programs executed by the starter with privileges must never
+	// see the dynamic loader variables, the container process gets its
+	// environment from the engine configuration
+	for _, key := range env.UnsetLoader() {
+		sylog.Debugf("Unset %s environment variable: %s", key, env.LoaderKeys[key])
+	}
+
 	// global variable defined in cmd/starter/c/starter.c,
 	// C.sconfig points to a shared memory area
 	csconf := unsafe.Pointer(C.sconfig)
@@ -45,6 +45,92 @@ Enterprise Performance Computing (EPC)`
   container, and then build it as a default Singularity image for production 
   use. The default format is immutable.
 
+  An image path of "-" writes the image to standard output, all other output
+  being written to standard error. It's not supported for sandbox builds.
+
+  When a sandbox build is interrupted (e.g. with Ctrl-C) once its base image
+  is bootstrapped, the partial sandbox is kept with the list of completed
+  phases (bootstrap, %setup, %files, %post). Running the same build with
+  "--update" resumes it from the first phase not completed, a phase which
+  was interrupted runs again. The sandbox is rebuilt from scratch when it
+  was started from another definition or by another Singularity version.
+
+  When a post build hook is configured by the administrator, the image is
+  scanned once built and the scan report is recorded in the image. The build
+  fails if the scan fails, "--skip-scan" skips the scan when allowed by the
+  administrator.
+
+  With "--reproducible", building twice from identical inputs produces
+  bit-identical SIF images: all timestamps are set from SOURCE_DATE_EPOCH,
+  or from the modification time of the definition file when unset, and the
+  image ID is derived from its content. The squashfs directory entries are
+  sorted by name, the SIF data objects are owned by root, and so are the
+  root filesystem files of builds without root privileges. The root
+  filesystem digest is reported so builds can be compared. It requires
+  squashfs-tools 4.4 or later and can't be used with encryption.
+
+  Reproducible builds are not normalized for:
+    - the base image, pin it with a digest (e.g. "From: alpine@sha256:...")
+      rather than a tag
+    - the results of %post commands, such as package installations,
+      downloads, random data (e.g. /etc/machine-id) or recorded dates
+    - the extended attributes (e.g. SELinux labels) of files copied from
+      the host
+    - the squashfs-tools version and compression algorithm
+    - the post build hook report, when configured by the administrator
+    - remote builds, which are never reproducible
+
+  The squashfs block size of SIF images is set with "--blocksize", a power
+  of two from 4K to 1M, in bytes or with a K or M suffix (e.g. "64K"). The
+  mksquashfs default of 128K suits sequential reads. Smaller blocks speed up
+  workloads reading small parts of large files at random, as less data is
+  read and decompressed for each access, at the cost of a lower compression
+  ratio and a larger image. Larger blocks compress better but slow down
+  random reads.
+
+  The %pre, %setup, %post and %test sections run with the "errexit" and
+  "pipefail" shell options: the build fails at the first failing command,
+  including a command failing in a pipeline, and the error reports the
+  definition file line of the command with its exit code. Run with "-v"
+  to show the definition file line of each command executed. The shell
+  options are set with the "ShellOptions" definition header, or overridden
+  with "--shell-options", as a comma separated list of "errexit" and
+  "pipefail", "none" ignoring failing commands. They only apply to the %test
+  section run during the build, not to "singularity test" running the image.
+
+  The %post section runs with /bin/sh, another interpreter is selected with
+  its path after "-c" (e.g. "%post -c /bin/bash") or with a shebang first
+  line (e.g. "#!/bin/bash"). The build fails before running %post when the
+  interpreter is not found in the container. The shell options don't apply
+  to a custom interpreter.
+
+  The OS version bootstrapped by the debootstrap, yum and zypper bootstrap
+  agents is set with the "OSVersion" definition header, or overridden with
+  "--os-version" so that one definition file targets several releases: a
+  suite or codename for debootstrap (e.g. buster), a release version for yum
+  and zypper (e.g. 8 or 15.2). It's substituted to %{OSVERSION} in the
+  "Include" header, and in the "MirrorURL" and "UpdateURL" headers for yum
+  and zypper.
+
+  A host file is exposed to the %post section with "--secret
+  id=<id>,src=<path>" at /run/secrets/<id>, e.g. a token to access a
+  private repository. Secrets are staged on a tmpfs and mounted read-only
+  for %post only, they are neither copied in the image nor recorded in its
+  metadata, unless %post copies them itself. The build fails when /dev/shm
+  is not available, unless "--secrets-on-disk" allows staging them in the
+  temporary directory.
+
+  A definition file is a Go text/template applied to the build arguments
+  set with "--build-arg NAME=VALUE": {{ .NAME }} is replaced by the value
+  of NAME, and lines or whole sections between {{ if .NAME }} and {{ end }}
+  are only kept when NAME is set to a non empty value, so that a single
+  definition file produces several variants of an image. A definition file
+  is only rendered when build arguments are given or when its header
+  declares the arguments it accepts, e.g. "BuildArgs: GPU BASE=alpine",
+  which are empty or set to their default when not given. Referencing an
+  argument neither given nor declared, or giving an undeclared argument,
+  is an error. A literal "{{" is written {{"{{"}}.
+
   BUILD SPEC:
 
   The build spec target is a definition (def) file, local image, or URI that can 
@@ -55,13 +141,25 @@ Enterprise Performance Computing (EPC)`
       directory:  A directory structure containing a (ch)root file system
       image:      A local image on your machine (will convert to sif if
                   it is legacy format)
+      -:          A def file read from standard input
 
   Targets can also be remote and defined by a URI of the following formats:
 
       library://  an image library (default https://cloud.sylabs.io/library)
       docker://   a Docker registry (default Docker Hub)
       shub://     a Singularity registry (default Singularity Hub)
-      oras://     a supporting OCI registry`
+      oras://     a supporting OCI registry
+
+  Base images pulled from a remote source are stored in the image cache and
+  reused by later builds, "--update-base" fetches a fresh copy of the base
+  image from its source instead, all the definition sections then run on
+  top of it. The tag of a docker or oras base image is resolved once to the
+  digest of its current manifest, which is logged and used to fetch it.
+
+  An existing build target is only overwritten with "--force" when it's a
+  Singularity image, a sandbox, an empty directory or a character device like
+  /dev/null, any other file or directory is only overwritten with
+  "--force-unsafe".`
 
 	BuildExample string = `
 
@@ -97,6 +195,7 @@ Enterprise Performance Computing (EPC)`
 
       Scratch:
           Bootstrap: scratch # Populate the container with a minimal rootfs in %setup
+                             # or %files, %post requires a shell copied to /bin/sh
 
   DEFFILE SECTIONS:
 
@@ -130,6 +229,8 @@ Enterprise Performance Computing (EPC)`
       %labels
           HELLO MOTO
           KEY VALUE
+          MULTILINE first line \
+              second line
 
       %files
           /path/on/host/file.txt /path/on/container/file.txt
@@ -155,7 +256,20 @@ Enterprise Performance Computing (EPC)`
       Build a base sandbox from DockerHub, make changes to it, then build sif
           $ singularity build --sandbox /tmp/debian docker://debian:latest
           $ singularity exec --writable /tmp/debian apt-get install python
-          $ singularity build /tmp/debian2.sif /tmp/debian`
+          $ singularity build /tmp/debian2.sif /tmp/debian
+
+      Build the same debootstrap recipe file for two Debian releases:
+          $ singularity build --os-version buster /tmp/buster.sif /path/to/debian.def
+          $ singularity build --os-version bullseye /tmp/bullseye.sif /path/to/debian.def
+
+      Build a sif file whose %post reads a token from /run/secrets/mytoken:
+          $ singularity build --secret id=mytoken,src=$HOME/.token /tmp/debian3.sif /path/to/debian.def
+
+      Build the GPU variant of a definition file with {{ if .GPU }} guards:
+          $ singularity build --build-arg GPU=1 /tmp/debian-gpu.sif /path/to/debian.def
+
+      Build a sif file from a generated recipe and stream it to another node:
+          $ generate-def | singularity build - - | ssh node 'cat > debian.sif'`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// Cache
@@ -163,8 +277,9 @@ Enterprise Performance Computing (EPC)`
 	CacheUse   string = `cache`
 	CacheShort string = `Manage the local cache`
 	CacheLong  string = `
-  Manage your local Singularity cache. You can list/clean using the specific 
-  types.`
+  Manage your local Singularity cache. You can list/clean/verify using the
+  specific types, add local SIF images to it, or export it to an archive
+  imported on another host.`
 	CacheExample string = `
   All group commands have their own help output:
 
@@ -196,7 +311,9 @@ Enterprise Performance Computing (EPC)`
 	CacheListShort string = `List your local Singularity cache`
 	CacheListLong  string = `
   This will list your local cache (stored at $HOME/.singularity/cache if
-  SINGULARITY_CACHEDIR is not set).`
+  SINGULARITY_CACHEDIR is not set). With --verbose, the last time and the
+  number of times each cached image was run are also shown, unless disabled
+  by the administrator.`
 	CacheListExample string = `
   All group commands have their own help output:
 
@@ -204,6 +321,84 @@ Enterprise Performance Computing (EPC)`
   $ singularity help cache list --type=library,oci
   $ singularity cache list --help`
 
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// Cache Add
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	CacheAddUse   string = `add <image path>`
+	CacheAddShort string = `Add a local SIF image to your local Singularity cache`
+	CacheAddLong  string = `
+  This will add a SIF image, built or received out of band, to your local
+  cache (stored at $HOME/.singularity/cache if SINGULARITY_CACHEDIR is not
+  set). The image is stored in the library and oras caches, keyed by its
+  digest, so pulling the same image from a library or an OCI registry uses
+  the cached copy instead of downloading it.`
+	CacheAddExample string = `
+  $ singularity cache add alpine.sif
+  $ singularity pull library://alpine:latest`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// Cache Stats
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	CacheStatsUse   string = `stats`
+	CacheStatsShort string = `Show the usage statistics of the images you run`
+	CacheStatsLong  string = `
+  This will show how many times and when you last ran each image, most run
+  first, followed by a summary. The statistics are recorded locally, in a
+  database per user of the singularity state directory
+  (LOCALSTATEDIR/singularity/usage), for the images of your cache and, if
+  allowed by the 'image usage stats' directive of singularity.conf, for your
+  local image files. They are never sent off the node. With --all, root is
+  shown the statistics of all users together.`
+	CacheStatsExample string = `
+  $ singularity cache stats
+  $ sudo singularity cache stats --all`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// Cache Verify
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	CacheVerifyUse   string = `verify [verify options...]`
+	CacheVerifyShort string = `Verify the integrity of your local Singularity cache`
+	CacheVerifyLong  string = `
+  This will check that the content of each entry of your local cache matches
+  the digest and size recorded in its manifest when it was added, and show
+  the source the entry was created from. Entries created by older versions of
+  Singularity have no manifest yet, one is recorded from their current
+  content the first time they are used or verified.`
+	CacheVerifyExample string = `
+  $ singularity cache verify
+  $ singularity cache verify --type=library,oras`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// Cache Export
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	CacheExportUse   string = `export <archive path>`
+	CacheExportShort string = `Export your local Singularity cache to a tar archive`
+	CacheExportLong  string = `
+  This will write the entries of your local cache, with their manifest, to a
+  tar archive, to seed the cache of a host without network access with
+  'singularity cache import'. Each entry is verified against its manifest
+  first, the export fails if an entry is corrupted. OCI blobs aren't
+  exported, the SIF images and root filesystems built from them are.`
+	CacheExportExample string = `
+  $ singularity cache export cache.tar`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// Cache Import
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	CacheImportUse   string = `import <archive path>`
+	CacheImportShort string = `Import a tar archive into your local Singularity cache`
+	CacheImportLong  string = `
+  This will add the entries of a tar archive written by 'singularity cache
+  export' to your local cache. The digest and size of each entry are verified
+  against its manifest first, and the library, oras, chunk and file entries,
+  named after the digest of their content, must match their name. Nothing is
+  imported if an entry is corrupted, misnamed or has no manifest. The entries
+  of the other types can't be checked against their source, a warning
+  reports them. Entries already in your cache are kept.`
+	CacheImportExample string = `
+  $ singularity cache import cache.tar
+  $ singularity cache verify`
+
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// key
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -328,6 +523,60 @@ Enterprise Performance Computing (EPC)`
 	KeyRemoveExample string = `
   $ singularity key remove D87FE3AF5C1F063FCBCC9B02F812842B5EEE5934`
 
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// key generate-pem
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	KeyGeneratePEMUse   string = `generate-pem [generate-pem options...] <private key> [public key]`
+	KeyGeneratePEMShort string = `Create an RSA key pair to encrypt images`
+	KeyGeneratePEMLong  string = `
+  The 'key generate-pem' command creates an RSA key pair in PEM files, the
+  public key encrypts images with 'build --pem-path' and the private key
+  decrypts them with 'run --pem-path'. The private key isn't protected by
+  a passphrase, it's only readable by its owner. The public key is written
+  next to the private key with a .pub extension, unless its path is set.`
+	KeyGeneratePEMExample string = `
+  $ singularity key generate-pem ~/.singularity/image.pem
+  $ singularity build --pem-path ~/.singularity/image.pub image.sif image.def
+  $ singularity run --pem-path ~/.singularity/image.pem image.sif`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// crypt
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	CryptUse   string = `crypt`
+	CryptShort string = `Manage the keys of encrypted images`
+	CryptLong  string = `
+  The 'crypt' command manages the keys of images encrypted with a PEM key
+  or a passphrase.`
+	CryptExample string = `
+  All group commands have their own help output:
+
+  $ singularity help crypt rekey
+  $ singularity crypt rekey --help`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// crypt rekey
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	CryptRekeyUse   string = `rekey [rekey options...] <image path>`
+	CryptRekeyShort string = `Replace the key of an encrypted image`
+	CryptRekeyLong  string = `
+  The 'crypt rekey' command replaces the key of an encrypted SIF image,
+  without decrypting and encrypting its partition again. The old key is a
+  PEM private key set with --old-pem or a passphrase, the new key is a PEM
+  public key set with --new-pem or a passphrase. Passphrases are prompted
+  for with --old-passphrase and --new-passphrase, or read from the
+  SINGULARITY_OLD_ENCRYPTION_PASSPHRASE and
+  SINGULARITY_NEW_ENCRYPTION_PASSPHRASE environment variables.
+
+  With --keep-old, the new key is added and both keys decrypt the image,
+  to migrate its users to the new key, the old key is removed by a later
+  rekey. The image is only replaced once the new key was checked by
+  mounting its partition, the signatures of the partition must be created
+  again. This command requires root privileges.`
+	CryptRekeyExample string = `
+  $ sudo singularity crypt rekey --old-pem old.pem --new-pem new.pub image.sif
+  $ sudo singularity crypt rekey --keep-old --old-pem old.pem --new-pem new.pub image.sif
+  $ sudo singularity crypt rekey --old-passphrase --new-passphrase image.sif`
+
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// delete
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -451,6 +700,10 @@ Enterprise Performance Computing (EPC)`
   directory/          sandbox format. Directory containing a valid root file 
                       system and optionally Singularity meta-data.
 
+  /dev/*              block device (e.g. an LVM volume) holding a squashfs or
+                      ext4 root file system, mounted read-only unless
+                      --writable is set. Requires a setuid installation.
+
   instance://*        A local running instance of a container. (See the instance
                       command group.)
 
@@ -465,14 +718,36 @@ Enterprise Performance Computing (EPC)`
 	ExecUse   string = `exec [exec options...] <container> <command>`
 	ExecShort string = `Run a command within a container`
 	ExecLong  string = `
+  The command runs in a pseudo terminal when the standard input, output and
+  error are all terminals, --pty allocates one in all cases and --no-pty
+  never does. In a pseudo terminal the standard output and error of the
+  command are both written to the standard output, a standard input which
+  isn't a terminal is kept as the standard input of the command so piped
+  data is read unchanged.
+
+  With --rootfs-ro-check the digest of the image is compared before and
+  after the command, the command fails if the image was modified, or was
+  mounted writable with --writable. Otherwise it exits with the exit code
+  of the command.
+
+  With --security nofilecaps the setuid bits and file capabilities of the
+  binaries in the container are ignored, the container is mounted nosuid
+  even with --allow-setuid and the command runs with no new privileges, to
+  run untrusted images safely.
+
   singularity exec supports the following formats:` + formats
 	ExecExamples string = `
   $ singularity exec /tmp/debian.sif cat /etc/debian_version
   $ singularity exec /tmp/debian.sif python ./hello_world.py
   $ cat hello_world.py | singularity exec /tmp/debian.sif python
+  $ echo data | singularity exec --pty /tmp/debian.sif ./needs-a-tty
   $ sudo singularity exec --writable /tmp/debian.sif apt-get update
   $ singularity exec instance://my_instance ps -ef
-  $ singularity exec library://centos cat /etc/os-release`
+  $ singularity exec library://centos cat /etc/os-release
+  $ singularity exec --security landlock:ro=/,rw=/tmp /tmp/debian.sif ./untrusted
+  $ sudo singularity exec --security nofilecaps /tmp/debian.sif ./untrusted
+  $ singularity exec --timeout 30m --max-output 1048576 /tmp/debian.sif ./ci-step
+  $ singularity exec --rootfs-ro-check /tmp/debian.sif ./compliance-step`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// instance
@@ -488,6 +763,80 @@ Enterprise Performance Computing (EPC)`
   $ singularity help instance start
   $ singularity instance start --help`
 
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// instance exec
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	InstanceExecUse   string = `exec [exec options...] <instance name> [--] <command> [args...]`
+	InstanceExecShort string = `Run a command within a running instance`
+	InstanceExecLong  string = `
+  The instance exec command allows you to execute a command within the
+  namespaces of a running instance, like 'singularity exec instance://<name>'.
+  The exit code of the command is returned.
+
+  By default the command runs in a pseudo terminal when the standard streams
+  are all terminals, like with exec. --tty always allocates a pseudo terminal
+  for interactive commands while --no-tty executes the command detached from
+  the terminal with its standard input read from /dev/null.
+
+  Only root can execute a command in an instance belonging to another user,
+  with --user, other users get a permission denied error.`
+	InstanceExecExample string = `
+  $ singularity instance start /tmp/my-sql.sif mysql
+  $ singularity instance exec mysql -- ps -ef
+  $ singularity instance exec --tty mysql -- mysql -u root
+  $ sudo singularity instance exec --user mibauer mysql -- cat /etc/os-release`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// instance generate-unit
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	InstanceGenerateUnitUse   string = `generate-unit [generate-unit options...] <instance name>`
+	InstanceGenerateUnitShort string = `Generate a systemd unit starting a running instance`
+	InstanceGenerateUnitLong  string = `
+  The instance generate-unit command prints a systemd service unit starting
+  and stopping a running instance with the options it was started with. The
+  image, startscript arguments and flags are saved to an options file read by
+  the unit with 'instance start --options-file', the options can be changed
+  in this file without updating the unit. 'instance start --systemd' prints
+  the unit of an instance without starting it.
+
+  With --scope user, the default for other users than root, the options file
+  is saved in ~/.singularity/instance-options and the unit is installed in
+  ~/.config/systemd/user. With --scope system, the default for root, the
+  options file is saved in the instance-options directory of the Singularity
+  configuration directory and the unit is installed in /etc/systemd/system.
+
+  The instance is restarted by systemd according to --restart, on failure by
+  default, after --restart-sec seconds. An instance started with --net and a
+  network other than none is ordered after the host network is online.`
+	InstanceGenerateUnitExample string = `
+  $ sudo singularity instance start --net --network bridge /tmp/nginx.sif web
+  $ sudo singularity instance generate-unit web > /etc/systemd/system/singularity-instance-web.service
+  $ sudo systemctl enable --now singularity-instance-web
+
+  $ singularity instance start --systemd --restart always /tmp/my-sql.sif mysql \
+      > ~/.config/systemd/user/singularity-instance-mysql.service
+  $ systemctl --user enable --now singularity-instance-mysql`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// instance info
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	InstanceInfoUse   string = `info [info options...] <instance name>`
+	InstanceInfoShort string = `Show the details and namespaces of a running instance`
+	InstanceInfoLong  string = `
+  The instance info command shows the details of a running instance along with
+  the paths of its namespaces in /proc, so host tools like nsenter can join the
+  instance mount namespace directly.
+
+  With --ns-paths only the nsenter options joining the instance namespaces are
+  printed, one per line, while --json prints all details in JSON format.
+
+  Only root can show an instance belonging to another user, with --user.`
+	InstanceInfoExample string = `
+  $ singularity instance start /tmp/my-sql.sif mysql
+  $ singularity instance info mysql
+  $ singularity instance info --json mysql
+  $ sudo nsenter $(singularity instance info --ns-paths mysql) ps -ef`
+
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// instance list
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -525,6 +874,12 @@ Enterprise Performance Computing (EPC)`
   will be executed with the instance start command as well. You can optionally
   pass arguments to startscript
 
+  With --systemd the instance isn't started, a systemd unit starting it with
+  the given options is printed instead, see 'singularity help instance
+  generate-unit'. With --options-file only the instance name is given, the
+  image, startscript arguments and flags are read from the options file saved
+  for the unit, flags given on the command line take precedence.
+
   singularity instance start accepts the following container formats` + formats
 	InstanceStartExample string = `
   $ singularity instance start /tmp/my-sql.sif mysql
@@ -589,11 +944,69 @@ Enterprise Performance Computing (EPC)`
       oras://registry/namespace/image:tag
 
   http, https: Pull an image using the http(s?) protocol
-      https://library.sylabs.io/v1/imagefile/library/default/alpine:latest`
+      https://library.sylabs.io/v1/imagefile/library/default/alpine:latest
+
+  file: Copy a local SIF image through the cache, optionally checking its
+  sha256 digest
+      file:///path/to/image.sif[@sha256:<digest>]
+
+  s3, gs: Pull an image from an Amazon S3 (or S3 compatible) or a Google
+  Cloud Storage bucket
+      s3://bucket/path/to/image.sif
+      gs://bucket/path/to/image.sif
+
+  The s3 and gs pulls use the ambient credentials: the AWS_ACCESS_KEY_ID and
+  AWS_SECRET_ACCESS_KEY environment variables or the AWS shared credentials
+  file for s3, and the GOOGLE_OAUTH_ACCESS_TOKEN or
+  GOOGLE_APPLICATION_CREDENTIALS environment variables or the gcloud
+  application default credentials for gs. The AWS_ENDPOINT_URL and
+  STORAGE_EMULATOR_HOST environment variables override the endpoints. The
+  image is verified against the sha256 digest stored in its 'sha256' object
+  metadata when set. A 'Buckets' entry of the remote configuration sets, for
+  a Scheme (s3 or gs) and an optional Bucket, the Endpoint (e.g. of a MinIO
+  server), Region, CredentialsFile and Profile, and where the digest is read
+  from: the ChecksumKey metadata key, or the object with the key of the image
+  followed by ChecksumSuffix (e.g. .sha256). 'Anonymous: true' sends
+  unauthenticated requests to a public bucket, and 'InstanceMetadata: true'
+  also looks up the credentials of the EC2 instance role or of the GCE
+  service account from the instance metadata service.
+
+  Without an output file or --name/-o, the image file name is derived from the
+  URI: the registry and repository path, the tag (latest by default) and the
+  digest are joined by '_' with the .sif extension. The default registry and
+  namespace are omitted (docker.io and library/ for docker, library/default/
+  for library), and characters other than letters, digits, '.', '_' and '-'
+  are replaced by '_'. For example docker://godlovedc/lolcow:3.7 is pulled to
+  godlovedc_lolcow_3.7.sif and oras://ghcr.io/user/image:1.0 to
+  ghcr.io_user_image_1.0.sif. For http(s) the image file name is the last
+  element of the URL path, for file it is the base name of the image path and
+  for s3 and gs the base name of the object key.
+
+  An existing image file is only overwritten with --force. The URI an image
+  was pulled from is recorded in an extended attribute of the image file when
+  the filesystem supports it, if a different URI maps to the same image file
+  name, the pull fails and the image file name must be set.
+
+  With --update, an existing image file is only replaced if the image changed
+  since it was pulled, for library, oras and OCI (e.g. docker) images. The
+  current digest of the image is read from the library API or the registry
+  manifest and compared with the digest of the image file, for library and
+  oras images, or with the manifest digest recorded in the SIF metadata of an
+  image built from an OCI image. An up to date image file is left untouched,
+  otherwise the image is downloaded to a temporary file which replaces the
+  image file once complete. With --check-only, pull only reports if an update
+  is available: it prints 'up-to-date' and exits with status 0, or prints
+  'update-available' and exits with status 100.`
 	PullExample string = `
   From Sylabs cloud library
   $ singularity pull alpine.sif library://alpine:latest
 
+  With the image file name derived from the URI (godlovedc_lolcow_latest.sif)
+  $ singularity pull docker://godlovedc/lolcow
+
+  With the image file name set by option
+  $ singularity pull -o lolcow.sif docker://godlovedc/lolcow
+
   From Docker
   $ singularity pull tensorflow.sif docker://tensorflow/tensorflow:latest
 
@@ -601,7 +1014,17 @@ Enterprise Performance Computing (EPC)`
   $ singularity pull singularity-images.sif shub://vsoch/singularity-images
 
   From supporting OCI registry (e.g. Azure Container Registry)
-  $ singularity pull image.sif oras://<username>.azurecr.io/namespace/image:tag`
+  $ singularity pull image.sif oras://<username>.azurecr.io/namespace/image:tag
+
+  From a local SIF image with an expected digest
+  $ singularity pull alpine.sif file:///tmp/alpine.sif@sha256:<digest>
+
+  From an S3 compatible store
+  $ AWS_ENDPOINT_URL=https://minio.example.com:9000 singularity pull s3://images/alpine.sif
+
+  Replace alpine.sif only if the image changed, or only check it
+  $ singularity pull --update alpine.sif library://alpine:latest
+  $ singularity pull --update --check-only alpine.sif library://alpine:latest`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// push
@@ -621,7 +1044,11 @@ Enterprise Performance Computing (EPC)`
 
   NOTE: It's always good practice to sign your containers before
   pushing them to the library. An auth token is required to push to the library,
-  so you may need to configure it first with 'singularity remote'.`
+  so you may need to configure it first with 'singularity remote'.
+
+  Images larger than the part size (--part-size) are uploaded to the library
+  in parts when the library supports it. If the upload is interrupted, running
+  the same push command again resumes it where it left off.`
 	PushExample string = `
   To Library
   $ singularity push /home/user/my.sif library://user/collection/my.sif:latest
@@ -674,6 +1101,14 @@ Enterprise Performance Computing (EPC)`
 	ShellUse   string = `shell [shell options...] <container>`
 	ShellShort string = `Run a shell within a container`
 	ShellLong  string = `
+  The history of the interactive shell is recorded in a file per image in
+  ~/.singularity/shell_history instead of the history file of the host when
+  the home directory is mounted in the container, --history-file selects
+  another file. With --norc the shell doesn't read its startup files.
+
+  Like exec, the shell runs in a pseudo terminal when the standard streams
+  are all terminals, or with --pty, unless --no-pty is set.
+
   singularity shell supports the following formats:` + formats
 	ShellExamples string = `
   $ singularity shell /tmp/Debian.sif
@@ -691,6 +1126,8 @@ Enterprise Performance Computing (EPC)`
   $ sudo singularity shell -w /tmp/Debian.sif
   $ sudo singularity shell --writable /tmp/Debian.sif
 
+  $ singularity shell --norc --history-file none /tmp/Debian.sif
+
   $ singularity shell instance://my_instance
 
   $ singularity shell instance://my_instance
@@ -710,10 +1147,17 @@ Enterprise Performance Computing (EPC)`
   The sign command allows a user to add one or more digital signatures to a SIF
   image. By default, one digital signature is added for each object group in
   the file.
+
+  Signatures use the SHA-256 hash algorithm by default, --hash selects SHA-384
+  or SHA-512 instead. The algorithm is recorded in the signature, and detected
+  by verify.
   
   To generate a keypair, see 'singularity help key newpair'`
 	SignExample string = `
-  $ singularity sign container.sif`
+  $ singularity sign container.sif
+
+  Sign an image using the SHA-512 hash algorithm:
+  $ singularity sign --hash sha512 container.sif`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// verify
@@ -726,9 +1170,54 @@ Enterprise Performance Computing (EPC)`
   multiple data objects signed. By default the command searches for the primary 
   partition signature. If found, a list of all verification blocks applied on 
   the primary partition is gathered so that data integrity (hashing) and 
-  signature verification is done for all those blocks.`
+  signature verification is done for all those blocks.
+
+  Keys which aren't in the local keyring are retrieved from the key server.
+  With --key-cache-ttl, they are cached, apart from the local keyring as their
+  trust isn't verified, for the given duration. Use --refresh-keys to retrieve
+  them again. If the key server can't be reached to retrieve an expired cached
+  key again, it's used with a warning, unless --strict-key-freshness is set.
+
+  Keyless signatures, made with a short lived certificate bound to an OIDC
+  identity and recorded in a transparency log, are verified instead when any
+  keyless option is set, --certificate-identity-regexp and
+  --certificate-oidc-issuer are then required. The identity regular expression
+  is unanchored, it must start with ^ and end with $ to match a whole email or
+  URI. The signing certificate chain, its embedded certificate transparency
+  timestamp and the transparency log entry are checked offline against the
+  provided trusted material. A keyless signature signs the SHA256 digest of the
+  objects of a group, in object ID order, each preceded by its length as a
+  big-endian 64-bit integer.
+
+  With --sandbox, a sandbox directory built or extracted from a signed SIF
+  image is verified instead. The image recorded in the sandbox must still be
+  available: the signatures of its root filesystem partition are verified,
+  then the content of the sandbox is compared to the signed partition,
+  ignoring modification times, and the changed paths are listed. The file
+  ownership is compared only when both the extraction and the verification
+  run as root. The definition, labels and build history written by the build
+  in .singularity.d are not compared.
+
+  When the 'Freshness' metadata source of the active remote endpoint is set
+  in remote.yaml, the verified image must also be the latest signed version
+  listed by TUF-style targets metadata. The timestamp, snapshot and targets
+  metadata are verified with the keys of the trusted root metadata, and
+  expired metadata or metadata older than the last trusted version are
+  rejected, detecting the rollback to an older signed image. The root keys
+  are rotated by the newer root metadata versions N.root.json of the source,
+  each signed by the keys of both the previous and the new version.`
 	VerifyExample string = `
-  $ singularity verify container.sif`
+  $ singularity verify container.sif
+
+  Verify a sandbox built from a signed image:
+  $ singularity build --sandbox container/ container.sif
+  $ singularity verify --sandbox container/
+
+  Verify a keyless (sigstore) signature made by a given OIDC identity:
+  $ singularity verify --certificate-identity-regexp '^jane@example\.com$' \
+      --certificate-oidc-issuer https://accounts.example.com \
+      --certificate-chain fulcio.pem --ctlog-public-key ctlog.pub \
+      --rekor-public-key rekor.pub container.sif`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// Run-help
@@ -738,7 +1227,10 @@ Enterprise Performance Computing (EPC)`
 	RunHelpLong  string = `
   The help text is from the '%help' section of the definition file. If you are 
   using the '--apps' option, the help text is instead from that app's '%apphelp' 
-  section.`
+  section.
+
+  A definition file can also be given instead of an image, its help text is
+  then shown without building the image.`
 	RunHelpExample string = `
   $ cat my_container.def
   Bootstrap: docker
@@ -761,7 +1253,65 @@ Enterprise Performance Computing (EPC)`
 
   $ singularity run-help --app foo my_container.sif
 
-    Some help for application in this container`
+    Some help for application in this container
+
+  $ singularity run-help my_container.def
+
+    Some help for this container`
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// Scan
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	ScanUse   string = `scan <image path>`
+	ScanShort string = `Scan an image with the post build hook`
+	ScanLong  string = `
+  The scan command runs the post build hook configured by the administrator
+  in singularity.conf ("post build hook") against a SIF or sandbox image, and
+  prints its output. The hook receives the image path and the path of a JSON
+  file describing the image, and runs unprivileged. The command fails if the
+  hook exits with a non-zero status or doesn't complete within the configured
+  timeout ("post build hook timeout").
+
+  The same hook runs after every build, its output is then recorded in the
+  image as a scan report, shown by 'singularity inspect --scan-report'.`
+	ScanExample string = `
+  $ singularity scan my_container.sif`
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// Doctor
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	DoctorUse   string = `doctor [doctor options...]`
+	DoctorShort string = `Check the host features used by Singularity`
+	DoctorLong  string = `
+  The doctor command probes the host features the runtime can use and
+  prints whether each of them is available, with a remediation hint for
+  the unavailable ones:
+
+    starter*    starter binaries installed with Singularity
+    setuid      setuid starter owned by root, allowed in singularity.conf
+                and not on a nosuid mount
+    userns      unprivileged user namespaces
+    overlay     overlay filesystem, for the container overlays
+    squashfs    squashfs filesystem, to mount SIF images
+    loop        loop devices, to mount SIF and ext3 images
+    fuse        /dev/fuse, for FUSE mounts
+    cgroups     cgroups, delegated to the user with cgroup v2, to apply
+                resource limits
+    seccomp     seccomp support of Singularity and of the kernel
+    mksquashfs  mksquashfs, to build SIF images
+    smoke*      a smoke test executing a tiny program from a minimal SIF
+                image generated by Singularity, which validates the whole
+                path of running a container, or from a sandbox image when
+                squashfs images are disallowed by the configuration
+
+  The command fails only when a core feature, marked with a star, is
+  unavailable: containers can't run on the host. With "--feature", only the
+  given features are probed and the command fails if one of them is
+  unavailable, which allows scripts to check the features they need.`
+	DoctorExample string = `
+  $ singularity doctor
+
+  $ singularity doctor --json
+
+  $ singularity doctor --feature overlay,userns`
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// Inspect
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -771,6 +1321,26 @@ Enterprise Performance Computing (EPC)`
   Inspect will show you labels, environment variables, apps and scripts associated 
   with the image determined by the flags you pass. By default, they will be shown in 
   plain text. If you would like to list them in json format, you should use the --json flag.
+
+  SIF images built by Singularity embed these metadata. Other images are run once
+  to gather them, and they are cached, so the next inspections of the unchanged
+  image are fast. The cached metadata are removed by 'singularity cache clean'.
+
+  A definition file can also be inspected instead of an image. The metadata of
+  the image it would build are shown, in the same format, without building the
+  image, so they can be compared with those of a built image. The last stage of
+  a multi-stage definition is inspected, and the sections are shown as they are
+  written in the definition. The build date label and the metadata added by the
+  bootstrap agent, like the environment of a Docker image, are not shown. A file
+  which isn't an image is inspected as a definition file. With the --definition
+  flag, the file is always inspected as a definition file, all the sections of
+  the would-be image are shown unless some are selected, and --build-arg values
+  are applied to the definition file.
+
+  The --special-files flag shows the setuid, setgid and world-writable files of
+  the image, which are recorded when the image is built. For squashfs images
+  built without recording them, they are read from the listing of the image
+  filesystem, without extracting it.
   `
 	InspectExample string = `
   $ singularity inspect ubuntu.sif
@@ -820,7 +1390,16 @@ Enterprise Performance Computing (EPC)`
 
   To verify you own a single application on your container image, use the --app <appname> flag:
 
-  $ singularity inspect --app <appname> ubuntu.sif`
+  $ singularity inspect --app <appname> ubuntu.sif
+
+  To show the runscript an image built from a definition file would have, and
+  compare the metadata of the definition with the built image:
+
+  $ singularity inspect --runscript ubuntu.def
+
+  $ singularity inspect --definition --build-arg VERSION=20.04 ubuntu.def
+
+  $ diff <(singularity inspect --all ubuntu.def) <(singularity inspect --all ubuntu.sif)`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// Test
@@ -990,11 +1569,14 @@ Enterprise Performance Computing (EPC)`
   $ singularity help config fakeroot
   $ singularity config fakeroot --help`
 
-	ConfigFakerootUse   string = `fakeroot <option> <user>`
+	ConfigFakerootUse   string = `fakeroot <option> [user]`
 	ConfigFakerootShort string = `Manage fakeroot user mappings entries (root user only)`
 	ConfigFakerootLong  string = `
   The config fakeroot command allow a root user to add/remove/enable/disable fakeroot
-  user mappings.`
+  user mappings and to list them. When the getsubids command is installed, the
+  subordinate ranges it reports, which may come from a directory service through
+  the subid plugins of nsswitch.conf, are used first and the /etc/subuid and
+  /etc/subgid files are only read for users without a range large enough.`
 	ConfigFakerootExample string = `
   To add a fakeroot user mapping for vagrant user:
   $ singularity config fakeroot --add vagrant
@@ -1006,7 +1588,10 @@ Enterprise Performance Computing (EPC)`
   $ singularity config fakeroot --disable vagrant
 
   To enable a fakeroot user mapping for vagrant user:
-  $ singularity config fakeroot --enable vagrant`
+  $ singularity config fakeroot --enable vagrant
+
+  To list the fakeroot user mappings and where they come from:
+  $ singularity config fakeroot --list`
 
 	ConfigGlobalUse   string = `global <option> <directive> [value,...]`
 	ConfigGlobalShort string = `Edit singularity.conf from command line (root user only or unprivileged installation)`
@@ -0,0 +1,63 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package docs
+
+// Global content for help and man pages
+const (
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// keyserver command
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	KeyserverUse   string = `keyserver [subcommand options...]`
+	KeyserverShort string = `Manage the keyservers of the active remote endpoint`
+	KeyserverLong  string = `
+  The 'keyserver' commands allow you to manage the keyservers of the active remote
+  endpoint. Keyservers are queried in order for key verification and search, the
+  results of all keyservers are aggregated. Keys are pushed to the first keyserver
+  which is not verify only, or to all of them with 'key push --all'.`
+	KeyserverExample string = `
+  All group commands have their own help output:
+
+  $ singularity help keyserver add
+  $ singularity keyserver list`
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// keyserver add command
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	KeyserverAddUse   string = `add [add options...] <keyserver_url>`
+	KeyserverAddShort string = `Add a keyserver to the active remote endpoint (root user only)`
+	KeyserverAddLong  string = `
+  The 'keyserver add' command adds a keyserver to the active remote endpoint. The
+  --order option sets the position of the keyserver in the list of keyservers,
+  '--order 1' makes it the primary keyserver. A keyserver added with --verify-only
+  is used for key verification and search but keys are never pushed to it.`
+	KeyserverAddExample string = `
+  $ singularity keyserver add https://keys.example.com
+
+  To add a keyserver used as the primary keyserver
+  $ singularity keyserver add --order 1 https://keys.example.com
+
+  To add a keyserver used only to verify signatures
+  $ singularity keyserver add --verify-only https://keys.example.com`
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// keyserver remove command
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	KeyserverRemoveUse   string = `remove <keyserver_url>`
+	KeyserverRemoveShort string = `Remove a keyserver from the active remote endpoint (root user only)`
+	KeyserverRemoveLong  string = `
+  The 'keyserver remove' command removes a keyserver from the active remote endpoint.`
+	KeyserverRemoveExample string = `
+  $ singularity keyserver remove https://keys.example.com`
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// keyserver list command
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	KeyserverListUse   string = `list`
+	KeyserverListShort string = `List the keyservers of the active remote endpoint`
+	KeyserverListLong  string = `
+  The 'keyserver list' command lists the keyservers of the active remote endpoint
+  in the order they are queried, with their authentication status and the key
+  operations they are used for.`
+	KeyserverListExample string = `
+  $ singularity keyserver list`
+)
@@ -7,13 +7,19 @@ package actions
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -24,6 +30,7 @@ import (
 	"github.com/sylabs/singularity/internal/pkg/test/tool/exec"
 	"github.com/sylabs/singularity/internal/pkg/test/tool/require"
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/pkg/util/gpu"
 )
 
 type actionTests struct {
@@ -149,6 +156,21 @@ func (c actionTests) actionExec(t *testing.T) {
 			argv: []string{"--app", "fakeapp", c.env.ImagePath, "testapp.sh"},
 			exit: 1,
 		},
+		{
+			name: "ScifTestAppPath",
+			argv: []string{"--app", "testapp", c.env.ImagePath, "sh", "-c", `test "$(command -v testapp.sh)" = /scif/apps/testapp/bin/testapp.sh`},
+			exit: 0,
+		},
+		{
+			name: "ScifTestAppLibPath",
+			argv: []string{"--app", "testapp", c.env.ImagePath, "sh", "-c", `case ":$LD_LIBRARY_PATH:" in *:/scif/apps/testapp/lib:*) ;; *) exit 1 ;; esac`},
+			exit: 0,
+		},
+		{
+			name: "ScifTestAppVars",
+			argv: []string{"--app", "testapp", c.env.ImagePath, "sh", "-c", `test "$SCIF_APPNAME" = testapp -a "$SCIF_APPROOT" = /scif/apps/testapp -a "$SCIF_APPDATA" = /scif/data/testapp`},
+			exit: 0,
+		},
 		{
 			name: "ScifTestfolderOrg",
 			argv: []string{c.env.ImagePath, "test", "-d", "/scif"},
@@ -316,6 +338,46 @@ func (c actionTests) actionShell(t *testing.T) {
 			},
 			exit: 127,
 		},
+		{
+			name: "ShellScifTestApp",
+			argv: []string{"--app", "testapp", c.env.ImagePath},
+			consoleOps: []e2e.SingularityConsoleOp{
+				e2e.ConsoleSendLine("command -v testapp.sh"),
+				e2e.ConsoleExpect("/scif/apps/testapp/bin/testapp.sh"),
+				e2e.ConsoleSendLine("exit"),
+			},
+			exit: 0,
+		},
+		{
+			name: "ShellHistoryPerImage",
+			argv: []string{c.env.ImagePath},
+			consoleOps: []e2e.SingularityConsoleOp{
+				e2e.ConsoleSendLine("echo HISTFILE=$HISTFILE"),
+				e2e.ConsoleExpect("HISTFILE=" + filepath.Join(e2e.CurrentUser(t).Dir, ".singularity", "shell_history") + "/"),
+				e2e.ConsoleSendLine("exit"),
+			},
+			exit: 0,
+		},
+		{
+			name: "ShellHistoryNone",
+			argv: []string{"--history-file", "none", c.env.ImagePath},
+			consoleOps: []e2e.SingularityConsoleOp{
+				e2e.ConsoleSendLine("echo HISTFILE=$HISTFILE"),
+				e2e.ConsoleExpect("HISTFILE=/dev/null"),
+				e2e.ConsoleSendLine("exit"),
+			},
+			exit: 0,
+		},
+		{
+			name: "ShellNoRC",
+			argv: []string{"--norc", "--shell", "/bin/sh", c.env.ImagePath},
+			consoleOps: []e2e.SingularityConsoleOp{
+				e2e.ConsoleSendLine("echo ENV=${ENV:-unset} NORC=${SINGULARITY_SHELL_NORC:-unset}"),
+				e2e.ConsoleExpect("ENV=unset NORC=unset"),
+				e2e.ConsoleSendLine("exit"),
+			},
+			exit: 0,
+		},
 	}
 
 	for _, tt := range tests {
@@ -325,10 +387,24 @@ func (c actionTests) actionShell(t *testing.T) {
 			e2e.WithProfile(e2e.UserProfile),
 			e2e.WithCommand("shell"),
 			e2e.WithArgs(tt.argv...),
+			e2e.WithEnv(append(os.Environ(), "ENV=/etc/profile")),
 			e2e.ConsoleRun(tt.consoleOps...),
 			e2e.ExpectExit(tt.exit),
 		)
 	}
+
+	// the shell settings don't apply to the other actions
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("ExecNoShellHistory"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs(c.env.ImagePath, "/bin/sh", "-c", "echo HISTFILE=${HISTFILE:-unset}"),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.UnwantedMatch, "shell_history"),
+		),
+	)
 }
 
 // STDPipe tests pipe stdin/stdout to singularity actions cmd
@@ -442,6 +518,33 @@ func (c actionTests) STDPipe(t *testing.T) {
 			output:  "/etc",
 			exit:    0,
 		},
+		{
+			name:    "CwdPath",
+			command: "exec",
+			argv:    []string{"--cwd", "/etc", c.env.ImagePath, "pwd"},
+			output:  "/etc",
+			exit:    0,
+		},
+		{
+			name:    "CwdRelativePath",
+			command: "exec",
+			argv:    []string{"--contain", "--cwd", "..", c.env.ImagePath, "pwd"},
+			output:  filepath.Dir(user.Dir),
+			exit:    0,
+		},
+		{
+			name:    "CwdMissing",
+			command: "exec",
+			argv:    []string{"--cwd", "/doesnotexist", c.env.ImagePath, "pwd"},
+			output:  user.Dir,
+			exit:    0,
+		},
+		{
+			name:    "CwdNotDirectory",
+			command: "exec",
+			argv:    []string{"--cwd", "/etc/passwd", c.env.ImagePath, "pwd"},
+			exit:    255,
+		},
 		{
 			name:    "Arguments",
 			command: "run",
@@ -1492,6 +1595,16 @@ func (c actionTests) actionBinds(t *testing.T) {
 func (c actionTests) exitSignals(t *testing.T) {
 	e2e.EnsureImage(t, c.env)
 
+	// forwardSignal sends SIGTERM to the singularity process, the parent
+	// of the command or of its supervising process, which forwards it
+	forwardSignal := `trap 'kill $child; exit 7' TERM
+p=$PPID
+grep -q "Singularity runtime parent" /proc/$p/cmdline || p=$(cut -d' ' -f4 /proc/$p/stat)
+sleep 30 >/dev/null 2>&1 &
+child=$!
+kill -TERM $p
+wait`
+
 	tests := []struct {
 		name string
 		args []string
@@ -1522,18 +1635,55 @@ func (c actionTests) exitSignals(t *testing.T) {
 			args: []string{c.env.ImagePath, "/bin/sh", "-c", "kill -ABRT $$"},
 			exit: 134,
 		},
+		{
+			name: "SignalForward",
+			args: []string{c.env.ImagePath, "/bin/sh", "-c", forwardSignal},
+			exit: 7,
+		},
 	}
 
-	for _, tt := range tests {
-		c.env.RunSingularity(
-			t,
-			e2e.AsSubtest(tt.name),
-			e2e.WithProfile(e2e.UserProfile),
-			e2e.WithCommand("exec"),
-			e2e.WithArgs(tt.args...),
-			e2e.ExpectExit(tt.exit),
-		)
+	// exit codes and signals are propagated whether the command is a
+	// direct child of the singularity process or has a supervising process
+	modes := []struct {
+		name string
+		args []string
+	}{
+		{name: "Default"},
+		{name: "NoFork", args: []string{"--no-fork"}},
+		{name: "Supervised", args: []string{"--timeout", "1h"}},
 	}
+
+	for _, m := range modes {
+		for _, tt := range tests {
+			c.env.RunSingularity(
+				t,
+				e2e.AsSubtest(m.name+tt.name),
+				e2e.WithProfile(e2e.UserProfile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs(append(append([]string{}, m.args...), tt.args...)...),
+				e2e.ExpectExit(tt.exit),
+			)
+		}
+	}
+
+	// with --no-fork the command is a direct child of the singularity
+	// process, options requiring a supervising process are refused
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("NoForkParent"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("--no-fork", c.env.ImagePath, "/bin/sh", "-c", `grep -q "Singularity runtime parent" /proc/$PPID/cmdline`),
+		e2e.ExpectExit(0),
+	)
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("NoForkTimeout"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("--no-fork", "--timeout", "1h", c.env.ImagePath, "true"),
+		e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, "--no-fork and --timeout are mutually exclusive")),
+	)
 }
 
 func (c actionTests) fuseMount(t *testing.T) {
@@ -2040,40 +2190,2139 @@ func (c actionTests) bindImage(t *testing.T) {
 	}
 }
 
-// actionUmask tests that the within-container umask is correct in action flows
-func (c actionTests) actionUmask(t *testing.T) {
+// bindFileOverFile tests that a host file can be bound over an existing
+// file of a read-only image without requiring an overlay or underlay layer.
+func (c actionTests) bindFileOverFile(t *testing.T) {
 	e2e.EnsureImage(t, c.env)
 
-	u := e2e.UserProfile.HostUser(t)
+	const (
+		contFile    = "/etc/motd"
+		fileContent = "file over file bind"
+	)
 
-	// Set umask for tests to 0000
-	oldUmask := syscall.Umask(0)
-	defer syscall.Umask(oldUmask)
+	hostDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "bind-file-", "")
+	defer cleanup(t)
+
+	hostFile := filepath.Join(hostDir, "motd")
+	if err := ioutil.WriteFile(hostFile, []byte(fileContent), 0644); err != nil {
+		t.Fatalf("failed to create %s: %s", hostFile, err)
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		exit   int
+		output string
+	}{
+		{
+			name:   "FileOverFile",
+			args:   []string{"--bind", hostFile + ":" + contFile, c.env.ImagePath, "cat", contFile},
+			exit:   0,
+			output: fileContent,
+		},
+		{
+			name:   "FileOverFileReadOnly",
+			args:   []string{"--bind", hostFile + ":" + contFile + ":ro", c.env.ImagePath, "cat", contFile},
+			exit:   0,
+			output: fileContent,
+		},
+		{
+			name: "FileOverDirectory",
+			args: []string{"--bind", hostFile + ":/etc", c.env.ImagePath, "true"},
+			exit: 255,
+		},
+		{
+			name: "DirectoryOverFile",
+			args: []string{"--bind", hostDir + ":" + contFile, c.env.ImagePath, "true"},
+			exit: 255,
+		},
+	}
+
+	for _, profile := range e2e.Profiles {
+		profile := profile
+
+		t.Run(profile.String(), func(t *testing.T) {
+			for _, tt := range tests {
+				var exitFunc []e2e.SingularityCmdResultOp
+				if tt.output != "" {
+					exitFunc = append(exitFunc, e2e.ExpectOutput(e2e.ExactMatch, tt.output))
+				}
+				c.env.RunSingularity(
+					t,
+					e2e.AsSubtest(tt.name),
+					e2e.WithProfile(profile),
+					e2e.WithCommand("exec"),
+					e2e.WithArgs(tt.args...),
+					e2e.ExpectExit(tt.exit, exitFunc...),
+				)
+			}
+		})
+	}
+}
+
+// bindOptional tests that optional binds with a missing source are skipped
+// with a warning while the other binds are mounted.
+func (c actionTests) bindOptional(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	hostDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "bind-optional-", "")
+	defer cleanup(t)
+
+	missing := filepath.Join(hostDir, "missing")
+
+	for _, profile := range e2e.Profiles {
+		profile := profile
+
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(profile.String()),
+			e2e.WithProfile(profile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(
+				"--bind", hostDir+":/optional/existing:optional",
+				"--bind", missing+":/optional/missing:optional",
+				c.env.ImagePath,
+				"sh", "-c", "test -d /optional/existing && ! test -e /optional/missing",
+			),
+			e2e.ExpectExit(
+				0,
+				e2e.ExpectError(e2e.ContainMatch, "Skipping optional bind mount "+missing),
+			),
+		)
+	}
 
+	// a missing source without the optional marker still fails
 	c.env.RunSingularity(
 		t,
-		e2e.WithProfile(e2e.FakerootProfile),
-		e2e.WithDir(u.Dir),
+		e2e.AsSubtest("NotOptional"),
+		e2e.WithProfile(e2e.UserProfile),
 		e2e.WithCommand("exec"),
-		e2e.WithArgs(c.env.ImagePath, "sh", "-c", "umask"),
+		e2e.WithArgs("--bind", missing+":/optional/missing", c.env.ImagePath, "true"),
+		e2e.ExpectExit(255),
+	)
+}
+
+// bindGlob tests that each host path matching a wildcard bind source is
+// bound under its name in the destination directory.
+func (c actionTests) bindGlob(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	hostDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "bind-glob-", "")
+	defer cleanup(t)
+
+	jobs := []string{"job-1", "job-2", "job-3"}
+	for _, job := range append(jobs, "other") {
+		if err := os.Mkdir(filepath.Join(hostDir, job), 0755); err != nil {
+			t.Fatalf("failed to create %s: %s", job, err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(hostDir, job, "name"), []byte(job), 0644); err != nil {
+			t.Fatalf("failed to create %s/name: %s", job, err)
+		}
+	}
+
+	var script []string
+	for _, job := range jobs {
+		script = append(script, fmt.Sprintf("test \"$(cat /scratch/%[1]s/name)\" = %[1]s", job))
+	}
+	script = append(script, "! test -e /scratch/other")
+
+	for _, profile := range e2e.Profiles {
+		profile := profile
+
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(profile.String()),
+			e2e.WithProfile(profile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(
+				"--bind", filepath.Join(hostDir, "job-*")+":/scratch/",
+				c.env.ImagePath,
+				"sh", "-c", strings.Join(script, " && "),
+			),
+			e2e.ExpectExit(0),
+		)
+	}
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("SingleDestination"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("--bind", filepath.Join(hostDir, "job-*")+":/scratch", c.env.ImagePath, "true"),
 		e2e.ExpectExit(
-			0,
-			e2e.ExpectOutput(e2e.ExactMatch, "0000"),
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "must end with / to bind them under their names"),
 		),
 	)
 
 	c.env.RunSingularity(
 		t,
-		e2e.WithProfile(e2e.FakerootProfile),
-		e2e.WithDir(u.Dir),
+		e2e.AsSubtest("NoMatch"),
+		e2e.WithProfile(e2e.UserProfile),
 		e2e.WithCommand("exec"),
-		e2e.WithArgs("--no-umask", c.env.ImagePath, "sh", "-c", "umask"),
+		e2e.WithArgs("--bind", filepath.Join(hostDir, "missing-*")+":/scratch/", c.env.ImagePath, "true"),
 		e2e.ExpectExit(
-			0,
-			e2e.ExpectOutput(e2e.ExactMatch, "0022"),
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "no host path matches the bind source"),
 		),
 	)
+}
 
+// bindIDMap tests that a directory bound with the idmap option keeps its
+// host ownership inside a fakeroot container, where it's otherwise owned
+// by root, while the host files are left untouched.
+func (c actionTests) bindIDMap(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+	require.IDMappedMount(t)
+
+	hostDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "bind-idmap-", "")
+	defer cleanup(t)
+
+	hostFile := filepath.Join(hostDir, "file")
+	if err := ioutil.WriteFile(hostFile, []byte("idmap"), 0644); err != nil {
+		t.Fatalf("failed to create %s: %s", hostFile, err)
+	}
+	hostUID := func() uint32 {
+		var st syscall.Stat_t
+		if err := syscall.Stat(hostFile, &st); err != nil {
+			t.Fatalf("failed to stat %s: %s", hostFile, err)
+		}
+		return st.Uid
+	}
+	uid := hostUID()
+
+	tests := []struct {
+		name string
+		bind string
+		want string
+	}{
+		{name: "Plain", bind: hostDir + ":/idmap", want: "0"},
+		{name: "IDMap", bind: hostDir + ":/idmap:idmap", want: strconv.Itoa(int(uid))},
+	}
+
+	for _, tt := range tests {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.FakerootProfile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs("--bind", tt.bind, c.env.ImagePath, "stat", "-c", "%u", "/idmap/file"),
+			e2e.ExpectExit(0, func(t *testing.T, r *e2e.SingularityCmdResult) {
+				if strings.Contains(string(r.Stderr), "without ID translation") {
+					t.Errorf("idmapped mount not created: %s", r.Stderr)
+				}
+				if got := strings.TrimSpace(string(r.Stdout)); got != tt.want {
+					t.Errorf("file owned by %s in the container instead of %s", got, tt.want)
+				}
+			}),
+		)
+	}
+
+	if got := hostUID(); got != uid {
+		t.Errorf("host file owner changed from %d to %d", uid, got)
+	}
+}
+
+// bindChown tests that a directory bound with the chown option is seen
+// owned by the requested IDs in the container, while the host files are
+// left untouched, and that users can't give the copy an owner other than
+// themselves.
+func (c actionTests) bindChown(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	hostDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "bind-chown-", "")
+	defer cleanup(t)
+
+	hostFile := filepath.Join(hostDir, "file")
+	if err := ioutil.WriteFile(hostFile, []byte("chown"), 0644); err != nil {
+		t.Fatalf("failed to create %s: %s", hostFile, err)
+	}
+	hostOwner := func(path string) string {
+		var st syscall.Stat_t
+		if err := syscall.Stat(path, &st); err != nil {
+			t.Fatalf("failed to stat %s: %s", path, err)
+		}
+		return fmt.Sprintf("%d:%d", st.Uid, st.Gid)
+	}
+	dirOwner := hostOwner(hostDir)
+	fileOwner := hostOwner(hostFile)
+
+	userOwner := fmt.Sprintf("%d:%d", e2e.OrigUID(), e2e.OrigGID())
+
+	tests := []struct {
+		name    string
+		profile e2e.Profile
+		owner   string
+		exit    int
+		op      e2e.SingularityCmdResultOp
+	}{
+		{
+			name:    "UserOwnIDs",
+			profile: e2e.UserProfile,
+			owner:   userOwner,
+			exit:    0,
+			op:      e2e.ExpectOutput(e2e.ExactMatch, userOwner+"\n"+userOwner),
+		},
+		{
+			name:    "UserOtherIDs",
+			profile: e2e.UserProfile,
+			owner:   "0:0",
+			exit:    255,
+			op:      e2e.ExpectError(e2e.ContainMatch, "chown=0:0 not allowed"),
+		},
+		{
+			name:    "Root",
+			profile: e2e.RootProfile,
+			owner:   "1001:1001",
+			exit:    0,
+			op:      e2e.ExpectOutput(e2e.ExactMatch, "1001:1001\n1001:1001"),
+		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(tt.profile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(
+				"--bind", hostDir+":/chown:chown="+tt.owner,
+				c.env.ImagePath,
+				"stat", "-c", "%u:%g", "/chown", "/chown/file",
+			),
+			e2e.ExpectExit(tt.exit, tt.op),
+		)
+
+		if got := hostOwner(hostDir); got != dirOwner {
+			t.Errorf("host directory owner changed from %s to %s", dirOwner, got)
+		}
+		if got := hostOwner(hostFile); got != fileOwner {
+			t.Errorf("host file owner changed from %s to %s", fileOwner, got)
+		}
+	}
+}
+
+// bindACL tests that POSIX ACLs are preserved through a bind mount, a file
+// created in the container inherits the default ACL of the bound directory,
+// and that ACL entries not mapped in the user namespace are reported.
+func (c actionTests) bindACL(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+	require.Command(t, "setfacl")
+	require.Command(t, "getfacl")
+
+	hostDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "bind-acl-", "")
+	defer cleanup(t)
+
+	uid := strconv.Itoa(os.Getuid())
+	if res := exec.Command("setfacl", "-m", "d:u:"+uid+":rwx,d:u:0:r", hostDir).Run(t); res.Error != nil {
+		t.Skipf("could not set ACL on %s:\n%s", hostDir, res)
+	}
+
+	tests := []struct {
+		name    string
+		profile e2e.Profile
+		warning bool
+	}{
+		{
+			name:    "Setuid",
+			profile: e2e.UserProfile,
+		},
+		{
+			name:    "UserNamespace",
+			profile: e2e.UserNamespaceProfile,
+			warning: true,
+		},
+	}
+
+	for _, tt := range tests {
+		file := filepath.Join(hostDir, tt.name)
+		var stderr string
+
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(tt.profile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs("--bind", hostDir+":/acl", c.env.ImagePath, "touch", "/acl/"+tt.name),
+			e2e.ExpectExit(0, e2e.GetStreams(new(string), &stderr)),
+		)
+
+		res := exec.Command("getfacl", "-n", file).Run(t)
+		if res.Error != nil {
+			t.Errorf("%s: getfacl %s failed:\n%s", tt.name, file, res)
+			continue
+		}
+		if !strings.Contains(res.Stdout(), "user:"+uid+":") {
+			t.Errorf("%s: default ACL not inherited by %s:\n%s", tt.name, file, res.Stdout())
+		}
+
+		warned := strings.Contains(stderr, "user ID 0 not mapped")
+		if warned != tt.warning {
+			t.Errorf("%s: unexpected unmapped ACL warning %v, stderr: %s", tt.name, warned, stderr)
+		}
+	}
+}
+
+// bindResolvConf tests that an explicit user bind of /etc/resolv.conf takes
+// precedence over the resolv.conf generated for the container.
+func (c actionTests) bindResolvConf(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	const resolvConf = "nameserver 192.0.2.53\n"
+
+	hostDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "bind-resolv-", "")
+	defer cleanup(t)
+
+	hostFile := filepath.Join(hostDir, "resolv.conf")
+	if err := ioutil.WriteFile(hostFile, []byte(resolvConf), 0644); err != nil {
+		t.Fatalf("failed to create %s: %s", hostFile, err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		errorOp e2e.SingularityCmdResultOp
+	}{
+		{
+			name: "Contain",
+			args: []string{"--contain", "--bind", hostFile + ":/etc/resolv.conf"},
+		},
+		{
+			name:    "ContainDNS",
+			args:    []string{"--contain", "--dns", "192.0.2.1", "--bind", hostFile + ":/etc/resolv.conf"},
+			errorOp: e2e.ExpectError(e2e.ContainMatch, "Ignoring --dns option"),
+		},
+	}
+
+	for _, profile := range e2e.Profiles {
+		profile := profile
+
+		t.Run(profile.String(), func(t *testing.T) {
+			for _, tt := range tests {
+				exitFunc := []e2e.SingularityCmdResultOp{
+					e2e.ExpectOutput(e2e.ExactMatch, strings.TrimSpace(resolvConf)),
+				}
+				if tt.errorOp != nil {
+					exitFunc = append(exitFunc, tt.errorOp)
+				}
+				c.env.RunSingularity(
+					t,
+					e2e.AsSubtest(tt.name),
+					e2e.WithProfile(profile),
+					e2e.WithCommand("exec"),
+					e2e.WithArgs(append(tt.args, c.env.ImagePath, "cat", "/etc/resolv.conf")...),
+					e2e.ExpectExit(0, exitFunc...),
+				)
+			}
+		})
+	}
+}
+
+// bindSymlinkDest tests that a bind destination which is a symbolic link
+// pointing outside of the container root is resolved within the container.
+func (c actionTests) bindSymlinkDest(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	const marker = "bind marker"
+
+	tmpDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "bind-symlink-", "")
+	defer cleanup(t)
+
+	sandbox := filepath.Join(tmpDir, "sandbox")
+	c.env.RunSingularity(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--force", "--sandbox", sandbox, c.env.ImagePath),
+		e2e.ExpectExit(0),
+	)
+
+	// /mnt points to /host and /escape to a relative path going above
+	// the container root
+	if err := os.RemoveAll(filepath.Join(sandbox, "mnt")); err != nil {
+		t.Fatalf("failed to remove /mnt from sandbox: %s", err)
+	}
+	if err := os.Symlink("/host", filepath.Join(sandbox, "mnt")); err != nil {
+		t.Fatalf("failed to create /mnt symlink: %s", err)
+	}
+	if err := os.Symlink("../../../../../../host", filepath.Join(sandbox, "escape")); err != nil {
+		t.Fatalf("failed to create /escape symlink: %s", err)
+	}
+	if err := os.Mkdir(filepath.Join(sandbox, "host"), 0755); err != nil {
+		t.Fatalf("failed to create /host in sandbox: %s", err)
+	}
+
+	source := filepath.Join(tmpDir, "source")
+	if err := os.Mkdir(source, 0755); err != nil {
+		t.Fatalf("failed to create %s: %s", source, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(source, "marker"), []byte(marker), 0644); err != nil {
+		t.Fatalf("failed to create marker file: %s", err)
+	}
+
+	_, hostErr := os.Stat("/host")
+
+	for _, profile := range e2e.Profiles {
+		profile := profile
+
+		t.Run(profile.String(), func(t *testing.T) {
+			for _, dest := range []string{"/mnt", "/escape"} {
+				c.env.RunSingularity(
+					t,
+					e2e.AsSubtest(strings.TrimPrefix(dest, "/")),
+					e2e.WithProfile(profile),
+					e2e.WithCommand("exec"),
+					e2e.WithArgs("--bind", source+":"+dest, sandbox, "cat", "/host/marker"),
+					e2e.PostRun(func(t *testing.T) {
+						if _, err := os.Stat("/host"); os.IsNotExist(hostErr) && !os.IsNotExist(err) {
+							t.Errorf("bind to %s created /host on the host", dest)
+						}
+					}),
+					e2e.ExpectExit(0, e2e.ExpectOutput(e2e.ExactMatch, marker)),
+				)
+			}
+		})
+	}
+}
+
+// bindSymlinkEscape tests that bind destinations and overlay directories are
+// never created through symbolic links of a crafted image pointing outside
+// of the container.
+func (c actionTests) bindSymlinkEscape(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	tmpDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "bind-symlink-escape-", "")
+	// the overlay test creates a work directory owned by root
+	defer e2e.Privileged(cleanup)(t)
+
+	// outside is a host directory which must stay empty
+	outside := filepath.Join(tmpDir, "outside")
+	if err := os.Mkdir(outside, 0755); err != nil {
+		t.Fatalf("failed to create %s: %s", outside, err)
+	}
+	checkOutside := func(t *testing.T) {
+		if fi, err := ioutil.ReadDir(outside); err != nil || len(fi) > 0 {
+			t.Errorf("host directory %s was modified through the container", outside)
+		}
+	}
+
+	sandbox := filepath.Join(tmpDir, "sandbox")
+	c.env.RunSingularity(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--force", "--sandbox", sandbox, c.env.ImagePath),
+		e2e.ExpectExit(0),
+	)
+
+	// /abs points to the host directory, /rel to the host directory with
+	// a relative path going above the container root
+	if err := os.Symlink(outside, filepath.Join(sandbox, "abs")); err != nil {
+		t.Fatalf("failed to create /abs symlink: %s", err)
+	}
+	if err := os.Symlink(filepath.Join(strings.Repeat("../", 32), outside), filepath.Join(sandbox, "rel")); err != nil {
+		t.Fatalf("failed to create /rel symlink: %s", err)
+	}
+
+	for _, profile := range e2e.Profiles {
+		profile := profile
+
+		t.Run(profile.String(), func(t *testing.T) {
+			for _, dest := range []string{"/abs/data", "/rel/data", "/abs/sub/data"} {
+				c.env.RunSingularity(
+					t,
+					e2e.AsSubtest(strings.Replace(strings.TrimPrefix(dest, "/"), "/", "-", -1)),
+					e2e.WithProfile(profile),
+					e2e.WithCommand("exec"),
+					e2e.WithArgs("--bind", tmpDir+":"+dest, sandbox, "test", "-d", dest),
+					e2e.PostRun(checkOutside),
+					e2e.ExpectExit(0),
+				)
+			}
+		})
+	}
+
+	// a writable overlay directory whose upper directory points outside
+	require.Filesystem(t, "overlay")
+
+	overlayDir := filepath.Join(tmpDir, "overlay")
+	if err := os.Mkdir(overlayDir, 0755); err != nil {
+		t.Fatalf("failed to create %s: %s", overlayDir, err)
+	}
+	if err := os.Symlink(outside, filepath.Join(overlayDir, "upper")); err != nil {
+		t.Fatalf("failed to create upper symlink: %s", err)
+	}
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("OverlayUpper"),
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("--overlay", overlayDir, sandbox, "touch", "/escaped"),
+		e2e.PostRun(checkOutside),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "/upper is a symbolic link, refusing to follow it"),
+		),
+	)
+}
+
+// appData tests that the data directory of the application set with --app
+// is writable in a read-only container and persisted with --scif-data.
+func (c actionTests) appData(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	const output = "app output"
+
+	script := fmt.Sprintf(`echo %q > "$SCIF_APPOUTPUT/result" && cat "$SCIF_APPOUTPUT/result"`, output)
+
+	for _, profile := range e2e.Profiles {
+		profile := profile
+
+		t.Run(profile.String(), func(t *testing.T) {
+			dataDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "scif-data-", "")
+			defer cleanup(t)
+
+			c.env.RunSingularity(
+				t,
+				e2e.AsSubtest("ReadOnly"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs("--app", "foo", c.env.ImagePath, "sh", "-c", script),
+				e2e.ExpectExit(0, e2e.ExpectOutput(e2e.ExactMatch, output)),
+			)
+
+			c.env.RunSingularity(
+				t,
+				e2e.AsSubtest("ScifData"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs("--app", "foo", "--scif-data", dataDir, c.env.ImagePath, "sh", "-c", script),
+				e2e.PostRun(func(t *testing.T) {
+					b, err := ioutil.ReadFile(filepath.Join(dataDir, "output", "result"))
+					if err != nil {
+						t.Fatalf("application output not persisted: %s", err)
+					}
+					if got := strings.TrimSpace(string(b)); got != output {
+						t.Errorf("got persisted output %q, want %q", got, output)
+					}
+				}),
+				e2e.ExpectExit(0, e2e.ExpectOutput(e2e.ExactMatch, output)),
+			)
+
+			c.env.RunSingularity(
+				t,
+				e2e.AsSubtest("ScifDataWithoutApp"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs("--scif-data", dataDir, c.env.ImagePath, "true"),
+				e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, "--scif-data requires an application set with --app")),
+			)
+		})
+	}
+}
+
+// appDataQuota tests that --scif-data-quota limits the size of the
+// temporary data directory of the application set with --app.
+func (c actionTests) appDataQuota(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+	require.Command(t, "mkfs.ext2")
+
+	// dd reports the failed write, its exit status is the one of the
+	// container
+	write := func(kib int) string {
+		return fmt.Sprintf(`dd if=/dev/zero of="$SCIF_APPOUTPUT/data" bs=1024 count=%d 2>&1 >/dev/null`, kib)
+	}
+
+	for _, profile := range e2e.Profiles {
+		profile := profile
+
+		t.Run(profile.String(), func(t *testing.T) {
+			// the disk image is mounted with a loop device
+			if profile.In(e2e.UserNamespaceProfile, e2e.RootUserNamespaceProfile, e2e.FakerootProfile) {
+				c.env.RunSingularity(
+					t,
+					e2e.AsSubtest("UserNamespace"),
+					e2e.WithProfile(profile),
+					e2e.WithCommand("exec"),
+					e2e.WithArgs("--app", "foo", "--scif-data-quota", "1", c.env.ImagePath, "true"),
+					e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, "--scif-data-quota requires a setuid installation or root without user namespace")),
+				)
+				return
+			}
+
+			c.env.RunSingularity(
+				t,
+				e2e.AsSubtest("UnderQuota"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs("--app", "foo", "--scif-data-quota", "1", c.env.ImagePath, "sh", "-c", write(512)),
+				e2e.ExpectExit(0),
+			)
+
+			c.env.RunSingularity(
+				t,
+				e2e.AsSubtest("OverQuota"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs("--app", "foo", "--scif-data-quota", "1", c.env.ImagePath, "sh", "-c", write(2048)),
+				e2e.ExpectExit(
+					1,
+					e2e.ExpectOutput(e2e.ContainMatch, "No space left on device"),
+					e2e.ExpectError(e2e.ContainMatch, "Application data directory /scif/data/foo reached its --scif-data-quota of 1 MiB"),
+				),
+			)
+
+			c.env.RunSingularity(
+				t,
+				e2e.AsSubtest("Unlimited"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs("--app", "foo", c.env.ImagePath, "sh", "-c", write(2048)),
+				e2e.ExpectExit(0),
+			)
+
+			c.env.RunSingularity(
+				t,
+				e2e.AsSubtest("WithoutApp"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs("--scif-data-quota", "1", c.env.ImagePath, "true"),
+				e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, "--scif-data-quota requires an application set with --app")),
+			)
+
+			c.env.RunSingularity(
+				t,
+				e2e.AsSubtest("ScifData"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs("--app", "foo", "--scif-data", c.env.TestDir, "--scif-data-quota", "1", c.env.ImagePath, "true"),
+				e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, "it can't limit the --scif-data host directory")),
+			)
+		})
+	}
+}
+
+// actionUmask tests that the within-container umask is correct in action flows
+func (c actionTests) actionUmask(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	u := e2e.UserProfile.HostUser(t)
+
+	// Set umask for tests to 0000
+	oldUmask := syscall.Umask(0)
+	defer syscall.Umask(oldUmask)
+
+	c.env.RunSingularity(
+		t,
+		e2e.WithProfile(e2e.FakerootProfile),
+		e2e.WithDir(u.Dir),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs(c.env.ImagePath, "sh", "-c", "umask"),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.ExactMatch, "0000"),
+		),
+	)
+
+	c.env.RunSingularity(
+		t,
+		e2e.WithProfile(e2e.FakerootProfile),
+		e2e.WithDir(u.Dir),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("--no-umask", c.env.ImagePath, "sh", "-c", "umask"),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.ExactMatch, "0022"),
+		),
+	)
+
+}
+
+// actionShmSize tests that --shm-size sizes the container /dev/shm
+// temporary filesystem, with and without a contained /dev.
+func (c actionTests) actionShmSize(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	// size of /dev/shm in 1K blocks
+	const dfShm = "df -k /dev/shm | tail -n 1 | awk '{print $2}'"
+
+	tests := []struct {
+		name   string
+		args   []string
+		exit   int
+		output string
+	}{
+		{
+			name:   "ShmSize",
+			args:   []string{"--shm-size", "256M", c.env.ImagePath, "sh", "-c", dfShm},
+			exit:   0,
+			output: "262144",
+		},
+		{
+			name:   "ShmSizeContain",
+			args:   []string{"--contain", "--shm-size", "256M", c.env.ImagePath, "sh", "-c", dfShm},
+			exit:   0,
+			output: "262144",
+		},
+		{
+			name: "ContainShmExists",
+			args: []string{"--contain", c.env.ImagePath, "test", "-d", "/dev/shm"},
+			exit: 0,
+		},
+		{
+			name: "ShmSizeInvalid",
+			args: []string{"--shm-size", "256MB", c.env.ImagePath, "true"},
+			exit: 255,
+		},
+	}
+
+	for _, profile := range e2e.Profiles {
+		profile := profile
+
+		t.Run(profile.String(), func(t *testing.T) {
+			for _, tt := range tests {
+				var exitFunc []e2e.SingularityCmdResultOp
+				if tt.output != "" {
+					exitFunc = append(exitFunc, e2e.ExpectOutput(e2e.ExactMatch, tt.output))
+				}
+				c.env.RunSingularity(
+					t,
+					e2e.AsSubtest(tt.name),
+					e2e.WithProfile(profile),
+					e2e.WithCommand("exec"),
+					e2e.WithArgs(tt.args...),
+					e2e.ExpectExit(tt.exit, exitFunc...),
+				)
+			}
+		})
+	}
+}
+
+// actionTmpMount tests that --tmp and --var-tmp control the mounts of the
+// container /tmp and /var/tmp directories independently.
+func (c actionTests) actionTmpMount(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	const marker = "e2e-tmp-mount"
+
+	for _, profile := range e2e.Profiles {
+		profile := profile
+
+		t.Run(profile.String(), func(t *testing.T) {
+			hostDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "var-tmp-", "")
+			defer cleanup(t)
+			if err := os.Chmod(hostDir, 0777|os.ModeSticky); err != nil {
+				t.Fatalf("while changing %s permissions: %s", hostDir, err)
+			}
+
+			hostMarker := filepath.Join("/tmp", marker)
+			os.Remove(hostMarker)
+
+			tests := []struct {
+				name string
+				args []string
+				exit int
+			}{
+				{
+					name: "TmpfsWrite",
+					args: []string{"--tmp", "tmpfs", c.env.ImagePath, "touch", "/tmp/" + marker},
+					exit: 0,
+				},
+				{
+					name: "TmpfsFreshRun",
+					args: []string{"--tmp", "tmpfs", c.env.ImagePath, "test", "!", "-e", "/tmp/" + marker},
+					exit: 0,
+				},
+				{
+					name: "VarTmpHostDir",
+					args: []string{"--tmp", "tmpfs", "--var-tmp", hostDir, c.env.ImagePath, "touch", "/var/tmp/" + marker},
+					exit: 0,
+				},
+				{
+					name: "VarTmpTmpfsContain",
+					args: []string{"--contain", "--var-tmp", "tmpfs", c.env.ImagePath, "sh", "-c", "test -w /tmp && test -w /var/tmp"},
+					exit: 0,
+				},
+				{
+					name: "TmpNotDirectory",
+					args: []string{"--tmp", "/etc/passwd", c.env.ImagePath, "true"},
+					exit: 255,
+				},
+			}
+
+			for _, tt := range tests {
+				c.env.RunSingularity(
+					t,
+					e2e.AsSubtest(tt.name),
+					e2e.WithProfile(profile),
+					e2e.WithCommand("exec"),
+					e2e.WithArgs(tt.args...),
+					e2e.ExpectExit(tt.exit),
+				)
+			}
+
+			// the private /tmp never reaches the host
+			if e2e.PathExists(t, hostMarker) {
+				t.Errorf("%s was written to the host /tmp", marker)
+				os.Remove(hostMarker)
+			}
+			if !e2e.PathExists(t, filepath.Join(hostDir, marker)) {
+				t.Errorf("%s was not written to the --var-tmp directory %s", marker, hostDir)
+			}
+		})
+	}
+}
+
+// actionNoPivot checks that --no-pivot enters the container root filesystem
+// with chroot, and that it allows to run where pivot_root is disallowed.
+func (c actionTests) actionNoPivot(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	for _, profile := range e2e.Profiles {
+		profile := profile
+
+		t.Run(profile.String(), func(t *testing.T) {
+			c.env.RunSingularity(
+				t,
+				e2e.AsSubtest("NoPivot"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs("--no-pivot", c.env.ImagePath, "test", "-f", "/.singularity.d/runscript"),
+				e2e.ExpectExit(
+					0,
+					e2e.ExpectError(e2e.ContainMatch, "--no-pivot enters the container with chroot"),
+				),
+			)
+		})
+	}
+
+	// only in environments where pivot_root is disallowed, e.g. some
+	// nested container runtimes
+	t.Run("RestrictedEnvironment", func(t *testing.T) {
+		res := exec.Command(c.env.CmdPath, "exec", c.env.ImagePath, "true").Run(t)
+		if res.Error == nil || !strings.Contains(res.Stderr(), "try --no-pivot") {
+			t.Skip("pivot_root is allowed in this environment")
+		}
+
+		c.env.RunSingularity(
+			t,
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs("--no-pivot", c.env.ImagePath, "true"),
+			e2e.ExpectExit(0),
+		)
+	})
+}
+
+// actionDryRun checks that --dry-run validates the options without running
+// the container, and that all incompatibilities are reported at once.
+func (c actionTests) actionDryRun(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Valid"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("--dry-run", c.env.ImagePath, "false"),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectError(e2e.ContainMatch, "No incompatible options found"),
+		),
+	)
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Incompatible"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("--dry-run", "--writable", "--overlay", "/overlay", "--keep-privs", c.env.ImagePath, "true"),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "--writable and --overlay are mutually exclusive"),
+			e2e.ExpectError(e2e.ContainMatch, "--keep-privs requires root privileges"),
+		),
+	)
+}
+
+// actionReadOnly tests that --read-only keeps the container root filesystem
+// read-only even with a writable overlay image.
+func (c actionTests) actionReadOnly(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	require.Filesystem(t, "overlay")
+	require.Command(t, "mkfs.ext3")
+	require.Command(t, "dd")
+
+	testdir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "read-only-", "")
+	defer cleanup(t)
+
+	ext3Img := filepath.Join(testdir, "ext3_fs.img")
+
+	cmd := exec.Command("dd", "if=/dev/zero", "of="+ext3Img, "bs=1M", "count=64", "status=none")
+	if res := cmd.Run(t); res.Error != nil {
+		t.Fatalf("Unexpected error while running command.\n%s", res)
+	}
+	cmd = exec.Command("mkfs.ext3", "-q", "-F", ext3Img)
+	if res := cmd.Run(t); res.Error != nil {
+		t.Fatalf("Unexpected error while running command.\n%s", res)
+	}
+
+	tests := []struct {
+		name    string
+		argv    []string
+		exit    int
+		matches []e2e.SingularityCmdResultOp
+	}{
+		{
+			name: "OverlayCreate",
+			argv: []string{"--overlay", ext3Img, c.env.ImagePath, "touch", "/ext3_overlay"},
+			exit: 0,
+		},
+		{
+			name: "ReadOnlyWrite",
+			argv: []string{"--read-only", "--overlay", ext3Img, c.env.ImagePath, "touch", "/read_only"},
+			exit: 1,
+			matches: []e2e.SingularityCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "Read-only file system"),
+			},
+		},
+		{
+			name: "ReadOnlyOverlayContent",
+			argv: []string{"--read-only", "--overlay", ext3Img, c.env.ImagePath, "test", "-f", "/ext3_overlay"},
+			exit: 0,
+		},
+		{
+			name: "ReadOnlyNothingWritten",
+			argv: []string{"--overlay", ext3Img, c.env.ImagePath, "test", "-f", "/read_only"},
+			exit: 1,
+		},
+		{
+			name: "ReadOnlyWritable",
+			argv: []string{"--read-only", "--writable", c.env.ImagePath, "true"},
+			exit: 255,
+			matches: []e2e.SingularityCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "--read-only and --writable are mutually exclusive"),
+			},
+		},
+		{
+			name: "ReadOnlyWritableTmpfs",
+			argv: []string{"--read-only", "--writable-tmpfs", c.env.ImagePath, "true"},
+			exit: 255,
+			matches: []e2e.SingularityCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "--read-only and --writable-tmpfs are mutually exclusive"),
+			},
+		},
+		{
+			name: "ReadOnlyDryRun",
+			argv: []string{"--dry-run", "--read-only", "--overlay", ext3Img, c.env.ImagePath, "true"},
+			exit: 0,
+			matches: []e2e.SingularityCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "Overlay "+ext3Img+": read-only (demoted by --read-only)"),
+				e2e.ExpectError(e2e.ContainMatch, "Root filesystem: read-only"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.RootProfile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(tt.argv...),
+			e2e.ExpectExit(tt.exit, tt.matches...),
+		)
+	}
+}
+
+// actionCudaDriver tests that --nv reports a host NVIDIA driver too old for
+// the CUDA version declared by the image label.
+func (c actionTests) actionCudaDriver(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	testdir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "cuda-driver-", "")
+	defer cleanup(t)
+
+	sandbox := filepath.Join(testdir, "sandbox")
+	c.env.RunSingularity(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--force", "--sandbox", sandbox, c.env.ImagePath),
+		e2e.ExpectExit(0),
+	)
+
+	labels := filepath.Join(sandbox, ".singularity.d", "labels.json")
+	if err := ioutil.WriteFile(labels, []byte(`{"com.nvidia.cuda.version": "11.0.3"}`), 0644); err != nil {
+		t.Fatalf("failed to write image labels: %s", err)
+	}
+
+	// mock nvidia-smi reporting the host driver version
+	bindir := filepath.Join(testdir, "bin")
+	if err := os.Mkdir(bindir, 0755); err != nil {
+		t.Fatalf("failed to create directory: %s", err)
+	}
+	nvidiaSmi := filepath.Join(bindir, "nvidia-smi")
+	pathEnv := "PATH=" + bindir + ":" + os.Getenv("PATH")
+
+	tests := []struct {
+		name    string
+		driver  string
+		matches []e2e.SingularityCmdResultOp
+	}{
+		{
+			name:   "DriverTooOld",
+			driver: "418.87.01",
+			matches: []e2e.SingularityCmdResultOp{
+				e2e.ExpectError(
+					e2e.ContainMatch,
+					"container requires CUDA 11.0.3 which needs NVIDIA driver >= 450.36.06, host driver version is 418.87.01",
+				),
+			},
+		},
+		{
+			name:   "DriverRecent",
+			driver: "450.80.02",
+			matches: []e2e.SingularityCmdResultOp{
+				func(t *testing.T, r *e2e.SingularityCmdResult) {
+					if bytes.Contains(r.Stderr, []byte("needs NVIDIA driver")) {
+						t.Errorf("unexpected CUDA driver mismatch reported:\n%s", r.Stderr)
+					}
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		script := "#!/bin/sh\necho " + tt.driver + "\n"
+		if err := ioutil.WriteFile(nvidiaSmi, []byte(script), 0755); err != nil {
+			t.Fatalf("failed to write nvidia-smi mock: %s", err)
+		}
+
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("exec"),
+			e2e.WithEnv(append(os.Environ(), pathEnv)),
+			e2e.WithArgs("--nv", sandbox, "true"),
+			e2e.ExpectExit(0, tt.matches...),
+		)
+	}
+}
+
+// actionNvMIG checks that --nv binds only the device nodes of the MIG
+// device selected with CUDA_VISIBLE_DEVICES, with or without --contain, the
+// test requires a MIG enabled GPU.
+func (c actionTests) actionNvMIG(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+	require.Command(t, "nvidia-smi")
+
+	res := exec.Command("nvidia-smi", "-L").Run(t)
+	if res.Error != nil {
+		t.Skipf("nvidia-smi failed: %s", res.Error)
+	}
+	// MIG 1g.5gb Device 0: (UUID: MIG-GPU-<GPU UUID>/<GI>/<CI>)
+	m := regexp.MustCompile(`\(UUID: (MIG-GPU-[^)]+)\)`).FindStringSubmatch(res.Stdout())
+	if m == nil {
+		t.Skipf("no MIG device found")
+	}
+	mig := m[1]
+
+	devs, err := gpu.NvidiaMIGDevices(mig)
+	if err != nil {
+		t.Fatalf("could not get devices of MIG device %s: %s", mig, err)
+	}
+	// all the nvidia devices visible in the container: the non-GPU
+	// devices, the GPU and the capabilities of the MIG device and the
+	// /dev/nvidia-caps directory holding them
+	want := append([]string{"/dev/nvidia-caps"}, devs...)
+	sort.Strings(want)
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{
+			name: "Contain",
+			args: []string{"--contain"},
+		},
+		{
+			name: "HostDev",
+		},
+	}
+
+	for _, tt := range tests {
+		args := append(tt.args, "--nv", c.env.ImagePath, "/bin/sh", "-c", "ls -d /dev/nvidia* /dev/nvidia-caps/*")
+
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("exec"),
+			e2e.WithEnv(append(os.Environ(), "CUDA_VISIBLE_DEVICES="+mig)),
+			e2e.WithArgs(args...),
+			e2e.ExpectExit(
+				0,
+				func(t *testing.T, r *e2e.SingularityCmdResult) {
+					got := strings.Fields(string(r.Stdout))
+					sort.Strings(got)
+					if !reflect.DeepEqual(got, want) {
+						t.Errorf("got nvidia devices %v, want %v", got, want)
+					}
+				},
+			),
+		)
+	}
+}
+
+// actionSessionDir checks that the writable tmpfs overlay grows the memory
+// session directory and that SINGULARITY_SESSIONDIR stores the session
+// directory on disk in the unprivileged workflow.
+func (c actionTests) actionSessionDir(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	sessionDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "sessiondir-", "session directory")
+	defer cleanup(t)
+
+	// the default 16MiB session directory is grown to 32MiB with
+	// --writable-tmpfs
+	write := func(size int) []string {
+		return []string{
+			"--writable-tmpfs", c.env.ImagePath,
+			"/bin/sh", "-c", fmt.Sprintf("dd if=/dev/zero of=/data bs=1M count=%d", size),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		profile e2e.Profile
+		env     []string
+		args    []string
+		exit    int
+	}{
+		{
+			name:    "WritableTmpfsGrowth",
+			profile: e2e.UserProfile,
+			args:    write(24),
+			exit:    0,
+		},
+		{
+			name:    "WritableTmpfsFull",
+			profile: e2e.UserProfile,
+			args:    write(64),
+			exit:    1,
+		},
+		{
+			name:    "SessionDirIgnoredSetuid",
+			profile: e2e.UserProfile,
+			env:     []string{"SINGULARITY_SESSIONDIR=" + sessionDir},
+			args:    write(64),
+			exit:    1,
+		},
+		{
+			name:    "SessionDirUserNamespace",
+			profile: e2e.UserNamespaceProfile,
+			env:     []string{"SINGULARITY_SESSIONDIR=" + sessionDir},
+			args:    write(64),
+			exit:    0,
+		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(tt.profile),
+			e2e.WithCommand("exec"),
+			e2e.WithEnv(append(os.Environ(), tt.env...)),
+			e2e.WithArgs(tt.args...),
+			e2e.PostRun(func(t *testing.T) {
+				// the session directory stored on disk is removed
+				// once the container exits
+				fis, err := ioutil.ReadDir(sessionDir)
+				if err != nil {
+					t.Fatalf("could not read %s: %s", sessionDir, err)
+				} else if len(fis) != 0 {
+					t.Errorf("session directory %s not removed", filepath.Join(sessionDir, fis[0].Name()))
+				}
+			}),
+			e2e.ExpectExit(tt.exit),
+		)
+	}
+}
+
+// actionNetworkIPv6 checks that the loopback interface has the IPv6
+// loopback address and that the bundled networks assign IPv6 addresses.
+func (c actionTests) actionNetworkIPv6(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+	require.IPv6(t)
+
+	// /proc/net/if_inet6 lists addresses without separators
+	const (
+		loopback   = "00000000000000000000000000000001"
+		bridgeNet  = "fd000010002200000000"
+		bridge6Net = "fd000010002400000000"
+	)
+
+	tests := []struct {
+		name    string
+		profile e2e.Profile
+		network string
+		match   string
+		root    bool
+	}{
+		{
+			name:    "LoopbackOnly",
+			profile: e2e.UserProfile,
+			network: "none",
+			match:   loopback,
+		},
+		{
+			name:    "DualStackBridge",
+			profile: e2e.RootProfile,
+			network: "bridge",
+			match:   bridgeNet,
+			root:    true,
+		},
+		{
+			name:    "IPv6Bridge",
+			profile: e2e.RootProfile,
+			network: "bridge6",
+			match:   bridge6Net,
+			root:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(tt.profile),
+			e2e.PreRun(func(t *testing.T) {
+				if tt.root {
+					e2e.Privileged(require.Network)(t)
+				}
+			}),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs("--net", "--network", tt.network, c.env.ImagePath, "cat", "/proc/net/if_inet6"),
+			e2e.ExpectExit(0, e2e.ExpectOutput(e2e.ContainMatch, tt.match)),
+		)
+	}
+}
+
+// actionPidFile checks that --pid-file writes the host PID of the container
+// process while it's running and that the file is removed once it exits.
+func (c actionTests) actionPidFile(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	hostDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "pid-file-", "")
+	defer cleanup(t)
+
+	pidFile := filepath.Join(hostDir, "container.pid")
+
+	for _, profile := range e2e.Profiles {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(profile.String()),
+			e2e.WithProfile(profile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs("--pid-file", pidFile, "--bind", hostDir+":/pid", c.env.ImagePath, "cat", "/pid/container.pid"),
+			e2e.PostRun(func(t *testing.T) {
+				if _, err := os.Stat(pidFile); !os.IsNotExist(err) {
+					os.Remove(pidFile)
+					t.Errorf("pid file %s not removed", pidFile)
+				}
+			}),
+			e2e.ExpectExit(
+				0,
+				e2e.ExpectOutput(e2e.RegexMatch, `^[0-9]+\n$`),
+			),
+		)
+	}
+}
+
+// actionDevice checks that a block device passed read-only with --device
+// can be read but not written from the container.
+func (c actionTests) actionDevice(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+	require.Cgroups(t)
+	require.Command(t, "losetup")
+
+	testdir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "device-", "")
+	defer cleanup(t)
+
+	backing := filepath.Join(testdir, "disk.img")
+	if err := ioutil.WriteFile(backing, make([]byte, 1024*1024), 0644); err != nil {
+		t.Fatalf("failed to create loop backing file: %s", err)
+	}
+
+	var loopDev string
+	e2e.Privileged(func(t *testing.T) {
+		res := exec.Command("losetup", "--find", "--show", backing).Run(t)
+		if res.ExitCode != 0 {
+			t.Skipf("no loop block device available: %s", res.Stderr())
+		}
+		loopDev = strings.TrimSpace(res.Stdout())
+		// the device must not be readable by the invoking user, even
+		// when it belongs to the disk group
+		if loopDev != "" {
+			if err := os.Chmod(loopDev, 0600); err != nil {
+				t.Errorf("failed to change %s permissions: %s", loopDev, err)
+			}
+		}
+	})(t)
+	if loopDev == "" {
+		return
+	}
+	defer e2e.Privileged(func(t *testing.T) {
+		exec.Command("losetup", "--detach", loopDev).Run(t)
+	})(t)
+
+	read := "dd if=/dev/data of=/dev/null bs=512 count=1"
+	write := "dd if=/dev/zero of=/dev/data bs=512 count=1 conv=notrunc"
+	hostWrite := strings.Replace(write, "/dev/data", loopDev, 1)
+
+	tests := []struct {
+		name string
+		args []string
+		exit int
+	}{
+		{
+			name: "ReadOnlyRead",
+			args: []string{"--contain", "--device", loopDev + ":/dev/data:ro", c.env.ImagePath, "sh", "-c", read},
+			exit: 0,
+		},
+		{
+			name: "ReadOnlyWrite",
+			args: []string{"--contain", "--device", loopDev + ":/dev/data:ro", c.env.ImagePath, "sh", "-c", write},
+			exit: 1,
+		},
+		{
+			name: "ReadWriteWrite",
+			args: []string{"--contain", "--device", loopDev + ":/dev/data:rw", c.env.ImagePath, "sh", "-c", write},
+			exit: 0,
+		},
+		{
+			name: "HostDevReadOnlyWrite",
+			args: []string{"--device", loopDev + ":ro", c.env.ImagePath, "sh", "-c", hostWrite},
+			exit: 1,
+		},
+		{
+			name: "NotADevice",
+			args: []string{"--contain", "--device", backing + ":/dev/data:ro", c.env.ImagePath, "true"},
+			exit: 255,
+		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.RootProfile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(tt.args...),
+			e2e.ExpectExit(tt.exit),
+		)
+	}
+}
+
+// actionBlockDevice checks that an ext4 filesystem on a block device can be
+// used as a container, read-only by default and read-write with --writable,
+// and that a user not allowed to read the device can't use it.
+func (c actionTests) actionBlockDevice(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+	require.Command(t, "losetup")
+	require.Command(t, "mkfs.ext4")
+
+	testdir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "blockdev-", "")
+	defer cleanup(t)
+
+	sandbox := filepath.Join(testdir, "sandbox")
+	backing := filepath.Join(testdir, "disk.img")
+
+	c.env.RunSingularity(
+		t,
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--sandbox", sandbox, c.env.ImagePath),
+		e2e.ExpectExit(0),
+	)
+	if t.Failed() {
+		return
+	}
+
+	var loopDev string
+	e2e.Privileged(func(t *testing.T) {
+		// populating the filesystem requires mke2fs 1.43 or later
+		res := exec.Command("mkfs.ext4", "-q", "-F", "-d", sandbox, backing, "256M").Run(t)
+		if res.ExitCode != 0 {
+			t.Skipf("can't create ext4 filesystem from %s: %s", sandbox, res.Stderr())
+		}
+		res = exec.Command("losetup", "--find", "--show", backing).Run(t)
+		if res.ExitCode != 0 {
+			t.Skipf("no loop block device available: %s", res.Stderr())
+		}
+		loopDev = strings.TrimSpace(res.Stdout())
+		// the device must not be readable by the invoking user, even
+		// when it belongs to the disk group
+		if loopDev != "" {
+			if err := os.Chmod(loopDev, 0600); err != nil {
+				t.Errorf("failed to change %s permissions: %s", loopDev, err)
+			}
+		}
+	})(t)
+	if loopDev == "" {
+		return
+	}
+	defer e2e.Privileged(func(t *testing.T) {
+		exec.Command("losetup", "--detach", loopDev).Run(t)
+	})(t)
+
+	tests := []struct {
+		name    string
+		profile e2e.Profile
+		args    []string
+		exit    int
+		match   string
+	}{
+		{
+			name:    "ReadOnly",
+			profile: e2e.RootProfile,
+			args:    []string{loopDev, "test", "-f", "/.singularity.d/runscript"},
+			exit:    0,
+		},
+		{
+			name:    "ReadOnlyWrite",
+			profile: e2e.RootProfile,
+			args:    []string{loopDev, "touch", "/block_marker"},
+			exit:    1,
+		},
+		{
+			name:    "Writable",
+			profile: e2e.RootProfile,
+			args:    []string{"--writable", loopDev, "touch", "/block_marker"},
+			exit:    0,
+		},
+		{
+			name:    "WritablePersist",
+			profile: e2e.RootProfile,
+			args:    []string{loopDev, "test", "-f", "/block_marker"},
+			exit:    0,
+		},
+		{
+			name:    "UserNamespace",
+			profile: e2e.UserNamespaceProfile,
+			args:    []string{loopDev, "true"},
+			exit:    255,
+			match:   "a setuid installation is required",
+		},
+		{
+			name:    "UserUnreadable",
+			profile: e2e.UserProfile,
+			args:    []string{loopDev, "true"},
+			exit:    255,
+			match:   "permission denied to read block device",
+		},
+	}
+
+	for _, tt := range tests {
+		opts := []e2e.SingularityCmdOp{
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(tt.profile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(tt.args...),
+		}
+		if tt.match != "" {
+			opts = append(opts, e2e.ExpectExit(tt.exit, e2e.ExpectError(e2e.ContainMatch, tt.match)))
+		} else {
+			opts = append(opts, e2e.ExpectExit(tt.exit))
+		}
+		c.env.RunSingularity(t, opts...)
+	}
+}
+
+// actionBindCgroups checks that --bind-cgroups binds the host cgroup v2
+// hierarchy read-write with its controllers, and is restricted to root.
+func (c actionTests) actionBindCgroups(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+	require.CgroupsV2(t)
+
+	controllers, err := ioutil.ReadFile("/sys/fs/cgroup/cgroup.controllers")
+	if err != nil {
+		t.Fatalf("failed to read host cgroup controllers: %s", err)
+	}
+	want := strings.TrimSpace(string(controllers))
+
+	tests := []struct {
+		name    string
+		profile e2e.Profile
+		args    []string
+		exit    int
+		op      e2e.SingularityCmdResultOp
+	}{
+		{
+			name:    "Controllers",
+			profile: e2e.RootProfile,
+			args:    []string{"--bind-cgroups", c.env.ImagePath, "cat", "/sys/fs/cgroup/cgroup.controllers"},
+			exit:    0,
+			op:      e2e.ExpectOutput(e2e.ExactMatch, want),
+		},
+		{
+			name:    "Writable",
+			profile: e2e.RootProfile,
+			args:    []string{"--bind-cgroups", c.env.ImagePath, "sh", "-c", "test -w /sys/fs/cgroup && grep -q ' /sys/fs/cgroup cgroup2 rw,' /proc/mounts"},
+			exit:    0,
+		},
+		{
+			name:    "ContainWritable",
+			profile: e2e.RootProfile,
+			args:    []string{"--contain", "--bind-cgroups", c.env.ImagePath, "test", "-w", "/sys/fs/cgroup/cgroup.subtree_control"},
+			exit:    0,
+		},
+		{
+			name:    "DefaultReadOnly",
+			profile: e2e.RootProfile,
+			args:    []string{c.env.ImagePath, "grep", "-q", " /sys/fs/cgroup cgroup2 rw,", "/proc/mounts"},
+			exit:    1,
+		},
+		{
+			name:    "User",
+			profile: e2e.UserProfile,
+			args:    []string{"--bind-cgroups", c.env.ImagePath, "true"},
+			exit:    255,
+			op:      e2e.ExpectError(e2e.ContainMatch, "--bind-cgroups requires root privileges"),
+		},
+	}
+
+	for _, tt := range tests {
+		expects := []e2e.SingularityCmdResultOp{}
+		if tt.op != nil {
+			expects = append(expects, tt.op)
+		}
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(tt.profile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(tt.args...),
+			e2e.ExpectExit(tt.exit, expects...),
+		)
+	}
+}
+
+// actionTimeout checks that --timeout terminates the container payload
+// with its children and that --max-output truncates its output.
+func (c actionTests) actionTimeout(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	// the background children of the payload would keep the output pipes
+	// open until they exit if they were not terminated along with it
+	var start time.Time
+	exitedEarly := func(t *testing.T, r *e2e.SingularityCmdResult) {
+		if d := time.Since(start); d > 20*time.Second {
+			t.Errorf("container children not terminated on timeout, exited after %s", d)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		command string
+		args    []string
+		exit    int
+		ops     []e2e.SingularityCmdResultOp
+	}{
+		{
+			name:    "Timeout",
+			command: "exec",
+			args:    []string{"--timeout", "2s", c.env.ImagePath, "sleep", "30"},
+			exit:    124,
+			ops:     []e2e.SingularityCmdResultOp{e2e.ExpectError(e2e.ContainMatch, "Container timed out after 2s")},
+		},
+		{
+			name:    "TimeoutKill",
+			command: "exec",
+			args:    []string{"--timeout", "2s", c.env.ImagePath, "sh", "-c", "trap '' TERM; sleep 30"},
+			exit:    137,
+			ops:     []e2e.SingularityCmdResultOp{e2e.ExpectError(e2e.ContainMatch, "sending SIGKILL")},
+		},
+		{
+			name:    "TimeoutChildren",
+			command: "exec",
+			args:    []string{"--timeout", "2s", c.env.ImagePath, "sh", "-c", "sleep 60 & sleep 60 & wait"},
+			exit:    124,
+			ops:     []e2e.SingularityCmdResultOp{exitedEarly},
+		},
+		{
+			name:    "TimeoutChildrenKill",
+			command: "exec",
+			args:    []string{"--timeout", "2s", c.env.ImagePath, "sh", "-c", "trap '' TERM; (trap '' TERM; sleep 60) & sleep 60"},
+			exit:    137,
+			ops:     []e2e.SingularityCmdResultOp{exitedEarly},
+		},
+		{
+			name:    "NoTimeout",
+			command: "exec",
+			args:    []string{"--timeout", "1m", c.env.ImagePath, "true"},
+			exit:    0,
+		},
+		{
+			name:    "BadTimeout",
+			command: "exec",
+			args:    []string{"--timeout", "forever", c.env.ImagePath, "true"},
+			exit:    255,
+		},
+		{
+			name:    "MaxOutput",
+			command: "exec",
+			args:    []string{"--max-output", "10", c.env.ImagePath, "sh", "-c", "printf 0123456789abcdef"},
+			exit:    0,
+			ops: []e2e.SingularityCmdResultOp{
+				e2e.ExpectOutput(e2e.ExactMatch, "0123456789"),
+				e2e.ExpectError(e2e.ContainMatch, "Container standard output truncated after 10 bytes"),
+			},
+		},
+		{
+			name:    "InstanceTimeout",
+			command: "instance start",
+			args:    []string{"--timeout", "1m", c.env.ImagePath, "timeout"},
+			exit:    255,
+			ops:     []e2e.SingularityCmdResultOp{e2e.ExpectError(e2e.ContainMatch, "instance stop --timeout")},
+		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand(tt.command),
+			e2e.WithArgs(tt.args...),
+			e2e.PreRun(func(t *testing.T) {
+				start = time.Now()
+			}),
+			e2e.ExpectExit(tt.exit, tt.ops...),
+		)
+	}
+}
+
+// actionRlimit checks that --rlimit sets the resource limits of the
+// container process and that they are reported by --dry-run.
+func (c actionTests) actionRlimit(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	tests := []struct {
+		name    string
+		profile e2e.Profile
+		args    []string
+		exit    int
+		ops     []e2e.SingularityCmdResultOp
+	}{
+		{
+			name:    "UserNofile",
+			profile: e2e.UserProfile,
+			args:    []string{"--rlimit", "nofile=256:512", c.env.ImagePath, "sh", "-c", "ulimit -Sn; ulimit -Hn"},
+			ops:     []e2e.SingularityCmdResultOp{e2e.ExpectOutput(e2e.ExactMatch, "256\n512")},
+		},
+		{
+			// nofile can't be unlimited, the hard limit is at most nr_open
+			name:    "UserNofileRaise",
+			profile: e2e.UserProfile,
+			args:    []string{"--rlimit", "nofile=unlimited", c.env.ImagePath, "true"},
+			ops:     []e2e.SingularityCmdResultOp{e2e.ExpectError(e2e.ContainMatch, "is above the current hard limit")},
+		},
+		{
+			name:    "UserNamespaceCore",
+			profile: e2e.UserNamespaceProfile,
+			args:    []string{"--rlimit", "core=0", c.env.ImagePath, "sh", "-c", "ulimit -Hc"},
+			ops:     []e2e.SingularityCmdResultOp{e2e.ExpectOutput(e2e.ExactMatch, "0")},
+		},
+		{
+			name:    "RootStack",
+			profile: e2e.RootProfile,
+			args:    []string{"--rlimit", "stack=unlimited", c.env.ImagePath, "sh", "-c", "ulimit -s"},
+			ops:     []e2e.SingularityCmdResultOp{e2e.ExpectOutput(e2e.ExactMatch, "unlimited")},
+		},
+		{
+			name:    "DryRun",
+			profile: e2e.UserProfile,
+			args:    []string{"--dry-run", "--rlimit", "nofile=1024:2048,stack=8M", c.env.ImagePath, "true"},
+			ops: []e2e.SingularityCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "Resource limit nofile: soft 1024, hard 2048"),
+				e2e.ExpectError(e2e.ContainMatch, "Resource limit stack: soft 8388608, hard 8388608"),
+			},
+		},
+		{
+			name:    "Unsupported",
+			profile: e2e.UserProfile,
+			args:    []string{"--rlimit", "cpu=10", c.env.ImagePath, "true"},
+			exit:    255,
+			ops:     []e2e.SingularityCmdResultOp{e2e.ExpectError(e2e.ContainMatch, `unsupported resource "cpu"`)},
+		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(tt.profile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(tt.args...),
+			e2e.ExpectExit(tt.exit, tt.ops...),
+		)
+	}
+}
+
+// actionPty checks that exec and shell attach the container process to a
+// pseudo terminal only with --pty or when the standard streams are
+// terminals, and that a piped input is read unchanged up to its end.
+func (c actionTests) actionPty(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	// binary data holding the control characters interpreted by a
+	// terminal line discipline, like the end of file and interrupt
+	// characters
+	binary := make([]byte, 4*256)
+	for i := range binary {
+		binary[i] = byte(i)
+	}
+	binaryDigest := sha256.Sum256(binary)
+
+	tests := []struct {
+		name  string
+		args  []string
+		input string
+		exit  int
+		ops   []e2e.SingularityCmdResultOp
+	}{
+		{
+			name:  "PipeCat",
+			args:  []string{c.env.ImagePath, "cat"},
+			input: "data\n",
+			ops:   []e2e.SingularityCmdResultOp{e2e.ExpectOutput(e2e.ExactMatch, "data")},
+		},
+		{
+			name:  "PtyPipeCat",
+			args:  []string{"--pty", "--timeout", "30s", c.env.ImagePath, "cat"},
+			input: "data\n",
+			ops:   []e2e.SingularityCmdResultOp{e2e.ExpectOutput(e2e.ExactMatch, "data")},
+		},
+		{
+			// the input isn't terminated by a newline, cat would wait
+			// for one until the timeout without the end of file
+			name:  "PtyPipeNoNewline",
+			args:  []string{"--pty", "--timeout", "30s", c.env.ImagePath, "cat"},
+			input: "data",
+			ops:   []e2e.SingularityCmdResultOp{e2e.ExpectOutput(e2e.ExactMatch, "data")},
+		},
+		{
+			name:  "PtyPipeBinary",
+			args:  []string{"--pty", "--timeout", "30s", c.env.ImagePath, "sha256sum"},
+			input: string(binary),
+			ops:   []e2e.SingularityCmdResultOp{e2e.ExpectOutput(e2e.ContainMatch, hex.EncodeToString(binaryDigest[:]))},
+		},
+		{
+			name:  "PipeIsatty",
+			args:  []string{c.env.ImagePath, "test", "-t", "0"},
+			input: "data\n",
+			exit:  1,
+		},
+		{
+			name:  "NoPtyIsatty",
+			args:  []string{"--no-pty", c.env.ImagePath, "test", "-t", "0"},
+			input: "data\n",
+			exit:  1,
+		},
+		{
+			// a piped standard input is kept, the output streams
+			// and the controlling terminal are the pseudo terminal
+			name:  "PtyIsatty",
+			args:  []string{"--pty", c.env.ImagePath, "sh", "-c", "! test -t 0 && test -t 1 && test -t 2 && : </dev/tty"},
+			input: "data\n",
+		},
+		{
+			name: "PtyNoPty",
+			args: []string{"--pty", "--no-pty", c.env.ImagePath, "true"},
+			exit: 255,
+			ops:  []e2e.SingularityCmdResultOp{e2e.ExpectError(e2e.ContainMatch, "--pty and --no-pty are mutually exclusive")},
+		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(tt.args...),
+			e2e.WithStdin(strings.NewReader(tt.input)),
+			e2e.ExpectExit(tt.exit, tt.ops...),
+		)
+	}
+
+	// an interactive shell gets a pseudo terminal, unless --no-pty is set
+	// and it uses the terminal of the console directly
+	shellTests := []struct {
+		name string
+		args []string
+	}{
+		{name: "ShellPty", args: []string{c.env.ImagePath}},
+		{name: "ShellNoPty", args: []string{"--no-pty", c.env.ImagePath}},
+	}
+	for _, tt := range shellTests {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("shell"),
+			e2e.WithArgs(tt.args...),
+			e2e.ConsoleRun(
+				e2e.ConsoleSendLine("tty"),
+				e2e.ConsoleExpect("/dev/pts/"),
+				e2e.ConsoleSendLine("exit 3"),
+			),
+			e2e.ExpectExit(3),
+		)
+	}
+
+	// nohup ignores SIGHUP, the piped input and output are used as is
+	t.Run("Nohup", func(t *testing.T) {
+		require.Command(t, "nohup")
+
+		res := exec.Command("sh", "-c", "echo data | nohup "+c.env.CmdPath+" exec "+c.env.ImagePath+" cat").Run(t)
+		if res.Error != nil {
+			t.Fatalf("unexpected error: %s: %s", res.Error, res.Stderr())
+		}
+		if got := strings.TrimSpace(res.Stdout()); got != "data" {
+			t.Errorf("got output %q, want %q", got, "data")
+		}
+	})
+}
+
+// actionRootfsROCheck checks that --rootfs-ro-check passes the exit code of
+// a run which left the image untouched, and fails a run which modified the
+// image or mounted it writable.
+func (c actionTests) actionRootfsROCheck(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	tmpDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "rootfs-ro-check-", "")
+	defer cleanup(t)
+
+	sandbox := filepath.Join(tmpDir, "sandbox")
+	c.env.RunSingularity(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--force", "--sandbox", sandbox, c.env.ImagePath),
+		e2e.ExpectExit(0),
+	)
+
+	tests := []struct {
+		name    string
+		command string
+		argv    []string
+		exit    int
+		wantErr string
+	}{
+		{
+			name:    "ExecSIF",
+			command: "exec",
+			argv:    []string{"--rootfs-ro-check", c.env.ImagePath, "true"},
+		},
+		{
+			name:    "ExecSIFExitCode",
+			command: "exec",
+			argv:    []string{"--rootfs-ro-check", c.env.ImagePath, "/bin/sh", "-c", "exit 3"},
+			exit:    3,
+		},
+		{
+			name:    "RunSandbox",
+			command: "run",
+			argv:    []string{"--rootfs-ro-check", sandbox},
+		},
+		{
+			name:    "ExecSandboxWritableTmpfs",
+			command: "exec",
+			argv:    []string{"--rootfs-ro-check", "--writable-tmpfs", sandbox, "touch", "/tmpfs_marker"},
+		},
+		{
+			// the run didn't modify the image but could have
+			name:    "ExecSandboxWritable",
+			command: "exec",
+			argv:    []string{"--rootfs-ro-check", "--writable", sandbox, "true"},
+			exit:    255,
+			wantErr: "was mounted writable by --writable",
+		},
+		{
+			name:    "ExecSandboxWritableModified",
+			command: "exec",
+			argv:    []string{"--rootfs-ro-check", "--writable", sandbox, "touch", "/writable_marker"},
+			exit:    255,
+			wantErr: "was modified by the run",
+		},
+		{
+			// the image is modified through a bind mount of itself
+			name:    "ExecSandboxBindModified",
+			command: "exec",
+			argv:    []string{"--rootfs-ro-check", "--bind", sandbox + ":/mnt", sandbox, "touch", "/mnt/bind_marker"},
+			exit:    255,
+			wantErr: "was modified by the run",
+		},
+	}
+
+	for _, tt := range tests {
+		var ops []e2e.SingularityCmdResultOp
+		if tt.wantErr != "" {
+			ops = append(ops, e2e.ExpectError(e2e.ContainMatch, tt.wantErr))
+		}
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand(tt.command),
+			e2e.WithArgs(tt.argv...),
+			e2e.ExpectExit(tt.exit, ops...),
+		)
+	}
+}
+
+// ociBundle tests the actions against an OCI bundle directory: the bundle
+// process environment, working directory and arguments apply, bundle binds
+// are mounted and modifications are discarded unless --writable is set.
+func (c actionTests) ociBundle(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	tmpDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "oci-bundle-", "")
+	defer cleanup(t)
+
+	bundle := filepath.Join(tmpDir, "bundle")
+	rootfs := filepath.Join(bundle, "rootfs")
+	c.env.RunSingularity(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--force", "--sandbox", rootfs, c.env.ImagePath),
+		e2e.ExpectExit(0),
+	)
+	for _, dir := range []string{"srv", "data"} {
+		if err := os.MkdirAll(filepath.Join(rootfs, dir), 0755); err != nil {
+			t.Fatalf("failed to create /%s in bundle: %s", dir, err)
+		}
+	}
+
+	data := filepath.Join(bundle, "data")
+	if err := os.Mkdir(data, 0755); err != nil {
+		t.Fatalf("failed to create %s: %s", data, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(data, "file"), []byte("bundle data"), 0644); err != nil {
+		t.Fatalf("failed to create data file: %s", err)
+	}
+
+	config := `{
+	"ociVersion": "1.0.2",
+	"root": {"path": "rootfs"},
+	"process": {
+		"args": ["/bin/echo", "bundle"],
+		"env": ["PATH=/bin:/usr/bin", "BUNDLE_VAR=bundle"],
+		"cwd": "/srv"
+	},
+	"mounts": [
+		{"destination": "/proc", "type": "proc", "source": "proc"},
+		{"destination": "/data", "type": "bind", "source": "data", "options": ["rbind", "ro"]}
+	]
+}`
+	if err := ioutil.WriteFile(filepath.Join(bundle, "config.json"), []byte(config), 0644); err != nil {
+		t.Fatalf("failed to write bundle configuration: %s", err)
+	}
+
+	tests := []struct {
+		name    string
+		command string
+		argv    []string
+		env     []string
+		exit    int
+		wantOut string
+	}{
+		{
+			name:    "RunArgs",
+			command: "run",
+			argv:    []string{bundle, "arg"},
+			wantOut: "bundle arg",
+		},
+		{
+			name:    "Env",
+			command: "exec",
+			argv:    []string{bundle, "/bin/sh", "-c", "echo $BUNDLE_VAR"},
+			wantOut: "bundle",
+		},
+		{
+			name:    "EnvOverride",
+			command: "exec",
+			argv:    []string{"--env", "BUNDLE_VAR=user", bundle, "/bin/sh", "-c", "echo $BUNDLE_VAR"},
+			wantOut: "user",
+		},
+		{
+			name:    "HostEnv",
+			command: "exec",
+			argv:    []string{bundle, "/bin/sh", "-c", "echo $BUNDLE_VAR"},
+			env:     []string{"BUNDLE_VAR=host"},
+			wantOut: "bundle",
+		},
+		{
+			name:    "Cwd",
+			command: "exec",
+			argv:    []string{bundle, "pwd"},
+			wantOut: "/srv",
+		},
+		{
+			name:    "CwdOverride",
+			command: "exec",
+			argv:    []string{"--pwd", "/", bundle, "pwd"},
+			wantOut: "/",
+		},
+		{
+			name:    "Bind",
+			command: "exec",
+			argv:    []string{bundle, "cat", "/data/file"},
+			wantOut: "bundle data",
+		},
+		{
+			name:    "BindOverride",
+			command: "exec",
+			argv:    []string{"--bind", tmpDir + ":/data", bundle, "test", "-d", "/data/bundle"},
+		},
+		{
+			name:    "Ephemeral",
+			command: "exec",
+			argv:    []string{bundle, "touch", "/srv/ephemeral"},
+		},
+		{
+			name:    "Writable",
+			command: "exec",
+			argv:    []string{"--writable", bundle, "touch", "/srv/writable"},
+		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand(tt.command),
+			e2e.WithArgs(tt.argv...),
+			e2e.WithEnv(append(os.Environ(), tt.env...)),
+			e2e.ExpectExit(tt.exit, e2e.ExpectOutput(e2e.ExactMatch, tt.wantOut)),
+		)
+	}
+
+	if _, err := os.Stat(filepath.Join(rootfs, "srv", "ephemeral")); !os.IsNotExist(err) {
+		t.Errorf("modification of the bundle root filesystem wasn't discarded")
+	}
+	if _, err := os.Stat(filepath.Join(rootfs, "srv", "writable")); err != nil {
+		t.Errorf("modification of the bundle root filesystem with --writable was discarded: %s", err)
+	}
 }
 
 // E2ETests is the main func to trigger the test suite
@@ -2105,10 +4354,39 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 		"issue 5455":            c.issue5455,           // https://github.com/sylabs/singularity/issues/5455
 		"issue 5631":            c.issue5631,           // https://github.com/sylabs/singularity/issues/5631
 		"network":               c.actionNetwork,       // test basic networking
+		"network ipv6":          c.actionNetworkIPv6,   // test IPv6 networking
 		"binds":                 c.actionBinds,         // test various binds
-		"exit and signals":      c.exitSignals,         // test exit and signals propagation
+		"exit and signals":      c.exitSignals,         // test exit and signals propagation, with and without --no-fork
 		"fuse mount":            c.fuseMount,           // test fusemount option
 		"bind image":            c.bindImage,           // test bind image
+		"bind file over file":   c.bindFileOverFile,    // test file over file bind
+		"bind optional":         c.bindOptional,        // test optional binds
+		"bind glob":             c.bindGlob,            // test wildcard bind sources
+		"bind idmap":            c.bindIDMap,           // test idmapped binds
+		"bind chown":            c.bindChown,           // test chown bind option
+		"bind acl":              c.bindACL,             // test ACLs of binds
+		"bind resolv.conf":      c.bindResolvConf,      // test user bind of /etc/resolv.conf
+		"app data":              c.appData,             // test --app data directory backing
+		"app data quota":        c.appDataQuota,        // test --scif-data-quota size limit
+		"bind symlink dest":     c.bindSymlinkDest,     // test bind destination symlinks are contained
+		"bind symlink escape":   c.bindSymlinkEscape,   // test crafted image symlinks are never followed outside
+		"oci bundle":            c.ociBundle,           // test actions against an OCI bundle directory
 		"umask":                 c.actionUmask,         // test umask propagation
+		"shm size":              c.actionShmSize,       // test /dev/shm sizing
+		"tmp mount":             c.actionTmpMount,      // test --tmp and --var-tmp
+		"no pivot":              c.actionNoPivot,       // test --no-pivot
+		"dry run":               c.actionDryRun,        // test --dry-run option validation
+		"read only":             c.actionReadOnly,      // test --read-only
+		"cuda driver":           c.actionCudaDriver,    // test --nv CUDA driver version check
+		"nv mig":                c.actionNvMIG,         // test --nv MIG device nodes
+		"device":                c.actionDevice,        // test --device read-only block device
+		"session dir":           c.actionSessionDir,    // test sessiondir size and SINGULARITY_SESSIONDIR
+		"pid file":              c.actionPidFile,       // test --pid-file
+		"bind cgroups":          c.actionBindCgroups,   // test --bind-cgroups
+		"timeout":               c.actionTimeout,       // test --timeout and --max-output
+		"rlimit":                c.actionRlimit,        // test --rlimit resource limits
+		"pty":                   c.actionPty,           // test --pty and --no-pty
+		"rootfs ro check":       c.actionRootfsROCheck, // test --rootfs-ro-check
+		"block device":          c.actionBlockDevice,   // test block device images
 	}
 }
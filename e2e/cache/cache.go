@@ -6,8 +6,15 @@
 package cache
 
 import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
 	"path"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/sylabs/scs-library-client/client"
@@ -254,6 +261,346 @@ func (c cacheTests) testInteractiveCacheCmds(t *testing.T) {
 	}
 }
 
+// testAddCacheCmd checks that 'cache add' registers a local SIF image in the
+// cache, as if it was pulled from the library.
+func (c cacheTests) testAddCacheCmd(t *testing.T) {
+	cacheDir, cleanup := e2e.MakeCacheDir(t, "")
+	defer cleanup(t)
+
+	ensureNotCached(t, "cache add", c.env.ImagePath, cacheDir)
+
+	c.env.ImgCacheDir = cacheDir
+	for _, name := range []string{"add", "add again"} {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("cache"),
+			e2e.WithArgs("add", c.env.ImagePath),
+			e2e.ExpectExit(0),
+		)
+	}
+	ensureCached(t, "cache add", c.env.ImagePath, cacheDir)
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("list"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("cache"),
+		e2e.WithArgs("list", "--type", "library"),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.ContainMatch, "There are 1 container file"),
+		),
+	)
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("not a SIF"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("cache"),
+		e2e.WithArgs("add", "/etc/passwd"),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "is not a SIF image"),
+		),
+	)
+}
+
+// testVerifyCacheCmd checks that 'cache verify' reports the source of the
+// entries and detects an entry whose content was modified.
+func (c cacheTests) testVerifyCacheCmd(t *testing.T) {
+	cacheDir, cleanup := e2e.MakeCacheDir(t, "")
+	defer cleanup(t)
+
+	c.env.ImgCacheDir = cacheDir
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("add"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("cache"),
+		e2e.WithArgs("add", c.env.ImagePath),
+		e2e.ExpectExit(0),
+	)
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("verify"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("cache"),
+		e2e.WithArgs("verify", "--type", "library"),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.ContainMatch, c.env.ImagePath),
+			e2e.ExpectOutput(e2e.ContainMatch, "Verified 1 cache entries"),
+		),
+	)
+
+	shasum, err := client.ImageHash(c.env.ImagePath)
+	if err != nil {
+		t.Fatalf("couldn't compute hash of image %s: %v", c.env.ImagePath, err)
+	}
+	cacheImagePath := filepath.Join(cacheDir, cache.SubDirName, "library", shasum)
+	if err := ioutil.WriteFile(cacheImagePath, []byte("corrupted"), 0600); err != nil {
+		t.Fatalf("while corrupting cache entry %s: %s", cacheImagePath, err)
+	}
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("verify corrupted"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("cache"),
+		e2e.WithArgs("verify", "--type", "library"),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectOutput(e2e.ContainMatch, "FAILED"),
+			e2e.ExpectError(e2e.ContainMatch, "1 of 1 cache entries failed verification"),
+		),
+	)
+}
+
+// testExportImportCacheCmd checks that 'cache import' restores the entries
+// and manifests written by 'cache export' into a fresh cache, and that
+// corrupted entries are neither exported nor imported.
+func (c cacheTests) testExportImportCacheCmd(t *testing.T) {
+	srcDir, cleanupSrc := e2e.MakeCacheDir(t, "")
+	defer cleanupSrc(t)
+	dstDir, cleanupDst := e2e.MakeCacheDir(t, "")
+	defer cleanupDst(t)
+	tmpDir, cleanupTmp := e2e.MakeTempDir(t, c.env.TestDir, "cache-archive-", "")
+	defer cleanupTmp(t)
+
+	archive := filepath.Join(tmpDir, "cache.tar")
+
+	c.env.ImgCacheDir = srcDir
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("add"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("cache"),
+		e2e.WithArgs("add", c.env.ImagePath),
+		e2e.ExpectExit(0),
+	)
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("export"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("cache"),
+		e2e.WithArgs("export", archive),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectError(e2e.ContainMatch, "Exported 2 cache entries"),
+		),
+	)
+
+	c.env.ImgCacheDir = dstDir
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("import"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("cache"),
+		e2e.WithArgs("import", archive),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectError(e2e.ContainMatch, "Imported 2 cache entries"),
+		),
+	)
+
+	// the entries and their manifest, with the source, are restored
+	for _, cacheType := range []string{cache.LibraryCacheType, cache.OrasCacheType} {
+		entries, err := ioutil.ReadDir(filepath.Join(dstDir, cache.SubDirName, cacheType))
+		if err != nil {
+			t.Fatalf("while reading %s cache: %s", cacheType, err)
+		}
+		if len(entries) != 1 {
+			t.Fatalf("got %d %s cache entries, want 1", len(entries), cacheType)
+		}
+		manifest := filepath.Join(dstDir, cache.SubDirName, "manifests", cacheType, entries[0].Name()+".json")
+		if !fs.IsFile(manifest) {
+			t.Errorf("manifest %s of imported %s cache entry is missing", manifest, cacheType)
+		}
+	}
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("verify imported"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("cache"),
+		e2e.WithArgs("verify"),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.ContainMatch, c.env.ImagePath),
+			e2e.ExpectOutput(e2e.ContainMatch, "Verified 2 cache entries"),
+		),
+	)
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("import again"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("cache"),
+		e2e.WithArgs("import", archive),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectError(e2e.ContainMatch, "Imported 0 cache entries from "+archive+", 2 already cached"),
+		),
+	)
+
+	// an archive whose entry was modified is rejected by a fresh cache
+	tampered := filepath.Join(tmpDir, "tampered.tar")
+	tamperCacheArchive(t, archive, tampered)
+
+	emptyDir, cleanupEmpty := e2e.MakeCacheDir(t, "")
+	defer cleanupEmpty(t)
+	c.env.ImgCacheDir = emptyDir
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("import tampered"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("cache"),
+		e2e.WithArgs("import", tampered),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "hash does not match"),
+		),
+	)
+	ensureEmptyCache(t, emptyDir)
+
+	// a corrupted entry isn't exported
+	shasum, err := client.ImageHash(c.env.ImagePath)
+	if err != nil {
+		t.Fatalf("couldn't compute hash of image %s: %v", c.env.ImagePath, err)
+	}
+	cacheImagePath := filepath.Join(srcDir, cache.SubDirName, "library", shasum)
+	if err := ioutil.WriteFile(cacheImagePath, []byte("corrupted"), 0600); err != nil {
+		t.Fatalf("while corrupting cache entry %s: %s", cacheImagePath, err)
+	}
+	c.env.ImgCacheDir = srcDir
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("export corrupted"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("cache"),
+		e2e.WithArgs("export", filepath.Join(tmpDir, "corrupted.tar")),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "hash does not match"),
+		),
+	)
+	if fs.IsFile(filepath.Join(tmpDir, "corrupted.tar")) {
+		t.Errorf("failed export left an archive behind")
+	}
+}
+
+// tamperCacheArchive copies the cache archive src to dst, altering the
+// first byte of the first cache entry.
+func tamperCacheArchive(t *testing.T, src, dst string) {
+	in, err := os.Open(src)
+	if err != nil {
+		t.Fatalf("while opening %s: %s", src, err)
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		t.Fatalf("while creating %s: %s", dst, err)
+	}
+	defer out.Close()
+
+	tr := tar.NewReader(in)
+	tw := tar.NewWriter(out)
+	tampered := false
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("while reading %s: %s", src, err)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("while reading %s: %s", src, err)
+		}
+		if !tampered && len(data) > 0 && !strings.HasPrefix(hdr.Name, "manifests/") {
+			data[0] ^= 0xff
+			tampered = true
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("while writing %s: %s", dst, err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatalf("while writing %s: %s", dst, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("while writing %s: %s", dst, err)
+	}
+	if !tampered {
+		t.Fatalf("no cache entry found in %s", src)
+	}
+}
+
+// testBuildDisableCache checks that a build without cache, requested with
+// --disable-cache or globally with SINGULARITY_DISABLE_CACHE, leaves the
+// persistent cache untouched.
+func (c cacheTests) testBuildDisableCache(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         []string
+		disableCache bool
+	}{
+		{
+			name: "disable cache flag",
+			args: []string{"--disable-cache"},
+		},
+		{
+			name:         "disable cache env",
+			disableCache: true,
+		},
+	}
+
+	for _, tt := range tests {
+		cacheDir, cleanup := e2e.MakeCacheDir(t, c.env.TestDir)
+		defer cleanup(t)
+
+		imageDir, imageCleanup := e2e.MakeTempDir(t, c.env.TestDir, "build-", "")
+		defer imageCleanup(t)
+
+		c.env.ImgCacheDir = cacheDir
+		c.env.DisableCache = tt.disableCache
+
+		args := append(tt.args, filepath.Join(imageDir, imgName), imgURL)
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("build"),
+			e2e.WithArgs(args...),
+			e2e.PostRun(func(t *testing.T) {
+				ensureEmptyCache(t, cacheDir)
+			}),
+			e2e.ExpectExit(0),
+		)
+	}
+}
+
+// ensureEmptyCache checks the cache doesn't hold any entry
+func ensureEmptyCache(t *testing.T, cacheParentDir string) {
+	cacheRoot := filepath.Join(cacheParentDir, cache.SubDirName)
+	err := filepath.Walk(cacheRoot, func(path string, fi os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		// the cache type directories are created with the cache
+		if path != cacheRoot && filepath.Dir(path) != cacheRoot {
+			t.Errorf("unexpected cache entry %s", path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("while walking cache %s: %s", cacheRoot, err)
+	}
+}
+
 // ensureNotCached checks the entry related to an image is not in the cache
 func ensureNotCached(t *testing.T, testName string, imagePath string, cacheParentDir string) {
 	shasum, err := client.ImageHash(imagePath)
@@ -286,6 +633,127 @@ func ensureCached(t *testing.T, testName string, imagePath string, cacheParentDi
 	}
 }
 
+// testImageUsage checks the usage statistics of the images run, recorded
+// for the cache entries by default and also for local images if the image
+// usage stats directive is set to all.
+func (c cacheTests) testImageUsage(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	setDirective := func(t *testing.T, value string) {
+		c.env.RunSingularity(
+			t,
+			e2e.WithProfile(e2e.RootProfile),
+			e2e.WithCommand("config global"),
+			e2e.WithArgs("--set", "image usage stats", value),
+			e2e.ExpectExit(0),
+		)
+	}
+	defer c.env.RunSingularity(
+		t,
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("config global"),
+		e2e.WithArgs("--reset", "image usage stats"),
+		e2e.ExpectExit(0),
+	)
+
+	cacheDir, cleanup := e2e.MakeCacheDir(t, c.env.TestDir)
+	defer cleanup(t)
+	c.env.ImgCacheDir = cacheDir
+
+	// a copy of the test image has a path unique to this test
+	imageDir, cleanupImage := e2e.MakeTempDir(t, c.env.TestDir, "usage-", "image usage")
+	defer cleanupImage(t)
+	localImage := filepath.Join(imageDir, "local.sif")
+	if err := fs.CopyFile(c.env.ImagePath, localImage, 0755); err != nil {
+		t.Fatalf("while copying test image: %s", err)
+	}
+	shasum, err := client.ImageHash(localImage)
+	if err != nil {
+		t.Fatalf("couldn't compute hash of image %s: %v", localImage, err)
+	}
+	cachedImage := filepath.Join(cacheDir, cache.SubDirName, cache.LibraryCacheType, shasum)
+
+	c.env.RunSingularity(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("cache add"),
+		e2e.WithArgs(localImage),
+		e2e.ExpectExit(0),
+	)
+
+	run := func(t *testing.T, image string) {
+		c.env.RunSingularity(
+			t,
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(image, "true"),
+			e2e.ExpectExit(0),
+		)
+	}
+	usageLine := func(count int, imageType, image string) string {
+		return fmt.Sprintf(`(?m)^%d\s+\S+ \S+\s+%s\s+%s$`, count, imageType, regexp.QuoteMeta(image))
+	}
+	notListed := func(image string) e2e.SingularityCmdResultOp {
+		return func(t *testing.T, r *e2e.SingularityCmdResult) {
+			if strings.Contains(string(r.Stdout), image) {
+				t.Errorf("unexpected usage of %s in output:\n%s", image, r.Stdout)
+			}
+		}
+	}
+
+	// default: only the cache entries are recorded
+	run(t, cachedImage)
+	run(t, localImage)
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("cache"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("cache stats"),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.RegexMatch, usageLine(1, cache.LibraryCacheType, cachedImage)),
+			notListed(localImage),
+		),
+	)
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("list verbose"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("cache list"),
+		e2e.WithArgs("--verbose", "--type", cache.LibraryCacheType),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.ContainMatch, "LAST USED"),
+		),
+	)
+
+	setDirective(t, "all")
+	run(t, localImage)
+	run(t, localImage)
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("all"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("cache stats"),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.RegexMatch, usageLine(2, "local", localImage)),
+		),
+	)
+
+	setDirective(t, "no")
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("disabled"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("cache stats"),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "disabled"),
+		),
+	)
+}
+
 // E2ETests is the main func to trigger the test suite
 func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	c := cacheTests{
@@ -297,7 +765,12 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	return testhelper.Tests{
 		"interactive commands":     np(c.testInteractiveCacheCmds),
 		"non-interactive commands": np(c.testNoninteractiveCacheCmds),
+		"add command":              np(c.testAddCacheCmd),
+		"verify command":           np(c.testVerifyCacheCmd),
+		"export import commands":   np(c.testExportImportCacheCmd),
+		"build disable cache":      np(c.testBuildDisableCache),
 		"issue5097":                np(c.issue5097),
 		"issue5350":                np(c.issue5350),
+		"image usage":              np(c.testImageUsage),
 	}
 }
@@ -6,8 +6,13 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/sylabs/singularity/e2e/internal/e2e"
@@ -57,8 +62,11 @@ func (c configTests) configGlobal(t *testing.T) {
 		cwd               string
 		directive         string
 		directiveValue    string
-		exit              int
-		resultOp          e2e.SingularityCmdResultOp
+		// extraDirective is set to extraValue along with directive
+		extraDirective string
+		extraValue     string
+		exit           int
+		resultOp       e2e.SingularityCmdResultOp
 	}{
 		{
 			name: "AllowSetuid",
@@ -376,6 +384,110 @@ func (c configTests) configGlobal(t *testing.T) {
 			directiveValue: "yes",
 			exit:           0,
 		},
+		{
+			// the alpine test image holds the setuid /bin/bbsuid
+			name:           "DenySetuidBinariesAllowSetuid",
+			argv:           []string{"--allow-setuid", c.env.ImagePath, "true"},
+			profile:        e2e.RootProfile,
+			directive:      "deny setuid binaries",
+			directiveValue: "yes",
+			exit:           255,
+			resultOp:       e2e.ExpectError(e2e.ContainMatch, "Setuid binaries are denied by the configuration"),
+		},
+		{
+			name:           "DenySetuidBinariesOverride",
+			argv:           []string{"--allow-setuid", "--override-setuid-policy", c.env.ImagePath, "true"},
+			profile:        e2e.RootProfile,
+			directive:      "deny setuid binaries",
+			directiveValue: "yes",
+			exit:           0,
+		},
+		{
+			name:           "DenySetuidBinariesNo",
+			argv:           []string{"--allow-setuid", c.env.ImagePath, "true"},
+			profile:        e2e.RootProfile,
+			directive:      "deny setuid binaries",
+			directiveValue: "no",
+			exit:           0,
+			resultOp:       e2e.ExpectError(e2e.ContainMatch, "setuid files which run with elevated privileges"),
+		},
+		{
+			name:           "BindProfileBind",
+			argv:           []string{"--profile", "e2e", c.env.ImagePath, "test", "-f", "/profile-hosts"},
+			profile:        e2e.UserProfile,
+			directive:      "bind profile",
+			directiveValue: "e2e bind = /etc/hosts:/profile-hosts:ro",
+			exit:           0,
+		},
+		{
+			name:           "BindProfileEnv",
+			argv:           []string{"--profile", "e2e", "--env", "E2E_USER=user", c.env.ImagePath, "sh", "-c", `test "$E2E_PROFILE" = "a,b" && test "$E2E_USER" = "user"`},
+			profile:        e2e.UserProfile,
+			directive:      "bind profile",
+			directiveValue: "e2e env = E2E_PROFILE=a,b",
+			exit:           0,
+		},
+		{
+			name:           "BindProfileEnvOverride",
+			argv:           []string{"--profile", "e2e", "--env", "E2E_PROFILE=user", c.env.ImagePath, "sh", "-c", `test "$E2E_PROFILE" = "user"`},
+			profile:        e2e.UserProfile,
+			directive:      "bind profile",
+			directiveValue: "e2e env = E2E_PROFILE=a,b",
+			exit:           0,
+		},
+		{
+			name:           "BindProfileLdPath",
+			argv:           []string{"--profile", "e2e", c.env.ImagePath, "sh", "-c", `case "$LD_LIBRARY_PATH" in */.singularity.d/libs*:/opt/e2e/lib) exit 0;; esac; exit 1`},
+			profile:        e2e.UserProfile,
+			directive:      "bind profile",
+			directiveValue: "e2e ld path = /opt/e2e/lib",
+			exit:           0,
+		},
+		{
+			name:           "BindProfileLdPathUser",
+			argv:           []string{"--profile", "e2e", "--env", "LD_LIBRARY_PATH=/opt/user/lib", c.env.ImagePath, "sh", "-c", `case "$LD_LIBRARY_PATH" in /opt/user/lib*:/opt/e2e/lib) exit 0;; esac; exit 1`},
+			profile:        e2e.UserProfile,
+			directive:      "bind profile",
+			directiveValue: "e2e ld path = /opt/e2e/lib",
+			exit:           0,
+		},
+		{
+			name:           "BindProfileUserBindControlNo",
+			argv:           []string{"--profile", "e2e", c.env.ImagePath, "test", "-f", "/profile-hosts"},
+			profile:        e2e.UserProfile,
+			directive:      "user bind control",
+			directiveValue: "no",
+			extraDirective: "bind profile",
+			extraValue:     "e2e bind = /etc/hosts:/profile-hosts:ro",
+			exit:           0,
+		},
+		{
+			name:           "BindProfileDryRun",
+			argv:           []string{"--dry-run", "--profile", "e2e", c.env.ImagePath, "true"},
+			profile:        e2e.UserProfile,
+			directive:      "bind profile",
+			directiveValue: "e2e env = E2E_PROFILE=a,b",
+			exit:           0,
+			resultOp:       e2e.ExpectError(e2e.ContainMatch, "Profile e2e: environment variable E2E_PROFILE=a,b"),
+		},
+		{
+			name:           "BindProfileUnknown",
+			argv:           []string{"--profile", "missing", c.env.ImagePath, "true"},
+			profile:        e2e.UserProfile,
+			directive:      "bind profile",
+			directiveValue: "e2e env = E2E_PROFILE=a,b",
+			exit:           255,
+			resultOp:       e2e.ExpectError(e2e.ContainMatch, `profile "missing" is not defined`),
+		},
+		{
+			name:           "BindProfileInvalid",
+			argv:           []string{c.env.ImagePath, "true"},
+			profile:        e2e.UserProfile,
+			directive:      "bind profile",
+			directiveValue: "e2e mount = /opt",
+			exit:           255,
+			resultOp:       e2e.ExpectError(e2e.ContainMatch, `bind profile = e2e mount = /opt: unknown directive "mount"`),
+		},
 	}
 
 	for _, tt := range tests {
@@ -389,9 +501,15 @@ func (c configTests) configGlobal(t *testing.T) {
 					tt.addRequirementsFn(t)
 				}
 				setDirective(t, tt.directive, tt.directiveValue)
+				if tt.extraDirective != "" {
+					setDirective(t, tt.extraDirective, tt.extraValue)
+				}
 			}),
 			e2e.PostRun(func(t *testing.T) {
 				resetDirective(t, tt.directive)
+				if tt.extraDirective != "" {
+					resetDirective(t, tt.extraDirective)
+				}
 			}),
 			e2e.WithCommand("exec"),
 			e2e.WithArgs(tt.argv...),
@@ -460,6 +578,301 @@ func (c configTests) configFile(t *testing.T) {
 	}
 }
 
+func (c configTests) configHostHooks(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	dir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "host-hooks-", "")
+	defer e2e.Privileged(cleanup)(t)
+
+	stateFile := filepath.Join(dir, "state.json")
+
+	// hooks are created by root as they must be owned by root
+	// in the setuid workflow
+	writeHook := func(t *testing.T, name, script string) string {
+		path := filepath.Join(dir, name)
+		e2e.Privileged(func(t *testing.T) {
+			if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+				t.Fatalf("could not write hook %s: %s", path, err)
+			}
+		})(t)
+		return path
+	}
+	stateHook := writeHook(t, "state", fmt.Sprintf("cat > %s\n", stateFile))
+	failHook := writeHook(t, "fail", "echo 'no scratch quota available' >&2\nexit 1\n")
+	sleepHook := writeHook(t, "sleep", "sleep 60\n")
+
+	u := e2e.UserProfile.HostUser(t)
+
+	// checkState checks the container state received by the hook
+	checkState := func(exitCode *int) func(*testing.T) {
+		return func(t *testing.T) {
+			b, err := ioutil.ReadFile(stateFile)
+			if err != nil {
+				t.Fatalf("could not read container state: %s", err)
+			}
+			var state struct {
+				Image string `json:"image"`
+				User  struct {
+					UID uint32 `json:"uid"`
+				} `json:"user"`
+				Namespaces []interface{} `json:"namespaces"`
+				ExitCode   *int          `json:"exitCode"`
+			}
+			if err := json.Unmarshal(b, &state); err != nil {
+				t.Fatalf("could not decode container state %q: %s", b, err)
+			}
+			if state.Image != c.env.ImagePath {
+				t.Errorf("unexpected image %q in container state", state.Image)
+			}
+			if state.User.UID != u.UID {
+				t.Errorf("unexpected user ID %d in container state", state.User.UID)
+			}
+			if state.Namespaces == nil {
+				t.Errorf("missing namespaces in container state")
+			}
+			switch {
+			case exitCode == nil && state.ExitCode != nil:
+				t.Errorf("unexpected exit code %d in container state", *state.ExitCode)
+			case exitCode != nil && (state.ExitCode == nil || *state.ExitCode != *exitCode):
+				t.Errorf("missing exit code %d in container state", *exitCode)
+			}
+		}
+	}
+	exitCode := 3
+
+	tests := []struct {
+		name       string
+		argv       []string
+		directives map[string]string
+		exit       int
+		resultOp   e2e.SingularityCmdResultOp
+		check      func(*testing.T)
+	}{
+		{
+			name:       "PrestartState",
+			argv:       []string{c.env.ImagePath, "true"},
+			directives: map[string]string{"prestart host hook": stateHook},
+			exit:       0,
+			check:      checkState(nil),
+		},
+		{
+			name:       "PrestartFailure",
+			argv:       []string{c.env.ImagePath, "true"},
+			directives: map[string]string{"prestart host hook": failHook},
+			exit:       255,
+			resultOp:   e2e.ExpectError(e2e.ContainMatch, "no scratch quota available"),
+		},
+		{
+			name: "PrestartTimeout",
+			argv: []string{c.env.ImagePath, "true"},
+			directives: map[string]string{
+				"prestart host hook": sleepHook,
+				"host hook timeout":  "1",
+			},
+			exit:     255,
+			resultOp: e2e.ExpectError(e2e.ContainMatch, "prestart host hook timed out"),
+		},
+		{
+			name:       "PoststopState",
+			argv:       []string{c.env.ImagePath, "/bin/sh", "-c", "exit 3"},
+			directives: map[string]string{"poststop host hook": stateHook},
+			exit:       3,
+			check:      checkState(&exitCode),
+		},
+		{
+			name:       "PoststopFailure",
+			argv:       []string{c.env.ImagePath, "true"},
+			directives: map[string]string{"poststop host hook": failHook},
+			exit:       0,
+		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.PreRun(func(t *testing.T) {
+				e2e.Privileged(func(t *testing.T) {
+					os.Remove(stateFile)
+				})(t)
+				for directive, value := range tt.directives {
+					c.env.RunSingularity(
+						t,
+						e2e.WithProfile(e2e.RootProfile),
+						e2e.WithCommand("config global"),
+						e2e.WithArgs("--set", directive, value),
+						e2e.ExpectExit(0),
+					)
+				}
+			}),
+			e2e.PostRun(func(t *testing.T) {
+				for directive := range tt.directives {
+					c.env.RunSingularity(
+						t,
+						e2e.WithProfile(e2e.RootProfile),
+						e2e.WithCommand("config global"),
+						e2e.WithArgs("--reset", directive),
+						e2e.ExpectExit(0),
+					)
+				}
+				if tt.check != nil && !t.Failed() {
+					tt.check(t)
+				}
+			}),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(tt.argv...),
+			e2e.ExpectExit(tt.exit, tt.resultOp),
+		)
+	}
+}
+
+func (c configTests) configEventLog(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	dir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "event-log-", "")
+	defer e2e.Privileged(cleanup)(t)
+
+	eventLog := filepath.Join(dir, "events.log")
+
+	u := e2e.UserProfile.HostUser(t)
+
+	type event struct {
+		Event    string `json:"event"`
+		Pid      int    `json:"pid"`
+		Image    string `json:"image"`
+		UID      uint32 `json:"uid"`
+		ExitCode *int   `json:"exitCode"`
+		Signal   int    `json:"signal"`
+		Rusage   *struct {
+			UserTime   float64 `json:"userTime"`
+			SystemTime float64 `json:"systemTime"`
+			MaxRSS     int64   `json:"maxRSS"`
+		} `json:"rusage"`
+	}
+
+	// the container command prints its PID and burns CPU time, which
+	// must be accounted in the resource usage of the stop event
+	payload := `echo $$; i=0; while [ $i -lt 200000 ]; do i=$((i+1)); done; `
+	var payloadPid int
+	savePid := func(t *testing.T, r *e2e.SingularityCmdResult) {
+		fields := strings.Fields(string(r.Stdout))
+		if len(fields) == 0 {
+			t.Fatalf("missing container command PID in output")
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			t.Fatalf("invalid container command PID %q: %s", fields[0], err)
+		}
+		payloadPid = pid
+	}
+
+	// checkEvents checks the start and stop events of the container
+	checkEvents := func(exitCode, signal int) func(*testing.T) {
+		return func(t *testing.T) {
+			var b []byte
+			e2e.Privileged(func(t *testing.T) {
+				var err error
+				if b, err = ioutil.ReadFile(eventLog); err != nil {
+					t.Fatalf("could not read event log: %s", err)
+				}
+			})(t)
+			var events []event
+			for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+				var ev event
+				if err := json.Unmarshal([]byte(line), &ev); err != nil {
+					t.Fatalf("could not decode event %q: %s", line, err)
+				}
+				events = append(events, ev)
+			}
+			if len(events) != 2 || events[0].Event != "start" || events[1].Event != "stop" {
+				t.Fatalf("unexpected events %q", b)
+			}
+			for _, ev := range events {
+				if ev.Image != c.env.ImagePath || ev.UID != u.UID {
+					t.Errorf("unexpected %s event %+v", ev.Event, ev)
+				}
+				// the event PID is the one of the container command
+				if ev.Pid != payloadPid {
+					t.Errorf("got PID %d in %s event, want container command PID %d", ev.Pid, ev.Event, payloadPid)
+				}
+			}
+			stop := events[1]
+			if stop.ExitCode == nil || *stop.ExitCode != exitCode || stop.Signal != signal {
+				t.Errorf("unexpected exit status in stop event %q", b)
+			}
+			// wait4 of the container command accounts for its CPU time
+			if ru := stop.Rusage; ru == nil {
+				t.Errorf("missing resource usage in stop event %q", b)
+			} else if ru.UserTime+ru.SystemTime < 0.01 || ru.MaxRSS == 0 {
+				t.Errorf("resource usage of the container command not accounted in stop event %q", b)
+			}
+		}
+	}
+
+	tests := []struct {
+		name  string
+		argv  []string
+		exit  int
+		check func(*testing.T)
+	}{
+		{
+			name:  "Exit",
+			argv:  []string{c.env.ImagePath, "/bin/sh", "-c", payload + "exit 3"},
+			exit:  3,
+			check: checkEvents(3, 0),
+		},
+		{
+			name:  "NoForkExit",
+			argv:  []string{"--no-fork", c.env.ImagePath, "/bin/sh", "-c", payload + "exit 3"},
+			exit:  3,
+			check: checkEvents(3, 0),
+		},
+		{
+			name:  "Signal",
+			argv:  []string{c.env.ImagePath, "/bin/sh", "-c", payload + "kill -KILL $$"},
+			exit:  137,
+			check: checkEvents(137, 9),
+		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.PreRun(func(t *testing.T) {
+				payloadPid = 0
+				e2e.Privileged(func(t *testing.T) {
+					os.Remove(eventLog)
+				})(t)
+				c.env.RunSingularity(
+					t,
+					e2e.WithProfile(e2e.RootProfile),
+					e2e.WithCommand("config global"),
+					e2e.WithArgs("--set", "event log", eventLog),
+					e2e.ExpectExit(0),
+				)
+			}),
+			e2e.PostRun(func(t *testing.T) {
+				c.env.RunSingularity(
+					t,
+					e2e.WithProfile(e2e.RootProfile),
+					e2e.WithCommand("config global"),
+					e2e.WithArgs("--reset", "event log"),
+					e2e.ExpectExit(0),
+				)
+				if !t.Failed() {
+					tt.check(t)
+				}
+			}),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(tt.argv...),
+			e2e.ExpectExit(tt.exit, savePid),
+		)
+	}
+}
+
 // E2ETests is the main func to trigger the test suite
 func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	c := configTests{
@@ -469,7 +882,9 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	np := testhelper.NoParallel
 
 	return testhelper.Tests{
-		"config file":   c.configFile,       // test --config file option
-		"config global": np(c.configGlobal), // test various global configuration
+		"config file":   c.configFile,          // test --config file option
+		"config global": np(c.configGlobal),    // test various global configuration
+		"host hooks":    np(c.configHostHooks), // test prestart and poststop host hooks
+		"event log":     np(c.configEventLog),  // test container start and stop events
 	}
 }
@@ -6,11 +6,21 @@
 package docker
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/docker"
+	ocilayout "github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/pkg/errors"
 	"github.com/sylabs/singularity/e2e/internal/e2e"
 	"github.com/sylabs/singularity/e2e/internal/testhelper"
@@ -397,6 +407,137 @@ func (c ctx) testDockerRegistry(t *testing.T) {
 	}
 }
 
+// ociLayoutWithCommand copies the image ref to an OCI layout in dir and
+// sets its ENTRYPOINT and CMD, it returns the OCI layout reference.
+func ociLayoutWithCommand(t *testing.T, ref, dir string, entrypoint, cmd []string) string {
+	policy := &signature.Policy{Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()}}
+	policyCtx, err := signature.NewPolicyContext(policy)
+	if err != nil {
+		t.Fatalf("failed to create policy context: %s", err)
+	}
+	srcRef, err := docker.ParseReference("//" + ref)
+	if err != nil {
+		t.Fatalf("failed to parse %s: %s", ref, err)
+	}
+	dstRef, err := ocilayout.ParseReference(dir + ":latest")
+	if err != nil {
+		t.Fatalf("failed to parse %s: %s", dir, err)
+	}
+	_, err = copy.Image(context.Background(), policyCtx, dstRef, srcRef, &copy.Options{
+		ReportWriter: ioutil.Discard,
+		SourceCtx: &types.SystemContext{
+			DockerInsecureSkipTLSVerify: types.NewOptionalBool(true),
+		},
+		DestinationCtx: &types.SystemContext{},
+	})
+	if err != nil {
+		t.Fatalf("failed to copy %s to %s: %s", ref, dir, err)
+	}
+
+	blobPath := func(d digest.Digest) string {
+		return filepath.Join(dir, "blobs", d.Algorithm().String(), d.Hex())
+	}
+	readJSON := func(path string, v interface{}) {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read %s: %s", path, err)
+		}
+		if err := json.Unmarshal(b, v); err != nil {
+			t.Fatalf("failed to decode %s: %s", path, err)
+		}
+	}
+	writeBlob := func(v interface{}) imgspecv1.Descriptor {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("failed to encode blob: %s", err)
+		}
+		d := digest.FromBytes(b)
+		if err := ioutil.WriteFile(blobPath(d), b, 0644); err != nil {
+			t.Fatalf("failed to write blob: %s", err)
+		}
+		return imgspecv1.Descriptor{Digest: d, Size: int64(len(b))}
+	}
+
+	var index imgspecv1.Index
+	readJSON(filepath.Join(dir, "index.json"), &index)
+	var manifest imgspecv1.Manifest
+	readJSON(blobPath(index.Manifests[0].Digest), &manifest)
+	var config imgspecv1.Image
+	readJSON(blobPath(manifest.Config.Digest), &config)
+
+	config.Config.Entrypoint = entrypoint
+	config.Config.Cmd = cmd
+	desc := writeBlob(config)
+	manifest.Config.Digest = desc.Digest
+	manifest.Config.Size = desc.Size
+	desc = writeBlob(manifest)
+	index.Manifests[0].Digest = desc.Digest
+	index.Manifests[0].Size = desc.Size
+
+	b, err := json.Marshal(index)
+	if err != nil {
+		t.Fatalf("failed to encode index: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "index.json"), b, 0644); err != nil {
+		t.Fatalf("failed to write index: %s", err)
+	}
+	return "oci:" + dir + ":latest"
+}
+
+// testDockerEntrypointCmd checks that run combines the ENTRYPOINT and CMD
+// of a converted image like docker run.
+func (c ctx) testDockerEntrypointCmd(t *testing.T) {
+	e2e.PrepRegistry(t, c.env)
+
+	tmpDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "entrypoint-", "")
+	defer cleanup(t)
+
+	layout := ociLayoutWithCommand(
+		t,
+		"localhost:5000/my-busybox",
+		filepath.Join(tmpDir, "layout"),
+		[]string{"printf", `%s\n`, "entrypoint"},
+		[]string{"cmd", "$HOME"},
+	)
+	imagePath := filepath.Join(tmpDir, "image.sif")
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Build"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs(imagePath, layout),
+		e2e.ExpectExit(0),
+	)
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "NoArgs",
+			want: "entrypoint\ncmd\n$HOME",
+		},
+		{
+			name: "Args",
+			args: []string{"a b", "$(id)", "it's"},
+			want: "entrypoint\na b\n$(id)\nit's",
+		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("run"),
+			e2e.WithArgs(append([]string{imagePath}, tt.args...)...),
+			e2e.ExpectExit(0, e2e.ExpectOutput(e2e.ExactMatch, tt.want)),
+		)
+	}
+}
+
 // E2ETests is the main func to trigger the test suite
 func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	c := ctx{
@@ -406,6 +547,7 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	return testhelper.Tests{
 		"AUFS":             c.testDockerAUFS,
 		"def file":         c.testDockerDefFile,
+		"entrypoint cmd":   c.testDockerEntrypointCmd,
 		"permissions":      c.testDockerPermissions,
 		"pulls":            c.testDockerPulls,
 		"registry":         c.testDockerRegistry,
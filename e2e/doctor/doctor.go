@@ -0,0 +1,106 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package doctor
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sylabs/singularity/e2e/internal/e2e"
+	"github.com/sylabs/singularity/e2e/internal/testhelper"
+	"github.com/sylabs/singularity/internal/app/singularity"
+)
+
+type ctx struct {
+	env e2e.TestEnv
+}
+
+// doctorResults decodes the JSON output of the doctor command.
+func doctorResults(t *testing.T, r *e2e.SingularityCmdResult) []singularity.DoctorResult {
+	var results []singularity.DoctorResult
+	if err := json.Unmarshal(r.Stdout, &results); err != nil {
+		t.Fatalf("could not decode doctor output %q: %s", r.Stdout, err)
+	}
+	return results
+}
+
+// testDoctor checks that the host running the e2e tests is able to run
+// containers for every profile.
+func (c ctx) testDoctor(t *testing.T) {
+	for _, profile := range []e2e.Profile{e2e.UserProfile, e2e.RootProfile} {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(profile.String()),
+			e2e.WithProfile(profile),
+			e2e.WithCommand("doctor"),
+			e2e.ExpectExit(
+				0,
+				e2e.ExpectOutput(e2e.RegexMatch, `(?m)^starter\*\s+available`),
+				e2e.ExpectOutput(e2e.RegexMatch, `(?m)^smoke\*\s+available`),
+			),
+		)
+	}
+}
+
+// testDoctorJSON checks the JSON output and the feature selection.
+func (c ctx) testDoctorJSON(t *testing.T) {
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("All"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("doctor"),
+		e2e.WithArgs("--json"),
+		e2e.ExpectExit(0, func(t *testing.T, r *e2e.SingularityCmdResult) {
+			results := doctorResults(t, r)
+			for _, res := range results {
+				if res.Core && !res.Available {
+					t.Errorf("core feature %s unavailable: %s", res.Feature, res.Details)
+				}
+			}
+			if len(results) < 2 {
+				t.Errorf("unexpected results %+v", results)
+			}
+		}),
+	)
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Selected"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("doctor"),
+		e2e.WithArgs("--json", "--feature", "starter,smoke"),
+		e2e.ExpectExit(0, func(t *testing.T, r *e2e.SingularityCmdResult) {
+			results := doctorResults(t, r)
+			if len(results) != 2 || results[0].Feature != "starter" || results[1].Feature != "smoke" {
+				t.Errorf("unexpected results %+v", results)
+			}
+		}),
+	)
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Unknown"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("doctor"),
+		e2e.WithArgs("--feature", "missing"),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, `unknown feature "missing"`),
+		),
+	)
+}
+
+// E2ETests is the main func to trigger the test suite
+func E2ETests(env e2e.TestEnv) testhelper.Tests {
+	c := ctx{
+		env: env,
+	}
+
+	return testhelper.Tests{
+		"doctor":      c.testDoctor,
+		"doctor json": c.testDoctorJSON,
+	}
+}
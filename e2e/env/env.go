@@ -10,12 +10,14 @@ package singularityenv
 
 import (
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/sylabs/singularity/e2e/internal/e2e"
 	"github.com/sylabs/singularity/e2e/internal/testhelper"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
 )
 
 type ctx struct {
@@ -434,6 +436,256 @@ func (c ctx) singularityEnvFile(t *testing.T) {
 	}
 }
 
+// singularityLoaderEnv checks that the dynamic loader variables are passed
+// to the container or stripped according to the container loader env
+// directive, and that --dry-run reports them.
+func (c ctx) singularityLoaderEnv(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	tmpDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "loader-env-", "")
+	defer e2e.Privileged(cleanup)(t)
+	stripConfig := filepath.Join(tmpDir, "singularity.conf")
+
+	c.env.RunSingularity(
+		t,
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.PreRun(func(t *testing.T) {
+			// custom config file must be root owned with tight permissions
+			if err := fs.EnsureFileWithPermission(stripConfig, 0600); err != nil {
+				t.Fatalf("while creating temporary config file: %s", err)
+			}
+		}),
+		e2e.WithCommand("config global"),
+		e2e.WithGlobalOptions("--config", stripConfig),
+		e2e.WithArgs("--set", "container loader env", "strip"),
+		e2e.ExpectExit(0),
+	)
+
+	hostEnv := []string{"TZDIR=/host/zoneinfo", "SINGULARITYENV_GCONV_PATH=/host/gconv"}
+
+	tests := []struct {
+		name    string
+		config  string
+		argv    []string
+		matches []e2e.SingularityCmdResultOp
+	}{
+		{
+			name: "Pass",
+			argv: []string{c.env.ImagePath, "env"},
+			matches: []e2e.SingularityCmdResultOp{
+				e2e.ExpectOutput(e2e.ContainMatch, "TZDIR=/host/zoneinfo"),
+				e2e.ExpectOutput(e2e.ContainMatch, "GCONV_PATH=/host/gconv"),
+				e2e.ExpectOutput(e2e.ContainMatch, "LOCPATH=/env/locale"),
+			},
+		},
+		{
+			name: "PassDryRun",
+			argv: []string{"--dry-run", c.env.ImagePath, "env"},
+			matches: []e2e.SingularityCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "Environment variable TZDIR: passed to the container process, never passed to privileged helpers"),
+				e2e.ExpectError(e2e.ContainMatch, "Environment variable GCONV_PATH: passed to the container process"),
+				e2e.ExpectError(e2e.ContainMatch, "Environment variable LOCPATH: passed to the container process"),
+			},
+		},
+		{
+			name:   "Strip",
+			config: stripConfig,
+			argv:   []string{c.env.ImagePath, "env"},
+			matches: []e2e.SingularityCmdResultOp{
+				e2e.ExpectOutput(e2e.UnwantedMatch, "TZDIR="),
+				e2e.ExpectOutput(e2e.UnwantedMatch, "GCONV_PATH="),
+				e2e.ExpectOutput(e2e.UnwantedMatch, "LOCPATH="),
+			},
+		},
+		{
+			name:   "StripDryRun",
+			config: stripConfig,
+			argv:   []string{"--dry-run", c.env.ImagePath, "env"},
+			matches: []e2e.SingularityCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "Environment variable TZDIR: stripped from the container process environment (container loader env = strip)"),
+			},
+		},
+		{
+			name:   "CleanEnvDryRun",
+			config: stripConfig,
+			argv:   []string{"--dry-run", "--cleanenv", c.env.ImagePath, "env"},
+			matches: []e2e.SingularityCmdResultOp{
+				e2e.ExpectError(e2e.UnwantedMatch, "Environment variable TZDIR"),
+				e2e.ExpectError(e2e.ContainMatch, "Environment variable GCONV_PATH: stripped"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		opts := []string{}
+		if tt.config != "" {
+			opts = append(opts, "--config", tt.config)
+		}
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.RootProfile),
+			e2e.WithGlobalOptions(opts...),
+			e2e.WithCommand("exec"),
+			e2e.WithEnv(hostEnv),
+			e2e.WithArgs(append([]string{"--env", "LOCPATH=/env/locale"}, tt.argv...)...),
+			e2e.ExpectExit(0, tt.matches...),
+		)
+	}
+
+	// the keep-privs prelude and the host hooks run with privileges, they
+	// never get the loader variables passed to the container process
+	hookConfig := filepath.Join(tmpDir, "hook.conf")
+	hookEnv := filepath.Join(tmpDir, "hook.env")
+	envHook := filepath.Join(tmpDir, "env-hook")
+	c.env.RunSingularity(
+		t,
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.PreRun(func(t *testing.T) {
+			if err := fs.EnsureFileWithPermission(hookConfig, 0600); err != nil {
+				t.Fatalf("while creating temporary config file: %s", err)
+			}
+			// host hooks must be owned by root
+			if err := ioutil.WriteFile(envHook, []byte("#!/bin/sh\nenv > "+hookEnv+"\n"), 0755); err != nil {
+				t.Fatalf("while creating host hook: %s", err)
+			}
+		}),
+		e2e.WithCommand("config global"),
+		e2e.WithGlobalOptions("--config", hookConfig),
+		e2e.WithArgs("--set", "prestart host hook", envHook),
+		e2e.ExpectExit(0),
+	)
+
+	loaderEnv := []string{"LD_PRELOAD=/host/lib/libpreload.so", "LD_LIBRARY_PATH=/host/lib"}
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("PrivilegedHelpers"),
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithGlobalOptions("--config", hookConfig),
+		e2e.WithCommand("exec"),
+		e2e.WithEnv(loaderEnv),
+		e2e.WithArgs(
+			"--keep-privs-prelude", `echo "prelude ${LD_PRELOAD:-unset} ${LD_LIBRARY_PATH:-unset}"`,
+			c.env.ImagePath,
+			"sh", "-c", `echo "container $LD_PRELOAD $LD_LIBRARY_PATH"`,
+		),
+		e2e.PostRun(func(t *testing.T) {
+			b, err := ioutil.ReadFile(hookEnv)
+			if err != nil {
+				t.Fatalf("could not read host hook environment: %s", err)
+			}
+			for _, key := range []string{"LD_PRELOAD=", "LD_LIBRARY_PATH="} {
+				if strings.Contains(string(b), key) {
+					t.Errorf("host hook environment %q contains %s", b, key)
+				}
+			}
+		}),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.ContainMatch, "prelude unset unset\n"),
+			e2e.ExpectOutput(e2e.RegexMatch, `container /host/lib/libpreload.so \S*/host/lib`),
+		),
+	)
+}
+
+// singularitySanitizePath checks that PATH is reset to the default container
+// PATH with --sanitize-path or the sanitize path directive, whatever the host
+// PATH, the image environment and the SINGULARITYENV_ variables.
+func (c ctx) singularitySanitizePath(t *testing.T) {
+	imgCacheDir, cleanCache := e2e.MakeCacheDir(t, c.env.TestDir)
+	defer cleanCache(t)
+	c.env.ImgCacheDir = imgCacheDir
+
+	// This image sets a custom path.
+	customImage := "docker://sylabsio/lolcow"
+	customPath := "/usr/games:" + defaultPath
+
+	tmpDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "sanitize-path-", "")
+	defer e2e.Privileged(cleanup)(t)
+	sanitizeConfig := filepath.Join(tmpDir, "singularity.conf")
+
+	c.env.RunSingularity(
+		t,
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.PreRun(func(t *testing.T) {
+			// custom config file must be root owned with tight permissions
+			if err := fs.EnsureFileWithPermission(sanitizeConfig, 0600); err != nil {
+				t.Fatalf("while creating temporary config file: %s", err)
+			}
+		}),
+		e2e.WithCommand("config global"),
+		e2e.WithGlobalOptions("--config", sanitizeConfig),
+		e2e.WithArgs("--set", "sanitize path", "yes"),
+		e2e.ExpectExit(0),
+	)
+
+	tests := []struct {
+		name    string
+		config  string
+		options []string
+		env     []string
+		path    string
+	}{
+		{
+			name:    "ImagePath",
+			options: []string{"--sanitize-path"},
+			path:    defaultPath,
+		},
+		{
+			name:    "HostPath",
+			options: []string{"--sanitize-path"},
+			env:     []string{"PATH=/host/bin:" + os.Getenv("PATH")},
+			path:    defaultPath,
+		},
+		{
+			name:    "SingularityEnvPath",
+			options: []string{"--sanitize-path"},
+			env:     []string{"SINGULARITYENV_PREPEND_PATH=/foo", "SINGULARITYENV_APPEND_PATH=/bar"},
+			path:    defaultPath,
+		},
+		{
+			name:    "CleanEnv",
+			options: []string{"--sanitize-path", "--cleanenv"},
+			path:    defaultPath,
+		},
+		{
+			name:   "Config",
+			config: sanitizeConfig,
+			path:   defaultPath,
+		},
+		{
+			name:    "ConfigDisabled",
+			config:  sanitizeConfig,
+			options: []string{"--sanitize-path=false"},
+			path:    customPath,
+		},
+	}
+
+	for _, tt := range tests {
+		var globalOpts []string
+		profile := e2e.UserProfile
+		if tt.config != "" {
+			globalOpts = append(globalOpts, "--config", tt.config)
+			profile = e2e.RootProfile
+		}
+		args := append(tt.options, customImage, "/bin/sh", "-c", "echo $PATH")
+
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(profile),
+			e2e.WithGlobalOptions(globalOpts...),
+			e2e.WithCommand("exec"),
+			e2e.WithEnv(tt.env),
+			e2e.WithArgs(args...),
+			e2e.ExpectExit(
+				0,
+				e2e.ExpectOutput(e2e.ExactMatch, tt.path),
+			),
+		)
+	}
+}
+
 // E2ETests is the main func to trigger the test suite
 func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	c := ctx{
@@ -444,6 +696,8 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 		"environment manipulation": c.singularityEnv,
 		"environment option":       c.singularityEnvOption,
 		"environment file":         c.singularityEnvFile,
+		"loader environment":       c.singularityLoaderEnv,
+		"sanitize path":            c.singularitySanitizePath,
 		"issue 5057":               c.issue5057, // https://github.com/sylabs/hpcng/issues/5057
 		"issue 5426":               c.issue5426, // https://github.com/sylabs/hpcng/issues/5426
 	}
@@ -80,6 +80,7 @@ func (c ctx) testCommands(t *testing.T) {
 		{"Build", "build"},
 		{"Cache", "cache"},
 		{"Capability", "capability"},
+		{"Doctor", "doctor"},
 		{"Exec", "exec"},
 		{"Instance", "instance"},
 		{"Key", "key"},
@@ -6,18 +6,29 @@
 package imgbuild
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/sylabs/sif/pkg/sif"
 	"github.com/sylabs/singularity/e2e/internal/e2e"
 	"github.com/sylabs/singularity/e2e/internal/testhelper"
 	"github.com/sylabs/singularity/internal/pkg/test/tool/require"
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/pkg/image"
 )
 
 var testFileContent = "Test file content\n"
@@ -307,6 +318,107 @@ func (c imgBuildTests) buildLocalImage(t *testing.T) {
 	}
 }
 
+// buildStdio tests builds reading the definition from standard input and
+// writing the image to standard output.
+func (c imgBuildTests) buildStdio(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	tmpdir, cleanup := c.tempDir(t, "build-stdio")
+	defer cleanup()
+
+	def := []byte(fmt.Sprintf("Bootstrap: localimage\nFrom: %s\n\n%%post\n    echo post output\n", c.env.ImagePath))
+
+	defFile := filepath.Join(tmpdir, "stdio.def")
+	if err := ioutil.WriteFile(defFile, def, 0644); err != nil {
+		t.Fatalf("failed to write %s: %s", defFile, err)
+	}
+
+	// writeImage saves the image written on standard output to imagePath
+	writeImage := func(imagePath string) e2e.SingularityCmdResultOp {
+		return func(t *testing.T, r *e2e.SingularityCmdResult) {
+			if err := ioutil.WriteFile(imagePath, r.Stdout, 0755); err != nil {
+				t.Errorf("failed to write %s: %s", imagePath, err)
+			}
+		}
+	}
+
+	for _, profile := range []e2e.Profile{e2e.RootProfile, e2e.FakerootProfile} {
+		profile := profile
+
+		t.Run(profile.String(), func(t *testing.T) {
+			stdinImage := filepath.Join(tmpdir, "stdin-"+profile.String())
+			c.env.RunSingularity(
+				t,
+				e2e.AsSubtest("DefinitionFromStdin"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("build"),
+				e2e.WithArgs(stdinImage, "-"),
+				e2e.WithStdin(bytes.NewReader(def)),
+				e2e.PostRun(func(t *testing.T) {
+					if t.Failed() {
+						return
+					}
+					defer os.Remove(stdinImage)
+					c.env.ImageVerify(t, stdinImage, profile)
+				}),
+				e2e.ExpectExit(0),
+			)
+
+			// %post output must not corrupt the image stream
+			stdoutImage := filepath.Join(tmpdir, "stdout-"+profile.String())
+			c.env.RunSingularity(
+				t,
+				e2e.AsSubtest("ImageToStdout"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("build"),
+				e2e.WithArgs("-", defFile),
+				e2e.PostRun(func(t *testing.T) {
+					if t.Failed() {
+						return
+					}
+					defer os.Remove(stdoutImage)
+					c.env.ImageVerify(t, stdoutImage, profile)
+				}),
+				e2e.ExpectExit(
+					0,
+					writeImage(stdoutImage),
+					e2e.ExpectError(e2e.ContainMatch, "post output"),
+				),
+			)
+
+			stdioImage := filepath.Join(tmpdir, "stdio-"+profile.String())
+			c.env.RunSingularity(
+				t,
+				e2e.AsSubtest("StdinToStdout"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("build"),
+				e2e.WithArgs("-", "-"),
+				e2e.WithStdin(bytes.NewReader(def)),
+				e2e.PostRun(func(t *testing.T) {
+					if t.Failed() {
+						return
+					}
+					defer os.Remove(stdioImage)
+					c.env.ImageVerify(t, stdioImage, profile)
+				}),
+				e2e.ExpectExit(0, writeImage(stdioImage)),
+			)
+
+			c.env.RunSingularity(
+				t,
+				e2e.AsSubtest("SandboxToStdout"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("build"),
+				e2e.WithArgs("--sandbox", "-", defFile),
+				e2e.ExpectExit(
+					255,
+					e2e.ExpectError(e2e.ContainMatch, "Sandbox builds can't be written to standard output"),
+				),
+			)
+		})
+	}
+}
+
 func (c imgBuildTests) badPath(t *testing.T) {
 	dn, cleanup := c.tempDir(t, "bad-path")
 	defer cleanup()
@@ -1059,6 +1171,1203 @@ func (c imgBuildTests) buildUpdateSandbox(t *testing.T) {
 	}
 }
 
+// buildForce checks that --force refuses to overwrite a file which is not
+// a Singularity image, which is only overwritten with --force-unsafe.
+func (c imgBuildTests) buildForce(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	tmpdir, cleanup := c.tempDir(t, "build-force")
+	defer cleanup()
+
+	document := filepath.Join(tmpdir, "document.txt")
+	if err := ioutil.WriteFile(document, []byte("important"), 0644); err != nil {
+		t.Fatalf("could not create %s: %s", document, err)
+	}
+	image := filepath.Join(tmpdir, "image.sif")
+
+	tests := []struct {
+		name     string
+		args     []string
+		exitCode int
+		op       e2e.SingularityCmdResultOp
+		postRun  func(t *testing.T)
+	}{
+		{
+			name:     "ForceDocument",
+			args:     []string{"--force", document, c.env.ImagePath},
+			exitCode: 255,
+			op:       e2e.ExpectError(e2e.ContainMatch, "is not a Singularity image"),
+			postRun: func(t *testing.T) {
+				if b, err := ioutil.ReadFile(document); err != nil || string(b) != "important" {
+					t.Errorf("%s was overwritten", document)
+				}
+			},
+		},
+		{
+			name:     "BuildImage",
+			args:     []string{image, c.env.ImagePath},
+			exitCode: 0,
+		},
+		{
+			name:     "ForceImage",
+			args:     []string{"--force", image, c.env.ImagePath},
+			exitCode: 0,
+		},
+		{
+			name:     "ForceUnsafeDocument",
+			args:     []string{"--force-unsafe", document, c.env.ImagePath},
+			exitCode: 0,
+			postRun: func(t *testing.T) {
+				if b, err := ioutil.ReadFile(document); err == nil && string(b) == "important" {
+					t.Errorf("%s was not overwritten", document)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		expects := []e2e.SingularityCmdResultOp{}
+		if tt.op != nil {
+			expects = append(expects, tt.op)
+		}
+		postRun := func(t *testing.T) {}
+		if tt.postRun != nil {
+			postRun = tt.postRun
+		}
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("build"),
+			e2e.WithArgs(tt.args...),
+			e2e.PostRun(postRun),
+			e2e.ExpectExit(tt.exitCode, expects...),
+		)
+	}
+}
+
+// buildUpdateBase rebuilds an image after its base image is updated in the
+// registry, the new base content must be found in the rebuilt image.
+func (c imgBuildTests) buildUpdateBase(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	tmpdir, cleanup := c.tempDir(t, "build-update-base")
+	defer cleanup()
+
+	baseURI := fmt.Sprintf("oras://%s/update_base:latest", c.env.TestRegistry)
+	image := filepath.Join(tmpdir, "image.sif")
+
+	def := filepath.Join(tmpdir, "image.def")
+	defContent := fmt.Sprintf("Bootstrap: oras\nFrom: %s/update_base:latest\n\n%%post\n    echo derived > /derived\n", c.env.TestRegistry)
+	if err := ioutil.WriteFile(def, []byte(defContent), 0644); err != nil {
+		t.Fatalf("failed to write %s: %s", def, err)
+	}
+
+	// pushBase builds and pushes the base image with the given version
+	pushBase := func(t *testing.T, version string) {
+		baseDef := filepath.Join(tmpdir, "base.def")
+		content := fmt.Sprintf("Bootstrap: localimage\nFrom: %s\n\n%%post\n    echo %s > /base-version\n", c.env.ImagePath, version)
+		if err := ioutil.WriteFile(baseDef, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %s", baseDef, err)
+		}
+		base := filepath.Join(tmpdir, "base-"+version+".sif")
+
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest("BuildBase"+version),
+			e2e.WithProfile(e2e.RootProfile),
+			e2e.WithCommand("build"),
+			e2e.WithArgs(base, baseDef),
+			e2e.ExpectExit(0),
+		)
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest("PushBase"+version),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("push"),
+			e2e.WithArgs(base, baseURI),
+			e2e.ExpectExit(0),
+		)
+	}
+
+	// checkContent checks the base version and the content added by
+	// the image definition
+	checkContent := func(t *testing.T, version string) {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest("CheckBase"+version),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(image, "cat", "/base-version", "/derived"),
+			e2e.ExpectExit(
+				0,
+				e2e.ExpectOutput(e2e.ExactMatch, version+"\nderived"),
+			),
+		)
+	}
+
+	pushBase(t, "1")
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Build"),
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs(image, def),
+		e2e.ExpectExit(0),
+	)
+	checkContent(t, "1")
+
+	pushBase(t, "2")
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("RebuildUpdateBase"),
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--force", "--update-base", image, def),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectError(
+				e2e.ContainMatch,
+				fmt.Sprintf("Base image %[1]s/update_base:latest resolved to %[1]s/update_base@sha256:", c.env.TestRegistry),
+			),
+		),
+	)
+	// the rebuilt image is based on the new base, the tag wasn't
+	// resolved to the base previously pulled
+	checkContent(t, "2")
+
+	// the base of an existing sandbox can't be updated in place
+	sandbox := filepath.Join(tmpdir, "sandbox")
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("BuildSandbox"),
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--sandbox", sandbox, def),
+		e2e.ExpectExit(0),
+	)
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("UpdateSandboxBase"),
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--update", "--update-base", "--sandbox", sandbox, def),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "use --force to rebuild it"),
+		),
+	)
+	e2e.Privileged(func(t *testing.T) {
+		if err := os.RemoveAll(sandbox); err != nil {
+			t.Errorf("failed to remove %s: %s", sandbox, err)
+		}
+	})(t)
+}
+
+// buildReproducible checks that two reproducible builds from the same
+// definition produce bit-identical images with the same root filesystem
+// digest.
+func (c imgBuildTests) buildReproducible(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	tmpdir, cleanup := c.tempDir(t, "build-reproducible")
+	defer cleanup()
+
+	def := filepath.Join(tmpdir, "image.def")
+	defContent := fmt.Sprintf("Bootstrap: localimage\nFrom: %s\n\n%%post\n    echo reproducible > /reproducible\n", c.env.ImagePath)
+	if err := ioutil.WriteFile(def, []byte(defContent), 0644); err != nil {
+		t.Fatalf("failed to write %s: %s", def, err)
+	}
+
+	env := append(os.Environ(), "SOURCE_DATE_EPOCH=1601553600")
+
+	digestRe := regexp.MustCompile(`Root filesystem digest: (sha256:[0-9a-f]{64})`)
+
+	var images [][]byte
+	var digests []string
+	for _, name := range []string{"first", "second"} {
+		image := filepath.Join(tmpdir, name+".sif")
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest("Build"+name),
+			e2e.WithProfile(e2e.RootProfile),
+			e2e.WithCommand("build"),
+			e2e.WithEnv(env),
+			e2e.WithArgs("--reproducible", image, def),
+			e2e.ExpectExit(0, func(t *testing.T, r *e2e.SingularityCmdResult) {
+				m := digestRe.FindSubmatch(r.Stderr)
+				if m == nil {
+					t.Errorf("root filesystem digest not reported:\n%s", r.Stderr)
+					return
+				}
+				digests = append(digests, string(m[1]))
+			}),
+		)
+
+		b, err := ioutil.ReadFile(image)
+		if err != nil {
+			t.Fatalf("failed to read %s: %s", image, err)
+		}
+		images = append(images, b)
+	}
+
+	if len(digests) == 2 && digests[0] != digests[1] {
+		t.Errorf("reproducible builds produced different root filesystems: %s and %s", digests[0], digests[1])
+	}
+	if len(images) == 2 && !bytes.Equal(images[0], images[1]) {
+		t.Errorf("reproducible builds produced different images")
+	}
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Label"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("inspect"),
+		e2e.WithArgs("--labels", filepath.Join(tmpdir, "first.sif")),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.ContainMatch, "org.label-schema.build-date: Thursday_1_October_2020_12:0:0_UTC"),
+		),
+	)
+}
+
+// buildBlockSize checks that --blocksize sets the block size of the squashfs
+// root filesystem of SIF images, and rejects invalid block sizes.
+func (c imgBuildTests) buildBlockSize(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	tmpdir, cleanup := c.tempDir(t, "build-blocksize")
+	defer cleanup()
+
+	imgPath := filepath.Join(tmpdir, "image.sif")
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Build"),
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--blocksize", "64K", imgPath, c.env.ImagePath),
+		e2e.PostRun(func(t *testing.T) {
+			if t.Failed() {
+				return
+			}
+			fimg, err := sif.LoadContainer(imgPath, true)
+			if err != nil {
+				t.Fatalf("failed to load %s: %s", imgPath, err)
+			}
+			defer fimg.UnloadContainer()
+
+			part, _, err := fimg.GetPartPrimSys()
+			if err != nil {
+				t.Fatalf("failed to get primary partition of %s: %s", imgPath, err)
+			}
+			blockSize, err := image.GetSquashfsBlockSize(part.GetData(&fimg))
+			if err != nil {
+				t.Fatalf("failed to get squashfs block size of %s: %s", imgPath, err)
+			}
+			if blockSize != 64<<10 {
+				t.Errorf("unexpected squashfs block size %d, want %d", blockSize, 64<<10)
+			}
+		}),
+		e2e.ExpectExit(0),
+	)
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "NotPowerOfTwo",
+			args:     []string{"--blocksize", "100K"},
+			expected: "must be a power of two from 4K to 1M",
+		},
+		{
+			name:     "TooLarge",
+			args:     []string{"--blocksize", "2M"},
+			expected: "must be a power of two from 4K to 1M",
+		},
+		{
+			name:     "Sandbox",
+			args:     []string{"--blocksize", "64K", "--sandbox"},
+			expected: "--blocksize only applies to SIF images",
+		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.RootProfile),
+			e2e.WithCommand("build"),
+			e2e.WithArgs(append(tt.args, filepath.Join(tmpdir, tt.name), c.env.ImagePath)...),
+			e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, tt.expected)),
+		)
+	}
+}
+
+const scratchDefinition = `Bootstrap: localimage
+From: %[1]s
+Stage: busybox
+
+Bootstrap: scratch
+Stage: final
+
+%%files from busybox
+    /bin/busybox /bin/busybox
+    /bin/busybox /bin/sh
+
+%%post
+    /bin/busybox --install -s /bin
+    echo scratch > /scratch
+`
+
+const scratchNoShellDefinition = `Bootstrap: scratch
+
+%post
+    echo scratch > /scratch
+`
+
+// buildScratch builds a minimal image from scratch holding only a
+// statically linked busybox copied from the test image.
+func (c imgBuildTests) buildScratch(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	tmpdir, cleanup := c.tempDir(t, "build-scratch")
+	defer cleanup()
+
+	image := filepath.Join(tmpdir, "scratch.sif")
+	def := filepath.Join(tmpdir, "scratch.def")
+	if err := ioutil.WriteFile(def, []byte(fmt.Sprintf(scratchDefinition, c.env.ImagePath)), 0644); err != nil {
+		t.Fatalf("failed to write %s: %s", def, err)
+	}
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Build"),
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs(image, def),
+		e2e.ExpectExit(0),
+	)
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Exec"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs(image, "cat", "/scratch"),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.ExactMatch, "scratch"),
+		),
+	)
+
+	// %post can't run without a shell in the container
+	noShellDef := filepath.Join(tmpdir, "noshell.def")
+	if err := ioutil.WriteFile(noShellDef, []byte(scratchNoShellDefinition), 0644); err != nil {
+		t.Fatalf("failed to write %s: %s", noShellDef, err)
+	}
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("NoShell"),
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs(filepath.Join(tmpdir, "noshell.sif"), noShellDef),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "%post requires /bin/sh in the container"),
+		),
+	)
+}
+
+// resumeDefinition runs a long %post on the first build, and completes it
+// when the build is resumed.
+const resumeDefinition = `Bootstrap: localimage
+From: %s
+
+%%setup
+    echo setup >> $SINGULARITY_ROOTFS/setup-runs
+
+%%post
+    if [ -f /post-started ]; then
+        echo resumed > /resumed
+    else
+        touch /post-started
+        sleep 120
+    fi
+`
+
+// buildResume interrupts a sandbox build during %post and resumes it with
+// --update.
+func (c imgBuildTests) buildResume(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	tmpdir, cleanup := c.tempDir(t, "build-resume")
+	defer cleanup()
+
+	sandbox := filepath.Join(tmpdir, "sandbox")
+	def := filepath.Join(tmpdir, "resume.def")
+	if err := ioutil.WriteFile(def, []byte(fmt.Sprintf(resumeDefinition, c.env.ImagePath)), 0644); err != nil {
+		t.Fatalf("failed to write %s: %s", def, err)
+	}
+
+	// interrupt the build like Ctrl-C once %post started
+	e2e.Privileged(func(t *testing.T) {
+		cmd := exec.Command(c.env.CmdPath, "build", "--sandbox", sandbox, def)
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		if err := cmd.Start(); err != nil {
+			t.Fatalf("failed to start build: %s", err)
+		}
+		defer cmd.Wait()
+
+		started := filepath.Join(tmpdir, "build-temp-*", "rootfs", "post-started")
+		for i := 0; i < 120; i++ {
+			if m, _ := filepath.Glob(started); len(m) > 0 {
+				break
+			}
+			time.Sleep(time.Second)
+		}
+		if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGINT); err != nil {
+			t.Fatalf("failed to interrupt build: %s", err)
+		}
+	})(t)
+
+	b, err := ioutil.ReadFile(filepath.Join(sandbox, ".singularity.d", "build-state.json"))
+	if err != nil {
+		t.Fatalf("no build state saved in the interrupted sandbox: %s", err)
+	}
+	if !bytes.Contains(b, []byte(`"phases":["bootstrap","setup","files"]`)) {
+		t.Errorf("unexpected build state %s", b)
+	}
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Resume"),
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--update", "--sandbox", sandbox, def),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectError(e2e.ContainMatch, "Resuming the interrupted build"),
+			e2e.ExpectError(e2e.ContainMatch, "Skipping %setup, completed by the interrupted build"),
+		),
+	)
+
+	if b, err := ioutil.ReadFile(filepath.Join(sandbox, "setup-runs")); err != nil || string(b) != "setup\n" {
+		t.Errorf("%%setup not run once: %q (%v)", b, err)
+	}
+	if !fs.IsFile(filepath.Join(sandbox, "resumed")) {
+		t.Errorf("%%post not completed by the resumed build")
+	}
+	if fs.IsFile(filepath.Join(sandbox, ".singularity.d", "build-state.json")) {
+		t.Errorf("build state left in the completed sandbox")
+	}
+
+	// a build state recorded for another definition is discarded
+	state := `{"version":"0.0.0","definition":"","phases":["bootstrap"]}`
+	e2e.Privileged(func(t *testing.T) {
+		if err := ioutil.WriteFile(filepath.Join(sandbox, ".singularity.d", "build-state.json"), []byte(state), 0644); err != nil {
+			t.Fatalf("failed to write build state: %s", err)
+		}
+	})(t)
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Stale"),
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--update", "--sandbox", sandbox, c.env.ImagePath),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectError(e2e.ContainMatch, "was started by Singularity 0.0.0, rebuilding it from scratch"),
+		),
+	)
+	if fs.IsFile(filepath.Join(sandbox, "resumed")) {
+		t.Errorf("sandbox with a stale build state not rebuilt from scratch")
+	}
+
+	e2e.Privileged(func(t *testing.T) {
+		if err := os.RemoveAll(sandbox); err != nil {
+			t.Errorf("failed to remove %s: %s", sandbox, err)
+		}
+	})(t)
+}
+
+// osVersionDefinition bootstraps a Debian release overridden with
+// --os-version.
+const osVersionDefinition = `Bootstrap: debootstrap
+OSVersion: stable
+MirrorURL: http://deb.debian.org/debian/
+`
+
+// buildOSVersion builds the same definition for two Debian releases with
+// --os-version.
+func (c imgBuildTests) buildOSVersion(t *testing.T) {
+	require.Command(t, "debootstrap")
+
+	tmpdir, cleanup := c.tempDir(t, "build-os-version")
+	defer cleanup()
+
+	def := filepath.Join(tmpdir, "debian.def")
+	if err := ioutil.WriteFile(def, []byte(osVersionDefinition), 0644); err != nil {
+		t.Fatalf("failed to write %s: %s", def, err)
+	}
+
+	for _, version := range []string{"bullseye", "bookworm"} {
+		sandbox := filepath.Join(tmpdir, version)
+
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(version),
+			e2e.WithProfile(e2e.RootProfile),
+			e2e.WithCommand("build"),
+			e2e.WithArgs("--os-version", version, "--sandbox", sandbox, def),
+			e2e.PostRun(func(t *testing.T) {
+				defer e2e.Privileged(func(t *testing.T) {
+					os.RemoveAll(sandbox)
+				})(t)
+
+				b, err := ioutil.ReadFile(filepath.Join(sandbox, "etc", "os-release"))
+				if err != nil {
+					t.Fatalf("failed to read os-release: %s", err)
+				}
+				if !bytes.Contains(b, []byte("VERSION_CODENAME="+version+"\n")) {
+					t.Errorf("sandbox not bootstrapped from %s:\n%s", version, b)
+				}
+			}),
+			e2e.ExpectExit(0),
+		)
+	}
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Invalid"),
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--os-version", "11.0", "--sandbox", filepath.Join(tmpdir, "invalid"), def),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, `invalid OS version "11.0" for the debootstrap bootstrap agent`),
+		),
+	)
+}
+
+// registryInsecureDefinition is a multistage definition bootstrapping its
+// stages from the test registry reached with two different host names.
+const registryInsecureDefinition = `Bootstrap: docker
+From: %[1]s/my-busybox
+Stage: one
+
+Bootstrap: docker
+From: %[2]s/my-busybox
+Stage: two
+`
+
+// buildRegistryInsecure checks that --registry-insecure disables HTTPS
+// only for the given registry: the other stage of the same build still
+// requires HTTPS.
+func (c imgBuildTests) buildRegistryInsecure(t *testing.T) {
+	e2e.PrepRegistry(t, c.env)
+
+	// the test registry doesn't serve HTTPS, it's reached by another
+	// host name for the stage requiring HTTPS
+	insecure := c.env.TestRegistry
+	secure := strings.Replace(insecure, "localhost", "127.0.0.1", 1)
+	if secure == insecure {
+		t.Skipf("no alternate host name for registry %s", insecure)
+	}
+
+	tmpdir, cleanup := c.tempDir(t, "build-registry-insecure")
+	defer cleanup()
+
+	def := filepath.Join(tmpdir, "multistage.def")
+	if err := ioutil.WriteFile(def, []byte(fmt.Sprintf(registryInsecureDefinition, insecure, secure)), 0644); err != nil {
+		t.Fatalf("failed to write %s: %s", def, err)
+	}
+
+	tests := []struct {
+		name     string
+		hosts    string
+		exitCode int
+	}{
+		{
+			name:     "OneInsecure",
+			hosts:    insecure,
+			exitCode: 255,
+		},
+		{
+			name:     "BothInsecure",
+			hosts:    insecure + "," + secure,
+			exitCode: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		image := filepath.Join(tmpdir, tt.name+".sif")
+
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.RootProfile),
+			e2e.WithCommand("build"),
+			e2e.WithArgs("--registry-insecure", tt.hosts, image, def),
+			e2e.PostRun(func(t *testing.T) {
+				os.Remove(image)
+			}),
+			e2e.ExpectExit(tt.exitCode),
+		)
+	}
+}
+
+// timestampsDefinition is a definition whose %post output lines are
+// written one second apart.
+const timestampsDefinition = `Bootstrap: localimage
+From: %s
+
+%%post
+    echo "post line 1"
+    sleep 1
+    echo "post line 2"
+    sleep 1
+    echo "post line 3"
+`
+
+// timestampRegexp matches the %post output lines prefixed by --timestamps.
+var timestampRegexp = regexp.MustCompile(`(?m)^\[([0-9]{2}):([0-9]{2}):([0-9]{2}\.[0-9]{3})\] post line ([0-9])$`)
+
+// buildTimestamps checks that the %post output is streamed line by line
+// with --timestamps: each line is stamped when it's written and not when
+// the section terminates.
+func (c imgBuildTests) buildTimestamps(t *testing.T) {
+	tmpdir, cleanup := c.tempDir(t, "build-timestamps")
+	defer cleanup()
+
+	def := filepath.Join(tmpdir, "timestamps.def")
+	content := fmt.Sprintf(timestampsDefinition, c.env.ImagePath)
+	if err := ioutil.WriteFile(def, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %s", def, err)
+	}
+
+	c.env.RunSingularity(
+		t,
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--timestamps", filepath.Join(tmpdir, "image.sif"), def),
+		e2e.ExpectExit(
+			0,
+			func(t *testing.T, r *e2e.SingularityCmdResult) {
+				matches := timestampRegexp.FindAllStringSubmatch(string(r.Stdout), -1)
+				if len(matches) != 3 {
+					t.Fatalf("got %d timestamped %%post lines, want 3:\n%s", len(matches), r.Stdout)
+				}
+				var last time.Duration
+				for i, m := range matches {
+					if m[4] != strconv.Itoa(i+1) {
+						t.Errorf("unexpected %%post line order: %q", m[0])
+					}
+					h, _ := strconv.Atoi(m[1])
+					min, _ := strconv.Atoi(m[2])
+					sec, _ := strconv.ParseFloat(m[3], 64)
+					elapsed := time.Duration(h)*time.Hour + time.Duration(min)*time.Minute + time.Duration(sec*float64(time.Second))
+					if i > 0 && elapsed-last < 500*time.Millisecond {
+						t.Errorf("%%post line %d stamped %s after the previous one, output is not streamed", i+1, elapsed-last)
+					}
+					last = elapsed
+				}
+			},
+		),
+	)
+}
+
+// testUserDefinition is a definition whose %test section reports the
+// user running it.
+const testUserDefinition = `Bootstrap: localimage
+From: %s
+
+%%test
+    echo "TEST UID $(id -u) GID $(id -g)"
+`
+
+// buildTestUnprivileged checks that the %test section runs as the user
+// running %post by default, and as an unprivileged user with
+// --test-unprivileged.
+func (c imgBuildTests) buildTestUnprivileged(t *testing.T) {
+	tmpdir, cleanup := c.tempDir(t, "build-test-unprivileged")
+	defer cleanup()
+
+	def := filepath.Join(tmpdir, "test-user.def")
+	content := fmt.Sprintf(testUserDefinition, c.env.ImagePath)
+	if err := ioutil.WriteFile(def, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %s", def, err)
+	}
+
+	tests := []struct {
+		name    string
+		profile e2e.Profile
+		args    []string
+		want    string
+	}{
+		{
+			name:    "RootDefault",
+			profile: e2e.RootProfile,
+			want:    "TEST UID 0 GID 0",
+		},
+		{
+			name:    "RootUnprivileged",
+			profile: e2e.RootProfile,
+			args:    []string{"--test-unprivileged"},
+			want:    "TEST UID 65534 GID 65534",
+		},
+		{
+			name:    "FakerootDefault",
+			profile: e2e.FakerootProfile,
+			want:    "TEST UID 0 GID 0",
+		},
+		{
+			name:    "FakerootUnprivileged",
+			profile: e2e.FakerootProfile,
+			args:    []string{"--test-unprivileged"},
+			want:    "TEST UID 65534 GID 65534",
+		},
+	}
+
+	for _, tt := range tests {
+		sandbox := filepath.Join(tmpdir, tt.name)
+		args := append([]string{"--sandbox"}, tt.args...)
+		args = append(args, sandbox, def)
+
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(tt.profile),
+			e2e.WithCommand("build"),
+			e2e.WithArgs(args...),
+			e2e.PostRun(func(t *testing.T) {
+				e2e.Privileged(func(t *testing.T) {
+					os.RemoveAll(sandbox)
+				})(t)
+			}),
+			e2e.ExpectExit(
+				0,
+				e2e.ExpectOutput(e2e.ContainMatch, tt.want),
+			),
+		)
+	}
+}
+
+// postInterpreterDefinitions are definitions running a %post section with
+// bash specific syntax, with bash given with -c or with a shebang line.
+var postInterpreterDefinitions = map[string]string{
+	"Args": `Bootstrap: %s
+From: %s
+
+%%post -c /bin/bash
+    declare -a words=(bash post)
+    [[ ${#words[@]} -eq 2 ]] && echo "${words[*]} interpreter"
+`,
+	"Shebang": `Bootstrap: %s
+From: %s
+
+%%post
+#!/bin/bash
+    declare -a words=(bash post)
+    [[ ${#words[@]} -eq 2 ]] && echo "${words[*]} interpreter"
+`,
+}
+
+// buildPostInterpreter checks that %post runs with the interpreter given
+// with -c or with a shebang line, and that the build fails before running
+// %post when the interpreter is not in the container.
+func (c imgBuildTests) buildPostInterpreter(t *testing.T) {
+	tmpdir, cleanup := c.tempDir(t, "build-post-interpreter")
+	defer cleanup()
+
+	tests := []struct {
+		name      string
+		def       string
+		bootstrap string
+		from      string
+		exit      int
+		result    e2e.SingularityCmdResultOp
+	}{
+		{
+			// /bin/sh is dash in Debian, it doesn't run bash syntax
+			name:      "Args",
+			def:       "Args",
+			bootstrap: "docker",
+			from:      "debian:buster-slim",
+			result:    e2e.ExpectOutput(e2e.ContainMatch, "bash post interpreter"),
+		},
+		{
+			name:      "Shebang",
+			def:       "Shebang",
+			bootstrap: "docker",
+			from:      "debian:buster-slim",
+			result:    e2e.ExpectOutput(e2e.ContainMatch, "bash post interpreter"),
+		},
+		{
+			// there is no bash in the Alpine test image
+			name:      "Missing",
+			def:       "Args",
+			bootstrap: "localimage",
+			from:      c.env.ImagePath,
+			exit:      255,
+			result:    e2e.ExpectError(e2e.ContainMatch, "%post interpreter /bin/bash not found in the container"),
+		},
+		{
+			name:      "MissingShebang",
+			def:       "Shebang",
+			bootstrap: "localimage",
+			from:      c.env.ImagePath,
+			exit:      255,
+			result:    e2e.ExpectError(e2e.ContainMatch, "%post interpreter /bin/bash not found in the container"),
+		},
+	}
+
+	for _, tt := range tests {
+		def := filepath.Join(tmpdir, tt.name+".def")
+		content := fmt.Sprintf(postInterpreterDefinitions[tt.def], tt.bootstrap, tt.from)
+		if err := ioutil.WriteFile(def, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %s", def, err)
+		}
+		sandbox := filepath.Join(tmpdir, tt.name)
+
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.RootProfile),
+			e2e.WithCommand("build"),
+			e2e.WithArgs("--sandbox", sandbox, def),
+			e2e.PostRun(func(t *testing.T) {
+				os.RemoveAll(sandbox)
+			}),
+			e2e.ExpectExit(tt.exit, tt.result),
+		)
+	}
+}
+
+// secretDefinition is a definition whose %post section reads a secret,
+// and whose %test section checks that secrets are only exposed to %post.
+const secretDefinition = `Bootstrap: localimage
+From: %s
+
+%%post
+    wc -c < /run/secrets/mytoken | tr -d ' ' > /secret-size
+
+%%test
+    test ! -e /run/secrets/mytoken
+`
+
+// filesContaining returns the regular files of the directory tree root
+// which contain data.
+func filesContaining(t *testing.T, root string, data []byte) []string {
+	var files []string
+
+	err := filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(b, data) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to scan %s: %s", root, err)
+	}
+	return files
+}
+
+// buildSecret checks that a secret given with --secret is readable by the
+// %post section, and that its content doesn't enter the image.
+func (c imgBuildTests) buildSecret(t *testing.T) {
+	tmpdir, cleanup := c.tempDir(t, "build-secret")
+	defer cleanup()
+
+	def := filepath.Join(tmpdir, "secret.def")
+	content := fmt.Sprintf(secretDefinition, c.env.ImagePath)
+	if err := ioutil.WriteFile(def, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %s", def, err)
+	}
+
+	secret := []byte(fmt.Sprintf("e2e-build-secret-%d", time.Now().UnixNano()))
+	secretFile := filepath.Join(tmpdir, "token")
+	if err := ioutil.WriteFile(secretFile, secret, 0600); err != nil {
+		t.Fatalf("failed to write %s: %s", secretFile, err)
+	}
+
+	image := filepath.Join(tmpdir, "secret.sif")
+	sandbox := filepath.Join(tmpdir, "secret")
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Missing"),
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--secret", "id=mytoken,src="+filepath.Join(tmpdir, "missing"), image, def),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "while copying secret mytoken"),
+		),
+	)
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Build"),
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--secret", "id=mytoken,src="+secretFile, image, def),
+		e2e.PostRun(func(t *testing.T) {
+			if t.Failed() {
+				return
+			}
+			b, err := ioutil.ReadFile(image)
+			if err != nil {
+				t.Fatalf("failed to read %s: %s", image, err)
+			}
+			if bytes.Contains(b, secret) {
+				t.Errorf("secret found in %s", image)
+			}
+		}),
+		e2e.ExpectExit(0),
+	)
+
+	// the image is unpacked, its file systems are compressed
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Scan"),
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--sandbox", sandbox, image),
+		e2e.PostRun(func(t *testing.T) {
+			if t.Failed() {
+				return
+			}
+			e2e.Privileged(func(t *testing.T) {
+				defer os.RemoveAll(sandbox)
+
+				if files := filesContaining(t, sandbox, secret); len(files) > 0 {
+					t.Errorf("secret found in image files %v", files)
+				}
+				size, err := ioutil.ReadFile(filepath.Join(sandbox, "secret-size"))
+				if err != nil {
+					t.Fatalf("failed to read secret size written by %%post: %s", err)
+				}
+				if got := strings.TrimSpace(string(size)); got != strconv.Itoa(len(secret)) {
+					t.Errorf("%%post read a secret of %s bytes, want %d", got, len(secret))
+				}
+				if _, err := os.Lstat(filepath.Join(sandbox, "run", "secrets")); !os.IsNotExist(err) {
+					t.Errorf("secrets mount point left in the image: %v", err)
+				}
+			})(t)
+		}),
+		e2e.ExpectExit(0),
+	)
+}
+
+// conditionalDefinition is a definition whose %post steps depend on the GPU
+// build argument.
+const conditionalDefinition = `Bootstrap: localimage
+From: %s
+BuildArgs: GPU
+
+%%post
+    echo common > /variant
+{{ if .GPU }}
+    echo gpu {{ .GPU }} >> /variant
+{{ else }}
+    echo cpu >> /variant
+{{ end }}
+`
+
+// buildConditional checks that the conditional %post steps of a single
+// definition only run when the build argument they depend on is set.
+func (c imgBuildTests) buildConditional(t *testing.T) {
+	tmpdir, cleanup := c.tempDir(t, "build-conditional")
+	defer cleanup()
+
+	def := filepath.Join(tmpdir, "variant.def")
+	content := fmt.Sprintf(conditionalDefinition, c.env.ImagePath)
+	if err := ioutil.WriteFile(def, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %s", def, err)
+	}
+
+	malformed := filepath.Join(tmpdir, "malformed.def")
+	content = strings.Replace(content, "{{ end }}", "", 1)
+	if err := ioutil.WriteFile(malformed, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %s", malformed, err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		variant string
+	}{
+		{name: "CPU", variant: "common\ncpu\n"},
+		{name: "GPU", args: []string{"--build-arg", "GPU=cuda"}, variant: "common\ngpu cuda\n"},
+	}
+
+	for _, tt := range tests {
+		sandbox := filepath.Join(tmpdir, tt.name)
+
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.RootProfile),
+			e2e.WithCommand("build"),
+			e2e.WithArgs(append(tt.args, "--sandbox", sandbox, def)...),
+			e2e.PostRun(func(t *testing.T) {
+				if t.Failed() {
+					return
+				}
+				defer os.RemoveAll(sandbox)
+
+				b, err := ioutil.ReadFile(filepath.Join(sandbox, "variant"))
+				if err != nil {
+					t.Fatalf("failed to read variant written by %%post: %s", err)
+				}
+				if string(b) != tt.variant {
+					t.Errorf("%%post wrote %q, want %q", b, tt.variant)
+				}
+			}),
+			e2e.ExpectExit(0),
+		)
+	}
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Malformed"),
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--build-arg", "GPU=cuda", "--sandbox", filepath.Join(tmpdir, "malformed"), malformed),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "while parsing definition file template"),
+		),
+	)
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("BadArg"),
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--build-arg", "GPU", "--sandbox", filepath.Join(tmpdir, "badarg"), def),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "the format is NAME=VALUE"),
+		),
+	)
+}
+
+// sourceDigest returns a digest of the file or of the directory tree at
+// path covering the names, modes, link targets and content of its files.
+func sourceDigest(t *testing.T, path string) string {
+	h := sha256.New()
+
+	err := filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s %s\n", rel, fi.Mode())
+
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "%s\n", target)
+		case fi.Mode().IsRegular():
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if _, err := io.Copy(h, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to compute digest of %s: %s", path, err)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// buildLocalImageUntouched modifies the root filesystem of an image built
+// from a local SIF image and from a sandbox, and checks the source images
+// stay byte-identical.
+func (c imgBuildTests) buildLocalImageUntouched(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	tmpdir, cleanup := c.tempDir(t, "build-local-untouched")
+	defer cleanup()
+
+	sandbox := filepath.Join(tmpdir, "sandbox")
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Sandbox"),
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--sandbox", sandbox, c.env.ImagePath),
+		e2e.ExpectExit(0),
+	)
+
+	tests := []struct {
+		name    string
+		source  string
+		message string
+	}{
+		{"SIF", c.env.ImagePath, "Staged"},
+		{"Sandbox", sandbox, "Copied sandbox"},
+	}
+
+	for _, tt := range tests {
+		def := filepath.Join(tmpdir, tt.name+".def")
+		defContent := fmt.Sprintf(
+			"Bootstrap: localimage\nFrom: %s\n\n%%post\n    echo modified > /etc/hostname\n    rm -f /bin/true\n    chmod 700 /etc\n",
+			tt.source,
+		)
+		if err := ioutil.WriteFile(def, []byte(defContent), 0644); err != nil {
+			t.Fatalf("failed to write %s: %s", def, err)
+		}
+
+		before := sourceDigest(t, tt.source)
+		image := filepath.Join(tmpdir, tt.name+".sif")
+
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.RootProfile),
+			e2e.WithGlobalOptions("-v"),
+			e2e.WithCommand("build"),
+			e2e.WithArgs(image, def),
+			e2e.PostRun(func(t *testing.T) {
+				if t.Failed() {
+					return
+				}
+				if after := sourceDigest(t, tt.source); after != before {
+					t.Errorf("source image %s was modified by the build", tt.source)
+				}
+			}),
+			e2e.ExpectExit(
+				0,
+				e2e.ExpectError(e2e.ContainMatch, tt.message),
+			),
+		)
+	}
+}
+
 // E2ETests is the main func to trigger the test suite
 func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	c := imgBuildTests{
@@ -1067,14 +2376,29 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 
 	return testhelper.Tests{
 		"bad path":                        c.badPath,                   // try to build from a non existent path
+		"build stdio":                     c.buildStdio,                // build from stdin and to stdout
 		"build encrypt with PEM file":     c.buildEncryptPemFile,       // build encrypted images with certificate
 		"build encrypted with passphrase": c.buildEncryptPassphrase,    // build encrypted images with passphrase
 		"definition":                      c.buildDefinition,           // builds from definition template
 		"from local image":                c.buildLocalImage,           // build and image from an existing image
+		"from local image untouched":      c.buildLocalImageUntouched,  // source image unmodified by the build
 		"from":                            c.buildFrom,                 // builds from definition file and URI
 		"multistage":                      c.buildMultiStageDefinition, // multistage build from definition templates
 		"non-root build":                  c.nonRootBuild,              // build sifs from non-root
 		"build and update sandbox":        c.buildUpdateSandbox,        // build/update sandbox
+		"build force":                     c.buildForce,                // --force only overwrites images
+		"build update base":               c.buildUpdateBase,           // rebuild with an updated base image
+		"build reproducible":              c.buildReproducible,         // bit-identical reproducible builds
+		"build blocksize":                 c.buildBlockSize,            // squashfs block size of SIF images
+		"build scratch":                   c.buildScratch,              // minimal image bootstrapped from scratch
+		"build resume":                    c.buildResume,               // resume an interrupted sandbox build
+		"build os version":                c.buildOSVersion,            // same definition built for two OS versions
+		"build registry insecure":         c.buildRegistryInsecure,     // HTTPS disabled for one registry only
+		"build timestamps":                c.buildTimestamps,           // %post output streamed with timestamps
+		"build test unprivileged":         c.buildTestUnprivileged,     // %test run as an unprivileged user
+		"build post interpreter":          c.buildPostInterpreter,      // %post run with bash
+		"build secret":                    c.buildSecret,               // secrets never enter the image
+		"build conditional":               c.buildConditional,          // conditional %post steps driven by --build-arg
 		"issue 4203":                      c.issue4203,                 // https://github.com/sylabs/singularity/issues/4203
 		"issue 4407":                      c.issue4407,                 // https://github.com/sylabs/singularity/issues/4407
 		"issue 4524":                      c.issue4524,                 // https://github.com/sylabs/singularity/issues/4524
@@ -291,12 +291,27 @@ func (c *imgBuildTests) issue5166(t *testing.T) {
 		),
 	)
 
-	// finally force overwrite
+	// --force doesn't overwrite a directory which is not a sandbox
 	c.env.RunSingularity(
 		t,
 		e2e.WithProfile(e2e.RootProfile),
 		e2e.WithCommand("build"),
 		e2e.WithArgs("--force", "--sandbox", sensibleDir, c.env.ImagePath),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(
+				e2e.ContainMatch,
+				"use --force-unsafe if you want to overwrite it",
+			),
+		),
+	)
+
+	// finally force overwrite
+	c.env.RunSingularity(
+		t,
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--force-unsafe", "--sandbox", sensibleDir, c.env.ImagePath),
 		e2e.PostRun(func(t *testing.T) {
 			if !t.Failed() {
 				cleanup(t)
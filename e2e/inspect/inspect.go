@@ -8,6 +8,7 @@ package inspect
 import (
 	"encoding/json"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -118,6 +119,16 @@ func (c ctx) singularityInspect(t *testing.T) {
 			insType:   "--labels",
 			compareFn: compareLabel("hi", "\"hello world\"", ""),
 		},
+		{
+			name:      "label_URL",
+			insType:   "--labels",
+			compareFn: compareLabel("URL", "https://example.com:8443/path", ""),
+		},
+		{
+			name:      "label_MULTILINE",
+			insType:   "--labels",
+			compareFn: compareLabel("MULTILINE", "first line\nsecond line: with colon", ""),
+		},
 		{
 			name:      "label_org.label-schema.usage",
 			insType:   "--labels",
@@ -350,6 +361,47 @@ func (c ctx) singularityInspect(t *testing.T) {
 		)
 	}
 
+	// squashfs images are inspected from the cached metadata once they
+	// were run to be inspected, without running the container again
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Squash/cached"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithGlobalOptions("--debug"),
+		e2e.WithCommand("inspect"),
+		e2e.WithArgs("--json", "--labels", squashImage),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectError(e2e.ContainMatch, "Using cached inspect metadata"),
+		),
+	)
+
+	// --labels --json output must round-trip, with sorted keys
+	compareRoundTrip := func(t *testing.T, r *e2e.SingularityCmdResult) {
+		meta := new(inspect.Metadata)
+		if err := json.Unmarshal(r.Stdout, meta); err != nil {
+			t.Fatalf("unable to parse json output: %s", err)
+		}
+		b, err := json.MarshalIndent(meta, "", "\t")
+		if err != nil {
+			t.Fatalf("unable to encode inspect metadata: %s", err)
+		}
+		if string(b)+"\n" != string(r.Stdout) {
+			t.Errorf("json output doesn't round-trip, got:\n%s\nre-encoded as:\n%s", r.Stdout, b)
+		}
+	}
+
+	for name, img := range map[string]string{"SIF": sifImage, "Squash": squashImage, "Sandbox": sandboxImage} {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(name+"/labels round-trip"),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("inspect"),
+			e2e.WithArgs("--labels", "--json", img),
+			e2e.ExpectExit(0, compareRoundTrip),
+		)
+	}
+
 	// test --all
 	compareAll := func(t *testing.T, r *e2e.SingularityCmdResult) {
 		meta := new(inspect.Metadata)
@@ -387,6 +439,152 @@ func (c ctx) singularityInspect(t *testing.T) {
 		e2e.WithArgs("--all", sandboxImage),
 		e2e.ExpectExit(0, compareAll),
 	)
+
+	// the setuid /bin/bbsuid helper of alpine is recorded at build time,
+	// and read from the squashfs listing for the squashfs image
+	for name, img := range map[string]string{"SIF": sifImage, "Squash": squashImage, "Sandbox": sandboxImage} {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(name+"/special files"),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("inspect"),
+			e2e.WithArgs("--special-files", img),
+			e2e.ExpectExit(
+				0,
+				e2e.ExpectOutput(e2e.RegexMatch, `(?s)^Setuid files: [1-9][0-9]*\n.*  /bin/bbsuid\n.*Setgid files: `),
+			),
+		)
+	}
+
+	// the metadata of the definition file match the ones of the built
+	// image, except the build date label and the environment set in %post
+	imageMeta := new(inspect.Metadata)
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("SIF/all for definition"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("inspect"),
+		e2e.WithArgs("--all", sifImage),
+		e2e.ExpectExit(0, func(t *testing.T, r *e2e.SingularityCmdResult) {
+			if err := json.Unmarshal(r.Stdout, imageMeta); err != nil {
+				t.Errorf("unable to parse json output: %s", err)
+			}
+		}),
+	)
+
+	compareDefinition := func(t *testing.T, r *e2e.SingularityCmdResult) {
+		meta := new(inspect.Metadata)
+		if err := json.Unmarshal(r.Stdout, meta); err != nil {
+			t.Fatalf("unable to parse json output: %s", err)
+		}
+		delete(imageMeta.Attributes.Labels, "org.label-schema.build-date")
+		delete(imageMeta.Attributes.Environment, "/.singularity.d/env/91-environment.sh")
+		imageMeta.Attributes.SpecialFiles = nil
+		if !reflect.DeepEqual(meta.Attributes, imageMeta.Attributes) {
+			b, _ := json.MarshalIndent(imageMeta, "", "\t")
+			t.Errorf("definition metadata don't match the image ones, got:\n%s\ninstead of:\n%s", r.Stdout, b)
+		}
+	}
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Definition/all"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("inspect"),
+		e2e.WithArgs("--all", containerTesterDEF),
+		e2e.ExpectExit(0, compareDefinition),
+	)
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Definition/runscript"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("inspect"),
+		e2e.WithArgs("--runscript", containerTesterDEF),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.ExactMatch, "#!/bin/sh\n\ncat /.singularity.d/runscript.help"),
+		),
+	)
+
+	invalidDef := filepath.Join(testDir, "invalid.def")
+	if err := ioutil.WriteFile(invalidDef, []byte("Bootstrap: library\nFrom: alpine\n\n%bogus\n"), 0644); err != nil {
+		t.Fatalf("failed to write %s: %s", invalidDef, err)
+	}
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Definition/invalid"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("inspect"),
+		e2e.WithArgs("--definition", invalidDef),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "invalid section(s) specified: bogus"),
+		),
+	)
+
+	argsDef := filepath.Join(testDir, "args.def")
+	argsContent := "Bootstrap: library\nFrom: alpine\nBuildArgs: GREETING=hello\n\n%runscript\n    echo {{ .GREETING }}\n"
+	if err := ioutil.WriteFile(argsDef, []byte(argsContent), 0644); err != nil {
+		t.Fatalf("failed to write %s: %s", argsDef, err)
+	}
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Definition/build-arg default"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("inspect"),
+		e2e.WithArgs("--definition", argsDef),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.ContainMatch, "echo hello"),
+		),
+	)
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Definition/build-arg"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("inspect"),
+		e2e.WithArgs("--definition", "--build-arg", "GREETING=bye", "--runscript", argsDef),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.ContainMatch, "echo bye"),
+		),
+	)
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Definition/build-arg without definition"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("inspect"),
+		e2e.WithArgs("--build-arg", "GREETING=bye", argsDef),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "--build-arg requires the --definition flag"),
+		),
+	)
+
+	// a corrupted image is reported as such, not as a bad definition file
+	badSIF := filepath.Join(testDir, "bad.sif")
+	badContent := make([]byte, 4096)
+	copy(badContent, "#!/usr/bin/env run-singularity\nSIF_MAGIC0")
+	if err := ioutil.WriteFile(badSIF, badContent, 0644); err != nil {
+		t.Fatalf("failed to write %s: %s", badSIF, err)
+	}
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Image/corrupted"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("inspect"),
+		e2e.WithArgs(badSIF),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "Failed to open image "+badSIF),
+		),
+	)
 }
 
 // E2ETests is the main func to trigger the test suite
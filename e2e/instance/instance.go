@@ -7,10 +7,12 @@ package instance
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"syscall"
@@ -301,6 +303,300 @@ func (c *ctx) testGhostInstance(t *testing.T) {
 	)
 }
 
+// Test that instance exec joins a running instance, propagates the exit
+// code of the command and controls the terminal.
+func (c *ctx) testInstanceExec(t *testing.T) {
+	instanceName := "exec-" + uuid.NewV4().String()
+
+	c.env.RunSingularity(
+		t,
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs(c.env.ImagePath, instanceName),
+		e2e.ExpectExit(0),
+	)
+	defer c.stopInstance(t, instanceName)
+
+	tests := []struct {
+		name       string
+		args       []string
+		expectExit int
+		expectOp   e2e.SingularityCmdResultOp
+		// userOnly is set for tests checking the user restrictions
+		userOnly bool
+	}{
+		{
+			name:       "Join",
+			args:       []string{instanceName, "--", "sh", "-c", "echo $SINGULARITY_NAME"},
+			expectExit: 0,
+			expectOp:   e2e.ExpectOutput(e2e.ExactMatch, filepath.Base(c.env.ImagePath)),
+		},
+		{
+			name:       "NoSeparator",
+			args:       []string{instanceName, "true"},
+			expectExit: 0,
+		},
+		{
+			name:       "ExitCode",
+			args:       []string{instanceName, "--", "sh", "-c", "exit 42"},
+			expectExit: 42,
+		},
+		{
+			name:       "NoCommand",
+			args:       []string{instanceName, "--"},
+			expectExit: 255,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "No command to execute"),
+		},
+		{
+			name:       "NoTTY",
+			args:       []string{"--no-tty", instanceName, "--", "sh", "-c", "test ! -t 0 && cat"},
+			expectExit: 0,
+			expectOp:   e2e.ExpectOutput(e2e.ExactMatch, ""),
+		},
+		{
+			// tests are run without terminal, the command gets
+			// a pseudo terminal anyway
+			name:       "TTY",
+			args:       []string{"--tty", instanceName, "--", "sh", "-c", "test -t 1 && tty"},
+			expectExit: 0,
+			expectOp:   e2e.ExpectOutput(e2e.RegexMatch, `^/dev/pts/[0-9]+`),
+		},
+		{
+			name:       "Missing",
+			args:       []string{"missing-instance", "--", "true"},
+			expectExit: 255,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "no instance found with name missing-instance"),
+		},
+		{
+			name:       "OtherUser",
+			args:       []string{"--user", "root", instanceName, "--", "true"},
+			expectExit: 255,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "only root can execute commands in instances of other users"),
+			userOnly:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		if tt.userOnly && !c.profile.In(e2e.UserProfile) {
+			continue
+		}
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(c.profile),
+			e2e.WithCommand("instance exec"),
+			e2e.WithArgs(tt.args...),
+			e2e.ExpectExit(tt.expectExit, tt.expectOp),
+		)
+	}
+
+	if !c.profile.In(e2e.UserProfile) {
+		return
+	}
+
+	// an instance of root is not reported missing to the user
+	rootInstance := "exec-root-" + uuid.NewV4().String()
+	c.env.RunSingularity(
+		t,
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs(c.env.ImagePath, rootInstance),
+		e2e.ExpectExit(0),
+	)
+	defer c.env.RunSingularity(
+		t,
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("instance stop"),
+		e2e.WithArgs(rootInstance),
+		e2e.ExpectExit(0),
+	)
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("RootInstance"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance exec"),
+		e2e.WithArgs(rootInstance, "--", "true"),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "permission denied: instance "+rootInstance+" belongs to user root"),
+		),
+	)
+}
+
+// Test that instance start writes the host PID of the instance to the file
+// given with --pid-file, removed when the instance is stopped, and that
+// instance info reports the namespaces of this process.
+func (c *ctx) testInstanceInfo(t *testing.T) {
+	instanceName := "info-" + uuid.NewV4().String()
+	pidfile := filepath.Join(c.env.TestDir, instanceName+".pid")
+
+	c.env.RunSingularity(
+		t,
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--pid-file", pidfile, c.env.ImagePath, instanceName),
+		e2e.ExpectExit(0),
+	)
+
+	d, err := ioutil.ReadFile(pidfile)
+	if err != nil {
+		c.stopInstance(t, instanceName)
+		t.Fatalf("failed to read pid file: %s", err)
+	}
+	pid := strings.TrimSuffix(string(d), "\n")
+
+	var info struct {
+		Pid        int `json:"pid"`
+		Namespaces []struct {
+			Type string `json:"type"`
+			Path string `json:"path"`
+		} `json:"namespaces"`
+	}
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("JSON"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance info"),
+		e2e.WithArgs("--json", instanceName),
+		e2e.ExpectExit(0, func(t *testing.T, r *e2e.SingularityCmdResult) {
+			if err := json.Unmarshal(r.Stdout, &info); err != nil {
+				t.Fatalf("failed to decode instance info: %s", err)
+			}
+			if strconv.Itoa(info.Pid) != pid {
+				t.Errorf("instance info reports PID %d, pid file contains %s", info.Pid, pid)
+			}
+			for _, ns := range info.Namespaces {
+				if ns.Type == "mnt" {
+					return
+				}
+			}
+			t.Errorf("mount namespace not reported in %+v", info.Namespaces)
+		}),
+	)
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("NsPaths"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance info"),
+		e2e.WithArgs("--ns-paths", instanceName),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutputf(e2e.ContainMatch, "--mount=/proc/%s/ns/mnt", pid),
+		),
+	)
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Missing"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance info"),
+		e2e.WithArgs("missing-instance"),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "no instance found with name missing-instance"),
+		),
+	)
+
+	c.stopInstance(t, instanceName)
+
+	if _, err := os.Stat(pidfile); !os.IsNotExist(err) {
+		os.Remove(pidfile)
+		t.Errorf("pid file %s not removed after instance stop", pidfile)
+	}
+}
+
+// Test that a systemd unit is generated for a running instance and with
+// instance start --systemd, and that the instance is started again from
+// the saved options file.
+func (c *ctx) testGenerateUnit(t *testing.T) {
+	instanceName := "unit-" + uuid.NewV4().String()
+	optionsRe := regexp.MustCompile(`Instance options saved to (\S+),`)
+
+	c.env.RunSingularity(
+		t,
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--env", "UNIT_TEST=yes", c.env.ImagePath, instanceName),
+		e2e.ExpectExit(0),
+	)
+
+	var stdout, stderr string
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Running"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance generate-unit"),
+		e2e.WithArgs("--restart", "always", instanceName),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.ContainMatch, "--options-file"),
+			e2e.ExpectOutputf(e2e.ContainMatch, "instance stop %s", instanceName),
+			e2e.ExpectOutput(e2e.ContainMatch, "Restart=always"),
+			e2e.GetStreams(&stdout, &stderr),
+		),
+	)
+
+	c.stopInstance(t, instanceName)
+
+	m := optionsRe.FindStringSubmatch(stderr)
+	if m == nil {
+		t.Fatalf("options file not reported in %q", stderr)
+	}
+	optionsFile := m[1]
+	defer os.Remove(optionsFile)
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("OptionsFile"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--options-file", optionsFile, instanceName),
+		e2e.ExpectExit(0),
+	)
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("OptionsFileEnv"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("instance://"+instanceName, "sh", "-c", "echo $UNIT_TEST"),
+		e2e.ExpectExit(0, e2e.ExpectOutput(e2e.ExactMatch, "yes")),
+	)
+	c.stopInstance(t, instanceName)
+
+	systemdName := "unit-" + uuid.NewV4().String()
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Systemd"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--systemd", "--net", "--network", "none", c.env.ImagePath, systemdName),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.ContainMatch, "instance start --options-file"),
+			e2e.GetStreams(&stdout, &stderr),
+		),
+	)
+	if m := optionsRe.FindStringSubmatch(stderr); m != nil {
+		os.Remove(m[1])
+	}
+	c.expectInstance(t, systemdName, 0)
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("RestartWithoutSystemd"),
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--restart", "always", c.env.ImagePath, systemdName),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "--restart requires --systemd"),
+		),
+	)
+}
+
 func (c *ctx) applyCgroupsInstance(t *testing.T) {
 	require.Cgroups(t)
 
@@ -335,6 +631,79 @@ func (c *ctx) applyCgroupsInstance(t *testing.T) {
 	)
 }
 
+// applyCgroupsInstanceExec checks that the processes executed in an
+// instance started with a memory limit are placed in the instance cgroups
+// and constrained by the limit.
+func (c *ctx) applyCgroupsInstanceExec(t *testing.T) {
+	require.Cgroups(t)
+
+	if !c.profile.In(e2e.RootProfile) {
+		t.Skipf("%s requires %s profile, current profile: %s", t.Name(), e2e.RootProfile, c.profile)
+	}
+
+	instanceName := uuid.NewV4().String()
+	joinName := fmt.Sprintf("instance://%s", instanceName)
+
+	c.env.RunSingularity(
+		t,
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs("--apply-cgroups", "testdata/cgroups/memory_limit.toml", c.env.ImagePath, instanceName),
+		e2e.ExpectExit(0),
+	)
+	defer c.stopInstance(t, instanceName)
+
+	tests := []struct {
+		name     string
+		command  string
+		args     []string
+		exit     int
+		expectOp e2e.SingularityCmdResultOp
+	}{
+		{
+			name:     "Cgroup",
+			command:  "exec",
+			args:     []string{joinName, "cat", "/proc/self/cgroup"},
+			exit:     0,
+			expectOp: e2e.ExpectOutput(e2e.RegexMatch, `(?m)^\d+:memory:/singularity/\d+$`),
+		},
+		{
+			name:    "BelowLimit",
+			command: "exec",
+			args:    []string{joinName, "sh", "-c", "head -c 8m /dev/zero | tail"},
+			exit:    0,
+		},
+		{
+			// tail buffers the whole input without newline in memory
+			name:    "AboveLimit",
+			command: "exec",
+			args:    []string{joinName, "sh", "-c", "head -c 256m /dev/zero | tail"},
+			exit:    137,
+		},
+		{
+			name:    "InstanceExecAboveLimit",
+			command: "instance exec",
+			args:    []string{instanceName, "sh", "-c", "head -c 256m /dev/zero | tail"},
+			exit:    137,
+		},
+	}
+
+	for _, tt := range tests {
+		var ops []e2e.SingularityCmdResultOp
+		if tt.expectOp != nil {
+			ops = append(ops, tt.expectOp)
+		}
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(c.profile),
+			e2e.WithCommand(tt.command),
+			e2e.WithArgs(tt.args...),
+			e2e.ExpectExit(tt.exit, ops...),
+		)
+	}
+}
+
 // E2ETests is the main func to trigger the test suite
 func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	c := &ctx{
@@ -359,10 +728,14 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 				{"BasicOptions", c.testBasicOptions},
 				{"Contain", c.testContain},
 				{"InstanceFromURI", c.testInstanceFromURI},
+				{"InstanceExec", c.testInstanceExec},
+				{"InstanceInfo", c.testInstanceInfo},
+				{"GenerateUnit", c.testGenerateUnit},
 				{"CreateManyInstances", c.testCreateManyInstances},
 				{"StopAll", c.testStopAll},
 				{"GhostInstance", c.testGhostInstance},
 				{"ApplyCgroupsInstance", c.applyCgroupsInstance},
+				{"ApplyCgroupsInstanceExec", c.applyCgroupsInstanceExec},
 			}
 
 			profiles := []e2e.Profile{
@@ -13,6 +13,7 @@ import (
 
 	"github.com/sylabs/singularity/e2e/internal/e2e"
 	"github.com/sylabs/singularity/e2e/internal/testhelper"
+	"github.com/sylabs/singularity/pkg/util/crypt"
 )
 
 type ctx struct {
@@ -483,6 +484,60 @@ func (c *ctx) checkKeyLength(t *testing.T, expectedKeyLength int) {
 	}
 }
 
+// singularityKeyGeneratePEM checks that 'key generate-pem' creates an RSA
+// key pair usable for image encryption and doesn't overwrite key files.
+func (c ctx) singularityKeyGeneratePEM(t *testing.T) {
+	tmpDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "pem-", "")
+	defer cleanup(t)
+
+	privPath := filepath.Join(tmpDir, "image.pem")
+	pubPath := filepath.Join(tmpDir, "image.pub")
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("generate"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("key"),
+		e2e.WithArgs("generate-pem", "--bit-length", "2048", privPath),
+		e2e.PostRun(func(t *testing.T) {
+			fi, err := os.Stat(privPath)
+			if err != nil {
+				t.Fatalf("private key not created: %s", err)
+			}
+			if fi.Mode().Perm() != 0600 {
+				t.Errorf("private key has mode %o, want 600", fi.Mode().Perm())
+			}
+			priv, err := crypt.LoadPEMPrivateKey(privPath)
+			if err != nil {
+				t.Fatalf("invalid private key: %s", err)
+			}
+			if priv.N.BitLen() != 2048 {
+				t.Errorf("private key has %d bits, want 2048", priv.N.BitLen())
+			}
+			pub, err := crypt.LoadPEMPublicKey(pubPath)
+			if err != nil {
+				t.Fatalf("invalid public key: %s", err)
+			}
+			if pub.N.Cmp(priv.N) != 0 {
+				t.Errorf("public key doesn't match the private key")
+			}
+		}),
+		e2e.ExpectExit(0),
+	)
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("no overwrite"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("key"),
+		e2e.WithArgs("generate-pem", privPath, filepath.Join(tmpDir, "other.pub")),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectError(e2e.ContainMatch, "already exists"),
+		),
+	)
+}
+
 // Run the 'key' tests in order
 func (c ctx) singularityKeyCmd(t *testing.T) {
 	c.singularityKeySearch(t)
@@ -514,6 +569,7 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 		"ordered": func(t *testing.T) {
 			t.Run("keyCmd", c.singularityKeyCmd)                       // Run all the tests in order
 			t.Run("keyNewpairWithLen", c.singularityKeyNewpairWithLen) // We run a separate test for `key newpair --bit-length` because it requires handling a keyring a specific way
+			t.Run("keyGeneratePEM", c.singularityKeyGeneratePEM)       // PEM key pairs don't use the keyring
 		},
 	}
 }
@@ -8,12 +8,18 @@
 package pull
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/containerd/containerd/reference"
 	"github.com/containerd/containerd/remotes/docker"
@@ -24,6 +30,8 @@ import (
 	"github.com/pkg/errors"
 	"github.com/sylabs/singularity/e2e/internal/e2e"
 	"github.com/sylabs/singularity/e2e/internal/testhelper"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/remote"
 	"github.com/sylabs/singularity/internal/pkg/util/uri"
 	"golang.org/x/sys/unix"
 )
@@ -267,6 +275,11 @@ func (c *ctx) setup(t *testing.T) {
 			srcPath: c.env.ImagePath,
 			uri:     fmt.Sprintf("%s/pull_test_sif:latest", c.env.TestRegistry),
 		},
+		{
+			// image file name collides with pull_test_sif:latest
+			srcPath: c.env.ImagePath,
+			uri:     fmt.Sprintf("%s/pull_test/sif:latest", c.env.TestRegistry),
+		},
 		{
 			srcPath: orasInvalidDir,
 			uri:     fmt.Sprintf("%s/pull_test_dir:latest", c.env.TestRegistry),
@@ -484,6 +497,161 @@ func (c ctx) testPullDisableCacheCmd(t *testing.T) {
 	}
 }
 
+// testPullOutput checks that the pulled image path is the only content
+// written to stdout, so it can be captured by scripts, and that --quiet and
+// --silent suppress informational messages on stderr.
+func (c ctx) testPullOutput(t *testing.T) {
+	imageSrc := fmt.Sprintf("oras://%s/pull_test_sif:latest", c.env.TestRegistry)
+
+	tests := []struct {
+		name          string
+		globalOptions []string
+		expectStderr  bool
+	}{
+		{
+			name:         "default",
+			expectStderr: true,
+		},
+		{
+			name:          "quiet",
+			globalOptions: []string{"--quiet"},
+		},
+		{
+			name:          "silent",
+			globalOptions: []string{"--silent"},
+		},
+	}
+
+	for _, tt := range tests {
+		imagePath := filepath.Join(c.env.TestDir, "output-"+tt.name+".sif")
+
+		resultOps := []e2e.SingularityCmdResultOp{
+			e2e.ExpectOutput(e2e.ExactMatch, imagePath),
+		}
+		if !tt.expectStderr {
+			resultOps = append(resultOps, e2e.ExpectError(e2e.ExactMatch, ""))
+		}
+
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithGlobalOptions(tt.globalOptions...),
+			e2e.WithCommand("pull"),
+			e2e.WithArgs("--force", "--disable-cache", imagePath, imageSrc),
+			e2e.PostRun(func(t *testing.T) {
+				os.Remove(imagePath)
+			}),
+			e2e.ExpectExit(0, resultOps...),
+		)
+	}
+}
+
+// testPullName checks the image file name derived from the URI, that an
+// existing image file isn't overwritten without --force, and that a name
+// collision between two URIs requires to set the image file name.
+func (c ctx) testPullName(t *testing.T) {
+	dir, err := ioutil.TempDir(c.env.TestDir, "pull_name-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	imageSrc := fmt.Sprintf("oras://%s/pull_test_sif:latest", c.env.TestRegistry)
+	collidingSrc := fmt.Sprintf("oras://%s/pull_test/sif:latest", c.env.TestRegistry)
+	imageName := uri.GetName(imageSrc)
+	if uri.GetName(collidingSrc) != imageName {
+		t.Fatalf("%s and %s image file names don't collide", imageSrc, collidingSrc)
+	}
+	imagePath := filepath.Join(dir, imageName)
+
+	tests := []struct {
+		name     string
+		args     []string
+		exit     int
+		op       e2e.SingularityCmdResultOp
+		xattr    bool // requires extended attributes support
+		wantPath string
+	}{
+		{
+			name:     "Derived",
+			args:     []string{imageSrc},
+			exit:     0,
+			op:       e2e.ExpectOutput(e2e.ExactMatch, imageName),
+			wantPath: imagePath,
+		},
+		{
+			name: "Exists",
+			args: []string{imageSrc},
+			exit: 255,
+			op:   e2e.ExpectError(e2e.ContainMatch, "will not overwrite"),
+		},
+		{
+			name:     "Force",
+			args:     []string{"--force", imageSrc},
+			exit:     0,
+			wantPath: imagePath,
+		},
+		{
+			name:  "Collision",
+			args:  []string{"--force", collidingSrc},
+			exit:  255,
+			op:    e2e.ExpectError(e2e.ContainMatch, "has the same name as "+collidingSrc),
+			xattr: true,
+		},
+		{
+			name:     "Name",
+			args:     []string{"--name", "colliding.sif", collidingSrc},
+			exit:     0,
+			op:       e2e.ExpectOutput(e2e.ExactMatch, "colliding.sif"),
+			wantPath: filepath.Join(dir, "colliding.sif"),
+		},
+		{
+			name:     "ShortName",
+			args:     []string{"-o", "short.sif", collidingSrc},
+			exit:     0,
+			wantPath: filepath.Join(dir, "short.sif"),
+		},
+		{
+			name: "NameAndOutput",
+			args: []string{"--name", "name.sif", "output.sif", collidingSrc},
+			exit: 255,
+		},
+	}
+
+	for _, tt := range tests {
+		if tt.xattr {
+			b := make([]byte, 4096)
+			if _, err := unix.Getxattr(imagePath, "user.singularity.pull.source", b); err != nil {
+				t.Logf("skipping %s: image source not recorded: %s", tt.name, err)
+				continue
+			}
+		}
+
+		expects := []e2e.SingularityCmdResultOp{}
+		if tt.op != nil {
+			expects = append(expects, tt.op)
+		}
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithDir(dir),
+			e2e.WithCommand("pull"),
+			e2e.WithArgs(tt.args...),
+			e2e.PostRun(func(t *testing.T) {
+				if tt.wantPath == "" || t.Failed() {
+					return
+				}
+				if _, err := os.Stat(tt.wantPath); err != nil {
+					t.Errorf("image not pulled to %s: %s", tt.wantPath, err)
+				}
+			}),
+			e2e.ExpectExit(tt.exit, expects...),
+		)
+	}
+}
+
 // testPullUmask will run some pull tests with different umasks, and
 // ensure the output file hase the correct permissions.
 func (c ctx) testPullUmask(t *testing.T) {
@@ -590,6 +758,558 @@ func (c ctx) testPullUmask(t *testing.T) {
 	}
 }
 
+// setRemoteConf sets the user remote configuration to the existing one
+// modified by set, and returns a function restoring the original one.
+func (c ctx) setRemoteConf(t *testing.T, set func(rc *remote.Config)) func() {
+	remoteConf := filepath.Join(e2e.UserProfile.HostUser(t).Dir, ".singularity", "remote.yaml")
+
+	orig, err := ioutil.ReadFile(remoteConf)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("while reading %s: %s", remoteConf, err)
+	}
+	rc := new(remote.Config)
+	restore := func() { os.Remove(remoteConf) }
+	if err == nil {
+		rc, err = remote.ReadFrom(bytes.NewReader(orig))
+		if err != nil {
+			t.Fatalf("while parsing %s: %s", remoteConf, err)
+		}
+		restore = func() {
+			if err := ioutil.WriteFile(remoteConf, orig, 0600); err != nil {
+				t.Errorf("while restoring %s: %s", remoteConf, err)
+			}
+		}
+	}
+	set(rc)
+
+	var buf bytes.Buffer
+	if _, err := rc.WriteTo(&buf); err != nil {
+		t.Fatalf("while writing remote configuration: %s", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(remoteConf), 0700); err != nil {
+		t.Fatalf("while creating %s: %s", filepath.Dir(remoteConf), err)
+	}
+	if err := ioutil.WriteFile(remoteConf, buf.Bytes(), 0600); err != nil {
+		t.Fatalf("while writing %s: %s", remoteConf, err)
+	}
+
+	return restore
+}
+
+// testPullMirror tests that docker:// pulls are redirected to the
+// mirrors set in the user remote configuration.
+func (c ctx) testPullMirror(t *testing.T) {
+	defer c.setRemoteConf(t, func(rc *remote.Config) {
+		// docker.io/e2e-mirror doesn't exist, pulls succeed only if they
+		// hit the test registry
+		rc.Mirrors = []*remote.Mirror{
+			{
+				Transport: remote.MirrorDocker,
+				Prefix:    "docker.io/e2e-mirror/",
+				Mirror:    c.env.TestRegistry + "/",
+			},
+			{
+				Transport: remote.MirrorDocker,
+				Regex:     `^docker\.io/e2e-mirror-regex/([^:]+):.*$`,
+				Mirror:    c.env.TestRegistry + "/$1:latest",
+			},
+		}
+	})()
+
+	tmpdir, err := ioutil.TempDir(c.env.TestDir, "pull_mirror.")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory for pull mirror test: %+v", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	tests := []struct {
+		name     string
+		srcURI   string
+		exitCode int
+	}{
+		{
+			name:     "Prefix",
+			srcURI:   "docker://e2e-mirror/my-busybox",
+			exitCode: 0,
+		},
+		{
+			name:     "Regex",
+			srcURI:   "docker://e2e-mirror-regex/my-busybox:1.0",
+			exitCode: 0,
+		},
+		{
+			name:     "MissingImage",
+			srcURI:   "docker://e2e-mirror/missing-image",
+			exitCode: 255,
+		},
+	}
+
+	for _, tt := range tests {
+		imagePath := filepath.Join(tmpdir, tt.name+".sif")
+
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("pull"),
+			e2e.WithArgs("--nohttps", imagePath, tt.srcURI),
+			e2e.PostRun(func(t *testing.T) {
+				if t.Failed() || tt.exitCode != 0 {
+					return
+				}
+				if _, err := os.Stat(imagePath); err != nil {
+					t.Errorf("image %s not pulled: %s", imagePath, err)
+				}
+			}),
+			e2e.ExpectExit(tt.exitCode),
+		)
+	}
+}
+
+// testPullRegistryInsecure tests that HTTPS is disabled only for the
+// registries given with --registry-insecure or marked as insecure in the
+// user remote configuration.
+func (c ctx) testPullRegistryInsecure(t *testing.T) {
+	e2e.PrepRegistry(t, c.env)
+
+	tmpdir, err := ioutil.TempDir(c.env.TestDir, "pull_registry_insecure.")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory for pull registry insecure test: %+v", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// the test registry doesn't serve HTTPS
+	srcURI := "docker://" + c.env.TestRegistry + "/my-busybox"
+
+	tests := []struct {
+		name     string
+		args     []string
+		exitCode int
+	}{
+		{
+			name:     "Insecure",
+			args:     []string{"--registry-insecure", c.env.TestRegistry},
+			exitCode: 0,
+		},
+		{
+			name:     "OtherInsecure",
+			args:     []string{"--registry-insecure", "registry.example.com"},
+			exitCode: 255,
+		},
+		{
+			name:     "Secure",
+			exitCode: 255,
+		},
+	}
+
+	for _, tt := range tests {
+		imagePath := filepath.Join(tmpdir, tt.name+".sif")
+
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("pull"),
+			e2e.WithArgs(append(tt.args, "--disable-cache", imagePath, srcURI)...),
+			e2e.ExpectExit(tt.exitCode),
+		)
+	}
+
+	restore := c.setRemoteConf(t, func(rc *remote.Config) {
+		rc.Registries = []*remote.Registry{
+			{Host: c.env.TestRegistry, Insecure: true},
+		}
+	})
+	defer restore()
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("RemoteConfig"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("pull"),
+		e2e.WithArgs("--disable-cache", filepath.Join(tmpdir, "remote.sif"), srcURI),
+		e2e.ExpectExit(0),
+	)
+}
+
+// testPullFile checks that a local image referenced by a file:// URI is
+// copied through the cache, keyed by its sha256 digest, and that a digest
+// mismatch is refused.
+func (c ctx) testPullFile(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "e2e-imgcache-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	c.env.ImgCacheDir = cacheDir
+
+	content, err := ioutil.ReadFile(c.env.ImagePath)
+	if err != nil {
+		t.Fatalf("failed to read %s: %s", c.env.ImagePath, err)
+	}
+	sum := sha256.Sum256(content)
+	digest := hex.EncodeToString(sum[:])
+	badDigest := strings.Repeat("0", len(digest))
+
+	imagePath := filepath.Join(c.env.TestDir, "file.sif")
+	defer os.Remove(imagePath)
+
+	tests := []struct {
+		name       string
+		imageSrc   string
+		expectExit int
+	}{
+		{
+			name:       "path",
+			imageSrc:   "file://" + c.env.ImagePath,
+			expectExit: 0,
+		},
+		{
+			name:       "digest",
+			imageSrc:   "file://" + c.env.ImagePath + "@sha256:" + digest,
+			expectExit: 0,
+		},
+		{
+			name:       "bad digest",
+			imageSrc:   "file://" + c.env.ImagePath + "@sha256:" + badDigest,
+			expectExit: 255,
+		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("pull"),
+			e2e.WithArgs("--force", imagePath, tt.imageSrc),
+			e2e.PostRun(func(t *testing.T) {
+				if t.Failed() || tt.expectExit != 0 {
+					return
+				}
+				if b, err := ioutil.ReadFile(imagePath); err != nil || !bytes.Equal(b, content) {
+					t.Errorf("pulled image doesn't match %s: %v", c.env.ImagePath, err)
+				}
+				imgCache, err := cache.New(cache.Config{ParentDir: cacheDir})
+				if err != nil {
+					t.Fatalf("failed to open cache: %s", err)
+				}
+				m, err := imgCache.VerifyEntry(cache.FileCacheType, digest)
+				if err != nil {
+					t.Fatalf("cache entry %s not verified: %s", digest, err)
+				}
+				if m.Digest != "sha256:"+digest {
+					t.Errorf("cache entry digest %s doesn't match sha256:%s", m.Digest, digest)
+				}
+			}),
+			e2e.ExpectExit(tt.expectExit),
+		)
+	}
+}
+
+// testPullBucket checks that images referenced by s3:// and gs:// URIs are
+// downloaded from a fake object storage server, through the cache, and
+// verified against the digest stored in their metadata.
+func (c ctx) testPullBucket(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "e2e-imgcache-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	c.env.ImgCacheDir = cacheDir
+
+	content, err := ioutil.ReadFile(c.env.ImagePath)
+	if err != nil {
+		t.Fatalf("failed to read %s: %s", c.env.ImagePath, err)
+	}
+	sum := sha256.Sum256(content)
+	digest := hex.EncodeToString(sum[:])
+	objects := map[string]string{
+		"busybox.sif":   digest,
+		"corrupted.sif": strings.Repeat("0", len(digest)),
+	}
+
+	// serves the objects of the bucket images with the S3 API in the path
+	// style and with the Google Cloud Storage JSON API
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var key string
+		media := true
+		if strings.HasPrefix(r.URL.Path, "/storage/v1/b/images/o/") {
+			key = strings.TrimPrefix(r.URL.Path, "/storage/v1/b/images/o/")
+			media = r.URL.Query().Get("alt") == "media"
+		} else {
+			key = strings.TrimPrefix(r.URL.Path, "/images/")
+		}
+		d, ok := objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if !media {
+			fmt.Fprintf(w, `{"size":"%d","generation":"1","metadata":{"sha256":"%s"}}`, len(content), d)
+			return
+		}
+		w.Header().Set("ETag", `"1"`)
+		w.Header().Set("X-Amz-Meta-Sha256", d)
+		http.ServeContent(w, r, key, time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	s3Env := append(os.Environ(),
+		"AWS_ACCESS_KEY_ID=e2e",
+		"AWS_SECRET_ACCESS_KEY=e2e",
+		"AWS_ENDPOINT_URL="+srv.URL,
+	)
+	gsEnv := append(os.Environ(), "STORAGE_EMULATOR_HOST="+srv.URL)
+	noCredsEnv := append(os.Environ(),
+		"AWS_ACCESS_KEY_ID=",
+		"AWS_SECRET_ACCESS_KEY=",
+		"AWS_PROFILE=",
+		"AWS_SHARED_CREDENTIALS_FILE="+filepath.Join(c.env.TestDir, "no-credentials"),
+		"AWS_EC2_METADATA_DISABLED=true",
+		"AWS_ENDPOINT_URL="+srv.URL,
+	)
+
+	imagePath := filepath.Join(c.env.TestDir, "bucket.sif")
+	defer os.Remove(imagePath)
+
+	tests := []struct {
+		name       string
+		imageSrc   string
+		env        []string
+		expectExit int
+		expectOp   e2e.SingularityCmdResultOp
+	}{
+		{
+			name:       "s3",
+			imageSrc:   "s3://images/busybox.sif",
+			env:        s3Env,
+			expectExit: 0,
+		},
+		{
+			name:       "gs",
+			imageSrc:   "gs://images/busybox.sif",
+			env:        gsEnv,
+			expectExit: 0,
+		},
+		{
+			name:       "not found",
+			imageSrc:   "s3://images/missing.sif",
+			env:        s3Env,
+			expectExit: 255,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "image s3://images/missing.sif not found"),
+		},
+		{
+			name:       "bad digest",
+			imageSrc:   "gs://images/corrupted.sif",
+			env:        gsEnv,
+			expectExit: 255,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "doesn't match the expected digest"),
+		},
+		{
+			name:       "no credentials",
+			imageSrc:   "s3://images/busybox.sif",
+			env:        noCredsEnv,
+			expectExit: 255,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "no S3 credentials found, checked: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables"),
+		},
+	}
+
+	for _, tt := range tests {
+		var ops []e2e.SingularityCmdResultOp
+		if tt.expectOp != nil {
+			ops = append(ops, tt.expectOp)
+		}
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("pull"),
+			e2e.WithEnv(tt.env),
+			e2e.WithArgs("--force", imagePath, tt.imageSrc),
+			e2e.PostRun(func(t *testing.T) {
+				if t.Failed() || tt.expectExit != 0 {
+					return
+				}
+				if b, err := ioutil.ReadFile(imagePath); err != nil || !bytes.Equal(b, content) {
+					t.Errorf("pulled image doesn't match %s: %v", c.env.ImagePath, err)
+				}
+			}),
+			e2e.ExpectExit(tt.expectExit, ops...),
+		)
+	}
+
+	// action commands run the image from the cache entry
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("exec"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithEnv(s3Env),
+		e2e.WithArgs("s3://images/busybox.sif", "true"),
+		e2e.ExpectExit(0),
+	)
+}
+
+// testPullUpdate checks that pull --update replaces an image file only when
+// the image of the registry changed, and that --check-only only reports it
+// with its output and exit status.
+func (c ctx) testPullUpdate(t *testing.T) {
+	e2e.PrepRegistry(t, c.env)
+
+	dir, err := ioutil.TempDir(c.env.TestDir, "pull_update-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	imageSrc := fmt.Sprintf("oras://%s/pull_update_sif:latest", c.env.TestRegistry)
+	imagePath := filepath.Join(dir, "update.sif")
+	// a rebuilt image has the same content but another digest
+	newImage := filepath.Join(dir, "new.sif")
+	// the test registry doesn't serve HTTPS
+	ociSrc := "docker://" + c.env.TestRegistry + "/my-busybox"
+	ociPath := filepath.Join(dir, "oci.sif")
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("PushImage"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("push"),
+		e2e.WithArgs(c.env.ImagePath, imageSrc),
+		e2e.ExpectExit(0),
+	)
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("BuildNewImage"),
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs(newImage, c.env.ImagePath),
+		e2e.ExpectExit(0),
+	)
+
+	tests := []struct {
+		name      string
+		args      []string
+		push      string // image pushed before the pull
+		exit      int
+		op        e2e.SingularityCmdResultOp
+		wantImage string // expected content of the image file
+	}{
+		{
+			name: "CheckOnlyWithoutUpdate",
+			args: []string{"--check-only", imagePath, imageSrc},
+			exit: 255,
+			op:   e2e.ExpectError(e2e.ContainMatch, "--check-only requires --update"),
+		},
+		{
+			name:      "Missing",
+			args:      []string{"--update", imagePath, imageSrc},
+			exit:      0,
+			op:        e2e.ExpectOutput(e2e.ExactMatch, imagePath),
+			wantImage: c.env.ImagePath,
+		},
+		{
+			name:      "UpToDate",
+			args:      []string{"--update", imagePath, imageSrc},
+			exit:      0,
+			op:        e2e.ExpectError(e2e.ContainMatch, "is already up to date with "+imageSrc),
+			wantImage: c.env.ImagePath,
+		},
+		{
+			name:      "CheckOnlyUpToDate",
+			args:      []string{"--update", "--check-only", imagePath, imageSrc},
+			exit:      0,
+			op:        e2e.ExpectOutput(e2e.ExactMatch, "up-to-date"),
+			wantImage: c.env.ImagePath,
+		},
+		{
+			name:      "CheckOnly",
+			args:      []string{"--update", "--check-only", imagePath, imageSrc},
+			push:      newImage,
+			exit:      100,
+			op:        e2e.ExpectOutput(e2e.ExactMatch, "update-available"),
+			wantImage: c.env.ImagePath,
+		},
+		{
+			name:      "CheckOnlyMessage",
+			args:      []string{"--update", "--check-only", imagePath, imageSrc},
+			exit:      100,
+			op:        e2e.ExpectError(e2e.ContainMatch, "An update of image file "+imagePath+" is available"),
+			wantImage: c.env.ImagePath,
+		},
+		{
+			name:      "Update",
+			args:      []string{"--update", imagePath, imageSrc},
+			exit:      0,
+			op:        e2e.ExpectError(e2e.ContainMatch, "updated from "+imageSrc),
+			wantImage: newImage,
+		},
+		{
+			name:      "UpdatedUpToDate",
+			args:      []string{"--update", "--check-only", imagePath, imageSrc},
+			exit:      0,
+			op:        e2e.ExpectError(e2e.ContainMatch, "is already up to date with "+imageSrc),
+			wantImage: newImage,
+		},
+		{
+			name: "OCIPull",
+			args: []string{"--registry-insecure", c.env.TestRegistry, ociPath, ociSrc},
+			exit: 0,
+		},
+		{
+			// the digest is recorded in the SIF metadata by the plain pull
+			name: "OCICheckOnly",
+			args: []string{"--registry-insecure", c.env.TestRegistry, "--update", "--check-only", ociPath, ociSrc},
+			exit: 0,
+			op:   e2e.ExpectOutput(e2e.ExactMatch, "up-to-date"),
+		},
+		{
+			name:      "Unsupported",
+			args:      []string{"--update", imagePath, "file://" + c.env.ImagePath},
+			exit:      255,
+			op:        e2e.ExpectError(e2e.ContainMatch, "--update is not supported for file images"),
+			wantImage: newImage,
+		},
+	}
+
+	for _, tt := range tests {
+		if tt.push != "" {
+			c.env.RunSingularity(
+				t,
+				e2e.AsSubtest(tt.name+"Push"),
+				e2e.WithProfile(e2e.UserProfile),
+				e2e.WithCommand("push"),
+				e2e.WithArgs(tt.push, imageSrc),
+				e2e.ExpectExit(0),
+			)
+		}
+
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("pull"),
+			e2e.WithArgs(tt.args...),
+			e2e.PostRun(func(t *testing.T) {
+				if tt.wantImage == "" || t.Failed() {
+					return
+				}
+				want, err := ioutil.ReadFile(tt.wantImage)
+				if err != nil {
+					t.Fatalf("failed to read %s: %s", tt.wantImage, err)
+				}
+				if b, err := ioutil.ReadFile(imagePath); err != nil || !bytes.Equal(b, want) {
+					t.Errorf("image file %s doesn't match %s: %v", imagePath, tt.wantImage, err)
+				}
+			}),
+			e2e.ExpectExit(tt.exit, tt.op),
+		)
+	}
+}
+
 // E2ETests is the main func to trigger the test suite
 func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	c := ctx{
@@ -608,6 +1328,13 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 
 			t.Run("pull", c.testPullCmd)
 			t.Run("pullDisableCache", c.testPullDisableCacheCmd)
+			t.Run("pullOutput", c.testPullOutput)
+			t.Run("pullName", c.testPullName)
+			t.Run("pullMirror", c.testPullMirror)
+			t.Run("pullRegistryInsecure", c.testPullRegistryInsecure)
+			t.Run("pullFile", c.testPullFile)
+			t.Run("pullBucket", c.testPullBucket)
+			t.Run("pullUpdate", c.testPullUpdate)
 		}),
 	}
 }
@@ -755,6 +755,108 @@ func (c ctx) remoteKeyserver(t *testing.T) {
 	}
 }
 
+func (c ctx) keyserverCmd(t *testing.T) {
+	var (
+		sylabsKeyserver = "https://keys.sylabs.io"
+		testKeyserver   = "http://localhost:11371"
+	)
+
+	tests := []struct {
+		name       string
+		command    string
+		args       []string
+		listLines  []string
+		expectExit int
+		profile    e2e.Profile
+	}{
+		{
+			name:       "add non privileged",
+			command:    "keyserver add",
+			args:       []string{testKeyserver},
+			expectExit: 255,
+			profile:    e2e.UserProfile,
+		},
+		{
+			name:       "add with order 0",
+			command:    "keyserver add",
+			args:       []string{"--order", "0", testKeyserver},
+			expectExit: 255,
+			profile:    e2e.RootProfile,
+		},
+		{
+			name:    "add verify only",
+			command: "keyserver add",
+			args:    []string{"--order", "1", "--verify-only", testKeyserver},
+			listLines: []string{
+				`ORDER\s+URI\s+AUTH\s+CAPABILITIES\s+INSECURE`,
+				`1\s+` + testKeyserver + `\s+NO\s+verify,search\s+NO`,
+				`2\s+` + sylabsKeyserver + `\s+(YES|NO)\s+verify,search,pull,push\s+NO`,
+			},
+			expectExit: 0,
+			profile:    e2e.RootProfile,
+		},
+		{
+			name:       "add duplicate",
+			command:    "keyserver add",
+			args:       []string{testKeyserver},
+			expectExit: 255,
+			profile:    e2e.RootProfile,
+		},
+		{
+			name:       "remove non privileged",
+			command:    "keyserver remove",
+			args:       []string{testKeyserver},
+			expectExit: 255,
+			profile:    e2e.UserProfile,
+		},
+		{
+			name:    "remove verify only",
+			command: "keyserver remove",
+			args:    []string{testKeyserver},
+			listLines: []string{
+				`1\s+` + sylabsKeyserver + `\s+(YES|NO)\s+verify,search,pull,push\s+NO`,
+			},
+			expectExit: 0,
+			profile:    e2e.RootProfile,
+		},
+		{
+			name:       "remove non-existent",
+			command:    "keyserver remove",
+			args:       []string{testKeyserver},
+			expectExit: 255,
+			profile:    e2e.RootProfile,
+		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(tt.profile),
+			e2e.WithCommand(tt.command),
+			e2e.WithArgs(tt.args...),
+			e2e.PostRun(func(t *testing.T) {
+				if t.Failed() || len(tt.listLines) == 0 {
+					return
+				}
+				c.env.RunSingularity(
+					t,
+					e2e.WithProfile(e2e.UserProfile),
+					e2e.WithCommand("keyserver list"),
+					e2e.ExpectExit(
+						0,
+						e2e.ExpectOutput(
+							e2e.RegexMatch,
+							strings.Join(tt.listLines, "\n"),
+						),
+					),
+				)
+			}),
+			e2e.ExpectExit(tt.expectExit),
+		)
+	}
+}
+
 func (c ctx) remoteUseExclusive(t *testing.T) {
 	var (
 		sylabsRemote = "SylabsCloud"
@@ -898,6 +1000,7 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 		"oci login basic":        np(c.remoteBasicLogin),
 		"oci login push private": np(c.remoteLoginPushPrivate),
 		"keyserver":              np(c.remoteKeyserver),
+		"keyserver command":      np(c.keyserverCmd),
 		"use exclusive":          np(c.remoteUseExclusive),
 	}
 }
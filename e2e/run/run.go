@@ -191,6 +191,77 @@ func (c ctx) testRunPassphraseEncrypted(t *testing.T) {
 	)
 }
 
+// testRunRekeyEncrypted checks that 'crypt rekey' replaces the key of an
+// encrypted image, or adds a second key with --keep-old, and that the
+// images are still run with the keys which weren't removed.
+func (c ctx) testRunRekeyEncrypted(t *testing.T) {
+	err := e2e.CheckCryptsetupVersion()
+	if err != nil {
+		t.Skip("cryptsetup is not compatible, skipping test")
+	}
+
+	oldPub, oldPriv := e2e.GeneratePemFiles(t, c.env.TestDir)
+	newPub, newPriv := e2e.GeneratePemFiles(t, c.env.TestDir)
+
+	tempDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "", "")
+	defer cleanup(t)
+
+	imgPath := filepath.Join(tempDir, "encrypted_rekey.sif")
+	c.env.RunSingularity(
+		t,
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--encrypt", "--pem-path", oldPub, imgPath, "library://alpine:3.11.5"),
+		e2e.ExpectExit(0),
+	)
+
+	rekey := func(name string, profile e2e.Profile, env []string, exit int, args ...string) {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(name),
+			e2e.WithProfile(profile),
+			e2e.WithCommand("crypt rekey"),
+			e2e.WithArgs(append(args, imgPath)...),
+			e2e.WithEnv(append(os.Environ(), env...)),
+			e2e.ExpectExit(exit),
+		)
+	}
+	run := func(name string, exit int, args ...string) {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(append(args, imgPath, "/bin/true")...),
+			e2e.ExpectExit(exit),
+		)
+	}
+
+	rekey("user rekey", e2e.UserProfile, nil, 255, "--old-pem", oldPriv, "--new-pem", newPub)
+	rekey("bad old key", e2e.RootProfile, nil, 255, "--old-pem", newPriv, "--new-pem", newPub)
+	run("bad old key unchanged", 0, "--pem-path", oldPriv)
+
+	// both keys decrypt the image during the migration
+	rekey("keep old", e2e.RootProfile, nil, 0, "--keep-old", "--old-pem", oldPriv, "--new-pem", newPub)
+	run("keep old with old key", 0, "--pem-path", oldPriv)
+	run("keep old with new key", 0, "--pem-path", newPriv)
+
+	// the old key is replaced by a passphrase, the new key still works
+	passphraseEnv := fmt.Sprintf("%s=%s", "SINGULARITY_NEW_ENCRYPTION_PASSPHRASE", e2e.Passphrase)
+	rekey("replace old", e2e.RootProfile, []string{passphraseEnv}, 0, "--old-pem", oldPriv)
+	run("replace old with old key", 255, "--pem-path", oldPriv)
+	run("replace old with new key", 0, "--pem-path", newPriv)
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("replace old with passphrase"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs(imgPath, "/bin/true"),
+		e2e.WithEnv(append(os.Environ(), "SINGULARITY_ENCRYPTION_PASSPHRASE="+e2e.Passphrase)),
+		e2e.ExpectExit(0),
+	)
+}
+
 // E2ETests is the main func to trigger the test suite
 func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	c := ctx{
@@ -201,5 +272,6 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 		"0555 cache":           c.testRun555Cache,
 		"passphrase encrypted": c.testRunPassphraseEncrypted,
 		"PEM encrypted":        c.testRunPEMEncrypted,
+		"rekey encrypted":      c.testRunRekeyEncrypted,
 	}
 }
@@ -43,6 +43,24 @@ func (c ctx) testRunHelp(t *testing.T) {
 			output: "No help sections were defined for this image",
 			exit:   0,
 		},
+		{
+			name:   "DefinitionHelp",
+			argv:   []string{"testdata/Singularity"},
+			output: "BAD_GUY=Thanos",
+			exit:   0,
+		},
+		{
+			name:   "DefinitionAppFooHelp",
+			argv:   []string{"--app", "foo", "testdata/Singularity"},
+			output: "This is the help for foo!",
+			exit:   0,
+		},
+		{
+			name:   "DefinitionAppFakeHelp",
+			argv:   []string{"--app", "fake", "testdata/Singularity"},
+			output: "No help sections were defined for this image",
+			exit:   0,
+		},
 		{
 			name: "NoImage",
 			argv: []string{"/fake/image"},
@@ -6,12 +6,17 @@
 package security
 
 import (
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
 
 	"github.com/sylabs/singularity/e2e/internal/e2e"
 	"github.com/sylabs/singularity/e2e/internal/testhelper"
 	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/fakeroot"
 	"github.com/sylabs/singularity/internal/pkg/test/tool/require"
 )
 
@@ -67,6 +72,12 @@ func (c ctx) testSecurityUnpriv(t *testing.T) {
 			opts:       []string{"--keep-privs"},
 			expectExit: 255, // singularity errors out, --keep-privs needs root
 		},
+		{
+			name:       "capabilities_keep_prelude",
+			argv:       []string{"true"},
+			opts:       []string{"--keep-privs-prelude", "true"},
+			expectExit: 255, // singularity errors out, --keep-privs-prelude needs root
+		},
 		{
 			// we start without any capabilities, the
 			// expected set is empty.
@@ -173,6 +184,31 @@ func (c ctx) testSecurityPriv(t *testing.T) {
 			opts:     []string{"--drop-caps", "CAP_NET_RAW"},
 			expectOp: e2e.ExpectOutput(e2e.RegexMatch, `CapEff:\s+[0f]{6}[13f]fffffdfff\n`),
 		},
+		{
+			// the prelude command runs with all the
+			// capabilities, the container command without
+			name:     "capabilities_keep_prelude",
+			argv:     []string{"grep", "^CapEff:", "/proc/self/status"},
+			opts:     []string{"--keep-privs-prelude", "grep ^CapEff: /proc/self/status"},
+			expectOp: e2e.ExpectOutput(e2e.RegexMatch, `CapEff:\s+[0f]{6}[13f]fffffffff\nCapEff:\s+0+\n`),
+		},
+		{
+			// capabilities requested with --add-caps are
+			// kept for the container command, cap_net_raw
+			// corresponds to the only bit set in CapEff.
+			name:     "capabilities_keep_prelude_add",
+			argv:     []string{"grep", "^CapEff:", "/proc/self/status"},
+			opts:     []string{"--keep-privs-prelude", "true", "--add-caps", "CAP_NET_RAW"},
+			expectOp: e2e.ExpectOutput(e2e.RegexMatch, `CapEff:\s+0+2000\n`),
+		},
+		{
+			// a failing prelude command aborts the
+			// container execution
+			name:       "capabilities_keep_prelude_failure",
+			argv:       []string{"true"},
+			opts:       []string{"--keep-privs-prelude", "false"},
+			expectExit: 255,
+		},
 	}
 
 	e2e.EnsureImage(t, c.env)
@@ -196,6 +232,324 @@ func (c ctx) testSecurityPriv(t *testing.T) {
 	}
 }
 
+// testSecurityRemap tests that users can run the container process with
+// a UID/GID of their subordinate ID ranges within a user namespace.
+func (c ctx) testSecurityRemap(t *testing.T) {
+	require.UserNamespace(t)
+	e2e.EnsureImage(t, c.env)
+
+	uid := uint32(e2e.OrigUID())
+
+	uidRange, err := fakeroot.GetIDRange(fakeroot.SubUIDFile, uid)
+	if err != nil {
+		t.Skipf("no subordinate UID range: %s", err)
+	}
+	gidRange, err := fakeroot.GetIDRange(fakeroot.SubGIDFile, uid)
+	if err != nil {
+		t.Skipf("no subordinate GID range: %s", err)
+	}
+	targetUID := uidRange.HostID + 1001
+	targetGID := gidRange.HostID + 1001
+
+	// the directory must be writable by the remapped IDs
+	hostDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "remap-", "")
+	defer cleanup(t)
+	if err := os.Chmod(hostDir, 0777); err != nil {
+		t.Fatalf("failed to change %s permissions: %s", hostDir, err)
+	}
+
+	security := fmt.Sprintf("uid:%d,gid:%d", targetUID, targetGID)
+
+	tests := []struct {
+		name       string
+		argv       []string
+		opts       []string
+		postFn     func(*testing.T)
+		expectOp   e2e.SingularityCmdResultOp
+		expectExit int
+	}{
+		{
+			name:     "Set_uid_gid",
+			argv:     []string{"sh", "-c", "echo $(id -u) $(id -g)"},
+			opts:     []string{"--security", security},
+			expectOp: e2e.ExpectOutputf(e2e.ExactMatch, "%d %d", targetUID, targetGID),
+		},
+		{
+			name: "Set_gid",
+			argv: []string{"sh", "-c", "echo $(id -u) $(id -g)"},
+			opts: []string{"--security", fmt.Sprintf("gid:%d", targetGID)},
+			// the UID is kept when only a GID is requested
+			expectOp: e2e.ExpectOutputf(e2e.ExactMatch, "%d %d", uid, targetGID),
+		},
+		{
+			name: "Bound_dir_ownership",
+			argv: []string{"touch", "/remap/file"},
+			opts: []string{"--security", security, "--bind", hostDir + ":/remap"},
+			postFn: func(t *testing.T) {
+				if t.Failed() {
+					return
+				}
+				var st syscall.Stat_t
+				file := filepath.Join(hostDir, "file")
+				if err := syscall.Stat(file, &st); err != nil {
+					t.Fatalf("could not stat %s: %s", file, err)
+				}
+				if st.Uid != targetUID || st.Gid != targetGID {
+					t.Errorf("%s owned by %d:%d instead of %d:%d", file, st.Uid, st.Gid, targetUID, targetGID)
+				}
+			},
+		},
+		{
+			name:       "Out_of_range_uid",
+			argv:       []string{"true"},
+			opts:       []string{"--security", fmt.Sprintf("uid:%d", uidRange.HostID+uidRange.Size)},
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "is not in your subordinate ID range"),
+			expectExit: 255,
+		},
+		{
+			name:       "Root_uid",
+			argv:       []string{"true"},
+			opts:       []string{"--security", "uid:0"},
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "use --fakeroot instead"),
+			expectExit: 255,
+		},
+	}
+
+	for _, tt := range tests {
+		optArgs := []string{}
+		optArgs = append(optArgs, tt.opts...)
+		optArgs = append(optArgs, c.env.ImagePath)
+		optArgs = append(optArgs, tt.argv...)
+
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(optArgs...),
+			e2e.PostRun(tt.postFn),
+			e2e.ExpectExit(tt.expectExit, tt.expectOp),
+		)
+	}
+}
+
+// testSecuritySummary tests the security context summary printed with -v,
+// which reports the actual state of the container process.
+func (c ctx) testSecuritySummary(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	tests := []struct {
+		name     string
+		profile  e2e.Profile
+		opts     []string
+		expectOp []e2e.SingularityCmdResultOp
+	}{
+		{
+			name:    "User",
+			profile: e2e.UserProfile,
+			expectOp: []e2e.SingularityCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "Security context:"),
+				e2e.ExpectError(e2e.RegexMatch, `Effective capabilities:\s+none`),
+				e2e.ExpectError(e2e.RegexMatch, `No new privileges:\s+yes`),
+				e2e.ExpectError(e2e.RegexMatch, `mount namespace:\s+created`),
+				e2e.ExpectError(e2e.RegexMatch, `Root filesystem:\s+read-only`),
+			},
+		},
+		{
+			name:    "UserRlimit",
+			profile: e2e.UserProfile,
+			opts:    []string{"--rlimit", "nofile=256:512"},
+			expectOp: []e2e.SingularityCmdResultOp{
+				e2e.ExpectError(e2e.RegexMatch, `Resource limit nofile \(soft/hard\):\s+256/512`),
+			},
+		},
+		{
+			name:    "RootNoPrivs",
+			profile: e2e.RootProfile,
+			opts:    []string{"--no-privs", "--net", "--network", "none"},
+			expectOp: []e2e.SingularityCmdResultOp{
+				e2e.ExpectError(e2e.RegexMatch, `UID \(real/effective/saved/fs\):\s+0/0/0/0`),
+				e2e.ExpectError(e2e.RegexMatch, `Effective capabilities:\s+none`),
+				e2e.ExpectError(e2e.RegexMatch, `network namespace:\s+created`),
+			},
+		},
+		{
+			name:    "RootWritableTmpfs",
+			profile: e2e.RootProfile,
+			opts:    []string{"--writable-tmpfs"},
+			expectOp: []e2e.SingularityCmdResultOp{
+				e2e.ExpectError(e2e.RegexMatch, `Root filesystem:\s+writable`),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		args := append(tt.opts, c.env.ImagePath, "true")
+
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(tt.profile),
+			e2e.WithGlobalOptions("-v"),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(args...),
+			e2e.ExpectExit(0, tt.expectOp...),
+		)
+	}
+}
+
+// testSecurityLandlock tests the filesystem access restrictions of a
+// landlock ruleset.
+func (c ctx) testSecurityLandlock(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	home, err := ioutil.TempDir(c.env.TestDir, "landlock-home-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(home)
+	bind := []string{"--bind", home + ":/home/landlock"}
+
+	tests := []struct {
+		name       string
+		opts       []string
+		argv       []string
+		expectOp   e2e.SingularityCmdResultOp
+		expectExit int
+	}{
+		{
+			name:       "WriteTmp",
+			opts:       []string{"--security", "landlock:ro=/,rw=/tmp"},
+			argv:       []string{"touch", "/tmp/landlock-e2e"},
+			expectExit: 0,
+		},
+		{
+			name:       "WriteHome",
+			opts:       []string{"--security", "landlock:ro=/,rw=/tmp"},
+			argv:       []string{"touch", "/home/landlock/file"},
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "Permission denied"),
+			expectExit: 1,
+		},
+		{
+			name:       "WriteHomeAllowed",
+			opts:       []string{"--security", "landlock:ro=/,rw=/tmp,rw=/home/landlock"},
+			argv:       []string{"touch", "/home/landlock/file"},
+			expectExit: 0,
+		},
+		{
+			name:       "BadRuleset",
+			opts:       []string{"--security", "landlock:wo=/tmp"},
+			argv:       []string{"true"},
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "invalid landlock ruleset"),
+			expectExit: 255,
+		},
+	}
+
+	for _, tt := range tests {
+		args := append([]string{}, bind...)
+		args = append(args, tt.opts...)
+		args = append(args, c.env.ImagePath)
+		args = append(args, tt.argv...)
+
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(args...),
+			e2e.PreRun(require.Landlock),
+			e2e.ExpectExit(tt.expectExit, tt.expectOp),
+		)
+	}
+}
+
+// testSecurityNoFilecaps tests that setuid bits and file capabilities
+// are ignored with the nofilecaps security feature.
+func (c ctx) testSecurityNoFilecaps(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	dir, err := ioutil.TempDir(c.env.TestDir, "nofilecaps-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer e2e.Privileged(func(t *testing.T) {
+		os.RemoveAll(dir)
+	})(t)
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatalf("failed to change permissions of %s: %s", dir, err)
+	}
+
+	// setuid root copy of the busybox binary of the image
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("Prepare"),
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("--bind", dir+":/suid", c.env.ImagePath, "sh", "-c", "cp /bin/busybox /suid/busybox && chmod 4755 /suid/busybox"),
+		e2e.ExpectExit(0),
+	)
+
+	for _, profile := range []e2e.Profile{e2e.UserProfile, e2e.UserNamespaceProfile} {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest("Setuid"+profile.String()),
+			e2e.WithProfile(profile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs("--security", "nofilecaps", "--bind", dir+":/suid", c.env.ImagePath, "/suid/busybox", "id", "-u"),
+			e2e.ExpectExit(
+				0,
+				e2e.ExpectOutputf(e2e.ExactMatch, "%d", profile.ContainerUser(t).UID),
+			),
+		)
+	}
+
+	tests := []struct {
+		name     string
+		opts     []string
+		expectOp []e2e.SingularityCmdResultOp
+	}{
+		{
+			name: "RootAllowSetuid",
+			opts: []string{"--allow-setuid"},
+			expectOp: []e2e.SingularityCmdResultOp{
+				e2e.ExpectError(e2e.RegexMatch, `No new privileges:\s+no`),
+				e2e.ExpectError(e2e.RegexMatch, `Setuid and file capabilities:\s+honored`),
+			},
+		},
+		{
+			name: "RootAllowSetuidNoFilecaps",
+			opts: []string{"--allow-setuid", "--security", "nofilecaps"},
+			expectOp: []e2e.SingularityCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "--allow-setuid has no effect with --security nofilecaps"),
+				e2e.ExpectError(e2e.RegexMatch, `No new privileges:\s+yes`),
+				e2e.ExpectError(e2e.RegexMatch, `Setuid and file capabilities:\s+ignored`),
+			},
+		},
+		{
+			name: "RootBindSuidNoFilecaps",
+			opts: []string{"--security", "nofilecaps", "--bind", dir + ":/suid:suid"},
+			expectOp: []e2e.SingularityCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "Ignoring suid option"),
+				e2e.ExpectError(e2e.RegexMatch, `Setuid and file capabilities:\s+ignored`),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		args := append(tt.opts, c.env.ImagePath, "true")
+
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.RootProfile),
+			e2e.WithGlobalOptions("-v"),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(args...),
+			e2e.ExpectExit(0, tt.expectOp...),
+		)
+	}
+}
+
 // testSecurityConfOwnership tests checks on config files ownerships
 func (c ctx) testSecurityConfOwnership(t *testing.T) {
 	e2e.EnsureImage(t, c.env)
@@ -239,8 +593,12 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	np := testhelper.NoParallel
 
 	return testhelper.Tests{
-		"singularitySecurityUnpriv": c.testSecurityUnpriv,
-		"singularitySecurityPriv":   c.testSecurityPriv,
-		"testSecurityConfOwnership": np(c.testSecurityConfOwnership),
+		"singularitySecurityUnpriv":     c.testSecurityUnpriv,
+		"singularitySecurityPriv":       c.testSecurityPriv,
+		"singularitySecurityRemap":      c.testSecurityRemap,
+		"singularitySecuritySummary":    c.testSecuritySummary,
+		"singularitySecurityLandlock":   c.testSecurityLandlock,
+		"singularitySecurityNoFilecaps": c.testSecurityNoFilecaps,
+		"testSecurityConfOwnership":     np(c.testSecurityConfOwnership),
 	}
 }
@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/sylabs/singularity/e2e/internal/e2e"
 	"github.com/sylabs/singularity/e2e/internal/testhelper"
@@ -70,7 +71,7 @@ func (c ctx) singularitySignIDOption(t *testing.T) {
 		{
 			name:       "sign deffile",
 			args:       []string{"--sif-id", "1", imgPath},
-			expectOp:   e2e.ExpectOutput(e2e.ContainMatch, "Signature created and applied to "+imgPath),
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "Signature created and applied to "+imgPath),
 			expectExit: 0,
 		},
 		{
@@ -110,13 +111,13 @@ func (c ctx) singularitySignAllOption(t *testing.T) {
 		{
 			name:       "sign default",
 			args:       []string{imgPath},
-			expectOp:   e2e.ExpectOutput(e2e.ContainMatch, "Signature created and applied to "+imgPath),
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "Signature created and applied to "+imgPath),
 			expectExit: 0,
 		},
 		{
 			name:       "sign all",
 			args:       []string{"--all", imgPath},
-			expectOp:   e2e.ExpectOutput(e2e.ContainMatch, "Signature created and applied to "+imgPath),
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "Signature created and applied to "+imgPath),
 			expectExit: 0,
 		},
 	}
@@ -150,7 +151,7 @@ func (c ctx) singularitySignGroupIDOption(t *testing.T) {
 		{
 			name:       "groupID 0",
 			args:       []string{"--group-id", "1", imgPath},
-			expectOp:   e2e.ExpectOutput(e2e.ContainMatch, "Signature created and applied to "+imgPath),
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "Signature created and applied to "+imgPath),
 			expectExit: 0,
 		},
 		{
@@ -197,6 +198,133 @@ func (c ctx) singularitySignKeyidxOption(t *testing.T) {
 	)
 }
 
+func (c ctx) singularitySignHashOption(t *testing.T) {
+	imgPath, cleanup := c.prepareImage(t)
+	defer cleanup(t)
+
+	tests := []struct {
+		name       string
+		args       []string
+		consoleOps []e2e.SingularityConsoleOp
+		expectOp   e2e.SingularityCmdResultOp
+		expectExit int
+	}{
+		{
+			name:       "sha512",
+			args:       []string{"--hash", "sha512", imgPath},
+			consoleOps: c.passphraseInput,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "Signature created and applied to "+imgPath),
+			expectExit: 0,
+		},
+		{
+			// signed twice with different hash algorithms
+			name:       "sha384",
+			args:       []string{"--hash", "sha384", imgPath},
+			consoleOps: c.passphraseInput,
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "Signature created and applied to "+imgPath),
+			expectExit: 0,
+		},
+		{
+			name:       "md5",
+			args:       []string{"--hash", "md5", imgPath},
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, `unsupported signature hash algorithm "md5"`),
+			expectExit: 255,
+		},
+	}
+
+	c.env.KeyringDir = c.keyringDir
+	c.env.ImgCacheDir = c.imgCache
+
+	for _, tt := range tests {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("sign"),
+			e2e.WithArgs(tt.args...),
+			e2e.ConsoleRun(tt.consoleOps...),
+			e2e.ExpectExit(tt.expectExit, tt.expectOp),
+		)
+	}
+
+	// both signatures are verified with their own hash algorithm
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("verify"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("verify"),
+		e2e.WithArgs(imgPath),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.ContainMatch, "Hash: sha512"),
+			e2e.ExpectOutput(e2e.ContainMatch, "Hash: sha384"),
+		),
+	)
+}
+
+func (c ctx) singularitySignSandbox(t *testing.T) {
+	imgPath, cleanup := c.prepareImage(t)
+	defer cleanup(t)
+
+	c.env.KeyringDir = c.keyringDir
+	c.env.ImgCacheDir = c.imgCache
+
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("sign"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("sign"),
+		e2e.WithArgs(imgPath),
+		e2e.ConsoleRun(c.passphraseInput...),
+		e2e.ExpectExit(0),
+	)
+
+	sandbox := filepath.Join(filepath.Dir(imgPath), "sandbox")
+	c.env.RunSingularity(
+		t,
+		e2e.AsSubtest("build"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--sandbox", sandbox, imgPath),
+		e2e.ExpectExit(0),
+	)
+
+	verify := func(name string, exit int, op e2e.SingularityCmdResultOp) {
+		c.env.RunSingularity(
+			t,
+			e2e.AsSubtest(name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("verify"),
+			e2e.WithArgs("--local", "--sandbox", sandbox),
+			e2e.ExpectExit(exit, op),
+		)
+	}
+
+	verify("verify", 0, e2e.ExpectOutput(e2e.ContainMatch, "Sandbox matches signed source"))
+
+	added := filepath.Join(sandbox, "e2e-added")
+	if err := ioutil.WriteFile(added, []byte("e2e\n"), 0644); err != nil {
+		t.Fatalf("failed to write %s: %s", added, err)
+	}
+	verify("verify added", 255, e2e.ExpectOutput(e2e.RegexMatch, `added: +e2e-added`))
+	if err := os.Remove(added); err != nil {
+		t.Fatalf("failed to remove %s: %s", added, err)
+	}
+
+	// modification times are ignored
+	if err := os.Chtimes(filepath.Join(sandbox, "bin"), time.Now(), time.Now()); err != nil {
+		t.Fatalf("failed to change times: %s", err)
+	}
+	verify("verify touched", 0, e2e.ExpectOutput(e2e.ContainMatch, "Sandbox matches signed source"))
+
+	// the source record can't hide a modification of the signed content
+	runscript := filepath.Join(sandbox, ".singularity.d", "runscript")
+	if err := ioutil.WriteFile(runscript, []byte("#!/bin/sh\necho modified\n"), 0755); err != nil {
+		t.Fatalf("failed to write %s: %s", runscript, err)
+	}
+	verify("verify modified", 255, e2e.ExpectOutput(e2e.RegexMatch, `modified: +\.singularity\.d/runscript`))
+}
+
 func (c *ctx) generateKeypair(t *testing.T) {
 	keyGenInput := []e2e.SingularityConsoleOp{
 		e2e.ConsoleSendLine("e2e sign test key"),
@@ -260,6 +388,8 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 			t.Run("singularitySignIDOption", c.singularitySignIDOption)
 			t.Run("singularitySignGroupIDOption", c.singularitySignGroupIDOption)
 			t.Run("singularitySignKeyidxOption", c.singularitySignKeyidxOption)
+			t.Run("singularitySignHashOption", c.singularitySignHashOption)
+			t.Run("singularitySignSandbox", c.singularitySignSandbox)
 		},
 	}
 }
@@ -26,6 +26,7 @@ import (
 	"github.com/sylabs/singularity/e2e/config"
 	"github.com/sylabs/singularity/e2e/delete"
 	"github.com/sylabs/singularity/e2e/docker"
+	"github.com/sylabs/singularity/e2e/doctor"
 	singularityenv "github.com/sylabs/singularity/e2e/env"
 	"github.com/sylabs/singularity/e2e/help"
 	"github.com/sylabs/singularity/e2e/imgbuild"
@@ -163,6 +164,7 @@ func Run(t *testing.T) {
 	suite.AddGroup("CONFIG", config.E2ETests)
 	suite.AddGroup("DELETE", delete.E2ETests)
 	suite.AddGroup("DOCKER", docker.E2ETests)
+	suite.AddGroup("DOCTOR", doctor.E2ETests)
 	suite.AddGroup("ENV", singularityenv.E2ETests)
 	suite.AddGroup("HELP", help.E2ETests)
 	suite.AddGroup("INSPECT", inspect.E2ETests)
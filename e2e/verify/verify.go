@@ -252,7 +252,7 @@ func (c ctx) checkGroupidOption(t *testing.T) {
 		e2e.WithArgs(cmdArgs...),
 		e2e.ExpectExit(
 			0,
-			e2e.ExpectOutput(e2e.RegexMatch, "Container verified: .*/verify_success.sif"),
+			e2e.ExpectError(e2e.RegexMatch, "Container verified: .*/verify_success.sif"),
 		),
 	)
 }
@@ -266,7 +266,7 @@ func (c ctx) checkIDOption(t *testing.T) {
 		e2e.WithArgs(cmdArgs...),
 		e2e.ExpectExit(
 			0,
-			e2e.ExpectOutput(e2e.RegexMatch, "Container verified: .*/verify_success.sif"),
+			e2e.ExpectError(e2e.RegexMatch, "Container verified: .*/verify_success.sif"),
 		),
 	)
 }
@@ -280,7 +280,7 @@ func (c ctx) checkAllOption(t *testing.T) {
 		e2e.WithArgs(cmdArgs...),
 		e2e.ExpectExit(
 			0,
-			e2e.ExpectOutput(e2e.RegexMatch, "Container verified: .*/verify_success.sif"),
+			e2e.ExpectError(e2e.RegexMatch, "Container verified: .*/verify_success.sif"),
 		),
 	)
 }
@@ -298,7 +298,7 @@ func (c ctx) checkURLOption(t *testing.T) {
 		e2e.WithArgs(cmdArgs...),
 		e2e.ExpectExit(
 			0,
-			e2e.ExpectOutput(e2e.RegexMatch, "Container verified: .*/verify_success.sif"),
+			e2e.ExpectError(e2e.RegexMatch, "Container verified: .*/verify_success.sif"),
 		),
 	)
 }
@@ -16,6 +16,7 @@ require (
 	github.com/containernetworking/cni v0.8.0
 	github.com/containernetworking/plugins v0.8.7
 	github.com/containers/image/v5 v5.6.0
+	github.com/cyphar/filepath-securejoin v0.2.2
 	github.com/deislabs/oras v0.8.1
 	github.com/docker/docker v1.4.2-0.20200203170920-46ec8731fbce
 	github.com/dsnet/compress v0.0.1 // indirect
@@ -64,5 +65,9 @@ require (
 
 replace (
 	github.com/opencontainers/image-tools => github.com/sylabs/image-tools v0.0.0-20181006203805-2814f4980568
+	// temporary fork of sif v1.2.1 with its mmap code restricted to unix
+	// platforms, to be dropped for the first sif release building on
+	// Windows
+	github.com/sylabs/sif => ./third_party/sif
 	golang.org/x/crypto => github.com/sylabs/golang-x-crypto v0.0.0-20181006204705-4bce89e8e9a9
 )
@@ -0,0 +1,108 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/sylabs/scs-library-client/client"
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/client/oras"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// addCacheEntry copies the image at path into the cacheType cache, under the
+// entry hash, unless it's already cached.
+func addCacheEntry(imgCache *cache.Handle, cacheType, hash, path string) error {
+	entry, err := imgCache.GetEntry(cacheType, hash)
+	if err != nil {
+		return fmt.Errorf("unable to check if %v exists in cache: %v", hash, err)
+	}
+	defer entry.CleanTmp()
+
+	if entry.Exists {
+		// an entry which doesn't match its manifest is replaced
+		_, err := imgCache.VerifyEntry(cacheType, hash)
+		if err == nil {
+			sylog.Infof("Image already in %s cache: %s", cacheType, hash)
+			return nil
+		} else if !errors.Is(err, cache.ErrBadChecksum) {
+			return err
+		}
+		sylog.Warningf("Replacing corrupted %s cache entry %s: %v", cacheType, hash, err)
+		if err := imgCache.RemoveEntry(cacheType, hash); err != nil {
+			return err
+		}
+		return addCacheEntry(imgCache, cacheType, hash, path)
+	}
+	entry.Source = path
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(entry.TmpPath, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return fmt.Errorf("could not copy image into cache: %v", err)
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	if err := entry.Finalize(); err != nil {
+		return err
+	}
+	sylog.Infof("Added image to %s cache: %s", cacheType, hash)
+	return nil
+}
+
+// AddSingularityCache adds the SIF image at path to the library and oras
+// caches, keyed by its digest, so pulling the same image from a library or
+// an OCI registry doesn't download it again.
+func AddSingularityCache(imgCache *cache.Handle, path string) error {
+	if imgCache == nil {
+		return errInvalidCacheHandle
+	}
+	if imgCache.IsDisabled() {
+		return fmt.Errorf("cache is disabled")
+	}
+
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("while determining absolute path for %s: %v", path, err)
+	}
+
+	fimg, err := sif.LoadContainer(path, true)
+	if err != nil {
+		return fmt.Errorf("%s is not a SIF image: %v", path, err)
+	}
+	fimg.UnloadContainer()
+
+	libraryHash, err := client.ImageHash(path)
+	if err != nil {
+		return fmt.Errorf("error getting image hash: %v", err)
+	}
+	if err := addCacheEntry(imgCache, cache.LibraryCacheType, libraryHash, path); err != nil {
+		return err
+	}
+
+	orasHash, err := oras.ImageHash(path)
+	if err != nil {
+		return fmt.Errorf("error getting image hash: %v", err)
+	}
+	return addCacheEntry(imgCache, cache.OrasCacheType, orasHash, path)
+}
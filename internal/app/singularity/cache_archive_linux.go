@@ -0,0 +1,76 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// ExportSingularityCache writes the entries of the cache, with their
+// manifest, to the tar archive path. The archive is written to a temporary
+// file replacing path once complete, a failed export leaves no partial
+// archive behind.
+func ExportSingularityCache(imgCache *cache.Handle, path string) error {
+	if imgCache == nil {
+		return errInvalidCacheHandle
+	}
+	if imgCache.IsDisabled() {
+		return fmt.Errorf("cache is disabled")
+	}
+
+	f, err := fs.MakeTmpFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp-", 0644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	count, err := imgCache.Export(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+
+	sylog.Infof("Exported %d cache entries to %s", count, path)
+	return nil
+}
+
+// ImportSingularityCache adds the entries of the tar archive path, written
+// by ExportSingularityCache, to the cache. The entries are verified against
+// their manifest first, nothing is imported if one of them is corrupted.
+// Entries already in the cache are kept.
+func ImportSingularityCache(imgCache *cache.Handle, path string) error {
+	if imgCache == nil {
+		return errInvalidCacheHandle
+	}
+	if imgCache.IsDisabled() {
+		return fmt.Errorf("cache is disabled")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	imported, skipped, err := imgCache.Import(f)
+	if err != nil {
+		return err
+	}
+
+	sylog.Infof("Imported %d cache entries from %s, %d already cached", imported, path, skipped)
+	return nil
+}
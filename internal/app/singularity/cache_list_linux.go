@@ -46,8 +46,8 @@ func findSize(size int64) string {
 
 // listTypeCache will list a cache type with given name (cacheType). The options are 'library', and 'oci'.
 // Will return: the number of containers for that type (int), the total space the container type is using (int64),
-// and an error if one occurs.
-func listTypeCache(printList bool, name, cachePath string) (int, int64, error) {
+// and an error if one occurs. The usage statistics of the entries are listed if usage isn't nil.
+func listTypeCache(printList bool, name, cachePath string, usage map[string]*cache.Usage) (int, int64, error) {
 	_, err := os.Stat(cachePath)
 	if os.IsNotExist(err) {
 		return 0, 0, nil
@@ -65,15 +65,32 @@ func listTypeCache(printList bool, name, cachePath string) (int, int64, error) {
 	)
 
 	for _, entry := range cacheEntries {
+		size := entry.Size()
+		if entry.IsDir() {
+			size = cache.DirSize(filepath.Join(cachePath, entry.Name()))
+		}
 
-		if printList {
+		if printList && usage != nil {
+			lastUsed, runs := "-", "-"
+			if u, ok := usage[filepath.Join(cachePath, entry.Name())]; ok {
+				lastUsed = u.LastUsed.Format("2006-01-02 15:04:05")
+				runs = fmt.Sprintf("%d", u.Count)
+			}
+			fmt.Printf("%-24.22s %-22s %-22s %-8s %-16s %s\n",
+				entry.Name(),
+				entry.ModTime().Format("2006-01-02 15:04:05"),
+				lastUsed,
+				runs,
+				findSize(size),
+				name)
+		} else if printList {
 			fmt.Printf("%-24.22s %-22s %-16s %s\n",
 				entry.Name(),
 				entry.ModTime().Format("2006-01-02 15:04:05"),
-				findSize(entry.Size()),
+				findSize(size),
 				name)
 		}
-		totalSize += entry.Size()
+		totalSize += size
 	}
 
 	return len(cacheEntries), totalSize, nil
@@ -83,23 +100,35 @@ func listTypeCache(printList bool, name, cachePath string) (int, int64, error) {
 // types specified by cacheListTypes. If cacheListTypes contains the
 // value "all", all the cache entries are considered. If cacheListVerbose is
 // true, the entries will be shown in the output, otherwise only a
-// summary is provided.
-func ListSingularityCache(imgCache *cache.Handle, cacheListTypes []string, cacheListVerbose bool) error {
+// summary is provided. The usage statistics of the entries are shown if
+// usage isn't nil.
+func ListSingularityCache(imgCache *cache.Handle, cacheListTypes []string, cacheListVerbose bool, usage []*cache.Usage) error {
 	if imgCache == nil {
 		return errInvalidCacheHandle
 	}
 
 	var (
-		containerCount, blobCount             int
-		containerSpace, blobSpace, totalSpace int64
+		containerCount, blobCount, layerCount, chunkCount, inspectCount             int
+		containerSpace, blobSpace, layerSpace, chunkSpace, inspectSpace, totalSpace int64
 	)
 
-	if cacheListVerbose {
+	var usageMap map[string]*cache.Usage
+	if usage != nil {
+		usageMap = make(map[string]*cache.Usage, len(usage))
+		for _, u := range usage {
+			usageMap[u.Image] = u
+		}
+	}
+
+	if cacheListVerbose && usageMap != nil {
+		fmt.Printf("%-24s %-22s %-22s %-8s %-16s %s\n", "NAME", "DATE CREATED", "LAST USED", "RUNS", "SIZE", "TYPE")
+	} else if cacheListVerbose {
 		fmt.Printf("%-24s %-22s %-16s %s\n", "NAME", "DATE CREATED", "SIZE", "TYPE")
 	}
 
 	containersShown := false
 	blobsShown := false
+	layersShown := false
 
 	// If types requested includes "all" then we don't want to filter anything
 	if stringInSlice("all", cacheListTypes) {
@@ -118,7 +147,7 @@ func ListSingularityCache(imgCache *cache.Handle, cacheListTypes []string, cache
 			return err
 		}
 		cacheDir = filepath.Join(cacheDir, "blobs", "sha256")
-		blobsCount, blobsSize, err := listTypeCache(cacheListVerbose, cacheType, cacheDir)
+		blobsCount, blobsSize, err := listTypeCache(cacheListVerbose, cacheType, cacheDir, usageMap)
 		if err != nil {
 			fmt.Print(err)
 			return err
@@ -136,17 +165,46 @@ func ListSingularityCache(imgCache *cache.Handle, cacheListTypes []string, cache
 		if err != nil {
 			return err
 		}
-		count, size, err := listTypeCache(cacheListVerbose, cacheType, cacheDir)
+		count, size, err := listTypeCache(cacheListVerbose, cacheType, cacheDir, usageMap)
 		if err != nil {
 			fmt.Print(err)
 			return err
 		}
+		totalSpace += size
+		if cacheType == cache.ChunkCacheType {
+			chunkCount += count
+			chunkSpace += size
+			continue
+		}
+		if cacheType == cache.InspectCacheType {
+			inspectCount += count
+			inspectSpace += size
+			continue
+		}
 		containerCount += count
 		containerSpace += size
-		totalSpace += size
 		containersShown = true
 	}
 
+	for _, cacheType := range cache.DirCacheTypes {
+		if len(cacheListTypes) > 0 && !stringInSlice(cacheType, cacheListTypes) {
+			continue
+		}
+		cacheDir, err := imgCache.GetDirCacheDir(cacheType)
+		if err != nil {
+			return err
+		}
+		count, size, err := listTypeCache(cacheListVerbose, cacheType, cacheDir, usageMap)
+		if err != nil {
+			fmt.Print(err)
+			return err
+		}
+		layerCount += count
+		layerSpace += size
+		totalSpace += size
+		layersShown = true
+	}
+
 	if cacheListVerbose {
 		fmt.Print("\n")
 	}
@@ -162,6 +220,18 @@ func ListSingularityCache(imgCache *cache.Handle, cacheListTypes []string, cache
 	if blobsShown {
 		fmt.Fprintf(out, " %d oci blob file(s) using %s", blobCount, findSize(blobSpace))
 	}
+	if (containersShown || blobsShown) && layersShown {
+		fmt.Fprintf(out, " and")
+	}
+	if layersShown {
+		fmt.Fprintf(out, " %d oci layer chain(s) using %s", layerCount, findSize(layerSpace))
+	}
+	if chunkCount > 0 {
+		fmt.Fprintf(out, " and %d library chunk(s) using %s", chunkCount, findSize(chunkSpace))
+	}
+	if inspectCount > 0 {
+		fmt.Fprintf(out, " and %d inspect metadata file(s) using %s", inspectCount, findSize(inspectSpace))
+	}
 	out.WriteString(" of space\n")
 
 	fmt.Print(out.String())
@@ -0,0 +1,65 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sylabs/singularity/internal/pkg/cache"
+)
+
+// CacheStats prints the usage statistics of the images, sorted by
+// decreasing run count, followed by a summary. The type of an image is its
+// cache type for the entries of imgCache, local for other images and
+// removed for the images which don't exist anymore. The space used by the
+// cache entries is the size recorded in their manifest.
+func CacheStats(imgCache *cache.Handle, usage []*cache.Usage) error {
+	if imgCache == nil {
+		return errInvalidCacheHandle
+	}
+
+	var (
+		runCount, cachedCount uint64
+		cachedSpace           int64
+	)
+
+	if len(usage) > 0 {
+		fmt.Printf("%-8s %-22s %-10s %s\n", "RUNS", "LAST USED", "TYPE", "IMAGE")
+	}
+	for _, u := range usage {
+		imageType := imgCache.EntryType(u.Image)
+		fi, err := os.Stat(u.Image)
+		if err != nil {
+			imageType = "removed"
+		} else if imageType == "" {
+			imageType = "local"
+		} else {
+			cachedCount++
+			size := fi.Size()
+			if m, err := imgCache.ReadManifest(imageType, filepath.Base(u.Image)); err == nil {
+				size = m.Size
+			}
+			cachedSpace += size
+		}
+		runCount += u.Count
+
+		fmt.Printf("%-8d %-22s %-10s %s\n",
+			u.Count,
+			u.LastUsed.Format("2006-01-02 15:04:05"),
+			imageType,
+			u.Image)
+	}
+	if len(usage) > 0 {
+		fmt.Print("\n")
+	}
+
+	fmt.Printf("There are %d image(s) run %d time(s), %d of them in the cache using %s\n",
+		len(usage), runCount, cachedCount, findSize(cachedSpace))
+
+	return nil
+}
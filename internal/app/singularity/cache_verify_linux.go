@@ -0,0 +1,77 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// VerifySingularityCache checks that the content of the cache entries of
+// the types cacheVerifyTypes, or of all types if it contains "all", match
+// their manifest, and prints the result for each entry. Entries without
+// manifest get one recorded. It returns an error if an entry is corrupted.
+func VerifySingularityCache(imgCache *cache.Handle, cacheVerifyTypes []string) error {
+	if imgCache == nil {
+		return errInvalidCacheHandle
+	}
+
+	cacheTypes := append(append([]string{}, cache.FileCacheTypes...), cache.DirCacheTypes...)
+	if len(cacheVerifyTypes) > 0 && !stringInSlice("all", cacheVerifyTypes) {
+		cacheTypes = cacheVerifyTypes
+	}
+
+	var entryCount, failedCount int
+
+	for _, cacheType := range cacheTypes {
+		cacheDir, err := imgCache.GetFileCacheDir(cacheType)
+		if err == cache.ErrInvalidCacheType {
+			cacheDir, err = imgCache.GetDirCacheDir(cacheType)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot verify %s cache: %v", cacheType, err)
+		}
+
+		entries, err := ioutil.ReadDir(cacheDir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("unable to open cache %s at directory %s: %v", cacheType, cacheDir, err)
+		}
+
+		for _, e := range entries {
+			// entries being created
+			if strings.HasPrefix(e.Name(), "tmp_") {
+				continue
+			}
+			entryCount++
+
+			status := "OK"
+			m, err := imgCache.VerifyEntry(cacheType, e.Name())
+			if err != nil {
+				sylog.Errorf("%s cache entry %s: %v", cacheType, e.Name(), err)
+				status = "FAILED"
+				failedCount++
+			}
+			source := "-"
+			if m != nil && m.Source != "" {
+				source = m.Source
+			}
+			fmt.Printf("%-8s %-10s %-24.22s %s\n", status, cacheType, e.Name(), source)
+		}
+	}
+
+	if failedCount > 0 {
+		return fmt.Errorf("%d of %d cache entries failed verification", failedCount, entryCount)
+	}
+	fmt.Printf("Verified %d cache entries\n", entryCount)
+	return nil
+}
@@ -1,4 +1,4 @@
-// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// Copyright (c) 2019-2020, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -6,9 +6,15 @@
 package singularity
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
 
 	"github.com/sylabs/singularity/internal/pkg/fakeroot"
+	"github.com/sylabs/singularity/internal/pkg/util/user"
+	"github.com/sylabs/singularity/pkg/sylog"
 )
 
 // FakerootConfigOp defines a type for a fakeroot
@@ -80,3 +86,67 @@ func FakerootConfig(username string, op FakerootConfigOp) error {
 
 	return nil
 }
+
+// FakerootList prints the fakeroot mappings of the users with an entry
+// in /etc/subuid or /etc/subgid, or of username only if not empty, and
+// where each mapping was found.
+func FakerootList(username string) error {
+	var uids []uint32
+
+	if username != "" {
+		u, err := user.GetPwNam(username)
+		if err != nil {
+			return fmt.Errorf("could not retrieve user information for %s: %s", username, err)
+		}
+		uids = append(uids, u.UID)
+	} else {
+		seen := make(map[uint32]bool)
+		for _, file := range []string{fakeroot.SubUIDFile, fakeroot.SubGIDFile} {
+			if _, err := os.Stat(file); os.IsNotExist(err) {
+				continue
+			}
+			config, err := fakeroot.GetConfig(file, false, nil)
+			if err != nil {
+				return fmt.Errorf("while opening %s: %s", file, err)
+			}
+			for _, uid := range config.UIDs() {
+				if !seen[uid] {
+					seen[uid] = true
+					uids = append(uids, uid)
+				}
+			}
+			config.Close()
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", "USER", "UID RANGE", "GID RANGE", "SOURCE")
+	for _, uid := range uids {
+		name := strconv.FormatUint(uint64(uid), 10)
+		if u, err := user.GetPwUID(uid); err == nil {
+			name = u.Name
+		}
+		uidRange, uidSource := fakerootMapping(fakeroot.SubUIDFile, uid)
+		gidRange, gidSource := fakerootMapping(fakeroot.SubGIDFile, uid)
+		source := uidSource
+		if gidSource != uidSource {
+			source += ", " + gidSource
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", name, uidRange, gidRange, source)
+	}
+	return tw.Flush()
+}
+
+// fakerootMapping returns the mapping of the user uid for the file path
+// formatted for FakerootList and its source.
+func fakerootMapping(path string, uid uint32) (string, string) {
+	idRange, source, err := fakeroot.LookupIDRange(path, uid)
+	if err != nil {
+		sylog.Debugf("No mapping for UID %d in %s: %s", uid, path, err)
+		if errors.Is(err, fakeroot.ErrMappingDisabled) {
+			return "disabled", path
+		}
+		return "none", "-"
+	}
+	return fmt.Sprintf("%d-%d", idRange.HostID, idRange.HostID+idRange.Size-1), source
+}
@@ -92,8 +92,12 @@ func GlobalConfig(args []string, configFile string, dry bool, op GlobalConfigOp)
 		return err
 	}
 
+	split := singularityconf.SplitsValues(directive)
+
 	values := []string{}
-	if value != "" {
+	if value != "" && !split {
+		values = append(values, strings.TrimSpace(value))
+	} else if value != "" {
 		for _, v := range strings.Split(value, ",") {
 			va := strings.TrimSpace(v)
 			if va != "" {
@@ -136,7 +140,11 @@ func GlobalConfig(args []string, configFile string, dry bool, op GlobalConfigOp)
 		}
 	case GlobalConfigGet:
 		if len(directives[directive]) > 0 {
-			fmt.Println(strings.Join(directives[directive], ","))
+			sep := ","
+			if !split {
+				sep = "\n"
+			}
+			fmt.Println(strings.Join(directives[directive], sep))
 		}
 		return nil
 	case GlobalConfigReset:
@@ -0,0 +1,222 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/util/crypt"
+)
+
+// CryptRekeyOptions are the keys of an encrypted image rekey.
+type CryptRekeyOptions struct {
+	// OldKey is a PEM private key or a passphrase opening the image.
+	OldKey crypt.KeyInfo
+	// NewKey is a PEM public key or a passphrase replacing OldKey.
+	NewKey crypt.KeyInfo
+	// KeepOld keeps OldKey, both keys open the image, to migrate the
+	// users of the image to the new key.
+	KeepOld bool
+}
+
+// CryptRekey replaces the key of the encrypted SIF image path. Only the
+// LUKS key slots and the encrypted keys of the image are rewritten, not the
+// encrypted partition. The image is modified in a temporary copy, which
+// replaces the image once the new key was checked by mounting the
+// encrypted partition.
+func CryptRekey(path string, opts CryptRekeyOptions) error {
+	if os.Geteuid() != 0 {
+		return errors.New("rekeying an encrypted image requires root privileges")
+	}
+
+	oldKey, oldID, err := crypt.PlaintextKeyMessage(opts.OldKey, path)
+	if err != nil {
+		return fmt.Errorf("while reading the key of %s: %s", path, err)
+	}
+	newKey, err := crypt.NewPlaintextKey(opts.NewKey)
+	if err != nil {
+		return fmt.Errorf("unable to obtain the new key: %s", err)
+	}
+	if bytes.Equal(oldKey, newKey) {
+		return errors.New("the new key is the same as the old key")
+	}
+	message, err := crypt.EncryptKey(opts.NewKey, newKey)
+	if err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := fs.MakeTmpFile(filepath.Dir(path), "."+filepath.Base(path)+".rekey-", 0600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = copyImage(tmp, path)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("while copying %s: %s", path, err)
+	}
+
+	if err := rekeyImage(tmp.Name(), oldKey, newKey, oldID, message, opts.KeepOld); err != nil {
+		return err
+	}
+
+	// the new key, and the old key when kept, must open the image
+	if err := checkEncryptedImage(tmp.Name(), newKey); err != nil {
+		return fmt.Errorf("while checking the new key: %s", err)
+	}
+	if opts.KeepOld {
+		if err := checkEncryptedImage(tmp.Name(), oldKey); err != nil {
+			return fmt.Errorf("while checking the old key: %s", err)
+		}
+	}
+
+	if err := os.Chmod(tmp.Name(), fi.Mode().Perm()); err != nil {
+		return err
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		if err := os.Chown(tmp.Name(), int(st.Uid), int(st.Gid)); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("while replacing %s: %s", path, err)
+	}
+	if d, err := os.Open(filepath.Dir(path)); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// copyImage copies the image path to f and syncs it.
+func copyImage(f *os.File, path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if _, err := io.Copy(f, src); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// rekeyImage adds the key slot of newKey to the encrypted partition of
+// the image path and records its encrypted key message, if any. Without
+// keepOld, the key slot of oldKey and its encrypted key with the
+// descriptor ID oldID, if any, are removed.
+func rekeyImage(path string, oldKey, newKey []byte, oldID uint32, message []byte, keepOld bool) error {
+	img, err := sif.LoadContainer(path, false)
+	if err != nil {
+		return fmt.Errorf("while loading SIF image: %s", err)
+	}
+	defer img.UnloadContainer()
+
+	part, _, err := img.GetPartPrimSys()
+	if err != nil {
+		return fmt.Errorf("while getting the primary partition: %s", err)
+	}
+	if fstype, err := part.GetFsType(); err != nil || fstype != sif.FsEncryptedSquashfs {
+		return fmt.Errorf("the primary partition is not encrypted")
+	}
+	if sigs, _, err := img.GetLinkedDescrsByType(part.ID, sif.DataSignature); err == nil && len(sigs) > 0 {
+		sylog.Warningf("The signatures of the encrypted partition are invalidated by the new key, the image must be signed again")
+	}
+
+	loopDev, err := crypt.AttachLoop(path, uint64(part.Fileoff), uint64(part.Filelen))
+	if err != nil {
+		return err
+	}
+
+	dev := &crypt.Device{}
+	if err := dev.AddKey(loopDev, oldKey, newKey); err != nil {
+		return fmt.Errorf("while adding the new key: %s", err)
+	}
+	if !keepOld {
+		if err := dev.RemoveKey(loopDev, oldKey); err != nil {
+			return fmt.Errorf("while removing the old key: %s", err)
+		}
+		if oldID != 0 {
+			if err := img.DeleteObject(oldID, 0); err != nil {
+				return fmt.Errorf("while removing the old encrypted key: %s", err)
+			}
+		}
+	}
+
+	if message != nil {
+		in := sif.DescriptorInput{
+			Datatype: sif.DataCryptoMessage,
+			Groupid:  sif.DescrDefaultGroup,
+			Link:     part.ID,
+			Data:     message,
+			Size:     int64(len(message)),
+		}
+		if err := in.SetCryptoMsgExtra(sif.FormatPEM, sif.MessageRSAOAEP); err != nil {
+			return err
+		}
+		if err := img.AddObject(in); err != nil {
+			return fmt.Errorf("while adding the new encrypted key: %s", err)
+		}
+	}
+	return nil
+}
+
+// checkEncryptedImage checks that key opens the encrypted partition of the
+// image path and that its filesystem can be mounted.
+func checkEncryptedImage(path string, key []byte) error {
+	img, err := sif.LoadContainer(path, true)
+	if err != nil {
+		return fmt.Errorf("while loading SIF image: %s", err)
+	}
+	part, _, err := img.GetPartPrimSys()
+	img.UnloadContainer()
+	if err != nil {
+		return fmt.Errorf("while getting the primary partition: %s", err)
+	}
+
+	loopDev, err := crypt.AttachLoop(path, uint64(part.Fileoff), uint64(part.Filelen))
+	if err != nil {
+		return err
+	}
+
+	dev := &crypt.Device{}
+	name, err := dev.Open(key, loopDev)
+	if err != nil {
+		return err
+	}
+	defer dev.CloseCryptDevice(name)
+
+	dir, err := ioutil.TempDir("", "rekey-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(dir)
+
+	flags := uintptr(syscall.MS_RDONLY | syscall.MS_NOSUID | syscall.MS_NODEV)
+	if err := syscall.Mount("/dev/mapper/"+name, dir, "squashfs", flags, ""); err != nil {
+		return fmt.Errorf("while mounting the encrypted partition: %s", err)
+	}
+	return syscall.Unmount(dir, 0)
+}
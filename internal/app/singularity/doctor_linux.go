@@ -0,0 +1,550 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/security/seccomp"
+	"github.com/sylabs/singularity/internal/pkg/util/fs/squashfs"
+	"github.com/sylabs/singularity/pkg/util/fs/proc"
+	"github.com/sylabs/singularity/pkg/util/singularityconf"
+	"golang.org/x/sys/unix"
+)
+
+// doctorSmokeTimeout is the time allowed to the smoke test container.
+const doctorSmokeTimeout = 30 * time.Second
+
+// DoctorResult is the result of the probe of a host feature.
+type DoctorResult struct {
+	Feature   string `json:"feature"`
+	Available bool   `json:"available"`
+	// Core is set for the features without which no container can run.
+	Core    bool   `json:"core"`
+	Details string `json:"details"`
+	// Hint is the remediation of an unavailable feature.
+	Hint string `json:"hint,omitempty"`
+}
+
+// doctorProbe returns if a feature is available, with details and a
+// remediation hint when it's not.
+type doctorProbe func(conf *singularityconf.File) (available bool, details, hint string)
+
+// doctorFeatures lists the features probed by Doctor, in order.
+var doctorFeatures = []struct {
+	name  string
+	core  bool
+	probe doctorProbe
+}{
+	{"starter", true, probeStarter},
+	{"setuid", false, probeSetuid},
+	{"userns", false, probeUserNamespace},
+	{"overlay", false, probeOverlay},
+	{"squashfs", false, probeSquashfs},
+	{"loop", false, probeLoop},
+	{"fuse", false, probeFuse},
+	{"cgroups", false, probeCgroups},
+	{"seccomp", false, probeSeccomp},
+	{"mksquashfs", false, probeMksquashfs},
+	{"smoke", true, probeSmoke},
+}
+
+// DoctorFeatures returns the names of the features probed by Doctor.
+func DoctorFeatures() []string {
+	names := make([]string, 0, len(doctorFeatures))
+	for _, f := range doctorFeatures {
+		names = append(names, f.name)
+	}
+	return names
+}
+
+// starterPath returns the path of the starter binary, the setuid one if
+// suid is true.
+func starterPath(suid bool) string {
+	name := "starter"
+	if suid {
+		name = "starter-suid"
+	}
+	return filepath.Join(buildcfg.LIBEXECDIR, "singularity", "bin", name)
+}
+
+func probeStarter(conf *singularityconf.File) (bool, string, string) {
+	var found []string
+	if err := unix.Access(starterPath(false), unix.X_OK); err == nil {
+		found = append(found, "starter")
+	}
+	if ok, _, _ := probeSetuid(conf); ok {
+		found = append(found, "starter-suid")
+	}
+	if len(found) == 0 {
+		return false, fmt.Sprintf("no usable starter in %s", filepath.Dir(starterPath(false))),
+			"reinstall Singularity with 'make install', the starter binaries are installed in LIBEXECDIR"
+	}
+	return true, strings.Join(found, " and ") + " usable", ""
+}
+
+func probeSetuid(conf *singularityconf.File) (bool, string, string) {
+	path := starterPath(true)
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false, fmt.Sprintf("%s not found", path),
+			"install Singularity as root with 'make install' to set up the setuid workflow, or rely on user namespaces"
+	}
+	st := fi.Sys().(*syscall.Stat_t)
+	if st.Uid != 0 || fi.Mode()&os.ModeSetuid == 0 {
+		return false, fmt.Sprintf("%s is not owned by root with the setuid bit", path),
+			fmt.Sprintf("run 'chown root:root %[1]s && chmod 4755 %[1]s' as root", path)
+	}
+	var sfs unix.Statfs_t
+	if err := unix.Statfs(path, &sfs); err == nil && sfs.Flags&unix.ST_NOSUID != 0 {
+		return false, fmt.Sprintf("%s is on a nosuid mount", path),
+			"install Singularity on a filesystem mounted without the nosuid option"
+	}
+	if conf != nil && !conf.AllowSetuid {
+		return false, "disabled by 'allow setuid = no' in singularity.conf",
+			"set 'allow setuid = yes' in singularity.conf"
+	}
+	return true, fmt.Sprintf("%s owned by root with the setuid bit", path), ""
+}
+
+// readSysctl returns the value of the sysctl file path, or an empty string
+// if it can't be read.
+func readSysctl(path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func probeUserNamespace(conf *singularityconf.File) (bool, string, string) {
+	if _, err := os.Stat("/proc/self/ns/user"); err != nil {
+		return false, "the kernel doesn't support user namespaces",
+			"use a kernel built with CONFIG_USER_NS, or the setuid workflow"
+	}
+	// as for the tests requiring user namespaces, executing a command in
+	// a new user namespace is the reliable way to check they are enabled
+	cmd := exec.Command("/bin/true")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER,
+	}
+	if err := cmd.Run(); err != nil {
+		details := fmt.Sprintf("could not create a user namespace: %s", err)
+		switch {
+		case readSysctl("/proc/sys/user/max_user_namespaces") == "0":
+			return false, details, "run 'sysctl -w user.max_user_namespaces=15000' as root, and persist it in /etc/sysctl.d"
+		case readSysctl("/proc/sys/kernel/unprivileged_userns_clone") == "0":
+			return false, details, "run 'sysctl -w kernel.unprivileged_userns_clone=1' as root, and persist it in /etc/sysctl.d"
+		}
+		return false, details, "check whether a security module (e.g. SELinux or AppArmor) denies user namespaces"
+	}
+	if max := readSysctl("/proc/sys/user/max_user_namespaces"); max != "" {
+		return true, fmt.Sprintf("enabled, up to %s user namespaces", max), ""
+	}
+	return true, "enabled", ""
+}
+
+// probeFilesystem probes the kernel support of the filesystem fs.
+func probeFilesystem(fs string) (bool, string, string) {
+	has, err := proc.HasFilesystem(fs)
+	if err != nil {
+		return false, err.Error(), ""
+	}
+	if !has {
+		return false, fmt.Sprintf("%s is not listed in /proc/filesystems", fs),
+			fmt.Sprintf("load the %[1]s kernel module with 'modprobe %[1]s' as root", fs)
+	}
+	return true, "supported by the kernel", ""
+}
+
+func probeOverlay(conf *singularityconf.File) (bool, string, string) {
+	if conf != nil && conf.EnableOverlay == "no" {
+		return false, "disabled by 'enable overlay = no' in singularity.conf",
+			"set 'enable overlay = try' in singularity.conf"
+	}
+	return probeFilesystem("overlay")
+}
+
+func probeSquashfs(conf *singularityconf.File) (bool, string, string) {
+	return probeFilesystem("squashfs")
+}
+
+func probeLoop(conf *singularityconf.File) (bool, string, string) {
+	if _, err := os.Stat("/dev/loop-control"); err != nil {
+		return false, "/dev/loop-control not found",
+			"load the loop kernel module with 'modprobe loop' as root"
+	}
+	if conf != nil && conf.MaxLoopDevices == 0 {
+		return false, "disabled by 'max loop devices = 0' in singularity.conf",
+			"set 'max loop devices' in singularity.conf"
+	}
+	return true, "/dev/loop-control found", ""
+}
+
+func probeFuse(conf *singularityconf.File) (bool, string, string) {
+	if _, err := os.Stat("/dev/fuse"); err != nil {
+		return false, "/dev/fuse not found",
+			"load the fuse kernel module with 'modprobe fuse' as root"
+	}
+	return true, "/dev/fuse found", ""
+}
+
+// cgroupDelegated returns the cgroup v2 controllers delegated to the
+// current user, the controllers enabled in the cgroup subtree of the user
+// systemd instance when the user owns it.
+func cgroupDelegated() []string {
+	b, err := ioutil.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return nil
+	}
+	service := fmt.Sprintf("user@%d.service", os.Getuid())
+	for _, line := range strings.Split(string(b), "\n") {
+		if !strings.HasPrefix(line, "0::") {
+			continue
+		}
+		path := strings.TrimPrefix(line, "0::")
+		i := strings.Index(path, service)
+		if i < 0 {
+			return nil
+		}
+		dir := filepath.Join("/sys/fs/cgroup", path[:i+len(service)])
+		fi, err := os.Stat(dir)
+		if err != nil || fi.Sys().(*syscall.Stat_t).Uid != uint32(os.Getuid()) {
+			return nil
+		}
+		return strings.Fields(readSysctl(filepath.Join(dir, "cgroup.subtree_control")))
+	}
+	return nil
+}
+
+func probeCgroups(conf *singularityconf.File) (bool, string, string) {
+	var st unix.Statfs_t
+	if err := unix.Statfs("/sys/fs/cgroup", &st); err != nil {
+		return false, "/sys/fs/cgroup is not mounted", "mount the cgroup filesystems, usually done by the init system"
+	}
+
+	if st.Type != unix.CGROUP2_SUPER_MAGIC {
+		if os.Geteuid() != 0 {
+			return false, "cgroup v1, resource limits require root",
+				"run as root to apply resource limits with --apply-cgroups"
+		}
+		return true, "cgroup v1", ""
+	}
+
+	controllers := readSysctl("/sys/fs/cgroup/cgroup.controllers")
+	details := fmt.Sprintf("cgroup v2, controllers: %s", controllers)
+	if os.Geteuid() == 0 {
+		return true, details, ""
+	}
+	delegated := cgroupDelegated()
+	if len(delegated) == 0 {
+		return false, details + ", none delegated to the user",
+			"delegate the cgroup controllers to users with 'Delegate=yes' in a systemd drop-in for user@.service"
+	}
+	return true, fmt.Sprintf("%s, delegated to the user: %s", details, strings.Join(delegated, " ")), ""
+}
+
+func probeSeccomp(conf *singularityconf.File) (bool, string, string) {
+	if !seccomp.Enabled() {
+		return false, "Singularity was built without seccomp support",
+			"rebuild Singularity with the libseccomp development headers installed"
+	}
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return false, err.Error(), ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "Seccomp:") {
+			return true, "supported by Singularity and the kernel", ""
+		}
+	}
+	return false, "the kernel doesn't support seccomp", "use a kernel built with CONFIG_SECCOMP_FILTER"
+}
+
+func probeMksquashfs(conf *singularityconf.File) (bool, string, string) {
+	path, err := squashfs.GetPath()
+	if err != nil {
+		return false, fmt.Sprintf("mksquashfs not found: %s", err),
+			"install squashfs-tools, or set 'mksquashfs path' in singularity.conf, to build SIF images"
+	}
+	return true, path, ""
+}
+
+// doctorTrue returns a static executable for arch exiting with status 0,
+// the payload of the smoke test, or nil if arch isn't supported.
+func doctorTrue(arch string) []byte {
+	var machine elf.Machine
+	var code []byte
+
+	switch arch {
+	case "amd64":
+		machine = elf.EM_X86_64
+		// mov $60, %eax; xor %edi, %edi; syscall (exit)
+		code = []byte{0xb8, 0x3c, 0x00, 0x00, 0x00, 0x31, 0xff, 0x0f, 0x05}
+	case "arm64":
+		machine = elf.EM_AARCH64
+		// mov x0, #0; mov x8, #93; svc #0 (exit)
+		code = []byte{0x00, 0x00, 0x80, 0xd2, 0xa8, 0x0b, 0x80, 0xd2, 0x01, 0x00, 0x00, 0xd4}
+	default:
+		return nil
+	}
+
+	// the code follows the ELF header and a single program header
+	// loading the whole file
+	const base = 0x400000
+	hdrSize := binary.Size(elf.Header64{})
+	progSize := binary.Size(elf.Prog64{})
+	size := uint64(hdrSize + progSize + len(code))
+
+	hdr := elf.Header64{
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Entry:     base + uint64(hdrSize+progSize),
+		Phoff:     uint64(hdrSize),
+		Ehsize:    uint16(hdrSize),
+		Phentsize: uint16(progSize),
+		Phnum:     1,
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	prog := elf.Prog64{
+		Type:   uint32(elf.PT_LOAD),
+		Flags:  uint32(elf.PF_R | elf.PF_X),
+		Vaddr:  base,
+		Paddr:  base,
+		Filesz: size,
+		Memsz:  size,
+		Align:  0x1000,
+	}
+
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, hdr)
+	binary.Write(buf, binary.LittleEndian, prog)
+	buf.Write(code)
+	return buf.Bytes()
+}
+
+// makeSmokeRootfs creates a minimal root filesystem in dir holding the
+// smoke test payload as /bin/true.
+func makeSmokeRootfs(dir string) error {
+	payload := doctorTrue(runtime.GOARCH)
+	if payload == nil {
+		return fmt.Errorf("no smoke test payload for the %s architecture", runtime.GOARCH)
+	}
+	for _, d := range smokeRootfsDirs {
+		if err := os.Mkdir(filepath.Join(dir, d), 0755); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "bin", "true"), payload, 0755)
+}
+
+// smokeRootfsDirs lists the directories of the smoke test root filesystem.
+var smokeRootfsDirs = []string{"bin", "dev", "etc", "proc", "sys", "tmp"}
+
+// makeSmokeImage creates at path a SIF image holding the smoke test root
+// filesystem as a squashfs partition, generated in memory, so the smoke
+// test runs the same image driver as the default image format.
+func makeSmokeImage(path string) error {
+	payload := doctorTrue(runtime.GOARCH)
+	if payload == nil {
+		return fmt.Errorf("no smoke test payload for the %s architecture", runtime.GOARCH)
+	}
+	root := &squashfsNode{mode: 0755}
+	for _, d := range smokeRootfsDirs {
+		n := &squashfsNode{name: d, mode: 0755}
+		if d == "bin" {
+			n.children = []*squashfsNode{{name: "true", mode: 0755, data: payload}}
+		}
+		root.children = append(root.children, n)
+	}
+	rootfs, err := makeSquashfs(root)
+	if err != nil {
+		return fmt.Errorf("while creating squashfs: %s", err)
+	}
+
+	part := sif.DescriptorInput{
+		Datatype: sif.DataPartition,
+		Groupid:  sif.DescrDefaultGroup,
+		Link:     sif.DescrUnusedLink,
+		Fname:    "rootfs.squashfs",
+		Data:     rootfs,
+		Size:     int64(len(rootfs)),
+	}
+	if err := part.SetPartExtra(sif.FsSquash, sif.PartPrimSys, sif.GetSIFArch(runtime.GOARCH)); err != nil {
+		return err
+	}
+	cinfo := sif.CreateInfo{
+		Pathname:   path,
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []sif.DescriptorInput{part},
+	}
+	if _, err := sif.CreateContainer(cinfo); err != nil {
+		return fmt.Errorf("while creating SIF: %s", err)
+	}
+	return nil
+}
+
+func probeSmoke(conf *singularityconf.File) (bool, string, string) {
+	self, err := os.Executable()
+	if err != nil {
+		return false, fmt.Sprintf("could not find the singularity binary: %s", err), ""
+	}
+
+	dir, err := ioutil.TempDir("", "singularity-doctor-")
+	if err != nil {
+		return false, fmt.Sprintf("could not create the smoke test image: %s", err),
+			"set TMPDIR to a writable directory"
+	}
+	defer os.RemoveAll(dir)
+
+	// a SIF image is used unless squashfs images are disallowed, the
+	// sandbox directory is the only image format left then
+	image, format := filepath.Join(dir, "smoke.sif"), "SIF image"
+	if conf != nil && !conf.AllowContainerSquashfs {
+		image, format = filepath.Join(dir, "rootfs"), "sandbox image"
+		if err := os.Mkdir(image, 0755); err == nil {
+			err = makeSmokeRootfs(image)
+		}
+	} else {
+		err = makeSmokeImage(image)
+	}
+	if err != nil {
+		return false, fmt.Sprintf("could not create the smoke test image: %s", err), ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), doctorSmokeTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, self, "exec", "--contain", image, "/bin/true")
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return false, fmt.Sprintf("the container didn't exit within %s", doctorSmokeTimeout),
+			fmt.Sprintf("run 'singularity -d exec --contain' on a %s to find where it hangs", format)
+	}
+	if err != nil {
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		hint := fmt.Sprintf("check TMPDIR (%s) is not mounted noexec, and fix the unavailable features above", os.TempDir())
+		if conf != nil && len(conf.LimitContainerPaths) > 0 {
+			hint = fmt.Sprintf("set TMPDIR to a directory allowed by 'limit container paths' in singularity.conf, %s", hint)
+		}
+		return false, fmt.Sprintf("exec of a %s failed: %s: %s", format, err, lines[len(lines)-1]), hint
+	}
+	return true, fmt.Sprintf("exec of a minimal %s succeeded", format), ""
+}
+
+// Doctor probes the features of the host the runtime can use, all of
+// them or the features names, and prints the results as a table followed
+// by the remediation hints of the unavailable features, or in JSON format
+// if formatJSON is true, to the passed writer. It returns an error when a
+// core feature is unavailable, or one of the features names.
+func Doctor(w io.Writer, conf *singularityconf.File, names []string, formatJSON bool) error {
+	selected := make(map[string]bool)
+	for _, name := range names {
+		found := false
+		for _, f := range doctorFeatures {
+			found = found || f.name == name
+		}
+		if !found {
+			return fmt.Errorf("unknown feature %q, available features: %s", name, strings.Join(DoctorFeatures(), ", "))
+		}
+		selected[name] = true
+	}
+
+	var results []DoctorResult
+	var failed []string
+	for _, f := range doctorFeatures {
+		if len(selected) > 0 && !selected[f.name] {
+			continue
+		}
+		ok, details, hint := f.probe(conf)
+		results = append(results, DoctorResult{
+			Feature:   f.name,
+			Available: ok,
+			Core:      f.core,
+			Details:   details,
+			Hint:      hint,
+		})
+		if !ok && (f.core || len(selected) > 0) {
+			failed = append(failed, f.name)
+		}
+	}
+
+	if formatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(results); err != nil {
+			return fmt.Errorf("could not encode results: %v", err)
+		}
+	} else if err := printDoctorResults(w, results); err != nil {
+		return err
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+	if len(selected) > 0 {
+		return fmt.Errorf("unavailable features: %s", strings.Join(failed, ", "))
+	}
+	return fmt.Errorf("containers can't run on this host, unavailable core features: %s", strings.Join(failed, ", "))
+}
+
+// printDoctorResults prints the results as a table, core features being
+// marked with a star, followed by the hints of the unavailable features.
+func printDoctorResults(w io.Writer, results []DoctorResult) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "FEATURE\tSTATUS\tDETAILS\n")
+	var hints []string
+	for _, r := range results {
+		name := r.Feature
+		if r.Core {
+			name += "*"
+		}
+		status := "available"
+		if !r.Available {
+			status = "unavailable"
+			if r.Hint != "" {
+				hints = append(hints, fmt.Sprintf("  %s: %s", r.Feature, r.Hint))
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", name, status, r.Details)
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("could not write results: %v", err)
+	}
+	fmt.Fprintf(w, "\n* core feature, containers can't run without it\n")
+	if len(hints) > 0 {
+		fmt.Fprintf(w, "\nHints:\n%s\n", strings.Join(hints, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity/pkg/image"
+	"github.com/sylabs/singularity/pkg/util/singularityconf"
+)
+
+func TestDoctorTrue(t *testing.T) {
+	machines := map[string]elf.Machine{
+		"amd64": elf.EM_X86_64,
+		"arm64": elf.EM_AARCH64,
+	}
+	for arch, machine := range machines {
+		f, err := elf.NewFile(bytes.NewReader(doctorTrue(arch)))
+		if err != nil {
+			t.Fatalf("%s: invalid executable: %s", arch, err)
+		}
+		if f.Machine != machine || f.Type != elf.ET_EXEC || len(f.Progs) != 1 || f.Progs[0].Type != elf.PT_LOAD {
+			t.Errorf("%s: unexpected executable %+v", arch, f.FileHeader)
+		}
+	}
+	if doctorTrue("mips") != nil {
+		t.Errorf("unexpected executable for an unsupported architecture")
+	}
+
+	payload := doctorTrue(runtime.GOARCH)
+	if payload == nil {
+		t.Skipf("no smoke test payload for %s", runtime.GOARCH)
+	}
+	dir, err := ioutil.TempDir("", "doctor-")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := makeSmokeRootfs(dir); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := exec.Command(filepath.Join(dir, "bin", "true")).Run(); err != nil {
+		t.Errorf("smoke test payload failed: %s", err)
+	}
+}
+
+func TestMakeSmokeImage(t *testing.T) {
+	if doctorTrue(runtime.GOARCH) == nil {
+		t.Skipf("no smoke test payload for %s", runtime.GOARCH)
+	}
+	dir, err := ioutil.TempDir("", "doctor-")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "smoke.sif")
+	if err := makeSmokeImage(path); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	img, err := image.Init(path, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer img.File.Close()
+	if img.Type != image.SIF {
+		t.Fatalf("unexpected image type %d", img.Type)
+	}
+	part, err := img.GetRootFsPartition()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if part.Type != image.SQUASHFS {
+		t.Fatalf("unexpected root filesystem partition type %d", part.Type)
+	}
+
+	// the kernel must be able to mount the squashfs partition and run
+	// the payload from it
+	if os.Geteuid() != 0 {
+		t.Skipf("mounting the smoke test image requires root")
+	}
+	mnt := filepath.Join(dir, "mnt")
+	if err := os.Mkdir(mnt, 0755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	opts := "loop,ro,offset=" + strconv.FormatUint(part.Offset, 10)
+	if out, err := exec.Command("mount", "-t", "squashfs", "-o", opts, path, mnt).CombinedOutput(); err != nil {
+		t.Skipf("could not mount the smoke test image: %s: %s", err, out)
+	}
+	defer exec.Command("umount", mnt).Run()
+
+	for _, d := range smokeRootfsDirs {
+		if fi, err := os.Stat(filepath.Join(mnt, d)); err != nil || !fi.IsDir() {
+			t.Errorf("missing directory %s in the smoke test image: %v", d, err)
+		}
+	}
+	if err := exec.Command(filepath.Join(mnt, "bin", "true")).Run(); err != nil {
+		t.Errorf("smoke test payload failed: %s", err)
+	}
+}
+
+func TestDoctor(t *testing.T) {
+	features := doctorFeatures
+	defer func() { doctorFeatures = features }()
+
+	probe := func(ok bool, details, hint string) doctorProbe {
+		return func(*singularityconf.File) (bool, string, string) {
+			return ok, details, hint
+		}
+	}
+	doctorFeatures = []struct {
+		name  string
+		core  bool
+		probe doctorProbe
+	}{
+		{"core", true, probe(true, "core details", "")},
+		{"good", false, probe(true, "good details", "")},
+		{"bad", false, probe(false, "bad details", "fix bad")},
+	}
+
+	// unavailable optional features don't fail
+	var out bytes.Buffer
+	if err := Doctor(&out, nil, nil, false); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	for _, want := range []string{"core*    available", "bad      unavailable  bad details", "Hints:\n  bad: fix bad\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output doesn't contain %q:\n%s", want, out.String())
+		}
+	}
+
+	// selected features fail when unavailable
+	out.Reset()
+	if err := Doctor(&out, nil, []string{"good"}, true); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	var results []DoctorResult
+	if err := json.Unmarshal(out.Bytes(), &results); err != nil {
+		t.Fatalf("could not decode %q: %s", out.String(), err)
+	}
+	if len(results) != 1 || results[0].Feature != "good" || !results[0].Available {
+		t.Errorf("unexpected results %+v", results)
+	}
+	if err := Doctor(ioutil.Discard, nil, []string{"good", "bad"}, false); err == nil || err.Error() != "unavailable features: bad" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := Doctor(ioutil.Discard, nil, []string{"missing"}, false); err == nil || !strings.Contains(err.Error(), `unknown feature "missing"`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// unavailable core features fail
+	doctorFeatures[0].probe = probe(false, "core details", "")
+	if err := Doctor(ioutil.Discard, nil, nil, false); err == nil || !strings.Contains(err.Error(), "unavailable core features: core") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// The smoke test image is a squashfs 4.0 filesystem written without
+// compression, so it can be generated without mksquashfs, which may not
+// be installed, and mounted by any kernel or squashfuse supporting
+// squashfs.
+const (
+	squashfsMagic         = 0x73717368
+	squashfsBlockLog      = 17
+	squashfsBlockSize     = 1 << squashfsBlockLog
+	squashfsMetadataSize  = 8192
+	squashfsCompGzip      = 1
+	squashfsInvalidBlock  = 0xffffffffffffffff
+	squashfsInvalidFrag   = 0xffffffff
+	squashfsUncompressed  = 0x8000
+	squashfsDataUncompOff = 1 << 24
+
+	// uncompressed inodes, data, fragments and ids, no fragments and
+	// no extended attributes
+	squashfsFlags = 0x0001 | 0x0002 | 0x0008 | 0x0010 | 0x0200 | 0x0800
+
+	squashfsDirType  = 1
+	squashfsFileType = 2
+
+	// sizes of the basic directory and file inodes, the file inode
+	// is followed by the size of each data block
+	squashfsDirInodeSize  = 32
+	squashfsFileInodeSize = 32
+)
+
+// squashfsSuperblock is the squashfs 4.0 superblock.
+type squashfsSuperblock struct {
+	Magic               uint32
+	InodeCount          uint32
+	ModTime             uint32
+	BlockSize           uint32
+	FragCount           uint32
+	Compression         uint16
+	BlockLog            uint16
+	Flags               uint16
+	IDCount             uint16
+	VersionMajor        uint16
+	VersionMinor        uint16
+	RootInode           uint64
+	BytesUsed           uint64
+	IDTableStart        uint64
+	XattrIDTableStart   uint64
+	InodeTableStart     uint64
+	DirectoryTableStart uint64
+	FragmentTableStart  uint64
+	LookupTableStart    uint64
+}
+
+// squashfsNode is a directory, when data is nil, or a regular file of
+// the smoke test image, all owned by root.
+type squashfsNode struct {
+	name     string
+	mode     uint16
+	data     []byte
+	children []*squashfsNode
+
+	inode     uint32
+	inodeOff  int
+	dirOff    int
+	dirSize   int
+	dataStart uint32
+}
+
+func (n *squashfsNode) isDir() bool {
+	return n.data == nil
+}
+
+// walk calls fn for n and its children, depth first, the children of a
+// directory being sorted by name as required by squashfs.
+func (n *squashfsNode) walk(fn func(*squashfsNode)) {
+	fn(n)
+	sort.Slice(n.children, func(i, j int) bool {
+		return n.children[i].name < n.children[j].name
+	})
+	for _, c := range n.children {
+		c.walk(fn)
+	}
+}
+
+// metadataBlock returns data stored as a single uncompressed squashfs
+// metadata block.
+func metadataBlock(data []byte) ([]byte, error) {
+	if len(data) > squashfsMetadataSize {
+		return nil, fmt.Errorf("metadata of %d bytes exceed a metadata block", len(data))
+	}
+	b := make([]byte, 2, 2+len(data))
+	binary.LittleEndian.PutUint16(b, uint16(len(data))|squashfsUncompressed)
+	return append(b, data...), nil
+}
+
+// makeSquashfs returns a squashfs image of the tree root. The inode and
+// directory tables must fit in a metadata block each, which is enough
+// for the few entries of the smoke test image.
+func makeSquashfs(root *squashfsNode) ([]byte, error) {
+	// inode numbers and positions in the inode table
+	var nodes []*squashfsNode
+	inodeOff := 0
+	root.walk(func(n *squashfsNode) {
+		nodes = append(nodes, n)
+		n.inode = uint32(len(nodes))
+		n.inodeOff = inodeOff
+		if n.isDir() {
+			inodeOff += squashfsDirInodeSize
+		} else {
+			inodeOff += squashfsFileInodeSize + 4*dataBlocks(len(n.data))
+		}
+	})
+
+	le := binary.LittleEndian
+	sb := squashfsSuperblock{
+		Magic:             squashfsMagic,
+		InodeCount:        uint32(len(nodes)),
+		BlockSize:         squashfsBlockSize,
+		Compression:       squashfsCompGzip,
+		BlockLog:          squashfsBlockLog,
+		Flags:             squashfsFlags,
+		IDCount:           1,
+		VersionMajor:      4,
+		RootInode:         uint64(root.inodeOff),
+		XattrIDTableStart: squashfsInvalidBlock,
+		// the fragment table isn't read without fragments
+		FragmentTableStart: squashfsInvalidBlock,
+		LookupTableStart:   squashfsInvalidBlock,
+	}
+
+	img := new(bytes.Buffer)
+	img.Write(make([]byte, binary.Size(sb)))
+
+	// file data, stored in uncompressed blocks
+	for _, n := range nodes {
+		if !n.isDir() {
+			n.dataStart = uint32(img.Len())
+			img.Write(n.data)
+		}
+	}
+
+	// directory table, a single header per directory as all inodes
+	// are in the first metadata block of the inode table
+	dirs := new(bytes.Buffer)
+	for _, n := range nodes {
+		if !n.isDir() {
+			continue
+		}
+		n.dirOff = dirs.Len()
+		if len(n.children) > 0 {
+			binary.Write(dirs, le, []uint32{uint32(len(n.children) - 1), 0, n.children[0].inode})
+			for _, c := range n.children {
+				typ := uint16(squashfsDirType)
+				if !c.isDir() {
+					typ = squashfsFileType
+				}
+				binary.Write(dirs, le, []uint16{
+					uint16(c.inodeOff),
+					uint16(c.inode - n.children[0].inode),
+					typ,
+					uint16(len(c.name) - 1),
+				})
+				dirs.WriteString(c.name)
+			}
+		}
+		// the listing size includes the . and .. entries
+		n.dirSize = dirs.Len() - n.dirOff + 3
+	}
+
+	// inode table
+	inodes := new(bytes.Buffer)
+	for _, n := range nodes {
+		typ, nlink := uint16(squashfsFileType), uint32(1)
+		if n.isDir() {
+			typ, nlink = squashfsDirType, 2
+			for _, c := range n.children {
+				if c.isDir() {
+					nlink++
+				}
+			}
+		}
+		binary.Write(inodes, le, []uint16{typ, n.mode, 0, 0})
+		binary.Write(inodes, le, []uint32{0, n.inode})
+		if n.isDir() {
+			parent := uint32(len(nodes) + 1)
+			for _, p := range nodes {
+				for _, c := range p.children {
+					if c == n {
+						parent = p.inode
+					}
+				}
+			}
+			binary.Write(inodes, le, []uint32{0, nlink})
+			binary.Write(inodes, le, []uint16{uint16(n.dirSize), uint16(n.dirOff)})
+			binary.Write(inodes, le, parent)
+			continue
+		}
+		binary.Write(inodes, le, []uint32{n.dataStart, squashfsInvalidFrag, 0, uint32(len(n.data))})
+		for size := len(n.data); size > 0; size -= squashfsBlockSize {
+			block := size
+			if block > squashfsBlockSize {
+				block = squashfsBlockSize
+			}
+			binary.Write(inodes, le, uint32(block)|squashfsDataUncompOff)
+		}
+	}
+
+	inodeBlock, err := metadataBlock(inodes.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("inode table: %s", err)
+	}
+	dirBlock, err := metadataBlock(dirs.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("directory table: %s", err)
+	}
+	// root is the only ID, referenced by the index following it
+	idBlock, _ := metadataBlock([]byte{0, 0, 0, 0})
+
+	sb.InodeTableStart = uint64(img.Len())
+	img.Write(inodeBlock)
+	sb.DirectoryTableStart = uint64(img.Len())
+	img.Write(dirBlock)
+	idStart := uint64(img.Len())
+	img.Write(idBlock)
+	sb.IDTableStart = uint64(img.Len())
+	binary.Write(img, le, idStart)
+	sb.BytesUsed = uint64(img.Len())
+
+	// devices are read by blocks of 4KiB
+	if pad := img.Len() % 4096; pad != 0 {
+		img.Write(make([]byte, 4096-pad))
+	}
+
+	b := img.Bytes()
+	hdr := new(bytes.Buffer)
+	binary.Write(hdr, le, sb)
+	copy(b, hdr.Bytes())
+	return b, nil
+}
+
+// dataBlocks returns the number of data blocks of a file of size bytes.
+func dataBlocks(size int) int {
+	return (size + squashfsBlockSize - 1) / squashfsBlockSize
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/sylabs/singularity/internal/pkg/instance"
+)
+
+// procDir is the directory where the proc file system is mounted.
+var procDir = "/proc"
+
+// nsenterOptions lists the namespace types found in /proc/<pid>/ns with
+// the nsenter option joining them, in the order they are joined by nsenter.
+var nsenterOptions = []struct {
+	nstype string
+	option string
+}{
+	{"user", "--user"},
+	{"cgroup", "--cgroup"},
+	{"ipc", "--ipc"},
+	{"uts", "--uts"},
+	{"net", "--net"},
+	{"pid", "--pid"},
+	{"mnt", "--mount"},
+	{"time", "--time"},
+}
+
+type instanceNamespace struct {
+	Type   string `json:"type"`
+	Path   string `json:"path"`
+	Inode  string `json:"inode,omitempty"`
+	Option string `json:"nsenterOption"`
+}
+
+type instanceDetails struct {
+	Instance   string              `json:"instance"`
+	Pid        int                 `json:"pid"`
+	PPid       int                 `json:"ppid"`
+	User       string              `json:"user"`
+	Image      string              `json:"img"`
+	IP         string              `json:"ip"`
+	IPv6       string              `json:"ipv6,omitempty"`
+	UserNs     bool                `json:"userns"`
+	LogErrPath string              `json:"logErrPath"`
+	LogOutPath string              `json:"logOutPath"`
+	Namespaces []instanceNamespace `json:"namespaces"`
+}
+
+// processNamespaces returns the namespaces of the process pid which can be
+// joined with nsenter. The namespace inodes are reported when the caller
+// is allowed to read them.
+func processNamespaces(pid int) []instanceNamespace {
+	var namespaces []instanceNamespace
+
+	dir := filepath.Join(procDir, strconv.Itoa(pid), "ns")
+	for _, n := range nsenterOptions {
+		path := filepath.Join(dir, n.nstype)
+		if _, err := os.Lstat(path); err != nil {
+			continue
+		}
+		inode, _ := os.Readlink(path)
+		namespaces = append(namespaces, instanceNamespace{
+			Type:   n.nstype,
+			Path:   path,
+			Inode:  inode,
+			Option: fmt.Sprintf("%s=%s", n.option, path),
+		})
+	}
+	return namespaces
+}
+
+// PrintInstanceInfo prints the details of the instance name, including the
+// paths of its namespaces, in a regular or a JSON format (if formatJSON is
+// true) to the passed writer. If nsPaths is true, only the nsenter options
+// joining the instance namespaces are printed, one per line.
+func PrintInstanceInfo(w io.Writer, name, user string, formatJSON, nsPaths bool) error {
+	if formatJSON && nsPaths {
+		return fmt.Errorf("--json and --ns-paths are mutually exclusive")
+	}
+
+	ii, err := instance.List(user, name, instance.SingSubDir)
+	if err != nil {
+		return fmt.Errorf("could not retrieve instance list: %v", err)
+	}
+	if len(ii) == 0 {
+		return fmt.Errorf("no instance found with name %s", name)
+	} else if len(ii) > 1 {
+		return fmt.Errorf("%d instances found with name %s, an instance name is expected", len(ii), name)
+	}
+
+	i := ii[0]
+	details := instanceDetails{
+		Instance:   i.Name,
+		Pid:        i.Pid,
+		PPid:       i.PPid,
+		User:       i.User,
+		Image:      i.Image,
+		IP:         i.IP,
+		IPv6:       i.IPv6,
+		UserNs:     i.UserNs,
+		LogErrPath: i.LogErrPath,
+		LogOutPath: i.LogOutPath,
+		Namespaces: processNamespaces(i.Pid),
+	}
+
+	if nsPaths {
+		for _, ns := range details.Namespaces {
+			if _, err := fmt.Fprintln(w, ns.Option); err != nil {
+				return fmt.Errorf("could not write namespace paths: %v", err)
+			}
+		}
+		return nil
+	}
+
+	if formatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(details); err != nil {
+			return fmt.Errorf("could not encode instance info: %v", err)
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 4, ' ', 0)
+	fmt.Fprintf(tw, "Instance:\t%s\n", details.Instance)
+	fmt.Fprintf(tw, "PID:\t%d\n", details.Pid)
+	fmt.Fprintf(tw, "User:\t%s\n", details.User)
+	fmt.Fprintf(tw, "Image:\t%s\n", details.Image)
+	if details.IP != "" {
+		fmt.Fprintf(tw, "IP:\t%s\n", details.IP)
+	}
+	if details.IPv6 != "" {
+		fmt.Fprintf(tw, "IPv6:\t%s\n", details.IPv6)
+	}
+	fmt.Fprintf(tw, "Logs:\t%s\n\t%s\n", details.LogErrPath, details.LogOutPath)
+	fmt.Fprintf(tw, "Namespaces:\t\n")
+	for _, ns := range details.Namespaces {
+		fmt.Fprintf(tw, "  %s\t%s\n", ns.Type, ns.Path)
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("could not write instance info: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestProcessNamespaces(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proc-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(d string) {
+		procDir = d
+	}(procDir)
+	procDir = dir
+
+	nsDir := filepath.Join(dir, "42", "ns")
+	if err := os.MkdirAll(nsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// pid_for_children has no nsenter option and is ignored
+	for _, ns := range []string{"mnt", "pid", "pid_for_children", "user"} {
+		if err := os.Symlink(ns+":[4026531840]", filepath.Join(nsDir, ns)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []instanceNamespace{
+		{"user", filepath.Join(nsDir, "user"), "user:[4026531840]", "--user=" + filepath.Join(nsDir, "user")},
+		{"pid", filepath.Join(nsDir, "pid"), "pid:[4026531840]", "--pid=" + filepath.Join(nsDir, "pid")},
+		{"mnt", filepath.Join(nsDir, "mnt"), "mnt:[4026531840]", "--mount=" + filepath.Join(nsDir, "mnt")},
+	}
+	if got := processNamespaces(42); !reflect.DeepEqual(got, want) {
+		t.Errorf("got namespaces %+v, want %+v", got, want)
+	}
+
+	if got := processNamespaces(43); len(got) != 0 {
+		t.Errorf("got namespaces %+v for a missing process", got)
+	}
+}
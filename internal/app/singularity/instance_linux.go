@@ -9,7 +9,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"os"
 	"syscall"
 	"text/tabwriter"
 	"time"
@@ -24,6 +23,7 @@ type instanceInfo struct {
 	Pid        int    `json:"pid"`
 	Image      string `json:"img"`
 	IP         string `json:"ip"`
+	IPv6       string `json:"ipv6,omitempty"`
 	LogErrPath string `json:"logErrPath"`
 	LogOutPath string `json:"logOutPath"`
 }
@@ -71,6 +71,13 @@ func PrintInstanceList(w io.Writer, name, user string, formatJSON bool, showLogs
 			if err != nil {
 				return fmt.Errorf("could not write instance info: %v", err)
 			}
+			// the IPv6 address of a dual-stack instance is
+			// displayed below its IPv4 address
+			if i.IPv6 != "" {
+				if _, err := fmt.Fprintf(tabWriter, "\t\t%s\t\n", i.IPv6); err != nil {
+					return fmt.Errorf("could not write instance info: %v", err)
+				}
+			}
 		}
 		return nil
 	}
@@ -81,6 +88,7 @@ func PrintInstanceList(w io.Writer, name, user string, formatJSON bool, showLogs
 		instances[i].Pid = ii[i].Pid
 		instances[i].Instance = ii[i].Name
 		instances[i].IP = ii[i].IP
+		instances[i].IPv6 = ii[i].IPv6
 		instances[i].LogErrPath = ii[i].LogErrPath
 		instances[i].LogOutPath = ii[i].LogOutPath
 	}
@@ -97,32 +105,6 @@ func PrintInstanceList(w io.Writer, name, user string, formatJSON bool, showLogs
 	return nil
 }
 
-// WriteInstancePidFile fetches instance's PID and writes it to the pidFile,
-// truncating it if it already exists. Note that the name should not be a glob,
-// i.e. name should identify a single instance only, otherwise an error is returned.
-func WriteInstancePidFile(name, pidFile string) error {
-	inst, err := instance.List("", name, instance.SingSubDir)
-	if err != nil {
-		return fmt.Errorf("could not retrieve instance list: %v", err)
-
-	}
-	if len(inst) != 1 {
-		return fmt.Errorf("unexpected instance count: %d", len(inst))
-	}
-
-	f, err := os.OpenFile(pidFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|syscall.O_NOFOLLOW, 0644)
-	if err != nil {
-		return fmt.Errorf("could not create pid file: %v", err)
-	}
-	defer f.Close()
-
-	_, err = fmt.Fprintf(f, "%d\n", inst[0].Pid)
-	if err != nil {
-		return fmt.Errorf("could not write pid file: %v", err)
-	}
-	return nil
-}
-
 // StopInstance fetches instance list, applying name and
 // user filters, and stops them by sending a signal sig. If an instance
 // is still running after a grace period defined by timeout is expired,
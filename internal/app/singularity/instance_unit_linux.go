@@ -0,0 +1,206 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/instance"
+	"github.com/sylabs/singularity/pkg/syfs"
+)
+
+const (
+	// UnitScopeUser is the scope of a unit run by the systemd user manager.
+	UnitScopeUser = "user"
+	// UnitScopeSystem is the scope of a unit run by the systemd system
+	// manager.
+	UnitScopeSystem = "system"
+)
+
+// unitRestartPolicies lists the values of the systemd Restart setting.
+var unitRestartPolicies = []string{
+	"no",
+	"on-success",
+	"on-failure",
+	"on-abnormal",
+	"on-watchdog",
+	"on-abort",
+	"always",
+}
+
+// InstanceUnit describes the systemd service unit managing an instance.
+type InstanceUnit struct {
+	// Name is the instance name.
+	Name string
+	// Scope is UnitScopeUser or UnitScopeSystem.
+	Scope string
+	// Restart is the systemd restart policy of the instance.
+	Restart string
+	// RestartSec is the delay in seconds before restarting the instance.
+	RestartSec int
+	// Options are the options the instance is started with.
+	Options *instance.StartOptions
+}
+
+// DefaultUnitScope returns the unit scope used by default, the system scope
+// for root and the user scope otherwise.
+func DefaultUnitScope() string {
+	if os.Getuid() == 0 {
+		return UnitScopeSystem
+	}
+	return UnitScopeUser
+}
+
+// instanceOptionsDir returns the directory of the options files read by
+// the units with scope.
+var instanceOptionsDir = func(scope string) string {
+	if scope == UnitScopeSystem {
+		return filepath.Join(buildcfg.SINGULARITY_CONFDIR, syfs.InstanceOpts)
+	}
+	return syfs.InstanceOptionsDir()
+}
+
+// InstanceOptionsFile returns the path of the options file read by the unit
+// of the instance name for scope.
+func InstanceOptionsFile(name, scope string) string {
+	return filepath.Join(instanceOptionsDir(scope), name+".json")
+}
+
+// InstanceUnitName returns the name of the unit file of the instance name.
+func InstanceUnitName(name string) string {
+	return "singularity-instance-" + name + ".service"
+}
+
+// unitTemplate is the template of an instance unit, the instance start
+// options are read from the options file so the unit doesn't need to be
+// updated when they change.
+const unitTemplate = `# {{.UnitName}} generated by singularity instance generate-unit,
+# the instance options are read from {{.OptionsFile}}
+[Unit]
+Description=Singularity instance {{.Name}}
+{{- if .Network}}
+Wants=network-online.target
+After=network-online.target network.target
+{{- end}}
+
+[Service]
+Type=forking
+{{- if .PidFile}}
+PIDFile={{.PidFile}}
+{{- end}}
+ExecStart={{.Singularity}} instance start --options-file {{.OptionsFileArg}} {{.Name}}
+ExecStop={{.Singularity}} instance stop {{.Name}}
+Restart={{.Restart}}
+RestartSec={{.RestartSec}}
+
+[Install]
+WantedBy={{.WantedBy}}
+`
+
+// unitQuote returns s quoted for a systemd command line when required,
+// percent signs are escaped so they're not expanded as specifiers.
+func unitQuote(s string) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	if !strings.ContainsAny(s, " \t\"'\\;") {
+		return s
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// unitNetwork returns if the instance options configure a CNI network,
+// the unit is then ordered after the host network is up.
+func unitNetwork(o *instance.StartOptions) bool {
+	net := o.Flag("net")
+	if len(net) == 0 || net[len(net)-1] != "true" {
+		return false
+	}
+	for _, n := range o.Flag("network") {
+		for _, t := range strings.Split(n, ",") {
+			if strings.TrimSpace(t) != "none" {
+				return true
+			}
+		}
+	}
+	// bridge is the default network
+	return len(o.Flag("network")) == 0
+}
+
+// WriteInstanceUnit saves the start options of the instance unit u to its
+// options file and writes the unit to w.
+func WriteInstanceUnit(w io.Writer, u InstanceUnit) error {
+	if err := instance.CheckName(u.Name); err != nil {
+		return err
+	}
+	if u.Options == nil {
+		return fmt.Errorf("no start options for instance %s", u.Name)
+	}
+
+	var wantedBy string
+	switch u.Scope {
+	case UnitScopeUser:
+		wantedBy = "default.target"
+	case UnitScopeSystem:
+		if os.Getuid() != 0 {
+			return fmt.Errorf("a unit with the %s scope can only be generated by root", UnitScopeSystem)
+		}
+		wantedBy = "multi-user.target"
+	default:
+		return fmt.Errorf("unknown unit scope %q, use %s or %s", u.Scope, UnitScopeUser, UnitScopeSystem)
+	}
+
+	validRestart := false
+	for _, p := range unitRestartPolicies {
+		if u.Restart == p {
+			validRestart = true
+			break
+		}
+	}
+	if !validRestart {
+		return fmt.Errorf("unknown restart policy %q, use one of %s", u.Restart, strings.Join(unitRestartPolicies, ", "))
+	}
+	if u.RestartSec < 0 {
+		return fmt.Errorf("the restart delay can't be negative")
+	}
+
+	optionsFile := InstanceOptionsFile(u.Name, u.Scope)
+	if err := u.Options.Save(optionsFile); err != nil {
+		return err
+	}
+
+	var pidFile string
+	if p := u.Options.Flag("pid-file"); len(p) > 0 && filepath.IsAbs(p[len(p)-1]) {
+		pidFile = p[len(p)-1]
+	}
+
+	t := template.Must(template.New("unit").Parse(unitTemplate))
+	return t.Execute(w, struct {
+		InstanceUnit
+		UnitName       string
+		OptionsFile    string
+		OptionsFileArg string
+		Singularity    string
+		Network        bool
+		PidFile        string
+		WantedBy       string
+	}{
+		InstanceUnit:   u,
+		UnitName:       InstanceUnitName(u.Name),
+		OptionsFile:    optionsFile,
+		OptionsFileArg: unitQuote(optionsFile),
+		Singularity:    unitQuote(filepath.Join(buildcfg.BINDIR, "singularity")),
+		Network:        unitNetwork(u.Options),
+		PidFile:        pidFile,
+		WantedBy:       wantedBy,
+	})
+}
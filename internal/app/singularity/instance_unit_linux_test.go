@@ -0,0 +1,186 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/instance"
+)
+
+func TestWriteInstanceUnit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "instance-unit-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(f func(string) string) {
+		instanceOptionsDir = f
+	}(instanceOptionsDir)
+	instanceOptionsDir = func(scope string) string {
+		return filepath.Join(dir, scope)
+	}
+
+	singularity := filepath.Join(buildcfg.BINDIR, "singularity")
+
+	tests := []struct {
+		name      string
+		unit      InstanceUnit
+		expectErr bool
+		want      []string
+		notWant   []string
+	}{
+		{
+			name: "User",
+			unit: InstanceUnit{
+				Name:       "web",
+				Scope:      UnitScopeUser,
+				Restart:    "on-failure",
+				RestartSec: 5,
+				Options:    &instance.StartOptions{Image: "/images/nginx.sif"},
+			},
+			want: []string{
+				"Description=Singularity instance web\n",
+				"Type=forking\n",
+				"ExecStart=" + singularity + " instance start --options-file " + filepath.Join(dir, "user", "web.json") + " web\n",
+				"ExecStop=" + singularity + " instance stop web\n",
+				"Restart=on-failure\n",
+				"RestartSec=5\n",
+				"WantedBy=default.target\n",
+			},
+			notWant: []string{"network", "PIDFile"},
+		},
+		{
+			name: "Network",
+			unit: InstanceUnit{
+				Name:    "web",
+				Scope:   UnitScopeUser,
+				Restart: "always",
+				Options: &instance.StartOptions{
+					Image: "/images/nginx.sif",
+					Flags: []string{"net=true", "network=bridge", "pid-file=/run/web.pid"},
+				},
+			},
+			want: []string{
+				"Wants=network-online.target\n",
+				"After=network-online.target network.target\n",
+				"PIDFile=/run/web.pid\n",
+				"Restart=always\n",
+			},
+		},
+		{
+			name: "NetworkNone",
+			unit: InstanceUnit{
+				Name:    "web",
+				Scope:   UnitScopeUser,
+				Restart: "no",
+				Options: &instance.StartOptions{
+					Image: "/images/nginx.sif",
+					Flags: []string{"net=true", "network=none"},
+				},
+			},
+			notWant: []string{"network-online.target"},
+		},
+		{
+			name: "BadScope",
+			unit: InstanceUnit{
+				Name:    "web",
+				Scope:   "session",
+				Restart: "no",
+				Options: &instance.StartOptions{Image: "/images/nginx.sif"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "BadRestart",
+			unit: InstanceUnit{
+				Name:    "web",
+				Scope:   UnitScopeUser,
+				Restart: "sometimes",
+				Options: &instance.StartOptions{Image: "/images/nginx.sif"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "BadName",
+			unit: InstanceUnit{
+				Name:    "../web",
+				Scope:   UnitScopeUser,
+				Restart: "no",
+				Options: &instance.StartOptions{Image: "/images/nginx.sif"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "System",
+			unit: InstanceUnit{
+				Name:    "db",
+				Scope:   UnitScopeSystem,
+				Restart: "on-failure",
+				Options: &instance.StartOptions{Image: "/images/mysql.sif"},
+			},
+			expectErr: os.Getuid() != 0,
+			want:      []string{"WantedBy=multi-user.target\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := WriteInstanceUnit(&buf, tt.unit)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatalf("unexpected success")
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			unit := buf.String()
+			for _, w := range tt.want {
+				if !strings.Contains(unit, w) {
+					t.Errorf("%q not found in unit:\n%s", w, unit)
+				}
+			}
+			for _, w := range tt.notWant {
+				if strings.Contains(unit, w) {
+					t.Errorf("unexpected %q in unit:\n%s", w, unit)
+				}
+			}
+
+			o, err := instance.LoadStartOptions(InstanceOptionsFile(tt.unit.Name, tt.unit.Scope))
+			if err != nil {
+				t.Fatalf("could not read options file: %s", err)
+			}
+			if o.Image != tt.unit.Options.Image {
+				t.Errorf("got image %s in options file, want %s", o.Image, tt.unit.Options.Image)
+			}
+		})
+	}
+}
+
+func TestUnitQuote(t *testing.T) {
+	tests := map[string]string{
+		"/usr/bin/singularity": "/usr/bin/singularity",
+		"/home/a b/web.json":   `"/home/a b/web.json"`,
+		`/home/"q"/web.json`:   `"/home/\"q\"/web.json"`,
+		"/home/100%/web.json":  "/home/100%%/web.json",
+		`/home/a\b c/web.json`: `"/home/a\\b c/web.json"`,
+	}
+	for s, want := range tests {
+		if got := unitQuote(s); got != want {
+			t.Errorf("unitQuote(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sylabs/singularity/internal/pkg/remote"
+	"github.com/sylabs/singularity/internal/pkg/remote/endpoint"
+)
+
+const keyserverListLine = "%d\t%s\t%s\t%s\t%s\n"
+
+// KeyserverList prints the keyservers of the remote endpoint name, or of
+// the active remote endpoint if name is empty, in the order they are
+// queried.
+func KeyserverList(usrConfigFile, name string) error {
+	// opening config file
+	file, err := os.OpenFile(usrConfigFile, os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("while opening remote config file: %s", err)
+	}
+	defer file.Close()
+
+	// read file contents to config struct
+	c, err := remote.ReadFrom(file)
+	if err != nil {
+		return fmt.Errorf("while parsing remote config data: %s", err)
+	}
+
+	if err := syncSysConfig(c); err != nil {
+		return err
+	}
+
+	var ep *endpoint.Config
+
+	if name == "" {
+		ep, err = c.GetDefault()
+	} else {
+		ep, err = c.GetRemote(name)
+	}
+	if err != nil {
+		return fmt.Errorf("no endpoint found: %s", err)
+	}
+
+	keyservers, err := ep.ActiveKeyservers()
+	if err != nil {
+		return fmt.Errorf("while retrieving keyservers: %s", err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", "ORDER", "URI", "AUTH", "CAPABILITIES", "INSECURE")
+	for i, kc := range keyservers {
+		auth := "NO"
+		if kc.Authenticated() {
+			auth = "YES"
+		}
+		insecure := "NO"
+		if kc.Insecure {
+			insecure = "YES"
+		}
+		fmt.Fprintf(tw, keyserverListLine, i+1, kc.URI, auth, strings.Join(kc.Capabilities(), ","), insecure)
+	}
+	return tw.Flush()
+}
@@ -37,6 +37,12 @@ type LibraryPushSpec struct {
 	Description string
 	// AllowUnsigned must be set to true to allow push of an unsigned container image to succeed
 	AllowUnsigned bool
+	// PartSize is the size of the parts of a multipart upload, images larger than
+	// PartSize are uploaded in parts when the library supports it
+	PartSize int64
+	// StateDir is the directory holding the state of multipart uploads, an
+	// interrupted upload is resumed from there on the next push
+	StateDir string
 }
 
 type progressCallback struct {
@@ -46,7 +52,7 @@ type progressCallback struct {
 
 func (c *progressCallback) InitUpload(totalSize int64, r io.Reader) {
 	// create bar
-	p := mpb.New()
+	p := mpb.New(mpb.WithOutput(sylog.Writer()))
 	c.bar = p.AddBar(totalSize,
 		mpb.PrependDecorators(
 			decor.Counters(decor.UnitKiB, "%.1f / %.1f"),
@@ -107,7 +113,61 @@ func LibraryPush(ctx context.Context, pushSpec LibraryPushSpec, libraryConfig *c
 	}
 	defer f.Close()
 
-	return libraryClient.UploadImage(ctx, f, r.Host+r.Path, arch, r.Tags, pushSpec.Description, &progressCallback{})
+	// the image file is read once to compute its digests
+	d, err := digestImage(f, pushSpec.PartSize)
+	if err != nil {
+		return fmt.Errorf("error calculating checksum: %v", err)
+	}
+
+	ref := r.Host + r.Path
+	u := newMultipartUploader(libraryClient, f, d, pushSpec.StateDir)
+
+	image, err := u.ensureImage(ctx, ref, arch, pushSpec.Description)
+	if err != nil {
+		return err
+	}
+
+	if image.Uploaded {
+		sylog.Infof("Image is already present in the library, not uploading")
+	} else {
+		uploaded, err := libraryChunkedPush(ctx, u, image.ID)
+		if err != nil {
+			return err
+		}
+		if !uploaded {
+			uploaded, err = libraryMultipartPush(ctx, u, image.ID)
+			if err != nil {
+				return err
+			}
+		}
+		if !uploaded {
+			// small image or library without chunked and multipart
+			// uploads, the library client uploads it and sets its tags
+			return libraryClient.UploadImage(ctx, f, ref, arch, r.Tags, pushSpec.Description, &progressCallback{})
+		}
+		if err := u.verify(ctx, ref, arch); err != nil {
+			return err
+		}
+	}
+
+	return u.setTags(ctx, image.Container, image.ID, arch, r.Tags)
+}
+
+// libraryMultipartPush uploads the image file in parts to the library image
+// imageID when it's larger than the part size. It returns false for smaller
+// files or when the library doesn't support multipart uploads.
+func libraryMultipartPush(ctx context.Context, u *multipartUploader, imageID string) (bool, error) {
+	if u.size <= u.partSize {
+		return false, nil
+	}
+
+	if err := u.upload(ctx, imageID); err == errMultipartUnsupported {
+		sylog.Debugf("Library doesn't support multipart uploads, falling back to single upload")
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 func sifArch(filename string) (string, error) {
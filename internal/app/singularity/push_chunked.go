@@ -0,0 +1,92 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sylabs/singularity/internal/pkg/client/chunk"
+	"github.com/sylabs/singularity/pkg/sylog"
+	"github.com/vbauerster/mpb/v4"
+	"github.com/vbauerster/mpb/v4/decor"
+)
+
+// libraryChunkedPush uploads the content-defined chunks of the image file
+// the library doesn't store yet to the library image imageID, the library
+// then reassembles the image file from its chunks. It returns false when
+// the library doesn't support chunked uploads.
+func libraryChunkedPush(ctx context.Context, u *multipartUploader, imageID string) (bool, error) {
+	cc := chunk.NewClient(u.c)
+	m := &chunk.Manifest{Size: u.size, Hash: "sha256." + u.sha256, Chunks: u.digest.chunks}
+
+	missing, err := cc.Missing(ctx, imageID, m)
+	if err == chunk.ErrUnsupported {
+		sylog.Debugf("Library doesn't support chunked uploads, falling back to image file upload")
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("while sending image chunks: %v", err)
+	}
+
+	if err := uploadChunks(ctx, cc, u.f, m.Chunks, missing); err != nil {
+		return false, err
+	}
+
+	if err := cc.Complete(ctx, imageID, m); err != nil {
+		return false, fmt.Errorf("while completing chunked upload: %v", err)
+	}
+	return true, nil
+}
+
+// uploadChunks uploads once each chunk of the image file f listed in missing.
+func uploadChunks(ctx context.Context, cc *chunk.Client, f *os.File, chunks []chunk.Chunk, missing []string) error {
+	upload := make(map[string]bool)
+	for _, d := range missing {
+		upload[d] = true
+	}
+
+	var todo []chunk.Chunk
+	var todoSize, total int64
+	for _, ch := range chunks {
+		total += ch.Size
+		if upload[ch.Digest] {
+			upload[ch.Digest] = false
+			todo = append(todo, ch)
+			todoSize += ch.Size
+		}
+	}
+	sylog.Infof("Uploading %d of %d chunks (%d of %d bytes), the library stores the others", len(todo), len(chunks), todoSize, total)
+
+	p := mpb.New(mpb.WithOutput(sylog.Writer()))
+	bar := p.AddBar(todoSize,
+		mpb.PrependDecorators(
+			decor.Counters(decor.UnitKiB, "%.1f / %.1f"),
+		),
+		mpb.AppendDecorators(
+			decor.Percentage(),
+			decor.AverageSpeed(decor.UnitKiB, " % .1f "),
+			decor.AverageETA(decor.ET_STYLE_GO),
+		),
+	)
+	defer func() {
+		if !bar.Completed() {
+			bar.Abort(false)
+		}
+		p.Wait()
+	}()
+
+	for _, ch := range todo {
+		body := bar.ProxyReader(io.NewSectionReader(f, ch.Offset, ch.Size))
+		err := cc.Upload(ctx, ch, body)
+		body.Close()
+		if err != nil {
+			return fmt.Errorf("while uploading chunk %s: %v", ch.Digest, err)
+		}
+	}
+	return nil
+}
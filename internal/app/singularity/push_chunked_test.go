@@ -0,0 +1,180 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/client/chunk"
+)
+
+// mockChunkLibrary emulates a library supporting chunked uploads, the
+// other requests are served by the multipart mock library.
+type mockChunkLibrary struct {
+	mockLibrary
+
+	chunks    map[string][]byte
+	uploaded  []string
+	assembled []byte
+}
+
+func (m *mockChunkLibrary) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.Lock()
+
+	switch {
+	case r.URL.Path == "/v2/imagefile/image/_chunks" && r.Method == http.MethodPost:
+		defer m.Unlock()
+		var manifest chunk.Manifest
+		if err := json.NewDecoder(r.Body).Decode(&manifest); err != nil {
+			m.t.Errorf("while decoding manifest: %s", err)
+		}
+		res := chunk.MissingResponse{Missing: []string{}}
+		for _, ch := range manifest.Chunks {
+			if _, ok := m.chunks[ch.Digest]; !ok {
+				res.Missing = append(res.Missing, ch.Digest)
+			}
+		}
+		m.reply(w, res)
+	case strings.HasPrefix(r.URL.Path, "/v2/chunks/") && r.Method == http.MethodPut:
+		defer m.Unlock()
+		digest := strings.TrimPrefix(r.URL.Path, "/v2/chunks/")
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			m.t.Errorf("while reading chunk: %s", err)
+		}
+		if chunk.Digest(b) != digest {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		m.chunks[digest] = b
+		m.uploaded = append(m.uploaded, digest)
+	case r.URL.Path == "/v2/imagefile/image/_chunks_complete":
+		defer m.Unlock()
+		var manifest chunk.Manifest
+		if err := json.NewDecoder(r.Body).Decode(&manifest); err != nil {
+			m.t.Errorf("while decoding manifest: %s", err)
+		}
+		var data []byte
+		for _, ch := range manifest.Chunks {
+			data = append(data, m.chunks[ch.Digest]...)
+		}
+		m.assembled = data
+		m.mockLibrary.image.Hash = chunk.Digest(data)
+		m.mockLibrary.image.Size = int64(len(data))
+		m.mockLibrary.image.Uploaded = true
+		m.reply(w, nil)
+	default:
+		m.Unlock()
+		m.mockLibrary.ServeHTTP(w, r)
+	}
+}
+
+func TestLibraryChunkedPush(t *testing.T) {
+	defer func(p chunk.Params) {
+		chunk.DefaultParams = p
+	}(chunk.DefaultParams)
+	chunk.DefaultParams = chunk.Params{Min: 2048, Avg: 8192, Max: 32768}
+
+	dir, err := ioutil.TempDir("", "chunked-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	v1 := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(1)).Read(v1)
+	// v2 modifies a few bytes in the middle of v1
+	v2 := append([]byte{}, v1...)
+	copy(v2[600000:], "modified")
+
+	m := &mockChunkLibrary{
+		mockLibrary: mockLibrary{t: t},
+		chunks:      make(map[string][]byte),
+	}
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+	m.url = srv.URL
+
+	push := func(data []byte) (bool, error) {
+		image := filepath.Join(dir, "image.sif")
+		if err := ioutil.WriteFile(image, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		// each version is a new library image sharing the chunk store
+		m.mockLibrary.image = nil
+		m.uploaded = nil
+		u, img := testUploader(t, srv.URL, f, 0, "")
+		uploaded, err := libraryChunkedPush(context.Background(), u, img.ID)
+		if err != nil || !uploaded {
+			return uploaded, err
+		}
+		return true, u.verify(context.Background(), "entity/collection/container", "amd64")
+	}
+
+	uploaded, err := push(v1)
+	if err != nil {
+		t.Fatalf("unexpected error pushing v1: %s", err)
+	} else if !uploaded {
+		t.Fatalf("v1 not uploaded in chunks")
+	}
+	if !bytes.Equal(m.assembled, v1) {
+		t.Errorf("reassembled v1 doesn't match image")
+	}
+	v1Chunks := len(m.uploaded)
+
+	uploaded, err = push(v2)
+	if err != nil {
+		t.Fatalf("unexpected error pushing v2: %s", err)
+	} else if !uploaded {
+		t.Fatalf("v2 not uploaded in chunks")
+	}
+	if !bytes.Equal(m.assembled, v2) {
+		t.Errorf("reassembled v2 doesn't match image")
+	}
+	if len(m.uploaded) != 1 {
+		t.Errorf("%d chunks uploaded for v2 out of %d chunks for v1, want only the modified chunk", len(m.uploaded), v1Chunks)
+	}
+	for _, d := range m.uploaded {
+		if bytes.Contains(m.chunks[d], []byte("modified")) {
+			continue
+		}
+		t.Errorf("unmodified chunk %s uploaded again", d)
+	}
+
+	// a library without chunked uploads falls back to the image file upload
+	ms := &mockLibrary{t: t}
+	srv2 := httptest.NewServer(ms)
+	defer srv2.Close()
+
+	f, err := os.Open(filepath.Join(dir, "image.sif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	u, img := testUploader(t, srv2.URL, f, 0, "")
+	if uploaded, err := libraryChunkedPush(context.Background(), u, img.ID); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if uploaded {
+		t.Errorf("image reported as uploaded in chunks by a library without chunked uploads")
+	}
+}
@@ -0,0 +1,597 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	jsonresp "github.com/sylabs/json-resp"
+	"github.com/sylabs/scs-library-client/client"
+	"github.com/sylabs/singularity/internal/pkg/client/chunk"
+	"github.com/sylabs/singularity/pkg/sylog"
+	"github.com/vbauerster/mpb/v4"
+	"github.com/vbauerster/mpb/v4/decor"
+)
+
+const (
+	// DefaultUploadPartSize is the default size of the parts of a multipart upload.
+	DefaultUploadPartSize int64 = 64 * 1024 * 1024
+	// MinUploadPartSize is the minimum size of the parts of a multipart upload
+	// accepted by the object store.
+	MinUploadPartSize int64 = 5 * 1024 * 1024
+
+	// uploadPartRetries is the number of attempts to upload a single part.
+	uploadPartRetries = 5
+)
+
+// uploadRetryDelay is the delay before the first retry of a part upload,
+// doubled after each failed attempt.
+var uploadRetryDelay = time.Second
+
+// errMultipartUnsupported is returned when the library doesn't advertise the
+// multipart upload API.
+var errMultipartUnsupported = errors.New("multipart upload not supported by library")
+
+// errUploadExpired is returned when the library doesn't know anymore about
+// a resumed multipart upload.
+var errUploadExpired = errors.New("multipart upload expired")
+
+// multipartStartRequest is sent to initiate a multipart upload, the part size
+// is a hint which may be overridden by the library.
+type multipartStartRequest struct {
+	Size     int64 `json:"filesize"`
+	PartSize int64 `json:"partSize,omitempty"`
+}
+
+// uploadState is the state of a multipart upload, persisted after each part
+// so an interrupted push continues where it left off.
+type uploadState struct {
+	ImageID        string                 `json:"imageID"`
+	UploadID       string                 `json:"uploadID"`
+	Size           int64                  `json:"size"`
+	PartSize       int64                  `json:"partSize"`
+	TotalParts     int                    `json:"totalParts"`
+	S3Compliant    bool                   `json:"s3Compliant"`
+	CompletedParts []client.CompletedPart `json:"completedParts"`
+}
+
+// imageDigest holds the digests of an image file, computed in a single pass
+// over the file: its SHA256 digest, the SHA256 digests of its parts for a
+// multipart upload and its content-defined chunks for a chunked upload.
+type imageDigest struct {
+	size     int64
+	sha256   string
+	partSize int64
+	parts    []string
+	chunks   []chunk.Chunk
+}
+
+// partHasher computes the SHA256 digests of the consecutive parts of
+// partSize bytes of the data written to it.
+type partHasher struct {
+	partSize int64
+	n        int64
+	h        hash.Hash
+	parts    []string
+}
+
+func (p *partHasher) Write(b []byte) (int, error) {
+	written := len(b)
+	for len(b) > 0 {
+		l := int64(len(b))
+		if left := p.partSize - p.n; l > left {
+			l = left
+		}
+		p.h.Write(b[:l])
+		p.n += l
+		b = b[l:]
+		if p.n == p.partSize {
+			p.sum()
+		}
+	}
+	return written, nil
+}
+
+// sum ends the current part.
+func (p *partHasher) sum() {
+	p.parts = append(p.parts, hex.EncodeToString(p.h.Sum(nil)))
+	p.h.Reset()
+	p.n = 0
+}
+
+// countWriter counts the bytes written to it.
+type countWriter struct {
+	n int64
+}
+
+func (w *countWriter) Write(b []byte) (int, error) {
+	w.n += int64(len(b))
+	return len(b), nil
+}
+
+// digestImage returns the digests of the image file f for parts of partSize
+// bytes, reading it once.
+func digestImage(f *os.File, partSize int64) (*imageDigest, error) {
+	if partSize <= 0 {
+		partSize = DefaultUploadPartSize
+	}
+
+	h := sha256.New()
+	ph := &partHasher{partSize: partSize, h: sha256.New()}
+	cw := new(countWriter)
+
+	chunks, err := chunk.DefaultParams.Split(io.TeeReader(f, io.MultiWriter(h, ph, cw)))
+	if err != nil {
+		return nil, err
+	}
+	if ph.n > 0 {
+		ph.sum()
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return &imageDigest{
+		size:     cw.n,
+		sha256:   hex.EncodeToString(h.Sum(nil)),
+		partSize: partSize,
+		parts:    ph.parts,
+		chunks:   chunks,
+	}, nil
+}
+
+// multipartUploader uploads an image file with the library multipart or
+// chunked API.
+type multipartUploader struct {
+	c        *client.Client
+	f        *os.File
+	size     int64
+	sha256   string
+	partSize int64
+	digest   *imageDigest
+	stateDir string
+	bar      *mpb.Bar
+}
+
+func newMultipartUploader(c *client.Client, f *os.File, d *imageDigest, stateDir string) *multipartUploader {
+	return &multipartUploader{
+		c:        c,
+		f:        f,
+		size:     d.size,
+		sha256:   d.sha256,
+		partSize: d.partSize,
+		digest:   d,
+		stateDir: stateDir,
+	}
+}
+
+// apiRequest sends a JSON request to the library API and decodes the response in out.
+func (u *multipartUploader) apiRequest(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	ref, err := url.Parse(path)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(method, u.c.BaseURL.ResolveReference(ref).String(), body)
+	if err != nil {
+		return err
+	}
+	if u.c.AuthToken != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("BEARER %s", u.c.AuthToken))
+	}
+	if u.c.UserAgent != "" {
+		req.Header.Set("User-Agent", u.c.UserAgent)
+	}
+
+	res, err := u.c.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("error making request to server: %v", err)
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return client.ErrNotFound
+	case res.StatusCode < 200 || res.StatusCode > 299:
+		if err := jsonresp.ReadError(res.Body); err != nil {
+			return fmt.Errorf("request did not succeed: %v", err)
+		}
+		return fmt.Errorf("request did not succeed: http status code: %d", res.StatusCode)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// getOrCreate retrieves the library object at getPath, or creates it with newObj.
+func (u *multipartUploader) getOrCreate(ctx context.Context, getPath, createPath string, newObj, out interface{}) error {
+	err := u.apiRequest(ctx, http.MethodGet, getPath, nil, out)
+	if err != client.ErrNotFound {
+		return err
+	}
+	return u.apiRequest(ctx, http.MethodPost, createPath, newObj, out)
+}
+
+// ensureImage returns the library image record for the uploaded file, creating the
+// entity, collection, container and image records as required.
+func (u *multipartUploader) ensureImage(ctx context.Context, ref, arch, description string) (*client.Image, error) {
+	entityName, collectionName, containerName, _ := client.ParseLibraryPath(ref)
+
+	var entity client.EntityResponse
+	err := u.getOrCreate(ctx, "v1/entities/"+entityName, "v1/entities",
+		client.Entity{Name: entityName, Description: "No description"}, &entity)
+	if err != nil {
+		return nil, fmt.Errorf("while getting entity %s: %v", entityName, err)
+	}
+
+	qualifiedCollection := entityName + "/" + collectionName
+
+	var collection client.CollectionResponse
+	err = u.getOrCreate(ctx, "v1/collections/"+qualifiedCollection, "v1/collections",
+		client.Collection{Name: collectionName, Description: "No description", Entity: entity.Data.ID}, &collection)
+	if err != nil {
+		return nil, fmt.Errorf("while getting collection %s: %v", qualifiedCollection, err)
+	}
+
+	qualifiedContainer := qualifiedCollection + "/" + containerName
+
+	var container client.ContainerResponse
+	err = u.getOrCreate(ctx, "v1/containers/"+qualifiedContainer, "v1/containers",
+		client.Container{Name: containerName, Description: "No description", Collection: collection.Data.ID}, &container)
+	if err != nil {
+		return nil, fmt.Errorf("while getting container %s: %v", qualifiedContainer, err)
+	}
+
+	var image client.ImageResponse
+	err = u.getOrCreate(ctx, u.imagePath(qualifiedContainer, arch), "v1/images",
+		client.Image{Hash: "sha256." + u.sha256, Description: description, Container: container.Data.ID}, &image)
+	if err != nil {
+		return nil, fmt.Errorf("while getting image: %v", err)
+	}
+
+	return &image.Data, nil
+}
+
+// imagePath returns the API path of the uploaded image in container.
+func (u *multipartUploader) imagePath(container, arch string) string {
+	q := url.Values{}
+	q.Add("arch", arch)
+	return (&url.URL{Path: "v1/images/" + container + ":sha256." + u.sha256, RawQuery: q.Encode()}).String()
+}
+
+// verify checks that the library reports the digest and size of the local file
+// for the uploaded image.
+func (u *multipartUploader) verify(ctx context.Context, ref, arch string) error {
+	entityName, collectionName, containerName, _ := client.ParseLibraryPath(ref)
+
+	var image client.ImageResponse
+	path := u.imagePath(entityName+"/"+collectionName+"/"+containerName, arch)
+	if err := u.apiRequest(ctx, http.MethodGet, path, nil, &image); err != nil {
+		return fmt.Errorf("while getting uploaded image: %v", err)
+	}
+
+	if !image.Data.Uploaded {
+		return fmt.Errorf("library doesn't report the image as uploaded")
+	}
+	if want := "sha256." + u.sha256; image.Data.Hash != want {
+		return fmt.Errorf("library reports digest %s, local file digest is %s", image.Data.Hash, want)
+	}
+	if image.Data.Size != 0 && image.Data.Size != u.size {
+		return fmt.Errorf("library reports size %d, local file size is %d", image.Data.Size, u.size)
+	}
+	return nil
+}
+
+// setTags sets the tags of the uploaded image imageID in the container
+// containerID, with the architecture aware tags API when the library
+// supports it.
+func (u *multipartUploader) setTags(ctx context.Context, containerID, imageID, arch string, tags []string) error {
+	for _, tag := range tags {
+		path := "v2/tags/" + containerID
+		err := u.apiRequest(ctx, http.MethodPost, path, client.ArchImageTag{Arch: arch, Tag: tag, ImageID: imageID}, nil)
+		if err == client.ErrNotFound {
+			sylog.Debugf("Library doesn't support tags per architecture, tag %s replaces any existing one", tag)
+			path = "v1/tags/" + containerID
+			err = u.apiRequest(ctx, http.MethodPost, path, client.ImageTag{Tag: tag, ImageID: imageID}, nil)
+		}
+		if err != nil {
+			return fmt.Errorf("while setting tag %s: %v", tag, err)
+		}
+	}
+	return nil
+}
+
+// statePath returns the path of the state file of the upload.
+func (u *multipartUploader) statePath() string {
+	return filepath.Join(u.stateDir, u.sha256+".json")
+}
+
+// loadState returns the state of a previous interrupted upload of the image
+// imageID, if any.
+func (u *multipartUploader) loadState(imageID string) *uploadState {
+	if u.stateDir == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(u.statePath())
+	if err != nil {
+		return nil
+	}
+
+	s := new(uploadState)
+	if err := json.Unmarshal(b, s); err != nil {
+		sylog.Warningf("Ignoring corrupted upload state %s: %s", u.statePath(), err)
+		return nil
+	}
+	if s.ImageID != imageID || s.Size != u.size || s.PartSize <= 0 || s.UploadID == "" {
+		return nil
+	}
+	return s
+}
+
+// saveState persists the state of the upload.
+func (u *multipartUploader) saveState(s *uploadState) {
+	if u.stateDir == "" {
+		return
+	}
+
+	b, err := json.Marshal(s)
+	if err == nil {
+		err = os.MkdirAll(u.stateDir, 0700)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(u.statePath(), b, 0600)
+	}
+	if err != nil {
+		sylog.Warningf("Could not save upload state, an interrupted push will restart from the beginning: %s", err)
+	}
+}
+
+// removeState removes the state file of the upload.
+func (u *multipartUploader) removeState() {
+	if u.stateDir == "" {
+		return
+	}
+	if err := os.Remove(u.statePath()); err != nil && !os.IsNotExist(err) {
+		sylog.Warningf("Could not remove upload state %s: %s", u.statePath(), err)
+	}
+}
+
+// start initiates a new multipart upload.
+func (u *multipartUploader) start(ctx context.Context, imageID string) (*uploadState, error) {
+	var res client.MultipartUploadStartResponse
+
+	path := fmt.Sprintf("v2/imagefile/%s/_multipart", imageID)
+	err := u.apiRequest(ctx, http.MethodPost, path, multipartStartRequest{Size: u.size, PartSize: u.partSize}, &res)
+	if err == client.ErrNotFound {
+		return nil, errMultipartUnsupported
+	} else if err != nil {
+		return nil, fmt.Errorf("while starting multipart upload: %v", err)
+	}
+
+	s := &uploadState{
+		ImageID:    imageID,
+		UploadID:   res.Data.UploadID,
+		Size:       u.size,
+		PartSize:   res.Data.PartSize,
+		TotalParts: res.Data.TotalParts,
+	}
+	if s.PartSize <= 0 {
+		s.PartSize = u.partSize
+	}
+	if s.PartSize != u.partSize {
+		sylog.Debugf("Library selected a part size of %d bytes", s.PartSize)
+	}
+	if n := int((u.size + s.PartSize - 1) / s.PartSize); s.TotalParts != n {
+		return nil, fmt.Errorf("library expects %d parts of %d bytes for a file of %d bytes", s.TotalParts, s.PartSize, u.size)
+	}
+
+	// S3 compliancy mode is enabled by default
+	val := res.Data.Options[client.OptionS3Compliant]
+	s.S3Compliant = val == "" || val == "true"
+
+	return s, nil
+}
+
+// upload uploads the file to the library image imageID, resuming a previous
+// interrupted upload when possible.
+func (u *multipartUploader) upload(ctx context.Context, imageID string) error {
+	s := u.loadState(imageID)
+	if s != nil {
+		err := u.uploadParts(ctx, s)
+		if err != errUploadExpired {
+			return err
+		}
+		sylog.Infof("Previous upload expired, restarting upload")
+		u.removeState()
+	}
+
+	s, err := u.start(ctx, imageID)
+	if err != nil {
+		return err
+	}
+	u.saveState(s)
+
+	return u.uploadParts(ctx, s)
+}
+
+// uploadParts uploads the parts missing from s and completes the upload.
+func (u *multipartUploader) uploadParts(ctx context.Context, s *uploadState) error {
+	p := mpb.New(mpb.WithOutput(sylog.Writer()))
+	u.bar = p.AddBar(u.size,
+		mpb.PrependDecorators(
+			decor.Counters(decor.UnitKiB, "%.1f / %.1f"),
+		),
+		mpb.AppendDecorators(
+			decor.Percentage(),
+			decor.AverageSpeed(decor.UnitKiB, " % .1f "),
+			decor.AverageETA(decor.ET_STYLE_GO),
+		),
+	)
+	defer func() {
+		if !u.bar.Completed() {
+			u.bar.Abort(false)
+		}
+		p.Wait()
+	}()
+
+	completed := make(map[int]bool)
+	for _, part := range s.CompletedParts {
+		completed[part.PartNumber] = true
+	}
+	if len(completed) > 0 {
+		sylog.Infof("Resuming upload, %d/%d parts already uploaded", len(completed), s.TotalParts)
+	}
+
+	for n := 1; n <= s.TotalParts; n++ {
+		offset := int64(n-1) * s.PartSize
+		size := s.PartSize
+		if offset+size > u.size {
+			size = u.size - offset
+		}
+
+		if completed[n] {
+			u.bar.IncrInt64(size)
+			continue
+		}
+
+		etag, err := u.uploadPartWithRetry(ctx, s, n, offset, size)
+		if err != nil {
+			return err
+		}
+
+		s.CompletedParts = append(s.CompletedParts, client.CompletedPart{PartNumber: n, Token: etag})
+		u.saveState(s)
+	}
+
+	path := fmt.Sprintf("v2/imagefile/%s/_multipart_complete", s.ImageID)
+	req := client.CompleteMultipartUploadRequest{UploadID: s.UploadID, CompletedParts: s.CompletedParts}
+	if err := u.apiRequest(ctx, http.MethodPut, path, req, nil); err == client.ErrNotFound {
+		return errUploadExpired
+	} else if err != nil {
+		return fmt.Errorf("while completing multipart upload: %v", err)
+	}
+
+	u.removeState()
+	return nil
+}
+
+// uploadPartWithRetry uploads a part, retrying on failure.
+func (u *multipartUploader) uploadPartWithRetry(ctx context.Context, s *uploadState, n int, offset, size int64) (string, error) {
+	current := u.bar.Current()
+	delay := uploadRetryDelay
+
+	var err error
+	for attempt := 1; attempt <= uploadPartRetries; attempt++ {
+		var etag string
+
+		etag, err = u.uploadPart(ctx, s, n, offset, size)
+		if err == nil {
+			return etag, nil
+		}
+		if err == errUploadExpired || ctx.Err() != nil {
+			return "", err
+		}
+
+		u.bar.SetCurrent(current)
+		sylog.Debugf("Upload of part %d failed (attempt %d/%d): %s", n, attempt, uploadPartRetries, err)
+
+		if attempt < uploadPartRetries {
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+			delay *= 2
+		}
+	}
+
+	return "", fmt.Errorf("while uploading part %d/%d: %v (re-run push to resume the upload)", n, s.TotalParts, err)
+}
+
+// uploadPart uploads a single part to the presigned URL provided by the library.
+func (u *multipartUploader) uploadPart(ctx context.Context, s *uploadState, n int, offset, size int64) (string, error) {
+	var checksum string
+
+	if s.S3Compliant {
+		// the part digests were computed along with the image digest,
+		// unless the library selected another part size
+		if s.PartSize == u.digest.partSize && n <= len(u.digest.parts) {
+			checksum = u.digest.parts[n-1]
+		} else {
+			h := sha256.New()
+			if _, err := io.Copy(h, io.NewSectionReader(u.f, offset, size)); err != nil {
+				return "", err
+			}
+			checksum = hex.EncodeToString(h.Sum(nil))
+		}
+	}
+
+	var res client.UploadImagePartResponse
+
+	path := fmt.Sprintf("v2/imagefile/%s/_multipart", s.ImageID)
+	partReq := client.UploadImagePartRequest{
+		PartSize:       size,
+		UploadID:       s.UploadID,
+		PartNumber:     n,
+		SHA256Checksum: checksum,
+	}
+	if err := u.apiRequest(ctx, http.MethodPut, path, partReq, &res); err == client.ErrNotFound {
+		return "", errUploadExpired
+	} else if err != nil {
+		return "", err
+	}
+
+	body := u.bar.ProxyReader(io.NewSectionReader(u.f, offset, size))
+	defer body.Close()
+
+	req, err := http.NewRequest(http.MethodPut, res.Data.PresignedURL, body)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = size
+	if s.S3Compliant {
+		req.Header.Set("x-amz-content-sha256", checksum)
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("object store returned an error: %d", resp.StatusCode)
+	}
+
+	return resp.Header.Get("ETag"), nil
+}
@@ -0,0 +1,451 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sylabs/scs-library-client/client"
+	"github.com/sylabs/singularity/internal/pkg/client/chunk"
+)
+
+// mockLibrary emulates the library API and the object store presigned URLs.
+type mockLibrary struct {
+	sync.Mutex
+
+	t   *testing.T
+	url string
+
+	noMultipart bool
+	noArchTags  bool
+	badDigest   bool
+	// failPart holds the number of failures remaining before accepting a part
+	failPart map[int]int
+
+	image    *client.Image
+	uploadID string
+	parts    map[int][]byte
+	puts     int
+	tags     []string
+}
+
+func (m *mockLibrary) reply(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"data": data}); err != nil {
+		m.t.Errorf("while encoding response: %s", err)
+	}
+}
+
+func (m *mockLibrary) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.Lock()
+	defer m.Unlock()
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/v1/entities/"):
+		m.reply(w, client.Entity{ID: "entity"})
+	case strings.HasPrefix(r.URL.Path, "/v1/collections/"):
+		m.reply(w, client.Collection{ID: "collection"})
+	case strings.HasPrefix(r.URL.Path, "/v1/containers/"):
+		m.reply(w, client.Container{ID: "container"})
+	case strings.HasPrefix(r.URL.Path, "/v1/images/"):
+		if m.image == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		m.reply(w, m.image)
+	case r.URL.Path == "/v1/images" && r.Method == http.MethodPost:
+		var image client.Image
+		if err := json.NewDecoder(r.Body).Decode(&image); err != nil {
+			m.t.Errorf("while decoding image: %s", err)
+		}
+		image.ID = "image"
+		m.image = &image
+		m.reply(w, m.image)
+	case r.URL.Path == "/v2/imagefile/image/_multipart" && r.Method == http.MethodPost:
+		if m.noMultipart {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var req multipartStartRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			m.t.Errorf("while decoding start request: %s", err)
+		}
+		m.uploadID = fmt.Sprintf("upload%d", len(m.uploadID))
+		m.parts = make(map[int][]byte)
+		m.reply(w, client.MultipartUpload{
+			UploadID:   m.uploadID,
+			PartSize:   req.PartSize,
+			TotalParts: int((req.Size + req.PartSize - 1) / req.PartSize),
+		})
+	case r.URL.Path == "/v2/imagefile/image/_multipart" && r.Method == http.MethodPut:
+		var req client.UploadImagePartRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			m.t.Errorf("while decoding part request: %s", err)
+		}
+		if req.UploadID != m.uploadID {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		m.reply(w, client.UploadImagePart{
+			PresignedURL: fmt.Sprintf("%s/s3/%d?sha256=%s", m.url, req.PartNumber, req.SHA256Checksum),
+		})
+	case strings.HasPrefix(r.URL.Path, "/s3/"):
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/s3/"))
+		m.puts++
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			m.t.Errorf("while reading part: %s", err)
+		}
+		if m.failPart[n] > 0 {
+			m.failPart[n]--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		sum := sha256.Sum256(b)
+		if hex.EncodeToString(sum[:]) != r.URL.Query().Get("sha256") ||
+			r.Header.Get("x-amz-content-sha256") != r.URL.Query().Get("sha256") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		m.parts[n] = b
+		w.Header().Set("ETag", fmt.Sprintf("etag%d", n))
+	case r.URL.Path == "/v2/imagefile/image/_multipart_complete":
+		var req client.CompleteMultipartUploadRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			m.t.Errorf("while decoding complete request: %s", err)
+		}
+		if req.UploadID != m.uploadID {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var data []byte
+		for i, p := range req.CompletedParts {
+			if p.PartNumber != i+1 || p.Token != fmt.Sprintf("etag%d", i+1) {
+				m.t.Errorf("unexpected completed part %+v", p)
+			}
+			data = append(data, m.parts[p.PartNumber]...)
+		}
+		sum := sha256.Sum256(data)
+		if m.badDigest {
+			sum[0] ^= 0xff
+		}
+		m.image.Hash = "sha256." + hex.EncodeToString(sum[:])
+		m.image.Size = int64(len(data))
+		m.image.Uploaded = true
+		m.reply(w, nil)
+	case r.URL.Path == "/v2/tags/container" && r.Method == http.MethodPost:
+		if m.noArchTags {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var tag client.ArchImageTag
+		if err := json.NewDecoder(r.Body).Decode(&tag); err != nil {
+			m.t.Errorf("while decoding tag: %s", err)
+		}
+		m.tags = append(m.tags, tag.Arch+"/"+tag.Tag+"/"+tag.ImageID)
+	case r.URL.Path == "/v1/tags/container" && r.Method == http.MethodPost:
+		var tag client.ImageTag
+		if err := json.NewDecoder(r.Body).Decode(&tag); err != nil {
+			m.t.Errorf("while decoding tag: %s", err)
+		}
+		m.tags = append(m.tags, tag.Tag+"/"+tag.ImageID)
+	case strings.Contains(r.URL.Path, "/_chunks"):
+		// chunked uploads are not supported
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		m.t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestLibraryMultipartPush(t *testing.T) {
+	const partSize = 4096
+
+	uploadRetryDelay = 0
+
+	data := make([]byte, 3*partSize-100)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "multipart-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	image := filepath.Join(dir, "image.sif")
+	if err := ioutil.WriteFile(image, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	stateDir := filepath.Join(dir, "state")
+
+	tests := []struct {
+		name        string
+		setup       func(m *mockLibrary)
+		partSize    int64
+		wantErr     bool
+		wantPuts    int
+		wantState   bool
+		wantPartial int
+	}{
+		{
+			name:     "SmallFile",
+			partSize: 4 * partSize,
+			wantPuts: 0,
+		},
+		{
+			name:     "Upload",
+			partSize: partSize,
+			wantPuts: 3,
+		},
+		{
+			name: "FlakyPart",
+			setup: func(m *mockLibrary) {
+				m.failPart = map[int]int{2: uploadPartRetries - 1}
+			},
+			partSize: partSize,
+			wantPuts: 3 + uploadPartRetries - 1,
+		},
+		{
+			name: "Interrupted",
+			setup: func(m *mockLibrary) {
+				m.failPart = map[int]int{3: uploadPartRetries}
+			},
+			partSize:    partSize,
+			wantErr:     true,
+			wantPuts:    2 + uploadPartRetries,
+			wantState:   true,
+			wantPartial: 2,
+		},
+		{
+			name:     "NoMultipart",
+			setup:    func(m *mockLibrary) { m.noMultipart = true },
+			partSize: partSize,
+			wantPuts: 0,
+		},
+		{
+			name:     "DigestMismatch",
+			setup:    func(m *mockLibrary) { m.badDigest = true },
+			partSize: partSize,
+			wantErr:  true,
+			wantPuts: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.RemoveAll(stateDir)
+
+			m := &mockLibrary{t: t}
+			if tt.setup != nil {
+				tt.setup(m)
+			}
+			srv := httptest.NewServer(m)
+			defer srv.Close()
+			m.url = srv.URL
+
+			err := testMultipartPush(t, srv.URL, image, tt.partSize, stateDir)
+			if tt.wantErr && err == nil {
+				t.Errorf("unexpected success")
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if m.puts != tt.wantPuts {
+				t.Errorf("got %d part uploads, want %d", m.puts, tt.wantPuts)
+			}
+
+			states, _ := filepath.Glob(filepath.Join(stateDir, "*.json"))
+			if !tt.wantState {
+				if len(states) != 0 {
+					t.Errorf("unexpected upload state %v", states)
+				}
+				return
+			}
+			if len(states) != 1 {
+				t.Fatalf("got %d upload states, want 1", len(states))
+			}
+
+			b, err := ioutil.ReadFile(states[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			var s uploadState
+			if err := json.Unmarshal(b, &s); err != nil {
+				t.Fatal(err)
+			}
+			if len(s.CompletedParts) != tt.wantPartial {
+				t.Errorf("got %d completed parts, want %d", len(s.CompletedParts), tt.wantPartial)
+			}
+
+			// resume the interrupted upload, only the missing part must be uploaded
+			m.puts = 0
+			if err := testMultipartPush(t, srv.URL, image, tt.partSize, stateDir); err != nil {
+				t.Fatalf("unexpected error while resuming upload: %s", err)
+			}
+			if want := s.TotalParts - tt.wantPartial; m.puts != want {
+				t.Errorf("got %d part uploads while resuming, want %d", m.puts, want)
+			}
+			if !bytes.Equal(bytes.Join([][]byte{m.parts[1], m.parts[2], m.parts[3]}, nil), data) {
+				t.Errorf("uploaded data doesn't match image")
+			}
+		})
+	}
+}
+
+// testUploader returns an uploader of the image file f to the library at
+// url, along with the library image record of f.
+func testUploader(t *testing.T, url string, f *os.File, partSize int64, stateDir string) (*multipartUploader, *client.Image) {
+	c, err := client.NewClient(&client.Config{BaseURL: url, AuthToken: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := digestImage(f, partSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := newMultipartUploader(c, f, d, stateDir)
+	image, err := u.ensureImage(context.Background(), "entity/collection/container", "amd64", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u, image
+}
+
+func testMultipartPush(t *testing.T, url, image string, partSize int64, stateDir string) error {
+	f, err := os.Open(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	u, img := testUploader(t, url, f, partSize, stateDir)
+	uploaded, err := libraryMultipartPush(context.Background(), u, img.ID)
+	if err != nil || !uploaded {
+		return err
+	}
+	return u.verify(context.Background(), "entity/collection/container", "amd64")
+}
+
+func TestSetTags(t *testing.T) {
+	tests := []struct {
+		name       string
+		noArchTags bool
+		want       []string
+	}{
+		{
+			name: "ArchTags",
+			want: []string{"amd64/latest/image", "amd64/1.0/image"},
+		},
+		{
+			name:       "Tags",
+			noArchTags: true,
+			want:       []string{"latest/image", "1.0/image"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mockLibrary{t: t, noArchTags: tt.noArchTags}
+			srv := httptest.NewServer(m)
+			defer srv.Close()
+
+			c, err := client.NewClient(&client.Config{BaseURL: srv.URL, AuthToken: "token"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			u := &multipartUploader{c: c}
+
+			if err := u.setTags(context.Background(), "container", "image", "amd64", []string{"latest", "1.0"}); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(m.tags, tt.want) {
+				t.Errorf("got tags %v, want %v", m.tags, tt.want)
+			}
+		})
+	}
+}
+
+func TestDigestImage(t *testing.T) {
+	const partSize = 4096
+
+	data := make([]byte, 3*partSize-100)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := ioutil.TempFile("", "digest-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := digestImage(f, partSize)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	sum := sha256.Sum256(data)
+	if d.size != int64(len(data)) || d.sha256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("got size %d and digest %s, want %d and %x", d.size, d.sha256, len(data), sum)
+	}
+	if len(d.parts) != 3 {
+		t.Fatalf("got %d part digests, want 3", len(d.parts))
+	}
+	for i, p := range d.parts {
+		end := (i + 1) * partSize
+		if end > len(data) {
+			end = len(data)
+		}
+		sum := sha256.Sum256(data[i*partSize : end])
+		if p != hex.EncodeToString(sum[:]) {
+			t.Errorf("part %d: got digest %s, want %x", i+1, p, sum)
+		}
+	}
+
+	var size int64
+	for _, ch := range d.chunks {
+		if ch.Offset != size || ch.Digest != chunk.Digest(data[ch.Offset:ch.Offset+ch.Size]) {
+			t.Errorf("unexpected chunk %+v", ch)
+		}
+		size += ch.Size
+	}
+	if size != d.size {
+		t.Errorf("chunks cover %d bytes, want %d", size, d.size)
+	}
+
+	// the file is read again from the beginning for the upload
+	if off, err := f.Seek(0, io.SeekCurrent); err != nil || off != 0 {
+		t.Errorf("file offset %d not reset (%v)", off, err)
+	}
+}
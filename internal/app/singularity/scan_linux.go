@@ -0,0 +1,298 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/internal/pkg/util/env"
+	"github.com/sylabs/singularity/internal/pkg/util/exec"
+	"github.com/sylabs/singularity/pkg/image"
+	"github.com/sylabs/singularity/pkg/inspect"
+	"github.com/sylabs/singularity/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/util/namespaces"
+	"github.com/sylabs/singularity/pkg/util/singularityconf"
+)
+
+// ErrNoScanHook is returned by NewScanHook when no post build hook is
+// configured.
+var ErrNoScanHook = errors.New("no post build hook configured")
+
+// ScanHook is the post build hook scanning images.
+type ScanHook struct {
+	// Args is the hook command line, the first %s is replaced by the
+	// image path.
+	Args []string
+	// Timeout is the time after which the hook is killed.
+	Timeout time.Duration
+}
+
+// ScanMetadata describes the scanned image to the hook.
+type ScanMetadata struct {
+	Image      string          `json:"image"`
+	Format     string          `json:"format"`
+	Definition string          `json:"definition,omitempty"`
+	Inspect    json.RawMessage `json:"inspect,omitempty"`
+}
+
+// NewScanHook returns the post build hook configured in c.
+func NewScanHook(c *singularityconf.File) (*ScanHook, error) {
+	args := strings.Fields(c.PostBuildHook)
+	if len(args) == 0 {
+		return nil, ErrNoScanHook
+	}
+	if !filepath.IsAbs(args[0]) {
+		return nil, fmt.Errorf("post build hook %s must be an absolute path", args[0])
+	}
+	if c.PostBuildHookTimeout == 0 {
+		return nil, fmt.Errorf("post build hook timeout must be greater than zero")
+	}
+
+	return &ScanHook{
+		Args:    args,
+		Timeout: time.Duration(c.PostBuildHookTimeout) * time.Second,
+	}, nil
+}
+
+// Scan runs the hook against the image found at path. The report is
+// returned along with an error if the hook fails or times out, so the
+// hook output is always available to the caller.
+func (h *ScanHook) Scan(ctx context.Context, path string) (*inspect.ScanReport, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("while resolving image path: %s", err)
+	}
+
+	md, err := scanMetadata(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cred, err := scanCredential()
+	if err != nil {
+		return nil, err
+	}
+
+	mdFile, err := writeScanMetadata(md, cred)
+	if err != nil {
+		return nil, fmt.Errorf("while writing image metadata: %s", err)
+	}
+	defer os.Remove(mdFile)
+
+	args := make([]string, 0, len(h.Args)+2)
+	replaced := false
+	for _, a := range h.Args {
+		if !replaced && strings.Contains(a, "%s") {
+			a = strings.Replace(a, "%s", path, 1)
+			replaced = true
+		}
+		args = append(args, a)
+	}
+	if !replaced {
+		args = append(args, path)
+	}
+	args = append(args, mdFile)
+
+	ctx, cancel := context.WithTimeout(ctx, h.Timeout)
+	defer cancel()
+
+	var stdout bytes.Buffer
+
+	cmd := osexec.Command(args[0], args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	cmd.Dir = "/"
+	cmd.Env = []string{"PATH=" + env.DefaultPath}
+	// run the hook in its own process group to kill its children as well
+	// on timeout, they would otherwise keep the output pipe open
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: cred,
+		Setpgid:    true,
+	}
+
+	sylog.Infof("Scanning image %s", path)
+	sylog.Debugf("Running post build hook %v", args)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("while running post build hook: %s", err)
+	}
+
+	err = exec.WaitProcessGroup(ctx, cmd)
+
+	r := &inspect.ScanReport{
+		Hook:     strings.Join(h.Args, " "),
+		Date:     time.Now().UTC(),
+		ExitCode: cmd.ProcessState.ExitCode(),
+		Output:   stdout.String(),
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return r, fmt.Errorf("image scan timed out after %s", h.Timeout)
+	} else if err != nil {
+		return r, fmt.Errorf("image scan failed with exit status %d", r.ExitCode)
+	}
+	return r, nil
+}
+
+// RecordScanReport stores the scan report r in the image found at path.
+// In a SIF image, the report is added to the default object group, which
+// is covered by the group signatures, and is linked to the root filesystem
+// partition it describes.
+func RecordScanReport(path string, r *inspect.ScanReport) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("while encoding scan report: %s", err)
+	}
+
+	img, err := image.Init(path, false)
+	if err != nil {
+		return err
+	}
+	img.File.Close()
+
+	switch img.Type {
+	case image.SANDBOX:
+		return ioutil.WriteFile(filepath.Join(img.Path, ".singularity.d", inspect.ScanReportName), data, 0644)
+	case image.SIF:
+		f, err := sif.LoadContainer(img.Path, false)
+		if err != nil {
+			return fmt.Errorf("while loading SIF image: %s", err)
+		}
+		defer f.UnloadContainer()
+
+		part, _, err := f.GetPartPrimSys()
+		if err != nil {
+			return fmt.Errorf("while looking for the root filesystem partition: %s", err)
+		}
+
+		in := sif.DescriptorInput{
+			Datatype: sif.DataGenericJSON,
+			Groupid:  sif.DescrDefaultGroup,
+			Link:     part.ID,
+			Data:     data,
+			Fname:    inspect.ScanReportName,
+		}
+		in.Size = int64(binary.Size(in.Data))
+
+		if err := f.AddObject(in); err != nil {
+			return fmt.Errorf("while adding scan report to SIF image: %s", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("scan reports can only be recorded in SIF or sandbox images")
+}
+
+// scanMetadata returns the metadata passed to the hook for the image
+// found at path.
+func scanMetadata(path string) (*ScanMetadata, error) {
+	img, err := image.Init(path, false)
+	if err != nil {
+		return nil, err
+	}
+	defer img.File.Close()
+
+	md := &ScanMetadata{Image: img.Path}
+
+	switch img.Type {
+	case image.SANDBOX:
+		md.Format = "sandbox"
+		if b, err := ioutil.ReadFile(filepath.Join(img.Path, ".singularity.d", "Singularity")); err == nil {
+			md.Definition = string(b)
+		}
+	case image.SIF:
+		md.Format = "sif"
+		f, err := sif.LoadContainerFp(img.File, true)
+		if err != nil {
+			return nil, fmt.Errorf("while loading SIF image: %s", err)
+		}
+		for _, od := range f.DescrArr {
+			if !od.Used {
+				continue
+			}
+			switch {
+			case od.Datatype == sif.DataDeffile:
+				md.Definition = string(od.GetData(&f))
+			case od.Datatype == sif.DataGenericJSON && od.GetName() == image.SIFDescInspectMetadataJSON:
+				md.Inspect = od.GetData(&f)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("only SIF and sandbox images can be scanned")
+	}
+	return md, nil
+}
+
+// writeScanMetadata writes the image metadata in a temporary file readable
+// by the hook.
+func writeScanMetadata(md *ScanMetadata, cred *syscall.Credential) (string, error) {
+	f, err := ioutil.TempFile("", "scan-metadata-")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if err := json.NewEncoder(f).Encode(md); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	if cred != nil {
+		if err := f.Chown(int(cred.Uid), int(cred.Gid)); err != nil {
+			os.Remove(f.Name())
+			return "", err
+		}
+	}
+	return f.Name(), nil
+}
+
+// scanCredential returns the credential the hook runs with, nil if the
+// current user is already unprivileged. When running as root, the hook
+// runs as the user who invoked sudo, or as nobody.
+func scanCredential() (*syscall.Credential, error) {
+	if os.Geteuid() != 0 {
+		return nil, nil
+	}
+	// fakeroot builds are already unprivileged on the host
+	if inside, _ := namespaces.IsInsideUserNamespace(os.Getpid()); inside {
+		return nil, nil
+	}
+
+	uid, gid := os.Getenv("SUDO_UID"), os.Getenv("SUDO_GID")
+	if uid == "" || uid == "0" {
+		u, err := user.Lookup("nobody")
+		if err != nil {
+			return nil, fmt.Errorf("while looking for the unprivileged user running the post build hook: %s", err)
+		}
+		uid, gid = u.Uid, u.Gid
+	}
+
+	cred := &syscall.Credential{Groups: []uint32{}}
+	id, err := strconv.ParseUint(uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID %q: %s", uid, err)
+	}
+	cred.Uid = uint32(id)
+	id, err = strconv.ParseUint(gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid group ID %q: %s", gid, err)
+	}
+	cred.Gid = uint32(id)
+
+	return cred, nil
+}
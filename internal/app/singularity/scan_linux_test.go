@@ -0,0 +1,233 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/pkg/inspect"
+	"github.com/sylabs/singularity/pkg/util/singularityconf"
+)
+
+const scanHookScript = `#!/bin/sh
+echo "args: $*"
+for md; do :; done
+cat "$md"
+case "$1" in
+fail) exit 3 ;;
+hang) sleep 60 ;;
+esac
+`
+
+func TestNewScanHook(t *testing.T) {
+	tests := []struct {
+		name    string
+		hook    string
+		timeout uint
+		wantErr bool
+		want    *ScanHook
+	}{
+		{name: "NoHook", timeout: 300, wantErr: true},
+		{name: "RelativePath", hook: "scanner %s", timeout: 300, wantErr: true},
+		{name: "NoTimeout", hook: "/usr/bin/scanner %s", wantErr: true},
+		{
+			name:    "Hook",
+			hook:    "/usr/bin/scanner --image %s",
+			timeout: 10,
+			want:    &ScanHook{Args: []string{"/usr/bin/scanner", "--image", "%s"}, Timeout: 10 * time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := NewScanHook(&singularityconf.File{PostBuildHook: tt.hook, PostBuildHookTimeout: tt.timeout})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("unexpected success")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if strings.Join(h.Args, " ") != strings.Join(tt.want.Args, " ") || h.Timeout != tt.want.Timeout {
+				t.Errorf("got hook %+v, want %+v", h, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewScanHook(&singularityconf.File{}); err != ErrNoScanHook {
+		t.Errorf("got error %v, want %v", err, ErrNoScanHook)
+	}
+}
+
+func TestScanHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scan-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// the hook runs unprivileged when the test runs as root
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	script := filepath.Join(dir, "hook.sh")
+	if err := ioutil.WriteFile(script, []byte(scanHookScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile("../../../e2e/testdata/busybox.sif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := filepath.Join(dir, "image.sif")
+	if err := ioutil.WriteFile(image, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantErr    bool
+		wantExit   int
+		wantOutput []string
+	}{
+		{
+			name:       "Success",
+			args:       []string{script, "--image", "%s"},
+			wantOutput: []string{"args: --image " + image + " ", `"image":"` + image + `"`, `"format":"sif"`},
+		},
+		{
+			name:       "ImageAppended",
+			args:       []string{script},
+			wantOutput: []string{"args: " + image + " "},
+		},
+		{
+			name:       "Failure",
+			args:       []string{script, "fail"},
+			wantErr:    true,
+			wantExit:   3,
+			wantOutput: []string{"args: fail " + image},
+		},
+		{
+			name:    "Timeout",
+			args:    []string{script, "hang"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &ScanHook{Args: tt.args, Timeout: 2 * time.Second}
+
+			start := time.Now()
+			r, err := h.Scan(context.Background(), image)
+			if time.Since(start) > 30*time.Second {
+				t.Errorf("hook not killed on timeout")
+			}
+			if tt.wantErr && err == nil {
+				t.Errorf("unexpected success")
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if r == nil {
+				t.Fatalf("no scan report returned")
+			}
+			if tt.wantExit != 0 && r.ExitCode != tt.wantExit {
+				t.Errorf("got exit code %d, want %d", r.ExitCode, tt.wantExit)
+			}
+			for _, s := range tt.wantOutput {
+				if !strings.Contains(r.Output, s) {
+					t.Errorf("output %q doesn't contain %q", r.Output, s)
+				}
+			}
+		})
+	}
+}
+
+func TestRecordScanReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scan-report-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := &inspect.ScanReport{Hook: "/usr/bin/scanner %s", Output: "no vulnerability found\n"}
+
+	t.Run("SIF", func(t *testing.T) {
+		data, err := ioutil.ReadFile("../../../e2e/testdata/busybox.sif")
+		if err != nil {
+			t.Fatal(err)
+		}
+		image := filepath.Join(dir, "image.sif")
+		if err := ioutil.WriteFile(image, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := RecordScanReport(image, r); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		f, err := sif.LoadContainer(image, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.UnloadContainer()
+
+		part, _, err := f.GetPartPrimSys()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got *inspect.ScanReport
+		for _, od := range f.DescrArr {
+			if od.Used && od.Datatype == sif.DataGenericJSON && od.GetName() == inspect.ScanReportName {
+				if od.Link != part.ID || od.Groupid != sif.DescrDefaultGroup {
+					t.Errorf("scan report linked to %d in group %x, want %d in group %x", od.Link, od.Groupid, part.ID, sif.DescrDefaultGroup)
+				}
+				got = new(inspect.ScanReport)
+				if err := json.Unmarshal(od.GetData(&f), got); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if got == nil || got.Output != r.Output {
+			t.Errorf("got scan report %+v, want %+v", got, r)
+		}
+	})
+
+	t.Run("Sandbox", func(t *testing.T) {
+		sandbox := filepath.Join(dir, "sandbox")
+		if err := os.MkdirAll(filepath.Join(sandbox, ".singularity.d"), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := RecordScanReport(sandbox, r); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(sandbox, ".singularity.d", inspect.ScanReportName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got inspect.ScanReport
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Output != r.Output {
+			t.Errorf("got scan report %+v, want %+v", got, r)
+		}
+	})
+}
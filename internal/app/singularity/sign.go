@@ -6,13 +6,21 @@
 package singularity
 
 import (
+	"crypto"
+	"errors"
+	"fmt"
+	"strings"
+
 	"github.com/sylabs/sif/pkg/integrity"
 	"github.com/sylabs/sif/pkg/sif"
 	"github.com/sylabs/singularity/pkg/sypgp"
+	"golang.org/x/crypto/openpgp"
 )
 
 type signer struct {
-	opts []integrity.SignerOpt
+	e    *openpgp.Entity // Entity to use to generate signature(s).
+	hash crypto.Hash     // Hash algorithm of the signature(s).
+	sels []signSelection // Groups or objects to sign, all groups if empty.
 }
 
 // SignOpt are used to configure s.
@@ -27,7 +35,7 @@ func OptSignEntitySelector(f sypgp.EntitySelector) SignOpt {
 			return err
 		}
 
-		s.opts = append(s.opts, integrity.OptSignWithEntity(e))
+		s.e = e
 
 		return nil
 	}
@@ -37,7 +45,10 @@ func OptSignEntitySelector(f sypgp.EntitySelector) SignOpt {
 // specified groupID. This may be called multiple times to add multiple group signatures.
 func OptSignGroup(groupID uint32) SignOpt {
 	return func(s *signer) error {
-		s.opts = append(s.opts, integrity.OptSignGroup(groupID))
+		if groupID == 0 {
+			return errors.New("invalid group ID")
+		}
+		s.sels = append(s.sels, signSelection{groupID: groupID})
 		return nil
 	}
 }
@@ -47,7 +58,22 @@ func OptSignGroup(groupID uint32) SignOpt {
 // This may be called multiple times to add multiple signatures.
 func OptSignObjects(ids ...uint32) SignOpt {
 	return func(s *signer) error {
-		s.opts = append(s.opts, integrity.OptSignObjects(ids...))
+		s.sels = append(s.sels, signSelection{ids: ids})
+		return nil
+	}
+}
+
+// OptSignHash specifies the name of the hash algorithm (sha256, sha384 or sha512) used to
+// generate signature(s). The algorithm is recorded in the signature descriptors, and defaults to
+// DefaultSignHash.
+func OptSignHash(name string) SignOpt {
+	return func(s *signer) error {
+		name = strings.ToLower(name)
+		h, ok := signHashes[name]
+		if !ok {
+			return fmt.Errorf("unsupported signature hash algorithm %q, supported algorithms are %s", name, strings.Join(SignHashes(), ", "))
+		}
+		s.hash = h
 		return nil
 	}
 }
@@ -59,7 +85,7 @@ func OptSignObjects(ids ...uint32) SignOpt {
 // consider using OptSignGroup and/or OptSignObject.
 func Sign(path string, opts ...SignOpt) error {
 	// Apply options to signer.
-	s := signer{}
+	s := signer{hash: signHashes[DefaultSignHash]}
 	for _, opt := range opts {
 		if err := opt(&s); err != nil {
 			return err
@@ -73,8 +99,25 @@ func Sign(path string, opts ...SignOpt) error {
 	}
 	defer f.UnloadContainer()
 
+	// The sif integrity signer only generates SHA-256 signatures.
+	if s.hash != crypto.SHA256 {
+		return signWithHash(&f, s.e, s.hash, s.sels)
+	}
+
+	var sopts []integrity.SignerOpt
+	if s.e != nil {
+		sopts = append(sopts, integrity.OptSignWithEntity(s.e))
+	}
+	for _, sel := range s.sels {
+		if sel.groupID != 0 {
+			sopts = append(sopts, integrity.OptSignGroup(sel.groupID))
+		} else {
+			sopts = append(sopts, integrity.OptSignObjects(sel.ids...))
+		}
+	}
+
 	// Apply signature(s).
-	is, err := integrity.NewSigner(&f, s.opts...)
+	is, err := integrity.NewSigner(&f, sopts...)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,373 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package singularity
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/sha512" // SHA-384 and SHA-512 signatures
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/sylabs/sif/pkg/integrity"
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// DefaultSignHash is the name of the hash algorithm used by default for signatures.
+const DefaultSignHash = "sha256"
+
+// signHashes are the hash algorithms supported for signatures, by name.
+var signHashes = map[string]crypto.Hash{
+	"sha256": crypto.SHA256,
+	"sha384": crypto.SHA384,
+	"sha512": crypto.SHA512,
+}
+
+// sifHashTypes are the SIF hash types recorded in the signature descriptors for each supported
+// hash algorithm.
+var sifHashTypes = map[crypto.Hash]sif.Hashtype{
+	crypto.SHA256: sif.HashSHA256,
+	crypto.SHA384: sif.HashSHA384,
+	crypto.SHA512: sif.HashSHA512,
+}
+
+// SignHashes returns the names of the hash algorithms supported for signatures.
+func SignHashes() []string {
+	names := make([]string, 0, len(signHashes))
+	for name := range signHashes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SignatureHash returns the name of the hash algorithm recorded in the descriptor of the
+// signature object id in f, or an empty string if it's unknown.
+func SignatureHash(f *sif.FileImage, id uint32) string {
+	od, _, err := f.GetFromDescrID(id)
+	if err != nil {
+		return ""
+	}
+	ht, err := od.GetHashType()
+	if err != nil {
+		return ""
+	}
+	for name, h := range signHashes {
+		if sifHashTypes[h] == ht {
+			return name
+		}
+	}
+	return ""
+}
+
+// signCreator identifies the version of singularity creating signatures, it's recorded as the
+// name of the signature descriptors.
+func signCreator() string {
+	return "singularity " + buildcfg.PACKAGE_VERSION
+}
+
+// checkSignatureHashes returns an error if a signature of f uses a hash algorithm unknown to this
+// version, the error reports the version which created the signature when it's recorded.
+func checkSignatureHashes(f *sif.FileImage) error {
+	for _, od := range f.DescrArr {
+		if !od.Used || od.Datatype != sif.DataSignature {
+			continue
+		}
+		ht, err := od.GetHashType()
+		if err != nil {
+			return err
+		}
+		known := false
+		for _, t := range sifHashTypes {
+			if t == ht {
+				known = true
+				break
+			}
+		}
+		if known {
+			continue
+		}
+
+		creator := "an unknown version"
+		if name := od.GetName(); strings.HasPrefix(name, "singularity ") {
+			creator = name
+		}
+		return &UnknownHashError{ID: od.ID, Hash: ht, Creator: creator}
+	}
+	return nil
+}
+
+// signSelection selects the objects of a signature, either all the objects of the group groupID
+// or the objects ids, one signature being applied for each of their groups.
+type signSelection struct {
+	groupID uint32
+	ids     []uint32
+}
+
+// signGroup holds the objects of the group id covered by a signature, sorted by ID.
+type signGroup struct {
+	id  uint32
+	ods []*sif.Descriptor
+}
+
+// getSignGroups returns the groups of f to sign according to sels, all the groups of f if sels is
+// empty.
+func getSignGroups(f *sif.FileImage, sels []signSelection) ([]signGroup, error) {
+	if len(sels) == 0 {
+		var ids []uint32
+		for _, od := range f.DescrArr {
+			if od.Used && od.Groupid != sif.DescrUnusedGroup {
+				ids = append(ids, od.Groupid&^sif.DescrGroupMask)
+			}
+		}
+		if len(ids) == 0 {
+			return nil, errors.New("no groups found")
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		for i := len(ids) - 1; i > 0; i-- {
+			if ids[i] == ids[i-1] {
+				ids = append(ids[:i], ids[i+1:]...)
+			}
+		}
+		for _, id := range ids {
+			sels = append(sels, signSelection{groupID: id})
+		}
+	}
+
+	var groups []signGroup
+	for _, sel := range sels {
+		if sel.groupID != 0 {
+			ods, _, err := f.GetFromDescr(sif.Descriptor{Groupid: sel.groupID | sif.DescrGroupMask})
+			if err != nil {
+				return nil, fmt.Errorf("while getting objects of group %d: %w", sel.groupID, err)
+			}
+			groups = append(groups, newSignGroup(sel.groupID, ods))
+			continue
+		}
+
+		if len(sel.ids) == 0 {
+			return nil, errors.New("no objects specified")
+		}
+		groupObjects := make(map[uint32][]*sif.Descriptor)
+		var groupIDs []uint32
+		for _, id := range sel.ids {
+			if id == 0 {
+				return nil, errors.New("invalid object ID")
+			}
+			od, _, err := f.GetFromDescrID(id)
+			if err != nil {
+				return nil, fmt.Errorf("while getting object %d: %w", id, err)
+			}
+			groupID := od.Groupid &^ sif.DescrGroupMask
+			if groupID == 0 {
+				return nil, fmt.Errorf("object %d is not in a group", id)
+			}
+			if _, ok := groupObjects[groupID]; !ok {
+				groupIDs = append(groupIDs, groupID)
+			}
+			groupObjects[groupID] = append(groupObjects[groupID], od)
+		}
+		sort.Slice(groupIDs, func(i, j int) bool { return groupIDs[i] < groupIDs[j] })
+		for _, groupID := range groupIDs {
+			groups = append(groups, newSignGroup(groupID, groupObjects[groupID]))
+		}
+	}
+	return groups, nil
+}
+
+// newSignGroup returns the signGroup of the objects ods of the group id, sorted by ID without
+// duplicates.
+func newSignGroup(id uint32, ods []*sif.Descriptor) signGroup {
+	sort.Slice(ods, func(i, j int) bool { return ods[i].ID < ods[j].ID })
+	g := signGroup{id: id}
+	for _, od := range ods {
+		if n := len(g.ods); n == 0 || g.ods[n-1].ID != od.ID {
+			g.ods = append(g.ods, od)
+		}
+	}
+	return g
+}
+
+// signDigest is a digest of the image metadata, marshalled as "alg:value".
+type signDigest struct {
+	hash  crypto.Hash
+	value []byte
+}
+
+// newSignDigest returns the digest of the contents read from r, using hash algorithm h.
+func newSignDigest(h crypto.Hash, r io.Reader) (signDigest, error) {
+	w := h.New()
+	if _, err := io.Copy(w, r); err != nil {
+		return signDigest{}, err
+	}
+	return signDigest{hash: h, value: w.Sum(nil)}, nil
+}
+
+func (d signDigest) MarshalJSON() ([]byte, error) {
+	for name, h := range signHashes {
+		if h == d.hash {
+			return json.Marshal(fmt.Sprintf("%s:%x", name, d.value))
+		}
+	}
+	return nil, fmt.Errorf("unsupported signature hash algorithm %v", d.hash)
+}
+
+// signObjectMetadata and signImageMetadata are the image metadata signed by the sif integrity
+// package, in version 1 of its format, so that signatures are verified by any sif verifier.
+type signObjectMetadata struct {
+	RelativeID       uint32     `json:"relativeId"`
+	DescriptorDigest signDigest `json:"descriptorDigest"`
+	ObjectDigest     signDigest `json:"objectDigest"`
+}
+
+type signImageMetadata struct {
+	Version int `json:"version"`
+	Header  struct {
+		Digest signDigest `json:"digest"`
+	} `json:"header"`
+	Objects []signObjectMetadata `json:"objects"`
+}
+
+// writeLE writes fields to w in little-endian order.
+func writeLE(w io.Writer, fields ...interface{}) error {
+	for _, f := range fields {
+		if err := binary.Write(w, binary.LittleEndian, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getSignImageMetadata returns the image metadata of the objects of g in f, using hash algorithm
+// h. Object IDs are relative to the minimum object ID of the group.
+func getSignImageMetadata(f *sif.FileImage, g signGroup, h crypto.Hash) (signImageMetadata, error) {
+	md := signImageMetadata{Version: 1}
+
+	ods, _, err := f.GetFromDescr(sif.Descriptor{Groupid: g.id | sif.DescrGroupMask})
+	if err != nil {
+		return md, fmt.Errorf("while getting objects of group %d: %w", g.id, err)
+	}
+	minID := ^uint32(0)
+	for _, od := range ods {
+		if od.ID < minID {
+			minID = od.ID
+		}
+	}
+
+	b := new(bytes.Buffer)
+	hdr := f.Header
+	if err := writeLE(b, hdr.Launch, hdr.Magic, hdr.Version, hdr.ID); err != nil {
+		return md, err
+	}
+	if md.Header.Digest, err = newSignDigest(h, b); err != nil {
+		return md, err
+	}
+
+	for _, od := range g.ods {
+		relID := od.ID - minID
+		om := signObjectMetadata{RelativeID: relID}
+
+		b.Reset()
+		fields := []interface{}{od.Datatype, od.Used, relID, od.Link, od.Filelen, od.Ctime, od.UID, od.Gid, od.Name, od.Extra}
+		if err := writeLE(b, fields...); err != nil {
+			return md, err
+		}
+		if om.DescriptorDigest, err = newSignDigest(h, b); err != nil {
+			return md, err
+		}
+		if om.ObjectDigest, err = newSignDigest(h, od.GetReadSeeker(f)); err != nil {
+			return md, err
+		}
+		md.Objects = append(md.Objects, om)
+	}
+	return md, nil
+}
+
+// signWithHash adds to f a signature generated by e using hash algorithm h for each group
+// selected by sels, like the sif integrity signer does with SHA-256. The version of singularity
+// is recorded as the name of the signature descriptors.
+func signWithHash(f *sif.FileImage, e *openpgp.Entity, h crypto.Hash, sels []signSelection) error {
+	if e == nil {
+		return integrity.ErrNoKeyMaterial
+	}
+	ht, ok := sifHashTypes[h]
+	if !ok {
+		return fmt.Errorf("unsupported signature hash algorithm %v", h)
+	}
+
+	groups, err := getSignGroups(f, sels)
+	if err != nil {
+		return err
+	}
+
+	for _, g := range groups {
+		md, err := getSignImageMetadata(f, g, h)
+		if err != nil {
+			return fmt.Errorf("failed to get image metadata: %w", err)
+		}
+
+		b := new(bytes.Buffer)
+		plaintext, err := clearsign.Encode(b, e.PrivateKey, &packet.Config{DefaultHash: h})
+		if err != nil {
+			return fmt.Errorf("failed to encode signature: %w", err)
+		}
+		if err := json.NewEncoder(plaintext).Encode(md); err != nil {
+			plaintext.Close()
+			return fmt.Errorf("failed to encode signature: %w", err)
+		}
+		if err := plaintext.Close(); err != nil {
+			return fmt.Errorf("failed to encode signature: %w", err)
+		}
+
+		di := sif.DescriptorInput{
+			Datatype: sif.DataSignature,
+			Groupid:  sif.DescrUnusedGroup,
+			Link:     sif.DescrGroupMask | g.id,
+			Fname:    signCreator(),
+			Size:     int64(b.Len()),
+			Fp:       b,
+		}
+		if err := di.SetSignExtra(ht, hex.EncodeToString(e.PrimaryKey.Fingerprint[:])); err != nil {
+			return fmt.Errorf("failed to set signature metadata: %w", err)
+		}
+		if err := f.AddObject(di); err != nil {
+			return fmt.Errorf("failed to add object: %w", err)
+		}
+	}
+	return nil
+}
+
+// ErrUnknownHash is the error matched by an UnknownHashError.
+var ErrUnknownHash = errors.New("unknown signature hash algorithm")
+
+// UnknownHashError records a signature using a hash algorithm unknown to this version.
+type UnknownHashError struct {
+	ID      uint32       // ID of the signature object.
+	Hash    sif.Hashtype // Hash type recorded in the signature descriptor.
+	Creator string       // Version which created the signature.
+}
+
+func (e *UnknownHashError) Error() string {
+	return fmt.Sprintf(
+		"signature object %d uses hash algorithm %d unknown to %s, it was created by %s",
+		e.ID, int32(e.Hash), signCreator(), e.Creator,
+	)
+}
+
+// Is returns true if target is ErrUnknownHash.
+func (e *UnknownHashError) Is(target error) bool {
+	return target == ErrUnknownHash
+}
@@ -0,0 +1,296 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package singularity
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/binary"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/scs-key-client/client"
+	"github.com/sylabs/sif/pkg/integrity"
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/internal/pkg/sigstore"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+func TestSignHash(t *testing.T) {
+	e := getTestEntity(t)
+	s := httptest.NewServer(mockHKP{e: e})
+	defer s.Close()
+
+	keyServerOpt := OptVerifyUseKeyServer(&client.Config{BaseURL: s.URL})
+	mockEntityOpt := OptSignEntitySelector(mockEntitySelector(t))
+
+	tests := []struct {
+		name       string
+		hashes     []string
+		opts       []SignOpt
+		verifyOpts []VerifyOpt
+		wantObject uint32
+		wantHashes []string
+		wantErr    bool
+	}{
+		{
+			name:    "Unsupported",
+			hashes:  []string{"md5"},
+			wantErr: true,
+		},
+		{
+			name:       "SHA256",
+			hashes:     []string{"sha256"},
+			wantHashes: []string{"sha256"},
+		},
+		{
+			name:       "SHA384",
+			hashes:     []string{"SHA384"},
+			wantHashes: []string{"sha384"},
+		},
+		{
+			name:       "SHA512",
+			hashes:     []string{"sha512"},
+			wantHashes: []string{"sha512"},
+		},
+		{
+			name:       "SHA512OptSignGroup",
+			hashes:     []string{"sha512"},
+			opts:       []SignOpt{OptSignGroup(1)},
+			wantHashes: []string{"sha512"},
+		},
+		{
+			name:       "SHA512OptSignObjects",
+			hashes:     []string{"sha512"},
+			opts:       []SignOpt{OptSignObjects(1)},
+			verifyOpts: []VerifyOpt{OptVerifyObject(1)},
+			wantObject: 1,
+			wantHashes: []string{"sha512"},
+		},
+		{
+			name:       "Mixed",
+			hashes:     []string{"sha256", "sha512", "sha384"},
+			wantHashes: []string{"sha256", "sha512", "sha384"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := tempFileFrom(filepath.Join("testdata", "images", "one-group.sif"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(path)
+
+			for _, h := range tt.hashes {
+				opts := append([]SignOpt{mockEntityOpt, OptSignHash(h)}, tt.opts...)
+				err := Sign(path, opts...)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+				}
+			}
+			if tt.wantErr {
+				return
+			}
+
+			// Each signature is verified independently with its own hash algorithm.
+			wantVerified := []uint32{1, 2}
+			if tt.wantObject != 0 {
+				wantVerified = []uint32{tt.wantObject}
+			}
+
+			var gotHashes []string
+			cb := func(f *sif.FileImage, r integrity.VerifyResult) bool {
+				if err := r.Error(); err != nil {
+					t.Errorf("signature %d: unexpected error: %v", r.Signature(), err)
+				}
+				if got, want := r.Verified(), wantVerified; !reflect.DeepEqual(got, want) {
+					t.Errorf("signature %d: got verified %v, want %v", r.Signature(), got, want)
+				}
+				gotHashes = append(gotHashes, SignatureHash(f, r.Signature()))
+				return false
+			}
+			opts := append([]VerifyOpt{keyServerOpt, OptVerifyCallback(cb)}, tt.verifyOpts...)
+			if err := Verify(context.Background(), path, opts...); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(gotHashes, tt.wantHashes) {
+				t.Errorf("got hashes %v, want %v", gotHashes, tt.wantHashes)
+			}
+		})
+	}
+}
+
+func TestCheckSignatureHashes(t *testing.T) {
+	path, err := tempFileFrom(filepath.Join("testdata", "images", "one-group.sif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	if err := Sign(path, OptSignEntitySelector(mockEntitySelector(t)), OptSignHash("sha512")); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := sif.LoadContainer(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer()
+
+	if err := checkSignatureHashes(&f); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Record a hash algorithm unknown to this version in the signature descriptor.
+	for i, od := range f.DescrArr {
+		if od.Used && od.Datatype == sif.DataSignature {
+			binary.LittleEndian.PutUint32(f.DescrArr[i].Extra[:4], uint32(sif.HashBLAKE2B))
+		}
+	}
+
+	err = checkSignatureHashes(&f)
+	if !errors.Is(err, ErrUnknownHash) {
+		t.Fatalf("got error %v, want %v", err, ErrUnknownHash)
+	}
+	if got, want := err.Error(), "created by "+signCreator(); !strings.Contains(got, want) {
+		t.Errorf("got error %q, want it to contain %q", got, want)
+	}
+}
+
+func TestVerifyKeylessUnknownHash(t *testing.T) {
+	path, err := tempFileFrom(filepath.Join("testdata", "images", "one-group-signed-keyless.sif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	// Add a signature using a hash algorithm unknown to this version next to the keyless one.
+	f, err := sif.LoadContainer(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := []byte("signature")
+	di := sif.DescriptorInput{
+		Datatype: sif.DataSignature,
+		Groupid:  sif.DescrUnusedGroup,
+		Link:     sif.DescrGroupMask | 1,
+		Size:     int64(len(sig)),
+		Fp:       bytes.NewReader(sig),
+	}
+	if err := di.SetSignExtra(sif.HashBLAKE2B, strings.Repeat("00", 20)); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.AddObject(di); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.UnloadContainer(); err != nil {
+		t.Fatal(err)
+	}
+
+	signer := sigstore.Identity{
+		Subject: regexp.MustCompile(`^signer@example\.com$`),
+		Issuer:  "https://accounts.example.com",
+	}
+	err = Verify(context.Background(), path, OptVerifyKeyless(getTestTrustRoot(t), signer))
+	if !errors.Is(err, ErrUnknownHash) {
+		t.Fatalf("got error %v, want %v", err, ErrUnknownHash)
+	}
+}
+
+// signaturePlaintexts returns the plaintexts of the signatures of the SIF image at path.
+func signaturePlaintexts(t *testing.T, path string) []string {
+	t.Helper()
+
+	f, err := sif.LoadContainer(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer()
+
+	var plaintexts []string
+	for _, od := range f.DescrArr {
+		if !od.Used || od.Datatype != sif.DataSignature {
+			continue
+		}
+		b, _ := clearsign.Decode(od.GetData(&f))
+		if b == nil {
+			t.Fatalf("signature %d: clearsigned message not found", od.ID)
+		}
+		plaintexts = append(plaintexts, string(b.Plaintext))
+	}
+	return plaintexts
+}
+
+func TestSignWithHashMetadata(t *testing.T) {
+	e := getTestEntity(t)
+
+	tests := []struct {
+		name string
+		opts []SignOpt
+		sels []signSelection
+	}{
+		{
+			name: "Defaults",
+		},
+		{
+			name: "OptSignGroup",
+			opts: []SignOpt{OptSignGroup(1)},
+			sels: []signSelection{{groupID: 1}},
+		},
+		{
+			name: "OptSignObjects",
+			opts: []SignOpt{OptSignObjects(2, 1, 2)},
+			sels: []signSelection{{ids: []uint32{2, 1, 2}}},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := tempFileFrom(filepath.Join("testdata", "images", "one-group.sif"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(want)
+
+			got, err := tempFileFrom(filepath.Join("testdata", "images", "one-group.sif"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(got)
+
+			// The sif integrity signer signs with SHA-256.
+			opts := append([]SignOpt{OptSignEntitySelector(mockEntitySelector(t))}, tt.opts...)
+			if err := Sign(want, opts...); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := sif.LoadContainer(got, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := signWithHash(&f, e, crypto.SHA256, tt.sels); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := f.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := signaturePlaintexts(t, got), signaturePlaintexts(t, want); !reflect.DeepEqual(got, want) {
+				t.Errorf("got metadata %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -7,16 +7,33 @@ package singularity
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
 
 	"github.com/sylabs/scs-key-client/client"
 	"github.com/sylabs/sif/pkg/integrity"
 	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/internal/pkg/sandbox"
+	"github.com/sylabs/singularity/internal/pkg/sigstore"
+	"github.com/sylabs/singularity/internal/pkg/tuf"
+	"github.com/sylabs/singularity/pkg/image"
+	"github.com/sylabs/singularity/pkg/sylog"
 	"github.com/sylabs/singularity/pkg/sypgp"
 	"golang.org/x/crypto/openpgp"
 )
 
 type VerifyCallback func(*sif.FileImage, integrity.VerifyResult) bool
 
+// KeylessVerifyCallback is called for each verified keyless signature with
+// the ID of the signed object group.
+type KeylessVerifyCallback func(groupID uint32, r *sigstore.Result)
+
 type verifier struct {
 	c         *client.Config
 	groupIDs  []uint32
@@ -24,6 +41,12 @@ type verifier struct {
 	all       bool
 	legacy    bool
 	cb        VerifyCallback
+	keyless   bool
+	tr        *sigstore.TrustRoot
+	id        sigstore.Identity
+	keylessCb KeylessVerifyCallback
+	hkrOpts   []sypgp.HybridKeyRingOpt
+	freshness *tuf.Client
 }
 
 // VerifyOpt are used to configure v.
@@ -38,6 +61,32 @@ func OptVerifyUseKeyServer(c *client.Config) VerifyOpt {
 	}
 }
 
+// OptVerifyKeyCache caches the keys retrieved from the keyserver, and uses cached keys retrieved
+// less than ttl ago instead of contacting the keyserver again.
+func OptVerifyKeyCache(ttl time.Duration) VerifyOpt {
+	return func(v *verifier) error {
+		v.hkrOpts = append(v.hkrOpts, sypgp.OptKeyCacheTTL(ttl))
+		return nil
+	}
+}
+
+// OptVerifyRefreshKeys retrieves keys from the keyserver even if a fresh copy is cached.
+func OptVerifyRefreshKeys() VerifyOpt {
+	return func(v *verifier) error {
+		v.hkrOpts = append(v.hkrOpts, sypgp.OptRefreshKeys())
+		return nil
+	}
+}
+
+// OptVerifyStrictKeyFreshness rejects expired cached keys which can't be retrieved again from the
+// keyserver, instead of using them with a warning.
+func OptVerifyStrictKeyFreshness() VerifyOpt {
+	return func(v *verifier) error {
+		v.hkrOpts = append(v.hkrOpts, sypgp.OptStrictKeyFreshness())
+		return nil
+	}
+}
+
 // OptVerifyGroup adds a verification task for the group with the specified groupID. This may be
 // called multliple times to request verification of more than one group.
 func OptVerifyGroup(groupID uint32) VerifyOpt {
@@ -82,6 +131,46 @@ func OptVerifyCallback(cb VerifyCallback) VerifyOpt {
 	}
 }
 
+// OptVerifyKeyless selects verification of keyless (sigstore) signatures instead of PGP
+// signatures. Signing certificates, certificate transparency and transparency log entries are
+// checked against tr, and the signer identity must match id. Verification fails, rather than
+// falling back to PGP signatures, without a trust root or an identity and its OIDC issuer.
+func OptVerifyKeyless(tr *sigstore.TrustRoot, id sigstore.Identity) VerifyOpt {
+	return func(v *verifier) error {
+		if tr == nil {
+			return errors.New("keyless verification requires a trust root")
+		}
+		if id.Subject == nil {
+			return errors.New("keyless verification requires a signer identity")
+		}
+		if id.Issuer == "" {
+			return errors.New("keyless verification requires a signer OIDC issuer")
+		}
+		v.keyless = true
+		v.tr = tr
+		v.id = id
+		return nil
+	}
+}
+
+// OptVerifyKeylessCallback registers cb as the keyless verification callback.
+func OptVerifyKeylessCallback(cb KeylessVerifyCallback) VerifyOpt {
+	return func(v *verifier) error {
+		v.keylessCb = cb
+		return nil
+	}
+}
+
+// OptVerifyFreshness checks, once the signatures are verified, that the image is the latest
+// signed version listed by the TUF metadata read by c, to reject an older signed image served in
+// place of the current one.
+func OptVerifyFreshness(c *tuf.Client) VerifyOpt {
+	return func(v *verifier) error {
+		v.freshness = c
+		return nil
+	}
+}
+
 // newVerifier constructs a new verifier based on opts.
 func newVerifier(opts []VerifyOpt) (verifier, error) {
 	v := verifier{}
@@ -93,24 +182,23 @@ func newVerifier(opts []VerifyOpt) (verifier, error) {
 	return v, nil
 }
 
+// keyRing returns the keyring providing key material, the local public keyring supplemented by
+// the keyserver if one is configured.
+func (v verifier) keyRing(ctx context.Context) (openpgp.KeyRing, error) {
+	if v.c != nil {
+		return sypgp.NewHybridKeyRing(ctx, v.c, v.hkrOpts...)
+	}
+	return sypgp.PublicKeyRing()
+}
+
 // getOpts returns integrity.VerifierOpt necessary to validate f.
 func (v verifier) getOpts(ctx context.Context, f *sif.FileImage) ([]integrity.VerifierOpt, error) {
 	var iopts []integrity.VerifierOpt
 
 	// Add keyring.
-	var kr openpgp.KeyRing
-	if v.c != nil {
-		hkr, err := sypgp.NewHybridKeyRing(ctx, v.c)
-		if err != nil {
-			return nil, err
-		}
-		kr = hkr
-	} else {
-		pkr, err := sypgp.PublicKeyRing()
-		if err != nil {
-			return nil, err
-		}
-		kr = pkr
+	kr, err := v.keyRing(ctx)
+	if err != nil {
+		return nil, err
 	}
 	iopts = append(iopts, integrity.OptVerifyWithKeyRing(kr))
 
@@ -153,6 +241,87 @@ func (v verifier) getOpts(ctx context.Context, f *sif.FileImage) ([]integrity.Ve
 	return iopts, nil
 }
 
+// groupDigest returns the SHA256 digest of the data objects of the group groupID in f, in
+// object ID order. Each object is framed by its length as a big-endian 64-bit integer, so that
+// data moved from one object to another changes the digest. This is the message signed by keyless
+// signatures.
+func groupDigest(f *sif.FileImage, groupID uint32) ([]byte, error) {
+	h := sha256.New()
+
+	n := 0
+	for i, od := range f.DescrArr {
+		if !od.Used || od.Groupid != sif.DescrGroupMask|groupID {
+			continue
+		}
+		if err := binary.Write(h, binary.BigEndian, uint64(od.Filelen)); err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(h, f.DescrArr[i].GetReadSeeker(f)); err != nil {
+			return nil, err
+		}
+		n++
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("group %d not found", groupID)
+	}
+
+	return h.Sum(nil), nil
+}
+
+// verifyKeyless verifies the keyless signature(s) in f.
+func (v verifier) verifyKeyless(f *sif.FileImage) error {
+	if len(v.objectIDs) > 0 || v.legacy {
+		return errors.New("keyless signatures only support object group selection")
+	}
+
+	verified := 0
+	for i, od := range f.DescrArr {
+		if !od.Used || od.Datatype != sif.DataGenericJSON || od.GetName() != sigstore.BundleObjectName {
+			continue
+		}
+		if od.Link&sif.DescrGroupMask == 0 {
+			continue
+		}
+		groupID := od.Link &^ sif.DescrGroupMask
+
+		if len(v.groupIDs) > 0 && !containsID(v.groupIDs, groupID) {
+			continue
+		}
+
+		b, err := sigstore.ParseBundle(f.DescrArr[i].GetData(f))
+		if err != nil {
+			return fmt.Errorf("object group %d: %s", groupID, err)
+		}
+		digest, err := groupDigest(f, groupID)
+		if err != nil {
+			return err
+		}
+		r, err := b.Verify(digest, v.tr, v.id)
+		if err != nil {
+			return fmt.Errorf("object group %d: %s", groupID, err)
+		}
+
+		if v.keylessCb != nil {
+			v.keylessCb(groupID, r)
+		}
+		verified++
+	}
+
+	if verified == 0 {
+		return errors.New("no keyless signature found")
+	}
+	return nil
+}
+
+func containsID(ids []uint32, id uint32) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
 // Verify verifies digital signature(s) in the SIF image found at path, according to opts.
 //
 // By default, the singularity public keyring provides key material. To supplement this with a
@@ -160,29 +329,121 @@ func (v verifier) getOpts(ctx context.Context, f *sif.FileImage) ([]integrity.Ve
 //
 // By default, non-legacy signatures for all object groups are verified. To override the default
 // behavior, consider using OptVerifyGroup, OptVerifyObject, OptVerifyAll, and/or OptVerifyLegacy.
+//
+// To verify keyless signatures instead, use OptVerifyKeyless.
+//
+// To also check that the image is the latest signed version, use OptVerifyFreshness.
 func Verify(ctx context.Context, path string, opts ...VerifyOpt) error {
 	v, err := newVerifier(opts)
 	if err != nil {
 		return err
 	}
 
-	// Load container.
-	f, err := sif.LoadContainer(path, true)
+	// Load container, images created with a newer SIF format version are
+	// accepted as the objects they contain can still be verified.
+	fp, err := os.Open(path)
 	if err != nil {
 		return err
 	}
+	f, version, err := image.LoadSIF(fp, true)
+	if err != nil {
+		fp.Close()
+		return err
+	}
 	defer f.UnloadContainer()
 
+	if version != "" {
+		sylog.Warningf("%s uses the newer SIF format version %s, unknown objects are verified but can't be used", path, version)
+	}
+
+	// Reject signatures using a hash algorithm unknown to this version, rather than failing to
+	// verify them, whichever kind of signature is verified.
+	if err := checkSignatureHashes(&f); err != nil {
+		return err
+	}
+
+	if v.keyless {
+		err = v.verifyKeyless(&f)
+	} else {
+		err = v.verifySignatures(ctx, &f)
+	}
+	if err != nil || v.freshness == nil {
+		return err
+	}
+	return v.checkFreshness(ctx, fp)
+}
+
+// verifySignatures verifies the PGP signature(s) in f.
+func (v verifier) verifySignatures(ctx context.Context, f *sif.FileImage) error {
 	// Get options to validate f.
-	vopts, err := v.getOpts(ctx, &f)
+	vopts, err := v.getOpts(ctx, f)
 	if err != nil {
 		return err
 	}
 
 	// Verify signature(s).
-	iv, err := integrity.NewVerifier(&f, vopts...)
+	iv, err := integrity.NewVerifier(f, vopts...)
 	if err != nil {
 		return err
 	}
 	return iv.Verify()
 }
+
+// checkFreshness checks that the image read from r is the latest signed version listed by the
+// freshness metadata.
+func (v verifier) checkFreshness(ctx context.Context, r io.ReadSeeker) error {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+
+	name, err := v.freshness.Check(ctx, digest)
+	if err != nil {
+		return fmt.Errorf("freshness check failed: %w", err)
+	}
+	sylog.Infof("Image is the latest signed version of %s listed by %s", name, v.freshness.Source())
+	return nil
+}
+
+// SandboxVerifyResult is the result of the verification of a sandbox.
+type SandboxVerifyResult struct {
+	Source  string            // Path of the signed SIF image the sandbox was extracted from.
+	Signers []*openpgp.Entity // Entities of the keys signing the source image.
+	Changes []sandbox.Change  // Paths changed since the sandbox was extracted.
+}
+
+// VerifySandbox verifies the sandbox found at path against the signed SIF image it was extracted
+// from, according to opts. The signatures of the root file system partition of the source image
+// are verified with the keyring configured by opts, then the sandbox is compared to the content
+// of the signed partition, modification times are ignored. The source record of the sandbox only
+// locates the image, its content isn't trusted.
+//
+// Only keyring options apply, object selection and keyless options are rejected.
+func VerifySandbox(ctx context.Context, path string, opts ...VerifyOpt) (SandboxVerifyResult, error) {
+	v, err := newVerifier(opts)
+	if err != nil {
+		return SandboxVerifyResult{}, err
+	}
+	if v.keyless || v.freshness != nil || v.legacy || v.all || len(v.groupIDs) > 0 || len(v.objectIDs) > 0 {
+		return SandboxVerifyResult{}, errors.New("sandbox verification only supports keyring options")
+	}
+
+	s, err := sandbox.ReadSource(path)
+	if err != nil {
+		return SandboxVerifyResult{}, err
+	}
+
+	kr, err := v.keyRing(ctx)
+	if err != nil {
+		return SandboxVerifyResult{}, err
+	}
+	signers, changes, err := s.Verify(path, kr)
+	if err != nil {
+		return SandboxVerifyResult{}, err
+	}
+	return SandboxVerifyResult{Source: s.Image, Signers: signers, Changes: changes}, nil
+}
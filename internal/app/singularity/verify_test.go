@@ -8,16 +8,19 @@ package singularity
 import (
 	"context"
 	"errors"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"testing"
 
 	"github.com/sylabs/scs-key-client/client"
 	"github.com/sylabs/sif/pkg/integrity"
 	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/internal/pkg/sigstore"
 	"golang.org/x/crypto/openpgp"
 	"golang.org/x/crypto/openpgp/armor"
 )
@@ -236,6 +239,29 @@ func Test_verifier_getOpts(t *testing.T) {
 	}
 }
 
+// getFutureVersionImage returns the path of a copy of the image path with
+// a SIF format version newer than the supported one.
+func getFutureVersionImage(t *testing.T, path string) string {
+	t.Helper()
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(b[sif.HdrLaunchLen+sif.HdrMagicLen:], "02")
+
+	f, err := ioutil.TempFile("", "future-version-*.sif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
 func TestVerify(t *testing.T) {
 	// Start up a mock HKP server.
 	e := getTestEntity(t)
@@ -245,6 +271,10 @@ func TestVerify(t *testing.T) {
 	// Create an option that points to the mock HKP server.
 	keyServerOpt := OptVerifyUseKeyServer(&client.Config{BaseURL: s.URL})
 
+	// Create an unsigned image with a newer SIF format version.
+	futureVersion := getFutureVersionImage(t, filepath.Join("testdata", "images", "one-group.sif"))
+	defer os.Remove(futureVersion)
+
 	tests := []struct {
 		name         string
 		path         string
@@ -283,6 +313,12 @@ func TestVerify(t *testing.T) {
 			opts:    []VerifyOpt{keyServerOpt},
 			wantErr: &integrity.SignatureNotFoundError{},
 		},
+		{
+			name:    "SignatureNotFoundFutureVersion",
+			path:    futureVersion,
+			opts:    []VerifyOpt{keyServerOpt},
+			wantErr: &integrity.SignatureNotFoundError{},
+		},
 		{
 			name:         "Defaults",
 			path:         filepath.Join("testdata", "images", "one-group-signed.sif"),
@@ -304,6 +340,13 @@ func TestVerify(t *testing.T) {
 			wantVerified: [][]uint32{{1}},
 			wantEntity:   e,
 		},
+		{
+			name:         "FutureObject",
+			path:         filepath.Join("testdata", "images", "one-group-signed-future.sif"),
+			opts:         []VerifyOpt{keyServerOpt},
+			wantVerified: [][]uint32{{1, 2, 3}},
+			wantEntity:   e,
+		},
 		{
 			name:         "LegacyDefaults",
 			path:         filepath.Join("testdata", "images", "one-group-signed-legacy.sif"),
@@ -366,3 +409,141 @@ func TestVerify(t *testing.T) {
 		})
 	}
 }
+
+// getTestTrustRoot returns the trust root of the keyless signature fixtures.
+func getTestTrustRoot(t *testing.T) *sigstore.TrustRoot {
+	t.Helper()
+
+	var material [3][]byte
+	for i, name := range []string{"chain.pem", "ctlog.pub", "rekor.pub"} {
+		b, err := ioutil.ReadFile(filepath.Join("testdata", "keyless", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		material[i] = b
+	}
+
+	tr, err := sigstore.NewTrustRoot(material[0], material[1], material[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
+
+func TestOptVerifyKeyless(t *testing.T) {
+	tr := getTestTrustRoot(t)
+	signer := sigstore.Identity{
+		Subject: regexp.MustCompile(`^signer@example\.com$`),
+		Issuer:  "https://accounts.example.com",
+	}
+
+	// keyless verification never falls back to PGP signatures
+	if _, err := newVerifier([]VerifyOpt{OptVerifyKeyless(nil, signer)}); err == nil {
+		t.Errorf("unexpected success without trust root")
+	}
+	if _, err := newVerifier([]VerifyOpt{OptVerifyKeyless(tr, sigstore.Identity{})}); err == nil {
+		t.Errorf("unexpected success without signer identity")
+	}
+	if _, err := newVerifier([]VerifyOpt{OptVerifyKeyless(tr, sigstore.Identity{Subject: signer.Subject})}); err == nil {
+		t.Errorf("unexpected success without signer OIDC issuer")
+	}
+	if v, err := newVerifier([]VerifyOpt{OptVerifyKeyless(tr, signer)}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if !v.keyless {
+		t.Errorf("keyless verification not selected")
+	}
+}
+
+func TestVerifyKeyless(t *testing.T) {
+	tr := getTestTrustRoot(t)
+
+	signer := sigstore.Identity{
+		Subject: regexp.MustCompile(`^signer@example\.com$`),
+		Issuer:  "https://accounts.example.com",
+	}
+
+	tests := []struct {
+		name         string
+		path         string
+		opts         []VerifyOpt
+		wantVerified []uint32
+		wantSubject  string
+		wantErr      bool
+	}{
+		{
+			name:    "SignatureNotFound",
+			path:    filepath.Join("testdata", "images", "one-group.sif"),
+			opts:    []VerifyOpt{OptVerifyKeyless(tr, signer)},
+			wantErr: true,
+		},
+		{
+			name:    "PGPSignature",
+			path:    filepath.Join("testdata", "images", "one-group-signed.sif"),
+			opts:    []VerifyOpt{OptVerifyKeyless(tr, signer)},
+			wantErr: true,
+		},
+		{
+			name:         "MatchingIdentity",
+			path:         filepath.Join("testdata", "images", "one-group-signed-keyless.sif"),
+			opts:         []VerifyOpt{OptVerifyKeyless(tr, signer)},
+			wantVerified: []uint32{1},
+			wantSubject:  "signer@example.com",
+		},
+		{
+			name:         "MatchingIdentityGroup",
+			path:         filepath.Join("testdata", "images", "one-group-signed-keyless.sif"),
+			opts:         []VerifyOpt{OptVerifyKeyless(tr, signer), OptVerifyGroup(1)},
+			wantVerified: []uint32{1},
+			wantSubject:  "signer@example.com",
+		},
+		{
+			name: "MismatchedIdentity",
+			path: filepath.Join("testdata", "images", "one-group-signed-keyless.sif"),
+			opts: []VerifyOpt{OptVerifyKeyless(tr, sigstore.Identity{
+				Subject: regexp.MustCompile(`^intruder@example\.com$`),
+				Issuer:  signer.Issuer,
+			})},
+			wantErr: true,
+		},
+		{
+			name: "MismatchedIssuer",
+			path: filepath.Join("testdata", "images", "one-group-signed-keyless.sif"),
+			opts: []VerifyOpt{OptVerifyKeyless(tr, sigstore.Identity{
+				Subject: signer.Subject,
+				Issuer:  "https://token.example.com",
+			})},
+			wantErr: true,
+		},
+		{
+			name:    "OptVerifyObject",
+			path:    filepath.Join("testdata", "images", "one-group-signed-keyless.sif"),
+			opts:    []VerifyOpt{OptVerifyKeyless(tr, signer), OptVerifyObject(1)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var verified []uint32
+			var subject string
+
+			cb := func(groupID uint32, r *sigstore.Result) {
+				verified = append(verified, groupID)
+				subject = r.Subject
+			}
+			opts := append(tt.opts, OptVerifyKeylessCallback(cb))
+
+			err := Verify(context.Background(), tt.path, opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+
+			if got, want := verified, tt.wantVerified; !reflect.DeepEqual(got, want) {
+				t.Errorf("got verified %v, want %v", got, want)
+			}
+			if got, want := subject, tt.wantSubject; got != want {
+				t.Errorf("got subject %q, want %q", got, want)
+			}
+		})
+	}
+}
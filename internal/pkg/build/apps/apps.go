@@ -21,6 +21,8 @@ import (
 	"sync"
 
 	"github.com/sylabs/singularity/pkg/build/types"
+	"github.com/sylabs/singularity/pkg/build/types/parser"
+	"github.com/sylabs/singularity/pkg/inspect"
 	"github.com/sylabs/singularity/pkg/sylog"
 )
 
@@ -380,29 +382,11 @@ func copyFiles(b *types.Bundle, a *App) error {
 
 // %applabels
 func writeLabels(b *types.Bundle, a *App) error {
-	lines := strings.Split(strings.TrimSpace(a.Labels), "\n")
-	labels := make(map[string]string)
+	labels := parser.ParseLabels(a.Labels)
 
 	// add default label
-	labels["SCIF_APP_NAME"] = a.Name
-
-	for _, line := range lines {
-
-		// skip empty or comment lines
-		if line = strings.TrimSpace(line); line == "" || strings.Index(line, "#") == 0 {
-			continue
-		}
-		var key, val string
-		lineSubs := strings.SplitN(line, " ", 2)
-		if len(lineSubs) < 2 {
-			key = strings.TrimSpace(lineSubs[0])
-			val = ""
-		} else {
-			key = strings.TrimSpace(lineSubs[0])
-			val = strings.TrimSpace(lineSubs[1])
-		}
-
-		labels[key] = val
+	if _, ok := labels["SCIF_APP_NAME"]; !ok {
+		labels["SCIF_APP_NAME"] = a.Name
 	}
 
 	// make new map into json
@@ -416,6 +400,29 @@ func writeLabels(b *types.Bundle, a *App) error {
 	return err
 }
 
+// Attributes returns the inspect attributes of the app as they are found
+// in the image once it is built.
+func (a *App) Attributes() *inspect.AppAttributes {
+	attr := &inspect.AppAttributes{
+		Environment: make(map[string]string),
+		Labels:      parser.ParseLabels(a.Labels),
+		Helpfile:    strings.TrimRight(a.Help, "\n"),
+	}
+	if _, ok := attr.Labels["SCIF_APP_NAME"]; !ok {
+		attr.Labels["SCIF_APP_NAME"] = a.Name
+	}
+	if a.Env != "" {
+		attr.Environment[filepath.Join("/scif/apps", a.Name, "scif/env/90-environment.sh")] = strings.TrimRight(a.Env, "\n")
+	}
+	if a.Run != "" {
+		attr.Runscript = strings.TrimRight(fmt.Sprintf(scifRunscriptBase, a.Run), "\n")
+	}
+	if a.Test != "" {
+		attr.Test = strings.TrimRight(fmt.Sprintf(scifTestBase, a.Test), "\n")
+	}
+	return attr
+}
+
 //util funcs
 
 func appBase(b *types.Bundle, a *App) string {
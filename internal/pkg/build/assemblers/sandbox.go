@@ -23,6 +23,7 @@ type SandboxAssembler struct {
 // Assemble creates a Sandbox image from a Bundle.
 func (a *SandboxAssembler) Assemble(b *types.Bundle, path string) (err error) {
 	sylog.Infof("Creating sandbox directory...")
+	b.ReportProgress(types.ProgressEvent{Type: types.AssembleEvent, Phase: types.PhaseAssemble, Step: types.AssembleSandbox})
 
 	if _, err := os.Stat(path); err == nil {
 		os.RemoveAll(path)
@@ -6,8 +6,11 @@
 package assemblers
 
 import (
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"regexp"
@@ -15,6 +18,7 @@ import (
 	"sort"
 	"strconv"
 	"syscall"
+	"time"
 
 	uuid "github.com/satori/go.uuid"
 	"github.com/sylabs/sif/pkg/sif"
@@ -156,6 +160,12 @@ func createSIF(path string, b *types.Bundle, squashfile string, encOpts *encrypt
 		return fmt.Errorf("while creating container: %s", err)
 	}
 
+	if b.Opts.Reproducible {
+		if err := pinSIF(path, b.Opts.SourceDate); err != nil {
+			return fmt.Errorf("while making container reproducible: %s", err)
+		}
+	}
+
 	// chown the sif file to the calling user
 	if uid, gid, ok := changeOwner(); ok {
 		if err := os.Chown(path, uid, gid); err != nil {
@@ -166,6 +176,79 @@ func createSIF(path string, b *types.Bundle, squashfile string, encOpts *encrypt
 	return nil
 }
 
+// pinSIF makes the SIF image found at path reproducible: the header and
+// data object timestamps are set to date, the data objects are owned by
+// root and the image ID is derived from the image content.
+func pinSIF(path string, date time.Time) error {
+	fimg, err := sif.LoadContainer(path, false)
+	if err != nil {
+		return err
+	}
+	defer fimg.UnloadContainer()
+
+	fimg.Header.ID = uuid.Nil
+	fimg.Header.Ctime = date.Unix()
+	fimg.Header.Mtime = date.Unix()
+	for i := range fimg.DescrArr {
+		if !fimg.DescrArr[i].Used {
+			continue
+		}
+		fimg.DescrArr[i].Ctime = date.Unix()
+		fimg.DescrArr[i].Mtime = date.Unix()
+		fimg.DescrArr[i].UID = 0
+		fimg.DescrArr[i].Gid = 0
+	}
+
+	if _, err := fimg.Fp.Seek(fimg.Header.Descroff, io.SeekStart); err != nil {
+		return err
+	}
+	if err := binary.Write(fimg.Fp, binary.LittleEndian, fimg.DescrArr); err != nil {
+		return fmt.Errorf("while writing descriptors: %s", err)
+	}
+	if err := writeSIFHeader(&fimg); err != nil {
+		return err
+	}
+
+	// the ID is the digest of the image written with a nil ID
+	if _, err := fimg.Fp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, fimg.Fp); err != nil {
+		return fmt.Errorf("while computing image digest: %s", err)
+	}
+	fimg.Header.ID = uuid.NewV5(uuid.Nil, hex.EncodeToString(h.Sum(nil)))
+
+	return writeSIFHeader(&fimg)
+}
+
+// squashfsDigest returns the hex encoded sha256 digest of the squashfs
+// image at path.
+func squashfsDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("while opening squashfs: %s", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("while computing squashfs digest: %s", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeSIFHeader writes the global header of fimg to its file.
+func writeSIFHeader(fimg *sif.FileImage) error {
+	if _, err := fimg.Fp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := binary.Write(fimg.Fp, binary.LittleEndian, fimg.Header); err != nil {
+		return fmt.Errorf("while writing header: %s", err)
+	}
+	return nil
+}
+
 // Assemble creates a SIF image from a Bundle.
 func (a *SIFAssembler) Assemble(b *types.Bundle, path string) error {
 	sylog.Infof("Creating SIF file...")
@@ -197,6 +280,14 @@ func (a *SIFAssembler) Assemble(b *types.Bundle, path string) error {
 	if a.MksquashfsProcs != 0 {
 		flags = append(flags, "-processors", fmt.Sprint(a.MksquashfsProcs))
 	}
+	if b.Opts.BlockSize != 0 {
+		flags = append(flags, "-b", fmt.Sprint(b.Opts.BlockSize))
+	}
+	// pin the filesystem and files timestamps, requires squashfs-tools 4.4
+	if b.Opts.Reproducible {
+		date := fmt.Sprint(b.Opts.SourceDate.Unix())
+		flags = append(flags, "-reproducible", "-mkfs-time", date, "-all-time", date)
+	}
 	arch := machine.ArchFromContainer(b.RootfsPath)
 	if arch == "" {
 		sylog.Infof("Architecture not recognized, use native")
@@ -204,13 +295,26 @@ func (a *SIFAssembler) Assemble(b *types.Bundle, path string) error {
 	}
 	sylog.Verbosef("Set SIF container architecture to %s", arch)
 
+	b.ReportProgress(types.ProgressEvent{Type: types.AssembleEvent, Phase: types.PhaseAssemble, Step: types.AssembleSquashfs})
 	if err := s.Create([]string{b.RootfsPath}, fsPath, flags); err != nil {
 		return fmt.Errorf("while creating squashfs: %v", err)
 	}
 
+	// the root filesystem digest allows to compare reproducible builds
+	// even when the images differ, e.g. with a post build hook report
+	if b.Opts.Reproducible {
+		digest, err := squashfsDigest(fsPath)
+		if err != nil {
+			return err
+		}
+		sylog.Infof("Root filesystem digest: sha256:%s", digest)
+	}
+
 	var encOpts *encryptionOptions
 
 	if b.Opts.EncryptionKeyInfo != nil {
+		b.ReportProgress(types.ProgressEvent{Type: types.AssembleEvent, Phase: types.PhaseAssemble, Step: types.AssembleEncrypt})
+
 		plaintext, err := crypt.NewPlaintextKey(*b.Opts.EncryptionKeyInfo)
 		if err != nil {
 			return fmt.Errorf("unable to obtain encryption key: %+v", err)
@@ -238,6 +342,7 @@ func (a *SIFAssembler) Assemble(b *types.Bundle, path string) error {
 
 	}
 
+	b.ReportProgress(types.ProgressEvent{Type: types.AssembleEvent, Phase: types.PhaseAssemble, Step: types.AssembleSIF})
 	err = createSIF(path, b, fsPath, encOpts, arch)
 	if err != nil {
 		return fmt.Errorf("while creating SIF: %v", err)
@@ -0,0 +1,67 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package assemblers
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/pkg/build/types"
+	"github.com/sylabs/singularity/pkg/image"
+)
+
+func TestAssembleBlockSize(t *testing.T) {
+	mksquashfs, err := exec.LookPath("mksquashfs")
+	if err != nil {
+		t.Skipf("mksquashfs not found")
+	}
+
+	dir, err := ioutil.TempDir("", "assemble-blocksize-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b, err := types.NewBundle(filepath.Join(dir, "bundle"), dir)
+	if err != nil {
+		t.Fatalf("unable to make bundle: %s", err)
+	}
+	defer b.Remove()
+
+	b.Recipe = types.Definition{Raw: []byte("Bootstrap: scratch\n")}
+	b.Opts.BlockSize = 64 << 10
+	if err := ioutil.WriteFile(filepath.Join(b.RootfsPath, "file"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "image.sif")
+	a := &SIFAssembler{MksquashfsPath: mksquashfs}
+	if err := a.Assemble(b, path); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	fimg, err := sif.LoadContainer(path, true)
+	if err != nil {
+		t.Fatalf("while loading SIF: %s", err)
+	}
+	defer fimg.UnloadContainer()
+
+	part, _, err := fimg.GetPartPrimSys()
+	if err != nil {
+		t.Fatalf("while getting primary partition: %s", err)
+	}
+	blockSize, err := image.GetSquashfsBlockSize(part.GetData(&fimg))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if blockSize != b.Opts.BlockSize {
+		t.Errorf("got block size %d, want %d", blockSize, b.Opts.BlockSize)
+	}
+}
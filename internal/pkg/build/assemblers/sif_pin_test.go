@@ -0,0 +1,204 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package assemblers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+// createTestSIF creates a SIF image at path holding a definition, with a
+// random ID.
+func createTestSIF(t *testing.T, path string) {
+	in := sif.DescriptorInput{
+		Datatype: sif.DataDeffile,
+		Groupid:  sif.DescrDefaultGroup,
+		Link:     sif.DescrUnusedLink,
+		Data:     []byte("Bootstrap: scratch\n"),
+	}
+	in.Size = int64(binary.Size(in.Data))
+
+	cinfo := sif.CreateInfo{
+		Pathname:   path,
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []sif.DescriptorInput{in},
+	}
+	if _, err := sif.CreateContainer(cinfo); err != nil {
+		t.Fatalf("while creating SIF: %s", err)
+	}
+}
+
+func TestPinSIF(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pin-sif-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	date := time.Date(2020, time.October, 1, 12, 0, 0, 0, time.UTC)
+
+	var images [][]byte
+	for _, name := range []string{"first.sif", "second.sif"} {
+		path := filepath.Join(dir, name)
+		createTestSIF(t, path)
+
+		if err := pinSIF(path, date); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		fimg, err := sif.LoadContainer(path, true)
+		if err != nil {
+			t.Fatalf("while loading SIF: %s", err)
+		}
+		if fimg.Header.Ctime != date.Unix() || fimg.Header.Mtime != date.Unix() {
+			t.Errorf("got header times %d/%d, want %d", fimg.Header.Ctime, fimg.Header.Mtime, date.Unix())
+		}
+		if uuid.Equal(fimg.Header.ID, uuid.Nil) {
+			t.Errorf("image ID not set")
+		}
+		for _, d := range fimg.DescrArr {
+			if !d.Used {
+				continue
+			}
+			if d.Ctime != date.Unix() || d.Mtime != date.Unix() || d.UID != 0 || d.Gid != 0 {
+				t.Errorf("descriptor %d not pinned: %+v", d.ID, d)
+			}
+		}
+		fimg.UnloadContainer()
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		images = append(images, b)
+	}
+
+	if !bytes.Equal(images[0], images[1]) {
+		t.Errorf("pinned images differ")
+	}
+}
+
+// reproducibleMksquashfs returns the path of mksquashfs, the test is
+// skipped when it's not found or older than 4.4, which introduced the
+// reproducible options.
+func reproducibleMksquashfs(t *testing.T) string {
+	path, err := exec.LookPath("mksquashfs")
+	if err != nil {
+		t.Skipf("mksquashfs not found")
+	}
+	out, _ := exec.Command(path, "-version").CombinedOutput()
+	m := regexp.MustCompile(`version (\d+)\.(\d+)`).FindSubmatch(out)
+	if m == nil {
+		t.Skipf("unknown mksquashfs version: %s", out)
+	}
+	major, _ := strconv.Atoi(string(m[1]))
+	minor, _ := strconv.Atoi(string(m[2]))
+	if major < 4 || (major == 4 && minor < 4) {
+		t.Skipf("mksquashfs %d.%d doesn't support reproducible builds", major, minor)
+	}
+	return path
+}
+
+// partitionDigest returns the digest of the primary partition of the SIF
+// image at path.
+func partitionDigest(t *testing.T, path string) string {
+	fimg, err := sif.LoadContainer(path, true)
+	if err != nil {
+		t.Fatalf("while loading SIF: %s", err)
+	}
+	defer fimg.UnloadContainer()
+
+	part, _, err := fimg.GetPartPrimSys()
+	if err != nil {
+		t.Fatalf("while getting primary partition: %s", err)
+	}
+	fs := filepath.Join(filepath.Dir(path), filepath.Base(path)+".squashfs")
+	if err := ioutil.WriteFile(fs, part.GetData(&fimg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := squashfsDigest(fs)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return digest
+}
+
+func TestAssembleReproducible(t *testing.T) {
+	mksquashfs := reproducibleMksquashfs(t)
+
+	dir, err := ioutil.TempDir("", "assemble-reproducible-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	date := time.Date(2020, time.October, 1, 12, 0, 0, 0, time.UTC)
+	a := &SIFAssembler{MksquashfsPath: mksquashfs}
+
+	var images [][]byte
+	var digests []string
+	for i, name := range []string{"first", "second"} {
+		b, err := types.NewBundle(filepath.Join(dir, name), dir)
+		if err != nil {
+			t.Fatalf("unable to make bundle: %s", err)
+		}
+		defer b.Remove()
+
+		b.Recipe = types.Definition{Raw: []byte("Bootstrap: scratch\n")}
+		b.Opts.Reproducible = true
+		b.Opts.SourceDate = date
+
+		// the files are created in a different order, with different
+		// modification times, for each build
+		files := []string{"a", "b", "c"}
+		if i == 1 {
+			files = []string{"c", "b", "a"}
+		}
+		for _, f := range files {
+			path := filepath.Join(b.RootfsPath, f)
+			if err := ioutil.WriteFile(path, []byte(f), 0644); err != nil {
+				t.Fatal(err)
+			}
+			mtime := time.Now().Add(time.Duration(i) * time.Hour)
+			if err := os.Chtimes(path, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		image := filepath.Join(dir, name+".sif")
+		if err := a.Assemble(b, image); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		content, err := ioutil.ReadFile(image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		images = append(images, content)
+		digests = append(digests, partitionDigest(t, image))
+	}
+
+	if digests[0] != digests[1] {
+		t.Errorf("root filesystem digests differ: %s and %s", digests[0], digests[1])
+	}
+	if !bytes.Equal(images[0], images[1]) {
+		t.Errorf("reproducible images differ")
+	}
+}
@@ -14,7 +14,9 @@ import (
 	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
 	"github.com/sylabs/singularity/pkg/util/fs/proc"
@@ -23,6 +25,7 @@ import (
 	"github.com/sylabs/singularity/internal/pkg/build/apps"
 	"github.com/sylabs/singularity/internal/pkg/build/assemblers"
 	"github.com/sylabs/singularity/internal/pkg/build/sources"
+	"github.com/sylabs/singularity/internal/pkg/cache"
 	"github.com/sylabs/singularity/internal/pkg/util/fs/squashfs"
 	"github.com/sylabs/singularity/internal/pkg/util/uri"
 	"github.com/sylabs/singularity/pkg/build/types"
@@ -41,6 +44,23 @@ import (
 type Build struct {
 	// stages of the build
 	stages []stage
+	// progress delivers the progress events, if any.
+	progress *types.ProgressDispatcher
+	// state records the phases completed by the last stage of a
+	// sandbox build, nil for other formats.
+	state *State
+	// cleanOnce runs the clean up once, on termination signal or on
+	// build return, whichever comes first.
+	cleanOnce sync.Once
+	// cleanMu guards the fields read by the clean up, which can run
+	// on termination signal while the build sets them.
+	cleanMu sync.Mutex
+	// tmpCache is the throwaway cache used by the stages built without
+	// cache, if any.
+	tmpCache *cache.Handle
+	// secretsDir is the directory of the secrets staged for the %post
+	// sections, if any.
+	secretsDir string
 	// Conf contains cross stage build configuration.
 	Conf Config
 }
@@ -74,9 +94,10 @@ func New(defs []types.Definition, conf Config) (*Build, error) {
 }
 
 func newBuild(defs []types.Definition, conf Config) (*Build, error) {
+	start := time.Now()
 	sandboxCopy := false
-	oldumask := syscall.Umask(0002)
-	defer syscall.Umask(oldumask)
+	oldumask := umask(0002)
+	defer umask(oldumask)
 
 	dest, err := fs.Abs(conf.Dest)
 	if err != nil {
@@ -89,10 +110,43 @@ func newBuild(defs []types.Definition, conf Config) (*Build, error) {
 		conf.Format = "sandbox"
 	}
 
-	b := &Build{
-		Conf: conf,
+	if conf.Opts.UpdateBase && conf.Opts.Update && !conf.Opts.Force {
+		return nil, fmt.Errorf("the base image can't be updated when building into an existing container, use --force to rebuild it")
 	}
 
+	if conf.Opts.Reproducible && conf.Opts.EncryptionKeyInfo != nil {
+		return nil, fmt.Errorf("encrypted images can't be built reproducibly")
+	}
+
+	if err := setOSVersion(conf.Opts.OSVersion, defs); err != nil {
+		return nil, err
+	}
+
+	b := &Build{}
+	if conf.Format == "sandbox" {
+		b.state = newState(defs)
+		if conf.Opts.Update && !conf.Opts.Force {
+			state, err := ReadState(conf.Dest)
+			if err != nil {
+				return nil, fmt.Errorf("while reading build state of %s: %v", conf.Dest, err)
+			}
+			if state != nil {
+				if reason := state.staleReason(b.state); reason != "" {
+					sylog.Warningf("The interrupted build in %s %s, rebuilding it from scratch", conf.Dest, reason)
+					conf.Opts.Force = true
+				} else {
+					sylog.Infof("Resuming the interrupted build in %s, completed phases: %s", conf.Dest, state)
+					b.state = state
+				}
+			}
+		}
+	}
+	if conf.Opts.Progress != nil {
+		b.progress = types.NewProgressDispatcher(conf.Opts.Progress)
+		conf.Opts.Progress = b.progress.Emit
+	}
+	b.Conf = conf
+
 	// look if there is mount options set which could conflict
 	// with the build process like nodev and noexec
 	entries, err := proc.GetMountInfoEntry("/proc/self/mountinfo")
@@ -129,6 +183,12 @@ func newBuild(defs []types.Definition, conf Config) (*Build, error) {
 		}
 		s.name = d.Header["stage"]
 		s.b.Recipe = d
+		s.shellOpts, err = shellOptions(conf.Opts.ShellOptions, d.Header)
+		if err != nil {
+			return nil, err
+		}
+		s.postLines = strings.Count(d.BuildData.Post.Script, "\n") + 1
+		s.start = start
 
 		if conf.Format == "sandbox" && lastStageIndex == i {
 			// rootfs path changed during bundle creation it means that chown
@@ -170,6 +230,11 @@ func newBuild(defs []types.Definition, conf Config) (*Build, error) {
 		}
 
 		s.b.Opts = conf.Opts
+		if conf.Opts.UpdateBase {
+			// fetch the base image from its source, a cached copy
+			// could be outdated
+			s.b.Opts.NoCache = true
+		}
 		// dont need to get cp if we're skipping bootstrap
 		if !conf.Opts.Update || conf.Opts.Force {
 			if c, err := conveyorPacker(d); err == nil {
@@ -303,8 +368,45 @@ func ensureGzipComp(tmpdir, mksquashfsPath string) (bool, error) {
 	return false, fmt.Errorf("could not build squashfs with required gzip compression")
 }
 
+// useTemporaryCache makes the stages built without cache, or with the cache
+// disabled by the user, go through a throwaway cache. Their bootstrap pulls
+// then never read nor write the persistent cache, and concurrent builds
+// don't race on it.
+func (b *Build) useTemporaryCache() error {
+	for _, s := range b.stages {
+		imgCache := s.b.Opts.ImgCache
+		if imgCache == nil || !(s.b.Opts.NoCache || imgCache.IsDisabled()) {
+			continue
+		}
+		if b.tmpCache == nil {
+			tmpCache, err := cache.NewTemporary(b.Conf.Opts.TmpDir)
+			if err != nil {
+				return fmt.Errorf("while creating temporary image cache: %v", err)
+			}
+			sylog.Debugf("Using a temporary image cache for builds without cache")
+			b.tmpCache = tmpCache
+		}
+		s.b.Opts.NoCache = true
+		s.b.Opts.ImgCache = b.tmpCache
+	}
+	return nil
+}
+
 // cleanUp removes remnants of build from file system unless NoCleanUp is specified.
-func (b Build) cleanUp() {
+// The throwaway cache, if any, is always removed.
+func (b *Build) cleanUp() {
+	if b.tmpCache != nil {
+		if err := b.tmpCache.Remove(); err != nil {
+			sylog.Errorf("Could not remove temporary image cache: %v", err)
+		}
+	}
+	// secrets are removed even without clean up
+	if b.secretsDir != "" {
+		if err := os.RemoveAll(b.secretsDir); err != nil {
+			sylog.Errorf("Could not remove build secrets: %v", err)
+		}
+	}
+
 	if b.Conf.NoCleanUp {
 		var bundlePaths []string
 		for _, s := range b.stages {
@@ -323,22 +425,83 @@ func (b Build) cleanUp() {
 	}
 }
 
+// saveInterrupted moves the root filesystem of an interrupted sandbox build
+// to the build destination, so the build can be resumed with --update. The
+// root filesystem is discarded if the bootstrap wasn't completed.
+func (b *Build) saveInterrupted() {
+	if b.state == nil || b.Conf.NoCleanUp {
+		return
+	}
+	last := b.stages[len(b.stages)-1]
+
+	// read the state written by the build rather than the one being
+	// updated concurrently
+	state, err := ReadState(last.b.RootfsPath)
+	if err != nil || !state.Done(types.PhaseBootstrap) {
+		return
+	}
+	if a, ok := last.a.(*assemblers.SandboxAssembler); ok && a.Copy {
+		sylog.Warningf("Build interrupted, the partial sandbox can't be saved in %s", b.Conf.Dest)
+		return
+	}
+
+	os.RemoveAll(b.Conf.Dest)
+	if err := os.Rename(last.b.RootfsPath, b.Conf.Dest); err != nil {
+		sylog.Errorf("Could not save the interrupted build in %s: %v", b.Conf.Dest, err)
+		return
+	}
+	sylog.Warningf("Build interrupted, the partial sandbox is saved in %s (completed phases: %s), "+
+		"run the same build with --update to resume it", b.Conf.Dest, state)
+}
+
+// finish cleans up the build once, the build returned or was interrupted
+// by a termination signal, an interrupted sandbox build is saved first. A
+// concurrent call waits for the first one to complete.
+func (b *Build) finish(interrupted bool) {
+	b.cleanOnce.Do(func() {
+		b.cleanMu.Lock()
+		defer b.cleanMu.Unlock()
+
+		if interrupted {
+			b.saveInterrupted()
+		}
+		b.cleanUp()
+	})
+}
+
 // Full runs a standard build from start to finish.
 func (b *Build) Full(ctx context.Context) error {
 	sylog.Infof("Starting build...")
 
 	// monitor build for termination signal and clean up
 	c := make(chan os.Signal, 1)
+	done := make(chan struct{})
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
-		<-c
-		b.cleanUp()
-		os.Exit(1)
+		select {
+		case <-c:
+			b.finish(true)
+			os.Exit(1)
+		case <-done:
+		}
 	}()
 	// clean up build normally
-	defer b.cleanUp()
+	defer func() {
+		signal.Stop(c)
+		close(done)
+		b.finish(false)
+	}()
+	// deliver pending progress events before returning
+	defer b.progress.Close()
+
+	b.cleanMu.Lock()
+	err := b.useTemporaryCache()
+	b.cleanMu.Unlock()
+	if err != nil {
+		return err
+	}
 
-	oldumask := syscall.Umask(0002)
+	oldumask := umask(0002)
 
 	// generate the default configuration
 	config, err := singularityconf.Parse("")
@@ -357,8 +520,35 @@ func (b *Build) Full(ctx context.Context) error {
 	}
 	configData := buffer.Bytes()
 
+	if len(b.Conf.Opts.Secrets) > 0 {
+		dir, err := stageSecrets(b.Conf.Opts.Secrets, b.Conf.Opts.TmpDir, b.Conf.Opts.SecretsOnDisk)
+		if err != nil {
+			return err
+		}
+		b.cleanMu.Lock()
+		b.secretsDir = dir
+		b.cleanMu.Unlock()
+	}
+
 	// build each stage one after the other
 	for i, stage := range b.stages {
+		// the phases completed by the last stage of sandbox builds are
+		// recorded, an interrupted build is then resumed with --update
+		tracked := b.state != nil && i == len(b.stages)-1
+		complete := func(phase string) error {
+			if !tracked {
+				return nil
+			}
+			return b.state.complete(phase, stage.b.RootfsPath)
+		}
+		skip := func(phase string) bool {
+			if tracked && b.state.Done(phase) {
+				sylog.Infof("Skipping %%%s, completed by the interrupted build", phase)
+				return true
+			}
+			return false
+		}
+
 		if err := stage.runSectionScript("pre", stage.b.Recipe.BuildData.Pre); err != nil {
 			return err
 		}
@@ -382,6 +572,7 @@ func (b *Build) Full(ctx context.Context) error {
 			if b.Conf.Opts.ImgCache == nil {
 				return fmt.Errorf("undefined image cache")
 			}
+			stage.reportPhase(types.PhaseBootstrap)
 			if err := stage.c.Get(ctx, stage.b); err != nil {
 				return fmt.Errorf("conveyor failed to get: %v", err)
 			}
@@ -391,6 +582,9 @@ func (b *Build) Full(ctx context.Context) error {
 				return fmt.Errorf("packer failed to pack: %v", err)
 			}
 		}
+		if err := complete(types.PhaseBootstrap); err != nil {
+			return err
+		}
 
 		// create apps in bundle
 		a := apps.New()
@@ -405,23 +599,38 @@ func (b *Build) Full(ctx context.Context) error {
 		}
 		stage.b.Recipe.BuildData.Post.Script += appPost
 
+		skipFiles := skip(types.PhaseFiles)
+
 		// copy potential files from previous stage
-		if stage.b.RunSection("files") {
+		if stage.b.RunSection("files") && !skipFiles {
 			if err := stage.copyFilesFrom(b); err != nil {
 				return fmt.Errorf("unable to copy files from stage to container fs: %v", err)
 			}
 		}
 
-		if err := stage.runSectionScript("setup", stage.b.Recipe.BuildData.Setup); err != nil {
-			return err
+		if !skip(types.PhaseSetup) {
+			if err := stage.runSectionScript("setup", stage.b.Recipe.BuildData.Setup); err != nil {
+				return err
+			}
+			if err := complete(types.PhaseSetup); err != nil {
+				return err
+			}
 		}
 
 		// copy files from host
-		if stage.b.RunSection("files") {
+		if stage.b.RunSection("files") && !skipFiles {
+			if len(stage.b.Recipe.BuildData.Files) > 0 {
+				stage.reportPhase(types.PhaseFiles)
+			}
 			if err := stage.copyFiles(); err != nil {
 				return fmt.Errorf("unable to copy files from host to container fs: %v", err)
 			}
 		}
+		if !skipFiles {
+			if err := complete(types.PhaseFiles); err != nil {
+				return err
+			}
+		}
 
 		// create stage file for /etc/resolv.conf and /etc/hosts
 		sessionResolv, err := createStageFile("/etc/resolv.conf", stage.b, "Name resolution could fail")
@@ -444,9 +653,12 @@ func (b *Build) Full(ctx context.Context) error {
 		}
 		defer os.Remove(configFile)
 
-		if stage.b.Recipe.BuildData.Post.Script != "" {
-			if err := stage.runPostScript(configFile, sessionResolv, sessionHosts); err != nil {
-				return fmt.Errorf("while running engine: %v", err)
+		if stage.b.Recipe.BuildData.Post.Script != "" && !skip(types.PhasePost) {
+			if err := stage.runPostScript(configFile, sessionResolv, sessionHosts, b.secretsDir); err != nil {
+				return err
+			}
+			if err := complete(types.PhasePost); err != nil {
+				return err
 			}
 		}
 
@@ -456,16 +668,25 @@ func (b *Build) Full(ctx context.Context) error {
 		}
 
 		if err := stage.runTestScript(configFile, sessionResolv, sessionHosts); err != nil {
-			return fmt.Errorf("failed to execute %%test script: %v", err)
+			return err
 		}
 	}
 
-	syscall.Umask(oldumask)
+	umask(oldumask)
 
 	sylog.Debugf("Calling assembler")
-	if err := b.stages[len(b.stages)-1].Assemble(b.Conf.Dest); err != nil {
+	last := b.stages[len(b.stages)-1]
+	if b.state != nil {
+		// the build is complete, there is nothing left to resume
+		if err := os.Remove(filepath.Join(last.b.RootfsPath, StateFile)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("while removing build state: %v", err)
+		}
+	}
+	last.reportPhase(types.PhaseAssemble)
+	if err := last.Assemble(b.Conf.Dest); err != nil {
 		return err
 	}
+	last.b.ReportProgress(types.ProgressEvent{Type: types.PhaseEvent, Phase: types.PhaseComplete})
 
 	sylog.Verbosef("Build complete: %s", b.Conf.Dest)
 	return nil
@@ -498,8 +719,9 @@ func makeDef(spec string) (types.Definition, error) {
 	return d, nil
 }
 
-// MakeAllDefs gets a definition object from a spec
-func MakeAllDefs(spec string) ([]types.Definition, error) {
+// MakeAllDefs gets a definition object from a spec, the build arguments
+// buildArgs are applied to a definition file with RenderDefinition.
+func MakeAllDefs(spec string, buildArgs map[string]string) ([]types.Definition, error) {
 	if ok, err := uri.IsValid(spec); ok && err == nil {
 		// URI passed as spec
 		d, err := types.NewDefinitionFromURI(spec)
@@ -520,7 +742,12 @@ func MakeAllDefs(spec string) ([]types.Definition, error) {
 	}
 	defer defFile.Close()
 
-	d, err := parser.All(defFile)
+	r, err := RenderDefinition(defFile, filepath.Base(spec), buildArgs)
+	if err != nil {
+		return nil, fmt.Errorf("while parsing definition: %s: %v", spec, err)
+	}
+
+	d, err := parser.All(r)
 	if err != nil {
 		return nil, fmt.Errorf("while parsing definition: %s: %v", spec, err)
 	}
@@ -0,0 +1,133 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+func TestUseTemporaryCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "build-cache-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	imgCache, err := cache.New(cache.Config{ParentDir: dir})
+	if err != nil {
+		t.Fatalf("while creating image cache: %s", err)
+	}
+	disabledCache, err := cache.New(cache.Config{Disable: true})
+	if err != nil {
+		t.Fatalf("while creating disabled image cache: %s", err)
+	}
+
+	tests := []struct {
+		name      string
+		opts      types.Options
+		temporary bool
+	}{
+		{
+			name: "Cache",
+			opts: types.Options{ImgCache: imgCache},
+		},
+		{
+			name:      "NoCache",
+			opts:      types.Options{ImgCache: imgCache, NoCache: true},
+			temporary: true,
+		},
+		{
+			name:      "DisabledCache",
+			opts:      types.Options{ImgCache: disabledCache},
+			temporary: true,
+		},
+	}
+
+	b := &Build{Conf: Config{NoCleanUp: true, Opts: types.Options{TmpDir: dir}}}
+	for _, tt := range tests {
+		b.stages = append(b.stages, stage{name: tt.name, b: &types.Bundle{Opts: tt.opts}})
+	}
+	if err := b.useTemporaryCache(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for i, tt := range tests {
+		opts := b.stages[i].b.Opts
+		if tt.temporary {
+			if opts.ImgCache != b.tmpCache || !opts.ImgCache.IsTemporary() {
+				t.Errorf("%s: stage doesn't use the temporary cache", tt.name)
+			}
+			if !opts.NoCache {
+				t.Errorf("%s: stage uses the cached images", tt.name)
+			}
+		} else if opts.ImgCache != imgCache {
+			t.Errorf("%s: stage doesn't use the persistent cache", tt.name)
+		}
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the persistent cache and the temporary one
+	if len(entries) != 2 {
+		t.Errorf("got %d entries in %s, want 2", len(entries), dir)
+	}
+
+	b.cleanUp()
+	entries, err = ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != cache.SubDirName {
+		t.Errorf("temporary cache not removed")
+	}
+}
+
+func TestFinishOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "build-finish-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	secrets := filepath.Join(dir, "secrets")
+	if err := os.Mkdir(secrets, 0700); err != nil {
+		t.Fatal(err)
+	}
+	b := &Build{Conf: Config{NoCleanUp: true}, secretsDir: secrets}
+
+	// the build returns while a termination signal is handled
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(interrupted bool) {
+			defer wg.Done()
+			b.finish(interrupted)
+		}(i%2 == 0)
+	}
+	wg.Wait()
+
+	if _, err := os.Stat(secrets); !os.IsNotExist(err) {
+		t.Fatalf("secrets not removed: %v", err)
+	}
+
+	// later calls don't clean up again
+	if err := os.Mkdir(secrets, 0700); err != nil {
+		t.Fatal(err)
+	}
+	b.finish(true)
+	if _, err := os.Stat(secrets); err != nil {
+		t.Errorf("clean up ran twice: %s", err)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// buildArgName matches the names of build arguments, they are referenced as
+// {{ .NAME }} in definition files.
+var buildArgName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ParseBuildArgs parses the build arguments values in the NAME=VALUE format
+// and checks that their names are unique.
+func ParseBuildArgs(values []string) (map[string]string, error) {
+	args := make(map[string]string, len(values))
+
+	for _, v := range values {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("bad build argument %q, the format is NAME=VALUE", v)
+		}
+		if !buildArgName.MatchString(kv[0]) {
+			return nil, fmt.Errorf("build argument %q: bad name %q, it must only contain letters, digits and underscores", v, kv[0])
+		}
+		if _, ok := args[kv[0]]; ok {
+			return nil, fmt.Errorf("duplicate build argument %s", kv[0])
+		}
+		args[kv[0]] = kv[1]
+	}
+	return args, nil
+}
+
+// buildArgsHeader matches the BuildArgs header line of a definition file
+// declaring the build arguments it accepts.
+var buildArgsHeader = regexp.MustCompile(`(?i)^\s*buildargs\s*:(.*)$`)
+
+// bootstrapHeader matches the first header line of a definition file stage.
+var bootstrapHeader = regexp.MustCompile(`(?i)^\s*bootstrap\s*:`)
+
+// declaredBuildArgs returns the build arguments declared by the BuildArgs
+// headers of the definition file def, with their default values. The
+// header lists the arguments as NAME or NAME=DEFAULT separated by spaces,
+// a NAME without default is empty. The boolean is false if there is no
+// BuildArgs header.
+func declaredBuildArgs(def []byte) (map[string]string, bool, error) {
+	var declared map[string]string
+
+	inHeader := true
+	for _, line := range strings.Split(string(def), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "%") {
+			inHeader = false
+			continue
+		}
+		if bootstrapHeader.MatchString(line) {
+			inHeader = true
+			continue
+		}
+		m := buildArgsHeader.FindStringSubmatch(line)
+		if !inHeader || m == nil {
+			continue
+		}
+		if declared == nil {
+			declared = make(map[string]string)
+		}
+		for _, v := range strings.Fields(strings.Split(m[1], "#")[0]) {
+			kv := strings.SplitN(v, "=", 2)
+			if !buildArgName.MatchString(kv[0]) {
+				return nil, false, fmt.Errorf("BuildArgs header: bad build argument name %q", kv[0])
+			}
+			if len(kv) == 2 {
+				declared[kv[0]] = kv[1]
+			} else {
+				declared[kv[0]] = ""
+			}
+		}
+	}
+	return declared, declared != nil, nil
+}
+
+// RenderDefinition applies the build arguments args to the definition file
+// read from r and returns the resulting definition file. The definition
+// file is rendered as a text/template only when build arguments are given
+// or when it declares the build arguments it accepts in a BuildArgs header,
+// it is returned untouched otherwise. {{ .NAME }} is replaced by the value
+// of the build argument NAME, and {{ if .NAME }} ... {{ end }} guards keep
+// the enclosed lines, whole sections included, only when NAME is set to a
+// non empty value. Declared build arguments take their default value when
+// not given, a build argument neither given nor declared is an error, as
+// is a given build argument which isn't declared by a BuildArgs header. A
+// literal {{ is written {{"{{"}}.
+func RenderDefinition(r io.Reader, name string, args map[string]string) (io.Reader, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("while reading definition file: %s", err)
+	}
+
+	declared, ok, err := declaredBuildArgs(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	// not opted in, don't read the definition file as a template
+	if !ok && len(args) == 0 {
+		return bytes.NewReader(b), nil
+	}
+
+	values := make(map[string]string, len(declared)+len(args))
+	for k, v := range declared {
+		values[k] = v
+	}
+	for k, v := range args {
+		if _, found := declared[k]; ok && !found {
+			return nil, fmt.Errorf("%s: build argument %s is not declared in the BuildArgs header", name, k)
+		}
+		values[k] = v
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("while parsing definition file template: %s", err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, values); err != nil {
+		return nil, fmt.Errorf("while applying build arguments: %s", err)
+	}
+	return buf, nil
+}
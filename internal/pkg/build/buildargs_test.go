@@ -0,0 +1,198 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity/pkg/build/types/parser"
+)
+
+func TestParseBuildArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "None", values: []string{}, want: map[string]string{}},
+		{name: "Several", values: []string{"GPU=1", "VERSION=1.2=rc"}, want: map[string]string{"GPU": "1", "VERSION": "1.2=rc"}},
+		{name: "Empty", values: []string{"GPU="}, want: map[string]string{"GPU": ""}},
+		{name: "NoValue", values: []string{"GPU"}, wantErr: true},
+		{name: "BadName", values: []string{"CUDA-VERSION=11"}, wantErr: true},
+		{name: "Duplicate", values: []string{"GPU=1", "GPU=0"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseBuildArgs(tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+const variantDef = `Bootstrap: docker
+From: {{ .BASE }}
+BuildArgs: GPU BASE=alpine:3.12
+
+%post
+    echo common
+{{ if .GPU }}
+    echo gpu {{ .GPU }}
+{{ else }}
+    echo cpu
+{{ end }}
+{{ if .GPU }}
+%environment
+    export GPU=1
+{{ end }}
+`
+
+func TestRenderDefinition(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    map[string]string
+		from    string
+		post    []string
+		notPost []string
+		env     bool
+	}{
+		{
+			name:    "CPU",
+			from:    "alpine:3.12",
+			post:    []string{"echo common", "echo cpu"},
+			notPost: []string{"echo gpu"},
+		},
+		{
+			name:    "GPU",
+			args:    map[string]string{"GPU": "cuda", "BASE": "nvidia/cuda:11.0-base"},
+			from:    "nvidia/cuda:11.0-base",
+			post:    []string{"echo common", "echo gpu cuda"},
+			notPost: []string{"echo cpu"},
+			env:     true,
+		},
+		{
+			name:    "EmptyGPU",
+			args:    map[string]string{"GPU": ""},
+			from:    "alpine:3.12",
+			post:    []string{"echo cpu"},
+			notPost: []string{"echo gpu"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := RenderDefinition(strings.NewReader(variantDef), "variant.def", tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			d, err := parser.ParseDefinitionFile(r)
+			if err != nil {
+				t.Fatalf("unexpected error while parsing rendered definition: %s", err)
+			}
+			if d.Header["from"] != tt.from {
+				t.Errorf("got from %q, want %q", d.Header["from"], tt.from)
+			}
+			for _, s := range tt.post {
+				if !strings.Contains(d.BuildData.Post.Script, s) {
+					t.Errorf("%%post section doesn't contain %q: %q", s, d.BuildData.Post.Script)
+				}
+			}
+			for _, s := range tt.notPost {
+				if strings.Contains(d.BuildData.Post.Script, s) {
+					t.Errorf("%%post section contains %q: %q", s, d.BuildData.Post.Script)
+				}
+			}
+			if got := d.ImageData.Environment.Script != ""; got != tt.env {
+				t.Errorf("got %%environment section %t, want %t", got, tt.env)
+			}
+		})
+	}
+}
+
+func TestRenderDefinitionMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		def  string
+	}{
+		{name: "NoEnd", def: "Bootstrap: docker\nFrom: alpine\n%post\n{{ if .GPU }}\n    echo gpu\n"},
+		{name: "StrayEnd", def: "Bootstrap: docker\nFrom: alpine\n%post\n    echo gpu\n{{ end }}\n"},
+		{name: "Unclosed", def: "Bootstrap: docker\nFrom: alpine\n%post\n{{ if .GPU \n    echo gpu\n{{ end }}\n"},
+		{name: "NoCondition", def: "Bootstrap: docker\nFrom: alpine\n%post\n{{ if }}\n    echo gpu\n{{ end }}\n"},
+		{name: "Field", def: "Bootstrap: docker\nFrom: alpine\n%post\n{{ if .GPU.Version }}\n    echo gpu\n{{ end }}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := RenderDefinition(strings.NewReader(tt.def), "malformed.def", map[string]string{"GPU": "1"})
+			if err == nil {
+				t.Fatalf("unexpected success with a malformed conditional")
+			}
+			if !strings.Contains(err.Error(), "malformed.def") {
+				t.Errorf("error %q doesn't locate the definition file", err)
+			}
+		})
+	}
+
+	// a definition file is left untouched without build arguments nor
+	// BuildArgs header
+	def := "Bootstrap: docker\nFrom: alpine\n%post\n    echo '{{ .GPU }}' | jq .\n"
+	r, err := RenderDefinition(strings.NewReader(def), "plain.def", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(b) != def {
+		t.Errorf("got %q, want %q", b, def)
+	}
+}
+
+func TestRenderDefinitionArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		def     string
+		args    map[string]string
+		wantErr bool
+	}{
+		{name: "Given", def: "Bootstrap: docker\nFrom: {{ .BASE }}\n", args: map[string]string{"BASE": "alpine"}},
+		{name: "Missing", def: "Bootstrap: docker\nFrom: {{ .BASE }}\n", args: map[string]string{"GPU": "1"}, wantErr: true},
+		{name: "Default", def: "Bootstrap: docker\nFrom: {{ .BASE }}\nBuildArgs: BASE=alpine\n"},
+		{name: "Override", def: "Bootstrap: docker\nFrom: {{ .BASE }}\nBuildArgs: BASE=debian\n", args: map[string]string{"BASE": "alpine"}},
+		{name: "Undeclared", def: "Bootstrap: docker\nFrom: {{ .BASE }}\nBuildArgs: BASE=alpine\n", args: map[string]string{"BAS": "alpine"}, wantErr: true},
+		{name: "UndeclaredReference", def: "Bootstrap: docker\nFrom: {{ .BASE }}\nBuildArgs: GPU\n", wantErr: true},
+		{name: "BadHeader", def: "Bootstrap: docker\nFrom: alpine\nBuildArgs: CUDA-VERSION\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := RenderDefinition(strings.NewReader(tt.def), "args.def", tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			d, err := parser.ParseDefinitionFile(r)
+			if err != nil {
+				t.Fatalf("unexpected error while parsing rendered definition: %s", err)
+			}
+			if d.Header["from"] != "alpine" {
+				t.Errorf("got from %q, want alpine", d.Header["from"])
+			}
+		})
+	}
+}
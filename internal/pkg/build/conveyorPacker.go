@@ -37,6 +37,8 @@ func conveyorPacker(def types.Definition) (ConveyorPacker, error) {
 		return &sources.LibraryConveyorPacker{}, nil
 	case "oras":
 		return &sources.OrasConveyorPacker{}, nil
+	case "s3", "gs":
+		return &sources.BucketConveyorPacker{}, nil
 	case "shub":
 		return &sources.ShubConveyorPacker{}, nil
 	case "docker", "docker-archive", "docker-daemon", "oci", "oci-archive":
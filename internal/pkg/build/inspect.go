@@ -0,0 +1,84 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/build/apps"
+	"github.com/sylabs/singularity/internal/pkg/build/sources"
+	"github.com/sylabs/singularity/pkg/build/types"
+	"github.com/sylabs/singularity/pkg/inspect"
+)
+
+// environmentFile is the environment file holding the %environment section.
+const environmentFile = "/.singularity.d/env/90-environment.sh"
+
+// DefinitionMetadata returns the inspect metadata of the image which would
+// be built from the stages defs of a definition file, without building it.
+// The image is built from the last stage, the build date label and the
+// content added by the bootstrap agent (e.g. the environment and runscript
+// of a Docker image) are only known once the image is built.
+func DefinitionMetadata(defs []types.Definition) (*inspect.Metadata, error) {
+	if len(defs) == 0 {
+		return nil, fmt.Errorf("no definition stage found")
+	}
+	d := defs[len(defs)-1]
+
+	if _, err := shellOptions("", d.Header); err != nil {
+		return nil, err
+	}
+
+	metadata := inspect.NewMetadata()
+	attr := &metadata.Attributes
+
+	b := &types.Bundle{Recipe: d, Opts: types.Options{Sections: []string{"all"}}}
+	if err := addBuildLabels(attr.Labels, b); err != nil {
+		return nil, err
+	}
+	delete(attr.Labels, "org.label-schema.build-date")
+	// like in insertLabelsJSON, build labels are not overwritten
+	for k, v := range d.ImageData.Labels {
+		if _, ok := attr.Labels[k]; !ok {
+			attr.Labels[k] = v
+		}
+	}
+
+	env := sources.BaseEnvironment()
+	if d.ImageData.Environment.Script != "" {
+		env += "\n" + d.ImageData.Environment.Script + "\n"
+	}
+	attr.Environment[environmentFile] = strings.TrimRight(env, "\n")
+
+	if d.ImageData.Runscript.Script != "" {
+		shebang, script := handleShebangScript(d.ImageData.Runscript)
+		attr.Runscript = strings.TrimRight(shebang+"\n\n"+script, "\n")
+	}
+	if d.ImageData.Startscript.Script != "" {
+		shebang, script := handleShebangScript(d.ImageData.Startscript)
+		attr.Startscript = strings.TrimRight(shebang+"\n\n"+script, "\n")
+	}
+	if d.ImageData.Test.Script != "" {
+		attr.Test = strings.TrimRight("#!/bin/sh\n\n"+d.ImageData.Test.Script, "\n")
+	}
+	attr.Helpfile = strings.TrimRight(d.ImageData.Help.Script, "\n")
+	attr.Deffile = strings.TrimRight(string(d.Raw), "\n")
+
+	a := apps.New()
+	for k, v := range d.CustomData {
+		a.HandleSection(k, v)
+	}
+	for _, name := range d.AppOrder {
+		app, ok := a.Apps[name]
+		if !ok {
+			return nil, fmt.Errorf("no BuildApp record for app %s", name)
+		}
+		attr.Apps[name] = app.Attributes()
+	}
+
+	return metadata, nil
+}
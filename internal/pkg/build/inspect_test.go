@@ -0,0 +1,124 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/build/sources"
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/pkg/build/types/parser"
+	"github.com/sylabs/singularity/pkg/inspect"
+)
+
+const inspectDefinition = `Bootstrap: docker
+From: golang:1.13
+Stage: build
+
+%post
+    go build -o /hello hello.go
+
+Bootstrap: docker
+From: alpine:3.12
+Stage: final
+
+%files from build
+    /hello /bin/hello
+
+%labels
+    Maintainer jane
+    org.label-schema.schema-version 2.0
+
+%environment
+    export HELLO=world
+
+%runscript
+    exec /bin/hello "$@"
+
+%startscript
+#!/bin/bash
+    exec /bin/hello --daemon
+
+%test
+    /bin/hello --version
+
+%help
+    Says hello.
+
+%apprun greet
+    echo "hi $@"
+
+%applabels greet
+    Greeting yes
+
+%appenv greet
+    export GREETING=hi
+
+%apphelp greet
+    Greets.
+`
+
+func TestDefinitionMetadata(t *testing.T) {
+	defs, err := parser.All(strings.NewReader(inspectDefinition))
+	if err != nil {
+		t.Fatalf("unexpected error while parsing definition: %s", err)
+	}
+
+	metadata, err := DefinitionMetadata(defs)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := inspect.NewMetadata()
+	want.Attributes = inspect.Attributes{
+		Labels: map[string]string{
+			"Maintainer":                                           "jane",
+			"org.label-schema.schema-version":                      "1.0",
+			"org.label-schema.usage":                               "/.singularity.d/runscript.help",
+			"org.label-schema.usage.singularity.runscript.help":    "/.singularity.d/runscript.help",
+			"org.label-schema.usage.singularity.version":           buildcfg.PACKAGE_VERSION,
+			"org.label-schema.usage.singularity.deffile.bootstrap": "docker",
+			"org.label-schema.usage.singularity.deffile.from":      "alpine:3.12",
+			"org.label-schema.usage.singularity.deffile.stage":     "final",
+			"org.label-schema.build-arch":                          runtime.GOARCH,
+		},
+		Environment: map[string]string{
+			"/.singularity.d/env/90-environment.sh": sources.BaseEnvironment() + "\n    export HELLO=world",
+		},
+		Runscript:   "#!/bin/sh\n\n    exec /bin/hello \"$@\"",
+		Startscript: "#!/bin/bash\n\n    exec /bin/hello --daemon",
+		Test:        "#!/bin/sh\n\n    /bin/hello --version",
+		Helpfile:    "    Says hello.",
+		Deffile:     strings.TrimRight(inspectDefinition, "\n"),
+		Apps: map[string]*inspect.AppAttributes{
+			"greet": {
+				Environment: map[string]string{
+					"/scif/apps/greet/scif/env/90-environment.sh": "    export GREETING=hi",
+				},
+				Labels: map[string]string{
+					"Greeting":      "yes",
+					"SCIF_APP_NAME": "greet",
+				},
+				Runscript: "#!/bin/sh\n\n    echo \"hi $@\"",
+				Helpfile:  "    Greets.",
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(metadata, want) {
+		t.Errorf("got metadata %+v, want %+v", metadata.Attributes, want.Attributes)
+		for name, app := range metadata.Attributes.Apps {
+			t.Logf("app %s: %+v", name, app)
+		}
+	}
+
+	if _, err := DefinitionMetadata(nil); err == nil {
+		t.Errorf("unexpected success without definition")
+	}
+}
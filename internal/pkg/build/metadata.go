@@ -18,6 +18,7 @@ import (
 	"time"
 
 	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/util/fs/specialfiles"
 	"github.com/sylabs/singularity/pkg/build/types"
 	"github.com/sylabs/singularity/pkg/image"
 	"github.com/sylabs/singularity/pkg/inspect"
@@ -60,6 +61,12 @@ func (s *stage) insertMetadata() error {
 		return fmt.Errorf("while inserting test script: %v", err)
 	}
 
+	// record setuid, setgid and world-writable files, read back by
+	// the inspect command for the JSON inspect metadata
+	if err := insertSpecialFiles(s.b); err != nil {
+		return fmt.Errorf("while inserting special files: %v", err)
+	}
+
 	// insert JSON inspect metadata (must be the last call)
 	if err := insertJSONInspectMetadata(s.b); err != nil {
 		return fmt.Errorf("while inserting JSON inspect metadata: %v", err)
@@ -141,6 +148,8 @@ func insertStartScript(b *types.Bundle) error {
 	return nil
 }
 
+// insertTestScript inserts the %test section, the shell options only apply
+// to the test run at build time, not to 'singularity test'.
 func insertTestScript(b *types.Bundle) error {
 	if b.RunSection("test") && b.Recipe.ImageData.Test.Script != "" {
 		sylog.Infof("Adding testscript")
@@ -248,6 +257,29 @@ func insertLabelsJSON(b *types.Bundle) (err error) {
 	return err
 }
 
+// insertSpecialFiles writes the setuid, setgid and world-writable files
+// of the container to /.singularity.d/special-files.json, and warns when
+// the container holds any of them.
+func insertSpecialFiles(b *types.Bundle) error {
+	files, err := specialfiles.ScanDir(b.RootfsPath)
+	if err != nil {
+		return err
+	}
+
+	if files.SetuidCount > 0 || files.SetgidCount > 0 {
+		sylog.Warningf("Container holds %d setuid and %d setgid files, run 'singularity inspect --special-files' on the image to list them", files.SetuidCount, files.SetgidCount)
+	}
+	if files.WorldWritableCount > 0 {
+		sylog.Warningf("Container holds %d world-writable files and directories", files.WorldWritableCount)
+	}
+
+	data, err := json.MarshalIndent(files, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(b.RootfsPath, "/.singularity.d/special-files.json"), data, 0644)
+}
+
 func insertJSONInspectMetadata(b *types.Bundle) error {
 	metadata := new(inspect.Metadata)
 
@@ -301,6 +333,9 @@ func addBuildLabels(labels map[string]string, b *types.Bundle) error {
 
 	// build date and time, lots of time formatting
 	currentTime := time.Now()
+	if b.Opts.Reproducible {
+		currentTime = b.Opts.SourceDate.UTC()
+	}
 	year, month, day := currentTime.Date()
 	date := strconv.Itoa(day) + `_` + month.String() + `_` + strconv.Itoa(year)
 	hour, min, sec := currentTime.Clock()
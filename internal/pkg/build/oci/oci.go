@@ -14,6 +14,8 @@ import (
 	"strings"
 
 	"github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/oci/layout"
 	"github.com/containers/image/v5/signature"
 	"github.com/containers/image/v5/transports"
@@ -26,9 +28,17 @@ import (
 // ImageReference wraps containers/image ImageReference type
 type ImageReference struct {
 	source types.ImageReference
+	// digest is the hex encoded sha256 digest of the source manifest
+	digest string
 	types.ImageReference
 }
 
+// Digest returns the hex encoded sha256 digest of the manifest of the
+// source image, as returned by ImageSHA.
+func (t *ImageReference) Digest() string {
+	return t.digest
+}
+
 // ConvertReference converts a source reference into a cache.ImageReference to cache its blobs
 func ConvertReference(ctx context.Context, imgCache *cache.Handle, src types.ImageReference, sys *types.SystemContext) (types.ImageReference, error) {
 	if imgCache == nil {
@@ -54,6 +64,7 @@ func ConvertReference(ctx context.Context, imgCache *cache.Handle, src types.Ima
 
 	return &ImageReference{
 		source:         src,
+		digest:         cacheTag,
 		ImageReference: c,
 	}, nil
 
@@ -138,3 +149,27 @@ func calculateRefHash(ctx context.Context, ref types.ImageReference, sys *types.
 	hash = fmt.Sprintf("%x", sha256.Sum256(man))
 	return hash, nil
 }
+
+// RefDigest returns the hex encoded sha256 digest of the manifest of the
+// image ref, as returned by ImageSHA.
+func RefDigest(ctx context.Context, ref types.ImageReference, sys *types.SystemContext) (string, error) {
+	if r, ok := ref.(*ImageReference); ok {
+		return r.digest, nil
+	}
+	return calculateRefHash(ctx, ref, sys)
+}
+
+// PinReference resolves the docker reference ref to the digest of its
+// current manifest, and returns the reference of the image by this digest,
+// so that a moving tag isn't resolved again while the image is fetched.
+func PinReference(ctx context.Context, ref types.ImageReference, sys *types.SystemContext) (types.ImageReference, error) {
+	named := ref.DockerReference()
+	if named == nil {
+		return nil, fmt.Errorf("%s is not a docker reference", transports.ImageName(ref))
+	}
+	hash, err := calculateRefHash(ctx, ref, sys)
+	if err != nil {
+		return nil, fmt.Errorf("while resolving %s: %v", named, err)
+	}
+	return docker.ParseReference("//" + reference.TrimNamed(named).String() + "@sha256:" + hash)
+}
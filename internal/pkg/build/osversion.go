@@ -0,0 +1,58 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+// osVersionPatterns are the OS version formats expected by the distro
+// bootstrap agents.
+var osVersionPatterns = map[string]*regexp.Regexp{
+	// suite or codename, e.g. buster or bionic
+	"debootstrap": regexp.MustCompile(`^[a-z][a-z0-9-]*$`),
+	// release version, e.g. 7 or 8.2
+	"yum": regexp.MustCompile(`^[0-9]+(\.[0-9]+)*$`),
+	// release version, e.g. 15.2
+	"zypper": regexp.MustCompile(`^[0-9]+(\.[0-9]+)*$`),
+}
+
+var osVersionRegexp = regexp.MustCompile(`(?i)%{OSVERSION}`)
+
+// setOSVersion sets the OSVersion header of the definitions bootstrapped
+// by a distro bootstrap agent to the version given with the --os-version
+// flag, if any, and substitutes their OS version into their Include header.
+func setOSVersion(version string, defs []types.Definition) error {
+	found := false
+	for _, d := range defs {
+		bootstrap := d.Header["bootstrap"]
+		pattern, ok := osVersionPatterns[bootstrap]
+		if !ok {
+			continue
+		}
+		found = true
+
+		if version != "" {
+			if !pattern.MatchString(version) {
+				return fmt.Errorf("invalid OS version %q for the %s bootstrap agent", version, bootstrap)
+			}
+			d.Header["osversion"] = version
+		}
+		if osversion, ok := d.Header["osversion"]; ok {
+			if include, ok := d.Header["include"]; ok {
+				d.Header["include"] = osVersionRegexp.ReplaceAllString(include, osversion)
+			}
+		}
+	}
+
+	if version != "" && !found {
+		return fmt.Errorf("an OS version can only be set for the debootstrap, yum and zypper bootstrap agents")
+	}
+	return nil
+}
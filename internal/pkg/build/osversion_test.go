@@ -0,0 +1,101 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+func TestSetOSVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		headers []map[string]string
+		want    []map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "NoVersion",
+			headers: []map[string]string{{"bootstrap": "docker", "from": "alpine"}},
+			want:    []map[string]string{{"bootstrap": "docker", "from": "alpine"}},
+		},
+		{
+			name:    "Debootstrap",
+			version: "buster",
+			headers: []map[string]string{{"bootstrap": "debootstrap", "osversion": "stable"}},
+			want:    []map[string]string{{"bootstrap": "debootstrap", "osversion": "buster"}},
+		},
+		{
+			name:    "Yum",
+			version: "8",
+			headers: []map[string]string{{"bootstrap": "yum", "include": "centos-release-%{OSVERSION}"}},
+			want:    []map[string]string{{"bootstrap": "yum", "osversion": "8", "include": "centos-release-8"}},
+		},
+		{
+			name:    "HeaderInclude",
+			headers: []map[string]string{{"bootstrap": "zypper", "osversion": "15.2", "include": "release-%{osversion}"}},
+			want:    []map[string]string{{"bootstrap": "zypper", "osversion": "15.2", "include": "release-15.2"}},
+		},
+		{
+			name:    "MultiStage",
+			version: "15.2",
+			headers: []map[string]string{
+				{"bootstrap": "zypper", "osversion": "15.1"},
+				{"bootstrap": "localimage", "from": "/tmp/image.sif"},
+			},
+			want: []map[string]string{
+				{"bootstrap": "zypper", "osversion": "15.2"},
+				{"bootstrap": "localimage", "from": "/tmp/image.sif"},
+			},
+		},
+		{
+			name:    "InvalidDebootstrap",
+			version: "10.5",
+			headers: []map[string]string{{"bootstrap": "debootstrap"}},
+			wantErr: true,
+		},
+		{
+			name:    "InvalidYum",
+			version: "centos8",
+			headers: []map[string]string{{"bootstrap": "yum"}},
+			wantErr: true,
+		},
+		{
+			name:    "Unsupported",
+			version: "3.12",
+			headers: []map[string]string{{"bootstrap": "docker", "from": "alpine"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var defs []types.Definition
+			for _, h := range tt.headers {
+				defs = append(defs, types.Definition{Header: h})
+			}
+
+			err := setOSVersion(tt.version, defs)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("unexpected success")
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			for i, d := range defs {
+				if !reflect.DeepEqual(d.Header, tt.want[i]) {
+					t.Errorf("got header %v, want %v", d.Header, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+)
+
+// outputWriter forwards section output to w and reports each line
+// written with emit.
+type outputWriter struct {
+	w    io.Writer
+	emit func(line string)
+	buf  []byte
+}
+
+func (o *outputWriter) Write(p []byte) (int, error) {
+	n, err := o.w.Write(p)
+
+	o.buf = append(o.buf, p[:n]...)
+	for {
+		i := bytes.IndexByte(o.buf, '\n')
+		if i < 0 {
+			break
+		}
+		o.emit(string(o.buf[:i]))
+		o.buf = o.buf[i+1:]
+	}
+	return n, err
+}
+
+// flush reports the last line if it doesn't end with a newline.
+func (o *outputWriter) flush() {
+	if len(o.buf) > 0 {
+		o.emit(string(o.buf))
+		o.buf = nil
+	}
+}
+
+// lineWriter writes each line of section output to w with a single write
+// as soon as it's terminated, prefixed with the time elapsed since start
+// if stamp is set.
+type lineWriter struct {
+	w     io.Writer
+	start time.Time
+	stamp bool
+	buf   []byte
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		err := l.writeLine(l.buf[:i+1])
+		l.buf = l.buf[i+1:]
+		if err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+func (l *lineWriter) writeLine(line []byte) error {
+	if l.stamp {
+		line = append([]byte(elapsedStamp(time.Since(l.start))), line...)
+	}
+	_, err := l.w.Write(line)
+	return err
+}
+
+// flush writes the last line if it doesn't end with a newline.
+func (l *lineWriter) flush() {
+	if len(l.buf) > 0 {
+		l.writeLine(l.buf)
+		l.buf = nil
+	}
+}
+
+// elapsedStamp returns the prefix of the output lines written d after
+// the build started.
+func elapsedStamp(d time.Duration) string {
+	d = d.Round(time.Millisecond)
+	h := d / time.Hour
+	m := (d % time.Hour) / time.Minute
+	ms := (d % time.Minute) / time.Millisecond
+	return fmt.Sprintf("[%02d:%02d:%02d.%03d] ", h, m, ms/1000, ms%1000)
+}
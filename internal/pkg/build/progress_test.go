@@ -0,0 +1,251 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/test"
+	"github.com/sylabs/singularity/pkg/build/types"
+	"github.com/sylabs/singularity/pkg/build/types/parser"
+)
+
+// recorder is a progress callback recording the events received.
+type recorder struct {
+	sync.Mutex
+	events []types.ProgressEvent
+}
+
+func (r *recorder) record(e types.ProgressEvent) {
+	r.Lock()
+	defer r.Unlock()
+	r.events = append(r.events, e)
+}
+
+func TestOutputWriter(t *testing.T) {
+	var buf bytes.Buffer
+	var lines []string
+
+	o := &outputWriter{
+		w:    &buf,
+		emit: func(line string) { lines = append(lines, line) },
+	}
+
+	for _, s := range []string{"first line\nsec", "ond line\n", "\nlast"} {
+		if _, err := o.Write([]byte(s)); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	o.flush()
+
+	want := []string{"first line", "second line", "", "last"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("got lines %q, want %q", lines, want)
+	}
+	if got := buf.String(); got != "first line\nsecond line\n\nlast" {
+		t.Errorf("unexpected forwarded output %q", got)
+	}
+}
+
+// writerFunc is an io.Writer calling the function for each write.
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestLineWriter(t *testing.T) {
+	stampRegexp := regexp.MustCompile(`^\[[0-9]{2}:[0-9]{2}:[0-9]{2}\.[0-9]{3}\] `)
+
+	tests := []struct {
+		name  string
+		stamp bool
+	}{
+		{name: "NoStamp", stamp: false},
+		{name: "Stamp", stamp: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var writes []string
+
+			l := &lineWriter{
+				w: writerFunc(func(p []byte) (int, error) {
+					writes = append(writes, string(p))
+					return len(p), nil
+				}),
+				start: time.Now(),
+				stamp: tt.stamp,
+			}
+
+			for _, s := range []string{"first line\nsec", "ond line\n", "\nlast"} {
+				if _, err := l.Write([]byte(s)); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+			l.flush()
+
+			if tt.stamp {
+				for i, w := range writes {
+					if !stampRegexp.MatchString(w) {
+						t.Errorf("line %q is not timestamped", w)
+					}
+					writes[i] = stampRegexp.ReplaceAllString(w, "")
+				}
+			}
+			want := []string{"first line\n", "second line\n", "\n", "last"}
+			if !reflect.DeepEqual(writes, want) {
+				t.Errorf("got writes %q, want %q", writes, want)
+			}
+		})
+	}
+}
+
+func TestElapsedStamp(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "[00:00:00.000] "},
+		{1500 * time.Microsecond, "[00:00:00.002] "},
+		{62003 * time.Millisecond, "[00:01:02.003] "},
+		{25*time.Hour + 59*time.Second, "[25:00:59.000] "},
+	}
+
+	for _, tt := range tests {
+		if got := elapsedStamp(tt.d); got != tt.want {
+			t.Errorf("elapsedStamp(%s) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+// TestLineWriterStreaming checks that the lines written by a command are
+// forwarded as soon as they are written and not once it terminates.
+func TestLineWriterStreaming(t *testing.T) {
+	var arrivals []time.Time
+
+	l := &lineWriter{
+		w: writerFunc(func(p []byte) (int, error) {
+			arrivals = append(arrivals, time.Now())
+			return len(p), nil
+		}),
+		start: time.Now(),
+		stamp: true,
+	}
+
+	cmd := exec.Command("/bin/sh", "-c", "echo first; sleep 1; echo second; sleep 1; echo third")
+	cmd.Stdout = l
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	l.flush()
+
+	if len(arrivals) != 3 {
+		t.Fatalf("got %d lines, want 3", len(arrivals))
+	}
+	for i := 1; i < len(arrivals); i++ {
+		if d := arrivals[i].Sub(arrivals[i-1]); d < 500*time.Millisecond {
+			t.Errorf("line %d arrived %s after the previous one, output is not streamed", i+1, d)
+		}
+	}
+}
+
+const progressDefinition = `Bootstrap: localimage
+From: %s
+
+%%post
+    echo "progress from post"
+`
+
+func TestBuildProgress(t *testing.T) {
+	test.EnsurePrivilege(t)
+
+	if _, err := exec.LookPath("mksquashfs"); err != nil {
+		t.Skip("mksquashfs not found")
+	}
+	if _, err := os.Stat(filepath.Join(buildcfg.BINDIR, "singularity")); err != nil {
+		t.Skip("singularity is not installed")
+	}
+	image, err := filepath.Abs("../../../e2e/testdata/busybox.sif")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "build-progress-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	def, err := parser.ParseDefinitionFile(strings.NewReader(fmt.Sprintf(progressDefinition, image)))
+	if err != nil {
+		t.Fatalf("while parsing definition: %s", err)
+	}
+
+	imgCache, err := cache.New(cache.Config{ParentDir: dir})
+	if err != nil {
+		t.Fatalf("while creating image cache: %s", err)
+	}
+
+	var r recorder
+	b, err := New([]types.Definition{def}, Config{
+		Dest:   filepath.Join(dir, "image.sif"),
+		Format: "sif",
+		Opts: types.Options{
+			TmpDir:   dir,
+			ImgCache: imgCache,
+			NoTest:   true,
+			Progress: r.record,
+		},
+	})
+	if err != nil {
+		t.Fatalf("while creating build: %s", err)
+	}
+	if err := b.Full(context.Background()); err != nil {
+		t.Fatalf("build failed: %s", err)
+	}
+
+	var phases, steps []string
+	postOutput := false
+	for _, e := range r.events {
+		switch e.Type {
+		case types.PhaseEvent:
+			phases = append(phases, e.Phase)
+		case types.AssembleEvent:
+			steps = append(steps, e.Step)
+		case types.OutputEvent:
+			if e.Phase == types.PhasePost && e.Line == "progress from post" {
+				postOutput = true
+			}
+		}
+	}
+
+	wantPhases := []string{types.PhaseBootstrap, types.PhasePost, types.PhaseAssemble, types.PhaseComplete}
+	if !reflect.DeepEqual(phases, wantPhases) {
+		t.Errorf("got phases %v, want %v", phases, wantPhases)
+	}
+	wantSteps := []string{types.AssembleSquashfs, types.AssembleSIF}
+	if !reflect.DeepEqual(steps, wantSteps) {
+		t.Errorf("got assemble steps %v, want %v", steps, wantSteps)
+	}
+	if !postOutput {
+		t.Errorf("%%post output not reported")
+	}
+}
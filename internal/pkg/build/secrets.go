@@ -0,0 +1,156 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/pkg/build/types"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// secretsPath is the directory of the secrets in the container while the
+// %post section runs.
+const secretsPath = "/run/secrets"
+
+// shmDir is the tmpfs the secrets are staged in, so their content is never
+// written to a disk.
+var shmDir = "/dev/shm"
+
+// ParseSecret parses a secret in the id=<id>,src=<path> format, the id
+// defaults to the base name of the source file.
+func ParseSecret(value string) (types.Secret, error) {
+	var secret types.Secret
+
+	for _, field := range strings.Split(value, ",") {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return types.Secret{}, fmt.Errorf("bad secret %q, the format is id=<id>,src=<path>", value)
+		}
+		switch kv[0] {
+		case "id":
+			secret.ID = kv[1]
+		case "src", "source":
+			secret.Src = kv[1]
+		case "type":
+			if kv[1] != "file" {
+				return types.Secret{}, fmt.Errorf("secret %q: unsupported type %s, only file secrets are supported", value, kv[1])
+			}
+		default:
+			return types.Secret{}, fmt.Errorf("secret %q: unknown field %s", value, kv[0])
+		}
+	}
+
+	if secret.Src == "" {
+		return types.Secret{}, fmt.Errorf("secret %q has no source file", value)
+	}
+	if secret.ID == "" {
+		secret.ID = filepath.Base(secret.Src)
+	}
+	if strings.Contains(secret.ID, "/") || secret.ID == "." || secret.ID == ".." {
+		return types.Secret{}, fmt.Errorf("secret %q: bad id %q, it must be a file name", value, secret.ID)
+	}
+
+	src, err := filepath.Abs(secret.Src)
+	if err != nil {
+		return types.Secret{}, fmt.Errorf("secret %q: %s", value, err)
+	}
+	secret.Src = src
+
+	return secret, nil
+}
+
+// ParseSecrets parses the secrets values with ParseSecret and checks that
+// their ids are unique.
+func ParseSecrets(values []string) ([]types.Secret, error) {
+	secrets := make([]types.Secret, 0, len(values))
+	ids := make(map[string]bool)
+
+	for _, v := range values {
+		secret, err := ParseSecret(v)
+		if err != nil {
+			return nil, err
+		}
+		if ids[secret.ID] {
+			return nil, fmt.Errorf("duplicate secret id %q", secret.ID)
+		}
+		ids[secret.ID] = true
+		secrets = append(secrets, secret)
+	}
+	return secrets, nil
+}
+
+// stageSecrets copies the secrets to a private directory on a tmpfs, or in
+// tmpDir if there is none and onDisk is set, and returns the directory. The
+// directory is bind mounted on /run/secrets for the %post section, the
+// secrets are then never written in the root filesystem of the image.
+func stageSecrets(secrets []types.Secret, tmpDir string, onDisk bool) (string, error) {
+	parent := shmDir
+	if fi, err := os.Stat(shmDir); err != nil || !fi.IsDir() {
+		if !onDisk {
+			return "", fmt.Errorf("%s is not available to stage the build secrets, use --secrets-on-disk to stage them in %s", shmDir, tmpDir)
+		}
+		sylog.Warningf("%s is not available, build secrets are staged in %s", shmDir, tmpDir)
+		parent = tmpDir
+	}
+
+	dir, err := ioutil.TempDir(parent, "build-secrets-")
+	if err != nil {
+		return "", fmt.Errorf("while creating secrets directory: %s", err)
+	}
+
+	for _, secret := range secrets {
+		if err := fs.CopyFile(secret.Src, filepath.Join(dir, secret.ID), 0400); err != nil {
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("while copying secret %s: %s", secret.ID, err)
+		}
+	}
+	return dir, nil
+}
+
+// secretsMountPoint creates the directories of the /run/secrets mount
+// point missing in the root filesystem, and returns a function removing
+// them, so the image doesn't keep an empty /run/secrets.
+func (s *stage) secretsMountPoint() (func(), error) {
+	var created []string
+
+	remove := func() {
+		for i := len(created) - 1; i >= 0; i-- {
+			if err := os.Remove(created[i]); err != nil {
+				sylog.Debugf("Could not remove secrets mount point %s: %s", created[i], err)
+			}
+		}
+	}
+
+	path := s.b.RootfsPath
+	dest := fs.EvalRelative(secretsPath, s.b.RootfsPath)
+	for _, elem := range strings.Split(strings.TrimPrefix(dest, "/"), "/") {
+		path = filepath.Join(path, elem)
+
+		fi, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			if err := os.Mkdir(path, 0755); err != nil {
+				remove()
+				return nil, fmt.Errorf("while creating secrets mount point: %s", err)
+			}
+			created = append(created, path)
+			continue
+		} else if err != nil {
+			remove()
+			return nil, fmt.Errorf("while checking secrets mount point: %s", err)
+		}
+		if !fi.IsDir() {
+			remove()
+			return nil, fmt.Errorf("%s is not a directory in the container, secrets can't be mounted", secretsPath)
+		}
+	}
+	return remove, nil
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+func TestParseSecrets(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    []types.Secret
+		wantErr bool
+	}{
+		{
+			name:   "IDAndSource",
+			values: []string{"id=mytoken,src=/path/file"},
+			want:   []types.Secret{{ID: "mytoken", Src: "/path/file"}},
+		},
+		{
+			name:   "SourceOnly",
+			values: []string{"source=/path/file,type=file"},
+			want:   []types.Secret{{ID: "file", Src: "/path/file"}},
+		},
+		{
+			name:   "Several",
+			values: []string{"id=a,src=/path/a", "id=b,src=/path/a"},
+			want:   []types.Secret{{ID: "a", Src: "/path/a"}, {ID: "b", Src: "/path/a"}},
+		},
+		{name: "NoSource", values: []string{"id=mytoken"}, wantErr: true},
+		{name: "BadField", values: []string{"id=mytoken,/path/file"}, wantErr: true},
+		{name: "UnknownField", values: []string{"id=mytoken,src=/path/file,mode=0400"}, wantErr: true},
+		{name: "EnvType", values: []string{"id=mytoken,type=env,src=TOKEN"}, wantErr: true},
+		{name: "PathID", values: []string{"id=../mytoken,src=/path/file"}, wantErr: true},
+		{name: "Duplicate", values: []string{"id=a,src=/path/a", "id=a,src=/path/b"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSecrets(tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStageSecrets(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "stage-secrets-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	src := filepath.Join(tmpDir, "token")
+	if err := ioutil.WriteFile(src, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := stageSecrets([]types.Secret{{ID: "mytoken", Src: src}}, tmpDir, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if fi, err := os.Stat(dir); err != nil || fi.Mode().Perm() != 0700 {
+		t.Errorf("secrets directory %s is not private: %v", dir, err)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "mytoken")); err != nil || string(b) != "secret" {
+		t.Errorf("secret not staged in %s: %v", dir, err)
+	}
+
+	if _, err := stageSecrets([]types.Secret{{ID: "missing", Src: filepath.Join(tmpDir, "missing")}}, tmpDir, false); err == nil {
+		t.Errorf("unexpected success staging a missing secret")
+	}
+
+	// without tmpfs, the secrets are written to tmpDir only if allowed
+	defer func(dir string) { shmDir = dir }(shmDir)
+	shmDir = filepath.Join(tmpDir, "missing")
+
+	if _, err := stageSecrets([]types.Secret{{ID: "mytoken", Src: src}}, tmpDir, false); err == nil {
+		t.Errorf("unexpected success staging secrets on disk")
+	}
+	dir, err = stageSecrets([]types.Secret{{ID: "mytoken", Src: src}}, tmpDir, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if filepath.Dir(dir) != tmpDir {
+		t.Errorf("secrets staged in %s instead of %s", dir, tmpDir)
+	}
+}
+
+func TestSecretsMountPoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(rootfs string) error
+		dest     string
+		existing bool
+		wantRun  bool
+		wantErr  bool
+	}{
+		{
+			name:  "NoRun",
+			setup: func(rootfs string) error { return nil },
+		},
+		{
+			name: "Run",
+			setup: func(rootfs string) error {
+				return os.Mkdir(filepath.Join(rootfs, "run"), 0755)
+			},
+			wantRun: true,
+		},
+		{
+			name: "Secrets",
+			setup: func(rootfs string) error {
+				return os.MkdirAll(filepath.Join(rootfs, "run", "secrets"), 0755)
+			},
+			existing: true,
+			wantRun:  true,
+		},
+		{
+			// the symlink target must be resolved in the container, not on the host
+			name: "HostSymlink",
+			setup: func(rootfs string) error {
+				if err := os.Mkdir(filepath.Join(rootfs, "var"), 0755); err != nil {
+					return err
+				}
+				return os.Symlink("/var", filepath.Join(rootfs, "run"))
+			},
+			dest:    "var/secrets",
+			wantRun: true,
+		},
+		{
+			name: "File",
+			setup: func(rootfs string) error {
+				return ioutil.WriteFile(filepath.Join(rootfs, "run"), []byte{}, 0644)
+			},
+			wantRun: true,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rootfs, err := ioutil.TempDir("", "secrets-mount-point-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(rootfs)
+
+			if err := tt.setup(rootfs); err != nil {
+				t.Fatal(err)
+			}
+			before, err := ioutil.ReadDir(rootfs)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s := &stage{b: &types.Bundle{RootfsPath: rootfs}}
+			remove, err := s.secretsMountPoint()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err != nil {
+				return
+			}
+
+			if tt.dest == "" {
+				tt.dest = "run/secrets"
+			}
+			dest := filepath.Join(rootfs, tt.dest)
+			if fi, err := os.Stat(dest); err != nil || !fi.IsDir() {
+				t.Fatalf("mount point %s not created: %v", dest, err)
+			}
+
+			remove()
+			after, err := ioutil.ReadDir(rootfs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(dest); os.IsNotExist(err) == tt.existing {
+				t.Errorf("unexpected mount point %s existence after removal: %v", dest, err)
+			}
+			if len(after) != len(before) {
+				t.Errorf("root filesystem has %d entries after removal, want %d", len(after), len(before))
+			}
+			if _, err := os.Lstat(filepath.Join(rootfs, "run")); os.IsNotExist(err) == tt.wantRun {
+				t.Errorf("unexpected /run existence after removal: %v", err)
+			}
+		})
+	}
+}
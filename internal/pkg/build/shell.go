@@ -0,0 +1,288 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+// Shell options applied to the %pre, %setup, %post and %test sections.
+const (
+	// shellErrexit aborts a section as soon as a command fails.
+	shellErrexit = "errexit"
+	// shellPipefail makes a pipeline fail if any of its commands fails.
+	shellPipefail = "pipefail"
+	// shellNone disables all shell options.
+	shellNone = "none"
+)
+
+// defaultShellOptions are the shell options used when neither the
+// ShellOptions header nor the --shell-options flag are set.
+var defaultShellOptions = []string{shellErrexit, shellPipefail}
+
+// shellOptions returns the shell options set by the --shell-options flag,
+// by the ShellOptions header of the definition or the default ones.
+func shellOptions(flag string, header map[string]string) ([]string, error) {
+	value, ok := flag, flag != ""
+	if !ok {
+		value, ok = header["shelloptions"]
+	}
+	if !ok {
+		return defaultShellOptions, nil
+	}
+
+	var opts []string
+	for _, o := range strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	}) {
+		switch o {
+		case shellErrexit, shellPipefail:
+			opts = append(opts, o)
+		case shellNone:
+		default:
+			return nil, fmt.Errorf("invalid shell option %q, valid options are %s, %s and %s", o, shellErrexit, shellPipefail, shellNone)
+		}
+	}
+	return opts, nil
+}
+
+// shellPrologue returns the shell commands, on a single line, enabling the
+// shell options opts and the command trace if trace is set.
+func shellPrologue(opts []string, trace bool) string {
+	var cmds []string
+	for _, o := range opts {
+		switch o {
+		case shellErrexit:
+			cmds = append(cmds, "set -e")
+		case shellPipefail:
+			// not all /bin/sh implementations support pipefail
+			cmds = append(cmds, "if (set -o pipefail) 2>/dev/null; then set -o pipefail; fi")
+		}
+	}
+	if trace {
+		cmds = append(cmds, `PS4='+ [line $LINENO] '`, "set -x")
+	}
+	return strings.Join(cmds, "; ")
+}
+
+// customShell returns if the section script is run by the shell given with
+// the -c section argument, in which case the shell options can't be applied.
+func customShell(s types.Script) bool {
+	for _, param := range strings.Fields(strings.Split(s.Args, "#")[0]) {
+		if param == "-c" {
+			return true
+		}
+	}
+	return false
+}
+
+// shebangShell returns the section s with the interpreter of its shebang
+// line given as custom shell, a section starting with #!/bin/bash runs like
+// with '-c /bin/bash'. The shebang line is ignored when -c is given.
+func shebangShell(s types.Script) types.Script {
+	script := strings.TrimLeft(s.Script, " \t\n")
+	if customShell(s) || !strings.HasPrefix(script, "#!") {
+		return s
+	}
+	interpreter := strings.TrimSpace(strings.SplitN(script, "\n", 2)[0][2:])
+	if interpreter == "" {
+		return s
+	}
+	s.Args = strings.TrimSpace(strings.Split(s.Args, "#")[0] + " -c " + interpreter)
+	return s
+}
+
+// sectionInterpreter returns the program given with the -c section argument
+// running the section s, or an empty string for the default shell.
+func sectionInterpreter(s types.Script) string {
+	params := strings.Fields(strings.Split(s.Args, "#")[0])
+	for i, param := range params {
+		if param == "-c" && i+1 < len(params) {
+			return params[i+1]
+		}
+	}
+	return ""
+}
+
+// sectionScript returns the content of the script running the section s
+// with the shell options opts, preceded by the shell prologue line.
+func sectionScript(s types.Script, opts []string, trace bool) string {
+	if customShell(s) {
+		return s.Script
+	}
+	return shellPrologue(opts, trace) + "\n" + s.Script
+}
+
+// testCommand returns the shell command running the test script of the
+// image with the shell options opts, which aren't part of the test script
+// run by 'singularity test'.
+func testCommand(opts []string) string {
+	cmd := ". /.singularity.d/test"
+	if prologue := shellPrologue(opts, false); prologue != "" {
+		cmd = prologue + "\n" + cmd
+	}
+	return cmd
+}
+
+// traceRegexp matches the command trace produced with the shell prologue.
+var traceRegexp = regexp.MustCompile(`^(\++) \[line ([0-9]*)\] (.*)$`)
+
+// traceWriter processes the command trace of a section script written to
+// w. The definition file line of traced commands is shown in verbose mode
+// only, and the last traced command is kept to report failures.
+type traceWriter struct {
+	w       io.Writer
+	verbose bool
+	// script is the section, its first line is the second one of
+	// the script file, after the shell prologue.
+	script types.Script
+	// lines is the number of lines of the section in the definition
+	// file, the script may hold more lines (e.g. %appinstall sections
+	// appended to %post).
+	lines int
+
+	buf      []byte
+	pass     bool
+	next     int
+	last     string
+	lastLine int
+}
+
+// defLine returns the definition file line of the script file line, or 0 if
+// it's unknown.
+func (t *traceWriter) defLine(line int) int {
+	line--
+	if t.script.Line == 0 || line < 1 || line > t.lines {
+		return 0
+	}
+	t.next = line
+	return t.script.Line + line - 1
+}
+
+// matchLine returns the definition file line of the traced command cmd
+// for shells not setting LINENO (e.g. dash), or 0 if it's unknown. The
+// section lines are searched for the command name from the line following
+// the last traced command.
+func (t *traceWriter) matchLine(cmd string) int {
+	name := strings.Fields(cmd)
+	if t.script.Line == 0 || len(name) == 0 {
+		return 0
+	}
+	lines := strings.Split(t.script.Script, "\n")
+	if len(lines) > t.lines {
+		lines = lines[:t.lines]
+	}
+	for i := range lines {
+		n := (t.next + i) % len(lines)
+		if f := strings.Fields(lines[n]); len(f) > 0 && f[0] == name[0] {
+			t.next = n + 1
+			return t.script.Line + n
+		}
+	}
+	return 0
+}
+
+func (t *traceWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if t.pass {
+			// pass lines which aren't part of the trace as they are
+			i := bytes.IndexByte(p, '\n')
+			if i < 0 {
+				_, err := t.w.Write(p)
+				return n, err
+			}
+			if _, err := t.w.Write(p[:i+1]); err != nil {
+				return n, err
+			}
+			p = p[i+1:]
+			t.pass = false
+			continue
+		}
+		if len(t.buf) == 0 && p[0] != '+' {
+			t.pass = true
+			continue
+		}
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			t.buf = append(t.buf, p...)
+			return n, nil
+		}
+		t.buf = append(t.buf, p[:i]...)
+		p = p[i+1:]
+		if err := t.traceLine(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// traceLine processes the buffered line.
+func (t *traceWriter) traceLine() error {
+	line := string(t.buf)
+	t.buf = t.buf[:0]
+
+	m := traceRegexp.FindStringSubmatch(line)
+	if m == nil {
+		_, err := io.WriteString(t.w, line+"\n")
+		return err
+	}
+
+	t.last = m[3]
+	if n, err := strconv.Atoi(m[2]); err == nil {
+		t.lastLine = t.defLine(n)
+	} else {
+		t.lastLine = t.matchLine(m[3])
+	}
+	if t.verbose && t.lastLine > 0 {
+		line = fmt.Sprintf("%s [line %d] %s", m[1], t.lastLine, m[3])
+	} else {
+		line = m[1] + " " + m[3]
+	}
+	_, err := io.WriteString(t.w, line+"\n")
+	return err
+}
+
+// flush writes the last line if it doesn't end with a newline.
+func (t *traceWriter) flush() {
+	if len(t.buf) > 0 {
+		t.w.Write(t.buf)
+		t.buf = nil
+	}
+}
+
+// sectionError returns the error reported when the section script ran with
+// the shell options opts failed with err, the trace writer t holding its
+// last command may be nil.
+func sectionError(section string, err error, opts []string, t *traceWriter) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return fmt.Errorf("failed to run %%%s script: %v", section, err)
+	}
+
+	msg := fmt.Sprintf("%%%s script failed with exit code %d", section, exitErr.ExitCode())
+	if t != nil && t.last != "" {
+		if t.lastLine > 0 {
+			msg += fmt.Sprintf(" at line %d of the definition file", t.lastLine)
+		}
+		msg += fmt.Sprintf(" running: %s", t.last)
+	}
+	if len(opts) > 0 {
+		msg += fmt.Sprintf("\nSections run with the %s shell options and stop at the first failing command, "+
+			"set 'ShellOptions: %s' in the definition header or use --shell-options %s to ignore failures",
+			strings.Join(opts, " and "), shellNone, shellNone)
+	}
+	return errors.New(msg)
+}
@@ -0,0 +1,284 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+func TestShellOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		flag    string
+		header  map[string]string
+		want    []string
+		wantErr bool
+	}{
+		{"Default", "", nil, defaultShellOptions, false},
+		{"Header", "", map[string]string{"shelloptions": "errexit"}, []string{shellErrexit}, false},
+		{"HeaderNone", "", map[string]string{"shelloptions": "none"}, nil, false},
+		{"FlagOverride", "pipefail", map[string]string{"shelloptions": "errexit"}, []string{shellPipefail}, false},
+		{"FlagNone", "none", nil, nil, false},
+		{"List", "Errexit, pipefail", nil, []string{shellErrexit, shellPipefail}, false},
+		{"Invalid", "", map[string]string{"shelloptions": "nounset"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := shellOptions(tt.flag, tt.header)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("unexpected success")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got options %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSectionScript(t *testing.T) {
+	dir, err := ioutil.TempDir("", "build-shell-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the section starts at line 10 of the definition file
+	script := types.Script{
+		Script: "echo start\nfalse | true\necho pipe\nfalse\necho end",
+		Line:   10,
+	}
+
+	tests := []struct {
+		name     string
+		opts     []string
+		verbose  bool
+		wantErr  bool
+		wantOut  string
+		wantLast string
+		wantLine int
+	}{
+		{"None", nil, false, false, "start\npipe\nend\n", "echo end", 14},
+		{"Errexit", []string{shellErrexit}, false, true, "start\npipe\n", "false", 13},
+		{"Pipefail", defaultShellOptions, true, true, "start\n", "false", 11},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Pipefail" && exec.Command("/bin/sh", "-c", "set -o pipefail").Run() != nil {
+				t.Skip("/bin/sh doesn't support pipefail")
+			}
+
+			path := filepath.Join(dir, tt.name)
+			if err := createScript(path, []byte(sectionScript(script, tt.opts, true))); err != nil {
+				t.Fatal(err)
+			}
+			args, err := getSectionScriptArgs("post", path, script)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var stdout, stderr bytes.Buffer
+			trace := &traceWriter{w: &stderr, verbose: tt.verbose, script: script, lines: 5}
+			cmd := exec.Command(args[0], args[1:]...)
+			cmd.Stdout = &stdout
+			cmd.Stderr = trace
+			err = cmd.Run()
+			trace.flush()
+
+			if tt.wantErr && err == nil {
+				t.Fatalf("unexpected success")
+			} else if !tt.wantErr && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if stdout.String() != tt.wantOut {
+				t.Errorf("got output %q, want %q", stdout.String(), tt.wantOut)
+			}
+			if trace.last != tt.wantLast {
+				t.Errorf("got last command %q, want %q", trace.last, tt.wantLast)
+			}
+			if trace.lastLine != tt.wantLine {
+				t.Errorf("got last command line %d, want %d", trace.lastLine, tt.wantLine)
+			}
+
+			out := stderr.String()
+			want := "+ echo start\n"
+			if tt.verbose {
+				want = "+ [line 10] echo start\n"
+			}
+			if !strings.Contains(out, want) {
+				t.Errorf("command trace %q not found in %q", want, out)
+			}
+
+			if err != nil {
+				msg := sectionError("post", err, tt.opts, trace).Error()
+				if !strings.Contains(msg, "exit code 1") || !strings.Contains(msg, "ShellOptions: none") {
+					t.Errorf("unexpected error message %q", msg)
+				}
+			}
+		})
+	}
+}
+
+func TestTestCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "build-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the test script is written without the shell options
+	path := filepath.Join(dir, "test")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n\nfalse\necho end\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command(path).Output(); err != nil || string(out) != "end\n" {
+		t.Errorf("test script run with shell options: %q, %v", out, err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    []string
+		wantErr bool
+		wantOut string
+	}{
+		{"None", nil, false, "end\n"},
+		{"Errexit", []string{shellErrexit}, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := strings.Replace(testCommand(tt.opts), "/.singularity.d/test", path, 1)
+			out, err := exec.Command("/bin/sh", "-c", cmd).Output()
+			if tt.wantErr && err == nil {
+				t.Errorf("unexpected success")
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if string(out) != tt.wantOut {
+				t.Errorf("got output %q, want %q", out, tt.wantOut)
+			}
+		})
+	}
+}
+
+func TestTraceWriter(t *testing.T) {
+	var out bytes.Buffer
+	trace := &traceWriter{
+		w:      &out,
+		script: types.Script{Line: 5},
+		lines:  2,
+	}
+
+	for _, s := range []string{"progress 10%\r", "progress 100%\n+ [li", "ne 2] apt-get install\n", "++ [line 4] appinstall\n", "partial"} {
+		if _, err := trace.Write([]byte(s)); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	trace.flush()
+
+	want := "progress 10%\rprogress 100%\n+ apt-get install\n++ appinstall\npartial"
+	if out.String() != want {
+		t.Errorf("got output %q, want %q", out.String(), want)
+	}
+	// line 4 of the script file is past the section
+	if trace.last != "appinstall" || trace.lastLine != 0 {
+		t.Errorf("got last command %q at line %d", trace.last, trace.lastLine)
+	}
+	if trace.defLine(2) != 5 {
+		t.Errorf("got definition line %d, want 5", trace.defLine(2))
+	}
+}
+
+func TestTraceWriterMatchLine(t *testing.T) {
+	var out bytes.Buffer
+	trace := &traceWriter{
+		w:       &out,
+		verbose: true,
+		script: types.Script{
+			Script: "for i in 1 2; do\n  echo $i\ndone\ntrue\n%appinstall",
+			Line:   20,
+		},
+		lines: 4,
+	}
+
+	// shells not setting LINENO
+	trace.Write([]byte("+ [line ] echo 1\n+ [line ] echo 2\n+ [line ] true\n+ [line ] unknown\n"))
+
+	want := "+ [line 21] echo 1\n+ [line 21] echo 2\n+ [line 23] true\n+ unknown\n"
+	if out.String() != want {
+		t.Errorf("got output %q, want %q", out.String(), want)
+	}
+}
+
+func TestShebangShell(t *testing.T) {
+	tests := []struct {
+		name            string
+		script          types.Script
+		wantArgs        string
+		wantInterpreter string
+	}{
+		{
+			name:   "Default",
+			script: types.Script{Script: "echo post\n"},
+		},
+		{
+			name:            "Args",
+			script:          types.Script{Args: "-c /bin/bash # bash", Script: "echo post\n"},
+			wantArgs:        "-c /bin/bash # bash",
+			wantInterpreter: "/bin/bash",
+		},
+		{
+			name:            "Shebang",
+			script:          types.Script{Script: "\n    #!/bin/bash -e\necho post\n"},
+			wantArgs:        "-c /bin/bash -e",
+			wantInterpreter: "/bin/bash",
+		},
+		{
+			name:            "ShebangComment",
+			script:          types.Script{Args: "# bash", Script: "#!/usr/bin/env bash\necho post\n"},
+			wantArgs:        "-c /usr/bin/env bash",
+			wantInterpreter: "/usr/bin/env",
+		},
+		{
+			name:            "ArgsOverShebang",
+			script:          types.Script{Args: "-c /bin/zsh", Script: "#!/bin/bash\necho post\n"},
+			wantArgs:        "-c /bin/zsh",
+			wantInterpreter: "/bin/zsh",
+		},
+		{
+			name:   "EmptyShebang",
+			script: types.Script{Script: "#!\necho post\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := shebangShell(tt.script)
+			if s.Args != tt.wantArgs {
+				t.Errorf("got args %q, want %q", s.Args, tt.wantArgs)
+			}
+			if s.Script != tt.script.Script {
+				t.Errorf("script modified: %q", s.Script)
+			}
+			if got := sectionInterpreter(s); got != tt.wantInterpreter {
+				t.Errorf("got interpreter %q, want %q", got, tt.wantInterpreter)
+			}
+		})
+	}
+}
@@ -416,6 +416,12 @@ func makeFiles(rootPath string) error {
 	return nil
 }
 
+// BaseEnvironment returns the content of /.singularity.d/env/90-environment.sh
+// before the %environment section of a definition is appended to it.
+func BaseEnvironment() string {
+	return environmentShFileContent
+}
+
 func makeBaseEnv(rootPath string) (err error) {
 
 	var info os.FileInfo
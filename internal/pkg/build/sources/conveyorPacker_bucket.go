@@ -0,0 +1,41 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sylabs/singularity/internal/pkg/client/bucket"
+	"github.com/sylabs/singularity/pkg/build/types"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// BucketConveyorPacker only needs to hold a packer to pack the image it
+// pulls from an s3:// or gs:// object storage bucket.
+type BucketConveyorPacker struct {
+	LocalPacker
+}
+
+// Get downloads container from an object storage bucket
+func (cp *BucketConveyorPacker) Get(ctx context.Context, b *types.Bundle) (err error) {
+	sylog.Debugf("Getting container from %s object storage", b.Recipe.Header["bootstrap"])
+
+	ref := b.Recipe.Header["bootstrap"] + "://" + b.Recipe.Header["from"]
+
+	imagePath, err := bucket.Pull(ctx, b.Opts.ImgCache, ref, b.Opts.TmpDir, b.Opts.Buckets)
+	if err != nil {
+		return fmt.Errorf("while fetching object storage image: %v", err)
+	}
+
+	// insert base metadata before unpacking fs
+	if err = makeBaseEnv(b.RootfsPath); err != nil {
+		return fmt.Errorf("while inserting base environment: %v", err)
+	}
+
+	cp.LocalPacker, err = GetLocalPacker(imagePath, b)
+	return err
+}
@@ -30,6 +30,7 @@ import (
 	"github.com/containers/image/v5/types"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sylabs/singularity/internal/pkg/build/oci"
+	"github.com/sylabs/singularity/internal/pkg/remote"
 	"github.com/sylabs/singularity/internal/pkg/util/shell"
 	sytypes "github.com/sylabs/singularity/pkg/build/types"
 	"github.com/sylabs/singularity/pkg/image"
@@ -46,6 +47,8 @@ type OCIConveyorPacker struct {
 	policyCtx *signature.PolicyContext
 	imgConfig imgspecv1.ImageConfig
 	sysCtx    *types.SystemContext
+	// digest is the hex encoded sha256 digest of the source manifest
+	digest string
 }
 
 // Get downloads container information from the specified source
@@ -59,33 +62,53 @@ func (cp *OCIConveyorPacker) Get(ctx context.Context, b *sytypes.Bundle) (err er
 		return err
 	}
 
+	// add registry and namespace to reference if specified
+	ref := b.Recipe.Header["from"]
+	if b.Recipe.Header["namespace"] != "" {
+		ref = b.Recipe.Header["namespace"] + "/" + ref
+	}
+	if b.Recipe.Header["registry"] != "" {
+		ref = b.Recipe.Header["registry"] + "/" + ref
+	}
+	sylog.Debugf("Reference: %v", ref)
+
+	// the credentials given for the registry of the reference aren't sent
+	// to a mirror on another host
+	auth := cp.b.Opts.DockerAuthConfig
+	if b.Recipe.Header["bootstrap"] == "docker" {
+		if mirrored, moved := cp.b.Opts.Mirrors.RewriteRegistry(remote.MirrorDocker, ref); mirrored != ref {
+			sylog.Verbosef("Pulling %s from mirror %s", ref, mirrored)
+			ref = mirrored
+			if moved {
+				auth = nil
+			}
+		}
+	}
+
+	// only the registry of the reference is checked against the insecure
+	// registries, the other ones still require a secure connection
+	noHTTPS := cp.b.Opts.NoHTTPS
+	if b.Recipe.Header["bootstrap"] == "docker" && remote.InsecureRegistry(cp.b.Opts.InsecureRegistries, ref) {
+		noHTTPS = true
+	}
+
 	// DockerInsecureSkipTLSVerify is set only if --nohttps is specified to honor
 	// configuration from /etc/containers/registries.conf because DockerInsecureSkipTLSVerify
 	// can have three possible values true/false and undefined, so we left it as undefined instead
 	// of forcing it to false in order to delegate decision to /etc/containers/registries.conf:
 	// https://github.com/sylabs/singularity/issues/5172
 	cp.sysCtx = &types.SystemContext{
-		OCIInsecureSkipTLSVerify: cp.b.Opts.NoHTTPS,
-		DockerAuthConfig:         cp.b.Opts.DockerAuthConfig,
+		OCIInsecureSkipTLSVerify: noHTTPS,
+		DockerAuthConfig:         auth,
 		OSChoice:                 "linux",
 		AuthFilePath:             syfs.DockerConf(),
 		DockerRegistryUserAgent:  useragent.Value(),
 		BigFilesTemporaryDir:     b.TmpDir,
 	}
-	if cp.b.Opts.NoHTTPS {
+	if noHTTPS {
 		cp.sysCtx.DockerInsecureSkipTLSVerify = types.NewOptionalBool(true)
 	}
 
-	// add registry and namespace to reference if specified
-	ref := b.Recipe.Header["from"]
-	if b.Recipe.Header["namespace"] != "" {
-		ref = b.Recipe.Header["namespace"] + "/" + ref
-	}
-	if b.Recipe.Header["registry"] != "" {
-		ref = b.Recipe.Header["registry"] + "/" + ref
-	}
-	sylog.Debugf("Reference: %v", ref)
-
 	switch b.Recipe.Header["bootstrap"] {
 	case "docker":
 		ref = "//" + ref
@@ -133,6 +156,17 @@ func (cp *OCIConveyorPacker) Get(ctx context.Context, b *sytypes.Bundle) (err er
 		return fmt.Errorf("invalid image source: %v", err)
 	}
 
+	// the tag is resolved once, the base image fetched is the one
+	// currently tagged
+	if cp.b.Opts.UpdateBase && b.Recipe.Header["bootstrap"] == "docker" {
+		pinned, err := oci.PinReference(ctx, cp.srcRef, cp.sysCtx)
+		if err != nil {
+			return fmt.Errorf("while resolving base image: %v", err)
+		}
+		sylog.Infof("Base image %s resolved to %s", strings.TrimPrefix(ref, "//"), pinned.DockerReference())
+		cp.srcRef = pinned
+	}
+
 	if !cp.b.Opts.NoCache {
 		// Grab the modified source ref from the cache
 		cp.srcRef, err = oci.ConvertReference(ctx, b.Opts.ImgCache, cp.srcRef, cp.sysCtx)
@@ -141,6 +175,12 @@ func (cp *OCIConveyorPacker) Get(ctx context.Context, b *sytypes.Bundle) (err er
 		}
 	}
 
+	// the digest of the source manifest is recorded in the image, the
+	// cache reference already resolved it
+	if cp.digest, err = oci.RefDigest(ctx, cp.srcRef, cp.sysCtx); err != nil {
+		sylog.Debugf("Could not get the digest of %s: %v", ref, err)
+	}
+
 	// To to do the RootFS extraction we also have to have a location that
 	// contains *only* this image
 	cp.tmpfsRef, err = ocilayout.ParseReference(cp.b.TmpDir + ":" + "tmp")
@@ -219,6 +259,14 @@ func (cp *OCIConveyorPacker) insertOCIConfig() error {
 	}
 
 	cp.b.JSONObjects[image.SIFDescOCIConfigJSON] = conf
+
+	if cp.digest != "" {
+		digest, err := json.Marshal("sha256:" + cp.digest)
+		if err != nil {
+			return err
+		}
+		cp.b.JSONObjects[image.SIFDescOCIDigestJSON] = digest
+	}
 	return nil
 }
 
@@ -318,85 +366,50 @@ func (cp *OCIConveyorPacker) insertRunScript() (err error) {
 
 	defer f.Close()
 
-	_, err = f.WriteString("#!/bin/sh\n")
+	_, err = f.WriteString(ociRunscript(cp.imgConfig.Entrypoint, cp.imgConfig.Cmd))
 	if err != nil {
 		return
 	}
 
-	if len(cp.imgConfig.Entrypoint) > 0 {
-		_, err = f.WriteString("OCI_ENTRYPOINT='" + shell.ArgsQuoted(cp.imgConfig.Entrypoint) + "'\n")
-		if err != nil {
-			return
-		}
-	} else {
-		_, err = f.WriteString("OCI_ENTRYPOINT=''\n")
-		if err != nil {
-			return
-		}
-	}
+	f.Sync()
 
-	if len(cp.imgConfig.Cmd) > 0 {
-		_, err = f.WriteString("OCI_CMD='" + shell.ArgsQuoted(cp.imgConfig.Cmd) + "'\n")
-		if err != nil {
-			return
-		}
-	} else {
-		_, err = f.WriteString("OCI_CMD=''\n")
-		if err != nil {
-			return
-		}
+	err = os.Chmod(cp.b.RootfsPath+"/.singularity.d/runscript", 0755)
+	if err != nil {
+		return
 	}
 
-	_, err = f.WriteString(`CMDLINE_ARGS=""
-# prepare command line arguments for evaluation
-for arg in "$@"; do
-    CMDLINE_ARGS="${CMDLINE_ARGS} \"$arg\""
-done
+	return nil
+}
 
-# ENTRYPOINT only - run entrypoint plus args
-if [ -z "$OCI_CMD" ] && [ -n "$OCI_ENTRYPOINT" ]; then
-    if [ $# -gt 0 ]; then
-        SINGULARITY_OCI_RUN="${OCI_ENTRYPOINT} ${CMDLINE_ARGS}"
-    else
-        SINGULARITY_OCI_RUN="${OCI_ENTRYPOINT}"
-    fi
-fi
+// singleQuoted returns s quoted for a shell assignment.
+func singleQuoted(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
 
-# CMD only - run CMD or override with args
-if [ -n "$OCI_CMD" ] && [ -z "$OCI_ENTRYPOINT" ]; then
-    if [ $# -gt 0 ]; then
-        SINGULARITY_OCI_RUN="${CMDLINE_ARGS}"
-    else
-        SINGULARITY_OCI_RUN="${OCI_CMD}"
-    fi
+// ociRunscript returns the runscript of an image with the OCI entrypoint
+// and cmd, which are combined like Docker does: the run arguments replace
+// cmd and are appended to entrypoint, cmd is the default arguments of
+// entrypoint or the default command without entrypoint. Both are in exec
+// form, neither they nor the run arguments are evaluated by the shell.
+func ociRunscript(entrypoint, cmd []string) string {
+	return `#!/bin/sh
+OCI_ENTRYPOINT=` + singleQuoted(shell.ArgsQuoted(entrypoint)) + `
+OCI_CMD=` + singleQuoted(shell.ArgsQuoted(cmd)) + `
+
+# CMD provides the default arguments, replaced by the run arguments
+if [ $# -eq 0 ]; then
+    eval "set -- ${OCI_CMD}"
 fi
+# ENTRYPOINT is prepended to the arguments, which are kept verbatim
+eval "set -- ${OCI_ENTRYPOINT} \"\$@\""
 
-# ENTRYPOINT and CMD - run ENTRYPOINT with CMD as default args
-# override with user provided args
-if [ $# -gt 0 ]; then
-    SINGULARITY_OCI_RUN="${OCI_ENTRYPOINT} ${CMDLINE_ARGS}"
-else
-    SINGULARITY_OCI_RUN="${OCI_ENTRYPOINT} ${OCI_CMD}"
+if [ $# -eq 0 ]; then
+    echo "No ENTRYPOINT or CMD set in the image and no command given" >&2
+    exit 1
 fi
 
-# Evaluate shell expressions first and set arguments accordingly,
-# then execute final command as first container process
-eval "set ${SINGULARITY_OCI_RUN}"
 exec "$@"
-
-`)
-	if err != nil {
-		return
-	}
-
-	f.Sync()
-
-	err = os.Chmod(cp.b.RootfsPath+"/.singularity.d/runscript", 0755)
-	if err != nil {
-		return
-	}
-
-	return nil
+`
 }
 
 func (cp *OCIConveyorPacker) insertEnv() (err error) {
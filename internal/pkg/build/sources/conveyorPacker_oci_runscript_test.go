@@ -0,0 +1,98 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestOCIRunscript checks that the runscript combines ENTRYPOINT, CMD and
+// the run arguments like docker run, the printed arguments are the
+// command line Docker would execute.
+func TestOCIRunscript(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oci-runscript-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	printArgs := []string{"printf", `%s\n`}
+
+	tests := []struct {
+		name       string
+		entrypoint []string
+		cmd        []string
+		args       []string
+		want       []string
+		wantErr    bool
+	}{
+		{
+			name:       "EntrypointAndCmd",
+			entrypoint: append(printArgs, "entrypoint"),
+			cmd:        []string{"cmd", "$HOME"},
+			want:       []string{"entrypoint", "cmd", "$HOME"},
+		},
+		{
+			name:       "EntrypointAndCmdWithArgs",
+			entrypoint: append(printArgs, "entrypoint"),
+			cmd:        []string{"cmd"},
+			args:       []string{"a b", `"quoted"`, "$(id)", "it's"},
+			want:       []string{"entrypoint", "a b", `"quoted"`, "$(id)", "it's"},
+		},
+		{
+			name:       "EntrypointOnly",
+			entrypoint: append(printArgs, "it's", "`date`"),
+			want:       []string{"it's", "`date`"},
+		},
+		{
+			name:       "EntrypointOnlyWithArgs",
+			entrypoint: append(printArgs, "entrypoint"),
+			args:       []string{"arg"},
+			want:       []string{"entrypoint", "arg"},
+		},
+		{
+			name: "CmdOnly",
+			cmd:  append(printArgs, "cmd", `back\slash`),
+			want: []string{"cmd", `back\slash`},
+		},
+		{
+			name: "CmdOnlyWithArgs",
+			cmd:  append(printArgs, "cmd"),
+			args: append(printArgs, "args"),
+			want: []string{"args"},
+		},
+		{
+			name:    "None",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runscript := filepath.Join(dir, tt.name)
+			if err := ioutil.WriteFile(runscript, []byte(ociRunscript(tt.entrypoint, tt.cmd)), 0755); err != nil {
+				t.Fatalf("failed to write runscript: %s", err)
+			}
+			out, err := exec.Command(runscript, tt.args...).Output()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got arguments %q, expected %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 
 	"github.com/sylabs/singularity/internal/pkg/client/oras"
+	"github.com/sylabs/singularity/internal/pkg/remote"
 	"github.com/sylabs/singularity/pkg/build/types"
 	"github.com/sylabs/singularity/pkg/sylog"
 )
@@ -24,12 +25,35 @@ type OrasConveyorPacker struct {
 func (cp *OrasConveyorPacker) Get(ctx context.Context, b *types.Bundle) (err error) {
 	sylog.Debugf("Getting container from registry using ORAS")
 
+	// the credentials given for the registry of the reference aren't sent
+	// to a mirror on another host
+	from := b.Recipe.Header["from"]
+	auth := b.Opts.DockerAuthConfig
+	if mirrored, moved := b.Opts.Mirrors.RewriteRegistry(remote.MirrorOras, from); mirrored != from {
+		sylog.Verbosef("Pulling %s from mirror %s", from, mirrored)
+		from = mirrored
+		if moved {
+			auth = nil
+		}
+	}
+
+	// the tag is resolved once, the base image fetched is the one
+	// currently tagged
+	if b.Opts.UpdateBase {
+		pinned, err := oras.PinReference(ctx, from, auth)
+		if err != nil {
+			return fmt.Errorf("while resolving base image: %v", err)
+		}
+		sylog.Infof("Base image %s resolved to %s", from, pinned)
+		from = pinned
+	}
+
 	// uri with leading // for oras handlers to consume
-	ref := "//" + b.Recipe.Header["from"]
+	ref := "//" + from
 	// full uri for name determination and output
 	fullRef := "oras:" + ref
 
-	imagePath, err := oras.Pull(ctx, b.Opts.ImgCache, fullRef, b.Opts.TmpDir, b.Opts.DockerAuthConfig)
+	imagePath, err := oras.Pull(ctx, b.Opts.ImgCache, fullRef, b.Opts.TmpDir, auth)
 	if err != nil {
 		return fmt.Errorf("while fetching library image: %v", err)
 	}
@@ -420,7 +420,7 @@ func (cp *ZypperConveyorPacker) copyPseudoDevices() (err error) {
 		d := int((dev.major << 8) | (dev.minor & 0xff) | ((dev.minor & 0xfff00) << 12))
 		path := filepath.Join(cp.b.RootfsPath, dev.path)
 
-		if err := syscall.Mknod(path, dev.mode, d); err != nil {
+		if err := mknod(path, dev.mode, d); err != nil {
 			return fmt.Errorf("while creating %s: %s", path, err)
 		}
 	}
@@ -0,0 +1,13 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import "fmt"
+
+// mknod creates the device node path with mode and device number dev.
+func mknod(path string, mode uint32, dev int) error {
+	return fmt.Errorf("device nodes are not supported on this platform")
+}
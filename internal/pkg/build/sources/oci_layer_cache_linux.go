@@ -0,0 +1,117 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// layerCache holds the root filesystems unpacked from the chains of layers
+// of OCI images, so an image sharing its first layers with a previously
+// unpacked image only unpacks the layers which differ. The least recently
+// used chains are removed when the cache grows above maxSize bytes.
+type layerCache struct {
+	h       *cache.Handle
+	layers  []imgspecv1.Descriptor
+	maxSize int64
+}
+
+// chainKey returns the cache key of the chain of the first n layers, the
+// key depends on the user unpacking them, as rootless unpacking maps all
+// files to the user.
+func (lc *layerCache) chainKey(n int) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "uid %d\n", os.Geteuid())
+	for _, l := range lc.layers[:n] {
+		fmt.Fprintf(h, "%s\n", l.Digest)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// restore copies the longest cached chain of the first layers to rootfs,
+// and returns its number of layers, or 0 if none is cached. Chains whose
+// next layer also appears among their layers are skipped, as unpacking
+// resumes from the first layer with the next layer digest.
+func (lc *layerCache) restore(rootfs string) (int, error) {
+	for n := len(lc.layers); n > 0; n-- {
+		if n < len(lc.layers) && lc.hasLayer(n, lc.layers[n]) {
+			continue
+		}
+
+		e, err := lc.h.GetDirEntry(cache.LayerCacheType, lc.chainKey(n))
+		if err != nil {
+			return 0, err
+		}
+		e.CleanTmp()
+		if !e.Exists {
+			continue
+		}
+
+		sylog.Debugf("Restoring %d cached layers from %s", n, e.Path)
+		if err := copyTree(e.Path, rootfs); err != nil {
+			return 0, fmt.Errorf("while restoring cached layers: %v", err)
+		}
+		return n, nil
+	}
+	return 0, nil
+}
+
+// hasLayer returns if the layer appears among the first n layers.
+func (lc *layerCache) hasLayer(n int, layer imgspecv1.Descriptor) bool {
+	for _, l := range lc.layers[:n] {
+		if l.Digest == layer.Digest {
+			return true
+		}
+	}
+	return false
+}
+
+// store copies rootfs, holding the first n layers unpacked, to the cache.
+func (lc *layerCache) store(rootfs string, n int) error {
+	e, err := lc.h.GetDirEntry(cache.LayerCacheType, lc.chainKey(n))
+	if err != nil {
+		return err
+	}
+	defer e.CleanTmp()
+
+	if e.Exists {
+		return nil
+	}
+
+	if size := cache.DirSize(rootfs); size > lc.maxSize {
+		sylog.Debugf("Not caching %d unpacked layers of %d bytes, above the layer cache size limit", n, size)
+		return nil
+	}
+
+	sylog.Debugf("Caching %d unpacked layers in %s", n, e.Path)
+	// the chain is identified by its last layer
+	e.Source = string(lc.layers[n-1].Digest)
+	if err := copyTree(rootfs, e.TmpPath); err != nil {
+		return fmt.Errorf("while caching unpacked layers: %v", err)
+	}
+	if err := e.Finalize(); err != nil {
+		return err
+	}
+	return lc.h.LimitCache(cache.LayerCacheType, lc.maxSize)
+}
+
+// copyTree copies the content of the directory src to dst, preserving
+// ownership, permissions, timestamps and extended attributes.
+func copyTree(src, dst string) error {
+	cmd := exec.Command("cp", "-a", src+`/.`, dst)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("cp: %v: %s", err, out)
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	ocilayout "github.com/containers/image/v5/oci/layout"
+	"github.com/opencontainers/go-digest"
+	imgspec "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	sytypes "github.com/sylabs/singularity/pkg/build/types"
+)
+
+var (
+	baseLayer = testLayer{
+		dir("a/"),
+		file("a/file1", "1"),
+		file("a/file2", "2"),
+		dir("b/"),
+		file("b/keep", "keep"),
+	}
+	whiteoutLayer = testLayer{
+		file("a/.wh.file1", ""),
+		file("c", "c"),
+	}
+	opaqueLayer = testLayer{
+		file("a/.wh..wh..opq", ""),
+		file("a/file3", "3"),
+	}
+	updateLayer = testLayer{
+		file("b/.wh.keep", ""),
+		file("d", "d"),
+	}
+)
+
+// writeBlob writes data to the blobs of the OCI layout at dir.
+func writeBlob(t *testing.T, dir, mediaType string, data []byte) imgspecv1.Descriptor {
+	d := digest.Digest(fmt.Sprintf("sha256:%x", sha256.Sum256(data)))
+	if err := ioutil.WriteFile(filepath.Join(dir, "blobs", "sha256", d.Hex()), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return imgspecv1.Descriptor{MediaType: mediaType, Digest: d, Size: int64(len(data))}
+}
+
+func writeJSONBlob(t *testing.T, dir, mediaType string, v interface{}) imgspecv1.Descriptor {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writeBlob(t, dir, mediaType, data)
+}
+
+// writeLayout writes an OCI layout at dir holding an image, tagged tmp,
+// made of layers.
+func writeLayout(t *testing.T, dir string, layers ...testLayer) {
+	if err := os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := imgspecv1.Manifest{Versioned: imgspec.Versioned{SchemaVersion: 2}}
+	config := imgspecv1.Image{
+		Architecture: "amd64",
+		OS:           "linux",
+		RootFS:       imgspecv1.RootFS{Type: "layers"},
+	}
+	for _, l := range layers {
+		desc := writeBlob(t, dir, imgspecv1.MediaTypeImageLayer, l.tar(t))
+		manifest.Layers = append(manifest.Layers, desc)
+		config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, desc.Digest)
+	}
+	manifest.Config = writeJSONBlob(t, dir, imgspecv1.MediaTypeImageConfig, config)
+
+	desc := writeJSONBlob(t, dir, imgspecv1.MediaTypeImageManifest, manifest)
+	desc.Annotations = map[string]string{imgspecv1.AnnotationRefName: "tmp"}
+	index := imgspecv1.Index{
+		Versioned: imgspec.Versioned{SchemaVersion: 2},
+		Manifests: []imgspecv1.Descriptor{desc},
+	}
+
+	data, err := json.Marshal(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "index.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	data, err = json.Marshal(imgspecv1.ImageLayout{Version: imgspecv1.ImageLayoutVersion})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, imgspecv1.ImageLayoutFile), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// unpackLayout unpacks the image of the OCI layout at dir to rootfs and
+// returns its content.
+func unpackLayout(t *testing.T, imgCache *cache.Handle, dir, rootfs string, noCache bool) map[string]string {
+	ref, err := ocilayout.ParseReference(dir + ":tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &sytypes.Bundle{
+		RootfsPath: rootfs,
+		TmpDir:     dir,
+		Opts:       sytypes.Options{ImgCache: imgCache, NoCache: noCache},
+	}
+	if err := unpackRootfs(context.Background(), b, ref, nil); err != nil {
+		t.Fatalf("while unpacking %s: %s", dir, err)
+	}
+	return treeContent(t, rootfs)
+}
+
+// treeContent returns the content of the files of the tree at root, by
+// path, directories have a trailing slash and no content.
+func treeContent(t *testing.T, root string) map[string]string {
+	content := make(map[string]string)
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || path == root {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		if fi.IsDir() {
+			content[rel+"/"] = ""
+			return nil
+		}
+		b, err := ioutil.ReadFile(path)
+		content[rel] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func TestLayerCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "layer-cache-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.ForceRemoveAll(dir)
+
+	imgCache, err := cache.New(cache.Config{ParentDir: filepath.Join(dir, "cache")})
+	if err != nil {
+		t.Fatalf("while creating image cache: %s", err)
+	}
+	cacheDir, err := imgCache.GetDirCacheDir(cache.LayerCacheType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	image := filepath.Join(dir, "image")
+	writeLayout(t, image, baseLayer, whiteoutLayer, opaqueLayer)
+	update := filepath.Join(dir, "update")
+	writeLayout(t, update, baseLayer, whiteoutLayer, updateLayer)
+
+	imageContent := map[string]string{"a/": "", "a/file3": "3", "b/": "", "b/keep": "keep", "c": "c"}
+	updateContent := map[string]string{"a/": "", "a/file2": "2", "b/": "", "c": "c", "d": "d"}
+
+	got := unpackLayout(t, imgCache, image, filepath.Join(dir, "rootfs1"), false)
+	if !reflect.DeepEqual(got, imageContent) {
+		t.Fatalf("got content %v, want %v", got, imageContent)
+	}
+
+	// only the chain of the first two layers is cached
+	ref, err := ocilayout.ParseReference(image + ":tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := ref.NewImageSource(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _, err := src.GetManifest(context.Background(), nil)
+	src.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest imgspecv1.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	lc := &layerCache{h: imgCache, layers: manifest.Layers}
+	if fs.IsDir(filepath.Join(cacheDir, lc.chainKey(3))) {
+		t.Errorf("chain of all layers cached")
+	}
+	chain := filepath.Join(cacheDir, lc.chainKey(2))
+	if !fs.IsDir(chain) {
+		t.Fatalf("chain of 2 layers not cached")
+	}
+	// mark the cached chain to check it's used
+	if err := ioutil.WriteFile(filepath.Join(chain, "cached"), []byte("cached"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// an update of the last layer only unpacks it on top of the cached chain
+	got = unpackLayout(t, imgCache, update, filepath.Join(dir, "rootfs2"), false)
+	if got["cached"] != "cached" {
+		t.Errorf("cached chain of 2 layers not used")
+	}
+	delete(got, "cached")
+	if !reflect.DeepEqual(got, updateContent) {
+		t.Errorf("got content %v, want %v", got, updateContent)
+	}
+
+	// the unpacked image is identical without cache
+	got = unpackLayout(t, imgCache, update, filepath.Join(dir, "rootfs3"), true)
+	if !reflect.DeepEqual(got, updateContent) {
+		t.Errorf("got content %v without cache, want %v", got, updateContent)
+	}
+
+	// an unchanged image only unpacks its last layer too
+	got = unpackLayout(t, imgCache, image, filepath.Join(dir, "rootfs4"), false)
+	if got["cached"] != "cached" {
+		t.Errorf("cached chain of 2 layers not used")
+	}
+	delete(got, "cached")
+	if !reflect.DeepEqual(got, imageContent) {
+		t.Errorf("got content %v, want %v", got, imageContent)
+	}
+
+	// nothing is cached with a size limit of 0
+	if err := imgCache.CleanCache(cache.LayerCacheType, false, -1); err != nil {
+		t.Fatalf("while cleaning layer cache: %s", err)
+	}
+	os.Setenv(cache.LayerCacheMaxSizeEnv, "0")
+	defer os.Unsetenv(cache.LayerCacheMaxSizeEnv)
+	got = unpackLayout(t, imgCache, image, filepath.Join(dir, "rootfs5"), false)
+	if !reflect.DeepEqual(got, imageContent) {
+		t.Errorf("got content %v, want %v", got, imageContent)
+	}
+	if entries, err := ioutil.ReadDir(cacheDir); err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 0 {
+		t.Errorf("%d layer cache entries with a size limit of 0", len(entries))
+	}
+
+	if err := imgCache.CleanCache(cache.LayerCacheType, false, 0); err != nil {
+		t.Fatalf("while cleaning layer cache: %s", err)
+	}
+	entries, err := ioutil.ReadDir(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("%d layer cache entries left after clean", len(entries))
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	securejoin "github.com/cyphar/filepath-securejoin"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/opencontainers/umoci/oci/casext"
+	umocilayer "github.com/opencontainers/umoci/oci/layer"
+	"github.com/opencontainers/umoci/pkg/fseval"
+	"github.com/opencontainers/umoci/pkg/idtools"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+const (
+	// whiteoutPrefix prefixes the name of the files removed by a layer.
+	whiteoutPrefix = ".wh."
+	// whiteoutOpaque is the name of the file marking a directory whose
+	// content from the lower layers is removed by a layer.
+	whiteoutOpaque = whiteoutPrefix + whiteoutPrefix + ".opq"
+)
+
+// unpackLayers unpacks the layers of the image manifest from the OCI layout
+// engine to rootfs, starting from the layer startFrom if its media type is
+// set. The callback, if any, is called after each unpacked layer.
+func unpackLayers(ctx context.Context, engine casext.Engine, rootfs string, manifest imgspecv1.Manifest, opts *umocilayer.MapOptions, callback umocilayer.AfterLayerUnpackCallback, startFrom imgspecv1.Descriptor) (err error) {
+	if err := os.Mkdir(rootfs, 0755); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("while creating %s: %s", rootfs, err)
+	}
+	// rootless unpacking may leave files which can't be removed with
+	// a simple recursive removal
+	defer func() {
+		if err != nil {
+			layerFsEval(opts).RemoveAll(rootfs)
+		}
+	}()
+
+	rootUID, err := idtools.ToHost(0, opts.UIDMappings)
+	if err != nil {
+		return fmt.Errorf("while mapping root user: %s", err)
+	}
+	rootGID, err := idtools.ToHost(0, opts.GIDMappings)
+	if err != nil {
+		return fmt.Errorf("while mapping root group: %s", err)
+	}
+	if err := os.Lchown(rootfs, rootUID, rootGID); err != nil {
+		return fmt.Errorf("while changing %s ownership: %s", rootfs, err)
+	}
+	// most images don't hold an entry for the root directory, set its
+	// times to a fixed value for reproducible unpacking
+	epoch := time.Unix(0, 0)
+	if err := layerFsEval(opts).Lutimes(rootfs, epoch, epoch); err != nil {
+		return fmt.Errorf("while setting %s times: %s", rootfs, err)
+	}
+
+	configBlob, err := engine.FromDescriptor(ctx, manifest.Config)
+	if err != nil {
+		return fmt.Errorf("while getting image config: %s", err)
+	}
+	defer configBlob.Close()
+	config, ok := configBlob.Data.(imgspecv1.Image)
+	if !ok {
+		return fmt.Errorf("image config has unexpected media type %s", configBlob.Descriptor.MediaType)
+	}
+	if config.RootFS.Type != "layers" {
+		return fmt.Errorf("unsupported image rootfs type %q", config.RootFS.Type)
+	}
+	if len(config.RootFS.DiffIDs) != len(manifest.Layers) {
+		return fmt.Errorf("image config holds %d layer diff IDs for %d layers", len(config.RootFS.DiffIDs), len(manifest.Layers))
+	}
+
+	found := startFrom.MediaType == ""
+	for i, desc := range manifest.Layers {
+		if !found && desc.Digest != startFrom.Digest {
+			continue
+		}
+		found = true
+
+		sylog.Debugf("Unpacking layer %s", desc.Digest)
+		if err := unpackLayer(ctx, engine, rootfs, desc, config.RootFS.DiffIDs[i], opts); err != nil {
+			return fmt.Errorf("while unpacking layer %s: %s", desc.Digest, err)
+		}
+		if callback != nil {
+			if err := callback(manifest, desc); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// unpackLayer applies the layer desc from the OCI layout engine to rootfs
+// and checks its uncompressed content matches diffID.
+func unpackLayer(ctx context.Context, engine casext.Engine, rootfs string, desc imgspecv1.Descriptor, diffID digest.Digest, opts *umocilayer.MapOptions) error {
+	blob, err := engine.FromDescriptor(ctx, desc)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	data, ok := blob.Data.(io.ReadCloser)
+	if !ok {
+		return fmt.Errorf("unexpected media type %s", desc.MediaType)
+	}
+
+	var r io.Reader
+	switch desc.MediaType {
+	case imgspecv1.MediaTypeImageLayer, imgspecv1.MediaTypeImageLayerNonDistributable:
+		r = data
+	case imgspecv1.MediaTypeImageLayerGzip, imgspecv1.MediaTypeImageLayerNonDistributableGzip:
+		gz, err := gzip.NewReader(data)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	default:
+		return fmt.Errorf("unsupported media type %s", desc.MediaType)
+	}
+
+	digester := digest.SHA256.Digester()
+	r = io.TeeReader(r, digester.Hash())
+	if err := applyLayer(rootfs, r, opts); err != nil {
+		return err
+	}
+	// the tar reader may not consume the padding at the end of the layer
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		return err
+	}
+	if d := digester.Digest(); d != diffID {
+		return fmt.Errorf("layer diff ID %s doesn't match the image config diff ID %s", d, diffID)
+	}
+	return nil
+}
+
+// layerFsEval returns the file operations for the unpacking options.
+func layerFsEval(opts *umocilayer.MapOptions) fseval.FsEval {
+	if opts != nil && opts.Rootless {
+		return fseval.RootlessFsEval
+	}
+	return fseval.DefaultFsEval
+}
+
+// applyLayer applies the layer tar stream to root, following the OCI image
+// layer specification: the entries of the layer are extracted, replacing the
+// lower layers entries, a whiteout file .wh.<name> removes <name> from the
+// lower layers and an opaque whiteout .wh..wh..opq removes the content of
+// its directory from the lower layers.
+//
+// Whiteouts only apply to the lower layers, whatever their position in the
+// layer, so they are applied once all the layer entries are extracted. This
+// also lets hard links of the layer point to files of the lower layers
+// removed by the layer.
+func applyLayer(root string, layer io.Reader, opts *umocilayer.MapOptions) error {
+	var mapOptions umocilayer.MapOptions
+	if opts != nil {
+		mapOptions = *opts
+	}
+	te := umocilayer.NewTarExtractor(mapOptions)
+
+	// paths extracted from the layer and their parent directories,
+	// relative to root, they are kept by whiteouts
+	upper := make(map[string]struct{})
+	var whiteouts []string
+
+	tr := tar.NewReader(layer)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("while reading layer: %s", err)
+		}
+
+		name := strings.TrimPrefix(umocilayer.CleanPath("/"+hdr.Name), "/")
+		if strings.HasPrefix(filepath.Base(name), whiteoutPrefix) {
+			whiteouts = append(whiteouts, name)
+			continue
+		}
+		if err := te.UnpackEntry(root, hdr, tr); err != nil {
+			return fmt.Errorf("while unpacking %s: %s", hdr.Name, err)
+		}
+		for p := name; p != "." && p != "" && p != "/"; p = filepath.Dir(p) {
+			if _, ok := upper[p]; ok {
+				break
+			}
+			upper[p] = struct{}{}
+		}
+	}
+
+	fsEval := layerFsEval(opts)
+	for _, wh := range whiteouts {
+		if err := applyWhiteout(fsEval, root, wh, upper); err != nil {
+			return fmt.Errorf("while applying whiteout %s: %s", wh, err)
+		}
+	}
+	return nil
+}
+
+// applyWhiteout removes the target of the whiteout wh, relative to root,
+// keeping the paths extracted from the layer.
+func applyWhiteout(fsEval fseval.FsEval, root, wh string, upper map[string]struct{}) error {
+	dir, file := filepath.Split(wh)
+	opaque := file == whiteoutOpaque
+
+	// resolve symbolic links of the parent directory within root, the
+	// target itself isn't followed
+	parent, err := securejoin.SecureJoinVFS(root, dir, fsEval)
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(parent, strings.TrimPrefix(file, whiteoutPrefix))
+	if opaque {
+		target = parent
+	}
+	if _, err := fsEval.Lstat(target); err != nil {
+		// the target may have already been removed by another whiteout
+		if securejoin.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	// keep the modification time of the parent directory, as set by the
+	// layer entry if any
+	if fi, err := fsEval.Lstat(filepath.Dir(target)); err == nil && target != root {
+		defer fsEval.Lutimes(filepath.Dir(target), fi.ModTime(), fi.ModTime())
+	}
+
+	return fsEval.Walk(target, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if _, ok := upper[rel]; ok || (opaque && path == target) {
+			return nil
+		}
+		if err := fsEval.RemoveAll(path); err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
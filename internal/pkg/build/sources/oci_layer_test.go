@@ -0,0 +1,252 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+)
+
+// layerEntry is an entry of a synthetic layer.
+type layerEntry struct {
+	hdr     tar.Header
+	content string
+}
+
+// testLayer is the content of a synthetic layer.
+type testLayer []layerEntry
+
+func dir(name string) layerEntry {
+	return layerEntry{hdr: tar.Header{Name: name, Mode: 0755, Typeflag: tar.TypeDir}}
+}
+
+func file(name, content string) layerEntry {
+	return layerEntry{
+		hdr:     tar.Header{Name: name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(content))},
+		content: content,
+	}
+}
+
+func symlink(name, target string) layerEntry {
+	return layerEntry{hdr: tar.Header{Name: name, Mode: 0777, Typeflag: tar.TypeSymlink, Linkname: target}}
+}
+
+func hardlink(name, target string) layerEntry {
+	return layerEntry{hdr: tar.Header{Name: name, Mode: 0644, Typeflag: tar.TypeLink, Linkname: target}}
+}
+
+func (l testLayer) tar(t *testing.T) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range l {
+		hdr := e.hdr
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// treeEntries returns a description of the entries of the tree at root, by
+// path: directories have a trailing slash and no content, files have their
+// content and symbolic links their target preceded by an arrow.
+func treeEntries(t *testing.T, root string) map[string]string {
+	entries := make(map[string]string)
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || path == root {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		switch {
+		case fi.IsDir():
+			entries[rel+"/"] = ""
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			entries[rel] = "-> " + target
+			return err
+		default:
+			b, err := ioutil.ReadFile(path)
+			entries[rel] = string(b)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestApplyLayer(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "apply-layer-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.ForceRemoveAll(tmpDir)
+
+	opts, err := unpackMapOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lower := testLayer{
+		dir("a/"),
+		file("a/file1", "1"),
+		file("a/file2", "2"),
+		dir("b/"),
+		dir("b/c/"),
+		file("b/c/d", "d"),
+		symlink("l", "a"),
+	}
+	lowerEntries := map[string]string{
+		"a/": "", "a/file1": "1", "a/file2": "2",
+		"b/": "", "b/c/": "", "b/c/d": "d",
+		"l": "-> a",
+	}
+
+	tests := []struct {
+		name string
+		// layer is applied on top of the lower layer
+		layer testLayer
+		// removed and added are the entries differing from the lower layer
+		removed []string
+		added   map[string]string
+		// links are paths which must be hard links to the same file
+		links [2]string
+	}{
+		{
+			name:    "Whiteout",
+			layer:   testLayer{file("a/.wh.file1", "")},
+			removed: []string{"a/file1"},
+		},
+		{
+			name:  "WhiteoutMissing",
+			layer: testLayer{file(".wh.missing", ""), file("missing/.wh.file", "")},
+		},
+		{
+			name:  "WhiteoutBeforeEntry",
+			layer: testLayer{file("a/.wh.file1", ""), file("a/file1", "new")},
+			added: map[string]string{"a/file1": "new"},
+		},
+		{
+			name:  "WhiteoutAfterEntry",
+			layer: testLayer{file("a/file1", "new"), file("a/.wh.file1", "")},
+			added: map[string]string{"a/file1": "new"},
+		},
+		{
+			name:    "WhiteoutDirectory",
+			layer:   testLayer{file("b/.wh.c", "")},
+			removed: []string{"b/c/", "b/c/d"},
+		},
+		{
+			name:    "WhiteoutDirectoryRecreated",
+			layer:   testLayer{file(".wh.b", ""), dir("b/"), file("b/new", "new")},
+			removed: []string{"b/c/", "b/c/d"},
+			added:   map[string]string{"b/new": "new"},
+		},
+		{
+			name:    "WhiteoutSymlink",
+			layer:   testLayer{file(".wh.l", "")},
+			removed: []string{"l"},
+		},
+		{
+			name:    "OpaqueBeforeEntries",
+			layer:   testLayer{file("a/.wh..wh..opq", ""), file("a/file3", "3")},
+			removed: []string{"a/file1", "a/file2"},
+			added:   map[string]string{"a/file3": "3"},
+		},
+		{
+			name:    "OpaqueAfterEntries",
+			layer:   testLayer{file("a/file3", "3"), file("a/file1", "new"), file("a/.wh..wh..opq", "")},
+			removed: []string{"a/file2"},
+			added:   map[string]string{"a/file1": "new", "a/file3": "3"},
+		},
+		{
+			name:    "OpaqueNested",
+			layer:   testLayer{file("b/.wh..wh..opq", ""), file("b/c/e", "e")},
+			removed: []string{"b/c/d"},
+			added:   map[string]string{"b/c/e": "e"},
+		},
+		{
+			name:    "HardlinkToWhiteout",
+			layer:   testLayer{file("a/.wh.file1", ""), hardlink("a/link", "a/file1")},
+			removed: []string{"a/file1"},
+			added:   map[string]string{"a/link": "1"},
+		},
+		{
+			name:    "HardlinkToOpaque",
+			layer:   testLayer{file("a/.wh..wh..opq", ""), hardlink("a/link", "a/file2")},
+			removed: []string{"a/file1", "a/file2"},
+			added:   map[string]string{"a/link": "2"},
+		},
+		{
+			name:  "HardlinkInLayer",
+			layer: testLayer{file("a/file1", "new"), hardlink("a/link", "a/file1"), file("a/.wh.file1", "")},
+			added: map[string]string{"a/file1": "new", "a/link": "new"},
+			links: [2]string{"a/file1", "a/link"},
+		},
+		{
+			name:    "CaseColliding",
+			layer:   testLayer{file("a/File1", "F"), file("a/.wh.file1", ""), file("a/.WH.file2", "W")},
+			removed: []string{"a/file1"},
+			added:   map[string]string{"a/File1": "F", "a/.WH.file2": "W"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := filepath.Join(tmpDir, tt.name)
+			if err := os.MkdirAll(root, 0755); err != nil {
+				t.Fatal(err)
+			}
+			for _, l := range []testLayer{lower, tt.layer} {
+				if err := applyLayer(root, bytes.NewReader(l.tar(t)), &opts); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+
+			want := make(map[string]string)
+			for k, v := range lowerEntries {
+				want[k] = v
+			}
+			for _, k := range tt.removed {
+				delete(want, k)
+			}
+			for k, v := range tt.added {
+				want[k] = v
+			}
+			if got := treeEntries(t, root); !reflect.DeepEqual(got, want) {
+				t.Errorf("got entries %v, want %v", got, want)
+			}
+
+			if tt.links[0] != "" {
+				var st [2]syscall.Stat_t
+				for i, l := range tt.links {
+					if err := syscall.Lstat(filepath.Join(root, l), &st[i]); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if st[0].Ino != st[1].Ino {
+					t.Errorf("%s and %s aren't hard links to the same file", tt.links[0], tt.links[1])
+				}
+			}
+		})
+	}
+}
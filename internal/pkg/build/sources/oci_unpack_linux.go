@@ -22,6 +22,7 @@ import (
 	"github.com/opencontainers/umoci"
 	umocilayer "github.com/opencontainers/umoci/oci/layer"
 	"github.com/opencontainers/umoci/pkg/idtools"
+	"github.com/sylabs/singularity/internal/pkg/cache"
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
 	sytypes "github.com/sylabs/singularity/pkg/build/types"
 	"github.com/sylabs/singularity/pkg/sylog"
@@ -29,8 +30,6 @@ import (
 
 // unpackRootfs extracts all of the layers of the given image reference into the rootfs of the provided bundle
 func unpackRootfs(ctx context.Context, b *sytypes.Bundle, tmpfsRef types.ImageReference, sysCtx *types.SystemContext) (err error) {
-	var mapOptions umocilayer.MapOptions
-
 	loggerLevel := sylog.GetLevel()
 
 	// set the apex log level, for umoci
@@ -48,21 +47,9 @@ func unpackRootfs(ctx context.Context, b *sytypes.Bundle, tmpfsRef types.ImageRe
 		apexlog.SetLevel(apexlog.DebugLevel)
 	}
 
-	// Allow unpacking as non-root
-	if os.Geteuid() != 0 {
-		mapOptions.Rootless = true
-
-		uidMap, err := idtools.ParseMapping(fmt.Sprintf("0:%d:1", os.Geteuid()))
-		if err != nil {
-			return fmt.Errorf("error parsing uidmap: %s", err)
-		}
-		mapOptions.UIDMappings = append(mapOptions.UIDMappings, uidMap)
-
-		gidMap, err := idtools.ParseMapping(fmt.Sprintf("0:%d:1", os.Getegid()))
-		if err != nil {
-			return fmt.Errorf("error parsing gidmap: %s", err)
-		}
-		mapOptions.GIDMappings = append(mapOptions.GIDMappings, gidMap)
+	mapOptions, err := unpackMapOptions()
+	if err != nil {
+		return err
 	}
 
 	engineExt, err := umoci.OpenLayout(b.TmpDir)
@@ -85,13 +72,65 @@ func unpackRootfs(ctx context.Context, b *sytypes.Bundle, tmpfsRef types.ImageRe
 	var manifest imgspecv1.Manifest
 	json.Unmarshal(manifestData, &manifest)
 
-	// UnpackRootfs from umoci v0.4.2 expects a path to a non-existing directory
+	// unpackLayers expects a path to a non-existing directory
 	os.RemoveAll(b.RootfsPath)
 
-	// Unpack root filesystem
-	err = umocilayer.UnpackRootfs(ctx, engineExt, b.RootfsPath, manifest, &mapOptions, nil, imgspecv1.Descriptor{})
-	if err != nil {
-		return fmt.Errorf("error unpacking rootfs: %s", err)
+	// Restore the longest chain of the first layers already unpacked from
+	// the layer cache, only the following layers are unpacked
+	var lc *layerCache
+	var cached int
+	if b.Opts.ImgCache != nil && !b.Opts.ImgCache.IsDisabled() && !b.Opts.NoCache {
+		maxSize, err := cache.LayerCacheMaxSize()
+		if err != nil {
+			sylog.Warningf("Not caching unpacked layers: %s", err)
+		} else if maxSize > 0 {
+			lc = &layerCache{h: b.Opts.ImgCache, layers: manifest.Layers, maxSize: maxSize}
+		}
+	}
+	if lc != nil {
+		cached, err = lc.restore(b.RootfsPath)
+		if err != nil {
+			sylog.Warningf("Unpacking all layers: %s", err)
+			fs.ForceRemoveAll(b.RootfsPath)
+			cached = 0
+		}
+	}
+
+	if cached == 0 || cached < len(manifest.Layers) {
+		var startFrom imgspecv1.Descriptor
+		if cached > 0 {
+			sylog.Infof("Using %d cached layers, unpacking %d layers", cached, len(manifest.Layers)-cached)
+			startFrom = manifest.Layers[cached]
+		}
+
+		// cache a single chain, of all layers but the last one which is
+		// the one usually changing between two versions of an image, or
+		// of the only layer
+		var callback umocilayer.AfterLayerUnpackCallback
+		unpacked := cached
+		if lc != nil {
+			chain := len(manifest.Layers) - 1
+			if chain == 0 {
+				chain = 1
+			}
+			callback = func(_ imgspecv1.Manifest, _ imgspecv1.Descriptor) error {
+				unpacked++
+				if unpacked == chain {
+					if err := lc.store(b.RootfsPath, unpacked); err != nil {
+						sylog.Warningf("Could not cache unpacked layers: %s", err)
+					}
+				}
+				return nil
+			}
+		}
+
+		// Unpack root filesystem
+		err = unpackLayers(ctx, engineExt, b.RootfsPath, manifest, &mapOptions, callback, startFrom)
+		if err != nil {
+			return fmt.Errorf("error unpacking rootfs: %s", err)
+		}
+	} else {
+		sylog.Infof("Using %d cached layers", cached)
 	}
 
 	// If the `--fix-perms` flag was used, then modify the permissions so that
@@ -115,6 +154,29 @@ func unpackRootfs(ctx context.Context, b *sytypes.Bundle, tmpfsRef types.ImageRe
 
 }
 
+// unpackMapOptions returns the options mapping the owner of the unpacked
+// files, allowing unpacking as non-root.
+func unpackMapOptions() (umocilayer.MapOptions, error) {
+	var mapOptions umocilayer.MapOptions
+
+	if os.Geteuid() != 0 {
+		mapOptions.Rootless = true
+
+		uidMap, err := idtools.ParseMapping(fmt.Sprintf("0:%d:1", os.Geteuid()))
+		if err != nil {
+			return mapOptions, fmt.Errorf("error parsing uidmap: %s", err)
+		}
+		mapOptions.UIDMappings = append(mapOptions.UIDMappings, uidMap)
+
+		gidMap, err := idtools.ParseMapping(fmt.Sprintf("0:%d:1", os.Getegid()))
+		if err != nil {
+			return mapOptions, fmt.Errorf("error parsing gidmap: %s", err)
+		}
+		mapOptions.GIDMappings = append(mapOptions.GIDMappings, gidMap)
+	}
+	return mapOptions, nil
+}
+
 // fixPerms will work through the rootfs of this bundle, making sure that all
 // files and directories have permissions set such that the owner can read,
 // modify, delete. This brings us to the situation of <=3.4
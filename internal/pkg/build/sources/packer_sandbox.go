@@ -10,6 +10,7 @@ import (
 	"context"
 	"fmt"
 	"os/exec"
+	"time"
 
 	"github.com/sylabs/singularity/pkg/build/types"
 	"github.com/sylabs/singularity/pkg/sylog"
@@ -26,14 +27,38 @@ type SandboxPacker struct {
 func (p *SandboxPacker) Pack(context.Context) (*types.Bundle, error) {
 	rootfs := p.srcdir
 
-	// copy filesystem into bundle rootfs
+	// copy filesystem into bundle rootfs, the source sandbox is never
+	// modified by the build. The copy is a copy-on-write clone sharing
+	// the file data with the source sandbox when the file system
+	// supports reflinks
 	sylog.Debugf("Copying file system from %s to %s in Bundle\n", rootfs, p.b.RootfsPath)
+	start := time.Now()
+	var opts []string
+	if ok, err := reflinkSupported(rootfs, p.b.RootfsPath); err != nil {
+		return nil, fmt.Errorf("while checking reflink support: %s", err)
+	} else if ok {
+		opts = append(opts, "--reflink=auto")
+	} else {
+		sylog.Debugf("Reflink copy not supported, copying file system")
+	}
+	if err := copySandbox(rootfs, p.b.RootfsPath, opts...); err != nil {
+		return nil, err
+	}
+	sylog.Verbosef("Copied sandbox %s in %s", rootfs, time.Since(start).Round(time.Millisecond))
+
+	return p.b, nil
+}
+
+// copySandbox copies the content of the directory src into the
+// directory dst with cp and the additional options opts.
+func copySandbox(src, dst string, opts ...string) error {
 	var stderr bytes.Buffer
-	cmd := exec.Command("cp", "-a", rootfs+`/.`, p.b.RootfsPath)
+
+	args := append([]string{"-a"}, opts...)
+	cmd := exec.Command("cp", append(args, src+`/.`, dst)...)
 	cmd.Stderr = &stderr
 	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("cp Failed: %v: %v", err, stderr.String())
+		return fmt.Errorf("cp Failed: %v: %v", err, stderr.String())
 	}
-
-	return p.b, nil
+	return nil
 }
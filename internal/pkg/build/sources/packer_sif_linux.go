@@ -8,12 +8,18 @@ package sources
 import (
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
 
+	"github.com/sylabs/singularity/internal/pkg/sandbox"
 	"github.com/sylabs/singularity/pkg/build/types"
 	"github.com/sylabs/singularity/pkg/image"
 	"github.com/sylabs/singularity/pkg/image/unpacker"
 	"github.com/sylabs/singularity/pkg/sylog"
+	"golang.org/x/sys/unix"
 )
 
 // Pack puts relevant objects in a Bundle.
@@ -38,18 +44,25 @@ func unpackSIF(b *types.Bundle, img *image.Image) (err error) {
 
 	switch part.Type {
 	case image.SQUASHFS:
-		// create a reader for rootfs partition
-		reader, err := image.NewPartitionReader(img, "", 0)
+		start := time.Now()
+
+		// unsquashfs requires a seekable file, the partition is
+		// staged next to the bundle root filesystem
+		staging, err := stagePartition(img, part, filepath.Dir(b.RootfsPath))
 		if err != nil {
 			return fmt.Errorf("could not extract root filesystem: %s", err)
 		}
+		defer staging.Close()
+		sylog.Verbosef("Staged %d MiB root filesystem partition of %s in %s", part.Size>>20, img.Path, time.Since(start).Round(time.Millisecond))
 
 		s := unpacker.NewSquashfs()
 
 		// extract root filesystem
-		if err := s.ExtractAll(reader, b.RootfsPath); err != nil {
+		start = time.Now()
+		if err := s.ExtractAll(staging, b.RootfsPath); err != nil {
 			return fmt.Errorf("root filesystem extraction failed: %s", err)
 		}
+		sylog.Verbosef("Extracted root filesystem of %s in %s", img.Path, time.Since(start).Round(time.Millisecond))
 	case image.EXT3:
 
 		// extract ext3 partition by mounting
@@ -73,5 +86,88 @@ func unpackSIF(b *types.Bundle, img *image.Image) (err error) {
 		}
 		b.JSONObjects[image.SIFDescOCIConfigJSON] = ociConfig
 	}
+
+	if b.Opts.SandboxTarget && img.Type == image.SIF {
+		if err := recordSource(b, img); err != nil {
+			return fmt.Errorf("while recording signed source: %s", err)
+		}
+	}
+	return nil
+}
+
+// recordSource records the signed image img the bundle root filesystem
+// is extracted from, the sandbox is later verified against the signed
+// root filesystem partition of img.
+func recordSource(b *types.Bundle, img *image.Image) error {
+	path, err := filepath.Abs(img.Path)
+	if err != nil {
+		return err
+	}
+	s, err := sandbox.NewSource(path, sandbox.PreservesOwners())
+	if err == sandbox.ErrNoSource {
+		sylog.Debugf("No signature of the root filesystem found in %s", img.Path)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return sandbox.WriteSource(b.RootfsPath, s)
+}
+
+// stagePartition copies the image partition part into an unlinked
+// temporary file created in the directory dir. The copy is done by the
+// kernel with copy_file_range, on file systems supporting reflinks like
+// btrfs or XFS the staging file shares its data blocks with the image,
+// so the image is never read back nor modified.
+func stagePartition(img *image.Image, part *image.Section, dir string) (*os.File, error) {
+	f, err := ioutil.TempFile(dir, "partition-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging file: %s", err)
+	}
+	// the file is deleted once closed
+	if err := os.Remove(f.Name()); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to unlink staging file: %s", err)
+	}
+	if err := copyRange(f, img.File, int64(part.Offset), int64(part.Size)); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to copy partition in staging file: %s", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// copyRange copies size bytes read at offset off from src to the start
+// of dst, it falls back to a regular copy if copy_file_range is not
+// supported between the two files.
+func copyRange(dst, src *os.File, off, size int64) error {
+	var written int64
+
+	for written < size {
+		n, err := unix.CopyFileRange(int(src.Fd()), &off, int(dst.Fd()), &written, int(size-written), 0)
+		switch err {
+		case nil:
+			if n == 0 {
+				return io.ErrUnexpectedEOF
+			}
+			continue
+		case unix.ENOSYS, unix.EXDEV, unix.EINVAL, unix.EOPNOTSUPP:
+			sylog.Debugf("copy_file_range not supported (%s), copying partition data", err)
+		default:
+			return err
+		}
+		if _, err := dst.Seek(written, io.SeekStart); err != nil {
+			return err
+		}
+		n64, err := io.Copy(dst, io.NewSectionReader(src, off, size-written))
+		if err != nil {
+			return err
+		} else if n64 != size-written {
+			return io.ErrUnexpectedEOF
+		}
+		written = size
+	}
 	return nil
 }
@@ -0,0 +1,76 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/sylabs/singularity/pkg/image"
+)
+
+func TestStagePartition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stage-partition-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	header := bytes.Repeat([]byte("h"), 4096)
+	data := bytes.Repeat([]byte("squashfs data\n"), 100000)
+	trailer := bytes.Repeat([]byte("t"), 512)
+	content := append(append(append([]byte{}, header...), data...), trailer...)
+
+	path := dir + "/image.sif"
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	img := &image.Image{Path: path, File: f}
+	part := &image.Section{Offset: uint64(len(header)), Size: uint64(len(data))}
+
+	staging, err := stagePartition(img, part, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer staging.Close()
+
+	got, err := ioutil.ReadAll(staging)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("staged %d bytes differing from the %d bytes partition", len(got), len(data))
+	}
+
+	// the staging file is unlinked and the image is left untouched
+	if entries, err := ioutil.ReadDir(dir); err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 1 {
+		t.Errorf("found %d files in staging directory, want 1", len(entries))
+	}
+	after, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(after, content) {
+		t.Errorf("image was modified by the staging copy")
+	}
+
+	// partition going past the end of the image
+	part.Size += uint64(len(trailer)) + 1
+	if staging, err := stagePartition(img, part, dir); err == nil {
+		staging.Close()
+		t.Errorf("unexpected success with a truncated partition")
+	}
+}
@@ -8,10 +8,13 @@ package sources
 import (
 	"context"
 	"fmt"
+	"io"
+	"time"
 
 	"github.com/sylabs/singularity/pkg/build/types"
 	"github.com/sylabs/singularity/pkg/image"
 	"github.com/sylabs/singularity/pkg/image/unpacker"
+	"github.com/sylabs/singularity/pkg/sylog"
 )
 
 // SquashfsPacker holds the locations of where to pack from and to, aswell as image offset info
@@ -23,18 +26,37 @@ type SquashfsPacker struct {
 
 // Pack puts relevant objects in a Bundle!
 func (p *SquashfsPacker) Pack(context.Context) (*types.Bundle, error) {
-	// create a reader for rootfs partition
-	reader, err := image.NewPartitionReader(p.img, "", 0)
+	part, err := p.img.GetRootFsPartition()
 	if err != nil {
-		return nil, fmt.Errorf("could not extract root filesystem: %s", err)
+		return nil, fmt.Errorf("while getting root filesystem in %s: %s", p.img.Name, err)
+	}
+
+	var reader io.Reader
+
+	if part.Offset == 0 {
+		// the image is a bare squashfs file, unsquashfs reads it
+		// directly without staging a copy of the image
+		sylog.Verbosef("Skipped staging copy of %d MiB image %s", part.Size>>20, p.img.Path)
+		if _, err := p.img.File.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("could not extract root filesystem: %s", err)
+		}
+		reader = p.img.File
+	} else {
+		// create a reader for rootfs partition
+		reader, err = image.NewPartitionReader(p.img, "", 0)
+		if err != nil {
+			return nil, fmt.Errorf("could not extract root filesystem: %s", err)
+		}
 	}
 
 	s := unpacker.NewSquashfs()
 
 	// extract root filesystem
+	start := time.Now()
 	if err := s.ExtractAll(reader, p.b.RootfsPath); err != nil {
 		return nil, fmt.Errorf("root filesystem extraction failed: %s", err)
 	}
+	sylog.Verbosef("Extracted root filesystem of %s in %s", p.img.Path, time.Since(start).Round(time.Millisecond))
 
 	return p.b, nil
 }
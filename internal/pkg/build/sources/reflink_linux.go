@@ -0,0 +1,68 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/sylabs/singularity/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+// ficlone is the FICLONE ioctl request, not provided by the vendored
+// golang.org/x/sys/unix package.
+const ficlone = 0x40049409
+
+// errFound stops the walk of the source directory.
+var errFound = errors.New("found")
+
+// reflinkSupported returns if the files of the directory src can be
+// cloned with reflinks into the directory dst. It's probed by cloning the
+// first regular file found in src into a temporary file of dst, false is
+// returned when the file system doesn't support reflinks or src and dst
+// are on different file systems.
+func reflinkSupported(src, dst string) (bool, error) {
+	var file string
+	err := filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Mode().IsRegular() && fi.Size() > 0 {
+			file = path
+			return errFound
+		}
+		return nil
+	})
+	if err != nil && err != errFound {
+		return false, err
+	} else if file == "" {
+		return false, nil
+	}
+
+	in, err := os.Open(file)
+	if err != nil {
+		sylog.Debugf("Could not probe reflink support with %s: %s", file, err)
+		return false, nil
+	}
+	defer in.Close()
+
+	out, err := ioutil.TempFile(dst, "reflink-")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	err = unix.IoctlSetInt(int(out.Fd()), ficlone, int(in.Fd()))
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, unix.EOPNOTSUPP), errors.Is(err, unix.EXDEV), errors.Is(err, unix.EINVAL), errors.Is(err, unix.ENOTTY):
+		// ENOTTY is returned by file systems without the ioctl
+		return false, nil
+	}
+	return false, err
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReflinkSupported(t *testing.T) {
+	src, err := ioutil.TempDir("", "reflink-src-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	dst, err := ioutil.TempDir("", "reflink-dst-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	// nothing to probe with
+	if ok, err := reflinkSupported(src, dst); err != nil || ok {
+		t.Errorf("got %t, %v without files, want false without error", ok, err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(src, "file"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the result depends on the file system, unsupported
+	// reflinks must not be reported as an error
+	if _, err := reflinkSupported(src, dst); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if entries, err := ioutil.ReadDir(dst); err != nil || len(entries) != 0 {
+		t.Errorf("probe left %d files in %s: %v", len(entries), dst, err)
+	}
+
+	if _, err := reflinkSupported(src, filepath.Join(dst, "missing")); err == nil {
+		t.Errorf("unexpected success with a missing destination")
+	}
+}
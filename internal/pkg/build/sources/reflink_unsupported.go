@@ -0,0 +1,14 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !linux
+
+package sources
+
+// reflinkSupported returns if the files of the directory src can be
+// cloned with reflinks into the directory dst.
+func reflinkSupported(src, dst string) (bool, error) {
+	return false, nil
+}
@@ -7,14 +7,18 @@ package build
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/sylabs/singularity/internal/pkg/build/files"
 	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/util/env"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
 	"github.com/sylabs/singularity/pkg/build/types"
 	"github.com/sylabs/singularity/pkg/sylog"
 )
@@ -29,6 +33,14 @@ type stage struct {
 	a Assembler
 	// b is an intermediate structure that encapsulates all information for the container, e.g., metadata, filesystems.
 	b *types.Bundle
+	// shellOpts are the shell options of the section scripts.
+	shellOpts []string
+	// postLines is the number of lines of the %post section, without
+	// the appended %appinstall sections.
+	postLines int
+	// start is the build start time, the section output lines are
+	// prefixed with the time elapsed since then with --timestamps.
+	start time.Time
 }
 
 const sEnvironment = "SINGULARITY_ENVIRONMENT=/.singularity.d/env/91-environment.sh"
@@ -38,6 +50,85 @@ func (s *stage) Assemble(path string) error {
 	return s.a.Assemble(s.b, path)
 }
 
+// reportPhase reports the start of a build phase for this stage.
+func (s *stage) reportPhase(phase string) {
+	s.b.ReportProgress(types.ProgressEvent{Type: types.PhaseEvent, Stage: s.name, Phase: phase})
+}
+
+// setOutput sets the standard output and error of a section command, the
+// command trace written to the standard error is processed by trace if not
+// nil. The returned function must be called once the command terminates.
+func (s *stage) setOutput(cmd *exec.Cmd, phase string, trace *traceWriter) func() {
+	if s.b.Opts.Progress == nil && !s.b.Opts.Timestamps {
+		// the command writes directly to the standard output
+		// and error, its output isn't buffered
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if trace == nil {
+			return func() {}
+		}
+		trace.w = os.Stderr
+		cmd.Stderr = trace
+		return trace.flush
+	}
+
+	var flush []func()
+
+	output := func(f *os.File, stderr bool) io.Writer {
+		lines := &lineWriter{
+			w:     f,
+			start: s.start,
+			stamp: s.b.Opts.Timestamps,
+		}
+		if s.b.Opts.Progress == nil {
+			flush = append(flush, lines.flush)
+			return lines
+		}
+		o := &outputWriter{
+			w: lines,
+			emit: func(line string) {
+				s.b.ReportProgress(types.ProgressEvent{
+					Type:   types.OutputEvent,
+					Stage:  s.name,
+					Phase:  phase,
+					Line:   line,
+					Stderr: stderr,
+				})
+			},
+		}
+		flush = append(flush, o.flush, lines.flush)
+		return o
+	}
+	stdout := output(os.Stdout, false)
+	stderr := output(os.Stderr, true)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if trace != nil {
+		trace.w = stderr
+		cmd.Stderr = trace
+		flush = append([]func(){trace.flush}, flush...)
+	}
+
+	return func() {
+		for _, f := range flush {
+			f()
+		}
+	}
+}
+
+// newTraceWriter returns the writer processing the command trace of the
+// section script, or nil if the script is run by a custom shell.
+func (s *stage) newTraceWriter(script types.Script, lines int) *traceWriter {
+	if customShell(script) {
+		return nil
+	}
+	return &traceWriter{
+		verbose: sylog.GetLevel() >= int(sylog.VerboseLevel),
+		script:  script,
+		lines:   lines,
+	}
+}
+
 // runSetupScript executes the stage's pre script on host.
 func (s *stage) runSectionScript(name string, script types.Script) error {
 	if s.b.RunSection(name) && script.Script != "" {
@@ -48,7 +139,8 @@ func (s *stage) runSectionScript(name string, script types.Script) error {
 		sRootfs := "SINGULARITY_ROOTFS=" + s.b.RootfsPath
 
 		scriptPath := filepath.Join(s.b.TmpDir, name)
-		if err := createScript(scriptPath, []byte(script.Script)); err != nil {
+		content := sectionScript(script, s.shellOpts, true)
+		if err := createScript(scriptPath, []byte(content)); err != nil {
 			return fmt.Errorf("while creating %s script: %s", name, err)
 		}
 		defer os.Remove(scriptPath)
@@ -60,21 +152,61 @@ func (s *stage) runSectionScript(name string, script types.Script) error {
 
 		// Run script section here
 		cmd := exec.Command(args[0], args[1:]...)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		trace := s.newTraceWriter(script, strings.Count(script.Script, "\n")+1)
+		flush := s.setOutput(cmd, name, trace)
 		cmd.Env = os.Environ()
 		cmd.Env = append(cmd.Env, sEnvironment, sRootfs)
 
+		s.reportPhase(name)
 		sylog.Infof("Running %s scriptlet", name)
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to run %%%s script: %v", name, err)
+		err = cmd.Run()
+		flush()
+		if err != nil {
+			return sectionError(name, err, s.shellOpts, trace)
 		}
 	}
 	return nil
 }
 
-func (s *stage) runPostScript(configFile, sessionResolv, sessionHosts string) error {
+// containerShell is the shell running the %post and %test sections and
+// the container action scripts.
+const containerShell = "/bin/sh"
+
+// hasShell returns if the stage root filesystem provides the shell required
+// to run the %post and %test sections, which is not the case of an image
+// bootstrapped from scratch until a shell is copied with %files.
+func (s *stage) hasShell() bool {
+	return s.hasExecutable(containerShell)
+}
+
+// hasExecutable returns if the program at path in the stage root filesystem
+// is an executable file, a program name without directory is looked up in
+// the directories of the default container PATH.
+func (s *stage) hasExecutable(path string) bool {
+	if !strings.Contains(path, "/") {
+		for _, dir := range filepath.SplitList(env.DefaultPath) {
+			if s.hasExecutable(filepath.Join(dir, path)) {
+				return true
+			}
+		}
+		return false
+	}
+	p := filepath.Join(s.b.RootfsPath, fs.EvalRelative(path, s.b.RootfsPath))
+	fi, err := os.Stat(p)
+	return err == nil && fi.Mode().IsRegular() && fi.Mode()&0111 != 0
+}
+
+func (s *stage) runPostScript(configFile, sessionResolv, sessionHosts, secretsDir string) error {
 	if s.b.Recipe.BuildData.Post.Script != "" {
+		if !s.hasShell() {
+			return fmt.Errorf("%%post requires %s in the container, images bootstrapped from scratch must provide a shell with %%files", containerShell)
+		}
+
+		script := shebangShell(s.b.Recipe.BuildData.Post)
+		if interpreter := sectionInterpreter(script); interpreter != "" && !s.hasExecutable(interpreter) {
+			return fmt.Errorf("%%post interpreter %s not found in the container, install it in the base image or with %%files", interpreter)
+		}
+
 		cmdArgs := []string{"-s", "-c", configFile, "exec", "--pwd", "/", "--writable"}
 		cmdArgs = append(cmdArgs, "--cleanenv", "--env", sEnvironment)
 
@@ -84,10 +216,18 @@ func (s *stage) runPostScript(configFile, sessionResolv, sessionHosts string) er
 		if sessionHosts != "" {
 			cmdArgs = append(cmdArgs, "-B", sessionHosts+":/etc/hosts")
 		}
+		if secretsDir != "" {
+			removeMountPoint, err := s.secretsMountPoint()
+			if err != nil {
+				return err
+			}
+			defer removeMountPoint()
+			cmdArgs = append(cmdArgs, "-B", secretsDir+":"+secretsPath+":ro")
+		}
 
-		script := s.b.Recipe.BuildData.Post
 		scriptPath := filepath.Join(s.b.RootfsPath, ".post.script")
-		if err := createScript(scriptPath, []byte(script.Script)); err != nil {
+		content := sectionScript(script, s.shellOpts, true)
+		if err := createScript(scriptPath, []byte(content)); err != nil {
 			return fmt.Errorf("while creating post script: %s", err)
 		}
 		defer os.Remove(scriptPath)
@@ -102,21 +242,43 @@ func (s *stage) runPostScript(configFile, sessionResolv, sessionHosts string) er
 		cmdArgs = append(cmdArgs, s.b.RootfsPath)
 		cmdArgs = append(cmdArgs, args...)
 		cmd := exec.Command(exe, cmdArgs...)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		trace := s.newTraceWriter(script, s.postLines)
+		flush := s.setOutput(cmd, types.PhasePost, trace)
 		cmd.Dir = "/"
 		cmd.Env = currentEnvNoSingularity()
 
+		s.reportPhase(types.PhasePost)
 		sylog.Infof("Running post scriptlet")
-		return cmd.Run()
+		err = cmd.Run()
+		flush()
+		if err != nil {
+			return sectionError("post", err, s.shellOpts, trace)
+		}
 	}
 	return nil
 }
 
+// unprivilegedTestID is the UID and GID running the %test section with
+// --test-unprivileged, the overflow ID mapped to nobody on most systems.
+const unprivilegedTestID = 65534
+
 func (s *stage) runTestScript(configFile, sessionResolv, sessionHosts string) error {
 	if !s.b.Opts.NoTest && s.b.Recipe.BuildData.Test.Script != "" {
-		cmdArgs := []string{"-s", "-c", configFile, "test", "--pwd", "/"}
+		if !s.hasShell() {
+			sylog.Warningf("Skipping %%test, there is no %s in the container", containerShell)
+			return nil
+		}
+
+		// the test script of the image is sourced after the shell
+		// prologue, so the shell options only apply at build time
+		cmdArgs := []string{"-s", "-c", configFile, "exec", "--pwd", "/"}
 
+		if s.b.Opts.TestUnprivileged {
+			// the home directory of the unprivileged user doesn't exist
+			// on most systems
+			security := fmt.Sprintf("uid:%d,gid:%d", unprivilegedTestID, unprivilegedTestID)
+			cmdArgs = append(cmdArgs, "--no-home", "--security", security)
+		}
 		if sessionResolv != "" {
 			cmdArgs = append(cmdArgs, "-B", sessionResolv+":/etc/resolv.conf")
 		}
@@ -126,15 +288,23 @@ func (s *stage) runTestScript(configFile, sessionResolv, sessionHosts string) er
 
 		exe := filepath.Join(buildcfg.BINDIR, "singularity")
 
-		cmdArgs = append(cmdArgs, s.b.RootfsPath)
+		cmdArgs = append(cmdArgs, s.b.RootfsPath, containerShell, "-c", testCommand(s.shellOpts))
 		cmd := exec.Command(exe, cmdArgs...)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		flush := s.setOutput(cmd, types.PhaseTest, nil)
 		cmd.Dir = "/"
 		cmd.Env = currentEnvNoSingularity()
 
-		sylog.Infof("Running testscript")
-		return cmd.Run()
+		s.reportPhase(types.PhaseTest)
+		if s.b.Opts.TestUnprivileged {
+			sylog.Infof("Running testscript as UID/GID %d", unprivilegedTestID)
+		} else {
+			sylog.Infof("Running testscript")
+		}
+		err := cmd.Run()
+		flush()
+		if err != nil {
+			return sectionError("test", err, s.shellOpts, nil)
+		}
 	}
 	return nil
 }
@@ -0,0 +1,113 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+func TestHasShell(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(rootfs string) error
+		want  bool
+	}{
+		{
+			name:  "Scratch",
+			setup: func(rootfs string) error { return nil },
+		},
+		{
+			name: "Shell",
+			setup: func(rootfs string) error {
+				return ioutil.WriteFile(filepath.Join(rootfs, "bin", "sh"), []byte{}, 0755)
+			},
+			want: true,
+		},
+		{
+			name: "NotExecutable",
+			setup: func(rootfs string) error {
+				return ioutil.WriteFile(filepath.Join(rootfs, "bin", "sh"), []byte{}, 0644)
+			},
+		},
+		{
+			name: "Symlink",
+			setup: func(rootfs string) error {
+				if err := ioutil.WriteFile(filepath.Join(rootfs, "bin", "busybox"), []byte{}, 0755); err != nil {
+					return err
+				}
+				return os.Symlink("/bin/busybox", filepath.Join(rootfs, "bin", "sh"))
+			},
+			want: true,
+		},
+		{
+			// the symlink target must be resolved in the container, not on the host
+			name: "HostSymlink",
+			setup: func(rootfs string) error {
+				return os.Symlink("/proc/self/exe", filepath.Join(rootfs, "bin", "sh"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rootfs, err := ioutil.TempDir("", "has-shell-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(rootfs)
+
+			if err := os.Mkdir(filepath.Join(rootfs, "bin"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.setup(rootfs); err != nil {
+				t.Fatal(err)
+			}
+
+			s := &stage{b: &types.Bundle{RootfsPath: rootfs}}
+			if got := s.hasShell(); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasExecutable(t *testing.T) {
+	rootfs, err := ioutil.TempDir("", "has-executable-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootfs)
+
+	if err := os.MkdirAll(filepath.Join(rootfs, "usr", "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(rootfs, "usr", "bin", "bash"), []byte{}, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/usr/bin/bash", true},
+		{"/bin/bash", false},
+		{"bash", true},
+		{"zsh", false},
+		{"/usr/bin", false},
+	}
+
+	s := &stage{b: &types.Bundle{RootfsPath: rootfs}}
+	for _, tt := range tests {
+		if got := s.hasExecutable(tt.path); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
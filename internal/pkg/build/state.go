@@ -0,0 +1,121 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+// StateFile is the file, relative to the sandbox root, recording the
+// phases completed by a sandbox build. It's removed once the build
+// completes, so only interrupted builds leave it behind.
+const StateFile = ".singularity.d/build-state.json"
+
+// State records the phases completed by a sandbox build.
+type State struct {
+	// Version is the version of Singularity which started the build.
+	Version string `json:"version"`
+	// Definition is the digest of the definition being built.
+	Definition string `json:"definition"`
+	// Phases lists the completed build phases.
+	Phases []string `json:"phases"`
+}
+
+// newState returns an empty build state for the definitions defs.
+func newState(defs []types.Definition) *State {
+	h := sha256.New()
+	for _, d := range defs {
+		h.Write(d.Raw)
+	}
+	return &State{
+		Version:    buildcfg.PACKAGE_VERSION,
+		Definition: hex.EncodeToString(h.Sum(nil)),
+	}
+}
+
+// ReadState returns the build state recorded in the sandbox, or nil if
+// the sandbox doesn't hold an interrupted build.
+func ReadState(sandbox string) (*State, error) {
+	b, err := ioutil.ReadFile(filepath.Join(sandbox, StateFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	s := new(State)
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("while decoding build state: %s", err)
+	}
+	return s, nil
+}
+
+// Done returns if the phase was completed.
+func (s *State) Done(phase string) bool {
+	if s == nil {
+		return false
+	}
+	for _, p := range s.Phases {
+		if p == phase {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the completed phases.
+func (s *State) String() string {
+	if len(s.Phases) == 0 {
+		return "none"
+	}
+	return strings.Join(s.Phases, ", ")
+}
+
+// staleReason returns why the build state can't be resumed by the build
+// state current, or an empty string if it can.
+func (s *State) staleReason(current *State) string {
+	if s.Version != current.Version {
+		return fmt.Sprintf("was started by Singularity %s", s.Version)
+	}
+	if s.Definition != current.Definition {
+		return "was started from a different definition"
+	}
+	return ""
+}
+
+// complete records the phase as completed in the root filesystem rootfs.
+func (s *State) complete(phase, rootfs string) error {
+	if !s.Done(phase) {
+		s.Phases = append(s.Phases, phase)
+	}
+	return s.write(rootfs)
+}
+
+// write writes the build state in the root filesystem rootfs.
+func (s *State) write(rootfs string) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(rootfs, StateFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		return fmt.Errorf("while writing build state: %s", err)
+	}
+	return nil
+}
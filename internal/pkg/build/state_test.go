@@ -0,0 +1,101 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+func TestState(t *testing.T) {
+	rootfs, err := ioutil.TempDir("", "build-state-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootfs)
+
+	defs := []types.Definition{{Raw: []byte("Bootstrap: scratch\n")}}
+
+	s, err := ReadState(rootfs)
+	if err != nil || s != nil {
+		t.Fatalf("got state %v and error %v for a sandbox without build state", s, err)
+	}
+
+	s = newState(defs)
+	for _, phase := range []string{types.PhaseBootstrap, types.PhaseSetup, types.PhaseSetup} {
+		if err := s.complete(phase, rootfs); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	got, err := ReadState(rootfs)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(got, s) {
+		t.Errorf("got state %+v, want %+v", got, s)
+	}
+	if want := []string{types.PhaseBootstrap, types.PhaseSetup}; !reflect.DeepEqual(got.Phases, want) {
+		t.Errorf("got phases %v, want %v", got.Phases, want)
+	}
+	if !got.Done(types.PhaseSetup) || got.Done(types.PhasePost) {
+		t.Errorf("unexpected completed phases %v", got.Phases)
+	}
+	if got.String() != "bootstrap, setup" {
+		t.Errorf("unexpected state description %q", got.String())
+	}
+
+	var nilState *State
+	if nilState.Done(types.PhaseBootstrap) {
+		t.Errorf("phase completed in nil state")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(rootfs, StateFile), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadState(rootfs); err == nil {
+		t.Errorf("unexpected success with corrupted build state")
+	}
+}
+
+func TestStateStale(t *testing.T) {
+	defs := []types.Definition{{Raw: []byte("Bootstrap: scratch\n")}}
+	current := newState(defs)
+
+	tests := []struct {
+		name   string
+		state  *State
+		reason string
+	}{
+		{
+			name:  "SameBuild",
+			state: newState(defs),
+		},
+		{
+			name:   "OtherVersion",
+			state:  &State{Version: "0.0.0", Definition: current.Definition},
+			reason: "was started by Singularity 0.0.0",
+		},
+		{
+			name:   "OtherDefinition",
+			state:  newState([]types.Definition{{Raw: []byte("Bootstrap: docker\nFrom: alpine\n")}}),
+			reason: "was started from a different definition",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.state.staleReason(current); got != tt.reason {
+				t.Errorf("got reason %q, want %q", got, tt.reason)
+			}
+		})
+	}
+}
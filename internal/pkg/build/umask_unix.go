@@ -0,0 +1,23 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !windows
+
+package build
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func umask(mask int) int {
+	return syscall.Umask(mask)
+}
+
+// canRead reports whether path is readable by the calling user.
+func canRead(path string) error {
+	return unix.Access(path, unix.R_OK)
+}
@@ -0,0 +1,24 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"os"
+)
+
+// umask is a no-op, there is no process umask on this platform.
+func umask(mask int) int {
+	return 0
+}
+
+// canRead reports whether path is readable by the calling user.
+func canRead(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
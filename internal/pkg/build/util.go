@@ -19,7 +19,6 @@ import (
 	"github.com/sylabs/singularity/pkg/build/types"
 	buildtypes "github.com/sylabs/singularity/pkg/build/types"
 	"github.com/sylabs/singularity/pkg/sylog"
-	"golang.org/x/sys/unix"
 )
 
 // ConvertOciToSIf will convert an OCI source into a SIF using the build routines
@@ -53,7 +52,7 @@ func ConvertOciToSIF(ctx context.Context, imgCache *cache.Handle, image, cachedI
 
 func createStageFile(source string, b *types.Bundle, warnMsg string) (string, error) {
 	dest := filepath.Join(b.RootfsPath, source)
-	if err := unix.Access(dest, unix.R_OK); err != nil {
+	if err := canRead(dest); err != nil {
 		sylog.Warningf("%s: while accessing to %s: %s", warnMsg, dest, err)
 		return "", nil
 	}
@@ -107,7 +106,9 @@ func createScript(path string, content []byte) error {
 }
 
 func getSectionScriptArgs(name string, script string, s types.Script) ([]string, error) {
-	args := []string{"/bin/sh", "-ex"}
+	// shell options are set by the script prologue, except when the
+	// script is run by a custom shell
+	args := []string{"/bin/sh"}
 	// trim potential trailing comment from args and append to args list
 	sectionParams := strings.Fields(strings.Split(s.Args, "#")[0])
 
@@ -124,6 +125,7 @@ func getSectionScriptArgs(name string, script string, s types.Script) ([]string,
 			// argument "shell [args...] script"
 			shellArgs := strings.Join(sectionParams[i+1:], " ")
 			sectionParams = append(sectionParams[0:i+1], shellArgs+" "+script)
+			args = append(args, "-ex")
 			commandOption = true
 			break
 		}
@@ -0,0 +1,418 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// maxManifestSize is the maximum size of a manifest in a cache archive.
+const maxManifestSize = 1 << 20
+
+// contentNames returns the entry name of the content digest hex, the
+// hexadecimal sha256 digest, for the cache types whose entries are named
+// after the digest of their content. The entries of the other cache types
+// are named after their source and can't be verified against their name.
+var contentNames = map[string]func(hex string) string{
+	LibraryCacheType: func(hex string) string { return "sha256." + hex },
+	ChunkCacheType:   func(hex string) string { return "sha256." + hex },
+	OrasCacheType:    func(hex string) string { return "sha256:" + hex },
+	FileCacheType:    func(hex string) string { return hex },
+}
+
+// archiveEntry identifies a cache entry in a cache archive.
+type archiveEntry struct {
+	cacheType string
+	hash      string
+}
+
+// Export writes the entries of the file and directory cache types, with
+// their manifest, to the tar archive w. Each entry is verified against its
+// manifest first, the export fails if an entry is corrupted. The archive
+// holds the manifest of an entry, "manifests/<type>/<hash>.json", followed
+// by the entry, "<type>/<hash>", like the cache directory. It returns the
+// number of exported entries.
+func (h *Handle) Export(w io.Writer) (int, error) {
+	if h.disabled {
+		return 0, fmt.Errorf("cache is disabled")
+	}
+
+	tw := tar.NewWriter(w)
+	count := 0
+
+	for _, cacheType := range append(append([]string{}, FileCacheTypes...), DirCacheTypes...) {
+		dir := h.getCacheTypeDir(cacheType)
+		entries, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return count, fmt.Errorf("unable to open cache %s at directory %s: %v", cacheType, dir, err)
+		}
+
+		isDirType := stringInSlice(cacheType, DirCacheTypes)
+		for _, e := range entries {
+			// entries being created
+			if strings.HasPrefix(e.Name(), "tmp_") {
+				continue
+			}
+			// directories left in file caches by Singularity <3.6
+			if e.IsDir() != isDirType {
+				sylog.Debugf("Skipping %s cache entry %s of unexpected type", cacheType, e.Name())
+				continue
+			}
+
+			m, err := h.VerifyEntry(cacheType, e.Name())
+			if err != nil {
+				return count, fmt.Errorf("%s cache entry %s: %w", cacheType, e.Name(), err)
+			}
+			if err := writeArchiveManifest(tw, cacheType, e.Name(), m); err != nil {
+				return count, fmt.Errorf("while exporting manifest of %s cache entry %s: %v", cacheType, e.Name(), err)
+			}
+			if err := writeArchiveEntry(tw, dir, cacheType, e.Name()); err != nil {
+				return count, fmt.Errorf("while exporting %s cache entry %s: %v", cacheType, e.Name(), err)
+			}
+			count++
+		}
+	}
+
+	return count, tw.Close()
+}
+
+// writeArchiveManifest writes the manifest m of the entry hash to tw.
+func writeArchiveManifest(tw *tar.Writer, cacheType, hash string, m *Manifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     path.Join(manifestDirName, cacheType, hash+".json"),
+		Mode:     0600,
+		Size:     int64(len(data)),
+		ModTime:  m.Created,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+	return err
+}
+
+// writeArchiveEntry writes the entry hash of the cacheType directory dir to
+// tw, with the files of a directory entry. Files other than directories,
+// regular files and symbolic links are skipped, they aren't accounted in
+// the entry size either.
+func writeArchiveEntry(tw *tar.Writer, dir, cacheType, hash string) error {
+	return filepath.Walk(filepath.Join(dir, hash), func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		link := ""
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		case !fi.IsDir() && !fi.Mode().IsRegular():
+			sylog.Warningf("Skipping special file %s of %s cache entry %s", rel, cacheType, hash)
+			return nil
+		}
+
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = path.Join(cacheType, filepath.ToSlash(rel))
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		// ownership isn't preserved by an import
+		hdr.Uid, hdr.Gid = 0, 0
+		hdr.Uname, hdr.Gname = "", ""
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
+
+// Import adds the entries of the cache archive r, written by Export, to
+// the cache. The archive is extracted in a temporary directory of the
+// cache, then each entry is verified against its manifest and, for the
+// content addressed cache types, its name is checked against the digest
+// of its content. The import fails without adding any entry if one is
+// corrupted, is misnamed or has no manifest. The entries of the other
+// types are trusted as they are, a warning reports them. Entries already
+// in the cache are kept. It returns the number of imported and skipped
+// entries.
+func (h *Handle) Import(r io.Reader) (imported, skipped int, err error) {
+	if h.disabled {
+		return 0, 0, fmt.Errorf("cache is disabled")
+	}
+
+	staging, err := fs.MakeTmpDir(h.rootDir, "tmp_import_", 0700)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() {
+		if err := fs.ForceRemoveAll(staging); err != nil {
+			sylog.Warningf("Could not remove %s: %v", staging, err)
+		}
+	}()
+
+	manifests, entries, err := extractArchive(r, staging)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	keys := make([]archiveEntry, 0, len(entries))
+	for k := range entries {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].cacheType != keys[j].cacheType {
+			return keys[i].cacheType < keys[j].cacheType
+		}
+		return keys[i].hash < keys[j].hash
+	})
+
+	for _, k := range keys {
+		m, ok := manifests[k]
+		if !ok {
+			return 0, 0, fmt.Errorf("%s cache entry %s has no manifest", k.cacheType, k.hash)
+		}
+		if err := verifyManifest(filepath.Join(staging, k.cacheType, k.hash), m); err != nil {
+			return 0, 0, fmt.Errorf("%s cache entry %s: %w", k.cacheType, k.hash, err)
+		}
+		if err := verifyEntryName(k, m); err != nil {
+			return 0, 0, err
+		}
+	}
+	for k := range manifests {
+		if !entries[k] {
+			sylog.Warningf("Ignoring manifest of missing %s cache entry %s", k.cacheType, k.hash)
+		}
+	}
+
+	for _, k := range keys {
+		dst := filepath.Join(h.getCacheTypeDir(k.cacheType), k.hash)
+		if exists, err := fs.PathExists(dst); err != nil {
+			return imported, skipped, fmt.Errorf("could not check for cache entry '%s': %v", dst, err)
+		} else if exists {
+			sylog.Debugf("Keeping existing %s cache entry %s", k.cacheType, k.hash)
+			skipped++
+			continue
+		}
+
+		if err := os.Rename(filepath.Join(staging, k.cacheType, k.hash), dst); err != nil {
+			return imported, skipped, fmt.Errorf("could not import %s cache entry %s: %v", k.cacheType, k.hash, err)
+		}
+		m := manifests[k]
+		m.Accessed = time.Now()
+		if err := h.writeManifest(k.cacheType, k.hash, m); err != nil {
+			return imported, skipped, err
+		}
+		imported++
+	}
+	return imported, skipped, nil
+}
+
+// extractArchive extracts the entries of the cache archive r in the
+// directory staging and returns the manifests and the entries it holds.
+func extractArchive(r io.Reader, staging string) (map[archiveEntry]*Manifest, map[archiveEntry]bool, error) {
+	manifests := make(map[archiveEntry]*Manifest)
+	entries := make(map[archiveEntry]bool)
+
+	type dirMode struct {
+		path string
+		mode os.FileMode
+	}
+	var dirs []dirMode
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("while reading cache archive: %v", err)
+		}
+
+		name := path.Clean(hdr.Name)
+		parts := strings.Split(name, "/")
+
+		if parts[0] == manifestDirName {
+			if len(parts) != 3 || hdr.Typeflag != tar.TypeReg || !strings.HasSuffix(parts[2], ".json") {
+				return nil, nil, fmt.Errorf("invalid manifest %s in cache archive", hdr.Name)
+			}
+			k := archiveEntry{cacheType: parts[1], hash: strings.TrimSuffix(parts[2], ".json")}
+			if err := checkArchiveEntry(k); err != nil {
+				return nil, nil, err
+			}
+			if hdr.Size > maxManifestSize {
+				return nil, nil, fmt.Errorf("manifest %s in cache archive is too large", hdr.Name)
+			}
+			m := new(Manifest)
+			if err := json.NewDecoder(tr).Decode(m); err != nil {
+				return nil, nil, fmt.Errorf("while decoding manifest %s: %v", hdr.Name, err)
+			}
+			manifests[k] = m
+			continue
+		}
+
+		if len(parts) < 2 {
+			return nil, nil, fmt.Errorf("invalid file %s in cache archive", hdr.Name)
+		}
+		k := archiveEntry{cacheType: parts[0], hash: parts[1]}
+		if err := checkArchiveEntry(k); err != nil {
+			return nil, nil, err
+		}
+
+		// file entries are a single regular file, directory entries
+		// hold directories, regular files and symbolic links
+		isDirType := stringInSlice(k.cacheType, DirCacheTypes)
+		switch {
+		case !isDirType && (len(parts) != 2 || (hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA)):
+			return nil, nil, fmt.Errorf("%s cache entry %s is not a file", k.cacheType, k.hash)
+		case isDirType && len(parts) == 2 && hdr.Typeflag != tar.TypeDir:
+			return nil, nil, fmt.Errorf("%s cache entry %s is not a directory", k.cacheType, k.hash)
+		}
+		entries[k] = true
+
+		target := filepath.Join(staging, filepath.FromSlash(name))
+		if err := checkNoSymlink(staging, target); err != nil {
+			return nil, nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return nil, nil, err
+		}
+
+		mode := os.FileMode(hdr.Mode).Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0700); err != nil {
+				return nil, nil, err
+			}
+			dirs = append(dirs, dirMode{path: target, mode: mode})
+		case tar.TypeReg, tar.TypeRegA:
+			if err := extractFile(tr, target, mode); err != nil {
+				return nil, nil, fmt.Errorf("while extracting %s: %v", hdr.Name, err)
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return nil, nil, err
+			}
+		default:
+			return nil, nil, fmt.Errorf("unsupported file %s in cache archive", hdr.Name)
+		}
+	}
+
+	// directories are writable until their content was extracted
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chmod(dirs[i].path, dirs[i].mode); err != nil {
+			return nil, nil, err
+		}
+	}
+	return manifests, entries, nil
+}
+
+// checkArchiveEntry checks that k is a cache entry which can be imported.
+func checkArchiveEntry(k archiveEntry) error {
+	if !stringInSlice(k.cacheType, FileCacheTypes) && !stringInSlice(k.cacheType, DirCacheTypes) {
+		return fmt.Errorf("%w %q in cache archive", ErrInvalidCacheType, k.cacheType)
+	}
+	if k.hash == "" || k.hash == "." || k.hash == ".." || strings.HasPrefix(k.hash, "tmp_") {
+		return fmt.Errorf("invalid %s cache entry name %q in cache archive", k.cacheType, k.hash)
+	}
+	return nil
+}
+
+// verifyEntryName checks that the name of the entry k of a content
+// addressed cache type matches the digest of its content, verified against
+// its manifest m. The entries of the other types are reported as
+// unverified.
+func verifyEntryName(k archiveEntry, m *Manifest) error {
+	name, ok := contentNames[k.cacheType]
+	if !ok {
+		sylog.Warningf("Importing %s cache entry %s without verifying that it matches its source %s", k.cacheType, k.hash, m.Source)
+		return nil
+	}
+	hex := strings.TrimPrefix(m.Digest, "sha256:")
+	if hex == m.Digest || name(hex) != k.hash {
+		return fmt.Errorf("%s cache entry %s: %w: content digest is %s", k.cacheType, k.hash, ErrBadChecksum, m.Digest)
+	}
+	return nil
+}
+
+// checkNoSymlink checks that none of the existing path components of
+// target below dir is a symbolic link, an archive can't write outside of
+// the directory it's extracted in through a symbolic link it holds.
+func checkNoSymlink(dir, target string) error {
+	rel, err := filepath.Rel(dir, target)
+	if err != nil {
+		return err
+	}
+	p := dir
+	for _, c := range strings.Split(rel, string(filepath.Separator)) {
+		p = filepath.Join(p, c)
+		fi, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("cache archive file %s is below a symbolic link", rel)
+		}
+	}
+	return nil
+}
+
+// extractFile writes the content of r to the new file path with mode.
+func extractFile(r io.Reader, path string, mode os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(path, mode)
+}
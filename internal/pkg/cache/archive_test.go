@@ -0,0 +1,258 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// addDirEntry adds a directory entry holding a file, a read-only directory
+// and a symbolic link to the cacheType cache.
+func addDirEntry(t *testing.T, h *Handle, cacheType, hash string) *Entry {
+	e, err := h.GetDirEntry(cacheType, hash)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer e.CleanTmp()
+
+	if err := os.MkdirAll(filepath.Join(e.TmpPath, "usr", "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(e.TmpPath, "usr", "bin", "tool"), []byte("tool"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("usr/bin", filepath.Join(e.TmpPath, "bin")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(e.TmpPath, "usr"), 0555); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Finalize(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return e
+}
+
+func newTestCache(t *testing.T) (*Handle, func()) {
+	dir, err := ioutil.TempDir("", "cache-archive-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := New(Config{ParentDir: dir})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return h, func() {
+		h.cleanAllCaches()
+		os.RemoveAll(dir)
+	}
+}
+
+// libraryHash returns the library cache entry name of the image data.
+func libraryHash(data string) string {
+	d := sha256.Sum256([]byte(data))
+	return "sha256." + hex.EncodeToString(d[:])
+}
+
+func TestExportImport(t *testing.T) {
+	src, cleanupSrc := newTestCache(t)
+	defer cleanupSrc()
+
+	libraryEntry := libraryHash("library image")
+	addEntry(t, src, LibraryCacheType, libraryEntry, "library://alpine:latest", []byte("library image"))
+	addEntry(t, src, NetCacheType, "net-hash", "https://example.com/image.sif", []byte("net image"))
+	addDirEntry(t, src, LayerCacheType, "layer-hash")
+
+	var archive bytes.Buffer
+	count, err := src.Export(&archive)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if count != 3 {
+		t.Errorf("got %d exported entries, want 3", count)
+	}
+
+	dst, cleanupDst := newTestCache(t)
+	defer cleanupDst()
+
+	imported, skipped, err := dst.Import(bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if imported != 3 || skipped != 0 {
+		t.Errorf("got %d imported and %d skipped entries, want 3 and 0", imported, skipped)
+	}
+
+	for _, e := range []struct{ cacheType, hash string }{
+		{LibraryCacheType, libraryEntry},
+		{NetCacheType, "net-hash"},
+		{LayerCacheType, "layer-hash"},
+	} {
+		want, err := src.ReadManifest(e.cacheType, e.hash)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		got, err := dst.VerifyEntry(e.cacheType, e.hash)
+		if err != nil {
+			t.Fatalf("%s cache entry %s: unexpected error: %s", e.cacheType, e.hash, err)
+		}
+		if got.Source != want.Source || got.Digest != want.Digest || got.Size != want.Size || !got.Created.Equal(want.Created) {
+			t.Errorf("%s cache entry %s: got manifest %+v, want %+v", e.cacheType, e.hash, got, want)
+		}
+	}
+
+	layer := filepath.Join(dst.getCacheTypeDir(LayerCacheType), "layer-hash")
+	if target, err := os.Readlink(filepath.Join(layer, "bin")); err != nil || target != "usr/bin" {
+		t.Errorf("got symbolic link to %q (%v), want usr/bin", target, err)
+	}
+	if fi, err := os.Stat(filepath.Join(layer, "usr")); err != nil || fi.Mode().Perm() != 0555 {
+		t.Errorf("directory permissions not restored: %v %v", fi, err)
+	}
+
+	// a second import keeps the existing entries
+	imported, skipped, err = dst.Import(bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if imported != 0 || skipped != 3 {
+		t.Errorf("got %d imported and %d skipped entries, want 0 and 3", imported, skipped)
+	}
+}
+
+// writeTestArchive returns a tar archive holding the directories dirs, the
+// symbolic links links, name and target pairs, and the files files, name and
+// content pairs, in this order.
+func writeTestArchive(t *testing.T, dirs []string, files [][2]string, links [][2]string) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, d := range dirs {
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: d, Mode: 0755}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, l := range links {
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeSymlink, Name: l[0], Linkname: l[1]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: f[0], Mode: 0644, Size: int64(len(f[1]))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImportInvalid(t *testing.T) {
+	src, cleanupSrc := newTestCache(t)
+	defer cleanupSrc()
+
+	addEntry(t, src, LibraryCacheType, libraryHash("library image"), "library://alpine:latest", []byte("library image"))
+	var archive bytes.Buffer
+	if _, err := src.Export(&archive); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// the entry matches its manifest but not its name
+	misnamedSrc, cleanupMisnamed := newTestCache(t)
+	defer cleanupMisnamed()
+
+	addEntry(t, misnamedSrc, LibraryCacheType, libraryHash("other image"), "library://alpine:latest", []byte("library image"))
+	var misnamed bytes.Buffer
+	if _, err := misnamedSrc.Export(&misnamed); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// the entry content is altered, its size is unchanged
+	tampered := bytes.Replace(archive.Bytes(), []byte("library image"), []byte("library imagE"), 1)
+
+	tests := []struct {
+		name    string
+		archive []byte
+		wantErr error
+	}{
+		{
+			name:    "Tampered",
+			archive: tampered,
+			wantErr: ErrBadChecksum,
+		},
+		{
+			name:    "Misnamed",
+			archive: misnamed.Bytes(),
+			wantErr: ErrBadChecksum,
+		},
+		{
+			name:    "NoManifest",
+			archive: writeTestArchive(t, nil, [][2]string{{"library/hash", "library image"}}, nil),
+		},
+		{
+			name:    "InvalidType",
+			archive: writeTestArchive(t, nil, [][2]string{{"unknown/hash", "data"}}, nil),
+			wantErr: ErrInvalidCacheType,
+		},
+		{
+			name:    "Traversal",
+			archive: writeTestArchive(t, nil, [][2]string{{"../library/hash", "data"}}, nil),
+			wantErr: ErrInvalidCacheType,
+		},
+		{
+			name:    "FileEntryDirectory",
+			archive: writeTestArchive(t, []string{"library/hash/"}, nil, nil),
+		},
+		{
+			name: "Symlink",
+			archive: writeTestArchive(t,
+				[]string{"layers/hash/"},
+				[][2]string{{"layers/hash/link/file", "data"}},
+				[][2]string{{"layers/hash/link", "/tmp"}},
+			),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst, cleanupDst := newTestCache(t)
+			defer cleanupDst()
+
+			_, _, err := dst.Import(bytes.NewReader(tt.archive))
+			if err == nil {
+				t.Fatalf("unexpected success")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %q, want %q", err, tt.wantErr)
+			}
+
+			// nothing was imported
+			for _, ct := range []string{LibraryCacheType, LayerCacheType} {
+				entries, err := ioutil.ReadDir(dst.getCacheTypeDir(ct))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(entries) != 0 {
+					t.Errorf("%s cache holds %d entries after a failed import", ct, len(entries))
+				}
+			}
+			if entries, _ := ioutil.ReadDir(dst.rootDir); len(entries) != len(FileCacheTypes)+len(DirCacheTypes) {
+				t.Errorf("cache directory holds %d files after a failed import", len(entries))
+			}
+		})
+	}
+}
@@ -13,7 +13,9 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
@@ -32,6 +34,12 @@ const (
 	DirEnv = "SINGULARITY_CACHEDIR"
 	// DisableCacheEnv specifies whether the image should be used
 	DisableEnv = "SINGULARITY_DISABLE_CACHE"
+	// LayerCacheMaxSizeEnv specifies the maximum size in MiB of the layer
+	// cache, 0 disables caching unpacked layers
+	LayerCacheMaxSizeEnv = "SINGULARITY_LAYER_CACHE_MAX_SIZE"
+	// DefaultLayerCacheMaxSize is the maximum size in MiB of the layer
+	// cache when LayerCacheMaxSizeEnv isn't set
+	DefaultLayerCacheMaxSize = 10 * 1024
 	// SubDirName specifies the name of the directory relative to the
 	// ParentDir specified when the cache is created.
 	// By default the cache will be placed at "~/.singularity/cache" which
@@ -50,6 +58,16 @@ const (
 	OrasCacheType = "oras"
 	// The Net cache holds images pulled from http(s) internet sources
 	NetCacheType = "net"
+	// The File cache holds local SIF images pulled from file:// references
+	FileCacheType = "file"
+	// The Bucket cache holds images pulled from s3:// and gs:// object storage
+	BucketCacheType = "bucket"
+	// The Layer cache holds root filesystems unpacked from OCI layer chains
+	LayerCacheType = "layers"
+	// The Chunk cache holds the chunks of images pulled from the library
+	ChunkCacheType = "chunks"
+	// The Inspect cache holds the metadata of images inspected by running them
+	InspectCacheType = "inspect"
 )
 
 var (
@@ -59,10 +77,17 @@ var (
 		ShubCacheType,
 		OrasCacheType,
 		NetCacheType,
+		FileCacheType,
+		BucketCacheType,
+		ChunkCacheType,
+		InspectCacheType,
 	}
 	OciCacheTypes = []string{
 		OciBlobCacheType,
 	}
+	DirCacheTypes = []string{
+		LayerCacheType,
+	}
 )
 
 // Config describes the requested configuration requested when a new handle is created,
@@ -86,6 +111,8 @@ type Handle struct {
 	rootDir string
 	// If the cache is disabled
 	disabled bool
+	// If the cache is a throwaway cache created by NewTemporary
+	temporary bool
 }
 
 func (h *Handle) GetFileCacheDir(cacheType string) (cacheDir string, err error) {
@@ -102,13 +129,20 @@ func (h *Handle) GetOciCacheDir(cacheType string) (cacheDir string, err error) {
 	return h.getCacheTypeDir(cacheType), nil
 }
 
+func (h *Handle) GetDirCacheDir(cacheType string) (cacheDir string, err error) {
+	if !stringInSlice(cacheType, DirCacheTypes) {
+		return "", ErrInvalidCacheType
+	}
+	return h.getCacheTypeDir(cacheType), nil
+}
+
 // GetEntry returns a cache Entry for a specified file cache type and hash
 func (h *Handle) GetEntry(cacheType string, hash string) (e *Entry, err error) {
 	if h.disabled {
 		return nil, nil
 	}
 
-	e = &Entry{}
+	e = &Entry{CacheType: cacheType, handle: h, hash: hash}
 
 	cacheDir, err := h.GetFileCacheDir(cacheType)
 	if err != nil {
@@ -155,10 +189,58 @@ func (h *Handle) GetEntry(cacheType string, hash string) (e *Entry, err error) {
 	}
 
 	// It exists in the cache and it's a file. Caller can use the Path directly
+	h.touchManifest(cacheType, hash)
 	e.Exists = true
 	return e, nil
 }
 
+// GetDirEntry returns a cache Entry for a specified directory cache type and
+// hash. An existing entry is marked as used, so entries cleaned by age are the
+// ones not used for the longest time.
+func (h *Handle) GetDirEntry(cacheType string, hash string) (e *Entry, err error) {
+	if h.disabled {
+		return nil, nil
+	}
+
+	e = &Entry{CacheType: cacheType, handle: h, hash: hash}
+
+	cacheDir, err := h.GetDirCacheDir(cacheType)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get '%s' cache directory: %v", cacheType, err)
+	}
+
+	e.Path = filepath.Join(cacheDir, hash)
+
+	pathExists, err := fs.PathExists(e.Path)
+	if err != nil {
+		return nil, fmt.Errorf("could not check for cache entry '%s': %v", e.Path, err)
+	}
+
+	if !pathExists {
+		e.TmpPath, err = fs.MakeTmpDir(cacheDir, "tmp_", 0700)
+		if err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+
+	if !fs.IsDir(e.Path) {
+		return nil, fmt.Errorf("path '%s' exists but is not a directory", e.Path)
+	}
+
+	now := time.Now()
+	if err := os.Chtimes(e.Path, now, now); err != nil {
+		sylog.Debugf("Could not update cache entry '%s' time: %v", e.Path, err)
+	}
+	h.touchManifest(cacheType, hash)
+
+	e.Exists = true
+	return e, nil
+}
+
+// CleanCache removes the entries of cacheType. When days isn't negative,
+// only the entries not used for days are removed, according to the access
+// time of their manifest, or their modification time without manifest.
 func (h *Handle) CleanCache(cacheType string, dryRun bool, days int) (err error) {
 	dir := h.getCacheTypeDir(cacheType)
 
@@ -172,7 +254,11 @@ func (h *Handle) CleanCache(cacheType string, dryRun bool, days int) (err error)
 	for _, f := range files {
 
 		if days >= 0 {
-			if time.Since(f.ModTime()) < time.Duration(days*24)*time.Hour {
+			lastUsed := f.ModTime()
+			if m, err := h.readManifestFile(cacheType, f.Name()); err == nil {
+				lastUsed = m.Accessed
+			}
+			if time.Since(lastUsed) < time.Duration(days*24)*time.Hour {
 				sylog.Debugf("Skipping %s: less that %d days old", f.Name(), days)
 				continue
 			}
@@ -180,8 +266,12 @@ func (h *Handle) CleanCache(cacheType string, dryRun bool, days int) (err error)
 
 		sylog.Infof("Removing %s cache entry: %s", cacheType, f.Name())
 		if !dryRun {
-			// We RemoveAll in case the entry is a directory from Singularity <3.6
-			err := os.RemoveAll(path.Join(dir, f.Name()))
+			// We RemoveAll in case the entry is a directory from Singularity <3.6,
+			// directory entries may hold directories without write permission
+			err := fs.ForceRemoveAll(path.Join(dir, f.Name()))
+			if err == nil {
+				err = h.removeManifest(cacheType, f.Name())
+			}
 			if err != nil {
 				sylog.Errorf("Could not remove cache entry '%s': %v", f.Name(), err)
 				errCount = errCount + 1
@@ -196,6 +286,68 @@ func (h *Handle) CleanCache(cacheType string, dryRun bool, days int) (err error)
 	return err
 }
 
+// LimitCache removes the least recently used entries of cacheType until the
+// size of the remaining entries, as recorded in their manifests, is at most
+// maxSize bytes.
+func (h *Handle) LimitCache(cacheType string, maxSize int64) error {
+	if h.disabled {
+		return nil
+	}
+
+	files, err := ioutil.ReadDir(h.getCacheTypeDir(cacheType))
+	if err != nil {
+		return fmt.Errorf("while listing %s cache entries: %v", cacheType, err)
+	}
+
+	var total int64
+	entries := make([]*Manifest, 0, len(files))
+	names := make(map[*Manifest]string, len(files))
+	for _, f := range files {
+		// skip the entries being created
+		if strings.HasPrefix(f.Name(), "tmp_") {
+			continue
+		}
+		m, err := h.ReadManifest(cacheType, f.Name())
+		if err != nil {
+			sylog.Debugf("Skipping %s cache entry %s: %v", cacheType, f.Name(), err)
+			continue
+		}
+		total += m.Size
+		entries = append(entries, m)
+		names[m] = f.Name()
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Accessed.Before(entries[j].Accessed)
+	})
+
+	for _, m := range entries {
+		if total <= maxSize {
+			break
+		}
+		sylog.Debugf("Removing %s cache entry %s above the cache size limit", cacheType, names[m])
+		if err := h.RemoveEntry(cacheType, names[m]); err != nil {
+			return err
+		}
+		total -= m.Size
+	}
+	return nil
+}
+
+// LayerCacheMaxSize returns the maximum size in bytes of the layer cache set
+// by LayerCacheMaxSizeEnv, or its default.
+func LayerCacheMaxSize() (int64, error) {
+	env := os.Getenv(LayerCacheMaxSizeEnv)
+	if env == "" {
+		return DefaultLayerCacheMaxSize << 20, nil
+	}
+	size, err := strconv.ParseInt(env, 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid %s value %q: must be a size in MiB", LayerCacheMaxSizeEnv, env)
+	}
+	return size << 20, nil
+}
+
 // cleanAllCaches is an utility function that wipes all files in the
 // cache directory, will return a error if one occurs
 func (h *Handle) cleanAllCaches() {
@@ -203,12 +355,15 @@ func (h *Handle) cleanAllCaches() {
 		return
 	}
 
-	for _, ct := range append(FileCacheTypes, OciCacheTypes...) {
+	for _, ct := range append(append(FileCacheTypes, OciCacheTypes...), DirCacheTypes...) {
 		dir := h.getCacheTypeDir(ct)
-		if err := os.RemoveAll(dir); err != nil {
+		if err := fs.ForceRemoveAll(dir); err != nil {
 			sylog.Verbosef("unable to clean %s cache, directory %s: %v", ct, dir, err)
 		}
 	}
+	if err := fs.ForceRemoveAll(path.Join(h.rootDir, manifestDirName)); err != nil {
+		sylog.Verbosef("unable to clean cache manifests: %v", err)
+	}
 
 }
 
@@ -273,23 +428,63 @@ func New(cfg Config) (h *Handle, err error) {
 		return h, nil
 	}
 
-	// Initialize the root directory of the cache
-	rootDir := path.Join(parentDir, SubDirName)
-	h.rootDir = rootDir
-	if err = initCacheDir(rootDir); err != nil {
-		return nil, fmt.Errorf("failed initializing caching directory: %s", err)
+	if err := h.initDirs(); err != nil {
+		return nil, err
 	}
-	// Initialize the subdirectories of the cache
-	for _, ct := range FileCacheTypes {
-		dir := h.getCacheTypeDir(ct)
-		if err = initCacheDir(dir); err != nil {
-			return nil, fmt.Errorf("failed initializing caching directory: %s", err)
-		}
+
+	return h, nil
+}
+
+// NewTemporary initializes a throwaway cache within a new temporary directory
+// created in dir, even if the cache is disabled by the user. It lets a single
+// command, like a build, go through the cache without touching the persistent
+// one. The cache is removed with Remove.
+func NewTemporary(dir string) (h *Handle, err error) {
+	parentDir, err := ioutil.TempDir(dir, "cache-")
+	if err != nil {
+		return nil, fmt.Errorf("failed creating temporary cache directory: %s", err)
+	}
+
+	h = &Handle{parentDir: parentDir, temporary: true}
+	if err := h.initDirs(); err != nil {
+		os.RemoveAll(parentDir)
+		return nil, err
 	}
 
 	return h, nil
 }
 
+// IsTemporary returns true if the cache is a throwaway cache created by
+// NewTemporary.
+func (h *Handle) IsTemporary() bool {
+	return h.temporary
+}
+
+// Remove removes a throwaway cache created by NewTemporary, it does nothing
+// for the persistent cache.
+func (h *Handle) Remove() error {
+	if !h.temporary {
+		return nil
+	}
+	return fs.ForceRemoveAll(h.parentDir)
+}
+
+// initDirs initializes the root directory of the cache within its parent
+// directory and the subdirectories of the cache types.
+func (h *Handle) initDirs() error {
+	h.rootDir = path.Join(h.parentDir, SubDirName)
+	if err := initCacheDir(h.rootDir); err != nil {
+		return fmt.Errorf("failed initializing caching directory: %s", err)
+	}
+	for _, ct := range append(FileCacheTypes, DirCacheTypes...) {
+		dir := h.getCacheTypeDir(ct)
+		if err := initCacheDir(dir); err != nil {
+			return fmt.Errorf("failed initializing caching directory: %s", err)
+		}
+	}
+	return nil
+}
+
 // getCacheParentDir figures out where the parent directory of the cache is.
 //
 // Singularity makes the following assumptions:
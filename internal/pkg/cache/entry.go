@@ -9,13 +9,14 @@ package cache
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
 	"github.com/sylabs/singularity/pkg/sylog"
 )
 
-// Entry is a structure representing an entry in the cache. An entry is a file under the
-// CacheType subdir within the Cache rootDir
+// Entry is a structure representing an entry in the cache. An entry is a file, or a directory
+// for directory cache types, under the CacheType subdir within the Cache rootDir
 type Entry struct {
 	// cacheType indicates which subcache / subdir the entry belongs to, e.g. 'library'
 	CacheType string
@@ -27,6 +28,12 @@ type Entry struct {
 	// tmpPath is the temporary location that should be used for a new cache entry as it
 	// is created
 	TmpPath string
+	// Source is the URI or path a new cache entry is created from, it's
+	// recorded in the entry manifest when it is finalized
+	Source string
+
+	handle *Handle
+	hash   string
 }
 
 // Finalize an entry by renaming it to its permanent path atomically
@@ -37,18 +44,37 @@ func (e *Entry) Finalize() error {
 	//   https://golang.org/pkg/os/#Rename
 	err := os.Rename(e.TmpPath, e.Path)
 	if err != nil {
+		// A directory entry may have been finalized concurrently, keep it
+		if fs.IsDir(e.TmpPath) && fs.IsDir(e.Path) {
+			sylog.Debugf("Cache entry %s already finalized", e.Path)
+			return nil
+		}
 		return fmt.Errorf("could not finalize cached file: %v", err)
 	}
-	return nil
+	if e.handle == nil {
+		return nil
+	}
+
+	m, err := newManifest(e.Path, e.Source, time.Now())
+	if err != nil {
+		return err
+	}
+	return e.handle.writeManifest(e.CacheType, e.hash, m)
 }
 
 // CleanTmp should be defer'd when an Entry is created and will remove any temporary file
+// or directory
 func (e *Entry) CleanTmp() {
 	// If there is no TmpPath / file there then there is nothing to clean up
-	if e.TmpPath == "" || !fs.IsFile(e.TmpPath) {
+	if e.TmpPath == "" {
 		return
 	}
-	err := os.Remove(e.TmpPath)
+	var err error
+	if fs.IsDir(e.TmpPath) {
+		err = fs.ForceRemoveAll(e.TmpPath)
+	} else if fs.IsFile(e.TmpPath) {
+		err = os.Remove(e.TmpPath)
+	}
 	if err != nil {
 		sylog.Errorf("Could not remove cache temporary file '%s': %v", e.TmpPath, err)
 	}
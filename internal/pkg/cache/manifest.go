@@ -0,0 +1,225 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// manifestDirName is the directory, within the cache root directory, holding
+// the manifests of the entries in a subdirectory per cache type.
+const manifestDirName = "manifests"
+
+// Manifest records the origin and content of a cache entry, so the entry can
+// be verified and its usage tracked without relying on file times.
+type Manifest struct {
+	// Source is the URI or path the entry was created from, it's empty
+	// for entries created before manifests were recorded
+	Source string `json:"source,omitempty"`
+	// Digest is the sha256 digest of the entry content, "sha256:<hex>", it's
+	// empty for directory entries
+	Digest string `json:"digest,omitempty"`
+	// Created is the time the entry was added to the cache
+	Created time.Time `json:"created"`
+	// Accessed is the last time the entry was used
+	Accessed time.Time `json:"accessed"`
+	// Size is the size of the entry, or the size of the files of a
+	// directory entry
+	Size int64 `json:"size"`
+}
+
+// manifestPath returns the path of the manifest of the entry hash.
+func (h *Handle) manifestPath(cacheType, hash string) string {
+	return filepath.Join(h.rootDir, manifestDirName, cacheType, hash+".json")
+}
+
+// ReadManifest returns the manifest of the entry hash of cacheType. The
+// manifest of an entry created before manifests were recorded is created
+// from the entry content, without source.
+func (h *Handle) ReadManifest(cacheType, hash string) (*Manifest, error) {
+	if h.disabled {
+		return nil, fmt.Errorf("cache is disabled")
+	}
+
+	m, err := h.readManifestFile(cacheType, hash)
+	if os.IsNotExist(err) {
+		return h.migrateManifest(cacheType, hash)
+	} else if err != nil {
+		return nil, fmt.Errorf("while reading manifest of cache entry %s: %w", hash, err)
+	}
+	return m, nil
+}
+
+// readManifestFile reads the manifest of the entry hash, it returns an
+// error satisfying os.IsNotExist if the entry has no manifest yet.
+func (h *Handle) readManifestFile(cacheType, hash string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(h.manifestPath(cacheType, hash))
+	if err != nil {
+		return nil, err
+	}
+	m := new(Manifest)
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("while decoding manifest: %v", err)
+	}
+	return m, nil
+}
+
+// migrateManifest creates the manifest of the existing entry hash which has
+// none, its creation time is the entry modification time.
+func (h *Handle) migrateManifest(cacheType, hash string) (*Manifest, error) {
+	path := filepath.Join(h.getCacheTypeDir(cacheType), hash)
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("while checking cache entry %s: %v", hash, err)
+	}
+
+	sylog.Debugf("Recording manifest of cache entry %s", path)
+	m, err := newManifest(path, "", fi.ModTime())
+	if err != nil {
+		return nil, err
+	}
+	return m, h.writeManifest(cacheType, hash, m)
+}
+
+// writeManifest atomically writes the manifest m of the entry hash.
+func (h *Handle) writeManifest(cacheType, hash string, m *Manifest) error {
+	path := h.manifestPath(cacheType, hash)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("while creating cache manifest directory: %v", err)
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("while encoding manifest of cache entry %s: %v", hash, err)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "tmp_")
+	if err != nil {
+		return fmt.Errorf("while writing manifest of cache entry %s: %v", hash, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("while writing manifest of cache entry %s: %v", hash, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("while writing manifest of cache entry %s: %v", hash, err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// removeManifest removes the manifest of the entry hash, if any.
+func (h *Handle) removeManifest(cacheType, hash string) error {
+	err := os.Remove(h.manifestPath(cacheType, hash))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// RemoveEntry removes the entry hash of cacheType and its manifest.
+func (h *Handle) RemoveEntry(cacheType, hash string) error {
+	if err := fs.ForceRemoveAll(filepath.Join(h.getCacheTypeDir(cacheType), hash)); err != nil {
+		return fmt.Errorf("could not remove cache entry %s: %v", hash, err)
+	}
+	return h.removeManifest(cacheType, hash)
+}
+
+// touchManifest records that the entry hash was used now.
+func (h *Handle) touchManifest(cacheType, hash string) {
+	m, err := h.ReadManifest(cacheType, hash)
+	if err == nil {
+		m.Accessed = time.Now()
+		err = h.writeManifest(cacheType, hash, m)
+	}
+	if err != nil {
+		sylog.Debugf("Could not update manifest of cache entry %s: %v", hash, err)
+	}
+}
+
+// VerifyEntry checks that the content of the entry hash of cacheType
+// matches its manifest, it returns an error wrapping ErrBadChecksum if it
+// doesn't. An entry without manifest gets one and is considered valid.
+func (h *Handle) VerifyEntry(cacheType, hash string) (*Manifest, error) {
+	m, err := h.ReadManifest(cacheType, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, verifyManifest(filepath.Join(h.getCacheTypeDir(cacheType), hash), m)
+}
+
+// verifyManifest checks that the content of the entry at path matches its
+// manifest m, it returns an error wrapping ErrBadChecksum if it doesn't.
+func verifyManifest(path string, m *Manifest) error {
+	got, err := newManifest(path, m.Source, m.Created)
+	if err != nil {
+		return err
+	}
+	if got.Size != m.Size {
+		return fmt.Errorf("%w: size is %d bytes instead of %d", ErrBadChecksum, got.Size, m.Size)
+	}
+	if got.Digest != m.Digest {
+		return fmt.Errorf("%w: digest is %s instead of %s", ErrBadChecksum, got.Digest, m.Digest)
+	}
+	return nil
+}
+
+// newManifest returns the manifest of the entry at path created at time
+// created from source.
+func newManifest(path, source string, created time.Time) (*Manifest, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("while checking cache entry %s: %v", path, err)
+	}
+
+	m := &Manifest{
+		Source:   source,
+		Created:  created,
+		Accessed: created,
+		Size:     fi.Size(),
+	}
+	if fi.IsDir() {
+		m.Size = DirSize(path)
+		return m, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("while reading cache entry %s: %v", path, err)
+	}
+	defer f.Close()
+
+	d := sha256.New()
+	if _, err := io.Copy(d, f); err != nil {
+		return nil, fmt.Errorf("while computing digest of cache entry %s: %v", path, err)
+	}
+	m.Digest = fmt.Sprintf("sha256:%x", d.Sum(nil))
+	return m, nil
+}
+
+// DirSize returns the space used by the files of the directory at path,
+// files which can't be accessed are ignored.
+func DirSize(path string) int64 {
+	var size int64
+	filepath.Walk(path, func(_ string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	return size
+}
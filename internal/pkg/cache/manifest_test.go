@@ -0,0 +1,253 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// addEntry adds an entry holding data from source to the cacheType cache.
+func addEntry(t *testing.T, h *Handle, cacheType, hash, source string, data []byte) *Entry {
+	e, err := h.GetEntry(cacheType, hash)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer e.CleanTmp()
+
+	if err := ioutil.WriteFile(e.TmpPath, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	e.Source = source
+	if err := e.Finalize(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return e
+}
+
+func TestManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache-manifest-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h, err := New(Config{ParentDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("image content")
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+	source := "library://alpine:latest"
+
+	before := time.Now()
+	e := addEntry(t, h, LibraryCacheType, "hash", source, data)
+
+	m, err := h.ReadManifest(LibraryCacheType, "hash")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if m.Source != source {
+		t.Errorf("got source %q, want %q", m.Source, source)
+	}
+	if m.Digest != digest {
+		t.Errorf("got digest %q, want %q", m.Digest, digest)
+	}
+	if m.Size != int64(len(data)) {
+		t.Errorf("got size %d, want %d", m.Size, len(data))
+	}
+	if m.Created.Before(before) || !m.Accessed.Equal(m.Created) {
+		t.Errorf("got created %s and accessed %s, want %s", m.Created, m.Accessed, before)
+	}
+
+	// using the entry updates its access time only
+	time.Sleep(10 * time.Millisecond)
+	if e, err := h.GetEntry(LibraryCacheType, "hash"); err != nil || !e.Exists {
+		t.Fatalf("entry not found: %v", err)
+	}
+	used, err := h.ReadManifest(LibraryCacheType, "hash")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !used.Accessed.After(m.Accessed) || !used.Created.Equal(m.Created) || used.Source != source {
+		t.Errorf("got manifest %+v after use, want accessed after %s", used, m.Accessed)
+	}
+
+	if _, err := h.VerifyEntry(LibraryCacheType, "hash"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := ioutil.WriteFile(e.Path, []byte("image CONTENT"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.VerifyEntry(LibraryCacheType, "hash"); !errors.Is(err, ErrBadChecksum) {
+		t.Errorf("got error %v, want %v", err, ErrBadChecksum)
+	}
+
+	if err := h.RemoveEntry(LibraryCacheType, "hash"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(h.manifestPath(LibraryCacheType, "hash")); !os.IsNotExist(err) {
+		t.Errorf("manifest not removed with the entry: %v", err)
+	}
+}
+
+func TestManifestMigration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache-manifest-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h, err := New(Config{ParentDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an entry created before manifests were recorded
+	data := []byte("old image")
+	path := filepath.Join(h.getCacheTypeDir(OrasCacheType), "old")
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := h.ReadManifest(OrasCacheType, "old")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want := fmt.Sprintf("sha256:%x", sha256.Sum256(data)); m.Digest != want {
+		t.Errorf("got digest %q, want %q", m.Digest, want)
+	}
+	if m.Source != "" || !m.Created.Equal(mtime) {
+		t.Errorf("got source %q created %s, want no source created %s", m.Source, m.Created, mtime)
+	}
+	if _, err := os.Stat(h.manifestPath(OrasCacheType, "old")); err != nil {
+		t.Errorf("manifest not recorded: %s", err)
+	}
+}
+
+func TestCleanCacheManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache-manifest-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h, err := New(Config{ParentDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addEntry(t, h, NetCacheType, "unused", "https://example.com/unused.sif", nil)
+	addEntry(t, h, NetCacheType, "used", "https://example.com/used.sif", nil)
+
+	// the entry unused was last used 10 days ago while its file is new
+	m, err := h.ReadManifest(NetCacheType, "unused")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Accessed = time.Now().Add(-10 * 24 * time.Hour)
+	if err := h.writeManifest(NetCacheType, "unused", m); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.CleanCache(NetCacheType, false, 5); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(h.getCacheTypeDir(NetCacheType), "unused")); !os.IsNotExist(err) {
+		t.Errorf("unused entry not removed: %v", err)
+	}
+	if _, err := os.Stat(h.manifestPath(NetCacheType, "unused")); !os.IsNotExist(err) {
+		t.Errorf("unused entry manifest not removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(h.getCacheTypeDir(NetCacheType), "used")); err != nil {
+		t.Errorf("used entry removed: %v", err)
+	}
+}
+
+func TestLimitCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache-limit-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h, err := New(Config{ParentDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("0123456789")
+	for _, hash := range []string{"old", "used", "new"} {
+		addEntry(t, h, LibraryCacheType, hash, "", data)
+		time.Sleep(10 * time.Millisecond)
+	}
+	// using an entry makes it the most recently used
+	if e, err := h.GetEntry(LibraryCacheType, "used"); err != nil || !e.Exists {
+		t.Fatalf("entry not found: %v", err)
+	}
+
+	// the entries fit in the limit
+	if err := h.LimitCache(LibraryCacheType, 30); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, hash := range []string{"old", "used", "new"} {
+		if _, err := os.Stat(filepath.Join(h.getCacheTypeDir(LibraryCacheType), hash)); err != nil {
+			t.Errorf("entry %s removed below the limit: %s", hash, err)
+		}
+	}
+
+	// the least recently used entries are removed first
+	if err := h.LimitCache(LibraryCacheType, 15); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for hash, kept := range map[string]bool{"old": false, "new": false, "used": true} {
+		_, err := os.Stat(filepath.Join(h.getCacheTypeDir(LibraryCacheType), hash))
+		if kept && err != nil {
+			t.Errorf("entry %s removed: %s", hash, err)
+		} else if !kept && err == nil {
+			t.Errorf("entry %s kept above the limit", hash)
+		}
+		if _, err := os.Stat(h.manifestPath(LibraryCacheType, hash)); kept == os.IsNotExist(err) {
+			t.Errorf("manifest of entry %s not handled with the entry", hash)
+		}
+	}
+}
+
+func TestLayerCacheMaxSize(t *testing.T) {
+	defer os.Unsetenv(LayerCacheMaxSizeEnv)
+
+	tests := []struct {
+		env     string
+		size    int64
+		wantErr bool
+	}{
+		{env: "", size: DefaultLayerCacheMaxSize << 20},
+		{env: "0", size: 0},
+		{env: "100", size: 100 << 20},
+		{env: "-1", wantErr: true},
+		{env: "10G", wantErr: true},
+	}
+	for _, tt := range tests {
+		os.Setenv(LayerCacheMaxSizeEnv, tt.env)
+		size, err := LayerCacheMaxSize()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: unexpected error: %v", tt.env, err)
+		} else if size != tt.size {
+			t.Errorf("%q: got size %d, want %d", tt.env, size, tt.size)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// usageMaxSize is the size above which the usage database is compacted
+// after a record.
+const usageMaxSize = 1 << 20
+
+// usageDBExt is the extension of the usage database files of the users.
+const usageDBExt = ".db"
+
+// Usage holds the usage statistics of an image.
+type Usage struct {
+	// Image is the absolute path of the image
+	Image string
+	// Count is the number of times the image was run
+	Count uint64
+	// LastUsed is the last time the image was run
+	LastUsed time.Time
+}
+
+// UsageDB is the local database recording the images run by a user. It is
+// stored in the state directory shared by all users, which must only hold
+// databases owned by their user. It is
+// an append-only file with a line per run, or per image once compacted,
+// "<unix time> <count> <quoted image path>". A record is a single write
+// appended under a shared lock, compactions take an exclusive lock and are
+// skipped rather than waited for, so recording never blocks.
+type UsageDB struct {
+	path string
+}
+
+// NewUsageDB returns the usage database stored in the file path.
+func NewUsageDB(path string) *UsageDB {
+	return &UsageDB{path: path}
+}
+
+// UsageDBPath returns the path of the usage database of the user uid in the
+// directory dir holding the databases of all users.
+func UsageDBPath(dir string, uid int) string {
+	return filepath.Join(dir, strconv.Itoa(uid)+usageDBExt)
+}
+
+// AllUsage returns the usage statistics of the images run by all users,
+// recorded in the databases of the directory dir, sorted by decreasing run
+// count.
+func AllUsage(dir string) ([]*Usage, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+usageDBExt))
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]*Usage)
+	for _, path := range paths {
+		dm, err := NewUsageDB(path).read()
+		if err != nil {
+			return nil, err
+		}
+		for image, du := range dm {
+			u, ok := m[image]
+			if !ok {
+				m[image] = du
+				continue
+			}
+			u.Count += du.Count
+			if du.LastUsed.After(u.LastUsed) {
+				u.LastUsed = du.LastUsed
+			}
+		}
+	}
+	return sortUsage(m), nil
+}
+
+// Path returns the path of the usage database file.
+func (db *UsageDB) Path() string {
+	return db.path
+}
+
+// Record records a run of the image at the absolute path image at time t.
+func (db *UsageDB) Record(image string, t time.Time) error {
+	f, err := db.openLocked(false)
+	if err != nil {
+		return err
+	} else if f == nil {
+		sylog.Debugf("Usage database %s is being compacted, not recording %s", db.path, image)
+		return nil
+	}
+
+	line := fmt.Sprintf("%d 1 %s\n", t.Unix(), strconv.Quote(image))
+	_, err = f.WriteString(line)
+	fi, _ := f.Stat()
+	// release the shared lock before a compaction
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("while recording usage of %s: %s", image, err)
+	}
+
+	if fi != nil && fi.Size() > usageMaxSize {
+		if err := db.Compact(); err != nil {
+			sylog.Debugf("Could not compact usage database %s: %s", db.path, err)
+		}
+	}
+	return nil
+}
+
+// openLocked opens the database for appending with a shared lock, or an
+// exclusive one, it returns nil if the lock is held by another process.
+// The database file is opened again if it was replaced by a compaction
+// while waiting for the lock. The directory of the database isn't created,
+// the installation creates the state directory so every user can add their
+// database to it.
+func (db *UsageDB) openLocked(exclusive bool) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(db.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("while opening usage database %s: %s", db.path, err)
+		}
+		if locked, err := tryLock(f, exclusive); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("while locking usage database %s: %s", db.path, err)
+		} else if !locked {
+			f.Close()
+			return nil, nil
+		}
+
+		fst, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("while checking usage database %s: %s", db.path, err)
+		}
+		if !isOwner(fst) {
+			f.Close()
+			return nil, fmt.Errorf("usage database %s is not owned by the current user", db.path)
+		}
+		if pst, err := os.Stat(db.path); err == nil && os.SameFile(pst, fst) {
+			return f, nil
+		}
+		f.Close()
+	}
+}
+
+// Usage returns the usage statistics of the recorded images sorted by
+// decreasing run count.
+func (db *UsageDB) Usage() ([]*Usage, error) {
+	m, err := db.read()
+	if err != nil {
+		return nil, err
+	}
+	return sortUsage(m), nil
+}
+
+// Compact rewrites the database with a line per image, it does nothing if
+// the database is being recorded to or compacted.
+func (db *UsageDB) Compact() error {
+	f, err := db.openLocked(true)
+	if err != nil || f == nil {
+		return err
+	}
+	defer f.Close()
+
+	m, err := db.read()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(db.path), filepath.Base(db.path)+"-")
+	if err != nil {
+		return fmt.Errorf("while creating usage database: %s", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	for _, u := range sortUsage(m) {
+		fmt.Fprintf(w, "%d %d %s\n", u.LastUsed.Unix(), u.Count, strconv.Quote(u.Image))
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("while writing usage database: %s", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("while writing usage database: %s", err)
+	}
+	// the lock is held until the new database replaced the old one
+	return os.Rename(tmp.Name(), db.path)
+}
+
+// read returns the usage statistics stored in the database, invalid lines
+// are ignored.
+func (db *UsageDB) read() (map[string]*Usage, error) {
+	m := make(map[string]*Usage)
+
+	f, err := os.Open(db.path)
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("while opening usage database %s: %s", db.path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		ts, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		count, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		image, err := strconv.Unquote(fields[2])
+		if err != nil {
+			continue
+		}
+
+		u, ok := m[image]
+		if !ok {
+			u = &Usage{Image: image}
+			m[image] = u
+		}
+		u.Count += count
+		if t := time.Unix(ts, 0); t.After(u.LastUsed) {
+			u.LastUsed = t
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("while reading usage database %s: %s", db.path, err)
+	}
+	return m, nil
+}
+
+func sortUsage(m map[string]*Usage) []*Usage {
+	usage := make([]*Usage, 0, len(m))
+	for _, u := range m {
+		usage = append(usage, u)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Count != usage[j].Count {
+			return usage[i].Count > usage[j].Count
+		}
+		return usage[i].Image < usage[j].Image
+	})
+	return usage
+}
+
+// EntryType returns the file cache type of the image at path if it's a
+// cache entry, or an empty string otherwise.
+func (h *Handle) EntryType(path string) string {
+	if h.disabled || h.rootDir == "" {
+		return ""
+	}
+	for _, ct := range FileCacheTypes {
+		if filepath.Dir(path) == h.getCacheTypeDir(ct) {
+			return ct
+		}
+	}
+	return ""
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestUsageDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "usage-db-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db := NewUsageDB(filepath.Join(dir, "usage.db"))
+
+	usage, err := db.Usage()
+	if err != nil {
+		t.Fatalf("unexpected error with missing database: %s", err)
+	} else if len(usage) != 0 {
+		t.Fatalf("unexpected usage %v with missing database", usage)
+	}
+
+	t0 := time.Unix(1600000000, 0)
+	records := []struct {
+		image string
+		t     time.Time
+	}{
+		{"/images/a.sif", t0},
+		{"/images/with space\nand newline.sif", t0.Add(time.Hour)},
+		{"/images/a.sif", t0.Add(2 * time.Hour)},
+		{"/images/a.sif", t0.Add(time.Minute)},
+	}
+	for _, r := range records {
+		if err := db.Record(r.image, r.t); err != nil {
+			t.Fatalf("unexpected error while recording %s: %s", r.image, err)
+		}
+	}
+
+	check := func(t *testing.T) {
+		usage, err := db.Usage()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(usage) != 2 {
+			t.Fatalf("got %d images, want 2", len(usage))
+		}
+		if u := usage[0]; u.Image != "/images/a.sif" || u.Count != 3 || !u.LastUsed.Equal(t0.Add(2*time.Hour)) {
+			t.Errorf("unexpected usage %+v", u)
+		}
+		if u := usage[1]; u.Image != records[1].image || u.Count != 1 || !u.LastUsed.Equal(records[1].t) {
+			t.Errorf("unexpected usage %+v", u)
+		}
+	}
+	t.Run("Records", check)
+
+	// invalid lines are ignored
+	f, err := os.OpenFile(db.Path(), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("garbage\n1 x \"/images/b.sif\"\n1 1 unquoted\n")
+	f.Close()
+	t.Run("Invalid", check)
+
+	if err := db.Compact(); err != nil {
+		t.Fatalf("unexpected error while compacting: %s", err)
+	}
+	data, err := ioutil.ReadFile(db.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "\n"); n != 2 {
+		t.Errorf("got %d lines after compaction, want 2", n)
+	}
+	t.Run("Compacted", check)
+
+	// records are skipped during a compaction
+	f, err = os.Open(db.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Record("/images/c.sif", t0); err != nil {
+		t.Errorf("unexpected error while recording during a compaction: %s", err)
+	}
+	unix.Flock(int(f.Fd()), unix.LOCK_UN)
+	t.Run("Locked", check)
+}
+
+func TestAllUsage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "usage-db-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	t0 := time.Unix(1600000000, 0)
+	records := map[int][]string{
+		1000: {"/images/a.sif", "/images/b.sif"},
+		1001: {"/images/a.sif"},
+	}
+	for uid, images := range records {
+		db := NewUsageDB(UsageDBPath(dir, uid))
+		for i, image := range images {
+			if err := db.Record(image, t0.Add(time.Duration(uid+i)*time.Second)); err != nil {
+				t.Fatalf("unexpected error while recording %s: %s", image, err)
+			}
+		}
+	}
+	// files which aren't databases are ignored
+	if err := ioutil.WriteFile(filepath.Join(dir, "README"), []byte("1 1 \"/images/c.sif\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	usage, err := AllUsage(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(usage) != 2 {
+		t.Fatalf("got %d images, want 2", len(usage))
+	}
+	if u := usage[0]; u.Image != "/images/a.sif" || u.Count != 2 || !u.LastUsed.Equal(t0.Add(1001*time.Second)) {
+		t.Errorf("unexpected usage %+v", u)
+	}
+	if u := usage[1]; u.Image != "/images/b.sif" || u.Count != 1 {
+		t.Errorf("unexpected usage %+v", u)
+	}
+
+	// a database of another user isn't recorded to
+	if os.Geteuid() != 0 {
+		t.Skip("ownership of a database of another user requires root")
+	}
+	path := UsageDBPath(dir, 1000)
+	if err := os.Chown(path, 1000, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewUsageDB(path).Record("/images/c.sif", t0); err == nil {
+		t.Errorf("unexpected success while recording to a database of another user")
+	}
+}
+
+func TestEntryType(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h, err := New(Config{ParentDir: dir})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{filepath.Join(dir, SubDirName, LibraryCacheType, "sha256.1234"), LibraryCacheType},
+		{filepath.Join(dir, SubDirName, OciTempCacheType, "1234"), OciTempCacheType},
+		{filepath.Join(dir, SubDirName, LayerCacheType, "1234"), ""},
+		{filepath.Join(dir, "image.sif"), ""},
+	}
+	for _, tt := range tests {
+		if got := h.EntryType(tt.path); got != tt.want {
+			t.Errorf("got type %q for %s, want %q", got, tt.path, tt.want)
+		}
+	}
+}
@@ -22,7 +22,9 @@ type Manager struct {
 	cgroup cgroups.Cgroup
 }
 
-func readSpecFromFile(path string) (spec specs.LinuxResources, err error) {
+// ReadSpecFromFile returns the OCI resources restriction described by the
+// TOML configuration file path.
+func ReadSpecFromFile(path string) (spec specs.LinuxResources, err error) {
 	conf, err := LoadConfig(path)
 	if err != nil {
 		return
@@ -91,7 +93,7 @@ func (m *Manager) ApplyFromSpec(spec *specs.LinuxResources) (err error) {
 // ApplyFromFile applies cgroups resources restriction from TOML configuration
 // file
 func (m *Manager) ApplyFromFile(path string) error {
-	spec, err := readSpecFromFile(path)
+	spec, err := ReadSpecFromFile(path)
 	if err != nil {
 		return err
 	}
@@ -120,13 +122,24 @@ func (m *Manager) UpdateFromSpec(spec *specs.LinuxResources) (err error) {
 
 // UpdateFromFile updates cgroups resources restriction from TOML configuration
 func (m *Manager) UpdateFromFile(path string) error {
-	spec, err := readSpecFromFile(path)
+	spec, err := ReadSpecFromFile(path)
 	if err != nil {
 		return err
 	}
 	return m.UpdateFromSpec(&spec)
 }
 
+// AddProcess adds the process pid to the cgroups of the managed process,
+// the process is then subject to the same resources restriction.
+func (m *Manager) AddProcess(pid int) error {
+	if m.cgroup == nil {
+		if err := m.loadFromPid(); err != nil {
+			return err
+		}
+	}
+	return m.cgroup.Add(cgroups.Process{Pid: pid})
+}
+
 // Remove removes resources restriction for current managed process
 func (m *Manager) Remove() error {
 	// deletes subgroup
@@ -186,3 +186,58 @@ func TestPauseResume(t *testing.T) {
 
 	cmd.Wait()
 }
+
+func TestAddProcess(t *testing.T) {
+	test.EnsurePrivilege(t)
+
+	manager := &Manager{}
+	if err := manager.AddProcess(os.Getpid()); err == nil {
+		t.Errorf("unexpected success with PID 0")
+	}
+	defer func() {
+		if manager.cgroup != nil {
+			manager.Remove()
+		}
+	}()
+
+	var pids []int
+	for i := 0; i < 2; i++ {
+		cmd := exec.Command("/bin/cat")
+		pipe, err := cmd.StdinPipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		// the processes must exit before the cgroups are removed
+		defer func() {
+			pipe.Close()
+			cmd.Wait()
+		}()
+		pids = append(pids, cmd.Process.Pid)
+	}
+
+	path := filepath.Join("/singularity", strconv.Itoa(pids[0]))
+	manager = &Manager{Pid: pids[0], Path: path}
+	if err := manager.ApplyFromFile("example/cgroups.toml"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the cgroups are loaded from the process they are joined from
+	joined := &Manager{Pid: pids[0]}
+	if err := joined.AddProcess(pids[1]); err != nil {
+		t.Fatalf("failed to add process %d: %s", pids[1], err)
+	}
+
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pids[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) == 3 && strings.Contains(fields[1], "memory") && fields[2] != path {
+			t.Errorf("process %d is in memory cgroup %s instead of %s", pids[1], fields[2], path)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cgroups
+
+import (
+	"fmt"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// ReadOnlyDevice returns the device cgroup rule denying writes to the block
+// or character device at path, a read-only bind mount doesn't prevent
+// writes to a device node so the device controller must enforce it.
+func ReadOnlyDevice(path string) (specs.LinuxDeviceCgroup, error) {
+	var st unix.Stat_t
+	var rule specs.LinuxDeviceCgroup
+
+	if err := unix.Stat(path, &st); err != nil {
+		return rule, fmt.Errorf("while getting %s information: %s", path, err)
+	}
+
+	switch st.Mode & unix.S_IFMT {
+	case unix.S_IFBLK:
+		rule.Type = "b"
+	case unix.S_IFCHR:
+		rule.Type = "c"
+	default:
+		return rule, fmt.Errorf("%s is not a block or character device", path)
+	}
+
+	major := int64(unix.Major(uint64(st.Rdev)))
+	minor := int64(unix.Minor(uint64(st.Rdev)))
+	rule.Major = &major
+	rule.Minor = &minor
+	rule.Access = "w"
+
+	return rule, nil
+}
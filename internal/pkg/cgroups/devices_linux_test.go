@@ -0,0 +1,39 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cgroups
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestReadOnlyDevice(t *testing.T) {
+	rule, err := ReadOnlyDevice("/dev/null")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if rule.Allow || rule.Type != "c" || rule.Access != "w" {
+		t.Errorf("unexpected rule %+v", rule)
+	}
+	if rule.Major == nil || *rule.Major != 1 || rule.Minor == nil || *rule.Minor != 3 {
+		t.Errorf("unexpected /dev/null device number in rule %+v", rule)
+	}
+
+	f, err := ioutil.TempFile("", "not-a-device-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	if _, err := ReadOnlyDevice(f.Name()); err == nil {
+		t.Errorf("unexpected success with a regular file")
+	}
+	if _, err := ReadOnlyDevice("/dev/non-existent-device"); err == nil {
+		t.Errorf("unexpected success with a non-existent device")
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package bucket pulls images stored in object storage buckets, referenced
+// by s3://bucket/key and gs://bucket/key URIs, through the cache.
+package bucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// S3 is the scheme of the Amazon S3 and S3 compatible buckets.
+	S3 = "s3"
+	// GS is the scheme of the Google Cloud Storage buckets.
+	GS = "gs"
+)
+
+// DefaultChecksumKey is the object metadata key holding the hex encoded
+// sha256 digest of an image when Config.ChecksumKey is not set.
+const DefaultChecksumKey = "sha256"
+
+// ErrNotFound is returned when the object doesn't exist.
+var ErrNotFound = errors.New("object not found")
+
+// Config holds the settings of the pulls from the buckets of an object
+// storage service.
+type Config struct {
+	// Scheme is the object storage service, s3 or gs
+	Scheme string `yaml:"Scheme"`
+	// Bucket is the bucket the settings apply to, the settings without
+	// a bucket apply to all the buckets of Scheme
+	Bucket string `yaml:"Bucket,omitempty"`
+	// Endpoint overrides the service endpoint, like
+	// https://minio.example.com:9000 for an S3 compatible store
+	Endpoint string `yaml:"Endpoint,omitempty"`
+	// Region is the region of S3 buckets
+	Region string `yaml:"Region,omitempty"`
+	// CredentialsFile is the path of an AWS shared credentials file for
+	// s3, or of a service account key file for gs
+	CredentialsFile string `yaml:"CredentialsFile,omitempty"`
+	// Profile is the profile of the AWS shared credentials file
+	Profile string `yaml:"Profile,omitempty"`
+	// ChecksumKey is the object metadata key holding the hex encoded
+	// sha256 digest of the image, sha256 by default
+	ChecksumKey string `yaml:"ChecksumKey,omitempty"`
+	// ChecksumSuffix, when set, is appended to the object key to get a
+	// sidecar object holding the digest of the image, like .sha256
+	ChecksumSuffix string `yaml:"ChecksumSuffix,omitempty"`
+	// Anonymous sends unauthenticated requests, for public buckets
+	Anonymous bool `yaml:"Anonymous,omitempty"`
+	// InstanceMetadata allows getting the credentials of the instance role
+	// from the EC2 instance metadata service for s3, or of the instance
+	// service account from the GCE metadata server for gs
+	InstanceMetadata bool `yaml:"InstanceMetadata,omitempty"`
+}
+
+// Validate returns an error if the bucket settings are invalid.
+func (c *Config) Validate() error {
+	if c.Scheme != S3 && c.Scheme != GS {
+		return fmt.Errorf("bucket scheme %q is not supported, must be %s or %s", c.Scheme, S3, GS)
+	}
+	if strings.Contains(c.Bucket, "/") {
+		return fmt.Errorf("bucket name %q must not contain a path", c.Bucket)
+	}
+	if c.Endpoint != "" {
+		u, err := url.Parse(c.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("bucket endpoint %q must be an http(s) URL", c.Endpoint)
+		}
+	}
+	if c.Scheme == GS && (c.Region != "" || c.Profile != "") {
+		return fmt.Errorf("region and profile settings only apply to %s buckets", S3)
+	}
+	if c.Anonymous && (c.CredentialsFile != "" || c.Profile != "" || c.InstanceMetadata) {
+		return fmt.Errorf("anonymous access can't be combined with credentials settings")
+	}
+	return nil
+}
+
+// Lookup returns the settings of the bucket of scheme from configs: the
+// settings of the bucket if any, or else the settings of all the buckets of
+// scheme, or else the default settings.
+func Lookup(configs []Config, scheme, bucket string) Config {
+	found := Config{Scheme: scheme}
+	wide := false
+	for _, c := range configs {
+		if c.Scheme != scheme {
+			continue
+		}
+		if c.Bucket == bucket {
+			return c
+		} else if c.Bucket == "" && !wide {
+			found, wide = c, true
+		}
+	}
+	found.Bucket = bucket
+	return found
+}
+
+// IsBucketRef returns if ref is an s3:// or gs:// reference.
+func IsBucketRef(ref string) bool {
+	return strings.HasPrefix(ref, S3+"://") || strings.HasPrefix(ref, GS+"://")
+}
+
+// ParseRef returns the scheme, the bucket and the object key of the bucket
+// reference ref, in the s3://bucket/key or gs://bucket/key format.
+func ParseRef(ref string) (scheme, bucket, key string, err error) {
+	parts := strings.SplitN(ref, "://", 2)
+	if len(parts) != 2 || (parts[0] != S3 && parts[0] != GS) {
+		return "", "", "", fmt.Errorf("not a bucket reference: %s", ref)
+	}
+	path := strings.SplitN(parts[1], "/", 2)
+	if len(path) != 2 || path[0] == "" || path[1] == "" || strings.HasSuffix(path[1], "/") {
+		return "", "", "", fmt.Errorf("bad reference %s, the format is %s://bucket/key", ref, parts[0])
+	}
+	return parts[0], path[0], path[1], nil
+}
+
+// object describes an object stored in a bucket.
+type object struct {
+	Key  string
+	Size int64
+	// Version identifies the object content, the ETag for s3 and the
+	// generation for gs
+	Version string
+	// Metadata is the user metadata of the object, with lower case keys
+	Metadata map[string]string
+}
+
+// store reads the objects of a bucket.
+type store interface {
+	// service returns the URL of the service endpoint.
+	service() string
+	// stat returns the description of the object key.
+	stat(ctx context.Context, key string) (*object, error)
+	// get returns the content of the object obj from offset, it fails
+	// if the object changed since it was described by stat.
+	get(ctx context.Context, obj *object, offset int64) (io.ReadCloser, error)
+}
+
+// statusError is returned by the stores for an unexpected HTTP status.
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e *statusError) Error() string {
+	if e.msg == "" {
+		return fmt.Sprintf("request failed: %d %s", e.code, http.StatusText(e.code))
+	}
+	return fmt.Sprintf("request failed: %d %s: %s", e.code, http.StatusText(e.code), e.msg)
+}
+
+// retryable returns if the request failing with the status code can be
+// sent again.
+func (e *statusError) retryable() bool {
+	return e.code >= 500 || e.code == http.StatusRequestTimeout || e.code == http.StatusTooManyRequests
+}
+
+// checkResponse returns an error for an unsuccessful response res, the
+// body of which is then closed.
+func checkResponse(res *http.Response) error {
+	if res.StatusCode >= 200 && res.StatusCode <= 299 {
+		return nil
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusPreconditionFailed:
+		return fmt.Errorf("object changed during the download")
+	}
+	b := make([]byte, 512)
+	n, _ := io.ReadFull(res.Body, b)
+	return &statusError{code: res.StatusCode, msg: strings.TrimSpace(string(b[:n]))}
+}
+
+// newStore returns the store of the bucket of the settings c.
+func newStore(ctx context.Context, c Config) (store, error) {
+	switch c.Scheme {
+	case S3:
+		return newS3Store(ctx, c)
+	case GS:
+		return newGSStore(ctx, c)
+	}
+	return nil, fmt.Errorf("bucket scheme %q is not supported", c.Scheme)
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package bucket
+
+import (
+	"os"
+	"testing"
+
+	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
+)
+
+func TestMain(m *testing.M) {
+	useragent.InitValue("singularity", "3.0.0-alpha.1-303-gaed8d30-dirty")
+
+	os.Exit(m.Run())
+}
+
+func TestParseRef(t *testing.T) {
+	tests := []struct {
+		name       string
+		ref        string
+		wantScheme string
+		wantBucket string
+		wantKey    string
+		wantErr    bool
+	}{
+		{name: "S3", ref: "s3://images/busybox.sif", wantScheme: S3, wantBucket: "images", wantKey: "busybox.sif"},
+		{name: "GSPath", ref: "gs://images/tools/busybox.sif", wantScheme: GS, wantBucket: "images", wantKey: "tools/busybox.sif"},
+		{name: "NoKey", ref: "s3://images", wantErr: true},
+		{name: "EmptyKey", ref: "s3://images/", wantErr: true},
+		{name: "Prefix", ref: "gs://images/tools/", wantErr: true},
+		{name: "NoBucket", ref: "gs:///busybox.sif", wantErr: true},
+		{name: "BadScheme", ref: "https://images/busybox.sif", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme, bucket, key, err := ParseRef(tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if scheme != tt.wantScheme || bucket != tt.wantBucket || key != tt.wantKey {
+				t.Errorf("got %q, %q and %q, expected %q, %q and %q", scheme, bucket, key, tt.wantScheme, tt.wantBucket, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{name: "S3", config: Config{Scheme: S3, Bucket: "images", Region: "eu-west-1", Profile: "images"}},
+		{name: "MinIO", config: Config{Scheme: S3, Endpoint: "http://localhost:9000"}},
+		{name: "GS", config: Config{Scheme: GS, CredentialsFile: "/etc/singularity/gs.json", ChecksumSuffix: ".sha256"}},
+		{name: "BadScheme", config: Config{Scheme: "azure"}, wantErr: true},
+		{name: "BucketPath", config: Config{Scheme: S3, Bucket: "images/tools"}, wantErr: true},
+		{name: "BadEndpoint", config: Config{Scheme: S3, Endpoint: "localhost:9000"}, wantErr: true},
+		{name: "GSRegion", config: Config{Scheme: GS, Region: "eu-west-1"}, wantErr: true},
+		{name: "Anonymous", config: Config{Scheme: GS, Bucket: "public", Anonymous: true}},
+		{name: "AnonymousCredentials", config: Config{Scheme: S3, Anonymous: true, CredentialsFile: "/etc/singularity/s3"}, wantErr: true},
+		{name: "AnonymousInstanceMetadata", config: Config{Scheme: S3, Anonymous: true, InstanceMetadata: true}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	configs := []Config{
+		{Scheme: GS, Endpoint: "http://localhost:4443"},
+		{Scheme: S3, Region: "eu-west-1"},
+		{Scheme: S3, Bucket: "images", Endpoint: "http://localhost:9000"},
+		{Scheme: S3, Region: "us-west-2"},
+	}
+
+	tests := []struct {
+		name   string
+		scheme string
+		bucket string
+		want   Config
+	}{
+		{name: "Bucket", scheme: S3, bucket: "images", want: configs[2]},
+		{name: "Scheme", scheme: S3, bucket: "data", want: Config{Scheme: S3, Bucket: "data", Region: "eu-west-1"}},
+		{name: "OtherScheme", scheme: GS, bucket: "images", want: Config{Scheme: GS, Bucket: "images", Endpoint: "http://localhost:4443"}},
+		{name: "Default", scheme: S3, bucket: "data", want: Config{Scheme: S3, Bucket: "data"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := configs
+			if tt.name == "Default" {
+				c = configs[2:3]
+			}
+			if got := Lookup(c, tt.scheme, tt.bucket); got != tt.want {
+				t.Errorf("got %+v, expected %+v", got, tt.want)
+			}
+		})
+	}
+}
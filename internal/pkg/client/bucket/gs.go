@@ -0,0 +1,376 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package bucket
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sylabs/singularity/pkg/sylog"
+	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
+)
+
+const (
+	// gsEndpoint is the Google Cloud Storage service URL.
+	gsEndpoint = "https://storage.googleapis.com"
+	// gsScope is the OAuth2 scope of the access tokens requested.
+	gsScope = "https://www.googleapis.com/auth/devstorage.read_only"
+	// gsTokenURI is the OAuth2 token endpoint when the key file has none.
+	gsTokenURI = "https://oauth2.googleapis.com/token"
+	// gceMetadataHost is the metadata server of the GCE instances.
+	gceMetadataHost = "metadata.google.internal"
+)
+
+// gsStore reads the objects of a Google Cloud Storage bucket with the JSON
+// API.
+type gsStore struct {
+	client   *http.Client
+	bucket   string
+	endpoint string
+	// token is the OAuth2 access token of the requests, empty for the
+	// storage emulator and the anonymous requests
+	token string
+}
+
+func newGSStore(ctx context.Context, c Config) (store, error) {
+	s := &gsStore{
+		client:   &http.Client{},
+		bucket:   c.Bucket,
+		endpoint: c.Endpoint,
+	}
+
+	if s.endpoint == "" {
+		if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+			// the emulator doesn't authenticate the requests
+			s.endpoint = host
+			if !strings.Contains(host, "://") {
+				s.endpoint = "http://" + host
+			}
+			s.endpoint = strings.TrimSuffix(s.endpoint, "/")
+			sylog.Debugf("Using storage emulator at %s", s.endpoint)
+			return s, nil
+		}
+		s.endpoint = gsEndpoint
+	}
+	s.endpoint = strings.TrimSuffix(s.endpoint, "/")
+
+	if c.Anonymous {
+		sylog.Debugf("Sending anonymous requests to GS bucket %s", c.Bucket)
+		return s, nil
+	}
+	token, err := loadGSToken(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	s.token = token
+	return s, nil
+}
+
+func (s *gsStore) service() string {
+	return s.endpoint
+}
+
+// objectURL returns the URL of the object key, with the query q.
+func (s *gsStore) objectURL(key string, q url.Values) string {
+	u := fmt.Sprintf("%s/storage/v1/b/%s/o/%s", s.endpoint, url.PathEscape(s.bucket), url.PathEscape(key))
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	return u
+}
+
+// do sends the request of method to the url u.
+func (s *gsStore) do(ctx context.Context, method, u string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("User-Agent", useragent.Value())
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *gsStore) stat(ctx context.Context, key string) (*object, error) {
+	res, err := s.do(ctx, http.MethodGet, s.objectURL(key, nil), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var o struct {
+		Size       string            `json:"size"`
+		Generation string            `json:"generation"`
+		Metadata   map[string]string `json:"metadata"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&o); err != nil {
+		return nil, fmt.Errorf("bad object description: %v", err)
+	}
+
+	obj := &object{
+		Key:      key,
+		Version:  o.Generation,
+		Metadata: make(map[string]string, len(o.Metadata)),
+	}
+	if _, err := fmt.Sscanf(o.Size, "%d", &obj.Size); err != nil {
+		return nil, fmt.Errorf("bad object size %q", o.Size)
+	}
+	for k, v := range o.Metadata {
+		obj.Metadata[strings.ToLower(k)] = v
+	}
+	return obj, nil
+}
+
+func (s *gsStore) get(ctx context.Context, obj *object, offset int64) (io.ReadCloser, error) {
+	q := url.Values{"alt": {"media"}}
+	if obj.Version != "" {
+		// an object generation never changes, a new one is created
+		q.Set("generation", obj.Version)
+	}
+	header := make(http.Header)
+	if offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	res, err := s.do(ctx, http.MethodGet, s.objectURL(obj.Key, q), header)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 && res.StatusCode != http.StatusPartialContent {
+		res.Body.Close()
+		return nil, fmt.Errorf("range requests not supported by the storage endpoint")
+	}
+	return res.Body, nil
+}
+
+// gsKey is a service account or authorized user key file.
+type gsKey struct {
+	Type string `json:"type"`
+	// service_account fields
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+	// authorized_user fields
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// loadGSToken returns an access token from the first source providing
+// credentials: the credentials file of the settings c when set, or else
+// the GOOGLE_OAUTH_ACCESS_TOKEN and GOOGLE_APPLICATION_CREDENTIALS
+// environment variables, the gcloud application default credentials and,
+// when allowed by the settings c, the GCE metadata server.
+func loadGSToken(ctx context.Context, c Config) (string, error) {
+	if c.CredentialsFile != "" {
+		token, err := gsKeyFileToken(ctx, c.CredentialsFile)
+		if err != nil {
+			return "", fmt.Errorf("while reading GS credentials file %s from the remote configuration: %v", c.CredentialsFile, err)
+		}
+		return token, nil
+	}
+
+	var checked []string
+
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		sylog.Debugf("Using GS access token from the environment")
+		return token, nil
+	}
+	checked = append(checked, "GOOGLE_OAUTH_ACCESS_TOKEN environment variable")
+
+	if file := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); file != "" {
+		token, err := gsKeyFileToken(ctx, file)
+		if err != nil {
+			return "", fmt.Errorf("while reading GS credentials file %s from GOOGLE_APPLICATION_CREDENTIALS: %v", file, err)
+		}
+		return token, nil
+	}
+	checked = append(checked, "GOOGLE_APPLICATION_CREDENTIALS environment variable")
+
+	dir := os.Getenv("CLOUDSDK_CONFIG")
+	if dir == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			dir = filepath.Join(home, ".config", "gcloud")
+		}
+	}
+	if dir != "" {
+		file := filepath.Join(dir, "application_default_credentials.json")
+		token, err := gsKeyFileToken(ctx, file)
+		if err == nil {
+			sylog.Debugf("Using GS credentials from %s", file)
+			return token, nil
+		} else if !os.IsNotExist(err) {
+			return "", fmt.Errorf("while reading GS credentials file %s: %v", file, err)
+		}
+		checked = append(checked, file+" file")
+	}
+
+	if c.InstanceMetadata {
+		host := os.Getenv("GCE_METADATA_HOST")
+		if host == "" {
+			host = gceMetadataHost
+		}
+		token, err := gceMetadataToken(ctx, host)
+		if err == nil {
+			sylog.Debugf("Using GS credentials from the metadata server")
+			return token, nil
+		}
+		sylog.Debugf("Could not get GS credentials from the metadata server: %v", err)
+		checked = append(checked, "metadata server at "+host)
+	}
+
+	return "", fmt.Errorf("no GS credentials found, checked: %s", strings.Join(checked, ", "))
+}
+
+// gsKeyFileToken returns an access token obtained with the key file path.
+func gsKeyFileToken(ctx context.Context, path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var k gsKey
+	if err := json.Unmarshal(b, &k); err != nil {
+		return "", fmt.Errorf("bad key file: %v", err)
+	}
+
+	tokenURI := k.TokenURI
+	if tokenURI == "" {
+		tokenURI = gsTokenURI
+	}
+
+	var form url.Values
+	switch k.Type {
+	case "service_account":
+		assertion, err := gsJWT(&k, tokenURI, time.Now())
+		if err != nil {
+			return "", err
+		}
+		form = url.Values{
+			"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+			"assertion":  {assertion},
+		}
+	case "authorized_user":
+		form = url.Values{
+			"grant_type":    {"refresh_token"},
+			"client_id":     {k.ClientID},
+			"client_secret": {k.ClientSecret},
+			"refresh_token": {k.RefreshToken},
+		}
+	default:
+		return "", fmt.Errorf("key type %q is not supported, must be service_account or authorized_user", k.Type)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return requestToken(req)
+}
+
+// gsJWT returns the signed JWT assertion of the service account key k
+// requesting an access token from tokenURI at time t.
+func gsJWT(k *gsKey, tokenURI string, t time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(k.PrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("no PEM private key in the key file")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return "", fmt.Errorf("bad private key: %v", err)
+		}
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("private key is not an RSA key")
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": k.PrivateKeyID})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   k.ClientEmail,
+		"scope": gsScope,
+		"aud":   tokenURI,
+		"iat":   t.Unix(),
+		"exp":   t.Add(time.Hour).Unix(),
+	})
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+
+	h := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, h[:])
+	if err != nil {
+		return "", fmt.Errorf("could not sign token request: %v", err)
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
+
+// gceMetadataToken returns the access token of the service account of the
+// GCE instance, from the metadata server host.
+func gceMetadataToken(ctx context.Context, host string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	u := fmt.Sprintf("http://%s/computeMetadata/v1/instance/service-accounts/default/token", host)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	return requestToken(req)
+}
+
+// requestToken sends the OAuth2 token request req and returns the access
+// token of the response.
+func requestToken(req *http.Request) (string, error) {
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	if err := checkResponse(res); err != nil {
+		return "", fmt.Errorf("token request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	var t struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&t); err != nil {
+		return "", fmt.Errorf("bad token response: %v", err)
+	}
+	if t.AccessToken == "" {
+		return "", fmt.Errorf("no access token in the token response")
+	}
+	return t.AccessToken, nil
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package bucket
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTokenServer returns a fake OAuth2 token endpoint accepting the JWT
+// assertions signed with key and the refresh token "refresh".
+func newTokenServer(t *testing.T, key *rsa.PrivateKey) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch r.PostForm.Get("grant_type") {
+		case "urn:ietf:params:oauth:grant-type:jwt-bearer":
+			parts := strings.Split(r.PostForm.Get("assertion"), ".")
+			if len(parts) != 3 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+			h := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+			if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, h[:], sig); err != nil {
+				t.Errorf("bad assertion signature: %v", err)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			b, _ := base64.RawURLEncoding.DecodeString(parts[1])
+			var claims map[string]interface{}
+			json.Unmarshal(b, &claims)
+			if claims["scope"] != gsScope || claims["iss"] != "images@example.iam.gserviceaccount.com" {
+				t.Errorf("unexpected claims %v", claims)
+			}
+			w.Write([]byte(`{"access_token":"sa-token","token_type":"Bearer"}`))
+		case "refresh_token":
+			if r.PostForm.Get("refresh_token") != "refresh" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"access_token":"user-token","token_type":"Bearer"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+}
+
+func TestLoadGSToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gs-credentials-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newTokenServer(t, key)
+	defer srv.Close()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saFile := filepath.Join(dir, "service-account.json")
+	sa, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "images@example.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    srv.URL,
+	})
+	if err := ioutil.WriteFile(saFile, sa, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the gcloud application default credentials of a user
+	gcloudDir := filepath.Join(dir, "gcloud")
+	if err := os.Mkdir(gcloudDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	user, _ := json.Marshal(map[string]string{
+		"type":          "authorized_user",
+		"client_id":     "id",
+		"client_secret": "secret",
+		"refresh_token": "refresh",
+		"token_uri":     srv.URL,
+	})
+	if err := ioutil.WriteFile(filepath.Join(gcloudDir, "application_default_credentials.json"), user, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// no metadata server listens on the discard port
+	clean := map[string]string{
+		"HOME":                           dir,
+		"CLOUDSDK_CONFIG":                "",
+		"GOOGLE_OAUTH_ACCESS_TOKEN":      "",
+		"GOOGLE_APPLICATION_CREDENTIALS": "",
+		"GCE_METADATA_HOST":              "127.0.0.1:9",
+	}
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		config  Config
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "AccessToken",
+			env:    map[string]string{"GOOGLE_OAUTH_ACCESS_TOKEN": "env-token"},
+			config: Config{Scheme: GS},
+			want:   "env-token",
+		},
+		{
+			name:   "ApplicationCredentials",
+			env:    map[string]string{"GOOGLE_APPLICATION_CREDENTIALS": saFile},
+			config: Config{Scheme: GS},
+			want:   "sa-token",
+		},
+		{
+			name:   "ConfigFile",
+			env:    map[string]string{"GOOGLE_OAUTH_ACCESS_TOKEN": "env-token"},
+			config: Config{Scheme: GS, CredentialsFile: saFile},
+			want:   "sa-token",
+		},
+		{
+			name:   "ApplicationDefault",
+			env:    map[string]string{"CLOUDSDK_CONFIG": gcloudDir},
+			config: Config{Scheme: GS},
+			want:   "user-token",
+		},
+		{
+			name:    "ConfigFileMissing",
+			config:  Config{Scheme: GS, CredentialsFile: filepath.Join(dir, "missing.json")},
+			wantErr: "while reading GS credentials file " + filepath.Join(dir, "missing.json") + " from the remote configuration",
+		},
+		{
+			name:   "Missing",
+			config: Config{Scheme: GS},
+			wantErr: "no GS credentials found, checked: GOOGLE_OAUTH_ACCESS_TOKEN environment variable, " +
+				"GOOGLE_APPLICATION_CREDENTIALS environment variable, " +
+				filepath.Join(dir, ".config", "gcloud", "application_default_credentials.json") + " file",
+		},
+		{
+			name:   "MissingInstanceMetadata",
+			config: Config{Scheme: GS, InstanceMetadata: true},
+			wantErr: "no GS credentials found, checked: GOOGLE_OAUTH_ACCESS_TOKEN environment variable, " +
+				"GOOGLE_APPLICATION_CREDENTIALS environment variable, " +
+				filepath.Join(dir, ".config", "gcloud", "application_default_credentials.json") + " file, " +
+				"metadata server at 127.0.0.1:9",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer setenv(clean)()
+			defer setenv(tt.env)()
+
+			token, err := loadGSToken(context.Background(), tt.config)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, expected %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if token != tt.want {
+				t.Errorf("got token %q, expected %q", token, tt.want)
+			}
+		})
+	}
+}
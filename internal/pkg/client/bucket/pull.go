@@ -0,0 +1,326 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package bucket
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/client"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// maxAttempts is the number of consecutive failed requests after which the
+// download of an object fails.
+const maxAttempts = 5
+
+// retryDelay is the delay before the first download retry, doubled for each
+// of the next ones.
+var retryDelay = time.Second
+
+// resumableReader reads an object from a store, resuming the download
+// from the offset reached with a range request when it fails.
+type resumableReader struct {
+	ctx    context.Context
+	s      store
+	obj    *object
+	offset int64
+	body   io.ReadCloser
+	// failures is the number of consecutive failed requests
+	failures int
+	delay    time.Duration
+}
+
+func (r *resumableReader) Read(p []byte) (int, error) {
+	for {
+		if r.body == nil {
+			body, err := r.s.get(r.ctx, r.obj, r.offset)
+			if err != nil {
+				if rerr := r.retry(err); rerr != nil {
+					return 0, rerr
+				}
+				continue
+			}
+			r.body = body
+		}
+
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		if n > 0 {
+			r.failures = 0
+		}
+		if err == io.EOF {
+			if r.offset < r.obj.Size {
+				err = io.ErrUnexpectedEOF
+			} else {
+				return n, io.EOF
+			}
+		}
+		if err != nil {
+			r.body.Close()
+			r.body = nil
+			if rerr := r.retry(err); rerr != nil {
+				return n, rerr
+			}
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// retry waits before the next request following the error err, or returns
+// an error if the download can't be resumed.
+func (r *resumableReader) retry(err error) error {
+	var serr *statusError
+	if errors.Is(err, ErrNotFound) || errors.Is(err, context.Canceled) || r.ctx.Err() != nil ||
+		(errors.As(err, &serr) && !serr.retryable()) {
+		return err
+	}
+	r.failures++
+	if r.failures >= maxAttempts {
+		return fmt.Errorf("download failed after %d attempts: %v", r.failures, err)
+	}
+	if r.delay == 0 {
+		r.delay = retryDelay
+	}
+	sylog.Warningf("Download interrupted at %d bytes, resuming in %s: %v", r.offset, r.delay, err)
+	select {
+	case <-time.After(r.delay):
+	case <-r.ctx.Done():
+		return r.ctx.Err()
+	}
+	r.delay *= 2
+	return nil
+}
+
+// Close closes the body of the current request.
+func (r *resumableReader) Close() error {
+	if r.body != nil {
+		return r.body.Close()
+	}
+	return nil
+}
+
+// expectedDigest returns the hex encoded sha256 digest the object obj must
+// have, read from the sidecar object of the settings c if any, or else from
+// the checksum metadata key of obj. It returns an empty digest when the
+// object has no checksum metadata.
+func expectedDigest(ctx context.Context, s store, c Config, obj *object) (string, error) {
+	var digest string
+
+	if c.ChecksumSuffix != "" {
+		sidecar, err := s.stat(ctx, obj.Key+c.ChecksumSuffix)
+		if err != nil {
+			return "", fmt.Errorf("while getting checksum file %s: %v", obj.Key+c.ChecksumSuffix, err)
+		}
+		body, err := s.get(ctx, sidecar, 0)
+		if err != nil {
+			return "", fmt.Errorf("while getting checksum file %s: %v", sidecar.Key, err)
+		}
+		defer body.Close()
+		b, err := ioutil.ReadAll(io.LimitReader(body, 4096))
+		if err != nil {
+			return "", fmt.Errorf("while reading checksum file %s: %v", sidecar.Key, err)
+		}
+		// the sha256sum format, the digest is followed by the file name
+		fields := strings.Fields(string(b))
+		if len(fields) == 0 {
+			return "", fmt.Errorf("checksum file %s is empty", sidecar.Key)
+		}
+		digest = fields[0]
+	} else {
+		key := c.ChecksumKey
+		if key == "" {
+			key = DefaultChecksumKey
+		}
+		digest = obj.Metadata[strings.ToLower(key)]
+		if digest == "" {
+			return "", nil
+		}
+	}
+
+	digest = strings.ToLower(strings.TrimPrefix(digest, "sha256:"))
+	if b, err := hex.DecodeString(digest); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("bad sha256 digest %q for %s", digest, obj.Key)
+	}
+	return digest, nil
+}
+
+// download writes the object obj of the store s to the file path and
+// checks its digest.
+func download(ctx context.Context, s store, c Config, obj *object, path string) error {
+	expected, err := expectedDigest(ctx, s, c, obj)
+	if err != nil {
+		return err
+	}
+	if expected == "" {
+		sylog.Warningf("No %s checksum for %s, the image digest is not verified", c.ChecksumKey, obj.Key)
+	}
+
+	// mode is before umask if path doesn't exist
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0777)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	r := &resumableReader{ctx: ctx, s: s, obj: obj}
+	defer r.Close()
+
+	h := sha256.New()
+	w := io.MultiWriter(out, h)
+	if pb := client.ProgressBarCallback(ctx); pb != nil {
+		err = pb(obj.Size, r, w)
+	} else {
+		err = client.CopyWithContext(ctx, w, r)
+	}
+	if err != nil {
+		return err
+	}
+
+	digest := hex.EncodeToString(h.Sum(nil))
+	sylog.Debugf("Image digest is: sha256:%s", digest)
+	if expected != "" && digest != expected {
+		return fmt.Errorf("%s digest sha256:%s doesn't match the expected digest sha256:%s", obj.Key, digest, expected)
+	}
+	return out.Close()
+}
+
+// cacheKey returns the cache entry name of the version of the object key
+// of bucket at the service endpoint, the object version changes with the
+// object content. The fields are length prefixed so that distinct objects
+// can't have the same name.
+func cacheKey(endpoint, bucket, key, version string) string {
+	h := sha256.New()
+	for _, f := range []string{endpoint, bucket, key, version} {
+		fmt.Fprintf(h, "%d:%s\n", len(f), f)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// pull downloads the image referenced by pullFrom into the cache if
+// directTo is empty, or to the directTo file.
+func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string, configs []Config) (imagePath string, err error) {
+	scheme, bucket, key, err := ParseRef(pullFrom)
+	if err != nil {
+		return "", err
+	}
+	c := Lookup(configs, scheme, bucket)
+	if c.ChecksumKey == "" {
+		c.ChecksumKey = DefaultChecksumKey
+	}
+
+	s, err := newStore(ctx, c)
+	if err != nil {
+		return "", err
+	}
+	obj, err := s.stat(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return "", fmt.Errorf("image %s not found", pullFrom)
+	} else if err != nil {
+		return "", fmt.Errorf("while getting %s: %v", pullFrom, err)
+	}
+
+	if directTo != "" {
+		sylog.Infof("Downloading %s image", scheme)
+		if err := download(ctx, s, c, obj, directTo); err != nil {
+			os.Remove(directTo)
+			return "", fmt.Errorf("unable to download image: %v", err)
+		}
+		return directTo, nil
+	}
+
+	hash := cacheKey(s.service(), bucket, key, obj.Version)
+	sylog.Debugf("Image hash for cache is: %s", hash)
+
+	cacheEntry, err := imgCache.GetEntry(cache.BucketCacheType, hash)
+	if err != nil {
+		return "", fmt.Errorf("unable to check if %v exists in cache: %v", hash, err)
+	}
+	defer cacheEntry.CleanTmp()
+
+	if cacheEntry.Exists {
+		// an entry which doesn't match its digest is replaced
+		_, err := imgCache.VerifyEntry(cache.BucketCacheType, hash)
+		if err == nil {
+			sylog.Verbosef("Using image from cache")
+			return cacheEntry.Path, nil
+		} else if !errors.Is(err, cache.ErrBadChecksum) {
+			return "", err
+		}
+		sylog.Warningf("Replacing corrupted cache entry %s: %v", hash, err)
+		if err := imgCache.RemoveEntry(cache.BucketCacheType, hash); err != nil {
+			return "", err
+		}
+		return pull(ctx, imgCache, directTo, pullFrom, configs)
+	}
+
+	sylog.Infof("Downloading %s image", scheme)
+	cacheEntry.Source = pullFrom
+	if err := download(ctx, s, c, obj, cacheEntry.TmpPath); err != nil {
+		return "", fmt.Errorf("unable to download image: %v", err)
+	}
+	if err := cacheEntry.Finalize(); err != nil {
+		return "", err
+	}
+	return cacheEntry.Path, nil
+}
+
+// Pull will download an image referenced by an s3:// or gs:// URI to the
+// cache, or to a temporary file if cache is disabled. The settings of the
+// bucket are looked up in configs.
+func Pull(ctx context.Context, imgCache *cache.Handle, pullFrom string, tmpDir string, configs []Config) (imagePath string, err error) {
+	directTo := ""
+
+	if imgCache.IsDisabled() {
+		file, err := fs.MakeTmpFile(tmpDir, "sbuild-tmp-cache-", 0700)
+		if err != nil {
+			return "", fmt.Errorf("unable to create tmp file: %v", err)
+		}
+		file.Close()
+		directTo = file.Name()
+		sylog.Infof("Downloading image to tmp cache: %s", directTo)
+	}
+
+	return pull(ctx, imgCache, directTo, pullFrom, configs)
+}
+
+// PullToFile will download an image referenced by an s3:// or gs:// URI to
+// the specified location, through the cache, or directly if cache is
+// disabled. The settings of the bucket are looked up in configs.
+func PullToFile(ctx context.Context, imgCache *cache.Handle, pullTo, pullFrom, tmpDir string, configs []Config) (imagePath string, err error) {
+	directTo := ""
+	if imgCache.IsDisabled() {
+		directTo = pullTo
+		sylog.Debugf("Cache disabled, pulling directly to: %s", directTo)
+	}
+
+	src, err := pull(ctx, imgCache, directTo, pullFrom, configs)
+	if err != nil {
+		return "", fmt.Errorf("error fetching image to cache: %v", err)
+	}
+
+	if directTo == "" {
+		// mode is before umask if pullTo doesn't exist
+		err = fs.CopyFileAtomic(src, pullTo, 0777)
+		if err != nil {
+			return "", fmt.Errorf("error copying image out of cache: %v", err)
+		}
+	}
+
+	return pullTo, nil
+}
@@ -0,0 +1,367 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package bucket
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/cache"
+)
+
+// fakeObject is an object of the fake object storage server.
+type fakeObject struct {
+	content  []byte
+	version  string
+	metadata map[string]string
+}
+
+// fakeServer serves the objects of the bucket "images" with the S3 API,
+// in the path style, and with the Google Cloud Storage JSON API.
+type fakeServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	objects map[string]*fakeObject
+	// cut is the number of bytes after which the next full download
+	// of an object is interrupted
+	cut int
+	// gets counts the object downloads
+	gets int
+	// anonymous rejects the signed S3 requests instead of the unsigned
+	// ones, as a public bucket checks the signatures of the requests
+	anonymous bool
+}
+
+func newFakeServer() *fakeServer {
+	s := &fakeServer{objects: make(map[string]*fakeObject)}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+func (s *fakeServer) put(key string, content []byte, metadata map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h := sha256.Sum256(content)
+	s.objects[key] = &fakeObject{content: content, version: hex.EncodeToString(h[:8]), metadata: metadata}
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var key string
+	media := true
+	if strings.HasPrefix(r.URL.Path, "/storage/v1/b/images/o/") {
+		key = strings.TrimPrefix(r.URL.Path, "/storage/v1/b/images/o/")
+		media = r.URL.Query().Get("alt") == "media"
+	} else if strings.HasPrefix(r.URL.Path, "/images/") {
+		if strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") == s.anonymous {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		key = strings.TrimPrefix(r.URL.Path, "/images/")
+	}
+
+	o, ok := s.objects[key]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if !media {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"size":       strconv.Itoa(len(o.content)),
+			"generation": o.version,
+			"metadata":   o.metadata,
+		})
+		return
+	}
+	if g := r.URL.Query().Get("generation"); g != "" && g != o.version {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	for k, v := range o.metadata {
+		w.Header().Set("X-Amz-Meta-"+k, v)
+	}
+	w.Header().Set("ETag", `"`+o.version+`"`)
+	if r.Method == http.MethodGet {
+		s.gets++
+		if s.cut > 0 && r.Header.Get("Range") == "" {
+			cut := s.cut
+			s.cut = 0
+			w.Header().Set("Content-Length", strconv.Itoa(len(o.content)))
+			w.Write(o.content[:cut])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+	}
+	http.ServeContent(w, r, key, time.Time{}, bytes.NewReader(o.content))
+}
+
+// digest returns the hex encoded sha256 digest of content.
+func digest(content []byte) string {
+	h := sha256.Sum256(content)
+	return hex.EncodeToString(h[:])
+}
+
+func TestPullToFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bucket-pull-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv := newFakeServer()
+	defer srv.Close()
+
+	defer setenv(map[string]string{
+		"AWS_ACCESS_KEY_ID":     "id",
+		"AWS_SECRET_ACCESS_KEY": "secret",
+		"AWS_ENDPOINT_URL":      "",
+		"STORAGE_EMULATOR_HOST": srv.URL,
+	})()
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = time.Millisecond
+
+	content := bytes.Repeat([]byte("image content "), 4096)
+	srv.put("busybox.sif", content, map[string]string{"sha256": digest(content)})
+	srv.put("tools/alpine.sif", content, map[string]string{"checksum": digest(content)})
+	srv.put("tools/alpine.sif.sha256", []byte(digest(content)+"  alpine.sif\n"), nil)
+	srv.put("corrupted.sif", content, map[string]string{"sha256": digest([]byte("other"))})
+	srv.put("unverified.sif", content, nil)
+
+	configs := []Config{
+		{Scheme: S3, Endpoint: srv.URL},
+		{Scheme: S3, Bucket: "images", Endpoint: srv.URL, ChecksumKey: "checksum"},
+		{Scheme: GS, Bucket: "images", ChecksumSuffix: ".sha256"},
+	}
+
+	tests := []struct {
+		name    string
+		ref     string
+		configs []Config
+		cut     int
+		wantErr string
+	}{
+		{name: "S3", ref: "s3://images/busybox.sif", configs: configs[:1]},
+		{name: "S3Resume", ref: "s3://images/busybox.sif", configs: configs[:1], cut: len(content) / 3},
+		{name: "S3ChecksumKey", ref: "s3://images/tools/alpine.sif", configs: configs},
+		{name: "S3Unverified", ref: "s3://images/unverified.sif", configs: configs[:1]},
+		{name: "S3Corrupted", ref: "s3://images/corrupted.sif", configs: configs[:1], wantErr: "doesn't match the expected digest"},
+		{name: "S3NotFound", ref: "s3://images/missing.sif", configs: configs[:1], wantErr: "image s3://images/missing.sif not found"},
+		{name: "GS", ref: "gs://images/busybox.sif"},
+		{name: "GSResume", ref: "gs://images/busybox.sif", cut: len(content) / 2},
+		{name: "GSSidecar", ref: "gs://images/tools/alpine.sif", configs: configs},
+		{name: "GSSidecarMissing", ref: "gs://images/busybox.sif", configs: configs, wantErr: "while getting checksum file busybox.sif.sha256"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			imgCache, err := cache.New(cache.Config{ParentDir: filepath.Join(dir, tt.name)})
+			if err != nil {
+				t.Fatalf("failed to create cache: %s", err)
+			}
+
+			srv.mu.Lock()
+			srv.cut = tt.cut
+			srv.mu.Unlock()
+
+			pullTo := filepath.Join(dir, tt.name+".sif")
+			_, err = PullToFile(context.Background(), imgCache, pullTo, tt.ref, dir, tt.configs)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, expected %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			b, err := ioutil.ReadFile(pullTo)
+			if err != nil {
+				t.Fatalf("failed to read pulled image: %v", err)
+			}
+			if !bytes.Equal(b, content) {
+				t.Errorf("pulled image doesn't match the object")
+			}
+		})
+	}
+}
+
+func TestPullCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bucket-pull-cache-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv := newFakeServer()
+	defer srv.Close()
+
+	defer setenv(map[string]string{
+		"AWS_ACCESS_KEY_ID":     "id",
+		"AWS_SECRET_ACCESS_KEY": "secret",
+		"AWS_ENDPOINT_URL":      srv.URL,
+	})()
+
+	imgCache, err := cache.New(cache.Config{ParentDir: dir})
+	if err != nil {
+		t.Fatalf("failed to create cache: %s", err)
+	}
+
+	ctx := context.Background()
+	const ref = "s3://images/busybox.sif"
+
+	pull := func(content []byte, wantGets int) {
+		t.Helper()
+
+		path, err := Pull(ctx, imgCache, ref, dir, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if imgCache.EntryType(path) != cache.BucketCacheType {
+			t.Errorf("%s is not a %s cache entry", path, cache.BucketCacheType)
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read pulled image: %v", err)
+		}
+		if !bytes.Equal(b, content) {
+			t.Errorf("cached image doesn't match the object")
+		}
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		if srv.gets != wantGets {
+			t.Errorf("object downloaded %d times, expected %d", srv.gets, wantGets)
+		}
+	}
+
+	first := []byte("first version")
+	srv.put("busybox.sif", first, map[string]string{"sha256": digest(first)})
+	pull(first, 1)
+	// the cache entry is used while the ETag doesn't change
+	pull(first, 1)
+
+	second := []byte("second version")
+	srv.put("busybox.sif", second, map[string]string{"sha256": digest(second)})
+	pull(second, 2)
+
+	// the same object version at another endpoint is another entry
+	other := newFakeServer()
+	defer other.Close()
+	other.put("busybox.sif", second, map[string]string{"sha256": digest(second)})
+
+	path, err := Pull(ctx, imgCache, ref, dir, []Config{{Scheme: S3, Endpoint: other.URL}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b, err := ioutil.ReadFile(path); err != nil || !bytes.Equal(b, second) {
+		t.Errorf("cached image doesn't match the object: %v", err)
+	}
+	other.mu.Lock()
+	defer other.mu.Unlock()
+	if other.gets != 1 {
+		t.Errorf("object downloaded %d times from the other endpoint, expected 1", other.gets)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	keys := map[string]bool{
+		cacheKey("https://s3.example.com", "images", "busybox.sif", "v1"):    true,
+		cacheKey("https://s3.example.com", "images", "busybox.sif", "v2"):    true,
+		cacheKey("https://s3.example.com", "images", "busybox.sifv1", ""):    true,
+		cacheKey("https://s3.example.com", "imagesb", "usybox.sif", "v1"):    true,
+		cacheKey("https://minio.example.com", "images", "busybox.sif", "v1"): true,
+	}
+	if len(keys) != 5 {
+		t.Errorf("got %d distinct cache keys for 5 objects", len(keys))
+	}
+}
+
+func TestPullAnonymous(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bucket-pull-anonymous-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv := newFakeServer()
+	defer srv.Close()
+	srv.anonymous = true
+
+	// no credentials are looked up for the anonymous requests
+	defer setenv(map[string]string{
+		"HOME":                        dir,
+		"AWS_ACCESS_KEY_ID":           "",
+		"AWS_SECRET_ACCESS_KEY":       "",
+		"AWS_PROFILE":                 "",
+		"AWS_SHARED_CREDENTIALS_FILE": filepath.Join(dir, "credentials"),
+		"AWS_ENDPOINT_URL":            srv.URL,
+	})()
+
+	imgCache, err := cache.New(cache.Config{ParentDir: dir})
+	if err != nil {
+		t.Fatalf("failed to create cache: %s", err)
+	}
+
+	content := []byte("public image")
+	srv.put("busybox.sif", content, map[string]string{"sha256": digest(content)})
+
+	configs := []Config{{Scheme: S3, Bucket: "images", Anonymous: true}}
+	path, err := Pull(context.Background(), imgCache, "s3://images/busybox.sif", dir, configs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b, err := ioutil.ReadFile(path); err != nil || !bytes.Equal(b, content) {
+		t.Errorf("pulled image doesn't match the object: %v", err)
+	}
+}
+
+func TestPullMissingCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bucket-pull-credentials-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer setenv(map[string]string{
+		"HOME":                        dir,
+		"AWS_ACCESS_KEY_ID":           "",
+		"AWS_SECRET_ACCESS_KEY":       "",
+		"AWS_PROFILE":                 "",
+		"AWS_SHARED_CREDENTIALS_FILE": filepath.Join(dir, "credentials"),
+		"AWS_EC2_METADATA_DISABLED":   "true",
+	})()
+
+	imgCache, err := cache.New(cache.Config{ParentDir: dir})
+	if err != nil {
+		t.Fatalf("failed to create cache: %s", err)
+	}
+
+	_, err = Pull(context.Background(), imgCache, "s3://images/busybox.sif", dir, nil)
+	want := fmt.Sprintf("no S3 credentials found, checked: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables, %s file (profile default)", filepath.Join(dir, "credentials"))
+	if err == nil || err.Error() != want {
+		t.Errorf("got error %v, expected %q", err, want)
+	}
+}
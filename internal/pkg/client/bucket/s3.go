@@ -0,0 +1,445 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package bucket
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sylabs/singularity/pkg/sylog"
+	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
+)
+
+const (
+	// s3DefaultRegion is the region of the S3 buckets when none is set.
+	s3DefaultRegion = "us-east-1"
+	// s3MetaPrefix is the prefix of the user metadata headers.
+	s3MetaPrefix = "X-Amz-Meta-"
+	// emptySHA256 is the digest of the empty payload of the requests.
+	emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	// imdsEndpoint is the instance metadata service of EC2 instances.
+	imdsEndpoint = "http://169.254.169.254"
+)
+
+// s3Credentials are the credentials signing the S3 requests.
+type s3Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// s3Store reads the objects of an S3 bucket.
+type s3Store struct {
+	client *http.Client
+	bucket string
+	region string
+	// endpoint is the service URL, the bucket is in the host name of
+	// the AWS endpoint and in the path of a custom endpoint
+	endpoint  *url.URL
+	pathStyle bool
+	// creds are nil for anonymous requests
+	creds *s3Credentials
+}
+
+func newS3Store(ctx context.Context, c Config) (store, error) {
+	s := &s3Store{
+		client: &http.Client{},
+		bucket: c.Bucket,
+		region: c.Region,
+	}
+	if s.region == "" {
+		s.region = os.Getenv("AWS_REGION")
+	}
+	if s.region == "" {
+		s.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if s.region == "" {
+		s.region = s3DefaultRegion
+	}
+
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	if endpoint != "" {
+		// S3 compatible stores don't always resolve the bucket host names
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("bad S3 endpoint %s: %v", endpoint, err)
+		}
+		s.endpoint = u
+		s.pathStyle = true
+	} else {
+		s.endpoint = &url.URL{Scheme: "https", Host: fmt.Sprintf("%s.s3.%s.amazonaws.com", c.Bucket, s.region)}
+	}
+
+	if c.Anonymous {
+		sylog.Debugf("Sending anonymous requests to S3 bucket %s", c.Bucket)
+		return s, nil
+	}
+	creds, err := loadS3Credentials(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	s.creds = creds
+	return s, nil
+}
+
+// s3Escape escapes the object key path as required by the signature, all
+// characters but the unreserved ones and the slashes are escaped.
+func s3Escape(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '.' || c == '_' || c == '~' || c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func (s *s3Store) service() string {
+	return s.endpoint.String()
+}
+
+// url returns the URL of the object key.
+func (s *s3Store) url(key string) *url.URL {
+	u := *s.endpoint
+	path := "/" + key
+	if s.pathStyle {
+		path = strings.TrimSuffix(u.Path, "/") + "/" + s.bucket + path
+	}
+	u.Path = path
+	u.RawPath = s3Escape(path)
+	return &u
+}
+
+// request returns a request of method for the object key, signed unless
+// anonymous.
+func (s *s3Store) request(ctx context.Context, method, key string, header http.Header) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.url(key).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("User-Agent", useragent.Value())
+	if s.creds != nil {
+		signS3(req, s.creds, s.region, time.Now())
+	}
+	return req, nil
+}
+
+func (s *s3Store) stat(ctx context.Context, key string) (*object, error) {
+	req, err := s.request(ctx, http.MethodHead, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(res); err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+
+	obj := &object{
+		Key:      key,
+		Size:     res.ContentLength,
+		Version:  res.Header.Get("ETag"),
+		Metadata: make(map[string]string),
+	}
+	for k := range res.Header {
+		if strings.HasPrefix(k, s3MetaPrefix) {
+			obj.Metadata[strings.ToLower(k[len(s3MetaPrefix):])] = res.Header.Get(k)
+		}
+	}
+	return obj, nil
+}
+
+func (s *s3Store) get(ctx context.Context, obj *object, offset int64) (io.ReadCloser, error) {
+	header := make(http.Header)
+	if offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	if obj.Version != "" {
+		header.Set("If-Match", obj.Version)
+	}
+	req, err := s.request(ctx, http.MethodGet, obj.Key, header)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(res); err != nil {
+		return nil, err
+	}
+	if offset > 0 && res.StatusCode != http.StatusPartialContent {
+		res.Body.Close()
+		return nil, fmt.Errorf("range requests not supported by the S3 endpoint")
+	}
+	return res.Body, nil
+}
+
+// signS3 signs the request req with the AWS signature version 4 at time t.
+func signS3(req *http.Request, creds *s3Credentials, region string, t time.Time) {
+	amzDate := t.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptySHA256)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	// the host and the x-amz-* headers are signed, and the range
+	headers := map[string]string{"host": req.URL.Host}
+	for k := range req.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-amz-") || lk == "range" {
+			headers[lk] = strings.TrimSpace(req.Header.Get(k))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", k, headers[k])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptySHA256,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, region)
+	crh := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(crh[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, v := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, v)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// loadS3Credentials returns the credentials of the first source providing
+// them: the credentials file of the settings c when set, or else the
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables, the
+// AWS shared credentials file and, when allowed by the settings c, the EC2
+// instance metadata.
+func loadS3Credentials(ctx context.Context, c Config) (*s3Credentials, error) {
+	profile := c.Profile
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+
+	if c.CredentialsFile != "" {
+		creds, err := readS3CredentialsFile(c.CredentialsFile, profile)
+		if err != nil {
+			return nil, fmt.Errorf("while reading S3 credentials file %s from the remote configuration: %v", c.CredentialsFile, err)
+		}
+		return creds, nil
+	}
+
+	var checked []string
+
+	id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if id != "" && secret != "" {
+		sylog.Debugf("Using S3 credentials from the environment")
+		return &s3Credentials{AccessKeyID: id, SecretAccessKey: secret, SessionToken: os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+	checked = append(checked, "AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables")
+
+	file := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if file == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			file = filepath.Join(home, ".aws", "credentials")
+		}
+	}
+	if file != "" {
+		creds, err := readS3CredentialsFile(file, profile)
+		if err == nil {
+			sylog.Debugf("Using S3 credentials from %s", file)
+			return creds, nil
+		} else if !os.IsNotExist(err) {
+			sylog.Debugf("Could not read S3 credentials from %s: %v", file, err)
+		}
+		checked = append(checked, fmt.Sprintf("%s file (profile %s)", file, profile))
+	}
+
+	if c.InstanceMetadata && os.Getenv("AWS_EC2_METADATA_DISABLED") != "true" {
+		endpoint := os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT")
+		if endpoint == "" {
+			endpoint = imdsEndpoint
+		}
+		creds, err := imdsCredentials(ctx, endpoint)
+		if err == nil {
+			sylog.Debugf("Using S3 credentials from the instance metadata")
+			return creds, nil
+		}
+		sylog.Debugf("Could not get S3 credentials from the instance metadata: %v", err)
+		checked = append(checked, "instance metadata at "+endpoint)
+	}
+
+	return nil, fmt.Errorf("no S3 credentials found, checked: %s", strings.Join(checked, ", "))
+}
+
+// readS3CredentialsFile reads the credentials of profile from the AWS
+// shared credentials file path.
+func readS3CredentialsFile(path, profile string) (*s3Credentials, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	creds := new(s3Credentials)
+	found := false
+	section := ""
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			found = found || section == profile
+			continue
+		}
+		if section != profile {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch strings.TrimSpace(kv[0]) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = strings.TrimSpace(kv[1])
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = strings.TrimSpace(kv[1])
+		case "aws_session_token":
+			creds.SessionToken = strings.TrimSpace(kv[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, fmt.Errorf("no profile %s", profile)
+	} else if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, fmt.Errorf("profile %s has no aws_access_key_id or aws_secret_access_key", profile)
+	}
+	return creds, nil
+}
+
+// imdsCredentials returns the credentials of the IAM role of the EC2
+// instance, from the instance metadata service at endpoint.
+func imdsCredentials(ctx context.Context, endpoint string) (*s3Credentials, error) {
+	client := &http.Client{Timeout: 2 * time.Second}
+
+	do := func(method, path, token string) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(endpoint, "/")+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			req.Header.Set("X-Aws-Ec2-Metadata-Token", token)
+		} else {
+			req.Header.Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", strconv.Itoa(21600))
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkResponse(res); err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+		return ioutil.ReadAll(io.LimitReader(res.Body, 64*1024))
+	}
+
+	token, err := do(http.MethodPut, "/latest/api/token", "")
+	if err != nil {
+		return nil, err
+	}
+	roles, err := do(http.MethodGet, "/latest/meta-data/iam/security-credentials/", string(token))
+	if err != nil {
+		return nil, err
+	}
+	role := strings.TrimSpace(strings.SplitN(string(roles), "\n", 2)[0])
+	if role == "" {
+		return nil, fmt.Errorf("no IAM role attached to the instance")
+	}
+	b, err := do(http.MethodGet, "/latest/meta-data/iam/security-credentials/"+role, string(token))
+	if err != nil {
+		return nil, err
+	}
+
+	var res struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string `json:"SecretAccessKey"`
+		Token           string `json:"Token"`
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, fmt.Errorf("bad instance credentials: %v", err)
+	}
+	return &s3Credentials{AccessKeyID: res.AccessKeyID, SecretAccessKey: res.SecretAccessKey, SessionToken: res.Token}, nil
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package chunk splits image files in content-defined chunks and transfers
+// them to and from a library supporting chunked transfers, so only the
+// chunks changed between two versions of an image are transferred.
+package chunk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// Chunk describes a chunk of an image file.
+type Chunk struct {
+	// Digest is the digest of the chunk content, like sha256.<hex>
+	Digest string `json:"digest"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+}
+
+// Params holds the minimum, average and maximum chunk sizes, the average
+// size must be a power of two.
+type Params struct {
+	Min int
+	Avg int
+	Max int
+}
+
+// DefaultParams are the chunk sizes used for image transfers.
+var DefaultParams = Params{
+	Min: 512 * 1024,
+	Avg: 2 * 1024 * 1024,
+	Max: 8 * 1024 * 1024,
+}
+
+// gear is the table of random values of the rolling gear hash, the values
+// must never change as they determine the chunk boundaries.
+var gear [256]uint64
+
+func init() {
+	// splitmix64 with a fixed seed
+	x := uint64(0x5ab1e5c0ffee)
+	for i := range gear {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+// Digest returns the digest of the chunk content b.
+func Digest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256." + hex.EncodeToString(sum[:])
+}
+
+func (p Params) validate() error {
+	if p.Min <= 0 || p.Avg < p.Min || p.Max < p.Avg {
+		return fmt.Errorf("invalid chunk sizes %d/%d/%d", p.Min, p.Avg, p.Max)
+	} else if bits.OnesCount(uint(p.Avg)) != 1 {
+		return fmt.Errorf("average chunk size %d is not a power of two", p.Avg)
+	}
+	return nil
+}
+
+// cut returns the size of the chunk starting at the beginning of data. It
+// uses normalized chunking: a boundary is less likely before the average
+// size and more likely after it.
+func (p Params) cut(data []byte) int {
+	n := len(data)
+	if n <= p.Min {
+		return n
+	} else if n > p.Max {
+		n = p.Max
+	}
+	normal := p.Avg
+	if normal > n {
+		normal = n
+	}
+
+	b := uint(bits.Len(uint(p.Avg)) - 1)
+	maskS := ^uint64(0) << (64 - (b + 1))
+	maskL := ^uint64(0) << (64 - (b - 1))
+
+	var h uint64
+
+	i := p.Min
+	for ; i < normal; i++ {
+		h = h<<1 + gear[data[i]]
+		if h&maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		h = h<<1 + gear[data[i]]
+		if h&maskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// Split reads r until EOF and returns its content-defined chunks.
+func (p Params) Split(r io.Reader) ([]Chunk, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+
+	var (
+		chunks []Chunk
+		offset int64
+		eof    bool
+	)
+
+	buf := make([]byte, 0, 2*p.Max)
+	for {
+		if !eof && len(buf) < p.Max {
+			n, err := io.ReadFull(r, buf[len(buf):cap(buf)])
+			buf = buf[:len(buf)+n]
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				eof = true
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		if len(buf) == 0 {
+			return chunks, nil
+		}
+
+		size := p.cut(buf)
+		chunks = append(chunks, Chunk{
+			Digest: Digest(buf[:size]),
+			Offset: offset,
+			Size:   int64(size),
+		})
+		offset += int64(size)
+		buf = buf[:copy(buf, buf[size:])]
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package chunk
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+var testParams = Params{Min: 2048, Avg: 8192, Max: 32768}
+
+func randomData(seed int64, size int) []byte {
+	b := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(b)
+	return b
+}
+
+func TestSplit(t *testing.T) {
+	data := randomData(1, 1024*1024)
+
+	chunks, err := testParams.Split(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var offset int64
+	for i, ch := range chunks {
+		if ch.Offset != offset {
+			t.Fatalf("chunk %d at offset %d, want %d", i, ch.Offset, offset)
+		}
+		if ch.Size > int64(testParams.Max) || (ch.Size < int64(testParams.Min) && i != len(chunks)-1) {
+			t.Errorf("chunk %d has a size of %d bytes out of bounds", i, ch.Size)
+		}
+		if d := Digest(data[ch.Offset : ch.Offset+ch.Size]); d != ch.Digest {
+			t.Errorf("chunk %d has digest %s, want %s", i, ch.Digest, d)
+		}
+		offset += ch.Size
+	}
+	if offset != int64(len(data)) {
+		t.Errorf("chunks cover %d bytes, want %d", offset, len(data))
+	}
+	if avg := len(data) / len(chunks); avg < testParams.Min || avg > testParams.Max {
+		t.Errorf("average chunk size %d out of bounds", avg)
+	}
+
+	again, err := testParams.Split(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(again) != len(chunks) || again[len(again)-1] != chunks[len(chunks)-1] {
+		t.Errorf("chunking is not deterministic")
+	}
+
+	if chunks, err := testParams.Split(bytes.NewReader(nil)); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if len(chunks) != 0 {
+		t.Errorf("got %d chunks for empty data", len(chunks))
+	}
+
+	if _, err := (Params{Min: 1024, Avg: 3000, Max: 8192}).Split(bytes.NewReader(data)); err == nil {
+		t.Errorf("unexpected success with an average size not a power of two")
+	}
+}
+
+func TestSplitModified(t *testing.T) {
+	v1 := randomData(2, 1024*1024)
+
+	// v2 inserts a few bytes in the middle of v1, shifting the content
+	// following the insertion
+	v2 := append(append(append([]byte{}, v1[:500000]...), []byte("inserted")...), v1[500000:]...)
+
+	c1, err := testParams.Split(bytes.NewReader(v1))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	c2, err := testParams.Split(bytes.NewReader(v2))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	known := make(map[string]bool)
+	for _, ch := range c1 {
+		known[ch.Digest] = true
+	}
+	changed := 0
+	for _, ch := range c2 {
+		if !known[ch.Digest] {
+			changed++
+		}
+	}
+	if changed == 0 || changed > 2 {
+		t.Errorf("%d chunks changed out of %d, want 1 or 2", changed, len(c2))
+	}
+}
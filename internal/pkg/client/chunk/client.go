@@ -0,0 +1,181 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package chunk
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	jsonresp "github.com/sylabs/json-resp"
+	libclient "github.com/sylabs/scs-library-client/client"
+)
+
+// ErrUnsupported is returned when the library doesn't support chunked
+// transfers, the image file is then transferred as a whole.
+var ErrUnsupported = errors.New("chunked transfer not supported by library")
+
+// Manifest lists the chunks of an image file, the library reassembles the
+// image file from its manifest.
+type Manifest struct {
+	Size   int64   `json:"size"`
+	Hash   string  `json:"hash"`
+	Chunks []Chunk `json:"chunks"`
+}
+
+// MissingResponse is the response of the library to a manifest, listing
+// the digests of the chunks it doesn't store yet.
+type MissingResponse struct {
+	Missing []string `json:"missing"`
+}
+
+// Client transfers image chunks with a library.
+type Client struct {
+	c *libclient.Client
+}
+
+// NewClient returns a chunk client using the library client c.
+func NewClient(c *libclient.Client) *Client {
+	return &Client{c: c}
+}
+
+// request sends a request to the library API with the body in and returns
+// the response, a 404 response is reported as ErrUnsupported.
+func (c *Client) request(ctx context.Context, method, path string, in io.Reader, size int64, contentType string) (*http.Response, error) {
+	ref, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(method, c.c.BaseURL.ResolveReference(ref).String(), in)
+	if err != nil {
+		return nil, err
+	}
+	if in != nil {
+		req.ContentLength = size
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.c.AuthToken != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("BEARER %s", c.c.AuthToken))
+	}
+	if c.c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.c.UserAgent)
+	}
+
+	res, err := c.c.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("error making request to server: %v", err)
+	}
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		res.Body.Close()
+		return nil, ErrUnsupported
+	case res.StatusCode < 200 || res.StatusCode > 299:
+		defer res.Body.Close()
+		if err := jsonresp.ReadError(res.Body); err != nil {
+			return nil, fmt.Errorf("request did not succeed: %v", err)
+		}
+		return nil, fmt.Errorf("request did not succeed: http status code: %d", res.StatusCode)
+	}
+	return res, nil
+}
+
+// jsonRequest sends the JSON encoded in to the library API and decodes
+// the response data in out.
+func (c *Client) jsonRequest(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	var size int64
+
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+		size = int64(len(b))
+	}
+
+	res, err := c.request(ctx, method, path, body, size, "application/json")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	return jsonresp.ReadResponse(res.Body, out)
+}
+
+// Missing sends the manifest m of the image imageID and returns the
+// digests of the chunks the library doesn't store yet.
+func (c *Client) Missing(ctx context.Context, imageID string, m *Manifest) ([]string, error) {
+	var res MissingResponse
+
+	path := fmt.Sprintf("v2/imagefile/%s/_chunks", imageID)
+	if err := c.jsonRequest(ctx, http.MethodPost, path, m, &res); err != nil {
+		return nil, err
+	}
+	return res.Missing, nil
+}
+
+// Upload uploads the content of the chunk ch read from r.
+func (c *Client) Upload(ctx context.Context, ch Chunk, r io.Reader) error {
+	res, err := c.request(ctx, http.MethodPut, "v2/chunks/"+ch.Digest, r, ch.Size, "application/octet-stream")
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// Complete asks the library to reassemble the image imageID from the
+// chunks listed in its manifest m.
+func (c *Client) Complete(ctx context.Context, imageID string, m *Manifest) error {
+	path := fmt.Sprintf("v2/imagefile/%s/_chunks_complete", imageID)
+	return c.jsonRequest(ctx, http.MethodPut, path, m, nil)
+}
+
+// Manifest returns the manifest of the image imageID.
+func (c *Client) Manifest(ctx context.Context, imageID string) (*Manifest, error) {
+	m := new(Manifest)
+
+	path := fmt.Sprintf("v2/imagefile/%s/_chunks", imageID)
+	if err := c.jsonRequest(ctx, http.MethodGet, path, nil, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Download downloads the content of the chunk ch to w and checks its
+// digest.
+func (c *Client) Download(ctx context.Context, ch Chunk, w io.Writer) error {
+	res, err := c.request(ctx, http.MethodGet, "v2/chunks/"+ch.Digest, nil, 0, "")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, h), io.LimitReader(res.Body, ch.Size+1))
+	if err != nil {
+		return fmt.Errorf("while downloading chunk %s: %v", ch.Digest, err)
+	} else if n != ch.Size {
+		return fmt.Errorf("chunk %s has a size of %d bytes, expected %d", ch.Digest, n, ch.Size)
+	}
+	if digest := "sha256." + hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(digest, ch.Digest) {
+		return fmt.Errorf("chunk %s has a digest of %s", ch.Digest, digest)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package file pulls local SIF images referenced by file:// URIs, through
+// the cache like images pulled from a remote source.
+package file
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// digestPrefix is the prefix of the sha256 digest of an image in a file
+// reference and in the cache manifests.
+const digestPrefix = "sha256:"
+
+// ParseRef returns the absolute path of the image referenced by the file
+// URI ref, in the file:///path/to/image.sif or file:/path/to/image.sif
+// format, and the hex encoded sha256 digest the image must have when the
+// ref has a @sha256:<hex> suffix.
+func ParseRef(ref string) (path string, digest string, err error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(ref, "file:"), "//")
+	if i := strings.LastIndex(path, "@"+digestPrefix); i >= 0 {
+		digest = path[i+len(digestPrefix)+1:]
+		path = path[:i]
+		if b, err := hex.DecodeString(digest); err != nil || len(b) != sha256.Size {
+			return "", "", fmt.Errorf("bad sha256 digest %q in %s", digest, ref)
+		}
+		digest = strings.ToLower(digest)
+	}
+	if path == "" {
+		return "", "", fmt.Errorf("no image path in %s", ref)
+	}
+	if !filepath.IsAbs(path) {
+		return "", "", fmt.Errorf("image path %s in %s is not absolute, the format is file:///path/to/image.sif", path, ref)
+	}
+	return filepath.Clean(path), digest, nil
+}
+
+// fileDigest returns the hex encoded sha256 digest of the file path.
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("while computing digest of %s: %v", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sameFile returns whether the paths a and b refer to the same file.
+func sameFile(a, b string) bool {
+	fa, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	fb, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(fa, fb)
+}
+
+// copyImage copies the image src to dst and checks that the copy has the
+// expected digest, as src may have been modified since it was hashed.
+func copyImage(src, dst, digest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// mode is before umask if dst doesn't exist
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0777)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(out, h), in); err != nil {
+		return fmt.Errorf("could not copy image: %v", err)
+	}
+	if d := hex.EncodeToString(h.Sum(nil)); d != digest {
+		return fmt.Errorf("%s was modified while being copied: digest %s%s doesn't match %s%s", src, digestPrefix, d, digestPrefix, digest)
+	}
+	return out.Close()
+}
+
+// verifyEntry checks that the cached image with the entry digest matches
+// the digest recorded in its manifest, which must be the entry digest.
+func verifyEntry(imgCache *cache.Handle, digest string) error {
+	m, err := imgCache.VerifyEntry(cache.FileCacheType, digest)
+	if err != nil {
+		return err
+	}
+	if m.Digest != digestPrefix+digest {
+		return fmt.Errorf("%w: digest %s doesn't match %s%s", cache.ErrBadChecksum, m.Digest, digestPrefix, digest)
+	}
+	return nil
+}
+
+// pull copies the image referenced by pullFrom into the cache if directTo
+// is empty, or to the directTo file.
+func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string) (imagePath string, err error) {
+	path, expected, err := ParseRef(pullFrom)
+	if err != nil {
+		return "", err
+	}
+
+	fimg, err := sif.LoadContainer(path, true)
+	if err != nil {
+		return "", fmt.Errorf("%s is not a SIF image: %v", path, err)
+	}
+	fimg.UnloadContainer()
+
+	digest, err := fileDigest(path)
+	if err != nil {
+		return "", err
+	}
+	sylog.Debugf("Image digest is: %s%s", digestPrefix, digest)
+	if expected != "" && expected != digest {
+		return "", fmt.Errorf("%s digest %s%s doesn't match the expected digest %s%s", path, digestPrefix, digest, digestPrefix, expected)
+	}
+
+	if directTo != "" {
+		if sameFile(path, directTo) {
+			return "", fmt.Errorf("%s is the image being pulled", directTo)
+		}
+		sylog.Infof("Copying local image")
+		if err := copyImage(path, directTo, digest); err != nil {
+			os.Remove(directTo)
+			return "", err
+		}
+		return directTo, nil
+	}
+
+	cacheEntry, err := imgCache.GetEntry(cache.FileCacheType, digest)
+	if err != nil {
+		return "", fmt.Errorf("unable to check if %v exists in cache: %v", digest, err)
+	}
+	defer cacheEntry.CleanTmp()
+
+	if cacheEntry.Exists {
+		// an entry which doesn't match its digest is replaced
+		err := verifyEntry(imgCache, digest)
+		if err == nil {
+			sylog.Verbosef("Using image from cache")
+			return cacheEntry.Path, nil
+		} else if !errors.Is(err, cache.ErrBadChecksum) {
+			return "", err
+		}
+		sylog.Warningf("Replacing corrupted cache entry %s: %v", digest, err)
+		if err := imgCache.RemoveEntry(cache.FileCacheType, digest); err != nil {
+			return "", err
+		}
+		return pull(ctx, imgCache, directTo, pullFrom)
+	}
+
+	sylog.Infof("Copying local image to cache")
+	cacheEntry.Source = pullFrom
+	if err := copyImage(path, cacheEntry.TmpPath, digest); err != nil {
+		return "", err
+	}
+	if err := cacheEntry.Finalize(); err != nil {
+		return "", err
+	}
+	return cacheEntry.Path, nil
+}
+
+// Pull will copy a local image referenced by a file:// URI to the cache, or
+// to a temporary file if cache is disabled.
+func Pull(ctx context.Context, imgCache *cache.Handle, pullFrom string, tmpDir string) (imagePath string, err error) {
+	directTo := ""
+
+	if imgCache.IsDisabled() {
+		file, err := fs.MakeTmpFile(tmpDir, "sbuild-tmp-cache-", 0700)
+		if err != nil {
+			return "", fmt.Errorf("unable to create tmp file: %v", err)
+		}
+		file.Close()
+		directTo = file.Name()
+		sylog.Infof("Copying local image to tmp cache: %s", directTo)
+	}
+
+	return pull(ctx, imgCache, directTo, pullFrom)
+}
+
+// PullToFile will copy a local image referenced by a file:// URI to the
+// specified location, through the cache, or directly if cache is disabled.
+func PullToFile(ctx context.Context, imgCache *cache.Handle, pullTo, pullFrom, tmpDir string) (imagePath string, err error) {
+	directTo := ""
+	if imgCache.IsDisabled() {
+		directTo = pullTo
+		sylog.Debugf("Cache disabled, pulling directly to: %s", directTo)
+	}
+
+	src, err := pull(ctx, imgCache, directTo, pullFrom)
+	if err != nil {
+		return "", fmt.Errorf("error fetching image to cache: %v", err)
+	}
+
+	if directTo == "" {
+		// mode is before umask if pullTo doesn't exist
+		err = fs.CopyFileAtomic(src, pullTo, 0777)
+		if err != nil {
+			return "", fmt.Errorf("error copying image out of cache: %v", err)
+		}
+	}
+
+	return pullTo, nil
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/cache"
+)
+
+// testImage is a SIF image of the signature tests.
+const testImage = "../../../app/singularity/testdata/images/one-group.sif"
+
+func TestParseRef(t *testing.T) {
+	const digest = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	tests := []struct {
+		name       string
+		ref        string
+		wantPath   string
+		wantDigest string
+		wantErr    bool
+	}{
+		{name: "Path", ref: "file:///tmp/busybox.sif", wantPath: "/tmp/busybox.sif"},
+		{name: "PathWithoutAuthority", ref: "file:/tmp/busybox.sif", wantPath: "/tmp/busybox.sif"},
+		{name: "Digest", ref: "file:///tmp/busybox.sif@sha256:" + digest, wantPath: "/tmp/busybox.sif", wantDigest: digest},
+		{name: "RelativePath", ref: "file://busybox.sif", wantErr: true},
+		{name: "NoPath", ref: "file://", wantErr: true},
+		{name: "BadDigest", ref: "file:///tmp/busybox.sif@sha256:0123", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, digest, err := ParseRef(tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if path != tt.wantPath || digest != tt.wantDigest {
+				t.Errorf("got %q and %q, expected %q and %q", path, digest, tt.wantPath, tt.wantDigest)
+			}
+		})
+	}
+}
+
+func TestPullToFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "file-pull-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	imgCache, err := cache.New(cache.Config{ParentDir: dir})
+	if err != nil {
+		t.Fatalf("failed to create cache: %s", err)
+	}
+
+	image, err := filepath.Abs(testImage)
+	if err != nil {
+		t.Fatalf("failed to get image path: %s", err)
+	}
+	content, err := ioutil.ReadFile(image)
+	if err != nil {
+		t.Fatalf("failed to read image: %s", err)
+	}
+	digest, err := fileDigest(image)
+	if err != nil {
+		t.Fatalf("failed to compute digest: %s", err)
+	}
+
+	ctx := context.Background()
+	pullTo := filepath.Join(dir, "image.sif")
+
+	if _, err := PullToFile(ctx, imgCache, pullTo, "file://"+image+"@sha256:"+digest, dir); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if b, err := ioutil.ReadFile(pullTo); err != nil || !bytes.Equal(b, content) {
+		t.Errorf("pulled image doesn't match %s: %v", image, err)
+	}
+
+	entry, err := imgCache.GetEntry(cache.FileCacheType, digest)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !entry.Exists {
+		t.Fatalf("image not found in cache with digest %s", digest)
+	}
+	m, err := imgCache.VerifyEntry(cache.FileCacheType, digest)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if m.Digest != "sha256:"+digest || m.Source != "file://"+image+"@sha256:"+digest {
+		t.Errorf("unexpected cache entry manifest %+v", m)
+	}
+
+	// a cached image modified since it was pulled is replaced
+	if err := ioutil.WriteFile(entry.Path, []byte("corrupted"), 0644); err != nil {
+		t.Fatalf("failed to modify cache entry: %s", err)
+	}
+	if _, err := PullToFile(ctx, imgCache, pullTo, "file://"+image, dir); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if b, err := ioutil.ReadFile(pullTo); err != nil || !bytes.Equal(b, content) {
+		t.Errorf("pulled image doesn't match %s: %v", image, err)
+	}
+
+	bad := "file://" + image + "@sha256:" + digest[1:] + "0"
+	if _, err := PullToFile(ctx, imgCache, pullTo, bad, dir); err == nil {
+		t.Errorf("unexpected success pulling %s", bad)
+	}
+
+	notSIF := filepath.Join(dir, "image.txt")
+	if err := ioutil.WriteFile(notSIF, []byte("not a SIF"), 0644); err != nil {
+		t.Fatalf("failed to create file: %s", err)
+	}
+	if _, err := PullToFile(ctx, imgCache, pullTo, "file://"+notSIF, dir); err == nil {
+		t.Errorf("unexpected success pulling %s", notSIF)
+	}
+}
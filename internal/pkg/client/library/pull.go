@@ -17,6 +17,7 @@ import (
 	"github.com/sylabs/singularity/internal/app/singularity"
 	"github.com/sylabs/singularity/internal/pkg/cache"
 	"github.com/sylabs/singularity/internal/pkg/client"
+	"github.com/sylabs/singularity/internal/pkg/client/chunk"
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
 	"github.com/sylabs/singularity/pkg/sylog"
 )
@@ -26,6 +27,27 @@ var (
 	ErrLibraryPullUnsigned = errors.New("failed to verify container")
 )
 
+// ImageDigest returns the hash of the library image pullFrom for the
+// architecture arch, as returned by ImageHash for the image file (e.g.
+// sha256.<digest>).
+func ImageDigest(ctx context.Context, pullFrom, arch string, libraryConfig *libclient.Config) (string, error) {
+	imageRef := NormalizeLibraryRef(pullFrom)
+
+	c, err := libclient.NewClient(libraryConfig)
+	if err != nil {
+		return "", fmt.Errorf("unable to initialize client library: %v", err)
+	}
+
+	libraryImage, err := c.GetImage(ctx, arch, imageRef)
+	if err == libclient.ErrNotFound {
+		return "", fmt.Errorf("image does not exist in the library: %s (%s)", imageRef, arch)
+	}
+	if err != nil {
+		return "", err
+	}
+	return libraryImage.Hash, nil
+}
+
 // pull will pull a library image into the cache if directTo="", or a specific file if directTo is set.
 func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string, arch string, libraryConfig *libclient.Config) (imagePath string, err error) {
 	imageRef := NormalizeLibraryRef(pullFrom)
@@ -60,8 +82,14 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 		defer cacheEntry.CleanTmp()
 		if !cacheEntry.Exists {
 			sylog.Infof("Downloading library image")
+			cacheEntry.Source = imageRef
 
-			if err := DownloadImage(ctx, c, cacheEntry.TmpPath, arch, imageRef, client.ProgressBarCallback(ctx)); err != nil {
+			err := downloadChunked(ctx, c, imgCache, libraryImage.ID, cacheEntry.TmpPath)
+			if err == chunk.ErrUnsupported {
+				sylog.Debugf("Library doesn't support chunked downloads, downloading image file")
+				err = DownloadImage(ctx, c, cacheEntry.TmpPath, arch, imageRef, client.ProgressBarCallback(ctx))
+			}
+			if err != nil {
 				return "", fmt.Errorf("unable to download image: %v", err)
 			}
 
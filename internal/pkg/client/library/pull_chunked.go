@@ -0,0 +1,99 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package library
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	libclient "github.com/sylabs/scs-library-client/client"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/client/chunk"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// downloadChunked downloads the library image imageID to imagePath chunk by
+// chunk. The chunks are stored in the cache, so only the chunks changed
+// since a previously pulled version of the image are downloaded. It returns
+// chunk.ErrUnsupported when the library doesn't support chunked downloads.
+func downloadChunked(ctx context.Context, c *libclient.Client, imgCache *cache.Handle, imageID, imagePath string) error {
+	cc := chunk.NewClient(c)
+
+	m, err := cc.Manifest(ctx, imageID)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(imagePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0777)
+	if err != nil {
+		return fmt.Errorf("error opening file %s for writing: %v", imagePath, err)
+	}
+	defer f.Close()
+
+	var downloaded int
+	var downloadedSize int64
+
+	for _, ch := range m.Chunks {
+		path, cached, err := cachedChunk(ctx, cc, imgCache, ch)
+		if err != nil {
+			return err
+		} else if !cached {
+			downloaded++
+			downloadedSize += ch.Size
+		}
+		if err := copyChunk(f, path, ch); err != nil {
+			return err
+		}
+	}
+	sylog.Infof("Downloaded %d of %d chunks (%d of %d bytes), the others were found in cache", downloaded, len(m.Chunks), downloadedSize, m.Size)
+
+	return f.Close()
+}
+
+// cachedChunk downloads the chunk ch to the cache if it's not already
+// there, it returns the path of the cached chunk and if the chunk was
+// already cached.
+func cachedChunk(ctx context.Context, cc *chunk.Client, imgCache *cache.Handle, ch chunk.Chunk) (string, bool, error) {
+	entry, err := imgCache.GetEntry(cache.ChunkCacheType, ch.Digest)
+	if err != nil {
+		return "", false, fmt.Errorf("unable to check if chunk %s exists in cache: %v", ch.Digest, err)
+	}
+	defer entry.CleanTmp()
+	if entry.Exists {
+		return entry.Path, true, nil
+	}
+
+	tmp, err := os.OpenFile(entry.TmpPath, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return "", false, err
+	}
+	if err := cc.Download(ctx, ch, tmp); err != nil {
+		tmp.Close()
+		return "", false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", false, err
+	}
+	return entry.Path, false, entry.Finalize()
+}
+
+// copyChunk appends the chunk ch stored at path to f.
+func copyChunk(f *os.File, path string, ch chunk.Chunk) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if n, err := io.Copy(f, in); err != nil {
+		return fmt.Errorf("while copying chunk %s: %v", ch.Digest, err)
+	} else if n != ch.Size {
+		return fmt.Errorf("cached chunk %s has a size of %d bytes, expected %d", ch.Digest, n, ch.Size)
+	}
+	return nil
+}
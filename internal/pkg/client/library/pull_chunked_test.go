@@ -0,0 +1,148 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package library
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	libclient "github.com/sylabs/scs-library-client/client"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/client/chunk"
+)
+
+// mockChunkLibrary serves a single image chunk by chunk, or as a whole
+// image file when chunked downloads are disabled.
+type mockChunkLibrary struct {
+	t         *testing.T
+	noChunks  bool
+	id        string
+	data      []byte
+	chunks    []chunk.Chunk
+	store     map[string][]byte
+	requested []string
+	downloads int
+}
+
+func (m *mockChunkLibrary) setImage(id string, data []byte) {
+	chunks, err := chunk.DefaultParams.Split(bytes.NewReader(data))
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	for _, ch := range chunks {
+		m.store[ch.Digest] = data[ch.Offset : ch.Offset+ch.Size]
+	}
+	m.id = id
+	m.data = data
+	m.chunks = chunks
+	m.requested = nil
+	m.downloads = 0
+}
+
+func (m *mockChunkLibrary) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reply := func(data interface{}) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/v1/images/"):
+		reply(libclient.Image{ID: m.id, Hash: chunk.Digest(m.data), Size: int64(len(m.data))})
+	case r.URL.Path == "/v2/imagefile/"+m.id+"/_chunks" && !m.noChunks:
+		reply(chunk.Manifest{Size: int64(len(m.data)), Hash: chunk.Digest(m.data), Chunks: m.chunks})
+	case strings.HasPrefix(r.URL.Path, "/v2/chunks/") && !m.noChunks:
+		digest := strings.TrimPrefix(r.URL.Path, "/v2/chunks/")
+		m.requested = append(m.requested, digest)
+		w.Write(m.store[digest])
+	case strings.HasPrefix(r.URL.Path, "/v1/imagefile/"):
+		m.downloads++
+		w.Write(m.data)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestPullChunked(t *testing.T) {
+	defer func(p chunk.Params) {
+		chunk.DefaultParams = p
+	}(chunk.DefaultParams)
+	chunk.DefaultParams = chunk.Params{Min: 2048, Avg: 8192, Max: 32768}
+
+	dir, err := ioutil.TempDir("", "library-pull-chunked-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	imgCache, err := cache.New(cache.Config{ParentDir: dir})
+	if err != nil {
+		t.Fatalf("while creating image cache: %s", err)
+	}
+
+	v1 := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(1)).Read(v1)
+	// v2 modifies a few bytes in the middle of v1
+	v2 := append([]byte{}, v1...)
+	copy(v2[300000:], "modified")
+
+	m := &mockChunkLibrary{t: t, store: make(map[string][]byte)}
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	config := &libclient.Config{BaseURL: srv.URL}
+
+	pull := func(data []byte) {
+		imagePath, err := Pull(context.Background(), imgCache, "library://test/default/image:latest", "amd64", dir, config)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		b, err := ioutil.ReadFile(imagePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, data) {
+			t.Errorf("pulled image doesn't match library image")
+		}
+	}
+
+	m.setImage("v1", v1)
+	pull(v1)
+	if len(m.requested) != len(m.chunks) {
+		t.Errorf("%d chunks downloaded for v1, want all %d chunks", len(m.requested), len(m.chunks))
+	}
+
+	m.setImage("v2", v2)
+	pull(v2)
+	if len(m.requested) != 1 {
+		t.Errorf("%d chunks downloaded for v2, want only the modified chunk", len(m.requested))
+	}
+	for _, d := range m.requested {
+		if !bytes.Contains(m.store[d], []byte("modified")) {
+			t.Errorf("unmodified chunk %s downloaded again", d)
+		}
+	}
+	if m.downloads != 0 {
+		t.Errorf("image file downloaded %d times with chunked downloads", m.downloads)
+	}
+
+	// a library without chunked downloads falls back to the image file download
+	v3 := append([]byte{}, v2...)
+	copy(v3[700000:], "modified again")
+
+	m.noChunks = true
+	m.setImage("v3", v3)
+	pull(v3)
+	if m.downloads != 1 || len(m.requested) != 0 {
+		t.Errorf("got %d image file downloads and %d chunk downloads, want 1 image file download", m.downloads, len(m.requested))
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package library
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	libclient "github.com/sylabs/scs-library-client/client"
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+)
+
+// mockLibrary serves the metadata of a single image, and counts image
+// downloads.
+type mockLibrary struct {
+	hash      string
+	downloads int
+}
+
+func (m *mockLibrary) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/v1/images/"):
+		json.NewEncoder(w).Encode(libclient.ImageResponse{Data: libclient.Image{Hash: m.hash}})
+	case strings.HasPrefix(r.URL.Path, "/v1/imagefile/"):
+		m.downloads++
+		w.WriteHeader(http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestPullCacheAdd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "library-pull-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	imgCache, err := cache.New(cache.Config{ParentDir: dir})
+	if err != nil {
+		t.Fatalf("while creating image cache: %s", err)
+	}
+
+	notSIF := filepath.Join(dir, "image.img")
+	if err := ioutil.WriteFile(notSIF, []byte("not a SIF"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := singularity.AddSingularityCache(imgCache, notSIF); err == nil {
+		t.Errorf("unexpected success adding a non SIF image")
+	}
+
+	path := filepath.Join(dir, "image.sif")
+	in := sif.DescriptorInput{
+		Datatype: sif.DataDeffile,
+		Groupid:  sif.DescrDefaultGroup,
+		Link:     sif.DescrUnusedLink,
+		Data:     []byte("Bootstrap: scratch\n"),
+	}
+	in.Size = int64(binary.Size(in.Data))
+	cinfo := sif.CreateInfo{
+		Pathname:   path,
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []sif.DescriptorInput{in},
+	}
+	if _, err := sif.CreateContainer(cinfo); err != nil {
+		t.Fatalf("while creating SIF: %s", err)
+	}
+
+	// adding the same image twice must be harmless
+	for i := 0; i < 2; i++ {
+		if err := singularity.AddSingularityCache(imgCache, path); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	hash, err := libclient.ImageHash(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms := &mockLibrary{hash: hash}
+	srv := httptest.NewServer(ms)
+	defer srv.Close()
+
+	config := &libclient.Config{BaseURL: srv.URL}
+	imagePath, err := Pull(context.Background(), imgCache, "library://test/default/image:latest", "amd64", dir, config)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ms.downloads != 0 {
+		t.Errorf("image downloaded %d times despite being cached", ms.downloads)
+	}
+
+	entry, err := imgCache.GetEntry(cache.LibraryCacheType, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !entry.Exists || imagePath != entry.Path {
+		t.Errorf("got image %s, want cached image %s", imagePath, entry.Path)
+	}
+}
@@ -154,6 +154,7 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 
 		if !cacheEntry.Exists {
 			sylog.Infof("Downloading network image")
+			cacheEntry.Source = pullFrom
 			err := DownloadImage(ctx, cacheEntry.TmpPath, pullFrom)
 			if err != nil {
 				sylog.Fatalf("%v\n", err)
@@ -21,8 +21,8 @@ import (
 	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
 )
 
-// pull will build a SIF image into the cache if directTo="", or a specific file if directTo is set.
-func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom, tmpDir string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS, noCleanUp bool) (imagePath string, err error) {
+// sysContext returns the system context used to fetch the OCI image.
+func sysContext(tmpDir string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS bool) *ocitypes.SystemContext {
 	// DockerInsecureSkipTLSVerify is set only if --nohttps is specified to honor
 	// configuration from /etc/containers/registries.conf because DockerInsecureSkipTLSVerify
 	// can have three possible values true/false and undefined, so we left it as undefined instead
@@ -38,11 +38,26 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom, tmpDi
 	if noHTTPS {
 		sysCtx.DockerInsecureSkipTLSVerify = ocitypes.NewOptionalBool(true)
 	}
+	return sysCtx
+}
 
-	hash, err := oci.ImageSHA(ctx, pullFrom, sysCtx)
+// ImageDigest returns the sha256 digest, hex encoded, of the manifest of the
+// OCI image pullFrom, which identifies the SIF image built from it in the
+// cache.
+func ImageDigest(ctx context.Context, pullFrom, tmpDir string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS bool) (string, error) {
+	hash, err := oci.ImageSHA(ctx, pullFrom, sysContext(tmpDir, ociAuth, noHTTPS))
 	if err != nil {
 		return "", fmt.Errorf("failed to get checksum for %s: %s", pullFrom, err)
 	}
+	return hash, nil
+}
+
+// pull will build a SIF image into the cache if directTo="", or a specific file if directTo is set.
+func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom, tmpDir string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS, noCleanUp bool) (imagePath string, err error) {
+	hash, err := ImageDigest(ctx, pullFrom, tmpDir, ociAuth, noHTTPS)
+	if err != nil {
+		return "", err
+	}
 
 	if directTo != "" {
 		sylog.Infof("Converting OCI blobs to SIF format")
@@ -59,6 +74,7 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom, tmpDi
 		defer cacheEntry.CleanTmp()
 		if !cacheEntry.Exists {
 			sylog.Infof("Converting OCI blobs to SIF format")
+			cacheEntry.Source = pullFrom
 
 			if err := build.ConvertOciToSIF(ctx, imgCache, pullFrom, cacheEntry.TmpPath, tmpDir, noHTTPS, noCleanUp, ociAuth); err != nil {
 				return "", fmt.Errorf("while building SIF from layers: %v", err)
@@ -206,6 +206,32 @@ func ensureSIF(filepath string) error {
 	return nil
 }
 
+// PinReference resolves the reference uri to the digest of its current
+// manifest, and returns the reference of the image by this digest, without
+// the oras:// prefix.
+func PinReference(ctx context.Context, uri string, ociAuth *ocitypes.DockerAuthConfig) (string, error) {
+	ref := strings.TrimPrefix(uri, "oras://")
+	ref = strings.TrimPrefix(ref, "//")
+
+	spec, err := reference.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse oci reference: %s", err)
+	}
+	if spec.Object == "" {
+		spec.Object = SifDefaultTag
+	}
+
+	resolver, err := getResolver(ociAuth)
+	if err != nil {
+		return "", fmt.Errorf("while getting resolver: %s", err)
+	}
+	_, desc, err := resolver.Resolve(ctx, spec.String())
+	if err != nil {
+		return "", fmt.Errorf("while resolving reference: %v", err)
+	}
+	return spec.Locator + "@" + desc.Digest.String(), nil
+}
+
 // ImageSHA returns the sha256 digest of the SIF layer of the OCI manifest
 // oci spec dictates only sha256 and sha512 are supported at time creation for this function
 // sha512 is currently optional for implementations, this function will return an error when
@@ -38,6 +38,7 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 		defer cacheEntry.CleanTmp()
 		if !cacheEntry.Exists {
 			sylog.Infof("Downloading oras image")
+			cacheEntry.Source = pullFrom
 
 			if err := DownloadImage(cacheEntry.TmpPath, pullFrom, ociAuth); err != nil {
 				return "", fmt.Errorf("unable to Download Image: %v", err)
@@ -30,7 +30,7 @@ func ProgressBarCallback(ctx context.Context) ProgressCallback {
 	}
 
 	return func(totalSize int64, r io.Reader, w io.Writer) error {
-		p := mpb.New()
+		p := mpb.New(mpb.WithOutput(sylog.Writer()))
 		bar := p.AddBar(totalSize,
 			mpb.PrependDecorators(
 				decor.Counters(decor.UnitKiB, "%.1f / %.1f"),
@@ -155,6 +155,7 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 		defer cacheEntry.CleanTmp()
 		if !cacheEntry.Exists {
 			sylog.Infof("Downloading shub image")
+			cacheEntry.Source = pullFrom
 
 			err := DownloadImage(ctx, manifest, cacheEntry.TmpPath, pullFrom, true, noHTTPS)
 			if err != nil {
@@ -1,4 +1,4 @@
-// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// Copyright (c) 2019-2020, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -8,6 +8,7 @@ package fakeroot
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
@@ -16,6 +17,7 @@ import (
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sylabs/singularity/internal/pkg/util/user"
+	"github.com/sylabs/singularity/pkg/sylog"
 	"github.com/sylabs/singularity/pkg/util/fs/lock"
 )
 
@@ -40,6 +42,10 @@ const (
 	maxUID = ^uint32(0)
 )
 
+// ErrMappingDisabled is returned by LookupIDRange when the user mapping
+// entry is disabled.
+var ErrMappingDisabled = errors.New("your fakeroot mapping has been disabled by the administrator")
+
 // Entry represents an entry line of subuid/subgid configuration file.
 type Entry struct {
 	line     string
@@ -50,6 +56,11 @@ type Entry struct {
 	invalid  bool
 }
 
+// Disabled returns if the entry has been disabled by the administrator.
+func (e *Entry) Disabled() bool {
+	return e.disabled
+}
+
 // Config holds all entries found in the corresponding configuration
 // file and manages its configuration.
 type Config struct {
@@ -60,6 +71,23 @@ type Config struct {
 	getUserFn     func(string) (*user.User, error)
 }
 
+// UIDs returns the user IDs of the valid entries, in the order of the
+// configuration file and without duplicates. Entries associated to an
+// unknown user are ignored.
+func (c *Config) UIDs() []uint32 {
+	var uids []uint32
+
+	seen := make(map[uint32]bool)
+	for _, e := range c.entries {
+		if e.invalid || e.UID == maxUID || seen[e.UID] {
+			continue
+		}
+		seen[e.UID] = true
+		uids = append(uids, e.UID)
+	}
+	return uids
+}
+
 // GetUserFn defines the user lookup function prototype.
 type GetUserFn func(string) (*user.User, error)
 
@@ -290,9 +318,10 @@ func (c *Config) DisableUser(username string) error {
 }
 
 // GetUserEntry returns a user entry associated to a user and returns
-// an error if there is no entry for this user.
+// an error if there is no entry for this user. If there are multiple
+// entries for the user, the first one with a range count large enough
+// is returned.
 func (c *Config) GetUserEntry(username string) (*Entry, error) {
-	var largeRangeEntries []*Entry
 	entryCount := 0
 
 	u, err := c.getUserFn(username)
@@ -304,27 +333,12 @@ func (c *Config) GetUserEntry(username string) (*Entry, error) {
 			continue
 		}
 		if entry.UID == u.UID {
-			if entry.Count == validRangeCount {
+			if entry.Count >= validRangeCount {
 				return entry, nil
-			} else if entry.Count > validRangeCount {
-				largeRangeEntries = append(largeRangeEntries, entry)
-				continue
 			}
 			entryCount++
 		}
 	}
-	var largestEntry *Entry
-
-	for _, e := range largeRangeEntries {
-		if largestEntry == nil {
-			largestEntry = e
-		} else if e.Count > largestEntry.Count {
-			largestEntry = e
-		}
-	}
-	if largestEntry != nil {
-		return largestEntry, nil
-	}
 
 	if entryCount > 0 {
 		return nil, fmt.Errorf(
@@ -342,26 +356,56 @@ var getPwNam = user.GetPwNam
 // GetIDRange determines UID/GID mappings based on configuration
 // file provided in path.
 func GetIDRange(path string, uid uint32) (*specs.LinuxIDMapping, error) {
-	config, err := GetConfig(path, false, getPwNam)
+	idRange, _, err := LookupIDRange(path, uid)
+	return idRange, err
+}
+
+// LookupIDRange determines UID/GID mappings like GetIDRange and also
+// returns where the mapping was found. For the default subuid/subgid
+// files, the ranges reported by getsubids are used first, the file is
+// read if getsubids is not installed or doesn't report a range large
+// enough for the user.
+func LookupIDRange(path string, uid uint32) (*specs.LinuxIDMapping, string, error) {
+	userinfo, err := getPwUID(uid)
 	if err != nil {
-		return nil, err
+		return nil, "", fmt.Errorf("could not retrieve user with UID %d: %s", uid, err)
 	}
-	defer config.Close()
 
-	userinfo, err := getPwUID(uid)
+	if path == SubUIDFile || path == SubGIDFile {
+		entries, err := subidRanges(userinfo.Name, path == SubGIDFile)
+		if err != nil {
+			sylog.Warningf("Could not retrieve subordinate ranges, falling back to %s: %s", path, err)
+		}
+		for _, e := range entries {
+			if e.Count >= validRangeCount {
+				return &specs.LinuxIDMapping{
+					ContainerID: 1,
+					HostID:      e.Start,
+					Size:        e.Count,
+				}, SourceGetsubids, nil
+			}
+		}
+		if len(entries) > 0 {
+			sylog.Debugf("All subordinate ranges of %s reported by getsubids have a range count lower than %d", userinfo.Name, validRangeCount)
+		}
+	}
+
+	config, err := GetConfig(path, false, getPwNam)
 	if err != nil {
-		return nil, fmt.Errorf("could not retrieve user with UID %d: %s", uid, err)
+		return nil, "", err
 	}
+	defer config.Close()
+
 	e, err := config.GetUserEntry(userinfo.Name)
 	if err != nil {
-		return nil, err
+		return nil, "", fmt.Errorf("%s, an administrator can add one with 'singularity config fakeroot --add %s'", err, userinfo.Name)
 	}
 	if e.disabled {
-		return nil, fmt.Errorf("your fakeroot mapping has been disabled by the administrator")
+		return nil, "", fmt.Errorf("%w, it can be enabled with 'singularity config fakeroot --enable %s'", ErrMappingDisabled, userinfo.Name)
 	}
 	return &specs.LinuxIDMapping{
 		ContainerID: 1,
 		HostID:      e.Start,
 		Size:        e.Count,
-	}, nil
+	}, path, nil
 }
@@ -9,6 +9,7 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
@@ -166,13 +167,13 @@ root:100000:65536
 			},
 		},
 		{
-			name: "temporary file, uid 1 (multiple good)",
+			name: "temporary file, uid 1 (multiple good, first large enough)",
 			path: f.Name(),
 			uid:  1,
 			expectedMapping: &specs.LinuxIDMapping{
 				ContainerID: 1,
 				HostID:      165536,
-				Size:        65536,
+				Size:        165536,
 			},
 		},
 		{
@@ -191,13 +192,13 @@ root:100000:65536
 			uid:  4,
 		},
 		{
-			name: "temporary file, uid 5 (multiple large)",
+			name: "temporary file, uid 5 (multiple large, first large enough)",
 			path: f.Name(),
 			uid:  5,
 			expectedMapping: &specs.LinuxIDMapping{
 				ContainerID: 1,
 				HostID:      5065536,
-				Size:        1000000,
+				Size:        131072,
 			},
 		},
 		{
@@ -209,6 +210,151 @@ root:100000:65536
 	for _, test := range tests {
 		testGetIDRange(t, test)
 	}
+
+	// the error for a missing mapping names the command to add one
+	_, err = GetIDRange(f.Name(), 3)
+	if err == nil || !strings.Contains(err.Error(), "singularity config fakeroot --add sys") {
+		t.Errorf("unexpected error for missing mapping: %v", err)
+	}
+}
+
+func TestLookupIDRangeGetsubids(t *testing.T) {
+	getPwUID = getPwUIDMock
+	getPwNam = getPwNamMock
+	origSubidRanges := subidRanges
+	defer func() {
+		getPwUID = user.GetPwUID
+		getPwNam = user.GetPwNam
+		subidRanges = origSubidRanges
+	}()
+
+	ranges := map[string][]*Entry{
+		"root": {
+			{Start: 100000, Count: 1000},
+			{Start: 200000, Count: 65536},
+			{Start: 300000, Count: 131072},
+		},
+		"daemon": {
+			{Start: 400000, Count: 131072},
+		},
+	}
+	var groups []bool
+	subidRanges = func(username string, group bool) ([]*Entry, error) {
+		groups = append(groups, group)
+		return ranges[username], nil
+	}
+
+	tests := []struct {
+		name            string
+		path            string
+		uid             uint32
+		wantGroup       bool
+		expectedMapping *specs.LinuxIDMapping
+	}{
+		{
+			name:            "subuid first large enough",
+			path:            SubUIDFile,
+			uid:             0,
+			wantGroup:       false,
+			expectedMapping: &specs.LinuxIDMapping{ContainerID: 1, HostID: 200000, Size: 65536},
+		},
+		{
+			name:            "subgid",
+			path:            SubGIDFile,
+			uid:             1,
+			wantGroup:       true,
+			expectedMapping: &specs.LinuxIDMapping{ContainerID: 1, HostID: 400000, Size: 131072},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups = nil
+
+			idRange, source, err := LookupIDRange(tt.path, tt.uid)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if source != SourceGetsubids {
+				t.Errorf("unexpected source %q", source)
+			}
+			if !reflect.DeepEqual(idRange, tt.expectedMapping) {
+				t.Errorf("got mapping %+v, want %+v", idRange, tt.expectedMapping)
+			}
+			if len(groups) != 1 || groups[0] != tt.wantGroup {
+				t.Errorf("unexpected getsubids group queries %v", groups)
+			}
+		})
+	}
+
+	// getsubids is only queried for the default files
+	f, err := fs.MakeTmpFile("", "subid-", 0644)
+	if err != nil {
+		t.Fatalf("failed to create temporary file")
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("root:500000:65536\n")
+	f.Close()
+
+	groups = nil
+	idRange, source, err := LookupIDRange(f.Name(), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if source != f.Name() || idRange.HostID != 500000 {
+		t.Errorf("unexpected mapping %+v from %s", idRange, source)
+	} else if len(groups) != 0 {
+		t.Errorf("getsubids queried for %s", f.Name())
+	}
+}
+
+func TestParseSubids(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		want    [][2]uint32
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			out:  "",
+		},
+		{
+			name: "multiple",
+			out:  "0: alice 100000 65536\n1: alice 300000 131072\n",
+			want: [][2]uint32{{100000, 65536}, {300000, 131072}},
+		},
+		{
+			name:    "bad format",
+			out:     "Error fetching ranges\n",
+			wantErr: true,
+		},
+		{
+			name:    "bad count",
+			out:     "0: alice 100000 -1\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := parseSubids([]byte(tt.out))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("unexpected success")
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			var got [][2]uint32
+			for _, e := range entries {
+				got = append(got, [2]uint32{e.Start, e.Count})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got ranges %v, want %v", got, tt.want)
+			}
+		})
+	}
 }
 
 func getUserFn(username string) (*user.User, error) {
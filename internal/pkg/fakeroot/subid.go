@@ -0,0 +1,99 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fakeroot
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// SourceGetsubids is the source reported for the subordinate ranges
+// returned by getsubids, the ranges read from the subuid/subgid files
+// are reported with the file path.
+const SourceGetsubids = "getsubids"
+
+// getsubidsPaths are the locations searched for the getsubids command of
+// shadow-utils, which queries libsubid and so the subid plugins configured
+// in nsswitch.conf (e.g. LDAP). Only root owned system directories are
+// searched as the command is run with privileges in setuid mode.
+var getsubidsPaths = []string{"/usr/bin/getsubids", "/bin/getsubids"}
+
+// getsubids returns the path of the getsubids command, or an empty string
+// if it's not installed.
+func getsubids() string {
+	for _, path := range getsubidsPaths {
+		fi, err := os.Stat(path)
+		if err == nil && fi.Mode().IsRegular() && fi.Mode()&0111 != 0 {
+			return path
+		}
+	}
+	return ""
+}
+
+// subidRanges returns the subordinate ID ranges of the user reported by
+// getsubids, the subordinate group ID ranges if group is set. It returns
+// no error and no range if getsubids is not installed, it's also used for
+// mocking purpose.
+var subidRanges = func(username string, group bool) ([]*Entry, error) {
+	path := getsubids()
+	if path == "" {
+		return nil, nil
+	}
+
+	args := []string{username}
+	if group {
+		args = []string{"-g", username}
+	}
+
+	var stderr bytes.Buffer
+
+	cmd := exec.Command(path, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %s: %s", path, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return parseSubids(out)
+}
+
+// parseSubids parses the output of getsubids, each range is reported on
+// a line formatted as "<index>: <owner> <start> <count>".
+func parseSubids(out []byte) ([]*Entry, error) {
+	var entries []*Entry
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 4 || !strings.HasSuffix(fields[0], ":") {
+			return nil, fmt.Errorf("unexpected getsubids output: %q", line)
+		}
+		start, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad range start in getsubids output %q: %s", line, err)
+		}
+		count, err := strconv.ParseUint(fields[3], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad range count in getsubids output %q: %s", line, err)
+		}
+		entries = append(entries, &Entry{
+			line:  line,
+			Start: uint32(start),
+			Count: uint32(count),
+		})
+	}
+
+	return entries, scanner.Err()
+}
@@ -7,11 +7,13 @@ package instance
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"syscall"
 
@@ -36,6 +38,10 @@ const (
 	prognameFormat  = "%s: %s [%s]"
 )
 
+// ErrOtherUser is returned when the requested instance isn't an instance of
+// the current user but is run by another user.
+var ErrOtherUser = errors.New("permission denied")
+
 // File represents an instance file storing instance information
 type File struct {
 	Path       string `json:"-"`
@@ -49,6 +55,12 @@ type File struct {
 	IP         string `json:"ip"`
 	LogErrPath string `json:"logErrPath"`
 	LogOutPath string `json:"logOutPath"`
+	// StartOptions are the options given to instance start, they are
+	// not recorded by older versions
+	StartOptions *StartOptions `json:"startOptions,omitempty"`
+	// IPv6 is the IPv6 address of an instance with both an IPv4
+	// and an IPv6 address, IP being its IPv4 address
+	IPv6 string `json:"ipv6,omitempty"`
 }
 
 // ProcName returns processus name based on instance name
@@ -117,19 +129,73 @@ func GetDir(name string, subDir string) (string, error) {
 
 // Get returns the instance file corresponding to instance name
 func Get(name string, subDir string) (*File, error) {
+	return GetForUser(name, "", subDir)
+}
+
+// GetForUser returns the instance file corresponding to instance name
+// belonging to username, or to the current user if username is empty
+func GetForUser(name string, username string, subDir string) (*File, error) {
 	if err := CheckName(name); err != nil {
 		return nil, err
 	}
-	list, err := List("", name, subDir)
+	list, err := List(username, name, subDir)
 	if err != nil {
 		return nil, err
 	}
 	if len(list) != 1 {
+		if username != "" {
+			return nil, fmt.Errorf("no instance found with name %s for user %s", name, username)
+		}
+		if subDir == SingSubDir {
+			if owner := otherOwner(name); owner != "" {
+				return nil, fmt.Errorf("%w: instance %s belongs to user %s", ErrOtherUser, name, owner)
+			}
+		}
 		return nil, fmt.Errorf("no instance found with name %s", name)
 	}
 	return list[0], nil
 }
 
+// otherOwner returns the name of the user running the instance name if it
+// isn't the current user, or an empty string.
+func otherOwner(name string) string {
+	u, err := user.CurrentOriginal()
+	if err != nil {
+		return ""
+	}
+	owner := findOwner("/proc", name)
+	if owner == u.Name {
+		return ""
+	}
+	return owner
+}
+
+// findOwner returns the name of the user running the instance name, from
+// the names of the instance processes of the proc filesystem at procDir, or
+// an empty string if no instance process has this name.
+func findOwner(procDir, name string) string {
+	entries, err := ioutil.ReadDir(procDir)
+	if err != nil {
+		return ""
+	}
+	prefix := ProgPrefix + ": "
+	suffix := " [" + name + "]"
+	for _, e := range entries {
+		if _, err := strconv.Atoi(e.Name()); err != nil {
+			continue
+		}
+		d, err := ioutil.ReadFile(filepath.Join(procDir, e.Name(), "cmdline"))
+		if err != nil {
+			continue
+		}
+		progname := strings.TrimRight(strings.SplitN(string(d), "\x00", 2)[0], " ")
+		if strings.HasPrefix(progname, prefix) && strings.HasSuffix(progname, suffix) {
+			return strings.TrimSuffix(strings.TrimPrefix(progname, prefix), suffix)
+		}
+	}
+	return ""
+}
+
 // Add creates an instance file for a named instance in a privileged
 // or unprivileged path
 func Add(name string, subDir string) (*File, error) {
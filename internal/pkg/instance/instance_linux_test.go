@@ -6,6 +6,7 @@
 package instance
 
 import (
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -251,6 +252,41 @@ func TestGet(t *testing.T) {
 	}
 }
 
+func TestFindOwner(t *testing.T) {
+	procDir, err := ioutil.TempDir("", "proc-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(procDir)
+
+	processes := map[string]string{
+		"10":   "Singularity instance: alice [web]\x00",
+		"11":   "Singularity instance: bob [db]\x00\x00\x00",
+		"12":   "sinit\x00",
+		"self": "Singularity instance: eve [self]\x00",
+	}
+	for pid, cmdline := range processes {
+		if err := os.Mkdir(filepath.Join(procDir, pid), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(procDir, pid, "cmdline"), []byte(cmdline), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := map[string]string{
+		"web":  "alice",
+		"db":   "bob",
+		"b":    "",
+		"self": "",
+	}
+	for name, owner := range tests {
+		if got := findOwner(procDir, name); got != owner {
+			t.Errorf("got owner %q of instance %s, want %q", got, name, owner)
+		}
+	}
+}
+
 func TestMain(m *testing.M) {
 	// spawn a fake instance process
 	cmd := exec.Command("cat")
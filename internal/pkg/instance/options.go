@@ -0,0 +1,86 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// StartOptions are the options an instance is started with, recorded in
+// the instance file and in options files to start it again with the same
+// options.
+type StartOptions struct {
+	// Image is the absolute path or the URI of the instance image
+	Image string `json:"image"`
+	// Args are the arguments passed to the startscript
+	Args []string `json:"args,omitempty"`
+	// Flags are the instance start flags set on the command line or
+	// from the environment, in the form name=value, a flag taking
+	// several values is recorded once per value
+	Flags []string `json:"flags,omitempty"`
+}
+
+// Flag returns the values of the flag name in the options.
+func (o *StartOptions) Flag(name string) []string {
+	var values []string
+	for _, f := range o.Flags {
+		kv := strings.SplitN(f, "=", 2)
+		if kv[0] == name && len(kv) == 2 {
+			values = append(values, kv[1])
+		}
+	}
+	return values
+}
+
+// LoadStartOptions reads the start options from the options file at path.
+func LoadStartOptions(path string) (*StartOptions, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read options file: %w", err)
+	}
+	o := &StartOptions{}
+	if err := json.Unmarshal(b, o); err != nil {
+		return nil, fmt.Errorf("could not parse options file %s: %s", path, err)
+	}
+	if o.Image == "" {
+		return nil, fmt.Errorf("options file %s doesn't set an image", path)
+	}
+	for _, f := range o.Flags {
+		if !strings.Contains(f, "=") {
+			return nil, fmt.Errorf("options file %s: flag %q is not in the name=value form", path, f)
+		}
+	}
+	return o, nil
+}
+
+// Save writes the start options to the options file at path, creating its
+// parent directory if needed.
+func (o *StartOptions) Save(path string) error {
+	b, err := json.MarshalIndent(o, "", "\t")
+	if err != nil {
+		return fmt.Errorf("could not encode start options: %s", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("could not create options file directory: %s", err)
+	}
+
+	// write to a temporary file first, the options file may be used
+	// by a running service
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(b, '\n'), 0644); err != nil {
+		return fmt.Errorf("could not write options file: %s", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("could not write options file: %s", err)
+	}
+	return nil
+}
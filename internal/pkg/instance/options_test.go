@@ -0,0 +1,69 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStartOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "start-options-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	o := &StartOptions{
+		Image: "/images/nginx.sif",
+		Args:  []string{"-g", "daemon off;"},
+		Flags: []string{"bind=/data:/data", "bind=/logs", "net=true", "env=A=b"},
+	}
+
+	path := filepath.Join(dir, "units", "web.json")
+	if err := o.Save(path); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	got, err := LoadStartOptions(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(got, o) {
+		t.Errorf("got %+v, want %+v", got, o)
+	}
+
+	if b := got.Flag("bind"); !reflect.DeepEqual(b, []string{"/data:/data", "/logs"}) {
+		t.Errorf("unexpected bind values %v", b)
+	}
+	if e := got.Flag("env"); !reflect.DeepEqual(e, []string{"A=b"}) {
+		t.Errorf("unexpected env values %v", e)
+	}
+	if n := got.Flag("network"); n != nil {
+		t.Errorf("unexpected network values %v", n)
+	}
+
+	invalid := map[string]string{
+		"NoImage":   `{"args": ["a"]}`,
+		"BadFlag":   `{"image": "/a.sif", "flags": ["net"]}`,
+		"Malformed": `{"image": `,
+	}
+	for name, content := range invalid {
+		path := filepath.Join(dir, name+".json")
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadStartOptions(path); err == nil {
+			t.Errorf("%s: unexpected success", name)
+		}
+	}
+	if _, err := LoadStartOptions(filepath.Join(dir, "missing.json")); !os.IsNotExist(errors.Unwrap(err)) {
+		t.Errorf("unexpected error for a missing file: %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package remote
+
+import (
+	"github.com/sylabs/singularity/internal/pkg/client/bucket"
+)
+
+// Bucket holds the settings applied to the pulls from the s3:// and gs://
+// object storage buckets.
+type Bucket struct {
+	bucket.Config `yaml:",inline"`
+	System        bool `yaml:"System,omitempty"` // Was this bucket set from system config file
+}
+
+// BucketConfigs returns the settings of the buckets, in order of
+// precedence.
+func (c *Config) BucketConfigs() []bucket.Config {
+	configs := make([]bucket.Config, 0, len(c.Buckets))
+	for _, b := range c.Buckets {
+		configs = append(configs, b.Config)
+	}
+	return configs
+}
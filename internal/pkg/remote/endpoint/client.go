@@ -53,14 +53,20 @@ func (ep *Config) KeyserverClientConfig(uri string, op KeyserverOp) (*keyclient.
 	if isDefault {
 		config.BaseURL = primaryKeyserver.URI
 
-		if op == KeyserverVerifyOp {
-			// verify operation can query multiple keyserver, the token
-			// is automatically set by the custom client
+		if op == KeyserverVerifyOp || op == KeyserverSearchOp {
+			// verify and search operations query keyservers in order,
+			// the token is automatically set by the custom client
 			keyservers = ep.Keyservers
 		} else {
-			// use the primary keyserver
+			// use the first keyserver accepting keys, verify only
+			// keyservers are skipped
+			kc, err := ep.pushableKeyserver()
+			if err != nil {
+				return nil, err
+			}
+			config.BaseURL = kc.URI
 			keyservers = []*ServiceConfig{
-				primaryKeyserver,
+				kc,
 			}
 		}
 	} else if ep.Exclusive {
@@ -97,6 +103,53 @@ func (ep *Config) KeyserverClientConfig(uri string, op KeyserverOp) (*keyclient.
 	return config, nil
 }
 
+// KeyserverPushClientConfigs returns the client configurations used to
+// push keys to the keyservers of the remote endpoint: the first keyserver
+// accepting keys or all of them if all is true.
+func (ep *Config) KeyserverPushClientConfigs(all bool) ([]*keyclient.Config, error) {
+	if !all {
+		config, err := ep.KeyserverClientConfig("", KeyserverPushOp)
+		if err != nil {
+			return nil, err
+		}
+		return []*keyclient.Config{config}, nil
+	}
+
+	keyservers, err := ep.ActiveKeyservers()
+	if err != nil {
+		return nil, err
+	}
+
+	var configs []*keyclient.Config
+
+	for _, kc := range keyservers {
+		if kc.VerifyOnly {
+			continue
+		}
+		configs = append(configs, &keyclient.Config{
+			BaseURL:    kc.URI,
+			UserAgent:  useragent.Value(),
+			HTTPClient: newClient([]*ServiceConfig{kc}, KeyserverPushOp),
+		})
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("no keyserver accepting keys configured: all keyservers are verify only")
+	}
+
+	return configs, nil
+}
+
+// pushableKeyserver returns the first keyserver accepting keys.
+func (ep *Config) pushableKeyserver() (*ServiceConfig, error) {
+	for _, kc := range ep.Keyservers {
+		if kc.Skip || kc.VerifyOnly {
+			continue
+		}
+		return kc, nil
+	}
+	return nil, fmt.Errorf("no keyserver accepting keys configured: all keyservers are verify only")
+}
+
 func (ep *Config) LibraryClientConfig(uri string) (*libclient.Config, error) {
 	// empty uri means to use the default endpoint
 	isDefault := uri == ""
@@ -6,6 +6,7 @@
 package endpoint
 
 import (
+	"reflect"
 	"testing"
 
 	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
@@ -94,6 +95,42 @@ func TestKeyserverClientConfig(t *testing.T) {
 			expectSuccess: true,
 			op:            KeyserverSearchOp,
 		},
+		{
+			name: "Sylabs cloud push verify only",
+			endpoint: &Config{
+				URI: SCSDefaultCloudURI,
+				Keyservers: []*ServiceConfig{
+					{
+						URI:        "http://localhost:11371",
+						External:   true,
+						VerifyOnly: true,
+					},
+					{
+						URI: SCSDefaultKeyserverURI,
+					},
+				},
+			},
+			uri:           "",
+			expectedURI:   SCSDefaultKeyserverURI,
+			expectSuccess: true,
+			op:            KeyserverPushOp,
+		},
+		{
+			name: "Sylabs cloud push all verify only",
+			endpoint: &Config{
+				URI: SCSDefaultCloudURI,
+				Keyservers: []*ServiceConfig{
+					{
+						URI:        "http://localhost:11371",
+						External:   true,
+						VerifyOnly: true,
+					},
+				},
+			},
+			uri:           "",
+			expectSuccess: false,
+			op:            KeyserverPushOp,
+		},
 		{
 			name: "Custom library",
 			endpoint: &Config{
@@ -132,6 +169,59 @@ func TestKeyserverClientConfig(t *testing.T) {
 	}
 }
 
+func TestKeyserverPushClientConfigs(t *testing.T) {
+	ep := &Config{
+		URI: SCSDefaultCloudURI,
+		Keyservers: []*ServiceConfig{
+			{
+				URI:        "https://verify.keys",
+				External:   true,
+				VerifyOnly: true,
+			},
+			{
+				URI: SCSDefaultKeyserverURI,
+			},
+			{
+				URI:      "http://localhost:11371",
+				External: true,
+			},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		all          bool
+		expectedURIs []string
+	}{
+		{
+			name:         "First",
+			all:          false,
+			expectedURIs: []string{SCSDefaultKeyserverURI},
+		},
+		{
+			name:         "All",
+			all:          true,
+			expectedURIs: []string{SCSDefaultKeyserverURI, "http://localhost:11371"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configs, err := ep.KeyserverPushClientConfigs(tt.all)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			uris := make([]string, 0, len(configs))
+			for _, c := range configs {
+				uris = append(uris, c.BaseURL)
+			}
+			if !reflect.DeepEqual(uris, tt.expectedURIs) {
+				t.Errorf("unexpected uris returned: %v instead of %v", uris, tt.expectedURIs)
+			}
+		})
+	}
+}
+
 func TestLibraryClientConfig(t *testing.T) {
 	tests := []struct {
 		name          string
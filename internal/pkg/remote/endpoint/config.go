@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/sylabs/singularity/internal/pkg/remote/credential"
+	"github.com/sylabs/singularity/internal/pkg/tuf"
 	"github.com/sylabs/singularity/pkg/syfs"
 )
 
@@ -31,6 +32,9 @@ type Config struct {
 	System     bool             `yaml:"System"`    // Was this EndPoint set from system config file
 	Exclusive  bool             `yaml:"Exclusive"` // true if the endpoint must be used exclusively
 	Keyservers []*ServiceConfig `yaml:"Keyservers,omitempty"`
+	// Freshness opts in to check that verified images are the latest
+	// signed version listed by the TUF metadata of a source
+	Freshness *tuf.Config `yaml:"Freshness,omitempty"`
 
 	// for internal purpose
 	credentials []*credential.Config
@@ -49,6 +53,9 @@ type ServiceConfig struct {
 	Skip     bool   `yaml:"Skip"`
 	External bool   `yaml:"External"`
 	Insecure bool   `yaml:"Insecure"`
+	// VerifyOnly keyservers are queried for key verification and
+	// search only, keys are never pushed to them
+	VerifyOnly bool `yaml:"VerifyOnly,omitempty"`
 }
 
 func cacheDir() string {
@@ -6,9 +6,12 @@
 package endpoint
 
 import (
+	"bytes"
 	"crypto/tls"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/sylabs/singularity/internal/pkg/remote/credential"
@@ -30,8 +33,10 @@ const (
 	KeyserverVerifyOp
 )
 
-// AddKeyserver adds a keyserver for the corresponding remote endpoint.
-func (ep *Config) AddKeyserver(uri string, order uint32, insecure bool) error {
+// AddKeyserver adds a keyserver for the corresponding remote endpoint,
+// a verify only keyserver is queried by key verification and search but
+// keys are never pushed to it.
+func (ep *Config) AddKeyserver(uri string, order uint32, insecure, verifyOnly bool) error {
 	if err := ep.UpdateKeyserversConfig(); err != nil {
 		return err
 	}
@@ -68,9 +73,10 @@ func (ep *Config) AddKeyserver(uri string, order uint32, insecure bool) error {
 		ep.Keyservers = append(ep.Keyservers[:matchIndex], ep.Keyservers[matchIndex+1:]...)
 	} else {
 		kc = &ServiceConfig{
-			External: true,
-			URI:      uri,
-			Insecure: insecure,
+			External:   true,
+			URI:        uri,
+			Insecure:   insecure,
+			VerifyOnly: verifyOnly,
 		}
 	}
 
@@ -152,6 +158,38 @@ func (ep *Config) UpdateKeyserversConfig() error {
 	return nil
 }
 
+// ActiveKeyservers returns the keyservers of the remote endpoint in the
+// order they are queried.
+func (ep *Config) ActiveKeyservers() ([]*ServiceConfig, error) {
+	if err := ep.UpdateKeyserversConfig(); err != nil {
+		return nil, err
+	}
+	keyservers := make([]*ServiceConfig, 0, len(ep.Keyservers))
+	for _, kc := range ep.Keyservers {
+		if kc.Skip {
+			continue
+		}
+		keyservers = append(keyservers, kc)
+	}
+	return keyservers, nil
+}
+
+// Authenticated returns if credentials are associated to the keyserver.
+func (kc *ServiceConfig) Authenticated() bool {
+	if kc.credential == nil {
+		return false
+	}
+	return kc.credential.Auth != "" && kc.credential.Auth != credential.TokenPrefix
+}
+
+// Capabilities returns the operations the keyserver is used for.
+func (kc *ServiceConfig) Capabilities() []string {
+	if kc.VerifyOnly {
+		return []string{"verify", "search"}
+	}
+	return []string{"verify", "search", "pull", "push"}
+}
+
 type keyserverTransport struct {
 	keyservers []*ServiceConfig
 	op         KeyserverOp
@@ -159,54 +197,164 @@ type keyserverTransport struct {
 }
 
 func (c *keyserverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	ctx := req.Context()
+	if c.op == KeyserverSearchOp && req.URL.Query().Get("op") == "index" {
+		return c.search(req)
+	}
 
 	for i, k := range c.keyservers {
 		if k.Skip {
 			continue
 		}
 
-		cloneReq := req.Clone(ctx)
-
-		if i > 0 {
-			u, err := remoteutil.NormalizeKeyserverURI(k.URI)
-			if err != nil {
-				return nil, err
+		resp, err := c.do(req, i, k)
+		if err != nil {
+			if i < len(c.keyservers)-1 {
+				continue
 			}
-			cloneReq.URL.Scheme = u.Scheme
-			cloneReq.URL.Host = u.Host
-			cloneReq.URL.User = u.User
+			return resp, err
 		}
 
-		sylog.Debugf("Querying keyserver %s", cloneReq.URL)
+		if resp.StatusCode/100 != 2 && i < len(c.keyservers)-1 {
+			resp.Body.Close()
+			continue
+		}
 
-		cloneReq.Header.Del("Authorization")
-		if k.credential != nil && k.credential.Auth != "" {
-			cloneReq.Header.Set("Authorization", k.credential.Auth)
+		return resp, err
+	}
+
+	return nil, fmt.Errorf("no keyserver configured")
+}
+
+// do sends the request req to the keyserver k at index i.
+func (c *keyserverTransport) do(req *http.Request, i int, k *ServiceConfig) (*http.Response, error) {
+	cloneReq := req.Clone(req.Context())
+
+	if i > 0 {
+		u, err := remoteutil.NormalizeKeyserverURI(k.URI)
+		if err != nil {
+			return nil, err
 		}
+		cloneReq.URL.Scheme = u.Scheme
+		cloneReq.URL.Host = u.Host
+		cloneReq.URL.User = u.User
+	}
+
+	sylog.Debugf("Querying keyserver %s", cloneReq.URL)
 
-		tr, ok := c.client.Transport.(*http.Transport)
-		if ok {
-			tr.TLSClientConfig.InsecureSkipVerify = k.Insecure
+	cloneReq.Header.Del("Authorization")
+	if k.credential != nil && k.credential.Auth != "" {
+		cloneReq.Header.Set("Authorization", k.credential.Auth)
+	}
+
+	tr, ok := c.client.Transport.(*http.Transport)
+	if ok {
+		tr.TLSClientConfig.InsecureSkipVerify = k.Insecure
+	}
+
+	return c.client.Do(cloneReq)
+}
+
+// search sends the key index request req to all keyservers and returns
+// a response aggregating their results.
+func (c *keyserverTransport) search(req *http.Request) (*http.Response, error) {
+	var (
+		bodies  [][]byte
+		errResp *http.Response
+		lastErr error
+	)
+
+	for i, k := range c.keyservers {
+		if k.Skip {
+			continue
 		}
 
-		resp, err := c.client.Do(cloneReq)
+		resp, err := c.do(req, i, k)
 		if err != nil {
-			if i < len(c.keyservers)-1 {
-				continue
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			// keep the first error response to report it
+			// if no keyserver returned results
+			if errResp == nil {
+				errResp = resp
+			} else {
+				resp.Body.Close()
 			}
-			return resp, err
+			continue
 		}
 
-		if resp.StatusCode/100 != 2 && i < len(c.keyservers)-1 {
-			resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
 			continue
 		}
+		bodies = append(bodies, body)
+	}
 
-		return resp, err
+	if len(bodies) == 0 {
+		if errResp != nil {
+			return errResp, nil
+		} else if lastErr != nil {
+			return nil, lastErr
+		}
+		return nil, fmt.Errorf("no keyserver configured")
+	}
+	if errResp != nil {
+		errResp.Body.Close()
 	}
 
-	return nil, fmt.Errorf("no keyserver configured")
+	merged := mergeIndex(bodies)
+
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"text/plain"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(merged)),
+		ContentLength: int64(len(merged)),
+		Request:       req,
+	}, nil
+}
+
+// mergeIndex merges the machine readable key index outputs returned by
+// keyservers, keys returned by several keyservers are listed once in the
+// order of the keyservers.
+func mergeIndex(bodies [][]byte) []byte {
+	var keys bytes.Buffer
+
+	seen := make(map[string]bool)
+	count := 0
+
+	for _, body := range bodies {
+		keep := false
+		for _, line := range strings.Split(string(body), "\n") {
+			fields := strings.Split(line, ":")
+			switch fields[0] {
+			case "", "info":
+				continue
+			case "pub":
+				fp := ""
+				if len(fields) > 1 {
+					fp = strings.ToUpper(fields[1])
+				}
+				keep = !seen[fp]
+				if keep {
+					seen[fp] = true
+					count++
+				}
+			}
+			if keep {
+				keys.WriteString(line)
+				keys.WriteByte('\n')
+			}
+		}
+	}
+
+	return append([]byte(fmt.Sprintf("info:1:%d\n", count)), keys.Bytes()...)
 }
 
 var defaultClient = &http.Client{
@@ -7,6 +7,7 @@ package endpoint
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/sylabs/singularity/internal/pkg/remote/credential"
@@ -20,6 +21,7 @@ func TestAddRemoveKeyserver(t *testing.T) {
 
 	const (
 		localhostKeyserver = "http://localhost:11371"
+		verifyKeyserver    = "https://verify.keys"
 	)
 
 	var testErr error
@@ -36,6 +38,7 @@ func TestAddRemoveKeyserver(t *testing.T) {
 		uri            string
 		order          uint32
 		insecure       bool
+		verifyOnly     bool
 		wantErr        bool
 		wantKeyservers []*ServiceConfig
 	}{
@@ -157,6 +160,30 @@ func TestAddRemoveKeyserver(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:       "Add " + verifyKeyserver + " as verify only",
+			operation:  add,
+			uri:        verifyKeyserver,
+			order:      1,
+			verifyOnly: true,
+			wantErr:    false,
+			wantKeyservers: []*ServiceConfig{
+				{
+					URI:        verifyKeyserver,
+					External:   true,
+					VerifyOnly: true,
+				},
+				{
+					URI:      localhostKeyserver,
+					External: true,
+					Insecure: true,
+				},
+				{
+					URI:        SCSDefaultKeyserverURI,
+					credential: scsDefaultCredential,
+				},
+			},
+		},
 	}
 
 	ep := &Config{
@@ -168,7 +195,7 @@ func TestAddRemoveKeyserver(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			switch tt.operation {
 			case add:
-				testErr = ep.AddKeyserver(tt.uri, tt.order, tt.insecure)
+				testErr = ep.AddKeyserver(tt.uri, tt.order, tt.insecure, tt.verifyOnly)
 			case remove:
 				testErr = ep.RemoveKeyserver(tt.uri)
 			default:
@@ -187,3 +214,49 @@ func TestAddRemoveKeyserver(t *testing.T) {
 		})
 	}
 }
+
+func TestMergeIndex(t *testing.T) {
+	const (
+		key1 = "pub:8883491F4268F173C6E5DC49EDECE4F3F38D871E:1:4096:1535389423::\nuid:Key 1 <key1@example.com>:1535389423::\n"
+		key2 = "pub:A2B7B59E26E4DA8B1DE2F7D3C0C9B2C6A2B2E0E8:1:4096:1535389423::\nuid:Key 2 <key2@example.com>:1535389423::\n"
+	)
+
+	tests := []struct {
+		name   string
+		bodies []string
+		want   string
+	}{
+		{
+			name:   "Empty",
+			bodies: []string{"info:1:0\n"},
+			want:   "info:1:0\n",
+		},
+		{
+			name:   "Single",
+			bodies: []string{"info:1:1\n" + key1},
+			want:   "info:1:1\n" + key1,
+		},
+		{
+			name:   "Multiple",
+			bodies: []string{"info:1:1\n" + key1, "info:1:0\n", "info:1:1\n" + key2},
+			want:   "info:1:2\n" + key1 + key2,
+		},
+		{
+			name:   "Duplicate",
+			bodies: []string{"info:1:2\n" + key2 + key1, "info:1:1\n" + strings.ToLower(key1)},
+			want:   "info:1:2\n" + key2 + key1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bodies := make([][]byte, 0, len(tt.bodies))
+			for _, b := range tt.bodies {
+				bodies = append(bodies, []byte(b))
+			}
+			if got := string(mergeIndex(bodies)); got != tt.want {
+				t.Errorf("got merged index %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package remote
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+const (
+	// MirrorDocker is the transport of the mirror rules applied to
+	// docker:// pulls, matched against normalized references like
+	// docker.io/library/alpine:latest
+	MirrorDocker = "docker"
+	// MirrorLibrary is the transport of the mirror rules applied to
+	// library:// pulls, matched against references prefixed by the
+	// library host like library.sylabs.io/alpine:latest
+	MirrorLibrary = "library"
+	// MirrorOras is the transport of the mirror rules applied to oras://
+	// pulls, matched against normalized references like
+	// registry.example.com/sif/alpine:latest
+	MirrorOras = "oras"
+)
+
+// Mirrors are mirror rules, the system rules coming first.
+type Mirrors []*Mirror
+
+// Mirror is a rewrite rule redirecting the pulls of the images whose
+// reference starts with Prefix, or matches Regex, to an internal mirror.
+type Mirror struct {
+	Transport string `yaml:"Transport"`
+	// Prefix is replaced by Mirror in the matching references
+	Prefix string `yaml:"Prefix,omitempty"`
+	// Regex matching references are replaced by Mirror, which can
+	// reference the regular expression groups with $1, $2 ...
+	Regex  string `yaml:"Regex,omitempty"`
+	Mirror string `yaml:"Mirror"`
+	System bool   `yaml:"System,omitempty"` // Was this rule set from system config file
+}
+
+// Validate returns an error if the mirror rule is invalid.
+func (m *Mirror) Validate() error {
+	if m.Transport != MirrorDocker && m.Transport != MirrorLibrary && m.Transport != MirrorOras {
+		return fmt.Errorf("mirror transport %q is not supported, must be %s, %s or %s", m.Transport, MirrorDocker, MirrorLibrary, MirrorOras)
+	}
+	if (m.Prefix == "") == (m.Regex == "") {
+		return fmt.Errorf("mirror rule for %s must set either a prefix or a regex", m.Mirror)
+	}
+	if m.Mirror == "" {
+		return fmt.Errorf("mirror rule for %s%s has no mirror", m.Prefix, m.Regex)
+	}
+	if m.Regex != "" {
+		if _, err := regexp.Compile(m.Regex); err != nil {
+			return fmt.Errorf("mirror rule regex %s: %s", m.Regex, err)
+		}
+	}
+	return nil
+}
+
+// rewrite returns ref rewritten by the mirror rule and true if ref
+// matches the rule, or ref unchanged and false otherwise.
+func (m *Mirror) rewrite(ref string) (string, bool) {
+	if m.Prefix != "" {
+		if !strings.HasPrefix(ref, m.Prefix) {
+			return ref, false
+		}
+		return m.Mirror + strings.TrimPrefix(ref, m.Prefix), true
+	}
+	re, err := regexp.Compile(m.Regex)
+	if err != nil || !re.MatchString(ref) {
+		return ref, false
+	}
+	return re.ReplaceAllString(ref, m.Mirror), true
+}
+
+// Rewrite returns the image reference ref of a pull using transport
+// rewritten by the first matching mirror rule. The reference is returned
+// unchanged if no rule matches.
+func (ms Mirrors) Rewrite(transport, ref string) string {
+	for _, m := range ms {
+		if m.Transport != transport {
+			continue
+		}
+		if r, ok := m.rewrite(ref); ok {
+			return r
+		}
+	}
+	return ref
+}
+
+// RewriteRegistry returns the registry reference ref, without transport
+// prefix, of a docker or oras pull rewritten by the mirror rules. Rules
+// are matched against the normalized reference, like
+// docker.io/library/alpine:latest for alpine, ref is returned unchanged if
+// no rule matches. The boolean is true when the rewritten reference is on
+// another registry host: the credentials of the original registry must not
+// be sent to the mirror, whose credentials are looked up in the docker
+// configuration instead.
+func (ms Mirrors) RewriteRegistry(transport, ref string) (string, bool) {
+	if len(ms) == 0 {
+		return ref, false
+	}
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		sylog.Debugf("Not applying mirror rules to %s: %s", ref, err)
+		return ref, false
+	}
+	normalized := reference.TagNameOnly(named).String()
+
+	mirrored := ms.Rewrite(transport, normalized)
+	if mirrored == normalized {
+		return ref, false
+	}
+	mirroredNamed, err := reference.ParseNormalizedNamed(mirrored)
+	if err != nil {
+		sylog.Warningf("Ignoring mirror %s of %s: %s", mirrored, ref, err)
+		return ref, false
+	}
+	return mirrored, reference.Domain(mirroredNamed) != reference.Domain(named)
+}
+
+// Rewrite returns the image reference ref of a pull using transport
+// rewritten by the first matching mirror rule, the system rules coming
+// first. The reference is returned unchanged if no rule matches.
+func (c *Config) Rewrite(transport, ref string) string {
+	return c.Mirrors.Rewrite(transport, ref)
+}
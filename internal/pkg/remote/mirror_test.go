@@ -0,0 +1,204 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package remote
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMirrorValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mirror  Mirror
+		wantErr bool
+	}{
+		{
+			name:   "Prefix",
+			mirror: Mirror{Transport: MirrorDocker, Prefix: "docker.io/", Mirror: "mirror.example.com/"},
+		},
+		{
+			name:   "Regex",
+			mirror: Mirror{Transport: MirrorLibrary, Regex: "^library.sylabs.io/(.*)$", Mirror: "library.example.com/$1"},
+		},
+		{
+			name:    "BadTransport",
+			mirror:  Mirror{Transport: "shub", Prefix: "singularity-hub.org/", Mirror: "mirror.example.com/"},
+			wantErr: true,
+		},
+		{
+			name:    "NoMatch",
+			mirror:  Mirror{Transport: MirrorDocker, Mirror: "mirror.example.com/"},
+			wantErr: true,
+		},
+		{
+			name:    "PrefixAndRegex",
+			mirror:  Mirror{Transport: MirrorDocker, Prefix: "docker.io/", Regex: "^docker.io/", Mirror: "mirror.example.com/"},
+			wantErr: true,
+		},
+		{
+			name:    "NoMirror",
+			mirror:  Mirror{Transport: MirrorDocker, Prefix: "docker.io/"},
+			wantErr: true,
+		},
+		{
+			name:    "BadRegex",
+			mirror:  Mirror{Transport: MirrorDocker, Regex: "^docker.io/(", Mirror: "mirror.example.com/"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.mirror.Validate()
+			if tt.wantErr && err == nil {
+				t.Errorf("unexpected success")
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	c := &Config{
+		Mirrors: []*Mirror{
+			{Transport: MirrorDocker, Prefix: "docker.io/library/", Mirror: "registry.example.com/hub/"},
+			{Transport: MirrorDocker, Regex: `^quay\.io/([^/]+)/(.*)$`, Mirror: "registry.example.com/quay-$1/$2"},
+			{Transport: MirrorDocker, Prefix: "docker.io/", Mirror: "registry.example.com/other/"},
+			{Transport: MirrorLibrary, Prefix: "library.sylabs.io/", Mirror: "library.example.com/"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		transport string
+		ref       string
+		want      string
+	}{
+		{
+			name:      "DockerPrefix",
+			transport: MirrorDocker,
+			ref:       "docker.io/library/alpine:latest",
+			want:      "registry.example.com/hub/alpine:latest",
+		},
+		{
+			name:      "DockerFirstMatch",
+			transport: MirrorDocker,
+			ref:       "docker.io/sylabsio/lolcow:latest",
+			want:      "registry.example.com/other/sylabsio/lolcow:latest",
+		},
+		{
+			name:      "DockerRegex",
+			transport: MirrorDocker,
+			ref:       "quay.io/biocontainers/samtools:1.10",
+			want:      "registry.example.com/quay-biocontainers/samtools:1.10",
+		},
+		{
+			name:      "DockerNoMatch",
+			transport: MirrorDocker,
+			ref:       "ghcr.io/owner/image:latest",
+			want:      "ghcr.io/owner/image:latest",
+		},
+		{
+			name:      "Library",
+			transport: MirrorLibrary,
+			ref:       "library.sylabs.io/alpine:latest",
+			want:      "library.example.com/alpine:latest",
+		},
+		{
+			name:      "OtherTransport",
+			transport: MirrorLibrary,
+			ref:       "docker.io/library/alpine:latest",
+			want:      "docker.io/library/alpine:latest",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.Rewrite(tt.transport, tt.ref); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteRegistry(t *testing.T) {
+	ms := Mirrors{
+		{Transport: MirrorDocker, Prefix: "docker.io/", Mirror: "registry.example.com/hub/"},
+		{Transport: MirrorDocker, Prefix: "ghcr.io/sylabs/", Mirror: "ghcr.io/sylabs-mirror/"},
+		{Transport: MirrorOras, Prefix: "ghcr.io/", Mirror: "registry.example.com/ghcr/"},
+	}
+
+	tests := []struct {
+		name      string
+		transport string
+		ref       string
+		want      string
+		wantMoved bool
+	}{
+		{
+			name:      "Normalized",
+			transport: MirrorDocker,
+			ref:       "alpine",
+			want:      "registry.example.com/hub/library/alpine:latest",
+			wantMoved: true,
+		},
+		{
+			name:      "SameHost",
+			transport: MirrorDocker,
+			ref:       "ghcr.io/sylabs/alpine:3.12",
+			want:      "ghcr.io/sylabs-mirror/alpine:3.12",
+		},
+		{
+			name:      "Oras",
+			transport: MirrorOras,
+			ref:       "ghcr.io/sylabs/alpine:3.12",
+			want:      "registry.example.com/ghcr/sylabs/alpine:3.12",
+			wantMoved: true,
+		},
+		{
+			name:      "NoMatch",
+			transport: MirrorOras,
+			ref:       "quay.io/sylabs/alpine",
+			want:      "quay.io/sylabs/alpine",
+		},
+		{
+			name:      "Invalid",
+			transport: MirrorDocker,
+			ref:       "UPPER",
+			want:      "UPPER",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, moved := ms.RewriteRegistry(tt.transport, tt.ref)
+			if got != tt.want || moved != tt.wantMoved {
+				t.Errorf("got %s, %t, want %s, %t", got, moved, tt.want, tt.wantMoved)
+			}
+		})
+	}
+}
+
+func TestReadFromMirrors(t *testing.T) {
+	data := `Mirrors:
+- Transport: docker
+  Prefix: docker.io/
+  Mirror: registry.example.com/
+`
+	c, err := ReadFrom(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(c.Mirrors) != 1 || c.Mirrors[0].Mirror != "registry.example.com/" {
+		t.Errorf("unexpected mirrors %v", c.Mirrors)
+	}
+
+	if _, err := ReadFrom(strings.NewReader(data + "- Transport: docker\n  Mirror: registry.example.com/\n")); err == nil {
+		t.Errorf("unexpected success with an invalid mirror rule")
+	}
+}
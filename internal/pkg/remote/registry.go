@@ -0,0 +1,67 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package remote
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/containers/image/v5/docker/reference"
+)
+
+// Registry holds the settings applied to the pulls from an OCI registry.
+type Registry struct {
+	// Host is the registry host, with its port if any, like
+	// registry.example.com:5000
+	Host string `yaml:"Host"`
+	// Insecure disables TLS verification and allows plain HTTP for
+	// the pulls from this registry only
+	Insecure bool `yaml:"Insecure"`
+	System   bool `yaml:"System,omitempty"` // Was this registry set from system config file
+}
+
+// Validate returns an error if the registry settings are invalid.
+func (r *Registry) Validate() error {
+	if r.Host == "" {
+		return fmt.Errorf("registry with no host")
+	}
+	if strings.ContainsAny(r.Host, "/ ") {
+		return fmt.Errorf("registry host %q must not contain a scheme or a path", r.Host)
+	}
+	return nil
+}
+
+// InsecureRegistries returns the hosts of the registries marked as
+// insecure.
+func (c *Config) InsecureRegistries() []string {
+	var hosts []string
+	for _, r := range c.Registries {
+		if r.Insecure {
+			hosts = append(hosts, r.Host)
+		}
+	}
+	return hosts
+}
+
+// InsecureRegistry returns if the registry of the docker reference ref,
+// with or without its docker:// prefix, is one of the hosts.
+func InsecureRegistry(hosts []string, ref string) bool {
+	if len(hosts) == 0 {
+		return false
+	}
+	ref = strings.TrimPrefix(strings.TrimPrefix(ref, "docker:"), "//")
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return false
+	}
+	domain := reference.Domain(named)
+	for _, h := range hosts {
+		if strings.EqualFold(h, domain) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package remote
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRegistryValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		registry Registry
+		wantErr  bool
+	}{
+		{
+			name:     "Host",
+			registry: Registry{Host: "registry.example.com", Insecure: true},
+		},
+		{
+			name:     "HostPort",
+			registry: Registry{Host: "localhost:5000", Insecure: true},
+		},
+		{
+			name:     "NoHost",
+			registry: Registry{Insecure: true},
+			wantErr:  true,
+		},
+		{
+			name:     "Scheme",
+			registry: Registry{Host: "http://registry.example.com", Insecure: true},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.registry.Validate()
+			if tt.wantErr && err == nil {
+				t.Errorf("unexpected success")
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestInsecureRegistries(t *testing.T) {
+	c := &Config{
+		Registries: []*Registry{
+			{Host: "localhost:5000", Insecure: true},
+			{Host: "registry.example.com"},
+			{Host: "insecure.example.com", Insecure: true},
+		},
+	}
+	want := []string{"localhost:5000", "insecure.example.com"}
+	if got := c.InsecureRegistries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got insecure registries %v, want %v", got, want)
+	}
+}
+
+func TestInsecureRegistry(t *testing.T) {
+	hosts := []string{"localhost:5000", "Registry.example.com", "docker.io"}
+
+	tests := []struct {
+		name  string
+		hosts []string
+		ref   string
+		want  bool
+	}{
+		{
+			name:  "NoHosts",
+			hosts: nil,
+			ref:   "docker://localhost:5000/alpine",
+			want:  false,
+		},
+		{
+			name:  "Port",
+			hosts: hosts,
+			ref:   "docker://localhost:5000/alpine",
+			want:  true,
+		},
+		{
+			name:  "OtherPort",
+			hosts: hosts,
+			ref:   "docker://localhost:5001/alpine",
+			want:  false,
+		},
+		{
+			name:  "NoTransport",
+			hosts: hosts,
+			ref:   "//registry.example.com/sylabs/alpine:3.12",
+			want:  true,
+		},
+		{
+			name:  "Normalized",
+			hosts: hosts,
+			ref:   "docker://alpine",
+			want:  true,
+		},
+		{
+			name:  "Secure",
+			hosts: hosts,
+			ref:   "docker://quay.io/sylabs/alpine",
+			want:  false,
+		},
+		{
+			name:  "Invalid",
+			hosts: hosts,
+			ref:   "docker://Invalid Reference",
+			want:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := InsecureRegistry(tt.hosts, tt.ref); got != tt.want {
+				t.Errorf("got %v for %s, want %v", got, tt.ref, tt.want)
+			}
+		})
+	}
+}
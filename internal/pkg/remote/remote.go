@@ -51,6 +51,9 @@ type Config struct {
 	DefaultRemote string                      `yaml:"Active"`
 	Remotes       map[string]*endpoint.Config `yaml:"Remotes"`
 	Credentials   []*credential.Config        `yaml:"Credentials,omitempty"`
+	Mirrors       Mirrors                     `yaml:"Mirrors,omitempty"`
+	Registries    []*Registry                 `yaml:"Registries,omitempty"`
+	Buckets       []*Bucket                   `yaml:"Buckets,omitempty"`
 
 	// set to true when this is the system configuration
 	system bool
@@ -82,6 +85,21 @@ func ReadFrom(r io.Reader) (*Config, error) {
 			return nil, fmt.Errorf("failed to decode YAML data from io.Reader: %s", err)
 		}
 	}
+	for _, m := range c.Mirrors {
+		if err := m.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	for _, r := range c.Registries {
+		if err := r.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	for _, b := range c.Buckets {
+		if err := b.Validate(); err != nil {
+			return nil, err
+		}
+	}
 	return c, nil
 }
 
@@ -135,6 +153,68 @@ func (c *Config) SyncFrom(sys *Config) error {
 		}
 	}
 
+	// system mirror rules come first and replace the ones previously
+	// synced
+	mirrors := make([]*Mirror, 0, len(sys.Mirrors)+len(c.Mirrors))
+	for _, m := range sys.Mirrors {
+		mSys := *m
+		mSys.System = true
+		mirrors = append(mirrors, &mSys)
+	}
+	for _, m := range c.Mirrors {
+		if !m.System {
+			mirrors = append(mirrors, m)
+		}
+	}
+	if len(mirrors) > 0 {
+		c.Mirrors = mirrors
+	} else {
+		c.Mirrors = nil
+	}
+
+	// system registry settings take precedence over the user ones for
+	// the same host and replace the ones previously synced
+	registries := make([]*Registry, 0, len(sys.Registries)+len(c.Registries))
+	sysHosts := make(map[string]bool)
+	for _, r := range sys.Registries {
+		rSys := *r
+		rSys.System = true
+		registries = append(registries, &rSys)
+		sysHosts[r.Host] = true
+	}
+	for _, r := range c.Registries {
+		if !r.System && !sysHosts[r.Host] {
+			registries = append(registries, r)
+		}
+	}
+	if len(registries) > 0 {
+		c.Registries = registries
+	} else {
+		c.Registries = nil
+	}
+
+	// system bucket settings take precedence over the user ones for the
+	// same bucket and replace the ones previously synced
+	type bucketID struct{ scheme, name string }
+	buckets := make([]*Bucket, 0, len(sys.Buckets)+len(c.Buckets))
+	sysBuckets := make(map[bucketID]bool)
+	for _, b := range sys.Buckets {
+		bSys := *b
+		bSys.System = true
+		buckets = append(buckets, &bSys)
+		sysBuckets[bucketID{b.Scheme, b.Bucket}] = true
+	}
+	for _, b := range c.Buckets {
+		if !b.System && !sysBuckets[bucketID{b.Scheme, b.Bucket}] {
+			buckets = append(buckets, b)
+		}
+	}
+	if len(buckets) > 0 {
+		c.Buckets = buckets
+	} else {
+		c.Buckets = nil
+	}
+
 	// set system default to user default if no user default specified
 	if c.DefaultRemote == "" && sys.DefaultRemote != "" {
 		c.DefaultRemote = sys.DefaultRemote
@@ -12,6 +12,7 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/sylabs/singularity/internal/pkg/client/bucket"
 	"github.com/sylabs/singularity/internal/pkg/remote/endpoint"
 	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
 	yaml "gopkg.in/yaml.v2"
@@ -329,6 +330,74 @@ func TestSyncFrom(t *testing.T) {
 					},
 				},
 			},
+		}, {
+			name: "sys config mirrors",
+			sys: Config{
+				Remotes: map[string]*endpoint.Config{},
+				Mirrors: []*Mirror{
+					{Transport: MirrorDocker, Prefix: "docker.io/", Mirror: "mirror.example.com/"},
+				},
+			},
+			usr: Config{
+				Remotes: map[string]*endpoint.Config{},
+				Mirrors: []*Mirror{
+					{Transport: MirrorDocker, Prefix: "docker.io/", Mirror: "old.example.com/", System: true},
+					{Transport: MirrorDocker, Prefix: "quay.io/", Mirror: "quay.example.com/"},
+				},
+			},
+			res: Config{
+				Remotes: map[string]*endpoint.Config{},
+				Mirrors: []*Mirror{
+					{Transport: MirrorDocker, Prefix: "docker.io/", Mirror: "mirror.example.com/", System: true},
+					{Transport: MirrorDocker, Prefix: "quay.io/", Mirror: "quay.example.com/"},
+				},
+			},
+		}, {
+			name: "sys config registries",
+			sys: Config{
+				Remotes: map[string]*endpoint.Config{},
+				Registries: []*Registry{
+					{Host: "registry.example.com", Insecure: true},
+				},
+			},
+			usr: Config{
+				Remotes: map[string]*endpoint.Config{},
+				Registries: []*Registry{
+					{Host: "old.example.com", Insecure: true, System: true},
+					{Host: "registry.example.com"},
+					{Host: "localhost:5000", Insecure: true},
+				},
+			},
+			res: Config{
+				Remotes: map[string]*endpoint.Config{},
+				Registries: []*Registry{
+					{Host: "registry.example.com", Insecure: true, System: true},
+					{Host: "localhost:5000", Insecure: true},
+				},
+			},
+		}, {
+			name: "sys config buckets",
+			sys: Config{
+				Remotes: map[string]*endpoint.Config{},
+				Buckets: []*Bucket{
+					{Config: bucket.Config{Scheme: bucket.S3, Endpoint: "https://minio.example.com"}},
+				},
+			},
+			usr: Config{
+				Remotes: map[string]*endpoint.Config{},
+				Buckets: []*Bucket{
+					{Config: bucket.Config{Scheme: bucket.GS, Bucket: "old"}, System: true},
+					{Config: bucket.Config{Scheme: bucket.S3, Region: "eu-west-1"}},
+					{Config: bucket.Config{Scheme: bucket.S3, Bucket: "images", CredentialsFile: "/tmp/credentials"}},
+				},
+			},
+			res: Config{
+				Remotes: map[string]*endpoint.Config{},
+				Buckets: []*Bucket{
+					{Config: bucket.Config{Scheme: bucket.S3, Endpoint: "https://minio.example.com"}, System: true},
+					{Config: bucket.Config{Scheme: bucket.S3, Bucket: "images", CredentialsFile: "/tmp/credentials"}},
+				},
+			},
 		},
 	}
 
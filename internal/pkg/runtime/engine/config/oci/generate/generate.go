@@ -29,7 +29,6 @@ import (
 
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sylabs/singularity/pkg/util/capabilities"
-	"golang.org/x/sys/unix"
 )
 
 // Generator represents a generator for a OCI runtime config.
@@ -305,7 +304,7 @@ func (g *Generator) Save(w io.Writer) (err error) {
 
 // SaveToFile writes the configuration into a file.
 func (g *Generator) SaveToFile(path string) error {
-	flags := os.O_RDWR | os.O_CREATE | os.O_TRUNC | unix.O_NOFOLLOW
+	flags := os.O_RDWR | os.O_CREATE | os.O_TRUNC | openNoFollow
 
 	f, err := os.OpenFile(path, flags, 0600)
 	if err != nil {
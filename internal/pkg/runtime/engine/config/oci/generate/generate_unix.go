@@ -0,0 +1,13 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !windows
+
+package generate
+
+import "golang.org/x/sys/unix"
+
+// openNoFollow prevents SaveToFile from following a symbolic link.
+const openNoFollow = unix.O_NOFOLLOW
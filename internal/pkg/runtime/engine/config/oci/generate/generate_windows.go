@@ -0,0 +1,9 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package generate
+
+// openNoFollow has no equivalent on this platform.
+const openNoFollow = 0
@@ -26,6 +26,7 @@ import (
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sylabs/singularity/pkg/sylog"
 	"github.com/sylabs/singularity/pkg/util/capabilities"
+	"github.com/sylabs/singularity/pkg/util/rlimit"
 )
 
 const searchPath = "/usr/bin:/usr/sbin:/bin:/sbin:/usr/local/bin:/usr/local/sbin"
@@ -443,6 +444,25 @@ func (c *Config) SetTargetGID(gids []int) {
 	}
 }
 
+// SetRlimits sets the resource limits of the container process, applied
+// before dropping privileges so hard limits can be raised.
+func (c *Config) SetRlimits(limits []rlimit.Limit) error {
+	if len(limits) > C.MAX_RLIMITS {
+		return fmt.Errorf("you can't set more than %d resource limits", C.MAX_RLIMITS)
+	}
+	for i, l := range limits {
+		res, err := rlimit.Resource(l.Resource)
+		if err != nil {
+			return err
+		}
+		c.config.container.privileges.rlimits[i].resource = C.int(res)
+		c.config.container.privileges.rlimits[i].soft = C.ulonglong(l.Soft)
+		c.config.container.privileges.rlimits[i].hard = C.ulonglong(l.Hard)
+	}
+	c.config.container.privileges.numRlimits = C.int(len(limits))
+	return nil
+}
+
 // Release performs an unmap of a shared starter config and releases the mapped memory.
 // This method should be called as soon as the process doesn't need to access or modify
 // the underlying starter configuration. Attempt to modify the underlying config after
@@ -0,0 +1,145 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/sylabs/singularity/internal/pkg/util/env"
+	"github.com/sylabs/singularity/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+// scifDataDir is the directory holding the SCIF application data
+// directories in the container.
+const scifDataDir = "/scif/data"
+
+// ext2 superblock location and the offsets of the fields read from it,
+// see the kernel fs/ext2/ext2.h.
+const (
+	extSuperblockOffset = 1024
+	extSuperblockSize   = 1024
+	extFreeBlocksOffset = 12
+	extFreeInodesOffset = 16
+	extMagicFieldOffset = 56
+	extSuperMagic       = 0xEF53
+)
+
+// appDataImageSlack is the number of free blocks which can remain in
+// a full application data image: a write needs up to three indirect
+// blocks along with the data block and fails if they can't all be
+// allocated.
+const appDataImageSlack = 4
+
+// appDataQuota returns the size limit in MiB of the application data
+// directory backed by a disk image, 0 if there is none. With a writable
+// container root filesystem the data directory is stored in it and the
+// limit is ignored.
+func (e *EngineOperations) appDataQuota() int {
+	cfg := e.EngineConfig
+	if cfg.GetAppName() == "" || cfg.GetScifData() != "" {
+		return 0
+	}
+	if cfg.GetWritableImage() || cfg.GetWritableTmpfs() || len(cfg.GetOverlayImage()) > 0 {
+		return 0
+	}
+	return cfg.GetScifDataQuota()
+}
+
+// mkfsExt2 returns the path of the mkfs.ext2 program, searched in the
+// default PATH as the user environment isn't trusted.
+func mkfsExt2() (string, error) {
+	for _, dir := range filepath.SplitList(env.DefaultPath) {
+		path := filepath.Join(dir, "mkfs.ext2")
+		if fi, err := os.Stat(path); err == nil && fi.Mode().IsRegular() && fi.Mode()&0111 != 0 {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("mkfs.ext2 not found in %s", env.DefaultPath)
+}
+
+// createAppDataImage creates an ext2 filesystem image of size MiB in the
+// directory dir, its root directory owned by uid and gid, and returns its
+// file descriptor. The image file is removed right away, it only lives
+// through the returned file descriptor and its space is released once
+// the container exits.
+func createAppDataImage(dir string, size int, uid, gid int) (int, error) {
+	mkfs, err := mkfsExt2()
+	if err != nil {
+		return -1, err
+	}
+
+	f, err := ioutil.TempFile(dir, "singularity-appdata-")
+	if err != nil {
+		return -1, err
+	}
+	defer f.Close()
+
+	if err := os.Remove(f.Name()); err != nil {
+		return -1, err
+	}
+	// a sparse file, blocks are only allocated when written
+	if err := f.Truncate(int64(size) << 20); err != nil {
+		return -1, fmt.Errorf("could not set image size to %d MiB: %s", size, err)
+	}
+
+	// no blocks are reserved for root, the whole image is available
+	// to the application
+	cmd := exec.Command(mkfs, "-q", "-F", "-m", "0", "-E", fmt.Sprintf("root_owner=%d:%d", uid, gid), "/proc/self/fd/3")
+	cmd.ExtraFiles = []*os.File{f}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return -1, fmt.Errorf("%s failed: %s: %s", mkfs, err, out)
+	}
+
+	// the returned file descriptor isn't closed by the garbage collector
+	return unix.Dup(int(f.Fd()))
+}
+
+// appDataImageFull returns if the ext2 filesystem of the application data
+// image f is full, from the free block and inode counts of its superblock.
+func appDataImageFull(f *os.File) (bool, error) {
+	sb := make([]byte, extSuperblockSize)
+	if _, err := f.ReadAt(sb, extSuperblockOffset); err != nil {
+		return false, fmt.Errorf("could not read superblock: %s", err)
+	}
+	if binary.LittleEndian.Uint16(sb[extMagicFieldOffset:]) != extSuperMagic {
+		return false, fmt.Errorf("bad superblock magic")
+	}
+	freeBlocks := binary.LittleEndian.Uint32(sb[extFreeBlocksOffset:])
+	freeInodes := binary.LittleEndian.Uint32(sb[extFreeInodesOffset:])
+	return freeBlocks <= appDataImageSlack || freeInodes == 0, nil
+}
+
+// reportAppDataQuota reports when the application data directory limited
+// with --scif-data-quota is full at container exit, as the application
+// only gets ENOSPC errors for the writes beyond the limit. The filesystem
+// is unmounted by then, its superblock is up to date.
+func (e *EngineOperations) reportAppDataQuota() {
+	fd := e.EngineConfig.GetScifDataImageFd()
+	if fd <= 0 {
+		return
+	}
+	f := os.NewFile(uintptr(fd), "application data image")
+	defer f.Close()
+
+	full, err := appDataImageFull(f)
+	if err != nil {
+		sylog.Debugf("Could not check application data image usage: %s", err)
+		return
+	}
+	if full {
+		dest := filepath.Join(scifDataDir, filepath.Clean("/"+e.EngineConfig.GetAppName()))
+		sylog.Warningf(
+			"Application data directory %s reached its --scif-data-quota of %d MiB, writes beyond it fail with ENOSPC (No space left on device)",
+			dest, e.EngineConfig.GetScifDataQuota(),
+		)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestCreateAppDataImage(t *testing.T) {
+	if _, err := mkfsExt2(); err != nil {
+		t.Skip(err)
+	}
+
+	dir, err := ioutil.TempDir("", "appdata-")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fd, err := createAppDataImage(dir, 1, os.Getuid(), os.Getgid())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f := os.NewFile(uintptr(fd), "image")
+	defer f.Close()
+
+	if fi, err := ioutil.ReadDir(dir); err != nil || len(fi) > 0 {
+		t.Errorf("image file not removed from %s: %v", dir, err)
+	}
+	if fi, err := f.Stat(); err != nil || fi.Size() != 1<<20 {
+		t.Errorf("unexpected image size: %v", err)
+	}
+
+	if full, err := appDataImageFull(f); err != nil || full {
+		t.Errorf("got full %v (%v) for a new image, want not full", full, err)
+	}
+
+	// no free block left
+	b := make([]byte, 4)
+	if _, err := f.WriteAt(b, extSuperblockOffset+extFreeBlocksOffset); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if full, err := appDataImageFull(f); err != nil || !full {
+		t.Errorf("got full %v (%v) without free blocks, want full", full, err)
+	}
+
+	// bad magic
+	binary.LittleEndian.PutUint16(b, 0)
+	if _, err := f.WriteAt(b[:2], extSuperblockOffset+extMagicFieldOffset); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := appDataImageFull(f); err == nil {
+		t.Errorf("unexpected success with a bad superblock")
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/util/fs/proc"
+)
+
+const (
+	// autofsTimeout is the time spent waiting for an automounted
+	// directory which doesn't exist yet.
+	autofsTimeout = 2 * time.Second
+	// autofsInterval is the interval between two checks of an
+	// automounted directory.
+	autofsInterval = 100 * time.Millisecond
+)
+
+// getAutofsPoints returns the autofs mount points found in the
+// mount table of the current process.
+func getAutofsPoints() ([]string, error) {
+	const mountInfoPath = "/proc/self/mountinfo"
+
+	entries, err := proc.GetMountInfoEntry(mountInfoPath)
+	if err != nil {
+		return nil, fmt.Errorf("while parsing %s: %s", mountInfoPath, err)
+	}
+	autoFsPoints := make([]string, 0)
+	for _, e := range entries {
+		if e.FSType == "autofs" {
+			sylog.Debugf("Found %q as autofs mount point", e.Point)
+			autoFsPoints = append(autoFsPoints, e.Point)
+		}
+	}
+	return autoFsPoints, nil
+}
+
+// triggerAutofs triggers the mount of the directory path if it's located
+// under one of the autofs mount points. As sites using autofs may mount
+// a directory like a home directory a short time after its first access,
+// the directory is checked again until it appears or autofsTimeout
+// expires. It returns false if the directory doesn't exist, other errors
+// are left to the caller accessing the directory.
+func triggerAutofs(path string, autoFsPoints []string) bool {
+	path = filepath.Clean(path)
+
+	for _, p := range autoFsPoints {
+		if path != p && !strings.HasPrefix(path, strings.TrimSuffix(p, "/")+"/") {
+			continue
+		}
+		sylog.Debugf("Triggering autofs mount of %s", path)
+		exist, err := fs.WaitPath(path, autofsTimeout, autofsInterval)
+		if err != nil {
+			sylog.Debugf("While waiting for %s: %s", path, err)
+			return true
+		} else if !exist {
+			sylog.Debugf("%s not mounted after %s", path, autofsTimeout)
+		}
+		return exist
+	}
+
+	exist, err := fs.PathExists(path)
+	return exist || err != nil
+}
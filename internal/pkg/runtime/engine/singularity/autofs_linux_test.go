@@ -0,0 +1,57 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTriggerAutofs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "autofs-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// dir plays the role of an autofs mount point like /home
+	points := []string{dir}
+
+	// simulate a home directory automounted after a short delay
+	home := filepath.Join(dir, "user")
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		os.Mkdir(home, 0755)
+	}()
+	if !triggerAutofs(home, points) {
+		t.Errorf("delayed home directory %s not found", home)
+	}
+
+	// a missing home directory is waited for up to autofsTimeout
+	start := time.Now()
+	if triggerAutofs(filepath.Join(dir, "missing"), points) {
+		t.Errorf("missing home directory reported as existing")
+	}
+	if elapsed := time.Since(start); elapsed < autofsTimeout-autofsInterval {
+		t.Errorf("waited %s for a missing home directory, want %s", elapsed, autofsTimeout)
+	}
+
+	// outside of autofs mount points a missing directory is not waited for
+	start = time.Now()
+	if triggerAutofs(filepath.Join(dir, "missing"), nil) {
+		t.Errorf("missing home directory reported as existing")
+	}
+	if elapsed := time.Since(start); elapsed >= autofsInterval {
+		t.Errorf("waited %s for a directory outside of autofs mount points", elapsed)
+	}
+	// a sibling of the mount point is not located under it
+	if triggerAutofs(dir+"-other", points) {
+		t.Errorf("missing directory reported as existing")
+	}
+}
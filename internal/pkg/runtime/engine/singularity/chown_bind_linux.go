@@ -0,0 +1,169 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sylabs/singularity/internal/pkg/util/fs/mount"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// copyChown copies the file or directory tree src to dst, which must not
+// exist, and gives the copies the owner uid:gid with lchown. Permissions
+// are kept without the setuid, setgid and sticky bits, devices, fifos and
+// sockets are skipped.
+func copyChown(src, dst string, uid, gid int, lchown func(string, int, int) error) error {
+	type entry struct {
+		path string
+		mode os.FileMode
+	}
+	var entries []entry
+
+	err := filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch mode := fi.Mode(); {
+		case mode.IsDir():
+			// the permissions are set once the directory content
+			// is copied, read-only directories can be filled
+			if err := os.Mkdir(target, 0700); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			if err := copyFile(path, target); err != nil {
+				return err
+			}
+		case mode&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(link, target); err != nil {
+				return err
+			}
+		default:
+			sylog.Warningf("Skipping %s: only directories, regular files and symbolic links are copied for the chown bind option", path)
+			return nil
+		}
+		entries = append(entries, entry{target, fi.Mode()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// children first, the owner is changed once the permissions are set,
+	// the new owner may not allow the current user to set them
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.mode&os.ModeSymlink == 0 {
+			if err := os.Chmod(e.path, e.mode.Perm()); err != nil {
+				return err
+			}
+		}
+		if err := lchown(e.path, uid, gid); err != nil {
+			return fmt.Errorf("could not change owner of %s to %d:%d: %s", e.path, uid, gid, err)
+		}
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// checkChownIDs returns an error if the owner uid:gid can't be requested
+// by the caller with the user ID callerUID and the group IDs callerGIDs.
+// The copy owner is changed by the privileged RPC server in the setuid
+// workflow, so root is the only caller allowed to give any owner. In a
+// user namespace, the IDs must be mapped by the container mappings,
+// otherwise a user can only give its own user ID and one of its groups.
+func checkChownIDs(uid, gid, callerUID int, callerGIDs []int, userNS bool, linux *specs.Linux) error {
+	if callerUID == 0 && !userNS {
+		return nil
+	}
+	if userNS && linux != nil && len(linux.UIDMappings) > 0 {
+		if !isMappedID(uint32(uid), linux.UIDMappings, true) {
+			return fmt.Errorf("user ID %d is not mapped in the container user namespace", uid)
+		}
+		if !isMappedID(uint32(gid), linux.GIDMappings, true) {
+			return fmt.Errorf("group ID %d is not mapped in the container user namespace", gid)
+		}
+		return nil
+	}
+	if uid != callerUID {
+		return fmt.Errorf("user ID %d is not your user ID %d", uid, callerUID)
+	}
+	for _, g := range callerGIDs {
+		if g == gid {
+			return nil
+		}
+	}
+	return fmt.Errorf("group ID %d is not one of your groups", gid)
+}
+
+// addChownShadow registers the copy of the bind source src owned by
+// uid:gid in the session directory, made just before the user binds are
+// mounted, and returns its path, the bind mounts the copy instead of src
+// so the host files are left untouched. The owner is changed through RPC,
+// as it requires privileges in the setuid workflow.
+func (c *container) addChownShadow(system *mount.System, src string, uid, gid int) (string, error) {
+	gids, err := os.Getgroups()
+	if err != nil {
+		return "", fmt.Errorf("could not get groups: %s", err)
+	}
+	gids = append(gids, os.Getgid())
+	if err := checkChownIDs(uid, gid, os.Getuid(), gids, c.userNS, c.engine.EngineConfig.OciConfig.Linux); err != nil {
+		return "", fmt.Errorf("chown=%d:%d not allowed: %s", uid, gid, err)
+	}
+
+	c.chownShadows++
+	dir := fmt.Sprintf("/chown/%d", c.chownShadows)
+	if err := c.session.AddDir(dir); err != nil {
+		return "", err
+	}
+	path, _ := c.session.GetPath(dir)
+	shadow := filepath.Join(path, filepath.Base(src))
+
+	err = system.RunBeforeTag(mount.UserbindsTag, func(*mount.System) error {
+		sylog.Debugf("Copying %s to %s owned by %d:%d", src, shadow, uid, gid)
+		err := copyChown(src, shadow, uid, gid, c.rpcOps.Lchown)
+		if err != nil && c.sessionSize > 0 && sessionDiskDir == "" && sessionFull(path, err) {
+			sylog.Debugf("Session directory full: %s", err)
+			return fmt.Errorf("%s doesn't fit in the session directory for the chown bind option, its size is limited to %dMiB by 'sessiondir max size' in singularity.conf", src, c.sessionSize)
+		} else if err != nil {
+			return fmt.Errorf("while copying %s for the chown bind option: %s", src, err)
+		}
+		return nil
+	})
+	return shadow, err
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestCopyChown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chown-bind-")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(filepath.Join(src, "ro"), 0755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "ro", "file"), []byte("data"), 0640); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "tool"), nil, 0755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.Chmod(filepath.Join(src, "tool"), 0755|os.ModeSetuid); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.Symlink("ro/file", filepath.Join(src, "link")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.Chmod(filepath.Join(src, "ro"), 0555); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.Chmod(filepath.Join(src, "ro"), 0755)
+
+	dst := filepath.Join(dir, "dst")
+	var chowned []string
+	lchown := func(path string, uid, gid int) error {
+		if uid != 1001 || gid != 1002 {
+			t.Errorf("%s owner changed to %d:%d instead of 1001:1002", path, uid, gid)
+		}
+		chowned = append(chowned, path)
+		return nil
+	}
+	if err := copyChown(src, dst, 1001, 1002, lchown); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.Chmod(filepath.Join(dst, "ro"), 0755)
+
+	for _, f := range []struct {
+		path string
+		mode os.FileMode
+	}{
+		{"", 0755 | os.ModeDir},
+		{"ro", 0555 | os.ModeDir},
+		{"ro/file", 0640},
+		{"tool", 0755},
+	} {
+		fi, err := os.Lstat(filepath.Join(dst, f.path))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if fi.Mode() != f.mode {
+			t.Errorf("%s copied with mode %s instead of %s", f.path, fi.Mode(), f.mode)
+		}
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dst, "ro", "file")); err != nil || string(b) != "data" {
+		t.Errorf("got file content %q (%v), want %q", b, err, "data")
+	}
+	if target, err := os.Readlink(filepath.Join(dst, "link")); err != nil || target != "ro/file" {
+		t.Errorf("got symbolic link to %q (%v), want ro/file", target, err)
+	}
+
+	want := []string{dst, filepath.Join(dst, "link"), filepath.Join(dst, "ro"), filepath.Join(dst, "ro", "file"), filepath.Join(dst, "tool")}
+	sort.Strings(chowned)
+	if len(chowned) != len(want) {
+		t.Fatalf("owner changed for %v, want %v", chowned, want)
+	}
+	for i := range want {
+		if chowned[i] != want[i] {
+			t.Errorf("owner changed for %v, want %v", chowned, want)
+			break
+		}
+	}
+
+	// the source is left untouched
+	if fi, err := os.Stat(filepath.Join(src, "tool")); err != nil || fi.Mode() != 0755|os.ModeSetuid {
+		t.Errorf("source mode changed: %v %v", fi, err)
+	}
+
+	// the destination must not exist
+	if err := copyChown(src, dst, 1001, 1002, lchown); err == nil {
+		t.Errorf("unexpected success with an existing destination")
+	}
+}
+
+func TestCheckChownIDs(t *testing.T) {
+	linux := &specs.Linux{
+		UIDMappings: []specs.LinuxIDMapping{{ContainerID: 0, HostID: 1000, Size: 1}, {ContainerID: 1, HostID: 100000, Size: 65536}},
+		GIDMappings: []specs.LinuxIDMapping{{ContainerID: 0, HostID: 1000, Size: 1}, {ContainerID: 1, HostID: 100000, Size: 65536}},
+	}
+
+	tests := []struct {
+		name      string
+		uid       int
+		gid       int
+		callerUID int
+		userNS    bool
+		linux     *specs.Linux
+		wantErr   bool
+	}{
+		{name: "Root", uid: 0, gid: 0, callerUID: 0},
+		{name: "RootOtherUser", uid: 1001, gid: 1001, callerUID: 0},
+		{name: "UserOwnIDs", uid: 1000, gid: 1000, callerUID: 1000},
+		{name: "UserSupplementaryGroup", uid: 1000, gid: 50, callerUID: 1000},
+		{name: "UserRoot", uid: 0, gid: 0, callerUID: 1000, wantErr: true},
+		{name: "UserOtherUser", uid: 1001, gid: 1000, callerUID: 1000, wantErr: true},
+		{name: "UserOtherGroup", uid: 1000, gid: 1001, callerUID: 1000, wantErr: true},
+		{name: "UserNamespaceMapped", uid: 1001, gid: 1001, callerUID: 0, userNS: true, linux: linux},
+		{name: "UserNamespaceUnmappedUser", uid: 65537, gid: 0, callerUID: 0, userNS: true, linux: linux, wantErr: true},
+		{name: "UserNamespaceUnmappedGroup", uid: 0, gid: 65537, callerUID: 0, userNS: true, linux: linux, wantErr: true},
+		{name: "UserNamespaceWithoutMappings", uid: 0, gid: 0, callerUID: 1000, userNS: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkChownIDs(tt.uid, tt.gid, tt.callerUID, []int{1000, 50}, tt.userNS, tt.linux)
+			if tt.wantErr && err == nil {
+				t.Errorf("unexpected success for %d:%d", tt.uid, tt.gid)
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error for %d:%d: %s", tt.uid, tt.gid, err)
+			}
+		})
+	}
+}
@@ -36,6 +36,9 @@ import (
 // https://github.com/opencontainers/runtime-spec/blob/master/runtime.md#lifecycle.
 // CleanupContainer is performing step 8/9 here.
 func (e *EngineOperations) CleanupContainer(ctx context.Context, fatal error, status syscall.WaitStatus) error {
+	e.sendStopEvent(status)
+	e.reportAppDataQuota()
+
 	// firstly stop all fuse drivers before any image removal
 	// by image driver interruption or image cleanup for hybrid
 	// fakeroot workflow
@@ -71,6 +74,12 @@ func (e *EngineOperations) CleanupContainer(ctx context.Context, fatal error, st
 		}
 	}
 
+	removePidFile()
+
+	if err := removeSessionDiskDir(); err != nil {
+		sylog.Errorf("failed to delete session directory %s: %s", sessionDiskDir, err)
+	}
+
 	if networkSetup != nil {
 		if e.EngineConfig.GetFakeroot() {
 			priv.Escalate()
@@ -95,6 +104,10 @@ func (e *EngineOperations) CleanupContainer(ctx context.Context, fatal error, st
 		}
 	}
 
+	if err := e.runPoststopHostHook(ctx, status); err != nil {
+		sylog.Errorf("%s", err)
+	}
+
 	if e.EngineConfig.GetInstance() {
 		file, err := instance.Get(e.CommonConfig.ContainerID, instance.SingSubDir)
 		if err != nil {
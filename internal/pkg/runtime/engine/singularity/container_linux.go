@@ -7,6 +7,7 @@ package singularity
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -15,11 +16,14 @@ import (
 	"strings"
 	"syscall"
 
+	"github.com/containernetworking/cni/libcni"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sylabs/singularity/internal/pkg/buildcfg"
 	"github.com/sylabs/singularity/internal/pkg/cgroups"
 	"github.com/sylabs/singularity/internal/pkg/plugin"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engine/singularity/rpc/client"
+	"github.com/sylabs/singularity/internal/pkg/security"
+	"github.com/sylabs/singularity/internal/pkg/util/bindprofile"
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
 	"github.com/sylabs/singularity/internal/pkg/util/fs/files"
 	"github.com/sylabs/singularity/internal/pkg/util/fs/layout"
@@ -81,11 +85,17 @@ type container struct {
 	skippedMount  []string
 	suidFlag      uintptr
 	devSourcePath string
+	// noFilecaps is set by the nofilecaps security feature, it keeps
+	// the nosuid flag on all mounts
+	noFilecaps bool
+	// chownShadows counts the copies made for the chown bind option
+	chownShadows int
+	// profileBinds are the binds of the bind profiles, mounted like the
+	// user binds but allowed whatever the user bind control setting
+	profileBinds []singularity.BindPath
 }
 
-func create(ctx context.Context, engine *EngineOperations, rpcOps *client.RPC, pid int) error {
-	var err error
-
+func create(ctx context.Context, engine *EngineOperations, rpcOps *client.RPC, pid int) (err error) {
 	if len(engine.EngineConfig.GetImageList()) == 0 {
 		return fmt.Errorf("no root filesystem image provided")
 	}
@@ -110,6 +120,12 @@ func create(ctx context.Context, engine *EngineOperations, rpcOps *client.RPC, p
 		mountInfoPath: fmt.Sprintf("/proc/%d/mountinfo", pid),
 		skippedMount:  make([]string, 0),
 		suidFlag:      syscall.MS_NOSUID,
+		noFilecaps:    security.HasFeature(engine.EngineConfig.GetSecurity(), "nofilecaps"),
+	}
+
+	c.profileBinds, err = loadProfileBinds(configurationFile, engine.EngineConfig)
+	if err != nil {
+		return err
 	}
 
 	cwd := engine.EngineConfig.GetCwd()
@@ -135,9 +151,17 @@ func create(ctx context.Context, engine *EngineOperations, rpcOps *client.RPC, p
 	}
 
 	if os.Geteuid() != 0 {
-		c.sessionSize = int(c.engine.EngineConfig.File.SessiondirMaxSize)
+		memoryHome := engine.EngineConfig.GetContain() && !engine.EngineConfig.GetCustomHome() && engine.EngineConfig.File.MountHome
+		c.sessionSize = sessionSize(engine.EngineConfig.File.SessiondirMaxSize, engine.EngineConfig.GetWritableTmpfs(), memoryHome)
 	} else if engine.EngineConfig.GetAllowSUID() && !c.userNS {
-		c.suidFlag = 0
+		// the deny setuid binaries directive keeps the nosuid flag
+		// unless root overrides it, the nofilecaps security feature
+		// always keeps it
+		if c.noFilecaps {
+			sylog.Debugf("Ignoring setuid binaries, the container is mounted nosuid")
+		} else if !engine.EngineConfig.File.DenySetuidBinaries || engine.EngineConfig.GetOverrideSUIDPolicy() {
+			c.suidFlag = 0
+		}
 	}
 
 	// user namespace was not requested but we need to check
@@ -173,6 +197,15 @@ func create(ctx context.Context, engine *EngineOperations, rpcOps *client.RPC, p
 		return err
 	}
 
+	// report a full session directory instead of the error returned
+	// by the operation which ran out of space
+	defer func() {
+		if c.sessionSize > 0 && sessionDiskDir == "" && sessionFull(c.session.Path(), err) {
+			sylog.Debugf("Session directory full: %s", err)
+			err = fmt.Errorf("session directory full (size configured: %dMiB)", c.sessionSize)
+		}
+	}()
+
 	if err := c.setupImageDriver(system); err != nil {
 		return err
 	}
@@ -229,6 +262,9 @@ func create(ctx context.Context, engine *EngineOperations, rpcOps *client.RPC, p
 	if err := c.addScratchMount(system); err != nil {
 		return err
 	}
+	if err := c.addAppDataMount(system); err != nil {
+		return err
+	}
 	if err := c.addLibsMount(system); err != nil {
 		return err
 	}
@@ -259,13 +295,8 @@ func create(ctx context.Context, engine *EngineOperations, rpcOps *client.RPC, p
 	// chroot from RPC server current working directory since
 	// it's already in final directory after chdirFinal call
 	sylog.Debugf("Chroot into %s\n", c.session.FinalPath())
-	_, err = c.rpcOps.Chroot(".", "pivot")
-	if err != nil {
-		sylog.Debugf("Fallback to move/chroot")
-		_, err = c.rpcOps.Chroot(".", "move")
-		if err != nil {
-			return fmt.Errorf("chroot failed: %s", err)
-		}
+	if err := c.chroot(); err != nil {
+		return err
 	}
 
 	if networkSetup != nil {
@@ -274,15 +305,31 @@ func create(ctx context.Context, engine *EngineOperations, rpcOps *client.RPC, p
 		}
 	}
 
+	deviceRules, err := deviceCgroupRules(engine.EngineConfig.GetDevices())
+	if err != nil {
+		return err
+	}
+
 	if os.Geteuid() == 0 && !c.userNS {
 		path := engine.EngineConfig.GetCgroupsPath()
-		if path != "" {
+		if path != "" || len(deviceRules) > 0 {
+			var spec specs.LinuxResources
+			if path != "" {
+				spec, err = cgroups.ReadSpecFromFile(path)
+				if err != nil {
+					return fmt.Errorf("failed to read cgroups resources restriction: %s", err)
+				}
+			}
+			spec.Devices = append(spec.Devices, deviceRules...)
+
 			cgroupPath := filepath.Join("/singularity", strconv.Itoa(pid))
 			cgroupManager = &cgroups.Manager{Pid: pid, Path: cgroupPath}
-			if err := cgroupManager.ApplyFromFile(path); err != nil {
+			if err := cgroupManager.ApplyFromSpec(&spec); err != nil {
 				return fmt.Errorf("failed to apply cgroups resources restriction: %s", err)
 			}
 		}
+	} else if len(deviceRules) > 0 {
+		return fmt.Errorf("read-only devices require cgroups, which can't be applied in a user namespace")
 	}
 
 	sylog.Debugf("Chdir into / to avoid errors\n")
@@ -311,6 +358,17 @@ func (c *container) setupSessionLayout(system *mount.System) error {
 		return fmt.Errorf("failed to resolve session directory %s: %s", buildcfg.SESSIONDIR, err)
 	}
 
+	sessionDir := c.engine.EngineConfig.GetSessionDir()
+	if sessionDir == "" && c.engine.EngineConfig.File.SessiondirType == "disk" {
+		sessionDir = c.engine.EngineConfig.File.SessiondirPath
+	}
+	if sessionDir != "" {
+		if err := createSessionDiskDir(sessionDir); err != nil {
+			return err
+		}
+		sylog.Debugf("Storing session directory in %s", sessionDiskDir)
+	}
+
 	sessionLayer := c.engine.EngineConfig.GetSessionLayer()
 
 	sylog.Debugf("Using Layer system: %s\n", sessionLayer)
@@ -336,7 +394,7 @@ func (c *container) setupSessionLayout(system *mount.System) error {
 // setupOverlayLayout sets up the session with overlay filesystem
 func (c *container) setupOverlayLayout(system *mount.System, sessionPath string) (err error) {
 	sylog.Debugf("Creating overlay SESSIONDIR layout\n")
-	if c.session, err = layout.NewSession(sessionPath, c.sessionFsType, c.sessionSize, system, overlay.New()); err != nil {
+	if c.session, err = c.newSession(sessionPath, system, overlay.New()); err != nil {
 		return err
 	}
 	return c.addOverlayMount(system)
@@ -345,17 +403,32 @@ func (c *container) setupOverlayLayout(system *mount.System, sessionPath string)
 // setupUnderlayLayout sets up the session with underlay "filesystem"
 func (c *container) setupUnderlayLayout(system *mount.System, sessionPath string) (err error) {
 	sylog.Debugf("Creating underlay SESSIONDIR layout\n")
-	c.session, err = layout.NewSession(sessionPath, c.sessionFsType, c.sessionSize, system, underlay.New())
+	c.session, err = c.newSession(sessionPath, system, underlay.New())
 	return err
 }
 
 // setupDefaultLayout sets up the session without overlay or underlay
 func (c *container) setupDefaultLayout(system *mount.System, sessionPath string) (err error) {
 	sylog.Debugf("Creating default SESSIONDIR layout\n")
-	c.session, err = layout.NewSession(sessionPath, c.sessionFsType, c.sessionSize, system, nil)
+	c.session, err = c.newSession(sessionPath, system, nil)
 	return err
 }
 
+// sessionLayer is the layer added on top of the session layout.
+type sessionLayer interface {
+	Add(*layout.Session, *mount.System) error
+	Dir() string
+}
+
+// newSession returns the session directory layout manager, the session
+// directory is stored on disk in sessionDiskDir if set, in memory otherwise.
+func (c *container) newSession(sessionPath string, system *mount.System, layer sessionLayer) (*layout.Session, error) {
+	if sessionDiskDir != "" {
+		return layout.NewDiskSession(sessionPath, sessionDiskDir, system, layer)
+	}
+	return layout.NewSession(sessionPath, c.sessionFsType, c.sessionSize, system, layer)
+}
+
 // isLayerEnabled returns whether or not overlay or underlay system
 // is enabled
 func (c *container) isLayerEnabled() bool {
@@ -552,6 +625,9 @@ func (c *container) mountGeneric(mnt *mount.Point, tag mount.AuthorizedTag) (err
 	propagation := mount.HasPropagationFlag(flags)
 	source := mnt.Source
 	dest := ""
+	// root is set for destinations located in the container, which must
+	// not be mounted outside of the container root filesystem
+	root := ""
 
 	if bindMount {
 		if !remount {
@@ -580,8 +656,9 @@ func (c *container) mountGeneric(mnt *mount.Point, tag mount.AuthorizedTag) (err
 	}
 
 	if !strings.HasPrefix(mnt.Destination, sessionPath) {
-		dest = fs.EvalRelative(mnt.Destination, c.session.FinalPath())
-		dest = filepath.Join(c.session.FinalPath(), dest)
+		root = c.session.FinalPath()
+		dest = fs.EvalRelative(mnt.Destination, root)
+		dest = filepath.Join(root, dest)
 	} else {
 		dest = mnt.Destination
 	}
@@ -621,8 +698,24 @@ func (c *container) mountGeneric(mnt *mount.Point, tag mount.AuthorizedTag) (err
 		}
 	}
 
+	if bindMount && !remount && mount.HasIDMap(mnt.InternalOptions) {
+		err = c.mountIDMapped(root, source, dest, flags)
+		if err == nil {
+			return nil
+		} else if !mount.IDMapUnsupported(err) {
+			return fmt.Errorf("could not mount %s with ID mapping: %s", mnt.Source, err)
+		}
+		// the source filesystem doesn't support idmapped mounts
+		// or they require more privileges than the runtime has
+		sylog.Warningf("Could not mount %s with ID mapping: %s, it's bound without ID translation", mnt.Source, err)
+	}
+
 mount:
-	err = c.rpcOps.Mount(source, dest, mnt.Type, flags, optsString)
+	if root != "" {
+		err = c.rpcOps.MountInRoot(root, source, dest, mnt.Type, flags, optsString)
+	} else {
+		err = c.rpcOps.Mount(source, dest, mnt.Type, flags, optsString)
+	}
 	if os.IsNotExist(err) {
 		switch tag {
 		case mount.KernelTag,
@@ -677,6 +770,19 @@ mount:
 			}
 			return fmt.Errorf("could not remount %s: %s", mnt.Destination, err)
 		}
+		if errors.Is(err, syscall.ELOOP) {
+			// a component of the destination was replaced by a
+			// symbolic link after its resolution in the container
+			return fmt.Errorf("could not mount %s: %s contains a symbolic link which may point outside of the container", mnt.Source, mnt.Destination)
+		}
+		if err == syscall.ENOTDIR {
+			// the kernel allows to bind a file over an existing file or
+			// a directory over an existing directory, not a mix of both
+			return fmt.Errorf(
+				"could not mount %s to %s: a file can only be bound over a file and a directory over a directory",
+				mnt.Source, mnt.Destination,
+			)
+		}
 		return fmt.Errorf("could not mount %s: %s", mnt.Source, err)
 	}
 
@@ -818,6 +924,8 @@ func (c *container) addRootfsMount(system *mount.System) error {
 		mountType = "squashfs"
 	case image.EXT3:
 		mountType = "ext3"
+	case image.EXT4:
+		mountType = "ext4"
 	case image.ENCRYPTSQUASHFS:
 		mountType = "encryptfs"
 		key = c.engine.EngineConfig.GetEncryptionKey()
@@ -866,9 +974,13 @@ func (c *container) overlayUpperWork(system *mount.System) error {
 	createUpperWork := func(path, label string) error {
 		fi, err := c.rpcOps.Lstat(path)
 		if os.IsNotExist(err) {
-			if err := c.rpcOps.Mkdir(path, 0755); err != nil {
+			// the directory is created beneath its parent without
+			// following symbolic links from the overlay
+			if err := c.rpcOps.MkdirInRoot(filepath.Dir(path), filepath.Base(path), 0755, -1, -1); err != nil {
 				return fmt.Errorf("failed to create %s directory: %s", path, err)
 			}
+		} else if err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s overlay %s is a symbolic link, refusing to follow it", label, path)
 		} else if err == nil && !fi.IsDir() {
 			return fmt.Errorf("%s overlay %s must be a directory", label, path)
 		} else if err != nil {
@@ -949,7 +1061,7 @@ func (c *container) addOverlayMount(system *mount.System) error {
 			size := overlay.Size
 
 			switch overlay.Type {
-			case image.EXT3:
+			case image.EXT3, image.EXT4:
 				flags := uintptr(c.suidFlag | syscall.MS_NODEV)
 
 				if !img.Writable {
@@ -957,9 +1069,14 @@ func (c *container) addOverlayMount(system *mount.System) error {
 					ov.AddLowerDir(filepath.Join(dst, "upper"))
 				}
 
-				err = system.Points.AddImage(mount.PreLayerTag, src, dst, "ext3", flags, offset, size, nil)
+				fstype := "ext3"
+				if overlay.Type == image.EXT4 {
+					fstype = "ext4"
+				}
+
+				err = system.Points.AddImage(mount.PreLayerTag, src, dst, fstype, flags, offset, size, nil)
 				if err != nil {
-					return fmt.Errorf("while adding ext3 image: %s", err)
+					return fmt.Errorf("while adding %s image: %s", fstype, err)
 				}
 			case image.SQUASHFS:
 				flags := uintptr(c.suidFlag | syscall.MS_NODEV | syscall.MS_RDONLY)
@@ -1126,6 +1243,11 @@ func (c *container) addImageBindMount(system *mount.System) error {
 					flags |= syscall.MS_RDONLY
 				}
 				fstype = "ext3"
+			case image.EXT4:
+				if !img.Writable {
+					flags |= syscall.MS_RDONLY
+				}
+				fstype = "ext4"
 			case image.SQUASHFS:
 				flags |= syscall.MS_RDONLY
 				fstype = "squashfs"
@@ -1210,9 +1332,37 @@ func (c *container) addKernelMount(system *mount.System) error {
 	} else {
 		sylog.Verbosef("Skipping /sys mount")
 	}
+
+	if c.engine.EngineConfig.GetBindCgroups() {
+		if !c.engine.EngineConfig.File.MountSys {
+			return fmt.Errorf("--bind-cgroups requires 'mount sys' to be enabled in singularity.conf")
+		}
+		if !isCgroup2(cgroupRoot) {
+			return fmt.Errorf("--bind-cgroups requires the cgroup v2 unified hierarchy mounted at %s", cgroupRoot)
+		}
+		sylog.Debugf("Adding %s to mount list\n", cgroupRoot)
+		flags := uintptr(syscall.MS_BIND | syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC | syscall.MS_REC)
+		if err := system.Points.AddBind(mount.KernelTag, cgroupRoot, cgroupRoot, flags); err != nil {
+			return fmt.Errorf("unable to add %s to mount list: %s", cgroupRoot, err)
+		}
+		sylog.Verbosef("Default mount: %s:%s (read-write)", cgroupRoot, cgroupRoot)
+	}
 	return nil
 }
 
+// cgroupRoot is the mount point of the host cgroup hierarchy bound in the
+// container with --bind-cgroups.
+const cgroupRoot = "/sys/fs/cgroup"
+
+// isCgroup2 returns if path is the mount point of a cgroup v2 filesystem.
+func isCgroup2(path string) bool {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return false
+	}
+	return st.Type == unix.CGROUP2_SUPER_MAGIC
+}
+
 func (c *container) addSessionDevAt(srcpath string, atpath string, system *mount.System) error {
 	fi, err := os.Lstat(srcpath)
 	if err != nil {
@@ -1269,10 +1419,24 @@ func (c *container) addSessionDevMount(system *mount.System) error {
 	return nil
 }
 
+// stagedDev returns true if the container /dev is staged in the session
+// directory with only a minimal set of devices: with --contain, 'mount dev
+// = minimal' or with --nv restricted to MIG devices, as the other GPUs would
+// be available from the host /dev.
+func stagedDev(engineConfig *singularity.EngineConfig) bool {
+	switch {
+	case engineConfig.File.MountDev == "minimal" || engineConfig.GetContain():
+		return true
+	case engineConfig.File.MountDev == "yes" && engineConfig.GetNv():
+		return gpu.HasMIGDevices(engineConfig.GetNvVisibleDevices())
+	}
+	return false
+}
+
 func (c *container) addDevMount(system *mount.System) error {
 	sylog.Debugf("Checking configuration file for 'mount dev'")
 
-	if c.engine.EngineConfig.File.MountDev == "minimal" || c.engine.EngineConfig.GetContain() {
+	if stagedDev(c.engine.EngineConfig) {
 		sylog.Debugf("Creating temporary staged /dev")
 		if err := c.session.AddDir("/dev"); err != nil {
 			return fmt.Errorf("failed to add /dev session directory: %s", err)
@@ -1283,7 +1447,7 @@ func (c *container) addDevMount(system *mount.System) error {
 		}
 		devshmPath, _ := c.session.GetPath("/dev/shm")
 		flags := uintptr(syscall.MS_NOSUID | syscall.MS_NODEV)
-		err := system.Points.AddFS(mount.DevTag, devshmPath, c.sessionFsType, flags, "mode=1777")
+		err := system.Points.AddFS(mount.DevTag, devshmPath, c.sessionFsType, flags, c.shmOptions())
 		if err != nil {
 			return fmt.Errorf("failed to add /dev/shm temporary filesystem: %s", err)
 		}
@@ -1393,8 +1557,14 @@ func (c *container) addDevMount(system *mount.System) error {
 			return err
 		}
 		if c.engine.EngineConfig.GetNv() {
-			devs, err := gpu.NvidiaDevices(true)
+			// only the devices of the MIG devices listed in
+			// CUDA_VISIBLE_DEVICES are bound, if any
+			devs, err := gpu.NvidiaMIGDevices(c.engine.EngineConfig.GetNvVisibleDevices())
 			if err != nil {
+				return fmt.Errorf("failed to get nvidia MIG devices: %v", err)
+			} else if devs != nil {
+				sylog.Debugf("Binding nvidia MIG devices %s", strings.Join(devs, ", "))
+			} else if devs, err = gpu.NvidiaDevices(true); err != nil {
 				return fmt.Errorf("failed to get nvidia devices: %v", err)
 			}
 			for _, dev := range devs {
@@ -1416,6 +1586,12 @@ func (c *container) addDevMount(system *mount.System) error {
 			}
 		}
 
+		for _, d := range c.engine.EngineConfig.GetDevices() {
+			if err := c.addSessionDevAt(d.Source, d.Destination, system); err != nil {
+				return fmt.Errorf("failed to add device %s: %s", d.Source, err)
+			}
+		}
+
 		if err := c.addSessionDev("/dev/fd", system); err != nil {
 			return err
 		}
@@ -1441,12 +1617,51 @@ func (c *container) addDevMount(system *mount.System) error {
 			return fmt.Errorf("unable to add dev to mount list: %s", err)
 		}
 		sylog.Verbosef("Default mount: /dev:/dev")
+
+		// the host devices are already available from the host /dev
+		for _, d := range c.engine.EngineConfig.GetDevices() {
+			if d.Destination != d.Source {
+				return fmt.Errorf("device %s can't be passed at %s with the host /dev, use --contain", d.Source, d.Destination)
+			}
+		}
+
+		// the host /dev/shm is shared unless a size was requested
+		if c.engine.EngineConfig.GetShmSize() != "" {
+			sylog.Debugf("Adding sized /dev/shm temporary filesystem")
+			flags := uintptr(syscall.MS_NOSUID | syscall.MS_NODEV)
+			err := system.Points.AddFS(mount.DevTag, "/dev/shm", c.sessionFsType, flags, c.shmOptions())
+			if err != nil {
+				return fmt.Errorf("failed to add /dev/shm temporary filesystem: %s", err)
+			}
+		}
 	} else if c.engine.EngineConfig.File.MountDev == "no" {
 		sylog.Verbosef("Not mounting /dev inside the container, disallowed by configuration")
+		if len(c.engine.EngineConfig.GetDevices()) > 0 {
+			return fmt.Errorf("devices can't be passed into the container, /dev is not mounted")
+		}
+		if c.engine.EngineConfig.GetShmSize() != "" {
+			sylog.Warningf("Ignoring --shm-size, /dev is not mounted inside the container")
+		}
 	}
 	return nil
 }
 
+// shmOptions returns the mount options of the /dev/shm temporary filesystem,
+// the size requested by the user takes precedence over the configured size.
+func (c *container) shmOptions() string {
+	size := c.engine.EngineConfig.GetShmSize()
+	if size == "" {
+		size = c.engine.EngineConfig.File.ShmSize
+	}
+	if size == "" {
+		return "mode=1777"
+	}
+	if c.sessionFsType == "ramfs" {
+		sylog.Warningf("/dev/shm size of %s ignored with ramfs memory fs type", size)
+	}
+	return fmt.Sprintf("mode=1777,size=%s", size)
+}
+
 func (c *container) addHostMount(system *mount.System) error {
 	if !c.engine.EngineConfig.File.MountHostfs {
 		sylog.Debugf("Not mounting host file systems per configuration")
@@ -1500,8 +1715,12 @@ func (c *container) addBindsMount(system *mount.System) error {
 		// handle special case for /etc/hosts as it is required,
 		// if no network namespace was requested we simply bind
 		// /etc/hosts from host, if network namespace is requested
-		// we create a minimal default hosts for localhost resolution
-		if !c.netNS {
+		// we create a minimal default hosts for localhost resolution,
+		// unless the user binds its own /etc/hosts
+		if c.isUserBound(hostsPath) {
+			sylog.Verbosef("Skipping default %s, bound by user", hostsPath)
+			hosts = ""
+		} else if !c.netNS {
 			sylog.Debugf("Binding /etc/hosts and /etc/localtime only with contain")
 		} else {
 			sylog.Debugf("Skipping bind mounts as contain was requested")
@@ -1513,11 +1732,13 @@ func (c *container) addBindsMount(system *mount.System) error {
 			hosts, _ = c.session.GetPath(hostsPath)
 		}
 
-		if err := system.Points.AddBind(mount.BindsTag, hosts, hostsPath, flags); err != nil {
-			return fmt.Errorf("unable to add %s to mount list: %s", hosts, err)
-		}
-		if err := system.Points.AddRemount(mount.BindsTag, hostsPath, flags); err != nil {
-			return fmt.Errorf("unable to add %s for remount: %s", hostsPath, err)
+		if hosts != "" {
+			if err := system.Points.AddBind(mount.BindsTag, hosts, hostsPath, flags); err != nil {
+				return fmt.Errorf("unable to add %s to mount list: %s", hosts, err)
+			}
+			if err := system.Points.AddRemount(mount.BindsTag, hostsPath, flags); err != nil {
+				return fmt.Errorf("unable to add %s for remount: %s", hostsPath, err)
+			}
 		}
 		if err := system.Points.AddBind(mount.BindsTag, localtimePath, localtimePath, flags); err != nil {
 			return fmt.Errorf("unable to add %s to mount list: %s", hosts, err)
@@ -1584,8 +1805,9 @@ func (c *container) addHomeStagingDir(system *mount.System, source string, dest
 
 	bindSource := !c.engine.EngineConfig.GetContain() || c.engine.EngineConfig.GetCustomHome()
 
-	// use the session home directory is the user home directory doesn't exist (issue #4208)
-	if _, err := os.Stat(source); os.IsNotExist(err) {
+	// use the session home directory is the user home directory doesn't exist (issue #4208),
+	// an automounted home directory may appear after a short delay
+	if bindSource && !c.homeExists(source) {
 		bindSource = false
 	}
 
@@ -1605,6 +1827,16 @@ func (c *container) addHomeStagingDir(system *mount.System, source string, dest
 	return homeStage, nil
 }
 
+// homeExists returns if the home source directory exists, triggering its
+// mount if it's located under an autofs mount point.
+func (c *container) homeExists(source string) bool {
+	autoFsPoints, err := getAutofsPoints()
+	if err != nil {
+		sylog.Debugf("Could not get autofs mount points: %s", err)
+	}
+	return triggerAutofs(source, autoFsPoints)
+}
+
 // addHomeLayer adds the home mount when using either overlay or underlay
 func (c *container) addHomeLayer(system *mount.System, source, dest string) error {
 	flags := uintptr(syscall.MS_BIND | c.suidFlag | syscall.MS_NODEV | syscall.MS_REC)
@@ -1676,6 +1908,7 @@ func (c *container) addHomeMount(system *mount.System) error {
 	if err != nil {
 		return err
 	}
+	c.checkUnmappedIDs(source, false)
 
 	sessionLayer := c.engine.EngineConfig.GetSessionLayer()
 	sylog.Debugf("Adding home directory mount [%v:%v] to list using layer: %s\n", stagingDir, dest, sessionLayer)
@@ -1685,11 +1918,54 @@ func (c *container) addHomeMount(system *mount.System) error {
 	return c.addHomeLayer(system, stagingDir, dest)
 }
 
+// loadProfileBinds returns the binds of the bind profiles applied to the
+// container, read from the profiles defined by the administrator rather
+// than from the engine configuration. Optional binds with a missing source
+// are skipped.
+func loadProfileBinds(configurationFile string, engineConfig *singularity.EngineConfig) ([]singularity.BindPath, error) {
+	names := engineConfig.GetProfiles()
+	if len(names) == 0 {
+		return nil, nil
+	}
+	profiles, err := bindprofile.Load(configurationFile, engineConfig.File.BindProfile, bindprofile.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("while loading bind profiles: %s", err)
+	}
+	selected, err := bindprofile.Select(profiles, names, nil)
+	if err != nil {
+		return nil, err
+	}
+	binds, err := singularity.ParseBindPath(strings.Join(bindprofile.Binds(selected), ","))
+	if err != nil {
+		return nil, fmt.Errorf("while parsing profile bind path: %s", err)
+	}
+	binds, err = singularity.ExpandBindPaths(binds, engineConfig.File.MaxBindGlobMatches)
+	if err != nil {
+		return nil, fmt.Errorf("while expanding profile bind path: %s", err)
+	}
+
+	kept := make([]singularity.BindPath, 0, len(binds))
+	for _, b := range binds {
+		if _, err := os.Stat(b.Source); b.Optional() && os.IsNotExist(err) {
+			sylog.Warningf("Skipping optional profile bind mount %s: source doesn't exist", b.Source)
+			continue
+		}
+		kept = append(kept, b)
+	}
+	return kept, nil
+}
+
 func (c *container) addUserbindsMount(system *mount.System) error {
 	const devPrefix = "/dev"
 	defaultFlags := uintptr(syscall.MS_BIND | c.suidFlag | syscall.MS_NODEV | syscall.MS_REC)
 
-	for _, b := range c.engine.EngineConfig.GetBindPath() {
+	// profile binds are mounted before the user binds
+	binds := append([]singularity.BindPath(nil), c.profileBinds...)
+	binds = append(binds, c.engine.EngineConfig.GetBindPath()...)
+
+	for i, b := range binds {
+		profileBind := i < len(c.profileBinds)
+
 		// ignore image bind
 		if b.ID() != "" || b.ImageSrc() != "" {
 			continue
@@ -1707,15 +1983,16 @@ func (c *container) addUserbindsMount(system *mount.System) error {
 		if b.Readonly() {
 			flags |= syscall.MS_RDONLY
 		}
+		flags = c.bindFlagOptions(b, flags)
 
 		// special case for /dev mount to override default mount behavior
-		// with --contain option or 'mount dev = minimal'
+		// with a staged /dev, see stagedDev
 		if strings.HasPrefix(dst, devPrefix) && strings.HasPrefix(src, devPrefix) {
 			if dst != src {
 				sylog.Warningf("Skipping %s bind mount: source and destination must be identical when binding to %s", src, devPrefix)
 				continue
 			}
-			if c.engine.EngineConfig.File.MountDev == "minimal" || c.engine.EngineConfig.GetContain() {
+			if stagedDev(c.engine.EngineConfig) {
 				// "--bind /dev" bind case
 				if src == devPrefix {
 					system.Points.RemoveByTag(mount.DevTag)
@@ -1740,21 +2017,48 @@ func (c *container) addUserbindsMount(system *mount.System) error {
 			// proceed with normal binds below if 'mount dev = yes'
 			// or '--contain' wasn't requested
 		}
-		if !c.engine.EngineConfig.File.UserBindControl {
+		if !profileBind && !c.engine.EngineConfig.File.UserBindControl {
 			sylog.Warningf("Ignoring %s bind mount: user bind control disabled by system administrator", src)
 			continue
 		}
 
 		sylog.Debugf("Adding %s to mount list\n", src)
 
-		if err := system.Points.AddBind(mount.UserbindsTag, src, dst, flags); err == mount.ErrMountExists {
+		// the chown option binds a copy of the source owned by
+		// the requested IDs
+		bindSrc := src
+		uid, gid, chown := b.Chown()
+		if chown {
+			bindSrc, err = c.addChownShadow(system, src, uid, gid)
+			if err != nil {
+				return fmt.Errorf("unable to add %s to mount list: %s", src, err)
+			}
+		}
+
+		addBind := system.Points.AddBind
+		if b.IDMap() {
+			if !c.userNS {
+				// without user namespace host and container IDs
+				// are identical, there is nothing to translate
+				sylog.Warningf("Ignoring idmap option for %s bind mount: container doesn't run in a user namespace", src)
+			} else if !mount.IDMapSupported() {
+				sylog.Warningf("Kernel doesn't support idmapped mounts (Linux 5.12+ required), %s is bound without ID translation", src)
+			} else {
+				addBind = system.Points.AddIDMappedBind
+			}
+		}
+
+		if err := addBind(mount.UserbindsTag, bindSrc, dst, flags); err == mount.ErrMountExists {
 			sylog.Warningf("While bind mounting '%s:%s': %s", src, dst, err)
 		} else if err != nil {
 			return fmt.Errorf("unable to add %s to mount list: %s", src, err)
 		} else {
+			if !chown {
+				c.checkUnmappedIDs(src, b.IDMap() && mount.IDMapSupported())
+			}
 			fi, err := os.Stat(src)
 			if err == nil && fi.IsDir() {
-				c.session.OverrideDir(dst, src)
+				c.session.OverrideDir(dst, bindSrc)
 			}
 			system.Points.AddRemount(mount.UserbindsTag, dst, flags)
 		}
@@ -1763,6 +2067,98 @@ func (c *container) addUserbindsMount(system *mount.System) error {
 	return nil
 }
 
+// bindFlagOptions returns flags modified by the mount flag options of the
+// bind path b. The options relaxing the default nosuid and nodev flags are
+// only honored for root outside of a user namespace.
+func (c *container) bindFlagOptions(b singularity.BindPath, flags uintptr) uintptr {
+	privileged := os.Geteuid() == 0 && !c.userNS
+
+	for _, opt := range b.FlagOptions() {
+		switch opt {
+		case "nosuid":
+			flags |= syscall.MS_NOSUID
+		case "nodev":
+			flags |= syscall.MS_NODEV
+		case "noexec":
+			flags |= syscall.MS_NOEXEC
+		case "suid", "dev":
+			if !privileged {
+				sylog.Warningf("Ignoring %s option for %s bind mount: only allowed for root without user namespace", opt, b.Source)
+				continue
+			}
+			if opt == "suid" {
+				if c.noFilecaps {
+					sylog.Warningf("Ignoring suid option for %s bind mount: setuid binaries are ignored with --security nofilecaps", b.Source)
+					continue
+				}
+				flags &^= syscall.MS_NOSUID
+			} else {
+				flags &^= syscall.MS_NODEV
+			}
+		}
+	}
+	return flags
+}
+
+// isMappedID returns if the host id is mapped by one of the container user
+// namespace mappings, with idmap the id is a container ID as idmapped
+// mounts translate the IDs stored on disk.
+func isMappedID(id uint32, mappings []specs.LinuxIDMapping, idmap bool) bool {
+	if id == fs.ACLUndefinedID {
+		return false
+	}
+	for _, m := range mappings {
+		base := m.HostID
+		if idmap {
+			base = m.ContainerID
+		}
+		if id >= base && id-base < m.Size {
+			return true
+		}
+	}
+	return false
+}
+
+// checkUnmappedIDs warns when the owner of the bind source src, or an ID
+// referenced by its ACLs, isn't mapped in the container user namespace.
+// Those IDs are shown as nobody in the container, where the ACLs and the
+// extended attributes of src can't be modified (e.g. setfacl fails with
+// EPERM). The ACL extended attributes are never rewritten, their IDs are
+// only translated by the kernel, the files on the host are left untouched.
+func (c *container) checkUnmappedIDs(src string, idmap bool) {
+	linux := c.engine.EngineConfig.OciConfig.Linux
+	if !c.userNS || linux == nil || len(linux.UIDMappings) == 0 {
+		return
+	}
+
+	fi, err := os.Lstat(src)
+	if err != nil {
+		return
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		if !isMappedID(st.Uid, linux.UIDMappings, idmap) || !isMappedID(st.Gid, linux.GIDMappings, idmap) {
+			sylog.Warningf("%s is owned by an ID not mapped in the container user namespace, its ACLs and extended attributes can't be modified in the container", src)
+			return
+		}
+	}
+
+	uids, gids, err := fs.ACLIDs(src)
+	if err != nil {
+		sylog.Debugf("Could not read ACLs of %s: %s", src, err)
+		return
+	}
+	for _, uid := range uids {
+		if !isMappedID(uid, linux.UIDMappings, idmap) {
+			sylog.Warningf("ACL of %s references user ID %d not mapped in the container user namespace, it's shown as nobody in the container", src, uid)
+		}
+	}
+	for _, gid := range gids {
+		if !isMappedID(gid, linux.GIDMappings, idmap) {
+			sylog.Warningf("ACL of %s references group ID %d not mapped in the container user namespace, it's shown as nobody in the container", src, gid)
+		}
+	}
+}
+
 func (c *container) addTmpMount(system *mount.System) error {
 	const (
 		tmpPath    = "/tmp"
@@ -1771,6 +2167,9 @@ func (c *container) addTmpMount(system *mount.System) error {
 
 	sylog.Debugf("Checking for 'mount tmp' in configuration file")
 	if !c.engine.EngineConfig.File.MountTmp {
+		if c.engine.EngineConfig.GetTmpMount() != "" || c.engine.EngineConfig.GetVarTmpMount() != "" {
+			sylog.Warningf("Ignoring --tmp and --var-tmp, tmp dir mounting is disabled by system administrator")
+		}
 		sylog.Verbosef("Skipping tmp dir mounting (per config)")
 		return nil
 	}
@@ -1824,6 +2223,26 @@ func (c *container) addTmpMount(system *mount.System) error {
 		}
 	}
 
+	// the mounts requested with --tmp and --var-tmp replace the
+	// default mount of each directory
+	for _, m := range []struct {
+		path   string
+		spec   string
+		source *string
+	}{
+		{tmpPath, c.engine.EngineConfig.GetTmpMount(), &tmpSource},
+		{varTmpPath, c.engine.EngineConfig.GetVarTmpMount(), &vartmpSource},
+	} {
+		if m.spec == "" {
+			continue
+		}
+		source, err := c.tmpMountSource(system, m.path, m.spec)
+		if err != nil {
+			return err
+		}
+		*m.source = source
+	}
+
 	c.session.OverrideDir(tmpPath, tmpSource)
 	c.session.OverrideDir(varTmpPath, vartmpSource)
 
@@ -1845,6 +2264,30 @@ func (c *container) addTmpMount(system *mount.System) error {
 	return nil
 }
 
+// tmpMountSource returns the source of the container temporary directory
+// path for the mount specification spec: a host directory, or a private
+// temporary filesystem mounted in the session directory for TmpfsMount.
+func (c *container) tmpMountSource(system *mount.System, path, spec string) (string, error) {
+	if spec != singularity.TmpfsMount {
+		if !c.engine.EngineConfig.File.UserBindControl {
+			return "", fmt.Errorf("could not mount %s on container's %s directory: user bind control is disabled by system administrator", spec, path)
+		}
+		return spec, nil
+	}
+
+	tmpfsDir := filepath.Join("/tmpfs", path)
+	if err := c.session.AddDir(tmpfsDir); err != nil {
+		return "", fmt.Errorf("failed to add %s session directory: %s", tmpfsDir, err)
+	}
+	source, _ := c.session.GetPath(tmpfsDir)
+
+	flags := uintptr(syscall.MS_NOSUID | syscall.MS_NODEV)
+	if err := system.Points.AddFS(mount.TmpTag, source, c.sessionFsType, flags, "mode=1777"); err != nil {
+		return "", fmt.Errorf("failed to add %s temporary filesystem: %s", path, err)
+	}
+	return source, nil
+}
+
 func (c *container) addScratchMount(system *mount.System) error {
 	const scratchSessionDir = "/scratch"
 
@@ -1894,6 +2337,114 @@ func (c *container) addScratchMount(system *mount.System) error {
 	return nil
 }
 
+// addAppDataMount makes the data directory of the SCIF application set
+// with --app writable, by binding the host directory set with --scif-data
+// or, when the container root filesystem is read-only, a directory of the
+// session directory which is discarded at exit.
+func (c *container) addAppDataMount(system *mount.System) error {
+	app := c.engine.EngineConfig.GetAppName()
+	if app == "" {
+		return nil
+	}
+	dest := filepath.Join(scifDataDir, filepath.Clean("/"+app))
+	if c.isUserBound(dest) {
+		sylog.Debugf("Not mounting %s: bound by user", dest)
+		return nil
+	}
+
+	source := c.engine.EngineConfig.GetScifData()
+	if source != "" {
+		if !c.engine.EngineConfig.File.UserBindControl {
+			sylog.Warningf("Not mounting --scif-data: user bind control disabled by system administrator")
+			return nil
+		}
+		for _, dir := range []string{"input", "output"} {
+			if err := fs.MkdirAll(filepath.Join(source, dir), 0750); err != nil {
+				return fmt.Errorf("could not create application data directory: %s", err)
+			}
+		}
+	} else {
+		if c.engine.EngineConfig.GetWritableImage() ||
+			c.engine.EngineConfig.GetWritableTmpfs() ||
+			len(c.engine.EngineConfig.GetOverlayImage()) > 0 {
+			if c.engine.EngineConfig.GetScifDataQuota() > 0 {
+				sylog.Warningf("Ignoring --scif-data-quota: %s is in the writable container root filesystem", dest)
+			}
+			sylog.Debugf("Not mounting %s: container root filesystem is writable", dest)
+			return nil
+		}
+		if quota := c.engine.appDataQuota(); quota > 0 {
+			var err error
+			if source, err = c.appDataQuotaSource(system, dest, quota); err != nil {
+				return err
+			}
+		} else {
+			for _, dir := range []string{"input", "output"} {
+				if err := c.session.AddDir(filepath.Join(dest, dir)); err != nil {
+					return fmt.Errorf("could not create application data directory: %s", err)
+				}
+			}
+			source, _ = c.session.GetPath(dest)
+		}
+	}
+	c.session.OverrideDir(dest, source)
+
+	flags := uintptr(syscall.MS_BIND | c.suidFlag | syscall.MS_NODEV | syscall.MS_REC)
+	if err := system.Points.AddBind(mount.ScratchTag, source, dest, flags); err != nil {
+		return fmt.Errorf("could not bind application data directory %s into container: %s", source, err)
+	}
+	system.Points.AddRemount(mount.ScratchTag, dest, flags)
+	sylog.Verbosef("Application data mount: %s:%s", source, dest)
+	return nil
+}
+
+// appDataQuotaSource returns the source of the application data directory
+// dest limited to quota MiB: the ext2 disk image created by PrepareConfig
+// mounted in the session directory, writing beyond its size fails with
+// ENOSPC. The image is stored on disk, not in memory, and isn't accounted
+// in the session directory.
+func (c *container) appDataQuotaSource(system *mount.System, dest string, quota int) (string, error) {
+	fd := c.engine.EngineConfig.GetScifDataImageFd()
+	if fd <= 0 {
+		return "", fmt.Errorf("no disk image for the --scif-data-quota application data directory")
+	}
+
+	if err := c.session.AddDir(dest); err != nil {
+		return "", fmt.Errorf("could not create application data directory: %s", err)
+	}
+	source, _ := c.session.GetPath(dest)
+
+	backing := fmt.Sprintf("/proc/self/fd/%d", fd)
+	flags := uintptr(syscall.MS_NOSUID | syscall.MS_NODEV)
+	if err := system.Points.AddImage(mount.TmpTag, backing, source, "ext4", flags, 0, uint64(quota)<<20, nil); err != nil {
+		return "", fmt.Errorf("failed to add application data disk image: %s", err)
+	}
+
+	// the input and output directories are created once the
+	// disk image is mounted
+	uid := os.Getuid()
+	gid := os.Getgid()
+
+	err := system.RunAfterTag(mount.TmpTag, func(*mount.System) error {
+		for _, dir := range []string{"input", "output"} {
+			path := filepath.Join(source, dir)
+			if err := c.rpcOps.Mkdir(path, 0755); err != nil {
+				return fmt.Errorf("could not create application data directory: %s", err)
+			}
+			if err := c.rpcOps.Chown(path, uid, gid); err != nil {
+				return fmt.Errorf("could not change application data directory owner: %s", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sylog.Verbosef("Application data directory %s limited to %d MiB", dest, quota)
+	return source, nil
+}
+
 func (c *container) isMounted(dest string) bool {
 	sylog.Debugf("Checking if %s is already mounted", dest)
 
@@ -2082,8 +2633,10 @@ func (c *container) addIdentityMount(system *mount.System) error {
 	rootfs := c.session.RootFsPath()
 	defer c.session.Update()
 
+	// the target UID is also set by users running the container
+	// process with a remapped UID
 	uid := os.Getuid()
-	if uid == 0 && c.engine.EngineConfig.GetTargetUID() != 0 {
+	if c.engine.EngineConfig.GetTargetUID() != 0 {
 		uid = c.engine.EngineConfig.GetTargetUID()
 	}
 
@@ -2139,10 +2692,30 @@ func (c *container) addIdentityMount(system *mount.System) error {
 	return nil
 }
 
+// isUserBound returns if the user requested to bind a host path at the
+// container path dest, user binds take precedence over the files generated
+// for the container (e.g. /etc/resolv.conf and /etc/hosts).
+func (c *container) isUserBound(dest string) bool {
+	if !c.engine.EngineConfig.File.UserBindControl {
+		return false
+	}
+	for _, b := range c.engine.EngineConfig.GetBindPath() {
+		if b.ID() == "" && b.ImageSrc() == "" && filepath.Clean(b.Destination) == dest {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *container) addResolvConfMount(system *mount.System) error {
 	resolvConf := "/etc/resolv.conf"
 
-	if c.engine.EngineConfig.File.ConfigResolvConf {
+	if c.isUserBound(resolvConf) {
+		if c.engine.EngineConfig.GetDNS() != "" {
+			sylog.Warningf("Ignoring --dns option, %s is bound by user", resolvConf)
+		}
+		sylog.Verbosef("Skipping default %s, bound by user", resolvConf)
+	} else if c.engine.EngineConfig.File.ConfigResolvConf {
 		var err error
 		var content []byte
 
@@ -2233,16 +2806,6 @@ func (c *container) prepareNetworkSetup(system *mount.System, pid int) (func(con
 		return nil, fmt.Errorf("network requires root or --fakeroot, users need to specify --network=%s with --net", noneNet)
 	}
 
-	// we hold a reference to container network namespace
-	// by binding /proc/self/ns/net (from the RPC server) inside the
-	// session directory
-	if err := c.session.AddFile(sessionNetNs, nil); err != nil {
-		return nil, err
-	}
-	nspath, _ := c.session.GetPath(sessionNetNs)
-	if err := system.Points.AddBind(mount.SharedTag, procNetNs, nspath, 0); err != nil {
-		return nil, fmt.Errorf("could not hold network namespace reference: %s", err)
-	}
 	networks := strings.Split(c.engine.EngineConfig.GetNetwork(), ",")
 
 	if fakeroot && euid != 0 && net != fakerootNet {
@@ -2262,7 +2825,26 @@ func (c *container) prepareNetworkSetup(system *mount.System, pid int) (func(con
 		cniPath.Plugin = defaultCNIPluginPath
 	}
 
-	setup, err := network.NewSetup(networks, strconv.Itoa(pid), nspath, cniPath)
+	networkConfList, err := loadNetworkConfList(networks, cniPath)
+	if err != nil {
+		return nil, fmt.Errorf("network setup failed: %s", err)
+	} else if len(networkConfList) == 0 {
+		// only the loopback interface is brought up
+		return nil, nil
+	}
+
+	// we hold a reference to container network namespace
+	// by binding /proc/self/ns/net (from the RPC server) inside the
+	// session directory
+	if err := c.session.AddFile(sessionNetNs, nil); err != nil {
+		return nil, err
+	}
+	nspath, _ := c.session.GetPath(sessionNetNs)
+	if err := system.Points.AddBind(mount.SharedTag, procNetNs, nspath, 0); err != nil {
+		return nil, fmt.Errorf("could not hold network namespace reference: %s", err)
+	}
+
+	setup, err := network.NewSetupFromConfig(networkConfList, strconv.Itoa(pid), nspath, cniPath)
 	if err != nil {
 		return nil, fmt.Errorf("network setup failed: %s", err)
 	}
@@ -2294,6 +2876,41 @@ func (c *container) prepareNetworkSetup(system *mount.System, pid int) (func(con
 	}, nil
 }
 
+// loadNetworkConfList loads the configuration of the networks. When IPv6
+// is disabled, the IPv6 addressing of the networks is removed and the
+// networks with IPv6 addressing only are ignored with a warning.
+func loadNetworkConfList(networks []string, cniPath *network.CNIPath) ([]*libcni.NetworkConfigList, error) {
+	if cniPath.Conf == "" {
+		return nil, network.ErrNoCNIConfig
+	}
+
+	ipv6 := network.IPv6Enabled()
+	confList := make([]*libcni.NetworkConfigList, 0, len(networks))
+
+	for _, n := range networks {
+		conf, err := libcni.LoadConfList(cniPath.Conf, n)
+		if err != nil {
+			return nil, err
+		}
+		if !ipv6 {
+			removed, ipv4, err := network.RemoveIPv6(conf)
+			if err != nil {
+				return nil, err
+			}
+			if removed && !ipv4 {
+				sylog.Warningf("IPv6 is disabled on this host, ignoring IPv6 only network %s", n)
+				continue
+			} else if removed {
+				// the default networks are dual-stack, a warning
+				// would be displayed at each run on these hosts
+				sylog.Verbosef("IPv6 is disabled on this host, network %s is configured without IPv6 addresses", n)
+			}
+		}
+		confList = append(confList, conf)
+	}
+	return confList, nil
+}
+
 // getFuseFdFromRPC returns fuse file descriptors from RPC server based on
 // the file descriptor list provided in argument, it also returns an
 // additional file descriptor corresponding to /proc/self/ns/user.
@@ -2335,6 +2952,43 @@ func (c *container) getFuseFdFromRPC(fds []int) ([]int, error) {
 	return newfds, nil
 }
 
+// mountIDMapped bind mounts source to dest with its ownership translated
+// through the ID mappings of the container user namespace. An idmapped
+// mount requires privileges in the user namespace owning the source
+// filesystem, it's created detached by the master process in the host
+// user namespace and its file descriptor is passed to the RPC server
+// which attaches it in the container mount namespace.
+func (c *container) mountIDMapped(root, source, dest string, flags uintptr) error {
+	socketPair := c.engine.EngineConfig.GetUnixSocketPair()
+	if socketPair[0] < 0 {
+		return fmt.Errorf("no socket to pass the mount file descriptor")
+	}
+
+	fds, err := c.getFuseFdFromRPC(nil)
+	if err != nil {
+		return err
+	}
+	usernsFd := fds[0]
+	defer unix.Close(usernsFd)
+
+	fd, err := func() (int, error) {
+		if os.Geteuid() != 0 {
+			priv.Escalate()
+			defer priv.Drop()
+		}
+		return mount.OpenTreeIDMapped(source, usernsFd, flags)
+	}()
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	if err := unix.Sendmsg(socketPair[0], nil, unix.UnixRights(fd), nil, 0); err != nil {
+		return fmt.Errorf("while sending mount file descriptor: %s", err)
+	}
+	return c.rpcOps.MountIDMapped(root, dest, socketPair[1])
+}
+
 // openFuseFdFromRPC returns fuse file descriptor opened by RPC server,
 // the first returned argument corresponds to the file descriptor to use
 // by the caller while the second argument corresponds to the file
@@ -2532,3 +3186,28 @@ func (c *container) getBindFlags(source string, defaultFlags uintptr) (uintptr,
 
 	return defaultFlags | addFlags, nil
 }
+
+// chroot establishes the container root filesystem from the RPC server
+// current working directory. pivot_root is used by default, with a
+// fallback to a mount move followed by chroot, and a plain chroot is used
+// when requested with --no-pivot.
+func (c *container) chroot() error {
+	if c.engine.EngineConfig.GetNoPivot() {
+		sylog.Debugf("Chroot without pivot_root")
+		if _, err := c.rpcOps.Chroot(".", "chroot"); err != nil {
+			return fmt.Errorf("chroot failed: %s", err)
+		}
+		return nil
+	}
+
+	_, pivotErr := c.rpcOps.Chroot(".", "pivot")
+	if pivotErr == nil {
+		return nil
+	}
+
+	sylog.Debugf("pivot_root failed: %s, fallback to move/chroot", pivotErr)
+	if _, err := c.rpcOps.Chroot(".", "move"); err != nil {
+		return fmt.Errorf("chroot failed: %s (%s), if pivot_root is not allowed in this environment, try --no-pivot", err, pivotErr)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"syscall"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	singularity "github.com/sylabs/singularity/pkg/runtime/engine/singularity/config"
+)
+
+func TestIsMappedID(t *testing.T) {
+	fakeroot := []specs.LinuxIDMapping{
+		{HostID: 1000, ContainerID: 0, Size: 1},
+		{HostID: 100000, ContainerID: 1, Size: 65536},
+	}
+
+	tests := []struct {
+		name  string
+		id    uint32
+		idmap bool
+		want  bool
+	}{
+		{name: "User", id: 1000, want: true},
+		{name: "RangeStart", id: 100000, want: true},
+		{name: "RangeEnd", id: 165535, want: true},
+		{name: "AboveRange", id: 165536, want: false},
+		{name: "HostRoot", id: 0, want: false},
+		{name: "Undefined", id: fs.ACLUndefinedID, want: false},
+		{name: "IDMapRoot", id: 0, idmap: true, want: true},
+		{name: "IDMapUser", id: 1000, idmap: true, want: true},
+		{name: "IDMapAboveRange", id: 65537, idmap: true, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := isMappedID(tt.id, fakeroot, tt.idmap); got != tt.want {
+			t.Errorf("%s: isMappedID(%d, idmap=%v) = %v, expected %v", tt.name, tt.id, tt.idmap, got, tt.want)
+		}
+	}
+}
+
+func TestBindFlagOptions(t *testing.T) {
+	const defaultFlags = syscall.MS_BIND | syscall.MS_NOSUID | syscall.MS_NODEV
+
+	tests := []struct {
+		name         string
+		bind         string
+		userNS       bool
+		noFilecaps   bool
+		want         uintptr
+		unprivileged uintptr
+	}{
+		{
+			name:         "None",
+			bind:         "/src:/dst",
+			want:         defaultFlags,
+			unprivileged: defaultFlags,
+		},
+		{
+			name:         "Tighten",
+			bind:         "/src:/dst:nosuid,nodev,noexec",
+			want:         defaultFlags | syscall.MS_NOEXEC,
+			unprivileged: defaultFlags | syscall.MS_NOEXEC,
+		},
+		{
+			name:         "Relax",
+			bind:         "/src:/dst:suid,dev",
+			want:         syscall.MS_BIND,
+			unprivileged: defaultFlags,
+		},
+		{
+			name:         "RelaxNoFilecaps",
+			bind:         "/src:/dst:suid,dev",
+			noFilecaps:   true,
+			want:         syscall.MS_BIND | syscall.MS_NOSUID,
+			unprivileged: defaultFlags,
+		},
+		{
+			name:         "RelaxUserNamespace",
+			bind:         "/src:/dst:dev",
+			userNS:       true,
+			want:         defaultFlags,
+			unprivileged: defaultFlags,
+		},
+	}
+
+	for _, tt := range tests {
+		binds, err := singularity.ParseBindPath(tt.bind)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", tt.name, err)
+		}
+		c := &container{userNS: tt.userNS, noFilecaps: tt.noFilecaps}
+		want := tt.unprivileged
+		if syscall.Geteuid() == 0 {
+			want = tt.want
+		}
+		if got := c.bindFlagOptions(binds[0], defaultFlags); got != want {
+			t.Errorf("%s: got flags %#x, expected %#x", tt.name, got, want)
+		}
+	}
+}
@@ -27,6 +27,8 @@ import (
 // network setup (see container.prepareNetworkSetup) in fakeroot flow. The rest
 // of the setup (e.g. mount operations) where privileges may be required is performed
 // by calling RPC server methods (see internal/app/starter/rpc_linux.go for details).
+// Once the container is set up, the prestart host hook configured by the
+// administrator is run and aborts the container execution if it fails.
 func (e *EngineOperations) CreateContainer(ctx context.Context, pid int, rpcConn net.Conn) error {
 	if e.CommonConfig.EngineName != singularityConfig.Name {
 		return fmt.Errorf("engineName configuration doesn't match runtime name")
@@ -44,5 +46,9 @@ func (e *EngineOperations) CreateContainer(ctx context.Context, pid int, rpcConn
 		return fmt.Errorf("failed to initialize RPC client")
 	}
 
-	return create(ctx, e, rpcOps, pid)
+	if err := create(ctx, e, rpcOps, pid); err != nil {
+		return err
+	}
+
+	return e.runPrestartHostHook(ctx, pid)
 }
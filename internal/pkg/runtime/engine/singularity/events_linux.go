@@ -0,0 +1,186 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/util/priv"
+	"github.com/sylabs/singularity/internal/pkg/util/user"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// containerEvent is a container start or stop event written to the event
+// log set in singularity.conf, as a JSON object on a single line.
+type containerEvent struct {
+	Event    string    `json:"event"`
+	Time     time.Time `json:"time"`
+	Pid      int       `json:"pid"`
+	Image    string    `json:"image"`
+	Instance string    `json:"instance,omitempty"`
+	UID      int       `json:"uid"`
+	User     string    `json:"user,omitempty"`
+	// StartTime, ExitCode, Signal and Rusage are set for stop events.
+	StartTime *time.Time   `json:"startTime,omitempty"`
+	ExitCode  *int         `json:"exitCode,omitempty"`
+	Signal    int          `json:"signal,omitempty"`
+	Rusage    *eventRusage `json:"rusage,omitempty"`
+}
+
+// eventRusage is the resource usage of the container process and of the
+// descendants it waited for, times are in seconds and the maximum
+// resident set size in kilobytes.
+type eventRusage struct {
+	UserTime       float64 `json:"userTime"`
+	SystemTime     float64 `json:"systemTime"`
+	MaxRSS         int64   `json:"maxRSS"`
+	MinorFaults    int64   `json:"minorFaults"`
+	MajorFaults    int64   `json:"majorFaults"`
+	InBlocks       int64   `json:"inBlocks"`
+	OutBlocks      int64   `json:"outBlocks"`
+	VoluntaryCtx   int64   `json:"voluntaryContextSwitches"`
+	InvoluntaryCtx int64   `json:"involuntaryContextSwitches"`
+}
+
+var (
+	// startEvent is the start event sent by PostStartProcess, the
+	// stop event is only sent by CleanupContainer when it's set.
+	startEvent *containerEvent
+	// containerRusage is the resource usage of the container process
+	// returned by wait4 in MonitorContainer.
+	containerRusage *syscall.Rusage
+)
+
+func newEventRusage(ru *syscall.Rusage) *eventRusage {
+	if ru == nil {
+		return nil
+	}
+	seconds := func(tv syscall.Timeval) float64 {
+		return float64(tv.Sec) + float64(tv.Usec)/1e6
+	}
+	return &eventRusage{
+		UserTime:       seconds(ru.Utime),
+		SystemTime:     seconds(ru.Stime),
+		MaxRSS:         ru.Maxrss,
+		MinorFaults:    ru.Minflt,
+		MajorFaults:    ru.Majflt,
+		InBlocks:       ru.Inblock,
+		OutBlocks:      ru.Oublock,
+		VoluntaryCtx:   ru.Nvcsw,
+		InvoluntaryCtx: ru.Nivcsw,
+	}
+}
+
+// stopEvent returns the stop event of the container started with the
+// event start, exiting with status and resource usage ru.
+func stopEvent(start *containerEvent, status syscall.WaitStatus, ru *syscall.Rusage) *containerEvent {
+	ev := *start
+	ev.Event = "stop"
+	ev.Time = time.Now()
+	ev.StartTime = &start.Time
+
+	exitCode := status.ExitStatus()
+	if status.Signaled() {
+		ev.Signal = int(status.Signal())
+		exitCode = 128 + ev.Signal
+	}
+	ev.ExitCode = &exitCode
+	ev.Rusage = newEventRusage(ru)
+	return &ev
+}
+
+// writeEvent writes the event ev to path, a unix socket or a file created
+// if needed and appended to.
+func writeEvent(path string, ev *containerEvent) error {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		conn, err := net.Dial("unixgram", path)
+		if err != nil {
+			conn, err = net.Dial("unix", path)
+		}
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		_, err = conn.Write(b)
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE|syscall.O_NOFOLLOW, 0644)
+	if err != nil {
+		return err
+	}
+	// a single write keeps concurrent events on separate lines
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// sendEvent writes the event ev to the event log set in singularity.conf,
+// if any. The event log is usually writable by root only, privileges are
+// escalated in the setuid workflow. Errors are reported as warnings, they
+// don't stop the container.
+func (e *EngineOperations) sendEvent(ev *containerEvent) {
+	if e.EngineConfig.File == nil || e.EngineConfig.File.EventLog == "" {
+		return
+	}
+	path := e.EngineConfig.File.EventLog
+
+	if os.Geteuid() != 0 {
+		if err := priv.Escalate(); err != nil {
+			// not running with the setuid workflow
+			runtime.UnlockOSThread()
+		} else {
+			defer priv.Drop()
+		}
+	}
+	if err := writeEvent(path, ev); err != nil {
+		sylog.Warningf("Could not write %s event to %s: %s", ev.Event, path, err)
+	}
+}
+
+// sendStartEvent sends the start event of the container process pid.
+func (e *EngineOperations) sendStartEvent(pid int) {
+	if e.EngineConfig.File == nil || e.EngineConfig.File.EventLog == "" {
+		return
+	}
+	startEvent = &containerEvent{
+		Event: "start",
+		Time:  time.Now(),
+		Pid:   pid,
+		Image: e.EngineConfig.GetImage(),
+		UID:   os.Getuid(),
+	}
+	if e.EngineConfig.GetInstance() {
+		startEvent.Instance = e.CommonConfig.ContainerID
+	}
+	if pw, err := user.GetPwUID(uint32(os.Getuid())); err == nil {
+		startEvent.User = pw.Name
+	}
+	e.sendEvent(startEvent)
+}
+
+// sendStopEvent sends the stop event of the container process exiting
+// with status, once its start event was sent.
+func (e *EngineOperations) sendStopEvent(status syscall.WaitStatus) {
+	if startEvent == nil {
+		return
+	}
+	e.sendEvent(stopEvent(startEvent, status, containerRusage))
+	startEvent = nil
+}
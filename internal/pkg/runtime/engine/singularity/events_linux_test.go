@@ -0,0 +1,115 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestStopEvent(t *testing.T) {
+	start := &containerEvent{
+		Event: "start",
+		Time:  time.Now(),
+		Pid:   42,
+		Image: "/tmp/image.sif",
+		UID:   1000,
+	}
+	ru := &syscall.Rusage{
+		Utime:  syscall.Timeval{Sec: 1, Usec: 500000},
+		Maxrss: 2048,
+	}
+
+	// exit status 3
+	ev := stopEvent(start, syscall.WaitStatus(3<<8), ru)
+	if ev.Event != "stop" || ev.Pid != 42 || ev.Image != start.Image || !ev.StartTime.Equal(start.Time) {
+		t.Errorf("unexpected stop event %+v", ev)
+	}
+	if ev.ExitCode == nil || *ev.ExitCode != 3 || ev.Signal != 0 {
+		t.Errorf("got exit code %v and signal %d, want 3 and 0", ev.ExitCode, ev.Signal)
+	}
+	if ev.Rusage == nil || ev.Rusage.UserTime != 1.5 || ev.Rusage.MaxRSS != 2048 {
+		t.Errorf("unexpected resource usage %+v", ev.Rusage)
+	}
+	if start.Event != "start" {
+		t.Errorf("start event modified")
+	}
+
+	// killed by SIGKILL
+	ev = stopEvent(start, syscall.WaitStatus(syscall.SIGKILL), nil)
+	if ev.ExitCode == nil || *ev.ExitCode != 137 || ev.Signal != int(syscall.SIGKILL) {
+		t.Errorf("got exit code %v and signal %d, want 137 and 9", ev.ExitCode, ev.Signal)
+	}
+	if ev.Rusage != nil {
+		t.Errorf("unexpected resource usage %+v", ev.Rusage)
+	}
+}
+
+func TestWriteEvent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "events-")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	start := &containerEvent{Event: "start", Time: time.Now(), Pid: 42, Image: "image.sif"}
+	stop := stopEvent(start, 0, nil)
+
+	// events are appended to files
+	path := filepath.Join(dir, "events.log")
+	for _, ev := range []*containerEvent{start, stop} {
+		if err := writeEvent(path, ev); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer f.Close()
+	var events []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev containerEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatalf("unexpected error decoding %q: %s", scanner.Text(), err)
+		}
+		events = append(events, ev.Event)
+	}
+	if len(events) != 2 || events[0] != "start" || events[1] != "stop" {
+		t.Errorf("got events %v, want [start stop]", events)
+	}
+
+	// events are sent as datagrams to unix datagram sockets
+	sock := filepath.Join(dir, "events.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: sock, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer conn.Close()
+	if err := writeEvent(sock, stop); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	b := make([]byte, 4096)
+	n, err := conn.Read(b)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var ev containerEvent
+	if err := json.Unmarshal(b[:n], &ev); err != nil {
+		t.Fatalf("unexpected error decoding %q: %s", b[:n], err)
+	}
+	if ev.Event != "stop" || ev.ExitCode == nil || *ev.ExitCode != 0 {
+		t.Errorf("unexpected event %+v", ev)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sylabs/singularity/internal/pkg/util/env"
+	"github.com/sylabs/singularity/internal/pkg/util/exec"
+	"github.com/sylabs/singularity/internal/pkg/util/priv"
+	"github.com/sylabs/singularity/internal/pkg/util/user"
+	singularity "github.com/sylabs/singularity/pkg/runtime/engine/singularity/config"
+	"github.com/sylabs/singularity/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+// hookState holds the description of the container passed to the host
+// hooks, it is set by CreateContainer once the container is set up so
+// the poststop hook only runs for created containers.
+var hookState *hostHookState
+
+// hostHookUser describes the user running the container.
+type hostHookUser struct {
+	UID  int    `json:"uid"`
+	GID  int    `json:"gid"`
+	Name string `json:"name,omitempty"`
+}
+
+// hostHookState describes the container to the host hooks on their
+// standard input.
+type hostHookState struct {
+	ID         string                 `json:"id"`
+	Pid        int                    `json:"pid"`
+	Image      string                 `json:"image"`
+	Instance   string                 `json:"instance,omitempty"`
+	User       hostHookUser           `json:"user"`
+	Mounts     []singularity.BindPath `json:"mounts"`
+	Namespaces []specs.LinuxNamespace `json:"namespaces"`
+	ExitCode   *int                   `json:"exitCode,omitempty"`
+}
+
+// newHostHookState returns the description of the container pid passed to
+// the host hooks.
+func (e *EngineOperations) newHostHookState(pid int) *hostHookState {
+	s := &hostHookState{
+		ID:    e.CommonConfig.ContainerID,
+		Pid:   pid,
+		Image: e.EngineConfig.GetImage(),
+		User: hostHookUser{
+			UID: os.Getuid(),
+			GID: os.Getgid(),
+		},
+		Mounts:     e.EngineConfig.GetBindPath(),
+		Namespaces: []specs.LinuxNamespace{},
+	}
+	if e.EngineConfig.GetInstance() {
+		s.Instance = e.CommonConfig.ContainerID
+	}
+	if pw, err := user.GetPwUID(uint32(s.User.UID)); err == nil {
+		s.User.Name = pw.Name
+	}
+	if s.Mounts == nil {
+		s.Mounts = []singularity.BindPath{}
+	}
+	if e.EngineConfig.OciConfig.Linux != nil {
+		s.Namespaces = append(s.Namespaces, e.EngineConfig.OciConfig.Linux.Namespaces...)
+	}
+	return s
+}
+
+// masterSetuid returns if the master process runs in the setuid
+// workflow, the only one where it keeps a privileged saved user ID.
+func masterSetuid() (bool, error) {
+	var ruid, euid, suid uint32
+	_, _, errno := unix.RawSyscall(
+		unix.SYS_GETRESUID,
+		uintptr(unsafe.Pointer(&ruid)),
+		uintptr(unsafe.Pointer(&euid)),
+		uintptr(unsafe.Pointer(&suid)),
+	)
+	if errno != 0 {
+		return false, fmt.Errorf("while getting user IDs: %s", errno)
+	}
+	return ruid != 0 && suid == 0, nil
+}
+
+// runHostHook runs the host hook found at path with the container state s
+// on its standard input. The hook runs as root in the setuid workflow and
+// as the user otherwise, it is killed after timeout. The error returned
+// for a failing hook holds its standard error.
+func runHostHook(ctx context.Context, name, path string, timeout uint, s *hostHookState) error {
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("%s host hook %s must be an absolute path", name, path)
+	}
+	if timeout == 0 {
+		return fmt.Errorf("host hook timeout must be greater than zero")
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("while encoding container state: %s", err)
+	}
+
+	setuid, err := masterSetuid()
+	if err != nil {
+		return err
+	}
+
+	var fi unix.Stat_t
+	if err := unix.Stat(path, &fi); err != nil {
+		return fmt.Errorf("%s host hook %s: %s", name, path, err)
+	}
+	if setuid && (fi.Uid != 0 || fi.Mode&(unix.S_IWGRP|unix.S_IWOTH) != 0) {
+		return fmt.Errorf("%s host hook %s must be owned by root and only writable by its owner", name, path)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	var stderr bytes.Buffer
+
+	cmd := osexec.Command(path)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stderr = &stderr
+	cmd.Dir = "/"
+	cmd.Env = []string{"PATH=" + env.DefaultPath}
+	// run the hook in its own process group to kill its children as well
+	// on timeout, they would otherwise keep the output pipe open
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if setuid {
+		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: 0, Gid: 0}
+		if err := priv.Escalate(); err != nil {
+			return fmt.Errorf("while escalating privileges: %s", err)
+		}
+	}
+	sylog.Debugf("Running %s host hook %s", name, path)
+	err = cmd.Start()
+	if setuid {
+		if err := priv.Drop(); err != nil {
+			return fmt.Errorf("while dropping privileges: %s", err)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("while running %s host hook: %s", name, err)
+	}
+
+	err = exec.WaitProcessGroup(ctx, cmd)
+
+	msg := strings.TrimSpace(stderr.String())
+	if msg != "" {
+		msg = ": " + msg
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%s host hook timed out after %ds%s", name, timeout, msg)
+	} else if err != nil {
+		return fmt.Errorf("%s host hook failed with exit status %d%s", name, cmd.ProcessState.ExitCode(), msg)
+	}
+	return nil
+}
+
+// runPrestartHostHook runs the prestart host hook, if any, for the
+// container pid once it is set up.
+func (e *EngineOperations) runPrestartHostHook(ctx context.Context, pid int) error {
+	hookState = e.newHostHookState(pid)
+
+	path := e.EngineConfig.File.PrestartHostHook
+	if path == "" {
+		return nil
+	}
+	return runHostHook(ctx, "prestart", path, e.EngineConfig.File.HostHookTimeout, hookState)
+}
+
+// runPoststopHostHook runs the poststop host hook, if any, once the
+// container exited with status.
+func (e *EngineOperations) runPoststopHostHook(ctx context.Context, status syscall.WaitStatus) error {
+	if hookState == nil || e.EngineConfig.File.PoststopHostHook == "" {
+		return nil
+	}
+
+	exitCode := status.ExitStatus()
+	if status.Signaled() {
+		exitCode = 128 + int(status.Signal())
+	}
+	hookState.ExitCode = &exitCode
+
+	return runHostHook(ctx, "poststop", e.EngineConfig.File.PoststopHostHook, e.EngineConfig.File.HostHookTimeout, hookState)
+}
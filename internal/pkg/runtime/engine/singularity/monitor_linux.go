@@ -42,11 +42,14 @@ func (e *EngineOperations) MonitorContainer(pid int, signals chan os.Signal) (sy
 		s := <-signals
 		switch s {
 		case syscall.SIGCHLD:
-			if wpid, err := syscall.Wait4(pid, &status, syscall.WNOHANG, nil); err != nil {
+			var rusage syscall.Rusage
+			if wpid, err := syscall.Wait4(pid, &status, syscall.WNOHANG, &rusage); err != nil {
 				return status, fmt.Errorf("error while waiting child: %s", err)
 			} else if wpid != pid {
 				continue
 			}
+			// reported by the stop event
+			containerRusage = &rusage
 			return status, nil
 		case syscall.SIGURG:
 			// Ignore SIGURG, which is used for non-cooperative goroutine
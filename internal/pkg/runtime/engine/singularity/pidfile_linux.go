@@ -0,0 +1,69 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// pidFile is the path of the PID file written by writePidFile, it's
+// removed by CleanupContainer.
+var pidFile string
+
+// writePidFile writes the host PID pid of the container process to the
+// file path once the payload is executed. The PID is written to a
+// temporary file renamed to path, so readers never see a partial file.
+// The file is created by the master process with the identity of the
+// invoking user, it's chowned to the user if the master process runs
+// with escalated privileges.
+func writePidFile(path string, pid int) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return fmt.Errorf("could not create pid file: %s", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := fmt.Fprintf(f, "%d\n", pid); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write pid file: %s", err)
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return fmt.Errorf("could not change pid file permissions: %s", err)
+	}
+	if os.Geteuid() == 0 && os.Getuid() != 0 {
+		if err := f.Chown(os.Getuid(), os.Getgid()); err != nil {
+			f.Close()
+			return fmt.Errorf("could not change pid file owner: %s", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("could not write pid file: %s", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("could not create pid file: %s", err)
+	}
+	pidFile = path
+
+	return nil
+}
+
+// removePidFile removes the PID file written by writePidFile if any.
+func removePidFile() {
+	if pidFile == "" {
+		return
+	}
+	sylog.Debugf("Removing pid file %s", pidFile)
+
+	if err := os.Remove(pidFile); err != nil && !os.IsNotExist(err) {
+		sylog.Warningf("Could not remove pid file %s: %s", pidFile, err)
+	}
+}
@@ -17,16 +17,18 @@ import (
 	"strings"
 	"syscall"
 
-	"github.com/containerd/cgroups"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/cgroups"
 	fakerootutil "github.com/sylabs/singularity/internal/pkg/fakeroot"
 	"github.com/sylabs/singularity/internal/pkg/instance"
 	"github.com/sylabs/singularity/internal/pkg/plugin"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engine/config/starter"
 	"github.com/sylabs/singularity/internal/pkg/security"
+	"github.com/sylabs/singularity/internal/pkg/security/landlock"
 	"github.com/sylabs/singularity/internal/pkg/security/seccomp"
 	"github.com/sylabs/singularity/internal/pkg/syecl"
+	"github.com/sylabs/singularity/internal/pkg/util/env"
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
 	"github.com/sylabs/singularity/internal/pkg/util/fs/overlay"
 	"github.com/sylabs/singularity/internal/pkg/util/mainthread"
@@ -40,6 +42,7 @@ import (
 	"github.com/sylabs/singularity/pkg/util/capabilities"
 	"github.com/sylabs/singularity/pkg/util/fs/proc"
 	"github.com/sylabs/singularity/pkg/util/namespaces"
+	"github.com/sylabs/singularity/pkg/util/rlimit"
 	"github.com/sylabs/singularity/pkg/util/singularityconf"
 	"golang.org/x/crypto/openpgp"
 	"golang.org/x/sys/unix"
@@ -105,6 +108,27 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 		}
 	}
 
+	// the engine configuration is provided by the user in the setuid
+	// workflow, the CLI restriction of devices to root is not enough
+	if err := checkDevices(e.EngineConfig.GetDevices(), os.Getuid()); err != nil {
+		return err
+	}
+	// same for the read-write host cgroups hierarchy
+	if e.EngineConfig.GetBindCgroups() && os.Getuid() != 0 {
+		return fmt.Errorf("only root user can bind the host cgroups hierarchy into the container")
+	}
+
+	// the session directory location can be overridden in the
+	// unprivileged workflows only
+	if dir := e.EngineConfig.GetSessionDir(); dir != "" {
+		if starterConfig.GetIsSUID() {
+			sylog.Warningf("SINGULARITY_SESSIONDIR is ignored when running with setuid")
+			e.EngineConfig.SetSessionDir("")
+		} else if !filepath.IsAbs(dir) || !fs.IsDir(dir) {
+			return fmt.Errorf("session directory %s must be an existing absolute path", dir)
+		}
+	}
+
 	// Save the current working directory if not set
 	if e.EngineConfig.GetCwd() == "" {
 		if pwd, err := os.Getwd(); err == nil {
@@ -125,6 +149,14 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 		return fmt.Errorf("container process arguments not found")
 	}
 
+	if e.EngineConfig.File.ContainerLoaderEnv == env.LoaderEnvStrip {
+		var stripped []string
+		e.EngineConfig.OciConfig.Process.Env, stripped = env.StripLoader(e.EngineConfig.OciConfig.Process.Env)
+		for _, key := range stripped {
+			sylog.Verbosef("Stripping %s environment variable, container loader env is set to strip: it %s", key, env.LoaderKeys[key])
+		}
+	}
+
 	uid := e.EngineConfig.GetTargetUID()
 	gids := e.EngineConfig.GetTargetGID()
 
@@ -147,6 +179,13 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 		}
 	}
 
+	// no new privileges makes the kernel ignore setuid bits and file
+	// capabilities of the binaries executed from any mount
+	if security.HasFeature(e.EngineConfig.GetSecurity(), "nofilecaps") {
+		sylog.Debugf("Ignoring setuid bits and file capabilities")
+		e.EngineConfig.OciConfig.SetProcessNoNewPrivileges(true)
+	}
+
 	starterConfig.SetMasterPropagateMount(true)
 	starterConfig.SetNoNewPrivs(e.EngineConfig.OciConfig.Process.NoNewPrivileges)
 
@@ -158,6 +197,10 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 		starterConfig.SetCapabilities(capabilities.Ambient, e.EngineConfig.OciConfig.Process.Capabilities.Ambient)
 	}
 
+	if err := e.prepareRlimits(starterConfig); err != nil {
+		return err
+	}
+
 	// determine if engine need to propagate signals across processes
 	e.checkSignalPropagation()
 
@@ -176,7 +219,9 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 		return err
 	}
 
-	if sendFd || e.EngineConfig.File.ImageDriver != "" {
+	// the socketpair is also used to pass the idmapped mounts created
+	// by the master process to the RPC server
+	if sendFd || e.EngineConfig.File.ImageDriver != "" || hasIDMapBind(e.EngineConfig.GetBindPath()) {
 		fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
 		if err != nil {
 			return fmt.Errorf("failed to create socketpair to pass file descriptor: %s", err)
@@ -298,7 +343,6 @@ func (e *EngineOperations) prepareUserCaps(enforced bool) error {
 // prepareRootCaps is responsible for setting root capabilities
 // based on capability/configuration files and requested capabilities.
 func (e *EngineOperations) prepareRootCaps() error {
-	commonCaps := make([]string, 0)
 	defaultCapabilities := e.EngineConfig.File.RootDefaultCapabilities
 
 	uid := e.EngineConfig.GetTargetUID()
@@ -315,6 +359,18 @@ func (e *EngineOperations) prepareRootCaps() error {
 	} else if e.EngineConfig.GetKeepPrivs() {
 		sylog.Debugf("--keep-privs requested")
 		defaultCapabilities = "full"
+	} else if e.EngineConfig.GetKeepPrivsPrelude() != "" {
+		sylog.Debugf("--keep-privs-prelude requested")
+		defaultCapabilities = "full"
+
+		// the action command runs without privileges once
+		// the prelude command ran, like with --no-privs
+		actionCaps, err := e.rootCaps("no")
+		if err != nil {
+			return err
+		}
+		sylog.Debugf("Action command capabilities %s", strings.Join(actionCaps, ","))
+		e.EngineConfig.SetActionCaps(actionCaps)
 	}
 
 	sylog.Debugf("Root %s capabilities", defaultCapabilities)
@@ -323,24 +379,53 @@ func (e *EngineOperations) prepareRootCaps() error {
 	switch defaultCapabilities {
 	case "full":
 		e.EngineConfig.OciConfig.SetupPrivileged(true)
-		commonCaps = e.EngineConfig.OciConfig.Process.Capabilities.Permitted
+	case "file":
+	default:
+		e.EngineConfig.OciConfig.SetProcessNoNewPrivileges(true)
+	}
+
+	commonCaps, err := e.rootCaps(defaultCapabilities)
+	if err != nil {
+		return err
+	}
+
+	e.EngineConfig.OciConfig.Process.Capabilities.Permitted = commonCaps
+	e.EngineConfig.OciConfig.Process.Capabilities.Effective = commonCaps
+	e.EngineConfig.OciConfig.Process.Capabilities.Inheritable = commonCaps
+	e.EngineConfig.OciConfig.Process.Capabilities.Bounding = commonCaps
+	e.EngineConfig.OciConfig.Process.Capabilities.Ambient = commonCaps
+
+	return nil
+}
+
+// rootCaps returns the root capabilities for the default capabilities
+// defaultCapabilities, as set by the root default capabilities directive,
+// with the requested capabilities added or dropped.
+func (e *EngineOperations) rootCaps(defaultCapabilities string) ([]string, error) {
+	commonCaps := make([]string, 0)
+
+	switch defaultCapabilities {
+	case "full":
+		for c := range capabilities.Map {
+			commonCaps = append(commonCaps, c)
+		}
 	case "file":
 		file, err := os.OpenFile(buildcfg.CAPABILITY_FILE, os.O_RDONLY, 0644)
 		if err != nil {
-			return fmt.Errorf("while opening capability config file: %s", err)
+			return nil, fmt.Errorf("while opening capability config file: %s", err)
 		}
 		defer file.Close()
 
 		capConfig, err := capabilities.ReadFrom(file)
 		if err != nil {
-			return fmt.Errorf("while parsing capability config data: %s", err)
+			return nil, fmt.Errorf("while parsing capability config data: %s", err)
 		}
 
 		commonCaps = append(commonCaps, capConfig.ListUserCaps("root")...)
 
 		groups, err := os.Getgroups()
 		if err != nil {
-			return fmt.Errorf("while getting groups: %s", err)
+			return nil, fmt.Errorf("while getting groups: %s", err)
 		}
 
 		for _, g := range groups {
@@ -353,8 +438,6 @@ func (e *EngineOperations) prepareRootCaps() error {
 			commonCaps = append(commonCaps, caps...)
 			sylog.Debugf("%s group capabilities %s added", gr.Name, strings.Join(caps, ","))
 		}
-	default:
-		e.EngineConfig.OciConfig.SetProcessNoNewPrivileges(true)
 	}
 
 	caps, ignoredCaps := capabilities.Split(e.EngineConfig.GetAddCaps())
@@ -391,13 +474,7 @@ func (e *EngineOperations) prepareRootCaps() error {
 		}
 	}
 
-	e.EngineConfig.OciConfig.Process.Capabilities.Permitted = commonCaps
-	e.EngineConfig.OciConfig.Process.Capabilities.Effective = commonCaps
-	e.EngineConfig.OciConfig.Process.Capabilities.Inheritable = commonCaps
-	e.EngineConfig.OciConfig.Process.Capabilities.Bounding = commonCaps
-	e.EngineConfig.OciConfig.Process.Capabilities.Ambient = commonCaps
-
-	return nil
+	return commonCaps, nil
 }
 
 func keepAutofsMount(source string, autoFsPoints []string) (int, error) {
@@ -420,19 +497,23 @@ func keepAutofsMount(source string, autoFsPoints []string) (int, error) {
 	return -1, fmt.Errorf("no mount point")
 }
 
-func (e *EngineOperations) prepareAutofs(starterConfig *starter.Config) error {
-	const mountInfoPath = "/proc/self/mountinfo"
+// keepAutofsHome triggers the mount of the home source directory if it's
+// automounted and returns a file descriptor keeping it mounted.
+func (e *EngineOperations) keepAutofsHome(autoFsPoints []string) (int, error) {
+	dir := e.EngineConfig.GetHomeSource()
+	triggerAutofs(dir, autoFsPoints)
 
-	entries, err := proc.GetMountInfoEntry(mountInfoPath)
+	fd, err := keepAutofsMount(dir, autoFsPoints)
 	if err != nil {
-		return fmt.Errorf("while parsing %s: %s", mountInfoPath, err)
+		sylog.Debugf("Could not keep file descriptor for home directory %s: %s", dir, err)
 	}
-	autoFsPoints := make([]string, 0)
-	for _, e := range entries {
-		if e.FSType == "autofs" {
-			sylog.Debugf("Found %q as autofs mount point", e.Point)
-			autoFsPoints = append(autoFsPoints, e.Point)
-		}
+	return fd, err
+}
+
+func (e *EngineOperations) prepareAutofs(starterConfig *starter.Config) error {
+	autoFsPoints, err := getAutofsPoints()
+	if err != nil {
+		return err
 	}
 	if len(autoFsPoints) == 0 {
 		sylog.Debugf("No autofs mount point found")
@@ -464,18 +545,9 @@ func (e *EngineOperations) prepareAutofs(starterConfig *starter.Config) error {
 			fds = append(fds, fd)
 		}
 
-		// check home source directory
-		dir := e.EngineConfig.GetHomeSource()
-		fd, err := keepAutofsMount(dir, autoFsPoints)
-		if err != nil {
-			sylog.Debugf("Could not keep file descriptor for home directory %s: %s", dir, err)
-		} else {
-			fds = append(fds, fd)
-		}
-
 		// check the current working directory
-		dir = e.EngineConfig.GetCwd()
-		fd, err = keepAutofsMount(dir, autoFsPoints)
+		dir := e.EngineConfig.GetCwd()
+		fd, err := keepAutofsMount(dir, autoFsPoints)
 		if err != nil {
 			sylog.Debugf("Could not keep file descriptor for current working directory %s: %s", dir, err)
 		} else {
@@ -492,6 +564,14 @@ func (e *EngineOperations) prepareAutofs(starterConfig *starter.Config) error {
 		}
 	}
 
+	// check home source directory, only a custom home is mounted
+	// with --contain
+	if !e.EngineConfig.GetContain() || e.EngineConfig.GetCustomHome() {
+		if fd, err := e.keepAutofsHome(autoFsPoints); err == nil {
+			fds = append(fds, fd)
+		}
+	}
+
 	for _, f := range fds {
 		if err := starterConfig.KeepFileDescriptor(f); err != nil {
 			return err
@@ -532,6 +612,17 @@ func (e *EngineOperations) prepareContainerConfig(starterConfig *starter.Config)
 		}
 	}
 
+	if size := e.EngineConfig.GetShmSize(); size != "" {
+		if err := singularityConfig.CheckShmSize(size); err != nil {
+			return err
+		}
+	}
+	if size := e.EngineConfig.File.ShmSize; size != "" {
+		if err := singularityConfig.CheckShmSize(size); err != nil {
+			return fmt.Errorf("bad 'shm size' value in configuration: %s", err)
+		}
+	}
+
 	if e.EngineConfig.File.MountSlave {
 		starterConfig.SetMountPropagation("rslave")
 	} else {
@@ -555,17 +646,9 @@ func (e *EngineOperations) prepareContainerConfig(starterConfig *starter.Config)
 		uid := uint32(os.Getuid())
 		gid := uint32(os.Getgid())
 
-		getIDRange := fakerootutil.GetIDRange
-
-		callbackType := (fakerootcallback.UserMapping)(nil)
-		callbacks, err := plugin.LoadCallbacks(callbackType)
+		getIDRange, err := idRangeFunc()
 		if err != nil {
-			return fmt.Errorf("while loading plugins callbacks '%T': %s", callbackType, err)
-		}
-		if len(callbacks) > 1 {
-			return fmt.Errorf("multiple plugins have registered hook callback for fakeroot")
-		} else if len(callbacks) == 1 {
-			getIDRange = callbacks[0].(fakerootcallback.UserMapping)
+			return err
 		}
 
 		e.EngineConfig.OciConfig.AddLinuxUIDMapping(uid, 0, 1)
@@ -593,6 +676,10 @@ func (e *EngineOperations) prepareContainerConfig(starterConfig *starter.Config)
 
 		starterConfig.SetTargetUID(0)
 		starterConfig.SetTargetGID([]int{0})
+	} else if os.Getuid() != 0 && e.remapIDs() {
+		if err := e.prepareRemapIDs(starterConfig); err != nil {
+			return err
+		}
 	}
 
 	starterConfig.SetBringLoopbackInterface(true)
@@ -629,22 +716,50 @@ func (e *EngineOperations) prepareContainerConfig(starterConfig *starter.Config)
 			return err
 		}
 	}
+	param = security.GetParam(e.EngineConfig.GetSecurity(), "landlock")
+	if param != "" {
+		if _, err := landlock.ParseRuleset(param); err != nil {
+			return fmt.Errorf("invalid landlock ruleset: %s", err)
+		}
+	}
 
 	// open file descriptors (autofs bug path)
 	return e.prepareAutofs(starterConfig)
 }
 
+// idRangeFunc returns the function determining the subordinate ID range
+// of a user, the one registered by a fakeroot plugin if any.
+func idRangeFunc() (fakerootcallback.UserMapping, error) {
+	callbackType := (fakerootcallback.UserMapping)(nil)
+	callbacks, err := plugin.LoadCallbacks(callbackType)
+	if err != nil {
+		return nil, fmt.Errorf("while loading plugins callbacks '%T': %s", callbackType, err)
+	}
+	if len(callbacks) > 1 {
+		return nil, fmt.Errorf("multiple plugins have registered hook callback for fakeroot")
+	} else if len(callbacks) == 1 {
+		return callbacks[0].(fakerootcallback.UserMapping), nil
+	}
+	return fakerootutil.GetIDRange, nil
+}
+
 // prepareInstanceJoinConfig is responsible for getting and
 // applying configuration to join a running instance.
 func (e *EngineOperations) prepareInstanceJoinConfig(starterConfig *starter.Config) error {
+	uid := os.Getuid()
+	gid := os.Getgid()
+
+	// only root can join the instances of other users
+	username := e.EngineConfig.GetInstanceUser()
+	if username != "" && uid != 0 {
+		return fmt.Errorf("only root user can join instances of other users")
+	}
+
 	name := instance.ExtractName(e.EngineConfig.GetImage())
-	file, err := instance.Get(name, instance.SingSubDir)
+	file, err := instance.GetForUser(name, username, instance.SingSubDir)
 	if err != nil {
 		return err
 	}
-
-	uid := os.Getuid()
-	gid := os.Getgid()
 	suidRequired := uid != 0 && !file.UserNs
 
 	// basic checks:
@@ -852,6 +967,16 @@ func (e *EngineOperations) prepareInstanceJoinConfig(starterConfig *starter.Conf
 	if instanceEngineConfig.GetFakeroot() {
 		starterConfig.SetTargetUID(0)
 		starterConfig.SetTargetGID([]int{0})
+	} else if file.UserNs && uid != 0 {
+		// join with the IDs requested with --security uid/gid
+		// at instance start, if any
+		if targetUID := instanceEngineConfig.GetTargetUID(); targetUID != 0 {
+			starterConfig.SetTargetUID(targetUID)
+		}
+		if targetGID := instanceEngineConfig.GetTargetGID(); len(targetGID) > 0 {
+			starterConfig.SetTargetGID(targetGID)
+			starterConfig.SetAllowSetgroups(true)
+		}
 	}
 
 	// restore HOME environment variable to match the
@@ -891,15 +1016,16 @@ func (e *EngineOperations) prepareInstanceJoinConfig(starterConfig *starter.Conf
 		e.EngineConfig.OciConfig.Linux.Seccomp = instanceEngineConfig.OciConfig.Linux.Seccomp
 	}
 
-	if uid == 0 && !file.UserNs {
+	// the joining process and its children, forked by the starter, are
+	// placed in the cgroups of the instance to be subject to its resources
+	// restriction instead of running in the cgroups of the caller
+	if uid == 0 && !file.UserNs && instanceCgroups(instanceEngineConfig) {
 		pid := os.Getppid()
-		path := fmt.Sprintf("/singularity/%d", file.Pid)
-		control, err := cgroups.Load(cgroups.V1, cgroups.StaticPath(path))
-		if err == nil {
-			if err := control.Add(cgroups.Process{Pid: pid}); err != nil {
-				return fmt.Errorf("while adding process to instance cgroups: %s", err)
-			}
+		manager := &cgroups.Manager{Pid: file.Pid}
+		if err := manager.AddProcess(pid); err != nil {
+			return fmt.Errorf("while adding process to instance cgroups: %s", err)
 		}
+		sylog.Debugf("Added process %d to the cgroups of instance process %d", pid, file.Pid)
 	}
 
 	// only root user can set this value based on instance file
@@ -914,6 +1040,112 @@ func (e *EngineOperations) prepareInstanceJoinConfig(starterConfig *starter.Conf
 	return nil
 }
 
+// prepareRlimits sets the resource limits of the container process from
+// the defaults of singularity.conf and the limits requested with --rlimit.
+func (e *EngineOperations) prepareRlimits(starterConfig *starter.Config) error {
+	defaults, err := rlimit.ParseLimits(e.EngineConfig.File.DefaultRlimit)
+	if err != nil {
+		return fmt.Errorf("bad 'default rlimit' in singularity.conf: %s", err)
+	}
+	ceilings, err := rlimit.ParseLimits(e.EngineConfig.File.MaxRlimit)
+	if err != nil {
+		return fmt.Errorf("bad 'max rlimit' in singularity.conf: %s", err)
+	}
+
+	// raising a hard limit requires CAP_SYS_RESOURCE in the host user
+	// namespace, the container process in a user namespace can't
+	userNs := e.EngineConfig.GetFakeroot()
+	if e.EngineConfig.OciConfig.Linux != nil {
+		for _, ns := range e.EngineConfig.OciConfig.Linux.Namespaces {
+			userNs = userNs || ns.Type == specs.UserNamespace
+		}
+	}
+	raise := (os.Getuid() == 0 || starterConfig.GetIsSUID()) && !userNs
+
+	limits, err := rlimit.Resolve(defaults, ceilings, e.EngineConfig.GetRlimits(), os.Getuid() == 0, raise)
+	if err != nil {
+		return fmt.Errorf("invalid --rlimit value: %s", err)
+	}
+	for _, l := range limits {
+		sylog.Debugf("Setting resource limit %s", l)
+		// the stack size limit is restored from the process rlimits
+		// before executing the container process
+		if l.Resource == "RLIMIT_STACK" {
+			e.EngineConfig.OciConfig.AddProcessRlimits(l.Resource, l.Hard, l.Soft)
+		}
+	}
+	return starterConfig.SetRlimits(limits)
+}
+
+// checkDevices checks that the host devices passed into the container
+// are requested by root, are block or character device nodes and are
+// mounted in /dev.
+func checkDevices(devices []singularityConfig.Device, uid int) error {
+	if len(devices) > 0 && uid != 0 {
+		return fmt.Errorf("only root user can pass host devices into the container")
+	}
+	for _, d := range devices {
+		var st unix.Stat_t
+		if err := unix.Lstat(d.Source, &st); err != nil {
+			return fmt.Errorf("while getting device %s information: %s", d.Source, err)
+		}
+		if mode := st.Mode & unix.S_IFMT; mode != unix.S_IFCHR && mode != unix.S_IFBLK {
+			return fmt.Errorf("%s is not a block or character device", d.Source)
+		}
+		if !filepath.IsAbs(d.Destination) || !strings.HasPrefix(filepath.Clean(d.Destination), "/dev/") {
+			return fmt.Errorf("device destination %s must be in /dev", d.Destination)
+		}
+	}
+	return nil
+}
+
+// deviceCgroupRules returns the device cgroup rules restricting the access
+// to the devices passed in the container.
+func deviceCgroupRules(devices []singularityConfig.Device) ([]specs.LinuxDeviceCgroup, error) {
+	var rules []specs.LinuxDeviceCgroup
+	for _, d := range devices {
+		if !d.ReadOnly {
+			continue
+		}
+		rule, err := cgroups.ReadOnlyDevice(d.Source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to restrict device %s to read-only: %s", d.Source, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// instanceCgroups returns if the instance with the engine configuration
+// config was started with cgroups resources restriction, either from a
+// cgroups file or from device rules denying an access mode.
+func instanceCgroups(config *singularityConfig.EngineConfig) bool {
+	if config.GetCgroupsPath() != "" {
+		return true
+	}
+	rules, err := deviceCgroupRules(config.GetDevices())
+	if err != nil {
+		sylog.Debugf("Could not get the device rules of the instance: %s", err)
+		return false
+	}
+	for _, r := range rules {
+		if !r.Allow && r.Access != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// hasIDMapBind returns if one of the binds requests an idmapped mount.
+func hasIDMapBind(binds []singularityConfig.BindPath) bool {
+	for _, b := range binds {
+		if b.IDMap() {
+			return true
+		}
+	}
+	return false
+}
+
 // openDevFuse is a helper function that opens /dev/fuse once for each
 // plugin that wants to mount a FUSE filesystem.
 func openDevFuse(e *EngineOperations, starterConfig *starter.Config) (bool, error) {
@@ -973,6 +1205,21 @@ func (e *EngineOperations) checkSignalPropagation() {
 	}
 }
 
+// userNamespace returns if the container runs in a user namespace, either
+// requested or implicit, e.g when we run %test in a fakeroot build
+// https://github.com/hpcng/singularity/issues/5315
+func (e *EngineOperations) userNamespace() bool {
+	if userNS, _ := namespaces.IsInsideUserNamespace(os.Getpid()); userNS {
+		return true
+	}
+	for _, ns := range e.EngineConfig.OciConfig.Linux.Namespaces {
+		if ns.Type == specs.UserNamespace {
+			return true
+		}
+	}
+	return false
+}
+
 // setSessionLayer will test if overlay is supported/allowed.
 func (e *EngineOperations) setSessionLayer(img *image.Image) error {
 	e.EngineConfig.SetSessionLayer(singularityConfig.DefaultLayer)
@@ -985,6 +1232,14 @@ func (e *EngineOperations) setSessionLayer(img *image.Image) error {
 	if writableImage && hasOverlayImage {
 		return fmt.Errorf("you could not use --overlay in conjunction with --writable")
 	}
+	if e.EngineConfig.GetReadOnlyRootfs() {
+		if writableImage {
+			return fmt.Errorf("you could not use --read-only in conjunction with --writable")
+		}
+		if writableTmpfs {
+			return fmt.Errorf("you could not use --read-only in conjunction with --writable-tmpfs")
+		}
+	}
 
 	// a SIF image may contain one or more overlay partition
 	// check there is at least one ext3 overlay partition
@@ -1017,22 +1272,9 @@ func (e *EngineOperations) setSessionLayer(img *image.Image) error {
 		return nil
 	}
 
-	// Check for implicit user namespace, e.g when we run %test in a fakeroot build
-	// https://github.com/hpcng/singularity/issues/5315
-	userNS, _ := namespaces.IsInsideUserNamespace(os.Getpid())
-
 	// NEED FIX: on ubuntu until 4.15 kernel it was possible to mount overlay
 	// with the current workflow, since 4.18 we get an operation not permitted
-	if !userNS {
-		for _, ns := range e.EngineConfig.OciConfig.Linux.Namespaces {
-			if ns.Type == specs.UserNamespace {
-				userNS = true
-				break
-			}
-		}
-	}
-
-	if userNS {
+	if e.userNamespace() {
 		if !e.EngineConfig.File.EnableUnderlay {
 			sylog.Debugf("Not attempting to use underlay with user namespace: disabled by configuration ('enable underlay = no')")
 			return nil
@@ -1233,6 +1475,36 @@ func (e *EngineOperations) loadImages(starterConfig *starter.Config) error {
 
 	e.EngineConfig.SetImageList(images)
 
+	return e.loadAppDataImage(starterConfig)
+}
+
+// loadAppDataImage creates the disk image backing the application data
+// directory limited with --scif-data-quota and keeps its file descriptor
+// for the container mount.
+func (e *EngineOperations) loadAppDataImage(starterConfig *starter.Config) error {
+	// the file descriptor is only set here, never from the command line
+	e.EngineConfig.SetScifDataImageFd(0)
+
+	quota := e.appDataQuota()
+	if quota == 0 {
+		return nil
+	}
+	if e.userNamespace() {
+		return fmt.Errorf("--scif-data-quota requires a setuid installation or root without user namespace to mount its disk image")
+	}
+	if !e.EngineConfig.File.AllowContainerExtfs {
+		return fmt.Errorf("--scif-data-quota disk image is an extFS image, disallowed by configuration ('allow container extfs = no')")
+	}
+
+	fd, err := createAppDataImage(os.TempDir(), quota, os.Getuid(), os.Getgid())
+	if err != nil {
+		return fmt.Errorf("while creating application data disk image: %s", err)
+	}
+	if err := starterConfig.KeepFileDescriptor(fd); err != nil {
+		return err
+	}
+	e.EngineConfig.SetScifDataImageFd(fd)
+
 	return nil
 }
 
@@ -1241,7 +1513,9 @@ func (e *EngineOperations) loadOverlayImages(starterConfig *starter.Config, writ
 	images := make([]image.Image, 0)
 
 	for _, overlayImg := range e.EngineConfig.GetOverlayImage() {
-		writableOverlay := true
+		// overlay images are only lower layers of a read-only
+		// root filesystem
+		writableOverlay := !e.EngineConfig.GetReadOnlyRootfs()
 
 		splitted := strings.SplitN(overlayImg, ":", 2)
 		if len(splitted) == 2 {
@@ -1371,7 +1645,7 @@ func (e *EngineOperations) loadImage(path string, writable bool) (*image.Image,
 			if !e.EngineConfig.File.AllowContainerDir {
 				return nil, fmt.Errorf("configuration disallows users from running sandbox based containers")
 			}
-		case image.EXT3:
+		case image.EXT3, image.EXT4:
 			if !e.EngineConfig.File.AllowContainerExtfs {
 				return nil, fmt.Errorf("configuration disallows users from running extFS based containers")
 			}
@@ -0,0 +1,113 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"testing"
+
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engine/singularity/config"
+)
+
+func TestCheckDevices(t *testing.T) {
+	tests := []struct {
+		name    string
+		devices []singularityConfig.Device
+		uid     int
+		wantErr bool
+	}{
+		{
+			name: "NoDevice",
+			uid:  1000,
+		},
+		{
+			name:    "Root",
+			devices: []singularityConfig.Device{{Source: "/dev/null", Destination: "/dev/null"}},
+			uid:     0,
+		},
+		{
+			name:    "User",
+			devices: []singularityConfig.Device{{Source: "/dev/null", Destination: "/dev/null"}},
+			uid:     1000,
+			wantErr: true,
+		},
+		{
+			name:    "NotDevice",
+			devices: []singularityConfig.Device{{Source: "/etc/passwd", Destination: "/dev/passwd"}},
+			uid:     0,
+			wantErr: true,
+		},
+		{
+			name:    "Symlink",
+			devices: []singularityConfig.Device{{Source: "/dev/stdin", Destination: "/dev/stdin"}},
+			uid:     0,
+			wantErr: true,
+		},
+		{
+			name:    "DestinationOutsideDev",
+			devices: []singularityConfig.Device{{Source: "/dev/null", Destination: "/dev/../etc/null"}},
+			uid:     0,
+			wantErr: true,
+		},
+		{
+			name:    "RelativeDestination",
+			devices: []singularityConfig.Device{{Source: "/dev/null", Destination: "dev/null"}},
+			uid:     0,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		err := checkDevices(tt.devices, tt.uid)
+		if tt.wantErr && err == nil {
+			t.Errorf("%s: unexpected success", tt.name)
+		} else if !tt.wantErr && err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+		}
+	}
+}
+
+func TestInstanceCgroups(t *testing.T) {
+	tests := []struct {
+		name    string
+		devices []singularityConfig.Device
+		cgroups string
+		want    bool
+	}{
+		{
+			name: "NoRestriction",
+		},
+		{
+			name:    "CgroupsFile",
+			cgroups: "/etc/singularity/cgroups/cgroups.toml",
+			want:    true,
+		},
+		{
+			name:    "ReadWriteDevice",
+			devices: []singularityConfig.Device{{Source: "/dev/null", Destination: "/dev/null"}},
+		},
+		{
+			name:    "ReadOnlyDevice",
+			devices: []singularityConfig.Device{{Source: "/dev/null", Destination: "/dev/null", ReadOnly: true}},
+			want:    true,
+		},
+		{
+			// no device rule can be created for a missing device
+			name:    "ReadOnlyMissingDevice",
+			devices: []singularityConfig.Device{{Source: "/dev/non-existent-device", Destination: "/dev/null", ReadOnly: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := singularityConfig.NewConfig()
+			config.SetDevices(tt.devices)
+			config.SetCgroupsPath(tt.cgroups)
+			if got := instanceCgroups(config); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
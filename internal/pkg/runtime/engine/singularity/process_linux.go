@@ -34,6 +34,7 @@ import (
 	"github.com/sylabs/singularity/internal/pkg/plugin"
 	"github.com/sylabs/singularity/internal/pkg/security"
 	"github.com/sylabs/singularity/internal/pkg/util/env"
+	utilexec "github.com/sylabs/singularity/internal/pkg/util/exec"
 	"github.com/sylabs/singularity/internal/pkg/util/fs/files"
 	"github.com/sylabs/singularity/internal/pkg/util/machine"
 	"github.com/sylabs/singularity/internal/pkg/util/shell/interpreter"
@@ -41,6 +42,7 @@ import (
 	singularitycallback "github.com/sylabs/singularity/pkg/plugin/callback/runtime/engine/singularity"
 	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engine/singularity/config"
 	"github.com/sylabs/singularity/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/util/capabilities"
 	"github.com/sylabs/singularity/pkg/util/rlimit"
 	"golang.org/x/crypto/ssh/terminal"
 	"golang.org/x/sys/unix"
@@ -49,6 +51,18 @@ import (
 
 const defaultShell = "/bin/sh"
 
+// cwdError returns a descriptive error explaining why the container
+// process can't use cwd as its working directory.
+func cwdError(cwd string, err error) error {
+	switch {
+	case errors.Is(err, syscall.ENOTDIR):
+		return fmt.Errorf("working directory %s (or one of its parents) is not a directory", cwd)
+	case errors.Is(err, syscall.EACCES):
+		return fmt.Errorf("working directory %s is not accessible by user %d", cwd, os.Getuid())
+	}
+	return fmt.Errorf("could not change working directory to %s: %s", cwd, err)
+}
+
 // StartProcess is called during stage2 after RPC server finished
 // environment preparation. This is the container process itself.
 //
@@ -72,12 +86,21 @@ func (e *EngineOperations) StartProcess(masterConn net.Conn) error {
 	shimProcess := false
 
 	if err := os.Chdir(e.EngineConfig.OciConfig.Process.Cwd); err != nil {
+		// a working directory explicitly requested with --cwd which
+		// exists but can't be used is an error, a missing one falls
+		// back to the home directory with a warning
+		if e.EngineConfig.GetCustomCwd() {
+			if !errors.Is(err, syscall.ENOENT) {
+				return cwdError(e.EngineConfig.OciConfig.Process.Cwd, err)
+			}
+			sylog.Warningf("Working directory %s doesn't exist in container, using home directory", e.EngineConfig.OciConfig.Process.Cwd)
+		}
 		if err := os.Chdir(e.EngineConfig.GetHomeDest()); err != nil {
 			os.Chdir("/")
 		}
 	}
 
-	if e.EngineConfig.File.MountDev == "minimal" || e.EngineConfig.GetContain() {
+	if stagedDev(e.EngineConfig) {
 		// If on a terminal, reopen /dev/console so /proc/self/fd/[0-2
 		//   will point to /dev/console.  This is needed so that tty and
 		//   ttyname() on el6 will return the correct answer.  Newer
@@ -140,6 +163,13 @@ func (e *EngineOperations) StartProcess(masterConn net.Conn) error {
 		}
 	}
 
+	// the application data image is only accessible through its mount
+	if fd := e.EngineConfig.GetScifDataImageFd(); fd > 0 {
+		if err := syscall.Close(fd); err != nil {
+			return fmt.Errorf("failed to close application data image file descriptor: %s", err)
+		}
+	}
+
 	// restore the stack size limit for setuid workflow
 	for _, limit := range e.EngineConfig.OciConfig.Process.Rlimits {
 		if limit.Type == "RLIMIT_STACK" {
@@ -150,6 +180,15 @@ func (e *EngineOperations) StartProcess(masterConn net.Conn) error {
 		}
 	}
 
+	// landlock restrictions apply to the current thread, they are
+	// enforced before seccomp filters which could deny its system calls
+	if param := security.GetParam(e.EngineConfig.GetSecurity(), "landlock"); param != "" {
+		runtime.LockOSThread()
+		if err := security.ConfigureLandlock(param); err != nil {
+			return fmt.Errorf("failed to apply landlock ruleset: %s", err)
+		}
+	}
+
 	if err := security.Configure(&e.EngineConfig.OciConfig.Spec); err != nil {
 		return fmt.Errorf("failed to apply security configuration: %s", err)
 	}
@@ -161,7 +200,22 @@ func (e *EngineOperations) StartProcess(masterConn net.Conn) error {
 		_ = syscall.Umask(e.EngineConfig.GetUmask())
 	}
 
-	if (!isInstance && !shimProcess) || bootInstance || e.EngineConfig.GetInstanceJoin() {
+	// Report the security context the container process actually runs with.
+	e.printSecuritySummary()
+
+	// the action command is started and supervised by this process
+	// to enforce its time and output limits, or to attach it to a
+	// pseudo terminal
+	timeout := e.EngineConfig.GetTimeout()
+	maxOutput := e.EngineConfig.GetMaxOutput()
+	supervised := timeout > 0 || maxOutput > 0 || e.EngineConfig.GetAllocatePty()
+
+	direct := !supervised && ((!isInstance && !shimProcess) || e.EngineConfig.GetInstanceJoin())
+	if e.EngineConfig.GetNoFork() && !direct && !bootInstance {
+		return fmt.Errorf("--no-fork requires the container command to be executed without supervising process")
+	}
+
+	if bootInstance || direct {
 		args := e.EngineConfig.OciConfig.Process.Args
 		env := e.EngineConfig.OciConfig.Process.Env
 
@@ -175,6 +229,9 @@ func (e *EngineOperations) StartProcess(masterConn net.Conn) error {
 				// nothing to execute and no error was reported
 				return nil
 			}
+			if err := e.runKeepPrivsPrelude(env); err != nil {
+				return err
+			}
 		}
 
 		return e.execProcess(args, env)
@@ -184,19 +241,65 @@ func (e *EngineOperations) StartProcess(masterConn net.Conn) error {
 	statusChan := make(chan syscall.WaitStatus, 1)
 	cmdPid := -2
 
+	var timeoutChan, killChan <-chan time.Time
+	timedOut, killed := false, false
+	// cancelling the wait context kills the process group of the
+	// container command
+	waitCtx, killGroup := context.WithCancel(context.Background())
+	defer killGroup()
+
+	var ptmx *containerPty
+
 	args, env, err := runActionScript(e.EngineConfig)
 	if err != nil {
 		return err
 	} else if len(args) > 0 {
+		if err := e.runKeepPrivsPrelude(env); err != nil {
+			return err
+		}
+		if e.EngineConfig.GetAllocatePty() {
+			ptmx, err = openPty()
+			if err != nil {
+				sylog.Warningf("Could not allocate a pseudo terminal, using the standard streams: %s", err)
+				ptmx = nil
+			}
+		}
 	cmdexec:
 		// Spawn and wait container process, signal handler
 		cmd := exec.Command(args[0], args[1:]...)
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
+		if maxOutput > 0 {
+			cmd.Stdout = limitOutput(os.Stdout, "standard output", maxOutput)
+			cmd.Stderr = limitOutput(os.Stderr, "standard error", maxOutput)
+		}
 		cmd.Stdin = os.Stdin
 		cmd.Env = env
+		// with a time limit, the command runs in its own process group
+		// so its children are terminated with it, they would otherwise
+		// keep the output pipes open, the group is the foreground one
+		// of the terminal to keep reading from it
 		cmd.SysProcAttr = &syscall.SysProcAttr{
-			Setpgid: isInstance,
+			Setpgid: isInstance || timeout > 0,
+		}
+		if timeout > 0 && !isInstance && terminal.IsTerminal(0) {
+			cmd.SysProcAttr.Foreground = true
+			cmd.SysProcAttr.Ctty = 0
+		}
+		// the pseudo terminal is the controlling terminal of a new
+		// session, both output streams are written to its master side
+		ptyOut := cmd.Stdout
+		if ptmx != nil {
+			cmd.Stdin = ptmx.stdin()
+			cmd.Stdout = ptmx.slave
+			cmd.Stderr = ptmx.slave
+			// the standard output is the slave side even when
+			// the standard input is kept
+			cmd.SysProcAttr = &syscall.SysProcAttr{
+				Setsid:  true,
+				Setctty: true,
+				Ctty:    1,
+			}
 		}
 		if err := cmd.Start(); err != nil {
 			if e, ok := err.(*os.PathError); ok {
@@ -208,9 +311,17 @@ func (e *EngineOperations) StartProcess(masterConn net.Conn) error {
 			return fmt.Errorf("exec %s failed: %s", args[0], err)
 		}
 		cmdPid = cmd.Process.Pid
+		if ptmx != nil {
+			ptmx.start(ptyOut)
+		}
+
+		// the time limit counts from the action command execution
+		if timeout > 0 {
+			timeoutChan = time.After(timeout)
+		}
 
 		go func() {
-			errChan <- cmd.Wait()
+			errChan <- utilexec.WaitProcessGroup(waitCtx, cmd)
 		}()
 	}
 
@@ -261,6 +372,12 @@ func (e *EngineOperations) StartProcess(masterConn net.Conn) error {
 				// https://github.com/golang/go/issues/24543.
 				break
 			default:
+				// the kernel signals the container process when the
+				// pseudo terminal is resized
+				if s == syscall.SIGWINCH && ptmx != nil {
+					ptmx.resize()
+					continue
+				}
 				signal := s.(syscall.Signal)
 				// EPERM and EINVAL are deliberately ignored because they can't be
 				// returned in this context, this process is PID 1, so it has the
@@ -279,6 +396,16 @@ func (e *EngineOperations) StartProcess(masterConn net.Conn) error {
 					}
 				}
 			}
+		case <-timeoutChan:
+			sylog.Warningf("Container timed out after %s, sending SIGTERM", timeout)
+			timedOut = true
+			if err := syscall.Kill(-cmdPid, syscall.SIGTERM); err == nil {
+				killChan = time.After(timeoutGracePeriod)
+			}
+		case <-killChan:
+			sylog.Warningf("Container still running %s after SIGTERM, sending SIGKILL", timeoutGracePeriod)
+			killed = true
+			killGroup()
 		case err := <-errChan:
 			if e, ok := err.(*exec.ExitError); ok {
 				status, ok := e.Sys().(syscall.WaitStatus)
@@ -290,10 +417,23 @@ func (e *EngineOperations) StartProcess(masterConn net.Conn) error {
 				// handle possible race with Wait4 call above by ignoring ECHILD
 				// error because child process was already catched
 				if e.Err.(syscall.Errno) != syscall.ECHILD {
+					if ptmx != nil {
+						ptmx.restore()
+					}
 					sylog.Fatalf("error while waiting container process: %s", e.Error())
 				}
 			}
 			if !isInstance {
+				if ptmx != nil {
+					ptmx.wait()
+				}
+				// like timeout(1), the exit code reports the timeout
+				// unless the command had to be killed
+				if killed {
+					os.Exit(128 + int(syscall.SIGKILL))
+				} else if timedOut {
+					os.Exit(timeoutExitCode)
+				}
 				if len(statusChan) > 0 {
 					status := <-statusChan
 					if status.Signaled() {
@@ -333,6 +473,14 @@ func (e *EngineOperations) PostStartProcess(ctx context.Context, pid int) error
 		}
 	}
 
+	if path := e.EngineConfig.GetPidFile(); path != "" {
+		if err := writePidFile(path, pid); err != nil {
+			return err
+		}
+	}
+
+	e.sendStartEvent(pid)
+
 	if e.EngineConfig.GetInstance() {
 		name := e.CommonConfig.ContainerID
 
@@ -361,12 +509,14 @@ func (e *EngineOperations) PostStartProcess(ctx context.Context, pid int) error
 		file.Image = e.EngineConfig.GetImage()
 		file.LogErrPath = logErrPath
 		file.LogOutPath = logOutPath
+		file.StartOptions = e.EngineConfig.GetStartOptions()
 
-		ip, err := e.getIP()
+		ip, ipv6, err := e.getIP()
 		if err != nil {
 			sylog.Warningf("Could not get ip for %s: %s", pw.Name, err)
 		}
 		file.IP = ip
+		file.IPv6 = ipv6
 
 		// by default we add all namespaces except the user namespace which
 		// is added conditionally. This delegates checks to the C starter code
@@ -547,26 +697,30 @@ func (e *EngineOperations) stopFuseDrivers() {
 	}
 }
 
-func (e *EngineOperations) getIP() (string, error) {
+// getIP returns the IP address of the container on its first network,
+// the IPv4 address for a dual-stack network along with the IPv6 address.
+func (e *EngineOperations) getIP() (ip string, ipv6 string, err error) {
 	if networkSetup == nil {
-		return "", nil
+		return "", "", nil
 	}
 
 	net := strings.Split(e.EngineConfig.GetNetwork(), ",")
 
-	ip, err := networkSetup.GetNetworkIP(net[0], "4")
-	if err == nil {
-		return ip.String(), nil
-	}
-	sylog.Warningf("Could not get ipv4 %s", err)
+	ip4, err4 := networkSetup.GetNetworkIP(net[0], "4")
+	ip6, err6 := networkSetup.GetNetworkIP(net[0], "6")
 
-	ip, err = networkSetup.GetNetworkIP(net[0], "6")
-	if err == nil {
-		return ip.String(), nil
+	switch {
+	case err4 == nil && err6 == nil:
+		return ip4.String(), ip6.String(), nil
+	case err4 == nil:
+		return ip4.String(), "", nil
+	case err6 == nil:
+		return ip6.String(), "", nil
 	}
-	sylog.Warningf("Could not get ipv6 %s", err)
+	sylog.Debugf("Could not get ipv4 %s", err4)
+	sylog.Debugf("Could not get ipv6 %s", err6)
 
-	return "", errors.New("could not get ip")
+	return "", "", errors.New("could not get ip")
 }
 
 func getExecError(err error, args []string, shell string) error {
@@ -591,6 +745,45 @@ func getExecError(err error, args []string, shell string) error {
 	return fmt.Errorf("exec %s failed: %s", args[0], err)
 }
 
+// runKeepPrivsPrelude runs the keep-privs prelude command, if any, with
+// the root user privileges kept, then drops them for the action command.
+// Capabilities are per thread, the current goroutine is locked to its
+// thread so the action command is started by the same thread.
+func (e *EngineOperations) runKeepPrivsPrelude(procEnv []string) error {
+	prelude := e.EngineConfig.GetKeepPrivsPrelude()
+	if prelude == "" {
+		return nil
+	}
+
+	cmd := exec.Command(defaultShell, "-c", prelude)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = os.Stdin
+	// the prelude runs with privileges, it never gets the loader variables
+	cmd.Env, _ = env.StripLoader(procEnv)
+
+	sylog.Debugf("Running keep-privs prelude command %q", prelude)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("keep-privs prelude command failed: %s", err)
+	}
+
+	var caps uint64
+	for _, c := range e.EngineConfig.GetActionCaps() {
+		if cap, ok := capabilities.Map[c]; ok {
+			caps |= uint64(1 << cap.Value)
+		}
+	}
+
+	runtime.LockOSThread()
+	if err := capabilities.SetProcessCapabilities(caps); err != nil {
+		return fmt.Errorf("while dropping privileges after keep-privs prelude: %s", err)
+	}
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("while setting no new privileges after keep-privs prelude: %s", err)
+	}
+	return nil
+}
+
 func (e *EngineOperations) execProcess(args, env []string) error {
 	err := syscall.Exec(args[0], args, env)
 	if err == nil {
@@ -603,6 +796,54 @@ func (e *EngineOperations) execProcess(args, env []string) error {
 	return getExecError(err, args, e.EngineConfig.GetShell())
 }
 
+// timeoutExitCode is the exit code of a container terminated once its
+// time limit is reached, the same as timeout(1).
+const timeoutExitCode = 124
+
+// timeoutGracePeriod is the time given to a container to exit after the
+// SIGTERM sent once its time limit is reached, before it's killed.
+const timeoutGracePeriod = 10 * time.Second
+
+// outputLimiter writes up to max bytes to a file, the rest of the output
+// is discarded and its truncation is reported once.
+type outputLimiter struct {
+	f         *os.File
+	name      string
+	max       int
+	written   int
+	truncated bool
+}
+
+// limitOutput returns a writer truncating the output written to f, named
+// name in the truncation notice, after max bytes. Terminal output isn't
+// truncated.
+func limitOutput(f *os.File, name string, max int) io.Writer {
+	if terminal.IsTerminal(int(f.Fd())) {
+		return f
+	}
+	return &outputLimiter{f: f, name: name, max: max}
+}
+
+// Write writes p up to the output limit, the remaining bytes are discarded
+// but reported as written so the command output is drained.
+func (l *outputLimiter) Write(p []byte) (int, error) {
+	n := len(p)
+	if left := l.max - l.written; n > left {
+		p = p[:left]
+	}
+	if len(p) > 0 {
+		if _, err := l.f.Write(p); err != nil {
+			return 0, err
+		}
+		l.written += len(p)
+	}
+	if len(p) < n && !l.truncated {
+		l.truncated = true
+		sylog.Warningf("Container %s truncated after %d bytes", l.name, l.max)
+	}
+	return n, nil
+}
+
 // bufferCloser wraps a bytes.Buffer with a Close method
 // required by the open handler of the shell interpreter.
 type bufferCloser struct {
@@ -759,6 +1000,18 @@ func fixPathBuiltin(ctx context.Context, argv []string) error {
 	return nil
 }
 
+// sanitizedPathBuiltin returns the default PATH on shell interpreter output
+// when the PATH of the container process is sanitized, nothing otherwise.
+func sanitizedPathBuiltin(sanitize bool) interpreter.ShellBuiltin {
+	return func(ctx context.Context, argv []string) error {
+		if sanitize {
+			hc := interp.HandlerCtx(ctx)
+			fmt.Fprintf(hc.Stdout, "%s\n", env.DefaultPath)
+		}
+		return nil
+	}
+}
+
 // hashBuiltin is a noop function for hash bash builtin, since we don't
 // store resolved path in a hash table, there is nothing to do.
 func hashBuiltin(ctx context.Context, argv []string) error {
@@ -818,6 +1071,7 @@ func runActionScript(engineConfig *singularityConfig.EngineConfig) ([]string, []
 	shell.RegisterShellBuiltin("getenvkey", getEnvKeyBuiltin)
 	shell.RegisterShellBuiltin("sylog", sylogBuiltin)
 	shell.RegisterShellBuiltin("fixpath", fixPathBuiltin)
+	shell.RegisterShellBuiltin("sanitizedpath", sanitizedPathBuiltin(engineConfig.GetSanitizePath()))
 	shell.RegisterShellBuiltin("hash", hashBuiltin)
 	shell.RegisterShellBuiltin("unescape", unescapeBuiltin)
 	shell.RegisterShellBuiltin("umask_builtin", umaskBuiltin)
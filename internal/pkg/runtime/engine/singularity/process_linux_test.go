@@ -0,0 +1,75 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestLimitOutput(t *testing.T) {
+	tests := []struct {
+		name      string
+		writes    []string
+		max       int
+		want      string
+		truncated bool
+	}{
+		{
+			name:   "UnderLimit",
+			writes: []string{"hello", " world"},
+			max:    32,
+			want:   "hello world",
+		},
+		{
+			name:   "AtLimit",
+			writes: []string{"hello", " world"},
+			max:    11,
+			want:   "hello world",
+		},
+		{
+			name:      "OverLimit",
+			writes:    []string{"hello", " world", "!"},
+			max:       8,
+			want:      "hello wo",
+			truncated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ioutil.TempFile("", "output-")
+			if err != nil {
+				t.Fatalf("failed to create temporary file: %s", err)
+			}
+			defer os.Remove(f.Name())
+			defer f.Close()
+
+			w := limitOutput(f, "test output", tt.max)
+			l, ok := w.(*outputLimiter)
+			if !ok {
+				t.Fatalf("output to a regular file is not limited")
+			}
+			for _, s := range tt.writes {
+				if n, err := w.Write([]byte(s)); err != nil || n != len(s) {
+					t.Fatalf("got %d, %v while writing %q", n, err, s)
+				}
+			}
+
+			b, err := ioutil.ReadFile(f.Name())
+			if err != nil {
+				t.Fatalf("failed to read output: %s", err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("got output %q, expected %q", b, tt.want)
+			}
+			if l.truncated != tt.truncated {
+				t.Errorf("got truncated %v, expected %v", l.truncated, tt.truncated)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/kr/pty"
+	"github.com/sylabs/singularity/pkg/sylog"
+	"golang.org/x/crypto/ssh/terminal"
+	"golang.org/x/sys/unix"
+)
+
+// ptyDrainTimeout is how long the output of the pseudo terminal is read
+// once the container process exited, background processes may keep it
+// open forever.
+const ptyDrainTimeout = 500 * time.Millisecond
+
+// containerPty is the pseudo terminal the container process is attached
+// to, its input and output are copied from and to the standard streams.
+type containerPty struct {
+	master *os.File
+	slave  *os.File
+	state  *terminal.State
+	done   chan struct{}
+	// pipeInput is set when the standard input isn't a terminal, the
+	// container process reads it directly rather than through the line
+	// discipline of the pseudo terminal, which would interpret control
+	// characters of binary data and hold the end of file
+	pipeInput bool
+}
+
+// openPty allocates a pseudo terminal with the size of the terminal of the
+// standard streams. Output written to a pipe or a file keeps its line
+// endings.
+func openPty() (*containerPty, error) {
+	master, slave, err := pty.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	if !terminal.IsTerminal(int(os.Stdout.Fd())) {
+		termios, err := unix.IoctlGetTermios(int(slave.Fd()), unix.TCGETS)
+		if err != nil {
+			master.Close()
+			slave.Close()
+			return nil, err
+		}
+		termios.Oflag &^= unix.ONLCR
+		if err := unix.IoctlSetTermios(int(slave.Fd()), unix.TCSETS, termios); err != nil {
+			master.Close()
+			slave.Close()
+			return nil, err
+		}
+	}
+
+	p := &containerPty{
+		master:    master,
+		slave:     slave,
+		done:      make(chan struct{}),
+		pipeInput: !terminal.IsTerminal(int(os.Stdin.Fd())),
+	}
+	p.resize()
+	return p, nil
+}
+
+// stdin returns the standard input of the container process: the pseudo
+// terminal, or the standard input itself if it isn't a terminal.
+func (p *containerPty) stdin() *os.File {
+	if p.pipeInput {
+		return os.Stdin
+	}
+	return p.slave
+}
+
+// resize sets the size of the pseudo terminal to the size of the terminal
+// of the standard input or output.
+func (p *containerPty) resize() {
+	for _, f := range []*os.File{os.Stdin, os.Stdout} {
+		if !terminal.IsTerminal(int(f.Fd())) {
+			continue
+		}
+		size, err := pty.GetsizeFull(f)
+		if err != nil {
+			continue
+		}
+		if err := pty.Setsize(p.master, size); err != nil {
+			sylog.Debugf("Could not resize pseudo terminal: %s", err)
+		}
+		return
+	}
+}
+
+// start copies the standard input to the pseudo terminal and its output
+// to out, it's called once the container process holds the slave side.
+func (p *containerPty) start(out io.Writer) {
+	if terminal.IsTerminal(0) {
+		state, err := terminal.MakeRaw(0)
+		if err != nil {
+			sylog.Warningf("Could not set terminal in raw mode: %s", err)
+		}
+		p.state = state
+	}
+	p.slave.Close()
+
+	if !p.pipeInput {
+		go io.Copy(p.master, os.Stdin)
+	}
+	go func() {
+		io.Copy(out, p.master)
+		close(p.done)
+	}()
+}
+
+// wait waits for the output of the pseudo terminal to be copied, for at
+// most ptyDrainTimeout, and restores the terminal of the standard input.
+func (p *containerPty) wait() {
+	select {
+	case <-p.done:
+	case <-time.After(ptyDrainTimeout):
+	}
+	p.restore()
+}
+
+// restore restores the terminal of the standard input.
+func (p *containerPty) restore() {
+	if p.state != nil {
+		terminal.Restore(0, p.state)
+		p.state = nil
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestOpenPtyPipeInput(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	out, err := ioutil.TempFile("", "pty-out-")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	stdin, stdout := os.Stdin, os.Stdout
+	defer func() {
+		os.Stdin, os.Stdout = stdin, stdout
+	}()
+	os.Stdin, os.Stdout = r, out
+
+	p, err := openPty()
+	if err != nil {
+		t.Skipf("could not allocate a pseudo terminal: %s", err)
+	}
+	defer p.master.Close()
+	defer p.slave.Close()
+
+	// binary data read from a pipe bypasses the line discipline
+	if p.stdin() != r {
+		t.Errorf("the standard input pipe is not kept")
+	}
+
+	termios, err := unix.IoctlGetTermios(int(p.slave.Fd()), unix.TCGETS)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if termios.Oflag&unix.ONLCR != 0 {
+		t.Errorf("newlines are translated for an output written to a file")
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"os"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	fakerootutil "github.com/sylabs/singularity/internal/pkg/fakeroot"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engine/config/starter"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// remapIDs returns if a user requested to run the container process with
+// other IDs with --security uid/gid.
+func (e *EngineOperations) remapIDs() bool {
+	return e.EngineConfig.GetTargetUID() != 0 || len(e.EngineConfig.GetTargetGID()) > 0
+}
+
+// prepareRemapIDs sets the user namespace mappings allowing the container
+// process of a user to run with the UID/GIDs requested with --security
+// uid/gid. Each requested ID is mapped to the same host ID and must be
+// part of the subordinate ID ranges of the user. Like with fakeroot, the
+// mappings are set up by the privileged master process or by the
+// newuidmap/newgidmap commands.
+func (e *EngineOperations) prepareRemapIDs(starterConfig *starter.Config) error {
+	if !starterConfig.GetIsSUID() {
+		sylog.Debugf("Search for newuidmap binary")
+		if err := starterConfig.SetNewUIDMapPath(); err != nil {
+			return err
+		}
+		sylog.Debugf("Search for newgidmap binary")
+		if err := starterConfig.SetNewGIDMapPath(); err != nil {
+			return err
+		}
+	}
+
+	getIDRange, err := idRangeFunc()
+	if err != nil {
+		return err
+	}
+
+	uid := uint32(os.Getuid())
+	gid := uint32(os.Getgid())
+
+	targetUID := e.EngineConfig.GetTargetUID()
+	targetGID := e.EngineConfig.GetTargetGID()
+
+	// the user is mapped to root, so the starter is allowed to switch
+	// to the target UID, unless only GIDs are requested
+	userMapping := specs.LinuxIDMapping{HostID: uid, ContainerID: uid, Size: 1}
+	var uids []uint32
+	if targetUID != 0 {
+		userMapping.ContainerID = 0
+		uids = append(uids, uint32(targetUID))
+	}
+	var gids []uint32
+	for _, g := range targetGID {
+		gids = append(gids, uint32(g))
+	}
+
+	idRange, err := getIDRange(fakerootutil.SubUIDFile, uid)
+	if err != nil {
+		return fmt.Errorf("could not use --security uid: %s", err)
+	}
+	uidMappings, err := remapIDMappings(userMapping, uids, idRange)
+	if err != nil {
+		return fmt.Errorf("could not use --security uid: %s", err)
+	}
+
+	idRange, err = getIDRange(fakerootutil.SubGIDFile, uid)
+	if err != nil {
+		return fmt.Errorf("could not use --security gid: %s", err)
+	}
+	groupMapping := specs.LinuxIDMapping{HostID: gid, ContainerID: gid, Size: 1}
+	gidMappings, err := remapIDMappings(groupMapping, gids, idRange)
+	if err != nil {
+		return fmt.Errorf("could not use --security gid: %s", err)
+	}
+
+	e.EngineConfig.OciConfig.AddOrReplaceLinuxNamespace(specs.UserNamespace, "")
+	e.EngineConfig.OciConfig.Linux.UIDMappings = uidMappings
+	e.EngineConfig.OciConfig.Linux.GIDMappings = gidMappings
+	e.EngineConfig.OciConfig.SetProcessNoNewPrivileges(true)
+
+	starterConfig.SetHybridWorkflow(true)
+	starterConfig.SetAllowSetgroups(true)
+
+	starterConfig.SetTargetUID(targetUID)
+	starterConfig.SetTargetGID(targetGID)
+
+	return nil
+}
+
+// remapIDMappings returns the ID mappings of a user namespace where the
+// user ID is mapped as described by userMapping and each ID of ids is
+// mapped to the same host ID. The IDs must be in the subordinate ID
+// range idRange of the user, except the user ID when it's mapped to
+// itself.
+func remapIDMappings(userMapping specs.LinuxIDMapping, ids []uint32, idRange *specs.LinuxIDMapping) ([]specs.LinuxIDMapping, error) {
+	mappings := []specs.LinuxIDMapping{userMapping}
+
+	for _, id := range ids {
+		mapped := false
+		for _, m := range mappings {
+			if m.HostID == id && m.ContainerID == id {
+				mapped = true
+				break
+			} else if m.HostID == id || m.ContainerID == id {
+				return nil, fmt.Errorf("ID %d conflicts with the mapping of your own ID %d", id, userMapping.HostID)
+			}
+		}
+		if mapped {
+			continue
+		}
+		if id < idRange.HostID || id-idRange.HostID >= idRange.Size {
+			return nil, fmt.Errorf(
+				"ID %d is not in your subordinate ID range %d-%d",
+				id, idRange.HostID, idRange.HostID+idRange.Size-1,
+			)
+		}
+		mappings = append(mappings, specs.LinuxIDMapping{HostID: id, ContainerID: id, Size: 1})
+	}
+
+	return mappings, nil
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"reflect"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestRemapIDMappings(t *testing.T) {
+	idRange := &specs.LinuxIDMapping{HostID: 100000, ContainerID: 1, Size: 65536}
+
+	tests := []struct {
+		name        string
+		userMapping specs.LinuxIDMapping
+		ids         []uint32
+		want        []specs.LinuxIDMapping
+		wantErr     bool
+	}{
+		{
+			name:        "UserToRoot",
+			userMapping: specs.LinuxIDMapping{HostID: 1000, ContainerID: 0, Size: 1},
+			ids:         []uint32{101001},
+			want: []specs.LinuxIDMapping{
+				{HostID: 1000, ContainerID: 0, Size: 1},
+				{HostID: 101001, ContainerID: 101001, Size: 1},
+			},
+		},
+		{
+			name:        "OwnID",
+			userMapping: specs.LinuxIDMapping{HostID: 1000, ContainerID: 1000, Size: 1},
+			ids:         []uint32{1000, 100000, 165535, 100000},
+			want: []specs.LinuxIDMapping{
+				{HostID: 1000, ContainerID: 1000, Size: 1},
+				{HostID: 100000, ContainerID: 100000, Size: 1},
+				{HostID: 165535, ContainerID: 165535, Size: 1},
+			},
+		},
+		{
+			name:        "OwnIDMappedToRoot",
+			userMapping: specs.LinuxIDMapping{HostID: 1000, ContainerID: 0, Size: 1},
+			ids:         []uint32{1000},
+			wantErr:     true,
+		},
+		{
+			name:        "BelowRange",
+			userMapping: specs.LinuxIDMapping{HostID: 1000, ContainerID: 1000, Size: 1},
+			ids:         []uint32{99999},
+			wantErr:     true,
+		},
+		{
+			name:        "AboveRange",
+			userMapping: specs.LinuxIDMapping{HostID: 1000, ContainerID: 1000, Size: 1},
+			ids:         []uint32{165536},
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := remapIDMappings(tt.userMapping, tt.ids, idRange)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("unexpected success with mappings %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got mappings %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
 	"github.com/sylabs/singularity/pkg/util/loop"
 )
 
@@ -18,6 +19,13 @@ import (
 type MkdirArgs struct {
 	Path string
 	Perm os.FileMode
+	// Root, if set, is the directory Path is created under, the parent
+	// directories of Path are resolved strictly under it.
+	Root string
+	// UID and GID are the owner of the created directory with Root,
+	// -1 leaves the owner unchanged.
+	UID int
+	GID int
 }
 
 // LoopArgs defines the arguments to create a loop device.
@@ -36,6 +44,13 @@ type MountArgs struct {
 	Filesystem string
 	Mountflags uintptr
 	Data       string
+	// Root, if set, is the directory Target must be located under,
+	// Target is then resolved without following symbolic links.
+	Root string
+	// IDMap requests to attach to Target the detached idmapped mount
+	// received over the unix socket Socket instead of mounting Source.
+	IDMap  bool
+	Socket int
 }
 
 // CryptArgs defines the arguments to mount.
@@ -88,6 +103,13 @@ type OpenSendFuseFdArgs struct {
 type SymlinkArgs struct {
 	Old string
 	New string
+	// Root, if set, is the directory New is created under, the parent
+	// directories of New are resolved strictly under it.
+	Root string
+	// UID and GID are the owner of the created link with Root, -1
+	// leaves the owner unchanged.
+	UID int
+	GID int
 }
 
 // ReadDirArgs defines the arguments to readdir.
@@ -128,6 +150,13 @@ type WriteFileArgs struct {
 	Filename string
 	Data     []byte
 	Perm     os.FileMode
+	// Root, if set, is the directory Filename is created under, the
+	// parent directories of Filename are resolved strictly under it.
+	Root string
+	// UID and GID are the owner of the created file with Root, -1
+	// leaves the owner unchanged.
+	UID int
+	GID int
 }
 
 // FileInfo returns FileInfo interface to be passed as RPC argument.
@@ -184,4 +213,5 @@ func init() {
 	gob.Register((*os.PathError)(nil))
 	gob.Register((*os.SyscallError)(nil))
 	gob.Register((*os.LinkError)(nil))
+	gob.Register((*fs.SymlinkEscapeError)(nil))
 }
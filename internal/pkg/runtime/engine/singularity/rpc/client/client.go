@@ -40,6 +40,52 @@ func (t *RPC) Mount(source string, target string, filesystem string, flags uintp
 	return err
 }
 
+// MountInRoot calls the mount RPC using the supplied arguments, the mount
+// fails if target isn't located under root, or if one of its components is
+// a symbolic link.
+func (t *RPC) MountInRoot(root string, source string, target string, filesystem string, flags uintptr, data string) error {
+	arguments := &args.MountArgs{
+		Source:     source,
+		Target:     target,
+		Filesystem: filesystem,
+		Mountflags: flags,
+		Data:       data,
+		Root:       root,
+	}
+
+	var mountErr error
+
+	err := t.Client.Call(t.Name+".Mount", arguments, &mountErr)
+	// RPC communication will take precedence over mount error
+	if err == nil {
+		err = mountErr
+	}
+
+	return err
+}
+
+// MountIDMapped calls the mount RPC to attach to target the detached
+// idmapped mount previously sent over the unix socket, target is resolved
+// under root like with MountInRoot when root is set.
+func (t *RPC) MountIDMapped(root string, target string, socket int) error {
+	arguments := &args.MountArgs{
+		Target: target,
+		Root:   root,
+		IDMap:  true,
+		Socket: socket,
+	}
+
+	var mountErr error
+
+	err := t.Client.Call(t.Name+".Mount", arguments, &mountErr)
+	// RPC communication will take precedence over mount error
+	if err == nil {
+		err = mountErr
+	}
+
+	return err
+}
+
 // Decrypt calls the DeCrypt RPC using the supplied arguments.
 func (t *RPC) Decrypt(offset uint64, path string, key []byte, masterPid int) (string, error) {
 	arguments := &args.CryptArgs{
@@ -64,6 +110,19 @@ func (t *RPC) Mkdir(path string, perm os.FileMode) error {
 	return t.Client.Call(t.Name+".Mkdir", arguments, nil)
 }
 
+// MkdirInRoot calls the mkdir RPC using the supplied arguments, the parent
+// directories of path are resolved strictly under root.
+func (t *RPC) MkdirInRoot(root string, path string, perm os.FileMode, uid, gid int) error {
+	arguments := &args.MkdirArgs{
+		Path: path,
+		Perm: perm,
+		Root: root,
+		UID:  uid,
+		GID:  gid,
+	}
+	return t.callCreate("MkdirInRoot", arguments)
+}
+
 // Chroot calls the chroot RPC using the supplied arguments.
 func (t *RPC) Chroot(root string, method string) (int, error) {
 	arguments := &args.ChrootArgs{
@@ -165,6 +224,19 @@ func (t *RPC) Symlink(old string, new string) error {
 	return t.Client.Call(t.Name+".Symlink", arguments, nil)
 }
 
+// SymlinkInRoot calls the symlink RPC using the supplied arguments, the
+// parent directories of new are resolved strictly under root.
+func (t *RPC) SymlinkInRoot(root string, old string, new string, uid, gid int) error {
+	arguments := &args.SymlinkArgs{
+		Old:  old,
+		New:  new,
+		Root: root,
+		UID:  uid,
+		GID:  gid,
+	}
+	return t.callCreate("SymlinkInRoot", arguments)
+}
+
 // ReadDir calls the readdir RPC using the supplied arguments.
 func (t *RPC) ReadDir(dir string) ([]os.FileInfo, error) {
 	arguments := &args.ReadDirArgs{
@@ -235,3 +307,31 @@ func (t *RPC) WriteFile(filename string, data []byte, perm os.FileMode) error {
 	}
 	return t.Client.Call(t.Name+".WriteFile", arguments, nil)
 }
+
+// WriteFileInRoot calls the writefile RPC using the supplied arguments, the
+// parent directories of filename are resolved strictly under root.
+func (t *RPC) WriteFileInRoot(root string, filename string, data []byte, perm os.FileMode, uid, gid int) error {
+	arguments := &args.WriteFileArgs{
+		Filename: filename,
+		Data:     data,
+		Perm:     perm,
+		Root:     root,
+		UID:      uid,
+		GID:      gid,
+	}
+	return t.callCreate("WriteFileInRoot", arguments)
+}
+
+// callCreate calls the file creation RPC method with the supplied
+// arguments, the creation error is returned with its original type.
+func (t *RPC) callCreate(method string, arguments interface{}) error {
+	var createErr error
+
+	err := t.Client.Call(t.Name+"."+method, arguments, &createErr)
+	// RPC communication will take precedence over creation error
+	if err == nil {
+		err = createErr
+	}
+
+	return err
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
@@ -16,6 +17,7 @@ import (
 
 	args "github.com/sylabs/singularity/internal/pkg/runtime/engine/singularity/rpc"
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/internal/pkg/util/fs/mount"
 	"github.com/sylabs/singularity/internal/pkg/util/mainthread"
 	"github.com/sylabs/singularity/internal/pkg/util/user"
 	"github.com/sylabs/singularity/pkg/sylog"
@@ -62,7 +64,37 @@ func (t *Methods) Mount(arguments *args.MountArgs, mountErr *error) (err error)
 				_, err = capabilities.SetProcessEffective(oldEffective)
 			}()
 		}
-		*mountErr = syscall.Mount(arguments.Source, arguments.Target, arguments.Filesystem, arguments.Mountflags, arguments.Data)
+		target := arguments.Target
+		if arguments.Root != "" {
+			// mount through a file descriptor opened without following
+			// symbolic links, so target can't be swapped for a symbolic
+			// link pointing outside of root before the mount
+			rel, relErr := filepath.Rel(arguments.Root, target)
+			if relErr != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+				*mountErr = &os.PathError{Op: "mount", Path: target, Err: syscall.EINVAL}
+				return
+			}
+			f, openErr := fs.OpenInRoot(arguments.Root, rel)
+			if openErr != nil {
+				*mountErr = openErr
+				return
+			}
+			defer f.Close()
+			target = fmt.Sprintf("/proc/self/fd/%d", f.Fd())
+		}
+		if arguments.IDMap {
+			// the idmapped mount was created by the master process
+			// in the host user namespace
+			fd, recvErr := recvMountFd(arguments.Socket)
+			if recvErr != nil {
+				*mountErr = recvErr
+				return
+			}
+			defer unix.Close(fd)
+			*mountErr = mount.MoveMount(fd, target)
+			return
+		}
+		*mountErr = syscall.Mount(arguments.Source, target, arguments.Filesystem, arguments.Mountflags, arguments.Data)
 	})
 	return
 }
@@ -143,6 +175,18 @@ func (t *Methods) Mkdir(arguments *args.MkdirArgs, reply *int) (err error) {
 	return err
 }
 
+// MkdirInRoot performs a mkdir with the specified arguments, the parent
+// directories of the path are resolved strictly under the root directory.
+// The error is returned with createErr to preserve its type.
+func (t *Methods) MkdirInRoot(arguments *args.MkdirArgs, createErr *error) error {
+	mainthread.Execute(func() {
+		oldmask := syscall.Umask(0)
+		*createErr = fs.MkdirInRoot(arguments.Root, arguments.Path, arguments.Perm, arguments.UID, arguments.GID)
+		syscall.Umask(oldmask)
+	})
+	return nil
+}
+
 // Chroot performs a chroot with the specified arguments.
 func (t *Methods) Chroot(arguments *args.ChrootArgs, reply *int) (err error) {
 	root := arguments.Root
@@ -327,6 +371,30 @@ func (t *Methods) Lstat(arguments *args.StatArgs, reply *args.StatReply) error {
 	return nil
 }
 
+// recvMountFd receives the file descriptor of a detached mount over the
+// unix socket.
+func recvMountFd(socket int) (int, error) {
+	buf := make([]byte, unix.CmsgSpace(4))
+	if _, _, _, _, err := unix.Recvmsg(socket, nil, buf, 0); err != nil {
+		return -1, fmt.Errorf("while receiving mount file descriptor: %s", err)
+	}
+	msgs, err := unix.ParseSocketControlMessage(buf)
+	if err != nil {
+		return -1, fmt.Errorf("while parsing socket control message: %s", err)
+	}
+	for _, msg := range msgs {
+		fds, err := unix.ParseUnixRights(&msg)
+		if err != nil {
+			return -1, fmt.Errorf("while getting file descriptor: %s", err)
+		}
+		for _, fd := range fds[1:] {
+			unix.Close(fd)
+		}
+		return fds[0], nil
+	}
+	return -1, fmt.Errorf("no mount file descriptor received")
+}
+
 // SendFuseFd send fuse file descriptor over unix socket.
 func (t *Methods) SendFuseFd(arguments *args.SendFuseFdArgs, reply *int) error {
 	usernsFd, err := unix.Open("/proc/self/ns/user", unix.O_RDONLY|unix.O_CLOEXEC, 0)
@@ -357,6 +425,14 @@ func (t *Methods) Symlink(arguments *args.SymlinkArgs, reply *int) error {
 	return os.Symlink(arguments.Old, arguments.New)
 }
 
+// SymlinkInRoot performs a symlink with the specified arguments, the parent
+// directories of the link are resolved strictly under the root directory.
+// The error is returned with createErr to preserve its type.
+func (t *Methods) SymlinkInRoot(arguments *args.SymlinkArgs, createErr *error) error {
+	*createErr = fs.SymlinkInRoot(arguments.Root, arguments.Old, arguments.New, arguments.UID, arguments.GID)
+	return nil
+}
+
 // ReadDir performs a readdir with the specified arguments.
 func (t *Methods) ReadDir(arguments *args.ReadDirArgs, reply *args.ReadDirReply) error {
 	files, err := ioutil.ReadDir(arguments.Dir)
@@ -412,3 +488,11 @@ func (t *Methods) WriteFile(arguments *args.WriteFileArgs, reply *int) error {
 	}
 	return err
 }
+
+// WriteFileInRoot creates a file with the specified arguments, the parent
+// directories of the file are resolved strictly under the root directory.
+// The error is returned with createErr to preserve its type.
+func (t *Methods) WriteFileInRoot(arguments *args.WriteFileArgs, createErr *error) error {
+	*createErr = fs.WriteFileInRoot(arguments.Root, arguments.Filename, arguments.Data, arguments.Perm, arguments.UID, arguments.GID)
+	return nil
+}
@@ -0,0 +1,258 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sylabs/singularity/internal/pkg/security"
+	"github.com/sylabs/singularity/internal/pkg/security/landlock"
+	"github.com/sylabs/singularity/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/util/capabilities"
+	"github.com/sylabs/singularity/pkg/util/rlimit"
+	"golang.org/x/sys/unix"
+)
+
+// procSelf is the proc directory of the container process, the security
+// context summary is read from it.
+var procSelf = "/proc/self"
+
+// summaryNamespaces lists the namespaces reported in the security context
+// summary, with their name in /proc/self/ns.
+var summaryNamespaces = []struct {
+	nstype specs.LinuxNamespaceType
+	name   string
+}{
+	{specs.UserNamespace, "user"},
+	{specs.MountNamespace, "mnt"},
+	{specs.PIDNamespace, "pid"},
+	{specs.NetworkNamespace, "net"},
+	{specs.IPCNamespace, "ipc"},
+	{specs.UTSNamespace, "uts"},
+	{specs.CgroupNamespace, "cgroup"},
+}
+
+// readProcStatus returns the fields of the status file of the container
+// process.
+func readProcStatus() (map[string]string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(procSelf, "status"))
+	if err != nil {
+		return nil, err
+	}
+
+	status := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 2)
+		if len(fields) == 2 {
+			status[fields[0]] = strings.TrimSpace(fields[1])
+		}
+	}
+	return status, scanner.Err()
+}
+
+// capabilityNames returns the names of the capabilities set in the
+// hexadecimal mask, or all when the mask holds all known capabilities.
+func capabilityNames(mask string) string {
+	m, err := strconv.ParseUint(mask, 16, 64)
+	if err != nil {
+		return "unknown"
+	} else if m == 0 {
+		return "none"
+	}
+
+	var names []string
+	for name, c := range capabilities.Map {
+		if m&(1<<c.Value) != 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == len(capabilities.Map) {
+		return "all"
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// idMapping returns the ID mappings of the container process from the
+// uid_map or gid_map file.
+func idMapping(file string) string {
+	b, err := ioutil.ReadFile(filepath.Join(procSelf, file))
+	if err != nil {
+		return "unknown"
+	}
+
+	var mappings []string
+	for _, l := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		f := strings.Fields(l)
+		if len(f) != 3 {
+			continue
+		}
+		if f[0] == "0" && f[1] == "0" && f[2] == "4294967295" {
+			return "none"
+		}
+		mappings = append(mappings, fmt.Sprintf("%s->%s (%s)", f[0], f[1], f[2]))
+	}
+	return strings.Join(mappings, ", ")
+}
+
+// lsmAttr returns the LSM attribute of the container process, like the
+// current AppArmor profile or SELinux context.
+func lsmAttr(attr string) string {
+	b, err := ioutil.ReadFile(filepath.Join(procSelf, "attr", attr))
+	if err != nil {
+		return "unknown"
+	}
+	s := strings.TrimSpace(strings.TrimRight(string(b), "\x00"))
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+// resourceLimit returns the soft and hard limits of the resource name for
+// the container process.
+func resourceLimit(name string) string {
+	soft, hard, err := rlimit.Get("RLIMIT_" + strings.ToUpper(name))
+	if err != nil {
+		return "unknown"
+	}
+	return rlimit.FormatValue(soft) + "/" + rlimit.FormatValue(hard)
+}
+
+// namespaceState returns if the namespace nstype is created, joined or shared
+// with the host according to the applied config, with its actual inode.
+func namespaceState(spec *specs.Spec, nstype specs.LinuxNamespaceType, name string) string {
+	state := "shared with host"
+	if spec.Linux != nil {
+		for _, ns := range spec.Linux.Namespaces {
+			if ns.Type != nstype {
+				continue
+			}
+			state = "created"
+			if ns.Path != "" {
+				state = "joined " + ns.Path
+			}
+		}
+	}
+	if inode, err := os.Readlink(filepath.Join(procSelf, "ns", name)); err == nil {
+		state += " " + inode
+	}
+	return state
+}
+
+// securitySummary returns the effective security context of the container
+// process, read from its actual state once the security configuration spec
+// has been applied.
+func securitySummary(spec *specs.Spec, securityOpts []string) string {
+	status, err := readProcStatus()
+	if err != nil {
+		return fmt.Sprintf("Security context: unable to read process status: %s\n", err)
+	}
+
+	b := new(strings.Builder)
+	tw := tabwriter.NewWriter(b, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Security context:\t\n")
+	fmt.Fprintf(tw, "  UID (real/effective/saved/fs):\t%s\n", strings.Join(strings.Fields(status["Uid"]), "/"))
+	fmt.Fprintf(tw, "  GID (real/effective/saved/fs):\t%s\n", strings.Join(strings.Fields(status["Gid"]), "/"))
+	if groups := strings.Fields(status["Groups"]); len(groups) > 0 {
+		fmt.Fprintf(tw, "  Groups:\t%s\n", strings.Join(groups, ","))
+	}
+	fmt.Fprintf(tw, "  UID mapping:\t%s\n", idMapping("uid_map"))
+	fmt.Fprintf(tw, "  GID mapping:\t%s\n", idMapping("gid_map"))
+
+	fmt.Fprintf(tw, "  Effective capabilities:\t%s\n", capabilityNames(status["CapEff"]))
+	fmt.Fprintf(tw, "  Permitted capabilities:\t%s\n", capabilityNames(status["CapPrm"]))
+	fmt.Fprintf(tw, "  Inheritable capabilities:\t%s\n", capabilityNames(status["CapInh"]))
+	fmt.Fprintf(tw, "  Ambient capabilities:\t%s\n", capabilityNames(status["CapAmb"]))
+	fmt.Fprintf(tw, "  Bounding capabilities:\t%s\n", capabilityNames(status["CapBnd"]))
+
+	noNewPrivs := "no"
+	if status["NoNewPrivs"] == "1" {
+		noNewPrivs = "yes"
+	}
+	fmt.Fprintf(tw, "  No new privileges:\t%s\n", noNewPrivs)
+
+	seccomp := "none"
+	if status["Seccomp"] == "2" {
+		seccomp = "filter"
+		if n, ok := status["Seccomp_filters"]; ok {
+			seccomp += fmt.Sprintf(" (%s filters)", n)
+		}
+		if spec.Linux != nil && spec.Linux.Seccomp != nil {
+			seccomp += fmt.Sprintf(", default action %s", spec.Linux.Seccomp.DefaultAction)
+		}
+		if profile := security.GetParam(securityOpts, "seccomp"); profile != "" {
+			seccomp += ", profile " + profile
+		}
+	} else if status["Seccomp"] == "1" {
+		seccomp = "strict"
+	}
+	fmt.Fprintf(tw, "  Seccomp:\t%s\n", seccomp)
+
+	ruleset := "none"
+	if rules := security.GetParam(securityOpts, "landlock"); rules != "" {
+		ruleset = "unsupported"
+		if abi := landlock.ABI(); abi > 0 {
+			ruleset = fmt.Sprintf("%s (ABI %d)", rules, abi)
+		}
+	}
+	fmt.Fprintf(tw, "  Landlock ruleset:\t%s\n", ruleset)
+
+	fmt.Fprintf(tw, "  LSM label (current):\t%s\n", lsmAttr("current"))
+	fmt.Fprintf(tw, "  LSM label (on exec):\t%s\n", lsmAttr("exec"))
+
+	for _, ns := range summaryNamespaces {
+		fmt.Fprintf(tw, "  %s namespace:\t%s\n", ns.nstype, namespaceState(spec, ns.nstype, ns.name))
+	}
+
+	for _, name := range rlimit.Names {
+		fmt.Fprintf(tw, "  Resource limit %s (soft/hard):\t%s\n", name, resourceLimit(name))
+	}
+
+	rootfs := "unknown"
+	setuid := "unknown"
+	var st unix.Statfs_t
+	if err := unix.Statfs("/", &st); err == nil {
+		rootfs = "writable"
+		if st.Flags&unix.ST_RDONLY != 0 {
+			rootfs = "read-only"
+		}
+		setuid = "honored"
+		if st.Flags&unix.ST_NOSUID != 0 {
+			setuid = "ignored on root filesystem"
+		}
+	}
+	// no new privileges applies to the binaries of every mount
+	if noNewPrivs == "yes" {
+		setuid = "ignored"
+	}
+	fmt.Fprintf(tw, "  Root filesystem:\t%s\n", rootfs)
+	fmt.Fprintf(tw, "  Setuid and file capabilities:\t%s\n", setuid)
+
+	tw.Flush()
+	return b.String()
+}
+
+// printSecuritySummary prints the effective security context of the
+// container process with the verbose level.
+func (e *EngineOperations) printSecuritySummary() {
+	if sylog.GetLevel() < int(sylog.VerboseLevel) {
+		return
+	}
+	sylog.Verbosef("%s", strings.TrimSuffix(securitySummary(&e.EngineConfig.OciConfig.Spec, e.EngineConfig.GetSecurity()), "\n"))
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestCapabilityNames(t *testing.T) {
+	tests := []struct {
+		mask string
+		want string
+	}{
+		{"0000000000000000", "none"},
+		{"0000003fffffffff", "all"},
+		{"0000000000000401", "CAP_CHOWN,CAP_NET_BIND_SERVICE"},
+		{"invalid", "unknown"},
+	}
+	for _, tt := range tests {
+		if got := capabilityNames(tt.mask); got != tt.want {
+			t.Errorf("capabilityNames(%q) = %q, want %q", tt.mask, got, tt.want)
+		}
+	}
+}
+
+func TestSecuritySummary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "security-summary-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"status": "Name:\tsh\nUid:\t1000\t1000\t1000\t1000\nGid:\t1000\t1000\t1000\t1000\n" +
+			"Groups:\t10 1000\nCapInh:\t0000000000000000\nCapPrm:\t0000000000000000\n" +
+			"CapEff:\t0000000000000000\nCapBnd:\t0000003fffffffff\nCapAmb:\t0000000000000000\n" +
+			"NoNewPrivs:\t1\nSeccomp:\t2\nSeccomp_filters:\t1\n",
+		"uid_map":      "         0       1000          1\n",
+		"gid_map":      "         0          0 4294967295\n",
+		"attr/current": "unconfined\n",
+		"attr/exec":    "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "ns"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, ns := range []string{"user", "mnt", "pid", "net"} {
+		if err := os.Symlink(ns+":[4026531840]", filepath.Join(dir, "ns", ns)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func(dir string) {
+		procSelf = dir
+	}(procSelf)
+	procSelf = dir
+
+	spec := &specs.Spec{
+		Linux: &specs.Linux{
+			Namespaces: []specs.LinuxNamespace{
+				{Type: specs.UserNamespace},
+				{Type: specs.MountNamespace},
+				{Type: specs.PIDNamespace, Path: "/proc/42/ns/pid"},
+			},
+			Seccomp: &specs.LinuxSeccomp{DefaultAction: specs.ActErrno},
+		},
+	}
+
+	summary := securitySummary(spec, []string{"seccomp:/etc/seccomp.json", "landlock:ro=/,rw=/tmp"})
+
+	want := []string{
+		`UID \(real/effective/saved/fs\):\s+1000/1000/1000/1000\n`,
+		`Groups:\s+10,1000\n`,
+		`UID mapping:\s+0->1000 \(1\)\n`,
+		`GID mapping:\s+none\n`,
+		`Effective capabilities:\s+none\n`,
+		`Bounding capabilities:\s+all\n`,
+		`No new privileges:\s+yes\n`,
+		`Seccomp:\s+filter \(1 filters\), default action SCMP_ACT_ERRNO, profile /etc/seccomp.json\n`,
+		`Landlock ruleset:\s+(ro=/,rw=/tmp \(ABI \d+\)|unsupported)\n`,
+		`LSM label \(current\):\s+unconfined\n`,
+		`LSM label \(on exec\):\s+none\n`,
+		`user namespace:\s+created user:\[4026531840\]\n`,
+		`pid namespace:\s+joined /proc/42/ns/pid pid:\[4026531840\]\n`,
+		`network namespace:\s+shared with host net:\[4026531840\]\n`,
+		`uts namespace:\s+shared with host\n`,
+		`Resource limit nofile \(soft/hard\):\s+(\d+|unlimited)/(\d+|unlimited)\n`,
+		`Root filesystem:\s+(writable|read-only)\n`,
+		`Setuid and file capabilities:\s+ignored\n`,
+	}
+	for _, w := range want {
+		if !regexp.MustCompile(w).MatchString(summary) {
+			t.Errorf("summary doesn't match %q:\n%s", w, summary)
+		}
+	}
+}
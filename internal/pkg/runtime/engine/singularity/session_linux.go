@@ -0,0 +1,122 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/sylabs/singularity/internal/pkg/util/priv"
+	"github.com/sylabs/singularity/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+// sessionDiskDir is the directory storing the session directory when
+// it's stored on disk, it's removed by CleanupContainer.
+var sessionDiskDir string
+
+// sessionSize returns the size in MiB of a memory session directory
+// from the configured size: as the writable tmpfs overlay and an
+// in-memory home directory are stored in the session directory, the
+// configured size is added again for each of them.
+func sessionSize(size uint, writableTmpfs bool, memoryHome bool) int {
+	total := size
+	if writableTmpfs {
+		total += size
+	}
+	if memoryHome {
+		total += size
+	}
+	return int(total)
+}
+
+// withPrivileges runs fn with escalated privileges when the master
+// process has a privileged saved uid (suid workflow), so that the
+// directories created or removed by fn are owned by root.
+func withPrivileges(fn func() error) error {
+	setuid, err := masterSetuid()
+	if err != nil {
+		return err
+	} else if !setuid {
+		return fn()
+	}
+	if err := priv.Escalate(); err != nil {
+		return fmt.Errorf("failed to escalate privileges: %s", err)
+	}
+	defer priv.Drop()
+
+	return fn()
+}
+
+// createSessionDiskDir creates a session directory in the directory
+// base and sets sessionDiskDir to its path, so it's removed by
+// CleanupContainer. The directory is created relative to base without
+// following symbolic links, with mode 0700 and owned by the user, the
+// creation fails if the directory already exists.
+func createSessionDiskDir(base string) error {
+	uid, gid := os.Getuid(), os.Getgid()
+
+	rnd := make([]byte, 8)
+	if _, err := rand.Read(rnd); err != nil {
+		return fmt.Errorf("failed to generate session directory name: %s", err)
+	}
+	name := "singularity-session-" + hex.EncodeToString(rnd)
+
+	return withPrivileges(func() error {
+		baseFd, err := unix.Open(base, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("failed to open session directory base %s: %s", base, err)
+		}
+		defer unix.Close(baseFd)
+
+		if err := unix.Mkdirat(baseFd, name, 0700); err != nil {
+			return fmt.Errorf("failed to create session directory in %s: %s", base, err)
+		}
+		sessionDiskDir = filepath.Join(base, name)
+
+		fd, err := unix.Openat(baseFd, name, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("failed to open session directory %s: %s", sessionDiskDir, err)
+		}
+		defer unix.Close(fd)
+
+		if err := unix.Fchown(fd, uid, gid); err != nil {
+			return fmt.Errorf("failed to change session directory %s owner: %s", sessionDiskDir, err)
+		}
+		return unix.Fchmod(fd, 0700)
+	})
+}
+
+// removeSessionDiskDir removes the session directory stored on disk
+// if any.
+func removeSessionDiskDir() error {
+	if sessionDiskDir == "" {
+		return nil
+	}
+	sylog.Debugf("Removing session directory %s", sessionDiskDir)
+
+	return withPrivileges(func() error {
+		return os.RemoveAll(sessionDiskDir)
+	})
+}
+
+// sessionFull returns if the error err was caused by the session
+// directory mounted at path running out of space.
+func sessionFull(path string, err error) bool {
+	if err == nil || !strings.Contains(err.Error(), syscall.ENOSPC.Error()) {
+		return false
+	}
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return false
+	}
+	return st.Bavail == 0 || st.Ffree == 0
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestCreateSessionDiskDir(t *testing.T) {
+	defer func() { sessionDiskDir = "" }()
+
+	base, err := ioutil.TempDir("", "session-base-")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(base)
+
+	if err := createSessionDiskDir(base); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if filepath.Dir(sessionDiskDir) != base || !strings.HasPrefix(filepath.Base(sessionDiskDir), "singularity-session-") {
+		t.Errorf("unexpected session directory %s", sessionDiskDir)
+	}
+	fi, err := os.Lstat(sessionDiskDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !fi.IsDir() || fi.Mode().Perm() != 0700 || fi.Mode()&os.ModeSticky != 0 {
+		t.Errorf("unexpected session directory mode %s", fi.Mode())
+	}
+	if st := fi.Sys().(*syscall.Stat_t); int(st.Uid) != os.Getuid() || int(st.Gid) != os.Getgid() {
+		t.Errorf("unexpected session directory owner %d:%d", st.Uid, st.Gid)
+	}
+
+	if err := removeSessionDiskDir(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if _, err := os.Lstat(sessionDiskDir); !os.IsNotExist(err) {
+		t.Errorf("session directory %s not removed", sessionDiskDir)
+	}
+
+	// a symbolic link is not followed
+	sessionDiskDir = ""
+	link := filepath.Join(base, "link")
+	if err := os.Symlink(base, link); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := createSessionDiskDir(link); err == nil {
+		t.Errorf("unexpected success with a symbolic link base")
+	}
+	if sessionDiskDir != "" {
+		t.Errorf("unexpected session directory %s", sessionDiskDir)
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package launcher assembles the part of the singularity engine
+// configuration shared by the action commands and the client API, so that a
+// container runs the same way whichever of them starts it.
+package launcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engine/config/oci/generate"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engine/singularity/config"
+	"github.com/sylabs/singularity/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/util/capabilities"
+	"github.com/sylabs/singularity/pkg/util/namespaces"
+	"github.com/sylabs/singularity/pkg/util/rlimit"
+	"golang.org/x/sys/unix"
+)
+
+// Namespaces lists the namespaces requested for the container, the mount
+// namespace is always created.
+type Namespaces struct {
+	User bool
+	PID  bool
+	IPC  bool
+	Net  bool
+	UTS  bool
+}
+
+// Options are the settings of the container applied by Configure.
+type Options struct {
+	// UID and GID are the IDs of the container process, mapped to
+	// themselves in a user namespace
+	UID uint32
+	GID uint32
+	// Namespaces are the namespaces requested for the container
+	Namespaces Namespaces
+	// Fakeroot runs the container as root in a user namespace, the
+	// mappings are set by the engine
+	Fakeroot bool
+	// RemapIDs runs the container with IDs from the subordinate ID
+	// ranges of the user, the mappings are set by the engine
+	RemapIDs bool
+	// Home is the home directory specification src[:dest]
+	Home string
+	// Pwd is the initial working directory in the container, relative
+	// to the default one if not absolute
+	Pwd string
+	// DefaultPwd replaces the current working directory as the default
+	// working directory of the container if set
+	DefaultPwd string
+	// App is the SCIF application run in the container
+	App string
+	// SanitizePath resets PATH to the default container PATH, the
+	// default set in singularity.conf is used if nil
+	SanitizePath *bool
+	// Rlimits are resource limits name=soft[:hard] of the container
+	// process
+	Rlimits []string
+}
+
+// Workflow reports how the starter runs the container.
+type Workflow struct {
+	// UseSuid runs the setuid starter
+	UseSuid bool
+	// UserNamespace is set when the container runs in a user namespace,
+	// either requested or as a fallback of the setuid workflow
+	UserNamespace bool
+	// LoadOverlay loads the overlay kernel module before starting the
+	// container
+	LoadOverlay bool
+}
+
+// Configure applies opts to the engine configuration and the OCI
+// configuration of generator. The engine configuration File, the contain
+// setting and the image must be set beforehand, the namespaces are added
+// to generator.
+func Configure(engineConfig *singularityConfig.EngineConfig, generator *generate.Generator, opts Options) (Workflow, error) {
+	wf, err := workflow(engineConfig, opts)
+	if err != nil {
+		return wf, err
+	}
+
+	if err := setHome(engineConfig, opts.Home); err != nil {
+		return wf, err
+	}
+
+	ns := opts.Namespaces
+	if ns.Net {
+		generator.AddOrReplaceLinuxNamespace("network", "")
+	}
+	if ns.UTS {
+		generator.AddOrReplaceLinuxNamespace("uts", "")
+	}
+	if ns.PID {
+		generator.AddOrReplaceLinuxNamespace("pid", "")
+	}
+	if ns.IPC {
+		generator.AddOrReplaceLinuxNamespace("ipc", "")
+	}
+	if wf.UserNamespace {
+		generator.AddOrReplaceLinuxNamespace("user", "")
+
+		// user namespace mappings are set by the engine with
+		// fakeroot and with remapped IDs
+		if !opts.Fakeroot && !opts.RemapIDs {
+			generator.AddLinuxUIDMapping(opts.UID, opts.UID, 1)
+			generator.AddLinuxGIDMapping(opts.GID, opts.GID, 1)
+		}
+	}
+
+	if opts.SanitizePath != nil {
+		engineConfig.SetSanitizePath(*opts.SanitizePath)
+	} else {
+		engineConfig.SetSanitizePath(engineConfig.File.SanitizePath)
+	}
+	engineConfig.SetRlimits(opts.Rlimits)
+
+	if pwd, err := os.Getwd(); err == nil {
+		engineConfig.SetCwd(pwd)
+
+		defaultCwd := pwd
+		if engineConfig.GetContain() {
+			defaultCwd = engineConfig.GetHomeDest()
+		}
+
+		if opts.Pwd != "" {
+			// relative path are resolved against the default
+			// container working directory
+			cwd := opts.Pwd
+			if !filepath.IsAbs(cwd) {
+				cwd = filepath.Join(defaultCwd, cwd)
+			}
+			generator.SetProcessCwd(cwd)
+			engineConfig.SetCustomCwd(true)
+		} else if opts.DefaultPwd != "" {
+			generator.SetProcessCwd(opts.DefaultPwd)
+		} else {
+			generator.SetProcessCwd(defaultCwd)
+		}
+	} else {
+		sylog.Warningf("can't determine current working directory: %s", err)
+	}
+
+	generator.AddProcessEnv("SINGULARITY_APPNAME", opts.App)
+	engineConfig.SetAppName(opts.App)
+
+	// setuid workflow set RLIMIT_STACK to its default value,
+	// get the original value to restore it before executing
+	// container process
+	if wf.UseSuid {
+		soft, hard, err := rlimit.Get("RLIMIT_STACK")
+		if err != nil {
+			sylog.Warningf("can't retrieve stack size limit: %s", err)
+		}
+		generator.AddProcessRlimits("RLIMIT_STACK", hard, soft)
+	}
+
+	return wf, nil
+}
+
+// workflow selects the setuid or the user namespace workflow, falling back
+// to a user namespace when the setuid workflow isn't available.
+func workflow(engineConfig *singularityConfig.EngineConfig, opts Options) (Workflow, error) {
+	// root running the container process with another UID is
+	// handled like this user
+	isPrivileged := opts.UID == 0
+	insideUserNs, _ := namespaces.IsInsideUserNamespace(os.Getpid())
+	wf := Workflow{
+		// privileged installation by default
+		UseSuid:       true,
+		UserNamespace: opts.Namespaces.User,
+	}
+
+	// singularity was compiled with '--without-suid' option
+	if buildcfg.SINGULARITY_SUID_INSTALL == 0 {
+		wf.UseSuid = false
+
+		if !wf.UserNamespace && !isPrivileged {
+			sylog.Verbosef("Unprivileged installation: using user namespace")
+			wf.UserNamespace = true
+		}
+	}
+
+	// use non privileged starter binary:
+	// - if running as root
+	// - if already running inside a user namespace
+	// - if user namespace is requested
+	// - if running as user and 'allow setuid = no' is set in singularity.conf
+	if isPrivileged || insideUserNs || wf.UserNamespace || !engineConfig.File.AllowSetuid {
+		wf.UseSuid = false
+
+		// fallback to user namespace:
+		// - for non root user with setuid installation and 'allow setuid = no'
+		// - for root user without effective capability CAP_SYS_ADMIN
+		if !isPrivileged && buildcfg.SINGULARITY_SUID_INSTALL == 1 && !engineConfig.File.AllowSetuid {
+			sylog.Verbosef("'allow setuid' set to 'no' by configuration, fallback to user namespace")
+			wf.UserNamespace = true
+		} else if isPrivileged && !wf.UserNamespace {
+			caps, err := capabilities.GetProcessEffective()
+			if err != nil {
+				return wf, fmt.Errorf("could not get process effective capabilities: %s", err)
+			}
+			if caps&uint64(1<<unix.CAP_SYS_ADMIN) == 0 {
+				sylog.Verbosef("Effective capability CAP_SYS_ADMIN is missing, fallback to user namespace")
+				wf.UserNamespace = true
+			}
+		}
+	}
+
+	// the setuid starter sets up the user namespace mappings of
+	// fakeroot and remapped IDs
+	if opts.Fakeroot || opts.RemapIDs {
+		wf.UserNamespace = true
+	}
+
+	// starter will force the loading of kernel overlay module
+	wf.LoadOverlay = !wf.UserNamespace && buildcfg.SINGULARITY_SUID_INSTALL == 1
+
+	return wf, nil
+}
+
+// setHome sets the home directory source and destination from the home
+// specification src[:dest].
+func setHome(engineConfig *singularityConfig.EngineConfig, home string) error {
+	homeSlice := strings.Split(home, ":")
+	if len(homeSlice) > 2 {
+		return fmt.Errorf("home argument has incorrect number of elements: %v", len(homeSlice))
+	}
+	engineConfig.SetHomeSource(homeSlice[0])
+	engineConfig.SetHomeDest(homeSlice[len(homeSlice)-1])
+	return nil
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package launcher
+
+import (
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/runtime/engine/config/oci"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engine/config/oci/generate"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engine/singularity/config"
+	"github.com/sylabs/singularity/pkg/util/singularityconf"
+)
+
+func TestConfigure(t *testing.T) {
+	enabled := true
+	disabled := false
+
+	tests := []struct {
+		name         string
+		contain      bool
+		confSanitize bool
+		opts         Options
+		wantErr      bool
+		wantHome     string
+		wantCwd      string
+		wantSanitize bool
+		wantMappings int
+	}{
+		{
+			name:    "BadHome",
+			opts:    Options{Home: "/a:/b:/c"},
+			wantErr: true,
+		},
+		{
+			name:     "ContainRelativePwd",
+			contain:  true,
+			opts:     Options{UID: 1000, GID: 1000, Home: "/tmp:/home/test", Pwd: "work"},
+			wantHome: "/home/test",
+			wantCwd:  "/home/test/work",
+		},
+		{
+			name:     "DefaultPwd",
+			opts:     Options{UID: 1000, GID: 1000, Home: "/tmp", DefaultPwd: "/srv"},
+			wantHome: "/tmp",
+			wantCwd:  "/srv",
+		},
+		{
+			name:         "SanitizePathConfig",
+			confSanitize: true,
+			opts:         Options{UID: 1000, GID: 1000, Home: "/tmp", Pwd: "/"},
+			wantHome:     "/tmp",
+			wantCwd:      "/",
+			wantSanitize: true,
+		},
+		{
+			name:         "SanitizePathDisabled",
+			confSanitize: true,
+			opts:         Options{UID: 1000, GID: 1000, Home: "/tmp", Pwd: "/", SanitizePath: &disabled},
+			wantHome:     "/tmp",
+			wantCwd:      "/",
+		},
+		{
+			name:         "SanitizePathEnabled",
+			opts:         Options{UID: 1000, GID: 1000, Home: "/tmp", Pwd: "/", SanitizePath: &enabled},
+			wantHome:     "/tmp",
+			wantCwd:      "/",
+			wantSanitize: true,
+		},
+		{
+			name:         "UserNamespace",
+			opts:         Options{UID: 1000, GID: 1000, Home: "/tmp", Pwd: "/", Namespaces: Namespaces{User: true}},
+			wantHome:     "/tmp",
+			wantCwd:      "/",
+			wantMappings: 1,
+		},
+		{
+			name:     "Fakeroot",
+			opts:     Options{UID: 1000, GID: 1000, Home: "/tmp:/root", Pwd: "/", Fakeroot: true},
+			wantHome: "/root",
+			wantCwd:  "/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileConfig, err := singularityconf.Parse("")
+			if err != nil {
+				t.Fatalf("while getting default configuration: %s", err)
+			}
+			fileConfig.SanitizePath = tt.confSanitize
+
+			engineConfig := singularityConfig.NewConfig()
+			engineConfig.File = fileConfig
+			engineConfig.OciConfig = &oci.Config{}
+			engineConfig.SetContain(tt.contain)
+			generator := generate.New(&engineConfig.OciConfig.Spec)
+
+			wf, err := Configure(engineConfig, generator, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if got := engineConfig.GetHomeDest(); got != tt.wantHome {
+				t.Errorf("got home destination %q, want %q", got, tt.wantHome)
+			}
+			if got := engineConfig.OciConfig.Process.Cwd; got != tt.wantCwd {
+				t.Errorf("got working directory %q, want %q", got, tt.wantCwd)
+			}
+			if got := engineConfig.GetSanitizePath(); got != tt.wantSanitize {
+				t.Errorf("got sanitize path %v, want %v", got, tt.wantSanitize)
+			}
+			if (tt.opts.Namespaces.User || tt.opts.Fakeroot) && !wf.UserNamespace {
+				t.Errorf("user namespace not used")
+			}
+			if wf.UserNamespace && wf.LoadOverlay {
+				t.Errorf("overlay module loaded with a user namespace")
+			}
+			mappings := 0
+			if engineConfig.OciConfig.Linux != nil {
+				mappings = len(engineConfig.OciConfig.Linux.UIDMappings)
+			}
+			if got := mappings; got != tt.wantMappings {
+				t.Errorf("got %d uid mappings, want %d", got, tt.wantMappings)
+			}
+		})
+	}
+}
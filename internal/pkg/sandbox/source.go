@@ -0,0 +1,222 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package sandbox records the signed SIF image a sandbox was extracted
+// from, so that the sandbox content can be verified against it.
+package sandbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sylabs/sif/pkg/integrity"
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/pkg/image"
+	"github.com/sylabs/singularity/pkg/image/unpacker"
+	"github.com/sylabs/singularity/pkg/util/namespaces"
+	"golang.org/x/crypto/openpgp"
+)
+
+// SourceFile is the path of the source record, relative to the sandbox
+// root.
+const SourceFile = ".singularity.d/metadata/source.json"
+
+// ErrNoSource is returned when a sandbox has no source record.
+var ErrNoSource = errors.New("no signed source recorded")
+
+// buildFiles are the paths written by the build in an extracted
+// sandbox, they are descriptive metadata never executed by the runtime
+// and are not compared to the signed partition.
+var buildFiles = map[string]bool{
+	filepath.Dir(SourceFile):            true,
+	".singularity.d/Singularity":        true,
+	".singularity.d/labels.json":        true,
+	".singularity.d/special-files.json": true,
+	".singularity.d/bootstrap_history":  true,
+}
+
+// Source records the SIF image a sandbox was extracted from. The record
+// is stored in the sandbox and is not trusted, a sandbox is verified
+// against the signed root file system partition of the image itself.
+type Source struct {
+	Image string `json:"image"`
+	// Owners is set when the file ownership of the partition was
+	// preserved at extraction time.
+	Owners bool `json:"owners,omitempty"`
+}
+
+// PreservesOwners returns true if the file ownership of a partition is
+// preserved when extracted by the current process, which requires to
+// run as root in the host user namespace.
+func PreservesOwners() bool {
+	if os.Geteuid() != 0 {
+		return false
+	}
+	userns, _ := namespaces.IsInsideUserNamespace(os.Getpid())
+	return !userns
+}
+
+// openSource loads the SIF image path and returns it along with the
+// descriptor of its root file system partition.
+func openSource(path string) (*sif.FileImage, *sif.Descriptor, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	fimg, _, err := image.LoadSIF(f, true)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	od, _, err := fimg.GetPartPrimSys()
+	if err != nil {
+		fimg.UnloadContainer()
+		return nil, nil, err
+	}
+	return &fimg, od, nil
+}
+
+// NewSource returns the source record of a sandbox extracted from the
+// root file system partition of the SIF image found at path, owners
+// tells if the file ownership was preserved by the extraction. The
+// signatures aren't verified against any key, ErrNoSource is returned
+// if the partition has no non-legacy signature.
+func NewSource(path string, owners bool) (*Source, error) {
+	fimg, od, err := openSource(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fimg.UnloadContainer()
+
+	v, err := integrity.NewVerifier(fimg, integrity.OptVerifyObject(od.ID))
+	if err != nil {
+		return nil, err
+	}
+	if fps, err := v.AnySignedBy(); err != nil {
+		return nil, err
+	} else if len(fps) == 0 {
+		return nil, ErrNoSource
+	}
+	return &Source{Image: path, Owners: owners}, nil
+}
+
+// Verify verifies the signatures of the root file system partition of
+// the source image with the key material of kr, then compares the
+// sandbox root to the content of the signed partition, modification
+// times are ignored. The file ownership is compared only when it was
+// preserved both at extraction time and by the current extraction. The
+// entities of the signing keys and the paths changed in the sandbox are
+// returned.
+func (s *Source) Verify(root string, kr openpgp.KeyRing) ([]*openpgp.Entity, []Change, error) {
+	fimg, od, err := openSource(s.Image)
+	if err != nil {
+		return nil, nil, fmt.Errorf("while opening signed source %s: %s", s.Image, err)
+	}
+	defer fimg.UnloadContainer()
+
+	var signers []*openpgp.Entity
+	cb := func(r integrity.VerifyResult) bool {
+		if r.Error() == nil {
+			signers = append(signers, r.Entity())
+		}
+		return false
+	}
+	v, err := integrity.NewVerifier(fimg,
+		integrity.OptVerifyWithKeyRing(kr),
+		integrity.OptVerifyObject(od.ID),
+		integrity.OptVerifyCallback(cb),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := v.Verify(); err != nil {
+		return nil, nil, err
+	}
+
+	fs, err := od.GetFsType()
+	if err != nil {
+		return nil, nil, err
+	}
+	if fs != sif.FsSquash {
+		return nil, nil, fmt.Errorf("unsupported root file system partition type %d", fs)
+	}
+
+	dir, err := ioutil.TempDir("", "sandbox-source-")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	// extract the partition read from the verified image
+	rootfs := filepath.Join(dir, "rootfs")
+	if err := unpacker.NewSquashfs().ExtractAll(od.GetReadSeeker(fimg), rootfs); err != nil {
+		return nil, nil, fmt.Errorf("while extracting signed partition: %s", err)
+	}
+
+	owners := s.Owners && PreservesOwners()
+	signed, err := sourceManifest(rootfs, owners)
+	if err != nil {
+		return nil, nil, err
+	}
+	current, err := sourceManifest(root, owners)
+	if err != nil {
+		return nil, nil, err
+	}
+	return signers, Diff(signed, current), nil
+}
+
+// sourceManifest returns the manifest of root without the paths written
+// by the build, ownership is cleared unless owners is set.
+func sourceManifest(root string, owners bool) ([]File, error) {
+	files, err := Manifest(root)
+	if err != nil {
+		return nil, err
+	}
+	kept := files[:0]
+	for _, f := range files {
+		if buildFiles[f.Path] || strings.HasPrefix(f.Path, ".singularity.d/bootstrap_history/") {
+			continue
+		}
+		if !owners {
+			f.UID, f.GID = 0, 0
+		}
+		kept = append(kept, f)
+	}
+	return kept, nil
+}
+
+// WriteSource writes the source record s in the sandbox root.
+func WriteSource(root string, s *Source) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(root, SourceFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// ReadSource reads the source record of the sandbox root, ErrNoSource is
+// returned if there is none.
+func ReadSource(root string) (*Source, error) {
+	data, err := ioutil.ReadFile(filepath.Join(root, SourceFile))
+	if os.IsNotExist(err) {
+		return nil, ErrNoSource
+	} else if err != nil {
+		return nil, err
+	}
+	s := new(Source)
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("while decoding %s: %s", SourceFile, err)
+	}
+	return s, nil
+}
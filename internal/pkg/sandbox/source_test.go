@@ -0,0 +1,132 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sandbox
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// testImages is the directory of the signature test images.
+const testImages = "../../app/singularity/testdata"
+
+// testKeyRing returns the keyring of the signature test images.
+func testKeyRing(t *testing.T) openpgp.EntityList {
+	k, err := os.Open(filepath.Join(testImages, "keys", "private.asc"))
+	if err != nil {
+		t.Fatalf("failed to open key: %s", err)
+	}
+	defer k.Close()
+	kr, err := openpgp.ReadArmoredKeyRing(k)
+	if err != nil {
+		t.Fatalf("failed to read key: %s", err)
+	}
+	return kr
+}
+
+func TestNewSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		image   string
+		wantErr error
+	}{
+		{name: "Signed", image: "one-group-signed.sif"},
+		{name: "Unsigned", image: "one-group.sif", wantErr: ErrNoSource},
+		{name: "Legacy", image: "one-group-signed-legacy.sif", wantErr: ErrNoSource},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(testImages, "images", tt.image)
+			s, err := NewSource(path, true)
+			if err != tt.wantErr {
+				t.Fatalf("got error %v, expected %v", err, tt.wantErr)
+			}
+			if err == nil && (s.Image != path || !s.Owners) {
+				t.Errorf("unexpected source %+v", s)
+			}
+		})
+	}
+}
+
+func TestSourceVerify(t *testing.T) {
+	dir := makeTree(t)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name  string
+		image string
+		kr    openpgp.KeyRing
+	}{
+		{name: "NoKey", image: "one-group-signed.sif", kr: openpgp.EntityList{}},
+		{name: "Unsigned", image: "one-group.sif", kr: testKeyRing(t)},
+		{name: "MissingImage", image: "missing.sif", kr: testKeyRing(t)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Source{Image: filepath.Join(testImages, "images", tt.image)}
+			if _, _, err := s.Verify(dir, tt.kr); err == nil {
+				t.Errorf("unexpected success")
+			}
+		})
+	}
+}
+
+func TestSourceManifest(t *testing.T) {
+	dir := makeTree(t)
+	defer os.RemoveAll(dir)
+
+	if err := WriteSource(dir, &Source{Image: "test.sif"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, ".singularity.d/bootstrap_history"), 0755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, path := range []string{".singularity.d/labels.json", ".singularity.d/bootstrap_history/Singularity0"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, path), nil, 0644); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	files, err := sourceManifest(dir, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []string{".", ".singularity.d", "bin", "bin/false", "bin/true", "etc", "etc/hosts", "etc.d", "etc.d/a"}
+	if len(files) != len(want) {
+		t.Fatalf("got manifest %+v, expected paths %v", files, want)
+	}
+	for i, f := range files {
+		if f.Path != want[i] || f.UID != 0 || f.GID != 0 {
+			t.Errorf("got %+v, expected path %s without owner", f, want[i])
+		}
+	}
+}
+
+func TestSourceRecord(t *testing.T) {
+	dir := makeTree(t)
+	defer os.RemoveAll(dir)
+
+	if _, err := ReadSource(dir); err != ErrNoSource {
+		t.Fatalf("got error %v, expected %v", err, ErrNoSource)
+	}
+
+	if err := WriteSource(dir, &Source{Image: "test.sif", Owners: true}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	s, err := ReadSource(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if s.Image != "test.sif" || !s.Owners {
+		t.Errorf("unexpected source %+v", s)
+	}
+}
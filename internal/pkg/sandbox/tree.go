@@ -0,0 +1,136 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sandbox
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// File is the manifest entry of a sandbox path. Modification times are
+// not recorded, so that touching a file doesn't change the manifest.
+type File struct {
+	Path   string      `json:"path"`
+	Mode   os.FileMode `json:"mode"`
+	UID    uint32      `json:"uid"`
+	GID    uint32      `json:"gid"`
+	Size   int64       `json:"size,omitempty"`
+	Digest string      `json:"digest,omitempty"`
+	Link   string      `json:"link,omitempty"`
+	Rdev   uint64      `json:"rdev,omitempty"`
+}
+
+// Manifest returns the manifest of the sandbox root, in lexical path
+// order. The source record itself is excluded.
+func Manifest(root string) ([]File, error) {
+	var files []File
+
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if rel == SourceFile {
+			return nil
+		}
+
+		f := File{Path: rel, Mode: fi.Mode()}
+		setOwner(&f, fi)
+
+		switch {
+		case fi.Mode().IsRegular():
+			f.Size = fi.Size()
+			f.Digest, err = fileDigest(path)
+			if err != nil {
+				return err
+			}
+		case fi.Mode()&os.ModeSymlink != 0:
+			f.Link, err = os.Readlink(path)
+			if err != nil {
+				return err
+			}
+		}
+		files = append(files, f)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("while walking %s: %s", root, err)
+	}
+	return files, nil
+}
+
+// fileDigest returns the digest of the content of the file path.
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
+
+// TreeDigest returns the digest of the sandbox manifest files.
+func TreeDigest(files []File) (string, error) {
+	h := sha256.New()
+	if err := json.NewEncoder(h).Encode(files); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
+
+// Change kinds reported by Diff.
+const (
+	Added    = "added"
+	Removed  = "removed"
+	Modified = "modified"
+)
+
+// Change is a path which differs between two manifests.
+type Change struct {
+	Path string
+	Kind string
+}
+
+// Diff returns the paths added, removed or modified in the manifest
+// current compared to the manifest recorded, sorted by path.
+func Diff(recorded, current []File) []Change {
+	var changes []Change
+
+	files := make(map[string]File, len(recorded))
+	for _, f := range recorded {
+		files[f.Path] = f
+	}
+	for _, f := range current {
+		r, ok := files[f.Path]
+		if !ok {
+			changes = append(changes, Change{Path: f.Path, Kind: Added})
+			continue
+		}
+		if r != f {
+			changes = append(changes, Change{Path: f.Path, Kind: Modified})
+		}
+		delete(files, f.Path)
+	}
+	for path := range files {
+		changes = append(changes, Change{Path: path, Kind: Removed})
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
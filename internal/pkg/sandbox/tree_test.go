@@ -0,0 +1,122 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sandbox
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// makeTree creates a small sandbox tree in a temporary directory.
+func makeTree(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "sandbox-tree-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	for _, d := range []string{"bin", "etc", "etc.d"} {
+		if err := os.Mkdir(filepath.Join(dir, d), 0755); err != nil {
+			t.Fatalf("failed to create directory: %s", err)
+		}
+	}
+	for path, content := range map[string]string{
+		"bin/true":  "#!/bin/sh\nexit 0\n",
+		"etc/hosts": "127.0.0.1 localhost\n",
+		"etc.d/a":   "a\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, path), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to create file: %s", err)
+		}
+	}
+	if err := os.Symlink("true", filepath.Join(dir, "bin/false")); err != nil {
+		t.Fatalf("failed to create symlink: %s", err)
+	}
+	return dir
+}
+
+func TestManifest(t *testing.T) {
+	dir := makeTree(t)
+	defer os.RemoveAll(dir)
+
+	files, err := Manifest(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+	want := []string{".", "bin", "bin/false", "bin/true", "etc", "etc/hosts", "etc.d", "etc.d/a"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("got paths %v, expected %v", paths, want)
+	}
+
+	d1, err := TreeDigest(files)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// modification times are ignored
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "etc/hosts"), old, old); err != nil {
+		t.Fatalf("failed to change times: %s", err)
+	}
+	files, err = Manifest(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	d2, err := TreeDigest(files)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if d1 != d2 {
+		t.Errorf("digest changed after a modification time change: %s != %s", d1, d2)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	dir := makeTree(t)
+	defer os.RemoveAll(dir)
+
+	recorded, err := Manifest(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// same size content change
+	if err := ioutil.WriteFile(filepath.Join(dir, "etc/hosts"), []byte("127.0.0.2 localhost\n"), 0644); err != nil {
+		t.Fatalf("failed to modify file: %s", err)
+	}
+	if err := os.Chmod(filepath.Join(dir, "bin/true"), 0755); err != nil {
+		t.Fatalf("failed to change mode: %s", err)
+	}
+	if err := os.Remove(filepath.Join(dir, "bin/false")); err != nil {
+		t.Fatalf("failed to remove symlink: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "etc/passwd"), nil, 0644); err != nil {
+		t.Fatalf("failed to create file: %s", err)
+	}
+
+	current, err := Manifest(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []Change{
+		{Path: "bin/false", Kind: Removed},
+		{Path: "bin/true", Kind: Modified},
+		{Path: "etc/hosts", Kind: Modified},
+		{Path: "etc/passwd", Kind: Added},
+	}
+	if got := Diff(recorded, current); !reflect.DeepEqual(got, want) {
+		t.Errorf("got changes %v, expected %v", got, want)
+	}
+	if got := Diff(current, current); len(got) != 0 {
+		t.Errorf("unexpected changes %v between identical manifests", got)
+	}
+}
@@ -0,0 +1,25 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !windows
+
+package sandbox
+
+import (
+	"os"
+	"syscall"
+)
+
+// setOwner sets the ownership and the device number of the manifest entry
+// f from the file information fi.
+func setOwner(f *File, fi os.FileInfo) {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		f.UID = st.Uid
+		f.GID = st.Gid
+		if fi.Mode()&(os.ModeDevice|os.ModeCharDevice) != 0 {
+			f.Rdev = uint64(st.Rdev)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sandbox
+
+import (
+	"os"
+)
+
+// setOwner sets the ownership and the device number of the manifest entry
+// f from the file information fi, they are not reported on this platform.
+func setOwner(f *File, fi os.FileInfo) {}
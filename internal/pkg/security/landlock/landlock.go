@@ -0,0 +1,74 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package landlock
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Access is the access granted by a rule to a file hierarchy.
+type Access int
+
+const (
+	// ReadOnly allows to read and execute files and to list directories.
+	ReadOnly Access = iota
+	// ReadWrite allows any filesystem access.
+	ReadWrite
+)
+
+func (a Access) String() string {
+	if a == ReadWrite {
+		return "rw"
+	}
+	return "ro"
+}
+
+// Rule grants an access to the file hierarchy beneath a path.
+type Rule struct {
+	Path   string
+	Access Access
+}
+
+// Ruleset is a list of rules, the filesystem access not granted by a
+// rule is denied.
+type Ruleset []Rule
+
+func (r Ruleset) String() string {
+	rules := make([]string, len(r))
+	for i, rule := range r {
+		rules[i] = rule.Access.String() + "=" + rule.Path
+	}
+	return strings.Join(rules, ",")
+}
+
+// ParseRuleset parses a comma separated list of rules in the format
+// ro=<path> or rw=<path>, paths must be absolute.
+func ParseRuleset(s string) (Ruleset, error) {
+	var r Ruleset
+
+	for _, rule := range strings.Split(s, ",") {
+		kv := strings.SplitN(rule, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return nil, fmt.Errorf("bad rule %q (format is ro=<path> or rw=<path>)", rule)
+		}
+		var access Access
+		switch kv[0] {
+		case "ro":
+			access = ReadOnly
+		case "rw":
+			access = ReadWrite
+		default:
+			return nil, fmt.Errorf("bad access %q in rule %q (ro or rw expected)", kv[0], rule)
+		}
+		if !filepath.IsAbs(kv[1]) {
+			return nil, fmt.Errorf("path %q in rule %q is not absolute", kv[1], rule)
+		}
+		r = append(r, Rule{Path: filepath.Clean(kv[1]), Access: access})
+	}
+	return r, nil
+}
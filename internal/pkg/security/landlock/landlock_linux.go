@@ -0,0 +1,145 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package landlock
+
+import (
+	"fmt"
+	"os"
+	"unsafe"
+
+	"github.com/sylabs/singularity/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+// Landlock system calls and flags, not provided by the vendored
+// golang.org/x/sys/unix package, see the kernel include/uapi/linux/landlock.h.
+const (
+	sysLandlockCreateRuleset = 444
+	sysLandlockAddRule       = 445
+	sysLandlockRestrictSelf  = 446
+
+	createRulesetVersion = 1 << 0
+	rulePathBeneath      = 1
+)
+
+// Filesystem access rights.
+const (
+	accessExecute    = 1 << 0
+	accessWriteFile  = 1 << 1
+	accessReadFile   = 1 << 2
+	accessReadDir    = 1 << 3
+	accessRemoveDir  = 1 << 4
+	accessRemoveFile = 1 << 5
+	accessMakeChar   = 1 << 6
+	accessMakeDir    = 1 << 7
+	accessMakeReg    = 1 << 8
+	accessMakeSock   = 1 << 9
+	accessMakeFifo   = 1 << 10
+	accessMakeBlock  = 1 << 11
+	accessMakeSym    = 1 << 12
+	accessRefer      = 1 << 13 // ABI 2
+	accessTruncate   = 1 << 14 // ABI 3
+
+	// rights applying to files, the others only apply to directories
+	accessFile = accessExecute | accessWriteFile | accessReadFile | accessTruncate
+	// rights granted by read-only rules
+	accessRead = accessExecute | accessReadFile | accessReadDir
+)
+
+// ABI returns the Landlock ABI version supported by the kernel, 0 if
+// Landlock isn't supported or is disabled.
+func ABI() int {
+	abi, _, errno := unix.Syscall(sysLandlockCreateRuleset, 0, 0, createRulesetVersion)
+	if errno != 0 {
+		return 0
+	}
+	return int(abi)
+}
+
+// handledAccess returns the access rights handled with the ABI version.
+func handledAccess(abi int) uint64 {
+	access := uint64(accessRefer - 1)
+	if abi >= 2 {
+		access |= accessRefer
+	}
+	if abi >= 3 {
+		access |= accessTruncate
+	}
+	return access
+}
+
+// Restrict restricts the filesystem access of the calling thread, and of
+// the processes it executes, to the access granted by the rules of r.
+// Landlock restrictions only apply to the calling thread, which must be
+// locked to its goroutine. As required by Landlock, no new privileges
+// is set for the thread. Rules with a missing path are ignored with a
+// warning.
+func (r Ruleset) Restrict() error {
+	abi := ABI()
+	if abi < 1 {
+		return fmt.Errorf("landlock is not supported by the kernel")
+	}
+	handled := handledAccess(abi)
+
+	attr := struct{ handledAccessFs uint64 }{handled}
+	fd, _, errno := unix.Syscall(sysLandlockCreateRuleset, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return fmt.Errorf("while creating landlock ruleset: %s", errno)
+	}
+	defer unix.Close(int(fd))
+
+	for _, rule := range r {
+		if err := addRule(int(fd), rule, handled); err != nil {
+			if os.IsNotExist(err) {
+				sylog.Warningf("Ignoring landlock rule %s=%s: %s", rule.Access, rule.Path, err)
+				continue
+			}
+			return fmt.Errorf("while adding landlock rule %s=%s: %s", rule.Access, rule.Path, err)
+		}
+	}
+
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("while setting no new privileges: %s", err)
+	}
+	if _, _, errno := unix.Syscall(sysLandlockRestrictSelf, fd, 0, 0); errno != 0 {
+		return fmt.Errorf("while enforcing landlock ruleset: %s", errno)
+	}
+	return nil
+}
+
+// addRule adds the rule to the ruleset fd, the access rights not handled
+// by the ruleset are left out.
+func addRule(fd int, rule Rule, handled uint64) error {
+	pfd, err := unix.Open(rule.Path, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: rule.Path, Err: err}
+	}
+	defer unix.Close(pfd)
+
+	access := handled
+	if rule.Access == ReadOnly {
+		access &= accessRead
+	}
+
+	var st unix.Stat_t
+	if err := unix.Fstat(pfd, &st); err != nil {
+		return &os.PathError{Op: "stat", Path: rule.Path, Err: err}
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFDIR {
+		access &= accessFile
+	}
+
+	// struct landlock_path_beneath_attr is packed
+	var attr [12]byte
+	*(*uint64)(unsafe.Pointer(&attr[0])) = access
+	*(*int32)(unsafe.Pointer(&attr[8])) = int32(pfd)
+
+	_, _, errno := unix.Syscall6(sysLandlockAddRule, uintptr(fd), rulePathBeneath, uintptr(unsafe.Pointer(&attr[0])), 0, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package landlock
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestRestrict(t *testing.T) {
+	if ABI() < 1 {
+		t.Skipf("landlock not supported by the kernel")
+	}
+
+	allowed, err := ioutil.TempDir("", "landlock-rw-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(allowed)
+	denied, err := ioutil.TempDir("", "landlock-ro-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(denied)
+
+	r := Ruleset{
+		{Path: "/", Access: ReadOnly},
+		{Path: allowed, Access: ReadWrite},
+		{Path: filepath.Join(allowed, "missing"), Access: ReadWrite},
+	}
+
+	// the restricted thread is terminated with the goroutine locked to it
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runtime.LockOSThread()
+
+		if err := r.Restrict(); err != nil {
+			t.Errorf("unexpected error: %s", err)
+			return
+		}
+		if err := ioutil.WriteFile(filepath.Join(allowed, "file"), nil, 0644); err != nil {
+			t.Errorf("unexpected error while writing in %s: %s", allowed, err)
+		}
+		if _, err := ioutil.ReadDir(denied); err != nil {
+			t.Errorf("unexpected error while reading %s: %s", denied, err)
+		}
+		err := ioutil.WriteFile(filepath.Join(denied, "file"), nil, 0644)
+		if !os.IsPermission(err) {
+			t.Errorf("got error %v while writing in %s, expected permission denied", err, denied)
+		}
+	}()
+	<-done
+}
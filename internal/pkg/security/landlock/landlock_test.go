@@ -0,0 +1,72 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package landlock
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRuleset(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		want    Ruleset
+		wantErr bool
+	}{
+		{
+			name:  "ReadOnly",
+			rules: "ro=/",
+			want:  Ruleset{{Path: "/", Access: ReadOnly}},
+		},
+		{
+			name:  "Multiple",
+			rules: "ro=/usr,rw=/tmp/,ro=/etc/hosts",
+			want: Ruleset{
+				{Path: "/usr", Access: ReadOnly},
+				{Path: "/tmp", Access: ReadWrite},
+				{Path: "/etc/hosts", Access: ReadOnly},
+			},
+		},
+		{
+			name:    "Empty",
+			rules:   "",
+			wantErr: true,
+		},
+		{
+			name:    "NoPath",
+			rules:   "rw=",
+			wantErr: true,
+		},
+		{
+			name:    "BadAccess",
+			rules:   "wo=/tmp",
+			wantErr: true,
+		},
+		{
+			name:    "RelativePath",
+			rules:   "rw=tmp",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ParseRuleset(tt.rules)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(r, tt.want) {
+				t.Errorf("got ruleset %v, expected %v", r, tt.want)
+			}
+		})
+	}
+
+	r, _ := ParseRuleset("ro=/,rw=/tmp")
+	if s := r.String(); s != "ro=/,rw=/tmp" {
+		t.Errorf("got string %q for ruleset %v", s, r)
+	}
+}
@@ -0,0 +1,22 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !linux
+
+package landlock
+
+import (
+	"fmt"
+)
+
+// ABI returns 0 as Landlock is not supported on this platform.
+func ABI() int {
+	return 0
+}
+
+// Restrict returns an error for unsupported platform.
+func (r Ruleset) Restrict() error {
+	return fmt.Errorf("landlock is not supported by OS")
+}
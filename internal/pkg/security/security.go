@@ -11,6 +11,7 @@ import (
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sylabs/singularity/internal/pkg/security/apparmor"
+	"github.com/sylabs/singularity/internal/pkg/security/landlock"
 	"github.com/sylabs/singularity/internal/pkg/security/seccomp"
 	"github.com/sylabs/singularity/internal/pkg/security/selinux"
 	"github.com/sylabs/singularity/pkg/sylog"
@@ -52,6 +53,20 @@ func Configure(config *specs.Spec) error {
 	return nil
 }
 
+// ConfigureLandlock restricts the filesystem access of the current thread,
+// and of the processes it executes, with the landlock ruleset rules
+func ConfigureLandlock(rules string) error {
+	r, err := landlock.ParseRuleset(rules)
+	if err != nil {
+		return fmt.Errorf("invalid landlock ruleset: %s", err)
+	}
+	if landlock.ABI() < 1 {
+		sylog.Warningf("landlock is not enabled or supported on this system, filesystem access is not restricted")
+		return nil
+	}
+	return r.Restrict()
+}
+
 // GetParam iterates over security argument and returns parameters
 // for the security feature
 func GetParam(security []string, feature string) string {
@@ -66,3 +81,14 @@ func GetParam(security []string, feature string) string {
 	}
 	return ""
 }
+
+// HasFeature returns true if the security argument holds the feature
+// without parameters, like nofilecaps
+func HasFeature(security []string, feature string) bool {
+	for _, param := range security {
+		if param == feature {
+			return true
+		}
+	}
+	return false
+}
@@ -47,6 +47,40 @@ func TestGetParam(t *testing.T) {
 	}
 }
 
+func TestHasFeature(t *testing.T) {
+	tests := []struct {
+		security []string
+		feature  string
+		result   bool
+	}{
+		{
+			security: []string{"nofilecaps"},
+			feature:  "nofilecaps",
+			result:   true,
+		},
+		{
+			security: []string{"uid:1000", "nofilecaps"},
+			feature:  "nofilecaps",
+			result:   true,
+		},
+		{
+			security: []string{"nofilecaps:test"},
+			feature:  "nofilecaps",
+			result:   false,
+		},
+		{
+			security: []string{"uid:1000"},
+			feature:  "uid",
+			result:   false,
+		},
+	}
+	for _, tt := range tests {
+		if r := HasFeature(tt.security, tt.feature); r != tt.result {
+			t.Errorf("unexpected result for feature %s in %v, returned %v instead of %v", tt.feature, tt.security, r, tt.result)
+		}
+	}
+}
+
 func TestConfigure(t *testing.T) {
 	test.EnsurePrivilege(t)
 
@@ -0,0 +1,108 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sigstore
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// BundleMediaType is the media type prefix of sigstore bundles.
+const BundleMediaType = "application/vnd.dev.sigstore.bundle+json"
+
+// BundleObjectName is the name of the SIF data object holding a sigstore
+// bundle, this object is linked to the object group it signs.
+const BundleObjectName = "sigstore-bundle"
+
+// Bundle is the subset of the sigstore bundle format used to carry a keyless
+// signature, see https://github.com/sigstore/protobuf-specs for the complete
+// specification. Binary fields are base64 encoded in the JSON representation.
+type Bundle struct {
+	MediaType            string               `json:"mediaType"`
+	VerificationMaterial VerificationMaterial `json:"verificationMaterial"`
+	MessageSignature     MessageSignature     `json:"messageSignature"`
+}
+
+// VerificationMaterial holds the signing certificate chain and the
+// transparency log entries of a bundle.
+type VerificationMaterial struct {
+	X509CertificateChain X509CertificateChain `json:"x509CertificateChain"`
+	TlogEntries          []TlogEntry          `json:"tlogEntries"`
+}
+
+// X509CertificateChain holds DER encoded certificates, the first one
+// being the signing (leaf) certificate.
+type X509CertificateChain struct {
+	Certificates []X509Certificate `json:"certificates"`
+}
+
+// X509Certificate holds a DER encoded certificate.
+type X509Certificate struct {
+	RawBytes []byte `json:"rawBytes"`
+}
+
+// TlogEntry is a transparency log (Rekor) entry with its inclusion promise.
+type TlogEntry struct {
+	LogIndex          int64            `json:"logIndex,string"`
+	LogID             LogID            `json:"logId"`
+	IntegratedTime    int64            `json:"integratedTime,string"`
+	InclusionPromise  InclusionPromise `json:"inclusionPromise"`
+	CanonicalizedBody []byte           `json:"canonicalizedBody"`
+}
+
+// LogID identifies a log by the SHA256 digest of its DER encoded public key.
+type LogID struct {
+	KeyID []byte `json:"keyId"`
+}
+
+// InclusionPromise holds the signed entry timestamp returned by the log.
+type InclusionPromise struct {
+	SignedEntryTimestamp []byte `json:"signedEntryTimestamp"`
+}
+
+// MessageSignature is the signature over a message digest.
+type MessageSignature struct {
+	MessageDigest MessageDigest `json:"messageDigest"`
+	Signature     []byte        `json:"signature"`
+}
+
+// MessageDigest is the digest of the signed message.
+type MessageDigest struct {
+	Algorithm string `json:"algorithm"`
+	Digest    []byte `json:"digest"`
+}
+
+// ParseBundle parses a JSON encoded sigstore bundle.
+func ParseBundle(data []byte) (*Bundle, error) {
+	b := new(Bundle)
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("while decoding sigstore bundle: %s", err)
+	}
+	if !strings.HasPrefix(b.MediaType, BundleMediaType) {
+		return nil, fmt.Errorf("unsupported bundle media type %q", b.MediaType)
+	}
+	return b, nil
+}
+
+// certificates returns the parsed certificate chain of the bundle.
+func (b *Bundle) certificates() ([]*x509.Certificate, error) {
+	raw := b.VerificationMaterial.X509CertificateChain.Certificates
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("bundle doesn't contain a signing certificate")
+	}
+
+	certs := make([]*x509.Certificate, 0, len(raw))
+	for _, c := range raw {
+		cert, err := x509.ParseCertificate(c.RawBytes)
+		if err != nil {
+			return nil, fmt.Errorf("while parsing bundle certificate: %s", err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
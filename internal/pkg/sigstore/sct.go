@@ -0,0 +1,248 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sigstore
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+)
+
+// oidSCTList is the X.509 extension holding embedded signed certificate
+// timestamps (RFC 6962 section 3.3).
+var oidSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// signedCertificateTimestamp is a version 1 SCT.
+type signedCertificateTimestamp struct {
+	logID      []byte
+	timestamp  uint64
+	extensions []byte
+	signature  []byte
+}
+
+// tlsReader decodes the TLS presentation language encoding used by SCTs.
+type tlsReader struct {
+	data []byte
+	err  error
+}
+
+func (r *tlsReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < n {
+		r.err = fmt.Errorf("truncated signed certificate timestamp")
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *tlsReader) uint(n int) uint64 {
+	var v uint64
+	for _, b := range r.next(n) {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+func (r *tlsReader) vector(lenBytes int) []byte {
+	return r.next(int(r.uint(lenBytes)))
+}
+
+// derSequence returns the DER encoding of a SEQUENCE holding the already
+// encoded elements.
+func derSequence(elements ...[]byte) ([]byte, error) {
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: bytes.Join(elements, nil)})
+}
+
+// derElements returns the encoded elements of the DER encoded SEQUENCE
+// der, as found in der.
+func derElements(der []byte) ([]asn1.RawValue, error) {
+	var seq asn1.RawValue
+
+	if rest, err := asn1.Unmarshal(der, &seq); err != nil {
+		return nil, err
+	} else if len(rest) > 0 {
+		return nil, fmt.Errorf("trailing data after sequence")
+	}
+	if seq.Class != asn1.ClassUniversal || seq.Tag != asn1.TagSequence {
+		return nil, fmt.Errorf("not a sequence")
+	}
+
+	var elements []asn1.RawValue
+	for data := seq.Bytes; len(data) > 0; {
+		var e asn1.RawValue
+		var err error
+		if data, err = asn1.Unmarshal(data, &e); err != nil {
+			return nil, err
+		}
+		elements = append(elements, e)
+	}
+	return elements, nil
+}
+
+// embeddedSCTs returns the SCTs embedded in cert and the DER encoded
+// pre-certificate TBS they sign. The pre-certificate TBS is the TBS of
+// cert without the SCT list extension (RFC 6962 section 3.2), every other
+// element is kept as encoded in cert, only the enclosing lengths change.
+func embeddedSCTs(cert *x509.Certificate) ([]signedCertificateTimestamp, []byte, error) {
+	tbs, err := derElements(cert.RawTBSCertificate)
+	if err != nil {
+		return nil, nil, fmt.Errorf("while decoding certificate: %s", err)
+	}
+
+	var list []byte
+	var fields [][]byte
+
+	for _, e := range tbs {
+		// extensions are the explicitly tagged [3] field
+		if e.Class != asn1.ClassContextSpecific || e.Tag != 3 {
+			fields = append(fields, e.FullBytes)
+			continue
+		}
+		exts, err := derElements(e.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("while decoding certificate extensions: %s", err)
+		}
+		var kept [][]byte
+		for _, raw := range exts {
+			var ext pkix.Extension
+			if _, err := asn1.Unmarshal(raw.FullBytes, &ext); err != nil {
+				return nil, nil, fmt.Errorf("while decoding certificate extension: %s", err)
+			}
+			if !ext.Id.Equal(oidSCTList) {
+				kept = append(kept, raw.FullBytes)
+				continue
+			}
+			if list != nil {
+				return nil, nil, fmt.Errorf("duplicate signed certificate timestamps extension")
+			}
+			if _, err := asn1.Unmarshal(ext.Value, &list); err != nil {
+				return nil, nil, fmt.Errorf("while decoding signed certificate timestamps: %s", err)
+			}
+		}
+		if len(kept) == 0 {
+			continue
+		}
+		seq, err := derSequence(kept...)
+		if err != nil {
+			return nil, nil, err
+		}
+		field, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 3, IsCompound: true, Bytes: seq})
+		if err != nil {
+			return nil, nil, err
+		}
+		fields = append(fields, field)
+	}
+	if list == nil {
+		return nil, nil, fmt.Errorf("certificate doesn't embed signed certificate timestamps")
+	}
+
+	precert, err := derSequence(fields...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("while encoding pre-certificate: %s", err)
+	}
+
+	var scts []signedCertificateTimestamp
+
+	r := &tlsReader{data: list}
+	r = &tlsReader{data: r.vector(2), err: r.err}
+	for r.err == nil && len(r.data) > 0 {
+		s := &tlsReader{data: r.vector(2)}
+		if r.err != nil {
+			break
+		}
+		if version := s.uint(1); version != 0 {
+			continue
+		}
+		sct := signedCertificateTimestamp{
+			logID:      s.next(sha256.Size),
+			timestamp:  s.uint(8),
+			extensions: s.vector(2),
+		}
+		// only SHA256 (4) with ECDSA (3) is supported
+		hash, sig := s.uint(1), s.uint(1)
+		sct.signature = s.vector(2)
+		if s.err != nil {
+			return nil, nil, s.err
+		}
+		if hash == 4 && sig == 3 {
+			scts = append(scts, sct)
+		}
+	}
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+
+	return scts, precert, nil
+}
+
+// verifySCT checks that cert embeds at least one SCT issued by a trusted
+// certificate transparency log.
+func (tr *TrustRoot) verifySCT(cert, issuer *x509.Certificate) error {
+	scts, precert, err := embeddedSCTs(cert)
+	if err != nil {
+		return err
+	}
+
+	issuerKeyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+
+	for _, sct := range scts {
+		key, ok := tr.ctLogs[string(sct.logID)]
+		if !ok {
+			continue
+		}
+
+		var buf bytes.Buffer
+
+		// version v1 and certificate_timestamp signature type
+		buf.Write([]byte{0, 0})
+		binary.Write(&buf, binary.BigEndian, sct.timestamp)
+		// precert_entry type
+		buf.Write([]byte{0, 1})
+		buf.Write(issuerKeyHash[:])
+		buf.Write([]byte{byte(len(precert) >> 16), byte(len(precert) >> 8), byte(len(precert))})
+		buf.Write(precert)
+		binary.Write(&buf, binary.BigEndian, uint16(len(sct.extensions)))
+		buf.Write(sct.extensions)
+
+		if verifyECDSA(key, buf.Bytes(), sct.signature) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no valid signed certificate timestamp from a trusted log")
+}
+
+// verifyECDSA verifies the ASN.1 encoded ECDSA signature of the SHA256
+// digest of data.
+func verifyECDSA(key *ecdsa.PublicKey, data, signature []byte) bool {
+	sum := sha256.Sum256(data)
+	return verifyECDSADigest(key, sum[:], signature)
+}
+
+// verifyECDSADigest verifies the ASN.1 encoded ECDSA signature of digest.
+func verifyECDSADigest(key *ecdsa.PublicKey, digest, signature []byte) bool {
+	var sig struct {
+		R, S *big.Int
+	}
+
+	if rest, err := asn1.Unmarshal(signature, &sig); err != nil || len(rest) > 0 {
+		return false
+	}
+	if sig.R == nil || sig.S == nil {
+		return false
+	}
+	return ecdsa.Verify(key, digest, sig.R, sig.S)
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sigstore
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+)
+
+// TrustRoot holds the key material trusted to verify keyless signatures:
+// the certificate authority issuing signing certificates, the certificate
+// transparency logs and the transparency logs (Rekor).
+type TrustRoot struct {
+	roots         *x509.CertPool
+	intermediates []*x509.Certificate
+	ctLogs        map[string]*ecdsa.PublicKey
+	tLogs         map[string]*ecdsa.PublicKey
+}
+
+// NewTrustRoot returns a trust root from PEM encoded material: chain holds
+// the root certificate authority and its optional intermediates, ctLogKeys
+// and tLogKeys hold the public keys of the certificate transparency logs and
+// of the transparency logs respectively.
+func NewTrustRoot(chain, ctLogKeys, tLogKeys []byte) (*TrustRoot, error) {
+	tr := &TrustRoot{
+		roots: x509.NewCertPool(),
+	}
+
+	certs, err := parsePEM(chain, "CERTIFICATE")
+	if err != nil {
+		return nil, fmt.Errorf("while parsing certificate chain: %s", err)
+	}
+	for _, der := range certs {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("while parsing certificate chain: %s", err)
+		}
+		if bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+			tr.roots.AddCert(cert)
+		} else {
+			tr.intermediates = append(tr.intermediates, cert)
+		}
+	}
+
+	tr.ctLogs, err = parseLogKeys(ctLogKeys)
+	if err != nil {
+		return nil, fmt.Errorf("while parsing certificate transparency log keys: %s", err)
+	}
+	tr.tLogs, err = parseLogKeys(tLogKeys)
+	if err != nil {
+		return nil, fmt.Errorf("while parsing transparency log keys: %s", err)
+	}
+
+	return tr, nil
+}
+
+// parsePEM returns the content of all PEM blocks of type blockType found in data.
+func parsePEM(data []byte, blockType string) ([][]byte, error) {
+	var blocks [][]byte
+
+	for {
+		var block *pem.Block
+
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type == blockType {
+			blocks = append(blocks, block.Bytes)
+		}
+	}
+
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("no %s PEM block found", blockType)
+	}
+	return blocks, nil
+}
+
+// parseLogKeys returns the ECDSA public keys found in data indexed by log ID.
+func parseLogKeys(data []byte) (map[string]*ecdsa.PublicKey, error) {
+	blocks, err := parsePEM(data, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*ecdsa.PublicKey)
+	for _, der := range blocks {
+		pub, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := pub.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("unsupported public key type %T", pub)
+		}
+		keys[logID(der)] = key
+	}
+	return keys, nil
+}
+
+// logID returns the identifier of a log from its DER encoded public key.
+func logID(der []byte) string {
+	sum := sha256.Sum256(der)
+	return string(sum[:])
+}
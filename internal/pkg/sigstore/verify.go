@@ -0,0 +1,240 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sigstore
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+var (
+	// oidIssuer is the Fulcio OIDC issuer extension (raw string value).
+	oidIssuer = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	// oidIssuerV2 is the Fulcio OIDC issuer extension (DER UTF8String value).
+	oidIssuerV2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+)
+
+// Identity describes the expected signer identity.
+type Identity struct {
+	// Subject is matched against the email and URI subject
+	// alternative names of the signing certificate. The match is
+	// unanchored, ^ and $ must be used to match a whole name.
+	Subject *regexp.Regexp
+	// Issuer must be equal to the OIDC issuer recorded in the
+	// signing certificate, as the same subject may be issued by
+	// any OIDC provider trusted by the certificate authority.
+	Issuer string
+}
+
+// Result describes a verified keyless signature.
+type Result struct {
+	Subject        string
+	Issuer         string
+	IntegratedTime time.Time
+	LogIndex       int64
+}
+
+// rekorEntry is the subset of a hashedrekord transparency log entry
+// checked against the bundle signature.
+type rekorEntry struct {
+	Kind string `json:"kind"`
+	Spec struct {
+		Data struct {
+			Hash struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"value"`
+			} `json:"hash"`
+		} `json:"data"`
+		Signature struct {
+			Content   []byte `json:"content"`
+			PublicKey struct {
+				Content []byte `json:"content"`
+			} `json:"publicKey"`
+		} `json:"signature"`
+	} `json:"spec"`
+}
+
+// Verify verifies that the bundle holds a valid signature of the SHA256
+// digest for the signer identity id, using the key material of tr.
+func (b *Bundle) Verify(digest []byte, tr *TrustRoot, id Identity) (*Result, error) {
+	if id.Subject == nil || id.Issuer == "" {
+		return nil, fmt.Errorf("signer identity and OIDC issuer are required")
+	}
+
+	certs, err := b.certificates()
+	if err != nil {
+		return nil, err
+	}
+	leaf := certs[0]
+
+	entries := b.VerificationMaterial.TlogEntries
+	if len(entries) != 1 {
+		return nil, fmt.Errorf("bundle must contain exactly one transparency log entry, found %d", len(entries))
+	}
+	entry := entries[0]
+
+	if err := tr.verifyEntry(entry); err != nil {
+		return nil, err
+	}
+	integratedTime := time.Unix(entry.IntegratedTime, 0)
+
+	// signing certificates are short lived, they must be valid at the time
+	// the signature was recorded in the transparency log
+	intermediates := x509.NewCertPool()
+	for _, c := range tr.intermediates {
+		intermediates.AddCert(c)
+	}
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	chains, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         tr.roots,
+		Intermediates: intermediates,
+		CurrentTime:   integratedTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("while verifying signing certificate: %s", err)
+	}
+	if len(chains[0]) < 2 {
+		return nil, fmt.Errorf("signing certificate can't be a root certificate")
+	}
+
+	if err := tr.verifySCT(leaf, chains[0][1]); err != nil {
+		return nil, err
+	}
+
+	md := b.MessageSignature.MessageDigest
+	if md.Algorithm != "SHA2_256" {
+		return nil, fmt.Errorf("unsupported message digest algorithm %q", md.Algorithm)
+	}
+	if !bytes.Equal(md.Digest, digest) {
+		return nil, fmt.Errorf("message digest mismatch: signed data has been modified")
+	}
+
+	key, ok := leaf.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported signing key type %T", leaf.PublicKey)
+	}
+	if !verifyECDSADigest(key, digest, b.MessageSignature.Signature) {
+		return nil, fmt.Errorf("invalid signature")
+	}
+
+	if err := checkEntryBody(entry, leaf, digest, b.MessageSignature.Signature); err != nil {
+		return nil, err
+	}
+
+	r := &Result{
+		Issuer:         certIssuer(leaf),
+		IntegratedTime: integratedTime,
+		LogIndex:       entry.LogIndex,
+	}
+
+	for _, s := range certSubjects(leaf) {
+		if id.Subject != nil && id.Subject.MatchString(s) {
+			r.Subject = s
+			break
+		}
+	}
+	if r.Subject == "" {
+		return nil, fmt.Errorf("signer identity %v doesn't match %q", certSubjects(leaf), id.Subject)
+	}
+	if id.Issuer != r.Issuer {
+		return nil, fmt.Errorf("signer OIDC issuer %q doesn't match %q", r.Issuer, id.Issuer)
+	}
+
+	return r, nil
+}
+
+// verifyEntry checks the signed entry timestamp (inclusion promise) of a
+// transparency log entry.
+func (tr *TrustRoot) verifyEntry(e TlogEntry) error {
+	key, ok := tr.tLogs[string(e.LogID.KeyID)]
+	if !ok {
+		return fmt.Errorf("transparency log entry from an untrusted log")
+	}
+
+	// canonical JSON: keys sorted, no whitespace
+	payload, err := json.Marshal(struct {
+		Body           []byte `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+	}{
+		Body:           e.CanonicalizedBody,
+		IntegratedTime: e.IntegratedTime,
+		LogID:          hex.EncodeToString(e.LogID.KeyID),
+		LogIndex:       e.LogIndex,
+	})
+	if err != nil {
+		return err
+	}
+
+	if !verifyECDSA(key, payload, e.InclusionPromise.SignedEntryTimestamp) {
+		return fmt.Errorf("invalid transparency log signed entry timestamp")
+	}
+	return nil
+}
+
+// checkEntryBody ensures the transparency log entry records the bundle
+// signature and signing certificate.
+func checkEntryBody(e TlogEntry, leaf *x509.Certificate, digest, signature []byte) error {
+	var entry rekorEntry
+
+	if err := json.Unmarshal(e.CanonicalizedBody, &entry); err != nil {
+		return fmt.Errorf("while decoding transparency log entry: %s", err)
+	}
+	if entry.Kind != "hashedrekord" {
+		return fmt.Errorf("unsupported transparency log entry kind %q", entry.Kind)
+	}
+
+	hash := entry.Spec.Data.Hash
+	if hash.Algorithm != "sha256" || hash.Value != hex.EncodeToString(digest) {
+		return fmt.Errorf("transparency log entry doesn't match signed digest")
+	}
+	if !bytes.Equal(entry.Spec.Signature.Content, signature) {
+		return fmt.Errorf("transparency log entry doesn't match signature")
+	}
+	block, _ := pem.Decode(entry.Spec.Signature.PublicKey.Content)
+	if block == nil || !bytes.Equal(block.Bytes, leaf.Raw) {
+		return fmt.Errorf("transparency log entry doesn't match signing certificate")
+	}
+	return nil
+}
+
+// certSubjects returns the identities recorded in the subject alternative
+// names of cert.
+func certSubjects(cert *x509.Certificate) []string {
+	subjects := append([]string{}, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		subjects = append(subjects, u.String())
+	}
+	return subjects
+}
+
+// certIssuer returns the OIDC issuer recorded in cert.
+func certIssuer(cert *x509.Certificate) string {
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(oidIssuerV2):
+			var issuer string
+			if _, err := asn1.UnmarshalWithParams(ext.Value, &issuer, "utf8"); err == nil {
+				return issuer
+			}
+		case ext.Id.Equal(oidIssuer):
+			return string(ext.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,441 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sigstore
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testAuthority emulates a certificate authority (Fulcio), a certificate
+// transparency log and a transparency log (Rekor).
+type testAuthority struct {
+	caKey    *ecdsa.PrivateKey
+	caCert   *x509.Certificate
+	ctKey    *ecdsa.PrivateKey
+	rekorKey *ecdsa.PrivateKey
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("while generating key: %s", err)
+	}
+	return key
+}
+
+func signASN1(t *testing.T, key *ecdsa.PrivateKey, digest []byte) []byte {
+	t.Helper()
+
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+	if err != nil {
+		t.Fatalf("while signing: %s", err)
+	}
+	sig, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		t.Fatalf("while encoding signature: %s", err)
+	}
+	return sig
+}
+
+func pkixDER(t *testing.T, key *ecdsa.PrivateKey) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatalf("while encoding public key: %s", err)
+	}
+	return der
+}
+
+func newTestAuthority(t *testing.T) *testAuthority {
+	t.Helper()
+
+	a := &testAuthority{
+		caKey:    newKey(t),
+		ctKey:    newKey(t),
+		rekorKey: newKey(t),
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test root"},
+		NotBefore:             time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, a.caKey.Public(), a.caKey)
+	if err != nil {
+		t.Fatalf("while creating root certificate: %s", err)
+	}
+	a.caCert, err = x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("while parsing root certificate: %s", err)
+	}
+	return a
+}
+
+// trustRoot returns the trust root matching the authority.
+func (a *testAuthority) trustRoot(t *testing.T) *TrustRoot {
+	t.Helper()
+
+	chain := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: a.caCert.Raw})
+	ctKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkixDER(t, a.ctKey)})
+	rekorKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkixDER(t, a.rekorKey)})
+
+	tr, err := NewTrustRoot(chain, ctKey, rekorKey)
+	if err != nil {
+		t.Fatalf("while creating trust root: %s", err)
+	}
+	return tr
+}
+
+// issueCertificate issues a short lived signing certificate for key with
+// an embedded signed certificate timestamp.
+func (a *testAuthority) issueCertificate(t *testing.T, key *ecdsa.PrivateKey, email, issuer string, at time.Time) []byte {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(at.UnixNano()),
+		NotBefore:      at.Add(-time.Minute),
+		NotAfter:       at.Add(10 * time.Minute),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		EmailAddresses: []string{email},
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidIssuer, Value: []byte(issuer)},
+		},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, a.caCert, key.Public(), a.caKey)
+	if err != nil {
+		t.Fatalf("while creating pre-certificate: %s", err)
+	}
+	precert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("while parsing pre-certificate: %s", err)
+	}
+	tbs := precert.RawTBSCertificate
+
+	var signed bytes.Buffer
+	timestamp := uint64(at.UnixNano() / int64(time.Millisecond))
+	issuerKeyHash := sha256.Sum256(a.caCert.RawSubjectPublicKeyInfo)
+	signed.Write([]byte{0, 0})
+	binary.Write(&signed, binary.BigEndian, timestamp)
+	signed.Write([]byte{0, 1})
+	signed.Write(issuerKeyHash[:])
+	signed.Write([]byte{byte(len(tbs) >> 16), byte(len(tbs) >> 8), byte(len(tbs))})
+	signed.Write(tbs)
+	signed.Write([]byte{0, 0})
+	sum := sha256.Sum256(signed.Bytes())
+	sig := signASN1(t, a.ctKey, sum[:])
+
+	var sct bytes.Buffer
+	logID := sha256.Sum256(pkixDER(t, a.ctKey))
+	sct.WriteByte(0)
+	sct.Write(logID[:])
+	binary.Write(&sct, binary.BigEndian, timestamp)
+	sct.Write([]byte{0, 0, 4, 3})
+	binary.Write(&sct, binary.BigEndian, uint16(len(sig)))
+	sct.Write(sig)
+
+	var list bytes.Buffer
+	binary.Write(&list, binary.BigEndian, uint16(sct.Len()+2))
+	binary.Write(&list, binary.BigEndian, uint16(sct.Len()))
+	list.Write(sct.Bytes())
+
+	value, err := asn1.Marshal(list.Bytes())
+	if err != nil {
+		t.Fatalf("while encoding signed certificate timestamps: %s", err)
+	}
+	template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{Id: oidSCTList, Value: value})
+
+	der, err = x509.CreateCertificate(rand.Reader, template, a.caCert, key.Public(), a.caKey)
+	if err != nil {
+		t.Fatalf("while creating certificate: %s", err)
+	}
+	return der
+}
+
+// sign returns a bundle holding a keyless signature of digest by email.
+func (a *testAuthority) sign(t *testing.T, digest []byte, email, issuer string) *Bundle {
+	t.Helper()
+
+	at := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	key := newKey(t)
+	cert := a.issueCertificate(t, key, email, issuer, at)
+	sig := signASN1(t, key, digest)
+
+	var entry rekorEntry
+	entry.Kind = "hashedrekord"
+	entry.Spec.Data.Hash.Algorithm = "sha256"
+	entry.Spec.Data.Hash.Value = hex.EncodeToString(digest)
+	entry.Spec.Signature.Content = sig
+	entry.Spec.Signature.PublicKey.Content = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})
+	body, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatalf("while encoding log entry: %s", err)
+	}
+
+	logID := sha256.Sum256(pkixDER(t, a.rekorKey))
+	tlog := TlogEntry{
+		LogIndex:          42,
+		LogID:             LogID{KeyID: logID[:]},
+		IntegratedTime:    at.Unix(),
+		CanonicalizedBody: body,
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"body":           body,
+		"integratedTime": tlog.IntegratedTime,
+		"logID":          hex.EncodeToString(logID[:]),
+		"logIndex":       tlog.LogIndex,
+	})
+	if err != nil {
+		t.Fatalf("while encoding signed entry timestamp payload: %s", err)
+	}
+	sum := sha256.Sum256(payload)
+	tlog.InclusionPromise.SignedEntryTimestamp = signASN1(t, a.rekorKey, sum[:])
+
+	b := &Bundle{MediaType: BundleMediaType + ";version=0.1"}
+	b.VerificationMaterial.X509CertificateChain.Certificates = []X509Certificate{{RawBytes: cert}}
+	b.VerificationMaterial.TlogEntries = []TlogEntry{tlog}
+	b.MessageSignature.MessageDigest = MessageDigest{Algorithm: "SHA2_256", Digest: digest}
+	b.MessageSignature.Signature = sig
+	return b
+}
+
+func TestEmbeddedSCTs(t *testing.T) {
+	a := newTestAuthority(t)
+	key := newKey(t)
+
+	// the SCT list isn't the last extension, the other extensions keep
+	// their order and encoding in the pre-certificate
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2020, 10, 2, 0, 0, 0, 0, time.UTC),
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidIssuer, Value: []byte("https://accounts.example.com")},
+			{Id: asn1.ObjectIdentifier{1, 2, 3, 4}, Value: []byte{0x05, 0x00}},
+		},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, a.caCert, key.Public(), a.caKey)
+	if err != nil {
+		t.Fatalf("while creating pre-certificate: %s", err)
+	}
+	precert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("while parsing pre-certificate: %s", err)
+	}
+
+	list, err := asn1.Marshal([]byte{0, 0})
+	if err != nil {
+		t.Fatalf("while encoding signed certificate timestamps: %s", err)
+	}
+	template.ExtraExtensions = []pkix.Extension{
+		template.ExtraExtensions[0],
+		{Id: oidSCTList, Value: list},
+		template.ExtraExtensions[1],
+	}
+	der, err = x509.CreateCertificate(rand.Reader, template, a.caCert, key.Public(), a.caKey)
+	if err != nil {
+		t.Fatalf("while creating certificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("while parsing certificate: %s", err)
+	}
+
+	scts, tbs, err := embeddedSCTs(cert)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(scts) != 0 {
+		t.Errorf("unexpected signed certificate timestamps %v", scts)
+	}
+	if !bytes.Equal(tbs, precert.RawTBSCertificate) {
+		t.Errorf("pre-certificate TBS doesn't match the issued pre-certificate")
+	}
+
+	if _, _, err := embeddedSCTs(precert); err == nil {
+		t.Errorf("unexpected success without signed certificate timestamps")
+	}
+}
+
+func TestParseBundle(t *testing.T) {
+	a := newTestAuthority(t)
+	digest := sha256.Sum256([]byte("data"))
+	b := a.sign(t, digest[:], "jane@example.com", "https://accounts.example.com")
+
+	data, err := json.Marshal(b)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := ParseBundle(data); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	b.MediaType = "application/json"
+	data, err = json.Marshal(b)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := ParseBundle(data); err == nil {
+		t.Errorf("unexpected success with media type %q", b.MediaType)
+	}
+
+	if _, err := ParseBundle([]byte("{")); err == nil {
+		t.Errorf("unexpected success with invalid JSON")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	a := newTestAuthority(t)
+	other := newTestAuthority(t)
+
+	digest := sha256.Sum256([]byte("data"))
+	otherDigest := sha256.Sum256([]byte("modified data"))
+
+	const (
+		email  = "jane@example.com"
+		issuer = "https://accounts.example.com"
+	)
+
+	tests := []struct {
+		name    string
+		digest  []byte
+		tr      *TrustRoot
+		id      Identity
+		wantErr string
+	}{
+		{
+			name:   "MatchingIdentity",
+			digest: digest[:],
+			tr:     a.trustRoot(t),
+			id:     Identity{Subject: regexp.MustCompile(`^jane@example\.com$`), Issuer: issuer},
+		},
+		{
+			name:   "MatchingIdentityUnanchored",
+			digest: digest[:],
+			tr:     a.trustRoot(t),
+			id:     Identity{Subject: regexp.MustCompile(`@example\.com`), Issuer: issuer},
+		},
+		{
+			name:    "MissingIssuer",
+			digest:  digest[:],
+			tr:      a.trustRoot(t),
+			id:      Identity{Subject: regexp.MustCompile(`^jane@example\.com$`)},
+			wantErr: "OIDC issuer are required",
+		},
+		{
+			name:    "MismatchedIdentity",
+			digest:  digest[:],
+			tr:      a.trustRoot(t),
+			id:      Identity{Subject: regexp.MustCompile(`^john@example\.com$`), Issuer: issuer},
+			wantErr: "doesn't match",
+		},
+		{
+			name:    "MismatchedIssuer",
+			digest:  digest[:],
+			tr:      a.trustRoot(t),
+			id:      Identity{Subject: regexp.MustCompile(`^jane@example\.com$`), Issuer: "https://token.example.com"},
+			wantErr: "OIDC issuer",
+		},
+		{
+			name:    "ModifiedData",
+			digest:  otherDigest[:],
+			tr:      a.trustRoot(t),
+			id:      Identity{Subject: regexp.MustCompile(`^jane@example\.com$`), Issuer: issuer},
+			wantErr: "digest mismatch",
+		},
+		{
+			name:    "UntrustedAuthority",
+			digest:  digest[:],
+			tr:      other.trustRoot(t),
+			id:      Identity{Subject: regexp.MustCompile(`^jane@example\.com$`), Issuer: issuer},
+			wantErr: "untrusted log",
+		},
+	}
+
+	b := a.sign(t, digest[:], email, issuer)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := b.Verify(tt.digest, tt.tr, tt.id)
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("unexpected success")
+				}
+				if !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %q, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if r.Subject != email {
+				t.Errorf("got subject %q, want %q", r.Subject, email)
+			}
+			if r.Issuer != issuer {
+				t.Errorf("got issuer %q, want %q", r.Issuer, issuer)
+			}
+			if r.LogIndex != 42 {
+				t.Errorf("got log index %d, want 42", r.LogIndex)
+			}
+		})
+	}
+}
+
+func TestVerifyUntrustedTransparency(t *testing.T) {
+	a := newTestAuthority(t)
+	digest := sha256.Sum256([]byte("data"))
+	id := Identity{Subject: regexp.MustCompile(`^jane@example\.com$`), Issuer: "https://accounts.example.com"}
+
+	chain := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: a.caCert.Raw})
+	ctKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkixDER(t, a.ctKey)})
+	rekorKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkixDER(t, a.rekorKey)})
+	otherKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkixDER(t, newKey(t))})
+
+	// certificate transparency log unknown
+	tr, err := NewTrustRoot(chain, otherKey, rekorKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	b := a.sign(t, digest[:], "jane@example.com", "https://accounts.example.com")
+	if _, err := b.Verify(digest[:], tr, id); err == nil || !strings.Contains(err.Error(), "certificate timestamp") {
+		t.Errorf("got error %v, want signed certificate timestamp error", err)
+	}
+
+	// tampered signed entry timestamp
+	tr, err = NewTrustRoot(chain, ctKey, rekorKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	b.VerificationMaterial.TlogEntries[0].LogIndex++
+	if _, err := b.Verify(digest[:], tr, id); err == nil || !strings.Contains(err.Error(), "signed entry timestamp") {
+		t.Errorf("got error %v, want signed entry timestamp error", err)
+	}
+}
@@ -20,7 +20,7 @@ import (
 
 	toml "github.com/pelletier/go-toml"
 	"github.com/sylabs/sif/pkg/integrity"
-	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/pkg/image"
 	"golang.org/x/crypto/openpgp"
 )
 
@@ -209,7 +209,7 @@ func shouldRun(ecl *EclConfig, fp *os.File, kr openpgp.KeyRing) (ok bool, err er
 		return false, fmt.Errorf("%s not part of any execgroup", fp.Name())
 	}
 
-	f, err := sif.LoadContainerFp(fp, true)
+	f, _, err := image.LoadSIF(fp, true)
 	if err != nil {
 		return false, err
 	}
@@ -11,6 +11,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/sylabs/singularity/internal/pkg/security/landlock"
 	"github.com/sylabs/singularity/internal/pkg/security/seccomp"
 	"github.com/sylabs/singularity/pkg/util/fs/proc"
 )
@@ -47,6 +48,14 @@ func Seccomp(t *testing.T) {
 	}
 }
 
+// Landlock checks that the Landlock LSM is supported and enabled,
+// if not the current test is skipped with a message.
+func Landlock(t *testing.T) {
+	if landlock.ABI() < 1 {
+		t.Skipf("landlock not supported by the kernel or disabled")
+	}
+}
+
 // Arch checks the test machine has the specified architecture.
 // If not, the test is skipped with a message.
 func Arch(t *testing.T, arch string) {
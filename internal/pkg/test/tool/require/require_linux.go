@@ -17,6 +17,7 @@ import (
 	"github.com/containerd/cgroups"
 	"github.com/sylabs/singularity/internal/pkg/buildcfg"
 	"github.com/sylabs/singularity/pkg/network"
+	"golang.org/x/sys/unix"
 )
 
 var hasUserNamespace bool
@@ -113,6 +114,14 @@ func Network(t *testing.T) {
 	}
 }
 
+// IPv6 checks that IPv6 is enabled, if not the current
+// test is skipped with a message.
+func IPv6(t *testing.T) {
+	if !network.IPv6Enabled() {
+		t.Skipf("IPv6 seems disabled")
+	}
+}
+
 // Cgroups checks that cgroups is enabled, if not the
 // current test is skipped with a message.
 func Cgroups(t *testing.T) {
@@ -122,6 +131,16 @@ func Cgroups(t *testing.T) {
 	}
 }
 
+// CgroupsV2 checks that the cgroup v2 unified hierarchy is
+// mounted at /sys/fs/cgroup, if not the current test is
+// skipped with a message.
+func CgroupsV2(t *testing.T) {
+	var st unix.Statfs_t
+	if err := unix.Statfs("/sys/fs/cgroup", &st); err != nil || st.Type != unix.CGROUP2_SUPER_MAGIC {
+		t.Skipf("cgroup v2 unified hierarchy not mounted at /sys/fs/cgroup")
+	}
+}
+
 // CgroupsFreezer checks that cgroup freezer subsystem is
 // available, if not the current test is skipped with a
 // message
@@ -137,3 +156,16 @@ func CgroupsFreezer(t *testing.T) {
 	}
 	t.Skipf("no cgroups freezer subsystem available")
 }
+
+// IDMappedMount checks that the kernel supports idmapped mounts,
+// if not the current test is skipped with a message.
+func IDMappedMount(t *testing.T) {
+	// mount_setattr was introduced along with idmapped mounts,
+	// called with a bad file descriptor it's only reported as
+	// missing by kernels without idmapped mounts support
+	const sysMountSetattr = 442
+	_, _, errno := unix.Syscall6(sysMountSetattr, uintptr(0xffffffff), 0, 0, 0, 0, 0)
+	if errno == unix.ENOSYS {
+		t.Skipf("idmapped mounts not supported by the kernel (Linux 5.12+ required)")
+	}
+}
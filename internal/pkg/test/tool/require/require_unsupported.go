@@ -23,15 +23,34 @@ func Network(t *testing.T) {
 	t.Skipf("network not supported on this platform")
 }
 
+// IPv6 checks that IPv6 is enabled, if not the current
+// test is skipped with a message.
+func IPv6(t *testing.T) {
+	t.Skipf("network not supported on this platform")
+}
+
 // Cgroups checks that cgroups is enabled, if not the
 // current test is skipped with a message.
 func Cgroups(t *testing.T) {
 	t.Skipf("cgroups not supported on this platform")
 }
 
+// CgroupsV2 checks that the cgroup v2 unified hierarchy is
+// mounted at /sys/fs/cgroup, if not the current test is
+// skipped with a message.
+func CgroupsV2(t *testing.T) {
+	t.Skipf("cgroups not supported on this platform")
+}
+
 // CgroupsFreezer checks that cgroup freezer subsystem is
 // available, if not the current test is skipped with a
 // message
 func CgroupsFreezer(t *testing.T) {
 	t.Skipf("cgroups not supported on this platform")
 }
+
+// IDMappedMount checks that the kernel supports idmapped mounts,
+// if not the current test is skipped with a message.
+func IDMappedMount(t *testing.T) {
+	t.Skipf("idmapped mounts not supported on this platform")
+}
@@ -0,0 +1,305 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package tuf
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// canonicalJSON returns the OLPC canonical JSON encoding of the JSON
+// document b, the encoding signed by the keys: object keys are sorted by
+// their bytes, there is no insignificant white space, only integers are
+// allowed and strings are written as their raw bytes with only '"' and
+// '\' escaped. The strings are not decoded as UTF-8 text, so the bytes of
+// invalid UTF-8 sequences are kept.
+func canonicalJSON(b []byte) ([]byte, error) {
+	p := &canonicalParser{b: b}
+	buf := new(bytes.Buffer)
+
+	p.skipSpace()
+	if err := p.value(buf); err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.i != len(p.b) {
+		return nil, p.errorf("unexpected data after the top-level value")
+	}
+	return buf.Bytes(), nil
+}
+
+// canonicalParser reads a JSON document and writes its canonical encoding.
+type canonicalParser struct {
+	b []byte
+	i int
+}
+
+func (p *canonicalParser) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("canonical JSON: offset %d: %s", p.i, fmt.Sprintf(format, a...))
+}
+
+func (p *canonicalParser) skipSpace() {
+	for p.i < len(p.b) {
+		switch p.b[p.i] {
+		case ' ', '\t', '\n', '\r':
+			p.i++
+		default:
+			return
+		}
+	}
+}
+
+func (p *canonicalParser) value(buf *bytes.Buffer) error {
+	if p.i >= len(p.b) {
+		return p.errorf("unexpected end of data")
+	}
+
+	switch c := p.b[p.i]; {
+	case c == '{':
+		return p.object(buf)
+	case c == '[':
+		return p.array(buf)
+	case c == '"':
+		s, err := p.string()
+		if err != nil {
+			return err
+		}
+		writeCanonicalString(buf, s)
+		return nil
+	case c == '-' || (c >= '0' && c <= '9'):
+		return p.number(buf)
+	}
+
+	for _, lit := range []string{"true", "false", "null"} {
+		if bytes.HasPrefix(p.b[p.i:], []byte(lit)) {
+			p.i += len(lit)
+			buf.WriteString(lit)
+			return nil
+		}
+	}
+	return p.errorf("invalid character %q", p.b[p.i])
+}
+
+func (p *canonicalParser) object(buf *bytes.Buffer) error {
+	type member struct {
+		key   []byte
+		value []byte
+	}
+	var members []member
+
+	p.i++
+	p.skipSpace()
+	if p.i < len(p.b) && p.b[p.i] == '}' {
+		p.i++
+		buf.WriteString("{}")
+		return nil
+	}
+
+	for {
+		p.skipSpace()
+		if p.i >= len(p.b) || p.b[p.i] != '"' {
+			return p.errorf("object key expected")
+		}
+		key, err := p.string()
+		if err != nil {
+			return err
+		}
+		for _, m := range members {
+			if bytes.Equal(m.key, key) {
+				return p.errorf("duplicate object key %q", key)
+			}
+		}
+		p.skipSpace()
+		if p.i >= len(p.b) || p.b[p.i] != ':' {
+			return p.errorf("':' expected after object key")
+		}
+		p.i++
+		p.skipSpace()
+		v := new(bytes.Buffer)
+		if err := p.value(v); err != nil {
+			return err
+		}
+		members = append(members, member{key: key, value: v.Bytes()})
+
+		p.skipSpace()
+		if p.i >= len(p.b) {
+			return p.errorf("unexpected end of data")
+		}
+		if p.b[p.i] == '}' {
+			p.i++
+			break
+		}
+		if p.b[p.i] != ',' {
+			return p.errorf("',' or '}' expected in object")
+		}
+		p.i++
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return bytes.Compare(members[i].key, members[j].key) < 0
+	})
+
+	buf.WriteByte('{')
+	for i, m := range members {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeCanonicalString(buf, m.key)
+		buf.WriteByte(':')
+		buf.Write(m.value)
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+func (p *canonicalParser) array(buf *bytes.Buffer) error {
+	p.i++
+	p.skipSpace()
+	buf.WriteByte('[')
+	if p.i < len(p.b) && p.b[p.i] == ']' {
+		p.i++
+		buf.WriteByte(']')
+		return nil
+	}
+
+	for n := 0; ; n++ {
+		if n > 0 {
+			buf.WriteByte(',')
+		}
+		p.skipSpace()
+		if err := p.value(buf); err != nil {
+			return err
+		}
+		p.skipSpace()
+		if p.i >= len(p.b) {
+			return p.errorf("unexpected end of data")
+		}
+		if p.b[p.i] == ']' {
+			p.i++
+			break
+		}
+		if p.b[p.i] != ',' {
+			return p.errorf("',' or ']' expected in array")
+		}
+		p.i++
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+// number writes the integer at the current offset, canonical JSON has no
+// fractional or exponent notation.
+func (p *canonicalParser) number(buf *bytes.Buffer) error {
+	start := p.i
+	if p.b[p.i] == '-' {
+		p.i++
+	}
+	for p.i < len(p.b) && p.b[p.i] >= '0' && p.b[p.i] <= '9' {
+		p.i++
+	}
+	if p.i < len(p.b) {
+		switch p.b[p.i] {
+		case '.', 'e', 'E':
+			return p.errorf("non-integer numbers are not allowed")
+		}
+	}
+	n, err := strconv.ParseInt(string(p.b[start:p.i]), 10, 64)
+	if err != nil {
+		return p.errorf("invalid integer %q", p.b[start:p.i])
+	}
+	buf.WriteString(strconv.FormatInt(n, 10))
+	return nil
+}
+
+// string returns the raw bytes of the string at the current offset with
+// its escape sequences decoded.
+func (p *canonicalParser) string() ([]byte, error) {
+	p.i++
+	var s []byte
+	for {
+		if p.i >= len(p.b) {
+			return nil, p.errorf("unterminated string")
+		}
+		c := p.b[p.i]
+		switch {
+		case c == '"':
+			p.i++
+			return s, nil
+		case c < 0x20:
+			return nil, p.errorf("control character in string")
+		case c != '\\':
+			s = append(s, c)
+			p.i++
+			continue
+		}
+
+		p.i++
+		if p.i >= len(p.b) {
+			return nil, p.errorf("unterminated string")
+		}
+		e := p.b[p.i]
+		p.i++
+		switch e {
+		case '"', '\\', '/':
+			s = append(s, e)
+		case 'b':
+			s = append(s, '\b')
+		case 'f':
+			s = append(s, '\f')
+		case 'n':
+			s = append(s, '\n')
+		case 'r':
+			s = append(s, '\r')
+		case 't':
+			s = append(s, '\t')
+		case 'u':
+			r, err := p.hex4()
+			if err != nil {
+				return nil, err
+			}
+			if utf16.IsSurrogate(r) && bytes.HasPrefix(p.b[p.i:], []byte(`\u`)) {
+				p.i += 2
+				r2, err := p.hex4()
+				if err != nil {
+					return nil, err
+				}
+				r = utf16.DecodeRune(r, r2)
+			}
+			var u [utf8.UTFMax]byte
+			s = append(s, u[:utf8.EncodeRune(u[:], r)]...)
+		default:
+			return nil, p.errorf("invalid escape sequence '\\%c'", e)
+		}
+	}
+}
+
+func (p *canonicalParser) hex4() (rune, error) {
+	if p.i+4 > len(p.b) {
+		return 0, p.errorf("truncated unicode escape sequence")
+	}
+	n, err := strconv.ParseUint(string(p.b[p.i:p.i+4]), 16, 16)
+	if err != nil {
+		return 0, p.errorf("invalid unicode escape sequence")
+	}
+	p.i += 4
+	return rune(n), nil
+}
+
+// writeCanonicalString writes the string s with only '"' and '\' escaped.
+func writeCanonicalString(buf *bytes.Buffer, s []byte) {
+	buf.WriteByte('"')
+	for _, c := range s {
+		if c == '"' || c == '\\' {
+			buf.WriteByte('\\')
+		}
+		buf.WriteByte(c)
+	}
+	buf.WriteByte('"')
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package tuf
+
+import (
+	"testing"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{name: "SortedKeys", in: `{ "b": 1, "a": [true, false, null], "c": {} }`, want: `{"a":[true,false,null],"b":1,"c":{}}`},
+		{name: "Integers", in: `[-0, 007, -42]`, want: `[0,7,-42]`},
+		{name: "Float", in: `{"a": 1.5}`, wantErr: true},
+		{name: "Exponent", in: `{"a": 1e3}`, wantErr: true},
+		{name: "Escapes", in: `"a\"b\\c\/d\n\t"`, want: "\"a\\\"b\\\\c/d\n\t\""},
+		{name: "LineSeparators", in: "\"\u2028\\u2029<>&\"", want: "\"\u2028\u2029<>&\""},
+		{name: "SurrogatePair", in: `"😀"`, want: "\"\U0001F600\""},
+		{name: "InvalidUTF8", in: "\"\xff\xfe\"", want: "\"\xff\xfe\""},
+		{name: "KeyByteOrder", in: `{"é": 1, "z": 2, "Z": 3}`, want: `{"Z":3,"z":2,"é":1}`},
+		{name: "DuplicateKey", in: `{"a": 1, "a": 2}`, wantErr: true},
+		{name: "TrailingData", in: `{} {}`, wantErr: true},
+		{name: "Unterminated", in: `{"a": "b`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := canonicalJSON([]byte(tt.in))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
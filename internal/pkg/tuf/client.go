@@ -0,0 +1,461 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package tuf
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
+)
+
+// maxMetadataSize is the maximum size of a metadata file.
+const maxMetadataSize = 16 << 20
+
+// maxRootRotations is the maximum number of root metadata versions
+// fetched by an update.
+const maxRootRotations = 32
+
+// errNotFound is returned by fetch when the metadata file doesn't exist.
+var errNotFound = errors.New("metadata not found")
+
+var (
+	// ErrExpired is returned when metadata is expired, it's stale or
+	// replayed by a source which stopped updating it.
+	ErrExpired = errors.New("metadata expired")
+	// ErrRollback is returned when metadata is older than the metadata
+	// already trusted.
+	ErrRollback = errors.New("metadata rolled back")
+	// ErrNotLatest is returned when an image isn't listed by the current
+	// targets metadata, it's an older or unknown version.
+	ErrNotLatest = errors.New("image is not the latest signed version")
+)
+
+// Config is the freshness metadata source of a remote endpoint.
+type Config struct {
+	// Source is the URL or the directory the timestamp, snapshot and
+	// targets metadata are read from.
+	Source string `yaml:"Source"`
+	// Root is the path of the initially trusted root metadata, listing
+	// the keys of all roles. Newer root metadata versions are read from
+	// the source as N.root.json and must be signed by the keys of both
+	// the previous and the new version.
+	Root string `yaml:"Root"`
+}
+
+// state records the versions of the last trusted metadata of a source.
+type state struct {
+	Root      int `json:"root"`
+	Timestamp int `json:"timestamp"`
+	Snapshot  int `json:"snapshot"`
+	Targets   int `json:"targets"`
+}
+
+// Client reads and verifies the metadata of a source.
+type Client struct {
+	c        Config
+	stateDir string
+	now      func() time.Time
+	// stateID identifies the trusted state of the root keys
+	stateID string
+}
+
+// NewClient returns a client reading the metadata of the source c, the
+// versions of the trusted metadata are recorded in stateDir to reject
+// older metadata later.
+func NewClient(c Config, stateDir string) *Client {
+	return &Client{c: c, stateDir: stateDir, now: time.Now}
+}
+
+// Source returns the metadata source of the client.
+func (c *Client) Source() string {
+	return c.c.Source
+}
+
+// fetch returns the content of the metadata file name of the source.
+func (c *Client) fetch(ctx context.Context, name string) ([]byte, error) {
+	if !strings.HasPrefix(c.c.Source, "http://") && !strings.HasPrefix(c.c.Source, "https://") {
+		f, err := os.Open(filepath.Join(strings.TrimPrefix(c.c.Source, "file://"), name))
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s: %w", name, errNotFound)
+		} else if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return ioutil.ReadAll(io.LimitReader(f, maxMetadataSize))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(c.c.Source, "/")+"/"+name, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", useragent.Value())
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s: %w", name, errNotFound)
+	} else if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("while fetching %s: %s", name, res.Status)
+	}
+	return ioutil.ReadAll(io.LimitReader(res.Body, maxMetadataSize))
+}
+
+// rootStateID returns the identifier of the trusted state of the root
+// metadata r, derived from the key IDs of its root role, so that the state
+// follows the trusted keys rather than the URL they are read from.
+func rootStateID(r *Root) string {
+	ids := append([]string(nil), r.Roles[RoleRoot].KeyIDs...)
+	sort.Strings(ids)
+	h := sha256.Sum256([]byte(strings.Join(ids, "\n")))
+	return hex.EncodeToString(h[:])
+}
+
+// statePath returns the path of the state file of the trusted root keys.
+func (c *Client) statePath() string {
+	return filepath.Join(c.stateDir, c.stateID+".json")
+}
+
+// rootPath returns the path of the latest root metadata trusted after a
+// rotation of the root keys.
+func (c *Client) rootPath() string {
+	return filepath.Join(c.stateDir, c.stateID+".root.json")
+}
+
+func (c *Client) readState() (state, error) {
+	var s state
+	b, err := ioutil.ReadFile(c.statePath())
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return s, fmt.Errorf("while reading freshness state %s: %s", c.statePath(), err)
+	}
+	return s, nil
+}
+
+func (c *Client) writeState(s state) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return c.writeFile(c.statePath(), b)
+}
+
+// writeFile atomically replaces the file path of the state directory
+// with b.
+func (c *Client) writeFile(path string, b []byte) error {
+	if err := os.MkdirAll(c.stateDir, 0700); err != nil {
+		return err
+	}
+	tmp, err := fs.MakeTmpFile(c.stateDir, "state-", 0600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// decode verifies the signed metadata b of the role name with the keys of
+// root, decodes it into v and checks its type and expiration.
+func (c *Client) decode(b []byte, name string, root *Root, v interface{}, common *Common) error {
+	if err := verifyMetadata(b, name, root, v, common); err != nil {
+		return err
+	}
+	return c.checkExpires(name, common)
+}
+
+// checkExpires checks that the metadata of the role name isn't expired.
+func (c *Client) checkExpires(name string, common *Common) error {
+	if !common.Expires.After(c.now()) {
+		return fmt.Errorf("%s metadata version %d expired on %s: %w", name, common.Version, common.Expires.Format(time.RFC3339), ErrExpired)
+	}
+	return nil
+}
+
+// verifyMetadata verifies the signed metadata b of the role name with the
+// keys of root, decodes it into v and checks its type.
+func verifyMetadata(b []byte, name string, root *Root, v interface{}, common *Common) error {
+	var s Signed
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("while decoding %s metadata: %s", name, err)
+	}
+	role, ok := root.Roles[name]
+	if !ok {
+		return fmt.Errorf("no %s role in root metadata", name)
+	}
+	if err := verifySignatures(&s, name, role, root.Keys); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(s.Signed, v); err != nil {
+		return fmt.Errorf("while decoding %s metadata: %s", name, err)
+	}
+	if common.Type != name {
+		return fmt.Errorf("%s metadata has type %q", name, common.Type)
+	}
+	return nil
+}
+
+// readRoot decodes the self-signed root metadata b, checking its key IDs
+// and its signatures, but not its expiration.
+func readRoot(b []byte) (*Root, error) {
+	var s Signed
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("while decoding root metadata: %s", err)
+	}
+	root := new(Root)
+	if err := json.Unmarshal(s.Signed, root); err != nil {
+		return nil, fmt.Errorf("while decoding root metadata: %s", err)
+	}
+	if err := checkKeyIDs(root); err != nil {
+		return nil, fmt.Errorf("root metadata: %s", err)
+	}
+	if err := verifyMetadata(b, RoleRoot, root, root, &root.Common); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// trustedRoot returns the latest trusted root metadata: the configured
+// root metadata root, or the version it was rotated to by a previous
+// update.
+func (c *Client) trustedRoot(root *Root, st state) (*Root, error) {
+	if root.Version >= st.Root {
+		return root, nil
+	}
+
+	b, err := ioutil.ReadFile(c.rootPath())
+	if err != nil {
+		return nil, fmt.Errorf("while reading rotated root metadata: %s", err)
+	}
+	rotated, err := readRoot(b)
+	if err != nil {
+		return nil, err
+	}
+	if rotated.Version != st.Root {
+		return nil, fmt.Errorf("rotated root metadata version %d doesn't match the trusted version %d", rotated.Version, st.Root)
+	}
+	return rotated, nil
+}
+
+// rotateRoot reads the root metadata versions following root from the
+// source, each must be signed by the threshold of the root keys of both
+// the previous and the new version. The versions of the metadata whose
+// keys changed are reset in st, to recover from the compromise of these
+// keys.
+func (c *Client) rotateRoot(ctx context.Context, root *Root, st *state) (*Root, error) {
+	for i := 0; i < maxRootRotations; i++ {
+		name := fmt.Sprintf("%d.root.json", root.Version+1)
+		b, err := c.fetch(ctx, name)
+		if errors.Is(err, errNotFound) {
+			return root, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("while reading root metadata: %s", err)
+		}
+
+		next := new(Root)
+		if err := verifyMetadata(b, RoleRoot, root, next, &next.Common); err != nil {
+			return nil, fmt.Errorf("%s is not signed by the trusted root keys: %s", name, err)
+		}
+		if _, err := readRoot(b); err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		if next.Version != root.Version+1 {
+			return nil, fmt.Errorf("%s has version %d", name, next.Version)
+		}
+		if err := c.writeFile(c.rootPath(), b); err != nil {
+			return nil, fmt.Errorf("while recording rotated root metadata: %s", err)
+		}
+
+		if !sameRole(root, next, RoleTimestamp) {
+			st.Timestamp = 0
+		}
+		if !sameRole(root, next, RoleSnapshot) {
+			st.Snapshot = 0
+		}
+		if !sameRole(root, next, RoleTargets) {
+			st.Targets = 0
+		}
+		st.Root = next.Version
+		if err := c.writeState(*st); err != nil {
+			return nil, fmt.Errorf("while recording freshness state: %s", err)
+		}
+		root = next
+	}
+	return nil, fmt.Errorf("more than %d root metadata rotations", maxRootRotations)
+}
+
+// sameRole returns whether the role name has the same keys and threshold
+// in the root metadata a and b.
+func sameRole(a, b *Root, name string) bool {
+	ra, rb := a.Roles[name], b.Roles[name]
+	if ra.Threshold != rb.Threshold || len(ra.KeyIDs) != len(rb.KeyIDs) {
+		return false
+	}
+	for _, id := range ra.KeyIDs {
+		if !containsKeyID(rb.KeyIDs, id) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkMeta checks that the metadata file b of the role name is the
+// version listed by meta.
+func checkMeta(b []byte, name string, version int, meta map[string]MetaFile) error {
+	m, ok := meta[name+".json"]
+	if !ok {
+		return fmt.Errorf("%s.json is not listed", name)
+	}
+	if m.Version != version {
+		return fmt.Errorf("%s metadata version %d doesn't match the listed version %d", name, version, m.Version)
+	}
+	if m.Length > 0 && int64(len(b)) != m.Length {
+		return fmt.Errorf("%s metadata length %d doesn't match the listed length %d", name, len(b), m.Length)
+	}
+	if d, ok := m.Hashes["sha256"]; ok {
+		h := sha256.Sum256(b)
+		if hex.EncodeToString(h[:]) != strings.ToLower(d) {
+			return fmt.Errorf("%s metadata digest doesn't match the listed digest", name)
+		}
+	}
+	return nil
+}
+
+// checkVersion checks that the version of the metadata of the role name is
+// not older than the trusted version.
+func checkVersion(name string, version, trusted int) error {
+	if version < trusted {
+		return fmt.Errorf("%s metadata version %d is older than the trusted version %d: %w", name, version, trusted, ErrRollback)
+	}
+	return nil
+}
+
+// Update reads the metadata of the source, rotates the trusted root
+// metadata to its latest version, verifies the signatures with the keys of
+// the trusted root metadata, checks that the metadata isn't expired nor
+// older than the metadata previously trusted, and returns the current
+// targets metadata.
+//
+// The versions of the trusted metadata are recorded for the root keys of
+// the configured root metadata, a source serving older metadata signed by
+// these keys is detected whatever its URL.
+func (c *Client) Update(ctx context.Context) (*Targets, error) {
+	b, err := ioutil.ReadFile(c.c.Root)
+	if err != nil {
+		return nil, fmt.Errorf("while reading trusted root metadata: %s", err)
+	}
+	root, err := readRoot(b)
+	if err != nil {
+		return nil, err
+	}
+	c.stateID = rootStateID(root)
+
+	st, err := c.readState()
+	if err != nil {
+		return nil, err
+	}
+	root, err = c.trustedRoot(root, st)
+	if err != nil {
+		return nil, err
+	}
+	root, err = c.rotateRoot(ctx, root, &st)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkExpires(RoleRoot, &root.Common); err != nil {
+		return nil, err
+	}
+
+	b, err = c.fetch(ctx, RoleTimestamp+".json")
+	if err != nil {
+		return nil, fmt.Errorf("while reading timestamp metadata: %s", err)
+	}
+	timestamp := new(Timestamp)
+	if err := c.decode(b, RoleTimestamp, root, timestamp, &timestamp.Common); err != nil {
+		return nil, err
+	}
+	if err := checkVersion(RoleTimestamp, timestamp.Version, st.Timestamp); err != nil {
+		return nil, err
+	}
+
+	b, err = c.fetch(ctx, RoleSnapshot+".json")
+	if err != nil {
+		return nil, fmt.Errorf("while reading snapshot metadata: %s", err)
+	}
+	snapshot := new(Snapshot)
+	if err := c.decode(b, RoleSnapshot, root, snapshot, &snapshot.Common); err != nil {
+		return nil, err
+	}
+	if err := checkMeta(b, RoleSnapshot, snapshot.Version, timestamp.Meta); err != nil {
+		return nil, err
+	}
+	if err := checkVersion(RoleSnapshot, snapshot.Version, st.Snapshot); err != nil {
+		return nil, err
+	}
+
+	b, err = c.fetch(ctx, RoleTargets+".json")
+	if err != nil {
+		return nil, fmt.Errorf("while reading targets metadata: %s", err)
+	}
+	targets := new(Targets)
+	if err := c.decode(b, RoleTargets, root, targets, &targets.Common); err != nil {
+		return nil, err
+	}
+	if err := checkMeta(b, RoleTargets, targets.Version, snapshot.Meta); err != nil {
+		return nil, err
+	}
+	if err := checkVersion(RoleTargets, targets.Version, st.Targets); err != nil {
+		return nil, err
+	}
+
+	st = state{Root: st.Root, Timestamp: timestamp.Version, Snapshot: snapshot.Version, Targets: targets.Version}
+	if err := c.writeState(st); err != nil {
+		return nil, fmt.Errorf("while recording freshness state: %s", err)
+	}
+	return targets, nil
+}
+
+// Check verifies the metadata of the source and returns the name of the
+// target listed with the sha256 digest, hex encoded, of an image. It
+// returns ErrNotLatest if no current target has this digest.
+func (c *Client) Check(ctx context.Context, digest string) (string, error) {
+	targets, err := c.Update(ctx)
+	if err != nil {
+		return "", err
+	}
+	for name, t := range targets.Targets {
+		if strings.EqualFold(t.Hashes["sha256"], digest) {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("no target of %s metadata version %d has digest sha256:%s: %w", c.c.Source, targets.Version, digest, ErrNotLatest)
+}
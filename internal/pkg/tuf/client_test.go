@@ -0,0 +1,369 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package tuf
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var fixtureNow = time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+
+// fixture is an offline metadata repository signed with one fixed key per
+// role.
+type fixture struct {
+	dir    string
+	root   Root
+	keys   map[string]ed25519.PrivateKey
+	keyIDs map[string]string
+}
+
+func newFixture(t *testing.T, dir string) *fixture {
+	f := &fixture{
+		dir:    dir,
+		keys:   make(map[string]ed25519.PrivateKey),
+		keyIDs: make(map[string]string),
+	}
+
+	root := Root{
+		Common: Common{Type: RoleRoot, Version: 1, Expires: fixtureNow.AddDate(1, 0, 0)},
+		Keys:   make(map[string]Key),
+		Roles:  make(map[string]Role),
+	}
+	f.root = root
+	for i, role := range []string{RoleRoot, RoleTimestamp, RoleSnapshot, RoleTargets} {
+		f.setKey(t, role, byte(i+1))
+	}
+	f.write(t, "root.json", f.sign(t, RoleRoot, f.root))
+
+	return f
+}
+
+// setKey sets the key of role in the root metadata to the key derived
+// from seed.
+func (f *fixture) setKey(t *testing.T, role string, seed byte) {
+	priv := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))
+	var k Key
+	k.Type = "ed25519"
+	k.Scheme = "ed25519"
+	k.Value.Public = hex.EncodeToString(priv.Public().(ed25519.PublicKey))
+	id, err := k.ID()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if old, ok := f.keyIDs[role]; ok {
+		delete(f.root.Keys, old)
+	}
+	f.keys[role] = priv
+	f.keyIDs[role] = id
+	f.root.Keys[id] = k
+	f.root.Roles[role] = Role{KeyIDs: []string{id}, Threshold: 1}
+}
+
+// rotate publishes the next version of the root metadata, with new keys
+// derived from seed for roles, signed with the previous and the new root
+// keys.
+func (f *fixture) rotate(t *testing.T, seed byte, roles ...string) {
+	keys := map[string]ed25519.PrivateKey{f.keyIDs[RoleRoot]: f.keys[RoleRoot]}
+
+	// copy the maps, the previous root metadata is still referenced
+	root := f.root
+	root.Keys = make(map[string]Key)
+	root.Roles = make(map[string]Role)
+	for id, k := range f.root.Keys {
+		root.Keys[id] = k
+	}
+	for name, r := range f.root.Roles {
+		root.Roles[name] = r
+	}
+	root.Version++
+	f.root = root
+
+	for i, role := range roles {
+		f.setKey(t, role, seed+byte(i))
+	}
+	keys[f.keyIDs[RoleRoot]] = f.keys[RoleRoot]
+	f.write(t, fmt.Sprintf("%d.root.json", root.Version), signWith(t, root, keys))
+}
+
+// sign returns the metadata v signed with the key of role.
+func (f *fixture) sign(t *testing.T, role string, v interface{}) []byte {
+	return signWith(t, v, map[string]ed25519.PrivateKey{f.keyIDs[role]: f.keys[role]})
+}
+
+// signWith returns the metadata v signed with each private key of keys,
+// indexed by key ID.
+func signWith(t *testing.T, v interface{}, keys map[string]ed25519.PrivateKey) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	msg, err := canonicalJSON(b)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	s := Signed{Signed: b}
+	for id, key := range keys {
+		s.Signatures = append(s.Signatures, Signature{KeyID: id, Sig: hex.EncodeToString(ed25519.Sign(key, msg))})
+	}
+	b, err = json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return b
+}
+
+func (f *fixture) write(t *testing.T, name string, b []byte) {
+	if err := ioutil.WriteFile(filepath.Join(f.dir, name), b, 0644); err != nil {
+		t.Fatalf("failed to write %s: %s", name, err)
+	}
+}
+
+// publish writes the version of the timestamp, snapshot and targets
+// metadata listing the image digests by target name.
+func (f *fixture) publish(t *testing.T, version int, expires time.Time, images map[string]string) {
+	targets := Targets{
+		Common:  Common{Type: RoleTargets, Version: version, Expires: fixtureNow.AddDate(0, 3, 0)},
+		Targets: make(map[string]Target),
+	}
+	for name, digest := range images {
+		targets.Targets[name] = Target{Length: 1024, Hashes: map[string]string{"sha256": digest}}
+	}
+	tb := f.sign(t, RoleTargets, targets)
+	th := sha256.Sum256(tb)
+
+	snapshot := Snapshot{
+		Common: Common{Type: RoleSnapshot, Version: version, Expires: fixtureNow.AddDate(0, 1, 0)},
+		Meta: map[string]MetaFile{
+			"targets.json": {Version: version, Length: int64(len(tb)), Hashes: map[string]string{"sha256": hex.EncodeToString(th[:])}},
+		},
+	}
+	sb := f.sign(t, RoleSnapshot, snapshot)
+
+	timestamp := Timestamp{
+		Common: Common{Type: RoleTimestamp, Version: version, Expires: expires},
+		Meta: map[string]MetaFile{
+			"snapshot.json": {Version: version},
+		},
+	}
+
+	f.write(t, "targets.json", tb)
+	f.write(t, "snapshot.json", sb)
+	f.write(t, "timestamp.json", f.sign(t, RoleTimestamp, timestamp))
+}
+
+func digest(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+func TestCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tuf-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	repo := filepath.Join(dir, "repo")
+	if err := os.Mkdir(repo, 0755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f := newFixture(t, repo)
+
+	c := NewClient(Config{Source: repo, Root: filepath.Join(repo, "root.json")}, filepath.Join(dir, "state"))
+	c.now = func() time.Time { return fixtureNow }
+	ctx := context.Background()
+
+	v1, v2 := digest("image v1"), digest("image v2")
+	expires := fixtureNow.Add(24 * time.Hour)
+
+	// current metadata accepts the latest image only
+	f.publish(t, 1, expires, map[string]string{"busybox.sif": v1})
+	if name, err := c.Check(ctx, v1); err != nil || name != "busybox.sif" {
+		t.Fatalf("got target %q and error %v, expected busybox.sif", name, err)
+	}
+
+	old := make(map[string][]byte)
+	for _, name := range []string{"timestamp.json", "snapshot.json", "targets.json"} {
+		old[name], _ = ioutil.ReadFile(filepath.Join(repo, name))
+	}
+
+	f.publish(t, 2, expires, map[string]string{"busybox.sif": v2})
+	if _, err := c.Check(ctx, v2); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := c.Check(ctx, v1); !errors.Is(err, ErrNotLatest) {
+		t.Errorf("got error %v for an older image, expected %v", err, ErrNotLatest)
+	}
+
+	// the previous metadata is still signed but older than the trusted one
+	for name, b := range old {
+		f.write(t, name, b)
+	}
+	if _, err := c.Check(ctx, v1); !errors.Is(err, ErrRollback) {
+		t.Errorf("got error %v for rolled back metadata, expected %v", err, ErrRollback)
+	}
+
+	// stale metadata replayed after its expiration
+	f.publish(t, 3, fixtureNow.Add(-time.Hour), map[string]string{"busybox.sif": v2})
+	if _, err := c.Check(ctx, v2); !errors.Is(err, ErrExpired) {
+		t.Errorf("got error %v for expired metadata, expected %v", err, ErrExpired)
+	}
+
+	// timestamp metadata signed by another role
+	f.publish(t, 4, expires, map[string]string{"busybox.sif": v2})
+	ts, _ := ioutil.ReadFile(filepath.Join(repo, "timestamp.json"))
+	var s Signed
+	if err := json.Unmarshal(ts, &s); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var timestamp Timestamp
+	if err := json.Unmarshal(s.Signed, &timestamp); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f.write(t, "timestamp.json", f.sign(t, RoleSnapshot, timestamp))
+	if _, err := c.Check(ctx, v2); err == nil || !strings.Contains(err.Error(), "0 valid signature(s)") {
+		t.Errorf("got error %v for an invalid signature, expected a signature error", err)
+	}
+
+	// timestamp metadata listing another snapshot version
+	timestamp.Meta["snapshot.json"] = MetaFile{Version: 5}
+	f.write(t, "timestamp.json", f.sign(t, RoleTimestamp, timestamp))
+	if _, err := c.Check(ctx, v2); err == nil || !strings.Contains(err.Error(), "doesn't match the listed version") {
+		t.Errorf("got error %v for a mismatched snapshot, expected a version error", err)
+	}
+
+	// the trusted root metadata must be signed by the root key
+	f.write(t, "root.json", []byte(`{"signed": {"_type": "root"}, "signatures": []}`))
+	if _, err := c.Check(ctx, v2); err == nil {
+		t.Errorf("unexpected success with an unsigned root metadata")
+	}
+}
+
+func TestRootRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tuf-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	repo := filepath.Join(dir, "repo")
+	if err := os.Mkdir(repo, 0755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f := newFixture(t, repo)
+	rootPath := filepath.Join(dir, "root.json")
+	if err := os.Rename(filepath.Join(repo, "root.json"), rootPath); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	stateDir := filepath.Join(dir, "state")
+	c := NewClient(Config{Source: repo, Root: rootPath}, stateDir)
+	c.now = func() time.Time { return fixtureNow }
+	ctx := context.Background()
+
+	v1 := digest("image v1")
+	expires := fixtureNow.Add(24 * time.Hour)
+
+	f.publish(t, 1, expires, map[string]string{"busybox.sif": v1})
+	if _, err := c.Check(ctx, v1); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// the root and timestamp keys are replaced by two successive
+	// root metadata versions
+	f.rotate(t, 10, RoleRoot)
+	f.rotate(t, 20, RoleRoot, RoleTimestamp)
+	f.publish(t, 2, expires, map[string]string{"busybox.sif": v1})
+	if _, err := c.Check(ctx, v1); err != nil {
+		t.Fatalf("unexpected error after root rotation: %s", err)
+	}
+	st, err := c.readState()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if st.Root != 3 {
+		t.Errorf("got trusted root version %d, expected 3", st.Root)
+	}
+
+	// the rotated root metadata is trusted once the source removed it
+	for _, name := range []string{"2.root.json", "3.root.json"} {
+		if err := os.Remove(filepath.Join(repo, name)); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if _, err := c.Check(ctx, v1); err != nil {
+		t.Fatalf("unexpected error with the recorded root metadata: %s", err)
+	}
+
+	// a root metadata version not signed by the trusted root keys
+	root := f.root
+	root.Version++
+	f.setKey(t, RoleRoot, 30)
+	f.write(t, "4.root.json", f.sign(t, RoleRoot, root))
+	if _, err := c.Check(ctx, v1); err == nil || !strings.Contains(err.Error(), "not signed by the trusted root keys") {
+		t.Errorf("got error %v for an unsigned root rotation, expected a signature error", err)
+	}
+}
+
+func TestStateFollowsRootKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tuf-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	repo := filepath.Join(dir, "repo")
+	mirror := filepath.Join(dir, "mirror")
+	for _, d := range []string{repo, mirror} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	f := newFixture(t, repo)
+	rootPath := filepath.Join(repo, "root.json")
+	stateDir := filepath.Join(dir, "state")
+	ctx := context.Background()
+
+	v1, v2 := digest("image v1"), digest("image v2")
+	expires := fixtureNow.Add(24 * time.Hour)
+
+	// the mirror serves the first version only
+	f.publish(t, 1, expires, map[string]string{"busybox.sif": v1})
+	for _, name := range []string{"timestamp.json", "snapshot.json", "targets.json"} {
+		b, _ := ioutil.ReadFile(filepath.Join(repo, name))
+		if err := ioutil.WriteFile(filepath.Join(mirror, name), b, 0644); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	f.publish(t, 2, expires, map[string]string{"busybox.sif": v2})
+	c := NewClient(Config{Source: repo, Root: rootPath}, stateDir)
+	c.now = func() time.Time { return fixtureNow }
+	if _, err := c.Check(ctx, v2); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// the mirror URL differs but the metadata is signed by the same
+	// root keys
+	c = NewClient(Config{Source: mirror, Root: rootPath}, stateDir)
+	c.now = func() time.Time { return fixtureNow }
+	if _, err := c.Check(ctx, v1); !errors.Is(err, ErrRollback) {
+		t.Errorf("got error %v for metadata rolled back by a mirror, expected %v", err, ErrRollback)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package tuf checks that an image is the latest signed version listed by
+// metadata following The Update Framework (TUF) roles, to detect a rollback
+// to an older signed image or the replay of stale metadata.
+package tuf
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Names of the metadata roles.
+const (
+	RoleRoot      = "root"
+	RoleTimestamp = "timestamp"
+	RoleSnapshot  = "snapshot"
+	RoleTargets   = "targets"
+)
+
+// Key is a public key listed by the root metadata.
+type Key struct {
+	Type   string `json:"keytype"`
+	Scheme string `json:"scheme"`
+	Value  struct {
+		Public string `json:"public"`
+	} `json:"keyval"`
+}
+
+// ID returns the key ID, the hex encoded sha256 digest of the canonical
+// JSON encoding of the key.
+func (k Key) ID() (string, error) {
+	b, err := json.Marshal(k)
+	if err != nil {
+		return "", err
+	}
+	b, err = canonicalJSON(b)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// Role lists the keys trusted to sign the metadata of a role, and the
+// number of valid signatures required.
+type Role struct {
+	KeyIDs    []string `json:"keyids"`
+	Threshold int      `json:"threshold"`
+}
+
+// Signature is the signature of metadata by a key.
+type Signature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// Signed is the envelope of signed metadata.
+type Signed struct {
+	Signed     json.RawMessage `json:"signed"`
+	Signatures []Signature     `json:"signatures"`
+}
+
+// Common holds the fields of the metadata of all roles.
+type Common struct {
+	Type    string    `json:"_type"`
+	Version int       `json:"version"`
+	Expires time.Time `json:"expires"`
+}
+
+// Root is the metadata of the root role, listing the keys of all roles.
+type Root struct {
+	Common
+	Keys  map[string]Key  `json:"keys"`
+	Roles map[string]Role `json:"roles"`
+}
+
+// MetaFile describes the version of a metadata file listed by the
+// timestamp and snapshot metadata.
+type MetaFile struct {
+	Version int               `json:"version"`
+	Length  int64             `json:"length,omitempty"`
+	Hashes  map[string]string `json:"hashes,omitempty"`
+}
+
+// Timestamp is the metadata of the timestamp role, frequently re-signed
+// with a short expiration, listing the current snapshot metadata.
+type Timestamp struct {
+	Common
+	Meta map[string]MetaFile `json:"meta"`
+}
+
+// Snapshot is the metadata of the snapshot role, listing the current
+// targets metadata.
+type Snapshot struct {
+	Common
+	Meta map[string]MetaFile `json:"meta"`
+}
+
+// Target is an image listed by the targets metadata.
+type Target struct {
+	Length int64             `json:"length"`
+	Hashes map[string]string `json:"hashes"`
+	Custom json.RawMessage   `json:"custom,omitempty"`
+}
+
+// Targets is the metadata of the targets role, listing the latest
+// version of each image.
+type Targets struct {
+	Common
+	Targets map[string]Target `json:"targets"`
+}
+
+// verifySignatures checks that the signed metadata s is signed by at least
+// the threshold of the keys of role.
+func verifySignatures(s *Signed, name string, role Role, keys map[string]Key) error {
+	if role.Threshold < 1 {
+		return fmt.Errorf("%s role has an invalid threshold %d", name, role.Threshold)
+	}
+
+	msg, err := canonicalJSON(s.Signed)
+	if err != nil {
+		return fmt.Errorf("while encoding %s metadata: %s", name, err)
+	}
+
+	valid := make(map[string]bool)
+	for _, sig := range s.Signatures {
+		if !containsKeyID(role.KeyIDs, sig.KeyID) || valid[sig.KeyID] {
+			continue
+		}
+		k, ok := keys[sig.KeyID]
+		if !ok || k.Type != "ed25519" {
+			continue
+		}
+		pub, err := hex.DecodeString(k.Value.Public)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			continue
+		}
+		b, err := hex.DecodeString(sig.Sig)
+		if err != nil {
+			continue
+		}
+		if ed25519.Verify(ed25519.PublicKey(pub), msg, b) {
+			valid[sig.KeyID] = true
+		}
+	}
+
+	if len(valid) < role.Threshold {
+		return fmt.Errorf("%s metadata has %d valid signature(s), %d required", name, len(valid), role.Threshold)
+	}
+	return nil
+}
+
+func containsKeyID(ids []string, id string) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// checkKeyIDs checks that the ID of each key of the root metadata r is the
+// digest of the key.
+func checkKeyIDs(r *Root) error {
+	for id, k := range r.Keys {
+		kid, err := k.ID()
+		if err != nil {
+			return err
+		}
+		if kid != id {
+			return fmt.Errorf("key ID %s doesn't match the key digest %s", id, kid)
+		}
+	}
+	return nil
+}
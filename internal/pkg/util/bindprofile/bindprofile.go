@@ -0,0 +1,238 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package bindprofile loads the bind profiles defined by the administrator,
+// named sets of host files, environment variables and library directories
+// injected in containers, like interconnect stacks or monitoring agents.
+package bindprofile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/util/user"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engine/singularity/config"
+)
+
+// Dir is the drop-in directory of the bind profiles.
+var Dir = filepath.Join(buildcfg.SINGULARITY_CONFDIR, "profiles.d")
+
+// Ext is the extension of the profile files of the drop-in directory,
+// named after the profile they define.
+const Ext = ".conf"
+
+var (
+	nameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	envRegexp  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*=`)
+)
+
+// Profile is a bind profile, applied to the containers started with
+// --profile and to the containers of the members of its groups.
+type Profile struct {
+	Name string
+	// Source is the file defining the profile.
+	Source string
+	// Binds are bind paths in the --bind format.
+	Binds []string
+	// Env are environment variables in the KEY=VALUE format.
+	Env []string
+	// LdPaths are container directories added to the library search path.
+	LdPaths []string
+	// Groups are the names of the groups the profile is applied to.
+	Groups []string
+
+	gids []uint32
+}
+
+// set sets the profile directive key to value.
+func (p *Profile) set(key, value string) error {
+	switch key {
+	case "bind":
+		if _, err := singularityConfig.ParseBindPath(value); err != nil {
+			return err
+		}
+		p.Binds = append(p.Binds, value)
+	case "env":
+		if !envRegexp.MatchString(value) {
+			return fmt.Errorf("environment variable %q must have the format KEY=VALUE", value)
+		}
+		p.Env = append(p.Env, value)
+	case "ld path":
+		if !filepath.IsAbs(value) || strings.Contains(value, ":") {
+			return fmt.Errorf("library path %q must be an absolute path without ':'", value)
+		}
+		p.LdPaths = append(p.LdPaths, filepath.Clean(value))
+	case "group":
+		g, err := user.GetGrNam(value)
+		if err != nil {
+			return fmt.Errorf("unknown group %q: %s", value, err)
+		}
+		p.Groups = append(p.Groups, value)
+		p.gids = append(p.gids, g.GID)
+	default:
+		return fmt.Errorf("unknown directive %q, expected bind, env, ld path or group", key)
+	}
+	return nil
+}
+
+// Group returns the name of the first profile group found in gids.
+func (p *Profile) Group(gids []uint32) (string, bool) {
+	for i, gid := range p.gids {
+		for _, g := range gids {
+			if g == gid {
+				return p.Groups[i], true
+			}
+		}
+	}
+	return "", false
+}
+
+// splitDirective splits a "key = value" line.
+func splitDirective(line string) (key, value string, err error) {
+	kv := strings.SplitN(line, "=", 2)
+	if len(kv) != 2 {
+		return "", "", fmt.Errorf("%q must have the format 'key = value'", line)
+	}
+	key = strings.Join(strings.Fields(kv[0]), " ")
+	value = strings.TrimSpace(kv[1])
+	if value == "" {
+		return "", "", fmt.Errorf("directive %q has no value", key)
+	}
+	return key, value, nil
+}
+
+// Parse reads the profile name from r, holding a "key = value" directive
+// per line, empty lines and lines starting with # are ignored. Errors
+// report the source file and the line number.
+func Parse(name, source string, r io.Reader) (*Profile, error) {
+	if !nameRegexp.MatchString(name) {
+		return nil, fmt.Errorf("%s: invalid profile name %q", source, name)
+	}
+	p := &Profile{Name: name, Source: source}
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, err := splitDirective(line)
+		if err == nil {
+			err = p.set(key, value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", source, n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("while reading %s: %s", source, err)
+	}
+	return p, nil
+}
+
+// Load returns the profiles defined by the 'bind profile' entries of the
+// configuration file conf, with the format "name key = value", and by the
+// files of the directory dir. A missing directory holds no profile. A
+// profile can't be defined in several files.
+func Load(conf string, entries []string, dir string) (map[string]*Profile, error) {
+	profiles := make(map[string]*Profile)
+
+	for _, e := range entries {
+		f := strings.SplitN(strings.TrimSpace(e), " ", 2)
+		if len(f) != 2 {
+			return nil, fmt.Errorf("%s: bind profile = %s: must have the format 'name key = value'", conf, e)
+		}
+		p, ok := profiles[f[0]]
+		if !ok {
+			if !nameRegexp.MatchString(f[0]) {
+				return nil, fmt.Errorf("%s: bind profile = %s: invalid profile name %q", conf, e, f[0])
+			}
+			p = &Profile{Name: f[0], Source: conf}
+			profiles[f[0]] = p
+		}
+		key, value, err := splitDirective(f[1])
+		if err == nil {
+			err = p.set(key, value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: bind profile = %s: %s", conf, e, err)
+		}
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return profiles, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("while reading profile directory: %s", err)
+	}
+	for _, fi := range files {
+		if fi.IsDir() || filepath.Ext(fi.Name()) != Ext {
+			continue
+		}
+		path := filepath.Join(dir, fi.Name())
+		name := strings.TrimSuffix(fi.Name(), Ext)
+		if p, ok := profiles[name]; ok {
+			return nil, fmt.Errorf("%s: profile %s is already defined in %s", path, name, p.Source)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("while opening profile: %s", err)
+		}
+		p, err := Parse(name, path, f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		profiles[name] = p
+	}
+	return profiles, nil
+}
+
+// Select returns the profiles applied to a container, in the order their
+// binds are mounted and their variables are set: the profiles applied to
+// one of the groups gids, sorted by name, followed by the profiles names
+// in the given order. Each profile is returned once.
+func Select(profiles map[string]*Profile, names []string, gids []uint32) ([]*Profile, error) {
+	var selected []*Profile
+	seen := make(map[string]bool)
+
+	var byGroup []string
+	for name, p := range profiles {
+		if _, ok := p.Group(gids); ok {
+			byGroup = append(byGroup, name)
+		}
+	}
+	sort.Strings(byGroup)
+
+	for _, name := range append(byGroup, names...) {
+		if seen[name] {
+			continue
+		}
+		p, ok := profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("profile %q is not defined", name)
+		}
+		seen[name] = true
+		selected = append(selected, p)
+	}
+	return selected, nil
+}
+
+// Binds returns the bind paths of the profiles, in order.
+func Binds(profiles []*Profile) []string {
+	var binds []string
+	for _, p := range profiles {
+		binds = append(binds, p.Binds...)
+	}
+	return binds
+}
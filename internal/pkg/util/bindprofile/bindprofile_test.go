@@ -0,0 +1,210 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package bindprofile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    *Profile
+		wantErr string
+	}{
+		{
+			name: "Valid",
+			content: `# UCX stack
+bind = /opt/ucx:/opt/ucx:ro
+bind = /etc/ucx,/etc/libfabric
+
+env = UCX_TLS=rc,sm
+ld   path = /opt/ucx/lib/
+group = root
+`,
+			want: &Profile{
+				Name:    "ucx",
+				Source:  "ucx.conf",
+				Binds:   []string{"/opt/ucx:/opt/ucx:ro", "/etc/ucx,/etc/libfabric"},
+				Env:     []string{"UCX_TLS=rc,sm"},
+				LdPaths: []string{"/opt/ucx/lib"},
+				Groups:  []string{"root"},
+				gids:    []uint32{0},
+			},
+		},
+		{
+			name:    "UnknownDirective",
+			content: "bind = /opt\nmount = /opt",
+			wantErr: `ucx.conf:2: unknown directive "mount"`,
+		},
+		{
+			name:    "BadBind",
+			content: "bind = /opt:/opt:bad",
+			wantErr: "ucx.conf:1: ",
+		},
+		{
+			name:    "BadEnv",
+			content: "env = 1UCX=rc",
+			wantErr: `ucx.conf:1: environment variable "1UCX=rc"`,
+		},
+		{
+			name:    "RelativeLdPath",
+			content: "ld path = lib",
+			wantErr: `ucx.conf:1: library path "lib"`,
+		},
+		{
+			name:    "UnknownGroup",
+			content: "group = no-such-group-exists",
+			wantErr: `ucx.conf:1: unknown group "no-such-group-exists"`,
+		},
+		{
+			name:    "NoValue",
+			content: "bind =",
+			wantErr: `ucx.conf:1: directive "bind" has no value`,
+		},
+		{
+			name:    "NoEqual",
+			content: "bind /opt",
+			wantErr: `ucx.conf:1: "bind /opt" must have the format`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Parse("ucx", "ucx.conf", strings.NewReader(tt.content))
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(p, tt.want) {
+				t.Errorf("got %+v, want %+v", p, tt.want)
+			}
+		})
+	}
+
+	if _, err := Parse("../ucx", "ucx.conf", strings.NewReader("")); err == nil {
+		t.Errorf("unexpected success with an invalid profile name")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bindprofile-")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	entries := []string{
+		"ucx bind = /opt/ucx",
+		"ucx env = UCX_TLS=rc,sm",
+		"agent bind = /opt/agent",
+		"agent group = root",
+	}
+
+	// a missing directory holds no profile
+	profiles, err := Load("singularity.conf", entries, filepath.Join(dir, "missing"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(profiles) != 2 || !reflect.DeepEqual(profiles["ucx"].Env, []string{"UCX_TLS=rc,sm"}) {
+		t.Errorf("unexpected profiles %+v", profiles)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "ofi.conf"), []byte("bind = /opt/ofi\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not a profile"), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	profiles, err = Load("singularity.conf", entries, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if p := profiles["ofi"]; p == nil || p.Source != filepath.Join(dir, "ofi.conf") {
+		t.Errorf("unexpected ofi profile %+v", p)
+	}
+	if len(profiles) != 3 {
+		t.Errorf("got %d profiles, want 3", len(profiles))
+	}
+
+	// errors name the file defining the profile
+	if _, err := Load("singularity.conf", []string{"ucx ld path = lib"}, dir); err == nil || !strings.HasPrefix(err.Error(), "singularity.conf: bind profile = ucx ld path = lib: ") {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err := Load("singularity.conf", []string{"ucx"}, dir); err == nil {
+		t.Errorf("unexpected success with an entry without directive")
+	}
+	if _, err := Load("singularity.conf", []string{"ofi bind = /opt"}, dir); err == nil || !strings.Contains(err.Error(), "already defined in singularity.conf") {
+		t.Errorf("unexpected error %v", err)
+	}
+	bad := filepath.Join(dir, "bad.conf")
+	if err := ioutil.WriteFile(bad, []byte("bind = /opt\nenv = X\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := Load("singularity.conf", nil, dir); err == nil || !strings.HasPrefix(err.Error(), bad+":2: ") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	profiles := map[string]*Profile{
+		"a":   {Name: "a"},
+		"b":   {Name: "b", Groups: []string{"root"}, gids: []uint32{0}},
+		"c":   {Name: "c", Groups: []string{"other", "root"}, gids: []uint32{1000, 0}},
+		"ucx": {Name: "ucx", Groups: []string{"other"}, gids: []uint32{1000}},
+	}
+
+	tests := []struct {
+		name    string
+		names   []string
+		gids    []uint32
+		want    []string
+		wantErr bool
+	}{
+		{name: "None", gids: []uint32{42}},
+		{name: "Groups", gids: []uint32{42, 0}, want: []string{"b", "c"}},
+		{name: "Names", names: []string{"ucx", "a", "ucx"}, want: []string{"ucx", "a"}},
+		{name: "GroupsAndNames", names: []string{"a", "b"}, gids: []uint32{1000}, want: []string{"c", "ucx", "a", "b"}},
+		{name: "Unknown", names: []string{"mpi"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, err := Select(profiles, tt.names, tt.gids)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("unexpected success")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			var got []string
+			for _, p := range selected {
+				got = append(got, p.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if g, ok := profiles["c"].Group([]uint32{0}); !ok || g != "root" {
+		t.Errorf("got group %q %v, want root", g, ok)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package env
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	// LoaderEnvPass passes the loader variables to the container process.
+	LoaderEnvPass = "pass"
+	// LoaderEnvStrip strips the loader variables from the container
+	// process environment.
+	LoaderEnvStrip = "strip"
+)
+
+// LoaderKeys lists the environment variables changing the behavior of the
+// dynamic loader or of the C library of the programs they are passed to,
+// with the reason they are dangerous. They are the variables the GNU C
+// library ignores for setuid programs, they are never passed to the
+// programs executed with privileges by the starter, and they are passed
+// to the container process according to the "container loader env"
+// directive.
+var LoaderKeys = map[string]string{
+	"LD_PRELOAD":        "loads arbitrary libraries in the programs executed",
+	"LD_LIBRARY_PATH":   "searches libraries of the programs executed in arbitrary directories",
+	"LD_AUDIT":          "loads arbitrary auditing libraries in the programs executed",
+	"LD_DEBUG":          "makes the dynamic loader print debugging information",
+	"LD_DEBUG_OUTPUT":   "makes the dynamic loader write its debugging information to arbitrary files",
+	"LD_PROFILE":        "makes the dynamic loader profile a shared library",
+	"LD_PROFILE_OUTPUT": "makes the dynamic loader write profiling data to an arbitrary directory",
+	"LD_ORIGIN_PATH":    "changes the $ORIGIN library search path",
+	"LD_DYNAMIC_WEAK":   "changes how the dynamic loader resolves weak symbols",
+	"LD_USE_LOAD_BIAS":  "changes the load address of the programs executed",
+	"LD_SHOW_AUXV":      "makes the dynamic loader print the auxiliary vector",
+	"LD_HWCAP_MASK":     "changes the hardware capability library directories searched",
+	"GLIBC_TUNABLES":    "changes the internal parameters of the C library",
+	"GCONV_PATH":        "loads arbitrary character set conversion modules",
+	"GETCONF_DIR":       "changes the directory of the getconf programs",
+	"LOCPATH":           "loads locale data from arbitrary directories",
+	"NLSPATH":           "loads message catalogs from arbitrary files",
+	"MALLOC_TRACE":      "makes the C library write memory allocation traces to arbitrary files",
+	"HOSTALIASES":       "makes the resolver read host aliases from arbitrary files",
+	"RESOLV_HOST_CONF":  "makes the resolver read its configuration from arbitrary files",
+	"RES_OPTIONS":       "changes the resolver options",
+	"LOCALDOMAIN":       "changes the resolver search domains",
+	"NIS_PATH":          "changes the NIS+ tables searched",
+	"TZDIR":             "loads time zone data from arbitrary directories",
+}
+
+// IsLoaderKey returns if the environment variable key is one of the
+// LoaderKeys.
+func IsLoaderKey(key string) bool {
+	_, ok := LoaderKeys[key]
+	return ok
+}
+
+// StripLoader returns the environment env, in the KEY=VALUE format, without
+// the LoaderKeys variables, and the sorted keys of the variables stripped.
+func StripLoader(env []string) (kept []string, stripped []string) {
+	kept = make([]string, 0, len(env))
+	for _, e := range env {
+		key := strings.SplitN(e, "=", 2)[0]
+		if IsLoaderKey(key) {
+			stripped = append(stripped, key)
+			continue
+		}
+		kept = append(kept, e)
+	}
+	sort.Strings(stripped)
+	return kept, stripped
+}
+
+// ForwardedLoaderKeys returns the sorted keys of the LoaderKeys variables
+// SetContainerEnv forwards to the container from the host environment
+// hostEnvs, either directly or with the SINGULARITYENV_ prefix.
+func ForwardedLoaderKeys(hostEnvs []string, cleanEnv bool) []string {
+	forwarded := make(map[string]bool)
+	for _, env := range hostEnvs {
+		e := strings.SplitN(env, "=", 2)
+		if len(e) != 2 {
+			continue
+		}
+		key := e[0]
+		if strings.HasPrefix(key, SingularityEnvPrefix) {
+			key = key[len(SingularityEnvPrefix):]
+			if permitted, ok := alwaysOmitKeys[key]; ok && !permitted {
+				continue
+			}
+		} else if !addHostEnv(key, cleanEnv) {
+			continue
+		}
+		if IsLoaderKey(key) {
+			forwarded[key] = true
+		}
+	}
+
+	keys := make([]string, 0, len(forwarded))
+	for key := range forwarded {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// UnsetLoader removes the LoaderKeys variables from the environment of the
+// current process, so they are not inherited by the programs it executes,
+// and returns the sorted keys of the variables removed.
+func UnsetLoader() []string {
+	_, stripped := StripLoader(os.Environ())
+	for _, key := range stripped {
+		os.Unsetenv(key)
+	}
+	return stripped
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package env
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestStripLoader(t *testing.T) {
+	env := []string{
+		"PATH=/usr/bin:/bin",
+		"LD_PRELOAD=/tmp/evil.so",
+		"LD_PRELOADX=1",
+		"GCONV_PATH=/tmp",
+		"HOME=/home/tester",
+		"LD_LIBRARY_PATH",
+	}
+
+	kept, stripped := StripLoader(env)
+	if want := []string{"PATH=/usr/bin:/bin", "LD_PRELOADX=1", "HOME=/home/tester"}; !reflect.DeepEqual(kept, want) {
+		t.Errorf("got kept %v, expected %v", kept, want)
+	}
+	if want := []string{"GCONV_PATH", "LD_LIBRARY_PATH", "LD_PRELOAD"}; !reflect.DeepEqual(stripped, want) {
+		t.Errorf("got stripped %v, expected %v", stripped, want)
+	}
+}
+
+func TestForwardedLoaderKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      []string
+		cleanEnv bool
+		want     []string
+	}{
+		{
+			name: "Host",
+			env:  []string{"LD_PRELOAD=/tmp/evil.so", "LD_LIBRARY_PATH=/tmp", "TERM=xterm"},
+			want: []string{"LD_PRELOAD"},
+		},
+		{
+			name:     "HostCleanEnv",
+			env:      []string{"LD_PRELOAD=/tmp/evil.so", "TZDIR=/tmp"},
+			cleanEnv: true,
+			want:     []string{},
+		},
+		{
+			name:     "Prefixed",
+			env:      []string{"SINGULARITYENV_LD_LIBRARY_PATH=/tmp", "SINGULARITYENV_TZDIR=/tmp", "SINGULARITY_LD_PRELOAD=/tmp/evil.so"},
+			cleanEnv: true,
+			want:     []string{"LD_LIBRARY_PATH", "TZDIR"},
+		},
+		{
+			name: "Both",
+			env:  []string{"LD_PRELOAD=/tmp/evil.so", "SINGULARITYENV_LD_PRELOAD=/tmp/other.so"},
+			want: []string{"LD_PRELOAD"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ForwardedLoaderKeys(tt.env, tt.cleanEnv); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnsetLoader(t *testing.T) {
+	defer os.Unsetenv("LD_PRELOAD")
+	defer os.Unsetenv("SINGULARITY_TEST_LOADER")
+
+	os.Setenv("LD_PRELOAD", "/tmp/evil.so")
+	os.Setenv("SINGULARITY_TEST_LOADER", "1")
+
+	stripped := UnsetLoader()
+	if _, ok := os.LookupEnv("LD_PRELOAD"); ok {
+		t.Errorf("LD_PRELOAD still set")
+	}
+	if os.Getenv("SINGULARITY_TEST_LOADER") != "1" {
+		t.Errorf("SINGULARITY_TEST_LOADER unset")
+	}
+	found := false
+	for _, key := range stripped {
+		found = found || key == "LD_PRELOAD"
+	}
+	if !found {
+		t.Errorf("LD_PRELOAD not reported in %v", stripped)
+	}
+}
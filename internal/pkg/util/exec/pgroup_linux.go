@@ -0,0 +1,30 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package exec
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+)
+
+// WaitProcessGroup waits for the started command cmd, which must run in its
+// own process group, and kills the whole process group when ctx is done.
+// The children of the command are killed along with it, they would
+// otherwise keep its output pipes open and Wait would not return.
+func WaitProcessGroup(ctx context.Context, cmd *exec.Cmd) error {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		case <-done:
+		}
+	}()
+	err := cmd.Wait()
+	close(done)
+	return err
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package exec
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWaitProcessGroup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	// the background child keeps the output pipe open
+	var stdout bytes.Buffer
+	cmd := exec.Command("/bin/sh", "-c", "sleep 60 & echo started; wait")
+	cmd.Stdout = &stdout
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	start := time.Now()
+	if err := WaitProcessGroup(ctx, cmd); err == nil {
+		t.Errorf("unexpected success of a killed command")
+	}
+	if d := time.Since(start); d > 30*time.Second {
+		t.Errorf("command and its child not killed on timeout, waited %s", d)
+	}
+	if stdout.String() != "started\n" {
+		t.Errorf("unexpected output %q", stdout.String())
+	}
+
+	// a command terminating before the context is done isn't killed
+	cmd = exec.Command("/bin/true")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := WaitProcessGroup(context.Background(), cmd); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
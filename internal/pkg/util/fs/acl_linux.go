@@ -0,0 +1,99 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// POSIX ACL extended attributes and entry tags referencing an ID, see
+// the kernel include/uapi/linux/posix_acl_xattr.h.
+const (
+	aclAccessXattr  = "system.posix_acl_access"
+	aclDefaultXattr = "system.posix_acl_default"
+	aclXattrVersion = 2
+	aclUser         = 0x02
+	aclGroup        = 0x08
+)
+
+// ACLUndefinedID is the ID reported for an ACL entry referencing an ID
+// which isn't mapped in the user namespace of the caller.
+const ACLUndefinedID = ^uint32(0)
+
+// ACLIDs returns the user and group IDs referenced by the named entries of
+// the access and default ACLs of path, symbolic links are not followed. No
+// ID is returned if path has no ACL or if its filesystem doesn't support
+// ACLs.
+func ACLIDs(path string) (uids []uint32, gids []uint32, err error) {
+	for _, name := range []string{aclAccessXattr, aclDefaultXattr} {
+		value, err := lgetxattr(path, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		u, g, err := parseACL(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("while parsing %s of %s: %s", name, path, err)
+		}
+		uids = append(uids, u...)
+		gids = append(gids, g...)
+	}
+	return uids, gids, nil
+}
+
+// lgetxattr returns the value of the extended attribute name of path,
+// a missing attribute or an unsupported attribute returns no value.
+func lgetxattr(path, name string) ([]byte, error) {
+	for {
+		size, err := unix.Lgetxattr(path, name, nil)
+		switch err {
+		case nil:
+		case unix.ENODATA, unix.EOPNOTSUPP:
+			return nil, nil
+		default:
+			return nil, &os.PathError{Op: "getxattr", Path: path, Err: err}
+		}
+		if size == 0 {
+			return nil, nil
+		}
+		value := make([]byte, size)
+		n, err := unix.Lgetxattr(path, name, value)
+		if err == unix.ERANGE {
+			// the attribute grew in between
+			continue
+		} else if err != nil {
+			return nil, &os.PathError{Op: "getxattr", Path: path, Err: err}
+		}
+		return value[:n], nil
+	}
+}
+
+// parseACL returns the user and group IDs of the named entries of an ACL
+// extended attribute value.
+func parseACL(value []byte) (uids []uint32, gids []uint32, err error) {
+	if len(value) == 0 {
+		return nil, nil, nil
+	}
+	if len(value) < 4 || (len(value)-4)%8 != 0 {
+		return nil, nil, fmt.Errorf("bad ACL size %d", len(value))
+	}
+	if v := binary.LittleEndian.Uint32(value); v != aclXattrVersion {
+		return nil, nil, fmt.Errorf("unsupported ACL version %d", v)
+	}
+	for e := value[4:]; len(e) > 0; e = e[8:] {
+		id := binary.LittleEndian.Uint32(e[4:])
+		switch binary.LittleEndian.Uint16(e) {
+		case aclUser:
+			uids = append(uids, id)
+		case aclGroup:
+			gids = append(gids, id)
+		}
+	}
+	return uids, gids, nil
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fs
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+type aclEntry struct {
+	tag  uint16
+	perm uint16
+	id   uint32
+}
+
+// makeACL returns the extended attribute value of an ACL with entries.
+func makeACL(entries ...aclEntry) []byte {
+	b := make([]byte, 4+8*len(entries))
+	binary.LittleEndian.PutUint32(b, aclXattrVersion)
+	for i, e := range entries {
+		off := 4 + 8*i
+		binary.LittleEndian.PutUint16(b[off:], e.tag)
+		binary.LittleEndian.PutUint16(b[off+2:], e.perm)
+		binary.LittleEndian.PutUint32(b[off+4:], e.id)
+	}
+	return b
+}
+
+// minimal ACL entries without ID
+var (
+	aclUserObj  = aclEntry{tag: 0x01, perm: 6, id: ACLUndefinedID}
+	aclGroupObj = aclEntry{tag: 0x04, perm: 4, id: ACLUndefinedID}
+	aclMask     = aclEntry{tag: 0x10, perm: 7, id: ACLUndefinedID}
+	aclOther    = aclEntry{tag: 0x20, perm: 4, id: ACLUndefinedID}
+)
+
+func TestParseACL(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   []byte
+		uids    []uint32
+		gids    []uint32
+		wantErr bool
+	}{
+		{
+			name: "Empty",
+		},
+		{
+			name:  "Minimal",
+			value: makeACL(aclUserObj, aclGroupObj, aclOther),
+		},
+		{
+			name: "Named",
+			value: makeACL(
+				aclUserObj,
+				aclEntry{tag: aclUser, perm: 7, id: 1000},
+				aclEntry{tag: aclUser, perm: 4, id: ACLUndefinedID},
+				aclGroupObj,
+				aclEntry{tag: aclGroup, perm: 5, id: 100},
+				aclMask,
+				aclOther,
+			),
+			uids: []uint32{1000, ACLUndefinedID},
+			gids: []uint32{100},
+		},
+		{
+			name:    "BadSize",
+			value:   makeACL(aclUserObj)[:10],
+			wantErr: true,
+		},
+		{
+			name:    "BadVersion",
+			value:   []byte{1, 0, 0, 0},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uids, gids, err := parseACL(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(uids, tt.uids) || !reflect.DeepEqual(gids, tt.gids) {
+				t.Errorf("got uids %v and gids %v, expected %v and %v", uids, gids, tt.uids, tt.gids)
+			}
+		})
+	}
+}
+
+func TestACLIDs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acl-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	uids, gids, err := ACLIDs(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(uids) != 0 || len(gids) != 0 {
+		t.Errorf("unexpected IDs %v and %v for a directory without ACL", uids, gids)
+	}
+
+	access := makeACL(aclUserObj, aclEntry{tag: aclUser, perm: 7, id: 4242}, aclGroupObj, aclMask, aclOther)
+	def := makeACL(aclUserObj, aclGroupObj, aclEntry{tag: aclGroup, perm: 5, id: 4343}, aclMask, aclOther)
+	if err := unix.Lsetxattr(dir, aclAccessXattr, access, 0); err == unix.EOPNOTSUPP {
+		t.Skipf("ACLs not supported by the filesystem of %s", dir)
+	} else if err != nil {
+		t.Fatalf("failed to set access ACL: %s", err)
+	}
+	if err := unix.Lsetxattr(dir, aclDefaultXattr, def, 0); err != nil {
+		t.Fatalf("failed to set default ACL: %s", err)
+	}
+
+	uids, gids, err = ACLIDs(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(uids, []uint32{4242}) || !reflect.DeepEqual(gids, []uint32{4343}) {
+		t.Errorf("got uids %v and gids %v, expected [4242] and [4343]", uids, gids)
+	}
+
+	if _, _, err := ACLIDs(dir + "/missing"); err == nil {
+		t.Errorf("unexpected success for a missing path")
+	}
+}
@@ -9,6 +9,7 @@ var ActionScript = `#!/bin/sh
 
 declare -r __exported_env__=$(getallenv)
 declare -r __singularity_cmd__=${SINGULARITY_COMMAND:-}
+declare -r __host_ps1__=${PS1:-}
 
 if test -n "${SINGULARITY_APPNAME:-}"; then
     readonly SINGULARITY_APPNAME
@@ -16,6 +17,68 @@ fi
 
 export PWD
 
+# __run_apps__ is executed by the container /bin/sh to run
+# the applications listed in SINGULARITY_APPORDER one after
+# the other, it reports a summary of applications exit code
+# and exits with the last (or first) non-zero exit code.
+# Each application runs in a subshell setting its environment
+# like app_env, so the variables set by its %appenv don't
+# persist into the next application, which starts from the
+# container environment and the global exports of 94-appsbase.sh
+declare -r __run_apps__='
+__status__=0
+__summary__=""
+__ifs__="${IFS}"
+IFS=","
+set -f
+for __app__ in ${SINGULARITY_APPORDER}; do
+    IFS="${__ifs__}"
+    if test -x "/scif/apps/${__app__}/scif/runscript"; then
+        (
+            set +f
+            SINGULARITY_APPNAME="${__app__}"
+            export SINGULARITY_APPNAME
+            if test -f "/.singularity.d/env/94-appsbase.sh"; then
+                . "/.singularity.d/env/94-appsbase.sh"
+            fi
+            __approot__="/scif/apps/${__app__}"
+            PATH="${__approot__}:${PATH:-}"
+            if test -d "${__approot__}/bin"; then
+                PATH="${__approot__}/bin:${PATH}"
+            fi
+            export PATH
+            if test -d "${__approot__}/lib"; then
+                LD_LIBRARY_PATH="${__approot__}/lib${LD_LIBRARY_PATH:+:${LD_LIBRARY_PATH}}"
+                export LD_LIBRARY_PATH
+            fi
+            for __appenv__ in "${__approot__}/scif/env/01-base.sh" "${__approot__}/scif/env/90-environment.sh"; do
+                if test -f "${__appenv__}"; then
+                    . "${__appenv__}"
+                fi
+            done
+            exec "${__approot__}/scif/runscript" "$@"
+        )
+        __code__=$?
+    else
+        echo "ERROR: no runscript for contained app: ${__app__}" >&2
+        __code__=1
+    fi
+    if test ${__code__} -ne 0; then
+        if test "${SINGULARITY_APPEXIT:-last}" = "last" -o ${__status__} -eq 0; then
+            __status__=${__code__}
+        fi
+    fi
+    __summary__="${__summary__} ${__app__}:${__code__}"
+done
+IFS="${__ifs__}"
+set +f
+printf "%-24s %s\n" "APP" "EXIT CODE" >&2
+for __entry__ in ${__summary__}; do
+    printf "%-24s %s\n" "${__entry__%:*}" "${__entry__##*:}" >&2
+done
+exit ${__status__}
+'
+
 unsupported_builtin() {
     sylog warning "$1 is not supported by this shell interpreter"
 }
@@ -78,6 +141,64 @@ restore_env() {
     set +o noglob
 }
 
+# app_env sets the environment of the application SINGULARITY_APPNAME
+# for all actions: application bin and lib directories are prepended
+# to PATH and LD_LIBRARY_PATH, SCIF variables are exported and the
+# application environment (%appenv) is sourced. This replaces the image
+# /.singularity.d/env/95-apps.sh, which older images or images built
+# by other tools may not have
+app_env() {
+    if test -z "${SINGULARITY_APPNAME:-}" -o -n "${__app_env_set__:-}"; then
+        return
+    fi
+    __app_env_set__=1
+
+    local approot="/scif/apps/${SINGULARITY_APPNAME}"
+
+    if ! test -d "${approot}"; then
+        sylog error "could not locate the container application: ${SINGULARITY_APPNAME}"
+        exit 1
+    fi
+
+    export SINGULARITY_APPNAME
+
+    SCIF_APPS="/scif/apps"
+    SCIF_APPNAME="${SINGULARITY_APPNAME}"
+    SCIF_APPROOT="${approot}"
+    SCIF_APPMETA="${approot}/scif"
+    SCIF_APPBIN="${approot}/bin"
+    SCIF_APPLIB="${approot}/lib"
+    SCIF_DATA="/scif/data"
+    SCIF_APPDATA="/scif/data/${SINGULARITY_APPNAME}"
+    SCIF_APPINPUT="/scif/data/${SINGULARITY_APPNAME}/input"
+    SCIF_APPOUTPUT="/scif/data/${SINGULARITY_APPNAME}/output"
+    export SCIF_APPS SCIF_APPNAME SCIF_APPROOT SCIF_APPMETA SCIF_APPBIN SCIF_APPLIB
+    export SCIF_DATA SCIF_APPDATA SCIF_APPINPUT SCIF_APPOUTPUT
+
+    PATH="${approot}:${PATH:-}"
+    if test -d "${approot}/bin"; then
+        PATH="${approot}/bin:${PATH}"
+    fi
+    export PATH
+
+    if test -d "${approot}/lib"; then
+        if test -n "${LD_LIBRARY_PATH:-}"; then
+            LD_LIBRARY_PATH="${approot}/lib:${LD_LIBRARY_PATH}"
+        else
+            LD_LIBRARY_PATH="${approot}/lib"
+        fi
+        export LD_LIBRARY_PATH
+    fi
+
+    # application environment files are optional
+    for __appenv__ in "${approot}/scif/env/01-base.sh" "${approot}/scif/env/90-environment.sh"; do
+        if test -f "${__appenv__}"; then
+            sylog debug "Sourcing ${__appenv__}"
+            source "${__appenv__}"
+        fi
+    done
+}
+
 clear_env
 shopt -s expand_aliases
 
@@ -108,6 +229,9 @@ if test -d "/.singularity.d/env"; then
                 source "${__script__}"
                 source "/.inject-singularity-env.sh"
                 ;;
+            /.singularity.d/env/95-apps.sh)
+                app_env
+                ;;
             *)
                 source "${__script__}"
                 ;;
@@ -123,10 +247,23 @@ else
     source "/.inject-singularity-env.sh"
 fi
 
+# set the application environment if the image doesn't
+# have /.singularity.d/env/95-apps.sh
+app_env
+
 if ! test -f "/.singularity.d/env/99-runtimevars.sh"; then
     source "/.singularity.d/env/99-runtimevars.sh"
 fi
 
+# with --sanitize-path, PATH is reset to the default container PATH
+# whatever the image environment and SINGULARITYENV_ variables set
+__sanitized_path__="$(sanitizedpath)"
+if test -n "${__sanitized_path__}"; then
+    sylog debug "Resetting PATH to ${__sanitized_path__}"
+    export PATH="${__sanitized_path__}"
+fi
+unset __sanitized_path__
+
 shopt -u expand_aliases
 restore_env
 
@@ -138,6 +275,13 @@ if test -z "${PS1:-}"; then
 	export PS1="Singularity> "
 fi
 
+# An interactive shell displaying the prompt of the host
+# is easily mistaken for a host shell, force the Singularity
+# prompt when PS1 was inherited from the host environment
+if test "${__singularity_cmd__}" = "shell" -a "${PS1:-}" = "${__host_ps1__}"; then
+    export PS1="Singularity> "
+fi
+
 # See https://github.com/sylabs/singularity/issues/2721,
 # as bash is often used as the current shell it may confuse
 # users if the provided command is /bin/bash implying to
@@ -158,10 +302,33 @@ case "${__singularity_cmd__}" in
 exec)
     exec "$@" ;;
 shell)
+    # the history file directory doesn't exist when the
+    # home directory isn't mounted from the host
+    if test -n "${SINGULARITY_SHELL_HISTFILE:-}" -a -d "${SINGULARITY_SHELL_HISTFILE%/*}"; then
+        export HISTFILE="${SINGULARITY_SHELL_HISTFILE}"
+    fi
+    __norc__="${SINGULARITY_SHELL_NORC:-}"
+    unset SINGULARITY_SHELL_HISTFILE SINGULARITY_SHELL_NORC
+    if test -n "${__norc__}"; then
+        # sourced by sh, ash and dash interactive shells
+        unset ENV
+    fi
+
     if test -n "${SINGULARITY_SHELL:-}" -a -x "${SINGULARITY_SHELL:-}"; then
+        if test -n "${__norc__}"; then
+            case "${SINGULARITY_SHELL##*/}" in
+            bash)
+                exec "${SINGULARITY_SHELL}" --norc --noprofile "$@" ;;
+            zsh)
+                exec "${SINGULARITY_SHELL}" --no-rcs "$@" ;;
+            esac
+        fi
         exec "${SINGULARITY_SHELL:-}" "$@"
     elif test -x "/bin/bash"; then
         export SHELL=/bin/bash
+        if test -n "${__norc__}"; then
+            exec "/bin/bash" --norc --noprofile "$@"
+        fi
         exec "/bin/bash" --norc "$@"
     elif test -x "/bin/sh"; then
         export SHELL=/bin/sh
@@ -171,7 +338,13 @@ shell)
     sylog error "/bin/sh does not exist in container"
     exit 1 ;;
 run)
-    if test -n "${SINGULARITY_APPNAME:-}"; then
+    if test -n "${SINGULARITY_APPORDER:-}"; then
+        if test -x "/bin/sh"; then
+            exec "/bin/sh" -c "${__run_apps__}" "/bin/sh" "$@"
+        fi
+        sylog error "/bin/sh is required to run applications with --app-order"
+        exit 1
+    elif test -n "${SINGULARITY_APPNAME:-}"; then
         if test -x "/scif/apps/${SINGULARITY_APPNAME:-}/scif/runscript"; then
             exec "/scif/apps/${SINGULARITY_APPNAME:-}/scif/runscript" "$@"
         fi
@@ -230,5 +403,12 @@ if test -n "${SING_USER_DEFINED_PATH:-}"; then
     unset SING_USER_DEFINED_PATH
 fi
 
+# library paths of the bind profiles are searched after the ones set
+# by the image and the user
+if test -n "${SING_PROFILE_LD_LIBRARY_PATH:-}"; then
+    export LD_LIBRARY_PATH="${LD_LIBRARY_PATH:+${LD_LIBRARY_PATH}:}${SING_PROFILE_LD_LIBRARY_PATH}"
+    unset SING_PROFILE_LD_LIBRARY_PATH
+fi
+
 export PATH
 `
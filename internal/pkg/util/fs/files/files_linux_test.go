@@ -113,4 +113,16 @@ func TestResolvConf(t *testing.T) {
 	if !bytes.Equal(content, []byte("nameserver 8.8.8.8\n")) {
 		t.Errorf("ResolvConf returns a bad content")
 	}
+	content, err = ResolvConf([]string{"2001:4860:4860::8888", "fe80::1%eth0"})
+	if err != nil {
+		t.Errorf("should have passed with valid IPv6 dns: %s", err)
+	}
+	if !bytes.Equal(content, []byte("nameserver 2001:4860:4860::8888\nnameserver fe80::1%eth0\n")) {
+		t.Errorf("ResolvConf returns a bad content")
+	}
+	for _, dns := range []string{"8.8.8.8%eth0", "2001:4860:4860::8888%eth0", "fe80::1%"} {
+		if _, err := ResolvConf([]string{dns}); err == nil {
+			t.Errorf("should have failed with bad dns %s", dns)
+		}
+	}
 }
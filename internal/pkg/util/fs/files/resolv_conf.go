@@ -8,18 +8,21 @@ package files
 import (
 	"fmt"
 	"net"
+	"strings"
 
 	"github.com/sylabs/singularity/pkg/sylog"
 )
 
-// ResolvConf creates a resolv.conf content with provided dns list and returns it
+// ResolvConf creates a resolv.conf content with provided dns list and returns it,
+// IPv6 link-local addresses may specify their interface with the %<interface>
+// zone suffix.
 func ResolvConf(dns []string) (content []byte, err error) {
 	sylog.Verbosef("Creating resolv.conf content\n")
 	if len(dns) == 0 {
 		return content, fmt.Errorf("no dns ip provided")
 	}
 	for _, ip := range dns {
-		if net.ParseIP(ip) == nil {
+		if !isNameserver(ip) {
 			return content, fmt.Errorf("dns ip %s is not a valid IP address", ip)
 		}
 		line := fmt.Sprintf("nameserver %s\n", ip)
@@ -27,3 +30,12 @@ func ResolvConf(dns []string) (content []byte, err error) {
 	}
 	return content, nil
 }
+
+// isNameserver returns whether ip is a valid nameserver address.
+func isNameserver(ip string) bool {
+	if i := strings.IndexByte(ip, '%'); i > 0 && i < len(ip)-1 {
+		addr := net.ParseIP(ip[:i])
+		return addr != nil && addr.To4() == nil && addr.IsLinkLocalUnicast()
+	}
+	return net.ParseIP(ip) != nil
+}
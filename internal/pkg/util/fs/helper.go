@@ -13,10 +13,9 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
-	"syscall"
+	"time"
 
 	"github.com/sylabs/singularity/pkg/sylog"
-	"golang.org/x/sys/unix"
 )
 
 // Abs resolves a path to an absolute path.
@@ -73,47 +72,30 @@ func IsDir(name string) bool {
 	return info.Mode().IsDir()
 }
 
-// IsLink check if name component is a symlink.
-func IsLink(name string) bool {
-	info, err := os.Lstat(name)
-	if err != nil {
-		return false
-	}
-	return info.Mode()&os.ModeSymlink != 0
-}
-
-// IsOwner check if name component is owned by user identified with uid.
-func IsOwner(name string, uid uint32) bool {
-	info, err := os.Stat(name)
-	if err != nil {
-		return false
-	}
-	return info.Sys().(*syscall.Stat_t).Uid == uid
-}
-
-// IsExec check if name component has executable bit permission set.
-func IsExec(name string) bool {
+// IsBlockDevice check if name component is a block device.
+func IsBlockDevice(name string) bool {
 	info, err := os.Stat(name)
 	if err != nil {
 		return false
 	}
-	return info.Sys().(*syscall.Stat_t).Mode&syscall.S_IXUSR != 0
+	mode := info.Mode()
+	return mode&os.ModeDevice != 0 && mode&os.ModeCharDevice == 0
 }
 
-// IsSuid check if name component has setuid bit permission set.
-func IsSuid(name string) bool {
-	info, err := os.Stat(name)
+// IsLink check if name component is a symlink.
+func IsLink(name string) bool {
+	info, err := os.Lstat(name)
 	if err != nil {
 		return false
 	}
-	return info.Sys().(*syscall.Stat_t).Mode&syscall.S_ISUID != 0
+	return info.Mode()&os.ModeSymlink != 0
 }
 
 // MkdirAll creates a directory and parents if it doesn't exist with
 // mode after umask reset.
 func MkdirAll(path string, mode os.FileMode) error {
-	oldmask := syscall.Umask(0)
-	defer syscall.Umask(oldmask)
+	oldmask := umask(0)
+	defer umask(oldmask)
 
 	return os.MkdirAll(path, mode)
 }
@@ -121,8 +103,8 @@ func MkdirAll(path string, mode os.FileMode) error {
 // Mkdir creates a directory if it doesn't exist with
 // mode after umask reset.
 func Mkdir(path string, mode os.FileMode) error {
-	oldmask := syscall.Umask(0)
-	defer syscall.Umask(oldmask)
+	oldmask := umask(0)
+	defer umask(oldmask)
 
 	return os.Mkdir(path, mode)
 }
@@ -257,6 +239,19 @@ func EvalRelative(path string, root string) string {
 	return walkSymRelative(path, root, 40)
 }
 
+// SymlinkEscapeError is returned when a path resolved under a root
+// directory contains a symbolic link pointing outside of it.
+type SymlinkEscapeError struct {
+	// Path is the path of the symbolic link, relative to the root directory.
+	Path string
+	// Target is the target of the symbolic link.
+	Target string
+}
+
+func (e *SymlinkEscapeError) Error() string {
+	return fmt.Sprintf("symbolic link %s points outside of the container (target %s)", e.Path, e.Target)
+}
+
 // Touch behaves like touch command.
 func Touch(path string) error {
 	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
@@ -308,6 +303,23 @@ func PathExists(path string) (bool, error) {
 	return true, nil
 }
 
+// WaitPath checks if a path exists and if not, checks again every interval
+// until it appears or the timeout expires. Each check stats the path, which
+// also triggers the mount of an automounted directory.
+func WaitPath(path string, timeout, interval time.Duration) (bool, error) {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		exist, err := PathExists(path)
+		if exist || err != nil {
+			return exist, err
+		} else if time.Now().Add(interval).After(deadline) {
+			return false, nil
+		}
+		time.Sleep(interval)
+	}
+}
+
 // CopyFile copies file to the provided location making sure the resulting
 // file has permission bits set to the mode prior to umask. To honor umask
 // correctly the resulting file must not exist.
@@ -354,8 +366,8 @@ func CopyFileAtomic(from, to string, mode os.FileMode) (err error) {
 
 	// MakeTmpFile forces mode with chmod, so manually apply umask to mode so we
 	// act like other file copy functions that respect umask
-	oldmask := syscall.Umask(0)
-	syscall.Umask(oldmask)
+	oldmask := umask(0)
+	umask(oldmask)
 	mode = mode &^ os.FileMode(oldmask)
 
 	parentDir := filepath.Dir(to)
@@ -391,12 +403,6 @@ func CopyFileAtomic(from, to string, mode os.FileMode) (err error) {
 	return nil
 }
 
-// IsWritable returns true of the file that is passed in
-// is writable by the user (note: uid is checked, not euid).
-func IsWritable(path string) bool {
-	return unix.Access(path, unix.W_OK) == nil
-}
-
 // FirstExistingParent walks up the supplied path and returns the first
 // parent that exists. If the supplied path exists, it will just return that path.
 // Assumes cwd and the root directory always exists
@@ -0,0 +1,53 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// OpenInRoot opens path located under the root directory with the O_PATH
+// flag, without following symbolic links. Unlike EvalRelative, it fails
+// with ELOOP if a component of path is a symbolic link, so the returned
+// file is guaranteed to be located under root even if path is modified
+// concurrently. The returned file can be used as a mount point through its
+// /proc/self/fd entry.
+func OpenInRoot(root, path string) (*os.File, error) {
+	fd, err := unix.Open(root, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: root, Err: err}
+	}
+
+	current := filepath.Clean(root)
+	rel := strings.TrimPrefix(filepath.Join("/", path), "/")
+	if rel != "" {
+		for _, c := range strings.Split(rel, "/") {
+			current = filepath.Join(current, c)
+
+			nfd, err := unix.Openat(fd, c, unix.O_PATH|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+			unix.Close(fd)
+			if err != nil {
+				return nil, &os.PathError{Op: "open", Path: current, Err: err}
+			}
+			fd = nfd
+
+			var st unix.Stat_t
+			if err := unix.Fstat(fd, &st); err != nil {
+				unix.Close(fd)
+				return nil, &os.PathError{Op: "stat", Path: current, Err: err}
+			}
+			if st.Mode&unix.S_IFMT == unix.S_IFLNK {
+				unix.Close(fd)
+				return nil, &os.PathError{Op: "open", Path: current, Err: unix.ELOOP}
+			}
+		}
+	}
+	return os.NewFile(uintptr(fd), current), nil
+}
@@ -7,11 +7,15 @@ package fs
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/sylabs/singularity/internal/pkg/test"
 )
@@ -159,6 +163,21 @@ func TestIsDir(t *testing.T) {
 	}
 }
 
+func TestIsBlockDevice(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	if IsBlockDevice("/etc") {
+		t.Errorf("IsBlockDevice returns true for directory")
+	}
+	if IsBlockDevice("/dev/null") {
+		t.Errorf("IsBlockDevice returns true for character device")
+	}
+	if _, err := os.Stat("/dev/loop0"); err == nil && !IsBlockDevice("/dev/loop0") {
+		t.Errorf("IsBlockDevice returns false for /dev/loop0")
+	}
+}
+
 func TestIsLink(t *testing.T) {
 	test.DropPrivilege(t)
 	defer test.ResetPrivilege(t)
@@ -748,6 +767,42 @@ func TestFirstExistingParent(t *testing.T) {
 	}
 }
 
+func TestWaitPath(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	testDir, err := MakeTmpDir("", "dir", 0755)
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s: %s", testDir, err)
+	}
+	defer os.RemoveAll(testDir)
+
+	// simulate a directory mounted after a short delay
+	delayed := filepath.Join(testDir, "delayed")
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		os.Mkdir(delayed, 0755)
+	}()
+
+	exist, err := WaitPath(delayed, 5*time.Second, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if !exist {
+		t.Errorf("%s not found after it was created", delayed)
+	}
+
+	start := time.Now()
+	exist, err = WaitPath(filepath.Join(testDir, "missing"), 200*time.Millisecond, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if exist {
+		t.Errorf("missing path reported as existing")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("waited %s for a missing path, timeout not honored", elapsed)
+	}
+}
+
 func TestForceRemoveAll(t *testing.T) {
 	test.DropPrivilege(t)
 	defer test.ResetPrivilege(t)
@@ -788,3 +843,67 @@ func TestForceRemoveAll(t *testing.T) {
 		t.Errorf("ForceRemoveAll failed to remove %s", testDir)
 	}
 }
+
+func TestOpenInRoot(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	root, err := ioutil.TempDir("", "open_in_root-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(root)
+
+	// the file descriptor path is the real path
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatalf("failed to resolve %s: %s", root, err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(root, "a", "b"), 0755); err != nil {
+		t.Fatalf("failed to create directories: %s", err)
+	}
+	if err := os.Symlink("/etc", filepath.Join(root, "abs")); err != nil {
+		t.Fatalf("failed to create symlink: %s", err)
+	}
+	if err := os.Symlink("../../..", filepath.Join(root, "a", "rel")); err != nil {
+		t.Fatalf("failed to create symlink: %s", err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr error
+	}{
+		{"Root", "/", root, nil},
+		{"Directory", "/a/b", filepath.Join(root, "a", "b"), nil},
+		{"DotDot", "/a/../../a", filepath.Join(root, "a"), nil},
+		{"Missing", "/a/c", "", syscall.ENOENT},
+		{"AbsoluteSymlink", "/abs", "", syscall.ELOOP},
+		{"RelativeSymlink", "/a/rel/b", "", syscall.ELOOP},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := OpenInRoot(root, tt.path)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			defer f.Close()
+
+			target, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", f.Fd()))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if target != tt.want {
+				t.Errorf("got %s, want %s", target, tt.want)
+			}
+		})
+	}
+}
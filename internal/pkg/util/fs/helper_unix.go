@@ -0,0 +1,53 @@
+// Copyright (c) 2018-2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !windows
+
+package fs
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// IsOwner check if name component is owned by user identified with uid.
+func IsOwner(name string, uid uint32) bool {
+	info, err := os.Stat(name)
+	if err != nil {
+		return false
+	}
+	return info.Sys().(*syscall.Stat_t).Uid == uid
+}
+
+// IsExec check if name component has executable bit permission set.
+func IsExec(name string) bool {
+	info, err := os.Stat(name)
+	if err != nil {
+		return false
+	}
+	return info.Sys().(*syscall.Stat_t).Mode&syscall.S_IXUSR != 0
+}
+
+// IsSuid check if name component has setuid bit permission set.
+func IsSuid(name string) bool {
+	info, err := os.Stat(name)
+	if err != nil {
+		return false
+	}
+	return info.Sys().(*syscall.Stat_t).Mode&syscall.S_ISUID != 0
+}
+
+// IsWritable returns true of the file that is passed in
+// is writable by the user (note: uid is checked, not euid).
+func IsWritable(path string) bool {
+	return unix.Access(path, unix.W_OK) == nil
+}
+
+// umask sets the process umask to mask and returns the previous one.
+func umask(mask int) int {
+	return syscall.Umask(mask)
+}
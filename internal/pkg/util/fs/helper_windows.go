@@ -0,0 +1,45 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fs
+
+import (
+	"os"
+)
+
+// IsOwner check if name component is owned by user identified with uid,
+// file ownership is not reported on this platform.
+func IsOwner(name string, uid uint32) bool {
+	return false
+}
+
+// IsExec check if name component has executable bit permission set.
+func IsExec(name string) bool {
+	info, err := os.Stat(name)
+	if err != nil {
+		return false
+	}
+	return info.Mode()&0100 != 0
+}
+
+// IsSuid check if name component has setuid bit permission set.
+func IsSuid(name string) bool {
+	return false
+}
+
+// IsWritable returns true of the file that is passed in
+// is writable by the user.
+func IsWritable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return info.Mode()&0200 != 0
+}
+
+// umask has no effect on this platform.
+func umask(mask int) int {
+	return 0
+}
@@ -48,12 +48,15 @@ type VFS interface {
 	EvalRelative(string, string) string
 	Lchown(string, int, int) error
 	Mkdir(string, os.FileMode) error
+	MkdirInRoot(string, string, os.FileMode, int, int) error
 	Readlink(string) (string, error)
 	ReadDir(string) ([]os.FileInfo, error)
 	Stat(string) (os.FileInfo, error)
 	Symlink(string, string) error
+	SymlinkInRoot(string, string, string, int, int) error
 	Umask(int) int
 	WriteFile(string, []byte, os.FileMode) error
+	WriteFileInRoot(string, string, []byte, os.FileMode, int, int) error
 }
 
 type defaultVFS struct{}
@@ -74,6 +77,10 @@ func (v *defaultVFS) Mkdir(name string, perm os.FileMode) error {
 	return os.Mkdir(name, perm)
 }
 
+func (v *defaultVFS) MkdirInRoot(root, name string, perm os.FileMode, uid, gid int) error {
+	return fs.MkdirInRoot(root, name, perm, uid, gid)
+}
+
 func (v *defaultVFS) Readlink(name string) (string, error) {
 	return os.Readlink(name)
 }
@@ -90,6 +97,10 @@ func (v *defaultVFS) Symlink(oldname, newname string) error {
 	return os.Symlink(oldname, newname)
 }
 
+func (v *defaultVFS) SymlinkInRoot(root, oldname, newname string, uid, gid int) error {
+	return fs.SymlinkInRoot(root, oldname, newname, uid, gid)
+}
+
 func (v *defaultVFS) Umask(mask int) int {
 	return syscall.Umask(mask)
 }
@@ -111,6 +122,10 @@ func (v *defaultVFS) WriteFile(filename string, data []byte, perm os.FileMode) e
 	return err
 }
 
+func (v *defaultVFS) WriteFileInRoot(root, filename string, data []byte, perm os.FileMode, uid, gid int) error {
+	return fs.WriteFileInRoot(root, filename, data, perm, uid, gid)
+}
+
 var DefaultVFS VFS = &defaultVFS{}
 
 // Manager manages a filesystem layout in a given path
@@ -317,6 +332,15 @@ func (m *Manager) sync() error {
 	uid := os.Getuid()
 	gid := os.Getgid()
 
+	// owner returns the ownership to apply to a created entry, -1 when
+	// it matches the current user
+	owner := func(euid, egid int) (int, int) {
+		if euid == uid && egid == gid {
+			return -1, -1
+		}
+		return euid, egid
+	}
+
 	if m.entries == nil {
 		return fmt.Errorf("root path is not set")
 	}
@@ -329,9 +353,11 @@ func (m *Manager) sync() error {
 			continue
 		}
 		path := ""
+		rel := ""
 		for p, e := range m.entries {
 			if e == d {
 				path = m.rootPath + p
+				rel = p
 				for _, ovDir := range m.ovDirs[p] {
 					if _, err := m.VFS.Stat(ovDir); err != nil {
 						if err := m.VFS.Mkdir(ovDir, m.DirMode); err != nil {
@@ -345,36 +371,26 @@ func (m *Manager) sync() error {
 		if path == "" {
 			continue
 		}
-		if d.mode != m.DirMode {
-			if err := m.VFS.Mkdir(path, d.mode); err != nil {
-				if !os.IsExist(err) {
-					return fmt.Errorf("failed to create %s directory: %s", path, err)
-				}
-				// skip owner change, not created by us
-				d.created = true
-				continue
-			}
-		} else {
-			if err := m.VFS.Mkdir(path, m.DirMode); err != nil {
-				if !os.IsExist(err) {
-					return fmt.Errorf("failed to create %s directory: %s", path, err)
-				}
-				// skip owner change, not created by us
-				d.created = true
-				continue
-			}
-		}
-		if d.uid != uid || d.gid != gid {
-			if err := m.VFS.Chown(path, d.uid, d.gid); err != nil {
-				return fmt.Errorf("failed to change owner of %s: %s", path, err)
+		// parent directories are resolved strictly under the root path,
+		// they may be symbolic links copied from the container image, the
+		// owner is changed along with the creation for the same reason
+		duid, dgid := owner(d.uid, d.gid)
+		if err := m.VFS.MkdirInRoot(m.rootPath, rel, d.mode, duid, dgid); err != nil {
+			if !os.IsExist(err) {
+				return fmt.Errorf("failed to create %s directory: %w", path, err)
 			}
+			// skip owner change, not created by us
+			d.created = true
+			continue
 		}
 		d.created = true
 	}
 
 	for p, e := range m.entries {
 		path := m.rootPath + p
-		if ovDir, err := m.GetOverridePath(filepath.Dir(p)); err == nil {
+		ovDir, err := m.GetOverridePath(filepath.Dir(p))
+		override := err == nil
+		if override {
 			path = filepath.Join(ovDir, filepath.Base(p))
 		}
 		switch entry := e.(type) {
@@ -382,15 +398,21 @@ func (m *Manager) sync() error {
 			if entry.created {
 				continue
 			}
-			if err := m.VFS.WriteFile(path, entry.content, entry.mode); err != nil {
+			fuid, fgid := owner(entry.uid, entry.gid)
+			if override {
+				err = m.VFS.WriteFile(path, entry.content, entry.mode)
+			} else {
+				err = m.VFS.WriteFileInRoot(m.rootPath, p, entry.content, entry.mode, fuid, fgid)
+			}
+			if err != nil {
 				if !os.IsExist(err) {
-					return fmt.Errorf("failed to create file %s: %s", path, err)
+					return fmt.Errorf("failed to create file %s: %w", path, err)
 				}
 				// skip content write or owner change, not created by us
 				entry.created = true
 				continue
 			}
-			if entry.uid != uid || entry.gid != gid {
+			if override && (fuid != -1 || fgid != -1) {
 				if err := m.VFS.Chown(path, entry.uid, entry.gid); err != nil {
 					return fmt.Errorf("failed to change %s ownership: %s", path, err)
 				}
@@ -400,9 +422,15 @@ func (m *Manager) sync() error {
 			if entry.created {
 				continue
 			}
-			if err := m.VFS.Symlink(entry.target, path); err != nil {
+			luid, lgid := owner(entry.uid, entry.gid)
+			if override {
+				err = m.VFS.Symlink(entry.target, path)
+			} else {
+				err = m.VFS.SymlinkInRoot(m.rootPath, entry.target, p, luid, lgid)
+			}
+			if err != nil {
 				if !os.IsExist(err) {
-					return fmt.Errorf("failed to create symlink %s: %s", path, err)
+					return fmt.Errorf("failed to create symlink %s: %w", path, err)
 				}
 				// check that current symlink point to the right target if it's a symlink
 				// otherwise we consider the entry as already created no matter if it's a
@@ -415,7 +443,7 @@ func (m *Manager) sync() error {
 				entry.created = true
 				continue
 			}
-			if entry.uid != uid || entry.gid != gid {
+			if override && (luid != -1 || lgid != -1) {
 				if err := m.VFS.Lchown(path, entry.uid, entry.gid); err != nil {
 					return fmt.Errorf("failed to change %s ownership: %s", path, err)
 				}
@@ -6,8 +6,10 @@
 package layout
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/sylabs/singularity/internal/pkg/test"
@@ -147,3 +149,52 @@ func TestLayout(t *testing.T) {
 		}
 	}
 }
+
+func TestLayoutSymlinkEscape(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	outside, err := ioutil.TempDir("", "outside")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+
+	session := &Manager{VFS: DefaultVFS}
+	if err := session.SetRootPath(dir); err != nil {
+		t.Fatal(err)
+	}
+	// a symbolic link duplicated from a container image climbing
+	// outside of the session directory
+	if err := session.AddSymlink("/opt", filepath.Join("..", filepath.Base(outside))); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := session.AddDir("/opt/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.AddFile("/opt/file", nil); err != nil {
+		t.Fatal(err)
+	}
+	err = session.Update()
+
+	var linkErr *fs.SymlinkEscapeError
+	if !errors.As(err, &linkErr) {
+		t.Fatalf("got error %v, want symbolic link escape error", err)
+	}
+	if linkErr.Path != "/opt" {
+		t.Errorf("got symbolic link %s, want /opt", linkErr.Path)
+	}
+	if fi, err := ioutil.ReadDir(outside); err != nil || len(fi) > 0 {
+		t.Errorf("directory outside of session was modified: %v", err)
+	}
+}
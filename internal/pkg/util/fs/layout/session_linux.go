@@ -6,10 +6,13 @@
 package layout
 
 import (
+	"errors"
 	"fmt"
 	"path/filepath"
+	"strings"
 	"syscall"
 
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
 	"github.com/sylabs/singularity/internal/pkg/util/fs/mount"
 	"github.com/sylabs/singularity/pkg/sylog"
 )
@@ -31,6 +34,34 @@ type layer interface {
 
 // NewSession creates and returns a session directory layout manager
 func NewSession(path string, fstype string, size int, system *mount.System, layer layer) (*Session, error) {
+	options := "mode=1777"
+	if size > 0 {
+		options = fmt.Sprintf("mode=1777,size=%dm", size)
+	}
+	return newSession(path, system, layer, func() error {
+		return system.Points.AddFS(mount.SessionTag, path, fstype, syscall.MS_NOSUID, options)
+	})
+}
+
+// NewDiskSession creates and returns a session directory layout manager
+// for a session directory stored on disk in the directory dir, which is
+// bind mounted on path
+func NewDiskSession(path string, dir string, system *mount.System, layer layer) (*Session, error) {
+	return newSession(path, system, layer, func() error {
+		flags := uintptr(syscall.MS_BIND | syscall.MS_NOSUID | syscall.MS_NODEV)
+		if err := system.Points.AddBind(mount.SessionTag, dir, path, flags); err != nil {
+			return err
+		}
+		if err := system.Points.AddRemount(mount.SessionTag, path, flags); err != nil {
+			return err
+		}
+		// mount points added in the session directory must not
+		// propagate to dir which is removed once the container exits
+		return system.Points.AddPropagation(mount.SessionTag, path, syscall.MS_PRIVATE|syscall.MS_REC)
+	})
+}
+
+func newSession(path string, system *mount.System, layer layer, addMount func() error) (*Session, error) {
 	manager := &Manager{VFS: DefaultVFS}
 	session := &Session{Manager: manager}
 
@@ -43,12 +74,7 @@ func NewSession(path string, fstype string, size int, system *mount.System, laye
 	if err := manager.AddDir(finalDir); err != nil {
 		return nil, err
 	}
-	options := "mode=1777"
-	if size > 0 {
-		options = fmt.Sprintf("mode=1777,size=%dm", size)
-	}
-	err := system.Points.AddFS(mount.SessionTag, path, fstype, syscall.MS_NOSUID, options)
-	if err != nil {
+	if err := addMount(); err != nil {
 		return nil, err
 	}
 	if err := system.RunAfterTag(mount.SessionTag, session.createLayout); err != nil {
@@ -94,6 +120,33 @@ func (s *Session) RootFsPath() string {
 	return path
 }
 
+// Create creates the session directory layout, errors are reported
+// like Update.
+func (s *Session) Create() error {
+	return s.imageError(s.Manager.Create())
+}
+
+// Update updates the session directory layout. When the update fails
+// because of a symbolic link copied from the container image which points
+// outside of the container, the error identifies the symbolic link by its
+// path in the image.
+func (s *Session) Update() error {
+	return s.imageError(s.Manager.Update())
+}
+
+func (s *Session) imageError(err error) error {
+	var linkErr *fs.SymlinkEscapeError
+	if err == nil || s.Layer == nil || !errors.As(err, &linkErr) {
+		return err
+	}
+	dir := s.Layer.Dir()
+	if !strings.HasPrefix(linkErr.Path, dir+"/") {
+		return err
+	}
+	path := strings.TrimPrefix(linkErr.Path, dir)
+	return fmt.Errorf("refusing to follow %s in container image: symbolic link to %s pointing outside of the container", path, linkErr.Target)
+}
+
 func (s *Session) createLayout(system *mount.System) error {
 	// create directory for registered overrided directory
 	for _, tag := range mount.GetTagList() {
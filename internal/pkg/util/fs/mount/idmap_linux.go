@@ -0,0 +1,120 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package mount
+
+import (
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// IDMapOption is the internal option of an idmapped bind mount point.
+const IDMapOption = "idmap"
+
+// mount_setattr system call and new mount API flags, not provided by the
+// vendored golang.org/x/sys/unix package.
+const (
+	sysMountSetattr     = 442
+	openTreeClone       = 0x1
+	atRecursive         = 0x8000
+	moveMountFEmptyPath = 0x4
+	mountAttrIDMap      = 0x100000
+)
+
+// mountAttr is the mount_attr structure of the mount_setattr system call.
+type mountAttr struct {
+	attrSet     uint64
+	attrClr     uint64
+	propagation uint64
+	usernsFd    uint64
+}
+
+// HasIDMap returns if the idmap internal option is set.
+func HasIDMap(options []string) bool {
+	for _, opt := range options {
+		if opt == IDMapOption {
+			return true
+		}
+	}
+	return false
+}
+
+// IDMapSupported returns if the kernel supports idmapped mounts, which
+// were introduced in Linux 5.12 along with the mount_setattr system call.
+func IDMapSupported() bool {
+	_, _, errno := unix.Syscall6(sysMountSetattr, uintptr(0xffffffff), 0, 0, 0, 0, 0)
+	return errno != unix.ENOSYS
+}
+
+// IDMapUnsupported returns if err reports that an idmapped mount can't be
+// created, because the kernel or the source filesystem doesn't support it
+// or because the caller lacks the required privileges.
+func IDMapUnsupported(err error) bool {
+	switch err {
+	case unix.ENOSYS, unix.EINVAL, unix.EPERM, unix.EOPNOTSUPP:
+		return true
+	}
+	return false
+}
+
+// OpenTreeIDMapped returns the file descriptor of a detached bind mount
+// of source with its ownership translated through the ID mappings of the
+// user namespace usernsFd, the files of source are left untouched.
+// Submounts of source are included when flags contain MS_REC, other flags
+// must be applied with a remount once the mount is attached by MoveMount.
+// Creating an idmapped mount requires CAP_SYS_ADMIN in the user namespace
+// owning the source filesystem, the host user namespace for most of them,
+// so it's not possible from the container user namespace.
+func OpenTreeIDMapped(source string, usernsFd int, flags uintptr) (int, error) {
+	// AT_FDCWD is negative and can't be converted to uintptr as a constant
+	cwd := unix.AT_FDCWD
+	treeFlags := openTreeClone | unix.O_CLOEXEC
+	attrFlags := unix.AT_EMPTY_PATH
+	if flags&syscall.MS_REC != 0 {
+		treeFlags |= atRecursive
+		attrFlags |= atRecursive
+	}
+
+	src, err := unix.BytePtrFromString(source)
+	if err != nil {
+		return -1, err
+	}
+	fd, _, errno := unix.Syscall(unix.SYS_OPEN_TREE, uintptr(cwd), uintptr(unsafe.Pointer(src)), uintptr(treeFlags))
+	if errno != 0 {
+		return -1, errno
+	}
+
+	empty, _ := unix.BytePtrFromString("")
+	attr := &mountAttr{
+		attrSet:  mountAttrIDMap,
+		usernsFd: uint64(usernsFd),
+	}
+	_, _, errno = unix.Syscall6(sysMountSetattr, fd, uintptr(unsafe.Pointer(empty)), uintptr(attrFlags), uintptr(unsafe.Pointer(attr)), unsafe.Sizeof(*attr), 0)
+	if errno != 0 {
+		unix.Close(int(fd))
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+// MoveMount attaches the detached mount fd returned by OpenTreeIDMapped
+// to target, fd can be passed to and attached from another process
+// running in another mount namespace.
+func MoveMount(fd int, target string) error {
+	cwd := unix.AT_FDCWD
+
+	empty, _ := unix.BytePtrFromString("")
+	dst, err := unix.BytePtrFromString(target)
+	if err != nil {
+		return err
+	}
+	_, _, errno := unix.Syscall6(unix.SYS_MOVE_MOUNT, uintptr(fd), uintptr(unsafe.Pointer(empty)), uintptr(cwd), uintptr(unsafe.Pointer(dst)), moveMountFEmptyPath, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
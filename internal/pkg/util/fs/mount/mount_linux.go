@@ -144,6 +144,7 @@ var authorizedTags = map[AuthorizedTag]struct {
 var authorizedImage = map[string]fsContext{
 	"encryptfs": {true},
 	"ext3":      {true},
+	"ext4":      {true},
 	"squashfs":  {true},
 }
 
@@ -159,7 +160,7 @@ var authorizedFS = map[string]fsContext{
 	"fuse":    {false},
 }
 
-var internalOptions = []string{"loop", "offset", "sizelimit", "key"}
+var internalOptions = []string{"loop", "offset", "sizelimit", "key", IDMapOption}
 
 // Point describes a mount point
 type Point struct {
@@ -524,7 +525,12 @@ func (p *Points) Import(points map[AuthorizedTag][]Point) error {
 			}
 			// check if this is a bind mount point
 			if flags&syscall.MS_BIND != 0 {
-				if err = p.AddBind(tag, point.Source, point.Destination, flags); err == nil {
+				if HasIDMap(point.InternalOptions) {
+					err = p.AddIDMappedBind(tag, point.Source, point.Destination, flags)
+				} else {
+					err = p.AddBind(tag, point.Source, point.Destination, flags)
+				}
+				if err == nil {
 					continue
 				} else {
 					return err
@@ -611,7 +617,7 @@ func (p *Points) AddImage(tag AuthorizedTag, source string, dest string, fstype
 	}
 	keyB64 := base64.StdEncoding.EncodeToString(key)
 	options = fmt.Sprintf("loop,offset=%d,sizelimit=%d,key=%s", offset, sizelimit, keyB64)
-	if fstype == "ext3" {
+	if fstype == "ext3" || fstype == "ext4" {
 		options += ",errors=remount-ro"
 	}
 	return p.add(tag, source, dest, fstype, flags, options)
@@ -645,6 +651,18 @@ func (p *Points) AddBind(tag AuthorizedTag, source string, dest string, flags ui
 	return p.add(tag, source, dest, "", bindFlags, options)
 }
 
+// AddIDMappedBind adds a bind mount point with the ownership of source
+// translated through the ID mappings of the container user namespace.
+func (p *Points) AddIDMappedBind(tag AuthorizedTag, source string, dest string, flags uintptr) error {
+	if source == "" {
+		return fmt.Errorf("a bind mount point must contain a source")
+	}
+	if !strings.HasPrefix(source, "/") {
+		return fmt.Errorf("source must be an absolute path")
+	}
+	return p.add(tag, source, dest, "", flags|syscall.MS_BIND, IDMapOption)
+}
+
 // GetAllBinds returns a list of all registered bind mount points
 func (p *Points) GetAllBinds() []Point {
 	p.init()
@@ -54,6 +54,10 @@ func TestImage(t *testing.T) {
 		t.Errorf("should have passed with ext3 filesystem")
 	}
 	points.RemoveAll()
+	if err := points.AddImage(RootfsTag, "/fake", "/ext4", "ext4", 0, 0, 10, nil); err != nil {
+		t.Errorf("should have passed with ext4 filesystem")
+	}
+	points.RemoveAll()
 	if err := points.AddImage(RootfsTag, "/fake", "/squash", "squashfs", 0, 0, 10, nil); err != nil {
 		t.Errorf("should have passed with squashfs filesystem")
 	}
@@ -279,6 +283,48 @@ func TestBind(t *testing.T) {
 	}
 }
 
+func TestIDMappedBind(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	points := &Points{}
+
+	if err := points.AddIDMappedBind(UserbindsTag, "fake", "/mnt", 0); err == nil {
+		t.Errorf("should have failed as source is not an absolute path")
+	}
+	if err := points.AddIDMappedBind(UserbindsTag, "/home", "/mnt", syscall.MS_REC); err != nil {
+		t.Fatalf("%s", err)
+	}
+	bind := points.GetByDest("/mnt")
+	if len(bind) != 1 {
+		t.Fatalf("expected one mount point for /mnt, got %d", len(bind))
+	}
+	if !HasIDMap(bind[0].InternalOptions) {
+		t.Errorf("idmap option not set for /mnt: %v", bind[0].InternalOptions)
+	}
+	for _, option := range bind[0].Options {
+		if option == IDMapOption {
+			t.Errorf("idmap option passed as a mount option for /mnt")
+		}
+	}
+
+	imported := &Points{}
+	if err := imported.Import(points.GetAll()); err != nil {
+		t.Fatalf("unexpected import error: %s", err)
+	}
+	bind = imported.GetByDest("/mnt")
+	if len(bind) != 1 || !HasIDMap(bind[0].InternalOptions) {
+		t.Errorf("idmap option not imported for /mnt: %v", bind)
+	}
+
+	if err := points.AddBind(UserbindsTag, "/", "/opt", 0); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if bind := points.GetByDest("/opt"); len(bind) != 1 || HasIDMap(bind[0].InternalOptions) {
+		t.Errorf("unexpected idmap option for /opt: %v", bind)
+	}
+}
+
 func TestRemount(t *testing.T) {
 	test.DropPrivilege(t)
 	defer test.ResetPrivilege(t)
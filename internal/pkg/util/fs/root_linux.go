@@ -0,0 +1,285 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxSymlinks is the maximum number of symbolic links followed while
+// resolving a path under a root directory, like the kernel.
+const maxSymlinks = 40
+
+// openat2 system call and resolve flags, not provided by the vendored
+// golang.org/x/sys/unix package.
+const (
+	sysOpenat2          = 437
+	resolveNoMagiclinks = 0x02
+	resolveBeneath      = 0x08
+)
+
+// openHow is the open_how structure of the openat2 system call.
+type openHow struct {
+	flags   uint64
+	mode    uint64
+	resolve uint64
+}
+
+// openat2 calls the openat2 system call.
+func openat2(dirfd int, path string, how *openHow) (int, error) {
+	p, err := unix.BytePtrFromString(path)
+	if err != nil {
+		return -1, err
+	}
+	fd, _, errno := unix.Syscall6(sysOpenat2, uintptr(dirfd), uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(how)), unsafe.Sizeof(*how), 0, 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+// openBeneath opens the directory rel, relative to the root directory
+// rootfd, with the O_PATH flag. Symbolic links are followed as long as they
+// resolve under the root directory, absolute symbolic links are resolved
+// relative to the root directory like in the container. A relative symbolic
+// link climbing outside of the root directory is reported with a
+// SymlinkEscapeError. It relies on openat2 with RESOLVE_BENEATH when
+// supported by the kernel and falls back to a component by component
+// resolution otherwise.
+func openBeneath(rootfd int, rel string) (int, error) {
+	if rel == "" {
+		rel = "."
+	}
+	how := &openHow{
+		flags:   unix.O_PATH | unix.O_DIRECTORY | unix.O_CLOEXEC,
+		resolve: resolveBeneath | resolveNoMagiclinks,
+	}
+	fd, err := openat2(rootfd, rel, how)
+	switch err {
+	case nil:
+		return fd, nil
+	case unix.ENOSYS, unix.EPERM, unix.E2BIG:
+		// openat2 is not supported or filtered by seccomp
+		return walkBeneath(rootfd, rel)
+	case unix.EXDEV:
+		// resolution crossed an absolute symbolic link or escaped the
+		// root directory, resolve it again to follow absolute symbolic
+		// links from the root directory or to identify the offending
+		// symbolic link
+		return walkBeneath(rootfd, rel)
+	}
+	return -1, err
+}
+
+// walkBeneath resolves the directory rel under the root directory rootfd
+// component by component, without ever following a symbolic link outside
+// of the root directory. Absolute symbolic links restart the resolution
+// from the root directory.
+func walkBeneath(rootfd int, rel string) (int, error) {
+	fd, err := unix.Openat(rootfd, ".", unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, err
+	}
+
+	remaining := strings.Split(rel, "/")
+	// resolved holds the resolved components, none of them is a symbolic link
+	var resolved []string
+	var lastLink *SymlinkEscapeError
+	links := 0
+
+	for len(remaining) > 0 {
+		c := remaining[0]
+		remaining = remaining[1:]
+
+		switch c {
+		case "", ".":
+			continue
+		case "..":
+			if len(resolved) == 0 {
+				unix.Close(fd)
+				if lastLink != nil {
+					return -1, lastLink
+				}
+				return -1, unix.EXDEV
+			}
+			resolved = resolved[:len(resolved)-1]
+			unix.Close(fd)
+			// reopen the parent from the root directory, as the resolved
+			// components may have been replaced meanwhile they are opened
+			// again without following symbolic links
+			fd, err = walkBeneath(rootfd, strings.Join(resolved, "/"))
+			if err != nil {
+				return -1, err
+			}
+			continue
+		}
+
+		nfd, err := unix.Openat(fd, c, unix.O_PATH|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+		if err != nil {
+			unix.Close(fd)
+			return -1, err
+		}
+
+		var st unix.Stat_t
+		if err := unix.Fstat(nfd, &st); err != nil {
+			unix.Close(nfd)
+			unix.Close(fd)
+			return -1, err
+		}
+		if st.Mode&unix.S_IFMT != unix.S_IFLNK {
+			unix.Close(fd)
+			fd = nfd
+			resolved = append(resolved, c)
+			continue
+		}
+
+		target, err := readlinkFd(nfd)
+		unix.Close(nfd)
+		if err != nil {
+			unix.Close(fd)
+			return -1, err
+		}
+		link := &SymlinkEscapeError{
+			Path:   "/" + strings.Join(append(resolved, c), "/"),
+			Target: target,
+		}
+		links++
+		if links > maxSymlinks {
+			unix.Close(fd)
+			return -1, unix.ELOOP
+		}
+		if filepath.IsAbs(target) {
+			unix.Close(fd)
+			fd, err = unix.Openat(rootfd, ".", unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+			if err != nil {
+				return -1, err
+			}
+			resolved = nil
+		}
+		lastLink = link
+		remaining = append(strings.Split(target, "/"), remaining...)
+	}
+	return fd, nil
+}
+
+// readlinkFd returns the target of the symbolic link opened with fd.
+func readlinkFd(fd int) (string, error) {
+	for size := 128; ; size *= 2 {
+		b := make([]byte, size)
+		n, err := unix.Readlinkat(fd, "", b)
+		if err != nil {
+			return "", err
+		}
+		if n < size {
+			return string(b[:n]), nil
+		}
+	}
+}
+
+// openParentInRoot opens the parent directory of path located under the
+// root directory and returns it with the last component of path.
+func openParentInRoot(op, root, path string) (int, string, error) {
+	rel := strings.TrimPrefix(filepath.Join("/", path), "/")
+	full := filepath.Join(root, rel)
+	if rel == "" {
+		return -1, "", &os.PathError{Op: op, Path: full, Err: unix.EEXIST}
+	}
+
+	rootfd, err := unix.Open(root, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, "", &os.PathError{Op: op, Path: root, Err: err}
+	}
+	defer unix.Close(rootfd)
+
+	fd, err := openBeneath(rootfd, filepath.Dir(rel))
+	if err != nil {
+		return -1, "", &os.PathError{Op: op, Path: full, Err: err}
+	}
+	return fd, filepath.Base(rel), nil
+}
+
+// chownInRoot changes the owner of name, relative to the parent directory
+// fd, without following it if it's a symbolic link. A uid or gid of -1
+// leaves it unchanged like with os.Lchown.
+func chownInRoot(fd int, name, path string, uid, gid int) error {
+	if uid == -1 && gid == -1 {
+		return nil
+	}
+	if err := unix.Fchownat(fd, name, uid, gid, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return &os.PathError{Op: "lchown", Path: path, Err: err}
+	}
+	return nil
+}
+
+// MkdirInRoot creates the directory path located under the root directory
+// like os.Mkdir and sets its owner to uid and gid, -1 leaves the owner
+// unchanged. The parent directories of path are resolved strictly under
+// root, if one of them is a symbolic link pointing outside of root, the
+// returned error wraps a SymlinkEscapeError. The directory is created and
+// its owner changed relative to the resolved parent directory, it is never
+// looked up again by path.
+func MkdirInRoot(root, path string, perm os.FileMode, uid, gid int) error {
+	fd, name, err := openParentInRoot("mkdir", root, path)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	full := filepath.Join(root, path)
+	if err := unix.Mkdirat(fd, name, uint32(perm.Perm())); err != nil {
+		return &os.PathError{Op: "mkdir", Path: full, Err: err}
+	}
+	return chownInRoot(fd, name, full, uid, gid)
+}
+
+// WriteFileInRoot creates the file path located under the root directory,
+// owned by uid and gid, and writes data to it. It fails if path already
+// exists and resolves the parent directories of path like MkdirInRoot.
+func WriteFileInRoot(root, path string, data []byte, perm os.FileMode, uid, gid int) error {
+	fd, name, err := openParentInRoot("open", root, path)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	flags := unix.O_WRONLY | unix.O_CREAT | unix.O_EXCL | unix.O_NOFOLLOW | unix.O_CLOEXEC
+	ffd, err := unix.Openat(fd, name, flags, uint32(perm.Perm()))
+	if err != nil {
+		return &os.PathError{Op: "open", Path: filepath.Join(root, path), Err: err}
+	}
+	f := os.NewFile(uintptr(ffd), filepath.Join(root, path))
+	defer f.Close()
+
+	if uid != -1 || gid != -1 {
+		if err := f.Chown(uid, gid); err != nil {
+			return err
+		}
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// SymlinkInRoot creates the symbolic link path located under the root
+// directory, owned by uid and gid, and pointing to target. The parent
+// directories of path are resolved like MkdirInRoot.
+func SymlinkInRoot(root, target, path string, uid, gid int) error {
+	fd, name, err := openParentInRoot("symlink", root, path)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	full := filepath.Join(root, path)
+	if err := unix.Symlinkat(target, fd, name); err != nil {
+		return &os.LinkError{Op: "symlink", Old: target, New: full, Err: err}
+	}
+	return chownInRoot(fd, name, full, uid, gid)
+}
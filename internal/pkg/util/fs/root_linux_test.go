@@ -0,0 +1,225 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+	"golang.org/x/sys/unix"
+)
+
+// makeMaliciousRoot creates a root directory with symbolic links pointing
+// inside and outside of it, the returned outside directory must never be
+// modified through root.
+func makeMaliciousRoot(t *testing.T) (root, outside string) {
+	root, err := ioutil.TempDir("", "in_root-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	outside, err = ioutil.TempDir("", "outside_root-")
+	if err != nil {
+		os.RemoveAll(root)
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+
+	// the file descriptor paths are the real paths
+	for _, p := range []*string{&root, &outside} {
+		if *p, err = filepath.EvalSymlinks(*p); err != nil {
+			t.Fatalf("failed to resolve %s: %s", *p, err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Join(root, "a", "b"), 0755); err != nil {
+		t.Fatalf("failed to create directories: %s", err)
+	}
+	links := map[string]string{
+		"abs":     outside,
+		"a/absin": "/a/b",
+		"a/in":    "b",
+		"a/up":    "../a/b",
+		"a/rel":   filepath.Join("../..", filepath.Base(outside)),
+		"a/loop":  "loop",
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Fatalf("failed to create symlink: %s", err)
+		}
+	}
+	return root, outside
+}
+
+func TestMkdirInRoot(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	root, outside := makeMaliciousRoot(t)
+	defer os.RemoveAll(root)
+	defer os.RemoveAll(outside)
+
+	tests := []struct {
+		name     string
+		path     string
+		want     string
+		wantLink string
+		wantErr  error
+	}{
+		{name: "Directory", path: "/a/c", want: "a/c"},
+		{name: "InRootSymlink", path: "/a/in/c", want: "a/b/c"},
+		{name: "InRootDotDot", path: "/a/up/d", want: "a/b/d"},
+		{name: "Exists", path: "/a/b", wantErr: syscall.EEXIST},
+		{name: "Missing", path: "/a/missing/c", wantErr: syscall.ENOENT},
+		{name: "Loop", path: "/a/loop/c", wantErr: syscall.ELOOP},
+		{name: "AbsoluteInRootSymlink", path: "/a/absin/e", want: "a/b/e"},
+		{name: "AbsoluteSymlink", path: "/abs/c", wantErr: syscall.ENOENT},
+		{name: "RelativeSymlink", path: "/a/rel/c", wantLink: "/a/rel"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := MkdirInRoot(root, tt.path, 0755, os.Getuid(), os.Getgid())
+			switch {
+			case tt.wantLink != "":
+				var linkErr *SymlinkEscapeError
+				if !errors.As(err, &linkErr) {
+					t.Fatalf("got error %v, want symbolic link escape error", err)
+				}
+				if linkErr.Path != tt.wantLink {
+					t.Errorf("got symbolic link %s, want %s", linkErr.Path, tt.wantLink)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %s", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatalf("unexpected error: %s", err)
+			default:
+				if fi, err := os.Lstat(filepath.Join(root, tt.want)); err != nil || !fi.IsDir() {
+					t.Errorf("directory %s not created: %v", tt.want, err)
+				}
+			}
+		})
+	}
+
+	if fi, err := ioutil.ReadDir(outside); err != nil || len(fi) > 0 {
+		t.Errorf("directory outside of root was modified: %v", err)
+	}
+}
+
+func TestWriteFileInRoot(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	root, outside := makeMaliciousRoot(t)
+	defer os.RemoveAll(root)
+	defer os.RemoveAll(outside)
+
+	if err := WriteFileInRoot(root, "/a/in/file", []byte("data"), 0644, -1, -1); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(root, "a", "b", "file")); err != nil || string(b) != "data" {
+		t.Errorf("got content %q (%v), want %q", b, err, "data")
+	}
+	if err := WriteFileInRoot(root, "/a/in/file", nil, 0644, -1, -1); !os.IsExist(err) {
+		t.Errorf("got error %v, want %s", err, syscall.EEXIST)
+	}
+	// the last component is never followed
+	if err := WriteFileInRoot(root, "/abs", nil, 0644, -1, -1); !os.IsExist(err) {
+		t.Errorf("got error %v, want %s", err, syscall.EEXIST)
+	}
+
+	var linkErr *SymlinkEscapeError
+	if err := WriteFileInRoot(root, "/a/rel/file", nil, 0644, -1, -1); !errors.As(err, &linkErr) {
+		t.Errorf("got error %v, want symbolic link escape error", err)
+	}
+	// absolute symbolic links are resolved from the root directory
+	if err := SymlinkInRoot(root, "/etc", "/abs/link", -1, -1); !os.IsNotExist(err) {
+		t.Errorf("got error %v, want %s", err, syscall.ENOENT)
+	}
+	if err := SymlinkInRoot(root, "/etc", "/a/absin/link", os.Getuid(), os.Getgid()); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if _, err := os.Lstat(filepath.Join(root, "a", "b", "link")); err != nil {
+		t.Errorf("symbolic link not created: %s", err)
+	}
+
+	if fi, err := ioutil.ReadDir(outside); err != nil || len(fi) > 0 {
+		t.Errorf("directory outside of root was modified: %v", err)
+	}
+}
+
+// TestWalkBeneath checks the resolution used when openat2 is not supported
+// by the kernel.
+func TestWalkBeneath(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	root, outside := makeMaliciousRoot(t)
+	defer os.RemoveAll(root)
+	defer os.RemoveAll(outside)
+
+	rootfd, err := unix.Open(root, unix.O_PATH|unix.O_DIRECTORY, 0)
+	if err != nil {
+		t.Fatalf("failed to open %s: %s", root, err)
+	}
+	defer unix.Close(rootfd)
+
+	tests := []struct {
+		name     string
+		path     string
+		want     string
+		wantLink string
+		wantErr  error
+	}{
+		{name: "Root", path: "", want: root},
+		{name: "Directory", path: "a/b", want: filepath.Join(root, "a", "b")},
+		{name: "InRootSymlink", path: "a/in", want: filepath.Join(root, "a", "b")},
+		{name: "InRootDotDot", path: "a/up/../..", want: root},
+		{name: "DotDot", path: "..", wantErr: syscall.EXDEV},
+		{name: "Loop", path: "a/loop", wantErr: syscall.ELOOP},
+		{name: "AbsoluteInRootSymlink", path: "a/absin", want: filepath.Join(root, "a", "b")},
+		{name: "AbsoluteInRootDotDot", path: "a/absin/../..", want: root},
+		{name: "AbsoluteSymlink", path: "abs", wantErr: syscall.ENOENT},
+		{name: "RelativeSymlink", path: "a/rel", wantLink: "/a/rel"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fd, err := walkBeneath(rootfd, tt.path)
+			switch {
+			case tt.wantLink != "":
+				var linkErr *SymlinkEscapeError
+				if !errors.As(err, &linkErr) {
+					t.Fatalf("got error %v, want symbolic link escape error", err)
+				}
+				if linkErr.Path != tt.wantLink {
+					t.Errorf("got symbolic link %s, want %s", linkErr.Path, tt.wantLink)
+				}
+				return
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %s", err, tt.wantErr)
+				}
+				return
+			case err != nil:
+				t.Fatalf("unexpected error: %s", err)
+			}
+			defer unix.Close(fd)
+
+			target, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", fd))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if target != tt.want {
+				t.Errorf("got %s, want %s", target, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package specialfiles finds the setuid, setgid and world-writable files
+// of container images.
+package specialfiles
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sylabs/singularity/pkg/inspect"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// ScanDir returns the special files of the root filesystem in the
+// directory root. Setuid and setgid bits are only reported for regular
+// files, and world-writable directories with the sticky bit set, like
+// /tmp, are not reported. Directories which can't be read are skipped.
+func ScanDir(root string) (*inspect.SpecialFiles, error) {
+	if _, err := os.Lstat(root); err != nil {
+		return nil, err
+	}
+
+	files := new(inspect.SpecialFiles)
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			sylog.Debugf("Skipping %s: %s", path, err)
+			if fi != nil && fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		add(files, filepath.Join("/", rel), fi.Mode())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func add(files *inspect.SpecialFiles, path string, mode os.FileMode) {
+	regular := mode.IsRegular()
+	worldWritable := mode.Perm()&0002 != 0 && (regular || mode.IsDir() && mode&os.ModeSticky == 0)
+	files.Add(path, regular && mode&os.ModeSetuid != 0, regular && mode&os.ModeSetgid != 0, worldWritable)
+}
+
+// listingRegexp matches the lines of the long listing of a squashfs
+// filesystem, like:
+//
+// -rwsr-xr-x root/root 63960 2020-02-07 14:05 squashfs-root/usr/bin/passwd
+// crw-rw-rw- root/root 1,  3 2020-02-07 14:05 squashfs-root/dev/null
+var listingRegexp = regexp.MustCompile(`^([-a-zA-Z]{10})\s.*?\s\d{4}-\d{2}-\d{2} \d{2}:\d{2} squashfs-root(.*)$`)
+
+// ParseSquashfsListing returns the special files listed by the output of
+// unsquashfs -lls read from r, with the same rules as ScanDir.
+func ParseSquashfsListing(r io.Reader) (*inspect.SpecialFiles, error) {
+	files := new(inspect.SpecialFiles)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		m := listingRegexp.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		perms, path := m[1], m[2]
+		if path == "" {
+			path = "/"
+		}
+
+		var mode os.FileMode
+		switch perms[0] {
+		case '-':
+		case 'd':
+			mode |= os.ModeDir
+		default:
+			// symbolic links, devices, fifos and sockets are not
+			// reported, the target of symbolic links is listed
+			// as part of the path
+			continue
+		}
+		for i, c := range perms[1:] {
+			if c != '-' && c != 'S' && c != 'T' {
+				mode |= 1 << uint(8-i)
+			}
+		}
+		if perms[3] == 's' || perms[3] == 'S' {
+			mode |= os.ModeSetuid
+		}
+		if perms[6] == 's' || perms[6] == 'S' {
+			mode |= os.ModeSetgid
+		}
+		if perms[9] == 't' || perms[9] == 'T' {
+			mode |= os.ModeSticky
+		}
+		add(files, path, mode)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("while reading squashfs listing: %s", err)
+	}
+	return files, nil
+}
+
+// ScanSquashfs returns the special files of the squashfs filesystem of
+// size bytes at offset in the file path, read from its listing, so the
+// filesystem is neither extracted nor mounted. Versions of unsquashfs
+// which can't read a filesystem at an offset get a copy of it.
+func ScanSquashfs(unsquashfs, path string, offset, size uint64) (*inspect.SpecialFiles, error) {
+	if offset == 0 {
+		return listSquashfs(unsquashfs, path)
+	}
+
+	files, err := listSquashfs(unsquashfs, "-o", strconv.FormatUint(offset, 10), path)
+	if err == nil || !strings.Contains(err.Error(), "SYNTAX") {
+		return files, err
+	}
+	sylog.Debugf("unsquashfs does not support -o, copying the squashfs filesystem of %s", path)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tmp, err := ioutil.TempFile("", "squashfs-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging file: %s", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, io.NewSectionReader(f, int64(offset), int64(size))); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to copy content in staging file: %s", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close staging file: %s", err)
+	}
+	return listSquashfs(unsquashfs, tmp.Name())
+}
+
+func listSquashfs(unsquashfs string, args ...string) (*inspect.SpecialFiles, error) {
+	var stderr bytes.Buffer
+
+	cmd := exec.Command(unsquashfs, append([]string{"-lls"}, args...)...)
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("list command failed: %s", err)
+	}
+
+	files, perr := ParseSquashfsListing(stdout)
+	if perr != nil {
+		// drain the listing so unsquashfs can exit
+		io.Copy(ioutil.Discard, stdout)
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("list command failed: %s: %s", stderr.String(), err)
+	}
+	return files, perr
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package specialfiles
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/sylabs/singularity/pkg/inspect"
+)
+
+const listing = `Parallel unsquashfs: Using 8 processors
+6 inodes (5 blocks) to write
+
+drwxr-xr-x root/root                96 2020-02-07 14:05 squashfs-root
+drwxr-xr-x root/root                62 2020-02-07 14:05 squashfs-root/bin
+-rwsr-xr-x root/root             63960 2020-02-07 14:05 squashfs-root/bin/passwd
+-rwxr-sr-x root/shadow           31000 2020-02-07 14:05 squashfs-root/bin/chage
+-rwSr-Sr-- root/root                 0 2020-02-07 14:05 squashfs-root/bin/no exec
+lrwxrwxrwx root/root                 6 2020-02-07 14:05 squashfs-root/bin/su -> passwd
+drwxr-xr-x root/root                29 2020-02-07 14:05 squashfs-root/dev
+crw-rw-rw- root/root           1,  3 2020-02-07 14:05 squashfs-root/dev/null
+drwxrwsr-x root/staff                3 2020-02-07 14:05 squashfs-root/srv
+-rw-rw-rw- root/root                 0 2020-02-07 14:05 squashfs-root/srv/data 2020-02-07 14:05 squashfs-root
+drwxrwxrwt root/root                 3 2020-02-07 14:05 squashfs-root/tmp
+drwxrwxrwx root/root                 3 2020-02-07 14:05 squashfs-root/var
+`
+
+func TestParseSquashfsListing(t *testing.T) {
+	got, err := ParseSquashfsListing(strings.NewReader(listing))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := &inspect.SpecialFiles{
+		SetuidCount:        2,
+		Setuid:             []string{"/bin/passwd", "/bin/no exec"},
+		SetgidCount:        2,
+		Setgid:             []string{"/bin/chage", "/bin/no exec"},
+		WorldWritableCount: 2,
+		WorldWritable:      []string{"/srv/data 2020-02-07 14:05 squashfs-root", "/var"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestScanDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "specialfiles-")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the umask would clear the world-writable bits
+	defer syscall.Umask(syscall.Umask(0))
+
+	for _, f := range []struct {
+		path string
+		mode os.FileMode
+	}{
+		{"bin/passwd", 0755 | os.ModeSetuid},
+		{"bin/chage", 0755 | os.ModeSetgid},
+		{"srv/data", 0666},
+	} {
+		path := filepath.Join(dir, f.path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := os.Chmod(path, f.mode); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "tmp"), 0777|os.ModeSticky); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.Chmod(filepath.Join(dir, "tmp"), 0777|os.ModeSticky); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "var"), 0777); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.Symlink("passwd", filepath.Join(dir, "bin", "su")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got, err := ScanDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := &inspect.SpecialFiles{
+		SetuidCount:        1,
+		Setuid:             []string{"/bin/passwd"},
+		SetgidCount:        1,
+		Setgid:             []string{"/bin/chage"},
+		WorldWritableCount: 2,
+		WorldWritable:      []string{"/srv/data", "/var"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if _, err := ScanDir(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("unexpected success with a missing directory")
+	}
+}
+
+func TestSpecialFilesLimit(t *testing.T) {
+	files := new(inspect.SpecialFiles)
+	for i := 0; i < inspect.MaxSpecialFilePaths+10; i++ {
+		files.Add(fmt.Sprintf("/bin/%d", i), true, false, false)
+	}
+	if files.SetuidCount != inspect.MaxSpecialFilePaths+10 {
+		t.Errorf("got %d setuid files, want %d", files.SetuidCount, inspect.MaxSpecialFilePaths+10)
+	}
+	if len(files.Setuid) != inspect.MaxSpecialFilePaths {
+		t.Errorf("got %d setuid paths, want %d", len(files.Setuid), inspect.MaxSpecialFilePaths)
+	}
+}
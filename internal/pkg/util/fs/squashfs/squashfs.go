@@ -9,12 +9,20 @@ import (
 	"fmt"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/sylabs/singularity/internal/pkg/buildcfg"
 	"github.com/sylabs/singularity/pkg/util/singularityconf"
 )
 
+const (
+	// MinBlockSize is the smallest block size supported by mksquashfs.
+	MinBlockSize = 4 << 10
+	// MaxBlockSize is the largest block size supported by mksquashfs.
+	MaxBlockSize = 1 << 20
+)
+
 func getConfig() (*singularityconf.File, error) {
 	// if the caller has set the current config use it
 	// otherwise parse the default configuration file
@@ -73,3 +81,29 @@ func GetMem() (string, error) {
 
 	return mem, err
 }
+
+// ParseBlockSize parses a squashfs block size in bytes, or in kilobytes or
+// megabytes with a K or M suffix (e.g. 64K), and checks it's a power of two
+// supported by mksquashfs.
+func ParseBlockSize(s string) (uint32, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	unit := uint64(1)
+	switch {
+	case strings.HasSuffix(v, "K"):
+		unit = 1 << 10
+	case strings.HasSuffix(v, "M"):
+		unit = 1 << 20
+	}
+	if unit != 1 {
+		v = v[:len(v)-1]
+	}
+	n, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid block size %q: must be a number of bytes, optionally followed by K or M", s)
+	}
+	size := n * unit
+	if size < MinBlockSize || size > MaxBlockSize || size&(size-1) != 0 {
+		return 0, fmt.Errorf("invalid block size %q: must be a power of two from 4K to 1M", s)
+	}
+	return uint32(size), nil
+}
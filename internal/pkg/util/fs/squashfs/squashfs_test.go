@@ -0,0 +1,47 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package squashfs
+
+import (
+	"testing"
+)
+
+func TestParseBlockSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		size    uint32
+		wantErr bool
+	}{
+		{value: "4096", size: 4096},
+		{value: "64K", size: 64 << 10},
+		{value: "128k", size: 128 << 10},
+		{value: "1M", size: 1 << 20},
+		{value: "1048576", size: 1 << 20},
+		{value: "2K", wantErr: true},
+		{value: "2M", wantErr: true},
+		{value: "100K", wantErr: true},
+		{value: "0", wantErr: true},
+		{value: "-4K", wantErr: true},
+		{value: "K", wantErr: true},
+		{value: "64KB", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		size, err := ParseBlockSize(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: unexpected success, got %d", tt.value, size)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", tt.value, err)
+		} else if size != tt.size {
+			t.Errorf("%q: got %d, want %d", tt.value, size, tt.size)
+		}
+	}
+}
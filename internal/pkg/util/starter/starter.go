@@ -6,6 +6,7 @@
 package starter
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -50,6 +51,15 @@ func WithStdin(stdin io.Reader) CommandOp {
 	}
 }
 
+// WithContext allows to pass a context to starter command, the
+// starter process is killed if the context is done before it
+// finished its execution. Context is ignored for Exec.
+func WithContext(ctx context.Context) CommandOp {
+	return func(c *Command) {
+		c.ctx = ctx
+	}
+}
+
 // UseSuid sets if the starter command uses either the setuid
 // binary or the unprivileged binary. The unprivileged binary
 // is used by default if this operation is not passed to Run/Exec.
@@ -80,6 +90,7 @@ type Command struct {
 	stdin  io.Reader
 	stdout io.Writer
 	stderr io.Writer
+	ctx    context.Context
 }
 
 // Exec executes the starter binary in place of the caller if
@@ -101,7 +112,12 @@ func Run(name string, config *config.Common, ops ...CommandOp) error {
 		return fmt.Errorf("while initializing starter command: %s", err)
 	}
 
-	cmd := exec.Command(c.path)
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	cmd := exec.CommandContext(ctx, c.path)
 	cmd.Args = []string{name}
 	cmd.Env = c.env
 	cmd.Stdin = c.stdin
@@ -109,7 +125,7 @@ func Run(name string, config *config.Common, ops ...CommandOp) error {
 	cmd.Stderr = c.stderr
 
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("while running %s: %s", c.path, err)
+		return fmt.Errorf("while running %s: %w", c.path, err)
 	}
 	return nil
 }
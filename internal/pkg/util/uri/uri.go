@@ -7,6 +7,8 @@ package uri
 
 import (
 	"fmt"
+	"net/url"
+	"path"
 	"strings"
 )
 
@@ -21,6 +23,12 @@ const (
 	HTTPS = "https"
 	// Oras is the keyword for an oras ref
 	Oras = "oras"
+	// File is the keyword for a local file ref
+	File = "file"
+	// S3 is the keyword for an Amazon S3 object storage ref
+	S3 = "s3"
+	// GS is the keyword for a Google Cloud Storage ref
+	GS = "gs"
 )
 
 // validURIs contains a list of known uris
@@ -35,6 +43,9 @@ var validURIs = map[string]bool{
 	"http":           true,
 	"https":          true,
 	"oras":           true,
+	"s3":             true,
+	"gs":             true,
+	"file":           true,
 }
 
 // IsValid returns whether or not the given source is valid
@@ -53,8 +64,96 @@ func IsValid(source string) (valid bool, err error) {
 	return false, fmt.Errorf("invalid uri %s", source)
 }
 
-// GetName turns a transport:ref URI into a name containing the top-level identifier
-// of the image. For example, docker://godlovedc/lolcow returns lolcow
+// defaultPrefixes holds, for each registry transport, the default registry
+// and namespace prefixes omitted from the image file name.
+var defaultPrefixes = map[string][]string{
+	"docker":        {"docker.io/", "index.docker.io/", "registry-1.docker.io/", "library/"},
+	"docker-daemon": {"docker.io/", "library/"},
+	Library:         {"library/default/"},
+	Shub:            {"singularity-hub.org/"},
+}
+
+// archiveTransports holds the transports referring to a local archive or
+// directory instead of an image in a registry.
+var archiveTransports = map[string]bool{
+	"docker-archive": true,
+	"oci-archive":    true,
+	"oci":            true,
+}
+
+// imageRef holds the parts of a transport:ref URI used to name the image.
+type imageRef struct {
+	transport string
+	path      string
+	tag       string
+	digest    string
+}
+
+// parseImageRef splits the ref of a registry transport into the repository
+// path, without the default registry and namespace of the transport, its tag,
+// "latest" by default, and its digest.
+func parseImageRef(transport, ref string) imageRef {
+	r := imageRef{transport: transport}
+
+	ref = strings.TrimLeft(ref, "/")
+	if i := strings.Index(ref, "@"); i >= 0 {
+		r.digest = ref[i+1:]
+		ref = ref[:i]
+	}
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		r.tag = ref[i+1:]
+		ref = ref[:i]
+		// library refs may hold several tags separated by commas
+		r.tag = strings.Split(r.tag, ",")[0]
+	}
+	if r.tag == "" && r.digest == "" {
+		r.tag = "latest"
+	}
+
+	for _, prefix := range defaultPrefixes[transport] {
+		if strings.HasPrefix(ref, prefix) && len(ref) > len(prefix) {
+			ref = ref[len(prefix):]
+		}
+	}
+	r.path = ref
+
+	return r
+}
+
+// sanitizeName replaces the characters other than letters, digits, ".",
+// "_" and "-" by "_" in name.
+func sanitizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == '.', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// GetName turns a transport:ref URI into the file name of the pulled image.
+// For images in a registry, the name is made of the registry and repository
+// path, the tag and the digest of the image joined by "_", with the ".sif"
+// extension, where:
+//   - the default registry and namespace of the transport are omitted, like
+//     docker.io and library/ for docker, or library/default/ for library
+//   - the tag is latest when there is neither a tag nor a digest, only the
+//     first tag is used when the ref holds a comma separated list of tags
+//   - the characters other than letters, digits, ".", "_" and "-" are
+//     replaced by "_", the case is preserved
+//
+// For example, docker://godlovedc/lolcow returns godlovedc_lolcow_latest.sif
+// and docker://quay.io/user/image:1.0@sha256:<hex> returns
+// quay.io_user_image_1.0_sha256_<hex>.sif.
+//
+// For docker-archive, oci-archive and oci, the name is the base name of the
+// archive or directory, without the .tar, .tar.gz or .tgz extension, followed
+// by the reference in the archive, latest by default. For http and https, the
+// name is the last element of the URL path. For file, the name is the base
+// name of the image file, and for s3 and gs the base name of the object key.
 //
 // Returns "" when not in transport:ref format
 func GetName(uri string) string {
@@ -63,28 +162,74 @@ func GetName(uri string) string {
 		return ""
 	}
 
-	ref = strings.TrimLeft(ref, "/")    // Trim leading "/" characters
-	refSplit := strings.Split(ref, "/") // Split ref into parts
-
 	if transport == HTTP || transport == HTTPS {
-		imageName := refSplit[len(refSplit)-1]
-		return imageName
+		u, err := url.Parse(uri)
+		if err != nil {
+			return ""
+		}
+		name := path.Base(u.Path)
+		if name == "/" || name == "." {
+			name = u.Host
+		}
+		return sanitizeName(name)
 	}
 
-	// Default tag is latest
-	tags := []string{"latest"}
-	container := refSplit[len(refSplit)-1]
+	if transport == S3 || transport == GS {
+		name := path.Base(ref)
+		if name == "/" || name == "." || !strings.Contains(strings.TrimPrefix(ref, "//"), "/") {
+			return ""
+		}
+		return sanitizeName(name)
+	}
 
-	if strings.Contains(container, ":") {
-		imageParts := strings.Split(container, ":")
-		container = imageParts[0]
-		tags = []string{imageParts[1]}
-		if strings.Contains(tags[0], ",") {
-			tags = strings.Split(tags[0], ",")
+	if transport == File {
+		name := path.Base(strings.Split(ref, "@")[0])
+		if name == "/" || name == "." {
+			return ""
 		}
+		return sanitizeName(name)
 	}
 
-	return fmt.Sprintf("%s_%s.sif", container, tags[0])
+	if archiveTransports[transport] {
+		parts := strings.SplitN(ref, ":", 2)
+		name := path.Base(parts[0])
+		for _, ext := range []string{".tar.gz", ".tgz", ".tar"} {
+			if strings.HasSuffix(name, ext) && len(name) > len(ext) {
+				name = strings.TrimSuffix(name, ext)
+				break
+			}
+		}
+		tag := "latest"
+		if len(parts) == 2 && parts[1] != "" {
+			tag = parts[1]
+		}
+		return sanitizeName(name+"_"+tag) + ".sif"
+	}
+
+	r := parseImageRef(transport, ref)
+	name := strings.ReplaceAll(r.path, "/", "_")
+	if r.tag != "" {
+		name += "_" + r.tag
+	}
+	if r.digest != "" {
+		name += "_" + r.digest
+	}
+	return sanitizeName(name) + ".sif"
+}
+
+// SameImage returns if the transport:ref URIs a and b refer to the same
+// image, the default registry, namespace and tag of the transport being
+// taken into account.
+func SameImage(a, b string) bool {
+	ta, ra := Split(a)
+	tb, rb := Split(b)
+	if ta != tb {
+		return false
+	}
+	if ta == HTTP || ta == HTTPS || archiveTransports[ta] {
+		return strings.TrimLeft(ra, "/") == strings.TrimLeft(rb, "/")
+	}
+	return parseImageRef(ta, ra) == parseImageRef(tb, rb)
 }
 
 // Split splits a URI into it's components which can be used directly through containers/image
@@ -0,0 +1,83 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !cgo osusergo
+
+package user
+
+import (
+	osuser "os/user"
+	"strconv"
+	"syscall"
+)
+
+// Without cgo (e.g. client binaries cross-compiled for darwin) the lookups
+// fall back to the pure Go implementation of os/user, which doesn't provide
+// the login shell.
+
+func current() (*User, error) {
+	return lookupUnixUid(syscall.Getuid())
+}
+
+func lookupUser(username string) (*User, error) {
+	u, err := osuser.Lookup(username)
+	if err != nil {
+		return nil, err
+	}
+	return convertUser(u)
+}
+
+func lookupUnixUid(uid int) (*User, error) {
+	u, err := osuser.LookupId(strconv.Itoa(uid))
+	if err != nil {
+		return nil, err
+	}
+	return convertUser(u)
+}
+
+func lookupGroup(groupname string) (*Group, error) {
+	g, err := osuser.LookupGroup(groupname)
+	if err != nil {
+		return nil, err
+	}
+	return convertGroup(g)
+}
+
+func lookupUnixGid(gid int) (*Group, error) {
+	g, err := osuser.LookupGroupId(strconv.Itoa(gid))
+	if err != nil {
+		return nil, err
+	}
+	return convertGroup(g)
+}
+
+func convertUser(u *osuser.User) (*User, error) {
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	return &User{
+		Name:  u.Username,
+		UID:   uint32(uid),
+		GID:   uint32(gid),
+		Gecos: u.Name,
+		Dir:   u.HomeDir,
+	}, nil
+}
+
+func convertGroup(g *osuser.Group) (*Group, error) {
+	gid, err := strconv.ParseUint(g.Gid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	return &Group{
+		Name: g.Name,
+		GID:  uint32(gid),
+	}, nil
+}
@@ -12,7 +12,8 @@ cni_config_LIST := $(SOURCEDIR)/etc/network/00_bridge.conflist \
                    $(SOURCEDIR)/etc/network/10_ptp.conflist \
                    $(SOURCEDIR)/etc/network/20_ipvlan.conflist \
                    $(SOURCEDIR)/etc/network/30_macvlan.conflist \
-                   $(SOURCEDIR)/etc/network/40_fakeroot.conflist
+                   $(SOURCEDIR)/etc/network/40_fakeroot.conflist \
+                   $(SOURCEDIR)/etc/network/50_bridge6.conflist
 cni_config_INSTALL := $(DESTDIR)$(SYSCONFDIR)/singularity/network
 
 .PHONY: cniplugins
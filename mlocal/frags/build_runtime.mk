@@ -48,6 +48,16 @@ $(sessiondir_INSTALL):
 INSTALLFILES += $(sessiondir_INSTALL)
 
 
+# usagedir, shared by the usage databases of all users
+usagedir_INSTALL := $(DESTDIR)$(LOCALSTATEDIR)/singularity/usage
+$(usagedir_INSTALL):
+	@echo " INSTALL" $@
+	$(V)umask 0022 && mkdir -p $@
+	$(V)chmod 1777 $@
+
+INSTALLFILES += $(usagedir_INSTALL)
+
+
 # run-singularity script
 run_singularity := $(SOURCEDIR)/scripts/run-singularity
 
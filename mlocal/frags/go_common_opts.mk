@@ -2,6 +2,7 @@
 GO111MODULE := on
 GO_TAGS := containers_image_openpgp sylog oci_engine singularity_engine fakeroot_engine
 GO_TAGS_SUID := containers_image_openpgp sylog singularity_engine fakeroot_engine
+GO_TAGS_CLIENT := containers_image_openpgp sylog
 GO_LDFLAGS :=
 GO_BUILDMODE := -buildmode=pie
 GO_GCFLAGS := -gcflags=github.com/sylabs/singularity/...="-trimpath $(SOURCEDIR)=>github.com/sylabs/singularity@v0.0.0"
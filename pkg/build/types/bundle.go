@@ -11,13 +11,15 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	ocitypes "github.com/containers/image/v5/types"
 	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/client/bucket"
+	"github.com/sylabs/singularity/internal/pkg/remote"
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
 	"github.com/sylabs/singularity/pkg/sylog"
 	"github.com/sylabs/singularity/pkg/util/crypt"
-	"golang.org/x/sys/unix"
 )
 
 const OCIConfigJSON = "oci-config"
@@ -54,12 +56,45 @@ type Options struct {
 	ImgCache *cache.Handle
 	// NoTest indicates if build should skip running the test script.
 	NoTest bool `json:"noTest"`
+	// TestUnprivileged runs the test script as an unprivileged user
+	// instead of the user running the post script.
+	TestUnprivileged bool `json:"testUnprivileged"`
+	// ShellOptions overrides the shell options of the %pre, %setup, %post
+	// and %test sections set by the ShellOptions definition header.
+	ShellOptions string `json:"shellOptions"`
+	// OSVersion overrides the OSVersion header of the definitions
+	// bootstrapped by a distro bootstrap agent.
+	OSVersion string `json:"osVersion"`
+	// Timestamps prefixes each line written by the %pre, %setup, %post
+	// and %test sections with the time elapsed since the build started.
+	Timestamps bool `json:"timestamps"`
 	// Force automatically deletes an existing container at build destination while performing build.
 	Force bool `json:"force"`
 	// Update detects and builds using an existing sandbox container at build destination.
 	Update bool `json:"update"`
+	// UpdateBase bypasses the image cache to fetch a fresh copy of the
+	// base image the build bootstraps from.
+	UpdateBase bool `json:"updateBase"`
+	// Reproducible makes SIF builds from identical inputs bit-identical,
+	// the image timestamps are pinned to SourceDate.
+	Reproducible bool `json:"reproducible"`
+	// SourceDate is the build time recorded by reproducible builds.
+	SourceDate time.Time `json:"sourceDate"`
+	// BlockSize is the block size in bytes of the squashfs root filesystem
+	// of SIF images, the mksquashfs default when zero.
+	BlockSize uint32 `json:"blockSize"`
 	// NoHTTPS instructs builder not to use secure connection.
 	NoHTTPS bool `json:"noHTTPS"`
+	// InsecureRegistries lists the registry hosts the builder connects to
+	// without a secure connection, unlike NoHTTPS other registries still
+	// require one.
+	InsecureRegistries []string `json:"insecureRegistries"`
+	// Buckets are the settings of the s3:// and gs:// buckets base
+	// images are pulled from.
+	Buckets []bucket.Config `json:"-"`
+	// Mirrors are the mirror rules applied to the docker and oras base
+	// images.
+	Mirrors remote.Mirrors `json:"-"`
 	// NoCleanUp allows a user to prevent a bundle from being cleaned up after a failed build.
 	// useful for debugging.
 	NoCleanUp bool `json:"noCleanUp"`
@@ -72,6 +107,23 @@ type Options struct {
 	// To warn when the above is needed, we need to know if the target of this
 	// bundle will be a sandbox
 	SandboxTarget bool
+	// Progress, if set, receives the build progress events.
+	Progress ProgressFunc `json:"-"`
+	// Secrets are the files exposed to the %post section in
+	// /run/secrets, they are never recorded in the image.
+	Secrets []Secret `json:"-"`
+	// SecretsOnDisk allows staging the secrets in TmpDir when there is
+	// no tmpfs to stage them.
+	SecretsOnDisk bool `json:"-"`
+}
+
+// Secret is a host file exposed to the %post section at /run/secrets/<ID>
+// during the build, its content doesn't enter the image.
+type Secret struct {
+	// ID is the file name of the secret in /run/secrets.
+	ID string
+	// Src is the path of the host file with the secret content.
+	Src string
 }
 
 // NewEncryptedBundle creates an Encrypted Bundle environment.
@@ -123,7 +175,8 @@ func canChown(rootfs string) (bool, error) {
 
 	chownFile := filepath.Join(rootfs, ".chownTest")
 
-	f, err := os.OpenFile(chownFile, os.O_CREATE|os.O_EXCL|unix.O_NOFOLLOW, 0600)
+	// O_EXCL doesn't follow a symbolic link at chownFile
+	f, err := os.OpenFile(chownFile, os.O_CREATE|os.O_EXCL, 0600)
 	if err != nil {
 		return false, fmt.Errorf("could not create %q: %v", chownFile, err)
 	}
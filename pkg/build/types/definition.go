@@ -10,6 +10,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
 )
 
@@ -74,6 +75,9 @@ type FileTransport struct {
 type Script struct {
 	Args   string `json:"args"`
 	Script string `json:"script"`
+	// Line is the line of the definition file at which the script
+	// starts, or 0 if unknown.
+	Line int `json:"line,omitempty"`
 }
 
 // NewDefinitionFromURI crafts a new Definition given a URI.
@@ -152,8 +156,16 @@ func writeFilesIfExists(w io.Writer, f []Files) {
 
 func writeLabelsIfExists(w io.Writer, l map[string]string) {
 	if len(l) > 0 {
+		keys := make([]string, 0, len(l))
+		for k := range l {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
 		fmt.Fprintln(w, "%labels")
-		for k, v := range l {
+		for _, k := range keys {
+			// multi-line values continue with a trailing backslash
+			v := strings.Replace(l[k], "\n", " \\\n\t", -1)
 			fmt.Fprintf(w, "\t%s %s\n", k, v)
 		}
 		fmt.Fprintln(w)
@@ -282,26 +282,7 @@ func populateDefinition(sections map[string]*types.Script, files *[]types.Files,
 	}
 
 	// labels are parsed as a map[string]string
-	labelsSections := strings.TrimSpace(sections["labels"].Script)
-	subs := strings.Split(labelsSections, "\n")
-	labels := make(map[string]string)
-
-	for _, line := range subs {
-		if line = strings.TrimSpace(line); line == "" || strings.Index(line, "#") == 0 {
-			continue
-		}
-		var key, val string
-		lineSubs := strings.SplitN(line, " ", 2)
-		if len(lineSubs) < 2 {
-			key = strings.TrimSpace(lineSubs[0])
-			val = ""
-		} else {
-			key = strings.TrimSpace(lineSubs[0])
-			val = strings.TrimSpace(lineSubs[1])
-		}
-
-		labels[key] = val
-	}
+	labels := ParseLabels(sections["labels"].Script)
 
 	d.ImageData = types.ImageData{
 		ImageScripts: types.ImageScripts{
@@ -356,6 +337,45 @@ func populateDefinition(sections map[string]*types.Script, files *[]types.Files,
 	return err
 }
 
+// ParseLabels parses the content of a %labels or %applabels section, each
+// line holds a label name followed by its value. A value ending with a
+// backslash continues on the next line, lines are joined with a newline
+// to preserve multi-line values.
+func ParseLabels(section string) map[string]string {
+	labels := make(map[string]string)
+
+	var key string
+	continued := false
+
+	for _, line := range strings.Split(section, "\n") {
+		line = strings.TrimSpace(line)
+
+		if continued {
+			continued = strings.HasSuffix(line, "\\")
+			labels[key] += "\n" + strings.TrimSpace(strings.TrimSuffix(line, "\\"))
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var val string
+		lineSubs := strings.SplitN(line, " ", 2)
+		key = strings.TrimSpace(lineSubs[0])
+		if len(lineSubs) == 2 {
+			val = strings.TrimSpace(lineSubs[1])
+		}
+		if strings.HasSuffix(val, "\\") {
+			continued = true
+			val = strings.TrimSpace(strings.TrimSuffix(val, "\\"))
+		}
+
+		labels[key] = val
+	}
+
+	return labels
+}
+
 func doHeader(h string, d *types.Definition) error {
 	h = strings.TrimSpace(h)
 	toks := strings.Split(h, "\n")
@@ -420,6 +440,12 @@ func doHeader(h string, d *types.Definition) error {
 // and parse it into a Definition struct or return error if
 // the definition file has a bad section.
 func ParseDefinitionFile(r io.Reader) (d types.Definition, err error) {
+	return parseDefinitionFile(r, 1)
+}
+
+// parseDefinitionFile is ParseDefinitionFile for a definition starting at
+// line firstLine of the definition file.
+func parseDefinitionFile(r io.Reader, firstLine int) (d types.Definition, err error) {
 	d.Raw, err = ioutil.ReadAll(r)
 	if err != nil {
 		return d, fmt.Errorf("while attempting to read in definition: %v", err)
@@ -443,9 +469,39 @@ func ParseDefinitionFile(r io.Reader) (d types.Definition, err error) {
 		return d, err
 	}
 
+	lines := sectionLines(d.Raw, firstLine)
+	for name, script := range map[string]*types.Script{
+		"pre":   &d.BuildData.Pre,
+		"setup": &d.BuildData.Setup,
+		"post":  &d.BuildData.Post,
+		"test":  &d.BuildData.Test,
+	} {
+		if script.Script != "" {
+			script.Line = lines[name] + 1
+		}
+	}
+	d.ImageData.Test.Line = d.BuildData.Test.Line
+
 	return
 }
 
+// sectionLines returns the line of the first header of each section found
+// in the definition data, which starts at line firstLine of the definition
+// file.
+func sectionLines(data []byte, firstLine int) map[string]int {
+	lines := make(map[string]int)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "%") {
+			continue
+		}
+		if name := getSectionName(line); lines[name] == 0 {
+			lines[name] = firstLine + i
+		}
+	}
+	return lines
+}
+
 // All receives a reader from a definition file
 // and parses it into a slice of Definition structs or returns error if
 // an error is encounter while parsing
@@ -479,12 +535,14 @@ func All(r io.Reader) ([]types.Definition, error) {
 		return nil, errEmptyDefinition
 	}
 
+	line := 1
 	for _, stage := range splitBuf {
 		if len(stage) == 0 {
 			continue
 		}
 
-		d, err := ParseDefinitionFile(bytes.NewReader(stage))
+		d, err := parseDefinitionFile(bytes.NewReader(stage), line)
+		line += bytes.Count(stage, []byte("\n"))
 		if err != nil {
 			if err == errEmptyDefinition {
 				continue
@@ -567,22 +625,24 @@ var appSections = map[string]bool{
 // validHeaders just contains a list of all the valid headers a definition file
 // could contain. If any others are found, an error will generate
 var validHeaders = map[string]bool{
-	"bootstrap":   true,
-	"from":        true,
-	"includecmd":  true,
-	"mirrorurl":   true,
-	"updateurl":   true,
-	"osversion":   true,
-	"include":     true,
-	"library":     true,
-	"registry":    true,
-	"namespace":   true,
-	"stage":       true,
-	"product":     true,
-	"user":        true,
-	"regcode":     true,
-	"productpgp":  true,
-	"registerurl": true,
-	"modules":     true,
-	"otherurl&n":  true,
+	"bootstrap":    true,
+	"buildargs":    true,
+	"from":         true,
+	"includecmd":   true,
+	"mirrorurl":    true,
+	"updateurl":    true,
+	"osversion":    true,
+	"include":      true,
+	"library":      true,
+	"registry":     true,
+	"namespace":    true,
+	"stage":        true,
+	"product":      true,
+	"user":         true,
+	"regcode":      true,
+	"productpgp":   true,
+	"registerurl":  true,
+	"shelloptions": true,
+	"modules":      true,
+	"otherurl&n":   true,
 }
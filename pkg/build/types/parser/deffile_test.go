@@ -443,3 +443,50 @@ func TestParseAll(t *testing.T) {
 		}))
 	}
 }
+
+func TestParseLabels(t *testing.T) {
+	section := `
+	# comment
+	Author John Doe
+	URL https://example.com:8443/path
+	Empty
+	Description first line \
+	second line: with colon \
+	third line
+	Last value
+	`
+	want := map[string]string{
+		"Author":      "John Doe",
+		"URL":         "https://example.com:8443/path",
+		"Empty":       "",
+		"Description": "first line\nsecond line: with colon\nthird line",
+		"Last":        "value",
+	}
+
+	labels := ParseLabels(section)
+	if !reflect.DeepEqual(labels, want) {
+		t.Fatalf("got labels %q, want %q", labels, want)
+	}
+
+	// labels must survive the conversion of a definition to its raw
+	// representation and back
+	d := types.Definition{
+		Header:    map[string]string{"bootstrap": "scratch"},
+		ImageData: types.ImageData{Labels: want},
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err = types.NewDefinitionFromJSON(strings.NewReader(string(b)))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	parsed, err := ParseDefinitionFile(strings.NewReader(string(d.Raw)))
+	if err != nil {
+		t.Fatalf("failed to parse definition:\n%s\n%s", d.Raw, err)
+	}
+	if !reflect.DeepEqual(parsed.Labels, want) {
+		t.Errorf("got labels %q after round-trip, want %q", parsed.Labels, want)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package types
+
+import "sync"
+
+// ProgressEventType is the type of a build progress event.
+type ProgressEventType int
+
+const (
+	// PhaseEvent is reported when a build phase starts.
+	PhaseEvent ProgressEventType = iota
+	// OutputEvent is reported for each line written by a %pre, %setup,
+	// %post or %test section.
+	OutputEvent
+	// AssembleEvent is reported when a step of the image assembly starts.
+	AssembleEvent
+)
+
+// Build phases reported by PhaseEvent events, in the order they are run
+// for each stage. Sections which are not part of the definition, or not
+// selected, are not reported.
+const (
+	PhasePre       = "pre"
+	PhaseBootstrap = "bootstrap"
+	PhaseSetup     = "setup"
+	PhaseFiles     = "files"
+	PhasePost      = "post"
+	PhaseTest      = "test"
+	// PhaseAssemble is reported once for the last stage.
+	PhaseAssemble = "assemble"
+	// PhaseComplete is reported once the image is written.
+	PhaseComplete = "complete"
+)
+
+// Image assembly steps reported by AssembleEvent events.
+const (
+	AssembleSquashfs = "squashfs"
+	AssembleEncrypt  = "encrypt"
+	AssembleSIF      = "sif"
+	AssembleSandbox  = "sandbox"
+)
+
+// ProgressEvent describes the progress of a build.
+type ProgressEvent struct {
+	Type ProgressEventType
+	// Stage is the name of the build stage, empty for single stage
+	// builds, AssembleEvent events and the PhaseComplete phase.
+	Stage string
+	// Phase is the build phase the event belongs to.
+	Phase string
+	// Line is the section output line, without the trailing newline,
+	// for OutputEvent events.
+	Line string
+	// Stderr is set when Line was written to the standard error.
+	Stderr bool
+	// Step is the assembly step for AssembleEvent events.
+	Step string
+}
+
+// ProgressFunc receives build progress events. Events are delivered in
+// order from a dedicated goroutine, so a slow callback doesn't block the
+// build.
+type ProgressFunc func(ProgressEvent)
+
+// ReportProgress reports a progress event to the bundle progress
+// callback, if any.
+func (b *Bundle) ReportProgress(e ProgressEvent) {
+	if b.Opts.Progress != nil {
+		b.Opts.Progress(e)
+	}
+}
+
+// ProgressDispatcher queues build progress events and delivers them in
+// order to a ProgressFunc from a dedicated goroutine, Emit never blocks
+// the build. It's used as the ProgressFunc of the build bundles.
+type ProgressDispatcher struct {
+	mu      sync.Mutex
+	fn      ProgressFunc
+	cond    *sync.Cond
+	queue   []ProgressEvent
+	started bool
+	closed  bool
+	done    chan struct{}
+}
+
+// NewProgressDispatcher returns a dispatcher delivering the events to fn.
+func NewProgressDispatcher(fn ProgressFunc) *ProgressDispatcher {
+	d := &ProgressDispatcher{
+		fn:   fn,
+		done: make(chan struct{}),
+	}
+	d.cond = sync.NewCond(&d.mu)
+	return d
+}
+
+// Emit queues the event e, events emitted after Close are dropped.
+func (d *ProgressDispatcher) Emit(e ProgressEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return
+	}
+	d.queue = append(d.queue, e)
+	if !d.started {
+		d.started = true
+		go d.run()
+	}
+	d.cond.Signal()
+}
+
+func (d *ProgressDispatcher) run() {
+	defer close(d.done)
+
+	for {
+		d.mu.Lock()
+		for len(d.queue) == 0 && !d.closed {
+			d.cond.Wait()
+		}
+		events := d.queue
+		d.queue = nil
+		closed := d.closed
+		d.mu.Unlock()
+
+		for _, e := range events {
+			d.fn(e)
+		}
+		if closed && len(events) == 0 {
+			return
+		}
+	}
+}
+
+// Close waits until all queued events have been delivered.
+func (d *ProgressDispatcher) Close() {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	d.closed = true
+	started := d.started
+	d.cond.Signal()
+	d.mu.Unlock()
+
+	if started {
+		<-d.done
+	}
+}
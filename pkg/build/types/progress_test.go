@@ -0,0 +1,73 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package types
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a progress callback recording the events received.
+type recorder struct {
+	sync.Mutex
+	events []ProgressEvent
+}
+
+func (r *recorder) record(e ProgressEvent) {
+	r.Lock()
+	defer r.Unlock()
+	r.events = append(r.events, e)
+}
+
+func TestProgressDispatcher(t *testing.T) {
+	var r recorder
+
+	release := make(chan struct{})
+	d := NewProgressDispatcher(func(e ProgressEvent) {
+		<-release
+		r.record(e)
+	})
+
+	// emit must not block even if the callback does
+	emitted := make(chan struct{})
+	go func() {
+		for _, phase := range []string{PhasePre, PhaseBootstrap, PhasePost} {
+			d.Emit(ProgressEvent{Type: PhaseEvent, Phase: phase})
+		}
+		close(emitted)
+	}()
+	select {
+	case <-emitted:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("emit blocked by the progress callback")
+	}
+
+	close(release)
+	d.Close()
+
+	// events emitted after close are dropped
+	d.Emit(ProgressEvent{Type: PhaseEvent, Phase: PhaseTest})
+
+	var phases []string
+	for _, e := range r.events {
+		phases = append(phases, e.Phase)
+	}
+	want := []string{PhasePre, PhaseBootstrap, PhasePost}
+	if !reflect.DeepEqual(phases, want) {
+		t.Errorf("got phases %v, want %v", phases, want)
+	}
+}
+
+func TestProgressDispatcherUnused(t *testing.T) {
+	d := NewProgressDispatcher(func(ProgressEvent) {})
+	d.Close()
+	d.Close()
+
+	var nilDispatcher *ProgressDispatcher
+	nilDispatcher.Close()
+}
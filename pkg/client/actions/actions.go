@@ -0,0 +1,110 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package actions
+
+import (
+	"io"
+	"time"
+)
+
+// ImageRef references the container to run: the path of a local image
+// file or sandbox directory, or instance://<name> to join a running
+// instance of the current user.
+type ImageRef string
+
+// Namespaces lists the namespaces requested for the container, the mount
+// namespace is always created.
+type Namespaces struct {
+	// User requests a user namespace, like --userns
+	User bool
+	// PID requests a PID namespace, like --pid
+	PID bool
+	// IPC requests an IPC namespace, like --ipc
+	IPC bool
+	// Net requests a network namespace with only a loopback interface,
+	// like --net --network none
+	Net bool
+	// UTS requests a UTS namespace, like --uts
+	UTS bool
+}
+
+// Options sets how the container is run, each field mirrors the action
+// flag with the same name and the zero value is the flag default.
+type Options struct {
+	// Binds are bind path specifications src[:dest[:opts]], like --bind
+	Binds []string
+	// Overlay are overlay images or directories, like --overlay
+	Overlay []string
+	// Env are environment variables set in the container, like --env
+	Env map[string]string
+	// CleanEnv doesn't pass the host environment, like --cleanenv
+	CleanEnv bool
+	// Contain uses minimal /dev and empty directories, like --contain
+	Contain bool
+	// NoHome doesn't mount the home directory, like --no-home
+	NoHome bool
+	// Home is a home directory specification src[:dest], like --home
+	Home string
+	// Workdir is the working directory for /tmp, /var/tmp and home with
+	// Contain, like --workdir
+	Workdir string
+	// Pwd is the initial working directory in the container, like --pwd
+	Pwd string
+	// App is the SCIF application to run, like --app
+	App string
+	// Writable mounts the container writable, like --writable
+	Writable bool
+	// WritableTmpfs uses a temporary writable overlay, like
+	// --writable-tmpfs
+	WritableTmpfs bool
+	// KeepPrivs keeps all the privileges of root, like --keep-privs
+	KeepPrivs bool
+	// DropCaps is a comma separated list of capabilities to drop, like
+	// --drop-caps
+	DropCaps string
+	// Fakeroot runs the container as root in a user namespace, like
+	// --fakeroot
+	Fakeroot bool
+	// Namespaces are the namespaces requested for the container
+	Namespaces Namespaces
+	// Rlimits are resource limits name=soft[:hard] of the container
+	// process, like --rlimit
+	Rlimits []string
+	// SanitizePath resets PATH to the default container PATH when set to
+	// true, like --sanitize-path, or keeps it when set to false. The
+	// default set in singularity.conf applies if nil
+	SanitizePath *bool
+
+	// Stdin is the container standard input, there is no input if nil
+	Stdin io.Reader
+	// Stdout streams the container standard output, it is captured in
+	// Result.Stdout if nil
+	Stdout io.Writer
+	// Stderr streams the container standard error, it is captured in
+	// Result.Stderr if nil
+	Stderr io.Writer
+}
+
+// Result is the result of a container execution.
+type Result struct {
+	// ExitCode is the exit code of the container process, or of the
+	// runtime if the container couldn't be started
+	ExitCode int
+	// Stdout is the standard output captured if Options.Stdout is nil
+	Stdout []byte
+	// Stderr is the standard error captured if Options.Stderr is nil,
+	// it holds the runtime errors
+	Stderr []byte
+	// Started is the time the runtime was started
+	Started time.Time
+	// Finished is the time the container process exited
+	Finished time.Time
+}
+
+// Duration returns the time the execution took.
+func (r *Result) Duration() time.Duration {
+	return r.Finished.Sub(r.Started)
+}
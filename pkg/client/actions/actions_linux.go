@@ -0,0 +1,263 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package actions
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/instance"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engine/config/oci"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engine/config/oci/generate"
+	runtimeLauncher "github.com/sylabs/singularity/internal/pkg/runtime/launcher"
+	"github.com/sylabs/singularity/internal/pkg/util/env"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/internal/pkg/util/starter"
+	"github.com/sylabs/singularity/internal/pkg/util/user"
+	"github.com/sylabs/singularity/pkg/runtime/engine/config"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engine/singularity/config"
+	"github.com/sylabs/singularity/pkg/util/namespaces"
+	"github.com/sylabs/singularity/pkg/util/singularityconf"
+)
+
+// procName is the name of the runtime process, as set by the CLI.
+const procName = "Singularity runtime parent"
+
+// Exec runs command in the container image like 'singularity exec' and
+// returns once it exited. The returned error reports a failure to start the
+// runtime or the cancellation of ctx, which kills the container, an exit
+// code different from zero is not an error.
+func Exec(ctx context.Context, image ImageRef, command []string, opts Options) (*Result, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("no command to execute in %s", image)
+	}
+	return execute(ctx, image, append([]string{"/.singularity.d/actions/exec"}, command...), opts)
+}
+
+// Run runs the runscript of the container image with args like
+// 'singularity run', see Exec.
+func Run(ctx context.Context, image ImageRef, args []string, opts Options) (*Result, error) {
+	return execute(ctx, image, append([]string{"/.singularity.d/actions/run"}, args...), opts)
+}
+
+// execute runs the action script with args in the container image and
+// waits for the runtime to exit.
+func execute(ctx context.Context, image ImageRef, args []string, opts Options) (*Result, error) {
+	l, err := newLauncher(image, args, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	res := new(Result)
+	var stdout, stderr bytes.Buffer
+
+	stdoutWriter := opts.Stdout
+	if stdoutWriter == nil {
+		stdoutWriter = &stdout
+	}
+	stderrWriter := opts.Stderr
+	if stderrWriter == nil {
+		stderrWriter = &stderr
+	}
+	stdin := opts.Stdin
+	if stdin == nil {
+		stdin = bytes.NewReader(nil)
+	}
+
+	res.Started = time.Now()
+	err = starter.Run(
+		procName,
+		l.cfg,
+		starter.UseSuid(l.useSuid),
+		starter.LoadOverlayModule(l.loadOverlay),
+		starter.WithContext(ctx),
+		starter.WithStdin(stdin),
+		starter.WithStdout(stdoutWriter),
+		starter.WithStderr(stderrWriter),
+	)
+	res.Finished = time.Now()
+	res.Stdout = stdout.Bytes()
+	res.Stderr = stderr.Bytes()
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return res, ctxErr
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		res.ExitCode = exitErr.ExitCode()
+		return res, nil
+	}
+	return res, err
+}
+
+// launcher holds the runtime configuration of a container execution.
+type launcher struct {
+	cfg         *config.Common
+	useSuid     bool
+	loadOverlay bool
+}
+
+// newLauncher returns the runtime configuration to run the action script
+// with args in the container image, it's set like the CLI sets it for the
+// same flags.
+func newLauncher(image ImageRef, args []string, opts Options) (*launcher, error) {
+	fileConfig := singularityconf.GetCurrentConfig()
+	if fileConfig == nil {
+		var err error
+		fileConfig, err = singularityconf.Parse(buildcfg.SINGULARITY_CONF_FILE)
+		if err != nil {
+			return nil, fmt.Errorf("while parsing configuration file %s: %s", buildcfg.SINGULARITY_CONF_FILE, err)
+		}
+	}
+
+	engineConfig := singularityConfig.NewConfig()
+	engineConfig.File = fileConfig
+
+	ociConfig := &oci.Config{}
+	generator := generate.New(&ociConfig.Spec)
+	engineConfig.OciConfig = ociConfig
+	generator.SetProcessArgs(args)
+
+	// the umask can't be read without being set
+	currMask := syscall.Umask(0022)
+	syscall.Umask(currMask)
+	engineConfig.SetUmask(currMask)
+	engineConfig.SetRestoreUmask(true)
+
+	uid := uint32(os.Getuid())
+	gid := uint32(os.Getgid())
+	isPrivileged := uid == 0
+	insideUserNs, _ := namespaces.IsInsideUserNamespace(os.Getpid())
+	ns := opts.Namespaces
+
+	var imagePath string
+	if strings.HasPrefix(string(image), "instance://") {
+		file, err := instance.Get(instance.ExtractName(string(image)), instance.SingSubDir)
+		if err != nil {
+			return nil, err
+		}
+		ns.User = file.UserNs
+		imagePath = file.Image
+		engineConfig.SetImage(string(image))
+		engineConfig.SetInstanceJoin(true)
+	} else {
+		abspath, err := filepath.Abs(string(image))
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine image absolute path for %s: %s", image, err)
+		}
+		if _, err := os.Stat(abspath); err != nil {
+			return nil, fmt.Errorf("image %s: %w", image, err)
+		}
+		imagePath = abspath
+		engineConfig.SetImage(abspath)
+	}
+	generator.AddProcessEnv("SINGULARITY_CONTAINER", imagePath)
+	generator.AddProcessEnv("SINGULARITY_NAME", filepath.Base(imagePath))
+
+	if opts.KeepPrivs {
+		if !isPrivileged {
+			return nil, fmt.Errorf("keeping privileges requires root privileges")
+		}
+		engineConfig.SetKeepPrivs(true)
+	}
+
+	binds, err := singularityConfig.ParseBindPath(strings.Join(opts.Binds, ","))
+	if err != nil {
+		return nil, fmt.Errorf("while parsing bind path: %s", err)
+	}
+	binds, err = singularityConfig.ExpandBindPaths(binds, engineConfig.File.MaxBindGlobMatches)
+	if err != nil {
+		return nil, fmt.Errorf("while expanding bind path: %s", err)
+	}
+	engineConfig.SetBindPath(binds)
+	engineConfig.SetOverlayImage(opts.Overlay)
+	engineConfig.SetWritableImage(opts.Writable)
+	engineConfig.SetWritableTmpfs(opts.WritableTmpfs && !opts.Writable)
+	engineConfig.SetNoHome(opts.NoHome)
+	engineConfig.SetContain(opts.Contain)
+	engineConfig.SetWorkdir(opts.Workdir)
+	engineConfig.SetDropCaps(opts.DropCaps)
+	engineConfig.SetFakeroot(opts.Fakeroot)
+	if ns.Net {
+		engineConfig.SetNetwork("none")
+	}
+
+	home, err := homeSpec(opts)
+	if err != nil {
+		return nil, err
+	}
+	wf, err := runtimeLauncher.Configure(engineConfig, generator, runtimeLauncher.Options{
+		UID:          uid,
+		GID:          gid,
+		Namespaces:   runtimeLauncher.Namespaces(ns),
+		Fakeroot:     opts.Fakeroot,
+		Home:         home,
+		Pwd:          opts.Pwd,
+		App:          opts.App,
+		SanitizePath: opts.SanitizePath,
+		Rlimits:      opts.Rlimits,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if opts.Home != "" {
+		engineConfig.SetCustomHome(true)
+	}
+
+	// the variables set with Env are passed like the --env variables
+	hostEnv := os.Environ()
+	keys := make([]string, 0, len(opts.Env))
+	for k := range opts.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		hostEnv = append(hostEnv, env.SingularityEnvPrefix+k+"="+opts.Env[k])
+	}
+	singularityEnv := env.SetContainerEnv(generator, hostEnv, opts.CleanEnv, engineConfig.GetHomeDest())
+	engineConfig.SetSingularityEnv(singularityEnv)
+
+	// the CLI extracts SIF images to a temporary sandbox
+	if (wf.UserNamespace || insideUserNs) && fs.IsFile(engineConfig.GetImage()) {
+		return nil, fmt.Errorf("image %s can't be run in a user namespace, use a sandbox directory", image)
+	}
+
+	return &launcher{
+		cfg: &config.Common{
+			EngineName:   singularityConfig.Name,
+			EngineConfig: engineConfig,
+		},
+		useSuid:     wf.UseSuid,
+		loadOverlay: wf.LoadOverlay,
+	}, nil
+}
+
+// homeSpec returns the home directory specification from Options.Home, by
+// default the home directory of the current user is mounted at the same
+// location, or at /root with fakeroot.
+func homeSpec(opts Options) (string, error) {
+	if opts.Home != "" {
+		return opts.Home, nil
+	}
+	pw, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("couldn't determine user account information: %s", err)
+	}
+	if opts.Fakeroot {
+		return pw.Dir + ":/root", nil
+	}
+	return pw.Dir, nil
+}
@@ -0,0 +1,192 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package actions
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engine/singularity/config"
+	"github.com/sylabs/singularity/pkg/util/singularityconf"
+)
+
+func TestNewLauncher(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	fileConfig, err := singularityconf.Parse("")
+	if err != nil {
+		t.Fatalf("while getting default configuration: %s", err)
+	}
+	singularityconf.SetCurrentConfig(fileConfig)
+	defer singularityconf.SetCurrentConfig(nil)
+
+	sandbox, err := ioutil.TempDir("", "actions-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(sandbox)
+
+	sif := filepath.Join(sandbox, "image.sif")
+	if err := ioutil.WriteFile(sif, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the API can disable sanitize path set by singularity.conf
+	fileConfig.SanitizePath = true
+	disabled := false
+
+	tests := []struct {
+		name      string
+		image     ImageRef
+		opts      Options
+		expectErr bool
+		check     func(*testing.T, *launcher)
+	}{
+		{
+			name:      "MissingImage",
+			image:     ImageRef(filepath.Join(sandbox, "missing")),
+			expectErr: true,
+		},
+		{
+			name:      "SIFUserNamespace",
+			image:     ImageRef(sif),
+			opts:      Options{Namespaces: Namespaces{User: true}},
+			expectErr: true,
+		},
+		{
+			name:      "KeepPrivsUnprivileged",
+			image:     ImageRef(sandbox),
+			opts:      Options{KeepPrivs: true},
+			expectErr: true,
+		},
+		{
+			name:      "BadHome",
+			image:     ImageRef(sandbox),
+			opts:      Options{Home: "/a:/b:/c"},
+			expectErr: true,
+		},
+		{
+			name:  "Options",
+			image: ImageRef(sandbox),
+			opts: Options{
+				Binds:    []string{"/opt:/mnt:ro"},
+				Home:     "/tmp:/home/test",
+				Contain:  true,
+				Pwd:      "work",
+				App:      "foo",
+				Env:      map[string]string{"FOO": "bar"},
+				CleanEnv: true,
+			},
+			check: func(t *testing.T, l *launcher) {
+				c := l.cfg.EngineConfig.(*singularityConfig.EngineConfig)
+				if c.GetImage() != sandbox {
+					t.Errorf("unexpected image %q", c.GetImage())
+				}
+				if b := c.GetBindPath(); len(b) != 1 || b[0].Source != "/opt" || b[0].Destination != "/mnt" || !b[0].Readonly() {
+					t.Errorf("unexpected bind paths %+v", b)
+				}
+				if !c.GetCustomHome() || c.GetHomeSource() != "/tmp" || c.GetHomeDest() != "/home/test" {
+					t.Errorf("unexpected home %s:%s", c.GetHomeSource(), c.GetHomeDest())
+				}
+				if !c.GetContain() || c.GetAppName() != "foo" {
+					t.Errorf("contain or app name not set")
+				}
+				if cwd := c.OciConfig.Process.Cwd; cwd != "/home/test/work" {
+					t.Errorf("unexpected working directory %q", cwd)
+				}
+				if !c.GetCustomCwd() {
+					t.Errorf("custom working directory not set")
+				}
+				if v, ok := c.GetSingularityEnv()["FOO"]; !ok || v != "bar" {
+					t.Errorf("environment variable FOO not set")
+				}
+			},
+		},
+		{
+			name:  "Fakeroot",
+			image: ImageRef(sandbox),
+			opts:  Options{Fakeroot: true, Namespaces: Namespaces{Net: true}},
+			check: func(t *testing.T, l *launcher) {
+				c := l.cfg.EngineConfig.(*singularityConfig.EngineConfig)
+				if l.loadOverlay {
+					t.Errorf("overlay module used with user namespace")
+				}
+				if !hasNamespace(c, "user") {
+					t.Errorf("no user namespace with fakeroot")
+				}
+				if !c.GetFakeroot() || c.GetHomeDest() != "/root" {
+					t.Errorf("fakeroot not set")
+				}
+				if c.GetNetwork() != "none" {
+					t.Errorf("unexpected network %q", c.GetNetwork())
+				}
+				if len(c.OciConfig.Linux.UIDMappings) != 0 {
+					t.Errorf("unexpected uid mappings with fakeroot")
+				}
+			},
+		},
+		{
+			name:  "SanitizePathDefault",
+			image: ImageRef(sandbox),
+			check: func(t *testing.T, l *launcher) {
+				c := l.cfg.EngineConfig.(*singularityConfig.EngineConfig)
+				if c.GetSanitizePath() != fileConfig.SanitizePath {
+					t.Errorf("sanitize path doesn't default to singularity.conf")
+				}
+			},
+		},
+		{
+			name:  "SanitizePathDisabled",
+			image: ImageRef(sandbox),
+			opts:  Options{SanitizePath: &disabled},
+			check: func(t *testing.T, l *launcher) {
+				c := l.cfg.EngineConfig.(*singularityConfig.EngineConfig)
+				if c.GetSanitizePath() {
+					t.Errorf("sanitize path set while disabled")
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := newLauncher(tt.image, []string{"/.singularity.d/actions/exec", "true"}, tt.opts)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatalf("unexpected success")
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if tt.check != nil {
+				tt.check(t, l)
+			}
+		})
+	}
+}
+
+// hasNamespace returns if the namespace of type nsType is requested.
+func hasNamespace(c *singularityConfig.EngineConfig, nsType string) bool {
+	for _, ns := range c.OciConfig.Linux.Namespaces {
+		if string(ns.Type) == nsType {
+			return true
+		}
+	}
+	return false
+}
+
+func TestResultDuration(t *testing.T) {
+	r := Result{}
+	r.Finished = r.Started.Add(3)
+	if r.Duration() != 3 {
+		t.Errorf("unexpected duration %s", r.Duration())
+	}
+}
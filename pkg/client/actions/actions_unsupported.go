@@ -0,0 +1,29 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !linux
+
+package actions
+
+import (
+	"context"
+	"errors"
+)
+
+// errUnsupported is returned outside of Linux, containers can't be run
+// on the host.
+var errUnsupported = errors.New("running containers is not supported on this platform")
+
+// Exec runs command in the container image like 'singularity exec', it's
+// only supported on Linux.
+func Exec(ctx context.Context, image ImageRef, command []string, opts Options) (*Result, error) {
+	return nil, errUnsupported
+}
+
+// Run runs the runscript of the container image like 'singularity run',
+// it's only supported on Linux.
+func Run(ctx context.Context, image ImageRef, args []string, opts Options) (*Result, error) {
+	return nil, errUnsupported
+}
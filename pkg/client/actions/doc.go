@@ -0,0 +1,41 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+/*
+Package actions runs Singularity containers from Go programs, like the exec
+and run commands of the singularity CLI, without executing the singularity
+binary and parsing its output.
+
+The container is started with the engine configuration and the starter binary
+used by the CLI, the Singularity installation the package is built with must
+be installed on the host:
+
+	res, err := actions.Exec(ctx, "/images/alpine.sif", []string{"cat", "/etc/os-release"}, actions.Options{
+		Binds:    []string{"/data:/mnt:ro"},
+		CleanEnv: true,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("exit code %d after %s:\n%s", res.ExitCode, res.Duration(), res.Stdout)
+
+Stability
+
+The package API is versioned with APIVersion. Within an API version,
+exported identifiers are neither removed nor changed in an incompatible way:
+new fields may be added to Options and Result, their zero value keeping the
+previous behavior, and new functions may be added. An incompatible change
+increments APIVersion and is announced in the changelog.
+
+The options are checked against the administrator configuration in
+singularity.conf like the CLI flags, and the same privileges are required.
+Remote images (library://, docker://, ...) must be pulled first, and SIF
+images can't be run in a user namespace, an extracted sandbox must be used
+instead.
+*/
+package actions
+
+// APIVersion is the version of the package API.
+const APIVersion = 1
@@ -0,0 +1,18 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !linux
+
+package image
+
+import (
+	"fmt"
+	"os"
+)
+
+// blockDeviceSize returns the size in bytes of the block device f.
+func blockDeviceSize(f *os.File) (int64, error) {
+	return 0, fmt.Errorf("block devices are not supported on this platform")
+}
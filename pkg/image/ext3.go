@@ -73,6 +73,27 @@ func CheckExt3Header(b []byte) (uint64, error) {
 	return offset, nil
 }
 
+// checkExt4Header checks if byte content read from the beginning of a
+// block device contains an ext2, ext3 or ext4 superblock. Filesystem
+// features are not restricted, the filesystem is mounted with the ext4
+// driver which supports all of them.
+func checkExt4Header(b []byte) error {
+	einfo := &extFSInfo{}
+
+	if uintptr(extMagicOffset)+unsafe.Sizeof(*einfo) >= uintptr(len(b)) {
+		return debugError("can't find ext4 information header")
+	}
+	buffer := bytes.NewReader(b[extMagicOffset:])
+
+	if err := binary.Read(buffer, binary.LittleEndian, einfo); err != nil {
+		return debugError("can't read the top of the block device")
+	}
+	if !bytes.Equal(einfo.Magic[:], []byte(extMagic)) {
+		return debugError("block device doesn't contain an ext4 filesystem")
+	}
+	return nil
+}
+
 func (f *ext3Format) initializer(img *Image, fileinfo os.FileInfo) error {
 	if fileinfo.IsDir() {
 		return debugError("not an ext3 image")
@@ -81,17 +102,26 @@ func (f *ext3Format) initializer(img *Image, fileinfo os.FileInfo) error {
 	if n, err := img.File.Read(b); err != nil || n != bufferSize {
 		return debugErrorf("can't read first %d bytes: %v", bufferSize, err)
 	}
+	partType := EXT3
 	offset, err := CheckExt3Header(b)
+	if err != nil && isBlockDevice(fileinfo) {
+		// ext3 images created by singularity have a restricted set
+		// of features, a block device may hold any ext filesystem
+		if checkExt4Header(b) == nil {
+			partType = EXT4
+			offset, err = 0, nil
+		}
+	}
 	if err != nil {
 		return err
 	}
-	img.Type = EXT3
+	img.Type = partType
 	img.Partitions = []Section{
 		{
 			Offset:       offset,
 			Size:         uint64(fileinfo.Size()) - offset,
 			ID:           1,
-			Type:         EXT3,
+			Type:         uint32(partType),
 			Name:         RootFs,
 			AllowedUsage: RootFsUsage | OverlayUsage | DataUsage,
 		},
@@ -248,3 +248,47 @@ func TestInitializer(t *testing.T) {
 		t.Fatal("ext3 initializer succeeded with a directory while expected to fail")
 	}
 }
+
+// blockDeviceFileInfo reports a file as a block device.
+type blockDeviceFileInfo struct {
+	os.FileInfo
+}
+
+func (blockDeviceFileInfo) Mode() os.FileMode {
+	return os.ModeDevice | 0660
+}
+
+func TestExt4BlockDeviceInitializer(t *testing.T) {
+	if _, err := exec.LookPath("mkfs.ext4"); err != nil {
+		t.Skip("mkfs.ext4 command is not available, skipping the test...")
+	}
+
+	dir, err := ioutil.TempDir("", "ext4Testing-")
+	if err != nil {
+		t.Fatalf("impossible to create temporary directory: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := dir + "/ext4.fs"
+	createFullVirtualBlockDevice(t, path, "ext4")
+
+	img := &Image{}
+	img.File, err = os.Open(path)
+	if err != nil {
+		t.Fatalf("cannot open file: %s\n", err)
+	}
+	defer img.File.Close()
+
+	fileinfo, err := img.File.Stat()
+	if err != nil {
+		t.Fatalf("cannot stat image: %s\n", err)
+	}
+
+	var ext3format ext3Format
+	if err := ext3format.initializer(img, blockDeviceFileInfo{fileinfo}); err != nil {
+		t.Fatalf("ext3 initializer failed with an ext4 block device: %s\n", err)
+	}
+	if img.Type != EXT4 || img.Partitions[0].Type != EXT4 || img.Partitions[0].Offset != 0 {
+		t.Errorf("unexpected image type %d or partition %+v for an ext4 block device", img.Type, img.Partitions[0])
+	}
+}
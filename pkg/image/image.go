@@ -32,6 +32,8 @@ const (
 	ENCRYPTSQUASHFS
 	// RAW constant for raw format
 	RAW
+	// EXT4 constant for ext4 format, only for block devices
+	EXT4
 )
 
 type Usage uint8
@@ -170,7 +172,10 @@ func (i *Image) AuthorizedOwner(owners []string) (bool, error) {
 		return false, fmt.Errorf("failed to get stat for %s", i.Path)
 	}
 
-	uid := fileinfo.Sys().(*syscall.Stat_t).Uid
+	uid, _, err := fileOwner(fileinfo)
+	if err != nil {
+		return false, fmt.Errorf("failed to get owner of %s: %s", i.Path, err)
+	}
 	for _, owner := range owners {
 		pw, err := user.GetPwNam(owner)
 		if err != nil {
@@ -194,7 +199,10 @@ func (i *Image) AuthorizedGroup(groups []string) (bool, error) {
 		return false, fmt.Errorf("failed to get stat for %s", i.Path)
 	}
 
-	gid := fileinfo.Sys().(*syscall.Stat_t).Gid
+	_, gid, err := fileOwner(fileinfo)
+	if err != nil {
+		return false, fmt.Errorf("failed to get owner of %s: %s", i.Path, err)
+	}
 	for _, group := range groups {
 		gr, err := user.GetGrNam(group)
 		if err != nil {
@@ -367,7 +375,26 @@ func ResolvePath(path string) (string, error) {
 	return resolvedPath, nil
 }
 
-// Init initializes an image object based on given path.
+// blockDeviceInfo is the file information of a block device, reporting
+// the size of the device instead of the size of the device node.
+type blockDeviceInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (i *blockDeviceInfo) Size() int64 {
+	return i.size
+}
+
+// isBlockDevice returns true if fileinfo describes a block device.
+func isBlockDevice(fileinfo os.FileInfo) bool {
+	mode := fileinfo.Mode()
+	return mode&os.ModeDevice != 0 && mode&os.ModeCharDevice == 0
+}
+
+// Init initializes an image object based on given path, a path to an image
+// file, a sandbox directory or a block device holding an image or a
+// squashfs or ext filesystem.
 func Init(path string, writable bool) (*Image, error) {
 	sylog.Debugf("Image format detection")
 
@@ -383,6 +410,9 @@ func Init(path string, writable bool) (*Image, error) {
 		Usage: RootFsUsage,
 	}
 
+	fi, err := os.Stat(resolvedPath)
+	blockDevice := err == nil && isBlockDevice(fi)
+
 	for _, rf := range registeredFormats {
 		sylog.Debugf("Check for %s image format", rf.name)
 
@@ -395,11 +425,24 @@ func Init(path string, writable bool) (*Image, error) {
 				sylog.Debugf("Opening %s in read-only mode: no write permissions", path)
 				mode = os.O_RDONLY
 				img.Writable = false
+			} else if blockDevice {
+				// the kernel refuses an exclusive open of a block
+				// device mounted or opened exclusively elsewhere
+				mode |= os.O_EXCL
 			}
 		}
 
 		img.File, err = os.OpenFile(resolvedPath, mode, 0)
-		if err != nil {
+		if err != nil && blockDevice {
+			// the image is opened with the user privileges, the
+			// user must be allowed to read the block device
+			if os.IsPermission(err) {
+				return nil, fmt.Errorf("permission denied to read block device %s", resolvedPath)
+			} else if errors.Is(err, syscall.EBUSY) {
+				return nil, fmt.Errorf("block device %s is in use, can't open it for writing", resolvedPath)
+			}
+			return nil, fmt.Errorf("while opening block device %s: %s", resolvedPath, err)
+		} else if err != nil {
 			continue
 		}
 		fileinfo, err := img.File.Stat()
@@ -407,6 +450,14 @@ func Init(path string, writable bool) (*Image, error) {
 			_ = img.File.Close()
 			return nil, err
 		}
+		if blockDevice {
+			size, err := blockDeviceSize(img.File)
+			if err != nil {
+				_ = img.File.Close()
+				return nil, fmt.Errorf("while getting size of block device %s: %s", resolvedPath, err)
+			}
+			fileinfo = &blockDeviceInfo{FileInfo: fileinfo, size: size}
+		}
 
 		// readOnlyFilesystemError is allowed here and passed back
 		// to the caller because there is basically no error with
@@ -424,7 +475,7 @@ func Init(path string, writable bool) (*Image, error) {
 
 		sylog.Debugf("%s image format detected", rf.name)
 
-		if _, _, err := syscall.Syscall(syscall.SYS_FCNTL, img.File.Fd(), syscall.F_SETFD, syscall.O_CLOEXEC); err != 0 {
+		if err := setCloseOnExec(img.File.Fd()); err != nil {
 			sylog.Warningf("failed to set O_CLOEXEC flags on image")
 		}
 
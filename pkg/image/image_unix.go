@@ -0,0 +1,32 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !windows
+
+package image
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner returns the owner and the group of the file described by fi.
+func fileOwner(fi os.FileInfo) (uint32, uint32, error) {
+	st := fi.Sys().(*syscall.Stat_t)
+	return st.Uid, st.Gid, nil
+}
+
+// setCloseOnExec sets the close-on-exec flag of the file descriptor fd.
+func setCloseOnExec(fd uintptr) error {
+	if _, _, err := syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_SETFD, syscall.O_CLOEXEC); err != 0 {
+		return err
+	}
+	return nil
+}
+
+// munmap unmaps the memory mapped image data.
+func munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,28 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package image
+
+import (
+	"fmt"
+	"os"
+)
+
+// fileOwner returns the owner and the group of the file described by fi.
+func fileOwner(fi os.FileInfo) (uint32, uint32, error) {
+	return 0, 0, fmt.Errorf("file ownership is not supported on this platform")
+}
+
+// setCloseOnExec sets the close-on-exec flag of the file descriptor fd,
+// handles aren't inherited by default on this platform.
+func setCloseOnExec(fd uintptr) error {
+	return nil
+}
+
+// munmap unmaps the memory mapped image data, images are never mapped on
+// this platform.
+func munmap(data []byte) error {
+	return nil
+}
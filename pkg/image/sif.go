@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2019, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2020, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -10,7 +10,6 @@ import (
 	"fmt"
 	"os"
 	"runtime"
-	"syscall"
 
 	"github.com/sylabs/sif/pkg/sif"
 	"github.com/sylabs/singularity/internal/pkg/util/machine"
@@ -21,6 +20,9 @@ const (
 	SIFDescOCIConfigJSON = "oci-config.json"
 	// SIFDescInspectMetadataJSON is the name of the SIF descriptor holding the container metadata.
 	SIFDescInspectMetadataJSON = "inspect-metadata.json"
+	// SIFDescOCIDigestJSON is the name of the SIF descriptor holding the digest of the
+	// manifest of the OCI image the container was built from.
+	SIFDescOCIDigestJSON = "oci-digest.json"
 )
 
 type sifFormat struct{}
@@ -65,11 +67,19 @@ func (f *sifFormat) initializer(img *Image, fi os.FileInfo) error {
 	}
 
 	// Load the SIF file
-	fimg, err := sif.LoadContainerFp(img.File, !img.Writable)
+	fimg, version, err := LoadSIF(img.File, !img.Writable)
 	if err != nil {
 		return err
 	}
 
+	// objects of images created by newer versions which are not
+	// supported, they are skipped as long as the primary partition
+	// is readable
+	var skipped []string
+	if version != "" {
+		skipped = append(skipped, fmt.Sprintf("SIF format version %s", version))
+	}
+
 	groupID := -1
 
 	// Get the default system partition image
@@ -130,6 +140,10 @@ func (f *sifFormat) initializer(img *Image, fi os.FileInfo) error {
 			continue
 		}
 		if ptype, err := desc.GetPartType(); err == nil {
+			if !knownParttype(ptype) {
+				skipped = append(skipped, fmt.Sprintf("partition type %d of object %d", ptype, desc.ID))
+				continue
+			}
 			// exclude partitions that are not types data or overlay
 			if ptype != sif.PartData && ptype != sif.PartOverlay {
 				continue
@@ -141,6 +155,9 @@ func (f *sifFormat) initializer(img *Image, fi os.FileInfo) error {
 			fstype, err := desc.GetFsType()
 			if err != nil {
 				continue
+			} else if !knownFstype(fstype) {
+				skipped = append(skipped, fmt.Sprintf("file system type %d of partition %d", fstype, desc.ID))
+				continue
 			}
 
 			if fimg.Filesize < desc.Filelen+desc.Fileoff {
@@ -171,6 +188,14 @@ func (f *sifFormat) initializer(img *Image, fi os.FileInfo) error {
 			img.Partitions = append(img.Partitions, partition)
 			img.Usage |= usage
 		} else if desc.Datatype != 0 {
+			if !knownDatatype(desc.Datatype) {
+				skipped = append(skipped, fmt.Sprintf("data object type %#x of object %d", int32(desc.Datatype), desc.ID))
+				continue
+			}
+			if desc.GetName() == SIFDescInspectMetadataJSON && !knownMetadata(img, desc) {
+				skipped = append(skipped, fmt.Sprintf("container metadata type of object %d", desc.ID))
+				continue
+			}
 			data := Section{
 				Offset:       uint64(desc.Fileoff),
 				Size:         uint64(desc.Filelen),
@@ -185,10 +210,12 @@ func (f *sifFormat) initializer(img *Image, fi os.FileInfo) error {
 
 	img.Type = SIF
 
+	warnSkipped(img, &fimg, skipped)
+
 	// UnloadContainer close image, just want to unmap image
 	// from memory
 	if !fimg.Amodebuf {
-		if err := syscall.Munmap(fimg.Filedata); err != nil {
+		if err := munmap(fimg.Filedata); err != nil {
 			return fmt.Errorf("while calling unmapping SIF file")
 		}
 	}
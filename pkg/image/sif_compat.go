@@ -0,0 +1,145 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/pkg/inspect"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// sifVersionLabel is the label recording the Singularity version which
+// created an image.
+const sifVersionLabel = "org.label-schema.usage.singularity.version"
+
+// LoadSIF loads the SIF image from the file f like sif.LoadContainerFp
+// but also accepts images created with a newer SIF format version, in
+// which case the version is returned and the image is loaded in buffered
+// mode with the header and descriptors read in memory. The image header
+// is left untouched so the integrity of its signatures can be verified.
+func LoadSIF(f *os.File, rdonly bool) (sif.FileImage, string, error) {
+	var hdr sif.Header
+
+	if err := binary.Read(io.NewSectionReader(f, 0, sif.DataStartOffset), binary.LittleEndian, &hdr); err != nil {
+		return sif.FileImage{}, "", fmt.Errorf("while reading SIF global header: %s", err)
+	}
+	version := string(bytes.TrimRight(hdr.Version[:], "\x00"))
+	if version <= sif.HdrVersion {
+		fimg, err := sif.LoadContainerFp(f, rdonly)
+		return fimg, "", err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		return sif.FileImage{}, "", err
+	}
+	end := hdr.Descroff + hdr.Descrlen
+	if hdr.Descroff < 0 || hdr.Descrlen < 0 || end > fi.Size() {
+		return sif.FileImage{}, "", fmt.Errorf("invalid SIF file: wrong descriptors size")
+	}
+	data := make([]byte, end)
+	if _, err := f.ReadAt(data, 0); err != nil {
+		return sif.FileImage{}, "", fmt.Errorf("while reading SIF descriptors: %s", err)
+	}
+
+	// the SIF library rejects newer versions, the version stored in the
+	// buffer is replaced by the supported one to load the descriptors
+	off := sif.HdrLaunchLen + sif.HdrMagicLen
+	copy(data[off:off+sif.HdrVersionLen], make([]byte, sif.HdrVersionLen))
+	copy(data[off:], sif.HdrVersion)
+
+	fimg, err := sif.LoadContainerReader(bytes.NewReader(data))
+	if err != nil {
+		return sif.FileImage{}, "", err
+	} else if fimg.DescrArr == nil {
+		return sif.FileImage{}, "", fmt.Errorf("invalid SIF file: no descriptors found")
+	}
+	fimg.Header.Version = hdr.Version
+	fimg.Fp = f
+	fimg.Filesize = fi.Size()
+	fimg.Filedata = data
+	fimg.Amodebuf = true
+
+	return fimg, version, nil
+}
+
+// knownDatatype returns if the SIF data object type t is supported.
+func knownDatatype(t sif.Datatype) bool {
+	return t >= sif.DataDeffile && t <= sif.DataCryptoMessage
+}
+
+// knownFstype returns if the SIF partition file system type t is supported.
+func knownFstype(t sif.Fstype) bool {
+	return t >= sif.FsSquash && t <= sif.FsEncryptedSquashfs
+}
+
+// knownParttype returns if the SIF partition type t is supported.
+func knownParttype(t sif.Parttype) bool {
+	return t >= sif.PartSystem && t <= sif.PartOverlay
+}
+
+// knownMetadata returns if the container metadata stored in the data
+// object described by desc has a supported type.
+func knownMetadata(img *Image, desc sif.Descriptor) bool {
+	var metadata inspect.Metadata
+
+	r := io.NewSectionReader(img.File, desc.Fileoff, desc.Filelen)
+	if err := json.NewDecoder(r).Decode(&metadata); err != nil {
+		// let inspect report decoding errors
+		return true
+	}
+	return metadata.Type == "" || metadata.Type == inspect.ContainerType
+}
+
+// sifCreator returns the Singularity version which created the image from
+// its labels, if recorded.
+func sifCreator(img *Image, fimg *sif.FileImage) string {
+	for _, desc := range fimg.DescrArr {
+		if !desc.Used {
+			continue
+		}
+		labels := make(map[string]string)
+		r := io.NewSectionReader(img.File, desc.Fileoff, desc.Filelen)
+
+		switch {
+		case desc.Datatype == sif.DataLabels:
+			if err := json.NewDecoder(r).Decode(&labels); err != nil {
+				continue
+			}
+		case desc.Datatype == sif.DataGenericJSON && desc.GetName() == SIFDescInspectMetadataJSON:
+			metadata := new(inspect.Metadata)
+			if err := json.NewDecoder(r).Decode(metadata); err != nil {
+				continue
+			}
+			labels = metadata.Attributes.Labels
+		default:
+			continue
+		}
+		if v := labels[sifVersionLabel]; v != "" {
+			return "Singularity " + v
+		}
+	}
+	return "a newer Singularity version"
+}
+
+// warnSkipped warns about the SIF objects skipped by the image initializer.
+func warnSkipped(img *Image, fimg *sif.FileImage, skipped []string) {
+	if len(skipped) == 0 {
+		return
+	}
+	sylog.Warningf(
+		"%s was created by %s, ignoring unsupported %s",
+		img.Path, sifCreator(img, fimg), strings.Join(skipped, ", "),
+	)
+}
@@ -64,6 +64,23 @@ func createSIF(t *testing.T, inputDesc []sif.DescriptorInput, corrupted bool) st
 	return sifFile.Name()
 }
 
+// setSIFVersion sets the SIF format version of the image path to version
+// to mimic images created by newer versions.
+func setSIFVersion(t *testing.T, path string, version string) string {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("failed to open %s: %s", path, err)
+	}
+	defer f.Close()
+
+	b := make([]byte, sif.HdrVersionLen)
+	copy(b, version)
+	if _, err := f.WriteAt(b, sif.HdrLaunchLen+sif.HdrMagicLen); err != nil {
+		t.Fatalf("failed to write SIF version: %s", err)
+	}
+	return path
+}
+
 func TestSIFInitializer(t *testing.T) {
 	fp1, err := os.Open(testSquash)
 	if err != nil {
@@ -134,6 +151,51 @@ func TestSIFInitializer(t *testing.T) {
 		}),
 	}
 
+	// objects only known by future versions
+	futureData := []byte("future")
+	futureObject := sif.DescriptorInput{
+		Datatype: sif.DataCryptoMessage + 8,
+		Groupid:  sif.DescrDefaultGroup,
+		Link:     sif.DescrUnusedLink,
+		Fname:    "futureObject",
+		Data:     futureData,
+		Size:     int64(len(futureData)),
+	}
+
+	futureFsPart := sif.DescriptorInput{
+		Datatype: sif.DataPartition,
+		Groupid:  sif.DescrDefaultGroup,
+		Link:     sif.DescrUnusedLink,
+		Fname:    "futureFsPart",
+		Fp:       fp2,
+		Extra: *bytes.NewBuffer([]byte{
+			0x2a, 0x00, 0x00, 0x00, // fstype
+			0x03, 0x00, 0x00, 0x00, // part type
+		}),
+	}
+
+	futurePart := sif.DescriptorInput{
+		Datatype: sif.DataPartition,
+		Groupid:  sif.DescrDefaultGroup,
+		Link:     sif.DescrUnusedLink,
+		Fname:    "futurePart",
+		Fp:       fp2,
+		Extra: *bytes.NewBuffer([]byte{
+			0x01, 0x00, 0x00, 0x00, // fstype
+			0x2a, 0x00, 0x00, 0x00, // part type
+		}),
+	}
+
+	metadata := []byte(`{"data":{"attributes":{"labels":{"org.label-schema.usage.singularity.version":"4.0.0"}}},"type":"container-v2"}`)
+	futureMetadata := sif.DescriptorInput{
+		Datatype: sif.DataGenericJSON,
+		Groupid:  sif.DescrDefaultGroup,
+		Link:     sif.DescrUnusedLink,
+		Fname:    SIFDescInspectMetadataJSON,
+		Data:     metadata,
+		Size:     int64(len(metadata)),
+	}
+
 	tests := []struct {
 		name               string
 		path               string
@@ -206,6 +268,54 @@ func TestSIFInitializer(t *testing.T) {
 			expectedPartitions: 1,
 			expectedSections:   1,
 		},
+		{
+			name:               "FutureVersionSIF",
+			path:               setSIFVersion(t, createSIF(t, []sif.DescriptorInput{primPart, oneSection}, false), "02"),
+			writable:           false,
+			expectedSuccess:    true,
+			expectedPartitions: 1,
+			expectedSections:   1,
+		},
+		{
+			name:               "FutureVersionCorruptedSIF",
+			path:               setSIFVersion(t, createSIF(t, []sif.DescriptorInput{primPart}, true), "02"),
+			writable:           false,
+			expectedSuccess:    false,
+			expectedPartitions: 0,
+			expectedSections:   0,
+		},
+		{
+			name:               "FutureDataObjectSIF",
+			path:               createSIF(t, []sif.DescriptorInput{primPart, futureObject, oneSection}, false),
+			writable:           false,
+			expectedSuccess:    true,
+			expectedPartitions: 1,
+			expectedSections:   1,
+		},
+		{
+			name:               "FutureFsTypeSIF",
+			path:               createSIF(t, []sif.DescriptorInput{primPart, futureFsPart}, false),
+			writable:           false,
+			expectedSuccess:    true,
+			expectedPartitions: 1,
+			expectedSections:   0,
+		},
+		{
+			name:               "FuturePartitionTypeSIF",
+			path:               createSIF(t, []sif.DescriptorInput{primPart, futurePart}, false),
+			writable:           false,
+			expectedSuccess:    true,
+			expectedPartitions: 1,
+			expectedSections:   0,
+		},
+		{
+			name:               "FutureMetadataSIF",
+			path:               setSIFVersion(t, createSIF(t, []sif.DescriptorInput{primPart, futureMetadata}, false), "02"),
+			writable:           false,
+			expectedSuccess:    true,
+			expectedPartitions: 1,
+			expectedSections:   0,
+		},
 	}
 
 	for _, tt := range tests {
@@ -246,6 +356,76 @@ func TestSIFInitializer(t *testing.T) {
 	}
 }
 
+func TestLoadSIF(t *testing.T) {
+	fp, err := os.Open(testSquash)
+	if err != nil {
+		t.Fatalf("failed to open %s: %s", testSquash, err)
+	}
+	defer fp.Close()
+
+	part := sif.DescriptorInput{
+		Datatype: sif.DataPartition,
+		Groupid:  sif.DescrDefaultGroup,
+		Link:     sif.DescrUnusedLink,
+		Fname:    "primPart",
+		Fp:       fp,
+		Extra: *bytes.NewBuffer([]byte{
+			0x01, 0x00, 0x00, 0x00, // fstype
+			0x02, 0x00, 0x00, 0x00, // part type
+		}),
+	}
+	part.Extra.WriteString(sif.GetSIFArch(runtime.GOARCH))
+
+	tests := []struct {
+		name        string
+		version     string
+		wantVersion string
+	}{
+		{
+			name:        "CurrentVersion",
+			version:     sif.HdrVersion,
+			wantVersion: "",
+		},
+		{
+			name:        "FutureVersion",
+			version:     "02",
+			wantVersion: "02",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := setSIFVersion(t, createSIF(t, []sif.DescriptorInput{part}, false), tt.version)
+			defer os.Remove(path)
+
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fimg, version, err := LoadSIF(f, true)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			defer fimg.UnloadContainer()
+
+			if version != tt.wantVersion {
+				t.Errorf("got version %q, want %q", version, tt.wantVersion)
+			}
+			if got := string(bytes.TrimRight(fimg.Header.Version[:], "\x00")); got != tt.version {
+				t.Errorf("got header version %q, want %q", got, tt.version)
+			}
+			d, _, err := fimg.GetPartPrimSys()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if data := d.GetData(&fimg); !bytes.Equal(data[:4], []byte("hsqs")) {
+				t.Errorf("unexpected primary partition data")
+			}
+		})
+	}
+}
+
 func TestSIFOpenMode(t *testing.T) {
 	var sifFmt sifFormat
 
@@ -132,6 +132,19 @@ func GetSquashfsComp(b []byte) (string, error) {
 	return "", fmt.Errorf("not a valid squashfs image")
 }
 
+// GetSquashfsBlockSize checks if byte content contains a valid squashfs
+// header and returns the block size of the filesystem
+func GetSquashfsBlockSize(b []byte) (uint32, error) {
+	sb, _, err := parseSquashfsHeader(b)
+	if err != nil {
+		return 0, fmt.Errorf("while parsing squashfs super block: %v", err)
+	}
+	if sb.Major != 4 {
+		return 0, fmt.Errorf("unsupported squashfs version %d", sb.Major)
+	}
+	return sb.BlockSize, nil
+}
+
 func (f *squashfsFormat) initializer(img *Image, fileinfo os.FileInfo) error {
 	if fileinfo.IsDir() {
 		return debugError("not a squashfs image")
@@ -181,3 +181,75 @@ func TestSquashfsCompression(t *testing.T) {
 		})
 	}
 }
+
+func TestSquashfsBlockSize(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		blockSize uint32
+		wantErr   bool
+	}{
+		{
+			name:      "version 4 header",
+			path:      "./testdata/squashfs.v4",
+			blockSize: 131072,
+		},
+		{
+			name:    "version 3 header",
+			path:    "./testdata/squashfs.v3",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := ioutil.ReadFile(tt.path)
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+
+			blockSize, err := GetSquashfsBlockSize(b)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Unexpected success, got block size %d", blockSize)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("While looking for block size: %v", err)
+			}
+			if blockSize != tt.blockSize {
+				t.Errorf("Incorrect block size %d, want %d", blockSize, tt.blockSize)
+			}
+		})
+	}
+
+	t.Run("mksquashfs block size", func(t *testing.T) {
+		cmdBin, err := exec.LookPath("mksquashfs")
+		if err != nil {
+			t.Skipf("mksquashfs is not available, skipping the test...")
+		}
+		dir, err := ioutil.TempDir("", "squashfsBlockSize-")
+		if err != nil {
+			t.Fatalf("impossible to create temporary directory: %s", err)
+		}
+		defer os.RemoveAll(dir)
+
+		path := dir + ".squashfs"
+		defer os.Remove(path)
+		if out, err := exec.Command(cmdBin, dir, path, "-noappend", "-b", "65536").CombinedOutput(); err != nil {
+			t.Fatalf("cannot create squashfs volume: %s: %s", err, out)
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read file: %v", err)
+		}
+		blockSize, err := GetSquashfsBlockSize(b)
+		if err != nil {
+			t.Fatalf("While looking for block size: %v", err)
+		}
+		if blockSize != 65536 {
+			t.Errorf("Incorrect block size %d, want 65536", blockSize)
+		}
+	})
+}
@@ -5,6 +5,8 @@
 
 package inspect
 
+import "time"
+
 // ContainerType defines the container type (used by default).
 const ContainerType = "container"
 
@@ -27,6 +29,60 @@ type Attributes struct {
 	Helpfile    string                    `json:"helpfile,omitempty"`
 	Deffile     string                    `json:"deffile,omitempty"`
 	Startscript string                    `json:"startscript,omitempty"`
+	// SpecialFiles is nil when the image was built without recording
+	// its setuid, setgid and world-writable files.
+	SpecialFiles *SpecialFiles `json:"specialFiles,omitempty"`
+	// ScanReport is nil when the image wasn't scanned by the post build
+	// hook.
+	ScanReport *ScanReport `json:"scanReport,omitempty"`
+}
+
+// ScanReportName is the name of the SIF data object, linked to the root
+// filesystem partition it describes, or of the file in the sandbox
+// metadata directory, holding the post build hook report.
+const ScanReportName = "scan-report.json"
+
+// ScanReport records the post build hook execution.
+type ScanReport struct {
+	Hook     string    `json:"hook"`
+	Date     time.Time `json:"date"`
+	ExitCode int       `json:"exitCode"`
+	Output   string    `json:"output"`
+}
+
+// MaxSpecialFilePaths is the maximum number of paths recorded for each
+// kind of special files, files beyond it are only counted.
+const MaxSpecialFilePaths = 100
+
+// SpecialFiles describes the setuid, setgid and world-writable files
+// of a container image.
+type SpecialFiles struct {
+	SetuidCount        int      `json:"setuidCount"`
+	Setuid             []string `json:"setuid,omitempty"`
+	SetgidCount        int      `json:"setgidCount"`
+	Setgid             []string `json:"setgid,omitempty"`
+	WorldWritableCount int      `json:"worldWritableCount"`
+	WorldWritable      []string `json:"worldWritable,omitempty"`
+}
+
+// Add records the file path for each of the setuid, setgid and
+// world-writable kinds it belongs to.
+func (s *SpecialFiles) Add(path string, setuid, setgid, worldWritable bool) {
+	add := func(count *int, paths *[]string) {
+		*count++
+		if len(*paths) < MaxSpecialFilePaths {
+			*paths = append(*paths, path)
+		}
+	}
+	if setuid {
+		add(&s.SetuidCount, &s.Setuid)
+	}
+	if setgid {
+		add(&s.SetgidCount, &s.Setgid)
+	}
+	if worldWritable {
+		add(&s.WorldWritableCount, &s.WorldWritable)
+	}
 }
 
 // Data holds the container metadata attributes.
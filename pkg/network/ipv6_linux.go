@@ -0,0 +1,133 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+
+	"github.com/containernetworking/cni/libcni"
+)
+
+// ipv6DisablePath is the sysctl disabling IPv6 on all interfaces, absent
+// when IPv6 is disabled at boot time with ipv6.disable=1.
+const ipv6DisablePath = "/proc/sys/net/ipv6/conf/all/disable_ipv6"
+
+// IPv6Enabled returns whether IPv6 is enabled in the network namespace
+// of the caller.
+func IPv6Enabled() bool {
+	b, err := ioutil.ReadFile(ipv6DisablePath)
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(b)) == "0"
+}
+
+// isIPv6 returns whether the IP address or CIDR s is an IPv6 address.
+func isIPv6(s string) bool {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		var err error
+		if ip, _, err = net.ParseCIDR(s); err != nil {
+			return false
+		}
+	}
+	return ip.To4() == nil
+}
+
+// filterIPv6 removes the IPv6 entries of the list l, an entry is identified
+// as IPv6 by its key field. It returns the remaining entries and whether an
+// entry was removed.
+func filterIPv6(l []interface{}, key string) ([]interface{}, bool) {
+	kept := make([]interface{}, 0, len(l))
+	for _, e := range l {
+		if m, ok := e.(map[string]interface{}); ok {
+			if s, ok := m[key].(string); ok && isIPv6(s) {
+				continue
+			}
+		}
+		kept = append(kept, e)
+	}
+	return kept, len(kept) != len(l)
+}
+
+// RemoveIPv6 removes the IPv6 subnets, ranges, static addresses and routes
+// from the IPAM configuration of the plugins of a network configuration
+// list. It returns whether IPv6 addressing was removed and whether the
+// network still has IPv4 addressing, a network without IPAM subnet,
+// range or static address (e.g. configured by capability arguments) is
+// left unchanged.
+func RemoveIPv6(conf *libcni.NetworkConfigList) (removed bool, ipv4 bool, err error) {
+	for _, plugin := range conf.Plugins {
+		var raw map[string]interface{}
+
+		if err := json.Unmarshal(plugin.Bytes, &raw); err != nil {
+			return false, false, fmt.Errorf("while parsing %s network configuration: %s", conf.Name, err)
+		}
+		ipam, ok := raw["ipam"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		pluginRemoved := false
+		if subnet, ok := ipam["subnet"].(string); ok {
+			if isIPv6(subnet) {
+				for _, k := range []string{"subnet", "rangeStart", "rangeEnd", "gateway"} {
+					delete(ipam, k)
+				}
+				pluginRemoved = true
+			} else {
+				ipv4 = true
+			}
+		}
+		if ranges, ok := ipam["ranges"].([]interface{}); ok {
+			sets := make([]interface{}, 0, len(ranges))
+			for _, r := range ranges {
+				set, ok := r.([]interface{})
+				if !ok {
+					sets = append(sets, r)
+					continue
+				}
+				set, setRemoved := filterIPv6(set, "subnet")
+				pluginRemoved = pluginRemoved || setRemoved
+				if len(set) > 0 {
+					sets = append(sets, set)
+					ipv4 = true
+				}
+			}
+			if len(sets) > 0 {
+				ipam["ranges"] = sets
+			} else {
+				delete(ipam, "ranges")
+			}
+		}
+		if addresses, ok := ipam["addresses"].([]interface{}); ok {
+			addresses, addrRemoved := filterIPv6(addresses, "address")
+			pluginRemoved = pluginRemoved || addrRemoved
+			if len(addresses) > 0 {
+				ipv4 = true
+			}
+			ipam["addresses"] = addresses
+		}
+		if !pluginRemoved {
+			continue
+		}
+		if routes, ok := ipam["routes"].([]interface{}); ok {
+			ipam["routes"], _ = filterIPv6(routes, "dst")
+		}
+
+		b, err := json.Marshal(raw)
+		if err != nil {
+			return false, false, fmt.Errorf("while updating %s network configuration: %s", conf.Name, err)
+		}
+		plugin.Bytes = b
+		removed = true
+	}
+	return removed, ipv4, nil
+}
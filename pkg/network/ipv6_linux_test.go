@@ -0,0 +1,94 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/containernetworking/cni/libcni"
+)
+
+func TestRemoveIPv6(t *testing.T) {
+	tests := []struct {
+		name        string
+		ipam        string
+		wantIPAM    string
+		wantRemoved bool
+		wantIPv4    bool
+	}{
+		{
+			name:     "IPv4Subnet",
+			ipam:     `{"type":"host-local","subnet":"10.22.0.0/16","routes":[{"dst":"0.0.0.0/0"}]}`,
+			wantIPAM: `{"type":"host-local","subnet":"10.22.0.0/16","routes":[{"dst":"0.0.0.0/0"}]}`,
+			wantIPv4: true,
+		},
+		{
+			name:        "IPv6Subnet",
+			ipam:        `{"type":"host-local","subnet":"fd00:10:24::/64","routes":[{"dst":"::/0"}]}`,
+			wantIPAM:    `{"type":"host-local","routes":[]}`,
+			wantRemoved: true,
+		},
+		{
+			name: "DualStackRanges",
+			ipam: `{"type":"host-local","ranges":[[{"subnet":"10.22.0.0/16"}],[{"subnet":"fd00:10:22::/64"}]],` +
+				`"routes":[{"dst":"0.0.0.0/0"},{"dst":"::/0"}]}`,
+			wantIPAM:    `{"type":"host-local","ranges":[[{"subnet":"10.22.0.0/16"}]],"routes":[{"dst":"0.0.0.0/0"}]}`,
+			wantRemoved: true,
+			wantIPv4:    true,
+		},
+		{
+			name:        "StaticAddresses",
+			ipam:        `{"type":"static","addresses":[{"address":"192.168.1.1/24"},{"address":"fd00::1/64"}]}`,
+			wantIPAM:    `{"type":"static","addresses":[{"address":"192.168.1.1/24"}]}`,
+			wantRemoved: true,
+			wantIPv4:    true,
+		},
+		{
+			name:     "NoAddressing",
+			ipam:     `{"type":"host-local","routes":[{"dst":"::/0"}]}`,
+			wantIPAM: `{"type":"host-local","routes":[{"dst":"::/0"}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, err := libcni.ConfListFromBytes([]byte(`{
+				"cniVersion": "0.4.0",
+				"name": "test",
+				"plugins": [
+					{"type": "bridge", "ipam": ` + tt.ipam + `},
+					{"type": "portmap", "capabilities": {"portMappings": true}}
+				]
+			}`))
+			if err != nil {
+				t.Fatalf("failed to parse configuration: %s", err)
+			}
+
+			removed, ipv4, err := RemoveIPv6(conf)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if removed != tt.wantRemoved || ipv4 != tt.wantIPv4 {
+				t.Errorf("got removed=%v ipv4=%v, expected removed=%v ipv4=%v", removed, ipv4, tt.wantRemoved, tt.wantIPv4)
+			}
+
+			var got, want struct {
+				IPAM interface{} `json:"ipam"`
+			}
+			if err := json.Unmarshal(conf.Plugins[0].Bytes, &got); err != nil {
+				t.Fatalf("failed to parse updated configuration: %s", err)
+			}
+			if err := json.Unmarshal([]byte(`{"ipam":`+tt.wantIPAM+`}`), &want); err != nil {
+				t.Fatalf("failed to parse expected configuration: %s", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got ipam %v, expected %v", got.IPAM, want.IPAM)
+			}
+		})
+	}
+}
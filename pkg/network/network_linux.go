@@ -219,8 +219,14 @@ func (m *Setup) SetCapability(network string, capName string, args interface{})
 				)
 			case []allocator.Range:
 				if m.runtimeConf[i].CapabilityArgs[capName] == nil {
-					m.runtimeConf[i].CapabilityArgs[capName] = []allocator.RangeSet{args}
+					m.runtimeConf[i].CapabilityArgs[capName] = make([]allocator.RangeSet, 0)
 				}
+				// each range is a distinct range set, allowing to request
+				// both an IPv4 and an IPv6 address
+				m.runtimeConf[i].CapabilityArgs[capName] = append(
+					m.runtimeConf[i].CapabilityArgs[capName].([]allocator.RangeSet),
+					args,
+				)
 			}
 		}
 	}
@@ -389,36 +395,63 @@ func (m *Setup) SetPortProtection(network string, lowPort int) error {
 		return nil
 	}
 	for _, e := range entries {
-		sockProt := unix.IPPROTO_TCP
-		sockType := unix.SOCK_STREAM
-
 		if e.HostPort <= lowPort {
 			return fmt.Errorf("not authorized to map port under %d", lowPort)
 		}
-		if e.Protocol == "udp" {
-			sockProt = unix.IPPROTO_UDP
-			sockType = unix.SOCK_DGRAM
+		if err := protectPort(unix.AF_INET, e); err != nil {
+			return err
 		}
-		fd, err := unix.Socket(unix.AF_INET, sockType, sockProt)
-		if err != nil {
-			return fmt.Errorf("failed to create %s socket on port %d: %s", e.Protocol, e.HostPort, err)
+		// also hold the IPv6 port, as the port is mapped for both
+		// IPv4 and IPv6 container addresses, unless IPv6 is disabled
+		if err := protectPort(unix.AF_INET6, e); err != nil && err != unix.EAFNOSUPPORT {
+			return err
 		}
-		err = unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	}
+	return nil
+}
+
+// protectPort holds the host port of the port mapping entry e with a
+// socket of the address family, the socket is intentionally left open.
+// It returns EAFNOSUPPORT if the address family is not supported.
+func protectPort(family int, e PortMapEntry) error {
+	sockProt := unix.IPPROTO_TCP
+	sockType := unix.SOCK_STREAM
+
+	if e.Protocol == "udp" {
+		sockProt = unix.IPPROTO_UDP
+		sockType = unix.SOCK_DGRAM
+	}
+	fd, err := unix.Socket(family, sockType, sockProt)
+	if err == unix.EAFNOSUPPORT {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("failed to create %s socket on port %d: %s", e.Protocol, e.HostPort, err)
+	}
+	err = unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	if err != nil {
+		return fmt.Errorf("failed to set reuseport for %s socket on port %d: %s", e.Protocol, e.HostPort, err)
+	}
+	var sockAddr unix.Sockaddr = &unix.SockaddrInet4{
+		Port: e.HostPort,
+	}
+	if family == unix.AF_INET6 {
+		// don't overlap with the IPv4 socket
+		err = unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_V6ONLY, 1)
 		if err != nil {
-			return fmt.Errorf("failed to set reuseport for %s socket on port %d: %s", e.Protocol, e.HostPort, err)
+			return fmt.Errorf("failed to set IPv6 only for %s socket on port %d: %s", e.Protocol, e.HostPort, err)
 		}
-		sockAddr := &unix.SockaddrInet4{
+		sockAddr = &unix.SockaddrInet6{
 			Port: e.HostPort,
 		}
-		err = unix.Bind(fd, sockAddr)
+	}
+	err = unix.Bind(fd, sockAddr)
+	if err != nil {
+		return fmt.Errorf("failed to bind %s socket on port %d: %s", e.Protocol, e.HostPort, err)
+	}
+	if sockType == unix.SOCK_STREAM {
+		err = unix.Listen(fd, 1)
 		if err != nil {
-			return fmt.Errorf("failed to bind %s socket on port %d: %s", e.Protocol, e.HostPort, err)
-		}
-		if sockType == unix.SOCK_STREAM {
-			err = unix.Listen(fd, 1)
-			if err != nil {
-				return fmt.Errorf("failed to listen on %s socket port %d: %s", e.Protocol, e.HostPort, err)
-			}
+			return fmt.Errorf("failed to listen on %s socket port %d: %s", e.Protocol, e.HostPort, err)
 		}
 	}
 	return nil
@@ -7,10 +7,16 @@ package singularity
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/sylabs/singularity/internal/pkg/instance"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engine/config/oci"
 	"github.com/sylabs/singularity/pkg/image"
 	"github.com/sylabs/singularity/pkg/util/singularityconf"
@@ -100,6 +106,64 @@ func (b *BindPath) Readonly() bool {
 	return b.Options != nil && b.Options["ro"] != nil
 }
 
+// Optional returns the option optional was set or not.
+func (b *BindPath) Optional() bool {
+	return b.Options != nil && b.Options["optional"] != nil
+}
+
+// IDMap returns the option idmap was set or not.
+func (b *BindPath) IDMap() bool {
+	return b.Options != nil && b.Options["idmap"] != nil
+}
+
+// Chown returns the owner set by the chown option, ok is false if the
+// option wasn't set. The option value is checked by ParseBindPath.
+func (b *BindPath) Chown() (uid, gid int, ok bool) {
+	if b.Options == nil || b.Options["chown"] == nil {
+		return 0, 0, false
+	}
+	m := chownRegexp.FindStringSubmatch(b.Options["chown"].Value)
+	if m == nil {
+		return 0, 0, false
+	}
+	uid, _ = strconv.Atoi(m[1])
+	gid, _ = strconv.Atoi(m[2])
+	return uid, gid, true
+}
+
+// chownRegexp matches the uid:gid value of the chown bind option.
+var chownRegexp = regexp.MustCompile(`^(\d+):(\d+)$`)
+
+// bindFlagOptions lists the bind options setting mount flags, each one is
+// paired with the option it conflicts with.
+var bindFlagOptions = map[string]string{
+	"nosuid": "suid",
+	"suid":   "nosuid",
+	"nodev":  "dev",
+	"dev":    "nodev",
+	"noexec": "",
+}
+
+// FlagOptions returns the mount flag options set among nosuid, suid,
+// nodev, dev and noexec.
+func (b *BindPath) FlagOptions() []string {
+	var opts []string
+	for opt := range b.Options {
+		if _, ok := bindFlagOptions[opt]; ok {
+			opts = append(opts, opt)
+		}
+	}
+	sort.Strings(opts)
+	return opts
+}
+
+// Device stores a host device passed into the container.
+type Device struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	ReadOnly    bool   `json:"readOnly,omitempty"`
+}
+
 // JSONConfig stores engine specific confguration that is allowed to be set by the user.
 type JSONConfig struct {
 	ScratchDir        []string          `json:"scratchdir,omitempty"`
@@ -111,12 +175,16 @@ type JSONConfig struct {
 	FuseMount         []FuseMount       `json:"fuseMount,omitempty"`
 	ImageList         []image.Image     `json:"imageList,omitempty"`
 	BindPath          []BindPath        `json:"bindpath,omitempty"`
+	Profiles          []string          `json:"profiles,omitempty"`
+	Devices           []Device          `json:"devices,omitempty"`
 	SingularityEnv    map[string]string `json:"singularityEnv,omitempty"`
 	UnixSocketPair    [2]int            `json:"unixSocketPair,omitempty"`
 	OpenFd            []int             `json:"openFd,omitempty"`
 	TargetGID         []int             `json:"targetGID,omitempty"`
 	Image             string            `json:"image"`
 	Workdir           string            `json:"workdir,omitempty"`
+	AppName           string            `json:"appName,omitempty"`
+	ScifData          string            `json:"scifData,omitempty"`
 	CgroupsPath       string            `json:"cgroupsPath,omitempty"`
 	HomeSource        string            `json:"homedir,omitempty"`
 	HomeDest          string            `json:"homeDest,omitempty"`
@@ -129,6 +197,9 @@ type JSONConfig struct {
 	Network           string            `json:"network,omitempty"`
 	DNS               string            `json:"dns,omitempty"`
 	Cwd               string            `json:"cwd,omitempty"`
+	ShmSize           string            `json:"shmSize,omitempty"`
+	TmpMount          string            `json:"tmpMount,omitempty"`
+	VarTmpMount       string            `json:"varTmpMount,omitempty"`
 	SessionLayer      string            `json:"sessionLayer,omitempty"`
 	ConfigurationFile string            `json:"configurationFile,omitempty"`
 	EncryptionKey     []byte            `json:"encryptionKey,omitempty"`
@@ -137,22 +208,45 @@ type JSONConfig struct {
 	WritableTmpfs     bool              `json:"writableTmpfs,omitempty"`
 	Contain           bool              `json:"container,omitempty"`
 	Nv                bool              `json:"nv,omitempty"`
+	NvVisibleDevices  string            `json:"nvVisibleDevices,omitempty"`
 	Rocm              bool              `json:"rocm,omitempty"`
 	CustomHome        bool              `json:"customHome,omitempty"`
+	CustomCwd         bool              `json:"customCwd,omitempty"`
 	Instance          bool              `json:"instance,omitempty"`
 	InstanceJoin      bool              `json:"instanceJoin,omitempty"`
+	InstanceUser      string            `json:"instanceUser,omitempty"`
 	BootInstance      bool              `json:"bootInstance,omitempty"`
 	RunPrivileged     bool              `json:"runPrivileged,omitempty"`
 	AllowSUID         bool              `json:"allowSUID,omitempty"`
+	OverrideSUID      bool              `json:"overrideSUID,omitempty"`
 	KeepPrivs         bool              `json:"keepPrivs,omitempty"`
+	KeepPrivsPrelude  string            `json:"keepPrivsPrelude,omitempty"`
+	ActionCaps        []string          `json:"actionCaps,omitempty"`
 	NoPrivs           bool              `json:"noPrivs,omitempty"`
 	NoHome            bool              `json:"noHome,omitempty"`
 	NoInit            bool              `json:"noInit,omitempty"`
+	NoPivot           bool              `json:"noPivot,omitempty"`
+	ReadOnlyRootfs    bool              `json:"readOnlyRootfs,omitempty"`
 	DeleteTempDir     string            `json:"deleteTempDir,omitempty"`
+	SessionDir        string            `json:"sessionDir,omitempty"`
 	Fakeroot          bool              `json:"fakeroot,omitempty"`
 	SignalPropagation bool              `json:"signalPropagation,omitempty"`
 	RestoreUmask      bool              `json:"restoreUmask,omitempty"`
 	Umask             int               `json:"umask,omitempty"`
+	PidFile           string            `json:"pidFile,omitempty"`
+	BindCgroups       bool              `json:"bindCgroups,omitempty"`
+	Timeout           time.Duration     `json:"timeout,omitempty"`
+	MaxOutput         int               `json:"maxOutput,omitempty"`
+	Rlimits           []string          `json:"rlimits,omitempty"`
+	SanitizePath      bool              `json:"sanitizePath,omitempty"`
+	AllocatePty       bool              `json:"allocatePty,omitempty"`
+	NoFork            bool              `json:"noFork,omitempty"`
+	ScifDataQuota     int               `json:"scifDataQuota,omitempty"`
+	ScifDataImageFd   int               `json:"scifDataImageFd,omitempty"`
+
+	// StartOptions are the instance start options recorded in the
+	// instance file.
+	StartOptions *instance.StartOptions `json:"startOptions,omitempty"`
 }
 
 // SetImage sets the container image path to be used by EngineConfig.JSON.
@@ -215,6 +309,18 @@ func (e *EngineConfig) GetNv() bool {
 	return e.JSON.Nv
 }
 
+// SetNvVisibleDevices sets the CUDA_VISIBLE_DEVICES value of the container
+// process, used to bind only the devices of the listed MIG devices.
+func (e *EngineConfig) SetNvVisibleDevices(visible string) {
+	e.JSON.NvVisibleDevices = visible
+}
+
+// GetNvVisibleDevices returns the CUDA_VISIBLE_DEVICES value of the
+// container process.
+func (e *EngineConfig) GetNvVisibleDevices() string {
+	return e.JSON.NvVisibleDevices
+}
+
 // SetRocm sets rocm flag to bind rocm libraries into containee.JSON.
 func (e *EngineConfig) SetRocm(rocm bool) {
 	e.JSON.Rocm = rocm
@@ -245,6 +351,51 @@ func (e *EngineConfig) GetScratchDir() []string {
 	return e.JSON.ScratchDir
 }
 
+// SetAppName sets the name of the SCIF application run in the container.
+func (e *EngineConfig) SetAppName(name string) {
+	e.JSON.AppName = name
+}
+
+// GetAppName retrieves the name of the SCIF application run in the container.
+func (e *EngineConfig) GetAppName() string {
+	return e.JSON.AppName
+}
+
+// SetScifData sets the host directory bound to the application data directory.
+func (e *EngineConfig) SetScifData(path string) {
+	e.JSON.ScifData = path
+}
+
+// GetScifData retrieves the host directory bound to the application data directory.
+func (e *EngineConfig) GetScifData() string {
+	return e.JSON.ScifData
+}
+
+// SetScifDataQuota sets the size limit in MiB of the application data
+// directory backed by a disk image.
+func (e *EngineConfig) SetScifDataQuota(size int) {
+	e.JSON.ScifDataQuota = size
+}
+
+// GetScifDataQuota retrieves the size limit in MiB of the application data
+// directory backed by a disk image, 0 if it's not limited.
+func (e *EngineConfig) GetScifDataQuota() int {
+	return e.JSON.ScifDataQuota
+}
+
+// SetScifDataImageFd sets the file descriptor of the disk image backing
+// the application data directory limited in size.
+func (e *EngineConfig) SetScifDataImageFd(fd int) {
+	e.JSON.ScifDataImageFd = fd
+}
+
+// GetScifDataImageFd retrieves the file descriptor of the disk image
+// backing the application data directory limited in size, 0 if there is
+// none.
+func (e *EngineConfig) GetScifDataImageFd() int {
+	return e.JSON.ScifDataImageFd
+}
+
 // SetHomeSource sets the source home directory path.
 func (e *EngineConfig) SetHomeSource(source string) {
 	e.JSON.HomeSource = source
@@ -275,6 +426,32 @@ func (e *EngineConfig) GetCustomHome() bool {
 	return e.JSON.CustomHome
 }
 
+// SetCustomCwd sets if the process working directory was requested by the user.
+func (e *EngineConfig) SetCustomCwd(custom bool) {
+	e.JSON.CustomCwd = custom
+}
+
+// GetCustomCwd retrieves if the process working directory was requested by the user.
+func (e *EngineConfig) GetCustomCwd() bool {
+	return e.JSON.CustomCwd
+}
+
+// shmSizeRegexp matches a size with an optional k, m or g unit suffix
+// as accepted by the size option of tmpfs.
+var shmSizeRegexp = regexp.MustCompile(`^[1-9][0-9]*[kKmMgG]?$`)
+
+// CheckShmSize returns an error if size isn't a valid /dev/shm size.
+func CheckShmSize(size string) error {
+	if !shmSizeRegexp.MatchString(size) {
+		return fmt.Errorf("invalid /dev/shm size %q, must be a number optionally followed by k, m or g (e.g. 256M)", size)
+	}
+	return nil
+}
+
+// TmpfsMount is the container temporary directory mount specification
+// requesting a private temporary filesystem.
+const TmpfsMount = "tmpfs"
+
 // ParseBindPath parses a string and returns all encountered
 // bind paths as array.
 func ParseBindPath(bindpaths string) ([]BindPath, error) {
@@ -285,8 +462,16 @@ func ParseBindPath(bindpaths string) ([]BindPath, error) {
 	var validOptions = map[string]bool{
 		"ro":        true,
 		"rw":        true,
+		"optional":  true,
+		"idmap":     true,
+		"nosuid":    true,
+		"suid":      true,
+		"nodev":     true,
+		"dev":       true,
+		"noexec":    true,
 		"image-src": false,
 		"id":        false,
+		"chown":     false,
 	}
 
 	// there is a better regular expression to handle
@@ -300,6 +485,10 @@ func ParseBindPath(bindpaths string) ([]BindPath, error) {
 	// source1:destination1:option1,source2
 	re := regexp.MustCompile(`([^,^:]+:?)`)
 
+	// the value of the chown option holds a colon (chown=uid:gid),
+	// valueContinued is set when the next match is the end of the value
+	valueContinued := false
+
 	// with the regex above we get string array:
 	// - source1 -> [source1]
 	// - source1:destination1 -> [source1:, destination1]
@@ -311,6 +500,11 @@ func ParseBindPath(bindpaths string) ([]BindPath, error) {
 
 		// options are taken only if the bind has a source
 		// and a destination
+		if elem == 2 && valueContinued {
+			bind += s
+			valueContinued = false
+			continue
+		}
 		if elem == 2 {
 			isOption := false
 
@@ -332,6 +526,7 @@ func ParseBindPath(bindpaths string) ([]BindPath, error) {
 					bind += ","
 				}
 				bind += s
+				valueContinued = strings.HasPrefix(s, "chown=") && strings.HasSuffix(s, ":")
 				continue
 			}
 		} else if elem > 2 {
@@ -405,11 +600,80 @@ func newBindPath(bind string, validOptions map[string]bool) (BindPath, error) {
 				return bp, fmt.Errorf("%s is not a valid bind option", value)
 			}
 		}
+
+		if bp.Options["chown"] != nil {
+			if _, _, ok := bp.Chown(); !ok {
+				return bp, fmt.Errorf("invalid chown bind option %q, must be chown=uid:gid with numeric IDs", bp.Options["chown"].Value)
+			}
+			if bp.IDMap() {
+				return bp, fmt.Errorf("bind options chown and idmap are mutually exclusive")
+			}
+		}
+
+		for _, opt := range bp.FlagOptions() {
+			if conflict := bindFlagOptions[opt]; conflict != "" && bp.Options[conflict] != nil {
+				return bp, fmt.Errorf("bind options %s and %s are mutually exclusive", opt, conflict)
+			}
+		}
 	}
 
 	return bp, nil
 }
 
+// ExpandBindPaths returns binds with the bind paths whose source is a
+// wildcard pattern replaced by a bind path for each matching host path,
+// sorted by name. The destination of the matches is the destination of the
+// pattern, or the matching path itself when no destination was given. When
+// the destination ends with a /, each match is bound under its base name in
+// the destination directory, otherwise a single match is allowed. A pattern
+// matching more than maxMatches paths is an error, and patterns are taken
+// literally if maxMatches is 0. A pattern without match is kept if the bind
+// is optional, and is an error otherwise.
+func ExpandBindPaths(binds []BindPath, maxMatches uint) ([]BindPath, error) {
+	expanded := make([]BindPath, 0, len(binds))
+
+	for _, b := range binds {
+		if maxMatches == 0 || b.ImageSrc() != "" || !strings.ContainsAny(b.Source, "*?[") {
+			expanded = append(expanded, b)
+			continue
+		}
+		// an existing path is not a pattern
+		if _, err := os.Stat(b.Source); err == nil {
+			expanded = append(expanded, b)
+			continue
+		}
+
+		matches, err := filepath.Glob(b.Source)
+		if err != nil {
+			return nil, fmt.Errorf("bad bind source pattern %s: %s", b.Source, err)
+		}
+		switch {
+		case len(matches) == 0:
+			if b.Optional() {
+				expanded = append(expanded, b)
+				continue
+			}
+			return nil, fmt.Errorf("no host path matches the bind source %s", b.Source)
+		case uint(len(matches)) > maxMatches:
+			return nil, fmt.Errorf("bind source %s matches %d paths, more than the %d allowed by 'max bind glob matches' in singularity.conf", b.Source, len(matches), maxMatches)
+		case len(matches) > 1 && b.Destination != b.Source && !strings.HasSuffix(b.Destination, "/"):
+			return nil, fmt.Errorf("bind source %s matches %d paths, the destination %s must end with / to bind them under their names", b.Source, len(matches), b.Destination)
+		}
+
+		for _, m := range matches {
+			bp := BindPath{Source: m, Destination: b.Destination, Options: b.Options}
+			if b.Destination == b.Source {
+				bp.Destination = m
+			} else if strings.HasSuffix(b.Destination, "/") {
+				bp.Destination = filepath.Join(b.Destination, filepath.Base(m))
+			}
+			expanded = append(expanded, bp)
+		}
+	}
+
+	return expanded, nil
+}
+
 // SetBindPath sets the paths to bind into container.
 func (e *EngineConfig) SetBindPath(bindpath []BindPath) {
 	e.JSON.BindPath = bindpath
@@ -420,6 +684,59 @@ func (e *EngineConfig) GetBindPath() []BindPath {
 	return e.JSON.BindPath
 }
 
+// SetProfiles sets the names of the bind profiles applied to the
+// container, their binds are read by the engine from the profiles
+// defined by the administrator.
+func (e *EngineConfig) SetProfiles(profiles []string) {
+	e.JSON.Profiles = profiles
+}
+
+// GetProfiles retrieves the names of the bind profiles.
+func (e *EngineConfig) GetProfiles() []string {
+	return e.JSON.Profiles
+}
+
+// ParseDevice parses a device specification of the form
+// source[:destination][:ro|rw], the destination defaults to the source
+// and must be in /dev, devices are writable unless ro is set.
+func ParseDevice(device string) (Device, error) {
+	var d Device
+
+	parts := strings.Split(device, ":")
+	if n := len(parts); n > 1 && (parts[n-1] == "ro" || parts[n-1] == "rw") {
+		d.ReadOnly = parts[n-1] == "ro"
+		parts = parts[:n-1]
+	}
+	if len(parts) > 2 {
+		return d, fmt.Errorf("wrong device syntax %q, must be source[:destination][:ro|rw]", device)
+	}
+
+	d.Source = parts[0]
+	d.Destination = d.Source
+	if len(parts) > 1 {
+		d.Destination = parts[1]
+	}
+	if !filepath.IsAbs(d.Source) {
+		return d, fmt.Errorf("device source %q must be an absolute path", d.Source)
+	}
+	d.Destination = filepath.Clean(d.Destination)
+	if !strings.HasPrefix(d.Destination, "/dev/") {
+		return d, fmt.Errorf("device destination %q must be in /dev", d.Destination)
+	}
+
+	return d, nil
+}
+
+// SetDevices sets the host devices passed into the container.
+func (e *EngineConfig) SetDevices(devices []Device) {
+	e.JSON.Devices = devices
+}
+
+// GetDevices retrieves the host devices passed into the container.
+func (e *EngineConfig) GetDevices() []Device {
+	return e.JSON.Devices
+}
+
 // SetCommand sets action command to execute.
 func (e *EngineConfig) SetCommand(command string) {
 	e.JSON.Command = command
@@ -470,6 +787,18 @@ func (e *EngineConfig) GetInstanceJoin() bool {
 	return e.JSON.InstanceJoin
 }
 
+// SetInstanceUser sets the user owning the joined instance when root joins
+// an instance of another user.
+func (e *EngineConfig) SetInstanceUser(username string) {
+	e.JSON.InstanceUser = username
+}
+
+// GetInstanceUser returns the user owning the joined instance, or an empty
+// string for an instance of the current user.
+func (e *EngineConfig) GetInstanceUser() string {
+	return e.JSON.InstanceUser
+}
+
 // SetBootInstance sets boot flag to execute /sbin/init as main instance process.
 func (e *EngineConfig) SetBootInstance(boot bool) {
 	e.JSON.BootInstance = boot
@@ -480,6 +809,16 @@ func (e *EngineConfig) GetBootInstance() bool {
 	return e.JSON.BootInstance
 }
 
+// SetStartOptions sets the instance start options.
+func (e *EngineConfig) SetStartOptions(options *instance.StartOptions) {
+	e.JSON.StartOptions = options
+}
+
+// GetStartOptions returns the instance start options.
+func (e *EngineConfig) GetStartOptions() *instance.StartOptions {
+	return e.JSON.StartOptions
+}
+
 // SetAddCaps sets bounding/effective/permitted/inheritable/ambient capabilities to add.
 func (e *EngineConfig) SetAddCaps(caps string) {
 	e.JSON.AddCaps = caps
@@ -520,6 +859,18 @@ func (e *EngineConfig) GetAllowSUID() bool {
 	return e.JSON.AllowSUID
 }
 
+// SetOverrideSUIDPolicy sets the override-setuid-policy flag to honor
+// allow-suid when the deny setuid binaries directive is enabled.
+func (e *EngineConfig) SetOverrideSUIDPolicy(override bool) {
+	e.JSON.OverrideSUID = override
+}
+
+// GetOverrideSUIDPolicy returns true if override-setuid-policy is set
+// and false if not.
+func (e *EngineConfig) GetOverrideSUIDPolicy() bool {
+	return e.JSON.OverrideSUID
+}
+
 // SetKeepPrivs sets keep-privs flag to allow root to retain all privileges.
 func (e *EngineConfig) SetKeepPrivs(keep bool) {
 	e.JSON.KeepPrivs = keep
@@ -530,6 +881,30 @@ func (e *EngineConfig) GetKeepPrivs() bool {
 	return e.JSON.KeepPrivs
 }
 
+// SetKeepPrivsPrelude sets the command run with the root user privileges
+// kept before the action command, which runs without them.
+func (e *EngineConfig) SetKeepPrivsPrelude(command string) {
+	e.JSON.KeepPrivsPrelude = command
+}
+
+// GetKeepPrivsPrelude returns the command run with the root user
+// privileges kept before the action command.
+func (e *EngineConfig) GetKeepPrivsPrelude() string {
+	return e.JSON.KeepPrivsPrelude
+}
+
+// SetActionCaps sets the capabilities retained by the action command
+// once the keep-privs prelude command ran.
+func (e *EngineConfig) SetActionCaps(caps []string) {
+	e.JSON.ActionCaps = caps
+}
+
+// GetActionCaps returns the capabilities retained by the action command
+// once the keep-privs prelude command ran.
+func (e *EngineConfig) GetActionCaps() []string {
+	return e.JSON.ActionCaps
+}
+
 // SetNoPrivs sets no-privs flag to force root user to lose all privileges.
 func (e *EngineConfig) SetNoPrivs(nopriv bool) {
 	e.JSON.NoPrivs = nopriv
@@ -620,6 +995,63 @@ func (e *EngineConfig) GetOpenFd() []int {
 	return e.JSON.OpenFd
 }
 
+// SetNoPivot sets if the container root is established with chroot
+// instead of pivot_root.
+func (e *EngineConfig) SetNoPivot(val bool) {
+	e.JSON.NoPivot = val
+}
+
+// GetNoPivot returns if the container root is established with chroot
+// instead of pivot_root.
+func (e *EngineConfig) GetNoPivot() bool {
+	return e.JSON.NoPivot
+}
+
+// SetReadOnlyRootfs sets if the container root filesystem is read-only
+// whatever the overlay configuration, overlay images are then only used
+// as lower layers.
+func (e *EngineConfig) SetReadOnlyRootfs(val bool) {
+	e.JSON.ReadOnlyRootfs = val
+}
+
+// GetReadOnlyRootfs returns if the container root filesystem is read-only
+// whatever the overlay configuration.
+func (e *EngineConfig) GetReadOnlyRootfs() bool {
+	return e.JSON.ReadOnlyRootfs
+}
+
+// SetShmSize sets the size of the container /dev/shm temporary filesystem.
+func (e *EngineConfig) SetShmSize(size string) {
+	e.JSON.ShmSize = size
+}
+
+// GetShmSize returns the size of the container /dev/shm temporary filesystem.
+func (e *EngineConfig) GetShmSize() string {
+	return e.JSON.ShmSize
+}
+
+// SetTmpMount sets the mount of the container /tmp directory, a host
+// directory or TmpfsMount for a private temporary filesystem.
+func (e *EngineConfig) SetTmpMount(spec string) {
+	e.JSON.TmpMount = spec
+}
+
+// GetTmpMount returns the mount of the container /tmp directory.
+func (e *EngineConfig) GetTmpMount() string {
+	return e.JSON.TmpMount
+}
+
+// SetVarTmpMount sets the mount of the container /var/tmp directory, a
+// host directory or TmpfsMount for a private temporary filesystem.
+func (e *EngineConfig) SetVarTmpMount(spec string) {
+	e.JSON.VarTmpMount = spec
+}
+
+// GetVarTmpMount returns the mount of the container /var/tmp directory.
+func (e *EngineConfig) GetVarTmpMount() string {
+	return e.JSON.VarTmpMount
+}
+
 // SetWritableTmpfs sets writable tmpfs flag.
 func (e *EngineConfig) SetWritableTmpfs(writable bool) {
 	e.JSON.WritableTmpfs = writable
@@ -725,6 +1157,18 @@ func (e *EngineConfig) SetDeleteTempDir(dir string) {
 	e.JSON.DeleteTempDir = dir
 }
 
+// SetSessionDir sets dir as the directory where the session directory
+// is stored on disk, overriding the sessiondir configuration directives.
+func (e *EngineConfig) SetSessionDir(dir string) {
+	e.JSON.SessionDir = dir
+}
+
+// GetSessionDir returns the directory where the session directory is
+// stored on disk, or an empty string if it's not overridden.
+func (e *EngineConfig) GetSessionDir() string {
+	return e.JSON.SessionDir
+}
+
 // SetSignalPropagation sets if engine must propagate signals from
 // master process -> container process when PID namespace is disabled
 // or from master process -> sinit process -> container
@@ -853,3 +1297,98 @@ func (e *EngineConfig) SetUmask(umask int) {
 func (e *EngineConfig) GetUmask() int {
 	return e.JSON.Umask
 }
+
+// SetPidFile sets the path of the file receiving the host PID of the
+// container process.
+func (e *EngineConfig) SetPidFile(path string) {
+	e.JSON.PidFile = path
+}
+
+// GetPidFile returns the path of the file receiving the host PID of the
+// container process.
+func (e *EngineConfig) GetPidFile() string {
+	return e.JSON.PidFile
+}
+
+// SetBindCgroups sets if the host cgroup v2 hierarchy is bound read-write
+// in the container.
+func (e *EngineConfig) SetBindCgroups(bind bool) {
+	e.JSON.BindCgroups = bind
+}
+
+// GetBindCgroups returns if the host cgroup v2 hierarchy is bound read-write
+// in the container.
+func (e *EngineConfig) GetBindCgroups() bool {
+	return e.JSON.BindCgroups
+}
+
+// SetTimeout sets the wall-clock time limit of the container process,
+// counted from the execution of the action command.
+func (e *EngineConfig) SetTimeout(timeout time.Duration) {
+	e.JSON.Timeout = timeout
+}
+
+// GetTimeout returns the wall-clock time limit of the container process.
+func (e *EngineConfig) GetTimeout() time.Duration {
+	return e.JSON.Timeout
+}
+
+// SetMaxOutput sets the maximum number of bytes of the container process
+// standard output and error, when they are not a terminal.
+func (e *EngineConfig) SetMaxOutput(size int) {
+	e.JSON.MaxOutput = size
+}
+
+// GetMaxOutput returns the maximum number of bytes of the container
+// process standard output and error.
+func (e *EngineConfig) GetMaxOutput() int {
+	return e.JSON.MaxOutput
+}
+
+// SetRlimits sets the resource limits requested for the container process
+// (e.g. nofile=65536:65536).
+func (e *EngineConfig) SetRlimits(limits []string) {
+	e.JSON.Rlimits = limits
+}
+
+// GetRlimits returns the resource limits requested for the container
+// process.
+func (e *EngineConfig) GetRlimits() []string {
+	return e.JSON.Rlimits
+}
+
+// SetSanitizePath sets if the PATH of the container process is reset to
+// the default container PATH once the container environment is set.
+func (e *EngineConfig) SetSanitizePath(sanitize bool) {
+	e.JSON.SanitizePath = sanitize
+}
+
+// GetSanitizePath returns if the PATH of the container process is reset
+// to the default container PATH.
+func (e *EngineConfig) GetSanitizePath() bool {
+	return e.JSON.SanitizePath
+}
+
+// SetAllocatePty sets if the container process runs in a pseudo terminal
+// allocated in the container.
+func (e *EngineConfig) SetAllocatePty(allocate bool) {
+	e.JSON.AllocatePty = allocate
+}
+
+// GetAllocatePty returns if the container process runs in a pseudo
+// terminal allocated in the container.
+func (e *EngineConfig) GetAllocatePty() bool {
+	return e.JSON.AllocatePty
+}
+
+// SetNoFork sets if the container process must be executed by the
+// container process of the starter, without a supervising process.
+func (e *EngineConfig) SetNoFork(noFork bool) {
+	e.JSON.NoFork = noFork
+}
+
+// GetNoFork returns if the container process must be executed by the
+// container process of the starter, without a supervising process.
+func (e *EngineConfig) GetNoFork() bool {
+	return e.JSON.NoFork
+}
@@ -0,0 +1,252 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBindPathOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		bind     string
+		readonly bool
+		idmap    bool
+		flags    []string
+		wantErr  bool
+	}{
+		{
+			name: "NoOption",
+			bind: "/src:/dst",
+		},
+		{
+			name:     "ReadOnlyFlags",
+			bind:     "/src:/dst:ro,nosuid,nodev",
+			readonly: true,
+			flags:    []string{"nodev", "nosuid"},
+		},
+		{
+			name:  "IDMapNoexec",
+			bind:  "/src:/dst:idmap,noexec",
+			idmap: true,
+			flags: []string{"noexec"},
+		},
+		{
+			name:  "Relax",
+			bind:  "/src:/dst:suid,dev",
+			flags: []string{"dev", "suid"},
+		},
+		{
+			name:    "ConflictSuid",
+			bind:    "/src:/dst:suid,nosuid",
+			wantErr: true,
+		},
+		{
+			name:    "ConflictDev",
+			bind:    "/src:/dst:nodev,dev",
+			wantErr: true,
+		},
+		{
+			name:    "Unknown",
+			bind:    "/src:/dst:nosetuid",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			binds, err := ParseBindPath(tt.bind)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(binds) != 1 {
+				t.Fatalf("got %d bind paths instead of 1", len(binds))
+			}
+			b := binds[0]
+			if b.Readonly() != tt.readonly || b.IDMap() != tt.idmap {
+				t.Errorf("got readonly=%v idmap=%v, expected %v and %v", b.Readonly(), b.IDMap(), tt.readonly, tt.idmap)
+			}
+			if got := b.FlagOptions(); !reflect.DeepEqual(got, tt.flags) {
+				t.Errorf("got flag options %v, expected %v", got, tt.flags)
+			}
+		})
+	}
+}
+
+func TestParseBindPathChown(t *testing.T) {
+	tests := []struct {
+		name    string
+		bind    string
+		want    []BindPath
+		wantErr bool
+	}{
+		{
+			name: "Chown",
+			bind: "/src:/dst:chown=1001:1002",
+			want: []BindPath{
+				{Source: "/src", Destination: "/dst", Options: map[string]*BindOption{"chown": {Value: "1001:1002"}}},
+			},
+		},
+		{
+			name: "ChownOptions",
+			bind: "/src:/dst:ro,chown=1001:1002,noexec,/other",
+			want: []BindPath{
+				{Source: "/src", Destination: "/dst", Options: map[string]*BindOption{"ro": {}, "chown": {Value: "1001:1002"}, "noexec": {}}},
+				{Source: "/other", Destination: "/other"},
+			},
+		},
+		{
+			name:    "NoGID",
+			bind:    "/src:/dst:chown=1001",
+			wantErr: true,
+		},
+		{
+			name:    "Names",
+			bind:    "/src:/dst:chown=user:group",
+			wantErr: true,
+		},
+		{
+			name:    "IDMap",
+			bind:    "/src:/dst:chown=1001:1001,idmap",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			binds, err := ParseBindPath(tt.bind)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(binds, tt.want) {
+				t.Fatalf("got %+v, expected %+v", binds, tt.want)
+			}
+			if uid, gid, ok := binds[0].Chown(); !ok || uid != 1001 || gid != 1002 {
+				t.Errorf("got chown %d:%d (%v), expected 1001:1002", uid, gid, ok)
+			}
+		})
+	}
+}
+
+func TestExpandBindPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bind-glob-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, d := range []string{"job-1", "job-2", "job-3", "other", "literal[1]"} {
+		if err := os.Mkdir(filepath.Join(dir, d), 0755); err != nil {
+			t.Fatalf("failed to create %s: %s", d, err)
+		}
+	}
+	job := func(n string) string {
+		return filepath.Join(dir, "job-"+n)
+	}
+
+	tests := []struct {
+		name       string
+		bind       string
+		maxMatches uint
+		want       []BindPath
+		wantErr    string
+	}{
+		{
+			name:       "TrailingDestination",
+			bind:       filepath.Join(dir, "job-*") + ":/scratch/:ro",
+			maxMatches: 64,
+			want: []BindPath{
+				{Source: job("1"), Destination: "/scratch/job-1", Options: map[string]*BindOption{"ro": {}}},
+				{Source: job("2"), Destination: "/scratch/job-2", Options: map[string]*BindOption{"ro": {}}},
+				{Source: job("3"), Destination: "/scratch/job-3", Options: map[string]*BindOption{"ro": {}}},
+			},
+		},
+		{
+			name:       "NoDestination",
+			bind:       filepath.Join(dir, "job-[12]"),
+			maxMatches: 64,
+			want: []BindPath{
+				{Source: job("1"), Destination: job("1")},
+				{Source: job("2"), Destination: job("2")},
+			},
+		},
+		{
+			name:       "NoMatch",
+			bind:       filepath.Join(dir, "job-?3") + ":/job",
+			maxMatches: 64,
+			wantErr:    "no host path matches",
+		},
+		{
+			name:       "SingleMatchDestination",
+			bind:       filepath.Join(dir, "oth*") + ":/job",
+			maxMatches: 64,
+			want:       []BindPath{{Source: filepath.Join(dir, "other"), Destination: "/job"}},
+		},
+		{
+			name:       "MultipleMatchesDestination",
+			bind:       filepath.Join(dir, "job-*") + ":/job",
+			maxMatches: 64,
+			wantErr:    "must end with /",
+		},
+		{
+			name:       "TooManyMatches",
+			bind:       filepath.Join(dir, "job-*") + ":/scratch/",
+			maxMatches: 2,
+			wantErr:    "matches 3 paths, more than the 2 allowed",
+		},
+		{
+			name:       "Disabled",
+			bind:       filepath.Join(dir, "job-*") + ":/scratch/",
+			maxMatches: 0,
+			want:       []BindPath{{Source: filepath.Join(dir, "job-*"), Destination: "/scratch/"}},
+		},
+		{
+			name:       "Literal",
+			bind:       filepath.Join(dir, "literal[1]") + ":/literal",
+			maxMatches: 64,
+			want:       []BindPath{{Source: filepath.Join(dir, "literal[1]"), Destination: "/literal"}},
+		},
+		{
+			name:       "Optional",
+			bind:       filepath.Join(dir, "missing-*") + ":/missing/:optional",
+			maxMatches: 64,
+			want:       []BindPath{{Source: filepath.Join(dir, "missing-*"), Destination: "/missing/", Options: map[string]*BindOption{"optional": {}}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			binds, err := ParseBindPath(tt.bind)
+			if err != nil {
+				t.Fatalf("unexpected error while parsing %s: %s", tt.bind, err)
+			}
+			got, err := ExpandBindPaths(binds, tt.maxMatches)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, expected %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got bind paths %+v, expected %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -21,6 +21,10 @@ const (
 	RemoteConfFile = "remote.yaml"
 	RemoteCache    = "remote-cache"
 	DockerConfFile = "docker-config.json"
+	UploadState    = "upload-state"
+	ShellHistory   = "shell_history"
+	InstanceOpts   = "instance-options"
+	TUFState       = "tuf-state"
 	singularityDir = ".singularity"
 )
 
@@ -67,6 +71,30 @@ func RemoteCacheDir() string {
 	return filepath.Join(ConfigDir(), RemoteCache)
 }
 
+// UploadStateDir returns the directory holding the state of
+// interrupted library uploads.
+func UploadStateDir() string {
+	return filepath.Join(ConfigDir(), UploadState)
+}
+
+// ShellHistoryDir returns the directory holding the history files
+// of the shells started in containers by the current user.
+func ShellHistoryDir() string {
+	return filepath.Join(ConfigDir(), ShellHistory)
+}
+
+// InstanceOptionsDir returns the directory holding the options files
+// of the instances managed by systemd user units.
+func InstanceOptionsDir() string {
+	return filepath.Join(ConfigDir(), InstanceOpts)
+}
+
+// TUFStateDir returns the directory holding the versions of the
+// freshness metadata trusted by the current user.
+func TUFStateDir() string {
+	return filepath.Join(ConfigDir(), TUFState)
+}
+
 func DockerConf() string {
 	return filepath.Join(ConfigDir(), DockerConfFile)
 }
@@ -0,0 +1,150 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package sypgp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// timeNow returns the current time, it's overridden by tests.
+var timeNow = time.Now
+
+// cacheEntry records when a cached key was retrieved from a keyserver.
+type cacheEntry struct {
+	Fetched time.Time `json:"fetched"`
+}
+
+// keyCache holds the public keys retrieved from a keyserver. Cached keys are kept apart from the
+// local public keyring, as their trust was never verified by the user.
+type keyCache struct {
+	h       *Handle
+	keys    openpgp.EntityList
+	entries map[string]cacheEntry // Cache entries, by primary key fingerprint.
+}
+
+// CachePath returns a string describing the path to the cache of public keys retrieved from a
+// keyserver.
+func (keyring *Handle) CachePath() string {
+	return filepath.Join(keyring.path, "pgp-cache")
+}
+
+// cacheIndexPath returns a string describing the path to the index of the public keys cache.
+func (keyring *Handle) cacheIndexPath() string {
+	return filepath.Join(keyring.path, "pgp-cache.json")
+}
+
+// loadKeyCache loads the cache of public keys retrieved from a keyserver, which is empty if it
+// doesn't exist yet.
+func loadKeyCache(keyring *Handle) (*keyCache, error) {
+	c := &keyCache{
+		h:       keyring,
+		entries: make(map[string]cacheEntry),
+	}
+
+	b, err := ioutil.ReadFile(keyring.cacheIndexPath())
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &c.entries); err != nil {
+		return nil, fmt.Errorf("while decoding key cache index: %s", err)
+	}
+
+	c.keys, err = loadKeyring(keyring.CachePath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return c, nil
+}
+
+// lookup returns the cached entities that have the given key id, and when the oldest of them was
+// retrieved from the keyserver.
+func (c *keyCache) lookup(id uint64) (openpgp.EntityList, time.Time) {
+	var el openpgp.EntityList
+	var fetched time.Time
+
+	for _, e := range c.keys {
+		entry, ok := c.entries[fmt.Sprintf("%X", e.PrimaryKey.Fingerprint)]
+		if !ok || len(openpgp.EntityList{e}.KeysById(id)) == 0 {
+			continue
+		}
+		if len(el) == 0 || entry.Fetched.Before(fetched) {
+			fetched = entry.Fetched
+		}
+		el = append(el, e)
+	}
+	return el, fetched
+}
+
+// store adds the entities in el, retrieved from the keyserver at time t, to the cache, replacing
+// any previously cached copy.
+func (c *keyCache) store(el openpgp.EntityList, t time.Time) error {
+	for _, e := range el {
+		fp := fmt.Sprintf("%X", e.PrimaryKey.Fingerprint)
+		if keys := removeKey(c.keys, fp); keys != nil {
+			c.keys = keys
+		}
+		c.keys = append(c.keys, e)
+		c.entries[fp] = cacheEntry{Fetched: t}
+	}
+
+	if err := ensureDirPrivate(c.h.path); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+
+	// The keys are replaced before the index, so that an interrupted store never makes a stale
+	// cached key look freshly retrieved.
+	err = c.h.writeAtomic(c.h.CachePath(), func(w io.Writer) error {
+		return storePubKeys(w, c.keys)
+	})
+	if err != nil {
+		return fmt.Errorf("could not store cached keys: %s", err)
+	}
+	err = c.h.writeAtomic(c.h.cacheIndexPath(), func(w io.Writer) error {
+		_, err := w.Write(b)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not store key cache index: %s", err)
+	}
+	return nil
+}
+
+// writeAtomic writes the content written by fn to a temporary file in the keyring directory
+// which then replaces path, so that readers never see a partially written file.
+func (keyring *Handle) writeAtomic(path string, fn func(io.Writer) error) error {
+	f, err := ioutil.TempFile(keyring.path, filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	err = fn(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package sypgp
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sylabs/scs-key-client/client"
+	"golang.org/x/crypto/openpgp"
+)
+
+func TestKeyCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sypgp-cache-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h := NewHandle(dir)
+	id := testEntity.PrimaryKey.KeyId
+	fetched := time.Date(2020, time.October, 1, 12, 0, 0, 0, time.UTC)
+
+	c, err := loadKeyCache(h)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if el, _ := c.lookup(id); len(el) != 0 {
+		t.Fatalf("got %d cached entities in an empty cache", len(el))
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := c.store(openpgp.EntityList{testEntity}, fetched); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	c, err = loadKeyCache(h)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	el, got := c.lookup(id)
+	if len(el) != 1 {
+		t.Fatalf("got %d cached entities, want 1", len(el))
+	}
+	if el[0].PrimaryKey.Fingerprint != testEntity.PrimaryKey.Fingerprint {
+		t.Errorf("got cached key %X, want %X", el[0].PrimaryKey.Fingerprint, testEntity.PrimaryKey.Fingerprint)
+	}
+	if !got.Equal(fetched) {
+		t.Errorf("got fetch time %s, want %s", got, fetched)
+	}
+	if el, _ := c.lookup(id + 1); len(el) != 0 {
+		t.Errorf("got %d cached entities for an unknown key", len(el))
+	}
+
+	// cached keys must not end up in the local public keyring
+	if _, err := os.Stat(h.PublicPath()); !os.IsNotExist(err) {
+		t.Errorf("public keyring created by the key cache: %v", err)
+	}
+
+	if err := ioutil.WriteFile(h.cacheIndexPath(), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadKeyCache(h); err == nil {
+		t.Errorf("unexpected success with corrupted cache index")
+	}
+}
+
+func TestHybridKeyRingCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sypgp-hybrid-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(old string) { os.Setenv("SINGULARITY_SYPGPDIR", old) }(os.Getenv("SINGULARITY_SYPGPDIR"))
+	os.Setenv("SINGULARITY_SYPGPDIR", dir)
+
+	ms := &mockPKSLookup{el: openpgp.EntityList{testEntity}}
+	requests := 0
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		ms.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	config := &client.Config{
+		BaseURL:    srv.URL,
+		HTTPClient: srv.Client(),
+	}
+
+	// a keyserver which can't be reached
+	down := httptest.NewTLSServer(http.NotFoundHandler())
+	down.Close()
+	downConfig := &client.Config{
+		BaseURL:    down.URL,
+		HTTPClient: down.Client(),
+	}
+
+	start := time.Date(2020, time.October, 1, 12, 0, 0, 0, time.UTC)
+	defer func(old func() time.Time) { timeNow = old }(timeNow)
+
+	id := testEntity.PrimaryKey.KeyId
+
+	tests := []struct {
+		name     string
+		elapsed  time.Duration
+		code     int
+		down     bool
+		opts     []HybridKeyRingOpt
+		wantKeys int
+		requests int
+	}{
+		{"Fetch", 0, http.StatusOK, false, nil, 1, 1},
+		{"Fresh", 30 * time.Minute, http.StatusInternalServerError, false, nil, 1, 0},
+		{"Refresh", 30 * time.Minute, http.StatusOK, false, []HybridKeyRingOpt{OptRefreshKeys()}, 1, 1},
+		{"ExpiredUnreachable", 2 * time.Hour, http.StatusOK, true, nil, 1, 0},
+		{"ExpiredUnreachableStrict", 2 * time.Hour, http.StatusOK, true, []HybridKeyRingOpt{OptStrictKeyFreshness()}, 0, 0},
+		{"ExpiredServerError", 2 * time.Hour, http.StatusInternalServerError, false, nil, 0, 1},
+		{"Expired", 2 * time.Hour, http.StatusOK, false, []HybridKeyRingOpt{OptStrictKeyFreshness()}, 1, 1},
+		{"Refetched", 2*time.Hour + 30*time.Minute, http.StatusInternalServerError, false, nil, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms.code = tt.code
+			requests = 0
+			timeNow = func() time.Time { return start.Add(tt.elapsed) }
+
+			cfg := config
+			if tt.down {
+				cfg = downConfig
+			}
+			opts := append([]HybridKeyRingOpt{OptKeyCacheTTL(time.Hour)}, tt.opts...)
+			kr, err := NewHybridKeyRing(context.Background(), cfg, opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			// the keyserver is contacted at most once per key
+			for i := 0; i < 2; i++ {
+				if keys := kr.KeysById(id); len(keys) != tt.wantKeys {
+					t.Errorf("got %d keys, want %d", len(keys), tt.wantKeys)
+				}
+			}
+			if requests != tt.requests {
+				t.Errorf("got %d keyserver requests, want %d", requests, tt.requests)
+			}
+		})
+	}
+}
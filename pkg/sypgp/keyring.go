@@ -9,8 +9,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	jsonresp "github.com/sylabs/json-resp"
 	"github.com/sylabs/scs-key-client/client"
@@ -26,14 +29,49 @@ func PublicKeyRing() (openpgp.KeyRing, error) {
 // hybridKeyRing is keyring made up of a local keyring as well as a keyserver. The type satisfies
 // the openpgp.KeyRing interface.
 type hybridKeyRing struct {
-	local openpgp.KeyRing // Local keyring.
-	ctx   context.Context // Context, for use when retrieving keys remotely.
-	c     *client.Client  // Keyserver client.
+	local   openpgp.KeyRing               // Local keyring.
+	ctx     context.Context               // Context, for use when retrieving keys remotely.
+	c       *client.Client                // Keyserver client.
+	cache   *keyCache                     // Cache of keys retrieved remotely, nil if disabled.
+	ttl     time.Duration                 // Time after which cached keys are retrieved again.
+	refresh bool                          // Retrieve keys remotely even if cached keys are fresh.
+	strict  bool                          // Reject expired cached keys if the keyserver fails.
+	fetched map[uint64]openpgp.EntityList // Remote entities looked up so far, by key id.
+}
+
+// HybridKeyRingOpt are used to configure a hybrid keyring.
+type HybridKeyRingOpt func(kr *hybridKeyRing) error
+
+// OptKeyCacheTTL caches the keys retrieved from the keyserver, and uses cached keys retrieved
+// less than ttl ago instead of contacting the keyserver. Cached keys are stored apart from the
+// local public keyring as their trust isn't verified.
+func OptKeyCacheTTL(ttl time.Duration) HybridKeyRingOpt {
+	return func(kr *hybridKeyRing) error {
+		kr.ttl = ttl
+		return nil
+	}
+}
+
+// OptRefreshKeys retrieves keys from the keyserver even if a fresh copy is cached.
+func OptRefreshKeys() HybridKeyRingOpt {
+	return func(kr *hybridKeyRing) error {
+		kr.refresh = true
+		return nil
+	}
+}
+
+// OptStrictKeyFreshness rejects cached keys which can't be retrieved again from the keyserver
+// once expired. By default, a warning is emitted and the cached keys are used.
+func OptStrictKeyFreshness() HybridKeyRingOpt {
+	return func(kr *hybridKeyRing) error {
+		kr.strict = true
+		return nil
+	}
 }
 
 // NewHybridKeyRing returns a keyring backed by both the local public keyring and the configured
 // keyserver.
-func NewHybridKeyRing(ctx context.Context, cfg *client.Config) (openpgp.KeyRing, error) {
+func NewHybridKeyRing(ctx context.Context, cfg *client.Config, opts ...HybridKeyRingOpt) (openpgp.KeyRing, error) {
 	// Get local keyring.
 	kr, err := PublicKeyRing()
 	if err != nil {
@@ -46,11 +84,26 @@ func NewHybridKeyRing(ctx context.Context, cfg *client.Config) (openpgp.KeyRing,
 		return nil, err
 	}
 
-	return &hybridKeyRing{
-		local: kr,
-		ctx:   ctx,
-		c:     c,
-	}, nil
+	hkr := &hybridKeyRing{
+		local:   kr,
+		ctx:     ctx,
+		c:       c,
+		fetched: make(map[uint64]openpgp.EntityList),
+	}
+	for _, opt := range opts {
+		if err := opt(hkr); err != nil {
+			return nil, err
+		}
+	}
+
+	if hkr.ttl > 0 {
+		// A damaged cache shouldn't prevent retrieving keys from the keyserver.
+		if hkr.cache, err = loadKeyCache(NewHandle("")); err != nil {
+			sylog.Warningf("Ignoring key cache: %v", err)
+		}
+	}
+
+	return hkr, nil
 }
 
 // KeysById returns the set of keys that have the given key id.
@@ -60,13 +113,8 @@ func (kr *hybridKeyRing) KeysById(id uint64) []openpgp.Key {
 		return keys
 	}
 
-	// No keys found in local keyring, check with keyserver.
-	el, err := kr.remoteEntitiesByID(id)
-	if err != nil {
-		sylog.Warningf("failed to get key material: %v", err)
-		return nil
-	}
-	return el.KeysById(id)
+	// No keys found in local keyring, check with cache and keyserver.
+	return kr.entitiesByID(id).KeysById(id)
 }
 
 // KeysByIdUsage returns the set of keys with the given id that also meet the key usage given by
@@ -77,13 +125,8 @@ func (kr *hybridKeyRing) KeysByIdUsage(id uint64, requiredUsage byte) []openpgp.
 		return keys
 	}
 
-	// No keys found in local keyring, check with keyserver.
-	el, err := kr.remoteEntitiesByID(id)
-	if err != nil {
-		sylog.Warningf("failed to get key material: %v", err)
-		return nil
-	}
-	return el.KeysByIdUsage(id, requiredUsage)
+	// No keys found in local keyring, check with cache and keyserver.
+	return kr.entitiesByID(id).KeysByIdUsage(id, requiredUsage)
 }
 
 // DecryptionKeys returns all private keys that are valid for decryption.
@@ -91,6 +134,69 @@ func (kr *hybridKeyRing) DecryptionKeys() []openpgp.Key {
 	return kr.local.DecryptionKeys()
 }
 
+// entitiesByID returns the set of entities, from the cache or the keyserver, that have the given
+// key id. The keyserver is contacted at most once per key id.
+func (kr *hybridKeyRing) entitiesByID(id uint64) openpgp.EntityList {
+	if el, ok := kr.fetched[id]; ok {
+		return el
+	}
+	el := kr.cachedOrRemoteEntitiesByID(id)
+	kr.fetched[id] = el
+	return el
+}
+
+// cachedOrRemoteEntitiesByID returns the set of entities that have the given key id, from the
+// cache if they were retrieved less than the cache TTL ago, otherwise from the keyserver.
+func (kr *hybridKeyRing) cachedOrRemoteEntitiesByID(id uint64) openpgp.EntityList {
+	var cached openpgp.EntityList
+	var fetched time.Time
+
+	if kr.cache != nil {
+		cached, fetched = kr.cache.lookup(id)
+		if len(cached) > 0 && !kr.refresh && timeNow().Sub(fetched) < kr.ttl {
+			sylog.Debugf("Using cached key %X (unverified trust) retrieved at %s", id, fetched)
+			return cached
+		}
+	}
+
+	el, err := kr.remoteEntitiesByID(id)
+	if err != nil {
+		// Only an unreachable keyserver falls back to the cache, an error response could be
+		// the keyserver refusing to serve a revoked key.
+		if len(cached) == 0 || !unreachable(err) {
+			sylog.Warningf("failed to get key material: %v", err)
+			return nil
+		}
+
+		age := timeNow().Sub(fetched).Round(time.Second)
+		if kr.strict {
+			sylog.Warningf("failed to refresh cached key %X retrieved %s ago: %v", id, age, err)
+			return nil
+		}
+		sylog.Warningf("failed to refresh key %X, using cached copy retrieved %s ago which may have been revoked since: %v", id, age, err)
+		return cached
+	}
+
+	if kr.cache != nil {
+		if err := kr.cache.store(el, timeNow()); err != nil {
+			sylog.Warningf("failed to cache key material: %v", err)
+		}
+	}
+	return el
+}
+
+// unreachable returns true if err reports that the keyserver couldn't be reached, as opposed to
+// an error response from the keyserver or a connection that couldn't be trusted.
+func unreachable(err error) bool {
+	var uerr *url.Error
+	if errors.As(err, &uerr) && uerr.Timeout() {
+		return true
+	}
+	var operr *net.OpError
+	var dnserr *net.DNSError
+	return errors.As(err, &operr) || errors.As(err, &dnserr)
+}
+
 // remoteEntitiesByID returns the set of entities from the keyserver that have the given key id.
 func (kr *hybridKeyRing) remoteEntitiesByID(id uint64) (openpgp.EntityList, error) {
 	kt, err := kr.c.PKSLookup(kr.ctx, nil, fmt.Sprintf("%#x", id), client.OperationGet, false, true, nil)
@@ -21,7 +21,6 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
-	"syscall"
 	"text/tabwriter"
 	"time"
 
@@ -135,12 +134,12 @@ func (keyring *Handle) PublicPath() string {
 func ensureDirPrivate(dn string) error {
 	mode := os.FileMode(0700)
 
-	oldumask := syscall.Umask(0077)
+	oldumask := umask(0077)
 
 	err := os.MkdirAll(dn, mode)
 
 	// restore umask...
-	syscall.Umask(oldumask)
+	umask(oldumask)
 
 	// ... and check if there was an error in the os.MkdirAll call
 	if err != nil {
@@ -0,0 +1,15 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !windows
+
+package sypgp
+
+import "syscall"
+
+// umask sets the process umask to mask and returns the previous one.
+func umask(mask int) int {
+	return syscall.Umask(mask)
+}
@@ -100,3 +100,57 @@ func SetProcessEffective(caps uint64) (uint64, error) {
 
 	return oldEffective, nil
 }
+
+// SetProcessCapabilities restricts the bounding, ambient, permitted,
+// effective and inheritable capability sets of the current thread to
+// caps, so the processes it executes can't regain the dropped
+// capabilities. The caller must hold CAP_SETPCAP and should lock the
+// goroutine to its thread.
+func SetProcessCapabilities(caps uint64) error {
+	// drop every capability known by the kernel, not only those in Map
+	for i := uint(0); i < 64; i++ {
+		if _, err := unix.PrctlRetInt(unix.PR_CAPBSET_READ, uintptr(i), 0, 0, 0); err == unix.EINVAL {
+			break
+		}
+		if caps&uint64(1<<i) != 0 {
+			continue
+		}
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(i), 0, 0, 0); err != nil {
+			return fmt.Errorf("while dropping capability %d from bounding set: %s", i, err)
+		}
+	}
+
+	data, err := getProcessCapabilities()
+	if err != nil {
+		return err
+	}
+
+	permitted := uint64(data[0].Permitted) | uint64(data[1].Permitted)<<32
+	caps &= permitted
+
+	for i := range data {
+		set := uint32(caps >> (32 * uint(i)))
+		data[i].Permitted = set
+		data[i].Effective = set
+		data[i].Inheritable = set
+	}
+
+	header := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	if err := unix.Capset(&header, &data[0]); err != nil {
+		return fmt.Errorf("while setting capabilities: %s", err)
+	}
+
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+		return fmt.Errorf("while clearing ambient capabilities: %s", err)
+	}
+	for i := uint(0); i < 64; i++ {
+		if caps&uint64(1<<i) == 0 {
+			continue
+		}
+		if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_RAISE, uintptr(i), 0, 0); err != nil {
+			return fmt.Errorf("while raising ambient capability %d: %s", i, err)
+		}
+	}
+
+	return nil
+}
@@ -6,10 +6,12 @@
 package capabilities
 
 import (
+	"fmt"
 	"runtime"
 	"testing"
 
 	"github.com/sylabs/singularity/internal/pkg/test"
+	"golang.org/x/sys/unix"
 )
 
 func TestGetProcess(t *testing.T) {
@@ -87,3 +89,46 @@ func TestSetProcessEffective(t *testing.T) {
 		}
 	}
 }
+
+func TestSetProcessCapabilities(t *testing.T) {
+	test.EnsurePrivilege(t)
+
+	caps := uint64(1<<Map["CAP_SETPCAP"].Value | 1<<Map["CAP_NET_RAW"].Value)
+	errCh := make(chan error, 1)
+
+	// the dropped capabilities can't be regained, the thread is
+	// left locked so it terminates with the goroutine
+	go func() {
+		runtime.LockOSThread()
+
+		if err := SetProcessCapabilities(caps); err != nil {
+			errCh <- err
+			return
+		}
+		data, err := getProcessCapabilities()
+		if err != nil {
+			errCh <- err
+			return
+		}
+		for _, set := range []uint64{
+			uint64(data[0].Effective) | uint64(data[1].Effective)<<32,
+			uint64(data[0].Permitted) | uint64(data[1].Permitted)<<32,
+			uint64(data[0].Inheritable) | uint64(data[1].Inheritable)<<32,
+		} {
+			if set != caps {
+				errCh <- fmt.Errorf("got capability set %#x, want %#x", set, caps)
+				return
+			}
+		}
+		sysAdmin := uintptr(Map["CAP_SYS_ADMIN"].Value)
+		if v, err := unix.PrctlRetInt(unix.PR_CAPBSET_READ, sysAdmin, 0, 0, 0); err != nil || v != 0 {
+			errCh <- fmt.Errorf("CAP_SYS_ADMIN still in bounding set")
+			return
+		}
+		errCh <- nil
+	}()
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
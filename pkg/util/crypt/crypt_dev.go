@@ -55,6 +55,13 @@ func createLoop(path string, offset, size uint64) (string, error) {
 	return fmt.Sprintf("/dev/loop%d", idx), nil
 }
 
+// AttachLoop attaches size bytes at offset of the file path, like the
+// encrypted partition of a SIF image, to a loop device and returns the
+// path of the loop device.
+func AttachLoop(path string, offset, size uint64) (string, error) {
+	return createLoop(path, offset, size)
+}
+
 // CloseCryptDevice closes the crypt device
 func (crypt *Device) CloseCryptDevice(path string) error {
 	cryptsetup, err := bin.Cryptsetup()
@@ -69,9 +76,7 @@ func (crypt *Device) CloseCryptDevice(path string) error {
 	defer lock.Release(fd)
 
 	cmd := exec.Command(cryptsetup, "close", path)
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Credential: &syscall.Credential{Uid: 0, Gid: 0},
-	}
+	setRootCredential(cmd)
 	sylog.Debugf("Running %s %s", cmd.Path, strings.Join(cmd.Args, " "))
 	err = cmd.Run()
 	if err != nil {
@@ -274,8 +279,7 @@ func (crypt *Device) Open(key []byte, path string) (string, error) {
 		}
 
 		cmd := exec.Command(cryptsetup, "open", "--batch-mode", "--type", "luks2", "--key-file", "-", path, nextCrypt)
-		cmd.SysProcAttr = &syscall.SysProcAttr{}
-		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: 0, Gid: 0}
+		setRootCredential(cmd)
 		sylog.Debugf("Running %s %s", cmd.Path, strings.Join(cmd.Args, " "))
 
 		cmd.Stdin = bytes.NewBuffer(key)
@@ -305,3 +309,59 @@ func (crypt *Device) Open(key []byte, path string) (string, error) {
 
 	return "", errors.New("unable to open crypt device")
 }
+
+// AddKey adds a key slot opened by newKey to the encrypted filesystem
+// specified by path, key must open an existing key slot. The encrypted
+// data is not modified.
+func (crypt *Device) AddKey(path string, key, newKey []byte) error {
+	cryptsetup, err := bin.Cryptsetup()
+	if err != nil {
+		return err
+	}
+
+	// the new key is read from a pipe, it's never written to disk
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	go func() {
+		w.Write(newKey)
+		w.Close()
+	}()
+
+	cmd := exec.Command(cryptsetup, "luksAddKey", "--batch-mode", "--key-file", "-", path, "/dev/fd/3")
+	cmd.Stdin = bytes.NewReader(key)
+	cmd.ExtraFiles = []*os.File{r}
+	sylog.Debugf("Running %s %s", cmd.Path, strings.Join(cmd.Args, " "))
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if strings.Contains(string(out), "No key available") {
+			return ErrInvalidPassphrase
+		}
+		return fmt.Errorf("cryptsetup luksAddKey failed: %s: %v", string(out), err)
+	}
+	return nil
+}
+
+// RemoveKey removes the key slot opened by key from the encrypted
+// filesystem specified by path.
+func (crypt *Device) RemoveKey(path string, key []byte) error {
+	cryptsetup, err := bin.Cryptsetup()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(cryptsetup, "luksRemoveKey", "--batch-mode", "--key-file", "-", path)
+	cmd.Stdin = bytes.NewReader(key)
+	sylog.Debugf("Running %s %s", cmd.Path, strings.Join(cmd.Args, " "))
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if strings.Contains(string(out), "No key available") {
+			return ErrInvalidPassphrase
+		}
+		return fmt.Errorf("cryptsetup luksRemoveKey failed: %s: %v", string(out), err)
+	}
+	return nil
+}
@@ -19,6 +19,7 @@ import (
 	"io/ioutil"
 
 	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/pkg/sylog"
 )
 
 var (
@@ -98,37 +99,47 @@ func EncryptKey(k KeyInfo, plaintext []byte) ([]byte, error) {
 }
 
 func PlaintextKey(k KeyInfo, image string) ([]byte, error) {
+	plaintext, _, err := PlaintextKeyMessage(k, image)
+	return plaintext, err
+}
+
+// PlaintextKeyMessage returns like PlaintextKey the plaintext key of the
+// encrypted image, with the ID of the SIF descriptor of the encrypted key
+// it was decrypted from, or 0 for a passphrase. An image may hold one
+// encrypted key per recipient, each one is tried with the private key.
+func PlaintextKeyMessage(k KeyInfo, image string) ([]byte, uint32, error) {
 	switch k.Format {
 	case PEM:
 		privateKey, err := LoadPEMPrivateKey(k.Path)
 		if err != nil {
-			return nil, fmt.Errorf("could not load PEM private key: %v", err)
+			return nil, 0, fmt.Errorf("could not load PEM private key: %v", err)
 		}
 
-		pemKey, err := getEncryptionKeyFromImage(image)
+		messages, err := getEncryptionKeysFromImage(image)
 		if err != nil {
-			return nil, fmt.Errorf("could not get encryption information from SIF: %v", err)
+			return nil, 0, fmt.Errorf("could not get encryption information from SIF: %v", err)
 		}
 
-		pemBuf := bytes.NewReader(pemKey)
-
-		encKey, err := loadPEMMessage(pemBuf)
-		if err != nil {
-			return nil, fmt.Errorf("could not unpack LUKS PEM from SIF: %v", err)
-		}
-
-		plaintext, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, encKey, nil)
-		if err != nil {
-			return nil, fmt.Errorf("could not decrypt LUKS key: %v", err)
+		for _, m := range messages {
+			encKey, err := loadPEMMessage(bytes.NewReader(m.data))
+			if err != nil {
+				return nil, 0, fmt.Errorf("could not unpack LUKS PEM from SIF: %v", err)
+			}
+
+			plaintext, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, encKey, nil)
+			if err == nil {
+				return plaintext, m.id, nil
+			}
+			sylog.Debugf("Could not decrypt LUKS key of descriptor %d: %v", m.id, err)
 		}
 
-		return plaintext, nil
+		return nil, 0, fmt.Errorf("could not decrypt LUKS key: %v", rsa.ErrDecryption)
 
 	case Passphrase:
-		return []byte(k.Material), nil
+		return []byte(k.Material), 0, nil
 
 	default:
-		return nil, ErrUnsupportedKeyURI
+		return nil, 0, ErrUnsupportedKeyURI
 	}
 }
 
@@ -193,7 +204,16 @@ func savePEMMessage(w io.Writer, msg []byte) error {
 	return pem.Encode(w, b)
 }
 
-func getEncryptionKeyFromImage(fn string) ([]byte, error) {
+// encryptedKey is an encrypted key of an image and the ID of its SIF
+// descriptor.
+type encryptedKey struct {
+	id   uint32
+	data []byte
+}
+
+// getEncryptionKeysFromImage returns the encrypted keys linked to the
+// primary system partition of the image fn, there is one per recipient.
+func getEncryptionKeysFromImage(fn string) ([]encryptedKey, error) {
 	img, err := sif.LoadContainer(fn, true)
 	if err != nil {
 		return nil, fmt.Errorf("could not load container: %v", err)
@@ -210,6 +230,8 @@ func getEncryptionKeyFromImage(fn string) ([]byte, error) {
 		return nil, fmt.Errorf("could not retrieve linked descriptors for primary system partition from %s", fn)
 	}
 
+	var keys []encryptedKey
+
 	for _, d := range descr {
 		format, err := d.GetFormatType()
 		if err != nil {
@@ -226,9 +248,6 @@ func getEncryptionKeyFromImage(fn string) ([]byte, error) {
 			continue
 		}
 
-		// TODO(ian): For now, assume the first linked message is what we
-		// are looking for. We should consider what we want to do in the
-		// case of multiple linked messages
 		data := d.GetData(&img)
 		if data == nil {
 			return nil, fmt.Errorf("could not retrieve LUKS key data from %s: %v", fn, ErrNoEncryptedKeyData)
@@ -237,8 +256,12 @@ func getEncryptionKeyFromImage(fn string) ([]byte, error) {
 		key := make([]byte, len(data))
 		copy(key, data)
 
-		return key, nil
+		keys = append(keys, encryptedKey{id: d.ID, data: key})
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("could not read LUKS key from %s: %v", fn, ErrEncryptedKeyNotFound)
 	}
 
-	return nil, fmt.Errorf("could not read LUKS key from %s: %v", fn, ErrEncryptedKeyNotFound)
+	return keys, nil
 }
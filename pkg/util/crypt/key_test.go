@@ -6,10 +6,17 @@
 package crypt
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
 
 	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+	"github.com/sylabs/sif/pkg/sif"
 	"github.com/sylabs/singularity/internal/pkg/test"
 )
 
@@ -144,3 +151,99 @@ func TestPlaintextKey(t *testing.T) {
 		})
 	}
 }
+
+// createEncryptedSIF creates a SIF image at path with a fake encrypted
+// partition and the plaintexts encrypted with the public keys pubKeys.
+func createEncryptedSIF(t *testing.T, path string, pubKeys []string, plaintexts [][]byte) {
+	part := sif.DescriptorInput{
+		Datatype: sif.DataPartition,
+		Groupid:  sif.DescrDefaultGroup,
+		Link:     sif.DescrUnusedLink,
+		Data:     []byte("not a LUKS device"),
+	}
+	part.Size = int64(len(part.Data))
+	if err := part.SetPartExtra(sif.FsEncryptedSquashfs, sif.PartPrimSys, sif.GetSIFArch(runtime.GOARCH)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cinfo := sif.CreateInfo{
+		Pathname:   path,
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []sif.DescriptorInput{part},
+	}
+	for i, pub := range pubKeys {
+		data, err := EncryptKey(KeyInfo{Format: PEM, Path: pub}, plaintexts[i])
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		msg := sif.DescriptorInput{
+			Datatype: sif.DataCryptoMessage,
+			Groupid:  sif.DescrDefaultGroup,
+			Link:     1,
+			Data:     data,
+			Size:     int64(len(data)),
+		}
+		if err := msg.SetCryptoMsgExtra(sif.FormatPEM, sif.MessageRSAOAEP); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		cinfo.InputDescr = append(cinfo.InputDescr, msg)
+	}
+	if _, err := sif.CreateContainer(cinfo); err != nil {
+		t.Fatalf("while creating SIF: %s", err)
+	}
+}
+
+func TestPlaintextKeyMessage(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "crypt-key-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the image is encrypted for the first two recipients, as after a
+	// rekey keeping the old key
+	var privKeys, pubKeys []string
+	for i := 0; i < 3; i++ {
+		key, err := GenerateRSAKey(1024)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		priv := filepath.Join(dir, fmt.Sprintf("key%d.pem", i))
+		pub := filepath.Join(dir, fmt.Sprintf("key%d.pub", i))
+		if err := SavePrivatePEM(priv, key); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := SavePublicPEM(pub, key); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		privKeys = append(privKeys, priv)
+		pubKeys = append(pubKeys, pub)
+	}
+
+	image := filepath.Join(dir, "encrypted.sif")
+	plaintexts := [][]byte{[]byte("first secret"), []byte("second secret")}
+	createEncryptedSIF(t, image, pubKeys[:2], plaintexts)
+
+	for i, want := range plaintexts {
+		got, id, err := PlaintextKeyMessage(KeyInfo{Format: PEM, Path: privKeys[i]}, image)
+		if err != nil {
+			t.Fatalf("recipient %d: unexpected error: %s", i, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("recipient %d: got plaintext %q, want %q", i, got, want)
+		}
+		// the partition is the first descriptor
+		if wantID := uint32(i + 2); id != wantID {
+			t.Errorf("recipient %d: got descriptor %d, want %d", i, id, wantID)
+		}
+	}
+
+	if _, _, err := PlaintextKeyMessage(KeyInfo{Format: PEM, Path: privKeys[2]}, image); err == nil {
+		t.Errorf("unexpected success with a key of another recipient")
+	}
+}
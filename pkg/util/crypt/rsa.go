@@ -103,7 +103,9 @@ func SavePrivatePEM(fileName string, key *rsa.PrivateKey) error {
 		return fmt.Errorf("cannot save invalid key: %v", err)
 	}
 
-	outFile, err := os.Create(fileName)
+	// the private key isn't protected by a passphrase, only the owner can
+	// read it
+	outFile, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		return fmt.Errorf("unable to create key file: %v", err)
 	}
@@ -0,0 +1,54 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package lock
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// Exclusive applies an exclusive lock on path
+func Exclusive(path string) (fd int, err error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return -1, err
+	}
+	h, err := windows.CreateFile(p, windows.GENERIC_READ, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE, nil, windows.OPEN_EXISTING, windows.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return -1, err
+	}
+	ol := new(windows.Overlapped)
+	if err := windows.LockFileEx(h, windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, ol); err != nil {
+		windows.CloseHandle(h)
+		return -1, err
+	}
+	return int(h), nil
+}
+
+// Release removes a lock on path referenced by fd
+func Release(fd int) error {
+	h := windows.Handle(fd)
+	defer windows.CloseHandle(h)
+	ol := new(windows.Overlapped)
+	return windows.UnlockFileEx(h, 0, 1, 0, ol)
+}
+
+// Lock places a write lock for the corresponding byte-range,
+// byte-range locks are not supported on this platform.
+func (r *ByteRange) Lock() error {
+	return ErrLockNotSupported
+}
+
+// RLock places a read lock for the corresponding byte-range,
+// byte-range locks are not supported on this platform.
+func (r *ByteRange) RLock() error {
+	return ErrLockNotSupported
+}
+
+// Unlock removes the lock for the corresponding byte-range,
+// byte-range locks are not supported on this platform.
+func (r *ByteRange) Unlock() error {
+	return ErrLockNotSupported
+}
@@ -3,6 +3,8 @@
 // LICENSE file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
 
+// +build !windows
+
 package lock
 
 import "golang.org/x/sys/unix"
@@ -12,9 +12,6 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
-	"syscall"
-
-	"golang.org/x/sys/unix"
 )
 
 // HasFilesystem returns whether kernel support filesystem or not
@@ -121,9 +118,7 @@ func parseMountInfoLine(line string) MountInfoEntry {
 	if entry.FSType == "btrfs" || entry.FSType == "overlay" || entry.FSType == "ceph" {
 		fi, err := os.Stat(entry.Point)
 		if err == nil {
-			st := fi.Sys().(*syscall.Stat_t)
-			// cast to uint64 as st.Dev is uint32 on MIPS
-			entry.Dev = fmt.Sprintf("%d:%d", unix.Major(uint64(st.Dev)), unix.Minor(uint64(st.Dev)))
+			entry.Dev = deviceNumber(fi)
 		}
 	}
 
@@ -161,9 +156,7 @@ func FindParentMountEntry(path string, entries []MountInfoEntry) (*MountInfoEntr
 	if err != nil {
 		return nil, fmt.Errorf("while getting stat for %s: %s", path, err)
 	}
-	st := fi.Sys().(*syscall.Stat_t)
-	// cast to uint64 as st.Dev is uint32 on MIPS
-	dev := fmt.Sprintf("%d:%d", unix.Major(uint64(st.Dev)), unix.Minor(uint64(st.Dev)))
+	dev := deviceNumber(fi)
 
 	var entry *MountInfoEntry
 	matchLen := 0
@@ -285,37 +278,6 @@ func SetOOMScoreAdj(pid int, score *int) error {
 	return nil
 }
 
-// HasNamespace checks if host namespace and container namespace
-// are different.
-func HasNamespace(pid int, nstype string) (bool, error) {
-	var st1 syscall.Stat_t
-	var st2 syscall.Stat_t
-
-	has := false
-
-	processOne := fmt.Sprintf("/proc/%d/ns/%s", pid, nstype)
-	processTwo := fmt.Sprintf("/proc/self/ns/%s", nstype)
-
-	if err := syscall.Stat(processOne, &st1); err != nil {
-		if os.IsNotExist(err) {
-			return has, nil
-		}
-		return has, err
-	}
-	if err := syscall.Stat(processTwo, &st2); err != nil {
-		if os.IsNotExist(err) {
-			return has, nil
-		}
-		return has, err
-	}
-
-	if st1.Ino != st2.Ino {
-		has = true
-	}
-
-	return has, nil
-}
-
 // Getppid returns the parent process ID for the corresponding
 // process ID passed in parameter.
 func Getppid(pid int) (int, error) {
@@ -0,0 +1,55 @@
+// Copyright (c) 2018-2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !windows
+
+package proc
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// deviceNumber returns the major:minor number of the device holding the
+// file described by fi.
+func deviceNumber(fi os.FileInfo) string {
+	st := fi.Sys().(*syscall.Stat_t)
+	// cast to uint64 as st.Dev is uint32 on MIPS
+	return fmt.Sprintf("%d:%d", unix.Major(uint64(st.Dev)), unix.Minor(uint64(st.Dev)))
+}
+
+// HasNamespace checks if host namespace and container namespace
+// are different.
+func HasNamespace(pid int, nstype string) (bool, error) {
+	var st1 syscall.Stat_t
+	var st2 syscall.Stat_t
+
+	has := false
+
+	processOne := fmt.Sprintf("/proc/%d/ns/%s", pid, nstype)
+	processTwo := fmt.Sprintf("/proc/self/ns/%s", nstype)
+
+	if err := syscall.Stat(processOne, &st1); err != nil {
+		if os.IsNotExist(err) {
+			return has, nil
+		}
+		return has, err
+	}
+	if err := syscall.Stat(processTwo, &st2); err != nil {
+		if os.IsNotExist(err) {
+			return has, nil
+		}
+		return has, err
+	}
+
+	if st1.Ino != st2.Ino {
+		has = true
+	}
+
+	return has, nil
+}
@@ -0,0 +1,22 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package proc
+
+import (
+	"os"
+)
+
+// deviceNumber returns the major:minor number of the device holding the
+// file described by fi, device numbers are not reported on this platform.
+func deviceNumber(fi os.FileInfo) string {
+	return "0:0"
+}
+
+// HasNamespace checks if host namespace and container namespace
+// are different, there are no namespaces on this platform.
+func HasNamespace(pid int, nstype string) (bool, error) {
+	return false, nil
+}
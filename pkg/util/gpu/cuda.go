@@ -0,0 +1,161 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package gpu
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CudaVersionLabel is the image label declaring the CUDA toolkit version
+// shipped in the container, as set by the NVIDIA CUDA base images.
+const CudaVersionLabel = "com.nvidia.cuda.version"
+
+// nvidiaProcVersion is the kernel module version file used when nvidia-smi
+// is not available.
+var nvidiaProcVersion = "/proc/driver/nvidia/version"
+
+// cudaDriverVersions maps CUDA toolkit versions to the minimum Linux driver
+// version they require, see the CUDA toolkit release notes.
+var cudaDriverVersions = []struct {
+	cuda   string
+	driver string
+}{
+	{"11.1", "455.23"},
+	{"11.0", "450.36.06"},
+	{"10.2", "440.33"},
+	{"10.1", "418.39"},
+	{"10.0", "410.48"},
+	{"9.2", "396.26"},
+	{"9.1", "390.46"},
+	{"9.0", "384.81"},
+	{"8.0", "375.26"},
+	{"7.5", "352.31"},
+	{"7.0", "346.46"},
+}
+
+// sample /proc/driver/nvidia/version content:
+// NVRM version: NVIDIA UNIX x86_64 Kernel Module  450.80.02  Wed Sep 23 01:13:39 UTC 2020
+var nvidiaProcVersionRegexp = regexp.MustCompile(`Kernel Module\s+([0-9.]+)`)
+
+// NvidiaDriverVersion returns the version of the NVIDIA driver installed on
+// the host. The kernel module version is read first, nvidia-smi is only run
+// when it is unavailable and is looked up in the search path envPath, or in
+// the PATH of the current process if envPath is empty.
+func NvidiaDriverVersion(envPath string) (string, error) {
+	b, err := ioutil.ReadFile(nvidiaProcVersion)
+	if err == nil {
+		if match := nvidiaProcVersionRegexp.FindSubmatch(b); match != nil {
+			return string(match[1]), nil
+		}
+		err = fmt.Errorf("no kernel module version found in %s", nvidiaProcVersion)
+	}
+
+	smi, lerr := lookPath("nvidia-smi", envPath)
+	if lerr != nil {
+		return "", fmt.Errorf("could not determine NVIDIA driver version: %v", err)
+	}
+	out, err := exec.Command(smi, "--query-gpu=driver_version", "--format=csv,noheader").Output()
+	if err != nil {
+		return "", fmt.Errorf("could not determine NVIDIA driver version: %s failed: %v", smi, err)
+	}
+	// one line is reported per GPU, all with the same driver
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	if scanner.Scan() {
+		if v := strings.TrimSpace(scanner.Text()); v != "" {
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("could not determine NVIDIA driver version: no version reported by %s", smi)
+}
+
+// lookPath searches the executable file in the directories of the search
+// path envPath, without altering the environment of the current process.
+func lookPath(file, envPath string) (string, error) {
+	if envPath == "" {
+		return exec.LookPath(file)
+	}
+	for _, dir := range filepath.SplitList(envPath) {
+		if dir == "" {
+			continue
+		}
+		path := filepath.Join(dir, file)
+		if fi, err := os.Stat(path); err == nil && fi.Mode().IsRegular() && fi.Mode()&0111 != 0 {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%s not found in %s", file, envPath)
+}
+
+// CudaDriverVersion returns the minimum NVIDIA driver version required by
+// the CUDA toolkit version cuda, or false if the CUDA version is unknown.
+// Patch releases (e.g. 11.0.3) are matched against their minor release.
+func CudaDriverVersion(cuda string) (string, bool) {
+	fields := strings.SplitN(cuda, ".", 3)
+	if len(fields) < 2 {
+		return "", false
+	}
+	minor := fields[0] + "." + fields[1]
+	for _, v := range cudaDriverVersions {
+		if v.cuda == minor {
+			return v.driver, true
+		}
+	}
+	return "", false
+}
+
+// CheckCudaDriver returns an error describing the mismatch if the NVIDIA
+// driver version driver is too old for the CUDA toolkit version cuda.
+// Unknown CUDA versions are not checked.
+func CheckCudaDriver(cuda, driver string) error {
+	required, ok := CudaDriverVersion(cuda)
+	if !ok {
+		return nil
+	}
+	cmp, err := compareVersions(driver, required)
+	if err != nil {
+		return fmt.Errorf("invalid NVIDIA driver version %q: %v", driver, err)
+	}
+	if cmp < 0 {
+		return fmt.Errorf("container requires CUDA %s which needs NVIDIA driver >= %s, host driver version is %s", cuda, required, driver)
+	}
+	return nil
+}
+
+// compareVersions compares the dotted numeric versions a and b, it returns
+// -1, 0 or 1 if a is respectively lower, equal or greater than b.
+func compareVersions(a, b string) (int, error) {
+	fa := strings.Split(a, ".")
+	fb := strings.Split(b, ".")
+	for i := 0; i < len(fa) || i < len(fb); i++ {
+		var na, nb int
+		var err error
+		if i < len(fa) {
+			if na, err = strconv.Atoi(fa[i]); err != nil {
+				return 0, err
+			}
+		}
+		if i < len(fb) {
+			if nb, err = strconv.Atoi(fb[i]); err != nil {
+				return 0, err
+			}
+		}
+		if na < nb {
+			return -1, nil
+		} else if na > nb {
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
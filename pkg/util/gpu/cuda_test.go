@@ -0,0 +1,114 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package gpu
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const nvidiaSmiScript = `#!/bin/sh
+[ "$*" = "--query-gpu=driver_version --format=csv,noheader" ] || exit 1
+echo 418.87.01
+echo 418.87.01
+`
+
+func TestNvidiaDriverVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nvidia-smi-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	procVersion := filepath.Join(dir, "version")
+	content := "NVRM version: NVIDIA UNIX x86_64 Kernel Module  450.80.02  Wed Sep 23 01:13:39 UTC 2020\n"
+	if err := ioutil.WriteFile(procVersion, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(old string) { nvidiaProcVersion = old }(nvidiaProcVersion)
+	nvidiaProcVersion = procVersion
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "nvidia-smi"), []byte(nvidiaSmiScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// the kernel module version is preferred over running nvidia-smi
+	v, err := NvidiaDriverVersion(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if v != "450.80.02" {
+		t.Errorf("got driver version %s, want 450.80.02", v)
+	}
+
+	// without the kernel module version, nvidia-smi is looked up in the
+	// given search path only
+	nvidiaProcVersion = filepath.Join(dir, "missing")
+	v, err = NvidiaDriverVersion(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if v != "418.87.01" {
+		t.Errorf("got driver version %s, want 418.87.01", v)
+	}
+	if p := os.Getenv("PATH"); strings.Contains(p, dir) {
+		t.Errorf("PATH of the process was modified: %s", p)
+	}
+
+	os.Remove(filepath.Join(dir, "nvidia-smi"))
+	if _, err := NvidiaDriverVersion(dir); err == nil {
+		t.Errorf("unexpected success without any NVIDIA driver")
+	}
+}
+
+func TestCheckCudaDriver(t *testing.T) {
+	tests := []struct {
+		name    string
+		cuda    string
+		driver  string
+		wantErr string
+	}{
+		{name: "Newer", cuda: "10.1", driver: "450.80.02"},
+		{name: "Equal", cuda: "11.0", driver: "450.36.06"},
+		{name: "PatchRelease", cuda: "11.0.3", driver: "450.80.02"},
+		{name: "UnknownCuda", cuda: "12.0", driver: "418.87.01"},
+		{name: "InvalidCuda", cuda: "latest", driver: "418.87.01"},
+		{
+			name:    "Older",
+			cuda:    "11.0.3",
+			driver:  "418.87.01",
+			wantErr: "container requires CUDA 11.0.3 which needs NVIDIA driver >= 450.36.06, host driver version is 418.87.01",
+		},
+		{
+			name:    "OlderPatch",
+			cuda:    "11.0",
+			driver:  "450.36",
+			wantErr: "needs NVIDIA driver >= 450.36.06",
+		},
+		{name: "InvalidDriver", cuda: "11.0", driver: "unknown", wantErr: "invalid NVIDIA driver version"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckCudaDriver(tt.cuda, tt.driver)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("unexpected success, want error %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %q, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package gpu
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// nvidiaGpusDir holds a directory per GPU with its information file.
+	nvidiaGpusDir = "/proc/driver/nvidia/gpus"
+	// nvidiaMigMinors maps the MIG capabilities to the minor numbers of
+	// their device nodes in nvidiaCapsDir.
+	nvidiaMigMinors = "/proc/driver/nvidia-caps/mig-minors"
+	nvidiaCapsDir   = "/dev/nvidia-caps"
+)
+
+// MIG device UUID, as listed by nvidia-smi -L, of the form
+// MIG-GPU-<GPU UUID>/<GPU instance ID>/<compute instance ID>
+var migUUIDRegexp = regexp.MustCompile(`^MIG-(GPU-[0-9a-fA-F-]+)/([0-9]+)/([0-9]+)$`)
+
+// migDevice is a MIG device, a compute instance of a GPU instance of a GPU.
+type migDevice struct {
+	gpu string
+	gi  int
+	ci  int
+}
+
+// parseMIGDevices returns the MIG devices listed in the CUDA_VISIBLE_DEVICES
+// value visible. It returns no device if visible doesn't list MIG devices,
+// and an error if it mixes MIG devices with GPUs.
+func parseMIGDevices(visible string) ([]migDevice, error) {
+	var devices []migDevice
+	var others []string
+
+	for _, s := range strings.Split(visible, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		m := migUUIDRegexp.FindStringSubmatch(s)
+		if m == nil {
+			others = append(others, s)
+			continue
+		}
+		gi, _ := strconv.Atoi(m[2])
+		ci, _ := strconv.Atoi(m[3])
+		devices = append(devices, migDevice{gpu: m[1], gi: gi, ci: ci})
+	}
+
+	if len(devices) > 0 && len(others) > 0 {
+		return nil, fmt.Errorf("CUDA_VISIBLE_DEVICES can't mix MIG devices with GPUs %s", strings.Join(others, ","))
+	}
+	return devices, nil
+}
+
+// HasMIGDevices returns true if the CUDA_VISIBLE_DEVICES value visible
+// lists MIG devices.
+func HasMIGDevices(visible string) bool {
+	for _, s := range strings.Split(visible, ",") {
+		if migUUIDRegexp.MatchString(strings.TrimSpace(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// nvidiaGPUMinors returns the device minor numbers of the GPUs indexed by
+// GPU UUID.
+func nvidiaGPUMinors() (map[string]int, error) {
+	infos, err := filepath.Glob(filepath.Join(nvidiaGpusDir, "*", "information"))
+	if err != nil {
+		return nil, err
+	}
+
+	minors := make(map[string]int)
+	for _, info := range infos {
+		values, err := readKeyValues(info, ":")
+		if err != nil {
+			return nil, err
+		}
+		minor, err := strconv.Atoi(values["Device Minor"])
+		if err != nil || values["GPU UUID"] == "" {
+			return nil, fmt.Errorf("no GPU UUID or device minor found in %s", info)
+		}
+		minors[values["GPU UUID"]] = minor
+	}
+	return minors, nil
+}
+
+// readKeyValues returns the values of the "<key><sep> <value>" lines of the
+// file path.
+func readKeyValues(path, sep string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), sep, 2)
+		if len(kv) == 2 {
+			values[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	return values, scanner.Err()
+}
+
+// migDeviceNodes returns the GPU device nodes and MIG capability device
+// nodes giving access to the MIG devices listed in the CUDA_VISIBLE_DEVICES
+// value visible, or nil if it doesn't list MIG devices.
+func migDeviceNodes(visible string) ([]string, error) {
+	devices, err := parseMIGDevices(visible)
+	if err != nil || len(devices) == 0 {
+		return nil, err
+	}
+
+	gpuMinors, err := nvidiaGPUMinors()
+	if err != nil {
+		return nil, fmt.Errorf("could not list nvidia GPUs: %v", err)
+	}
+	// sample mig-minors content:
+	// config 1
+	// monitor 2
+	// gpu0/gi1/access 12
+	// gpu0/gi1/ci0/access 13
+	capMinors, err := readKeyValues(nvidiaMigMinors, " ")
+	if err != nil {
+		return nil, fmt.Errorf("could not read MIG capabilities: %v", err)
+	}
+
+	var nodes []string
+	seen := make(map[string]bool)
+	add := func(node string) {
+		if !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+
+	for _, d := range devices {
+		minor, ok := gpuMinors[d.gpu]
+		if !ok {
+			return nil, fmt.Errorf("no GPU found with UUID %s", d.gpu)
+		}
+		add(fmt.Sprintf("/dev/nvidia%d", minor))
+
+		for _, c := range []string{
+			fmt.Sprintf("gpu%d/gi%d/access", minor, d.gi),
+			fmt.Sprintf("gpu%d/gi%d/ci%d/access", minor, d.gi, d.ci),
+		} {
+			capMinor, ok := capMinors[c]
+			if !ok {
+				return nil, fmt.Errorf("no MIG capability %s found for %s", c, d.gpu)
+			}
+			add(filepath.Join(nvidiaCapsDir, "nvidia-cap"+capMinor))
+		}
+	}
+	return nodes, nil
+}
+
+// NvidiaMIGDevices returns the nvidia devices giving access to the MIG
+// devices listed in the CUDA_VISIBLE_DEVICES value visible: all non-GPU
+// nvidia devices but the MIG capabilities, the GPUs of the MIG devices and
+// their capabilities. It returns nil if visible doesn't list MIG devices.
+func NvidiaMIGDevices(visible string) ([]string, error) {
+	nodes, err := migDeviceNodes(visible)
+	if err != nil || nodes == nil {
+		return nil, err
+	}
+
+	devs, err := NvidiaDevices(false)
+	if err != nil {
+		return nil, err
+	}
+	var migDevs []string
+	for _, dev := range devs {
+		if dev != nvidiaCapsDir {
+			migDevs = append(migDevs, dev)
+		}
+	}
+	return append(migDevs, nodes...), nil
+}
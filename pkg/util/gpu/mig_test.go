@@ -0,0 +1,140 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package gpu
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const (
+	gpu0UUID = "GPU-5ac6a28d-6a5e-4bd6-a6b6-2e1a0e4c5cda"
+	gpu1UUID = "GPU-91e55f37-83ad-4a57-a2b8-1c4b2b1ef8d4"
+)
+
+const migMinors = `config 1
+monitor 2
+gpu0/gi1/access 12
+gpu0/gi1/ci0/access 13
+gpu0/gi2/access 21
+gpu0/gi2/ci0/access 22
+gpu1/gi1/access 147
+gpu1/gi1/ci0/access 148
+`
+
+func TestMIGDeviceNodes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nvidia-mig-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	gpus := map[string]string{
+		"0000:07:00.0": "Model: A100-SXM4-40GB\nGPU UUID: " + gpu0UUID + "\nDevice Minor: 0\n",
+		"0000:0f:00.0": "Model: A100-SXM4-40GB\nGPU UUID: " + gpu1UUID + "\nDevice Minor: 1\n",
+	}
+	for pci, info := range gpus {
+		if err := os.MkdirAll(filepath.Join(dir, "gpus", pci), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "gpus", pci, "information"), []byte(info), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "mig-minors"), []byte(migMinors), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(gpus, minors string) {
+		nvidiaGpusDir = gpus
+		nvidiaMigMinors = minors
+	}(nvidiaGpusDir, nvidiaMigMinors)
+	nvidiaGpusDir = filepath.Join(dir, "gpus")
+	nvidiaMigMinors = filepath.Join(dir, "mig-minors")
+
+	tests := []struct {
+		name    string
+		visible string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "NoMIG",
+			visible: "0,1",
+		},
+		{
+			name:    "Empty",
+			visible: "",
+		},
+		{
+			name:    "OneMIG",
+			visible: "MIG-" + gpu0UUID + "/2/0",
+			want:    []string{"/dev/nvidia0", "/dev/nvidia-caps/nvidia-cap21", "/dev/nvidia-caps/nvidia-cap22"},
+		},
+		{
+			name:    "TwoGPUs",
+			visible: "MIG-" + gpu0UUID + "/1/0, MIG-" + gpu1UUID + "/1/0",
+			want: []string{
+				"/dev/nvidia0", "/dev/nvidia-caps/nvidia-cap12", "/dev/nvidia-caps/nvidia-cap13",
+				"/dev/nvidia1", "/dev/nvidia-caps/nvidia-cap147", "/dev/nvidia-caps/nvidia-cap148",
+			},
+		},
+		{
+			name:    "Mixed",
+			visible: "MIG-" + gpu0UUID + "/1/0,1",
+			wantErr: true,
+		},
+		{
+			name:    "UnknownGPU",
+			visible: "MIG-GPU-00000000-0000-0000-0000-000000000000/1/0",
+			wantErr: true,
+		},
+		{
+			name:    "UnknownInstance",
+			visible: "MIG-" + gpu1UUID + "/2/0",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, err := migDeviceNodes(tt.visible)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("unexpected success")
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(nodes, tt.want) {
+				t.Errorf("got device nodes %v, want %v", nodes, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasMIGDevices(t *testing.T) {
+	tests := []struct {
+		visible string
+		want    bool
+	}{
+		{visible: "", want: false},
+		{visible: "0,1", want: false},
+		{visible: gpu0UUID, want: false},
+		{visible: "MIG-" + gpu0UUID + "/1/0", want: true},
+		{visible: "0, MIG-" + gpu1UUID + "/2/0", want: true},
+	}
+
+	for _, tt := range tests {
+		if got := HasMIGDevices(tt.visible); got != tt.want {
+			t.Errorf("HasMIGDevices(%q) = %v, want %v", tt.visible, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package rlimit
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// Unlimited is the value of a resource limit without restriction
+// (RLIM_INFINITY).
+const Unlimited = ^uint64(0)
+
+// Names lists the short names of the resources a limit can be set for
+// with ParseLimit.
+var Names = []string{"core", "memlock", "nofile", "nproc", "stack"}
+
+// sizeResources lists the resources limited in bytes, their value accepts
+// a K, M or G suffix.
+var sizeResources = map[string]bool{
+	"core":    true,
+	"memlock": true,
+	"stack":   true,
+}
+
+// Limit is the soft and hard limit of a resource.
+type Limit struct {
+	// Resource is the resource type (e.g. RLIMIT_NOFILE)
+	Resource string
+	Soft     uint64
+	Hard     uint64
+}
+
+// Name returns the short name of the limited resource (e.g. nofile).
+func (l Limit) Name() string {
+	return strings.ToLower(strings.TrimPrefix(l.Resource, "RLIMIT_"))
+}
+
+// String returns the limit with the format accepted by ParseLimit.
+func (l Limit) String() string {
+	return fmt.Sprintf("%s=%s:%s", l.Name(), FormatValue(l.Soft), FormatValue(l.Hard))
+}
+
+// FormatValue returns the value of a resource limit, or unlimited.
+func FormatValue(v uint64) string {
+	if v == Unlimited {
+		return "unlimited"
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+// parseValue parses the value of a limit of the resource name.
+func parseValue(name, s string) (uint64, error) {
+	if s == "unlimited" || s == "infinity" {
+		return Unlimited, nil
+	}
+
+	mult := uint64(1)
+	if sizeResources[name] && s != "" {
+		switch strings.ToUpper(s[len(s)-1:]) {
+		case "K":
+			mult = 1 << 10
+		case "M":
+			mult = 1 << 20
+		case "G":
+			mult = 1 << 30
+		}
+		if mult > 1 {
+			s = s[:len(s)-1]
+		}
+	}
+
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || v > Unlimited/mult {
+		return 0, fmt.Errorf("bad value %q for %s limit", s, name)
+	}
+	return v * mult, nil
+}
+
+// ParseLimit parses a resource limit with the format name=soft[:hard],
+// where name is one of Names, and soft and hard are a number or unlimited.
+// The hard limit is the soft limit when omitted.
+func ParseLimit(s string) (Limit, error) {
+	var l Limit
+
+	fields := strings.SplitN(strings.TrimSpace(s), "=", 2)
+	if len(fields) != 2 {
+		return l, fmt.Errorf("bad resource limit %q, must be name=soft[:hard]", s)
+	}
+
+	name := strings.ToLower(fields[0])
+	supported := false
+	for _, n := range Names {
+		supported = supported || n == name
+	}
+	if !supported {
+		return l, fmt.Errorf("unsupported resource %q, must be one of %s", fields[0], strings.Join(Names, ", "))
+	}
+	l.Resource = "RLIMIT_" + strings.ToUpper(name)
+
+	values := strings.SplitN(fields[1], ":", 2)
+	soft, err := parseValue(name, values[0])
+	if err != nil {
+		return l, err
+	}
+	hard := soft
+	if len(values) == 2 {
+		hard, err = parseValue(name, values[1])
+		if err != nil {
+			return l, err
+		}
+	}
+	if soft > hard {
+		return l, fmt.Errorf("soft %s limit %s is above the hard limit %s", name, FormatValue(soft), FormatValue(hard))
+	}
+	l.Soft = soft
+	l.Hard = hard
+
+	return l, nil
+}
+
+// ParseLimits parses a list of resource limits, a later limit of a resource
+// replaces a previous one. The limits are returned sorted by resource.
+func ParseLimits(list []string) ([]Limit, error) {
+	parsed := make([]Limit, 0, len(list))
+	for _, s := range list {
+		l, err := ParseLimit(s)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, l)
+	}
+	return override(nil, parsed), nil
+}
+
+// override returns limits with the limits of the same resources replaced
+// by overrides, sorted by resource.
+func override(limits, overrides []Limit) []Limit {
+	byResource := make(map[string]Limit)
+	for _, l := range append(append([]Limit{}, limits...), overrides...) {
+		byResource[l.Resource] = l
+	}
+
+	merged := make([]Limit, 0, len(byResource))
+	for _, l := range byResource {
+		merged = append(merged, l)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Resource < merged[j].Resource })
+	return merged
+}
+
+// Resolve returns the resource limits to apply to the container process:
+// the requested limits override the defaults configured by the
+// administrator. For an unprivileged user, the requested limits above the
+// ceilings configured by the administrator are clamped to them, and the
+// requested hard limits of the resources without a ceiling can't be raised
+// above the current ones. When raise is false, no hard limit can be raised
+// above the current one. A warning is displayed for each clamped limit.
+func Resolve(defaults, ceilings []Limit, requested []string, privileged, raise bool) ([]Limit, error) {
+	req, err := ParseLimits(requested)
+	if err != nil {
+		return nil, err
+	}
+
+	if !privileged {
+		for i, l := range req {
+			max, found := Unlimited, false
+			for _, c := range ceilings {
+				if c.Resource == l.Resource {
+					max, found = c.Hard, true
+				}
+			}
+			if !found {
+				_, hard, err := Get(l.Resource)
+				if err != nil {
+					return nil, err
+				}
+				max = hard
+			}
+			if l.Hard <= max {
+				continue
+			}
+			if found {
+				sylog.Warningf("Requested %s limit %s is above the maximum allowed by 'max rlimit' in singularity.conf, clamped to %s", l.Name(), FormatValue(l.Hard), FormatValue(max))
+			} else {
+				sylog.Warningf("Requested %s limit %s is above the current hard limit, clamped to %s, the administrator can allow it with 'max rlimit' in singularity.conf", l.Name(), FormatValue(l.Hard), FormatValue(max))
+			}
+			req[i].Hard = max
+			if req[i].Soft > max {
+				req[i].Soft = max
+			}
+		}
+	}
+
+	limits := override(defaults, req)
+
+	if raise {
+		return limits, nil
+	}
+	for i, l := range limits {
+		_, hard, err := Get(l.Resource)
+		if err != nil || l.Hard <= hard {
+			continue
+		}
+		sylog.Warningf("Hard %s limit %s can't be raised above the current one without privileges, clamped to %s", l.Name(), FormatValue(l.Hard), FormatValue(hard))
+		limits[i].Hard = hard
+		if limits[i].Soft > hard {
+			limits[i].Soft = hard
+		}
+	}
+	return limits, nil
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package rlimit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   string
+		want    Limit
+		wantErr bool
+	}{
+		{name: "SoftHard", limit: "nofile=1024:65536", want: Limit{"RLIMIT_NOFILE", 1024, 65536}},
+		{name: "SoftOnly", limit: "nproc=512", want: Limit{"RLIMIT_NPROC", 512, 512}},
+		{name: "Unlimited", limit: "stack=unlimited", want: Limit{"RLIMIT_STACK", Unlimited, Unlimited}},
+		{name: "UnlimitedHard", limit: "core=0:unlimited", want: Limit{"RLIMIT_CORE", 0, Unlimited}},
+		{name: "Suffix", limit: "memlock=64K:1G", want: Limit{"RLIMIT_MEMLOCK", 64 << 10, 1 << 30}},
+		{name: "UpperCase", limit: "NOFILE=8", want: Limit{"RLIMIT_NOFILE", 8, 8}},
+		{name: "SuffixNotSize", limit: "nofile=1K", wantErr: true},
+		{name: "Unsupported", limit: "cpu=10", wantErr: true},
+		{name: "NoValue", limit: "nofile", wantErr: true},
+		{name: "BadValue", limit: "nofile=lots", wantErr: true},
+		{name: "SoftAboveHard", limit: "nofile=2048:1024", wantErr: true},
+		{name: "Overflow", limit: "stack=18446744073709551615G", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLimit(tt.limit)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("unexpected success for %q", tt.limit)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error for %q: %s", tt.limit, err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	_, hard, err := Get("RLIMIT_NOFILE")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_, stackHard, err := Get("RLIMIT_STACK")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	defaults := []Limit{{"RLIMIT_NOFILE", 1024, 4096}, {"RLIMIT_CORE", 0, 0}}
+	ceilings := []Limit{{"RLIMIT_NOFILE", 8192, 8192}}
+
+	tests := []struct {
+		name       string
+		requested  []string
+		ceilings   []Limit
+		privileged bool
+		raise      bool
+		want       []Limit
+	}{
+		{
+			name:     "Defaults",
+			ceilings: ceilings,
+			raise:    true,
+			want:     []Limit{{"RLIMIT_CORE", 0, 0}, {"RLIMIT_NOFILE", 1024, 4096}},
+		},
+		{
+			name:      "Override",
+			ceilings:  ceilings,
+			requested: []string{"nofile=2048:8192", "stack=8M:unlimited"},
+			raise:     true,
+			want:      []Limit{{"RLIMIT_CORE", 0, 0}, {"RLIMIT_NOFILE", 2048, 8192}, {"RLIMIT_STACK", 8 << 20, stackHard}},
+		},
+		{
+			name:      "NoCeiling",
+			requested: []string{"nofile=unlimited"},
+			raise:     true,
+			want:      []Limit{{"RLIMIT_CORE", 0, 0}, {"RLIMIT_NOFILE", hard, hard}},
+		},
+		{
+			name:       "NoCeilingPrivileged",
+			requested:  []string{"nofile=unlimited"},
+			privileged: true,
+			raise:      true,
+			want:       []Limit{{"RLIMIT_CORE", 0, 0}, {"RLIMIT_NOFILE", Unlimited, Unlimited}},
+		},
+		{
+			name:      "Clamped",
+			ceilings:  ceilings,
+			requested: []string{"nofile=65536"},
+			raise:     true,
+			want:      []Limit{{"RLIMIT_CORE", 0, 0}, {"RLIMIT_NOFILE", 8192, 8192}},
+		},
+		{
+			name:       "Privileged",
+			ceilings:   ceilings,
+			requested:  []string{"nofile=65536"},
+			privileged: true,
+			raise:      true,
+			want:       []Limit{{"RLIMIT_CORE", 0, 0}, {"RLIMIT_NOFILE", 65536, 65536}},
+		},
+		{
+			name:      "NoRaise",
+			requested: []string{"nofile=unlimited"},
+			want:      []Limit{{"RLIMIT_CORE", 0, 0}, {"RLIMIT_NOFILE", hard, hard}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resolve(defaults, tt.ceilings, tt.requested, tt.privileged, tt.raise)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Resolve(defaults, ceilings, []string{"cpu=1"}, false, true); err == nil {
+		t.Errorf("unexpected success with an unsupported resource")
+	}
+}
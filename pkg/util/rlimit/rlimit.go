@@ -20,3 +20,8 @@ func Set(res string, cur uint64, max uint64) error {
 func Get(res string) (cur uint64, max uint64, err error) {
 	return 0, 0, fmt.Errorf("not supported on this platform")
 }
+
+// Resource returns the resource number of the resource type res
+func Resource(res string) (int, error) {
+	return 0, fmt.Errorf("not supported on this platform")
+}
@@ -68,3 +68,12 @@ func Get(res string) (cur uint64, max uint64, err error) {
 
 	return
 }
+
+// Resource returns the resource number of the resource type res
+func Resource(res string) (int, error) {
+	resVal, ok := resource[res]
+	if !ok {
+		return 0, fmt.Errorf("%s is not a valid resource type", res)
+	}
+	return resVal, nil
+}
@@ -34,6 +34,7 @@ type File struct {
 	MountTmp                bool     `default:"yes" authorized:"yes,no" directive:"mount tmp"`
 	MountHostfs             bool     `default:"no" authorized:"yes,no" directive:"mount hostfs"`
 	UserBindControl         bool     `default:"yes" authorized:"yes,no" directive:"user bind control"`
+	MaxBindGlobMatches      uint     `default:"64" directive:"max bind glob matches"`
 	EnableFusemount         bool     `default:"yes" authorized:"yes,no" directive:"enable fusemount"`
 	EnableUnderlay          bool     `default:"yes" authorized:"yes,no" directive:"enable underlay"`
 	MountSlave              bool     `default:"yes" authorized:"yes,no" directive:"mount slave"`
@@ -46,9 +47,15 @@ type File struct {
 	SharedLoopDevices       bool     `default:"no" authorized:"yes,no" directive:"shared loop devices"`
 	MaxLoopDevices          uint     `default:"256" directive:"max loop devices"`
 	SessiondirMaxSize       uint     `default:"16" directive:"sessiondir max size"`
+	SessiondirType          string   `default:"memory" authorized:"memory,disk" directive:"sessiondir type"`
+	SessiondirPath          string   `default:"/var/tmp" directive:"sessiondir path"`
+	ShmSize                 string   `directive:"shm size"`
+	DefaultRlimit           []string `directive:"default rlimit"`
+	MaxRlimit               []string `directive:"max rlimit"`
 	MountDev                string   `default:"yes" authorized:"yes,no,minimal" directive:"mount dev"`
 	EnableOverlay           string   `default:"try" authorized:"yes,no,try,driver" directive:"enable overlay"`
 	BindPath                []string `default:"/etc/localtime,/etc/hosts" directive:"bind path"`
+	BindProfile             []string `directive:"bind profile" split:"no"`
 	LimitContainerOwners    []string `directive:"limit container owners"`
 	LimitContainerGroups    []string `directive:"limit container groups"`
 	LimitContainerPaths     []string `directive:"limit container paths"`
@@ -59,8 +66,20 @@ type File struct {
 	MksquashfsPath          string   `directive:"mksquashfs path"`
 	MksquashfsProcs         uint     `default:"0" directive:"mksquashfs procs"`
 	MksquashfsMem           string   `directive:"mksquashfs mem"`
+	PostBuildHook           string   `directive:"post build hook"`
+	PostBuildHookTimeout    uint     `default:"300" directive:"post build hook timeout"`
+	AllowSkipScan           bool     `default:"no" authorized:"yes,no" directive:"allow skip scan"`
+	PrestartHostHook        string   `directive:"prestart host hook"`
+	PoststopHostHook        string   `directive:"poststop host hook"`
+	HostHookTimeout         uint     `default:"30" directive:"host hook timeout"`
+	ImageUsageStats         string   `default:"cache" authorized:"no,cache,all" directive:"image usage stats"`
+	ShellHistoryIsolation   bool     `default:"yes" authorized:"yes,no" directive:"shell history isolation"`
+	ContainerLoaderEnv      string   `default:"pass" authorized:"pass,strip" directive:"container loader env"`
+	SanitizePath            bool     `default:"no" authorized:"yes,no" directive:"sanitize path"`
 	CryptsetupPath          string   `directive:"cryptsetup path"`
 	ImageDriver             string   `directive:"image driver"`
+	DenySetuidBinaries      bool     `default:"no" authorized:"yes,no" directive:"deny setuid binaries"`
+	EventLog                string   `directive:"event log"`
 }
 
 const TemplateAsset = `# SINGULARITY.CONF
@@ -177,6 +196,32 @@ mount hostfs = {{ if eq .MountHostfs true }}yes{{ else }}no{{ end }}
 bind path = {{$path}}
 {{ end -}}
 {{ end }}
+# BIND PROFILE: [STRING]
+# DEFAULT: Undefined
+# Define bind profiles, named sets of host files and directories to bind,
+# environment variables to set and container library directories to add to
+# LD_LIBRARY_PATH, applied with 'singularity run --profile <name>' or
+# automatically to the members of the profile groups. Each entry has the
+# format '<name> <key> = <value>' where key is one of:
+#   bind    - a bind path, with the --bind format
+#   env     - an environment variable, with the KEY=VALUE format
+#   ld path - a container directory appended to LD_LIBRARY_PATH
+#   group   - a group whose members get the profile applied automatically
+# A profile can also be defined by a file named <name>.conf in the profiles.d
+# directory of the configuration directory, holding one 'key = value' entry
+# per line. Profile binds are system binds, mounted before the user binds even
+# with 'user bind control = no', their variables are overridden by the ones
+# set by the user and their library paths are appended to the LD_LIBRARY_PATH
+# set by the image and the user.
+#bind profile = ucx bind = /opt/ucx:/opt/ucx:ro
+#bind profile = ucx env = UCX_TLS=rc,sm,self
+#bind profile = ucx ld path = /opt/ucx/lib
+#bind profile = ucx group = hpc
+{{ range $profile := .BindProfile }}
+{{- if ne $profile "" -}}
+bind profile = {{$profile}}
+{{ end -}}
+{{ end }}
 # USER BIND CONTROL: [BOOL]
 # DEFAULT: yes
 # Allow users to influence and/or define bind points at runtime? This will allow
@@ -184,6 +229,13 @@ bind path = {{$path}}
 # control is only allowed if the host also supports PR_SET_NO_NEW_PRIVS)
 user bind control = {{ if eq .UserBindControl true }}yes{{ else }}no{{ end }}
 
+# MAX BIND GLOB MATCHES: [INT]
+# DEFAULT: 64
+# Maximum number of host paths a wildcard pattern in the source of a user bind
+# path (e.g. --bind '/scratch/job-*:/scratch/') can match. Set to 0 to disable
+# the expansion of wildcard patterns, sources are then taken literally.
+max bind glob matches = {{ .MaxBindGlobMatches }}
+
 # ENABLE FUSEMOUNT: [BOOL]
 # DEFAULT: yes
 # Allow users to mount fuse filesystems inside containers with the --fusemount
@@ -217,8 +269,61 @@ mount slave = {{ if eq .MountSlave true }}yes{{ else }}no{{ end }}
 # This specifies how large the default sessiondir should be (in MB) and it will
 # only affect users who use the "--contain" options and don't also specify a
 # location to do default read/writes to (e.g. "--workdir" or "--home").
+# The size is grown by this value again when the "--writable-tmpfs" option is
+# used and when the home directory is stored in the sessiondir, as they are
+# stored in the sessiondir too. It only applies to a "memory" sessiondir type.
 sessiondir max size = {{ .SessiondirMaxSize }}
 
+# SESSIONDIR TYPE: [STRING]
+# DEFAULT: memory
+# This specifies where the sessiondir is stored: "memory" stores it in a
+# temporary filesystem of the memory fs type, limited by the sessiondir max
+# size, "disk" stores it in a temporary directory created in the sessiondir
+# path, useful when the data staged in the sessiondir doesn't fit in memory.
+# Users running without setuid can store their sessiondir on disk in another
+# directory with the SINGULARITY_SESSIONDIR environment variable.
+sessiondir type = {{ .SessiondirType }}
+
+# SESSIONDIR PATH: [STRING]
+# DEFAULT: /var/tmp
+# This specifies the directory where the temporary sessiondir directories are
+# created when the sessiondir type is "disk", they are removed when the
+# container exits.
+sessiondir path = {{ .SessiondirPath }}
+
+# SHM SIZE: [STRING]
+# DEFAULT: Undefined
+# This specifies the default size of the /dev/shm temporary filesystem created
+# when /dev isn't shared with the host ("--contain" option or "mount dev" set to
+# minimal), e.g. 64M for 64mb or 1G for 1gb. When undefined the memory fs type
+# default size applies (half of the host memory for tmpfs). Users can request
+# another size with the "--shm-size" option.
+# shm size = 64M
+{{ if ne .ShmSize "" }}shm size = {{ .ShmSize }}{{ end }}
+
+# DEFAULT RLIMIT: [STRING]
+# DEFAULT: NULL
+# Resource limits applied to the container process, before dropping
+# privileges, with the format name=soft[:hard] where name is one of core,
+# memlock, nofile, nproc or stack, and soft and hard are a number or
+# unlimited. Users can override them with the "--rlimit" option.
+#default rlimit = nofile=65536:65536, stack=unlimited
+{{ range $index, $limit := .DefaultRlimit }}
+{{- if eq $index 0 }}default rlimit = {{ else }}, {{ end }}{{$limit}}
+{{- end }}
+
+# MAX RLIMIT: [STRING]
+# DEFAULT: NULL
+# Maximum resource limits a non-root user can request with the "--rlimit"
+# option, with the same format as "default rlimit", the hard value is the
+# ceiling of both limits. Requested limits above are clamped with a warning.
+# Without a maximum for a resource, a user can't raise its hard limit above
+# the current one, even with the setuid workflow.
+#max rlimit = nofile=1048576, memlock=unlimited
+{{ range $index, $limit := .MaxRlimit }}
+{{- if eq $index 0 }}max rlimit = {{ else }}, {{ end }}{{$limit}}
+{{- end }}
+
 # LIMIT CONTAINER OWNERS: [STRING]
 # DEFAULT: NULL
 # Only allow containers to be used that are owned by a given user. If this
@@ -327,6 +432,107 @@ mksquashfs procs = {{ .MksquashfsProcs }}
 # mksquashfs mem = 1G
 {{ if ne .MksquashfsMem "" }}mksquashfs mem = {{ .MksquashfsMem }}{{ end }}
 
+# POST BUILD HOOK: [STRING]
+# DEFAULT: Undefined
+# This allows the administrator to specify a command scanning every image
+# after it is built, and on demand with "singularity scan". The first %s
+# in the command is replaced by the image path (the path is appended if
+# there is none), the path of a JSON file describing the image is passed as
+# the last argument. The command runs as the calling user (or nobody when
+# running as root outside of a sudo session), a non-zero exit status fails
+# the build. Its standard output is recorded in the image as a scan report.
+# post build hook = /usr/bin/myscanner %s
+{{ if ne .PostBuildHook "" }}post build hook = {{ .PostBuildHook }}{{ end }}
+
+# POST BUILD HOOK TIMEOUT: [UINT]
+# DEFAULT: 300
+# Maximum time in seconds the post build hook is allowed to run before it
+# is killed and the scan is considered failed.
+post build hook timeout = {{ .PostBuildHookTimeout }}
+
+# ALLOW SKIP SCAN: [BOOL]
+# DEFAULT: no
+# Should we allow users to skip the post build hook with the "--skip-scan"
+# build option?
+allow skip scan = {{ if eq .AllowSkipScan true }}yes{{ else }}no{{ end }}
+
+# PRESTART HOST HOOK: [STRING]
+# DEFAULT: Undefined
+# This allows the administrator to specify an executable run on the host
+# once a container is set up, right before the container process starts.
+# The hook runs as root when Singularity runs setuid (it must then be owned
+# by root and only writable by its owner), and as the calling user otherwise.
+# A JSON description of the container (image, user, bind mounts and
+# namespaces) is passed on its standard input. A non-zero exit status aborts
+# the container execution and its standard error is reported to the user.
+# prestart host hook = /usr/libexec/site/prestart
+{{ if ne .PrestartHostHook "" }}prestart host hook = {{ .PrestartHostHook }}{{ end }}
+
+# POSTSTOP HOST HOOK: [STRING]
+# DEFAULT: Undefined
+# This allows the administrator to specify an executable run on the host,
+# under the same conditions as the prestart host hook, once a container
+# exited. The JSON description passed on its standard input also holds the
+# container exit code. A failure is reported but doesn't change the outcome.
+# poststop host hook = /usr/libexec/site/poststop
+{{ if ne .PoststopHostHook "" }}poststop host hook = {{ .PoststopHostHook }}{{ end }}
+
+# HOST HOOK TIMEOUT: [UINT]
+# DEFAULT: 30
+# Maximum time in seconds the prestart and poststop host hooks are allowed
+# to run before they are killed and considered failed.
+host hook timeout = {{ .HostHookTimeout }}
+
+# IMAGE USAGE STATS: [STRING]
+# DEFAULT: cache
+# Record, for each user, when and how many times the images are run in a
+# local database in the user's ~/.singularity directory, displayed by
+# 'singularity cache list --verbose' and 'singularity cache stats'. The
+# statistics are never sent off the node.
+# Possible values are:
+# no: nothing is recorded.
+# cache: only the images of the user cache are recorded.
+# all: the local image files run are also recorded.
+image usage stats = {{ .ImageUsageStats }}
+
+# SHELL HISTORY ISOLATION: [BOOL]
+# DEFAULT: yes
+# Record the history of 'singularity shell' sessions in a file per image in
+# the user's ~/.singularity/shell_history directory instead of the shell
+# history file of the host, when the user home directory is mounted in the
+# container. Users can still choose the history file with --history-file.
+shell history isolation = {{ if eq .ShellHistoryIsolation true }}yes{{ else }}no{{ end }}
+
+# CONTAINER LOADER ENV: [pass/strip]
+# DEFAULT: pass
+# Environment variables changing the behavior of the dynamic loader and of
+# the C library are never passed to the programs Singularity executes with
+# privileges (cryptsetup, FUSE mount programs, CNI plugins, the
+# --keep-privs-prelude command). This controls whether they are passed to the
+# container process when set on the host or with SINGULARITYENV_, --env and
+# --env-file:
+# - pass: pass them to the container process
+# - strip: remove them from the container process environment
+# The variables are: LD_PRELOAD, LD_LIBRARY_PATH, LD_AUDIT, LD_DEBUG,
+# LD_DEBUG_OUTPUT, LD_PROFILE, LD_PROFILE_OUTPUT, LD_ORIGIN_PATH,
+# LD_DYNAMIC_WEAK, LD_USE_LOAD_BIAS, LD_SHOW_AUXV, LD_HWCAP_MASK,
+# GLIBC_TUNABLES, GCONV_PATH, GETCONF_DIR, LOCPATH, NLSPATH, MALLOC_TRACE,
+# HOSTALIASES, RESOLV_HOST_CONF, RES_OPTIONS, LOCALDOMAIN, NIS_PATH and TZDIR.
+# The variables set by the container environment scripts in /.singularity.d/env
+# are not affected.
+container loader env = {{ .ContainerLoaderEnv }}
+
+# SANITIZE PATH: [BOOL]
+# DEFAULT: no
+# Reset the PATH of the container process to the default container PATH
+# (/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin) once the
+# container environment is set, discarding the directories added by the image
+# environment and with SINGULARITYENV_PATH, SINGULARITYENV_PREPEND_PATH and
+# SINGULARITYENV_APPEND_PATH. This is the default of the --sanitize-path
+# option of action commands, users can still disable it with
+# --sanitize-path=false.
+sanitize path = {{ if eq .SanitizePath true }}yes{{ else }}no{{ end }}
+
 # CRYPTSETUP PATH: [STRING]
 # DEFAULT: Undefined
 # This allows the administrator to specify the location of cryptsetup if
@@ -350,4 +556,25 @@ shared loop devices = {{ if eq .SharedLoopDevices true }}yes{{ else }}no{{ end }
 # If the driver name specified has not been registered via a plugin installation
 # the run-time will abort.
 image driver = {{ .ImageDriver }}
+
+# DENY SETUID BINARIES: [BOOL]
+# DEFAULT: no
+# Always mount the container root filesystem with nosuid, so setuid and setgid
+# binaries in images never run with elevated privileges, even when root uses
+# --allow-setuid. The --allow-setuid option is refused for images reported to
+# hold setuid files by their metadata ('singularity inspect --special-files'),
+# unless root also sets --override-setuid-policy.
+deny setuid binaries = {{ if eq .DenySetuidBinaries true }}yes{{ else }}no{{ end }}
+
+# EVENT LOG: [STRING]
+# DEFAULT: Undefined
+# Path of a file or of a unix socket receiving a JSON object, on a single
+# line, when a container starts and when it stops, for accounting collectors.
+# Events report the PID of the container process, the image, the user and
+# the time, stop events add the exit code and the resource usage (rusage) of
+# the container process and of the descendants it waited for. A file is
+# created if needed and appended to, events are sent as datagrams to a unix
+# datagram socket or written to a unix stream socket.
+#event log = /var/log/singularity/events.log
+{{ if ne .EventLog "" }}event log = {{ .EventLog }}{{ end }}
 `
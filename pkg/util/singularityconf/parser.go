@@ -70,6 +70,22 @@ func HasDirective(directive string) bool {
 	return false
 }
 
+// SplitsValues returns if the values of the directive are comma separated
+// lists, values of directives tagged with split:"no" are kept whole.
+func SplitsValues(directive string) bool {
+	elem := reflect.ValueOf(new(File)).Elem()
+
+	for i := 0; i < elem.NumField(); i++ {
+		typeField := elem.Type().Field(i)
+
+		if typeField.Tag.Get("directive") == directive {
+			return typeField.Tag.Get("split") != "no"
+		}
+	}
+
+	return true
+}
+
 // GetConfig sets the corresponding interface fields associated
 // with directives.
 func GetConfig(directives Directives) (*File, error) {
@@ -99,11 +115,19 @@ func GetConfig(directives Directives) (*File, error) {
 
 		kind := typeField.Type.Kind()
 
+		// values are comma separated lists, unless the field
+		// is tagged with split:"no"
+		split := typeField.Tag.Get("split") != "no"
+
 		value := []string{}
 		if len(directives[dir]) > 0 {
 			for _, dv := range directives[dir] {
-				if dv != "" {
+				if dv == "" {
+					continue
+				} else if split {
 					value = append(value, strings.Split(dv, ",")...)
+				} else {
+					value = append(value, dv)
 				}
 			}
 		} else {
@@ -118,6 +118,7 @@ func TestGetConfig(t *testing.T) {
 
 	directives["max loop devices"] = []string{"42"}
 	directives["bind path"] = []string{"/etc/hosts"}
+	directives["bind profile"] = []string{"ucx env = UCX_TLS=rc,sm"}
 
 	config, err := GetConfig(directives)
 	if err != nil {
@@ -135,6 +136,9 @@ func TestGetConfig(t *testing.T) {
 	if !reflect.DeepEqual(config.BindPath, directives["bind path"]) {
 		t.Errorf("bad value for BindPath: %v", config.BindPath)
 	}
+	if !reflect.DeepEqual(config.BindProfile, directives["bind profile"]) {
+		t.Errorf("bad value for BindProfile: %v", config.BindProfile)
+	}
 }
 
 func TestHasDirective(t *testing.T) {
@@ -148,3 +152,12 @@ func TestHasDirective(t *testing.T) {
 		t.Errorf("'fake directive' should not be present")
 	}
 }
+
+func TestSplitsValues(t *testing.T) {
+	if !SplitsValues("bind path") {
+		t.Errorf("'bind path' values should be split")
+	}
+	if SplitsValues("bind profile") {
+		t.Errorf("'bind profile' values should not be split")
+	}
+}
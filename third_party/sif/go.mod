@@ -0,0 +1,9 @@
+module github.com/sylabs/sif
+
+go 1.13
+
+require (
+	github.com/satori/go.uuid v1.2.0
+	github.com/spf13/cobra v1.0.0
+	golang.org/x/crypto v0.0.0-20200604202706-70a84ac30bf9
+)
@@ -0,0 +1,36 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package sif
+
+import (
+	"syscall"
+)
+
+// mmapFile maps the size bytes of the file fd in memory, privately when
+// rdonly is set, shared otherwise.
+func mmapFile(fd uintptr, size int64, rdonly bool) ([]byte, error) {
+	prot := syscall.PROT_READ
+	flags := syscall.MAP_PRIVATE
+
+	if !rdonly {
+		prot = syscall.PROT_WRITE
+		flags = syscall.MAP_SHARED
+	}
+
+	aligned := nextAligned(size, syscall.Getpagesize())
+	if int64(int(aligned)) < size {
+		return nil, errMapTooBig
+	}
+
+	return syscall.Mmap(int(fd), 0, int(aligned), prot, flags)
+}
+
+// munmapFile unmaps the data mapped by mmapFile.
+func munmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
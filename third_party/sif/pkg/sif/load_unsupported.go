@@ -0,0 +1,18 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package sif
+
+// mmapFile maps the size bytes of the file fd in memory.
+func mmapFile(fd uintptr, size int64, rdonly bool) ([]byte, error) {
+	return nil, errNoMmap
+}
+
+// munmapFile unmaps the data mapped by mmapFile.
+func munmapFile(data []byte) error {
+	return nil
+}